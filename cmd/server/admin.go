@@ -0,0 +1,561 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/password"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+	"github.com/the-monkeys/monkeys-identity/internal/signing"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+// commandError is the error of an admin command that ran, as opposed to a
+// usage error cobra reports before running it
+type commandError struct{ err error }
+
+func (e commandError) Error() string { return e.err.Error() }
+func (e commandError) Unwrap() error { return e.err }
+
+// ran wraps the function of a command so its errors are told apart from
+// usage errors
+func ran(fn func() error) func(*cobra.Command, []string) error {
+	return func(*cobra.Command, []string) error {
+		if err := fn(); err != nil {
+			return commandError{err}
+		}
+		return nil
+	}
+}
+
+// adminCommand builds the "admin" subcommand. Commands work on the database
+// directly through the queries layer, so they need only DATABASE_URL and
+// bypass the API's authorization; changes are recorded in the audit log
+// without a principal and with source admin_cli.
+func adminCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "admin",
+		Short: "Administer the identity server from the command line",
+		Args:  cobra.ArbitraryArgs,
+		RunE:  requireSubcommand,
+	}
+
+	org := &cobra.Command{Use: "org", Short: "Manage organizations", Args: cobra.ArbitraryArgs, RunE: requireSubcommand}
+	org.AddCommand(adminCreateOrgCommand())
+	cmd.AddCommand(
+		org,
+		adminCreateUserCommand(),
+		adminAssignRoleCommand(),
+		adminPurgeAuditCommand(),
+		adminRotateKeysCommand(),
+		adminBuildBreachFilterCommand(),
+	)
+	return cmd
+}
+
+// requireSubcommand runs in place of commands that only group others
+func requireSubcommand(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s needs a command", cmd.CommandPath())
+	}
+	return fmt.Errorf("unknown command %q for %q", args[0], cmd.CommandPath())
+}
+
+// runAdmin runs the "admin" subcommand and returns its exit status: 2 for
+// usage errors, 1 when the command failed
+func runAdmin(args []string) int {
+	root := &cobra.Command{Use: "monkeys-identity", SilenceErrors: true, SilenceUsage: true}
+	root.CompletionOptions.DisableDefaultCmd = true
+	root.AddCommand(adminCommand())
+	root.SetArgs(append([]string{"admin"}, args...))
+	err := root.Execute()
+	if err == nil {
+		return 0
+	}
+	fmt.Fprintln(os.Stderr, err)
+	var failed commandError
+	if errors.As(err, &failed) {
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, `Run "monkeys-identity admin --help" for usage.`)
+	return 2
+}
+
+// adminQueries connects to DATABASE_URL. Redis is not needed by any admin
+// command.
+func adminQueries() (*queries.Queries, func(), error) {
+	db, err := connectCLIDatabase()
+	if err != nil {
+		return nil, nil, err
+	}
+	return queries.New(db, nil), func() { db.Close() }, nil
+}
+
+// resolveOrg accepts an organization ID or slug
+func resolveOrg(q *queries.Queries, ref string) (*models.Organization, error) {
+	if _, err := uuid.Parse(ref); err == nil {
+		return q.Organization.GetOrganization(ref)
+	}
+	return q.Organization.GetOrganizationBySlug(ref)
+}
+
+// resolveUser accepts a user ID or email address
+func resolveUser(q *queries.Queries, ref, orgID string) (*models.User, error) {
+	if strings.Contains(ref, "@") {
+		return q.Auth.GetUserByEmail(strings.ToLower(ref), orgID)
+	}
+	return q.User.GetUser(ref, orgID)
+}
+
+// resolveRoleID accepts a role ID or name
+func resolveRoleID(q *queries.Queries, ref, orgID string) (string, error) {
+	if _, err := uuid.Parse(ref); err == nil {
+		role, err := q.Role.GetRole(ref, orgID)
+		if err != nil {
+			return "", err
+		}
+		return role.ID, nil
+	}
+	return q.Role.GetRoleIDByName(ref, orgID)
+}
+
+func logAdminEvent(q *queries.Queries, orgID, action, resourceType, resourceID string) {
+	err := q.Audit.LogAuditEvent(models.AuditEvent{
+		ID:                uuid.New().String(),
+		EventID:           fmt.Sprintf("EVT-%d", time.Now().UnixNano()),
+		OrganizationID:    orgID,
+		Action:            action,
+		ResourceType:      utils.StringPtr(resourceType),
+		ResourceID:        utils.StringPtr(resourceID),
+		Result:            "success",
+		Severity:          "warn",
+		UserAgent:         utils.StringPtr("monkeys-identity admin"),
+		AdditionalContext: `{"source": "admin_cli"}`,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to write audit event: %v\n", err)
+	}
+}
+
+func adminCreateOrgCommand() *cobra.Command {
+	var name, slug, description string
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create an organization",
+		Args:  cobra.NoArgs,
+		RunE:  ran(func() error { return adminCreateOrg(name, slug, description) }),
+	}
+	cmd.Flags().StringVar(&name, "name", "", "organization name")
+	cmd.Flags().StringVar(&slug, "slug", "", "URL-safe identifier (default: derived from the name)")
+	cmd.Flags().StringVar(&description, "description", "", "description")
+	cmd.MarkFlagRequired("name")
+	return cmd
+}
+
+func adminCreateOrg(name, slug, description string) error {
+	q, closeDB, err := adminQueries()
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	org := &models.Organization{
+		ID:           uuid.New().String(),
+		Name:         strings.TrimSpace(name),
+		Slug:         slug,
+		Description:  &description,
+		Metadata:     "{}",
+		Settings:     "{}",
+		BillingTier:  "free",
+		MaxUsers:     100,
+		MaxResources: 1000,
+		Status:       "active",
+	}
+	if org.Slug == "" {
+		org.Slug = strings.ToLower(strings.ReplaceAll(org.Name, " ", "-"))
+	}
+	if err := q.Organization.CreateOrganization(org); err != nil {
+		return fmt.Errorf("failed to create organization: %w", err)
+	}
+	if err := services.SeedSystemRoles(q.Role, org.ID); err != nil {
+		return fmt.Errorf("failed to seed system roles: %w", err)
+	}
+
+	logAdminEvent(q, org.ID, "create_organization", "organization", org.ID)
+	fmt.Printf("created organization %s (%s)\n", org.ID, org.Slug)
+	return nil
+}
+
+func adminCreateUserCommand() *cobra.Command {
+	var orgRef, email, username, displayName, role string
+	cmd := &cobra.Command{
+		Use:   "create-user",
+		Short: "Create a user in an organization",
+		Long: "Create a user in an organization. The password is read from MONKEYS_ADMIN_PASSWORD rather than a flag, " +
+			"so it does not end up in shell history or the process list.",
+		Args: cobra.NoArgs,
+		RunE: ran(func() error { return adminCreateUser(orgRef, email, username, displayName, role) }),
+	}
+	cmd.Flags().StringVar(&orgRef, "org", "", "organization ID or slug")
+	cmd.Flags().StringVar(&email, "email", "", "email address")
+	cmd.Flags().StringVar(&username, "username", "", "username (default: the email's local part)")
+	cmd.Flags().StringVar(&displayName, "display-name", "", "display name")
+	cmd.Flags().StringVar(&role, "role", "user", "role name to assign")
+	cmd.MarkFlagRequired("org")
+	cmd.MarkFlagRequired("email")
+	return cmd
+}
+
+func adminCreateUser(orgRef, email, username, displayName, role string) error {
+	// Read the password from the environment rather than a flag so it does
+	// not end up in shell history or the process list
+	initialPassword := os.Getenv("MONKEYS_ADMIN_PASSWORD")
+	if len(initialPassword) < 8 {
+		return errors.New("set MONKEYS_ADMIN_PASSWORD to the new user's password (at least 8 characters)")
+	}
+
+	q, closeDB, err := adminQueries()
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	org, err := resolveOrg(q, orgRef)
+	if err != nil {
+		return fmt.Errorf("organization %s: %w", orgRef, err)
+	}
+
+	// The CLI hashes with the default parameters; the server rehashes with
+	// the configured ones at the user's first login
+	hash, err := password.Hash(initialPassword)
+	if err != nil {
+		return err
+	}
+
+	addr := strings.ToLower(strings.TrimSpace(email))
+	if username == "" {
+		username = strings.SplitN(addr, "@", 2)[0]
+	}
+	now := time.Now()
+	user := &models.User{
+		ID:             uuid.NewString(),
+		Email:          addr,
+		Username:       username,
+		DisplayName:    displayName,
+		OrganizationID: org.ID,
+		PasswordHash:   hash,
+		EmailVerified:  true,
+		Status:         "active",
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := q.User.CreateUser(user); err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	roleID := ""
+	if role == "user" {
+		err = q.Role.EnsureRoleByName("user", "Standard user with basic access", org.ID, &roleID)
+	} else {
+		roleID, err = resolveRoleID(q, role, org.ID)
+	}
+	if err == nil {
+		err = q.Role.AssignRole(&models.RoleAssignment{
+			ID:            uuid.NewString(),
+			RoleID:        roleID,
+			PrincipalID:   user.ID,
+			PrincipalType: "user",
+		}, org.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("created user %s but failed to assign role %s: %w", user.ID, role, err)
+	}
+
+	logAdminEvent(q, org.ID, "create_user", "user", user.ID)
+	fmt.Printf("created user %s (%s) in %s with role %s\n", user.ID, user.Email, org.Slug, role)
+	return nil
+}
+
+func adminAssignRoleCommand() *cobra.Command {
+	var orgRef, userRef, role string
+	var expires time.Duration
+	cmd := &cobra.Command{
+		Use:   "assign-role",
+		Short: "Assign a role to a user",
+		Args:  cobra.NoArgs,
+		RunE:  ran(func() error { return adminAssignRole(orgRef, userRef, role, expires) }),
+	}
+	cmd.Flags().StringVar(&orgRef, "org", "", "organization ID or slug")
+	cmd.Flags().StringVar(&userRef, "user", "", "user ID or email")
+	cmd.Flags().StringVar(&role, "role", "", "role ID or name")
+	cmd.Flags().DurationVar(&expires, "expires-in", 0, "expire the assignment after this long (default: never)")
+	cmd.MarkFlagRequired("org")
+	cmd.MarkFlagRequired("user")
+	cmd.MarkFlagRequired("role")
+	return cmd
+}
+
+func adminAssignRole(orgRef, userRef, role string, expires time.Duration) error {
+	q, closeDB, err := adminQueries()
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	org, err := resolveOrg(q, orgRef)
+	if err != nil {
+		return fmt.Errorf("organization %s: %w", orgRef, err)
+	}
+	user, err := resolveUser(q, userRef, org.ID)
+	if err != nil {
+		return fmt.Errorf("user %s: %w", userRef, err)
+	}
+	if user == nil {
+		return fmt.Errorf("user %s: user not found", userRef)
+	}
+	roleID, err := resolveRoleID(q, role, org.ID)
+	if err != nil {
+		return fmt.Errorf("role %s: %w", role, err)
+	}
+
+	assignment := &models.RoleAssignment{
+		ID:            uuid.NewString(),
+		RoleID:        roleID,
+		PrincipalID:   user.ID,
+		PrincipalType: "user",
+	}
+	if expires > 0 {
+		at := time.Now().Add(expires)
+		assignment.ExpiresAt = &at
+	}
+	if err := q.Role.AssignRole(assignment, org.ID); err != nil {
+		return fmt.Errorf("failed to assign role: %w", err)
+	}
+
+	logAdminEvent(q, org.ID, "assign_role", "role", roleID)
+	fmt.Printf("assigned role %s to %s\n", role, user.Email)
+	return nil
+}
+
+func adminPurgeAuditCommand() *cobra.Command {
+	var orgRef string
+	var days int
+	cmd := &cobra.Command{
+		Use:   "purge-audit",
+		Short: "Delete old audit events of an organization",
+		Args:  cobra.NoArgs,
+		PreRunE: func(*cobra.Command, []string) error {
+			if days < 1 {
+				return errors.New("--older-than-days must be at least 1")
+			}
+			return nil
+		},
+		RunE: ran(func() error { return adminPurgeAudit(orgRef, days) }),
+	}
+	cmd.Flags().StringVar(&orgRef, "org", "", "organization ID or slug")
+	cmd.Flags().IntVar(&days, "older-than-days", 0, "delete events older than this many days")
+	cmd.MarkFlagRequired("org")
+	cmd.MarkFlagRequired("older-than-days")
+	return cmd
+}
+
+func adminPurgeAudit(orgRef string, days int) error {
+	q, closeDB, err := adminQueries()
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	org, err := resolveOrg(q, orgRef)
+	if err != nil {
+		return fmt.Errorf("organization %s: %w", orgRef, err)
+	}
+
+	deleted, err := q.Audit.DeleteOldAuditEvents(time.Duration(days)*24*time.Hour, org.ID)
+	if err != nil {
+		return fmt.Errorf("failed to purge audit events: %w", err)
+	}
+
+	// Logged after the purge so the record of it survives
+	logAdminEvent(q, org.ID, "purge_audit_events", "organization", org.ID)
+	fmt.Printf("deleted %d audit event(s) older than %d days from %s\n", deleted, days, org.Slug)
+	return nil
+}
+
+// adminRotateKeys writes a new signing key and the current key's public half.
+// The server reads keys from its environment, so the operator points
+// JWT_PRIVATE_KEY_FILE at the new key and adds the retired key to
+// JWT_VERIFY_KEY_FILES; tokens signed with the old key keep validating
+// until they expire.
+func adminRotateKeysCommand() *cobra.Command {
+	var dir string
+	cmd := &cobra.Command{
+		Use:   "rotate-oidc-keys",
+		Short: "Generate a new token signing key and retire the current one",
+		Args:  cobra.NoArgs,
+		RunE:  ran(func() error { return adminRotateKeys(dir) }),
+	}
+	cmd.Flags().StringVar(&dir, "dir", "keys", "directory to write the key files to")
+	return cmd
+}
+
+func adminRotateKeys(dir string) error {
+	current := os.Getenv("JWT_PRIVATE_KEY")
+	if current == "" {
+		if file := os.Getenv("JWT_PRIVATE_KEY_FILE"); file != "" {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("failed to read JWT_PRIVATE_KEY_FILE: %w", err)
+			}
+			current = string(data)
+		}
+	}
+	current = strings.ReplaceAll(current, `\n`, "\n")
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+	newFile := filepath.Join(dir, "signing-"+signing.KeyID(&key.PublicKey)+".pem")
+	newPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(newFile, newPEM, 0o600); err != nil {
+		return err
+	}
+
+	verifyFiles := os.Getenv("JWT_VERIFY_KEY_FILES")
+	if current != "" {
+		old, err := utils.LoadRSAPrivateKey(current)
+		if err != nil {
+			return fmt.Errorf("failed to parse the current signing key: %w", err)
+		}
+		pubDER, err := x509.MarshalPKIXPublicKey(&old.PublicKey)
+		if err != nil {
+			return err
+		}
+		retiredFile := filepath.Join(dir, "retired-"+signing.KeyID(&old.PublicKey)+".pem")
+		if err := os.WriteFile(retiredFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o644); err != nil {
+			return err
+		}
+		if verifyFiles != "" {
+			verifyFiles += ","
+		}
+		verifyFiles += retiredFile
+	}
+
+	fmt.Printf("new signing key: %s (kid %s)\n\n", newFile, signing.KeyID(&key.PublicKey))
+	fmt.Println("Update the server environment and restart every replica:")
+	fmt.Printf("  JWT_PRIVATE_KEY=\n  JWT_PRIVATE_KEY_FILE=%s\n", newFile)
+	if verifyFiles != "" {
+		fmt.Printf("  JWT_VERIFY_KEY_FILES=%s\n", verifyFiles)
+	}
+	fmt.Println("\nRemove retired keys from JWT_VERIFY_KEY_FILES once the tokens they signed have expired.")
+	return nil
+}
+
+// adminBuildBreachFilter turns the downloadable "SHA1:COUNT" list of breached
+// password hashes into the bloom filter read by
+// BREACHED_PASSWORD_BLOOM_FILE. The list is read twice, once to size the
+// filter and once to fill it.
+func adminBuildBreachFilterCommand() *cobra.Command {
+	var in, out string
+	var fpRate float64
+	var minCount int
+	cmd := &cobra.Command{
+		Use:   "build-breach-filter",
+		Short: "Build the offline breached password filter from a hash list",
+		Args:  cobra.NoArgs,
+		PreRunE: func(*cobra.Command, []string) error {
+			if fpRate <= 0 || fpRate >= 1 {
+				return errors.New("--fp-rate must be between 0 and 1")
+			}
+			return nil
+		},
+		RunE: ran(func() error { return adminBuildBreachFilter(in, out, fpRate, minCount) }),
+	}
+	cmd.Flags().StringVar(&in, "in", "", "hash list, one uppercase SHA-1 hex digest and count per line")
+	cmd.Flags().StringVar(&out, "out", "", "file to write the filter to")
+	cmd.Flags().Float64Var(&fpRate, "fp-rate", 0.001, "false positive rate of the filter")
+	cmd.Flags().IntVar(&minCount, "min-count", 1, "skip hashes seen fewer times than this")
+	cmd.MarkFlagRequired("in")
+	cmd.MarkFlagRequired("out")
+	return cmd
+}
+
+func adminBuildBreachFilter(in, out string, fpRate float64, minCount int) error {
+	var count uint64
+	if err := scanBreachList(in, minCount, func([]byte) { count++ }); err != nil {
+		return err
+	}
+	filter := utils.NewBloomFilter(count, fpRate)
+	if err := scanBreachList(in, minCount, filter.Add); err != nil {
+		return err
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if _, err := filter.WriteTo(w); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write the filter: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write the filter: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %d hash(es) to %s\n", count, out)
+	return nil
+}
+
+// scanBreachList calls add with the decoded hash of every line of the list
+// seen at least minCount times
+func scanBreachList(path string, minCount int, add func([]byte)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		digest, countText, _ := strings.Cut(text, ":")
+		hash, err := hex.DecodeString(digest)
+		if err != nil || len(hash) != 20 {
+			return fmt.Errorf("%s:%d: not a SHA-1 hex digest", path, line)
+		}
+		if countText != "" {
+			if n, err := strconv.Atoi(countText); err == nil && n < minCount {
+				continue
+			}
+		}
+		add(hash)
+	}
+	return scanner.Err()
+}
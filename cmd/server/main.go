@@ -20,14 +20,23 @@
 //	@name						Authorization
 //	@description				Type "Bearer" followed by a space and JWT token.
 //
+//	@securityDefinitions.apikey	ApiKeyAuth
+//	@in							header
+//	@name						X-API-Key
+//	@description				Service account API key as "<key_id>:<secret>".
+//
 //	@schemes	http https
 package main
 
 import (
 	"context"
 	"log"
+	"net/url"
+	"os"
 	"os/exec"
+	"os/signal"
 	"runtime"
+	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -36,14 +45,25 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/gofiber/swagger"
 	"github.com/joho/godotenv"
-	_ "github.com/the-monkeys/monkeys-identity/docs" // Import swagger docs
+	"github.com/the-monkeys/monkeys-identity/docs" // Swagger docs
+	"github.com/the-monkeys/monkeys-identity/internal/auditexport"
 	"github.com/the-monkeys/monkeys-identity/internal/config"
 	"github.com/the-monkeys/monkeys-identity/internal/database"
+	"github.com/the-monkeys/monkeys-identity/internal/detection"
+	"github.com/the-monkeys/monkeys-identity/internal/encryption"
+	"github.com/the-monkeys/monkeys-identity/internal/events"
+	"github.com/the-monkeys/monkeys-identity/internal/handlers"
+	"github.com/the-monkeys/monkeys-identity/internal/jobs"
+	"github.com/the-monkeys/monkeys-identity/internal/metrics"
 	"github.com/the-monkeys/monkeys-identity/internal/middleware"
+	"github.com/the-monkeys/monkeys-identity/internal/password"
 	"github.com/the-monkeys/monkeys-identity/internal/queries"
 	"github.com/the-monkeys/monkeys-identity/internal/routes"
 	"github.com/the-monkeys/monkeys-identity/internal/services"
+	"github.com/the-monkeys/monkeys-identity/internal/storage"
+	"github.com/the-monkeys/monkeys-identity/migrations"
 	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
 )
 
 func main() {
@@ -52,25 +72,123 @@ func main() {
 		log.Println("No .env file found")
 	}
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			os.Exit(runMigrate(os.Args[2:]))
+		case "admin":
+			os.Exit(runAdmin(os.Args[2:]))
+		}
+	}
+
 	// Initialize configuration
-	cfg := config.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
 
 	// Initialize logger
 	appLogger := logger.New(cfg.LogLevel)
 
-	// Initialize database
-	db, err := database.Connect(cfg.DatabaseURL)
+	hasher, err := password.FromConfig(cfg)
+	if err != nil {
+		appLogger.Fatal("Invalid password hashing configuration: %v", err)
+	}
+	password.SetDefault(hasher)
+
+	// Wait for dependencies; in container deployments Postgres and Redis
+	// often come up after the API
+	startupTimeout := time.Duration(cfg.StartupTimeoutSeconds) * time.Second
+
+	var db *database.DB
+	err = waitFor(appLogger, "database", startupTimeout, func() error {
+		var err error
+		db, err = database.Connect(cfg.DatabaseURL)
+		return err
+	})
 	if err != nil {
 		appLogger.Fatal("Failed to connect to database: %v", err)
 	}
-	defer db.Close()
+	db.SetRowLevelSecurity(cfg.RowLevelSecurity)
+	if cfg.RowLevelSecurity {
+		appLogger.Info("Row-level security scopes transactional queries only; other queries rely on their organization filters")
+	}
+	if err := db.ConnectReplicas(cfg.ReplicaURLs, cfg.ReplicaMaxLag); err != nil {
+		appLogger.Fatal("Failed to configure database replicas: %v", err)
+	}
+	for _, r := range db.Replicas() {
+		if !r.Healthy() {
+			appLogger.Warn("Database replica %s is unavailable or lagging; reads fall back to the primary", r.Name)
+		}
+	}
 
-	// Initialize Redis
-	redis, err := database.ConnectRedis(cfg.RedisURL)
+	if cfg.AutoMigrate {
+		migrator, err := database.NewMigrator(db.DB, migrations.FS)
+		if err != nil {
+			appLogger.Fatal("Failed to load migrations: %v", err)
+		}
+		applied, err := migrator.Up(context.Background())
+		if err != nil {
+			appLogger.Fatal("Failed to migrate database: %v", err)
+		}
+		appLogger.Info("Applied %d database migration(s)", applied)
+	}
+
+	redis, err := database.ConnectRedis(cfg.RedisURL, database.RedisOptions{
+		Password:     cfg.RedisPassword,
+		PoolSize:     cfg.RedisPoolSize,
+		MinIdleConns: cfg.RedisMinIdleConns,
+		TLSCAFile:    cfg.RedisTLSCAFile,
+	})
+	if err != nil {
+		appLogger.Fatal("Failed to connect to Redis: %v", err)
+	}
+	err = waitFor(appLogger, "Redis", startupTimeout, func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return redis.Ping(ctx).Err()
+	})
 	if err != nil {
 		appLogger.Fatal("Failed to connect to Redis: %v", err)
 	}
-	defer redis.Close()
+	// Installed after the startup wait so it cannot delay boot; from here on
+	// a Redis outage degrades caching instead of stalling requests
+	redisBreaker := database.NewRedisBreaker(cfg.RedisBreakerThreshold, cfg.RedisBreakerCooldown)
+	redis.AddHook(redisBreaker)
+
+	// TOTP secrets, backup codes and the configured user attributes are
+	// sealed with a data key wrapped by the master key
+	masterKey, err := encryption.FromConfig(cfg)
+	if err != nil {
+		appLogger.Fatal("Invalid field encryption configuration: %v", err)
+	}
+	var keyring *encryption.Keyring
+	if masterKey != nil {
+		keyring, err = encryption.NewKeyring(masterKey, queries.NewEncryptionKeyQueries(db, redis))
+		if err != nil {
+			appLogger.Fatal("Failed to load data encryption keys: %v", err)
+		}
+		db.SetFieldCipher(keyring, cfg.EncryptedUserAttributes)
+	} else if keys, err := queries.NewEncryptionKeyQueries(db, redis).ListDataKeys(); err == nil && len(keys) > 0 {
+		appLogger.Fatal("Encrypted fields are stored but no encryption master key is configured")
+	} else {
+		appLogger.Warn("No encryption master key configured; TOTP secrets and backup codes are stored unencrypted")
+	}
+
+	// Fiber's limit is the largest of the per route group limits, which
+	// the routes narrow down (see middleware.BodyLimits)
+	bodyLimit := int(cfg.AttachmentMaxBytes) + 64*1024 // room for the multipart framing
+	for _, n := range []int{cfg.BodyLimitAuth, cfg.BodyLimitDefault, cfg.BodyLimitPolicy, cfg.BodyLimitContent, cfg.BodyLimitImport} {
+		if n > bodyLimit {
+			bodyLimit = n
+		}
+	}
+
+	clientIPs, err := middleware.NewClientIPResolver(cfg.TrustedProxies)
+	if err != nil {
+		appLogger.Fatal("Invalid trusted proxies: %v", err)
+	}
+	clientIPs.SetCountryHeader(cfg.ClientCountryHeader)
 
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
@@ -78,22 +196,77 @@ func main() {
 		DisableStartupMessage: false,
 		AppName:               "Monkeys IAM v1.0",
 		ServerHeader:          "Monkeys-IAM",
-		BodyLimit:             4 * 1024 * 1024, // 4MB
+		BodyLimit:             bodyLimit,
+		// Every BodyParser call rejects deeply nested or huge JSON documents
+		JSONDecoder: utils.LimitedJSONDecoder(cfg.JSONMaxDepth, cfg.JSONMaxArrayLength),
 	})
 
-	// Global middleware
+	// Global middleware; the prefix is stripped first, see StripPathPrefix
+	app.Use(middleware.StripPathPrefix(cfg.PathPrefix()))
 	app.Use(recover.New())
 	app.Use(requestid.New())
+	app.Use(middleware.RequestContext(clientIPs))
+	app.Use(middleware.SecurityHeaders(middleware.SecurityHeadersConfig{
+		HSTSMaxAge:            cfg.HSTSMaxAge,
+		HSTSIncludeSubdomains: cfg.HSTSIncludeSubdomains,
+		SwaggerPrefix:         "/swagger",
+	}))
+	if cfg.MetricsEnabled {
+		app.Use(metrics.Middleware())
+	}
 	app.Use(fiberLogger.New(fiberLogger.Config{
-		Format: "[${time}] ${status} - ${method} ${path} - ${ip} - ${latency}\n",
+		Format: "[${time}] ${status} - ${method} ${path} - ${locals:client_ip} - ${latency}\n",
 	}))
 
 	// Dynamic CORS — origins are loaded from the database per-organization
 	// and cached in Redis. Static origins from ALLOWED_ORIGINS env var are
-	// always included. No restart needed when a new tenant registers.
+	// always included. Changes are published to every replica over Redis
+	// pub/sub, so no restart is needed when a tenant updates its origins.
 	dynamicCORS := middleware.NewDynamicCORS(db.DB, redis, appLogger, cfg.AllowedOrigins)
+	dynamicCORS.Start(context.Background())
 	app.Use(dynamicCORS.Handler())
 
+	// Probes: /live only says the process is up; /ready also checks
+	// dependencies and turns unhealthy as soon as shutdown begins. The
+	// email and signing key checks are added with the routes.
+	healthHandler := handlers.NewHealthHandler(db, redis)
+	app.Get("/live", healthHandler.Live)
+	app.Get("/ready", healthHandler.Ready)
+	app.Get("/health/ready", healthHandler.Ready)
+
+	if cfg.MetricsEnabled {
+		metrics.RegisterDBStats(db.DB, "postgres")
+		metrics.RegisterRedisBreaker(redisBreaker.Open)
+		for _, r := range db.Replicas() {
+			metrics.RegisterDBStats(r.DB, r.Name)
+			metrics.RegisterReplica(r.Name, r.Healthy, r.Lag)
+		}
+		sessionQueries := queries.New(db, redis).Session
+		metrics.RegisterActiveSessions(func(ctx context.Context) (int, error) {
+			return sessionQueries.WithContext(ctx).CountAllActiveSessions()
+		})
+		userQueries := queries.New(db, redis).User
+		metrics.RegisterPasswordHashes(func(ctx context.Context) ([]metrics.PasswordHashCount, error) {
+			schemes, err := userQueries.WithContext(ctx).CountPasswordHashSchemes()
+			if err != nil {
+				return nil, err
+			}
+			totals := make(map[metrics.PasswordHashCount]int)
+			for scheme, n := range schemes {
+				algorithm := password.Algorithm(scheme)
+				current := algorithm == hasher.Algorithm() && !hasher.NeedsRehash(scheme)
+				totals[metrics.PasswordHashCount{Algorithm: algorithm, Current: current}] += n
+			}
+			counts := make([]metrics.PasswordHashCount, 0, len(totals))
+			for key, n := range totals {
+				key.Count = n
+				counts = append(counts, key)
+			}
+			return counts, nil
+		})
+		app.Get("/metrics", metrics.Handler(cfg.MetricsToken))
+	}
+
 	// Health check
 	//
 	//	@Summary		Health check
@@ -110,13 +283,19 @@ func main() {
 		})
 	})
 
-	// Swagger documentation routes
+	// Swagger documentation routes; "Try it out" calls the API at PUBLIC_URL
+	if public, err := url.Parse(cfg.PublicURL); err == nil {
+		docs.SwaggerInfo.Host = public.Host
+		docs.SwaggerInfo.BasePath = cfg.PathPrefix() + "/api/v1"
+		docs.SwaggerInfo.Schemes = []string{public.Scheme}
+	}
+	swaggerIndex := cfg.PathPrefix() + "/swagger/index.html"
 	app.Get("/swagger/*", swagger.HandlerDefault)
 	app.Get("/", func(c *fiber.Ctx) error {
-		return c.Redirect("/swagger/index.html")
+		return c.Redirect(swaggerIndex)
 	})
 	app.Get("/docs", func(c *fiber.Ctx) error {
-		return c.Redirect("/swagger/index.html")
+		return c.Redirect(swaggerIndex)
 	})
 
 	// API routes
@@ -126,13 +305,115 @@ func main() {
 	// Initialize services
 	auditQueries := queries.New(db, redis).Audit
 	auditService := services.NewAuditService(auditQueries, appLogger)
+	// Events written are also exported to the SIEM sinks of their organization
+	auditExport := auditexport.NewManager(auditQueries, cfg.AuditExportQueueSize, appLogger)
+	auditExport.Start(context.Background())
+	auditService.AddExporter(auditExport)
+	// and matched against the security rules of their organization
+	detector := detection.NewEngine(auditQueries, queries.New(db, redis).Policy, detection.NewRedisCounter(redis), appLogger)
+	auditService.AddExporter(detector)
 	auditService.Start(context.Background())
-	defer auditService.Stop()
+	decisionLog := services.NewDecisionLog(queries.New(db, redis), cfg.AuthzDecisionSampleRate,
+		time.Duration(cfg.AuthzDecisionRetentionDays)*24*time.Hour, appLogger)
+	decisionLog.Start(context.Background())
+	accessLog := services.NewAccessLog(queries.New(db, redis), cfg.ResourceAccessLogRetentionDays, appLogger)
+	accessLog.Start(context.Background())
+
+	// Background jobs; every replica runs the scheduler and a Redis lock
+	// ensures each job run happens on only one of them
+	scheduler := jobs.NewScheduler(redis, appLogger)
+	userPurgeService := services.NewUserPurgeService(queries.New(db, redis).User, time.Duration(cfg.UserPurgeGraceDays)*24*time.Hour, appLogger)
+	if err := userPurgeService.RegisterJobs(scheduler); err != nil {
+		appLogger.Fatal("Failed to register user purge job: %v", err)
+	}
+	if err := decisionLog.RegisterJobs(scheduler); err != nil {
+		appLogger.Fatal("Failed to register authz decision purge job: %v", err)
+	}
+	if err := accessLog.RegisterJobs(scheduler); err != nil {
+		appLogger.Fatal("Failed to register resource access log purge job: %v", err)
+	}
+	if err := services.NewSystemRoleService(queries.New(db, redis), appLogger).RegisterJobs(scheduler); err != nil {
+		appLogger.Fatal("Failed to register system role reconciliation job: %v", err)
+	}
+	if err := services.NewContentCounterService(queries.New(db, redis), redis, appLogger).RegisterJobs(scheduler); err != nil {
+		appLogger.Fatal("Failed to register content counter flush job: %v", err)
+	}
+	if err := services.NewUsageRollupService(queries.New(db, redis).Stats, appLogger).RegisterJobs(scheduler); err != nil {
+		appLogger.Fatal("Failed to register org usage rollup job: %v", err)
+	}
+	if err := services.NewImpersonationService(queries.New(db, redis).Session, redis, auditService, appLogger).RegisterJobs(scheduler); err != nil {
+		appLogger.Fatal("Failed to register impersonation expiry job: %v", err)
+	}
+	if err := services.NewSessionExpiryService(queries.New(db, redis).Session, appLogger).RegisterJobs(scheduler); err != nil {
+		appLogger.Fatal("Failed to register session expiry job: %v", err)
+	}
+	if err := services.NewFieldEncryptionService(keyring, queries.New(db, redis).User, cfg.EncryptionKeyRotation, appLogger).RegisterJobs(scheduler); err != nil {
+		appLogger.Fatal("Failed to register field re-encryption job: %v", err)
+	}
+	exportStore, err := storage.New(cfg)
+	if err != nil {
+		appLogger.Fatal("Failed to initialize storage: %v", err)
+	}
+	orgDeletionService := services.NewOrganizationDeletionService(queries.New(db, redis), redis, exportStore, auditService,
+		time.Duration(cfg.OrgDeletionGraceDays)*24*time.Hour, appLogger)
+	if err := orgDeletionService.RegisterJobs(scheduler); err != nil {
+		appLogger.Fatal("Failed to register organization deletion job: %v", err)
+	}
 
 	mfaService := services.NewMFAService(appLogger)
 
+	// Global settings are served from memory and reloaded on every replica
+	// when an admin changes them
+	settingsService := services.NewSettingsService(queries.New(db, redis), redis, appLogger)
+	if err := settingsService.Reload(context.Background()); err != nil {
+		appLogger.Warn("Failed to load global settings, using defaults until the next refresh: %v", err)
+	}
+	settingsService.Start(context.Background())
+
+	// Identity events raised by the handlers; subscribers register before
+	// the bus starts
+	eventBus, err := events.New(cfg, redis, appLogger)
+	if err != nil {
+		appLogger.Fatal("Failed to initialize event bus: %v", err)
+	}
+
+	// Notifications are relayed through Redis to the streams open on any replica
+	notificationService := services.NewNotificationService(redis, appLogger)
+	notificationService.Relay(eventBus, queries.New(db, redis).Content)
+	notificationService.Start(context.Background())
+	// Security alerts are also raised from policy and role assignment events
+	detector.Relay(eventBus, notificationService)
+	detector.Start(context.Background())
+	eventBus.Start(context.Background())
+
+	inactiveQueries := queries.New(db, redis)
+	inactiveUserService := services.NewInactiveUserService(inactiveQueries, services.NewEmailService(cfg, inactiveQueries, appLogger),
+		notificationService, eventBus, auditService, appLogger)
+	if err := inactiveUserService.RegisterJobs(scheduler); err != nil {
+		appLogger.Fatal("Failed to register inactive user job: %v", err)
+	}
+	if err := services.NewRoleExpiryService(queries.New(db, redis).Role, eventBus, cfg.RoleExpiryReminderDays, appLogger).RegisterJobs(scheduler); err != nil {
+		appLogger.Fatal("Failed to register role expiry reminder job: %v", err)
+	}
+	if err := services.NewShareExpiryService(queries.New(db, redis), eventBus, cfg.ShareExpiryReminderDays, appLogger).RegisterJobs(scheduler); err != nil {
+		appLogger.Fatal("Failed to register share expiry jobs: %v", err)
+	}
+	if err := services.NewResourceLifecycleService(queries.New(db, redis), eventBus, auditService, appLogger).RegisterJobs(scheduler); err != nil {
+		appLogger.Fatal("Failed to register resource lifecycle job: %v", err)
+	}
+	if err := services.NewResourceIntegrityService(queries.New(db, redis), exportStore, auditService, cfg.ChecksumVerifyInterval, appLogger).RegisterJobs(scheduler); err != nil {
+		appLogger.Fatal("Failed to register checksum verification job: %v", err)
+	}
+	if err := services.NewKMSService(queries.New(db, redis), masterKey, auditService, appLogger).RegisterJobs(scheduler); err != nil {
+		appLogger.Fatal("Failed to register KMS key rotation job: %v", err)
+	}
+	if err := services.NewDirectorySyncService(queries.New(db, redis), eventBus, auditService, appLogger).RegisterJobs(scheduler); err != nil {
+		appLogger.Fatal("Failed to register directory sync job: %v", err)
+	}
+	scheduler.Start()
+
 	// Initialize routes
-	routes.SetupRoutes(app, v1, db, redis, appLogger, cfg, auditService, mfaService, dynamicCORS)
+	routes.SetupRoutes(app, v1, db, redis, appLogger, cfg, auditService, decisionLog, accessLog, mfaService, dynamicCORS, scheduler, settingsService, notificationService, eventBus, healthHandler)
 
 	// Function to open browser
 	openBrowser := func(url string) {
@@ -160,11 +441,21 @@ func main() {
 		port = "8080"
 	}
 
-	serverURL := "http://localhost:" + port
+	tlsSrv, err := newTLSServer(cfg)
+	if err != nil {
+		appLogger.Fatal("Failed to configure TLS: %v", err)
+	}
+	scheme := "http"
+	if tlsSrv != nil {
+		scheme = "https"
+	}
+
+	serverURL := scheme + "://localhost:" + port
 	swaggerURL := serverURL + "/swagger/index.html"
 
 	appLogger.Info("🚀 Starting Monkeys IAM Server...")
 	appLogger.Info("📊 Server URL: %s", serverURL)
+	appLogger.Info("🌐 Public URL: %s", cfg.PublicURL)
 	appLogger.Info("📖 API Documentation: %s", swaggerURL)
 	appLogger.Info("🔍 Opening Swagger UI in your browser...")
 
@@ -174,7 +465,88 @@ func main() {
 		openBrowser(swaggerURL)
 	}()
 
-	if err := app.Listen(":" + port); err != nil {
+	listenErr := make(chan error, 1)
+	go func() {
+		if tlsSrv == nil {
+			listenErr <- app.Listen(":" + port)
+			return
+		}
+		ln, err := tlsSrv.listener(port)
+		if err != nil {
+			listenErr <- err
+			return
+		}
+		listenErr <- app.Listener(ln)
+	}()
+	if tlsSrv != nil {
+		tlsSrv.startRedirect(listenErr)
+	}
+	healthHandler.SetReady(true)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-listenErr:
 		appLogger.Fatal("Failed to start server: %v", err)
+	case sig := <-quit:
+		appLogger.Info("Received %s, shutting down...", sig)
+	}
+
+	// Fail readiness first so load balancers stop routing new requests here,
+	// then let in-flight requests finish before tearing down dependencies
+	healthHandler.SetReady(false)
+	// Notification streams never finish on their own: end them so that
+	// clients reconnect to another replica
+	notificationService.Stop()
+	shutdownTimeout := time.Duration(cfg.ShutdownTimeoutSeconds) * time.Second
+	if err := app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+		appLogger.Error("HTTP server shutdown: %v", err)
+	}
+	if tlsSrv != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		if err := tlsSrv.shutdown(ctx); err != nil {
+			appLogger.Error("HTTP redirect server shutdown: %v", err)
+		}
+		cancel()
+	}
+
+	scheduler.Stop()
+	eventBus.Stop()
+	settingsService.Stop()
+	dynamicCORS.Stop()
+	decisionLog.Stop()
+	accessLog.Stop()
+	auditService.Stop()
+	auditExport.Stop()
+	detector.Stop()
+
+	if err := redis.Close(); err != nil {
+		appLogger.Error("Failed to close Redis: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		appLogger.Error("Failed to close database: %v", err)
+	}
+	appLogger.Info("Server stopped")
+}
+
+// waitFor retries connect with exponential backoff until it succeeds or the
+// timeout elapses
+func waitFor(l *logger.Logger, name string, timeout time.Duration, connect func() error) error {
+	deadline := time.Now().Add(timeout)
+	backoff := 500 * time.Millisecond
+	for {
+		err := connect()
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return err
+		}
+		l.Warn("Waiting for %s: %v (retrying in %s)", name, err, backoff)
+		time.Sleep(backoff)
+		if backoff < 8*time.Second {
+			backoff *= 2
+		}
 	}
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/the-monkeys/monkeys-identity/internal/database"
+	"github.com/the-monkeys/monkeys-identity/migrations"
+)
+
+const migrateUsage = `usage: monkeys-identity migrate <command>
+
+commands:
+  up            apply all pending migrations
+  down [N]      roll back the last N migrations (default 1)
+  status        show the current and pending versions
+  force V       mark version V as applied after repairing a failed migration`
+
+// runMigrate implements the "migrate" subcommand. Only DATABASE_URL is
+// needed, so it works before the rest of the environment is configured.
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	db, err := connectCLIDatabase()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db.DB, migrations.FS)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load migrations: %v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "applied %d migration(s), then: %v\n", applied, err)
+			return 1
+		}
+		fmt.Printf("applied %d migration(s)\n", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, "down takes a positive number of steps")
+				return 2
+			}
+		}
+		rolledBack, err := migrator.Down(ctx, steps)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "rolled back %d migration(s), then: %v\n", rolledBack, err)
+			return 1
+		}
+		fmt.Printf("rolled back %d migration(s)\n", rolledBack)
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read status: %v\n", err)
+			return 1
+		}
+		dirty := ""
+		if status.Dirty {
+			dirty = " (dirty)"
+		}
+		fmt.Printf("current version: %d%s\nlatest version:  %d\n", status.Version, dirty, status.Latest)
+		for _, m := range status.Pending {
+			fmt.Printf("pending: %06d_%s\n", m.Version, m.Name)
+		}
+	case "force":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "force takes a version")
+			return 2
+		}
+		version, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "force takes a numeric version")
+			return 2
+		}
+		if err := migrator.Force(ctx, version); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to force version: %v\n", err)
+			return 1
+		}
+		fmt.Printf("forced version %d\n", version)
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
+
+// connectCLIDatabase connects to DATABASE_URL for the command line tools,
+// which do not need the rest of the server configuration
+func connectCLIDatabase() (*database.DB, error) {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		return nil, errors.New("DATABASE_URL is not set")
+	}
+	db, err := database.Connect(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return db, nil
+}
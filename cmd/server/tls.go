@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/config"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsServer terminates TLS in the server itself, with a certificate from
+// files or obtained from Let's Encrypt, for deployments without a proxy
+type tlsServer struct {
+	config *tls.Config
+	// redirect serves HTTP_REDIRECT_PORT: ACME HTTP-01 challenges when
+	// autocert is used, and redirects to HTTPS
+	redirect *http.Server
+}
+
+// newTLSServer returns nil when TLS is not configured
+func newTLSServer(cfg *config.Config) (*tlsServer, error) {
+	if cfg.TLSCertFile == "" && len(cfg.TLSAutocertDomains) == 0 {
+		return nil, nil
+	}
+
+	s := &tlsServer{config: strictTLSConfig(cfg.TLSMinVersion)}
+	if cfg.MTLSClientAuth {
+		// Certificates are not verified against a CA: each one is pinned to a
+		// service account by its fingerprint
+		s.config.ClientAuth = tls.RequestClientCert
+	}
+	var redirect http.Handler = redirectToHTTPS(cfg.Port)
+	if cfg.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		s.config.Certificates = []tls.Certificate{cert}
+	} else {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.TLSAutocertDomains...),
+			Cache:      autocert.DirCache(cfg.TLSAutocertCacheDir),
+			Email:      cfg.TLSAutocertEmail,
+		}
+		s.config.GetCertificate = m.GetCertificate
+		// TLS-ALPN-01 challenges are answered on the TLS port itself
+		s.config.NextProtos = append(s.config.NextProtos, "acme-tls/1")
+		redirect = m.HTTPHandler(redirect)
+	}
+
+	if cfg.HTTPRedirectPort != "" {
+		s.redirect = &http.Server{
+			Addr:              ":" + cfg.HTTPRedirectPort,
+			Handler:           redirect,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+	}
+	return s, nil
+}
+
+// strictTLSConfig allows TLS 1.2 with forward-secret AEAD suites only, or
+// TLS 1.3 only
+func strictTLSConfig(minVersion string) *tls.Config {
+	c := &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+	}
+	if minVersion == "1.3" {
+		c.MinVersion = tls.VersionTLS13
+	}
+	return c
+}
+
+// listener wraps a TCP listener on port in TLS
+func (s *tlsServer) listener(port string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewListener(ln, s.config), nil
+}
+
+// startRedirect serves the redirect port in the background, reporting a
+// failure to listen on errs
+func (s *tlsServer) startRedirect(errs chan<- error) {
+	if s.redirect == nil {
+		return
+	}
+	go func() {
+		if err := s.redirect.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errs <- err
+		}
+	}()
+}
+
+func (s *tlsServer) shutdown(ctx context.Context) error {
+	if s.redirect == nil {
+		return nil
+	}
+	return s.redirect.Shutdown(ctx)
+}
+
+// redirectToHTTPS redirects to the same URL on the TLS port
+func redirectToHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,226 @@
+// Package apierror defines the single error envelope returned by every API
+// endpoint and the catalog of machine-readable error codes.
+//
+// Every error response has the shape:
+//
+//	{
+//	  "success": false,
+//	  "code": "not_found",
+//	  "error": "not_found",
+//	  "message": "User not found",
+//	  "details": { ... },
+//	  "request_id": "2f1c..."
+//	}
+//
+// "code" is the stable, machine-readable identifier from the catalog below and
+// "message" is a human-readable explanation that may change between releases.
+// "error" mirrors "code" for clients written against the previous envelope and
+// is deprecated. "details" is optional and code-specific.
+//
+// OAuth 2.0 / OIDC protocol endpoints (authorize, token, userinfo) are exempt:
+// RFC 6749 mandates their error format.
+package apierror
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Code is a machine-readable error code
+type Code string
+
+// Error code catalog. Codes are part of the public API contract: new codes may
+// be added, existing ones are never renamed or repurposed.
+const (
+	// 400 Bad Request
+	CodeInvalidRequest        Code = "invalid_request"
+	CodeValidationFailed      Code = "validation_failed"
+	CodeInvalidPolicyDocument Code = "invalid_policy_document"
+
+	// 401 Unauthorized
+	CodeUnauthorized       Code = "unauthorized"
+	CodeInvalidCredentials Code = "invalid_credentials"
+	CodeInvalidToken       Code = "invalid_token"
+	CodeTokenExpired       Code = "token_expired"
+	CodeTokenRevoked       Code = "token_revoked"
+	CodeSessionExpired     Code = "session_expired"
+
+	// 403 Forbidden
+	CodeForbidden               Code = "forbidden"
+	CodeAccountSuspended        Code = "account_suspended"
+	CodeAccountInactive         Code = "account_inactive"
+	CodeAccountDeleted          Code = "account_deleted"
+	CodeChallengeRequired       Code = "challenge_required"
+	CodeChallengeFailed         Code = "challenge_failed"
+	CodeCSRFInvalid             Code = "csrf_invalid"
+	CodeMFARequired             Code = "mfa_required"
+	CodeImpersonationRestricted Code = "impersonation_restricted"
+	CodeOrganizationDisabled    Code = "organization_disabled"
+
+	// 404 Not Found
+	CodeNotFound Code = "not_found"
+
+	// 409 Conflict
+	CodeConflict        Code = "conflict"
+	CodeExportNotReady  Code = "export_not_ready"
+	CodeVersionConflict Code = "version_conflict"
+	CodeSoDViolation    Code = "sod_violation"
+
+	// 413 Payload Too Large
+	CodePayloadTooLarge Code = "payload_too_large"
+	CodeQuotaExceeded   Code = "quota_exceeded"
+
+	// 428 Precondition Required
+	CodePreconditionRequired Code = "precondition_required"
+
+	// 429 Too Many Requests
+	CodeRateLimited Code = "rate_limited"
+
+	// 500 Internal Server Error
+	CodeInternal Code = "internal_error"
+
+	// 502 Bad Gateway
+	CodeUpstreamError Code = "upstream_error"
+
+	// 503 Service Unavailable
+	CodeServiceUnavailable Code = "service_unavailable"
+)
+
+// CatalogEntry documents a single error code
+type CatalogEntry struct {
+	Code        Code   `json:"code"`
+	Status      int    `json:"status"`
+	Description string `json:"description"`
+}
+
+// Catalog lists every error code the API may return together with its
+// default HTTP status
+var Catalog = []CatalogEntry{
+	{CodeInvalidRequest, fiber.StatusBadRequest, "The request is malformed: unparsable body, missing or invalid path/query parameters."},
+	{CodeValidationFailed, fiber.StatusBadRequest, "The request is well-formed but one or more fields failed validation."},
+	{CodeInvalidPolicyDocument, fiber.StatusBadRequest, "The supplied policy document is not valid JSON or does not follow the policy grammar."},
+	{CodeUnauthorized, fiber.StatusUnauthorized, "Authentication is required or the authentication context is incomplete."},
+	{CodeInvalidCredentials, fiber.StatusUnauthorized, "The supplied credentials (password, MFA code, client secret) are wrong."},
+	{CodeInvalidToken, fiber.StatusUnauthorized, "The bearer token is malformed, has an invalid signature or unexpected claims."},
+	{CodeTokenExpired, fiber.StatusUnauthorized, "The bearer token has expired."},
+	{CodeTokenRevoked, fiber.StatusUnauthorized, "The bearer token or its session has been revoked."},
+	{CodeForbidden, fiber.StatusForbidden, "The caller is authenticated but not allowed to perform this operation."},
+	{CodeAccountSuspended, fiber.StatusForbidden, "The account has been suspended by an administrator."},
+	{CodeAccountInactive, fiber.StatusForbidden, "The account is not active, e.g. the email address has not been verified."},
+	{CodeAccountDeleted, fiber.StatusForbidden, "The account has been deleted."},
+	{CodeChallengeRequired, fiber.StatusForbidden, "A CAPTCHA or proof-of-work challenge must be solved; details describe the challenge."},
+	{CodeChallengeFailed, fiber.StatusForbidden, "The challenge response is invalid, expired or was already used."},
+	{CodeCSRFInvalid, fiber.StatusForbidden, "A cookie-authenticated request did not echo the csrf_token cookie in the X-CSRF-Token header."},
+	{CodeMFARequired, fiber.StatusForbidden, "The operation requires a recent MFA verification of the session; details carry max_age_seconds."},
+	{CodeImpersonationRestricted, fiber.StatusForbidden, "The operation, such as a password or MFA change, is not available in a session a root user opened as the user."},
+	{CodeOrganizationDisabled, fiber.StatusForbidden, "The organization of the account is scheduled for deletion; its users and service accounts can no longer sign in."},
+	{CodeNotFound, fiber.StatusNotFound, "The addressed resource does not exist or is not visible to the caller."},
+	{CodeConflict, fiber.StatusConflict, "The request conflicts with the current state, e.g. a duplicate name or email."},
+	{CodeExportNotReady, fiber.StatusConflict, "The requested export has not finished yet."},
+	{CodeVersionConflict, fiber.StatusConflict, "The resource changed since the version named by If-Match was read; details carry current_version."},
+	{CodeSoDViolation, fiber.StatusConflict, "The role assignment or group membership would let a principal hold roles a separation-of-duties rule keeps apart; details carry the conflicts."},
+	{CodePayloadTooLarge, fiber.StatusRequestEntityTooLarge, "The request body exceeds the allowed size."},
+	{CodeQuotaExceeded, fiber.StatusRequestEntityTooLarge, "The upload would take the organization over its storage quota; details carry quota_bytes and used_bytes."},
+	{CodePreconditionRequired, fiber.StatusPreconditionRequired, "The update must name the version it is based on with If-Match or lock_version."},
+	{CodeRateLimited, fiber.StatusTooManyRequests, "Too many requests; retry after the indicated delay."},
+	{CodeInternal, fiber.StatusInternalServerError, "An unexpected server error occurred. Quote the request_id when reporting it."},
+	{CodeUpstreamError, fiber.StatusBadGateway, "An external system the operation depends on, such as an audit sink, rejected or failed the request; details carry its error."},
+	{CodeServiceUnavailable, fiber.StatusServiceUnavailable, "A dependency is unavailable or the service is in maintenance mode."},
+}
+
+// CodeForStatus returns the generic catalog code for an HTTP status
+func CodeForStatus(status int) Code {
+	switch status {
+	case fiber.StatusBadRequest, fiber.StatusMethodNotAllowed, fiber.StatusUnsupportedMediaType, fiber.StatusUnprocessableEntity:
+		return CodeInvalidRequest
+	case fiber.StatusUnauthorized:
+		return CodeUnauthorized
+	case fiber.StatusForbidden:
+		return CodeForbidden
+	case fiber.StatusNotFound:
+		return CodeNotFound
+	case fiber.StatusConflict:
+		return CodeConflict
+	case fiber.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case fiber.StatusPreconditionRequired:
+		return CodePreconditionRequired
+	case fiber.StatusTooManyRequests:
+		return CodeRateLimited
+	case fiber.StatusBadGateway:
+		return CodeUpstreamError
+	case fiber.StatusServiceUnavailable:
+		return CodeServiceUnavailable
+	}
+	if status >= 400 && status < 500 {
+		return CodeInvalidRequest
+	}
+	return CodeInternal
+}
+
+// Response is the JSON error envelope
+type Response struct {
+	Success   bool        `json:"success"`
+	Code      Code        `json:"code"`
+	Error     Code        `json:"error"` // Deprecated: mirrors Code
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// Error is an error carrying everything needed to render the envelope. Handlers
+// may return it and let the global error handler write the response.
+type Error struct {
+	Status  int
+	Code    Code
+	Message string
+	Details interface{}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// New creates an Error
+func New(status int, code Code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// WithDetails returns a copy of the error carrying details
+func (e *Error) WithDetails(details interface{}) *Error {
+	cp := *e
+	cp.Details = details
+	return &cp
+}
+
+// Respond writes the error envelope
+func Respond(c *fiber.Ctx, status int, code Code, message string, details ...interface{}) error {
+	resp := Response{
+		Success:   false,
+		Code:      code,
+		Error:     code,
+		Message:   message,
+		RequestID: RequestID(c),
+	}
+	if len(details) > 0 {
+		resp.Details = details[0]
+	}
+	return c.Status(status).JSON(resp)
+}
+
+// RespondError writes the envelope for an Error
+func RespondError(c *fiber.Ctx, err *Error) error {
+	if err.Details != nil {
+		return Respond(c, err.Status, err.Code, err.Message, err.Details)
+	}
+	return Respond(c, err.Status, err.Code, err.Message)
+}
+
+// RequestID returns the ID assigned to the request by the requestid middleware
+func RequestID(c *fiber.Ctx) string {
+	if id, ok := c.Locals("requestid").(string); ok && id != "" {
+		return id
+	}
+	return string(c.Response().Header.Peek(fiber.HeaderXRequestID))
+}
@@ -0,0 +1,169 @@
+// Package auditexport streams the audit events of organizations to the SIEM
+// sinks they configured: a Splunk HTTP Event Collector, a syslog server
+// (RFC 5424 over TLS) or NDJSON batches in an S3 bucket.
+//
+// Every replica exports the events it writes itself. Each sink has a bounded
+// queue and a worker sending batches with retries; when a sink falls too far
+// behind, new events for it are dropped and counted instead of slowing down
+// the audit log.
+package auditexport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// Sink types
+const (
+	TypeSplunkHEC = "splunk_hec"
+	TypeSyslog    = "syslog"
+	TypeS3        = "s3"
+)
+
+// secretMask replaces the secrets of a sink configuration in API responses.
+// Sending it back in an update keeps the stored secret.
+const secretMask = "********"
+
+// Destination delivers batches of audit events to a SIEM
+type Destination interface {
+	// Send delivers the events; it is retried with the same batch on error
+	Send(ctx context.Context, events []models.AuditEvent) error
+	// Batching returns the largest batch Send takes and how long the first
+	// event of a batch may wait for more
+	Batching() (size int, wait time.Duration)
+	Close() error
+}
+
+// NewDestination builds the destination of a sink from its configuration
+func NewDestination(sinkType string, config json.RawMessage) (Destination, error) {
+	switch sinkType {
+	case TypeSplunkHEC:
+		var cfg SplunkConfig
+		if err := decodeConfig(config, &cfg); err != nil {
+			return nil, err
+		}
+		return NewSplunkHEC(cfg)
+	case TypeSyslog:
+		var cfg SyslogConfig
+		if err := decodeConfig(config, &cfg); err != nil {
+			return nil, err
+		}
+		return NewSyslog(cfg)
+	case TypeS3:
+		var cfg S3Config
+		if err := decodeConfig(config, &cfg); err != nil {
+			return nil, err
+		}
+		return NewS3(cfg)
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", sinkType)
+	}
+}
+
+// Validate checks a sink configuration without connecting anywhere
+func Validate(sinkType string, config json.RawMessage) error {
+	dest, err := NewDestination(sinkType, config)
+	if err != nil {
+		return err
+	}
+	return dest.Close()
+}
+
+func decodeConfig(config json.RawMessage, v interface{}) error {
+	if len(config) == 0 {
+		return fmt.Errorf("config is required")
+	}
+	if err := json.Unmarshal(config, v); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	return nil
+}
+
+// secretFields lists the configuration fields of each sink type that are
+// never returned by the API
+var secretFields = map[string][]string{
+	TypeSplunkHEC: {"token"},
+	TypeSyslog:    {"client_key"},
+	TypeS3:        {"secret_access_key"},
+}
+
+// Redact returns the configuration with its secrets masked
+func Redact(sinkType string, config json.RawMessage) json.RawMessage {
+	var fields map[string]interface{}
+	if json.Unmarshal(config, &fields) != nil {
+		return json.RawMessage("{}")
+	}
+	for _, name := range secretFields[sinkType] {
+		if v, _ := fields[name].(string); v != "" {
+			fields[name] = secretMask
+		}
+	}
+	redacted, err := json.Marshal(fields)
+	if err != nil {
+		return json.RawMessage("{}")
+	}
+	return redacted
+}
+
+// KeepSecrets fills the secrets left empty or masked in an updated
+// configuration from the current one, so that clients can update a sink
+// from its redacted form
+func KeepSecrets(sinkType string, current, updated json.RawMessage) (json.RawMessage, error) {
+	var cur, upd map[string]interface{}
+	if err := json.Unmarshal(updated, &upd); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if json.Unmarshal(current, &cur) != nil {
+		return updated, nil
+	}
+	for _, name := range secretFields[sinkType] {
+		if v, _ := upd[name].(string); v == "" || v == secretMask {
+			upd[name] = cur[name]
+		}
+	}
+	return json.Marshal(upd)
+}
+
+// TestEvent is the event sent by Test
+func TestEvent(organizationID string) models.AuditEvent {
+	now := time.Now().UTC()
+	return models.AuditEvent{
+		ID:                "00000000-0000-0000-0000-000000000000",
+		EventID:           fmt.Sprintf("EVT-TEST-%d", now.UnixNano()),
+		Timestamp:         now,
+		OrganizationID:    organizationID,
+		Action:            "audit_export_test",
+		Result:            "success",
+		AdditionalContext: `{"message":"Test event from monkeys-identity"}`,
+		Severity:          "info",
+	}
+}
+
+// Test sends a single test event to a sink configuration and reports
+// whether it was accepted
+func Test(ctx context.Context, sink models.AuditSink) error {
+	dest, err := NewDestination(sink.Type, sink.Config)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+	return dest.Send(ctx, []models.AuditEvent{TestEvent(sink.OrganizationID)})
+}
+
+// eventJSON encodes an event for a SIEM, with the additional context as a
+// JSON object rather than a string
+func eventJSON(e models.AuditEvent) ([]byte, error) {
+	type exported models.AuditEvent
+	context := json.RawMessage(e.AdditionalContext)
+	if !json.Valid(context) {
+		context = json.RawMessage("{}")
+	}
+	return json.Marshal(struct {
+		exported
+		AdditionalContext json.RawMessage `json:"additional_context"`
+	}{exported(e), context})
+}
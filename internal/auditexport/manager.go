@@ -0,0 +1,316 @@
+package auditexport
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/metrics"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+const (
+	// refreshInterval is how often sink changes made on any replica are
+	// picked up
+	refreshInterval = 30 * time.Second
+	// maxAttempts bounds the sends of a batch; backoff doubles from
+	// firstBackoff between them
+	maxAttempts    = 5
+	firstBackoff   = time.Second
+	attemptTimeout = time.Minute
+	// flushTimeout bounds the last send of a worker being stopped
+	flushTimeout = 10 * time.Second
+)
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a send error that retrying the same batch cannot fix,
+// such as a rejected token
+func Permanent(err error) error { return permanentError{err} }
+
+// Store loads the sinks events are exported to
+type Store interface {
+	ListEnabledAuditSinks() ([]models.AuditSink, error)
+}
+
+// Manager runs a worker for every enabled sink and hands each audit event
+// to the workers of its organization
+type Manager struct {
+	store     Store
+	queueSize int
+	logger    *logger.Logger
+
+	mu      sync.RWMutex
+	workers map[string]*worker   // by sink ID
+	byOrg   map[string][]*worker // by organization ID
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewManager creates a Manager; queueSize bounds the events waiting for
+// each sink
+func NewManager(store Store, queueSize int, l *logger.Logger) *Manager {
+	return &Manager{
+		store:     store,
+		queueSize: queueSize,
+		logger:    l,
+		workers:   make(map[string]*worker),
+		byOrg:     make(map[string][]*worker),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start loads the sinks and keeps reloading them in the background
+func (m *Manager) Start(ctx context.Context) {
+	if err := m.Reload(); err != nil {
+		m.logger.Warn("Failed to load audit sinks: %v", err)
+	}
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.Reload(); err != nil {
+					m.logger.Warn("Failed to reload audit sinks: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops reloading and stops every worker after a last send of the
+// events it has queued
+func (m *Manager) Stop() {
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+	<-m.done
+
+	m.mu.Lock()
+	workers := m.workers
+	m.workers = make(map[string]*worker)
+	m.byOrg = make(map[string][]*worker)
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			w.close()
+		}(w)
+	}
+	wg.Wait()
+}
+
+// Reload starts workers for new and changed sinks and stops those of sinks
+// that were changed, disabled or deleted
+func (m *Manager) Reload() error {
+	sinks, err := m.store.ListEnabledAuditSinks()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	next := make(map[string]*worker, len(sinks))
+	byOrg := make(map[string][]*worker)
+	for _, sink := range sinks {
+		w, ok := m.workers[sink.ID]
+		if !ok || !w.sink.UpdatedAt.Equal(sink.UpdatedAt) {
+			dest, err := NewDestination(sink.Type, sink.Config)
+			if err != nil {
+				m.logger.Warn("Skipping audit sink %s of organization %s: %v", sink.ID, sink.OrganizationID, err)
+				continue
+			}
+			w = newWorker(sink, dest, m.queueSize, m.logger)
+		}
+		next[sink.ID] = w
+		byOrg[sink.OrganizationID] = append(byOrg[sink.OrganizationID], w)
+	}
+	var retired []*worker
+	for id, w := range m.workers {
+		if next[id] != w {
+			retired = append(retired, w)
+		}
+	}
+	m.workers, m.byOrg = next, byOrg
+	m.mu.Unlock()
+
+	// Export no longer reaches them; let them send what they have queued
+	for _, w := range retired {
+		go w.close()
+	}
+	return nil
+}
+
+// Export queues the event for the sinks of its organization. It never
+// blocks: a sink whose queue is full misses the event.
+func (m *Manager) Export(e models.AuditEvent) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, w := range m.byOrg[e.OrganizationID] {
+		w.offer(e)
+	}
+}
+
+// worker sends the events of one sink in batches
+type worker struct {
+	sink   models.AuditSink
+	dest   Destination
+	logger *logger.Logger
+	queue  chan models.AuditEvent
+
+	dropMu     sync.Mutex
+	lastDropAt time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newWorker(sink models.AuditSink, dest Destination, queueSize int, l *logger.Logger) *worker {
+	w := &worker{
+		sink:   sink,
+		dest:   dest,
+		logger: l,
+		queue:  make(chan models.AuditEvent, queueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *worker) offer(e models.AuditEvent) {
+	select {
+	case w.queue <- e:
+		metrics.AuditExportQueued(w.sink.Type, 1)
+	default:
+		metrics.RecordAuditExport(w.sink.Type, "dropped", 1)
+		w.dropMu.Lock()
+		defer w.dropMu.Unlock()
+		if time.Since(w.lastDropAt) > time.Minute {
+			w.lastDropAt = time.Now()
+			w.logger.Warn("Audit sink %s of organization %s is not keeping up, dropping events", w.sink.ID, w.sink.OrganizationID)
+		}
+	}
+}
+
+func (w *worker) close() {
+	select {
+	case <-w.stop:
+	default:
+		close(w.stop)
+	}
+	<-w.done
+}
+
+func (w *worker) run() {
+	defer close(w.done)
+	defer w.dest.Close()
+
+	size, wait := w.dest.Batching()
+	batch := make([]models.AuditEvent, 0, size)
+	timer := time.NewTimer(wait)
+	timer.Stop()
+	var timeout <-chan time.Time
+
+	for {
+		select {
+		case e := <-w.queue:
+			metrics.AuditExportQueued(w.sink.Type, -1)
+			batch = append(batch, e)
+			if len(batch) == 1 {
+				timer.Reset(wait)
+				timeout = timer.C
+			}
+			if len(batch) < size {
+				continue
+			}
+			if !timer.Stop() {
+				<-timer.C
+			}
+		case <-timeout:
+		case <-w.stop:
+			w.flush(batch, size)
+			return
+		}
+		w.deliver(batch)
+		batch = batch[:0]
+		timeout = nil
+	}
+}
+
+// flush sends the batch and the queued events once each, for a worker
+// being stopped
+func (w *worker) flush(batch []models.AuditEvent, size int) {
+	for {
+		select {
+		case e := <-w.queue:
+			metrics.AuditExportQueued(w.sink.Type, -1)
+			batch = append(batch, e)
+			if len(batch) < size {
+				continue
+			}
+		default:
+		}
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		w.record(batch, time.Now(), w.dest.Send(ctx, batch))
+		cancel()
+		if len(w.queue) == 0 {
+			return
+		}
+		batch = batch[:0]
+	}
+}
+
+// deliver sends a batch, retrying with backoff unless the error is
+// permanent or the worker is stopped
+func (w *worker) deliver(batch []models.AuditEvent) {
+	start := time.Now()
+	backoff := firstBackoff
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), attemptTimeout)
+		err = w.dest.Send(ctx, batch)
+		cancel()
+		if err == nil || errors.As(err, new(permanentError)) || attempt == maxAttempts {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-w.stop:
+			attempt = maxAttempts
+		}
+	}
+	w.record(batch, start, err)
+}
+
+func (w *worker) record(batch []models.AuditEvent, start time.Time, err error) {
+	metrics.ObserveAuditExportBatch(w.sink.Type, time.Since(start))
+	if err != nil {
+		metrics.RecordAuditExport(w.sink.Type, "failed", len(batch))
+		w.logger.Warn("Failed to export %d audit events to sink %s of organization %s: %v",
+			len(batch), w.sink.ID, w.sink.OrganizationID, err)
+		return
+	}
+	metrics.RecordAuditExport(w.sink.Type, "delivered", len(batch))
+}
@@ -0,0 +1,193 @@
+package auditexport
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// S3Config configures an S3 sink, which uploads the events as NDJSON
+// objects, one per batch, under
+// <prefix>/<organization>/<yyyy>/<mm>/<dd>/<time>-<id>.ndjson
+type S3Config struct {
+	Bucket          string `json:"bucket"`
+	Region          string `json:"region"`
+	Endpoint        string `json:"endpoint,omitempty"` // S3-compatible stores; default AWS
+	PathStyle       bool   `json:"path_style,omitempty"`
+	Prefix          string `json:"prefix,omitempty"`
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	// IntervalSeconds is how often a batch is uploaded, default 300
+	IntervalSeconds int `json:"interval_seconds,omitempty"`
+}
+
+// s3MaxBatch bounds the events of one object
+const s3MaxBatch = 10000
+
+// S3 uploads batches of events to a bucket, signing requests with AWS
+// Signature Version 4
+type S3 struct {
+	cfg      S3Config
+	endpoint *url.URL
+	interval time.Duration
+	client   *http.Client
+	now      func() time.Time
+}
+
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Bucket == "" || cfg.Region == "" {
+		return nil, fmt.Errorf("bucket and region are required")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, fmt.Errorf("access_key_id and secret_access_key are required")
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("endpoint must be an http(s) URL")
+	}
+	interval := 5 * time.Minute
+	if cfg.IntervalSeconds != 0 {
+		if cfg.IntervalSeconds < 10 || cfg.IntervalSeconds > 3600 {
+			return nil, fmt.Errorf("interval_seconds must be between 10 and 3600")
+		}
+		interval = time.Duration(cfg.IntervalSeconds) * time.Second
+	}
+	cfg.Prefix = strings.Trim(cfg.Prefix, "/")
+	return &S3{
+		cfg:      cfg,
+		endpoint: u,
+		interval: interval,
+		client:   &http.Client{Timeout: time.Minute},
+		now:      time.Now,
+	}, nil
+}
+
+func (s *S3) Batching() (int, time.Duration) { return s3MaxBatch, s.interval }
+
+// Send uploads the events as one object
+func (s *S3) Send(ctx context.Context, events []models.AuditEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	var body bytes.Buffer
+	for _, e := range events {
+		line, err := eventJSON(e)
+		if err != nil {
+			return Permanent(err)
+		}
+		body.Write(line)
+		body.WriteByte('\n')
+	}
+
+	first := events[0].Timestamp.UTC()
+	key := fmt.Sprintf("%s/%s/%s-%s.ndjson", events[0].OrganizationID, first.Format("2006/01/02"),
+		first.Format("20060102T150405Z"), uuid.NewString()[:8])
+	if s.cfg.Prefix != "" {
+		key = s.cfg.Prefix + "/" + key
+	}
+
+	u := *s.endpoint
+	if s.cfg.PathStyle {
+		u.Path = "/" + s.cfg.Bucket + "/" + key
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	signV4(req, body.Bytes(), s.cfg.AccessKeyID, s.cfg.SecretAccessKey, s.cfg.Region, s.now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return httpError(resp.StatusCode, detail)
+}
+
+func (s *S3) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// signV4 adds the AWS Signature Version 4 headers for S3 to req, signing
+// every header it already has
+func signV4(req *http.Request, payload []byte, accessKeyID, secretAccessKey, region string, now time.Time) {
+	payloadHash := sha256.Sum256(payload)
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath URI-encodes each segment of an object path
+func s3EscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(seg), "+", "%2B")
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,143 @@
+package auditexport
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// SplunkConfig configures a Splunk HTTP Event Collector sink
+type SplunkConfig struct {
+	// URL is the event endpoint, e.g.
+	// https://splunk.example.com:8088/services/collector/event
+	URL        string `json:"url"`
+	Token      string `json:"token"`
+	Index      string `json:"index,omitempty"`
+	Source     string `json:"source,omitempty"`     // default monkeys-identity
+	SourceType string `json:"sourcetype,omitempty"` // default monkeys:audit
+	CACert     string `json:"ca_cert,omitempty"`    // PEM, for collectors with a private CA
+}
+
+// SplunkHEC posts batches of events to a HTTP Event Collector
+type SplunkHEC struct {
+	cfg    SplunkConfig
+	client *http.Client
+}
+
+func NewSplunkHEC(cfg SplunkConfig) (*SplunkHEC, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("url must be an https URL")
+	}
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("token is required")
+	}
+	if cfg.Source == "" {
+		cfg.Source = "monkeys-identity"
+	}
+	if cfg.SourceType == "" {
+		cfg.SourceType = "monkeys:audit"
+	}
+	tlsConfig, err := clientTLS(cfg.CACert, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	return &SplunkHEC{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout:   15 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+func (s *SplunkHEC) Batching() (int, time.Duration) { return 100, 2 * time.Second }
+
+// Send posts the events as one request of concatenated HEC event objects
+func (s *SplunkHEC) Send(ctx context.Context, events []models.AuditEvent) error {
+	var body bytes.Buffer
+	for _, e := range events {
+		event, err := eventJSON(e)
+		if err != nil {
+			return Permanent(err)
+		}
+		fields := map[string]interface{}{
+			"time":       float64(e.Timestamp.UnixNano()) / 1e9,
+			"source":     s.cfg.Source,
+			"sourcetype": s.cfg.SourceType,
+			"event":      json.RawMessage(event),
+		}
+		if s.cfg.Index != "" {
+			fields["index"] = s.cfg.Index
+		}
+		envelope, err := json.Marshal(fields)
+		if err != nil {
+			return Permanent(err)
+		}
+		body.Write(envelope)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL, &body)
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Authorization", "Splunk "+s.cfg.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return httpError(resp.StatusCode, detail)
+}
+
+func (s *SplunkHEC) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// httpError maps the status of a collector response to an error; client
+// errors other than throttling are not worth retrying
+func httpError(status int, detail []byte) error {
+	if status >= 200 && status < 300 {
+		return nil
+	}
+	err := fmt.Errorf("status %d: %s", status, bytes.TrimSpace(detail))
+	if status >= 400 && status < 500 && status != http.StatusTooManyRequests && status != http.StatusRequestTimeout {
+		return Permanent(err)
+	}
+	return err
+}
+
+// clientTLS returns the TLS configuration of a sink connection: the system
+// roots, or caCert if given, and an optional client certificate
+func clientTLS(caCert, clientCert, clientKey, serverName string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: serverName}
+	if caCert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(caCert)) {
+			return nil, fmt.Errorf("ca_cert holds no PEM certificate")
+		}
+		cfg.RootCAs = pool
+	}
+	if clientCert != "" || clientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(clientCert), []byte(clientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
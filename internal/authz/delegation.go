@@ -0,0 +1,92 @@
+package authz
+
+import (
+	"sort"
+	"strings"
+)
+
+// DelegatedRoute is a request a delegated action allows: an HTTP method and
+// a route path whose ":name" segments match any single segment
+type DelegatedRoute struct {
+	Method string
+	Path   string
+}
+
+// DelegableActions are the actions a user can let a service account
+// perform on their behalf, with the requests each allows. Tokens minted
+// from a delegation are refused on every other request; the user's own
+// permissions still apply to the requests they are allowed.
+var DelegableActions = map[string][]DelegatedRoute{
+	"profile:read": {
+		{"GET", "/api/v1/users/me"},
+	},
+	"content:read": {
+		{"GET", "/api/v1/content"},
+		{"GET", "/api/v1/content/:id"},
+		{"GET", "/api/v1/content/:id/revisions"},
+	},
+	"content:create": {
+		{"POST", "/api/v1/content"},
+	},
+	"content:update": {
+		{"PUT", "/api/v1/content/:id"},
+		{"POST", "/api/v1/content/:id/attachments"},
+	},
+	"content:publish": {
+		{"PATCH", "/api/v1/content/:id/status"},
+	},
+	"content:delete": {
+		{"DELETE", "/api/v1/content/:id"},
+	},
+}
+
+// IsDelegableAction reports whether action can be delegated
+func IsDelegableAction(action string) bool {
+	_, ok := DelegableActions[action]
+	return ok
+}
+
+// DelegableActionNames returns the delegable actions, sorted
+func DelegableActionNames() []string {
+	names := make([]string, 0, len(DelegableActions))
+	for name := range DelegableActions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DelegationPermits reports whether any of actions allows a request with
+// method to path
+func DelegationPermits(actions []string, method, path string) bool {
+	for _, action := range actions {
+		for _, route := range DelegableActions[action] {
+			if strings.EqualFold(route.Method, method) && routeMatches(route.Path, path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// routeMatches matches a request path against a route path, ignoring a
+// trailing slash
+func routeMatches(route, path string) bool {
+	want := strings.Split(strings.Trim(route, "/"), "/")
+	got := strings.Split(strings.Trim(path, "/"), "/")
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if strings.HasPrefix(want[i], ":") {
+			if got[i] == "" {
+				return false
+			}
+			continue
+		}
+		if want[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,34 @@
+package authz
+
+import "testing"
+
+func TestDelegationPermits(t *testing.T) {
+	tests := []struct {
+		actions      []string
+		method, path string
+		want         bool
+	}{
+		{[]string{"content:publish"}, "PATCH", "/api/v1/content/42/status", true},
+		{[]string{"content:publish"}, "patch", "/api/v1/content/42/status/", true},
+		{[]string{"content:publish"}, "PUT", "/api/v1/content/42", false},
+		{[]string{"content:publish"}, "PATCH", "/api/v1/content//status", false},
+		{[]string{"content:read", "content:create"}, "POST", "/api/v1/content/", true},
+		{[]string{"content:read"}, "GET", "/api/v1/content/42/comments", false},
+		{[]string{"content:read"}, "GET", "/api/v1/users/me", false},
+		{[]string{"profile:read"}, "GET", "/api/v1/users/me", true},
+		{[]string{"iam:*"}, "GET", "/api/v1/users/me", false},
+		{nil, "GET", "/api/v1/content", false},
+	}
+	for _, tt := range tests {
+		if got := DelegationPermits(tt.actions, tt.method, tt.path); got != tt.want {
+			t.Errorf("DelegationPermits(%v, %s %s) = %v, want %v", tt.actions, tt.method, tt.path, got, tt.want)
+		}
+	}
+
+	if !IsDelegableAction("content:publish") || IsDelegableAction("content:*") {
+		t.Error("IsDelegableAction does not match the catalogue")
+	}
+	if names := DelegableActionNames(); len(names) != len(DelegableActions) || names[0] != "content:create" {
+		t.Errorf("DelegableActionNames() = %v", names)
+	}
+}
@@ -0,0 +1,237 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Grant is where a permission comes from: a policy statement, attached
+// through a role that is assigned directly or to a group, a resource
+// permission, or a resource share
+type Grant struct {
+	Source    string `json:"source"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Statement string `json:"statement,omitempty"`
+	RoleID    string `json:"role_id,omitempty"`
+	RoleName  string `json:"role_name,omitempty"`
+	GroupID   string `json:"group_id,omitempty"`
+	GroupName string `json:"group_name,omitempty"`
+	// Conditional grants only apply when the statement's conditions hold
+	Conditional bool `json:"conditional,omitempty"`
+	// Except lists words of actions the grant does not cover, as with the
+	// deletes and shares an editor share leaves out
+	Except []string `json:"except,omitempty"`
+}
+
+// Rule is an allow or deny of actions on resources by one grant
+type Rule struct {
+	Effect    Decision
+	Actions   []string
+	Resources []string
+	Grant     Grant
+}
+
+// EffectivePermission is what a principal may do on one resource pattern
+type EffectivePermission struct {
+	Resource string            `json:"resource"`
+	Actions  []EffectiveAction `json:"actions"`
+}
+
+// EffectiveAction is an action and every grant that covers it
+type EffectiveAction struct {
+	Action string  `json:"action"`
+	Grants []Grant `json:"grants"`
+}
+
+// PolicyRules returns a rule per statement of a policy document, each with
+// grant plus the statement's name and whether it has conditions
+func PolicyRules(docJSON string, grant Grant) ([]Rule, error) {
+	var doc PolicyDocument
+	if err := json.Unmarshal([]byte(docJSON), &doc); err != nil {
+		return nil, fmt.Errorf("invalid policy document: %w", err)
+	}
+	rules := make([]Rule, 0, len(doc.Statement))
+	for i, stmt := range doc.Statement {
+		g := grant
+		g.Statement = statementName(stmt, i)
+		g.Conditional = stmt.Condition != nil
+		effect := DecisionAllow
+		if strings.EqualFold(stmt.Effect, "deny") {
+			effect = DecisionDeny
+		}
+		rules = append(rules, Rule{Effect: effect, Actions: patterns(stmt.Action), Resources: patterns(stmt.Resource), Grant: g})
+	}
+	return rules, nil
+}
+
+// Effective merges rules into the actions allowed per resource pattern,
+// deduplicated and sorted, each with the grants behind it. An action is
+// left out when an unconditional deny covers it on the whole pattern;
+// denies are returned too, since ones covering only part of a pattern, or
+// with conditions, may still refuse some requests it allows.
+func Effective(rules []Rule) (allowed, denied []EffectivePermission) {
+	var denies []Rule
+	for _, r := range rules {
+		if r.Effect == DecisionDeny {
+			denies = append(denies, r)
+		}
+	}
+
+	allows := map[string]map[string][]Grant{}
+	denyMap := map[string]map[string][]Grant{}
+	for _, r := range rules {
+		target := allows
+		if r.Effect == DecisionDeny {
+			target = denyMap
+		}
+		for _, resource := range r.Resources {
+			for _, action := range r.Actions {
+				if r.Effect == DecisionAllow && deniedOutright(denies, action, resource) {
+					continue
+				}
+				if target[resource] == nil {
+					target[resource] = map[string][]Grant{}
+				}
+				target[resource][action] = append(target[resource][action], r.Grant)
+			}
+		}
+	}
+	return flatten(allows), flatten(denyMap)
+}
+
+// deniedOutright reports whether an unconditional deny covers action on
+// every resource resource matches
+func deniedOutright(denies []Rule, action, resource string) bool {
+	for _, d := range denies {
+		if d.Grant.Conditional {
+			continue
+		}
+		if covers(d.Actions, []string{action}) && covers(d.Resources, []string{resource}) {
+			return true
+		}
+	}
+	return false
+}
+
+// Exceeding returns the actions the allow rules grant that held does not
+// cover: unconditionally, on every resource of the rule, and clear of the
+// actions denied touches. Handing out rules is only safe for principals
+// for whom it is empty. Like covers, it is conservative.
+func Exceeding(held, denied []EffectivePermission, rules []Rule) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, r := range rules {
+		if r.Effect != DecisionAllow {
+			continue
+		}
+		for _, action := range r.Actions {
+			if seen[action] {
+				continue
+			}
+			if !holds(held, action, r.Resources) || touchesDenied(denied, action) {
+				seen[action] = true
+				out = append(out, action)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// holds reports whether an unconditional grant of perms covers action on
+// each of resources
+func holds(perms []EffectivePermission, action string, resources []string) bool {
+	if len(resources) == 0 {
+		return false
+	}
+	for _, resource := range resources {
+		found := false
+		for _, p := range perms {
+			if !grantCovers(p.Resource, resource) {
+				continue
+			}
+			for _, a := range p.Actions {
+				if grantCovers(a.Action, action) && hasUnconditional(a.Grants) {
+					found = true
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// grantCovers reports whether every value matching the pattern specific
+// matches general. Wildcards of specific are matched as characters, which is
+// sound unless a ? of general takes the place of one.
+func grantCovers(general, specific string) bool {
+	if strings.Contains(general, "?") && strings.ContainsAny(specific, "*?") {
+		return patternCovers(general, specific)
+	}
+	return (&Evaluator{}).MatchWildcard(general, specific)
+}
+
+func hasUnconditional(grants []Grant) bool {
+	for _, g := range grants {
+		if !g.Conditional && len(g.Except) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// touchesDenied reports whether a deny covers action or part of it, on any
+// resource
+func touchesDenied(denied []EffectivePermission, action string) bool {
+	for _, p := range denied {
+		for _, a := range p.Actions {
+			if grantCovers(a.Action, action) || grantCovers(action, a.Action) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func flatten(m map[string]map[string][]Grant) []EffectivePermission {
+	out := make([]EffectivePermission, 0, len(m))
+	for resource, actions := range m {
+		p := EffectivePermission{Resource: resource, Actions: make([]EffectiveAction, 0, len(actions))}
+		for action, grants := range actions {
+			p.Actions = append(p.Actions, EffectiveAction{Action: action, Grants: grants})
+		}
+		sort.Slice(p.Actions, func(i, j int) bool { return p.Actions[i].Action < p.Actions[j].Action })
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Resource < out[j].Resource })
+	return out
+}
+
+// FilterService keeps the actions of service, e.g. "blog" for
+// "blog:post:read", and wildcards that may cover it, dropping resource
+// patterns left without actions
+func FilterService(perms []EffectivePermission, service string) []EffectivePermission {
+	prefix := service + ":"
+	out := make([]EffectivePermission, 0, len(perms))
+	for _, p := range perms {
+		var actions []EffectiveAction
+		for _, a := range p.Actions {
+			if strings.HasPrefix(a.Action, prefix) || patternCovers(a.Action, prefix) {
+				actions = append(actions, a)
+			}
+		}
+		if len(actions) > 0 {
+			out = append(out, EffectivePermission{Resource: p.Resource, Actions: actions})
+		}
+	}
+	return out
+}
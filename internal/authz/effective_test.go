@@ -0,0 +1,108 @@
+package authz
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEffective(t *testing.T) {
+	editor := Grant{Source: SourcePolicy, ID: "p1", Name: "Editors", RoleName: "editor"}
+	viaGroup := Grant{Source: SourcePolicy, ID: "p2", Name: "Readers", RoleName: "reader", GroupName: "eng"}
+
+	rules, err := PolicyRules(`{"Statement":[
+		{"Sid":"Write","Effect":"Allow","Action":["blog:post:read","blog:post:update","blog:post:delete"],"Resource":"arn:blog:post/*"},
+		{"Sid":"NoDeletes","Effect":"Deny","Action":"blog:post:delete","Resource":"arn:blog:*"},
+		{"Sid":"Drafts","Effect":"Deny","Action":"blog:post:update","Resource":"arn:blog:post/draft-*"}
+	]}`, editor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	more, err := PolicyRules(`{"Statement":[
+		{"Effect":"Allow","Action":"blog:post:read","Resource":"arn:blog:post/*"},
+		{"Effect":"Allow","Action":"iam:user:read","Resource":"*","Condition":{"Bool":{"mfa":"true"}}}
+	]}`, viaGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allowed, denied := Effective(append(rules, more...))
+
+	got := map[string][]string{}
+	for _, p := range allowed {
+		for _, a := range p.Actions {
+			got[p.Resource] = append(got[p.Resource], a.Action)
+		}
+	}
+	want := map[string][]string{
+		"arn:blog:post/*": {"blog:post:read", "blog:post:update"},
+		"*":               {"iam:user:read"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("allowed = %v, want %v", got, want)
+	}
+
+	read := allowed[1].Actions[0]
+	if len(read.Grants) != 2 || read.Grants[0].Statement != "Write" || read.Grants[1].GroupName != "eng" {
+		t.Errorf("grants of read = %+v", read.Grants)
+	}
+	if !allowed[0].Actions[0].Grants[0].Conditional {
+		t.Error("conditional allow not marked")
+	}
+	if len(denied) != 2 {
+		t.Errorf("denied = %+v, want both deny statements", denied)
+	}
+}
+
+func TestFilterService(t *testing.T) {
+	perms := []EffectivePermission{
+		{Resource: "*", Actions: []EffectiveAction{{Action: "*"}, {Action: "iam:user:read"}}},
+		{Resource: "arn:blog:*", Actions: []EffectiveAction{{Action: "blog:*"}, {Action: "blog:post:read"}}},
+	}
+	got := FilterService(perms, "blog")
+	if len(got) != 2 || len(got[0].Actions) != 1 || got[0].Actions[0].Action != "*" || len(got[1].Actions) != 2 {
+		t.Errorf("FilterService(blog) = %+v", got)
+	}
+	if got := FilterService(perms, "iam"); len(got) != 1 || len(got[0].Actions) != 2 {
+		t.Errorf("FilterService(iam) = %+v", got)
+	}
+}
+
+func TestExceeding(t *testing.T) {
+	rules := func(doc string) []Rule {
+		t.Helper()
+		r, err := PolicyRules(doc, Grant{Source: SourcePolicy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	held, denied := Effective(rules(`{"Statement":[
+		{"Effect":"Allow","Action":["monkeys:iam:create_user","monkeys:iam:assign_role","monkeys:*:read"],"Resource":"*"},
+		{"Effect":"Allow","Action":"monkeys:audit:export","Resource":"*","Condition":{"Bool":{"mfa":"true"}}},
+		{"Effect":"Allow","Action":"monkeys:content:update","Resource":"arn:content/*"},
+		{"Effect":"Deny","Action":"monkeys:iam:delete_user","Resource":"arn:user/root"}
+	]}`))
+
+	tests := []struct {
+		name string
+		doc  string
+		want []string
+	}{
+		{"subset", `{"Statement":[{"Effect":"Allow","Action":["monkeys:iam:create_user","monkeys:user:read"],"Resource":"*"}]}`, nil},
+		{"wildcard held as is", `{"Statement":[{"Effect":"Allow","Action":"monkeys:*:read","Resource":"*"}]}`, nil},
+		{"denies are not grants", `{"Statement":[{"Effect":"Deny","Action":"*","Resource":"*"}]}`, nil},
+		{"more actions", `{"Statement":[{"Effect":"Allow","Action":["monkeys:iam:create_policy","monkeys:iam:create_user"],"Resource":"*"}]}`, []string{"monkeys:iam:create_policy"}},
+		{"full access", `{"Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`, []string{"*"}},
+		{"conditional grant", `{"Statement":[{"Effect":"Allow","Action":"monkeys:audit:export","Resource":"*"}]}`, []string{"monkeys:audit:export"}},
+		{"wider resource", `{"Statement":[{"Effect":"Allow","Action":"monkeys:content:update","Resource":"*"}]}`, []string{"monkeys:content:update"}},
+		{"narrower resource", `{"Statement":[{"Effect":"Allow","Action":"monkeys:content:update","Resource":"arn:content/1"}]}`, nil},
+		{"denied to the holder", `{"Statement":[{"Effect":"Allow","Action":"monkeys:iam:*","Resource":"*"}]}`, []string{"monkeys:iam:*"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Exceeding(held, denied, rules(tt.doc)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Exceeding() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
+
+	"github.com/the-monkeys/monkeys-identity/internal/metrics"
 )
 
 // Decision represents the outcome of an authorization check
@@ -31,40 +34,180 @@ type Statement struct {
 	Condition interface{} `json:"Condition,omitempty"`
 }
 
-// Evaluator handles policy evaluation logic
-type Evaluator struct{}
+// ValidateDocument checks that a policy document parses and that every
+// statement has an Allow or Deny effect, an action and a resource
+func ValidateDocument(docJSON string) error {
+	var doc PolicyDocument
+	if err := json.Unmarshal([]byte(docJSON), &doc); err != nil {
+		return fmt.Errorf("invalid policy document: %w", err)
+	}
+	if len(doc.Statement) == 0 {
+		return fmt.Errorf("policy must have at least one statement")
+	}
+	for i, stmt := range doc.Statement {
+		if stmt.Effect != "Allow" && stmt.Effect != "Deny" {
+			return fmt.Errorf("statement %s: Effect must be Allow or Deny", statementName(stmt, i))
+		}
+		if stmt.Action == nil {
+			return fmt.Errorf("statement %s: Action is required", statementName(stmt, i))
+		}
+		if stmt.Resource == nil {
+			return fmt.Errorf("statement %s: Resource is required", statementName(stmt, i))
+		}
+	}
+	return nil
+}
+
+// maxCachedDocuments bounds the parsed document cache; when it fills up the
+// cache is simply reset
+const maxCachedDocuments = 4096
+
+// Evaluator handles policy evaluation logic. Parsed policy documents are
+// cached by their JSON text, so edits to a policy never see a stale entry.
+type Evaluator struct {
+	mu   sync.RWMutex
+	docs map[string]*PolicyDocument
+}
 
 // NewEvaluator creates a new Evaluator
 func NewEvaluator() *Evaluator {
-	return &Evaluator{}
+	return &Evaluator{docs: make(map[string]*PolicyDocument)}
 }
 
 // Evaluate determines if a request is allowed based on a policy document
 func (e *Evaluator) Evaluate(docJSON string, action, resource string, context map[string]interface{}) (Decision, error) {
-	var doc PolicyDocument
-	if err := json.Unmarshal([]byte(docJSON), &doc); err != nil {
-		return DecisionDeny, fmt.Errorf("invalid policy document: %w", err)
+	decision, _, err := e.EvaluateStatement(docJSON, action, resource, context)
+	return decision, err
+}
+
+// EvaluateStatement is Evaluate that also names the statement that decided:
+// its Sid, or its position such as "#2" when it has none. The name is empty
+// when no statement matched.
+func (e *Evaluator) EvaluateStatement(docJSON string, action, resource string, context map[string]interface{}) (Decision, string, error) {
+	doc, err := e.parse(docJSON)
+	if err != nil {
+		return DecisionDeny, "", err
 	}
 
 	ce := NewConditionEvaluator()
 
-	for _, stmt := range doc.Statement {
+	for i, stmt := range doc.Statement {
 		matched, err := e.matches(stmt, action, resource, context, ce)
 		if err != nil {
-			return DecisionDeny, err
+			return DecisionDeny, statementName(stmt, i), err
 		}
 
 		if matched {
 			if strings.EqualFold(stmt.Effect, "Deny") {
-				return DecisionDeny, nil
+				return DecisionDeny, statementName(stmt, i), nil
 			}
 			if strings.EqualFold(stmt.Effect, "Allow") {
-				return DecisionAllow, nil
+				return DecisionAllow, statementName(stmt, i), nil
 			}
 		}
 	}
 
-	return DecisionNotApplicable, nil
+	return DecisionNotApplicable, "", nil
+}
+
+// StatementResult describes how one policy statement applied to a request
+type StatementResult struct {
+	Index           int    `json:"index"`
+	Sid             string `json:"sid,omitempty"`
+	Effect          string `json:"effect"`
+	ActionMatched   bool   `json:"action_matched"`
+	ResourceMatched bool   `json:"resource_matched"`
+	// ConditionMatched is nil when the statement has no condition or its
+	// action or resource did not match
+	ConditionMatched *bool `json:"condition_matched,omitempty"`
+	Matched          bool  `json:"matched"`
+	// Decisive marks the statement that determined the policy's decision
+	Decisive bool   `json:"decisive,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// EvaluateStatements evaluates every statement of a policy document and
+// reports each one, along with the decision Evaluate would return. A
+// condition that cannot be evaluated denies, and its error is reported on
+// the statement rather than returned.
+func (e *Evaluator) EvaluateStatements(docJSON string, action, resource string, context map[string]interface{}) (Decision, []StatementResult, error) {
+	doc, err := e.parse(docJSON)
+	if err != nil {
+		return DecisionDeny, nil, err
+	}
+
+	ce := NewConditionEvaluator()
+	decision := DecisionNotApplicable
+	decided := false
+	results := make([]StatementResult, 0, len(doc.Statement))
+
+	for i, stmt := range doc.Statement {
+		r := StatementResult{
+			Index:           i,
+			Sid:             stmt.Sid,
+			Effect:          stmt.Effect,
+			ActionMatched:   e.matchField(stmt.Action, action),
+			ResourceMatched: e.matchField(stmt.Resource, resource),
+		}
+		r.Matched = r.ActionMatched && r.ResourceMatched
+		var condErr error
+		if r.Matched && stmt.Condition != nil {
+			satisfied, err := ce.Evaluate(stmt.Condition, context)
+			if err != nil {
+				condErr = err
+				r.Error = err.Error()
+			}
+			r.ConditionMatched = &satisfied
+			r.Matched = satisfied && err == nil
+		}
+
+		// The first statement that errors or matches decides, as in Evaluate
+		if !decided {
+			switch {
+			case condErr != nil:
+				decision, decided, r.Decisive = DecisionDeny, true, true
+			case r.Matched && strings.EqualFold(stmt.Effect, "Deny"):
+				decision, decided, r.Decisive = DecisionDeny, true, true
+			case r.Matched && strings.EqualFold(stmt.Effect, "Allow"):
+				decision, decided, r.Decisive = DecisionAllow, true, true
+			}
+		}
+		results = append(results, r)
+	}
+
+	return decision, results, nil
+}
+
+func statementName(stmt Statement, index int) string {
+	if stmt.Sid != "" {
+		return stmt.Sid
+	}
+	return fmt.Sprintf("#%d", index)
+}
+
+// parse returns the parsed form of a policy document, from the cache if possible.
+// Cached documents are shared and must not be modified.
+func (e *Evaluator) parse(docJSON string) (*PolicyDocument, error) {
+	e.mu.RLock()
+	doc, ok := e.docs[docJSON]
+	e.mu.RUnlock()
+	metrics.RecordPolicyCacheLookup(ok)
+	if ok {
+		return doc, nil
+	}
+
+	doc = &PolicyDocument{}
+	if err := json.Unmarshal([]byte(docJSON), doc); err != nil {
+		return nil, fmt.Errorf("invalid policy document: %w", err)
+	}
+
+	e.mu.Lock()
+	if e.docs == nil || len(e.docs) >= maxCachedDocuments {
+		e.docs = make(map[string]*PolicyDocument)
+	}
+	e.docs[docJSON] = doc
+	e.mu.Unlock()
+	return doc, nil
 }
 
 // matches checks if a statement applies to the given request
@@ -233,3 +233,103 @@ func TestEvaluator_MatchWildcard(t *testing.T) {
 		}
 	}
 }
+
+func TestEvaluator_EvaluateStatement(t *testing.T) {
+	e := NewEvaluator()
+	doc := `{
+		"Version": "1.0",
+		"Statement": [
+			{"Sid": "ReadAll", "Effect": "Allow", "Action": "iam:Get*", "Resource": "*"},
+			{"Effect": "Deny", "Action": "iam:DeleteUser", "Resource": "*"}
+		]
+	}`
+
+	tests := []struct {
+		action    string
+		decision  Decision
+		statement string
+	}{
+		{"iam:GetUser", DecisionAllow, "ReadAll"},
+		{"iam:DeleteUser", DecisionDeny, "#1"},
+		{"iam:CreateUser", DecisionNotApplicable, ""},
+	}
+	for _, tt := range tests {
+		decision, statement, err := e.EvaluateStatement(doc, tt.action, "arn:monkeys:iam::user/1", nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.action, err)
+		}
+		if decision != tt.decision || statement != tt.statement {
+			t.Errorf("%s: got (%s, %q), want (%s, %q)", tt.action, decision, statement, tt.decision, tt.statement)
+		}
+	}
+}
+
+func TestTrace_Decide(t *testing.T) {
+	var trace Trace
+	allow := TraceStep{Source: SourcePolicy, Name: "readers", Effect: DecisionAllow, Statement: "ReadAll"}
+	deny := TraceStep{Source: SourcePolicy, Name: "no-deletes", Effect: DecisionDeny, Statement: "#1"}
+	trace.Add(allow)
+	trace.Add(deny)
+
+	trace.Decide(DecisionDeny, &deny)
+	if want := `Explicitly denied by policy "no-deletes" (statement #1); explicit denies override any allow`; trace.Reason != want {
+		t.Errorf("reason = %q, want %q", trace.Reason, want)
+	}
+
+	trace.Decide(DecisionDeny, nil)
+	if trace.DecidedBy != nil || trace.Reason == "" {
+		t.Errorf("default deny: decided_by = %v, reason = %q", trace.DecidedBy, trace.Reason)
+	}
+}
+
+func TestEvaluator_EvaluateStatements(t *testing.T) {
+	e := NewEvaluator()
+	doc := `{
+		"Version": "1.0",
+		"Statement": [
+			{"Sid": "Writers", "Effect": "Allow", "Action": "blog:*", "Resource": "arn:blog:post/*"},
+			{"Sid": "NoDeletes", "Effect": "Deny", "Action": "blog:delete", "Resource": "*"},
+			{"Effect": "Allow", "Action": "iam:*", "Resource": "*"}
+		]
+	}`
+
+	decision, results, err := e.EvaluateStatements(doc, "blog:delete", "arn:blog:post/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first matching statement decides, as in Evaluate
+	if decision != DecisionAllow {
+		t.Errorf("decision = %s, want allow", decision)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d statement results, want 3", len(results))
+	}
+	if !results[0].Matched || !results[0].Decisive {
+		t.Errorf("Writers: %+v, want matched and decisive", results[0])
+	}
+	if !results[1].Matched || results[1].Decisive {
+		t.Errorf("NoDeletes: %+v, want matched but not decisive", results[1])
+	}
+	if results[2].ActionMatched || !results[2].ResourceMatched || results[2].Matched {
+		t.Errorf("#2: %+v, want only the resource to match", results[2])
+	}
+}
+
+func TestValidateDocument(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		valid bool
+	}{
+		{"valid", `{"Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`, true},
+		{"not json", `{`, false},
+		{"no statements", `{"Statement":[]}`, false},
+		{"bad effect", `{"Statement":[{"Effect":"allow","Action":"*","Resource":"*"}]}`, false},
+		{"no resource", `{"Statement":[{"Effect":"Deny","Action":"*"}]}`, false},
+	}
+	for _, tt := range tests {
+		if err := ValidateDocument(tt.doc); (err == nil) != tt.valid {
+			t.Errorf("%s: err = %v, want valid=%v", tt.name, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Lint finding severities, most severe first
+const (
+	SeverityCritical = "critical"
+	SeverityHigh     = "high"
+	SeverityMedium   = "medium"
+	SeverityLow      = "low"
+)
+
+// SeverityRank orders severities for sorting; lower is more severe
+func SeverityRank(severity string) int {
+	switch severity {
+	case SeverityCritical:
+		return 0
+	case SeverityHigh:
+		return 1
+	case SeverityMedium:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// Lint rules
+const (
+	RuleInvalidDocument   = "invalid_document"
+	RuleFullWildcard      = "full_wildcard"
+	RuleOverlyBroad       = "overly_broad"
+	RuleShadowedDeny      = "shadowed_deny"
+	RuleShadowedStatement = "shadowed_statement"
+	RuleUnusedPolicy      = "unused_policy"
+)
+
+// LintFinding is a problem found in a policy document
+type LintFinding struct {
+	Rule           string `json:"rule"`
+	Severity       string `json:"severity"`
+	Statement      string `json:"statement,omitempty"`
+	Message        string `json:"message"`
+	Recommendation string `json:"recommendation"`
+}
+
+// LintDocument inspects a policy document for grants broader than they
+// likely need to be and for statements that can never take effect. Since
+// the first matching statement decides, a statement is shadowed when an
+// earlier unconditional statement matches everything it does.
+func LintDocument(docJSON string) ([]LintFinding, error) {
+	if err := ValidateDocument(docJSON); err != nil {
+		return nil, err
+	}
+	var doc PolicyDocument
+	if err := json.Unmarshal([]byte(docJSON), &doc); err != nil {
+		return nil, err
+	}
+
+	findings := []LintFinding{}
+	for i, stmt := range doc.Statement {
+		name := statementName(stmt, i)
+		actions, resources := patterns(stmt.Action), patterns(stmt.Resource)
+
+		if stmt.Effect == "Allow" {
+			anyAction, anyResource := contains(actions, "*"), contains(resources, "*")
+			switch {
+			case anyAction && anyResource:
+				severity := SeverityCritical
+				if stmt.Condition != nil {
+					severity = SeverityHigh
+				}
+				findings = append(findings, LintFinding{
+					Rule: RuleFullWildcard, Severity: severity, Statement: name,
+					Message:        "Allows every action on every resource",
+					Recommendation: "Grant the specific actions and resources the principals need; reserve full access for a small break-glass policy",
+				})
+			case anyAction:
+				findings = append(findings, LintFinding{
+					Rule: RuleOverlyBroad, Severity: SeverityMedium, Statement: name,
+					Message:        fmt.Sprintf("Allows every action on %s", strings.Join(resources, ", ")),
+					Recommendation: "List the actions that are needed instead of *",
+				})
+			case anyResource && hasServiceWildcard(actions):
+				findings = append(findings, LintFinding{
+					Rule: RuleOverlyBroad, Severity: SeverityMedium, Statement: name,
+					Message:        fmt.Sprintf("Allows all of %s on every resource", strings.Join(actions, ", ")),
+					Recommendation: "Scope the resource to the objects the principals work with, or list specific actions",
+				})
+			}
+		}
+
+		for j := 0; j < i; j++ {
+			earlier := doc.Statement[j]
+			if earlier.Condition != nil || !covers(patterns(earlier.Action), actions) || !covers(patterns(earlier.Resource), resources) {
+				continue
+			}
+			earlierName := statementName(earlier, j)
+			if stmt.Effect == "Deny" && earlier.Effect == "Allow" {
+				findings = append(findings, LintFinding{
+					Rule: RuleShadowedDeny, Severity: SeverityHigh, Statement: name,
+					Message:        fmt.Sprintf("Deny never applies: statement %s allows everything it covers first", earlierName),
+					Recommendation: "Move the deny into its own policy, or before the allow; explicit denies in other policies always win",
+				})
+			} else {
+				findings = append(findings, LintFinding{
+					Rule: RuleShadowedStatement, Severity: SeverityLow, Statement: name,
+					Message:        fmt.Sprintf("Never takes effect: statement %s matches everything it covers first", earlierName),
+					Recommendation: "Remove the statement or reorder the policy",
+				})
+			}
+			break
+		}
+	}
+	return findings, nil
+}
+
+// patterns returns the patterns of an Action or Resource field
+func patterns(field interface{}) []string {
+	switch v := field.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// covers reports whether every pattern in specific is matched by one of
+// general. It is conservative: false only means coverage was not proven.
+func covers(general, specific []string) bool {
+	if len(specific) == 0 {
+		return false
+	}
+	for _, s := range specific {
+		covered := false
+		for _, g := range general {
+			if patternCovers(g, s) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+func patternCovers(general, specific string) bool {
+	if general == "*" || general == specific {
+		return true
+	}
+	// A single trailing * covers anything sharing its prefix, including
+	// patterns whose own wildcards come after that prefix
+	if strings.Count(general, "*") == 1 && strings.HasSuffix(general, "*") && !strings.Contains(general, "?") {
+		return strings.HasPrefix(specific, strings.TrimSuffix(general, "*"))
+	}
+	return false
+}
+
+func hasServiceWildcard(actions []string) bool {
+	for _, a := range actions {
+		if strings.HasSuffix(a, ":*") {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
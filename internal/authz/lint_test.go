@@ -0,0 +1,71 @@
+package authz
+
+import "testing"
+
+func TestLintDocument(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		rules []string
+	}{
+		{
+			name:  "scoped grant",
+			doc:   `{"Statement":[{"Effect":"Allow","Action":["blog:post:read","blog:post:list"],"Resource":"arn:blog:post/*"}]}`,
+			rules: nil,
+		},
+		{
+			name:  "full wildcard",
+			doc:   `{"Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`,
+			rules: []string{RuleFullWildcard},
+		},
+		{
+			name:  "service wildcard on every resource",
+			doc:   `{"Statement":[{"Effect":"Allow","Action":"iam:*","Resource":"*"}]}`,
+			rules: []string{RuleOverlyBroad},
+		},
+		{
+			name: "deny after covering allow",
+			doc: `{"Statement":[
+				{"Sid":"Blog","Effect":"Allow","Action":"blog:*","Resource":"arn:blog:*"},
+				{"Sid":"NoDeletes","Effect":"Deny","Action":"blog:post:delete","Resource":"arn:blog:post/*"}
+			]}`,
+			rules: []string{RuleShadowedDeny},
+		},
+		{
+			name: "conditional allow does not shadow",
+			doc: `{"Statement":[
+				{"Effect":"Allow","Action":"blog:*","Resource":"arn:blog:*","Condition":{"StringEquals":{"department":"eng"}}},
+				{"Effect":"Deny","Action":"blog:post:delete","Resource":"arn:blog:post/*"}
+			]}`,
+			rules: nil,
+		},
+		{
+			name: "redundant allow",
+			doc: `{"Statement":[
+				{"Effect":"Allow","Action":"blog:post:*","Resource":"arn:blog:post/*"},
+				{"Effect":"Allow","Action":"blog:post:read","Resource":"arn:blog:post/42"}
+			]}`,
+			rules: []string{RuleShadowedStatement},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings, err := LintDocument(tt.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(findings) != len(tt.rules) {
+				t.Fatalf("got %d findings %+v, want rules %v", len(findings), findings, tt.rules)
+			}
+			for i, f := range findings {
+				if f.Rule != tt.rules[i] {
+					t.Errorf("finding %d rule = %s, want %s", i, f.Rule, tt.rules[i])
+				}
+			}
+		})
+	}
+
+	if _, err := LintDocument(`{"Statement":[]}`); err == nil {
+		t.Error("expected an error for a document without statements")
+	}
+}
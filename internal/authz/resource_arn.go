@@ -0,0 +1,25 @@
+package authz
+
+import "strings"
+
+// resourceARNPrefix starts the ARNs RequirePermission builds for routes with
+// an :id, arn:monkeys:resource:<org>:<type>/<id>
+const resourceARNPrefix = "arn:monkeys:resource:"
+
+// ParseResourceARN splits a resource ARN into the organization, the type
+// (the path segment before the ID, e.g. "resources" or "users") and the ID
+func ParseResourceARN(arn string) (orgID, resourceType, id string, ok bool) {
+	rest, found := strings.CutPrefix(arn, resourceARNPrefix)
+	if !found {
+		return "", "", "", false
+	}
+	orgID, path, found := strings.Cut(rest, ":")
+	if !found {
+		return "", "", "", false
+	}
+	resourceType, id, found = strings.Cut(path, "/")
+	if !found || resourceType == "" || id == "" || strings.Contains(id, "/") {
+		return "", "", "", false
+	}
+	return orgID, resourceType, id, true
+}
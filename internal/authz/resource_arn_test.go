@@ -0,0 +1,26 @@
+package authz
+
+import "testing"
+
+func TestParseResourceARN(t *testing.T) {
+	tests := []struct {
+		arn          string
+		org, typ, id string
+		ok           bool
+	}{
+		{"arn:monkeys:resource:org-1:resources/abc", "org-1", "resources", "abc", true},
+		{"arn:monkeys:resource::users/abc", "", "users", "abc", true},
+		{"arn:monkeys:resource:org-1:resources/abc/extra", "", "", "", false},
+		{"arn:monkeys:resource:org-1:resources", "", "", "", false},
+		{"arn:monkeys:resource:org-1:resources/", "", "", "", false},
+		{"arn:monkeys:iam::user/123", "", "", "", false},
+		{"*", "", "", "", false},
+	}
+	for _, tt := range tests {
+		org, typ, id, ok := ParseResourceARN(tt.arn)
+		if org != tt.org || typ != tt.typ || id != tt.id || ok != tt.ok {
+			t.Errorf("ParseResourceARN(%q) = %q, %q, %q, %v; want %q, %q, %q, %v",
+				tt.arn, org, typ, id, ok, tt.org, tt.typ, tt.id, tt.ok)
+		}
+	}
+}
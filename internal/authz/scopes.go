@@ -0,0 +1,19 @@
+package authz
+
+// ScopeActions maps OAuth scope names to the policy actions they grant.
+// Action patterns may use the same wildcards as policy statements.
+type ScopeActions map[string][]string
+
+// Permits reports whether any of scopes grants action. Scopes without a
+// mapping (such as openid or email) grant nothing.
+func (m ScopeActions) Permits(scopes []string, action string) bool {
+	e := &Evaluator{}
+	for _, scope := range scopes {
+		for _, pattern := range m[scope] {
+			if e.MatchWildcard(pattern, action) {
+				return true
+			}
+		}
+	}
+	return false
+}
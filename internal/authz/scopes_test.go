@@ -0,0 +1,27 @@
+package authz
+
+import "testing"
+
+func TestScopeActions_Permits(t *testing.T) {
+	m := ScopeActions{
+		"blog:read":  {"blog:post:read", "blog:comment:read"},
+		"blog:write": {"blog:post:*"},
+	}
+
+	tests := []struct {
+		scopes []string
+		action string
+		want   bool
+	}{
+		{[]string{"blog:read"}, "blog:post:read", true},
+		{[]string{"blog:read"}, "blog:post:create", false},
+		{[]string{"openid", "blog:write"}, "blog:post:create", true},
+		{[]string{"openid", "email"}, "blog:post:read", false},
+		{nil, "blog:post:read", false},
+	}
+	for _, tt := range tests {
+		if got := m.Permits(tt.scopes, tt.action); got != tt.want {
+			t.Errorf("Permits(%v, %q) = %v, want %v", tt.scopes, tt.action, got, tt.want)
+		}
+	}
+}
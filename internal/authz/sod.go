@@ -0,0 +1,42 @@
+package authz
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// SoDConflict is an SoD rule broken by a set of roles, with the roles of
+// the rule in the set
+type SoDConflict struct {
+	Rule  string   `json:"rule"`
+	Roles []string `json:"roles"`
+}
+
+// SoDConflicts returns the rules broken by holding all of the given roles,
+// in rule order. Role names compare case-insensitively; the conflicting
+// roles are reported as the rule names them.
+func SoDConflicts(rules []models.SoDRule, held []string) []SoDConflict {
+	holds := make(map[string]bool, len(held))
+	for _, role := range held {
+		holds[strings.ToLower(role)] = true
+	}
+	var conflicts []SoDConflict
+	for _, rule := range rules {
+		var roles []string
+		seen := map[string]bool{}
+		for _, role := range rule.Roles {
+			key := strings.ToLower(role)
+			if holds[key] && !seen[key] {
+				seen[key] = true
+				roles = append(roles, role)
+			}
+		}
+		if len(roles) > 1 {
+			sort.Strings(roles)
+			conflicts = append(conflicts, SoDConflict{Rule: rule.Name, Roles: roles})
+		}
+	}
+	return conflicts
+}
@@ -0,0 +1,38 @@
+package authz
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+func TestSoDConflicts(t *testing.T) {
+	rules := []models.SoDRule{
+		{Name: "billing-vs-audit", Roles: []string{"billing-admin", "auditor"}},
+		{Name: "policy-trio", Roles: []string{"policy-admin", "auditor", "user-admin"}},
+	}
+	tests := []struct {
+		name string
+		held []string
+		want []SoDConflict
+	}{
+		{"no roles", nil, nil},
+		{"one role of each rule", []string{"billing-admin", "policy-admin"}, nil},
+		{"pair", []string{"user", "Auditor", "billing-admin"}, []SoDConflict{
+			{Rule: "billing-vs-audit", Roles: []string{"auditor", "billing-admin"}},
+		}},
+		{"two rules", []string{"auditor", "billing-admin", "user-admin"}, []SoDConflict{
+			{Rule: "billing-vs-audit", Roles: []string{"auditor", "billing-admin"}},
+			{Rule: "policy-trio", Roles: []string{"auditor", "user-admin"}},
+		}},
+		{"duplicates count once", []string{"auditor", "AUDITOR"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SoDConflicts(rules, tt.held); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SoDConflicts(%v) = %+v, want %+v", tt.held, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package authz
+
+import "fmt"
+
+// Sources of a decision recorded in a Trace
+const (
+	SourcePolicy             = "policy"
+	SourceResourcePermission = "resource_permission"
+	SourceResourceShare      = "resource_share"
+	SourceTokenScope         = "token_scope"
+	SourceDefault            = "default"
+)
+
+// Trace explains an authorization decision: every policy and grant that was
+// considered and which one decided. Explicit denies override allows, and a
+// request nothing allows is denied by default.
+type Trace struct {
+	Decision Decision `json:"decision"`
+	// DecidedBy is the step that determined the decision
+	DecidedBy *TraceStep `json:"decided_by,omitempty"`
+	// Steps lists what was evaluated, in order
+	Steps  []TraceStep `json:"steps"`
+	Reason string      `json:"reason"`
+}
+
+// TraceStep is the outcome of one policy, resource permission, share or
+// scope check
+type TraceStep struct {
+	Source string   `json:"source"`
+	ID     string   `json:"id,omitempty"`
+	Name   string   `json:"name,omitempty"`
+	Effect Decision `json:"effect"`
+	// Statement is the Sid (or #index) of the policy statement that matched
+	Statement string `json:"statement,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Add records a step
+func (t *Trace) Add(step TraceStep) {
+	t.Steps = append(t.Steps, step)
+}
+
+// Decide sets the final decision and the step that caused it. by is nil for
+// the default deny.
+func (t *Trace) Decide(decision Decision, by *TraceStep) {
+	t.Decision = decision
+	t.DecidedBy = by
+	t.Reason = reason(decision, by)
+}
+
+func reason(decision Decision, by *TraceStep) string {
+	if by == nil {
+		return "Denied by default: no policy, permission or share allows this action on this resource"
+	}
+
+	what := by.Source
+	switch by.Source {
+	case SourcePolicy:
+		what = fmt.Sprintf("policy %q", by.Name)
+		if by.Statement != "" {
+			what += fmt.Sprintf(" (statement %s)", by.Statement)
+		}
+	case SourceResourcePermission:
+		what = fmt.Sprintf("resource permission %q", by.Name)
+	case SourceResourceShare:
+		what = fmt.Sprintf("%s share of the resource", by.Name)
+	case SourceTokenScope:
+		return "Denied: the token's OAuth scopes do not grant this action"
+	}
+
+	if decision == DecisionDeny {
+		return "Explicitly denied by " + what + "; explicit denies override any allow"
+	}
+	return "Allowed by " + what
+}
@@ -1,10 +1,14 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 )
 
 type Config struct {
@@ -13,21 +17,114 @@ type Config struct {
 	Environment    string
 	AllowedOrigins string
 	FrontendURL    string
+	// PublicURL is the external base URL of the API, as clients reach it
+	// through any gateway, with the gateway's path prefix if it has one
+	PublicURL      string
+	TrustedProxies []string // IPs and CIDR ranges whose X-Forwarded-For / X-Real-IP headers are believed
+	// Header a trusted proxy sets to the ISO country code of the client,
+	// such as CF-IPCountry; empty disables country based detection rules
+	ClientCountryHeader string
+
+	// TLS: the server terminates TLS itself when given a certificate or
+	// autocert domains, otherwise it serves plain HTTP behind a proxy
+	TLSCertFile         string
+	TLSKeyFile          string
+	TLSAutocertDomains  []string // hosts to obtain Let's Encrypt certificates for
+	TLSAutocertCacheDir string
+	TLSAutocertEmail    string
+	TLSMinVersion       string // 1.2 or 1.3
+	HTTPRedirectPort    string // with TLS, a plain HTTP port redirecting to HTTPS; empty disables it
+	// MTLSClientAuth asks clients for a certificate during the handshake, so
+	// service accounts can authenticate with a registered one
+	MTLSClientAuth bool
+
+	// Request bodies: per route group size limits in bytes, and guards on
+	// the JSON documents handlers bind
+	BodyLimitAuth      int // /auth and /oauth2
+	BodyLimitDefault   int // every other API route
+	BodyLimitPolicy    int // policy documents
+	BodyLimitContent   int // content items (attachments use ATTACHMENT_MAX_BYTES)
+	BodyLimitImport    int // user imports
+	JSONMaxDepth       int
+	JSONMaxArrayLength int
+
+	// Security headers
+	HSTSMaxAge            time.Duration // Strict-Transport-Security on HTTPS responses; 0 disables it
+	HSTSIncludeSubdomains bool
+
+	// Lifecycle
+	StartupTimeoutSeconds  int // how long to wait for Postgres/Redis at boot
+	ShutdownTimeoutSeconds int // how long in-flight requests may take to drain
+
+	// Metrics
+	MetricsEnabled bool
+	MetricsToken   string // optional bearer token required to scrape /metrics
 
 	// Database
-	DatabaseURL string
-	RedisURL    string
+	DatabaseURL      string
+	RedisURL         string
+	AutoMigrate      bool // apply pending embedded migrations at startup
+	RowLevelSecurity bool // scope tenant transactions (not other queries) with Postgres row-level security
+	ReplicaURLs      []string      // read replicas for lag-tolerant list and report queries
+	ReplicaMaxLag    time.Duration // replicas further behind are skipped until they catch up
+
+	// Redis connection; REDIS_URL selects single node, Sentinel or Cluster
+	RedisPassword         string
+	RedisPoolSize         int
+	RedisMinIdleConns     int
+	RedisTLSCAFile        string
+	RedisBreakerThreshold int           // consecutive failures before Redis calls are skipped
+	RedisBreakerCooldown  time.Duration // how long they are skipped before Redis is probed again
 
 	// Auth
-	JWTSecret     string
-	JWTExpiration string
+	JWTSecret       string
+	AccessTokenTTL  time.Duration // default; organizations may override in settings.token_lifetimes
+	RefreshTokenTTL time.Duration
+	StepUpMFAMaxAge time.Duration // how recent an MFA check sensitive operations require; 0 disables step-up
+	RoleCacheTTL    time.Duration // how long role checks cache a user's current role; 0 reads it on every check
+	ImpersonationTTL time.Duration // lifetime of the sessions root users open with POST /admin/impersonate
+	SessionIdleTimeout time.Duration // sessions unused this long expire; 0 disables. Organizations may shorten it in settings.session
+
+	// Password hashing; hashes of another algorithm or cost are replaced at
+	// the next successful login
+	PasswordHashAlgorithm string // bcrypt or argon2id
+	BcryptCost            int
+	Argon2MemoryKB        int
+	Argon2Iterations      int
+	Argon2Parallelism     int
+
+	// Breached password screening at registration, reset and change
+	BreachedPasswordCheck     string // off, api (HaveIBeenPwned range API) or bloom (local filter only)
+	BreachedPasswordAPIURL    string
+	BreachedPasswordBloomFile string // filter built with "admin build-breach-filter"; fallback when the API is unreachable
+	BreachedPasswordMinCount  int    // breaches a password must appear in to be refused
+
+	// Cookie sessions for first-party browser clients
+	SessionCookies bool   // allow clients to opt in with "X-Session-Mode: cookie"
+	CookieSecure   bool   // set the Secure attribute on session cookies
+	CookieSameSite string // Lax, Strict or None
 
 	// Logging
 	LogLevel string
 
 	// Security
-	RateLimitEnabled bool
-	RateLimitRPS     int
+	RateLimitEnabled                bool
+	RateLimitRPS                    int
+	RateLimitIPPerMinute            int // all API requests, per client IP
+	RateLimitAuthPerMinute          int // unauthenticated auth endpoints, per client IP
+	RateLimitUsernameCheckPerMinute int // username availability checks, per client IP
+	RateLimitUserPerMinute          int // authenticated requests, per user
+	RateLimitAPIKeyPerHour          int // API key requests when the key sets no rate_limit_per_hour
+	LoginThrottleDelays             []time.Duration // wait after each consecutive failed login of an email, the last repeating; empty disables
+	LoginThrottleWindow             time.Duration   // failed logins are forgotten after this long without one
+
+	// Bot challenges (CAPTCHA / proof-of-work)
+	ChallengeProvider       string // "", hcaptcha, turnstile or pow
+	ChallengeSiteKey        string
+	ChallengeSecretKey      string
+	ChallengePoWDifficulty  int  // leading zero bits required by proof-of-work
+	ChallengeAlways         bool // challenge every request instead of only flagged IPs
+	ChallengeAfterPerMinute int  // auth requests per IP per minute before the IP is flagged
 
 	// MFA
 	MFAIssuer string
@@ -39,27 +136,184 @@ type Config struct {
 	SMTPPassword string
 	SMTPFrom     string
 
+	// SMS (one-time passcodes for MFA)
+	SMSProvider      string // "" (disabled) or twilio
+	TwilioAccountSID string
+	TwilioAuthToken  string
+	TwilioFromNumber string
+
+	// Email address validation at registration and email change
+	EmailValidationMode    string   // off, warn (log and accept) or reject
+	EmailCheckMX           bool     // require the domain to accept mail (MX, or A/AAAA fallback)
+	EmailDisposableDomains []string // added to the built-in disposable domain blocklist
+
 	// Audit
 	AuditRetentionDays int
 
+	// Authorization decision log
+	AuthzDecisionSampleRate    float64 // fraction of decisions logged when the org does not set its own rate
+	AuthzDecisionRetentionDays int
+
+	// Resource access log
+	ResourceAccessLogRetentionDays int // days entries are kept when the organization does not set its own retention; 0 keeps them
+
+	// User lifecycle
+	UserPurgeGraceDays int
+
+	// Role assignments
+	RoleExpiryReminderDays int // days before a role assignment expires that its principal and assigner are reminded; 0 disables reminders
+
+	// Sharing
+	ShareExpiryReminderDays int // days before a resource share or co-authorship expires that its recipient is reminded; 0 disables reminders
+
+	// Organization lifecycle
+	OrgDeletionGraceDays int // days between scheduling an organization's deletion and carrying it out
+
+	// Content attachments
+	StorageBackend          string        // where uploads are stored: local
+	StorageLocalDir         string        // root directory of the local backend
+	AttachmentMaxBytes      int64         // largest upload; organizations may lower it in settings.attachments
+	AttachmentOrgQuotaBytes int64         // attachment storage per organization; 0 is unlimited
+	AttachmentContentTypes  []string      // accepted types; organizations may narrow them
+	AttachmentURLTTL        time.Duration // how long a signed download URL works
+	ChecksumVerifyInterval  time.Duration // how often stored blobs are checked against their checksum; 0 disables the check
+
+	// Event bus: events are always handled in process and, with a sink,
+	// also forwarded for other services to consume
+	EventSink         string   // none, redis (a Redis stream), nats or kafka
+	EventStream       string   // name of the Redis stream
+	EventStreamMaxLen int64    // approximate number of events the stream keeps
+	EventNATSURL      string   // NATS servers, comma separated
+	EventNATSSubject  string   // subject prefix; an event is published on <prefix>.<type>
+	EventKafkaBrokers []string // Kafka bootstrap brokers (host:port)
+	EventKafkaTopic   string   // topic events are written to, keyed by subject
+
+	// Audit export to the SIEM sinks of organizations
+	AuditExportQueueSize int // events a sink may have waiting; past it new events are dropped
+
+	// Encryption at rest of TOTP secrets, MFA backup codes and selected user
+	// attributes. The master key is either local or a Vault transit key,
+	// reached with VAULT_ADDR and VAULT_TOKEN.
+	EncryptionMasterKeys        []string      // "<id>:<base64 32 byte key>", the first one active
+	EncryptionVaultTransitKey   string        // transit key name; set to wrap data keys with Vault instead
+	EncryptionVaultTransitMount string        // mount of the transit secrets engine
+	EncryptionVaultAddr         string        // VAULT_ADDR
+	EncryptionVaultToken        string        // VAULT_TOKEN
+	EncryptionVaultNamespace    string        // VAULT_NAMESPACE
+	EncryptionKeyRotation       time.Duration // age at which the data key is replaced; 0 disables rotation
+	EncryptedUserAttributes     []string      // user attribute keys stored encrypted
+
 	// OIDC
 	OIDCIssuer    string
 	JWTPrivateKey string
 	CookieDomain  string
+
+	ClaimsWebhooks bool // call organizations' claims webhooks at token issuance; false turns them all off
+
+	// security.txt (RFC 9116), served at /.well-known/security.txt
+	SecurityContacts   []string  // mailto:, https: or tel: URIs; empty serves no security.txt
+	SecurityPolicyURL  string    // disclosure policy linked from security.txt
+	SecurityTxtExpires time.Time // when the security.txt goes stale; a year after startup by default
+
+	// Enterprise authentication: SPNEGO (Kerberos) login and service account
+	// client certificates, offered to organizations of these billing tiers
+	KerberosKeytabFile       string   // keytab of the HTTP service principal; empty disables SPNEGO
+	KerberosServicePrincipal string   // such as HTTP/iam.corp.example.com; empty accepts any principal of the keytab
+	EnterpriseAuthTiers      []string // billing tiers allowed SPNEGO and client certificates
+
+	// Token signing keys
+	JWTVerifyKeyFiles   []string  // retired keys still accepted and published in JWKS
+	JWTHS256AcceptUntil time.Time // HS256 tokens signed with JWT_SECRET are accepted until then
 }
 
-func Load() *Config {
+// Load reads the configuration from the environment. Every setting may
+// instead be given as a file named by <NAME>_FILE (Docker secrets) or, when
+// VAULT_ADDR is set, as a key of the Vault secret at VAULT_SECRET_PATH; the
+// environment takes precedence over the file and the file over Vault. All
+// missing and invalid settings are reported together in the error.
+func Load() (*Config, error) {
+	loadErrs = nil
+	secrets, err := loadVaultSecrets()
+	if err != nil {
+		return nil, err
+	}
+	vaultSecrets = secrets
+	defer func() { vaultSecrets = nil }()
+
 	cfg := &Config{
 		Port:           getEnv("PORT", "8080"),
 		Environment:    getEnv("ENVIRONMENT", "development"),
 		AllowedOrigins: getEnv("ALLOWED_ORIGINS", "*"),
 		FrontendURL:    getEnv("FRONTEND_URL", "http://localhost:5173"),
 
-		DatabaseURL: requireEnv("DATABASE_URL"),
-		RedisURL:    requireEnv("REDIS_URL"),
+		ClientCountryHeader: getEnv("CLIENT_COUNTRY_HEADER", ""),
+
+		TLSCertFile:         getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:          getEnv("TLS_KEY_FILE", ""),
+		TLSAutocertCacheDir: getEnv("TLS_AUTOCERT_CACHE_DIR", "./certs"),
+		TLSAutocertEmail:    getEnv("TLS_AUTOCERT_EMAIL", ""),
+		TLSMinVersion:       getEnv("TLS_MIN_VERSION", "1.2"),
+		MTLSClientAuth:      getEnv("MTLS_CLIENT_AUTH", "false") == "true",
+		HTTPRedirectPort:    getEnv("HTTP_REDIRECT_PORT", ""),
+
+		BodyLimitAuth:      getEnvAsInt("BODY_LIMIT_AUTH", 16<<10),
+		BodyLimitDefault:   getEnvAsInt("BODY_LIMIT_DEFAULT", 256<<10),
+		BodyLimitPolicy:    getEnvAsInt("BODY_LIMIT_POLICY", 1<<20),
+		BodyLimitContent:   getEnvAsInt("BODY_LIMIT_CONTENT", 4<<20),
+		BodyLimitImport:    getEnvAsInt("BODY_LIMIT_IMPORT", 20<<20),
+		JSONMaxDepth:       getEnvAsInt("JSON_MAX_DEPTH", 32),
+		JSONMaxArrayLength: getEnvAsInt("JSON_MAX_ARRAY_LENGTH", 10000),
+
+		HSTSMaxAge:            getEnvAsDuration("HSTS_MAX_AGE", 180*24*time.Hour),
+		HSTSIncludeSubdomains: getEnv("HSTS_INCLUDE_SUBDOMAINS", "false") == "true",
+
+		StartupTimeoutSeconds:  getEnvAsInt("STARTUP_TIMEOUT_SECONDS", 60),
+		ShutdownTimeoutSeconds: getEnvAsInt("SHUTDOWN_TIMEOUT_SECONDS", 30),
+
+		MetricsEnabled: getEnv("METRICS_ENABLED", "true") == "true",
+		MetricsToken:   getEnv("METRICS_TOKEN", ""),
+
+		DatabaseURL:      requireEnv("DATABASE_URL"),
+		RedisURL:         requireEnv("REDIS_URL"),
+		AutoMigrate:      getEnv("AUTO_MIGRATE", "false") == "true",
+		RowLevelSecurity: getEnv("DB_ROW_LEVEL_SECURITY", "false") == "true",
+		ReplicaMaxLag:    getEnvAsDuration("DATABASE_REPLICA_MAX_LAG", 5*time.Second),
 
-		JWTSecret:     requireEnv("JWT_SECRET"),
-		JWTExpiration: getEnv("JWT_EXPIRATION", "24h"),
+		RedisPassword:         getEnv("REDIS_PASSWORD", ""),
+		RedisPoolSize:         getEnvAsInt("REDIS_POOL_SIZE", 0),
+		RedisMinIdleConns:     getEnvAsInt("REDIS_MIN_IDLE_CONNS", 0),
+		RedisTLSCAFile:        getEnv("REDIS_TLS_CA_FILE", ""),
+		RedisBreakerThreshold: getEnvAsInt("REDIS_BREAKER_THRESHOLD", 5),
+		RedisBreakerCooldown:  getEnvAsDuration("REDIS_BREAKER_COOLDOWN", 10*time.Second),
+
+		JWTSecret:       requireEnv("JWT_SECRET"),
+		AccessTokenTTL:  getEnvAsDuration("ACCESS_TOKEN_TTL", time.Hour),
+		RefreshTokenTTL: getEnvAsDuration("REFRESH_TOKEN_TTL", 7*24*time.Hour),
+		StepUpMFAMaxAge: getEnvAsDuration("STEP_UP_MFA_MAX_AGE", 15*time.Minute),
+		RoleCacheTTL:    getEnvAsDuration("ROLE_CACHE_TTL", 10*time.Second),
+		ImpersonationTTL: getEnvAsDuration("IMPERSONATION_TTL", 15*time.Minute),
+		SessionIdleTimeout: getEnvAsDuration("SESSION_IDLE_TIMEOUT", 0),
+
+		PasswordHashAlgorithm: getEnv("PASSWORD_HASH_ALGORITHM", "bcrypt"),
+		BcryptCost:            getEnvAsInt("BCRYPT_COST", 10),
+		Argon2MemoryKB:        getEnvAsInt("ARGON2_MEMORY_KB", 64*1024),
+		Argon2Iterations:      getEnvAsInt("ARGON2_ITERATIONS", 3),
+		Argon2Parallelism:     getEnvAsInt("ARGON2_PARALLELISM", 2),
+
+		BreachedPasswordCheck:     getEnv("BREACHED_PASSWORD_CHECK", "off"),
+		BreachedPasswordAPIURL:    getEnv("BREACHED_PASSWORD_API_URL", "https://api.pwnedpasswords.com"),
+		BreachedPasswordBloomFile: getEnv("BREACHED_PASSWORD_BLOOM_FILE", ""),
+		BreachedPasswordMinCount:  getEnvAsInt("BREACHED_PASSWORD_MIN_COUNT", 1),
+
+		SessionCookies: getEnv("SESSION_COOKIES", "false") == "true",
+		CookieSameSite: getEnv("COOKIE_SAMESITE", "Lax"),
+
+		ChallengeProvider:       getEnv("CHALLENGE_PROVIDER", ""),
+		ChallengeSiteKey:        getEnv("CHALLENGE_SITE_KEY", ""),
+		ChallengeSecretKey:      getEnv("CHALLENGE_SECRET_KEY", ""),
+		ChallengePoWDifficulty:  getEnvAsInt("CHALLENGE_POW_DIFFICULTY", 20),
+		ChallengeAlways:         getEnv("CHALLENGE_ALWAYS", "false") == "true",
+		ChallengeAfterPerMinute: getEnvAsInt("CHALLENGE_AFTER_PER_MINUTE", 10),
 
 		MFAIssuer: getEnv("MFA_ISSUER", "MonkeysIdentity"),
 
@@ -69,55 +323,268 @@ func Load() *Config {
 		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
 		SMTPFrom:     getEnv("SMTP_FROM", "no-reply@monkeys.com"),
 
+		SMSProvider:      getEnv("SMS_PROVIDER", ""),
+		TwilioAccountSID: getEnv("TWILIO_ACCOUNT_SID", ""),
+		TwilioAuthToken:  getEnv("TWILIO_AUTH_TOKEN", ""),
+		TwilioFromNumber: getEnv("TWILIO_FROM_NUMBER", ""),
+
+		EmailValidationMode: getEnv("EMAIL_VALIDATION_MODE", "warn"),
+		EmailCheckMX:        getEnv("EMAIL_CHECK_MX", "true") == "true",
+
 		LogLevel:           getEnv("LOG_LEVEL", "info"),
 		AuditRetentionDays: getEnvAsInt("AUDIT_RETENTION_DAYS", 90),
 
-		RateLimitEnabled: getEnv("RATE_LIMIT_ENABLED", "true") == "true",
-		RateLimitRPS:     getEnvAsInt("RATE_LIMIT_RPS", 100),
+		AuthzDecisionSampleRate:    getEnvAsFloat("AUTHZ_DECISION_SAMPLE_RATE", 0),
+		AuthzDecisionRetentionDays: getEnvAsInt("AUTHZ_DECISION_RETENTION_DAYS", 30),
+		ResourceAccessLogRetentionDays: getEnvAsInt("RESOURCE_ACCESS_LOG_RETENTION_DAYS", 90),
+		UserPurgeGraceDays: getEnvAsInt("USER_PURGE_GRACE_DAYS", 30),
+		RoleExpiryReminderDays: getEnvAsInt("ROLE_EXPIRY_REMINDER_DAYS", 7),
+		ShareExpiryReminderDays: getEnvAsInt("SHARE_EXPIRY_REMINDER_DAYS", 3),
+		OrgDeletionGraceDays: getEnvAsInt("ORG_DELETION_GRACE_DAYS", 30),
 
-		OIDCIssuer:    getEnv("OIDC_ISSUER", "http://localhost:8080"),
+		StorageBackend:          getEnv("STORAGE_BACKEND", "local"),
+		StorageLocalDir:         getEnv("STORAGE_LOCAL_DIR", "./data/uploads"),
+		AttachmentMaxBytes:      int64(getEnvAsInt("ATTACHMENT_MAX_BYTES", 10<<20)),
+		AttachmentOrgQuotaBytes: int64(getEnvAsInt("ATTACHMENT_ORG_QUOTA_BYTES", 1<<30)),
+		AttachmentURLTTL:        getEnvAsDuration("ATTACHMENT_URL_TTL", 15*time.Minute),
+		ChecksumVerifyInterval:  getEnvAsDuration("CHECKSUM_VERIFY_INTERVAL", 7*24*time.Hour),
+
+		EventSink:         getEnv("EVENT_SINK", "none"),
+		EventStream:       getEnv("EVENT_STREAM", "identity:events"),
+		EventStreamMaxLen: int64(getEnvAsInt("EVENT_STREAM_MAX_LEN", 100000)),
+		EventNATSURL:      getEnv("EVENT_NATS_URL", "nats://localhost:4222"),
+		EventNATSSubject:  getEnv("EVENT_NATS_SUBJECT", "identity.events"),
+		EventKafkaTopic:   getEnv("EVENT_KAFKA_TOPIC", "identity.events"),
+
+		AuditExportQueueSize: getEnvAsInt("AUDIT_EXPORT_QUEUE_SIZE", 10000),
+
+		EncryptionVaultTransitKey:   getEnv("ENCRYPTION_VAULT_TRANSIT_KEY", ""),
+		EncryptionVaultTransitMount: getEnv("ENCRYPTION_VAULT_TRANSIT_MOUNT", "transit"),
+		EncryptionVaultAddr:         getEnv("VAULT_ADDR", ""),
+		EncryptionVaultToken:        getEnv("VAULT_TOKEN", ""),
+		EncryptionVaultNamespace:    getEnv("VAULT_NAMESPACE", ""),
+		EncryptionKeyRotation:       getEnvAsDuration("ENCRYPTION_KEY_ROTATION", 90*24*time.Hour),
+
+		RateLimitEnabled:                getEnv("RATE_LIMIT_ENABLED", "true") == "true",
+		RateLimitRPS:                    getEnvAsInt("RATE_LIMIT_RPS", 100),
+		RateLimitIPPerMinute:            getEnvAsInt("RATE_LIMIT_IP_PER_MINUTE", 1000),
+		RateLimitAuthPerMinute:          getEnvAsInt("RATE_LIMIT_AUTH_PER_MINUTE", 30),
+		RateLimitUsernameCheckPerMinute: getEnvAsInt("RATE_LIMIT_USERNAME_CHECK_PER_MINUTE", 20),
+		RateLimitUserPerMinute:          getEnvAsInt("RATE_LIMIT_USER_PER_MINUTE", 600),
+		RateLimitAPIKeyPerHour:          getEnvAsInt("RATE_LIMIT_API_KEY_PER_HOUR", 3600),
+		LoginThrottleDelays:             getEnvAsDurations("LOGIN_THROTTLE_DELAYS", []time.Duration{0, 2 * time.Second, 5 * time.Second, 30 * time.Second}),
+		LoginThrottleWindow:             getEnvAsDuration("LOGIN_THROTTLE_WINDOW", 15*time.Minute),
+
+		OIDCIssuer:    strings.TrimSuffix(getEnv("OIDC_ISSUER", ""), "/"),
 		JWTPrivateKey: getEnv("JWT_PRIVATE_KEY", ""),
 		CookieDomain:  getEnv("COOKIE_DOMAIN", "localhost"),
+
+		ClaimsWebhooks: getEnv("CLAIMS_WEBHOOKS_ENABLED", "true") == "true",
+
+		KerberosKeytabFile:       getEnv("KERBEROS_KEYTAB_FILE", ""),
+		KerberosServicePrincipal: getEnv("KERBEROS_SERVICE_PRINCIPAL", ""),
 	}
 
-	// If JWT_PRIVATE_KEY is empty, try to read from JWT_PRIVATE_KEY_FILE
+	for _, domain := range strings.Split(getEnv("TLS_AUTOCERT_DOMAINS", ""), ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			cfg.TLSAutocertDomains = append(cfg.TLSAutocertDomains, domain)
+		}
+	}
+	for _, contact := range strings.Split(getEnv("SECURITY_CONTACTS", ""), ",") {
+		if contact = strings.TrimSpace(contact); contact != "" {
+			cfg.SecurityContacts = append(cfg.SecurityContacts, contact)
+		}
+	}
+	for _, tier := range strings.Split(getEnv("ENTERPRISE_AUTH_TIERS", "enterprise"), ",") {
+		if tier = strings.TrimSpace(tier); tier != "" {
+			cfg.EnterpriseAuthTiers = append(cfg.EnterpriseAuthTiers, tier)
+		}
+	}
+	for _, broker := range strings.Split(getEnv("EVENT_KAFKA_BROKERS", "localhost:9092"), ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			cfg.EventKafkaBrokers = append(cfg.EventKafkaBrokers, broker)
+		}
+	}
+	for _, proxy := range strings.Split(getEnv("TRUSTED_PROXIES", ""), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			cfg.TrustedProxies = append(cfg.TrustedProxies, proxy)
+		}
+	}
+	for _, key := range strings.Split(getEnv("ENCRYPTION_MASTER_KEYS", ""), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			cfg.EncryptionMasterKeys = append(cfg.EncryptionMasterKeys, key)
+		}
+	}
+	for _, name := range strings.Split(getEnv("ENCRYPTED_USER_ATTRIBUTES", ""), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			cfg.EncryptedUserAttributes = append(cfg.EncryptedUserAttributes, name)
+		}
+	}
+	for _, url := range strings.Split(getEnv("DATABASE_REPLICA_URLS", ""), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			cfg.ReplicaURLs = append(cfg.ReplicaURLs, url)
+		}
+	}
+	// Separated by commas or whitespace so a one-per-line _FILE works too
+	cfg.EmailDisposableDomains = strings.FieldsFunc(getEnv("EMAIL_DISPOSABLE_DOMAINS", ""), func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	for _, ct := range strings.Split(getEnv("ATTACHMENT_CONTENT_TYPES", "image/png,image/jpeg,image/gif,image/webp,application/pdf"), ",") {
+		if ct = strings.ToLower(strings.TrimSpace(ct)); ct != "" {
+			cfg.AttachmentContentTypes = append(cfg.AttachmentContentTypes, ct)
+		}
+	}
+	for _, file := range strings.Split(getEnv("JWT_VERIFY_KEY_FILES", ""), ",") {
+		if file = strings.TrimSpace(file); file != "" {
+			cfg.JWTVerifyKeyFiles = append(cfg.JWTVerifyKeyFiles, file)
+		}
+	}
+	if until := getEnv("JWT_HS256_ACCEPT_UNTIL", ""); until != "" {
+		if t, err := time.Parse(time.RFC3339, until); err == nil {
+			cfg.JWTHS256AcceptUntil = t
+		} else {
+			loadErrs = append(loadErrs, fmt.Errorf("JWT_HS256_ACCEPT_UNTIL=%q is not an RFC 3339 timestamp", until))
+		}
+	}
 
-	if cfg.JWTPrivateKey == "" {
-		if keyFile := getEnv("JWT_PRIVATE_KEY_FILE", ""); keyFile != "" {
-			data, err := os.ReadFile(keyFile)
-			if err == nil {
-				cfg.JWTPrivateKey = string(data)
-			}
+	// Each of PUBLIC_URL and OIDC_ISSUER defaults to the other, so existing
+	// deployments that only set OIDC_ISSUER keep their URLs
+	cfg.PublicURL = strings.TrimSuffix(getEnv("PUBLIC_URL", cfg.OIDCIssuer), "/")
+	if cfg.PublicURL == "" {
+		cfg.PublicURL = "http://localhost:8080"
+	}
+	if cfg.OIDCIssuer == "" {
+		cfg.OIDCIssuer = cfg.PublicURL
+	}
+	cfg.FrontendURL = strings.TrimSuffix(cfg.FrontendURL, "/")
+
+	cfg.SecurityPolicyURL = getEnv("SECURITY_POLICY_URL", "")
+	cfg.SecurityTxtExpires = time.Now().UTC().AddDate(1, 0, 0).Truncate(time.Second)
+	if expires := getEnv("SECURITY_TXT_EXPIRES", ""); expires != "" {
+		if t, err := time.Parse(time.RFC3339, expires); err == nil {
+			cfg.SecurityTxtExpires = t
+		} else {
+			loadErrs = append(loadErrs, fmt.Errorf("SECURITY_TXT_EXPIRES=%q is not an RFC 3339 timestamp", expires))
 		}
 	}
 
+	cfg.CookieSecure = getEnv("COOKIE_SECURE", strconv.FormatBool(cfg.Environment == "production")) == "true"
+
 	// Handle escaped newlines in JWT_PRIVATE_KEY (common in .env files)
 	if strings.Contains(cfg.JWTPrivateKey, "\\n") {
 		cfg.JWTPrivateKey = strings.ReplaceAll(cfg.JWTPrivateKey, "\\n", "\n")
 	}
 
-	return cfg
+	if err := errors.Join(append(loadErrs, cfg.Validate())...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
-// requireEnv reads a mandatory environment variable and panics if unset/empty.
-func requireEnv(key string) string {
+
+// PathPrefix is the path of PublicURL, such as /iam when a gateway serves
+// the API under https://example.com/iam, or empty at the root of a host
+func (c *Config) PathPrefix() string {
+	u, err := url.Parse(c.PublicURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+var (
+	// loadErrs collects settings Load could not read or parse
+	loadErrs []error
+	// vaultSecrets holds the Vault secret while Load runs
+	vaultSecrets map[string]string
+)
+
+// lookupEnv reads a setting from the environment, the file named by
+// key_FILE, or Vault, in that order
+func lookupEnv(key string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
-	panic(fmt.Sprintf("FATAL: required environment variable %s is not set", key))
+	if path := os.Getenv(key + "_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			loadErrs = append(loadErrs, fmt.Errorf("%s_FILE: %w", key, err))
+			return ""
+		}
+		return strings.TrimRight(string(data), "\r\n")
+	}
+	return vaultSecrets[key]
+}
+
+// requireEnv reads a mandatory setting and records an error if it is unset
+func requireEnv(key string) string {
+	if value := lookupEnv(key); value != "" {
+		return value
+	}
+	loadErrs = append(loadErrs, fmt.Errorf("%s is required", key))
+	return ""
 }
 
 func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+	if value := lookupEnv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
 
 func getEnvAsInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intVal, err := strconv.Atoi(value); err == nil {
-			return intVal
+	if value := lookupEnv(key); value != "" {
+		intVal, err := strconv.Atoi(value)
+		if err != nil {
+			loadErrs = append(loadErrs, fmt.Errorf("%s=%q is not an integer", key, value))
+			return defaultValue
+		}
+		return intVal
+	}
+	return defaultValue
+}
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := lookupEnv(key); value != "" {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			loadErrs = append(loadErrs, fmt.Errorf("%s=%q is not a number", key, value))
+			return defaultValue
+		}
+		return f
+	}
+	return defaultValue
+}
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := lookupEnv(key); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			loadErrs = append(loadErrs, fmt.Errorf("%s=%q is not a duration such as 30s or 1h", key, value))
+			return defaultValue
 		}
+		return d
 	}
 	return defaultValue
 }
+
+// getEnvAsDurations reads a comma-separated list of durations. "none"
+// gives an empty list.
+func getEnvAsDurations(key string, defaultValue []time.Duration) []time.Duration {
+	value := lookupEnv(key)
+	if value == "" {
+		return defaultValue
+	}
+	if value == "none" {
+		return nil
+	}
+	var durations []time.Duration
+	for _, item := range strings.Split(value, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(item))
+		if err != nil || d < 0 {
+			loadErrs = append(loadErrs, fmt.Errorf("%s=%q is not a comma-separated list of durations such as 0s,2s,30s", key, value))
+			return defaultValue
+		}
+		durations = append(durations, d)
+	}
+	return durations
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setRequired(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/monkeys_iam")
+	t.Setenv("REDIS_URL", "redis://localhost:6379")
+	t.Setenv("JWT_SECRET", "dev-secret")
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	t.Setenv("DATABASE_URL", "")
+	t.Setenv("REDIS_URL", "redis://localhost:6379")
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("ACCESS_TOKEN_TTL", "soon")
+	t.Setenv("COOKIE_SAMESITE", "lax")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, lb.internal")
+	t.Setenv("TLS_CERT_FILE", "/etc/monkeys/tls.crt")
+	t.Setenv("BODY_LIMIT_AUTH", "0")
+	t.Setenv("IMPERSONATION_TTL", "8h")
+	t.Setenv("BREACHED_PASSWORD_CHECK", "bloom")
+	t.Setenv("LOGIN_THROTTLE_DELAYS", "0s,2s,soon")
+	t.Setenv("SECURITY_CONTACTS", "security@example.com")
+
+	_, err := Load()
+	if err == nil {
+		t.Fatal("Load accepted an invalid configuration")
+	}
+	for _, want := range []string{"DATABASE_URL is required", "JWT_SECRET is required", "ACCESS_TOKEN_TTL", "COOKIE_SAMESITE", "TRUSTED_PROXIES", "TLS_KEY_FILE", "BODY_LIMIT_AUTH", "IMPERSONATION_TTL", "BREACHED_PASSWORD_BLOOM_FILE", "LOGIN_THROTTLE_DELAYS", "SECURITY_CONTACTS"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadSecretFiles(t *testing.T) {
+	setRequired(t)
+	path := filepath.Join(t.TempDir(), "jwt_secret")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("JWT_SECRET_FILE", path)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.JWTSecret != "from-file" {
+		t.Errorf("JWTSecret = %q, want the file contents", cfg.JWTSecret)
+	}
+
+	t.Setenv("JWT_SECRET_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "JWT_SECRET_FILE") {
+		t.Errorf("err = %v, want the unreadable secret file reported", err)
+	}
+}
+
+func TestLoadVaultSecrets(t *testing.T) {
+	setRequired(t)
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" || r.URL.Path != "/v1/secret/data/monkeys-identity" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"SMTP_PASSWORD":"from-vault","JWT_SECRET":"ignored"},"metadata":{"version":3}}}`))
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "root")
+	t.Setenv("VAULT_SECRET_PATH", "secret/data/monkeys-identity")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SMTPPassword != "from-vault" {
+		t.Errorf("SMTPPassword = %q, want the Vault value", cfg.SMTPPassword)
+	}
+	if cfg.JWTSecret != "dev-secret" {
+		t.Errorf("JWTSecret = %q, the environment must take precedence over Vault", cfg.JWTSecret)
+	}
+
+	t.Setenv("VAULT_TOKEN", "wrong")
+	if _, err := Load(); err == nil {
+		t.Error("Load ignored a Vault error")
+	}
+}
+
+func TestLoadPublicURL(t *testing.T) {
+	setRequired(t)
+	t.Setenv("OIDC_ISSUER", "https://id.example.com/")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PublicURL != "https://id.example.com" || cfg.OIDCIssuer != "https://id.example.com" || cfg.PathPrefix() != "" {
+		t.Errorf("PublicURL = %q, OIDCIssuer = %q, PathPrefix = %q; want both from OIDC_ISSUER at the root", cfg.PublicURL, cfg.OIDCIssuer, cfg.PathPrefix())
+	}
+
+	t.Setenv("OIDC_ISSUER", "")
+	t.Setenv("PUBLIC_URL", "https://example.com/iam/")
+	if cfg, err = Load(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.OIDCIssuer != "https://example.com/iam" || cfg.PathPrefix() != "/iam" {
+		t.Errorf("OIDCIssuer = %q, PathPrefix = %q; want them from PUBLIC_URL", cfg.OIDCIssuer, cfg.PathPrefix())
+	}
+
+	for _, bad := range []string{"example.com/iam", "https://example.com/api", "https://example.com/?x=1"} {
+		t.Setenv("PUBLIC_URL", bad)
+		if _, err := Load(); err == nil || !strings.Contains(err.Error(), "PUBLIC_URL") {
+			t.Errorf("PUBLIC_URL=%q: err = %v, want it refused", bad, err)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minJWTSecretLength is the shortest JWT_SECRET accepted in production
+const minJWTSecretLength = 32
+
+// maxImpersonationTTL caps IMPERSONATION_TTL; impersonation is for short
+// support sessions
+const maxImpersonationTTL = time.Hour
+
+// Validate checks settings that would otherwise fail late or silently
+// weaken security, and returns every problem found
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		fail("PORT=%q is not a valid port", c.Port)
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		fail("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if c.TLSCertFile != "" && len(c.TLSAutocertDomains) > 0 {
+		fail("TLS_CERT_FILE and TLS_AUTOCERT_DOMAINS are mutually exclusive")
+	}
+	if len(c.TLSAutocertDomains) > 0 && c.TLSAutocertCacheDir == "" {
+		fail("TLS_AUTOCERT_DOMAINS requires TLS_AUTOCERT_CACHE_DIR")
+	}
+	switch c.TLSMinVersion {
+	case "1.2", "1.3":
+	default:
+		fail("TLS_MIN_VERSION=%q must be 1.2 or 1.3", c.TLSMinVersion)
+	}
+	if c.HTTPRedirectPort != "" {
+		if port, err := strconv.Atoi(c.HTTPRedirectPort); err != nil || port < 1 || port > 65535 {
+			fail("HTTP_REDIRECT_PORT=%q is not a valid port", c.HTTPRedirectPort)
+		} else if c.TLSCertFile == "" && len(c.TLSAutocertDomains) == 0 {
+			fail("HTTP_REDIRECT_PORT requires TLS_CERT_FILE or TLS_AUTOCERT_DOMAINS")
+		}
+	}
+	if c.MTLSClientAuth && c.TLSCertFile == "" && len(c.TLSAutocertDomains) == 0 {
+		fail("MTLS_CLIENT_AUTH requires TLS_CERT_FILE or TLS_AUTOCERT_DOMAINS")
+	}
+	if c.KerberosServicePrincipal != "" && c.KerberosKeytabFile == "" {
+		fail("KERBEROS_SERVICE_PRINCIPAL requires KERBEROS_KEYTAB_FILE")
+	}
+	for name, value := range map[string]string{"PUBLIC_URL": c.PublicURL, "OIDC_ISSUER": c.OIDCIssuer} {
+		if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			fail("%s=%q must be an http or https URL without query or fragment", name, value)
+		}
+	}
+	// The prefix is stripped from request paths, which must not eat the
+	// routes' own first segment
+	if prefix := c.PathPrefix(); prefix == "/api" || strings.HasPrefix(prefix, "/api/") {
+		fail("PUBLIC_URL path %q must not start with /api", prefix)
+	}
+	for _, contact := range c.SecurityContacts {
+		if u, err := url.Parse(contact); err != nil || (u.Scheme != "mailto" && u.Scheme != "https" && u.Scheme != "tel") {
+			fail("SECURITY_CONTACTS entry %q must be a mailto:, https: or tel: URI", contact)
+		}
+	}
+	for name, limit := range map[string]int{
+		"BODY_LIMIT_AUTH":    c.BodyLimitAuth,
+		"BODY_LIMIT_DEFAULT": c.BodyLimitDefault,
+		"BODY_LIMIT_POLICY":  c.BodyLimitPolicy,
+		"BODY_LIMIT_CONTENT": c.BodyLimitContent,
+		"BODY_LIMIT_IMPORT":  c.BodyLimitImport,
+	} {
+		if limit <= 0 {
+			fail("%s must be positive", name)
+		}
+	}
+	if c.JSONMaxDepth < 1 || c.JSONMaxArrayLength < 1 {
+		fail("JSON_MAX_DEPTH and JSON_MAX_ARRAY_LENGTH must be positive")
+	}
+	if c.HSTSMaxAge < 0 {
+		fail("HSTS_MAX_AGE must not be negative")
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			fail("TRUSTED_PROXIES entry %q is not an IP address or CIDR range", proxy)
+		}
+	}
+
+	if c.DatabaseURL != "" {
+		if _, err := url.Parse(c.DatabaseURL); err != nil {
+			fail("DATABASE_URL is not a valid URL")
+		}
+	}
+	if c.JWTSecret != "" && c.Environment == "production" && len(c.JWTSecret) < minJWTSecretLength {
+		fail("JWT_SECRET must be at least %d characters in production", minJWTSecretLength)
+	}
+
+	if c.AccessTokenTTL <= 0 {
+		fail("ACCESS_TOKEN_TTL must be positive")
+	}
+	if c.RefreshTokenTTL < c.AccessTokenTTL {
+		fail("REFRESH_TOKEN_TTL (%s) must not be shorter than ACCESS_TOKEN_TTL (%s)", c.RefreshTokenTTL, c.AccessTokenTTL)
+	}
+	if c.ImpersonationTTL < time.Minute || c.ImpersonationTTL > maxImpersonationTTL {
+		fail("IMPERSONATION_TTL (%s) must be between 1m and %s", c.ImpersonationTTL, maxImpersonationTTL)
+	}
+
+	if len(c.LoginThrottleDelays) > 0 && c.LoginThrottleWindow <= 0 {
+		fail("LOGIN_THROTTLE_WINDOW must be positive when LOGIN_THROTTLE_DELAYS is set")
+	}
+
+	switch c.CookieSameSite {
+	case "Lax", "Strict":
+	case "None":
+		if !c.CookieSecure {
+			fail("COOKIE_SAMESITE=None requires COOKIE_SECURE=true")
+		}
+	default:
+		fail("COOKIE_SAMESITE=%q must be Lax, Strict or None", c.CookieSameSite)
+	}
+
+	switch c.ChallengeProvider {
+	case "", "pow":
+	case "hcaptcha", "turnstile":
+		if c.ChallengeSiteKey == "" || c.ChallengeSecretKey == "" {
+			fail("CHALLENGE_PROVIDER=%s requires CHALLENGE_SITE_KEY and CHALLENGE_SECRET_KEY", c.ChallengeProvider)
+		}
+	default:
+		fail("CHALLENGE_PROVIDER=%q must be hcaptcha, turnstile or pow", c.ChallengeProvider)
+	}
+
+	switch c.SMSProvider {
+	case "":
+	case "twilio":
+		if c.TwilioAccountSID == "" || c.TwilioAuthToken == "" || c.TwilioFromNumber == "" {
+			fail("SMS_PROVIDER=twilio requires TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM_NUMBER")
+		}
+	default:
+		fail("SMS_PROVIDER=%q must be empty or twilio", c.SMSProvider)
+	}
+
+	switch c.BreachedPasswordCheck {
+	case "off", "api":
+	case "bloom":
+		if c.BreachedPasswordBloomFile == "" {
+			fail("BREACHED_PASSWORD_CHECK=bloom requires BREACHED_PASSWORD_BLOOM_FILE")
+		}
+	default:
+		fail("BREACHED_PASSWORD_CHECK=%q must be off, api or bloom", c.BreachedPasswordCheck)
+	}
+
+	switch c.EmailValidationMode {
+	case "off", "warn", "reject":
+	default:
+		fail("EMAIL_VALIDATION_MODE=%q must be off, warn or reject", c.EmailValidationMode)
+	}
+
+	if c.AuthzDecisionSampleRate < 0 || c.AuthzDecisionSampleRate > 1 {
+		fail("AUTHZ_DECISION_SAMPLE_RATE must be between 0 and 1")
+	}
+
+	switch c.StorageBackend {
+	case "local":
+		if c.StorageLocalDir == "" {
+			fail("STORAGE_BACKEND=local requires STORAGE_LOCAL_DIR")
+		}
+	default:
+		fail("STORAGE_BACKEND=%q must be local", c.StorageBackend)
+	}
+	if c.AttachmentMaxBytes <= 0 {
+		fail("ATTACHMENT_MAX_BYTES must be positive")
+	}
+	if c.AttachmentOrgQuotaBytes < 0 {
+		fail("ATTACHMENT_ORG_QUOTA_BYTES must not be negative")
+	}
+	if c.AttachmentURLTTL <= 0 {
+		fail("ATTACHMENT_URL_TTL must be positive")
+	}
+
+	switch c.EventSink {
+	case "none":
+	case "redis":
+		if c.EventStream == "" {
+			fail("EVENT_SINK=redis requires EVENT_STREAM")
+		}
+		if c.EventStreamMaxLen <= 0 {
+			fail("EVENT_STREAM_MAX_LEN must be positive")
+		}
+	case "nats":
+		if c.EventNATSURL == "" {
+			fail("EVENT_SINK=nats requires EVENT_NATS_URL")
+		}
+		if c.EventNATSSubject == "" || strings.ContainsAny(c.EventNATSSubject, " \t*>") {
+			fail("EVENT_NATS_SUBJECT must be a subject without spaces or wildcards")
+		}
+	case "kafka":
+		if len(c.EventKafkaBrokers) == 0 {
+			fail("EVENT_SINK=kafka requires EVENT_KAFKA_BROKERS")
+		}
+		if c.EventKafkaTopic == "" {
+			fail("EVENT_SINK=kafka requires EVENT_KAFKA_TOPIC")
+		}
+	default:
+		fail("EVENT_SINK=%q must be none, redis, nats or kafka", c.EventSink)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const vaultTimeout = 10 * time.Second
+
+// loadVaultSecrets reads the secret at VAULT_SECRET_PATH when VAULT_ADDR is
+// set. Its keys are setting names (JWT_SECRET, JWT_PRIVATE_KEY,
+// DATABASE_URL, SMTP_PASSWORD, ...) and fill in settings that are not given
+// in the environment or a _FILE. Both KV version 1 and 2 mounts are
+// supported; for version 2 the path includes "data/", e.g.
+// secret/data/monkeys-identity.
+func loadVaultSecrets() (map[string]string, error) {
+	addr := getEnv("VAULT_ADDR", "")
+	if addr == "" {
+		return nil, nil
+	}
+	token := getEnv("VAULT_TOKEN", "")
+	path := strings.Trim(getEnv("VAULT_SECRET_PATH", ""), "/")
+	if path == "" && token != "" && getEnv("ENCRYPTION_VAULT_TRANSIT_KEY", "") != "" {
+		// Vault only holds the transit key of field encryption
+		return nil, nil
+	}
+	if token == "" || path == "" {
+		return nil, fmt.Errorf("VAULT_ADDR is set but VAULT_TOKEN or VAULT_SECRET_PATH is missing")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAULT_ADDR: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := getEnv("VAULT_NAMESPACE", ""); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+
+	resp, err := (&http.Client{Timeout: vaultTimeout}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets from Vault: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read secrets from Vault: %s returned %s", path, resp.Status)
+	}
+
+	var body struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode Vault response: %w", err)
+	}
+	// KV version 2 nests the secret under data.data next to data.metadata
+	data := body.Data
+	if nested, ok := data["data"]; ok {
+		if _, hasMeta := data["metadata"]; hasMeta {
+			data = nil
+			if err := json.Unmarshal(nested, &data); err != nil {
+				return nil, fmt.Errorf("failed to decode Vault secret: %w", err)
+			}
+		}
+	}
+
+	secrets := make(map[string]string, len(data))
+	for key, raw := range data {
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("secret %s in Vault is not a string", key)
+		}
+		secrets[key] = value
+	}
+	return secrets, nil
+}
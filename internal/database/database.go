@@ -2,16 +2,27 @@ package database
 
 import (
 	"database/sql"
-	"fmt"
+	"database/sql/driver"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/lib/pq"
-	"github.com/redis/go-redis/v9"
 )
 
 type DB struct {
 	*sql.DB
+	rowLevelSecurity bool // see SetRowLevelSecurity
+
+	// Encryption of sensitive columns, see SetFieldCipher
+	fieldCipher         FieldCipher
+	encryptedAttributes map[string]bool
+
+	// Read replicas, see ConnectReplicas
+	replicas      []*Replica
+	maxReplicaLag time.Duration
+	nextReplica   atomic.Uint64
+	stopReplicas  chan struct{}
 }
 
 func Connect(databaseURL string) (*DB, error) {
@@ -27,22 +38,13 @@ func Connect(databaseURL string) (*DB, error) {
 
 	// Test connection
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return &DB{DB: db}, nil
 }
 
-func ConnectRedis(redisURL string) (*redis.Client, error) {
-	opt, err := redis.ParseURL(redisURL)
-	if err != nil {
-		return nil, fmt.Errorf("invalid REDIS_URL %q: %w", redisURL, err)
-	}
-
-	rdb := redis.NewClient(opt)
-	return rdb, nil
-}
-
 // StringArray is a helper type for handling PostgreSQL text arrays
 type StringArray []string
 
@@ -81,7 +83,7 @@ func (a *StringArray) Scan(src interface{}) error {
 }
 
 // Value implements the driver.Valuer interface
-func (a StringArray) Value() (interface{}, error) {
+func (a StringArray) Value() (driver.Value, error) {
 	if a == nil {
 		return nil, nil
 	}
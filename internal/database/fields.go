@@ -0,0 +1,68 @@
+package database
+
+// FieldCipher encrypts sensitive column values before they are written and
+// decrypts them after they are read. aad binds a value to the column and row
+// it belongs to, so a ciphertext copied to another row does not decrypt.
+type FieldCipher interface {
+	Encrypt(plaintext, aad string) (string, error)
+	// Decrypt returns values written before encryption was enabled unchanged
+	Decrypt(value, aad string) (string, error)
+	// Current reports whether the value is encrypted with the key new values
+	// are encrypted with
+	Current(value string) bool
+}
+
+// SetFieldCipher turns on encryption of TOTP secrets, MFA backup codes and
+// the named user attributes. Values already stored in plain text stay
+// readable until the re-encryption job seals them.
+func (db *DB) SetFieldCipher(cipher FieldCipher, userAttributes []string) {
+	db.fieldCipher = cipher
+	db.encryptedAttributes = make(map[string]bool, len(userAttributes))
+	for _, name := range userAttributes {
+		db.encryptedAttributes[name] = true
+	}
+}
+
+// FieldEncryption reports whether a field cipher is set
+func (db *DB) FieldEncryption() bool {
+	return db.fieldCipher != nil
+}
+
+// EncryptedAttribute reports whether the user attribute is stored encrypted
+func (db *DB) EncryptedAttribute(name string) bool {
+	return db.fieldCipher != nil && db.encryptedAttributes[name]
+}
+
+// EncryptField encrypts a value for storage; empty values and values
+// written without a cipher are stored as they are
+func (db *DB) EncryptField(value, aad string) (string, error) {
+	if db.fieldCipher == nil || value == "" {
+		return value, nil
+	}
+	return db.fieldCipher.Encrypt(value, aad)
+}
+
+// DecryptField decrypts a stored value
+func (db *DB) DecryptField(value, aad string) (string, error) {
+	if db.fieldCipher == nil || value == "" {
+		return value, nil
+	}
+	return db.fieldCipher.Decrypt(value, aad)
+}
+
+// ReencryptField returns the value encrypted with the current key, and
+// whether that differs from the stored value
+func (db *DB) ReencryptField(value, aad string) (string, bool, error) {
+	if db.fieldCipher == nil || value == "" || db.fieldCipher.Current(value) {
+		return value, false, nil
+	}
+	plaintext, err := db.fieldCipher.Decrypt(value, aad)
+	if err != nil {
+		return "", false, err
+	}
+	sealed, err := db.fieldCipher.Encrypt(plaintext, aad)
+	if err != nil {
+		return "", false, err
+	}
+	return sealed, true, nil
+}
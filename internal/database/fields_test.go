@@ -0,0 +1,26 @@
+package database
+
+import (
+	"database/sql/driver"
+	"testing"
+)
+
+func TestFieldsWithoutCipher(t *testing.T) {
+	db := &DB{}
+	if db.FieldEncryption() || db.EncryptedAttribute("ssn") {
+		t.Error("field encryption reported without a cipher")
+	}
+	if v, err := db.EncryptField("secret", "aad"); err != nil || v != "secret" {
+		t.Errorf("EncryptField = %q, %v; want the value unchanged", v, err)
+	}
+	if v, changed, err := db.ReencryptField("secret", "aad"); err != nil || changed || v != "secret" {
+		t.Errorf("ReencryptField = %q, %v, %v; want the value unchanged", v, changed, err)
+	}
+}
+
+func TestStringArrayValue(t *testing.T) {
+	var valuer driver.Valuer = StringArray{"a", "b"}
+	if v, err := valuer.Value(); err != nil || v != "{a,b}" {
+		t.Errorf("Value = %v, %v; want {a,b}", v, err)
+	}
+}
@@ -0,0 +1,260 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// ErrDirtySchema is returned when an earlier migration failed part-way and
+// the schema has to be repaired by hand before forcing a version
+var ErrDirtySchema = errors.New("database schema is dirty")
+
+// Migration is one numbered schema change
+type Migration struct {
+	Version    uint64
+	Name       string
+	Reversible bool // it has a down file
+}
+
+// MigrationStatus describes the schema version of a database
+type MigrationStatus struct {
+	Version uint64 // 0 when no migration has been applied
+	Dirty   bool
+	Latest  uint64
+	Pending []Migration
+}
+
+// Migrator applies the SQL migrations of an fs.FS with golang-migrate, so
+// the server, its migrate subcommand and the migrate CLI share the
+// schema_migrations table and can be used interchangeably. Replicas
+// starting together with AUTO_MIGRATE apply each migration once, under
+// golang-migrate's advisory lock.
+//
+// golang-migrate marks the schema dirty while a migration runs. Postgres
+// runs each migration file as one transaction, so when one fails the schema
+// is usually left at the previous version: check it, then force that version.
+type Migrator struct {
+	db         *sql.DB
+	fsys       fs.FS
+	migrations []Migration
+}
+
+// NewMigrator loads the migrations found in fsys
+func NewMigrator(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, fsys: fsys, migrations: migrations}, nil
+}
+
+// LoadMigrations lists the NNNNNN_name.up.sql / NNNNNN_name.down.sql pairs
+// of fsys, ordered by version. Every migration needs an up file.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	src, err := iofs.New(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	var migrations []Migration
+	version, err := src.First()
+	for err == nil {
+		m := Migration{Version: uint64(version)}
+		up, name, upErr := src.ReadUp(version)
+		if upErr != nil {
+			if errors.Is(upErr, os.ErrNotExist) {
+				return nil, fmt.Errorf("migration %d has no up file", version)
+			}
+			return nil, upErr
+		}
+		up.Close()
+		m.Name = name
+		if down, _, downErr := src.ReadDown(version); downErr == nil {
+			down.Close()
+			m.Reversible = true
+		} else if !errors.Is(downErr, os.ErrNotExist) {
+			return nil, downErr
+		}
+		migrations = append(migrations, m)
+		version, err = src.Next(version)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return migrations, nil
+}
+
+// Status reports the current version and the migrations not yet applied
+func (m *Migrator) Status(ctx context.Context) (*MigrationStatus, error) {
+	status := &MigrationStatus{}
+	err := m.run(ctx, func(mg *migrate.Migrate) error {
+		var err error
+		status.Version, status.Dirty, err = schemaVersion(mg)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, mig := range m.migrations {
+		status.Latest = mig.Version
+		if mig.Version > status.Version {
+			status.Pending = append(status.Pending, mig)
+		}
+	}
+	return status, nil
+}
+
+// Up applies every pending migration and returns how many were applied
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.run(ctx, func(mg *migrate.Migrate) error {
+		before, err := cleanVersion(mg)
+		if err != nil {
+			return err
+		}
+		err = mg.Up()
+		after, dirty, _ := schemaVersion(mg)
+		if dirty {
+			// The failed migration is recorded as the current version
+			after--
+		}
+		applied = m.between(before, after)
+		if errors.Is(err, migrate.ErrNoChange) {
+			return nil
+		}
+		return dirtyHint(err, dirty)
+	})
+	return applied, err
+}
+
+// Down rolls back the last steps applied migrations and returns how many
+// were rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	rolledBack := 0
+	err := m.run(ctx, func(mg *migrate.Migrate) error {
+		before, err := cleanVersion(mg)
+		if err != nil || before == 0 {
+			return err
+		}
+		err = mg.Steps(-steps)
+		after, dirty, _ := schemaVersion(mg)
+		if !dirty {
+			rolledBack = m.between(after, before)
+		} else {
+			// The schema is recorded at the version the failed rollback
+			// was going back to
+			rolledBack = m.between(after, before) - 1
+		}
+		var short migrate.ErrShortLimit
+		if errors.Is(err, migrate.ErrNoChange) || errors.As(err, &short) {
+			return nil
+		}
+		return dirtyHint(err, dirty)
+	})
+	return rolledBack, err
+}
+
+// Force records version as applied and clears the dirty flag without running
+// any SQL, after a failed migration has been repaired by hand. Version 0
+// forgets every migration.
+func (m *Migrator) Force(ctx context.Context, version uint64) error {
+	return m.run(ctx, func(mg *migrate.Migrate) error {
+		v := int(version)
+		if version == 0 {
+			v = -1
+		}
+		return mg.Force(v)
+	})
+}
+
+// run hands fn a golang-migrate instance on a connection of its own, which
+// stops after the current migration once ctx is done
+func (m *Migrator) run(ctx context.Context, fn func(mg *migrate.Migrate) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to prepare schema_migrations: %w", err)
+	}
+	var src source.Driver
+	if src, err = iofs.New(m.fsys, "."); err != nil {
+		driver.Close()
+		return err
+	}
+	mg, err := migrate.NewWithInstance("iofs", src, "postgres", driver)
+	if err != nil {
+		src.Close()
+		driver.Close()
+		return err
+	}
+	defer mg.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			mg.GracefulStop <- true
+		case <-done:
+		}
+	}()
+	return fn(mg)
+}
+
+// between counts the migrations above from up to and including to
+func (m *Migrator) between(from, to uint64) int {
+	n := 0
+	for _, mig := range m.migrations {
+		if mig.Version > from && mig.Version <= to {
+			n++
+		}
+	}
+	return n
+}
+
+// schemaVersion returns the version recorded in schema_migrations, 0 when no
+// migration has been applied
+func schemaVersion(mg *migrate.Migrate) (uint64, bool, error) {
+	version, dirty, err := mg.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return uint64(version), dirty, nil
+}
+
+// dirtyHint explains how to recover from err when it left the schema dirty
+func dirtyHint(err error, dirty bool) error {
+	if err == nil || !dirty {
+		return err
+	}
+	return fmt.Errorf("%w; the schema is marked dirty: check it, then run \"migrate force <version>\" with the version it is at", err)
+}
+
+// cleanVersion is schemaVersion that fails with ErrDirtySchema when the last
+// migration did not finish
+func cleanVersion(mg *migrate.Migrate) (uint64, error) {
+	version, dirty, err := schemaVersion(mg)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return version, fmt.Errorf("%w at version %d: fix it manually, then run \"migrate force <version>\"", ErrDirtySchema, version)
+	}
+	return version, nil
+}
@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/migrations"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000002_add_index.up.sql":   {Data: []byte("CREATE INDEX i ON t(c);")},
+		"000002_add_index.down.sql": {Data: []byte("DROP INDEX i;")},
+		"000001_init.up.sql":        {Data: []byte("CREATE TABLE t (c INT);")},
+		"000001_init.down.sql":      {Data: []byte("DROP TABLE t;")},
+		"README.md":                 {Data: []byte("ignored")},
+	}
+
+	got, err := LoadMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Version != 1 || got[1].Version != 2 {
+		t.Fatalf("migrations = %+v, want versions 1 and 2 in order", got)
+	}
+	if got[0].Name != "init" || !got[0].Reversible {
+		t.Errorf("migration 1 = %+v", got[0])
+	}
+
+	delete(fsys, "000002_add_index.up.sql")
+	if _, err := LoadMigrations(fsys); err == nil {
+		t.Error("migration without an up file was accepted")
+	}
+}
+
+func TestEmbeddedMigrationsArePaired(t *testing.T) {
+	got, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range got {
+		if !m.Reversible {
+			t.Errorf("migration %d_%s has no down file", m.Version, m.Name)
+		}
+		if i > 0 && m.Version == got[i-1].Version {
+			t.Errorf("duplicate migration version %d", m.Version)
+		}
+	}
+}
+
+// migrationTestDB opens the database of TEST_DATABASE_URL with a schema of
+// its own, dropped afterwards. Tests using it are skipped unless it is set.
+func migrationTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := Connect(databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	schema := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	db, err := Connect(u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db.DB
+}
+
+func TestMigratorDirtyState(t *testing.T) {
+	db := migrationTestDB(t)
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"000001_init.up.sql":     {Data: []byte("CREATE TABLE t (c INT);")},
+		"000001_init.down.sql":   {Data: []byte("DROP TABLE t;")},
+		"000002_broken.up.sql":   {Data: []byte("CREATE TABLE u (c INT); SELECT missing FROM t;")},
+		"000002_broken.down.sql": {Data: []byte("DROP TABLE u;")},
+	}
+	migrator, err := NewMigrator(db, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err == nil {
+		t.Fatal("broken migration succeeded")
+	}
+	if applied != 1 {
+		t.Errorf("applied = %d, want 1", applied)
+	}
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Dirty || status.Version != 2 {
+		t.Errorf("status = %+v, want dirty at version 2", status)
+	}
+	// The failed file ran as one transaction
+	var exists bool
+	if err := db.QueryRow(`SELECT to_regclass('u') IS NOT NULL`).Scan(&exists); err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Error("table of the failed migration was created")
+	}
+
+	if _, err := migrator.Up(ctx); !errors.Is(err, ErrDirtySchema) {
+		t.Errorf("Up on a dirty schema = %v, want ErrDirtySchema", err)
+	}
+	if _, err := migrator.Down(ctx, 1); !errors.Is(err, ErrDirtySchema) {
+		t.Errorf("Down on a dirty schema = %v, want ErrDirtySchema", err)
+	}
+
+	// Repaired: back to the version the schema is at, with the fixed file
+	if err := migrator.Force(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	fsys["000002_broken.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE u (c INT);")}
+	if migrator, err = NewMigrator(db, fsys); err != nil {
+		t.Fatal(err)
+	}
+	if applied, err := migrator.Up(ctx); err != nil || applied != 1 {
+		t.Fatalf("Up after force = %d, %v, want 1 migration applied", applied, err)
+	}
+	if applied, err := migrator.Up(ctx); err != nil || applied != 0 {
+		t.Errorf("Up when current = %d, %v, want nothing applied", applied, err)
+	}
+
+	if rolledBack, err := migrator.Down(ctx, 5); err != nil || rolledBack != 2 {
+		t.Errorf("Down(5) = %d, %v, want both migrations rolled back", rolledBack, err)
+	}
+	if status, err = migrator.Status(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status.Dirty || status.Version != 0 || len(status.Pending) != 2 {
+		t.Errorf("status after rollback = %+v, want version 0 with 2 pending", status)
+	}
+}
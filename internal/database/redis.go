@@ -0,0 +1,253 @@
+package database
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisOptions tunes the Redis connection beyond what REDIS_URL carries.
+// Zero values keep the URL's (or the client's default) setting.
+type RedisOptions struct {
+	Password     string // overrides the URL password so it can be kept out of the URL
+	PoolSize     int
+	MinIdleConns int
+	TLSCAFile    string // PEM bundle trusted for rediss connections instead of the system roots
+}
+
+// ConnectRedis creates a client for redisURL, which selects the deployment:
+//
+//	redis://[user:password@]host:port[/db]                     single node
+//	rediss://...                                               single node over TLS
+//	redis+cluster://[user:password@]host:port?addr=host:port   Redis Cluster seed nodes
+//	redis+sentinel://[user:password@]host:port/master[/db]?addr=host:port&sentinel_password=...
+//
+// The +cluster and +sentinel schemes also have a rediss+ variant for TLS.
+// Query parameters understood by go-redis (pool_size, dial_timeout, ...)
+// are honoured for single node and cluster URLs.
+func ConnectRedis(redisURL string, opts RedisOptions) (redis.UniversalClient, error) {
+	u, err := url.Parse(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	tlsScheme := strings.HasPrefix(u.Scheme, "rediss")
+
+	switch strings.TrimPrefix(strings.TrimPrefix(u.Scheme, "rediss"), "redis") {
+	case "+cluster":
+		u.Scheme = strings.TrimSuffix(u.Scheme, "+cluster")
+		o, err := redis.ParseClusterURL(u.String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+		}
+		if err := opts.apply(tlsScheme, &o.Password, &o.PoolSize, &o.MinIdleConns, &o.TLSConfig); err != nil {
+			return nil, err
+		}
+		return redis.NewClusterClient(o), nil
+
+	case "+sentinel":
+		o, err := parseSentinelURL(u)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+		}
+		if err := opts.apply(tlsScheme, &o.Password, &o.PoolSize, &o.MinIdleConns, &o.TLSConfig); err != nil {
+			return nil, err
+		}
+		return redis.NewFailoverClient(o), nil
+
+	default:
+		o, err := redis.ParseURL(redisURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+		}
+		if err := opts.apply(tlsScheme, &o.Password, &o.PoolSize, &o.MinIdleConns, &o.TLSConfig); err != nil {
+			return nil, err
+		}
+		return redis.NewClient(o), nil
+	}
+}
+
+func (opts RedisOptions) apply(tlsScheme bool, password *string, poolSize, minIdleConns *int, tlsConfig **tls.Config) error {
+	if opts.Password != "" {
+		*password = opts.Password
+	}
+	if opts.PoolSize > 0 {
+		*poolSize = opts.PoolSize
+	}
+	if opts.MinIdleConns > 0 {
+		*minIdleConns = opts.MinIdleConns
+	}
+	if opts.TLSCAFile == "" {
+		return nil
+	}
+	if !tlsScheme {
+		return errors.New("REDIS_TLS_CA_FILE is set but REDIS_URL does not use a rediss scheme")
+	}
+	pem, err := os.ReadFile(opts.TLSCAFile)
+	if err != nil {
+		return fmt.Errorf("failed to read REDIS_TLS_CA_FILE: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("REDIS_TLS_CA_FILE %s contains no certificates", opts.TLSCAFile)
+	}
+	if *tlsConfig == nil {
+		*tlsConfig = &tls.Config{}
+	}
+	(*tlsConfig).RootCAs = roots
+	(*tlsConfig).MinVersion = tls.VersionTLS12
+	return nil
+}
+
+// parseSentinelURL reads a redis+sentinel URL. The host and every addr
+// parameter are sentinels; the path names the monitored master and,
+// optionally, the database.
+func parseSentinelURL(u *url.URL) (*redis.FailoverOptions, error) {
+	q := u.Query()
+	o := &redis.FailoverOptions{
+		SentinelAddrs:    []string{u.Host},
+		SentinelUsername: q.Get("sentinel_username"),
+		SentinelPassword: q.Get("sentinel_password"),
+	}
+	o.SentinelAddrs = append(o.SentinelAddrs, q["addr"]...)
+	for i, addr := range o.SentinelAddrs {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			o.SentinelAddrs[i] = net.JoinHostPort(addr, "26379")
+		}
+	}
+
+	path := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if path[0] == "" || len(path) > 2 {
+		return nil, errors.New("sentinel URL path must be /<master>[/<db>]")
+	}
+	o.MasterName = path[0]
+	if len(path) == 2 {
+		db, err := strconv.Atoi(path[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid database number %q", path[1])
+		}
+		o.DB = db
+	}
+
+	if u.User != nil {
+		o.Username = u.User.Username()
+		o.Password, _ = u.User.Password()
+	}
+	if strings.HasPrefix(u.Scheme, "rediss") {
+		o.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return o, nil
+}
+
+// ErrRedisUnavailable is returned without contacting Redis while the
+// circuit breaker is open
+var ErrRedisUnavailable = errors.New("redis unavailable")
+
+// RedisBreaker is a redis.Hook that fails commands immediately after
+// consecutive connection failures, so an outage costs callers nothing
+// instead of a dial timeout per command. Callers already treat Redis errors
+// as a cache miss or skip the check. After the cooldown a single command is
+// let through to probe whether Redis is back.
+type RedisBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// NewRedisBreaker opens after threshold consecutive failures and stays open
+// for cooldown
+func NewRedisBreaker(threshold int, cooldown time.Duration) *RedisBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &RedisBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Open reports whether commands are currently being short-circuited
+func (b *RedisBreaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures >= b.threshold
+}
+
+func (b *RedisBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *RedisBreaker) record(err error) {
+	// The caller gave up; that says nothing about Redis
+	if errors.Is(err, context.Canceled) {
+		b.mu.Lock()
+		b.probing = false
+		b.mu.Unlock()
+		return
+	}
+
+	var reply redis.Error
+	failed := err != nil && err != redis.Nil && !errors.As(err, &reply)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+func (b *RedisBreaker) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (b *RedisBreaker) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if !b.allow() {
+			cmd.SetErr(ErrRedisUnavailable)
+			return ErrRedisUnavailable
+		}
+		err := next(ctx, cmd)
+		b.record(err)
+		return err
+	}
+}
+
+func (b *RedisBreaker) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if !b.allow() {
+			for _, cmd := range cmds {
+				cmd.SetErr(ErrRedisUnavailable)
+			}
+			return ErrRedisUnavailable
+		}
+		err := next(ctx, cmds)
+		b.record(err)
+		return err
+	}
+}
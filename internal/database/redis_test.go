@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestConnectRedis(t *testing.T) {
+	o, err := parseSentinelURL(mustParseURL(t, "redis+sentinel://:secret@s1:26379/mymaster/2?addr=s2&sentinel_password=sp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.MasterName != "mymaster" || o.DB != 2 || o.Password != "secret" || o.SentinelPassword != "sp" {
+		t.Errorf("unexpected options %+v", o)
+	}
+	if len(o.SentinelAddrs) != 2 || o.SentinelAddrs[1] != "s2:26379" {
+		t.Errorf("sentinels = %v", o.SentinelAddrs)
+	}
+
+	if _, err := ConnectRedis("redis+sentinel://s1:26379", RedisOptions{}); err == nil {
+		t.Error("sentinel URL without a master name accepted")
+	}
+	if _, err := ConnectRedis("redis://localhost:6379", RedisOptions{TLSCAFile: "ca.pem"}); err == nil {
+		t.Error("CA file accepted for a plain-text URL")
+	}
+	for _, u := range []string{"redis://localhost:6379/1", "rediss+cluster://n1:6379?addr=n2:6379"} {
+		rdb, err := ConnectRedis(u, RedisOptions{PoolSize: 4})
+		if err != nil {
+			t.Errorf("%s: %v", u, err)
+			continue
+		}
+		rdb.Close()
+	}
+}
+
+func TestRedisBreaker(t *testing.T) {
+	b := NewRedisBreaker(2, 20*time.Millisecond)
+	var calls int
+	var result error
+	process := b.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error {
+		calls++
+		return result
+	})
+	run := func() error { return process(context.Background(), redis.NewStatusCmd(context.Background(), "ping")) }
+
+	result = redis.Nil
+	run()
+	if b.Open() {
+		t.Fatal("a cache miss opened the breaker")
+	}
+
+	result = errors.New("dial tcp: connection refused")
+	run()
+	run()
+	if !b.Open() {
+		t.Fatal("breaker still closed after consecutive failures")
+	}
+	calls = 0
+	if err := run(); !errors.Is(err, ErrRedisUnavailable) || calls != 0 {
+		t.Errorf("open breaker let a command through: err=%v calls=%d", err, calls)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	result = nil
+	if err := run(); err != nil || calls != 1 {
+		t.Errorf("probe after cooldown: err=%v calls=%d", err, calls)
+	}
+	if b.Open() {
+		t.Error("breaker still open after a successful probe")
+	}
+}
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
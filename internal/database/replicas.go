@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// replicaCheckInterval is how often replica health and lag are measured
+const replicaCheckInterval = 5 * time.Second
+
+// replicaLagQuery measures how far a standby's replay is behind. A standby
+// that has replayed everything it received is current even if the primary
+// has been idle since the last replayed transaction.
+const replicaLagQuery = `
+	SELECT CASE
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END`
+
+// Replica is a read-only connection target
+type Replica struct {
+	Name string
+	DB   *sql.DB
+
+	healthy atomic.Bool
+	lag     atomic.Int64 // nanoseconds
+}
+
+// Healthy reports whether the replica answered its last check within the
+// lag tolerance
+func (r *Replica) Healthy() bool { return r.healthy.Load() }
+
+// Lag is the replication lag measured by the last check
+func (r *Replica) Lag() time.Duration { return time.Duration(r.lag.Load()) }
+
+// ConnectReplicas opens a connection pool per replica DSN. Read-heavy
+// queries are spread over the replicas whose lag is within maxLag; when none
+// qualifies they run on the primary. Replicas are checked in the background
+// until Close, and an unreachable replica does not fail startup.
+func (db *DB) ConnectReplicas(urls []string, maxLag time.Duration) error {
+	for i, url := range urls {
+		conn, err := sql.Open("postgres", url)
+		if err != nil {
+			return fmt.Errorf("replica %d: %w", i+1, err)
+		}
+		conn.SetMaxOpenConns(25)
+		conn.SetMaxIdleConns(5)
+		conn.SetConnMaxLifetime(5 * time.Minute)
+		db.replicas = append(db.replicas, &Replica{Name: fmt.Sprintf("postgres_replica_%d", i+1), DB: conn})
+	}
+	if len(db.replicas) == 0 {
+		return nil
+	}
+
+	db.maxReplicaLag = maxLag
+	db.checkReplicas()
+	db.stopReplicas = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(replicaCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-db.stopReplicas:
+				return
+			case <-ticker.C:
+				db.checkReplicas()
+			}
+		}
+	}()
+	return nil
+}
+
+func (db *DB) checkReplicas() {
+	for _, r := range db.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		var seconds float64
+		err := r.DB.QueryRowContext(ctx, replicaLagQuery).Scan(&seconds)
+		cancel()
+		if err != nil {
+			r.healthy.Store(false)
+			continue
+		}
+		lag := time.Duration(seconds * float64(time.Second))
+		r.lag.Store(int64(lag))
+		r.healthy.Store(db.maxReplicaLag <= 0 || lag <= db.maxReplicaLag)
+	}
+}
+
+// Replicas returns the configured replicas
+func (db *DB) Replicas() []*Replica {
+	return db.replicas
+}
+
+// Reader returns the pool for a read that tolerates replication lag: the
+// next healthy replica in turn, or the primary when there is none. Reads
+// that must see the caller's own writes belong on the primary.
+func (db *DB) Reader() *sql.DB {
+	n := uint64(len(db.replicas))
+	if n == 0 {
+		return db.DB
+	}
+	start := db.nextReplica.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if r := db.replicas[(start+i)%n]; r.Healthy() {
+			return r.DB
+		}
+	}
+	return db.DB
+}
+
+// Close stops the replica checks and closes every pool
+func (db *DB) Close() error {
+	if db.stopReplicas != nil {
+		close(db.stopReplicas)
+		db.stopReplicas = nil
+	}
+	for _, r := range db.replicas {
+		r.DB.Close()
+	}
+	return db.DB.Close()
+}
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestReaderSkipsUnhealthyReplicas(t *testing.T) {
+	primary, a, b := &sql.DB{}, &sql.DB{}, &sql.DB{}
+	db := &DB{DB: primary}
+	if db.Reader() != primary {
+		t.Error("reader without replicas is not the primary")
+	}
+
+	ra, rb := &Replica{Name: "a", DB: a}, &Replica{Name: "b", DB: b}
+	db.replicas = []*Replica{ra, rb}
+	if db.Reader() != primary {
+		t.Error("reader with no healthy replica is not the primary")
+	}
+
+	rb.healthy.Store(true)
+	for i := 0; i < 3; i++ {
+		if db.Reader() != b {
+			t.Fatal("reader did not pick the only healthy replica")
+		}
+	}
+
+	ra.healthy.Store(true)
+	seen := map[*sql.DB]bool{}
+	for i := 0; i < 4; i++ {
+		seen[db.Reader()] = true
+	}
+	if !seen[a] || !seen[b] || seen[primary] {
+		t.Errorf("reads were not spread over the healthy replicas: %v", seen)
+	}
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+type tenantKey struct{}
+
+// WithTenant returns a context that scopes transactions begun with it to the
+// organization when row-level security is enabled. Only transactions are
+// scoped: queries run outside one are unaffected by the tenant. Root callers
+// that manage every organization should not set a tenant.
+func WithTenant(ctx context.Context, orgID string) context.Context {
+	if orgID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, tenantKey{}, orgID)
+}
+
+// TenantFromContext returns the organization set by WithTenant
+func TenantFromContext(ctx context.Context) (string, bool) {
+	orgID, ok := ctx.Value(tenantKey{}).(string)
+	return orgID, ok && orgID != ""
+}
+
+// SetRowLevelSecurity turns tenant scoping of transactions on or off. The
+// Postgres policies from migration 000018 only restrict rows for
+// transactions that set app.current_org, so this can be enabled gradually.
+//
+// This is not tenant isolation. Only transactions begun with BeginTx, which
+// is what queries.Transact uses, set app.current_org; the many reads and
+// writes that run directly on the pool see every organization's rows, and
+// stay confined only by the organization filters in their SQL. The policies
+// are a safeguard for the transactional paths on top of those filters.
+func (db *DB) SetRowLevelSecurity(enabled bool) {
+	db.rowLevelSecurity = enabled
+}
+
+// BeginTx starts a transaction. With row-level security enabled and a
+// tenant in ctx, the transaction only sees and writes that tenant's rows.
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil || !db.rowLevelSecurity {
+		return tx, err
+	}
+	if orgID, ok := TenantFromContext(ctx); ok {
+		// set_config with is_local = true is SET LOCAL with a bind parameter
+		if _, err := tx.ExecContext(ctx, `SELECT set_config('app.current_org', $1, true)`, orgID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+// Begin starts a transaction without a tenant
+func (db *DB) Begin() (*sql.Tx, error) {
+	return db.BeginTx(context.Background(), nil)
+}
@@ -0,0 +1,21 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWithTenant(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := TenantFromContext(ctx); ok {
+		t.Error("tenant found in a bare context")
+	}
+	if _, ok := TenantFromContext(WithTenant(ctx, "")); ok {
+		t.Error("empty organization set as tenant")
+	}
+
+	orgID, ok := TenantFromContext(WithTenant(ctx, "org-a"))
+	if !ok || orgID != "org-a" {
+		t.Errorf("tenant = %q, %v; want org-a", orgID, ok)
+	}
+}
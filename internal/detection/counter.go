@@ -0,0 +1,48 @@
+package detection
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Counter keeps the sliding windows of the rules where every replica sees
+// them
+type Counter interface {
+	// Add records the occurrence member of key at the given time and
+	// returns how many occurrences of key fall within the window ending then
+	Add(ctx context.Context, key, member string, at time.Time, window time.Duration) (int64, error)
+	// Claim reports whether the caller is the first to claim key within
+	// ttl; rules claim their alert so that it is raised once per window
+	Claim(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+type redisCounter struct {
+	redis redis.UniversalClient
+}
+
+// NewRedisCounter keeps windows in Redis sorted sets scored by time
+func NewRedisCounter(rdb redis.UniversalClient) Counter {
+	return &redisCounter{redis: rdb}
+}
+
+func (c *redisCounter) Add(ctx context.Context, key, member string, at time.Time, window time.Duration) (int64, error) {
+	var count *redis.IntCmd
+	_, err := c.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(at.Add(-window).UnixMilli(), 10))
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(at.UnixMilli()), Member: member})
+		count = pipe.ZCard(ctx, key)
+		pipe.PExpire(ctx, key, window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count.Val(), nil
+}
+
+func (c *redisCounter) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return c.redis.SetNX(ctx, key, "1", ttl).Result()
+}
@@ -0,0 +1,327 @@
+package detection
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/events"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestValidateFillsDefaults(t *testing.T) {
+	rule := &models.SecurityRule{Name: "brute force", Type: TypeFailedLogins}
+	if err := Validate(rule); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if rule.Threshold != 5 || rule.WindowMinutes != 10 || rule.Severity != "high" {
+		t.Errorf("defaults = %d/%d/%s, want 5/10/high", rule.Threshold, rule.WindowMinutes, rule.Severity)
+	}
+
+	rule = &models.SecurityRule{Name: "new country", Type: TypeAPIKeyNewCountry, Threshold: 2, Severity: "low"}
+	if err := Validate(rule); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if rule.Threshold != 2 || rule.WindowMinutes != 60 || rule.Severity != "low" {
+		t.Errorf("settings = %d/%d/%s, want 2/60/low", rule.Threshold, rule.WindowMinutes, rule.Severity)
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		rule models.SecurityRule
+		want string
+	}{
+		{"unknown type", models.SecurityRule{Name: "x", Type: "port_scan"}, "type"},
+		{"no name", models.SecurityRule{Name: " ", Type: TypeFailedLogins}, "name"},
+		{"negative threshold", models.SecurityRule{Name: "x", Type: TypeFailedLogins, Threshold: -1}, "threshold"},
+		{"long window", models.SecurityRule{Name: "x", Type: TypeFailedLogins, WindowMinutes: MaxWindowMinutes + 1}, "window_minutes"},
+		{"severity", models.SecurityRule{Name: "x", Type: TypeFailedLogins, Severity: "urgent"}, "severity"},
+		{"plain http webhook", models.SecurityRule{Name: "x", Type: TypeFailedLogins, WebhookURL: "http://example.com/hook"}, "webhook_url"},
+		{"long secret", models.SecurityRule{Name: "x", Type: TypeFailedLogins, WebhookSecret: strings.Repeat("s", 257)}, "webhook_secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(&tt.rule)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate = %v, want an error about %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuditSignal(t *testing.T) {
+	ip := "203.0.113.7"
+	sig, ok := auditSignal(models.AuditEvent{OrganizationID: "org", Action: "login", Result: "failure",
+		PrincipalID: strPtr("u1"), IPAddress: &ip})
+	if !ok || sig.ruleType != TypeFailedLogins || sig.subject != "user:u1" {
+		t.Errorf("failed login of known user = %+v, %v", sig, ok)
+	}
+
+	sig, ok = auditSignal(models.AuditEvent{OrganizationID: "org", Action: "login", Result: "failure", IPAddress: &ip})
+	if !ok || sig.subject != "ip:"+ip {
+		t.Errorf("failed login of unknown user = %+v, %v; want subject ip:%s", sig, ok, ip)
+	}
+
+	if _, ok := auditSignal(models.AuditEvent{OrganizationID: "org", Action: "login", Result: "success", PrincipalID: strPtr("u1")}); ok {
+		t.Error("successful login carries a signal")
+	}
+
+	sig, ok = auditSignal(models.AuditEvent{OrganizationID: "org", Action: ActionAPIKeyNewCountry, PrincipalID: strPtr("sa1"),
+		ResourceID: strPtr("ak_1"), AdditionalContext: `{"country":"BR","known_countries":["US"]}`})
+	if !ok || sig.ruleType != TypeAPIKeyNewCountry || sig.subject != "api_key:ak_1" || sig.details["country"] != "BR" {
+		t.Errorf("new country = %+v, %v", sig, ok)
+	}
+
+	sig, ok = auditSignal(models.AuditEvent{OrganizationID: "org", Action: ActionChecksumMismatch,
+		ResourceID: strPtr("r1"), AdditionalContext: `{"resource_name":"report.pdf","expected":"aa","actual":"bb"}`})
+	if !ok || sig.ruleType != TypeChecksumMismatch || sig.subject != "resource:r1" || sig.details["actual"] != "bb" {
+		t.Errorf("checksum mismatch = %+v, %v", sig, ok)
+	}
+	if got := summary(models.SecurityRule{Type: TypeChecksumMismatch}, sig, 1); got != "Resource report.pdf no longer matches its stored checksum" {
+		t.Errorf("checksum mismatch summary = %q", got)
+	}
+}
+
+func TestBusSignal(t *testing.T) {
+	sig, ok := busSignal(events.Event{Type: events.PolicyUpdated, OrganizationID: "org", Subject: "p1", ActorID: "u1",
+		Data: map[string]interface{}{"name": "admins"}})
+	if !ok || sig.ruleType != TypePolicyWildcard || sig.subject != "policy:p1" || sig.details["policy_name"] != "admins" {
+		t.Errorf("policy update = %+v, %v", sig, ok)
+	}
+
+	sig, ok = busSignal(events.Event{Type: events.RoleAssigned, OrganizationID: "org", Subject: "u2", ActorID: "u1",
+		Data: map[string]interface{}{"role_id": "r1"}})
+	if !ok || sig.ruleType != TypeMassRoleAssignment || sig.subject != "user:u1" || sig.details["principal_id"] != "u2" {
+		t.Errorf("role assignment = %+v, %v", sig, ok)
+	}
+
+	if _, ok := busSignal(events.Event{Type: events.RoleAssigned, OrganizationID: "org", Subject: "u2"}); ok {
+		t.Error("role assignment without an actor carries a signal")
+	}
+}
+
+// memoryCounter is a Counter for a single process
+type memoryCounter struct {
+	mu      sync.Mutex
+	windows map[string][]time.Time
+	claims  map[string]time.Time
+}
+
+func newMemoryCounter() *memoryCounter {
+	return &memoryCounter{windows: map[string][]time.Time{}, claims: map[string]time.Time{}}
+}
+
+func (c *memoryCounter) Add(_ context.Context, key, _ string, at time.Time, window time.Duration) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var kept []time.Time
+	for _, t := range c.windows[key] {
+		if !t.Before(at.Add(-window)) {
+			kept = append(kept, t)
+		}
+	}
+	c.windows[key] = append(kept, at)
+	return int64(len(c.windows[key])), nil
+}
+
+func (c *memoryCounter) Claim(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if until, ok := c.claims[key]; ok && time.Now().Before(until) {
+		return false, nil
+	}
+	c.claims[key] = time.Now().Add(ttl)
+	return true, nil
+}
+
+type fakeStore struct {
+	rules  []models.SecurityRule
+	alerts []models.SecurityAlert
+}
+
+func (s *fakeStore) ListEnabledSecurityRules() ([]models.SecurityRule, error) { return s.rules, nil }
+
+func (s *fakeStore) CreateSecurityAlert(alert *models.SecurityAlert) error {
+	alert.ID = fmt.Sprintf("alert-%d", len(s.alerts)+1)
+	alert.Status = "open"
+	alert.RaisedAt = time.Now()
+	s.alerts = append(s.alerts, *alert)
+	return nil
+}
+
+func (s *fakeStore) ListSecurityAlertRecipients(string) ([]string, error) {
+	return []string{"admin"}, nil
+}
+
+type fakePolicies map[string]string
+
+func (p fakePolicies) GetPolicy(id, _ string) (*models.Policy, error) {
+	doc, ok := p[id]
+	if !ok {
+		return nil, fmt.Errorf("policy not found")
+	}
+	return &models.Policy{ID: id, Name: id, Document: doc}, nil
+}
+
+type recordingNotifier struct{ notified []string }
+
+func (n *recordingNotifier) Notify(_ context.Context, userID string, _ models.Notification) {
+	n.notified = append(n.notified, userID)
+}
+
+func newTestEngine(t *testing.T, store *fakeStore, policies PolicyStore) *Engine {
+	t.Helper()
+	e := NewEngine(store, policies, newMemoryCounter(), logger.New("error"))
+	if err := e.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	return e
+}
+
+func TestEngineRaisesOnceWhenThresholdReached(t *testing.T) {
+	store := &fakeStore{rules: []models.SecurityRule{{ID: "r1", OrganizationID: "org", Name: "brute force",
+		Type: TypeFailedLogins, Threshold: 3, WindowMinutes: 10, Severity: "high", NotifyAdmins: true}}}
+	e := newTestEngine(t, store, nil)
+	notifier := &recordingNotifier{}
+	e.notifier = notifier
+
+	failure := func(i int) signal {
+		sig, _ := auditSignal(models.AuditEvent{ID: fmt.Sprint(i), OrganizationID: "org", Action: "login",
+			Result: "failure", PrincipalID: strPtr("u1"), Timestamp: time.Now()})
+		return sig
+	}
+	for i := 0; i < 2; i++ {
+		e.evaluate(context.Background(), failure(i))
+	}
+	if len(store.alerts) != 0 {
+		t.Fatalf("alert raised below the threshold: %+v", store.alerts)
+	}
+	for i := 2; i < 5; i++ {
+		e.evaluate(context.Background(), failure(i))
+	}
+	if len(store.alerts) != 1 {
+		t.Fatalf("raised %d alerts, want 1 per window", len(store.alerts))
+	}
+	alert := store.alerts[0]
+	if alert.Subject != "user:u1" || alert.RuleName != "brute force" || *alert.RuleID != "r1" {
+		t.Errorf("alert = %+v", alert)
+	}
+	if want := "3 failed logins for user u1 within 10 minutes"; alert.Summary != want {
+		t.Errorf("summary = %q, want %q", alert.Summary, want)
+	}
+	if len(notifier.notified) != 1 || notifier.notified[0] != "admin" {
+		t.Errorf("notified %v, want the admin", notifier.notified)
+	}
+}
+
+func TestEngineIgnoresOtherOrganizations(t *testing.T) {
+	store := &fakeStore{rules: []models.SecurityRule{{ID: "r1", OrganizationID: "org", Name: "roles",
+		Type: TypeMassRoleAssignment, Threshold: 1, WindowMinutes: 10}}}
+	e := newTestEngine(t, store, nil)
+
+	sig, _ := busSignal(events.Event{Type: events.RoleAssigned, OrganizationID: "other", Subject: "u2", ActorID: "u1"})
+	if e.watching(sig) {
+		t.Error("engine watches an organization without rules")
+	}
+	e.evaluate(context.Background(), sig)
+	if len(store.alerts) != 0 {
+		t.Errorf("raised %+v for another organization", store.alerts)
+	}
+}
+
+func TestEnginePolicyWildcard(t *testing.T) {
+	store := &fakeStore{rules: []models.SecurityRule{{ID: "r1", OrganizationID: "org", Name: "wildcards",
+		Type: TypePolicyWildcard, Threshold: 1, WindowMinutes: 60, Severity: "high"}}}
+	policies := fakePolicies{
+		"narrow": `{"Statement":[{"Effect":"Allow","Action":["blog:post:read"],"Resource":"arn:blog:post/*"}]}`,
+		"broad":  `{"Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`,
+	}
+	e := newTestEngine(t, store, policies)
+
+	for _, id := range []string{"narrow", "broad"} {
+		sig, _ := busSignal(events.Event{Type: events.PolicyCreated, OrganizationID: "org", Subject: id, ActorID: "u1"})
+		e.evaluate(context.Background(), sig)
+	}
+	if len(store.alerts) != 1 || store.alerts[0].Subject != "policy:broad" {
+		t.Fatalf("alerts = %+v, want one for the broad policy", store.alerts)
+	}
+	var details map[string]interface{}
+	if err := json.Unmarshal(store.alerts[0].Details, &details); err != nil {
+		t.Fatalf("details: %v", err)
+	}
+	if findings, _ := details["findings"].([]interface{}); len(findings) == 0 {
+		t.Errorf("details = %s, want the lint findings", store.alerts[0].Details)
+	}
+}
+
+func TestSign(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	body := []byte(`{"type":"security_alert.raised"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1700000000."))
+	mac.Write(body)
+	want := "t=1700000000,v1=" + hex.EncodeToString(mac.Sum(nil))
+	if got := Sign("secret", at, body); got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+}
+
+func TestPostWebhook(t *testing.T) {
+	var status int
+	var received http.Header
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	e := NewEngine(&fakeStore{}, nil, newMemoryCounter(), logger.New("error"))
+	rule := models.SecurityRule{WebhookURL: srv.URL, WebhookSecret: "secret"}
+	payload := []byte(`{"type":"security_alert.raised","alert":{}}`)
+
+	status = http.StatusNoContent
+	if retry, err := e.postWebhook(rule, payload); err != nil || retry {
+		t.Fatalf("postWebhook = %v, %v", retry, err)
+	}
+	if string(body) != string(payload) || received.Get(EventHeader) != events.SecurityAlertRaised {
+		t.Errorf("received %s with headers %v", body, received)
+	}
+	timestamp := strings.TrimPrefix(strings.SplitN(received.Get(SignatureHeader), ",", 2)[0], "t=")
+	var unix int64
+	fmt.Sscan(timestamp, &unix)
+	if got, want := received.Get(SignatureHeader), Sign("secret", time.Unix(unix, 0), payload); got != want {
+		t.Errorf("signature = %s, want %s", got, want)
+	}
+
+	status = http.StatusServiceUnavailable
+	if retry, err := e.postWebhook(rule, payload); err == nil || !retry {
+		t.Errorf("503 = %v, %v; want a retried error", retry, err)
+	}
+	status = http.StatusBadRequest
+	if retry, err := e.postWebhook(rule, payload); err == nil || retry {
+		t.Errorf("400 = %v, %v; want an error not retried", retry, err)
+	}
+
+	rule.WebhookSecret = ""
+	status = http.StatusOK
+	if _, err := e.postWebhook(rule, payload); err != nil || received.Get(SignatureHeader) != "" {
+		t.Errorf("unsigned webhook = %v with signature %q", err, received.Get(SignatureHeader))
+	}
+}
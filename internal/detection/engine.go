@@ -0,0 +1,336 @@
+package detection
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/authz"
+	"github.com/the-monkeys/monkeys-identity/internal/events"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+const (
+	// refreshInterval is how often rule changes made on any replica are
+	// picked up
+	refreshInterval = 30 * time.Second
+	// queueSize bounds the signals waiting to be evaluated; past it they
+	// are dropped rather than slowing the audit worker down
+	queueSize = 1000
+	// evaluateTimeout bounds the Redis and database work of one signal
+	evaluateTimeout = 5 * time.Second
+)
+
+// Store loads the rules and records the alerts
+type Store interface {
+	ListEnabledSecurityRules() ([]models.SecurityRule, error)
+	CreateSecurityAlert(alert *models.SecurityAlert) error
+	ListSecurityAlertRecipients(organizationID string) ([]string, error)
+}
+
+// PolicyStore loads the policies policy_wildcard rules inspect
+type PolicyStore interface {
+	GetPolicy(id, organizationID string) (*models.Policy, error)
+}
+
+// Notifier delivers a notification to a user's open streams
+type Notifier interface {
+	Notify(ctx context.Context, userID string, n models.Notification)
+}
+
+// Engine evaluates the rules of each organization against its audit events
+// and identity events. It is an audit exporter: hand it to the audit
+// service, and to the event bus with Relay.
+type Engine struct {
+	store    Store
+	policies PolicyStore
+	counter  Counter
+	logger   *logger.Logger
+	client   *http.Client
+
+	// set by Relay
+	bus      events.Bus
+	notifier Notifier
+
+	mu    sync.RWMutex
+	rules map[string][]models.SecurityRule // by organization ID
+
+	queue chan signal
+	// ctx ends the webhook deliveries still retrying when the engine stops
+	ctx    context.Context
+	cancel context.CancelFunc
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewEngine creates an Engine; signals are queued until Start
+func NewEngine(store Store, policies PolicyStore, counter Counter, l *logger.Logger) *Engine {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Engine{
+		store:    store,
+		policies: policies,
+		counter:  counter,
+		logger:   l,
+		client:   &http.Client{Timeout: webhookTimeout},
+		rules:    make(map[string][]models.SecurityRule),
+		queue:    make(chan signal, queueSize),
+		ctx:      ctx,
+		cancel:   cancel,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Relay evaluates the policy and role assignment events of the bus, and
+// publishes and notifies alerts through them. Call before the bus starts.
+func (e *Engine) Relay(bus events.Bus, notifier Notifier) {
+	e.bus, e.notifier = bus, notifier
+	for _, kind := range []string{events.PolicyCreated, events.PolicyUpdated, events.RoleAssigned} {
+		bus.Subscribe(kind, func(ctx context.Context, ev events.Event) {
+			if sig, ok := busSignal(ev); ok {
+				e.offer(sig)
+			}
+		})
+	}
+}
+
+// Export queues the signal of an audit event, if it carries one. It never
+// blocks.
+func (e *Engine) Export(ev models.AuditEvent) {
+	if sig, ok := auditSignal(ev); ok {
+		e.offer(sig)
+	}
+}
+
+func (e *Engine) offer(sig signal) {
+	if !e.watching(sig) {
+		return
+	}
+	select {
+	case e.queue <- sig:
+	default:
+		e.logger.Warn("Detection queue full, dropping %s signal for organization %s", sig.ruleType, sig.orgID)
+	}
+}
+
+// watching reports whether the organization of the signal has a rule of
+// its type, so that signals nobody looks at never reach Redis
+func (e *Engine) watching(sig signal) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, rule := range e.rules[sig.orgID] {
+		if rule.Type == sig.ruleType {
+			return true
+		}
+	}
+	return false
+}
+
+// Start loads the rules and evaluates the queued signals in the background,
+// reloading the rules every refreshInterval
+func (e *Engine) Start(ctx context.Context) {
+	if err := e.Reload(); err != nil {
+		e.logger.Warn("Failed to load security rules: %v", err)
+	}
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case sig := <-e.queue:
+				e.evaluate(ctx, sig)
+			case <-ticker.C:
+				if err := e.Reload(); err != nil {
+					e.logger.Warn("Failed to reload security rules: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			case <-e.stop:
+				e.drain(ctx)
+				return
+			}
+		}
+	}()
+}
+
+// Stop evaluates the queued signals, waits for the worker to exit and
+// abandons the webhook deliveries still retrying
+func (e *Engine) Stop() {
+	select {
+	case <-e.stop:
+	default:
+		close(e.stop)
+	}
+	<-e.done
+	e.cancel()
+}
+
+func (e *Engine) drain(ctx context.Context) {
+	for {
+		select {
+		case sig := <-e.queue:
+			e.evaluate(ctx, sig)
+		default:
+			return
+		}
+	}
+}
+
+// Reload replaces the rules with the enabled rules of every organization
+func (e *Engine) Reload() error {
+	rules, err := e.store.ListEnabledSecurityRules()
+	if err != nil {
+		return err
+	}
+	byOrg := make(map[string][]models.SecurityRule)
+	for _, rule := range rules {
+		byOrg[rule.OrganizationID] = append(byOrg[rule.OrganizationID], rule)
+	}
+	e.mu.Lock()
+	e.rules = byOrg
+	e.mu.Unlock()
+	return nil
+}
+
+// evaluate counts the signal in the window of every rule of its type and
+// raises the alerts of the rules reaching their threshold
+func (e *Engine) evaluate(parent context.Context, sig signal) {
+	ctx, cancel := context.WithTimeout(parent, evaluateTimeout)
+	defer cancel()
+
+	e.mu.RLock()
+	var rules []models.SecurityRule
+	for _, rule := range e.rules[sig.orgID] {
+		if rule.Type == sig.ruleType {
+			rules = append(rules, rule)
+		}
+	}
+	e.mu.RUnlock()
+	if len(rules) == 0 {
+		return
+	}
+
+	if sig.ruleType == TypePolicyWildcard {
+		findings := e.wildcardFindings(sig)
+		if len(findings) == 0 {
+			return
+		}
+		sig.details["findings"] = findings
+	}
+
+	member := sig.id
+	if member == "" {
+		member = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	at := sig.at
+	if at.IsZero() {
+		at = time.Now()
+	}
+	for _, rule := range rules {
+		window := time.Duration(rule.WindowMinutes) * time.Minute
+		count, err := e.counter.Add(ctx, "detection:count:"+rule.ID+":"+sig.subject, member, at, window)
+		if err != nil {
+			e.logger.Warn("Failed to count %s signal for security rule %s: %v", sig.ruleType, rule.ID, err)
+			continue
+		}
+		if count < int64(rule.Threshold) {
+			continue
+		}
+		first, err := e.counter.Claim(ctx, "detection:fired:"+rule.ID+":"+sig.subject, window)
+		if err != nil {
+			e.logger.Warn("Failed to claim alert of security rule %s: %v", rule.ID, err)
+			continue
+		}
+		if first {
+			e.raise(ctx, rule, sig, count)
+		}
+	}
+}
+
+// wildcardFindings returns the lint findings that make the policy of the
+// signal a wildcard grant
+func (e *Engine) wildcardFindings(sig signal) []authz.LintFinding {
+	policyID, _ := sig.details["policy_id"].(string)
+	policy, err := e.policies.GetPolicy(policyID, sig.orgID)
+	if err != nil {
+		e.logger.Warn("Failed to load policy %s for detection: %v", policyID, err)
+		return nil
+	}
+	sig.details["policy_name"] = policy.Name
+	lint, err := authz.LintDocument(policy.Document)
+	if err != nil {
+		return nil
+	}
+	var findings []authz.LintFinding
+	for _, f := range lint {
+		if f.Rule == authz.RuleFullWildcard || f.Rule == authz.RuleOverlyBroad {
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// raise stores the alert of a rule and sends it to the organization admins,
+// the event bus and the rule's webhook
+func (e *Engine) raise(ctx context.Context, rule models.SecurityRule, sig signal, count int64) {
+	sig.details["count"] = count
+	details, err := json.Marshal(sig.details)
+	if err != nil {
+		details = []byte("{}")
+	}
+	alert := &models.SecurityAlert{
+		OrganizationID: rule.OrganizationID,
+		RuleID:         &rule.ID,
+		RuleName:       rule.Name,
+		RuleType:       rule.Type,
+		Severity:       rule.Severity,
+		Subject:        sig.subject,
+		Summary:        summary(rule, sig, count),
+		Details:        details,
+	}
+	if err := e.store.CreateSecurityAlert(alert); err != nil {
+		e.logger.Error("Failed to store alert of security rule %s: %v", rule.ID, err)
+		return
+	}
+	e.logger.Warn("Security alert %s raised for organization %s: %s", alert.ID, alert.OrganizationID, alert.Summary)
+
+	data := map[string]interface{}{
+		"alert_id":  alert.ID,
+		"rule_id":   rule.ID,
+		"rule_name": rule.Name,
+		"rule_type": rule.Type,
+		"severity":  alert.Severity,
+		"subject":   alert.Subject,
+		"summary":   alert.Summary,
+	}
+	if e.bus != nil {
+		e.bus.Publish(ctx, events.Event{
+			Type:           events.SecurityAlertRaised,
+			OrganizationID: alert.OrganizationID,
+			Subject:        alert.ID,
+			Data:           data,
+		})
+	}
+	if rule.NotifyAdmins && e.notifier != nil {
+		admins, err := e.store.ListSecurityAlertRecipients(alert.OrganizationID)
+		if err != nil {
+			e.logger.Warn("Failed to list admins to notify of security alert %s: %v", alert.ID, err)
+		}
+		for _, userID := range admins {
+			e.notifier.Notify(ctx, userID, models.Notification{
+				Type:           events.SecurityAlertRaised,
+				OrganizationID: alert.OrganizationID,
+				Data:           data,
+				CreatedAt:      alert.RaisedAt,
+			})
+		}
+	}
+	if rule.WebhookURL != "" {
+		go e.deliverWebhook(rule, alert)
+	}
+}
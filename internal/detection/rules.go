@@ -0,0 +1,238 @@
+// Package detection raises security alerts from the audit stream of each
+// organization. Organizations configure rules such as "5 failed logins for
+// one user within 10 minutes"; the engine counts the matching occurrences
+// in Redis, so every replica contributes to the same windows, and stores an
+// alert, notifies the organization admins and calls the rule's webhook when
+// a rule fires.
+package detection
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/events"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// Rule types
+const (
+	// TypeFailedLogins counts failed password and MFA checks per user, or
+	// per IP address for unknown accounts
+	TypeFailedLogins = "failed_logins"
+	// TypePolicyWildcard matches policies created or updated with an Allow
+	// statement granting every action, or every action of a service on
+	// every resource
+	TypePolicyWildcard = "policy_wildcard"
+	// TypeMassRoleAssignment counts the role assignments made by one user
+	TypeMassRoleAssignment = "mass_role_assignment"
+	// TypeAPIKeyNewCountry matches API keys used from a country they were
+	// not used from before
+	TypeAPIKeyNewCountry = "api_key_new_country"
+	// TypeChecksumMismatch matches resources whose content stopped matching
+	// their stored checksum
+	TypeChecksumMismatch = "checksum_mismatch"
+)
+
+// ActionAPIKeyNewCountry is the audit action recorded when an API key is
+// used from a new country. AdditionalContext holds the country and the
+// countries the key was used from before.
+const ActionAPIKeyNewCountry = "api_key_new_country"
+
+// ActionChecksumMismatch is the audit action recorded when the content of a
+// resource no longer matches its stored checksum. AdditionalContext holds
+// the expected and actual checksums and how they were found.
+const ActionChecksumMismatch = "resource_checksum_mismatch"
+
+// RuleDefaults are the settings a rule of a type gets when created without
+// them. Types matching single occurrences have a threshold of 1; their
+// window is how long repeats are folded into the first alert.
+type RuleDefaults struct {
+	Threshold     int    `json:"threshold"`
+	WindowMinutes int    `json:"window_minutes"`
+	Severity      string `json:"severity"`
+}
+
+// Defaults holds the defaults of every rule type
+var Defaults = map[string]RuleDefaults{
+	TypeFailedLogins:       {Threshold: 5, WindowMinutes: 10, Severity: "high"},
+	TypePolicyWildcard:     {Threshold: 1, WindowMinutes: 60, Severity: "high"},
+	TypeMassRoleAssignment: {Threshold: 20, WindowMinutes: 10, Severity: "high"},
+	TypeAPIKeyNewCountry:   {Threshold: 1, WindowMinutes: 60, Severity: "medium"},
+	TypeChecksumMismatch:   {Threshold: 1, WindowMinutes: 24 * 60, Severity: "critical"},
+}
+
+// Limits of rule settings
+const (
+	MaxThreshold     = 10000
+	MaxWindowMinutes = 7 * 24 * 60
+	maxSecretLength  = 256
+)
+
+var severities = map[string]bool{"critical": true, "high": true, "medium": true, "low": true}
+
+// Validate checks a rule before it is stored, filling the threshold, window
+// and severity left unset with the defaults of its type
+func Validate(rule *models.SecurityRule) error {
+	defaults, ok := Defaults[rule.Type]
+	if !ok {
+		return fmt.Errorf("type must be one of failed_logins, policy_wildcard, mass_role_assignment, api_key_new_country, checksum_mismatch")
+	}
+	if strings.TrimSpace(rule.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if rule.Threshold == 0 {
+		rule.Threshold = defaults.Threshold
+	}
+	if rule.WindowMinutes == 0 {
+		rule.WindowMinutes = defaults.WindowMinutes
+	}
+	if rule.Severity == "" {
+		rule.Severity = defaults.Severity
+	}
+	if rule.Threshold < 1 || rule.Threshold > MaxThreshold {
+		return fmt.Errorf("threshold must be between 1 and %d", MaxThreshold)
+	}
+	if rule.WindowMinutes < 1 || rule.WindowMinutes > MaxWindowMinutes {
+		return fmt.Errorf("window_minutes must be between 1 and %d", MaxWindowMinutes)
+	}
+	if !severities[rule.Severity] {
+		return fmt.Errorf("severity must be critical, high, medium or low")
+	}
+	if rule.WebhookURL != "" {
+		u, err := url.Parse(rule.WebhookURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("webhook_url must be an https URL")
+		}
+	}
+	if len(rule.WebhookSecret) > maxSecretLength {
+		return fmt.Errorf("webhook_secret must be at most %d characters", maxSecretLength)
+	}
+	return nil
+}
+
+// signal is an occurrence that rules of one type count. Subject is what
+// they count it by.
+type signal struct {
+	id       string
+	orgID    string
+	ruleType string
+	subject  string
+	at       time.Time
+	details  map[string]interface{}
+}
+
+// auditSignal returns the signal an audit event carries, if any
+func auditSignal(e models.AuditEvent) (signal, bool) {
+	sig := signal{id: e.ID, orgID: e.OrganizationID, at: e.Timestamp, details: map[string]interface{}{"event_id": e.EventID}}
+	if e.IPAddress != nil && *e.IPAddress != "" {
+		sig.details["ip_address"] = *e.IPAddress
+	}
+
+	switch {
+	case (e.Action == "login" && e.Result == "failure") || e.Action == "login_mfa_failed":
+		sig.ruleType = TypeFailedLogins
+		switch {
+		case e.PrincipalID != nil && *e.PrincipalID != "":
+			sig.subject = "user:" + *e.PrincipalID
+		case e.IPAddress != nil && *e.IPAddress != "":
+			sig.subject = "ip:" + *e.IPAddress
+		default:
+			return signal{}, false
+		}
+		if e.ErrorMessage != nil && *e.ErrorMessage != "" {
+			sig.details["reason"] = *e.ErrorMessage
+		}
+	case e.Action == ActionAPIKeyNewCountry:
+		if e.ResourceID == nil || *e.ResourceID == "" {
+			return signal{}, false
+		}
+		sig.ruleType = TypeAPIKeyNewCountry
+		sig.subject = "api_key:" + *e.ResourceID
+		var context map[string]interface{}
+		if json.Unmarshal([]byte(e.AdditionalContext), &context) == nil {
+			for k, v := range context {
+				sig.details[k] = v
+			}
+		}
+		if e.PrincipalID != nil {
+			sig.details["service_account_id"] = *e.PrincipalID
+		}
+	case e.Action == ActionChecksumMismatch:
+		if e.ResourceID == nil || *e.ResourceID == "" {
+			return signal{}, false
+		}
+		sig.ruleType = TypeChecksumMismatch
+		sig.subject = "resource:" + *e.ResourceID
+		var context map[string]interface{}
+		if json.Unmarshal([]byte(e.AdditionalContext), &context) == nil {
+			for k, v := range context {
+				sig.details[k] = v
+			}
+		}
+		if e.PrincipalID != nil {
+			sig.details["actor_id"] = *e.PrincipalID
+		}
+	default:
+		return signal{}, false
+	}
+	return sig, true
+}
+
+// busSignal returns the signal an identity event carries, if any
+func busSignal(e events.Event) (signal, bool) {
+	sig := signal{id: e.ID, orgID: e.OrganizationID, at: e.OccurredAt, details: map[string]interface{}{"event_id": e.ID}}
+	switch e.Type {
+	case events.PolicyCreated, events.PolicyUpdated:
+		sig.ruleType = TypePolicyWildcard
+		sig.subject = "policy:" + e.Subject
+		sig.details["policy_id"] = e.Subject
+		sig.details["change"] = e.Type
+		if name, ok := e.Data["name"]; ok {
+			sig.details["policy_name"] = name
+		}
+	case events.RoleAssigned:
+		if e.ActorID == "" {
+			return signal{}, false
+		}
+		sig.ruleType = TypeMassRoleAssignment
+		sig.subject = "user:" + e.ActorID
+		sig.details["role_id"] = e.Data["role_id"]
+		sig.details["principal_id"] = e.Subject
+	default:
+		return signal{}, false
+	}
+	if e.ActorID != "" {
+		sig.details["actor_id"] = e.ActorID
+	}
+	return sig, true
+}
+
+// summary describes why a rule fired, for the alert and its notifications
+func summary(rule models.SecurityRule, sig signal, count int64) string {
+	subject := strings.Replace(sig.subject, ":", " ", 1)
+	switch rule.Type {
+	case TypeFailedLogins:
+		return fmt.Sprintf("%d failed logins for %s within %d minutes", count, subject, rule.WindowMinutes)
+	case TypeMassRoleAssignment:
+		return fmt.Sprintf("%d role assignments by %s within %d minutes", count, subject, rule.WindowMinutes)
+	case TypePolicyWildcard:
+		name, _ := sig.details["policy_name"].(string)
+		if name == "" {
+			name, _ = sig.details["policy_id"].(string)
+		}
+		return fmt.Sprintf("Policy %s grants wildcard access", name)
+	case TypeAPIKeyNewCountry:
+		country, _ := sig.details["country"].(string)
+		return fmt.Sprintf("API key %s used from new country %s", strings.TrimPrefix(sig.subject, "api_key:"), country)
+	case TypeChecksumMismatch:
+		name, _ := sig.details["resource_name"].(string)
+		if name == "" {
+			name = strings.TrimPrefix(sig.subject, "resource:")
+		}
+		return fmt.Sprintf("Resource %s no longer matches its stored checksum", name)
+	}
+	return rule.Name
+}
@@ -0,0 +1,101 @@
+package detection
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/events"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+const (
+	// SignatureHeader carries "t=<unix time>,v1=<hex HMAC-SHA256>" on the
+	// webhooks of rules with a secret. The HMAC covers "<unix time>." followed
+	// by the body, so receivers can reject replays of old deliveries.
+	SignatureHeader = "X-Monkeys-Signature"
+	// EventHeader names the event a webhook delivers
+	EventHeader = "X-Monkeys-Event"
+
+	webhookTimeout  = 10 * time.Second
+	webhookAttempts = 3
+	webhookBackoff  = 2 * time.Second
+)
+
+// WebhookPayload is the JSON body posted to the webhook of a rule
+type WebhookPayload struct {
+	Type  string               `json:"type"`
+	Alert models.SecurityAlert `json:"alert"`
+}
+
+// Sign returns the SignatureHeader value of a webhook body sent at the
+// given time
+func Sign(secret string, at time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliverWebhook posts the alert to the rule's webhook, retrying server
+// errors and failed connections a few times
+func (e *Engine) deliverWebhook(rule models.SecurityRule, alert *models.SecurityAlert) {
+	body, err := json.Marshal(WebhookPayload{Type: events.SecurityAlertRaised, Alert: *alert})
+	if err != nil {
+		e.logger.Error("Failed to encode webhook of security alert %s: %v", alert.ID, err)
+		return
+	}
+
+	backoff := webhookBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := e.postWebhook(rule, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt == webhookAttempts {
+			e.logger.Warn("Giving up on webhook of security alert %s after %d attempts: %v", alert.ID, attempt, err)
+			return
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-e.ctx.Done():
+			return
+		}
+	}
+}
+
+// postWebhook sends one delivery and reports whether a failure is worth
+// retrying
+func (e *Engine) postWebhook(rule models.SecurityRule, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(e.ctx, http.MethodPost, rule.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Monkeys-IAM-Webhook")
+	req.Header.Set(EventHeader, events.SecurityAlertRaised)
+	if rule.WebhookSecret != "" {
+		req.Header.Set(SignatureHeader, Sign(rule.WebhookSecret, time.Now(), body))
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+			fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return false, nil
+}
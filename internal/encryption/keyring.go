@@ -0,0 +1,317 @@
+// Package encryption seals sensitive column values with envelope
+// encryption. Values are encrypted with AES-256-GCM under a data key; data
+// keys are stored in the database wrapped by a master key that never leaves
+// the configuration or Vault. Every encrypted value names the data key it was
+// sealed with, so keys can be rotated while old values stay readable.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// Prefix starts every encrypted value: "enc:v1:<data key ID>:<sealed>",
+// where sealed is the base64url nonce followed by the GCM ciphertext
+const Prefix = "enc:v1:"
+
+// refreshInterval is how often data keys created by other replicas are
+// picked up
+const refreshInterval = 5 * time.Minute
+
+var (
+	// ErrUnknownKey is returned for values sealed with a data key the
+	// keyring does not have
+	ErrUnknownKey = errors.New("unknown data encryption key")
+	// ErrMalformed is returned for values that start with Prefix but do not
+	// parse
+	ErrMalformed = errors.New("malformed encrypted value")
+)
+
+// KeyStore persists the wrapped data keys
+type KeyStore interface {
+	ListDataKeys() ([]models.DataEncryptionKey, error)
+	// CreateDataKey stores the first active key; it fails with a conflict
+	// when another replica created one first
+	CreateDataKey(key *models.DataEncryptionKey) error
+	// RotateDataKey retires the active key and stores key as the new one
+	RotateDataKey(key *models.DataEncryptionKey) error
+	RewrapDataKey(id, masterKeyID string, wrapped []byte) error
+}
+
+// Keyring holds the unwrapped data keys and implements database.FieldCipher
+type Keyring struct {
+	master MasterKey
+	store  KeyStore
+
+	mu            sync.RWMutex
+	keys          map[string]cipher.AEAD
+	active        string
+	activeCreated time.Time
+	loadedAt      time.Time
+}
+
+// NewKeyring loads the data keys, creating the first one if there is none
+func NewKeyring(master MasterKey, store KeyStore) (*Keyring, error) {
+	k := &Keyring{master: master, store: store, keys: make(map[string]cipher.AEAD)}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload unwraps the data keys added since the last load and picks up the
+// active key
+func (k *Keyring) Reload() error {
+	stored, err := k.store.ListDataKeys()
+	if err != nil {
+		return fmt.Errorf("failed to list data keys: %w", err)
+	}
+	if !hasActive(stored) {
+		// Another replica may create the first key at the same time and win;
+		// either way there is an active key afterwards
+		createErr := k.create()
+		if stored, err = k.store.ListDataKeys(); err != nil {
+			return fmt.Errorf("failed to list data keys: %w", err)
+		}
+		if !hasActive(stored) {
+			return fmt.Errorf("failed to create a data key: %v", createErr)
+		}
+	}
+
+	k.mu.RLock()
+	known := make(map[string]bool, len(k.keys))
+	for id := range k.keys {
+		known[id] = true
+	}
+	k.mu.RUnlock()
+
+	unwrapped := make(map[string]cipher.AEAD)
+	var active string
+	var activeCreated time.Time
+	for _, key := range stored {
+		if key.Status == "active" {
+			active, activeCreated = key.ID, key.CreatedAt
+		}
+		if known[key.ID] {
+			continue
+		}
+		raw, err := k.master.Unwrap(key.MasterKeyID, key.WrappedKey)
+		if err != nil {
+			return fmt.Errorf("failed to unwrap data key %s: %w", key.ID, err)
+		}
+		aead, err := newAEAD(raw)
+		if err != nil {
+			return fmt.Errorf("data key %s: %w", key.ID, err)
+		}
+		unwrapped[key.ID] = aead
+	}
+
+	k.mu.Lock()
+	for id, aead := range unwrapped {
+		k.keys[id] = aead
+	}
+	k.active, k.activeCreated, k.loadedAt = active, activeCreated, time.Now()
+	k.mu.Unlock()
+	return nil
+}
+
+func hasActive(keys []models.DataEncryptionKey) bool {
+	for _, key := range keys {
+		if key.Status == "active" {
+			return true
+		}
+	}
+	return false
+}
+
+// newDataKey generates a data key wrapped by the master key
+func (k *Keyring) newDataKey() (*models.DataEncryptionKey, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	wrapped, err := k.master.Wrap(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	return &models.DataEncryptionKey{MasterKeyID: k.master.ID(), WrappedKey: wrapped, Status: "active"}, nil
+}
+
+func (k *Keyring) create() error {
+	key, err := k.newDataKey()
+	if err != nil {
+		return err
+	}
+	return k.store.CreateDataKey(key)
+}
+
+// Rotate makes a new data key the active one. Values sealed with the old
+// keys stay readable; the re-encryption job moves them to the new key.
+func (k *Keyring) Rotate() (string, error) {
+	key, err := k.newDataKey()
+	if err != nil {
+		return "", err
+	}
+	if err := k.store.RotateDataKey(key); err != nil {
+		return "", err
+	}
+	return key.ID, k.Reload()
+}
+
+// ActiveKey returns the ID and creation time of the data key new values are
+// sealed with
+func (k *Keyring) ActiveKey() (string, time.Time) {
+	k.refresh()
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active, k.activeCreated
+}
+
+// Rewrap wraps the data keys still wrapped by a previous master key with the
+// current one, and returns how many it rewrapped
+func (k *Keyring) Rewrap() (int, error) {
+	stored, err := k.store.ListDataKeys()
+	if err != nil {
+		return 0, err
+	}
+	rewrapped := 0
+	for _, key := range stored {
+		if key.MasterKeyID == k.master.ID() {
+			continue
+		}
+		raw, err := k.master.Unwrap(key.MasterKeyID, key.WrappedKey)
+		if err != nil {
+			return rewrapped, fmt.Errorf("failed to unwrap data key %s: %w", key.ID, err)
+		}
+		wrapped, err := k.master.Wrap(raw)
+		if err != nil {
+			return rewrapped, fmt.Errorf("failed to wrap data key %s: %w", key.ID, err)
+		}
+		if err := k.store.RewrapDataKey(key.ID, k.master.ID(), wrapped); err != nil {
+			return rewrapped, err
+		}
+		rewrapped++
+	}
+	return rewrapped, nil
+}
+
+// refresh reloads the keys once refreshInterval has passed. A failed reload
+// keeps the keys already loaded.
+func (k *Keyring) refresh() {
+	k.mu.RLock()
+	stale := time.Since(k.loadedAt) > refreshInterval
+	k.mu.RUnlock()
+	if stale {
+		k.Reload()
+	}
+}
+
+func (k *Keyring) key(id string) (cipher.AEAD, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	aead, ok := k.keys[id]
+	return aead, ok
+}
+
+// Encrypt seals plaintext with the active data key
+func (k *Keyring) Encrypt(plaintext, aad string) (string, error) {
+	k.refresh()
+	k.mu.RLock()
+	id := k.active
+	aead := k.keys[id]
+	k.mu.RUnlock()
+	if aead == nil {
+		return "", ErrUnknownKey
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(aad))
+	return Prefix + id + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value sealed by Encrypt with the same aad. Values without
+// Prefix were stored before encryption was enabled and are returned as they
+// are.
+func (k *Keyring) Decrypt(value, aad string) (string, error) {
+	if !strings.HasPrefix(value, Prefix) {
+		return value, nil
+	}
+	id, sealed, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+	aead, ok := k.key(id)
+	if !ok {
+		// Created by another replica since the last load
+		if err := k.Reload(); err != nil {
+			return "", err
+		}
+		if aead, ok = k.key(id); !ok {
+			return "", ErrUnknownKey
+		}
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", ErrMalformed
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(aad))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value sealed with data key %s: %w", id, err)
+	}
+	return string(plaintext), nil
+}
+
+// Current reports whether the value is sealed with the active data key
+func (k *Keyring) Current(value string) bool {
+	id, ok := KeyID(value)
+	if !ok {
+		return false
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return id == k.active
+}
+
+// KeyID returns the data key a value is sealed with, if it is encrypted
+func KeyID(value string) (string, bool) {
+	if !strings.HasPrefix(value, Prefix) {
+		return "", false
+	}
+	id, _, err := parse(value)
+	return id, err == nil
+}
+
+func parse(value string) (string, []byte, error) {
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, Prefix), ":")
+	if !ok || id == "" {
+		return "", nil, ErrMalformed
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", nil, ErrMalformed
+	}
+	return id, sealed, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
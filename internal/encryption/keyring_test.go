@@ -0,0 +1,243 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// memoryStore is a KeyStore kept in memory
+type memoryStore struct {
+	mu   sync.Mutex
+	keys []models.DataEncryptionKey
+	seq  int
+}
+
+func (s *memoryStore) ListDataKeys() ([]models.DataEncryptionKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]models.DataEncryptionKey(nil), s.keys...), nil
+}
+
+func (s *memoryStore) CreateDataKey(key *models.DataEncryptionKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range s.keys {
+		if k.Status == "active" {
+			return errors.New("conflict: active data key exists")
+		}
+	}
+	s.add(key)
+	return nil
+}
+
+func (s *memoryStore) RotateDataKey(key *models.DataEncryptionKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.keys {
+		s.keys[i].Status = "retired"
+	}
+	s.add(key)
+	return nil
+}
+
+func (s *memoryStore) RewrapDataKey(id, masterKeyID string, wrapped []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.keys {
+		if s.keys[i].ID == id {
+			s.keys[i].MasterKeyID, s.keys[i].WrappedKey = masterKeyID, wrapped
+			return nil
+		}
+	}
+	return errors.New("data key not found")
+}
+
+func (s *memoryStore) add(key *models.DataEncryptionKey) {
+	s.seq++
+	key.ID = fmt.Sprintf("key-%d", s.seq)
+	key.CreatedAt = time.Now()
+	s.keys = append(s.keys, *key)
+}
+
+func localEntry(id string, b byte) string {
+	return id + ":" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func newTestKeyring(t *testing.T, store KeyStore, entries ...string) *Keyring {
+	t.Helper()
+	master, err := NewLocalMasterKey(entries)
+	if err != nil {
+		t.Fatalf("NewLocalMasterKey: %v", err)
+	}
+	k, err := NewKeyring(master, store)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	return k
+}
+
+func TestKeyringRoundTrip(t *testing.T) {
+	store := &memoryStore{}
+	k := newTestKeyring(t, store, localEntry("m1", 'a'))
+	if len(store.keys) != 1 || store.keys[0].MasterKeyID != "local:m1" {
+		t.Fatalf("stored keys = %+v, want one key wrapped by local:m1", store.keys)
+	}
+
+	sealed, err := k.Encrypt("JBSWY3DPEHPK3PXP", "users.totp_secret:u1")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if !strings.HasPrefix(sealed, Prefix+"key-1:") || strings.Contains(sealed, "JBSWY3DPEHPK3PXP") {
+		t.Fatalf("sealed = %q", sealed)
+	}
+	if id, ok := KeyID(sealed); !ok || id != "key-1" {
+		t.Errorf("KeyID = %q, %v", id, ok)
+	}
+
+	plain, err := k.Decrypt(sealed, "users.totp_secret:u1")
+	if err != nil || plain != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("Decrypt = %q, %v", plain, err)
+	}
+	if _, err := k.Decrypt(sealed, "users.totp_secret:u2"); err == nil {
+		t.Error("value decrypted for another row")
+	}
+	if plain, err := k.Decrypt("not-encrypted", "aad"); err != nil || plain != "not-encrypted" {
+		t.Errorf("Decrypt of a plain value = %q, %v", plain, err)
+	}
+	if _, err := k.Decrypt(Prefix+"key-1:!!", "aad"); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Decrypt of a malformed value: err = %v", err)
+	}
+	if _, err := k.Decrypt(Prefix+"key-9:AAAA", "aad"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt with an unknown key: err = %v", err)
+	}
+}
+
+func TestKeyringRotate(t *testing.T) {
+	store := &memoryStore{}
+	k := newTestKeyring(t, store, localEntry("m1", 'a'))
+	old, _ := k.Encrypt("secret", "aad")
+	if !k.Current(old) {
+		t.Fatal("value sealed with the active key is not current")
+	}
+
+	id, err := k.Rotate()
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if active, _ := k.ActiveKey(); active != id {
+		t.Errorf("active key = %s, want %s", active, id)
+	}
+	if k.Current(old) {
+		t.Error("value sealed with the retired key is still current")
+	}
+	if plain, err := k.Decrypt(old, "aad"); err != nil || plain != "secret" {
+		t.Errorf("Decrypt after rotation = %q, %v", plain, err)
+	}
+	fresh, _ := k.Encrypt("secret", "aad")
+	if keyID, _ := KeyID(fresh); keyID != id || !k.Current(fresh) {
+		t.Errorf("new value sealed with %s, want %s", keyID, id)
+	}
+
+	// Another replica loads both keys
+	other := newTestKeyring(t, store, localEntry("m1", 'a'))
+	if plain, err := other.Decrypt(old, "aad"); err != nil || plain != "secret" {
+		t.Errorf("Decrypt on another replica = %q, %v", plain, err)
+	}
+}
+
+func TestKeyringRewrap(t *testing.T) {
+	store := &memoryStore{}
+	k := newTestKeyring(t, store, localEntry("m1", 'a'))
+	sealed, _ := k.Encrypt("secret", "aad")
+
+	// m2 replaces m1, which is kept to unwrap the existing data key
+	k = newTestKeyring(t, store, localEntry("m2", 'b'), localEntry("m1", 'a'))
+	n, err := k.Rewrap()
+	if err != nil || n != 1 {
+		t.Fatalf("Rewrap = %d, %v; want 1", n, err)
+	}
+	if n, _ := k.Rewrap(); n != 0 {
+		t.Errorf("second Rewrap rewrapped %d keys", n)
+	}
+
+	// m1 can now be dropped
+	k = newTestKeyring(t, store, localEntry("m2", 'b'))
+	if plain, err := k.Decrypt(sealed, "aad"); err != nil || plain != "secret" {
+		t.Errorf("Decrypt after rewrap = %q, %v", plain, err)
+	}
+}
+
+func TestNewLocalMasterKey(t *testing.T) {
+	for name, entries := range map[string][]string{
+		"empty":      nil,
+		"no id":      {":" + base64.StdEncoding.EncodeToString(make([]byte, 32))},
+		"not base64": {"m1:***"},
+		"short key":  {"m1:" + base64.StdEncoding.EncodeToString(make([]byte, 16))},
+		"duplicate":  {localEntry("m1", 'a'), localEntry("m1", 'b')},
+	} {
+		if _, err := NewLocalMasterKey(entries); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+
+	master, _ := NewLocalMasterKey([]string{localEntry("m1", 'a')})
+	wrapped, _ := master.Wrap([]byte("data key"))
+	if _, err := master.Unwrap("local:m2", wrapped); err == nil {
+		t.Error("unwrapped with a master key that is not configured")
+	}
+}
+
+func TestVaultMasterKey(t *testing.T) {
+	var namespaces []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		namespaces = append(namespaces, r.Header.Get("X-Vault-Namespace"))
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/iam":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"ciphertext": "vault:v1:" + body["plaintext"]}})
+		case "/v1/transit/decrypt/iam":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"plaintext": strings.TrimPrefix(body["ciphertext"], "vault:v1:")}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	master := NewVaultMasterKey(srv.URL+"/", "token", "team", "", "iam")
+	if master.ID() != "vault:transit/iam" {
+		t.Errorf("ID = %s", master.ID())
+	}
+	k, err := NewKeyring(master, &memoryStore{})
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	sealed, _ := k.Encrypt("secret", "aad")
+	if plain, err := k.Decrypt(sealed, "aad"); err != nil || plain != "secret" {
+		t.Errorf("Decrypt = %q, %v", plain, err)
+	}
+	for _, ns := range namespaces {
+		if ns != "team" {
+			t.Errorf("namespace header = %q", ns)
+		}
+	}
+
+	denied := NewVaultMasterKey(srv.URL, "wrong", "", "transit", "iam")
+	if _, err := denied.Wrap([]byte("data key")); err == nil {
+		t.Error("Wrap succeeded with a rejected token")
+	}
+}
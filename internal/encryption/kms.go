@@ -0,0 +1,119 @@
+package encryption
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// KMSPrefix starts every ciphertext of the KMS API:
+// "kms:v1:<key ID>:<version>:<sealed>", where sealed is the base64url nonce
+// followed by the GCM ciphertext
+const KMSPrefix = "kms:v1:"
+
+// ErrNotAuthentic is returned for ciphertexts of the KMS API that were
+// tampered with or are opened with another context than they were sealed
+// with
+var ErrNotAuthentic = errors.New("ciphertext does not authenticate")
+
+// KeyVersion is the unwrapped material of one version of a KMS key
+type KeyVersion struct {
+	keyID   string
+	version int
+	aead    cipher.AEAD
+}
+
+// NewKeyVersion generates the material of a KMS key version, wrapped by the
+// master key
+func NewKeyVersion(master MasterKey) (*models.KMSKeyVersion, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	wrapped, err := master.Wrap(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap key material: %w", err)
+	}
+	return &models.KMSKeyVersion{MasterKeyID: master.ID(), WrappedKey: wrapped}, nil
+}
+
+// OpenKeyVersion unwraps the material of a KMS key version
+func OpenKeyVersion(master MasterKey, v *models.KMSKeyVersion) (*KeyVersion, error) {
+	raw, err := master.Unwrap(v.MasterKeyID, v.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap version %d of key %s: %w", v.Version, v.KeyID, err)
+	}
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, fmt.Errorf("version %d of key %s: %w", v.Version, v.KeyID, err)
+	}
+	return &KeyVersion{keyID: v.KeyID, version: v.Version, aead: aead}, nil
+}
+
+// additionalData binds a ciphertext to its key version as well as to the
+// caller's context, so the header cannot be swapped
+func (v *KeyVersion) additionalData(aad []byte) []byte {
+	return append([]byte(v.keyID+":"+strconv.Itoa(v.version)+"\x00"), aad...)
+}
+
+// Seal encrypts plaintext; aad must be given again to decrypt it
+func (v *KeyVersion) Seal(plaintext, aad []byte) (string, error) {
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := v.aead.Seal(nonce, nonce, plaintext, v.additionalData(aad))
+	return KMSPrefix + v.keyID + ":" + strconv.Itoa(v.version) + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a ciphertext sealed by this key version with the same aad
+func (v *KeyVersion) Open(ciphertext string, aad []byte) ([]byte, error) {
+	keyID, version, sealed, err := parseKMS(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if keyID != v.keyID || version != v.version {
+		return nil, ErrUnknownKey
+	}
+	if len(sealed) < v.aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ct := sealed[:v.aead.NonceSize()], sealed[v.aead.NonceSize():]
+	plaintext, err := v.aead.Open(nil, nonce, ct, v.additionalData(aad))
+	if err != nil {
+		return nil, fmt.Errorf("version %d of key %s: %w", v.version, v.keyID, ErrNotAuthentic)
+	}
+	return plaintext, nil
+}
+
+// ParseKMSCiphertext returns the key and version a ciphertext of the KMS API
+// was sealed with
+func ParseKMSCiphertext(ciphertext string) (string, int, error) {
+	keyID, version, _, err := parseKMS(ciphertext)
+	return keyID, version, err
+}
+
+func parseKMS(ciphertext string) (string, int, []byte, error) {
+	if !strings.HasPrefix(ciphertext, KMSPrefix) {
+		return "", 0, nil, ErrMalformed
+	}
+	parts := strings.SplitN(strings.TrimPrefix(ciphertext, KMSPrefix), ":", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return "", 0, nil, ErrMalformed
+	}
+	version, err := strconv.Atoi(parts[1])
+	if err != nil || version < 1 {
+		return "", 0, nil, ErrMalformed
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", 0, nil, ErrMalformed
+	}
+	return parts[0], version, sealed, nil
+}
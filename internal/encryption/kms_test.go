@@ -0,0 +1,62 @@
+package encryption
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestKeyVersionRoundTrip(t *testing.T) {
+	master, err := NewLocalMasterKey([]string{localEntry("m1", 'a')})
+	if err != nil {
+		t.Fatalf("NewLocalMasterKey: %v", err)
+	}
+	stored, err := NewKeyVersion(master)
+	if err != nil {
+		t.Fatalf("NewKeyVersion: %v", err)
+	}
+	if stored.MasterKeyID != "local:m1" {
+		t.Errorf("MasterKeyID = %q, want local:m1", stored.MasterKeyID)
+	}
+	stored.KeyID, stored.Version = "key-1", 2
+	v, err := OpenKeyVersion(master, stored)
+	if err != nil {
+		t.Fatalf("OpenKeyVersion: %v", err)
+	}
+
+	sealed, err := v.Seal([]byte("card 4111"), []byte(`{"purpose":"billing"}`))
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if !strings.HasPrefix(sealed, KMSPrefix+"key-1:2:") || strings.Contains(sealed, "4111") {
+		t.Fatalf("sealed = %q", sealed)
+	}
+	if id, version, err := ParseKMSCiphertext(sealed); err != nil || id != "key-1" || version != 2 {
+		t.Errorf("ParseKMSCiphertext = %q, %d, %v", id, version, err)
+	}
+
+	plain, err := v.Open(sealed, []byte(`{"purpose":"billing"}`))
+	if err != nil || string(plain) != "card 4111" {
+		t.Errorf("Open = %q, %v", plain, err)
+	}
+	if _, err := v.Open(sealed, []byte(`{"purpose":"other"}`)); !errors.Is(err, ErrNotAuthentic) {
+		t.Errorf("Open with another context: err = %v, want ErrNotAuthentic", err)
+	}
+	// The header is authenticated: claiming another version fails
+	forged := strings.Replace(sealed, ":2:", ":3:", 1)
+	other := *stored
+	other.Version = 3
+	v3, _ := OpenKeyVersion(master, &other)
+	if _, err := v3.Open(forged, []byte(`{"purpose":"billing"}`)); !errors.Is(err, ErrNotAuthentic) {
+		t.Errorf("Open under a forged version: err = %v, want ErrNotAuthentic", err)
+	}
+	if _, err := v.Open(forged, nil); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Open of another version: err = %v", err)
+	}
+
+	for _, bad := range []string{"enc:v1:key-1:AAAA", KMSPrefix + "key-1:0:AAAA", KMSPrefix + "key-1:x:AAAA", KMSPrefix + "key-1:1:!!", KMSPrefix + ":1:AAAA"} {
+		if _, _, err := ParseKMSCiphertext(bad); !errors.Is(err, ErrMalformed) {
+			t.Errorf("ParseKMSCiphertext(%q): err = %v, want ErrMalformed", bad, err)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/config"
+)
+
+// MasterKey wraps the data keys
+type MasterKey interface {
+	// ID names the master key new data keys are wrapped with
+	ID() string
+	Wrap(dataKey []byte) ([]byte, error)
+	// Unwrap opens a data key wrapped by the named master key, which may be
+	// a previous one
+	Unwrap(masterKeyID string, wrapped []byte) ([]byte, error)
+}
+
+// FromConfig returns the master key configured with
+// ENCRYPTION_VAULT_TRANSIT_KEY or ENCRYPTION_MASTER_KEYS, or nil when field
+// encryption is not configured
+func FromConfig(cfg *config.Config) (MasterKey, error) {
+	switch {
+	case cfg.EncryptionVaultTransitKey != "":
+		if cfg.EncryptionVaultAddr == "" || cfg.EncryptionVaultToken == "" {
+			return nil, fmt.Errorf("VAULT_ADDR and VAULT_TOKEN are required with ENCRYPTION_VAULT_TRANSIT_KEY")
+		}
+		return NewVaultMasterKey(cfg.EncryptionVaultAddr, cfg.EncryptionVaultToken, cfg.EncryptionVaultNamespace,
+			cfg.EncryptionVaultTransitMount, cfg.EncryptionVaultTransitKey), nil
+	case len(cfg.EncryptionMasterKeys) > 0:
+		return NewLocalMasterKey(cfg.EncryptionMasterKeys)
+	}
+	return nil, nil
+}
+
+type localMasterKey struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// NewLocalMasterKey creates a master key from "<id>:<base64 32 byte key>"
+// entries. The first entry wraps new data keys; the others are previous
+// master keys kept until the re-encryption job has rewrapped their data
+// keys.
+func NewLocalMasterKey(entries []string) (MasterKey, error) {
+	m := &localMasterKey{keys: make(map[string]cipher.AEAD)}
+	for _, entry := range entries {
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("master key must be <id>:<base64 key>")
+		}
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("master key %s is not base64: %w", id, err)
+		}
+		aead, err := newAEAD(raw)
+		if err != nil {
+			return nil, fmt.Errorf("master key %s: %w", id, err)
+		}
+		if _, dup := m.keys[id]; dup {
+			return nil, fmt.Errorf("master key %s is listed twice", id)
+		}
+		m.keys[id] = aead
+		if m.active == "" {
+			m.active = id
+		}
+	}
+	if m.active == "" {
+		return nil, fmt.Errorf("no master key configured")
+	}
+	return m, nil
+}
+
+func (m *localMasterKey) ID() string { return "local:" + m.active }
+
+func (m *localMasterKey) Wrap(dataKey []byte) ([]byte, error) {
+	aead := m.keys[m.active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, dataKey, []byte("data-key")), nil
+}
+
+func (m *localMasterKey) Unwrap(masterKeyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := m.keys[strings.TrimPrefix(masterKeyID, "local:")]
+	if !ok || !strings.HasPrefix(masterKeyID, "local:") {
+		return nil, fmt.Errorf("master key %s is not configured", masterKeyID)
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	return aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte("data-key"))
+}
+
+type vaultMasterKey struct {
+	addr      string
+	token     string
+	namespace string
+	mount     string
+	key       string
+	client    *http.Client
+}
+
+// NewVaultMasterKey wraps data keys with a key of Vault's transit secrets
+// engine. Vault keeps the versions of the key, so rotating it in Vault needs
+// no change here.
+func NewVaultMasterKey(addr, token, namespace, mount, key string) MasterKey {
+	if mount == "" {
+		mount = "transit"
+	}
+	return &vaultMasterKey{
+		addr:      strings.TrimRight(addr, "/"),
+		token:     token,
+		namespace: namespace,
+		mount:     strings.Trim(mount, "/"),
+		key:       key,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (v *vaultMasterKey) ID() string { return "vault:" + v.mount + "/" + v.key }
+
+func (v *vaultMasterKey) Wrap(dataKey []byte) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	if err := v.call("encrypt", map[string]string{"plaintext": base64.StdEncoding.EncodeToString(dataKey)}, &resp); err != nil {
+		return nil, err
+	}
+	return []byte(resp.Data.Ciphertext), nil
+}
+
+func (v *vaultMasterKey) Unwrap(masterKeyID string, wrapped []byte) ([]byte, error) {
+	if masterKeyID != v.ID() {
+		return nil, fmt.Errorf("master key %s is not configured", masterKeyID)
+	}
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := v.call("decrypt", map[string]string{"ciphertext": string(wrapped)}, &resp); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+}
+
+func (v *vaultMasterKey) call(op string, body interface{}, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, v.addr+"/v1/"+v.mount+"/"+op+"/"+v.key, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault transit %s: %w", op, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault transit %s responded %s", op, resp.Status)
+	}
+	return json.Unmarshal(data, out)
+}
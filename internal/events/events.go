@@ -0,0 +1,223 @@
+// Package events carries the identity events raised by the API, such as
+// user.created or policy.updated, to the subsystems reacting to them.
+// Events are dispatched in process and, with a sink configured, also
+// forwarded to a broker for other services.
+package events
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/config"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+// Canonical event types
+const (
+	UserCreated                = "user.created"
+	UserDormant                = "user.dormant"
+	UserSuspended              = "user.suspended"
+	LoginSucceeded             = "login.succeeded"
+	PolicyCreated              = "policy.created"
+	PolicyUpdated              = "policy.updated"
+	PolicyDeleted              = "policy.deleted"
+	RoleAssigned               = "role.assigned"
+	RoleExpiring               = "role.expiring"
+	RoleRenewalRequested       = "role_renewal.requested"
+	RoleRenewalDecided         = "role_renewal.decided"
+	SessionRevoked             = "session.revoked"
+	ShareExpiring              = "share.expiring"
+	ResourceArchived           = "resource.archived"
+	ResourceDeleted            = "resource.deleted"
+	ResourceRecertificationDue = "resource.recertification_due"
+	CollaboratorInvited        = "collaborator.invited"
+	ContentPublished           = "content.published"
+	AccessReviewAssigned       = "access_review.assigned"
+	SecurityAlertRaised        = "security_alert.raised"
+)
+
+// All subscribes a handler to every event type
+const All = "*"
+
+// Event is something that happened to an identity or resource. Subject is
+// the ID of what the type names: the user, policy, resource, content item
+// or access review. ActorID is the user who caused the event, if any.
+type Event struct {
+	ID             string                 `json:"id"`
+	Type           string                 `json:"type"`
+	OrganizationID string                 `json:"organization_id,omitempty"`
+	ActorID        string                 `json:"actor_id,omitempty"`
+	Subject        string                 `json:"subject"`
+	Data           map[string]interface{} `json:"data,omitempty"`
+	OccurredAt     time.Time              `json:"occurred_at"`
+}
+
+// Handler reacts to an event. Handlers run one at a time on the bus worker
+// and must not block for long.
+type Handler func(ctx context.Context, e Event)
+
+// Bus delivers published events to the handlers subscribed to their type
+type Bus interface {
+	// Publish queues the event; it never blocks the caller
+	Publish(ctx context.Context, e Event)
+	// Subscribe registers h for events of the type, or of every type with
+	// All. Subscribe before Start.
+	Subscribe(eventType string, h Handler)
+	Start(ctx context.Context)
+	// Stop delivers the queued events, waits for the worker to exit and
+	// closes the sink
+	Stop()
+}
+
+// Sink forwards events out of the process. A sink that is also an
+// io.Closer is closed when the bus stops.
+type Sink interface {
+	Send(ctx context.Context, e Event) error
+}
+
+// New returns the in-process bus with the sink selected by cfg.EventSink
+func New(cfg *config.Config, rdb redis.UniversalClient, l *logger.Logger) (Bus, error) {
+	switch cfg.EventSink {
+	case "none", "":
+		return NewMemoryBus(nil, l), nil
+	case "redis":
+		return NewMemoryBus(NewRedisStreamSink(rdb, cfg.EventStream, cfg.EventStreamMaxLen), l), nil
+	case "nats":
+		sink, err := NewNATSSink(cfg.EventNATSURL, cfg.EventNATSSubject)
+		if err != nil {
+			return nil, fmt.Errorf("connect to NATS: %w", err)
+		}
+		return NewMemoryBus(sink, l), nil
+	case "kafka":
+		return NewMemoryBus(NewKafkaSink(cfg.EventKafkaBrokers, cfg.EventKafkaTopic), l), nil
+	default:
+		return nil, fmt.Errorf("unknown event sink %q", cfg.EventSink)
+	}
+}
+
+// queueSize bounds the events waiting for the worker; past it events are
+// dropped rather than slowing requests down
+const queueSize = 1000
+
+type memoryBus struct {
+	sink   Sink
+	logger *logger.Logger
+
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+
+	queue chan Event
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewMemoryBus returns a bus dispatching events on a worker goroutine and
+// then forwarding them to sink, if not nil
+func NewMemoryBus(sink Sink, l *logger.Logger) Bus {
+	return &memoryBus{
+		sink:     sink,
+		logger:   l,
+		handlers: make(map[string][]Handler),
+		queue:    make(chan Event, queueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (b *memoryBus) Publish(ctx context.Context, e Event) {
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now().UTC()
+	}
+	select {
+	case b.queue <- e:
+	default:
+		b.logger.Warn("Event queue full, dropping %s event %s", e.Type, e.ID)
+	}
+}
+
+func (b *memoryBus) Subscribe(eventType string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], h)
+}
+
+func (b *memoryBus) Start(ctx context.Context) {
+	go func() {
+		defer close(b.done)
+		for {
+			select {
+			case e := <-b.queue:
+				b.dispatch(ctx, e)
+			case <-ctx.Done():
+				b.drain(context.Background())
+				return
+			case <-b.stop:
+				b.drain(ctx)
+				return
+			}
+		}
+	}()
+}
+
+func (b *memoryBus) Stop() {
+	select {
+	case <-b.stop:
+		<-b.done
+		return
+	default:
+		close(b.stop)
+	}
+	<-b.done
+	if closer, ok := b.sink.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			b.logger.Warn("Failed to close event sink: %v", err)
+		}
+	}
+}
+
+func (b *memoryBus) drain(ctx context.Context) {
+	for {
+		select {
+		case e := <-b.queue:
+			b.dispatch(ctx, e)
+		default:
+			return
+		}
+	}
+}
+
+func (b *memoryBus) dispatch(ctx context.Context, e Event) {
+	b.mu.RLock()
+	handlers := append(append([]Handler(nil), b.handlers[e.Type]...), b.handlers[All]...)
+	b.mu.RUnlock()
+
+	for _, h := range handlers {
+		b.run(ctx, h, e)
+	}
+	if b.sink != nil {
+		sendCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		if err := b.sink.Send(sendCtx, e); err != nil {
+			b.logger.Warn("Failed to forward %s event %s: %v", e.Type, e.ID, err)
+		}
+		cancel()
+	}
+}
+
+// run calls h, so that a failing handler neither stops the worker nor the
+// other handlers
+func (b *memoryBus) run(ctx context.Context, h Handler, e Event) {
+	defer func() {
+		if p := recover(); p != nil {
+			b.logger.Error("Handler of %s event %s panicked: %v", e.Type, e.ID, p)
+		}
+	}()
+	h(ctx, e)
+}
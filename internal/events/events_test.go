@@ -0,0 +1,105 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+type recordingSink struct {
+	mu     sync.Mutex
+	events []Event
+	err    error
+	closed int
+}
+
+func (s *recordingSink) Close() error {
+	s.closed++
+	return nil
+}
+
+func (s *recordingSink) Send(ctx context.Context, e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+	return s.err
+}
+
+func TestBusDispatchesByType(t *testing.T) {
+	sink := &recordingSink{}
+	bus := NewMemoryBus(sink, logger.New("error"))
+
+	var mu sync.Mutex
+	var users, all []string
+	bus.Subscribe(UserCreated, func(ctx context.Context, e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		users = append(users, e.Subject)
+	})
+	bus.Subscribe(All, func(ctx context.Context, e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		all = append(all, e.Type)
+	})
+	bus.Start(context.Background())
+
+	bus.Publish(context.Background(), Event{Type: UserCreated, Subject: "u1"})
+	bus.Publish(context.Background(), Event{Type: PolicyUpdated, Subject: "p1"})
+	bus.Stop()
+
+	if len(users) != 1 || users[0] != "u1" {
+		t.Errorf("user.created handler got %v, want [u1]", users)
+	}
+	if len(all) != 2 || all[0] != UserCreated || all[1] != PolicyUpdated {
+		t.Errorf("wildcard handler got %v, want both events in order", all)
+	}
+	if len(sink.events) != 2 {
+		t.Fatalf("sink got %d events, want 2", len(sink.events))
+	}
+	for _, e := range sink.events {
+		if e.ID == "" || e.OccurredAt.IsZero() {
+			t.Errorf("event %s was not given an ID and time: %+v", e.Type, e)
+		}
+	}
+}
+
+func TestBusSurvivesFailingHandlers(t *testing.T) {
+	sink := &recordingSink{err: errors.New("broker down")}
+	bus := NewMemoryBus(sink, logger.New("error"))
+
+	delivered := 0
+	bus.Subscribe(LoginSucceeded, func(ctx context.Context, e Event) { panic("boom") })
+	bus.Subscribe(LoginSucceeded, func(ctx context.Context, e Event) { delivered++ })
+	bus.Start(context.Background())
+
+	bus.Publish(context.Background(), Event{Type: LoginSucceeded})
+	bus.Publish(context.Background(), Event{Type: LoginSucceeded})
+	bus.Stop()
+
+	if delivered != 2 {
+		t.Errorf("second handler ran %d times, want 2 despite the panicking one", delivered)
+	}
+	if len(sink.events) != 2 {
+		t.Errorf("sink got %d events, want 2 despite failing", len(sink.events))
+	}
+}
+
+func TestBusStopClosesSink(t *testing.T) {
+	sink := &recordingSink{}
+	bus := NewMemoryBus(sink, logger.New("error"))
+	bus.Start(context.Background())
+
+	bus.Publish(context.Background(), Event{Type: UserCreated})
+	bus.Stop()
+	bus.Stop()
+
+	if len(sink.events) != 1 {
+		t.Errorf("sink got %d events before closing, want 1", len(sink.events))
+	}
+	if sink.closed != 1 {
+		t.Errorf("sink closed %d times, want 1", sink.closed)
+	}
+}
@@ -0,0 +1,48 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaSink writes events to a Kafka topic. Messages are keyed by the event
+// subject, so the events of one user or policy land on one partition and
+// are read in order.
+type KafkaSink struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaSink returns a sink writing to topic through the brokers. The
+// brokers are only contacted on the first event.
+func NewKafkaSink(brokers []string, topic string) *KafkaSink {
+	return &KafkaSink{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		// Events are sent one at a time by the bus worker; waiting for a
+		// batch to fill would only delay them
+		BatchTimeout: 10 * time.Millisecond,
+	}}
+}
+
+// Send writes the JSON encoded Event, with the type also in the type header
+func (s *KafkaSink) Send(ctx context.Context, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.writer.WriteMessages(ctx, kafka.Message{
+		Key:     []byte(e.Subject),
+		Value:   payload,
+		Headers: []kafka.Header{{Key: "type", Value: []byte(e.Type)}},
+	})
+}
+
+// Close flushes pending writes and closes the broker connections
+func (s *KafkaSink) Close() error {
+	return s.writer.Close()
+}
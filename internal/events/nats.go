@@ -0,0 +1,52 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATSSink publishes events on the subject <prefix>.<type>, so that other
+// services subscribe to the types they need (identity.events.user.*) or to
+// all of them (identity.events.>). Core NATS only reaches subscribers that
+// are connected; a JetStream stream on the subjects keeps events for
+// consumers that are not.
+type NATSSink struct {
+	conn   *nats.Conn
+	prefix string
+}
+
+// NewNATSSink connects to the servers in url, a comma separated list. The
+// connection is retried in the background, so the API starts while NATS is
+// down; events sent meanwhile are buffered by the client.
+func NewNATSSink(url, prefix string) (*NATSSink, error) {
+	conn, err := nats.Connect(url,
+		nats.Name("monkeys-identity"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &NATSSink{conn: conn, prefix: prefix}, nil
+}
+
+// Send publishes the JSON encoded Event, with the type also in the
+// Event-Type header
+func (s *NATSSink) Send(ctx context.Context, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(s.prefix + "." + e.Type)
+	msg.Header.Set("Event-Type", e.Type)
+	msg.Header.Set(nats.MsgIdHdr, e.ID)
+	msg.Data = payload
+	return s.conn.PublishMsg(msg)
+}
+
+// Close flushes the events still buffered and closes the connection
+func (s *NATSSink) Close() error {
+	return s.conn.Drain()
+}
@@ -0,0 +1,36 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStreamSink appends events to a Redis stream. Other services read it
+// with XREADGROUP, each consumer group getting every event once; the
+// stream is trimmed to about maxLen entries.
+type RedisStreamSink struct {
+	redis  redis.UniversalClient
+	stream string
+	maxLen int64
+}
+
+func NewRedisStreamSink(rdb redis.UniversalClient, stream string, maxLen int64) *RedisStreamSink {
+	return &RedisStreamSink{redis: rdb, stream: stream, maxLen: maxLen}
+}
+
+// Send adds the event as the fields type (for filtering without decoding)
+// and event (the JSON encoded Event)
+func (s *RedisStreamSink) Send(ctx context.Context, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.stream,
+		MaxLen: s.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{"type": e.Type, "event": payload},
+	}).Err()
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+)
+
+// maxAccessLogRetentionDays bounds the resource_access_log_retention_days
+// organization setting
+const maxAccessLogRetentionDays = 3650
+
+// accessLogQuery parses the filters and page of an access log request for
+// one resource or content item
+func accessLogQuery(c *fiber.Ctx, resourceType, resourceID string) (queries.ResourceAccessLogFilter, queries.ListParams, error) {
+	filter := queries.ResourceAccessLogFilter{
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		UserID:       c.Query("user_id"),
+		Action:       c.Query("action"),
+	}
+	params := queries.ListParams{Limit: 50, SortBy: "timestamp", Order: "DESC", Cursor: c.Query("cursor")}
+
+	if v := c.Query("success"); v != "" {
+		success, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, params, fmt.Errorf("success must be true or false")
+		}
+		filter.Success = &success
+	}
+	var err error
+	if filter.StartTime, err = parseTimeQuery(c, "start_time"); err != nil {
+		return filter, params, err
+	}
+	if filter.EndTime, err = parseTimeQuery(c, "end_time"); err != nil {
+		return filter, params, err
+	}
+	if l := c.QueryInt("limit", 50); l > 0 && l <= 100 {
+		params.Limit = l
+	}
+	if o := c.QueryInt("offset", 0); o >= 0 {
+		params.Offset = o
+	}
+	return filter, params, nil
+}
+
+// GetContentAccessLog returns who read and changed a content item.
+//
+//	@Summary	Get content access log
+//	@Description	Retrieve the reads and writes of a content item, and the attempts at them that were refused, newest first. Owner only. Entries are kept for the organization's resource_access_log_retention_days setting, else the server default.
+//	@Tags		Content
+//	@Produce	json
+//	@Param		id			path	string	true	"Content ID"
+//	@Param		user_id		query	string	false	"Only entries of this user"
+//	@Param		action		query	string	false	"Only entries of this action, e.g. read or update"
+//	@Param		success		query	bool	false	"Only successful (true) or refused (false) accesses"
+//	@Param		start_time	query	string	false	"Start time (RFC3339)"
+//	@Param		end_time	query	string	false	"End time (RFC3339)"
+//	@Param		limit		query	int		false	"Limit (default 50, max 100)"
+//	@Param		cursor		query	string	false	"Opaque cursor from next_cursor of the previous page; overrides offset"
+//	@Param		offset		query	int		false	"Offset"
+//	@Success	200	{object}	object	"Access log"
+//	@Failure	400	{object}	object	"Invalid filters"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	404	{object}	object	"Not found"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/access-log [get]
+func (h *ContentHandler) GetContentAccessLog(c *fiber.Ctx) error {
+	contentID := c.Params("id")
+	orgID := c.Locals("organization_id").(string)
+
+	role, err := h.contentRole(c, contentID)
+	if err != nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
+	}
+	if err := requireOwner(role); err != nil {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only the content owner can view its access log")
+	}
+
+	filter, params, err := accessLogQuery(c, queries.AccessLogContent, contentID)
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+	}
+	accessLog, err := h.queries.Resource.WithContext(c.Context()).GetResourceAccessLog(orgID, filter, params)
+	if err != nil {
+		if isInvalidCursorErr(err) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid pagination cursor")
+		}
+		h.logger.Error("get content access log: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve access log")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Access log retrieved successfully", accessLog)
+}
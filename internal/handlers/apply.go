@@ -0,0 +1,455 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+// maxBundleEntries bounds the resources a configuration bundle may declare
+const maxBundleEntries = 500
+
+// settingsKind is the kind of the organization settings entry of a plan
+const settingsKind = "settings"
+
+// errDryRun rolls back the transaction of a dry run once its plan is made
+var errDryRun = errors.New("dry run")
+
+// ConfigBundle is the declarative configuration of an organization, as
+// kept in version control. Resources are matched to existing ones by
+// external ID, as PUT .../external/{external_id} does; resources the bundle
+// leaves out are left alone.
+type ConfigBundle struct {
+	Policies     []BundleEntry `json:"policies"`
+	Roles        []BundleEntry `json:"roles"`
+	Groups       []BundleEntry `json:"groups"`
+	OAuthClients []BundleEntry `json:"oauth_clients"`
+	// Settings are merged into the organization settings as a JSON merge
+	// patch (RFC 7396): keys left out are kept, null removes a key
+	Settings json.RawMessage `json:"settings,omitempty"`
+	// DryRun only plans the changes, as ?dry_run=true does
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// BundleEntry declares one resource of a bundle
+type BundleEntry struct {
+	ExternalID string `json:"external_id"`
+	// Adopt is the ID of an existing resource without an external ID to
+	// import, when none has the external ID yet
+	Adopt string `json:"adopt,omitempty"`
+	// Spec is the managed form of the resource, as exports return it
+	Spec json.RawMessage `json:"spec"`
+}
+
+// PlannedChange is what applying a bundle does, or would do, to a resource
+type PlannedChange struct {
+	Kind       string `json:"kind"`
+	ExternalID string `json:"external_id,omitempty"`
+	// ID is left out for resources a dry run would create
+	ID string `json:"id,omitempty"`
+	// Action is created, imported, updated or unchanged
+	Action string `json:"action"`
+	// ChangedFields are the top-level fields of the spec that change
+	ChangedFields []string `json:"changed_fields"`
+	BeforeHash    string   `json:"before_hash,omitempty"`
+	AfterHash     string   `json:"after_hash"`
+	// Credentials only shown once, such as the secret of a new OAuth client
+	Credentials interface{} `json:"credentials,omitempty"`
+}
+
+// ApplyPlan is the outcome of applying a bundle
+type ApplyPlan struct {
+	// ChangeSetID identifies the config_apply audit event of an apply that
+	// changed anything
+	ChangeSetID string          `json:"change_set_id,omitempty"`
+	DryRun      bool            `json:"dry_run"`
+	Changes     []PlannedChange `json:"changes"`
+	// Summary counts the changes by action
+	Summary map[string]int `json:"summary"`
+}
+
+// ApplyHandler applies configuration bundles, reusing the managed kinds of
+// the handlers owning each kind of resource
+type ApplyHandler struct {
+	queries  *queries.Queries
+	logger   *logger.Logger
+	audit    services.AuditService
+	roles    *RoleHandler
+	policies *PolicyHandler
+	groups   *GroupHandler
+	clients  *OIDCHandler
+}
+
+func NewApplyHandler(q *queries.Queries, logger *logger.Logger, audit services.AuditService, roles *RoleHandler, policies *PolicyHandler, groups *GroupHandler, clients *OIDCHandler) *ApplyHandler {
+	return &ApplyHandler{queries: q, logger: logger, audit: audit, roles: roles, policies: policies, groups: groups, clients: clients}
+}
+
+// bundleItem is a validated entry of a bundle; where locates it in the
+// bundle for error messages, e.g. roles[2]
+type bundleItem struct {
+	where      string
+	mk         managedKind
+	externalID string
+	adopt      string
+}
+
+// bundleItemError is a failure to apply an entry of a bundle
+type bundleItemError struct {
+	item *bundleItem
+	err  error
+}
+
+func (e *bundleItemError) Error() string { return e.item.where + ": " + e.err.Error() }
+func (e *bundleItemError) Unwrap() error { return e.err }
+
+// Apply applies a configuration bundle to the caller's organization
+//
+//	@Summary		Apply configuration bundle
+//	@Description	Declarative configuration (GitOps): takes a YAML (Content-Type application/yaml) or JSON bundle of policies, roles, groups and OAuth clients, each an external_id and a spec as the export endpoints return it, and organization settings, merged in as a JSON merge patch. Every entry is upserted by external ID in one transaction, so either all of them are applied or none; resources the bundle leaves out are left alone. Responds with the plan: what changed in each resource, by top-level spec field and content hash. With ?dry_run=true (or dry_run in the bundle) the plan is made and the transaction rolled back. An apply that changes anything writes a config_apply audit event whose change_set_id is returned. Secrets of created OAuth clients are only returned here.
+//	@Tags			Admin
+//	@Accept			json
+//	@Accept			application/yaml
+//	@Produce		json
+//	@Param			dry_run	query		bool			false	"Only plan the changes"
+//	@Param			request	body		ConfigBundle	true	"Configuration bundle"
+//	@Success		200		{object}	ApplyPlan		"Bundle applied, or planned in a dry run"
+//	@Failure		400		{object}	ErrorResponse	"Invalid bundle or spec"
+//	@Failure		403		{object}	ErrorResponse	"Caller is not an administrator"
+//	@Failure		404		{object}	ErrorResponse	"Resource to adopt not found"
+//	@Failure		409		{object}	ErrorResponse	"Name or external ID taken"
+//	@Failure		500		{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/admin/apply [post]
+func (h *ApplyHandler) Apply(c *fiber.Ctx) error {
+	orgID := c.Locals("organization_id").(string)
+	userID, _ := c.Locals("user_id").(string)
+
+	bundle, err := parseBundle(c)
+	if bundle == nil {
+		return err
+	}
+	items, err := h.bundleItems(c, orgID, bundle)
+	if err != nil {
+		return respondSpecError(c, err)
+	}
+	dryRun := bundle.DryRun || c.QueryBool("dry_run")
+
+	ctx := c.UserContext()
+	// written are the items that changed, with their changes, for running
+	// the hooks of their kinds once committed
+	type writtenItem struct {
+		item   *bundleItem
+		change *managedChange
+	}
+	var changes []PlannedChange
+	var written []writtenItem
+	err = h.queries.Transact(ctx, func(q *queries.Queries) error {
+		changes, written = nil, nil
+		for _, item := range items {
+			change, err := applyManaged(ctx, q, item.mk, orgID, item.externalID, item.adopt)
+			if err != nil {
+				return &bundleItemError{item: item, err: err}
+			}
+			planned, err := plannedChange(item.mk.kind, item.externalID, change)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, planned)
+			if change.Result != managedUnchanged {
+				written = append(written, writtenItem{item, change})
+			}
+		}
+		if len(bundle.Settings) > 0 {
+			planned, err := applySettings(q, orgID, bundle.Settings)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, planned)
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+
+	var itemErr *bundleItemError
+	switch {
+	case errors.Is(err, errDryRun):
+		err = nil
+	case errors.As(err, &itemErr):
+		if failed := managedFailure(itemErr.item.mk, itemErr.err); failed != nil {
+			return apiError(c, failed.status, failed.code, itemErr.item.where+": "+failed.message)
+		}
+	}
+	if err != nil {
+		var failed *managedError
+		if errors.As(err, &failed) {
+			return apiError(c, failed.status, failed.code, failed.message)
+		}
+		h.logger.Error("Failed to apply configuration bundle to organization %s: %v", orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to apply configuration bundle")
+	}
+
+	plan := ApplyPlan{DryRun: dryRun, Changes: changes, Summary: map[string]int{}}
+	if plan.Changes == nil {
+		plan.Changes = []PlannedChange{}
+	}
+	for i := range plan.Changes {
+		if dryRun {
+			// Nothing was kept: neither the IDs nor the secrets of what a
+			// dry run created exist
+			plan.Changes[i].Credentials = nil
+			if plan.Changes[i].Action == managedCreated {
+				plan.Changes[i].ID = ""
+			}
+		}
+		plan.Summary[plan.Changes[i].Action]++
+	}
+	if dryRun {
+		return apiSuccess(c, fiber.StatusOK, "Configuration bundle planned", plan)
+	}
+
+	for _, w := range written {
+		if w.item.mk.written != nil {
+			w.item.mk.written(w.change.ID, w.change.Result)
+		}
+	}
+	if plan.Summary[managedUnchanged] < len(plan.Changes) {
+		plan.ChangeSetID = uuid.NewString()
+		h.auditChangeSet(c, orgID, userID, &plan)
+	}
+	h.logger.Info("Applied configuration bundle to organization %s: %v", orgID, plan.Summary)
+	return apiSuccess(c, fiber.StatusOK, "Configuration bundle applied", plan)
+}
+
+// parseBundle decodes the bundle of the request, YAML when its content type
+// says so and JSON otherwise, responding and returning nil when it is
+// invalid
+func parseBundle(c *fiber.Ctx) (*ConfigBundle, error) {
+	body := c.Body()
+	if strings.Contains(c.Get(fiber.HeaderContentType), "yaml") {
+		converted, err := utils.YAMLToJSON(body)
+		if err != nil {
+			return nil, apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+		}
+		body = converted
+	}
+	// Misspelled sections would otherwise be skipped without a word
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	var bundle ConfigBundle
+	if err := dec.Decode(&bundle); err != nil {
+		return nil, apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid configuration bundle: "+err.Error())
+	}
+	return &bundle, nil
+}
+
+// bundleItems validates the entries of a bundle and returns them in the
+// order they are applied: policies, roles, groups, then OAuth clients
+func (h *ApplyHandler) bundleItems(c *fiber.Ctx, orgID string, bundle *ConfigBundle) ([]*bundleItem, error) {
+	sections := []struct {
+		name    string
+		entries []BundleEntry
+		kind    func(raw json.RawMessage) (managedKind, error)
+	}{
+		{"policies", bundle.Policies, func(raw json.RawMessage) (managedKind, error) {
+			var spec PolicySpec
+			if err := decodeBundleSpec(raw, &spec); err != nil {
+				return managedKind{}, err
+			}
+			return h.policies.policyKind(c, &spec), spec.normalize()
+		}},
+		{"roles", bundle.Roles, func(raw json.RawMessage) (managedKind, error) {
+			var spec RoleSpec
+			if err := decodeBundleSpec(raw, &spec); err != nil {
+				return managedKind{}, err
+			}
+			return h.roles.roleKind(&spec), spec.normalize()
+		}},
+		{"groups", bundle.Groups, func(raw json.RawMessage) (managedKind, error) {
+			var spec GroupSpec
+			if err := decodeBundleSpec(raw, &spec); err != nil {
+				return managedKind{}, err
+			}
+			return h.groups.groupKind(&spec), spec.normalize()
+		}},
+		{"oauth_clients", bundle.OAuthClients, func(raw json.RawMessage) (managedKind, error) {
+			var spec RegisterClientRequest
+			if err := decodeBundleSpec(raw, &spec); err != nil {
+				return managedKind{}, err
+			}
+			return h.clients.clientKind(c, &spec), h.clients.normalizeClientSpec(orgID, &spec)
+		}},
+	}
+
+	total := 0
+	for _, section := range sections {
+		total += len(section.entries)
+	}
+	if total > maxBundleEntries {
+		return nil, managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed,
+			fmt.Sprintf("A bundle may declare at most %d resources", maxBundleEntries))
+	}
+	if string(bytes.TrimSpace(bundle.Settings)) == "null" {
+		bundle.Settings = nil
+	}
+	if len(bundle.Settings) > 0 && !isJSONObject(bundle.Settings) {
+		return nil, managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed, "settings must be an object")
+	}
+
+	items := make([]*bundleItem, 0, total)
+	for _, section := range sections {
+		seen := map[string]bool{}
+		for i, entry := range section.entries {
+			where := fmt.Sprintf("%s[%d]", section.name, i)
+			fail := func(err error) error {
+				var failed *managedError
+				if errors.As(err, &failed) {
+					return managedFail(failed.status, failed.code, where+": "+failed.message)
+				}
+				return managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed, where+": "+err.Error())
+			}
+			if !externalIDPattern.MatchString(entry.ExternalID) {
+				return nil, fail(errors.New("external_id must start with a letter or digit and contain only letters, digits and . _ : @ - (at most 200 characters)"))
+			}
+			if seen[entry.ExternalID] {
+				return nil, fail(errors.New("external_id " + entry.ExternalID + " is declared more than once"))
+			}
+			seen[entry.ExternalID] = true
+			if entry.Adopt != "" && !validID(entry.Adopt) {
+				return nil, fail(errors.New("adopt must be the ID of an existing resource"))
+			}
+			mk, err := section.kind(entry.Spec)
+			if err != nil {
+				return nil, fail(err)
+			}
+			items = append(items, &bundleItem{where: where, mk: mk, externalID: entry.ExternalID, adopt: entry.Adopt})
+		}
+	}
+	return items, nil
+}
+
+// decodeBundleSpec decodes the spec of a bundle entry
+func decodeBundleSpec(raw json.RawMessage, spec interface{}) error {
+	if !isJSONObject(raw) {
+		return errors.New("spec must be an object")
+	}
+	if err := json.Unmarshal(raw, spec); err != nil {
+		return fmt.Errorf("invalid spec: %v", err)
+	}
+	return nil
+}
+
+func isJSONObject(raw json.RawMessage) bool {
+	var obj map[string]json.RawMessage
+	return json.Unmarshal(raw, &obj) == nil && obj != nil
+}
+
+// plannedChange describes a change applyManaged made
+func plannedChange(kind, externalID string, change *managedChange) (PlannedChange, error) {
+	planned := PlannedChange{
+		Kind:        kind,
+		ExternalID:  externalID,
+		ID:          change.ID,
+		Action:      change.Result,
+		AfterHash:   change.After.ContentHash,
+		Credentials: change.Credentials,
+	}
+	var before interface{}
+	if change.Before != nil {
+		before = change.Before.Spec
+		planned.BeforeHash = change.Before.ContentHash
+	}
+	fields, err := utils.ChangedFields(before, change.After.Spec)
+	if err != nil {
+		return planned, err
+	}
+	planned.ChangedFields = fields
+	return planned, nil
+}
+
+// applySettings merges the settings of a bundle into those of the
+// organization in the transaction of q
+func applySettings(q *queries.Queries, orgID string, patch json.RawMessage) (PlannedChange, error) {
+	planned := PlannedChange{Kind: settingsKind, ID: orgID, Action: managedUnchanged}
+	current, err := q.Organization.GetOrganizationSettings(orgID)
+	if err != nil {
+		return planned, err
+	}
+	if current == "" {
+		current = "{}"
+	}
+	merged, err := utils.MergePatch([]byte(current), patch)
+	if err != nil {
+		return planned, err
+	}
+	if msg := validateOrganizationSettings(string(merged)); msg != "" {
+		return planned, managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed, "settings: "+msg)
+	}
+
+	if planned.BeforeHash, err = utils.ContentHash(json.RawMessage(current)); err != nil {
+		return planned, err
+	}
+	if planned.AfterHash, err = utils.ContentHash(json.RawMessage(merged)); err != nil {
+		return planned, err
+	}
+	if planned.ChangedFields, err = utils.ChangedFields(json.RawMessage(current), json.RawMessage(merged)); err != nil {
+		return planned, err
+	}
+	if planned.AfterHash == planned.BeforeHash {
+		return planned, nil
+	}
+	planned.Action = managedUpdated
+	return planned, q.Organization.UpdateOrganizationSettings(orgID, string(merged))
+}
+
+// auditChangeSet records an applied bundle as a config_apply audit event
+func (h *ApplyHandler) auditChangeSet(c *fiber.Ctx, orgID, userID string, plan *ApplyPlan) {
+	type changeRecord struct {
+		Kind          string   `json:"kind"`
+		ExternalID    string   `json:"external_id,omitempty"`
+		ID            string   `json:"id"`
+		Action        string   `json:"action"`
+		ChangedFields []string `json:"changed_fields"`
+		AfterHash     string   `json:"after_hash"`
+	}
+	records := []changeRecord{}
+	for _, change := range plan.Changes {
+		if change.Action == managedUnchanged {
+			continue
+		}
+		records = append(records, changeRecord{change.Kind, change.ExternalID, change.ID, change.Action, change.ChangedFields, change.AfterHash})
+	}
+	details, _ := json.Marshal(map[string]interface{}{
+		"change_set_id": plan.ChangeSetID,
+		"summary":       plan.Summary,
+		"changes":       records,
+	})
+	// CI pipelines apply bundles as service accounts
+	principalType, _ := c.Locals("principal_type").(string)
+	if principalType == "" {
+		principalType = "user"
+	}
+	h.audit.LogEvent(c.Context(), models.AuditEvent{
+		OrganizationID:    orgID,
+		PrincipalID:       utils.StringPtr(userID),
+		PrincipalType:     utils.StringPtr(principalType),
+		Action:            "config_apply",
+		ResourceType:      utils.StringPtr("organization"),
+		ResourceID:        utils.StringPtr(orgID),
+		Result:            "success",
+		AdditionalContext: string(details),
+		Severity:          "critical",
+	})
+}
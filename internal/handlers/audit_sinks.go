@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/auditexport"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+// AuditSinkRequest is the request body for creating an audit sink. The
+// config of each type is documented on auditexport.SplunkConfig,
+// auditexport.SyslogConfig and auditexport.S3Config.
+type AuditSinkRequest struct {
+	Name    string          `json:"name"`
+	Type    string          `json:"type"` // splunk_hec, syslog, s3
+	Config  json.RawMessage `json:"config"`
+	Enabled *bool           `json:"enabled,omitempty"` // default true
+}
+
+// UpdateAuditSinkRequest changes an audit sink; omitted fields are kept, as
+// are secrets sent back masked
+type UpdateAuditSinkRequest struct {
+	Name    *string         `json:"name,omitempty"`
+	Config  json.RawMessage `json:"config,omitempty"`
+	Enabled *bool           `json:"enabled,omitempty"`
+}
+
+// redactSink hides the secrets of a sink's config
+func redactSink(sink *models.AuditSink) *models.AuditSink {
+	redacted := *sink
+	redacted.Config = auditexport.Redact(sink.Type, sink.Config)
+	return &redacted
+}
+
+func (h *AuditHandler) logSinkChange(c *fiber.Ctx, action string, sink *models.AuditSink) {
+	h.audit.LogEvent(c.Context(), models.AuditEvent{
+		OrganizationID: sink.OrganizationID,
+		PrincipalID:    utils.StringPtr(c.Locals("user_id").(string)),
+		PrincipalType:  utils.StringPtr("user"),
+		Action:         action,
+		ResourceType:   utils.StringPtr("audit_sink"),
+		ResourceID:     utils.StringPtr(sink.ID),
+		Result:         "success",
+		Severity:       "warn",
+	})
+}
+
+// ListAuditSinks returns the SIEM sinks of the organization
+//
+//	@Summary	List audit sinks
+//	@Description	List the SIEM destinations the organization's audit events are exported to. Secrets in the configs are masked.
+//	@Tags		Audit & Compliance
+//	@Produce	json
+//	@Param		id	path	string	true	"Organization ID"
+//	@Success	200	{array}		models.AuditSink	"Audit sinks retrieved"
+//	@Failure	403	{object}	ErrorResponse	"Organization admin required"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Security	BearerAuth
+//	@Router		/organizations/{id}/audit-sinks [get]
+func (h *AuditHandler) ListAuditSinks(c *fiber.Ctx) error {
+	sinks, err := h.queries.Audit.WithContext(c.Context()).ListAuditSinks(c.Params("id"))
+	if err != nil {
+		h.logger.Error("Failed to list audit sinks: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve audit sinks")
+	}
+	for i := range sinks {
+		sinks[i] = *redactSink(&sinks[i])
+	}
+	return apiSuccess(c, fiber.StatusOK, "Audit sinks retrieved", sinks)
+}
+
+// CreateAuditSink adds a SIEM sink to the organization
+//
+//	@Summary	Create audit sink
+//	@Description	Export the organization's audit events to a Splunk HTTP Event Collector (splunk_hec), a syslog server over TLS (syslog) or NDJSON objects in an S3 bucket (s3). Every replica picks the sink up within 30 seconds; events are sent in batches, retried, and dropped if the destination falls too far behind.
+//	@Tags		Audit & Compliance
+//	@Accept		json
+//	@Produce	json
+//	@Param		id		path	string	true	"Organization ID"
+//	@Param		request	body	AuditSinkRequest	true	"Audit sink"
+//	@Success	201	{object}	models.AuditSink	"Audit sink created"
+//	@Failure	400	{object}	ErrorResponse	"Invalid sink"
+//	@Failure	403	{object}	ErrorResponse	"Organization admin required"
+//	@Failure	409	{object}	ErrorResponse	"A sink with this name exists"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Security	BearerAuth
+//	@Router		/organizations/{id}/audit-sinks [post]
+func (h *AuditHandler) CreateAuditSink(c *fiber.Ctx) error {
+	var req AuditSinkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "name is required")
+	}
+	if err := auditexport.Validate(req.Type, req.Config); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Invalid sink: "+err.Error())
+	}
+
+	sink := &models.AuditSink{
+		OrganizationID: c.Params("id"),
+		Name:           req.Name,
+		Type:           req.Type,
+		Config:         req.Config,
+		Enabled:        req.Enabled == nil || *req.Enabled,
+		CreatedBy:      utils.StringPtr(c.Locals("user_id").(string)),
+	}
+	if err := h.queries.Audit.WithContext(c.Context()).CreateAuditSink(sink); err != nil {
+		if isConflictErr(err) {
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "An audit sink with this name already exists")
+		}
+		h.logger.Error("Failed to create audit sink: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create audit sink")
+	}
+
+	h.logSinkChange(c, "create_audit_sink", sink)
+	return apiSuccess(c, fiber.StatusCreated, "Audit sink created", redactSink(sink))
+}
+
+// GetAuditSink returns a SIEM sink of the organization
+//
+//	@Summary	Get audit sink
+//	@Tags		Audit & Compliance
+//	@Produce	json
+//	@Param		id		path	string	true	"Organization ID"
+//	@Param		sink_id	path	string	true	"Audit sink ID"
+//	@Success	200	{object}	models.AuditSink	"Audit sink retrieved"
+//	@Failure	404	{object}	ErrorResponse	"Audit sink not found"
+//	@Security	BearerAuth
+//	@Router		/organizations/{id}/audit-sinks/{sink_id} [get]
+func (h *AuditHandler) GetAuditSink(c *fiber.Ctx) error {
+	sink, err := h.queries.Audit.WithContext(c.Context()).GetAuditSink(c.Params("sink_id"), c.Params("id"))
+	if err != nil {
+		return h.sinkError(c, err, "Failed to retrieve audit sink")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Audit sink retrieved", redactSink(sink))
+}
+
+// UpdateAuditSink changes a SIEM sink of the organization
+//
+//	@Summary	Update audit sink
+//	@Description	Rename, reconfigure, enable or disable an audit sink. Secrets left empty or masked in the config are kept.
+//	@Tags		Audit & Compliance
+//	@Accept		json
+//	@Produce	json
+//	@Param		id		path	string	true	"Organization ID"
+//	@Param		sink_id	path	string	true	"Audit sink ID"
+//	@Param		request	body	UpdateAuditSinkRequest	true	"Changes"
+//	@Success	200	{object}	models.AuditSink	"Audit sink updated"
+//	@Failure	400	{object}	ErrorResponse	"Invalid sink"
+//	@Failure	404	{object}	ErrorResponse	"Audit sink not found"
+//	@Failure	409	{object}	ErrorResponse	"A sink with this name exists"
+//	@Security	BearerAuth
+//	@Router		/organizations/{id}/audit-sinks/{sink_id} [put]
+func (h *AuditHandler) UpdateAuditSink(c *fiber.Ctx) error {
+	var req UpdateAuditSinkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+	}
+
+	q := h.queries.Audit.WithContext(c.Context())
+	sink, err := q.GetAuditSink(c.Params("sink_id"), c.Params("id"))
+	if err != nil {
+		return h.sinkError(c, err, "Failed to update audit sink")
+	}
+	if req.Name != nil {
+		if sink.Name = strings.TrimSpace(*req.Name); sink.Name == "" {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "name must not be empty")
+		}
+	}
+	if len(req.Config) > 0 {
+		config, err := auditexport.KeepSecrets(sink.Type, sink.Config, req.Config)
+		if err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, err.Error())
+		}
+		if err := auditexport.Validate(sink.Type, config); err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Invalid sink: "+err.Error())
+		}
+		sink.Config = config
+	}
+	if req.Enabled != nil {
+		sink.Enabled = *req.Enabled
+	}
+
+	if err := q.UpdateAuditSink(sink); err != nil {
+		if isConflictErr(err) {
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "An audit sink with this name already exists")
+		}
+		return h.sinkError(c, err, "Failed to update audit sink")
+	}
+
+	h.logSinkChange(c, "update_audit_sink", sink)
+	return apiSuccess(c, fiber.StatusOK, "Audit sink updated", redactSink(sink))
+}
+
+// DeleteAuditSink removes a SIEM sink of the organization
+//
+//	@Summary	Delete audit sink
+//	@Tags		Audit & Compliance
+//	@Produce	json
+//	@Param		id		path	string	true	"Organization ID"
+//	@Param		sink_id	path	string	true	"Audit sink ID"
+//	@Success	200	{object}	SuccessResponse	"Audit sink deleted"
+//	@Failure	404	{object}	ErrorResponse	"Audit sink not found"
+//	@Security	BearerAuth
+//	@Router		/organizations/{id}/audit-sinks/{sink_id} [delete]
+func (h *AuditHandler) DeleteAuditSink(c *fiber.Ctx) error {
+	sink := &models.AuditSink{ID: c.Params("sink_id"), OrganizationID: c.Params("id")}
+	if err := h.queries.Audit.WithContext(c.Context()).DeleteAuditSink(sink.ID, sink.OrganizationID); err != nil {
+		return h.sinkError(c, err, "Failed to delete audit sink")
+	}
+	h.logSinkChange(c, "delete_audit_sink", sink)
+	return apiSuccess(c, fiber.StatusOK, "Audit sink deleted", fiber.Map{"id": sink.ID})
+}
+
+// TestAuditSink sends a test event to a SIEM sink
+//
+//	@Summary	Test audit sink
+//	@Description	Send a single audit_export_test event to the sink's destination, whether or not the sink is enabled, and report the outcome.
+//	@Tags		Audit & Compliance
+//	@Produce	json
+//	@Param		id		path	string	true	"Organization ID"
+//	@Param		sink_id	path	string	true	"Audit sink ID"
+//	@Success	200	{object}	SuccessResponse	"Test event delivered"
+//	@Failure	404	{object}	ErrorResponse	"Audit sink not found"
+//	@Failure	502	{object}	ErrorResponse	"The destination did not accept the event"
+//	@Security	BearerAuth
+//	@Router		/organizations/{id}/audit-sinks/{sink_id}/test [post]
+func (h *AuditHandler) TestAuditSink(c *fiber.Ctx) error {
+	sink, err := h.queries.Audit.WithContext(c.Context()).GetAuditSink(c.Params("sink_id"), c.Params("id"))
+	if err != nil {
+		return h.sinkError(c, err, "Failed to test audit sink")
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 20*time.Second)
+	defer cancel()
+	if err := auditexport.Test(ctx, *sink); err != nil {
+		return apiError(c, fiber.StatusBadGateway, apierror.CodeUpstreamError, "The destination did not accept the test event", err.Error())
+	}
+	return apiSuccess(c, fiber.StatusOK, "Test event delivered", fiber.Map{"id": sink.ID})
+}
+
+func (h *AuditHandler) sinkError(c *fiber.Ctx, err error, message string) error {
+	if strings.Contains(err.Error(), "not found") {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Audit sink not found")
+	}
+	h.logger.Error("%s: %v", message, err)
+	return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, message)
+}
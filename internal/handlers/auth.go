@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"context"
-	"crypto/rsa"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,31 +13,52 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
 	"github.com/the-monkeys/monkeys-identity/internal/config"
+	"github.com/the-monkeys/monkeys-identity/internal/events"
+	"github.com/the-monkeys/monkeys-identity/internal/kerberos"
+	"github.com/the-monkeys/monkeys-identity/internal/metrics"
 	"github.com/the-monkeys/monkeys-identity/internal/middleware"
 	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/password"
 	"github.com/the-monkeys/monkeys-identity/internal/queries"
 	"github.com/the-monkeys/monkeys-identity/internal/services"
+	"github.com/the-monkeys/monkeys-identity/internal/signing"
 	"github.com/the-monkeys/monkeys-identity/pkg/logger"
 	"github.com/the-monkeys/monkeys-identity/pkg/utils"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// accountDeletedMessage is returned when a soft-deleted user tries to authenticate
+const accountDeletedMessage = "This account has been deleted. Contact your administrator if you believe this is a mistake."
+
 type AuthHandler struct {
-	queries    *queries.Queries
-	redis      *redis.Client
-	logger     *logger.Logger
-	config     *config.Config
-	audit      services.AuditService
-	mfa        services.MFAService
-	email      services.EmailService
-	privateKey *rsa.PrivateKey
-	cors       *middleware.DynamicCORS // set via SetCORS after construction
+	queries  *queries.Queries
+	redis    redis.UniversalClient
+	logger   *logger.Logger
+	config   *config.Config
+	audit    services.AuditService
+	mfa      services.MFAService
+	email    services.EmailService
+	otp      services.OTPService
+	keys     *signing.KeyManager
+	cors     *middleware.DynamicCORS          // set via SetCORS after construction
+	settings services.SettingsService         // set via SetSettings after construction
+	emails   services.EmailValidationService  // set via SetEmailValidator after construction
+	events   events.Bus                       // set via SetEvents after construction
+	breaches services.BreachedPasswordService // set via SetBreachedPasswords after construction
+
+	impersonation services.ImpersonationService // set via SetImpersonation after construction
+	loginThrottle services.LoginThrottleService // set via SetLoginThrottle after construction
+	delegation    services.DelegationService    // set via SetDelegation after construction
+	kerberos      *kerberos.Acceptor            // set via SetKerberos after construction; nil disables SPNEGO
 }
 
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=6"`
+	// Org is the slug of a slug-scoped login page; it signs in to the
+	// account of the email in that organization
+	Org string `json:"org,omitempty"`
 }
 
 type RegisterRequest struct {
@@ -53,6 +76,10 @@ type LoginResponse struct {
 	TokenType    string      `json:"token_type"`
 	User         models.User `json:"user"`
 	Role         string      `json:"role"`
+	// MFAEnrollmentRequired is set while the global require_mfa setting is
+	// on and the user has not enabled MFA; other API calls are refused
+	// until they do
+	MFAEnrollmentRequired bool `json:"mfa_enrollment_required,omitempty"`
 }
 
 type CreateAdminRequest struct {
@@ -63,8 +90,8 @@ type CreateAdminRequest struct {
 	OrganizationID string `json:"organization_id,omitempty"`
 }
 
-func NewAuthHandler(queries *queries.Queries, redis *redis.Client, logger *logger.Logger, config *config.Config, audit services.AuditService, mfa services.MFAService, email services.EmailService) *AuthHandler {
-	h := &AuthHandler{
+func NewAuthHandler(queries *queries.Queries, redis redis.UniversalClient, logger *logger.Logger, config *config.Config, audit services.AuditService, mfa services.MFAService, email services.EmailService, otp services.OTPService, keys *signing.KeyManager) *AuthHandler {
+	return &AuthHandler{
 		queries: queries,
 		redis:   redis,
 		logger:  logger,
@@ -72,23 +99,9 @@ func NewAuthHandler(queries *queries.Queries, redis *redis.Client, logger *logge
 		audit:   audit,
 		mfa:     mfa,
 		email:   email,
+		otp:     otp,
+		keys:    keys,
 	}
-
-	// Load RS256 private key for asymmetric token signing
-	if config.JWTPrivateKey != "" {
-		if priv, err := utils.LoadRSAPrivateKey(config.JWTPrivateKey); err == nil {
-			h.privateKey = priv
-		} else {
-			logger.Error("Failed to load JWT private key: %v", err)
-		}
-	}
-
-	// Generate a temporary key if none provided (useful for development)
-	if h.privateKey == nil {
-		h.logger.Warn("AuthHandler: No valid OIDC private key available. Token signing will fail.")
-	}
-
-	return h
 }
 
 // SetCORS injects the DynamicCORS reference so org registration can
@@ -97,24 +110,116 @@ func (h *AuthHandler) SetCORS(cors *middleware.DynamicCORS) {
 	h.cors = cors
 }
 
+// SetSettings injects the global settings that gate registration and MFA.
+// Called from route setup.
+func (h *AuthHandler) SetSettings(settings services.SettingsService) {
+	h.settings = settings
+}
+
+// SetEmailValidator injects the address checks applied to registrations.
+// Called from route setup.
+func (h *AuthHandler) SetEmailValidator(emails services.EmailValidationService) {
+	h.emails = emails
+}
+
+// SetBreachedPasswords injects the breach screening applied to passwords
+// chosen at registration and reset. Called from route setup.
+func (h *AuthHandler) SetBreachedPasswords(breaches services.BreachedPasswordService) {
+	h.breaches = breaches
+}
+
+// SetLoginThrottle injects the progressive delays applied to failed logins
+// per email. Called from route setup.
+func (h *AuthHandler) SetLoginThrottle(throttle services.LoginThrottleService) {
+	h.loginThrottle = throttle
+}
+
+// loginThrottled refuses a login attempt made while the email is in a
+// progressive delay. It reports whether the attempt was refused.
+func (h *AuthHandler) loginThrottled(c *fiber.Ctx, email string) (bool, error) {
+	if h.loginThrottle == nil {
+		return false, nil
+	}
+	wait := h.loginThrottle.Wait(c.Context(), email)
+	if wait <= 0 {
+		return false, nil
+	}
+	seconds := int((wait + time.Second - 1) / time.Second)
+	h.audit.LogLogin(c.Context(), "", "", middleware.ClientIP(c), c.Get("User-Agent"), false, "throttled")
+	metrics.RecordLogin(false, "throttled")
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	return true, apiError(c, fiber.StatusTooManyRequests, apierror.CodeRateLimited,
+		fmt.Sprintf("Too many failed sign-in attempts. Try again in %d seconds.", seconds),
+		fiber.Map{"retry_after_seconds": seconds})
+}
+
+// loginFailed records a failed login of email with the throttle, telling
+// the client when it may try again if a delay is now imposed
+func (h *AuthHandler) loginFailed(c *fiber.Ctx, email string) {
+	if h.loginThrottle == nil {
+		return
+	}
+	if delay := h.loginThrottle.Failed(c.Context(), email); delay > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int((delay+time.Second-1)/time.Second)))
+	}
+}
+
+// SetEvents injects the bus sign-ups and logins are published on. Called
+// from route setup.
+func (h *AuthHandler) SetEvents(bus events.Bus) {
+	h.events = bus
+}
+
+// SetImpersonation injects the service recording impersonation sessions.
+// Called from route setup.
+func (h *AuthHandler) SetImpersonation(impersonation services.ImpersonationService) {
+	h.impersonation = impersonation
+}
+
+// publishUserCreated publishes a user.created event for a user who signed
+// up, source telling how
+func (h *AuthHandler) publishUserCreated(c *fiber.Ctx, user *models.User, source string) {
+	publish(h.events, c, events.Event{
+		Type:           events.UserCreated,
+		OrganizationID: user.OrganizationID,
+		ActorID:        user.ID,
+		Subject:        user.ID,
+		Data:           map[string]interface{}{"email": user.Email, "username": user.Username, "source": source},
+	})
+}
+
+// publishLogin publishes a login.succeeded event
+func (h *AuthHandler) publishLogin(c *fiber.Ctx, user *models.User, method string) {
+	publish(h.events, c, events.Event{
+		Type:           events.LoginSucceeded,
+		OrganizationID: user.OrganizationID,
+		ActorID:        user.ID,
+		Subject:        user.ID,
+		Data:           map[string]interface{}{"method": method, "ip": middleware.ClientIP(c), "user_agent": c.Get("User-Agent")},
+	})
+}
+
 // Login authenticates user and returns JWT tokens
 //
 //	@Summary		User login
-//	@Description	Authenticate user with email and password
+//	@Description	Authenticate user with email and password. With org, the slug of a slug-scoped login page, the account of the email in that organization signs in.
 //	@Tags			Authentication
 //	@Accept			json
 //	@Produce		json
-//	@Param			request	body		LoginRequest	true	"Login credentials"
+//	@Param			request			body		LoginRequest	true	"Login credentials"
+//	@Param			X-Session-Mode	header		string			false	"\"cookie\" to receive the tokens as HttpOnly cookies instead of in the body (requires SESSION_COOKIES)"
 //	@Success		200		{object}	LoginResponse	"Successfully authenticated"
 //	@Failure		400		{object}	ErrorResponse	"Invalid request format"
 //	@Failure		401		{object}	ErrorResponse	"Invalid credentials"
+//	@Failure		404		{object}	ErrorResponse	"Organization of org not found"
+//	@Failure		429		{object}	ErrorResponse	"Too many failed attempts for this email; retry after the Retry-After delay"
 //	@Failure		500		{object}	ErrorResponse	"Internal server error"
 //	@Router			/auth/login [post]
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	var req LoginRequest
 	if err := c.BodyParser(&req); err != nil {
 		h.logger.Warn("Invalid login request: %v", err)
-		return apiError(c, fiber.StatusBadRequest, "invalid_request", "Invalid request format")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
 	}
 
 	// Trim spaces and normalize email
@@ -122,58 +227,124 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 
 	// Validate input
 	if req.Email == "" || req.Password == "" {
-		return apiError(c, fiber.StatusBadRequest, "validation_error", "Email and password are required")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Email and password are required")
+	}
+	if throttled, err := h.loginThrottled(c, req.Email); throttled {
+		return err
 	}
 
-	// Get user from database
-	user, err := h.queries.Auth.GetUserByEmail(req.Email, "")
+	// Get user from database, within the organization of a slug-scoped login
+	orgID := ""
+	if req.Org != "" {
+		org, err := publicOrganization(h.queries.Organization, strings.TrimSpace(req.Org))
+		if err != nil {
+			if !isNotFoundErr(err) {
+				h.logger.Error("Failed to get organization %s: %v", req.Org, err)
+				return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "An internal error occurred. Please try again later.")
+			}
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization not found")
+		}
+		orgID = org.ID
+	}
+	user, err := h.queries.Auth.GetUserByEmail(req.Email, orgID)
 	if err != nil {
+		if deleted, _ := h.queries.Auth.IsEmailDeleted(req.Email); deleted {
+			h.logger.Warn("Login attempt for deleted user: %s", req.Email)
+			h.audit.LogLogin(c.Context(), "", "", middleware.ClientIP(c), c.Get("User-Agent"), false, "account_deleted")
+			metrics.RecordLogin(false, "account_deleted")
+			return apiError(c, fiber.StatusForbidden, apierror.CodeAccountDeleted, accountDeletedMessage)
+		}
 		h.logger.Warn("User not found: %s", req.Email)
-		h.audit.LogLogin(c.Context(), "", "", c.IP(), c.Get("User-Agent"), false, "user_not_found")
-		return apiError(c, fiber.StatusUnauthorized, "invalid_credentials", "Invalid email or password")
+		h.audit.LogLogin(c.Context(), "", "", middleware.ClientIP(c), c.Get("User-Agent"), false, "user_not_found")
+		metrics.RecordLogin(false, "user_not_found")
+		// Unknown emails are throttled alike, so delays do not reveal accounts
+		h.loginFailed(c, req.Email)
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid email or password")
 	}
 
 	// Check password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+	if err := password.Verify(user.PasswordHash, req.Password); err != nil {
 		h.logger.Warn("Invalid password for user: %s", req.Email)
-		h.audit.LogLogin(c.Context(), user.OrganizationID, user.ID, c.IP(), c.Get("User-Agent"), false, "invalid_password")
-		return apiError(c, fiber.StatusUnauthorized, "invalid_credentials", "Invalid email or password")
+		h.audit.LogLogin(c.Context(), user.OrganizationID, user.ID, middleware.ClientIP(c), c.Get("User-Agent"), false, "invalid_password")
+		metrics.RecordLogin(false, "invalid_password")
+		h.loginFailed(c, req.Email)
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid email or password")
+	}
+	if h.loginThrottle != nil {
+		h.loginThrottle.Succeeded(c.Context(), req.Email)
 	}
 
-	// Check if user is active
+	if refused, err := h.accountRefused(c, user); refused {
+		return err
+	}
+	h.rehashPassword(user, req.Password)
+
+	if user.MFAEnabled {
+		return h.challengeMFA(c, user)
+	}
+	return h.completeLogin(c, user, "password")
+}
+
+// accountRefused refuses sign-ins of suspended and inactive users and to
+// disabled organizations; when it returns true the response is written
+func (h *AuthHandler) accountRefused(c *fiber.Ctx, user *models.User) (bool, error) {
 	if user.Status == "suspended" {
-		return apiError(c, fiber.StatusForbidden, "account_suspended", "Your account has been suspended. Contact your administrator.")
+		metrics.RecordLogin(false, "account_suspended")
+		return true, apiError(c, fiber.StatusForbidden, apierror.CodeAccountSuspended, "Your account has been suspended. Contact your administrator.")
 	}
 	if user.Status != "active" {
-		return apiError(c, fiber.StatusForbidden, "account_inactive", "Your account is not active. Please verify your email or contact your administrator.")
+		metrics.RecordLogin(false, "account_inactive")
+		return true, apiError(c, fiber.StatusForbidden, apierror.CodeAccountInactive, "Your account is not active. Please verify your email or contact your administrator.")
+	}
+	if services.OrganizationDisabled(c.Context(), h.redis, user.OrganizationID) {
+		metrics.RecordLogin(false, "organization_disabled")
+		return true, apiError(c, fiber.StatusForbidden, apierror.CodeOrganizationDisabled, middleware.OrganizationDisabledMessage)
 	}
+	return false, nil
+}
 
-	// Check if MFA is enabled
-	if user.MFAEnabled {
-		h.logger.Info("MFA required for user: %s", user.Email)
-		// Generate a temporary token for MFA verification
-		mfaToken := uuid.New().String()
-		// Store userID and orgID in Redis with 5 min expiry
-		err = h.redis.Set(c.Context(), "mfa_login:"+mfaToken, user.ID+":"+user.OrganizationID, 5*time.Minute).Err()
-		if err != nil {
-			h.logger.Error("Failed to store MFA login token: %v", err)
-			return apiError(c, fiber.StatusInternalServerError, "server_error", "An internal error occurred. Please try again later.")
-		}
+// challengeMFA answers a sign-in of a user with MFA enabled with a
+// temporary mfa_token to verify a code with, instead of tokens
+func (h *AuthHandler) challengeMFA(c *fiber.Ctx, user *models.User) error {
+	h.logger.Info("MFA required for user: %s", user.Email)
+	// Generate a temporary token for MFA verification
+	mfaToken := uuid.New().String()
+	// Store userID and orgID in Redis with 5 min expiry
+	err := h.redis.Set(c.Context(), "mfa_login:"+mfaToken, user.ID+":"+user.OrganizationID, 5*time.Minute).Err()
+	if err != nil {
+		h.logger.Error("Failed to store MFA login token: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "An internal error occurred. Please try again later.")
+	}
 
-		return c.JSON(fiber.Map{
-			"success":      true,
-			"mfa_required": true,
-			"mfa_token":    mfaToken,
-		})
+	methods := enrolledMFAMethods(user)
+	resp := fiber.Map{
+		"success":      true,
+		"mfa_required": true,
+		"mfa_token":    mfaToken,
+		"mfa_methods":  methods,
 	}
+	// Users whose primary method is email or SMS get their code right away
+	if len(methods) > 0 && (methods[0] == services.OTPMethodEmail || methods[0] == services.OTPMethodSMS) {
+		if sentTo, err := h.sendOTP(c, otpPurposeLogin, methods[0], user, user.MFAPhone); err != nil {
+			h.logger.Warn("Failed to send login MFA code to user %s: %v", user.ID, err)
+		} else {
+			resp["code_sent_to"] = sentTo
+		}
+	}
+	return c.JSON(resp)
+}
 
+// completeLogin signs an authenticated user in: it starts a session and
+// responds with its tokens. method names how the user authenticated.
+func (h *AuthHandler) completeLogin(c *fiber.Ctx, user *models.User, method string) error {
 	// Generate tokens
 	accessID := uuid.New().String()
 	refreshID := uuid.New().String()
-	accessToken, refreshToken, expiresIn, err := h.generateTokens(user, accessID, refreshID)
+	lifetime := h.newSessionLifetime(user.OrganizationID, accessID, time.Now())
+	tokens, err := h.generateTokens(user, accessID, refreshID, lifetime)
 	if err != nil {
 		h.logger.Error("Failed to generate tokens: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "token_error", "Failed to generate authentication tokens. Please try again.")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to generate authentication tokens. Please try again.")
 	}
 
 	// Resolve user role for the response
@@ -185,11 +356,11 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	}
 
 	// Create session
-	ipAddr := c.IP()
+	ipAddr := middleware.ClientIP(c)
 	userAgent := c.Get("User-Agent")
 	session := &models.Session{
 		ID:             accessID,
-		SessionToken:   accessToken,
+		SessionToken:   tokens.AccessToken,
 		PrincipalID:    user.ID,
 		PrincipalType:  "user",
 		OrganizationID: user.OrganizationID,
@@ -200,88 +371,100 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		IPAddress:      &ipAddr,
 		UserAgent:      &userAgent,
 		IssuedAt:       time.Now(),
-		ExpiresAt:      time.Now().Add(time.Duration(expiresIn) * time.Second),
+		ExpiresAt:      lifetime.expiresAt(time.Now(), time.Now().Add(tokens.RefreshTTL)),
 		LastUsedAt:     time.Now(),
 		Status:         "active",
 	}
-	if err := h.queries.Session.CreateSession(session); err != nil {
+	if err := h.startSession(session, lifetime); err != nil {
 		h.logger.Error("Failed to create session: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create session. Please try again.")
 	}
 
 	// Update last login
 	h.queries.Auth.UpdateLastLogin(user.ID, user.OrganizationID)
 
 	// Log successful login
-	h.audit.LogLogin(c.Context(), user.OrganizationID, user.ID, c.IP(), c.Get("User-Agent"), true, "")
+	h.audit.LogLogin(c.Context(), user.OrganizationID, user.ID, middleware.ClientIP(c), c.Get("User-Agent"), true, "")
+	metrics.RecordLogin(true, method)
+	h.publishLogin(c, user, method)
 	h.logger.Info("User logged in successfully: %s", user.Email)
 
-	// Set access token cookie
-	c.Cookie(&fiber.Cookie{
-		Name:     "access_token",
-		Value:    accessToken,
-		Expires:  time.Now().Add(time.Duration(expiresIn) * time.Second),
-		HTTPOnly: true,
-		Secure:   h.config.Environment == "production",
-		SameSite: "Lax",
-		Path:     "/",
-		Domain:   h.config.CookieDomain,
-	})
+	h.setSessionCookies(c, tokens)
+	accessToken, refreshToken := tokens.AccessToken, tokens.RefreshToken
+	if h.cookieSession(c) {
+		accessToken, refreshToken = "", ""
+	}
 
 	return apiSuccess(c, fiber.StatusOK, "Login successful", LoginResponse{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
-		ExpiresIn:    expiresIn,
+		ExpiresIn:    tokens.ExpiresIn(),
 		TokenType:    "Bearer",
 		User:         *user,
 		Role:         userRole,
+
+		MFAEnrollmentRequired: h.settings != nil && h.settings.RequireMFA() && !user.MFAEnabled,
 	})
 }
 
+// rehashPassword replaces the password hash of a user who just signed in
+// when it uses an outdated algorithm or cost. Failures only delay the upgrade
+// to the next login.
+func (h *AuthHandler) rehashPassword(user *models.User, plaintext string) {
+	if !password.NeedsRehash(user.PasswordHash) {
+		return
+	}
+	hash, err := password.Hash(plaintext)
+	if err != nil {
+		h.logger.Warn("Failed to rehash password of user %s: %v", user.ID, err)
+		return
+	}
+	if err := h.queries.Auth.RehashPassword(user.ID, user.OrganizationID, user.PasswordHash, hash); err != nil {
+		h.logger.Warn("Failed to store rehashed password of user %s: %v", user.ID, err)
+		return
+	}
+	user.PasswordHash = hash
+}
+
 // LoginMFAVerify verifies MFA code during login
 func (h *AuthHandler) LoginMFAVerify(c *fiber.Ctx) error {
 	var req struct {
 		MFAToken string `json:"mfa_token" validate:"required"`
 		Code     string `json:"code" validate:"required"`
+		Method   string `json:"method"` // totp, email, sms or backup; defaults to the primary method
 	}
 
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid request format",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
 	}
 
 	// Get user info from Redis
 	val, err := h.redis.Get(c.Context(), "mfa_login:"+req.MFAToken).Result()
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error":   "Invalid or expired MFA token",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid or expired MFA token")
 	}
 
 	// Parse userID and orgID
 	// Expecting "userID:orgID"
 	parts := strings.Split(val, ":")
 	if len(parts) != 2 {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Internal server error",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
 	}
 	userID := parts[0]
 	orgID := parts[1]
 
 	user, err := h.queries.Auth.GetUserByID(userID, orgID)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error":   "User not found",
-			"success": false,
-		})
+		if deleted, _ := h.queries.Auth.IsUserDeleted(userID); deleted {
+			return apiError(c, fiber.StatusForbidden, apierror.CodeAccountDeleted, accountDeletedMessage)
+		}
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "User not found")
+	}
+	if services.OrganizationDisabled(c.Context(), h.redis, user.OrganizationID) {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeOrganizationDisabled, middleware.OrganizationDisabledMessage)
 	}
 
-	// Verify TOTP
-	if !h.mfa.VerifyTOTP(req.Code, user.TOTPSecret) {
+	if err := h.verifyMFACode(c.Context(), user, otpPurposeLogin, req.Method, req.Code); err != nil {
 		h.audit.LogEvent(c.Context(), models.AuditEvent{
 			OrganizationID: user.OrganizationID,
 			PrincipalID:    utils.StringPtr(user.ID),
@@ -290,29 +473,26 @@ func (h *AuthHandler) LoginMFAVerify(c *fiber.Ctx) error {
 			Result:         "failure",
 			Severity:       "MEDIUM",
 		})
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error":   "Invalid MFA code",
-			"success": false,
-		})
+		metrics.RecordLogin(false, "invalid_mfa_code")
+		return mfaCodeError(c, err)
 	}
 
 	// Generate tokens
 	accessID := uuid.New().String()
 	refreshID := uuid.New().String()
-	accessToken, refreshToken, expiresIn, err := h.generateTokens(user, accessID, refreshID)
+	lifetime := h.newSessionLifetime(user.OrganizationID, accessID, time.Now())
+	tokens, err := h.generateTokens(user, accessID, refreshID, lifetime)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to generate tokens",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to generate tokens")
 	}
 
-	// Create session
-	ipAddr := c.IP()
+	// Create session, starting its step-up window
+	ipAddr := middleware.ClientIP(c)
 	userAgent := c.Get("User-Agent")
+	verifiedAt := time.Now()
 	session := &models.Session{
 		ID:             accessID,
-		SessionToken:   accessToken,
+		SessionToken:   tokens.AccessToken,
 		PrincipalID:    user.ID,
 		PrincipalType:  "user",
 		OrganizationID: user.OrganizationID,
@@ -320,15 +500,17 @@ func (h *AuthHandler) LoginMFAVerify(c *fiber.Ctx) error {
 		Context:        "{}",
 		Location:       "{}",
 		MFAVerified:    true,
+		MFAVerifiedAt:  &verifiedAt,
 		IPAddress:      &ipAddr,
 		UserAgent:      &userAgent,
 		IssuedAt:       time.Now(),
-		ExpiresAt:      time.Now().Add(time.Duration(expiresIn) * time.Second),
+		ExpiresAt:      lifetime.expiresAt(time.Now(), time.Now().Add(tokens.RefreshTTL)),
 		LastUsedAt:     time.Now(),
 		Status:         "active",
 	}
-	if err := h.queries.Session.CreateSession(session); err != nil {
+	if err := h.startSession(session, lifetime); err != nil {
 		h.logger.Error("Failed to create session: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create session. Please try again.")
 	}
 
 	// Update last login
@@ -337,26 +519,22 @@ func (h *AuthHandler) LoginMFAVerify(c *fiber.Ctx) error {
 	// Invalidate MFA login token
 	h.redis.Del(c.Context(), "mfa_login:"+req.MFAToken)
 
-	h.audit.LogLogin(c.Context(), user.OrganizationID, user.ID, c.IP(), c.Get("User-Agent"), true, "")
-
-	// Set access token cookie
-	c.Cookie(&fiber.Cookie{
-		Name:     "access_token",
-		Value:    accessToken,
-		Expires:  time.Now().Add(time.Duration(expiresIn) * time.Second),
-		HTTPOnly: true,
-		Secure:   h.config.Environment == "production",
-		SameSite: "Lax",
-		Path:     "/",
-		Domain:   h.config.CookieDomain,
-	})
+	h.audit.LogLogin(c.Context(), user.OrganizationID, user.ID, middleware.ClientIP(c), c.Get("User-Agent"), true, "")
+	metrics.RecordLogin(true, "mfa")
+	h.publishLogin(c, user, "mfa")
+
+	h.setSessionCookies(c, tokens)
+	accessToken, refreshToken := tokens.AccessToken, tokens.RefreshToken
+	if h.cookieSession(c) {
+		accessToken, refreshToken = "", ""
+	}
 
 	return c.JSON(fiber.Map{
 		"success": true,
 		"data": LoginResponse{
 			AccessToken:  accessToken,
 			RefreshToken: refreshToken,
-			ExpiresIn:    expiresIn,
+			ExpiresIn:    tokens.ExpiresIn(),
 			TokenType:    "Bearer",
 			User:         *user,
 		},
@@ -373,38 +551,49 @@ func (h *AuthHandler) LoginMFAVerify(c *fiber.Ctx) error {
 //	@Param			request	body		RegisterRequest	true	"Registration details"
 //	@Success		201		{object}	SuccessResponse	"User registered successfully"
 //	@Failure		400		{object}	ErrorResponse	"Invalid request format or validation error"
+//	@Failure		403		{object}	ErrorResponse	"Registration is disabled, invite-only or restricted to other email domains"
+//	@Failure		404		{object}	ErrorResponse	"Organization not found"
 //	@Failure		409		{object}	ErrorResponse	"User already exists"
 //	@Failure		500		{object}	ErrorResponse	"Internal server error"
 //	@Router			/auth/register [post]
 func (h *AuthHandler) Register(c *fiber.Ctx) error {
+	if closed, err := h.registrationClosed(c); closed {
+		return err
+	}
+
 	var req RegisterRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid request format",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
 	}
 
 	// Email normalization
 	req.Email = strings.TrimSpace(strings.ToLower(req.Email))
+	if refused, err := rejectEmail(c, h.emails, req.Email); refused {
+		return err
+	}
+
+	if refused, err := h.checkRegistrationPolicy(c, req.OrganizationID, req.Email); refused {
+		return err
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	if refused, err := h.checkNewUsername(c, req.OrganizationID, req.Username); refused {
+		return err
+	}
 
 	// Check if user already exists
 	existingUser, _ := h.queries.Auth.GetUserByEmail(req.Email, req.OrganizationID)
 	if existingUser != nil {
-		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-			"error":   "User with this email already exists",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "User with this email already exists")
+	}
+	if refused, err := rejectBreachedPassword(c, h.breaches, req.OrganizationID, req.Password); refused {
+		return err
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := password.Hash(req.Password)
 	if err != nil {
 		h.logger.Error("Failed to hash password: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to process password",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to process password")
 	}
 
 	// Create user
@@ -414,7 +603,7 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		Email:          req.Email,
 		DisplayName:    req.DisplayName,
 		OrganizationID: req.OrganizationID,
-		PasswordHash:   string(hashedPassword),
+		PasswordHash:   hashedPassword,
 		Status:         "active",
 		EmailVerified:  false, // Require email verification
 		CreatedAt:      time.Now(),
@@ -423,16 +612,10 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 
 	if err := h.queries.Auth.CreateUser(user); err != nil {
 		if isConflictErr(err) {
-			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-				"error":   "A user with this email or username already exists",
-				"success": false,
-			})
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "A user with this email or username already exists")
 		}
 		h.logger.Error("Failed to create user: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to create user account",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create user account")
 	}
 
 	// Generate email verification token
@@ -443,13 +626,14 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	}
 
 	// Send verification email with verificationToken
-	err = h.email.SendVerificationEmail(user.Email, user.Username, verificationToken)
+	err = h.email.SendVerificationEmail(user.OrganizationID, user.Email, user.Username, verificationToken)
 	if err != nil {
 		h.logger.Error("Failed to send verification email: %v", err)
 		// We still return success as the user was created, but they might need to resend the verification email
 	}
 
 	h.logger.Info("User registered successfully: %s", user.Email)
+	h.publishUserCreated(c, user, "registration")
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"success": true,
@@ -464,86 +648,119 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 // RefreshToken generates new access token using refresh token
 //
 //	@Summary		Refresh access token
-//	@Description	Get new access token using refresh token
+//	@Description	Get new access token using refresh token. Cookie session clients may omit the body; the refresh_token cookie is used instead.
 //	@Tags			Authentication
 //	@Accept			json
 //	@Produce		json
-//	@Param			request	body		RefreshTokenRequest	true	"Refresh token"
+//	@Param			request			body		RefreshTokenRequest	false	"Refresh token"
+//	@Param			X-Session-Mode	header		string				false	"\"cookie\" to receive the new access token as an HttpOnly cookie"
 //	@Success		200		{object}	LoginResponse		"New access token generated"
 //	@Failure		400		{object}	ErrorResponse		"Invalid request format"
-//	@Failure		401		{object}	ErrorResponse		"Invalid or expired refresh token"
+//	@Failure		401		{object}	ErrorResponse		"Invalid or expired refresh token, or the session expired or was revoked"
 //	@Failure		500		{object}	ErrorResponse		"Internal server error"
 //	@Router			/auth/refresh [post]
 func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
 	var req RefreshTokenRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid request format",
-			"success": false,
-		})
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
+		}
 	}
-
-	// Validate refresh token
-	token, err := jwt.Parse(req.RefreshToken, func(token *jwt.Token) (interface{}, error) {
-		return []byte(h.config.JWTSecret), nil
-	})
+	// Cookie session clients send the refresh token as a cookie
+	if req.RefreshToken == "" {
+		req.RefreshToken = c.Cookies(middleware.RefreshTokenCookie)
+	}
+	if req.RefreshToken == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "refresh_token is required")
+	}
+	// Validate refresh token; it is signed with the same RS256 keys as access tokens
+	token, err := jwt.Parse(req.RefreshToken, h.keys.Keyfunc, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}))
 
 	if err != nil || !token.Valid {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error":   "Invalid refresh token",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid refresh token")
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error":   "Invalid token claims",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid token claims")
+	}
+	userID, _ := claims["user_id"].(string)
+	orgID, _ := claims["organization_id"].(string)
+	if tokenType, _ := claims["type"].(string); tokenType != "refresh" || userID == "" {
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid token claims")
 	}
 
-	userID := claims["user_id"].(string)
-	orgID := claims["organization_id"].(string)
 	user, err := h.queries.Auth.GetUserByID(userID, orgID)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error":   "User not found",
-			"success": false,
-		})
+		if deleted, _ := h.queries.Auth.IsUserDeleted(userID); deleted {
+			return apiError(c, fiber.StatusForbidden, apierror.CodeAccountDeleted, accountDeletedMessage)
+		}
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "User not found")
+	}
+	if services.OrganizationDisabled(c.Context(), h.redis, user.OrganizationID) {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeOrganizationDisabled, middleware.OrganizationDisabledMessage)
+	}
+
+	// Refresh tokens of a session only renew access while the session is
+	// active and within its limits, which the organization may have
+	// tightened since sign-in
+	var lifetime *sessionLifetime
+	if sessionID, _ := claims["sid"].(string); sessionID != "" {
+		session, err := h.queries.Session.GetSession(sessionID, user.OrganizationID)
+		if err != nil {
+			if strings.Contains(err.Error(), "expired") {
+				return apiError(c, fiber.StatusUnauthorized, apierror.CodeSessionExpired, middleware.SessionExpiredMessage)
+			}
+			if strings.Contains(err.Error(), "not found") {
+				return apiError(c, fiber.StatusUnauthorized, apierror.CodeTokenRevoked, "Session has been revoked")
+			}
+			h.logger.Error("Failed to get session %s: %v", sessionID, err)
+			return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to generate new token")
+		}
+		if err := h.queries.Session.TouchSession(sessionID, user.OrganizationID); errors.Is(err, queries.ErrSessionExpired) {
+			return apiError(c, fiber.StatusUnauthorized, apierror.CodeSessionExpired, middleware.SessionExpiredMessage)
+		} else if err != nil {
+			h.logger.Warn("Failed to record activity of session %s: %v", sessionID, err)
+		}
+
+		now := time.Now()
+		lifetime = h.newSessionLifetime(user.OrganizationID, sessionID, session.IssuedAt)
+		if !lifetime.Deadline.IsZero() && !now.Before(lifetime.Deadline) {
+			h.queries.Session.ExpireSession(sessionID, user.OrganizationID)
+			return apiError(c, fiber.StatusUnauthorized, apierror.CodeSessionExpired, middleware.SessionExpiredMessage)
+		}
+		refreshExpiry, err := claims.GetExpirationTime()
+		if err != nil || refreshExpiry == nil {
+			return apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid token claims")
+		}
+		session.ExpiresAt = lifetime.expiresAt(now, refreshExpiry.Time)
+		if err := h.queries.Session.TrackSession(session, lifetime.Idle, lifetime.Deadline); err != nil {
+			h.logger.Error("Failed to track session %s: %v", sessionID, err)
+			return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to generate new token")
+		}
 	}
 
 	// Generate new access token
 	accessID := uuid.New().String()
 	refreshID := uuid.New().String()
-	accessToken, _, expiresIn, err := h.generateTokens(user, accessID, refreshID)
+	tokens, err := h.generateTokens(user, accessID, refreshID, lifetime)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to generate new token",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to generate new token")
 	}
 
-	// Update or Create session for the refreshed token if needed
-	// For now, just generate the token. Ideally we'd link this to an existing session.
-
-	// Set access token in cookie
-	c.Cookie(&fiber.Cookie{
-		Name:     "access_token",
-		Value:    accessToken,
-		Expires:  time.Now().Add(time.Duration(expiresIn) * time.Second),
-		HTTPOnly: true,
-		Secure:   h.config.Environment == "production",
-		SameSite: "Lax",
-		Path:     "/",
-		Domain:   h.config.CookieDomain,
-	})
+	// Only the access token is renewed; the refresh token keeps its expiry
+	tokens.RefreshToken = ""
+	h.setSessionCookies(c, tokens)
+	accessToken := tokens.AccessToken
+	if h.cookieSession(c) {
+		accessToken = ""
+	}
 
 	return c.JSON(fiber.Map{
 		"success": true,
 		"data": fiber.Map{
 			"access_token": accessToken,
-			"expires_in":   expiresIn,
+			"expires_in":   tokens.ExpiresIn(),
 			"token_type":   "Bearer",
 		},
 	})
@@ -564,31 +781,27 @@ func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 	// Get user ID from context (set by auth middleware)
 	userID, ok := c.Locals("user_id").(string)
 	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error":   "Invalid session",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid session")
 	}
 
-	// Get the current session token from Authorization header
+	// Get the current session token from Authorization header, or the
+	// session cookie for cookie session clients
 	authHeader := c.Get("Authorization")
-	if authHeader == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error":   "No authorization token provided",
-			"success": false,
-		})
-	}
-
-	// Extract token from "Bearer <token>"
 	token := authHeader
 	if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
 		token = authHeader[7:]
 	}
+	if token == "" {
+		token = c.Cookies(middleware.AccessTokenCookie)
+	}
+	if token == "" {
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "No authorization token provided")
+	}
 
-	// Find session by token and revoke it in database
+	// Revoke the session in the database; this also ends its refresh token
 	orgID := c.Locals("organization_id").(string)
-	if session, err := h.queries.Session.GetSessionByToken(token, orgID); err == nil {
-		h.queries.Session.RevokeSession(session.ID, orgID)
+	if sessionID, _ := c.Locals("session_id").(string); sessionID != "" {
+		h.queries.Session.RevokeSession(sessionID, orgID)
 	}
 
 	// Invalidate legacy session in Redis if patterns match
@@ -614,19 +827,18 @@ func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 		}
 	}
 
+	// Logging out of an impersonation session ends the impersonation
+	if rootID := middleware.Impersonator(c); rootID != "" && h.impersonation != nil {
+		sessionID, _ := c.Locals("session_id").(string)
+		if _, err := h.impersonation.Stop(c.Context(), sessionID, rootID, services.ImpersonationLogout); err != nil && !errors.Is(err, services.ErrImpersonationNotFound) {
+			h.logger.Error("Failed to end impersonation session %s: %v", sessionID, err)
+		}
+	}
+
 	h.logger.Info("User logged out: %s", userID)
 
-	// Clear access token cookie
-	c.Cookie(&fiber.Cookie{
-		Name:     "access_token",
-		Value:    "",
-		Expires:  time.Now().Add(-time.Hour),
-		HTTPOnly: true,
-		Secure:   h.config.Environment == "production",
-		SameSite: "Lax",
-		Path:     "/",
-		Domain:   h.config.CookieDomain,
-	})
+	// Clear session cookies
+	h.clearSessionCookies(c)
 
 	return c.JSON(fiber.Map{
 		"success": true,
@@ -650,10 +862,7 @@ func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 func (h *AuthHandler) CreateAdminUser(c *fiber.Ctx) error {
 	var req CreateAdminRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid request format",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
 	}
 
 	// Email normalization
@@ -663,36 +872,27 @@ func (h *AuthHandler) CreateAdminUser(c *fiber.Ctx) error {
 	adminExists, err := h.queries.Auth.CheckAdminExists()
 	if err != nil {
 		h.logger.Error("Failed to check admin existence: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to verify system state",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to verify system state")
 	}
 
 	if adminExists {
-		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-			"error":   "Admin user already exists in the system",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "Admin user already exists in the system")
 	}
 
 	// Check if user already exists
 	existingUser, _ := h.queries.Auth.GetUserByEmail(req.Email, req.OrganizationID)
 	if existingUser != nil {
-		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-			"error":   "User with this email already exists",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "User with this email already exists")
+	}
+	if refused, err := rejectBreachedPassword(c, h.breaches, req.OrganizationID, req.Password); refused {
+		return err
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := password.Hash(req.Password)
 	if err != nil {
 		h.logger.Error("Failed to hash password: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to process password",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to process password")
 	}
 
 	// Use provided organization or allow query layer to fall back to default
@@ -705,7 +905,7 @@ func (h *AuthHandler) CreateAdminUser(c *fiber.Ctx) error {
 		Email:          req.Email,
 		DisplayName:    req.DisplayName,
 		OrganizationID: orgID,
-		PasswordHash:   string(hashedPassword),
+		PasswordHash:   hashedPassword,
 		Status:         "active",
 		EmailVerified:  true, // Admin users are pre-verified
 		CreatedAt:      time.Now(),
@@ -716,20 +916,19 @@ func (h *AuthHandler) CreateAdminUser(c *fiber.Ctx) error {
 	err = h.queries.Auth.CreateAdminUser(user)
 	if err != nil {
 		if errors.Is(err, queries.ErrOrganizationNotFound) {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Specified organization does not exist",
-				"success": false,
-			})
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Specified organization does not exist")
 		}
 
 		h.logger.Error("Failed to create admin user: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to create admin user",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create admin user")
+	}
+
+	if err := services.SeedSystemRoles(h.queries.Role, user.OrganizationID); err != nil {
+		h.logger.Warn("Failed to seed system roles for organization %s: %v", user.OrganizationID, err)
 	}
 
 	h.logger.Info("Admin user created successfully: %s", user.Email)
+	h.publishUserCreated(c, user, "admin_bootstrap")
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"success": true,
@@ -743,12 +942,57 @@ func (h *AuthHandler) CreateAdminUser(c *fiber.Ctx) error {
 	})
 }
 
-// generateTokens creates JWT access and refresh tokens for a user
-func (h *AuthHandler) generateTokens(user *models.User, accessID, refreshID string) (string, string, int64, error) {
+// generateTokens creates JWT access and refresh tokens for a user, with the
+// lifetimes configured for the user's organization. With a session they
+// carry its ID as the sid claim and expire by its deadline.
+func (h *AuthHandler) generateTokens(user *models.User, accessID, refreshID string, session *sessionLifetime) (*issuedTokens, error) {
 	now := time.Now()
-	accessTokenExpiry := now.Add(time.Hour * 1)       // 1 hour
-	refreshTokenExpiry := now.Add(time.Hour * 24 * 7) // 7 days
+	accessTTL, refreshTTL := h.tokenLifetimes(user.OrganizationID)
+	accessTokenExpiry := session.cap(now.Add(accessTTL))
+	refreshTokenExpiry := session.cap(now.Add(refreshTTL))
+	accessTTL, refreshTTL = accessTokenExpiry.Sub(now), refreshTokenExpiry.Sub(now)
+
+	// Access Token Claims
+	accessClaims := h.accessClaims(user, accessID, now, accessTokenExpiry)
+
+	// Refresh Token Claims
+	refreshClaims := jwt.MapClaims{
+		"sub":             user.ID,
+		"jti":             refreshID,
+		"user_id":         user.ID,
+		"organization_id": user.OrganizationID,
+		"exp":             refreshTokenExpiry.Unix(),
+		"iat":             now.Unix(),
+		"type":            "refresh",
+	}
+	if session != nil {
+		accessClaims["sid"] = session.ID
+		refreshClaims["sid"] = session.ID
+	}
+
+	// Generate Access Token using RS256
+	accessTokenString, err := h.keys.Sign(accessClaims)
+	if err != nil {
+		return nil, err
+	}
 
+	// Generate Refresh Token using RS256
+	refreshTokenString, err := h.keys.Sign(refreshClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &issuedTokens{
+		AccessToken:  accessTokenString,
+		RefreshToken: refreshTokenString,
+		AccessTTL:    accessTTL,
+		RefreshTTL:   refreshTTL,
+	}, nil
+}
+
+// accessClaims returns the claims of an access token for user, with the
+// user's current primary role
+func (h *AuthHandler) accessClaims(user *models.User, accessID string, now, expiry time.Time) jwt.MapClaims {
 	roleName := "user"
 	if h.queries != nil && h.queries.Auth != nil {
 		if fetchedRole, err := h.queries.Auth.GetPrimaryRoleForUser(user.ID, user.OrganizationID); err == nil && fetchedRole != "" {
@@ -758,8 +1002,7 @@ func (h *AuthHandler) generateTokens(user *models.User, accessID, refreshID stri
 		}
 	}
 
-	// Access Token Claims
-	accessClaims := jwt.MapClaims{
+	return jwt.MapClaims{
 		"iss":             h.config.OIDCIssuer,
 		"sub":             user.ID,
 		"jti":             accessID,
@@ -767,44 +1010,16 @@ func (h *AuthHandler) generateTokens(user *models.User, accessID, refreshID stri
 		"email":           user.Email,
 		"organization_id": user.OrganizationID,
 		"role":            roleName,
-		"exp":             accessTokenExpiry.Unix(),
+		"exp":             expiry.Unix(),
 		"iat":             now.Unix(),
 		"type":            "access",
 	}
-
-	// Refresh Token Claims
-	refreshClaims := jwt.MapClaims{
-		"sub":     user.ID,
-		"jti":     refreshID,
-		"user_id": user.ID,
-		"exp":     refreshTokenExpiry.Unix(),
-		"iat":     now.Unix(),
-		"type":    "refresh",
-	}
-
-	// Generate Access Token using RS256
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodRS256, accessClaims)
-	accessTokenString, err := accessToken.SignedString(h.privateKey)
-	if err != nil {
-		return "", "", 0, err
-	}
-
-	// Generate Refresh Token using RS256
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodRS256, refreshClaims)
-	refreshTokenString, err := refreshToken.SignedString(h.privateKey)
-	if err != nil {
-		return "", "", 0, err
-	}
-
-	expiresIn := accessTokenExpiry.Unix() - now.Unix()
-
-	return accessTokenString, refreshTokenString, expiresIn, nil
 }
 
 // SetupMFA sets up multi-factor authentication for a user
 //
 //	@Summary		Setup MFA
-//	@Description	Set up multi-factor authentication for the authenticated user
+//	@Description	Start MFA enrollment for the authenticated user. For totp the response carries the secret and QR code; for email and sms a verification code is sent. Complete enrollment with /auth/mfa/verify.
 //	@Tags			MFA
 //	@Accept			json
 //	@Produce		json
@@ -813,140 +1028,281 @@ func (h *AuthHandler) generateTokens(user *models.User, accessID, refreshID stri
 //	@Success		200		{object}	models.SetupMFAResponse
 //	@Failure		400		{object}	ErrorResponse
 //	@Failure		401		{object}	ErrorResponse
+//	@Failure		429		{object}	ErrorResponse
 //	@Failure		500		{object}	ErrorResponse
 //	@Router			/auth/mfa/setup [post]
 func (h *AuthHandler) SetupMFA(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 	orgID := c.Locals("organization_id").(string)
 
+	req := models.SetupMFARequest{Method: mfaMethodTOTP}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
+		}
+		if req.Method == "" {
+			req.Method = mfaMethodTOTP
+		}
+	}
+
 	// Get user to check if MFA is already enabled
 	user, err := h.queries.Auth.GetUserByID(userID, orgID)
 	if err != nil {
 		if isNotFoundErr(err) {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error":   "User not found",
-				"success": false,
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to retrieve user",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve user")
 	}
 
 	if user.MFAEnabled {
-		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-			"error":   "MFA is already enabled for this account",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "MFA is already enabled for this account")
 	}
 
-	// Generate TOTP secret and QR code
-	secret, provisionURL, qrCodeBase64, err := h.mfa.GenerateTOTPSecret(userID, user.Email)
-	if err != nil {
-		h.logger.Error("Failed to generate TOTP secret: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to generate MFA secret",
-			"success": false,
-		})
+	setup := pendingMFASetup{Method: req.Method}
+	var resp models.SetupMFAResponse
+	var message string
+
+	switch req.Method {
+	case mfaMethodTOTP:
+		// Generate TOTP secret and QR code
+		secret, provisionURL, qrCodeBase64, err := h.mfa.GenerateTOTPSecret(userID, user.Email)
+		if err != nil {
+			h.logger.Error("Failed to generate TOTP secret: %v", err)
+			return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to generate MFA secret")
+		}
+		setup.Secret = secret
+		resp = models.SetupMFAResponse{Secret: secret, QRCode: qrCodeBase64, Message: provisionURL}
+		message = "MFA setup initiated. Scan the QR code with your authenticator app, then verify with a code."
+	case services.OTPMethodEmail, services.OTPMethodSMS:
+		if req.Method == services.OTPMethodSMS {
+			if !e164Pattern.MatchString(req.Phone) {
+				return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "phone must be an E.164 number such as +14155550123")
+			}
+			setup.Phone = req.Phone
+		}
+		if !h.otp.MethodEnabled(req.Method) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "This MFA method is not available")
+		}
+	default:
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "method must be one of totp, email or sms")
 	}
 
-	// Store secret in Redis temporarily (10 min) until user verifies with a code
-	err = h.redis.Set(c.Context(), "mfa_setup:"+userID, secret, 10*time.Minute).Err()
+	// Keep the pending setup in Redis (10 min) until the user verifies with a code
+	raw, _ := json.Marshal(setup)
+	err = h.redis.Set(c.Context(), "mfa_setup:"+userID, raw, 10*time.Minute).Err()
 	if err != nil {
-		h.logger.Error("Failed to store MFA setup secret: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to initiate MFA setup",
-			"success": false,
-		})
+		h.logger.Error("Failed to store MFA setup: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to initiate MFA setup")
+	}
+
+	if req.Method != mfaMethodTOTP {
+		sentTo, err := h.sendOTP(c, otpPurposeSetup, req.Method, user, setup.Phone)
+		if err != nil {
+			h.redis.Del(c.Context(), "mfa_setup:"+userID)
+			return h.otpSendError(c, err)
+		}
+		resp.Message = "Verification code sent to " + sentTo
+		message = "MFA setup initiated. Enter the code we sent you to finish."
 	}
 
 	h.audit.LogEvent(c.Context(), models.AuditEvent{
-		OrganizationID: orgID,
-		PrincipalID:    utils.StringPtr(userID),
-		PrincipalType:  utils.StringPtr("user"),
-		Action:         "mfa_setup_initiated",
-		Result:         "success",
-		Severity:       "MEDIUM",
+		OrganizationID:    orgID,
+		PrincipalID:       utils.StringPtr(userID),
+		PrincipalType:     utils.StringPtr("user"),
+		Action:            "mfa_setup_initiated",
+		AdditionalContext: fmt.Sprintf(`{"method":%q}`, req.Method),
+		Result:            "success",
+		Severity:          "warn",
 	})
 
 	return c.JSON(fiber.Map{
 		"success": true,
-		"message": "MFA setup initiated. Scan the QR code with your authenticator app, then verify with a code.",
-		"data": models.SetupMFAResponse{
-			Secret:  secret,
-			QRCode:  qrCodeBase64,
-			Message: provisionURL,
-		},
+		"message": message,
+		"data":    resp,
 	})
 }
 
 // VerifyMFA verifies a multi-factor authentication code
 //
 //	@Summary		Verify MFA
-//	@Description	Verify multi-factor authentication code for login
+//	@Description	Verify a multi-factor authentication code. While an MFA setup is pending the code completes enrollment and backup codes are returned; otherwise the code is checked against the chosen enrolled method (totp, email, sms or backup). Either way the calling session counts as MFA-verified for step-up protected operations.
 //	@Tags			MFA
 //	@Accept			json
 //	@Produce		json
 //	@Param			request	body		models.VerifyMFARequest	true	"MFA verification details"
-//	@Success		200		{object}	LoginResponse
+//	@Success		200		{object}	models.BackupCodesResponse
 //	@Failure		400		{object}	ErrorResponse
 //	@Failure		401		{object}	ErrorResponse
+//	@Failure		429		{object}	ErrorResponse
 //	@Failure		500		{object}	ErrorResponse
 //	@Router			/auth/mfa/verify [post]
 func (h *AuthHandler) VerifyMFA(c *fiber.Ctx) error {
 	var req models.VerifyMFARequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid request format",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
 	}
 
 	userID := c.Locals("user_id").(string)
 	orgID := c.Locals("organization_id").(string)
 
 	// Check if this is MFA setup verification
-	secret, err := h.redis.Get(c.Context(), "mfa_setup:"+userID).Result()
+	raw, err := h.redis.Get(c.Context(), "mfa_setup:"+userID).Result()
 	if err == nil {
-		if h.mfa.VerifyTOTP(req.Code, secret) {
-			backupCodes := h.mfa.GenerateBackupCodes(10)
-			err = h.queries.Auth.EnableMFA(userID, orgID, secret, backupCodes)
-			if err != nil {
-				h.logger.Error("Failed to enable MFA for user: %v", err)
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error":   "Failed to complete MFA setup",
-					"success": false,
-				})
+		setup := parsePendingMFASetup(raw)
+		if setup.Method == mfaMethodTOTP {
+			if !h.mfa.VerifyTOTP(req.Code, setup.Secret) {
+				return apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid MFA code")
 			}
+		} else if err := h.otp.Verify(c.Context(), otpPurposeSetup, setup.Method, userID, req.Code); err != nil {
+			return mfaCodeError(c, err)
+		}
 
-			h.redis.Del(c.Context(), "mfa_setup:"+userID)
-			h.audit.LogEvent(c.Context(), models.AuditEvent{
-				OrganizationID: orgID,
-				PrincipalID:    utils.StringPtr(userID),
-				PrincipalType:  utils.StringPtr("user"),
-				Action:         "mfa_setup_complete",
-				Result:         "success",
-				Severity:       "MEDIUM",
-			})
-
-			return c.JSON(fiber.Map{
-				"success": true,
-				"message": "MFA setup complete",
-				"data": models.BackupCodesResponse{
-					BackupCodes: backupCodes,
-					Message:     "Save these backup codes in a safe place",
-				},
-			})
+		backupCodes := h.mfa.GenerateBackupCodes(10)
+		err = h.queries.Auth.EnableMFA(userID, orgID, setup.Method, setup.Secret, setup.Phone, backupCodes)
+		if err != nil {
+			h.logger.Error("Failed to enable MFA for user: %v", err)
+			return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to complete MFA setup")
 		}
+
+		h.redis.Del(c.Context(), "mfa_setup:"+userID)
+		h.markSessionMFAVerified(c, setup.Method)
+		h.audit.LogEvent(c.Context(), models.AuditEvent{
+			OrganizationID:    orgID,
+			PrincipalID:       utils.StringPtr(userID),
+			PrincipalType:     utils.StringPtr("user"),
+			Action:            "mfa_setup_complete",
+			AdditionalContext: fmt.Sprintf(`{"method":%q}`, setup.Method),
+			Result:            "success",
+			Severity:          "warn",
+		})
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": "MFA setup complete",
+			"data": models.BackupCodesResponse{
+				BackupCodes: backupCodes,
+				Message:     "Save these backup codes in a safe place",
+			},
+		})
+	}
+
+	user, err := h.queries.Auth.GetUserByID(userID, orgID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found")
+		}
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve user")
+	}
+	if !user.MFAEnabled {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "MFA is not enabled. Please set up MFA first.")
+	}
+
+	if err := h.verifyMFACode(c.Context(), user, otpPurposeVerify, req.Method, req.Code); err != nil {
+		h.audit.LogEvent(c.Context(), models.AuditEvent{
+			OrganizationID: orgID,
+			PrincipalID:    utils.StringPtr(userID),
+			PrincipalType:  utils.StringPtr("user"),
+			Action:         "mfa_verify_failed",
+			Result:         "failure",
+			Severity:       "warn",
+		})
+		return mfaCodeError(c, err)
+	}
+	method := req.Method
+	if method == "" {
+		method = enrolledMFAMethods(user)[0]
 	}
+	h.markSessionMFAVerified(c, method)
 
-	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-		"error":   "Invalid MFA code",
-		"success": false,
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "MFA code verified",
 	})
 }
 
+// SendMFACode sends an email or SMS code to the authenticated user for
+// /auth/mfa/verify
+//
+//	@Summary		Send MFA code
+//	@Description	Send a one-time code by email or SMS to the authenticated user, to be checked with /auth/mfa/verify
+//	@Tags			MFA
+//	@Accept			json
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			request	body		models.SendMFACodeRequest	true	"Delivery method"
+//	@Success		200		{object}	SuccessResponse
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		429		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Router			/auth/mfa/send [post]
+func (h *AuthHandler) SendMFACode(c *fiber.Ctx) error {
+	var req models.SendMFACodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
+	}
+
+	user, err := h.queries.Auth.GetUserByID(c.Locals("user_id").(string), c.Locals("organization_id").(string))
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found")
+		}
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve user")
+	}
+	return h.sendEnrolledMFACode(c, user, otpPurposeVerify, req.Method)
+}
+
+// LoginMFASend sends an email or SMS code to finish an MFA login
+//
+//	@Summary		Send login MFA code
+//	@Description	Send (or resend) a one-time code by email or SMS for the login identified by mfa_token, to be checked with /auth/login/mfa-verify
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		models.SendMFACodeRequest	true	"MFA login token and delivery method"
+//	@Success		200		{object}	SuccessResponse
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		429		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Router			/auth/login/mfa-send [post]
+func (h *AuthHandler) LoginMFASend(c *fiber.Ctx) error {
+	var req models.SendMFACodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
+	}
+
+	val, err := h.redis.Get(c.Context(), "mfa_login:"+req.MFAToken).Result()
+	if err != nil || req.MFAToken == "" {
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid or expired MFA token")
+	}
+	parts := strings.Split(val, ":")
+	if len(parts) != 2 {
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+	}
+
+	user, err := h.queries.Auth.GetUserByID(parts[0], parts[1])
+	if err != nil {
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "User not found")
+	}
+	return h.sendEnrolledMFACode(c, user, otpPurposeLogin, req.Method)
+}
+
+func (h *AuthHandler) sendEnrolledMFACode(c *fiber.Ctx, user *models.User, purpose, method string) error {
+	if method != services.OTPMethodEmail && method != services.OTPMethodSMS {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "method must be email or sms")
+	}
+	if !user.MFAEnabled || !hasMFAMethod(user, method) {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "MFA method is not enabled for this account")
+	}
+
+	sentTo, err := h.sendOTP(c, purpose, method, user, user.MFAPhone)
+	if err != nil {
+		return h.otpSendError(c, err)
+	}
+	return apiSuccess(c, fiber.StatusOK, "Verification code sent", fiber.Map{"sent_to": sentTo})
+}
+
 // GenerateBackupCodes generates backup codes for MFA
 //
 //	@Summary		Generate MFA backup codes
@@ -967,22 +1323,13 @@ func (h *AuthHandler) GenerateBackupCodes(c *fiber.Ctx) error {
 	user, err := h.queries.Auth.GetUserByID(userID, orgID)
 	if err != nil {
 		if isNotFoundErr(err) {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error":   "User not found",
-				"success": false,
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to retrieve user",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve user")
 	}
 
 	if !user.MFAEnabled {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "MFA is not enabled. Please set up MFA first.",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "MFA is not enabled. Please set up MFA first.")
 	}
 
 	// Generate new backup codes
@@ -992,10 +1339,7 @@ func (h *AuthHandler) GenerateBackupCodes(c *fiber.Ctx) error {
 	err = h.queries.Auth.UpdateBackupCodes(userID, orgID, backupCodes)
 	if err != nil {
 		h.logger.Error("Failed to update backup codes: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to generate backup codes",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to generate backup codes")
 	}
 
 	h.audit.LogEvent(c.Context(), models.AuditEvent{
@@ -1036,36 +1380,24 @@ func (h *AuthHandler) DisableMFA(c *fiber.Ctx) error {
 
 	var req models.DisableMFARequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid request format",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
 	}
 
 	// Verify user identity with password before disabling MFA
 	user, err := h.queries.Auth.GetUserByID(userID, orgID)
 	if err != nil {
 		if isNotFoundErr(err) {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error":   "User not found",
-				"success": false,
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to retrieve user",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve user")
 	}
 
 	if !user.MFAEnabled {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "MFA is not currently enabled",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "MFA is not currently enabled")
 	}
 
 	// Verify password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+	if err := password.Verify(user.PasswordHash, req.Password); err != nil {
 		h.audit.LogEvent(c.Context(), models.AuditEvent{
 			OrganizationID: orgID,
 			PrincipalID:    utils.StringPtr(userID),
@@ -1074,20 +1406,14 @@ func (h *AuthHandler) DisableMFA(c *fiber.Ctx) error {
 			Result:         "failure",
 			Severity:       "HIGH",
 		})
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error":   "Invalid password",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid password")
 	}
 
 	// Disable MFA
 	err = h.queries.Auth.DisableMFA(userID, orgID)
 	if err != nil {
 		h.logger.Error("Failed to disable MFA: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to disable MFA",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to disable MFA")
 	}
 
 	h.audit.LogEvent(c.Context(), models.AuditEvent{
@@ -1121,10 +1447,7 @@ func (h *AuthHandler) DisableMFA(c *fiber.Ctx) error {
 func (h *AuthHandler) ForgotPassword(c *fiber.Ctx) error {
 	var req ForgotPasswordRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid request format",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
 	}
 
 	// Check if user exists
@@ -1144,14 +1467,11 @@ func (h *AuthHandler) ForgotPassword(c *fiber.Ctx) error {
 	err = h.queries.Auth.SetPasswordResetToken(user.ID, resetToken, time.Hour)
 	if err != nil {
 		h.logger.Error("Failed to store reset token: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to process password reset request",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to process password reset request")
 	}
 
 	// Send email with reset link containing the resetToken
-	err = h.email.SendPasswordResetEmail(user.Email, user.Username, resetToken)
+	err = h.email.SendPasswordResetEmail(user.OrganizationID, user.Email, user.Username, resetToken)
 	if err != nil {
 		h.logger.Error("Failed to send password reset email: %v", err)
 		// We should probably still return success to prevent user enumeration
@@ -1180,41 +1500,36 @@ func (h *AuthHandler) ForgotPassword(c *fiber.Ctx) error {
 func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
 	var req ResetPasswordRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid request format",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
 	}
 
 	// Verify reset token
 	userID, err := h.queries.Auth.GetPasswordResetToken(req.Token)
 	if err != nil || userID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid or expired reset token",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid or expired reset token")
+	}
+	orgID := ""
+	if user, err := h.queries.Auth.GetUserByID(userID, ""); err == nil {
+		orgID = user.OrganizationID
+	}
+	if refused, err := rejectBreachedPassword(c, h.breaches, orgID, req.NewPassword); refused {
+		return err
 	}
 
 	// Hash new password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	hashedPassword, err := password.Hash(req.NewPassword)
 	if err != nil {
 		h.logger.Error("Failed to hash password: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to process new password",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to process new password")
 	}
 
 	// Update password in database
-	err = h.queries.Auth.UpdatePassword(userID, string(hashedPassword), "") // Need user org here, but we only have ID from Redis.
+	err = h.queries.Auth.UpdatePassword(userID, hashedPassword, "") // Need user org here, but we only have ID from Redis.
 	// In a real system, SetPasswordResetToken should store OrgID too.
 	// For now, passing "" to allow global lookup if ID is unique.
 	if err != nil {
 		h.logger.Error("Failed to update password: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to update password",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update password")
 	}
 
 	// Delete the reset token
@@ -1247,29 +1562,20 @@ func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
 func (h *AuthHandler) VerifyEmail(c *fiber.Ctx) error {
 	var req VerifyEmailRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid request format",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
 	}
 
 	// Verify email verification token
 	userID, err := h.queries.Auth.GetEmailVerificationToken(req.Token)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid or expired verification token",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid or expired verification token")
 	}
 
 	// Update email verification status
 	err = h.queries.Auth.UpdateEmailVerification(userID, true, "") // Same as above, Redis token only has userID.
 	if err != nil {
 		h.logger.Error("Failed to verify email: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to verify email",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to verify email")
 	}
 
 	// Delete the verification token
@@ -1277,6 +1583,14 @@ func (h *AuthHandler) VerifyEmail(c *fiber.Ctx) error {
 
 	h.logger.Info("Email verified for user: %s", userID)
 
+	// Invitations to collaborate sent to this address before the account
+	// existed take effect now that the user has proven they own it
+	if n, err := h.queries.Content.WithContext(c.UserContext()).AcceptInvitationsForUser(userID); err != nil {
+		h.logger.Error("Failed to accept collaborator invitations for user %s: %v", userID, err)
+	} else if n > 0 {
+		h.logger.Info("Accepted %d collaborator invitations for user %s", n, userID)
+	}
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Email verified successfully",
@@ -1299,10 +1613,7 @@ func (h *AuthHandler) VerifyEmail(c *fiber.Ctx) error {
 func (h *AuthHandler) ResendVerification(c *fiber.Ctx) error {
 	var req ResendVerificationRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid request format",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
 	}
 
 	// Check if user exists
@@ -1330,14 +1641,11 @@ func (h *AuthHandler) ResendVerification(c *fiber.Ctx) error {
 	err = h.queries.Auth.SetEmailVerificationToken(user.ID, verificationToken, time.Hour*24)
 	if err != nil {
 		h.logger.Error("Failed to store verification token: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to process verification request",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to process verification request")
 	}
 
 	// Send verification email with verificationToken
-	err = h.email.SendVerificationEmail(user.Email, user.Username, verificationToken)
+	err = h.email.SendVerificationEmail(user.OrganizationID, user.Email, user.Username, verificationToken)
 	if err != nil {
 		h.logger.Error("Failed to resend verification email: %v", err)
 	}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/authz"
+	"github.com/the-monkeys/monkeys-identity/internal/middleware"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+// SetDelegation injects the service managing delegation grants. Called
+// from route setup.
+func (h *AuthHandler) SetDelegation(delegation services.DelegationService) {
+	h.delegation = delegation
+}
+
+// DelegationGrantRequest is the body of POST /users/me/delegations
+type DelegationGrantRequest struct {
+	ServiceAccountID string     `json:"service_account_id" validate:"required,uuid"`
+	Actions          []string   `json:"actions" validate:"required,min=1"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+}
+
+// DelegatedTokenRequest is the body of POST /auth/delegation/token
+type DelegatedTokenRequest struct {
+	UserID string `json:"user_id" validate:"required,uuid"`
+	// Actions narrows the token to some of the delegated actions; all of
+	// them when empty
+	Actions []string `json:"actions,omitempty"`
+}
+
+// DelegatedTokenResponse carries a token a service account minted to act
+// for a user. There is no refresh token; a new one is minted while the
+// grant is active.
+type DelegatedTokenResponse struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type"`
+	ExpiresIn    int64     `json:"expires_in"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	DelegationID string    `json:"delegation_id"`
+	Actions      []string  `json:"actions"`
+}
+
+// ListMyDelegations lists the caller's active delegation grants
+//
+//	@Summary		List my delegations
+//	@Description	Lists the active grants with which the caller lets service accounts act on their behalf, with the actions that can be delegated.
+//	@Tags			Delegation
+//	@Produce		json
+//	@Success		200	{object}	SuccessResponse	"Active delegation grants"
+//	@Failure		403	{object}	ErrorResponse	"Caller is not a user"
+//	@Failure		500	{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/users/me/delegations [get]
+func (h *AuthHandler) ListMyDelegations(c *fiber.Ctx) error {
+	if callerPrincipalType(c) != "user" {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only users can delegate")
+	}
+	grants, err := h.queries.Delegation.WithContext(c.Context()).ListActiveGrants(
+		c.Locals("organization_id").(string), c.Locals("user_id").(string), "")
+	if err != nil {
+		h.logger.Error("Failed to list delegation grants: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list delegations")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Delegations retrieved successfully", fiber.Map{
+		"delegations":       grants,
+		"delegable_actions": authz.DelegableActionNames(),
+	})
+}
+
+// GrantDelegation lets a service account act on the caller's behalf
+//
+//	@Summary		Delegate to a service account
+//	@Description	The caller consents to let a service account of the organization perform the listed actions on their behalf, until expires_at or until revoked. Replaces an active grant to the same service account. The service account mints tokens from the grant with POST /auth/delegation/token.
+//	@Tags			Delegation
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		DelegationGrantRequest	true	"Service account and actions"
+//	@Success		201		{object}	SuccessResponse{data=models.DelegationGrant}	"Delegation granted"
+//	@Failure		400		{object}	ErrorResponse	"Unknown action or expiry in the past"
+//	@Failure		403		{object}	ErrorResponse	"Caller is not a user"
+//	@Failure		404		{object}	ErrorResponse	"Service account not found"
+//	@Failure		500		{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/users/me/delegations [post]
+func (h *AuthHandler) GrantDelegation(c *fiber.Ctx) error {
+	if callerPrincipalType(c) != "user" {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only users can delegate")
+	}
+	var req DelegationGrantRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
+	}
+	if _, err := uuid.Parse(req.ServiceAccountID); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "service_account_id must be a UUID")
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "expires_at must be in the future")
+	}
+
+	grant := &models.DelegationGrant{
+		OrganizationID:   c.Locals("organization_id").(string),
+		UserID:           c.Locals("user_id").(string),
+		ServiceAccountID: req.ServiceAccountID,
+		Actions:          req.Actions,
+		ExpiresAt:        req.ExpiresAt,
+	}
+	if err := h.delegation.Grant(c.Context(), grant); err != nil {
+		if errors.Is(err, services.ErrInvalidDelegatedAction) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "actions must list delegable actions",
+				fiber.Map{"delegable_actions": authz.DelegableActionNames()})
+		}
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Service account not found")
+		}
+		h.logger.Error("Failed to grant delegation: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to grant delegation")
+	}
+	return apiSuccess(c, fiber.StatusCreated, "Delegation granted", grant)
+}
+
+// RevokeMyDelegation revokes one of the caller's delegation grants
+//
+//	@Summary		Revoke my delegation
+//	@Description	Revokes a delegation grant of the caller. Tokens already minted from it are refused from then on.
+//	@Tags			Delegation
+//	@Produce		json
+//	@Param			id	path		string			true	"Delegation grant ID"
+//	@Success		200	{object}	SuccessResponse	"Delegation revoked"
+//	@Failure		404	{object}	ErrorResponse	"No active grant of the caller with this ID"
+//	@Failure		500	{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/users/me/delegations/{id} [delete]
+func (h *AuthHandler) RevokeMyDelegation(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+	return h.revokeDelegation(c, c.Params("id"), userID, userID)
+}
+
+// ListServiceAccountDelegations lists the active grants to a service account
+//
+//	@Summary		List service account delegations
+//	@Description	Lists the users who let the service account act on their behalf, with the delegated actions.
+//	@Tags			Delegation
+//	@Produce		json
+//	@Param			id	path		string			true	"Service account ID"
+//	@Success		200	{object}	SuccessResponse	"Active delegation grants"
+//	@Failure		500	{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/service-accounts/{id}/delegations [get]
+func (h *AuthHandler) ListServiceAccountDelegations(c *fiber.Ctx) error {
+	grants, err := h.queries.Delegation.WithContext(c.Context()).ListActiveGrants(
+		c.Locals("organization_id").(string), "", c.Params("id"))
+	if err != nil {
+		h.logger.Error("Failed to list delegation grants: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list delegations")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Delegations retrieved successfully", grants)
+}
+
+// RevokeServiceAccountDelegation revokes a grant to a service account
+//
+//	@Summary		Revoke service account delegation
+//	@Description	Revokes a user's grant to the service account, e.g. when the service account is compromised. Tokens already minted from it are refused from then on.
+//	@Tags			Delegation
+//	@Produce		json
+//	@Param			id			path		string			true	"Service account ID"
+//	@Param			grant_id	path		string			true	"Delegation grant ID"
+//	@Success		200			{object}	SuccessResponse	"Delegation revoked"
+//	@Failure		404			{object}	ErrorResponse	"No active grant with this ID"
+//	@Failure		500			{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/service-accounts/{id}/delegations/{grant_id} [delete]
+func (h *AuthHandler) RevokeServiceAccountDelegation(c *fiber.Ctx) error {
+	return h.revokeDelegation(c, c.Params("grant_id"), "", c.Locals("user_id").(string))
+}
+
+func (h *AuthHandler) revokeDelegation(c *fiber.Ctx, id, userID, revokedBy string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Delegation not found")
+	}
+	grant, err := h.delegation.Revoke(c.Context(), id, c.Locals("organization_id").(string), userID, revokedBy)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Delegation not found")
+		}
+		h.logger.Error("Failed to revoke delegation %s: %v", id, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to revoke delegation")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Delegation revoked", grant)
+}
+
+// MintDelegatedToken issues a service account a token to act for a user
+//
+//	@Summary		Mint on-behalf-of token
+//	@Description	Service accounts only (X-API-Key). Issues a short-lived access token to act for a user who granted the service account a delegation. The token's subject is the user and its act claim names the service account; it is only accepted for the requests its actions allow, and the user's own permissions still apply. Every request made with it is audited as a delegated_request of the service account, and events it causes name both identities.
+//	@Tags			Delegation
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		DelegatedTokenRequest	true	"User and actions"
+//	@Success		201		{object}	SuccessResponse{data=DelegatedTokenResponse}	"Token minted"
+//	@Failure		400		{object}	ErrorResponse	"Invalid user ID"
+//	@Failure		403		{object}	ErrorResponse	"Caller is not a service account, or the user has not delegated the actions to it"
+//	@Failure		409		{object}	ErrorResponse	"User is not active"
+//	@Failure		500		{object}	ErrorResponse	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/auth/delegation/token [post]
+func (h *AuthHandler) MintDelegatedToken(c *fiber.Ctx) error {
+	if callerPrincipalType(c) != "service_account" {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only service accounts can mint delegated tokens")
+	}
+	serviceAccountID := c.Locals("user_id").(string)
+	orgID := c.Locals("organization_id").(string)
+
+	var req DelegatedTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
+	}
+	if _, err := uuid.Parse(req.UserID); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "user_id must be a UUID")
+	}
+
+	grant, actions, err := h.delegation.Authorize(c.Context(), serviceAccountID, req.UserID, orgID, req.Actions)
+	if err != nil {
+		if errors.Is(err, services.ErrDelegationNotGranted) {
+			return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "The user has not delegated these actions to this service account")
+		}
+		h.logger.Error("Failed to authorize delegation: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to mint token")
+	}
+	user, err := h.queries.Auth.GetUserByID(req.UserID, orgID)
+	if err != nil {
+		// The grant would have been deleted with the user
+		h.logger.Error("Failed to load delegating user %s: %v", req.UserID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to mint token")
+	}
+	if user.Status != "active" {
+		return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "The user is not active")
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(services.MaxDelegatedTokenLifetime)
+	if grant.ExpiresAt != nil && grant.ExpiresAt.Before(expiresAt) {
+		expiresAt = *grant.ExpiresAt
+	}
+	jti := uuid.New().String()
+	claims := h.accessClaims(user, jti, now, expiresAt)
+	claims["act"] = map[string]interface{}{"sub": serviceAccountID, "principal_type": "service_account"}
+	claims["delegation_id"] = grant.ID
+	claims["delegated_actions"] = actions
+	accessToken, err := h.keys.Sign(claims)
+	if err != nil {
+		h.logger.Error("Failed to sign delegated token: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to mint token")
+	}
+
+	if err := h.queries.Delegation.WithContext(c.Context()).TouchGrant(grant.ID, orgID); err != nil {
+		h.logger.Warn("Failed to record use of delegation grant %s: %v", grant.ID, err)
+	}
+	details, _ := json.Marshal(fiber.Map{
+		"on_behalf_of":  user.ID,
+		"delegation_id": grant.ID,
+		"actions":       actions,
+		"jti":           jti,
+		"expires_at":    expiresAt,
+	})
+	h.audit.LogEvent(c.Context(), models.AuditEvent{
+		OrganizationID:    orgID,
+		PrincipalID:       utils.StringPtr(serviceAccountID),
+		PrincipalType:     utils.StringPtr("service_account"),
+		Action:            "delegation_token_issued",
+		ResourceType:      utils.StringPtr("user"),
+		ResourceID:        utils.StringPtr(user.ID),
+		Result:            "success",
+		IPAddress:         utils.StringPtr(middleware.ClientIP(c)),
+		UserAgent:         utils.StringPtr(strings.Clone(c.Get(fiber.HeaderUserAgent))),
+		AdditionalContext: string(details),
+		Severity:          "info",
+	})
+
+	return apiSuccess(c, fiber.StatusCreated, "Token minted", DelegatedTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(expiresAt.Sub(now) / time.Second),
+		ExpiresAt:    expiresAt,
+		DelegationID: grant.ID,
+		Actions:      actions,
+	})
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/middleware"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+)
+
+// maxImpersonationReason bounds the reason recorded for an impersonation
+const maxImpersonationReason = 500
+
+// ImpersonateRequest is the body of POST /admin/impersonate/{user_id}
+type ImpersonateRequest struct {
+	// Reason is recorded on the audit events, e.g. a support ticket
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// ImpersonationResponse carries the access token of an impersonation
+// session. There is no refresh token; a new impersonation must be started
+// once it expires.
+type ImpersonationResponse struct {
+	AccessToken    string      `json:"access_token"`
+	ExpiresIn      int64       `json:"expires_in"`
+	TokenType      string      `json:"token_type"`
+	SessionID      string      `json:"session_id"`
+	ImpersonatedBy string      `json:"impersonated_by"`
+	ExpiresAt      time.Time   `json:"expires_at"`
+	User           models.User `json:"user"`
+	Role           string      `json:"role"`
+}
+
+// StartImpersonation opens a session as another user for support
+//
+//	@Summary		Impersonate a user
+//	@Description	Root users only. Issues a short-lived access token (IMPERSONATION_TTL) for the user, carrying an impersonated_by claim; responses to requests made with it carry the X-Impersonated-By header. Password, MFA and username changes are refused during impersonation. Starting and ending the session write impersonation_start and impersonation_stop audit events with the same session_id to the user's organization.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			user_id	path		string					true	"User ID"
+//	@Param			request	body		ImpersonateRequest		true	"Reason for the impersonation"
+//	@Success		201		{object}	ImpersonationResponse	"Impersonation session started"
+//	@Failure		400		{object}	ErrorResponse			"Missing reason or own user ID"
+//	@Failure		403		{object}	ErrorResponse			"Caller is not a root user, or the user is a root user"
+//	@Failure		404		{object}	ErrorResponse			"User not found"
+//	@Failure		409		{object}	ErrorResponse			"User is not active"
+//	@Failure		500		{object}	ErrorResponse			"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/admin/impersonate/{user_id} [post]
+func (h *AuthHandler) StartImpersonation(c *fiber.Ctx) error {
+	rootID := c.Locals("user_id").(string)
+	rootOrgID := c.Locals("organization_id").(string)
+	userID := c.Params("user_id")
+
+	var req ImpersonateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "reason is required")
+	}
+	if len(req.Reason) > maxImpersonationReason {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "reason must be at most 500 characters")
+	}
+	if userID == rootID {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "You cannot impersonate yourself")
+	}
+
+	user, err := h.queries.Auth.GetUserByID(userID, "")
+	if err != nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found")
+	}
+	// An impersonation token of another root user would carry root access
+	if user.OrganizationID == rootOrgID {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Root users cannot be impersonated")
+	}
+	if user.Status != "active" {
+		return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "Only active users can be impersonated")
+	}
+
+	sessionID := uuid.New().String()
+	now := time.Now()
+	expiresAt := now.Add(h.config.ImpersonationTTL)
+	claims := h.accessClaims(user, sessionID, now, expiresAt)
+	claims["impersonated_by"] = rootID
+	accessToken, err := h.keys.Sign(claims)
+	if err != nil {
+		h.logger.Error("Failed to sign impersonation token: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to start impersonation")
+	}
+
+	ipAddr := middleware.ClientIP(c)
+	userAgent := c.Get("User-Agent")
+	sessionContext, _ := json.Marshal(fiber.Map{"impersonated_by": rootID, "reason": req.Reason})
+	session := &models.Session{
+		ID:             sessionID,
+		SessionToken:   accessToken,
+		PrincipalID:    user.ID,
+		PrincipalType:  "user",
+		OrganizationID: user.OrganizationID,
+		Permissions:    "{}",
+		Context:        string(sessionContext),
+		Location:       "{}",
+		IPAddress:      &ipAddr,
+		UserAgent:      &userAgent,
+		IssuedAt:       now,
+		ExpiresAt:      expiresAt,
+		LastUsedAt:     now,
+		Status:         "active",
+	}
+	if err := h.queries.Session.CreateSession(session); err != nil {
+		h.logger.Error("Failed to create impersonation session: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to start impersonation")
+	}
+
+	// The token is only handed out once the impersonation is on record
+	imp := &services.Impersonation{
+		SessionID:      sessionID,
+		RootUserID:     rootID,
+		UserID:         user.ID,
+		OrganizationID: user.OrganizationID,
+		Reason:         req.Reason,
+		IPAddress:      ipAddr,
+		StartedAt:      now,
+		ExpiresAt:      expiresAt,
+	}
+	if err := h.impersonation.Start(c.Context(), imp, userAgent); err != nil {
+		h.logger.Error("Failed to record impersonation of user %s: %v", user.ID, err)
+		h.queries.Session.RevokeSession(sessionID, user.OrganizationID)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to start impersonation")
+	}
+	h.logger.Info("Root user %s started impersonating user %s (session %s)", rootID, user.ID, sessionID)
+
+	role, _ := claims["role"].(string)
+	return apiSuccess(c, fiber.StatusCreated, "Impersonation started", ImpersonationResponse{
+		AccessToken:    accessToken,
+		ExpiresIn:      int64(h.config.ImpersonationTTL / time.Second),
+		TokenType:      "Bearer",
+		SessionID:      sessionID,
+		ImpersonatedBy: rootID,
+		ExpiresAt:      expiresAt,
+		User:           *user,
+		Role:           role,
+	})
+}
+
+// ListImpersonations lists the open impersonation sessions
+//
+//	@Summary		List impersonations
+//	@Description	Root users only. Lists the open impersonation sessions of all root users, oldest first.
+//	@Tags			Admin
+//	@Produce		json
+//	@Success		200	{object}	SuccessResponse	"Open impersonation sessions"
+//	@Failure		403	{object}	ErrorResponse	"Caller is not a root user"
+//	@Failure		500	{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/admin/impersonations [get]
+func (h *AuthHandler) ListImpersonations(c *fiber.Ctx) error {
+	open, err := h.impersonation.List(c.Context())
+	if err != nil {
+		h.logger.Error("Failed to list impersonations: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list impersonations")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Impersonations retrieved successfully", open)
+}
+
+// StopImpersonation ends an impersonation session
+//
+//	@Summary		Stop impersonation
+//	@Description	Root users only. Revokes an impersonation session and writes its impersonation_stop audit event. The impersonation token may also end its own session with POST /auth/logout.
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			session_id	path		string			true	"Impersonation session ID"
+//	@Success		200			{object}	SuccessResponse	"Impersonation stopped"
+//	@Failure		403			{object}	ErrorResponse	"Caller is not a root user"
+//	@Failure		404			{object}	ErrorResponse	"No open impersonation with this session ID"
+//	@Failure		500			{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/admin/impersonations/{session_id} [delete]
+func (h *AuthHandler) StopImpersonation(c *fiber.Ctx) error {
+	rootID := c.Locals("user_id").(string)
+	imp, err := h.impersonation.Stop(c.Context(), c.Params("session_id"), rootID, services.ImpersonationStopped)
+	if errors.Is(err, services.ErrImpersonationNotFound) {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Impersonation not found or already ended")
+	}
+	if err != nil {
+		h.logger.Error("Failed to stop impersonation: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to stop impersonation")
+	}
+	h.logger.Info("Root user %s stopped impersonation session %s", rootID, imp.SessionID)
+	return apiSuccess(c, fiber.StatusOK, "Impersonation stopped", imp)
+}
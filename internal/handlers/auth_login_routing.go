@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/middleware"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+)
+
+const (
+	maxLoginEmailDomains   = 50
+	maxLoginSSOProviders   = 10
+	maxLoginKerberosRealms = 10
+	// minPasswordLength is the shortest password registration accepts
+	minPasswordLength = 8
+)
+
+// validateLoginPolicy checks the login routing settings of an organization
+func validateLoginPolicy(p *models.LoginPolicy) error {
+	if len(p.EmailDomains) > maxLoginEmailDomains {
+		return fmt.Errorf("at most %d email_domains are supported", maxLoginEmailDomains)
+	}
+	for _, domain := range p.EmailDomains {
+		if domain == "" || strings.ContainsAny(domain, "@ /") || !strings.Contains(domain, ".") || domain != strings.ToLower(domain) {
+			return fmt.Errorf("email_domains must be lowercase domain names: %q", domain)
+		}
+	}
+	if len(p.SSOProviders) > maxLoginSSOProviders {
+		return fmt.Errorf("at most %d sso_providers are supported", maxLoginSSOProviders)
+	}
+	for _, provider := range p.SSOProviders {
+		if strings.TrimSpace(provider.Name) == "" {
+			return fmt.Errorf("sso_providers need a name")
+		}
+		u, err := url.Parse(provider.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("sso_providers url must be an http(s) URL: %q", provider.URL)
+		}
+	}
+	if len(p.KerberosRealms) > maxLoginKerberosRealms {
+		return fmt.Errorf("at most %d kerberos_realms are supported", maxLoginKerberosRealms)
+	}
+	for _, realm := range p.KerberosRealms {
+		if realm == "" || strings.ContainsAny(realm, "@ /") || realm != strings.ToUpper(realm) {
+			return fmt.Errorf("kerberos_realms must be uppercase realm names: %q", realm)
+		}
+	}
+	return nil
+}
+
+// OrganizationLoginRoute is an organization suggested for an email address
+type OrganizationLoginRoute struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+	// LoginURL is the organization's slug-scoped login page
+	LoginURL string `json:"login_url"`
+}
+
+// DiscoverOrganizations suggests organizations to sign in to for an email
+//
+//	@Summary		Discover organizations for an email
+//	@Description	Suggests the organizations whose settings.login.email_domains claim the domain of an email address, with their slug-scoped login URLs. The answer depends on the domain alone, never on whether the address has an account, and organizations that claim no domain are never listed.
+//	@Tags			Authentication
+//	@Produce		json
+//	@Param			email	query		string										true	"Email address"
+//	@Success		200		{object}	SuccessResponse{data=[]OrganizationLoginRoute}	"Matching organizations, possibly none"
+//	@Failure		400		{object}	ErrorResponse								"Invalid email"
+//	@Failure		500		{object}	ErrorResponse								"Internal server error"
+//	@Router			/auth/orgs [get]
+func (h *AuthHandler) DiscoverOrganizations(c *fiber.Ctx) error {
+	email := strings.TrimSpace(strings.ToLower(c.Query("email")))
+	at := strings.LastIndex(email, "@")
+	if at < 1 || at == len(email)-1 {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "A valid email is required")
+	}
+
+	orgs, err := h.queries.Organization.ListOrganizationsByLoginDomain(email[at+1:])
+	if err != nil {
+		h.logger.Error("Failed to discover organizations: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to discover organizations")
+	}
+	routes := make([]OrganizationLoginRoute, 0, len(orgs))
+	for _, org := range orgs {
+		if middleware.IsInternalOrg(org.Slug) {
+			continue
+		}
+		routes = append(routes, OrganizationLoginRoute{Slug: org.Slug, Name: org.Name, LoginURL: h.loginURL(org.Slug)})
+	}
+	return apiSuccess(c, fiber.StatusOK, "Organizations retrieved", routes)
+}
+
+// loginURL returns the frontend's login page scoped to an organization
+func (h *AuthHandler) loginURL(slug string) string {
+	return h.config.FrontendURL + "/login?org=" + url.QueryEscape(slug)
+}
+
+// GetLoginOptions returns how the users of an organization sign in
+//
+//	@Summary		Get organization login options
+//	@Description	Returns what a slug-scoped login page (/login?org=acme) needs: the organization, the single sign-on providers of settings.login to offer, and its password and registration rules. Pass the slug as org to POST /auth/login to sign in to that organization.
+//	@Tags			Authentication
+//	@Produce		json
+//	@Param			org	query		string			true	"Organization slug"
+//	@Success		200	{object}	SuccessResponse	"Login options"
+//	@Failure		400	{object}	ErrorResponse	"org is required"
+//	@Failure		404	{object}	ErrorResponse	"Organization not found"
+//	@Failure		500	{object}	ErrorResponse	"Internal server error"
+//	@Router			/auth/login [get]
+func (h *AuthHandler) GetLoginOptions(c *fiber.Ctx) error {
+	slug := strings.TrimSpace(c.Query("org"))
+	if slug == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "org is required")
+	}
+	org, err := publicOrganization(h.queries.Organization, slug)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization not found")
+		}
+		h.logger.Error("Failed to get organization %s: %v", slug, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve login options")
+	}
+
+	var settings struct {
+		Login        models.LoginPolicy        `json:"login"`
+		Password     models.PasswordPolicy     `json:"password"`
+		Registration models.RegistrationPolicy `json:"registration"`
+	}
+	if err := json.Unmarshal([]byte(org.Settings), &settings); err != nil {
+		h.logger.Warn("Invalid settings of organization %s: %v", org.ID, err)
+	}
+	providers := settings.Login.SSOProviders
+	if providers == nil {
+		providers = []models.LoginProvider{}
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Login options retrieved", fiber.Map{
+		"organization":  fiber.Map{"slug": org.Slug, "name": org.Name},
+		"login_url":     h.loginURL(org.Slug),
+		"sso_providers": providers,
+		"password": fiber.Map{
+			"min_length":   minPasswordLength,
+			"breach_check": settings.Password.BreachCheck,
+		},
+		"registration": fiber.Map{
+			"invite_only":           settings.Registration.InviteOnly,
+			"allowed_email_domains": settings.Registration.AllowedEmailDomains,
+		},
+	})
+}
+
+// publicOrganization returns the organization a public URL's slug names,
+// such as that of a login page. Internal and inactive organizations are
+// reported as not found.
+func publicOrganization(orgs queries.OrganizationQueries, slug string) (*models.Organization, error) {
+	org, err := orgs.GetOrganizationBySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+	if middleware.IsInternalOrg(org.Slug) || org.Status != "active" {
+		return nil, fmt.Errorf("organization not found")
+	}
+	return org, nil
+}
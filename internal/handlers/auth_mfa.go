@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+)
+
+// MFA method names as stored in users.mfa_methods
+const (
+	mfaMethodTOTP   = "totp"
+	mfaMethodBackup = "backup"
+)
+
+// One-time passcode purposes; a code sent for one flow is not accepted by another
+const (
+	otpPurposeSetup  = "setup"
+	otpPurposeLogin  = "login"
+	otpPurposeVerify = "verify"
+)
+
+var (
+	errMFAMethodNotEnrolled = errors.New("MFA method not enrolled")
+	errInvalidMFACode       = errors.New("invalid MFA code")
+
+	e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+)
+
+// pendingMFASetup is kept in Redis under mfa_setup:<user_id> between
+// SetupMFA and the VerifyMFA call that confirms enrollment
+type pendingMFASetup struct {
+	Method string `json:"method"`
+	Secret string `json:"secret,omitempty"`
+	Phone  string `json:"phone,omitempty"`
+}
+
+// parsePendingMFASetup decodes a pending setup. Setups started before email
+// and SMS support stored the bare TOTP secret.
+func parsePendingMFASetup(raw string) pendingMFASetup {
+	var setup pendingMFASetup
+	if err := json.Unmarshal([]byte(raw), &setup); err != nil || setup.Method == "" {
+		return pendingMFASetup{Method: mfaMethodTOTP, Secret: raw}
+	}
+	return setup
+}
+
+// enrolledMFAMethods lists the user's MFA methods. Users enrolled before
+// methods were recorded have TOTP.
+func enrolledMFAMethods(user *models.User) []string {
+	if len(user.MFAMethods) > 0 {
+		return user.MFAMethods
+	}
+	if user.TOTPSecret != "" {
+		return []string{mfaMethodTOTP}
+	}
+	return nil
+}
+
+func hasMFAMethod(user *models.User, method string) bool {
+	for _, m := range enrolledMFAMethods(user) {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyMFACode checks a code for an enrolled user. An empty method means
+// the user's primary method. Backup codes are single-use.
+func (h *AuthHandler) verifyMFACode(ctx context.Context, user *models.User, purpose, method, code string) error {
+	if method == "" {
+		if methods := enrolledMFAMethods(user); len(methods) > 0 {
+			method = methods[0]
+		}
+	}
+
+	switch method {
+	case mfaMethodBackup:
+		for i, backup := range user.MFABackupCodes {
+			if subtle.ConstantTimeCompare([]byte(backup), []byte(code)) == 1 {
+				remaining := append(append([]string{}, user.MFABackupCodes[:i]...), user.MFABackupCodes[i+1:]...)
+				return h.queries.Auth.UpdateBackupCodes(user.ID, user.OrganizationID, remaining)
+			}
+		}
+		return errInvalidMFACode
+	case mfaMethodTOTP:
+		if !hasMFAMethod(user, mfaMethodTOTP) {
+			return errMFAMethodNotEnrolled
+		}
+		if !h.mfa.VerifyTOTP(code, user.TOTPSecret) {
+			return errInvalidMFACode
+		}
+		return nil
+	case services.OTPMethodEmail, services.OTPMethodSMS:
+		if !hasMFAMethod(user, method) {
+			return errMFAMethodNotEnrolled
+		}
+		return h.otp.Verify(ctx, purpose, method, user.ID, code)
+	}
+	return errMFAMethodNotEnrolled
+}
+
+// markSessionMFAVerified restarts the step-up window of the calling session
+// after a successful MFA check
+func (h *AuthHandler) markSessionMFAVerified(c *fiber.Ctx, method string) {
+	sessionID, _ := c.Locals("session_id").(string)
+	orgID, _ := c.Locals("organization_id").(string)
+	if sessionID == "" {
+		return
+	}
+	if err := h.queries.Session.MarkMFAVerified(sessionID, orgID, method); err != nil {
+		h.logger.Warn("Failed to mark session %s MFA verified: %v", sessionID, err)
+	}
+}
+
+// mfaCodeError writes the response for a failed verifyMFACode or OTP check
+func mfaCodeError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errMFAMethodNotEnrolled):
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "MFA method is not enabled for this account")
+	case errors.Is(err, services.ErrOTPTooManyAttempts):
+		return apiError(c, fiber.StatusTooManyRequests, apierror.CodeRateLimited, "Too many attempts. Request a new code.")
+	case errors.Is(err, services.ErrOTPExpired):
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidCredentials, "Code expired or not requested. Request a new code.")
+	case errors.Is(err, errInvalidMFACode), errors.Is(err, services.ErrOTPInvalid):
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid MFA code")
+	}
+	return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to verify MFA code")
+}
+
+// sendOTP delivers a one-time code to the user by email or SMS and returns
+// the masked destination
+func (h *AuthHandler) sendOTP(c *fiber.Ctx, purpose, method string, user *models.User, phone string) (string, error) {
+	to := services.OTPRecipient{UserID: user.ID, Username: user.Username, Email: user.Email, Phone: phone}
+	if err := h.otp.Send(c.Context(), purpose, method, to); err != nil {
+		return "", err
+	}
+	if method == services.OTPMethodSMS {
+		return maskPhone(phone), nil
+	}
+	return maskEmail(user.Email), nil
+}
+
+// otpSendError writes the response for a failed sendOTP
+func (h *AuthHandler) otpSendError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrOTPResendTooSoon):
+		return apiError(c, fiber.StatusTooManyRequests, apierror.CodeRateLimited, "A code was sent recently. Wait before requesting another.")
+	case errors.Is(err, services.ErrOTPMethodDisabled):
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "This MFA method is not available")
+	}
+	h.logger.Error("Failed to send MFA code: %v", err)
+	return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to send MFA code")
+}
+
+// maskEmail keeps the first character of the local part: a***@example.com
+func maskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return "***"
+	}
+	return email[:1] + "***" + email[at:]
+}
+
+// maskPhone keeps the last four digits: ***1234
+func maskPhone(phone string) string {
+	if len(phone) <= 4 {
+		return "***"
+	}
+	return "***" + phone[len(phone)-4:]
+}
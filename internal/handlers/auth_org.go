@@ -7,9 +7,11 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
 	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/password"
 	"github.com/the-monkeys/monkeys-identity/internal/queries"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
 )
 
 // RegisterOrganizationRequest defines the payload for registering a new organization
@@ -32,13 +34,22 @@ type RegisterOrganizationRequest struct {
 //	@Param			request	body		RegisterOrganizationRequest	true	"Organization registration details"
 //	@Success		201		{object}	SuccessResponse		"Organization created successfully"
 //	@Failure		400		{object}	ErrorResponse		"Invalid request format or validation error"
+//	@Failure		403		{object}	ErrorResponse		"Registration is disabled"
 //	@Failure		409		{object}	ErrorResponse		"User already exists"
 //	@Failure		500		{object}	ErrorResponse		"Internal server error"
 //	@Router			/auth/register-org [post]
 func (h *AuthHandler) RegisterOrganization(c *fiber.Ctx) error {
+	if closed, err := h.registrationClosed(c); closed {
+		return err
+	}
+
 	var req RegisterOrganizationRequest
 	if err := c.BodyParser(&req); err != nil {
-		return apiError(c, fiber.StatusBadRequest, "invalid_request", "Invalid request format")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
+	}
+	req.Email = strings.TrimSpace(strings.ToLower(req.Email))
+	if refused, err := rejectEmail(c, h.emails, req.Email); refused {
+		return err
 	}
 
 	// 1. Check if user already exists (globally by email, passed as empty orgID to check all?
@@ -49,11 +60,16 @@ func (h *AuthHandler) RegisterOrganization(c *fiber.Ctx) error {
 	// But we should check if they are trying to register an org that might clash? Or we generate ID.
 	// We generate ID, so no clash there.
 
+	// The organization does not exist yet, so the server default applies
+	if refused, err := rejectBreachedPassword(c, h.breaches, "", req.Password); refused {
+		return err
+	}
+
 	// 2. Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := password.Hash(req.Password)
 	if err != nil {
 		h.logger.Error("Failed to hash password: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to process password")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to process password")
 	}
 
 	// 3. Prepare User model (OrganizationID will be generated by CreateAdminUser logic if empty,
@@ -123,7 +139,7 @@ func (h *AuthHandler) RegisterOrganization(c *fiber.Ctx) error {
 		Email:          req.Email,
 		DisplayName:    req.DisplayName,
 		OrganizationID: newOrgID,
-		PasswordHash:   string(hashedPassword),
+		PasswordHash:   hashedPassword,
 		Status:         "active",
 		EmailVerified:  false, // Require email verification
 		CreatedAt: time.Now(),
@@ -143,11 +159,15 @@ func (h *AuthHandler) RegisterOrganization(c *fiber.Ctx) error {
 	err = h.queries.Auth.CreateAdminUser(user)
 	if err != nil {
 		if errors.Is(err, queries.ErrOrganizationNotFound) {
-			return apiError(c, fiber.StatusBadRequest, "invalid_request", "Organization could not be created")
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Organization could not be created")
 		}
 
 		h.logger.Error("Failed to create org admin: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to create organization. Please try again.")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create organization. Please try again.")
+	}
+
+	if err := services.SeedSystemRoles(h.queries.Role, user.OrganizationID); err != nil {
+		h.logger.Warn("Failed to seed system roles for organization %s: %v", user.OrganizationID, err)
 	}
 
 	// Update organization name (it was auto-generated as "Organization <ID>" in CreateAdminUser)
@@ -193,13 +213,14 @@ func (h *AuthHandler) RegisterOrganization(c *fiber.Ctx) error {
 	}
 
 	h.logger.Info("Organization registered successfully: %s", user.OrganizationID)
+	h.publishUserCreated(c, user, "organization_registration")
 
 	// Send verification email
 	verificationToken := uuid.New().String()
 	if err := h.queries.Auth.SetEmailVerificationToken(user.ID, verificationToken, 24*time.Hour); err != nil {
 		h.logger.Error("Failed to store verification token: %v", err)
 	} else {
-		if err := h.email.SendVerificationEmail(user.Email, user.Username, verificationToken); err != nil {
+		if err := h.email.SendVerificationEmail(user.OrganizationID, user.Email, user.Username, verificationToken); err != nil {
 			h.logger.Error("Failed to send verification email: %v", err)
 		}
 	}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+)
+
+// maxAllowedEmailDomains bounds settings.registration.allowed_email_domains
+const maxAllowedEmailDomains = 100
+
+// validateRegistrationPolicy checks and normalizes the allowed email domains
+func validateRegistrationPolicy(p *models.RegistrationPolicy) error {
+	if len(p.AllowedEmailDomains) > maxAllowedEmailDomains {
+		return fmt.Errorf("at most %d allowed_email_domains are supported", maxAllowedEmailDomains)
+	}
+	for i, domain := range p.AllowedEmailDomains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" || strings.ContainsAny(domain, "@ /") || !strings.Contains(domain, ".") {
+			return fmt.Errorf("%q is not a domain name", p.AllowedEmailDomains[i])
+		}
+		p.AllowedEmailDomains[i] = domain
+	}
+	return nil
+}
+
+// emailDomainAllowed reports whether the policy admits the address
+func emailDomainAllowed(p *models.RegistrationPolicy, email string) bool {
+	if len(p.AllowedEmailDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range p.AllowedEmailDomains {
+		if domain == strings.ToLower(strings.TrimSpace(allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// registrationClosed responds 403 when the global allow_registration
+// setting turns self-service signup off
+func (h *AuthHandler) registrationClosed(c *fiber.Ctx) (bool, error) {
+	if h.settings == nil || h.settings.AllowRegistration() {
+		return false, nil
+	}
+	return true, apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Registration is currently disabled")
+}
+
+// checkRegistrationPolicy applies the organization's signup restrictions to
+// a public registration. It returns a response when the registration must
+// be refused.
+func (h *AuthHandler) checkRegistrationPolicy(c *fiber.Ctx, orgID, email string) (bool, error) {
+	policy, err := h.queries.Organization.WithContext(c.UserContext()).GetRegistrationPolicy(orgID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return true, apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization not found")
+		}
+		h.logger.Error("Failed to load registration policy for org %s: %v", orgID, err)
+		return true, apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to process registration")
+	}
+	if policy == nil {
+		return false, nil
+	}
+	if policy.InviteOnly {
+		return true, apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "This organization accepts new members by invitation only")
+	}
+	if !emailDomainAllowed(policy, email) {
+		return true, apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Registration with this email domain is not allowed in this organization")
+	}
+	return false, nil
+}
+
+// rejectBreachedPassword responds 400 when a new password appears in a known
+// breach. A nil service accepts every password.
+func rejectBreachedPassword(c *fiber.Ctx, breaches services.BreachedPasswordService, orgID, password string) (bool, error) {
+	if breaches == nil {
+		return false, nil
+	}
+	if errors.Is(breaches.Check(c.UserContext(), orgID, password), services.ErrPasswordBreached) {
+		return true, apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed,
+			"This password has appeared in a data breach and cannot be used. Please choose a different password.")
+	}
+	return false, nil
+}
+
+// rejectEmail runs a new or changed address through the email validator and
+// responds 400 when it is refused. A nil validator accepts every address.
+func rejectEmail(c *fiber.Ctx, validator services.EmailValidationService, email string) (bool, error) {
+	if validator == nil {
+		return false, nil
+	}
+	err := validator.Validate(c.UserContext(), email)
+	switch {
+	case err == nil:
+		return false, nil
+	case errors.Is(err, services.ErrEmailDisposable):
+		return true, apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Disposable email addresses are not accepted")
+	case errors.Is(err, services.ErrEmailNoMailServer):
+		return true, apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "The email domain does not accept mail")
+	default:
+		return true, apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Email address is not valid")
+	}
+}
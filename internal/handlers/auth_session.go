@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/middleware"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// Bounds for per-organization token lifetime overrides
+const (
+	minTokenTTL        = time.Minute
+	maxAccessTokenTTL  = 24 * time.Hour
+	maxRefreshTokenTTL = 90 * 24 * time.Hour
+)
+
+// refreshCookiePath limits the refresh cookie to the endpoints that use
+// it, under the path prefix the browser sees them at
+func (h *AuthHandler) refreshCookiePath() string {
+	return h.config.PathPrefix() + "/api/v1/auth"
+}
+
+// issuedTokens is the result of generateTokens
+type issuedTokens struct {
+	AccessToken  string
+	RefreshToken string
+	AccessTTL    time.Duration
+	RefreshTTL   time.Duration
+}
+
+// ExpiresIn is the access token lifetime in seconds
+func (t *issuedTokens) ExpiresIn() int64 {
+	return int64(t.AccessTTL / time.Second)
+}
+
+// checkTTL parses a token lifetime setting, which must lie between
+// minTokenTTL and max; an empty value is 0
+func checkTTL(name, value string, max time.Duration) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration such as \"15m\" or \"720h\"", name)
+	}
+	if d < minTokenTTL || d > max {
+		return 0, fmt.Errorf("%s must be between %s and %s", name, minTokenTTL, max)
+	}
+	return d, nil
+}
+
+// validateTokenLifetimes checks an organization's token lifetime overrides
+func validateTokenLifetimes(l *models.TokenLifetimes) error {
+	if _, err := checkTTL("access_token_ttl", l.AccessTokenTTL, maxAccessTokenTTL); err != nil {
+		return err
+	}
+	_, err := checkTTL("refresh_token_ttl", l.RefreshTokenTTL, maxRefreshTokenTTL)
+	return err
+}
+
+// tokenLifetimes returns the access and refresh token lifetimes for an
+// organization: its settings.token_lifetimes overrides, else the server
+// defaults
+func (h *AuthHandler) tokenLifetimes(orgID string) (time.Duration, time.Duration) {
+	access, refresh := h.config.AccessTokenTTL, h.config.RefreshTokenTTL
+	if h.queries == nil || h.queries.Organization == nil || orgID == "" {
+		return access, refresh
+	}
+
+	overrides, err := h.queries.Organization.GetTokenLifetimes(orgID)
+	if err != nil {
+		h.logger.Warn("Failed to load token lifetimes for organization %s: %v", orgID, err)
+		return access, refresh
+	}
+	if overrides == nil || validateTokenLifetimes(overrides) != nil {
+		return access, refresh
+	}
+	if d, err := time.ParseDuration(overrides.AccessTokenTTL); err == nil {
+		access = d
+	}
+	if d, err := time.ParseDuration(overrides.RefreshTokenTTL); err == nil {
+		refresh = d
+	}
+	return access, refresh
+}
+
+// validateSessionPolicy checks an organization's session limits. "0"
+// keeps the server's limit.
+func validateSessionPolicy(p *models.SessionPolicy) error {
+	check := func(name, value string) error {
+		if value == "" {
+			return nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a duration such as \"30m\" or \"12h\"", name)
+		}
+		if d != 0 && (d < minTokenTTL || d > maxRefreshTokenTTL) {
+			return fmt.Errorf("%s must be between %s and %s", name, minTokenTTL, maxRefreshTokenTTL)
+		}
+		return nil
+	}
+	if err := check("idle_timeout", p.IdleTimeout); err != nil {
+		return err
+	}
+	return check("max_lifetime", p.MaxLifetime)
+}
+
+// sessionLifetime holds the limits of one session
+type sessionLifetime struct {
+	ID       string
+	Idle     time.Duration // zero without an idle timeout
+	Deadline time.Time     // zero without a maximum lifetime
+}
+
+// newSessionLifetime returns the limits of a session of orgID issued at
+// issuedAt: SESSION_IDLE_TIMEOUT and the max_session_duration global
+// setting, shortened by the organization's settings.session
+func (h *AuthHandler) newSessionLifetime(orgID, sessionID string, issuedAt time.Time) *sessionLifetime {
+	idle, maxLifetime := h.config.SessionIdleTimeout, time.Duration(0)
+	if h.settings != nil {
+		maxLifetime = h.settings.MaxSessionDuration()
+	}
+
+	if h.queries != nil && h.queries.Organization != nil && orgID != "" {
+		policy, err := h.queries.Organization.GetSessionPolicy(orgID)
+		if err != nil {
+			h.logger.Warn("Failed to load session policy for organization %s: %v", orgID, err)
+		} else if policy != nil && validateSessionPolicy(policy) == nil {
+			shorten := func(limit time.Duration, value string) time.Duration {
+				if d, err := time.ParseDuration(value); err == nil && d > 0 && (limit <= 0 || d < limit) {
+					return d
+				}
+				return limit
+			}
+			idle = shorten(idle, policy.IdleTimeout)
+			maxLifetime = shorten(maxLifetime, policy.MaxLifetime)
+		}
+	}
+
+	l := &sessionLifetime{ID: sessionID, Idle: idle}
+	if maxLifetime > 0 {
+		l.Deadline = issuedAt.Add(maxLifetime)
+	}
+	return l
+}
+
+// cap shortens an expiry to the session deadline
+func (l *sessionLifetime) cap(t time.Time) time.Time {
+	if l != nil && !l.Deadline.IsZero() && l.Deadline.Before(t) {
+		return l.Deadline
+	}
+	return t
+}
+
+// expiresAt is when the session ends if it is not used after now, given
+// when its refresh token expires
+func (l *sessionLifetime) expiresAt(now, refreshExpiry time.Time) time.Time {
+	if l.Idle > 0 && now.Add(l.Idle).Before(refreshExpiry) {
+		return l.cap(now.Add(l.Idle))
+	}
+	return l.cap(refreshExpiry)
+}
+
+// startSession stores a new session and starts enforcing its limits. Its
+// tokens carry the session ID, and RequireAuth refuses them for a session
+// that is not tracked.
+func (h *AuthHandler) startSession(session *models.Session, l *sessionLifetime) error {
+	if err := h.queries.Session.CreateSession(session); err != nil {
+		return err
+	}
+	return h.queries.Session.TrackSession(session, l.Idle, l.Deadline)
+}
+
+// cookieSession reports whether the client asked for a cookie session and the
+// server allows it. Such clients receive their tokens only as HttpOnly
+// cookies, never in the response body.
+func (h *AuthHandler) cookieSession(c *fiber.Ctx) bool {
+	return h.config.SessionCookies && strings.EqualFold(c.Get(middleware.SessionModeHeader), "cookie")
+}
+
+func (h *AuthHandler) sessionCookie(name, value, path string, expires time.Time, httpOnly bool) *fiber.Cookie {
+	return &fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Expires:  expires,
+		HTTPOnly: httpOnly,
+		Secure:   h.config.CookieSecure,
+		SameSite: h.config.CookieSameSite,
+		Path:     path,
+		Domain:   h.config.CookieDomain,
+	}
+}
+
+// setSessionCookies hands freshly issued tokens to the browser. In cookie
+// session mode the refresh token and a CSRF token are set as well; otherwise
+// only the legacy access_token cookie is set, unless cookie sessions are
+// enabled server-wide, in which case bearer clients get no cookies at all.
+// refreshToken may be empty when only the access token was renewed.
+func (h *AuthHandler) setSessionCookies(c *fiber.Ctx, tokens *issuedTokens) {
+	now := time.Now()
+	if !h.cookieSession(c) {
+		if !h.config.SessionCookies {
+			h.legacyAccessCookie(c, tokens.AccessToken, now.Add(tokens.AccessTTL))
+		}
+		return
+	}
+
+	c.Cookie(h.sessionCookie(middleware.AccessTokenCookie, tokens.AccessToken, "/", now.Add(tokens.AccessTTL), true))
+	if tokens.RefreshToken == "" {
+		return
+	}
+	c.Cookie(h.sessionCookie(middleware.RefreshTokenCookie, tokens.RefreshToken, h.refreshCookiePath(), now.Add(tokens.RefreshTTL), true))
+
+	csrf := make([]byte, 32)
+	if _, err := rand.Read(csrf); err != nil {
+		h.logger.Error("Failed to generate CSRF token: %v", err)
+		return
+	}
+	// Readable by scripts so they can echo it in the X-CSRF-Token header
+	c.Cookie(h.sessionCookie(middleware.CSRFCookie, hex.EncodeToString(csrf), "/", now.Add(tokens.RefreshTTL), false))
+}
+
+// legacyAccessCookie keeps the access_token cookie that was always set
+// before cookie sessions existed
+func (h *AuthHandler) legacyAccessCookie(c *fiber.Ctx, accessToken string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     middleware.AccessTokenCookie,
+		Value:    accessToken,
+		Expires:  expires,
+		HTTPOnly: true,
+		Secure:   h.config.Environment == "production",
+		SameSite: "Lax",
+		Path:     "/",
+		Domain:   h.config.CookieDomain,
+	})
+}
+
+// clearSessionCookies removes every session cookie
+func (h *AuthHandler) clearSessionCookies(c *fiber.Ctx) {
+	expired := time.Now().Add(-time.Hour)
+	c.Cookie(h.sessionCookie(middleware.AccessTokenCookie, "", "/", expired, true))
+	c.Cookie(h.sessionCookie(middleware.RefreshTokenCookie, "", h.refreshCookiePath(), expired, true))
+	c.Cookie(h.sessionCookie(middleware.CSRFCookie, "", "/", expired, false))
+}
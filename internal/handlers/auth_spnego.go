@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/kerberos"
+	"github.com/the-monkeys/monkeys-identity/internal/metrics"
+	"github.com/the-monkeys/monkeys-identity/internal/middleware"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+)
+
+// SetKerberos enables SPNEGO sign-in with the acceptor of the server's
+// keytab. Called from route setup.
+func (h *AuthHandler) SetKerberos(acceptor *kerberos.Acceptor) {
+	h.kerberos = acceptor
+}
+
+// spnegoReplayKey remembers an accepted authenticator for as long as a
+// replay of it could pass the clock skew check
+func spnegoReplayKey(key string) string { return "spnego:replay:" + key }
+
+// SPNEGOLogin signs a user in with the Kerberos ticket of their desktop
+//
+//	@Summary		Sign in with SPNEGO
+//	@Description	Integrated Windows / Kerberos sign-in (HTTP Negotiate, RFC 4559) for desktops joined to a realm listed in an organization's settings.login.kerberos_realms. Without an Authorization: Negotiate header the answer is 401 with WWW-Authenticate: Negotiate, upon which the browser sends a ticket for the server's HTTP service principal. The user whose current username is the principal's name signs in to the organization, as with POST /auth/login; with MFA enabled an mfa_token is returned. Names are case-sensitive, and usernames the user renamed away from do not match. org selects the organization when several accept the realm. Only Kerberos with AES keys is accepted, never NTLM, and only for organizations of the billing tiers in ENTERPRISE_AUTH_TIERS.
+//	@Tags			Authentication
+//	@Produce		json
+//	@Param			Authorization	header		string			false	"Negotiate <base64 SPNEGO token>"
+//	@Param			org				query		string			false	"Organization slug"
+//	@Param			X-Session-Mode	header		string			false	"\"cookie\" to receive the tokens as HttpOnly cookies instead of in the body (requires SESSION_COOKIES)"
+//	@Success		200				{object}	LoginResponse	"Signed in; WWW-Authenticate carries the server's answer token"
+//	@Failure		400				{object}	ErrorResponse	"Malformed token, or org is needed to choose the organization"
+//	@Failure		401				{object}	ErrorResponse	"Negotiate required, or the ticket or user was refused"
+//	@Failure		403				{object}	ErrorResponse	"Realm not accepted, not available on the plan, or account not active"
+//	@Failure		404				{object}	ErrorResponse	"SPNEGO is not enabled"
+//	@Failure		500				{object}	ErrorResponse	"Internal server error"
+//	@Router			/auth/spnego [get]
+func (h *AuthHandler) SPNEGOLogin(c *fiber.Ctx) error {
+	if h.kerberos == nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "SPNEGO sign-in is not enabled")
+	}
+
+	scheme, token, _ := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+	if !strings.EqualFold(scheme, "Negotiate") || strings.TrimSpace(token) == "" {
+		c.Set(fiber.HeaderWWWAuthenticate, "Negotiate")
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Negotiate authentication required")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(token))
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Malformed Negotiate token")
+	}
+
+	ipAddr, userAgent := middleware.ClientIP(c), c.Get("User-Agent")
+	accepted, err := h.kerberos.Accept(raw)
+	if err != nil {
+		h.logger.Warn("SPNEGO token refused: %v", err)
+		h.audit.LogLogin(c.Context(), "", "", ipAddr, userAgent, false, "kerberos_ticket_refused")
+		metrics.RecordLogin(false, "kerberos_ticket_refused")
+		if errors.Is(err, kerberos.ErrUnsupportedMechanism) {
+			return apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidCredentials, "Only Kerberos is supported; NTLM is not")
+		}
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidCredentials, "The Kerberos ticket was refused")
+	}
+
+	fresh, err := h.redis.SetNX(c.Context(), spnegoReplayKey(accepted.ReplayKey), 1, 2*kerberos.MaxClockSkew).Result()
+	if err != nil {
+		h.logger.Error("Failed to record SPNEGO authenticator: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "An internal error occurred. Please try again later.")
+	}
+	if !fresh {
+		h.logger.Warn("Replayed SPNEGO authenticator of %s", accepted.Client)
+		metrics.RecordLogin(false, "kerberos_replay")
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidCredentials, "The Kerberos authenticator was already used")
+	}
+
+	org, err := h.kerberosOrganization(c, accepted.Client.Realm)
+	if org == nil {
+		return err
+	}
+
+	// Host and service principals carry a "/"; only users sign in. The
+	// principal must be the user's current username: a name they renamed
+	// away from may belong to someone else in the directory by now.
+	userID, current := "", ""
+	if !strings.Contains(accepted.Client.Name, "/") {
+		userID, current, err = h.queries.User.ResolveUsername(accepted.Client.Name, org.ID)
+	}
+	if userID == "" || err != nil || current != accepted.Client.Name {
+		h.logger.Warn("No user for Kerberos principal %s in organization %s", accepted.Client, org.ID)
+		h.audit.LogLogin(c.Context(), org.ID, "", ipAddr, userAgent, false, "user_not_found")
+		metrics.RecordLogin(false, "user_not_found")
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidCredentials, "No account matches the Kerberos principal")
+	}
+	user, err := h.queries.Auth.GetUserByID(userID, org.ID)
+	if err != nil {
+		h.logger.Error("Failed to get user %s: %v", userID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "An internal error occurred. Please try again later.")
+	}
+	if refused, err := h.accountRefused(c, user); refused {
+		return err
+	}
+
+	// The answer token completes the negotiation
+	if len(accepted.ResponseToken) > 0 {
+		c.Set(fiber.HeaderWWWAuthenticate, "Negotiate "+base64.StdEncoding.EncodeToString(accepted.ResponseToken))
+	}
+	if user.MFAEnabled {
+		return h.challengeMFA(c, user)
+	}
+	return h.completeLogin(c, user, "kerberos")
+}
+
+// kerberosOrganization returns the organization a realm signs in to, the
+// one named by the org query parameter when several accept it. When it
+// returns nil the response is written.
+func (h *AuthHandler) kerberosOrganization(c *fiber.Ctx, realm string) (*models.Organization, error) {
+	// Realms are case-sensitive; organizations list them in uppercase, as
+	// realms are conventionally named
+	orgs, err := h.queries.Organization.ListOrganizationsByKerberosRealm(realm)
+	if err != nil {
+		h.logger.Error("Failed to list organizations of realm %s: %v", realm, err)
+		return nil, apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "An internal error occurred. Please try again later.")
+	}
+	if slug := strings.TrimSpace(c.Query("org")); slug != "" {
+		var chosen []*models.Organization
+		for _, org := range orgs {
+			if org.Slug == slug {
+				chosen = append(chosen, org)
+			}
+		}
+		orgs = chosen
+	}
+	switch {
+	case len(orgs) == 0:
+		metrics.RecordLogin(false, "kerberos_realm_not_accepted")
+		return nil, apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "No organization accepts sign-ins from the Kerberos realm "+realm)
+	case len(orgs) > 1:
+		return nil, apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Several organizations accept the Kerberos realm; choose one with org")
+	}
+	if !services.EnterpriseAuthAllowed(h.config.EnterpriseAuthTiers, orgs[0].BillingTier) {
+		return nil, apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "SPNEGO sign-in is not available on the organization's plan")
+	}
+	return orgs[0], nil
+}
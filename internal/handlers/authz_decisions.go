@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+)
+
+// ListAuthzDecisions lists sampled authorization decisions
+//
+//	@Summary	List sampled authorization decisions
+//	@Description	List the authorization decisions recorded for the caller's organization, newest first. The share of decisions recorded is set by the organization's authz_decision_sample_rate setting.
+//	@Tags		Authorization
+//	@Produce	json
+//	@Param		principal_id	query	string	false	"Principal ID"
+//	@Param		action			query	string	false	"Action"
+//	@Param		decision		query	string	false	"Decision (allow/deny)"
+//	@Param		start_time		query	string	false	"Start time (RFC3339)"
+//	@Param		end_time		query	string	false	"End time (RFC3339)"
+//	@Param		limit			query	int		false	"Limit (default: 50, max: 100)"
+//	@Param		offset			query	int		false	"Offset (default: 0)"
+//	@Success	200	{object}	SuccessResponse	"Decisions retrieved successfully"
+//	@Failure	400	{object}	ErrorResponse	"Invalid request parameters"
+//	@Failure	403	{object}	ErrorResponse	"Admin role required"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Security	BearerAuth
+//	@Router		/authz/decisions [get]
+func (h *PolicyHandler) ListAuthzDecisions(c *fiber.Ctx) error {
+	params := queries.ListAuthzDecisionsParams{
+		OrganizationID: c.Locals("organization_id").(string),
+		PrincipalID:    c.Query("principal_id"),
+		Action:         c.Query("action"),
+		Decision:       strings.ToLower(c.Query("decision")),
+		Offset:         c.QueryInt("offset", 0),
+	}
+	var err error
+	if params.StartTime, err = parseTimeQuery(c, "start_time"); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+	}
+	if params.EndTime, err = parseTimeQuery(c, "end_time"); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+	}
+	if limit := c.QueryInt("limit", 50); limit > 0 {
+		if limit > 100 {
+			limit = 100
+		}
+		params.Limit = limit
+	}
+
+	decisions, total, err := h.queries.AuthzDecision.ListDecisions(params)
+	if err != nil {
+		h.logger.Error("Failed to list authz decisions: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve decisions")
+	}
+
+	return c.JSON(fiber.Map{
+		"status": 200,
+		"data": fiber.Map{
+			"decisions":   decisions,
+			"total_count": total,
+			"limit":       params.Limit,
+			"offset":      params.Offset,
+		},
+		"message": "Decisions retrieved successfully",
+	})
+}
+
+// GetAuthzDecision retrieves one sampled authorization decision
+//
+//	@Summary	Get sampled authorization decision
+//	@Description	Retrieve a recorded authorization decision with the trace of how it was reached
+//	@Tags		Authorization
+//	@Produce	json
+//	@Param		id	path	string	true	"Decision ID"
+//	@Success	200	{object}	models.AuthzDecision	"Decision retrieved successfully"
+//	@Failure	403	{object}	ErrorResponse	"Admin role required"
+//	@Failure	404	{object}	ErrorResponse	"Decision not found"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Security	BearerAuth
+//	@Router		/authz/decisions/{id} [get]
+func (h *PolicyHandler) GetAuthzDecision(c *fiber.Ctx) error {
+	decision, err := h.queries.AuthzDecision.GetDecision(c.Params("id"), c.Locals("organization_id").(string))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Decision not found")
+		}
+		h.logger.Error("Failed to get authz decision: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve decision")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Decision retrieved successfully", decision)
+}
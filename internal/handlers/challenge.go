@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/middleware"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+// ChallengeHandler lets clients fetch a bot challenge ahead of calling an
+// endpoint guarded by middleware.RequireChallenge
+type ChallengeHandler struct {
+	challenges services.ChallengeService
+	limiter    *middleware.RateLimiter
+	always     bool
+	logger     *logger.Logger
+}
+
+func NewChallengeHandler(challenges services.ChallengeService, limiter *middleware.RateLimiter, always bool, logger *logger.Logger) *ChallengeHandler {
+	return &ChallengeHandler{challenges: challenges, limiter: limiter, always: always, logger: logger}
+}
+
+// GetChallenge
+//
+//	@Summary		Get a bot challenge
+//	@Description	Reports whether registration and password reset currently require a challenge from the caller's IP and, if so, issues one. Send the solution in the X-Challenge-Response header: the CAPTCHA widget token, or "<id>:<nonce>" for proof-of-work.
+//	@Tags			Authentication
+//	@Produce		json
+//	@Success		200	{object}	SuccessResponse	"Challenge status"
+//	@Failure		500	{object}	ErrorResponse	"Failed to issue challenge"
+//	@Router			/auth/challenge [get]
+func (h *ChallengeHandler) GetChallenge(c *fiber.Ctx) error {
+	required := h.challenges.Enabled() && (h.always || h.limiter.Suspicious(c.Context(), middleware.ClientIP(c)))
+	if !required {
+		return apiSuccess(c, fiber.StatusOK, "No challenge required", fiber.Map{"required": false})
+	}
+
+	challenge, err := h.challenges.Issue(c.Context())
+	if err != nil {
+		h.logger.Error("Failed to issue challenge: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to issue challenge")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Challenge issued", fiber.Map{"required": true, "challenge": challenge})
+}
@@ -0,0 +1,507 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/config"
+	"github.com/the-monkeys/monkeys-identity/internal/middleware"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/internal/signing"
+	"github.com/the-monkeys/monkeys-identity/internal/storage"
+)
+
+// attachmentTokenType tells signed download URLs apart from other tokens
+// signed with the same keys
+const attachmentTokenType = "attachment_download"
+
+// errAttachmentQuota aborts an upload that does not fit the quota
+var errAttachmentQuota = errors.New("attachment quota exceeded")
+
+// SetAttachments enables content attachments: files are kept in store
+// within the limits of cfg, and download URLs are signed with keys
+func (h *ContentHandler) SetAttachments(store storage.Backend, keys *signing.KeyManager, cfg *config.Config) {
+	h.store = store
+	h.keys = keys
+	h.cfg = cfg
+}
+
+// attachmentLimits are the server-wide limits narrowed by the organization
+type attachmentLimits struct {
+	maxBytes     int64
+	quotaBytes   int64 // 0 is unlimited
+	contentTypes []string
+}
+
+func (l attachmentLimits) allows(contentType string) bool {
+	for _, t := range l.contentTypes {
+		if t == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// validateAttachmentPolicy checks the attachments setting of an organization
+func validateAttachmentPolicy(p *models.AttachmentPolicy) error {
+	if p.MaxFileSizeBytes < 0 || p.MaxTotalBytes < 0 {
+		return fmt.Errorf("max_file_size_bytes and max_total_bytes must not be negative")
+	}
+	for _, t := range p.AllowedContentTypes {
+		if mediaType, params, err := mime.ParseMediaType(t); err != nil || len(params) > 0 || !strings.Contains(mediaType, "/") {
+			return fmt.Errorf("%q is not a media type such as image/png", t)
+		}
+	}
+	return nil
+}
+
+func (h *ContentHandler) attachmentLimits(c *fiber.Ctx, orgID string) (attachmentLimits, error) {
+	limits := attachmentLimits{
+		maxBytes:     h.cfg.AttachmentMaxBytes,
+		quotaBytes:   h.cfg.AttachmentOrgQuotaBytes,
+		contentTypes: h.cfg.AttachmentContentTypes,
+	}
+	policy, err := h.queries.Organization.WithContext(c.UserContext()).GetAttachmentPolicy(orgID)
+	if err != nil || policy == nil {
+		return limits, err
+	}
+	if n := policy.MaxFileSizeBytes; n > 0 && n < limits.maxBytes {
+		limits.maxBytes = n
+	}
+	if n := policy.MaxTotalBytes; n > 0 && (limits.quotaBytes == 0 || n < limits.quotaBytes) {
+		limits.quotaBytes = n
+	}
+	if len(policy.AllowedContentTypes) > 0 {
+		var narrowed []string
+		for _, t := range policy.AllowedContentTypes {
+			if t = strings.ToLower(strings.TrimSpace(t)); limits.allows(t) {
+				narrowed = append(narrowed, t)
+			}
+		}
+		limits.contentTypes = narrowed
+	}
+	return limits, nil
+}
+
+// sniffContentType detects the media type of an upload from its first bytes
+// rather than trusting the type the client declared
+func sniffContentType(head []byte) string {
+	contentType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return contentType
+}
+
+// cleanFilename keeps the base name of an uploaded file without control
+// characters or quotes, at most 255 bytes long
+func cleanFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
+
+// downloadURL signs a URL through which the attachment can be downloaded
+// without authentication until it expires
+func (h *ContentHandler) downloadURL(c *fiber.Ctx, a *models.ContentAttachment) (string, time.Time, error) {
+	expires := time.Now().Add(h.cfg.AttachmentURLTTL)
+	token, err := h.keys.Sign(jwt.MapClaims{
+		"sub":             a.ID,
+		"organization_id": a.OrganizationID,
+		"type":            attachmentTokenType,
+		"aud":             tokenAudience(attachmentTokenType),
+		"iat":             time.Now().Unix(),
+		"exp":             expires.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return h.cfg.PublicURL + "/api/v1/public/attachments/" + a.ID + "?token=" + token, expires, nil
+}
+
+// UploadAttachment stores a file attached to a content item.
+//
+//	@Summary	Upload attachment
+//	@Description	Attach a file to a content item as multipart field "file". The type is detected from the file's content and must be allowed, and the file must fit the size limit and the organization's quota. Each attachment is also created as a resource of type object so it can be shared. Collaborators only.
+//	@Tags		Content
+//	@Accept		multipart/form-data
+//	@Produce	json
+//	@Param		id		path		string	true	"Content ID"
+//	@Param		file	formData	file	true	"File to attach"
+//	@Success	201	{object}	object	"Attachment with a signed download URL"
+//	@Failure	400	{object}	object	"No file"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	404	{object}	object	"Content not found"
+//	@Failure	413	{object}	object	"File too large or quota exceeded"
+//	@Failure	415	{object}	object	"Content type not allowed"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/attachments [post]
+func (h *ContentHandler) UploadAttachment(c *fiber.Ctx) error {
+	if h.store == nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Attachments are not enabled")
+	}
+	contentID := c.Params("id")
+	userID := c.Locals("user_id").(string)
+	orgID := c.Locals("organization_id").(string)
+	ctx := c.UserContext()
+
+	role, err := h.contentRole(c, contentID)
+	if err != nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
+	}
+	if err := requireCollaborator(role); err != nil {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only collaborators can attach files")
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Multipart field file is required")
+	}
+	limits, err := h.attachmentLimits(c, orgID)
+	if err != nil {
+		h.logger.Error("load attachment policy: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to upload attachment")
+	}
+	if fh.Size > limits.maxBytes {
+		return apiError(c, fiber.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, "File is too large",
+			fiber.Map{"max_bytes": limits.maxBytes})
+	}
+
+	file, err := fh.Open()
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to read the uploaded file")
+	}
+	defer file.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to read the uploaded file")
+	}
+	contentType := sniffContentType(head[:n])
+	if !limits.allows(contentType) {
+		return apiError(c, fiber.StatusUnsupportedMediaType, apierror.CodeValidationFailed, "Files of type "+contentType+" cannot be attached",
+			fiber.Map{"allowed_content_types": limits.contentTypes})
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to read the uploaded file")
+	}
+
+	a := &models.ContentAttachment{
+		ID:             uuid.New().String(),
+		ContentID:      contentID,
+		OrganizationID: orgID,
+		Filename:       cleanFilename(fh.Filename),
+		ContentType:    contentType,
+		UploadedBy:     &userID,
+	}
+	a.StorageKey = orgID + "/" + contentID + "/" + a.ID
+	a.ARN = "arn:monkey:content::" + orgID + ":object/" + a.ID
+
+	attributes, _ := json.Marshal(map[string]string{"content_id": contentID, "filename": a.Filename})
+
+	hash := sha256.New()
+	counted := &countingReader{r: io.TeeReader(file, hash)}
+	if err := h.store.Put(ctx, a.StorageKey, counted); err != nil {
+		h.logger.Error("store attachment %s: %v", a.ID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to upload attachment")
+	}
+	a.SizeBytes = counted.n
+	a.Checksum = hex.EncodeToString(hash.Sum(nil))
+
+	var used int64
+	err = h.queries.Transact(ctx, func(q *queries.Queries) error {
+		var err error
+		if used, err = q.Content.LockAttachmentUsage(orgID); err != nil {
+			return err
+		}
+		if limits.quotaBytes > 0 && used+a.SizeBytes > limits.quotaBytes {
+			return errAttachmentQuota
+		}
+		ownerType := "user"
+		now := time.Now()
+		if err := q.Resource.CreateResource(&models.Resource{
+			ID:              a.ID,
+			ARN:             a.ARN,
+			Name:            a.Filename,
+			Type:            "object",
+			OrganizationID:  orgID,
+			OwnerID:         &userID,
+			OwnerType:       &ownerType,
+			Attributes:      string(attributes),
+			Tags:            "{}",
+			LifecyclePolicy: "{}",
+			AccessLevel:     "private",
+			ContentType:     &a.ContentType,
+			SizeBytes:       &a.SizeBytes,
+			Checksum:        &a.Checksum,
+			Status:          "active",
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		}); err != nil {
+			return err
+		}
+		return q.Content.CreateAttachment(a)
+	})
+	if err != nil {
+		if delErr := h.store.Delete(ctx, a.StorageKey); delErr != nil {
+			h.logger.Warn("remove unrecorded attachment %s: %v", a.StorageKey, delErr)
+		}
+		switch {
+		case errors.Is(err, errAttachmentQuota):
+			return apiError(c, fiber.StatusRequestEntityTooLarge, apierror.CodeQuotaExceeded, "The organization's attachment storage quota is exhausted",
+				fiber.Map{"quota_bytes": limits.quotaBytes, "used_bytes": used})
+		case isNotFoundErr(err):
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
+		}
+		h.logger.Error("record attachment: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to upload attachment")
+	}
+
+	url, expires, err := h.downloadURL(c, a)
+	if err != nil {
+		h.logger.Error("sign attachment url %s: %v", a.ID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Attachment uploaded but no download URL could be signed")
+	}
+	return apiSuccess(c, fiber.StatusCreated, "Attachment uploaded", fiber.Map{
+		"attachment":   a,
+		"download_url": url,
+		"expires_at":   expires,
+	})
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ListAttachments lists the files attached to a content item.
+//
+//	@Summary	List attachments
+//	@Description	List the files attached to a content item, oldest first. Requires read access to the content.
+//	@Tags		Content
+//	@Produce	json
+//	@Param		id	path	string	true	"Content ID"
+//	@Success	200	{object}	object	"Attachments"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	404	{object}	object	"Content not found"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/attachments [get]
+func (h *ContentHandler) ListAttachments(c *fiber.Ctx) error {
+	item, err := h.engagementTarget(c)
+	if item == nil {
+		return err
+	}
+
+	attachments, err := h.queries.Content.WithContext(c.UserContext()).ListAttachments(item.ID, item.OrganizationID)
+	if err != nil {
+		h.logger.Error("list attachments: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list attachments")
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Attachments retrieved successfully", attachments)
+}
+
+// GetAttachmentURL signs a download URL of an attachment.
+//
+//	@Summary	Get attachment download URL
+//	@Description	Sign a short-lived URL through which the attachment can be downloaded without authentication. Allowed for readers of the content and for principals the attachment's resource is shared with.
+//	@Tags		Content
+//	@Produce	json
+//	@Param		id				path	string	true	"Content ID"
+//	@Param		attachment_id	path	string	true	"Attachment ID"
+//	@Success	200	{object}	object	"Signed download URL"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	404	{object}	object	"Attachment not found"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/attachments/{attachment_id}/url [get]
+func (h *ContentHandler) GetAttachmentURL(c *fiber.Ctx) error {
+	if h.store == nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Attachments are not enabled")
+	}
+	userID := c.Locals("user_id").(string)
+	orgID := c.Locals("organization_id").(string)
+	ctx := c.UserContext()
+
+	a, err := h.queries.Content.WithContext(ctx).GetAttachment(c.Params("attachment_id"), orgID)
+	if err != nil || a.ContentID != c.Params("id") {
+		if err == nil || isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Attachment not found")
+		}
+		h.logger.Error("get attachment: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to load attachment")
+	}
+
+	shared, err := h.queries.Content.WithContext(ctx).AttachmentSharedWith(a.ID, userID, callerPrincipalType(c), orgID)
+	if err != nil {
+		h.logger.Error("check attachment shares: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to check access")
+	}
+	if !shared {
+		// Not shared directly: readers of the content may download it
+		if item, err := h.engagementTarget(c); item == nil {
+			return err
+		}
+	}
+
+	url, expires, err := h.downloadURL(c, a)
+	if err != nil {
+		h.logger.Error("sign attachment url %s: %v", a.ID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to sign download URL")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Download URL signed", fiber.Map{
+		"attachment":   a,
+		"download_url": url,
+		"expires_at":   expires,
+	})
+}
+
+// DeleteAttachment removes a file from a content item.
+//
+//	@Summary	Delete attachment
+//	@Description	Delete an attachment, its resource and the stored file. Allowed for the content owner, the uploader and org admins.
+//	@Tags		Content
+//	@Produce	json
+//	@Param		id				path	string	true	"Content ID"
+//	@Param		attachment_id	path	string	true	"Attachment ID"
+//	@Success	200	{object}	object	"Attachment deleted"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	404	{object}	object	"Attachment not found"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/attachments/{attachment_id} [delete]
+func (h *ContentHandler) DeleteAttachment(c *fiber.Ctx) error {
+	if h.store == nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Attachments are not enabled")
+	}
+	contentID := c.Params("id")
+	userID := c.Locals("user_id").(string)
+	orgID := c.Locals("organization_id").(string)
+	ctx := c.UserContext()
+
+	a, err := h.queries.Content.WithContext(ctx).GetAttachment(c.Params("attachment_id"), orgID)
+	if err != nil || a.ContentID != contentID {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Attachment not found")
+	}
+	allowed := a.UploadedBy != nil && *a.UploadedBy == userID
+	if tc := middleware.GetTenantContext(c); tc != nil && tc.CanAdminOrg(orgID) {
+		allowed = true
+	}
+	if !allowed {
+		role, err := h.contentRole(c, contentID)
+		if err != nil {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
+		}
+		allowed = requireOwner(role) == nil
+	}
+	if !allowed {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only the content owner or the uploader can delete an attachment")
+	}
+
+	key, err := h.queries.Content.WithContext(ctx).DeleteAttachment(a.ID, contentID, orgID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Attachment not found")
+		}
+		h.logger.Error("delete attachment: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to delete attachment")
+	}
+	if err := h.store.Delete(ctx, key); err != nil {
+		// The record is gone, so the file is unreachable; only space is lost
+		h.logger.Warn("remove stored attachment %s: %v", key, err)
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Attachment deleted successfully", nil)
+}
+
+// DownloadAttachment serves an attachment through a signed URL.
+//
+//	@Summary	Download attachment
+//	@Description	Download an attachment with the token of a URL signed by the upload or download URL endpoints. No other authentication is needed.
+//	@Tags		Content
+//	@Produce	octet-stream
+//	@Param		id		path	string	true	"Attachment ID"
+//	@Param		token	query	string	true	"Signed token of the download URL"
+//	@Success	200	{file}	file	"The attached file"
+//	@Failure	401	{object}	object	"Invalid or expired token"
+//	@Failure	404	{object}	object	"Attachment not found"
+//	@Router		/public/attachments/{id} [get]
+func (h *ContentHandler) DownloadAttachment(c *fiber.Ctx) error {
+	if h.store == nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Attachment not found")
+	}
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(c.Query("token"), claims, h.keys.Keyfunc)
+	if err != nil || !token.Valid {
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid or expired download link")
+	}
+	if tokenType, _ := claims["type"].(string); tokenType != attachmentTokenType || !audienceAllowed(claims, attachmentTokenType) {
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid or expired download link")
+	}
+	if sub, _ := claims["sub"].(string); sub != c.Params("id") {
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid or expired download link")
+	}
+	orgID, _ := claims["organization_id"].(string)
+	ctx := c.UserContext()
+
+	a, err := h.queries.Content.WithContext(ctx).GetAttachment(c.Params("id"), orgID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Attachment not found")
+		}
+		h.logger.Error("get attachment: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to load attachment")
+	}
+	r, err := h.store.Open(ctx, a.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Attachment not found")
+		}
+		h.logger.Error("open attachment %s: %v", a.ID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to load attachment")
+	}
+
+	disposition := "attachment"
+	if strings.HasPrefix(a.ContentType, "image/") {
+		disposition = "inline"
+	}
+	c.Set(fiber.HeaderContentType, a.ContentType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": a.Filename}))
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	c.Set(fiber.HeaderETag, `"`+a.Checksum+`"`)
+	return c.SendStream(r, int(a.SizeBytes))
+}
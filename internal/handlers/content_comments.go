@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/middleware"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+)
+
+const (
+	defaultCommentDepth   = 3
+	maxCommentDepth       = 5
+	defaultRepliesPerNode = 5
+	maxRepliesPerNode     = 50
+)
+
+// threadAccess reports whether the caller may read and comment on the thread
+// of root, and whether they moderate it. The owner of the commented content
+// and org admins moderate; published content is open to the whole
+// organization, anything else to its collaborators.
+func (h *ContentHandler) threadAccess(c *fiber.Ctx, root *models.ContentItem) (canRead, moderator bool, err error) {
+	userID := c.Locals("user_id").(string)
+	orgID := c.Locals("organization_id").(string)
+
+	if tc := middleware.GetTenantContext(c); root.OwnerID == userID || (tc != nil && tc.CanAdminOrg(orgID)) {
+		return true, true, nil
+	}
+	if root.Status == "published" {
+		return true, false, nil
+	}
+	role, err := h.queries.Content.GetCollaboratorRole(root.ID, userID, orgID)
+	return role != "", false, err
+}
+
+// createComment stores a comment on item.ParentID, which may be any content
+// the caller can read or another comment in such a thread. Comments are
+// published immediately and start approved unless the organization requires
+// approval of comments by non-moderators.
+func (h *ContentHandler) createComment(c *fiber.Ctx, item *models.ContentItem) error {
+	if item.ParentID == nil || *item.ParentID == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "parent_id is required for comments")
+	}
+	ctx := c.UserContext()
+
+	root, err := h.queries.Content.WithContext(ctx).GetThreadRoot(*item.ParentID, item.OrganizationID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Parent content not found")
+		}
+		h.logger.Error("load comment thread: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create comment")
+	}
+	canRead, moderator, err := h.threadAccess(c, root)
+	if err != nil {
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to check access")
+	}
+	if !canRead {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "You do not have access to this content")
+	}
+
+	policy, err := h.queries.Organization.WithContext(ctx).GetCommentPolicy(item.OrganizationID)
+	if err != nil {
+		h.logger.Error("load comment policy: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create comment")
+	}
+	moderation := models.CommentApproved
+	if policy != nil && policy.RequireApproval && !moderator {
+		moderation = models.CommentPending
+	}
+
+	err = h.queries.Transact(ctx, func(q *queries.Queries) error {
+		if err := q.Content.CreateComment(item, moderation); err != nil {
+			return err
+		}
+		_, err := q.Content.CreateRevision(item.ID, item.OrganizationID, item.OwnerID, nil)
+		return err
+	})
+	if err != nil {
+		h.logger.Error("create comment: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create comment")
+	}
+	if err := h.queries.Content.AddCollaborator(item.ID, item.OwnerID, "owner", item.OwnerID, item.OrganizationID, nil); err != nil {
+		h.logger.Error("add owner collaborator: %v", err)
+	}
+
+	return apiSuccess(c, fiber.StatusCreated, "Comment created successfully", &models.Comment{
+		ContentItem:      *item,
+		ModerationStatus: moderation,
+		Replies:          []*models.Comment{},
+	})
+}
+
+// ListComments returns the comment thread of a content item or the replies
+// to a comment as a tree.
+//
+//	@Summary	List comments
+//	@Description	List comments on a content item (or replies to a comment) as a tree. The top level is paginated; each comment carries up to replies_limit replies down to depth levels, with reply_count and has_more_replies telling when to page that comment's own thread. Readers see approved comments and their own; the content owner and org admins see all and may filter by moderation_status.
+//	@Tags		Content
+//	@Produce	json
+//	@Param		id					path	string	true	"Content or comment ID"
+//	@Param		limit				query	int		false	"Top-level comments per page (default 20)"
+//	@Param		cursor				query	string	false	"Opaque cursor from next_cursor of the previous page; overrides offset"
+//	@Param		offset				query	int		false	"Offset"
+//	@Param		order				query	string	false	"ASC (oldest first, default) or DESC"
+//	@Param		depth				query	int		false	"Levels of the tree to return (default 3, max 5)"
+//	@Param		replies_limit		query	int		false	"Replies returned per comment below the top level (default 5, max 50)"
+//	@Param		moderation_status	query	string	false	"Moderators only: pending, approved or hidden"
+//	@Success	200	{object}	object	"Comment tree"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	404	{object}	object	"Not found"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/comments [get]
+func (h *ContentHandler) ListComments(c *fiber.Ctx) error {
+	contentID := c.Params("id")
+	orgID := c.Locals("organization_id").(string)
+	ctx := c.UserContext()
+
+	root, err := h.queries.Content.WithContext(ctx).GetThreadRoot(contentID, orgID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
+		}
+		h.logger.Error("load comment thread: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list comments")
+	}
+	canRead, moderator, err := h.threadAccess(c, root)
+	if err != nil {
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to check access")
+	}
+	if !canRead {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "You do not have access to this content")
+	}
+
+	filter := queries.CommentFilter{ViewerID: c.Locals("user_id").(string), Moderator: moderator}
+	if status := c.Query("moderation_status"); status != "" {
+		if !moderator {
+			return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only moderators can filter by moderation_status")
+		}
+		if !validModerationStatus(status) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "moderation_status must be pending, approved or hidden")
+		}
+		filter.ModerationStatus = status
+	}
+
+	params := queries.ListParams{Limit: 20}
+	if v := c.QueryInt("limit", 20); v > 0 {
+		params.Limit = v
+	}
+	if v := c.QueryInt("offset", 0); v >= 0 {
+		params.Offset = v
+	}
+	params.Order = c.Query("order", "ASC")
+	params.Cursor = c.Query("cursor")
+	depth := clampQueryInt(c, "depth", defaultCommentDepth, maxCommentDepth)
+	perNode := clampQueryInt(c, "replies_limit", defaultRepliesPerNode, maxRepliesPerNode)
+
+	result, err := h.queries.Content.WithContext(ctx).ListComments(params, orgID, contentID, filter)
+	if err != nil {
+		if isInvalidCursorErr(err) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid pagination cursor")
+		}
+		h.logger.Error("list comments: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list comments")
+	}
+
+	// One query per level below the top: the first replies of every comment
+	// on the previous level
+	level := result.Items
+	for d := 1; d < depth && len(level) > 0; d++ {
+		byID := make(map[string]*models.Comment, len(level))
+		ids := make([]string, 0, len(level))
+		for _, cm := range level {
+			if cm.ReplyCount > 0 {
+				byID[cm.ID] = cm
+				ids = append(ids, cm.ID)
+			}
+		}
+		replies, err := h.queries.Content.WithContext(ctx).ListReplies(orgID, ids, perNode, filter)
+		if err != nil {
+			h.logger.Error("list replies: %v", err)
+			return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list comments")
+		}
+		for _, reply := range replies {
+			if parent := byID[*reply.ParentID]; parent != nil {
+				parent.Replies = append(parent.Replies, reply)
+			}
+		}
+		level = replies
+	}
+	markMoreReplies(result.Items)
+
+	return apiSuccess(c, fiber.StatusOK, "Comments retrieved successfully", result)
+}
+
+// markMoreReplies flags the comments whose replies were not all returned
+func markMoreReplies(comments []*models.Comment) {
+	for _, cm := range comments {
+		cm.HasMoreReplies = cm.ReplyCount > len(cm.Replies)
+		markMoreReplies(cm.Replies)
+	}
+}
+
+// ModerateComment approves, hides or re-queues a comment.
+//
+//	@Summary	Moderate comment
+//	@Description	Set a comment's moderation status to pending, approved or hidden. Restricted to the owner of the commented content and org admins.
+//	@Tags		Content
+//	@Accept		json
+//	@Produce	json
+//	@Param		id		path	string	true	"Comment ID"
+//	@Param		request	body	object	true	"New moderation status"
+//	@Success	200	{object}	object	"Moderation status updated"
+//	@Failure	400	{object}	object	"Invalid status or not a comment"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	404	{object}	object	"Not found"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/moderation [patch]
+func (h *ContentHandler) ModerateComment(c *fiber.Ctx) error {
+	commentID := c.Params("id")
+	orgID := c.Locals("organization_id").(string)
+
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid JSON body")
+	}
+	status := strings.ToLower(strings.TrimSpace(req.Status))
+	if !validModerationStatus(status) {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Status must be pending, approved or hidden")
+	}
+
+	root, err := h.queries.Content.WithContext(c.UserContext()).GetThreadRoot(commentID, orgID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Comment not found")
+		}
+		h.logger.Error("load comment thread: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to moderate comment")
+	}
+	if root.ID == commentID {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Only comments can be moderated")
+	}
+	if _, moderator, err := h.threadAccess(c, root); err != nil {
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to check access")
+	} else if !moderator {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only the content owner or an org admin can moderate comments")
+	}
+
+	if err := h.queries.Content.ModerateComment(commentID, orgID, status); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Comment not found")
+		}
+		h.logger.Error("moderate comment: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to moderate comment")
+	}
+	h.logger.Info("Comment %s moderated to %s by %s", commentID, status, c.Locals("user_id"))
+
+	return apiSuccess(c, fiber.StatusOK, "Comment moderation status updated to "+status, fiber.Map{"moderation_status": status})
+}
+
+func validModerationStatus(status string) bool {
+	switch status {
+	case models.CommentPending, models.CommentApproved, models.CommentHidden:
+		return true
+	}
+	return false
+}
+
+// clampQueryInt reads a positive integer query parameter, falling back to
+// def when absent or invalid and capping it at max
+func clampQueryInt(c *fiber.Ctx, name string, def, max int) int {
+	v := c.QueryInt(name, def)
+	if v <= 0 {
+		return def
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -1,14 +1,24 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/config"
 	"github.com/the-monkeys/monkeys-identity/internal/database"
+	"github.com/the-monkeys/monkeys-identity/internal/events"
 	"github.com/the-monkeys/monkeys-identity/internal/models"
 	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+	"github.com/the-monkeys/monkeys-identity/internal/signing"
+	"github.com/the-monkeys/monkeys-identity/internal/storage"
 	"github.com/the-monkeys/monkeys-identity/pkg/logger"
 )
 
@@ -17,13 +27,19 @@ import (
 // Authorization is done locally via the content_collaborators table (O(1) PK lookup)
 // rather than going through the IAM resource_shares table.
 type ContentHandler struct {
-	db      *database.DB
-	redis   *redis.Client
-	logger  *logger.Logger
-	queries *queries.Queries
+	db       *database.DB
+	redis    redis.UniversalClient
+	logger   *logger.Logger
+	queries  *queries.Queries
+	counters services.ContentCounterService
+	keys     *signing.KeyManager
+	email    services.EmailService
+	store    storage.Backend
+	cfg      *config.Config
+	events   events.Bus
 }
 
-func NewContentHandler(db *database.DB, redis *redis.Client, logger *logger.Logger) *ContentHandler {
+func NewContentHandler(db *database.DB, redis redis.UniversalClient, logger *logger.Logger) *ContentHandler {
 	return &ContentHandler{db: db, redis: redis, logger: logger, queries: queries.New(db, redis)}
 }
 
@@ -33,8 +49,10 @@ func NewContentHandler(db *database.DB, redis *redis.Client, logger *logger.Logg
 func (h *ContentHandler) contentRole(c *fiber.Ctx, contentID string) (string, error) {
 	userID := c.Locals("user_id").(string)
 
+	orgID := c.Locals("organization_id").(string)
+
 	// Fast path: check collaborator table (PK lookup)
-	role, err := h.queries.Content.GetCollaboratorRole(contentID, userID)
+	role, err := h.queries.Content.GetCollaboratorRole(contentID, userID, orgID)
 	if err != nil {
 		return "", err
 	}
@@ -43,7 +61,6 @@ func (h *ContentHandler) contentRole(c *fiber.Ctx, contentID string) (string, er
 	}
 
 	// Fallback: check if the user is the content owner (handles race before collaborator row is inserted)
-	orgID := c.Locals("organization_id").(string)
 	item, err := h.queries.Content.GetContent(contentID, orgID)
 	if err != nil {
 		return "", err
@@ -88,7 +105,7 @@ func isValidContentType(ct string) bool {
 // CreateContent creates a new content item. The caller becomes the owner.
 //
 //	@Summary	Create content
-//	@Description	Create a new content item (blog, video, tweet, comment, etc.). The authenticated user becomes the owner.
+//	@Description	Create a new content item (blog, video, tweet, comment, etc.). The authenticated user becomes the owner. Comments require parent_id and are published at once, pending approval if the organization requires it.
 //	@Tags		Content
 //	@Accept		json
 //	@Produce	json
@@ -109,10 +126,10 @@ func (h *ContentHandler) CreateContent(c *fiber.Ctx) error {
 		Metadata      string  `json:"metadata"`
 	}
 	if err := c.BodyParser(&req); err != nil {
-		return apiError(c, fiber.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid JSON body")
 	}
 	if strings.TrimSpace(req.Title) == "" {
-		return apiError(c, fiber.StatusBadRequest, "validation_error", "Title is required")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Title is required")
 	}
 
 	contentType := strings.ToLower(strings.TrimSpace(req.ContentType))
@@ -120,7 +137,7 @@ func (h *ContentHandler) CreateContent(c *fiber.Ctx) error {
 		contentType = "blog"
 	}
 	if !isValidContentType(contentType) {
-		return apiError(c, fiber.StatusBadRequest, "validation_error",
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed,
 			"Invalid content_type. Allowed: blog, video, tweet, comment, article, post")
 	}
 
@@ -142,14 +159,25 @@ func (h *ContentHandler) CreateContent(c *fiber.Ctx) error {
 		Tags:           defaultJSON(req.Tags, "[]"),
 		Metadata:       defaultJSON(req.Metadata, "{}"),
 	}
+	if contentType == "comment" {
+		return h.createComment(c, item)
+	}
 
-	if err := h.queries.Content.CreateContent(item); err != nil {
+	// The item and its first revision are written together
+	err := h.queries.Transact(c.UserContext(), func(q *queries.Queries) error {
+		if err := q.Content.CreateContent(item); err != nil {
+			return err
+		}
+		_, err := q.Content.CreateRevision(item.ID, orgID, userID, nil)
+		return err
+	})
+	if err != nil {
 		h.logger.Error("create content: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to create content")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create content")
 	}
 
 	// Auto-insert owner as collaborator so all permission checks work via PK lookup
-	if err := h.queries.Content.AddCollaborator(item.ID, userID, "owner", userID); err != nil {
+	if err := h.queries.Content.AddCollaborator(item.ID, userID, "owner", userID, orgID, nil); err != nil {
 		h.logger.Error("add owner collaborator: %v", err)
 		// Non-fatal — the fallback in contentRole() handles this
 	}
@@ -165,6 +193,7 @@ func (h *ContentHandler) CreateContent(c *fiber.Ctx) error {
 //	@Produce	json
 //	@Param		id	path	string	true	"Content ID"
 //	@Success	200	{object}	object	"Content detail"
+//	@Success	304	"Not modified"
 //	@Failure	403	{object}	object	"Forbidden"
 //	@Failure	404	{object}	object	"Not found"
 //	@Security	BearerAuth
@@ -175,17 +204,26 @@ func (h *ContentHandler) GetContent(c *fiber.Ctx) error {
 
 	item, err := h.queries.Content.GetContent(contentID, orgID)
 	if err != nil {
-		return apiError(c, fiber.StatusNotFound, "not_found", "Content not found")
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
 	}
 
 	role, err := h.contentRole(c, contentID)
 	if err != nil {
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to check access")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to check access")
 	}
 	if err := requireCollaborator(role); err != nil {
-		return apiError(c, fiber.StatusForbidden, "forbidden", "You do not have access to this content")
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "You do not have access to this content")
 	}
 
+	// Published items change rarely and may be served from the caller's
+	// cache for a minute; drafts are always revalidated
+	cacheControl := cacheRevalidate
+	if item.Status == "published" {
+		cacheControl = cachePublished
+	}
+	if notModified(c, versionETag(item.LockVersion), item.UpdatedAt, cacheControl) {
+		return nil
+	}
 	return apiSuccess(c, fiber.StatusOK, "Content retrieved successfully", fiber.Map{
 		"content": item,
 		"role":    role,
@@ -199,6 +237,7 @@ func (h *ContentHandler) GetContent(c *fiber.Ctx) error {
 //	@Tags		Content
 //	@Produce	json
 //	@Param		limit			query	int		false	"Limit"
+//	@Param		cursor			query	string		false	"Opaque cursor from next_cursor of the previous page; overrides offset"
 //	@Param		offset			query	int		false	"Offset"
 //	@Param		content_type	query	string	false	"Filter by type (blog, video, tweet, comment)"
 //	@Success	200	{object}	object	"Content list"
@@ -218,11 +257,76 @@ func (h *ContentHandler) ListContent(c *fiber.Ctx) error {
 	}
 	params.SortBy = c.Query("sort_by", "updated_at")
 	params.Order = c.Query("order", "DESC")
+	params.Cursor = c.Query("cursor")
 
 	result, err := h.queries.Content.ListContent(params, orgID, userID, contentType)
 	if err != nil {
+		if isInvalidCursorErr(err) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid pagination cursor")
+		}
 		h.logger.Error("list content: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to list content")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list content")
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Content retrieved successfully", result)
+}
+
+// ListAuthorContent returns the published content of an author addressed by
+// username. A username the author has since changed redirects to the
+// current one so existing links keep working.
+//
+//	@Summary	List an author's content
+//	@Description	List published content owned by the user with this username. Former usernames redirect (301) to the current one.
+//	@Tags		Content
+//	@Produce	json
+//	@Param		username		path	string	true	"Author username"
+//	@Param		limit			query	int		false	"Limit"
+//	@Param		cursor			query	string		false	"Opaque cursor from next_cursor of the previous page; overrides offset"
+//	@Param		offset			query	int		false	"Offset"
+//	@Param		content_type	query	string	false	"Filter by type (blog, video, tweet, comment)"
+//	@Success	200	{object}	object	"Content list"
+//	@Success	301	{object}	object	"Former username; Location names the current one"
+//	@Failure	404	{object}	object	"Author not found"
+//	@Security	BearerAuth
+//	@Router		/content/authors/{username} [get]
+func (h *ContentHandler) ListAuthorContent(c *fiber.Ctx) error {
+	orgID := c.Locals("organization_id").(string)
+	username := c.Params("username")
+
+	authorID, current, err := h.queries.User.WithContext(c.UserContext()).ResolveUsername(username, orgID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Author not found")
+		}
+		h.logger.Error("resolve username %s: %v", username, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list content")
+	}
+	if current != username {
+		location := strings.Replace(c.Route().Path, ":username", url.PathEscape(current), 1)
+		if query := c.Request().URI().QueryString(); len(query) > 0 {
+			location += "?" + string(query)
+		}
+		return c.Redirect(location, fiber.StatusMovedPermanently)
+	}
+
+	params := queries.ListParams{Limit: 20}
+	if v := c.QueryInt("limit", 20); v > 0 {
+		params.Limit = v
+	}
+	if v := c.QueryInt("offset", 0); v >= 0 {
+		params.Offset = v
+	}
+	params.SortBy = c.Query("sort_by", "updated_at")
+	params.Order = c.Query("order", "DESC")
+	params.Cursor = c.Query("cursor")
+
+	result, err := h.queries.Content.WithContext(c.UserContext()).ListPublishedByOwner(params, orgID, authorID, c.Query("content_type", ""))
+	if err != nil {
+		if isInvalidCursorErr(err) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid pagination cursor")
+		}
+		h.logger.Error("list author content: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list content")
 	}
 
 	return apiSuccess(c, fiber.StatusOK, "Content retrieved successfully", result)
@@ -231,14 +335,17 @@ func (h *ContentHandler) ListContent(c *fiber.Ctx) error {
 // UpdateContent updates a content item. Owner or co-author can edit.
 //
 //	@Summary	Update content
-//	@Description	Update content fields. Requires owner or co-author role.
+//	@Description	Update content fields. Requires owner or co-author role. Every update is recorded as a new revision, attributed to the caller. The update must name the version it is based on, as If-Match with the ETag of the item or as lock_version in the body; if the item changed since, nothing is written and 409 carries the current version.
 //	@Tags		Content
 //	@Accept		json
 //	@Produce	json
-//	@Param		id		path	string	true	"Content ID"
-//	@Param		request	body	object	true	"Updated fields"
+//	@Param		id			path	string	true	"Content ID"
+//	@Param		If-Match	header	string	false	"ETag of the version the update is based on; * for any"
+//	@Param		request		body	object	true	"Updated fields, optionally with lock_version instead of If-Match"
 //	@Success	200	{object}	object	"Content updated"
 //	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	409	{object}	object	"Content changed since that version"
+//	@Failure	428	{object}	object	"No version given"
 //	@Security	BearerAuth
 //	@Router		/content/{id} [put]
 func (h *ContentHandler) UpdateContent(c *fiber.Ctx) error {
@@ -247,10 +354,10 @@ func (h *ContentHandler) UpdateContent(c *fiber.Ctx) error {
 
 	role, err := h.contentRole(c, contentID)
 	if err != nil {
-		return apiError(c, fiber.StatusNotFound, "not_found", "Content not found")
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
 	}
 	if err := requireCollaborator(role); err != nil {
-		return apiError(c, fiber.StatusForbidden, "forbidden", "You do not have access to this content")
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "You do not have access to this content")
 	}
 
 	var req struct {
@@ -260,15 +367,25 @@ func (h *ContentHandler) UpdateContent(c *fiber.Ctx) error {
 		CoverImageURL *string `json:"cover_image_url"`
 		Tags          *string `json:"tags"`
 		Metadata      *string `json:"metadata"`
+		LockVersion   *int    `json:"lock_version"`
 	}
 	if err := c.BodyParser(&req); err != nil {
-		return apiError(c, fiber.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid JSON body")
+	}
+	version, err := requiredVersion(c, req.LockVersion)
+	if version < 0 {
+		return err
 	}
 
 	// Fetch current to merge
 	item, err := h.queries.Content.GetContent(contentID, orgID)
 	if err != nil {
-		return apiError(c, fiber.StatusNotFound, "not_found", "Content not found")
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
+	}
+	if version > 0 {
+		// Otherwise (If-Match: *) the update is still made against the
+		// version just read, so that the merge below is not lost
+		item.LockVersion = version
 	}
 
 	if req.Title != nil {
@@ -291,11 +408,18 @@ func (h *ContentHandler) UpdateContent(c *fiber.Ctx) error {
 		item.Metadata = *req.Metadata
 	}
 
-	if err := h.queries.Content.UpdateContent(item, orgID); err != nil {
+	if _, err := h.saveRevision(c, item, nil); err != nil {
+		if stale, resp := staleVersion(c, err, "Content was changed since the version this update is based on"); stale {
+			return resp
+		}
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
+		}
 		h.logger.Error("update content: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to update content")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update content")
 	}
 
+	c.Set(fiber.HeaderETag, versionETag(item.LockVersion))
 	return apiSuccess(c, fiber.StatusOK, "Content updated successfully", item)
 }
 
@@ -316,15 +440,15 @@ func (h *ContentHandler) DeleteContent(c *fiber.Ctx) error {
 
 	role, err := h.contentRole(c, contentID)
 	if err != nil {
-		return apiError(c, fiber.StatusNotFound, "not_found", "Content not found")
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
 	}
 	if err := requireOwner(role); err != nil {
-		return apiError(c, fiber.StatusForbidden, "forbidden", "Only the content owner can delete this item")
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only the content owner can delete this item")
 	}
 
 	if err := h.queries.Content.DeleteContent(contentID, orgID); err != nil {
 		h.logger.Error("delete content: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to delete content")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to delete content")
 	}
 
 	return apiSuccess(c, fiber.StatusOK, "Content deleted successfully", nil)
@@ -351,17 +475,17 @@ func (h *ContentHandler) UpdateContentStatus(c *fiber.Ctx) error {
 
 	role, err := h.contentRole(c, contentID)
 	if err != nil {
-		return apiError(c, fiber.StatusNotFound, "not_found", "Content not found")
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
 	}
 	if err := requireCollaborator(role); err != nil {
-		return apiError(c, fiber.StatusForbidden, "forbidden", "You do not have access to this content")
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "You do not have access to this content")
 	}
 
 	var req struct {
 		Status string `json:"status"`
 	}
 	if err := c.BodyParser(&req); err != nil {
-		return apiError(c, fiber.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid JSON body")
 	}
 
 	status := strings.ToLower(req.Status)
@@ -369,12 +493,15 @@ func (h *ContentHandler) UpdateContentStatus(c *fiber.Ctx) error {
 	case "draft", "published", "archived", "private", "hidden":
 		// valid
 	default:
-		return apiError(c, fiber.StatusBadRequest, "validation_error", "Status must be draft, published, archived, private, or hidden")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Status must be draft, published, archived, private, or hidden")
 	}
 
 	if err := h.queries.Content.UpdateContentStatus(contentID, orgID, status); err != nil {
 		h.logger.Error("update content status: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to update content status")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update content status")
+	}
+	if status == "published" {
+		publish(h.events, c, events.Event{Type: events.ContentPublished, Subject: contentID})
 	}
 
 	return apiSuccess(c, fiber.StatusOK, "Content status updated to "+status, fiber.Map{"status": status})
@@ -382,16 +509,19 @@ func (h *ContentHandler) UpdateContentStatus(c *fiber.Ctx) error {
 
 // ── Collaborator management ────────────────────────────────────────────
 
-// InviteCollaborator adds a co-author to a content item. OWNER ONLY.
+// InviteCollaborator adds a co-author to a content item, by user ID or by
+// email address. An address without a user in the organization gets a
+// pending invitation. OWNER ONLY.
 //
 //	@Summary	Invite co-author
-//	@Description	Add a user as co-author on a content item. Only the owner can invite.
+//	@Description	Add a user as co-author on a content item, given user_id or email. An email address without a user in the organization receives a signed invitation link and is answered with 202 and the pending invitation. A user can be added until expires_at (RFC3339); they are reminded ahead of it and lose access once it passes. Only the owner can invite.
 //	@Tags		Content
 //	@Accept		json
 //	@Produce	json
 //	@Param		id		path	string	true	"Content ID"
 //	@Param		request	body	object	true	"Collaborator details"
 //	@Success	201	{object}	object	"Collaborator added"
+//	@Success	202	{object}	object	"Invitation sent"
 //	@Failure	403	{object}	object	"Forbidden"
 //	@Security	BearerAuth
 //	@Router		/content/{id}/collaborators [post]
@@ -400,32 +530,69 @@ func (h *ContentHandler) InviteCollaborator(c *fiber.Ctx) error {
 
 	role, err := h.contentRole(c, contentID)
 	if err != nil {
-		return apiError(c, fiber.StatusNotFound, "not_found", "Content not found")
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
 	}
 	if err := requireOwner(role); err != nil {
-		return apiError(c, fiber.StatusForbidden, "forbidden", "Only the content owner can invite collaborators")
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only the content owner can invite collaborators")
 	}
 
 	var req struct {
-		UserID string `json:"user_id"`
+		UserID    string `json:"user_id"`
+		Email     string `json:"email"`
+		ExpiresAt string `json:"expires_at"`
 	}
 	if err := c.BodyParser(&req); err != nil {
-		return apiError(c, fiber.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid JSON body")
 	}
-	if req.UserID == "" {
-		return apiError(c, fiber.StatusBadRequest, "validation_error", "user_id is required")
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	if (req.UserID == "") == (req.Email == "") {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Exactly one of user_id or email is required")
+	}
+	var expiresAt *time.Time
+	if req.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "expires_at must be RFC3339")
+		}
+		if !t.After(time.Now()) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "expires_at must be in the future")
+		}
+		expiresAt = &t
+	}
+	if req.Email != "" {
+		user, err := h.queries.Auth.WithContext(c.UserContext()).GetUserByEmail(req.Email, c.Locals("organization_id").(string))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			h.logger.Error("look up invitee: %v", err)
+			return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to add collaborator")
+		}
+		if user == nil {
+			if expiresAt != nil {
+				return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "expires_at is only supported for users of the organization")
+			}
+			return h.inviteByEmail(c, contentID, req.Email)
+		}
+		req.UserID = user.ID
 	}
 
 	invitedBy := c.Locals("user_id").(string)
-	if err := h.queries.Content.AddCollaborator(contentID, req.UserID, "co-author", invitedBy); err != nil {
+	if err := h.queries.Content.AddCollaborator(contentID, req.UserID, "co-author", invitedBy, c.Locals("organization_id").(string), expiresAt); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found in this organization")
+		}
 		h.logger.Error("invite collaborator: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to add collaborator")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to add collaborator")
 	}
+	publish(h.events, c, events.Event{
+		Type:    events.CollaboratorInvited,
+		Subject: contentID,
+		Data:    map[string]interface{}{"user_id": req.UserID, "role": "co-author"},
+	})
 
 	return apiSuccess(c, fiber.StatusCreated, "Collaborator invited successfully", fiber.Map{
 		"content_id": contentID,
 		"user_id":    req.UserID,
 		"role":       "co-author",
+		"expires_at": expiresAt,
 	})
 }
 
@@ -446,27 +613,33 @@ func (h *ContentHandler) RemoveCollaborator(c *fiber.Ctx) error {
 
 	role, err := h.contentRole(c, contentID)
 	if err != nil {
-		return apiError(c, fiber.StatusNotFound, "not_found", "Content not found")
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
 	}
 	if err := requireOwner(role); err != nil {
-		return apiError(c, fiber.StatusForbidden, "forbidden", "Only the content owner can remove collaborators")
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only the content owner can remove collaborators")
 	}
 
 	targetUserID := c.Params("user_id")
-	if err := h.queries.Content.RemoveCollaborator(contentID, targetUserID); err != nil {
+	if err := h.queries.Content.RemoveCollaborator(contentID, targetUserID, c.Locals("organization_id").(string)); err != nil {
 		if strings.Contains(err.Error(), "owner") {
-			return apiError(c, fiber.StatusBadRequest, "validation_error", "Cannot remove the content owner")
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Cannot remove the content owner")
 		}
 		if isNotFoundErr(err) {
-			return apiError(c, fiber.StatusNotFound, "not_found", "Collaborator not found")
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Collaborator not found")
 		}
 		h.logger.Error("Failed to remove collaborator: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to remove collaborator")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to remove collaborator")
 	}
 
 	return apiSuccess(c, fiber.StatusOK, "Collaborator removed successfully", nil)
 }
 
+// SetEvents injects the bus content changes are published on. Called from
+// route setup.
+func (h *ContentHandler) SetEvents(bus events.Bus) {
+	h.events = bus
+}
+
 // ListCollaborators lists all collaborators on a content item.
 //
 //	@Summary	List collaborators
@@ -482,16 +655,16 @@ func (h *ContentHandler) ListCollaborators(c *fiber.Ctx) error {
 
 	role, err := h.contentRole(c, contentID)
 	if err != nil {
-		return apiError(c, fiber.StatusNotFound, "not_found", "Content not found")
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
 	}
 	if err := requireCollaborator(role); err != nil {
-		return apiError(c, fiber.StatusForbidden, "forbidden", "You do not have access to this content")
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "You do not have access to this content")
 	}
 
-	collabs, err := h.queries.Content.ListCollaborators(contentID)
+	collabs, err := h.queries.Content.ListCollaborators(contentID, c.Locals("organization_id").(string))
 	if err != nil {
 		h.logger.Error("list collaborators: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to list collaborators")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list collaborators")
 	}
 
 	return apiSuccess(c, fiber.StatusOK, "Collaborators retrieved successfully", collabs)
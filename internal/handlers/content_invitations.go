@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+	"github.com/the-monkeys/monkeys-identity/internal/signing"
+)
+
+const (
+	// collaboratorInviteTTL is how long an invitation link can be accepted
+	collaboratorInviteTTL = 7 * 24 * time.Hour
+	// invitationTokenType tells invitation links apart from other tokens
+	// signed with the same keys
+	invitationTokenType = "content_invitation"
+)
+
+// SetInvitations enables inviting collaborators by email: links are signed
+// with keys and sent with email
+func (h *ContentHandler) SetInvitations(keys *signing.KeyManager, email services.EmailService) {
+	h.keys = keys
+	h.email = email
+}
+
+// signInvitation returns the token of an invitation's accept link. It names
+// the invitation and expires with it; revocation is checked on accept.
+func (h *ContentHandler) signInvitation(inv *models.ContentInvitation) (string, error) {
+	return h.keys.Sign(jwt.MapClaims{
+		"sub":             inv.ID,
+		"organization_id": inv.OrganizationID,
+		"email":           inv.Email,
+		"type":            invitationTokenType,
+		"aud":             tokenAudience(invitationTokenType),
+		"iat":             time.Now().Unix(),
+		"exp":             inv.ExpiresAt.Unix(),
+	})
+}
+
+// inviteByEmail creates or renews a pending invitation of an address that
+// has no user in the organization and emails it the accept link
+func (h *ContentHandler) inviteByEmail(c *fiber.Ctx, contentID, email string) error {
+	if h.keys == nil || h.email == nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found in this organization")
+	}
+	if !strings.Contains(email, "@") {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Invalid email address")
+	}
+	userID := c.Locals("user_id").(string)
+	orgID := c.Locals("organization_id").(string)
+	ctx := c.UserContext()
+
+	item, err := h.queries.Content.WithContext(ctx).GetContent(contentID, orgID)
+	if err != nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
+	}
+	inv := &models.ContentInvitation{
+		ContentID:      contentID,
+		OrganizationID: orgID,
+		Email:          email,
+		Role:           "co-author",
+		InvitedBy:      &userID,
+		ExpiresAt:      time.Now().Add(collaboratorInviteTTL),
+	}
+	if err := h.queries.Content.WithContext(ctx).CreateInvitation(inv); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
+		}
+		h.logger.Error("create invitation: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to invite collaborator")
+	}
+
+	token, err := h.signInvitation(inv)
+	if err != nil {
+		h.logger.Error("sign invitation %s: %v", inv.ID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to invite collaborator")
+	}
+	inviter := userID
+	if user, err := h.queries.User.WithContext(ctx).GetUser(userID, orgID); err == nil {
+		inviter = user.Username
+		if user.DisplayName != "" {
+			inviter = user.DisplayName
+		}
+	}
+	if err := h.email.SendCollaboratorInvitationEmail(email, inviter, item.Title, token, collaboratorInviteTTL); err != nil {
+		h.logger.Error("send invitation %s: %v", inv.ID, err)
+		return apiError(c, fiber.StatusBadGateway, apierror.CodeInternal, "Invitation saved but the email could not be sent; invite again to retry")
+	}
+
+	return apiSuccess(c, fiber.StatusAccepted, "Invitation sent", inv)
+}
+
+// ListInvitations lists the pending email invitations to a content item.
+//
+//	@Summary	List pending invitations
+//	@Description	List invitations sent by email that have not been accepted or revoked. Only the owner can list them.
+//	@Tags		Content
+//	@Produce	json
+//	@Param		id	path	string	true	"Content ID"
+//	@Success	200	{object}	object	"Pending invitations"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/invitations [get]
+func (h *ContentHandler) ListInvitations(c *fiber.Ctx) error {
+	contentID := c.Params("id")
+
+	role, err := h.contentRole(c, contentID)
+	if err != nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
+	}
+	if err := requireOwner(role); err != nil {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only the content owner can list invitations")
+	}
+
+	invitations, err := h.queries.Content.WithContext(c.UserContext()).ListInvitations(contentID, c.Locals("organization_id").(string))
+	if err != nil {
+		h.logger.Error("list invitations: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list invitations")
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Invitations retrieved successfully", invitations)
+}
+
+// RevokeInvitation withdraws a pending invitation; its link stops working.
+//
+//	@Summary	Revoke invitation
+//	@Description	Revoke a pending email invitation. Only the owner can revoke.
+//	@Tags		Content
+//	@Produce	json
+//	@Param		id				path	string	true	"Content ID"
+//	@Param		invitation_id	path	string	true	"Invitation ID"
+//	@Success	200	{object}	object	"Invitation revoked"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	404	{object}	object	"No pending invitation"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/invitations/{invitation_id} [delete]
+func (h *ContentHandler) RevokeInvitation(c *fiber.Ctx) error {
+	contentID := c.Params("id")
+
+	role, err := h.contentRole(c, contentID)
+	if err != nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
+	}
+	if err := requireOwner(role); err != nil {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only the content owner can revoke invitations")
+	}
+
+	if err := h.queries.Content.WithContext(c.UserContext()).RevokeInvitation(c.Params("invitation_id"), contentID, c.Locals("organization_id").(string)); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Pending invitation not found")
+		}
+		h.logger.Error("revoke invitation: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to revoke invitation")
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Invitation revoked successfully", nil)
+}
+
+// AcceptInvitation makes the caller a co-author through an invitation link.
+//
+//	@Summary	Accept invitation
+//	@Description	Accept an email invitation to collaborate using the token of its link. The caller must be signed in with the invited email address in the inviting organization.
+//	@Tags		Content
+//	@Accept		json
+//	@Produce	json
+//	@Param		request	body	object	true	"Invitation token"
+//	@Success	200	{object}	object	"Invitation accepted"
+//	@Failure	400	{object}	object	"Invalid token"
+//	@Failure	403	{object}	object	"Invitation addressed to someone else"
+//	@Failure	404	{object}	object	"Invitation revoked, accepted or expired"
+//	@Security	BearerAuth
+//	@Router		/content/invitations/accept [post]
+func (h *ContentHandler) AcceptInvitation(c *fiber.Ctx) error {
+	if h.keys == nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Invitation not found")
+	}
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "token is required")
+	}
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(req.Token, claims, h.keys.Keyfunc)
+	if err != nil || !token.Valid {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid or expired invitation")
+	}
+	if tokenType, _ := claims["type"].(string); tokenType != invitationTokenType || !audienceAllowed(claims, invitationTokenType) {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid or expired invitation")
+	}
+	invitationID, _ := claims["sub"].(string)
+
+	userID := c.Locals("user_id").(string)
+	orgID := c.Locals("organization_id").(string)
+	ctx := c.UserContext()
+	if tokenOrg, _ := claims["organization_id"].(string); tokenOrg != orgID {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "This invitation is for another organization")
+	}
+
+	inv, err := h.queries.Content.WithContext(ctx).GetInvitation(invitationID, orgID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Invitation not found")
+		}
+		h.logger.Error("get invitation: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to accept invitation")
+	}
+	user, err := h.queries.User.WithContext(ctx).GetUser(userID, orgID)
+	if err != nil {
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to accept invitation")
+	}
+	if !strings.EqualFold(user.Email, inv.Email) {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "This invitation was sent to another email address")
+	}
+
+	contentID, err := h.queries.Content.WithContext(ctx).AcceptInvitation(inv.ID, userID, orgID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Invitation was revoked, already accepted or has expired")
+		}
+		h.logger.Error("accept invitation: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to accept invitation")
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Invitation accepted", fiber.Map{
+		"content_id": contentID,
+		"user_id":    userID,
+		"role":       inv.Role,
+	})
+}
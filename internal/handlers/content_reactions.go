@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+)
+
+// SetCounters enables live reaction and bookmark counts. Without it the
+// counts are only those last flushed into content metadata.
+func (h *ContentHandler) SetCounters(counters services.ContentCounterService) {
+	h.counters = counters
+}
+
+func validReactionType(reaction string) bool {
+	return reaction == models.ReactionLike || reaction == models.ReactionClap
+}
+
+// engagementTarget loads the content addressed by the route and responds
+// unless the caller may read it: everyone in the organization for published
+// content, collaborators otherwise. Comments follow the content they are on.
+func (h *ContentHandler) engagementTarget(c *fiber.Ctx) (*models.ContentItem, error) {
+	orgID := c.Locals("organization_id").(string)
+	ctx := c.UserContext()
+
+	item, err := h.queries.Content.WithContext(ctx).GetContent(c.Params("id"), orgID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return nil, apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
+		}
+		h.logger.Error("get content: %v", err)
+		return nil, apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to load content")
+	}
+	root := item
+	if item.ContentType == "comment" {
+		if root, err = h.queries.Content.WithContext(ctx).GetThreadRoot(item.ID, orgID); err != nil {
+			h.logger.Error("load comment thread: %v", err)
+			return nil, apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to load content")
+		}
+	}
+	canRead, _, err := h.threadAccess(c, root)
+	if err != nil {
+		return nil, apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to check access")
+	}
+	if !canRead {
+		return nil, apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "You do not have access to this content")
+	}
+	return item, nil
+}
+
+// recordChange counts a reaction or bookmark that was added or removed
+func (h *ContentHandler) recordChange(c *fiber.Ctx, contentID, counter string, delta int64) {
+	if h.counters != nil {
+		h.counters.Add(c.UserContext(), contentID, counter, delta)
+	}
+}
+
+func (h *ContentHandler) counts(c *fiber.Ctx, item *models.ContentItem) map[string]int64 {
+	if h.counters == nil {
+		return nil
+	}
+	return h.counters.Counts(c.UserContext(), item)
+}
+
+// AddReaction reacts to a content item.
+//
+//	@Summary	React to content
+//	@Description	Like or clap a content item or comment. A user reacts at most once per type; repeating a reaction is a no-op answered with 200. Requires read access.
+//	@Tags		Content
+//	@Accept		json
+//	@Produce	json
+//	@Param		id		path	string	true	"Content ID"
+//	@Param		request	body	object	true	"Reaction type: like or clap"
+//	@Success	201	{object}	object	"Reaction added, with current counts"
+//	@Success	200	{object}	object	"Already reacted"
+//	@Failure	400	{object}	object	"Invalid reaction type"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	404	{object}	object	"Not found"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/reactions [post]
+func (h *ContentHandler) AddReaction(c *fiber.Ctx) error {
+	var req struct {
+		Type string `json:"type"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid JSON body")
+	}
+	reaction := strings.ToLower(strings.TrimSpace(req.Type))
+	if !validReactionType(reaction) {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Reaction type must be like or clap")
+	}
+	item, err := h.engagementTarget(c)
+	if item == nil {
+		return err
+	}
+
+	added, err := h.queries.Content.WithContext(c.UserContext()).AddReaction(item.ID, c.Locals("user_id").(string), item.OrganizationID, reaction)
+	if err != nil {
+		h.logger.Error("add reaction: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to add reaction")
+	}
+	status, message := fiber.StatusOK, "Already reacted"
+	if added {
+		h.recordChange(c, item.ID, reaction, 1)
+		status, message = fiber.StatusCreated, "Reaction added"
+	}
+
+	return apiSuccess(c, status, message, fiber.Map{
+		"content_id": item.ID,
+		"type":       reaction,
+		"counts":     h.counts(c, item),
+	})
+}
+
+// RemoveReaction withdraws the caller's reaction.
+//
+//	@Summary	Remove reaction
+//	@Description	Withdraw the caller's reaction of the given type from a content item or comment.
+//	@Tags		Content
+//	@Produce	json
+//	@Param		id		path	string	true	"Content ID"
+//	@Param		type	path	string	true	"Reaction type: like or clap"
+//	@Success	200	{object}	object	"Reaction removed, with current counts"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	404	{object}	object	"Content or reaction not found"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/reactions/{type} [delete]
+func (h *ContentHandler) RemoveReaction(c *fiber.Ctx) error {
+	reaction := strings.ToLower(c.Params("type"))
+	if !validReactionType(reaction) {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Reaction type must be like or clap")
+	}
+	item, err := h.engagementTarget(c)
+	if item == nil {
+		return err
+	}
+
+	removed, err := h.queries.Content.WithContext(c.UserContext()).RemoveReaction(item.ID, c.Locals("user_id").(string), item.OrganizationID, reaction)
+	if err != nil {
+		h.logger.Error("remove reaction: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to remove reaction")
+	}
+	if !removed {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Reaction not found")
+	}
+	h.recordChange(c, item.ID, reaction, -1)
+
+	return apiSuccess(c, fiber.StatusOK, "Reaction removed", fiber.Map{
+		"content_id": item.ID,
+		"type":       reaction,
+		"counts":     h.counts(c, item),
+	})
+}
+
+// AddBookmark saves a content item for the caller.
+//
+//	@Summary	Bookmark content
+//	@Description	Save a content item to the caller's bookmarks. Bookmarking twice is a no-op answered with 200. Requires read access.
+//	@Tags		Content
+//	@Produce	json
+//	@Param		id	path	string	true	"Content ID"
+//	@Success	201	{object}	object	"Bookmarked"
+//	@Success	200	{object}	object	"Already bookmarked"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	404	{object}	object	"Not found"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/bookmark [post]
+func (h *ContentHandler) AddBookmark(c *fiber.Ctx) error {
+	item, err := h.engagementTarget(c)
+	if item == nil {
+		return err
+	}
+
+	added, err := h.queries.Content.WithContext(c.UserContext()).AddBookmark(item.ID, c.Locals("user_id").(string), item.OrganizationID)
+	if err != nil {
+		h.logger.Error("add bookmark: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to bookmark content")
+	}
+	status, message := fiber.StatusOK, "Already bookmarked"
+	if added {
+		h.recordChange(c, item.ID, services.CounterBookmarks, 1)
+		status, message = fiber.StatusCreated, "Content bookmarked"
+	}
+
+	return apiSuccess(c, status, message, fiber.Map{
+		"content_id": item.ID,
+		"bookmarked": true,
+		"counts":     h.counts(c, item),
+	})
+}
+
+// RemoveBookmark removes a content item from the caller's bookmarks.
+//
+//	@Summary	Remove bookmark
+//	@Description	Remove a content item from the caller's bookmarks.
+//	@Tags		Content
+//	@Produce	json
+//	@Param		id	path	string	true	"Content ID"
+//	@Success	200	{object}	object	"Bookmark removed"
+//	@Failure	404	{object}	object	"Not bookmarked"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/bookmark [delete]
+func (h *ContentHandler) RemoveBookmark(c *fiber.Ctx) error {
+	contentID := c.Params("id")
+	orgID := c.Locals("organization_id").(string)
+
+	// Unsaving needs no read access: the item may have been unpublished
+	removed, err := h.queries.Content.WithContext(c.UserContext()).RemoveBookmark(contentID, c.Locals("user_id").(string), orgID)
+	if err != nil {
+		h.logger.Error("remove bookmark: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to remove bookmark")
+	}
+	if !removed {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Bookmark not found")
+	}
+	h.recordChange(c, contentID, services.CounterBookmarks, -1)
+
+	return apiSuccess(c, fiber.StatusOK, "Bookmark removed", fiber.Map{
+		"content_id": contentID,
+		"bookmarked": false,
+	})
+}
+
+// ListMyBookmarks lists the caller's saved content.
+//
+//	@Summary	List my bookmarks
+//	@Description	List the content items the authenticated user bookmarked, most recently saved first. Items deleted or no longer readable are left out.
+//	@Tags		User Management
+//	@Produce	json
+//	@Param		limit	query	int		false	"Limit"
+//	@Param		cursor	query	string	false	"Opaque cursor from next_cursor of the previous page; overrides offset"
+//	@Param		offset	query	int		false	"Offset"
+//	@Success	200	{object}	object	"Bookmarked content"
+//	@Security	BearerAuth
+//	@Router		/users/me/bookmarks [get]
+func (h *ContentHandler) ListMyBookmarks(c *fiber.Ctx) error {
+	params := queries.ListParams{Limit: 20}
+	if v := c.QueryInt("limit", 20); v > 0 {
+		params.Limit = v
+	}
+	if v := c.QueryInt("offset", 0); v >= 0 {
+		params.Offset = v
+	}
+	params.Cursor = c.Query("cursor")
+
+	result, err := h.queries.Content.WithContext(c.UserContext()).ListBookmarks(params, c.Locals("user_id").(string), c.Locals("organization_id").(string))
+	if err != nil {
+		if isInvalidCursorErr(err) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid pagination cursor")
+		}
+		h.logger.Error("list bookmarks: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list bookmarks")
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Bookmarks retrieved successfully", result)
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+// saveRevision stores the edited item and records it as a new revision by
+// the caller in one transaction. restoredFrom names the revision a restore
+// copied.
+func (h *ContentHandler) saveRevision(c *fiber.Ctx, item *models.ContentItem, restoredFrom *int) (*models.ContentRevision, error) {
+	userID := c.Locals("user_id").(string)
+	orgID := c.Locals("organization_id").(string)
+
+	var revision *models.ContentRevision
+	err := h.queries.Transact(c.UserContext(), func(q *queries.Queries) error {
+		if err := q.Content.UpdateContent(item, orgID); err != nil {
+			return err
+		}
+		var err error
+		revision, err = q.Content.CreateRevision(item.ID, orgID, userID, restoredFrom)
+		return err
+	})
+	return revision, err
+}
+
+// requireRevisionAccess responds unless the caller collaborates on the
+// content addressed by the route
+func (h *ContentHandler) requireRevisionAccess(c *fiber.Ctx) (bool, error) {
+	role, err := h.contentRole(c, c.Params("id"))
+	if err != nil {
+		return true, apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
+	}
+	if err := requireCollaborator(role); err != nil {
+		return true, apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "You do not have access to this content")
+	}
+	return false, nil
+}
+
+// loadRevision fetches a revision of the content addressed by the route
+func (h *ContentHandler) loadRevision(c *fiber.Ctx, revision int) (*models.ContentRevision, error) {
+	r, err := h.queries.Content.WithContext(c.UserContext()).GetRevision(c.Params("id"), c.Locals("organization_id").(string), revision)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return nil, apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Revision not found")
+		}
+		h.logger.Error("get revision: %v", err)
+		return nil, apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to load revision")
+	}
+	return r, nil
+}
+
+// ListRevisions returns the revision history of a content item.
+//
+//	@Summary	List content revisions
+//	@Description	List the revisions of a content item, newest first, with the author of each. Bodies are omitted; fetch a single revision for its content. Requires collaborator access.
+//	@Tags		Content
+//	@Produce	json
+//	@Param		id		path	string	true	"Content ID"
+//	@Param		limit	query	int		false	"Limit"
+//	@Param		cursor	query	string	false	"Opaque cursor from next_cursor of the previous page; overrides offset"
+//	@Param		offset	query	int		false	"Offset"
+//	@Success	200	{object}	object	"Revision list"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	404	{object}	object	"Not found"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/revisions [get]
+func (h *ContentHandler) ListRevisions(c *fiber.Ctx) error {
+	if done, err := h.requireRevisionAccess(c); done {
+		return err
+	}
+
+	params := queries.ListParams{Limit: 20}
+	if v := c.QueryInt("limit", 20); v > 0 {
+		params.Limit = v
+	}
+	if v := c.QueryInt("offset", 0); v >= 0 {
+		params.Offset = v
+	}
+	params.Order = c.Query("order", "DESC")
+	params.Cursor = c.Query("cursor")
+
+	result, err := h.queries.Content.WithContext(c.UserContext()).ListRevisions(params, c.Params("id"), c.Locals("organization_id").(string))
+	if err != nil {
+		if isInvalidCursorErr(err) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid pagination cursor")
+		}
+		h.logger.Error("list revisions: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list revisions")
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Revisions retrieved successfully", result)
+}
+
+// GetRevision returns one revision of a content item in full.
+//
+//	@Summary	Get content revision
+//	@Description	Retrieve a revision of a content item with its body. Requires collaborator access.
+//	@Tags		Content
+//	@Produce	json
+//	@Param		id			path	string	true	"Content ID"
+//	@Param		revision	path	int		true	"Revision number"
+//	@Success	200	{object}	object	"Revision"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	404	{object}	object	"Not found"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/revisions/{revision} [get]
+func (h *ContentHandler) GetRevision(c *fiber.Ctx) error {
+	number, err := c.ParamsInt("revision")
+	if err != nil || number <= 0 {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Revision must be a positive number")
+	}
+	if done, err := h.requireRevisionAccess(c); done {
+		return err
+	}
+
+	revision, err := h.loadRevision(c, number)
+	if revision == nil {
+		return err
+	}
+	return apiSuccess(c, fiber.StatusOK, "Revision retrieved successfully", revision)
+}
+
+// DiffRevisions compares the title and body of two revisions.
+//
+//	@Summary	Diff content revisions
+//	@Description	Compare two revisions of a content item. The title is returned from both sides; the body as a line diff of equal, delete and insert chunks turning from into to. Requires collaborator access.
+//	@Tags		Content
+//	@Produce	json
+//	@Param		id		path	string	true	"Content ID"
+//	@Param		from	query	int		true	"Older revision number"
+//	@Param		to		query	int		true	"Newer revision number"
+//	@Success	200	{object}	object	"Revision diff"
+//	@Failure	400	{object}	object	"Invalid revision numbers"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	404	{object}	object	"Not found"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/revisions/diff [get]
+func (h *ContentHandler) DiffRevisions(c *fiber.Ctx) error {
+	fromNumber, toNumber := c.QueryInt("from"), c.QueryInt("to")
+	if fromNumber <= 0 || toNumber <= 0 {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "from and to must be revision numbers")
+	}
+	if done, err := h.requireRevisionAccess(c); done {
+		return err
+	}
+
+	from, err := h.loadRevision(c, fromNumber)
+	if from == nil {
+		return err
+	}
+	to, err := h.loadRevision(c, toNumber)
+	if to == nil {
+		return err
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Revisions compared successfully", fiber.Map{
+		"from": fiber.Map{"revision": from.Revision, "author_id": from.AuthorID, "author_username": from.AuthorUsername, "created_at": from.CreatedAt},
+		"to":   fiber.Map{"revision": to.Revision, "author_id": to.AuthorID, "author_username": to.AuthorUsername, "created_at": to.CreatedAt},
+		"title": fiber.Map{
+			"from":    from.Title,
+			"to":      to.Title,
+			"changed": from.Title != to.Title,
+		},
+		"body": utils.DiffLines(from.Body, to.Body),
+	})
+}
+
+// RestoreRevision makes an earlier revision the current state of a content
+// item. The restore is itself recorded as a new revision, so nothing is lost.
+//
+//	@Summary	Restore content revision
+//	@Description	Copy a revision's title, body, summary, cover image, tags and metadata back into the content item, recorded as a new revision by the caller with restored_from set. Requires owner or co-author role.
+//	@Tags		Content
+//	@Produce	json
+//	@Param		id			path	string	true	"Content ID"
+//	@Param		revision	path	int		true	"Revision number to restore"
+//	@Param		If-Match	header	string	false	"Only restore if the content is still at this version (ETag)"
+//	@Success	200	{object}	object	"Content restored"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	404	{object}	object	"Not found"
+//	@Failure	409	{object}	object	"Content changed since the If-Match version"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/revisions/{revision}/restore [post]
+func (h *ContentHandler) RestoreRevision(c *fiber.Ctx) error {
+	number, err := c.ParamsInt("revision")
+	if err != nil || number <= 0 {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Revision must be a positive number")
+	}
+	if done, err := h.requireRevisionAccess(c); done {
+		return err
+	}
+
+	source, err := h.loadRevision(c, number)
+	if source == nil {
+		return err
+	}
+	item, err := h.queries.Content.GetContent(c.Params("id"), c.Locals("organization_id").(string))
+	if err != nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
+	}
+	item.Title = source.Title
+	item.Slug = source.Slug
+	item.Body = source.Body
+	item.Summary = source.Summary
+	item.CoverImageURL = source.CoverImageURL
+	item.Tags = source.Tags
+	item.Metadata = source.Metadata
+	if c.Get(fiber.HeaderIfMatch) != "" {
+		version, err := requiredVersion(c, nil)
+		if version < 0 {
+			return err
+		}
+		if version > 0 {
+			item.LockVersion = version
+		}
+	}
+
+	revision, err := h.saveRevision(c, item, &source.Revision)
+	if err != nil {
+		if stale, resp := staleVersion(c, err, "Content was changed since the version given in If-Match"); stale {
+			return resp
+		}
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
+		}
+		h.logger.Error("restore revision: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to restore revision")
+	}
+	h.logger.Info("Content %s restored to revision %d by %s", item.ID, source.Revision, c.Locals("user_id"))
+	c.Set(fiber.HeaderETag, versionETag(item.LockVersion))
+
+	return apiSuccess(c, fiber.StatusOK, "Revision restored successfully", fiber.Map{
+		"content":  item,
+		"revision": revision,
+	})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/middleware"
+)
+
+// TransferOwnership hands a content item to another user of the
+// organization. The previous owner stays on as a co-author.
+//
+//	@Summary	Transfer content ownership
+//	@Description	Make another user of the organization the owner of a content item. Allowed for the owner and org admins. The previous owner keeps co-author access.
+//	@Tags		Content
+//	@Accept		json
+//	@Produce	json
+//	@Param		id		path	string	true	"Content ID"
+//	@Param		request	body	object	true	"New owner: {\"new_owner_id\": \"...\"}"
+//	@Success	200	{object}	object	"Ownership transferred"
+//	@Failure	400	{object}	object	"Invalid request"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	404	{object}	object	"Content or new owner not found"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/transfer [post]
+func (h *ContentHandler) TransferOwnership(c *fiber.Ctx) error {
+	contentID := c.Params("id")
+	userID := c.Locals("user_id").(string)
+	orgID := c.Locals("organization_id").(string)
+
+	var req struct {
+		NewOwnerID string `json:"new_owner_id"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid JSON body")
+	}
+	if req.NewOwnerID == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "new_owner_id is required")
+	}
+
+	item, err := h.queries.Content.WithContext(c.UserContext()).GetContent(contentID, orgID)
+	if err != nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
+	}
+	if tc := middleware.GetTenantContext(c); item.OwnerID != userID && (tc == nil || !tc.CanAdminOrg(orgID)) {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only the content owner or an org admin can transfer ownership")
+	}
+	if item.ContentType == "comment" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Comments cannot change owner")
+	}
+	if req.NewOwnerID == item.OwnerID {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "The user already owns this content")
+	}
+
+	previous, err := h.queries.Content.WithContext(c.UserContext()).TransferOwnership(contentID, req.NewOwnerID, userID, orgID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "New owner not found in this organization")
+		}
+		h.logger.Error("transfer ownership: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to transfer ownership")
+	}
+	h.logger.Info("Content %s transferred from %s to %s by %s", contentID, previous, req.NewOwnerID, userID)
+
+	return apiSuccess(c, fiber.StatusOK, "Ownership transferred successfully", fiber.Map{
+		"content_id":     contentID,
+		"owner_id":       req.NewOwnerID,
+		"previous_owner": previous,
+	})
+}
+
+// TransferUserContent hands all content owned by a user, typically one
+// leaving the organization, to another user. ADMIN ONLY.
+//
+//	@Summary	Transfer a user's content
+//	@Description	Make another user of the organization the owner of every content item the user owns, soft-deleted ones included. Comments keep their author. The previous owner keeps co-author access.
+//	@Tags		User Management
+//	@Accept		json
+//	@Produce	json
+//	@Param		id		path	string	true	"User ID of the current owner"
+//	@Param		request	body	object	true	"New owner: {\"new_owner_id\": \"...\"}"
+//	@Success	200	{object}	object	"Number of items transferred"
+//	@Failure	400	{object}	object	"Invalid request"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	404	{object}	object	"User not found"
+//	@Security	BearerAuth
+//	@Router		/users/{id}/transfer-content [post]
+func (h *ContentHandler) TransferUserContent(c *fiber.Ctx) error {
+	fromUserID := c.Params("id")
+	orgID := c.Locals("organization_id").(string)
+
+	var req struct {
+		NewOwnerID string `json:"new_owner_id"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid JSON body")
+	}
+	if req.NewOwnerID == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "new_owner_id is required")
+	}
+	if req.NewOwnerID == fromUserID {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "new_owner_id must differ from the current owner")
+	}
+	if _, err := h.queries.User.WithContext(c.UserContext()).GetUser(req.NewOwnerID, orgID); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "New owner not found in this organization")
+		}
+		h.logger.Error("get new owner: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to transfer content")
+	}
+
+	actor := c.Locals("user_id").(string)
+	n, err := h.queries.Content.WithContext(c.UserContext()).TransferAllOwnership(fromUserID, req.NewOwnerID, actor, orgID)
+	if err != nil {
+		h.logger.Error("transfer user content: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to transfer content")
+	}
+	h.logger.Info("%d content items of user %s transferred to %s by %s", n, fromUserID, req.NewOwnerID, actor)
+
+	return apiSuccess(c, fiber.StatusOK, "Content transferred successfully", fiber.Map{
+		"from_user_id": fromUserID,
+		"owner_id":     req.NewOwnerID,
+		"transferred":  n,
+	})
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+const (
+	// defaultDormantDays is how long a user of an organization without an
+	// inactivity policy must go without signing in to be listed as dormant
+	defaultDormantDays = 90
+	maxInactivityDays  = 3650
+)
+
+// validateInactivityPolicy checks an organization's inactivity policy.
+// Suspension needs the flag it counts its grace period from.
+func validateInactivityPolicy(p *models.InactivityPolicy) error {
+	if p.DormantAfterDays < 0 || p.DormantAfterDays > maxInactivityDays {
+		return fmt.Errorf("dormant_after_days must be between 0 and %d", maxInactivityDays)
+	}
+	if p.SuspendAfterDays < 0 || p.SuspendAfterDays > maxInactivityDays {
+		return fmt.Errorf("suspend_after_days must be between 0 and %d", maxInactivityDays)
+	}
+	if p.SuspendAfterDays > 0 && p.DormantAfterDays == 0 {
+		return fmt.Errorf("suspend_after_days requires dormant_after_days")
+	}
+	for _, id := range p.ExemptUserIDs {
+		if _, err := uuid.Parse(id); err != nil {
+			return fmt.Errorf("exempt_user_ids must be user IDs")
+		}
+	}
+	for _, id := range p.ExemptGroupIDs {
+		if _, err := uuid.Parse(id); err != nil {
+			return fmt.Errorf("exempt_group_ids must be group IDs")
+		}
+	}
+	return nil
+}
+
+// ListDormantUsers
+//
+//	@Summary      List dormant users
+//	@Description  List the active users of the organization who have not signed in for the given number of days, the longest inactive first. Users exempted by the organization's inactivity policy are left out. dormant_since is set once the inactivity job has flagged the user and suspend_at when the policy will suspend them.
+//	@Tags         Organization Management
+//	@Produce      json
+//	@Param        id      path   string  true   "Organization ID"
+//	@Param        days    query  int     false  "Days without sign-in (default: the policy's dormant_after_days, else 90)"
+//	@Param        limit   query  int     false  "Page size (1-200, default 50)"
+//	@Param        offset  query  int     false  "Number of users to skip (default 0)"
+//	@Success      200  {object}  SuccessResponse{data=object{items=[]models.DormantUser,total=int,days=int,limit=int,offset=int}}  "Dormant users retrieved"
+//	@Failure      400  {object}  ErrorResponse    "Invalid query parameters"
+//	@Failure      500  {object}  ErrorResponse    "Internal server error"
+//	@Security     BearerAuth
+//	@Router       /organizations/{id}/dormant-users [get]
+func (h *OrganizationHandler) ListDormantUsers(c *fiber.Ctx) error {
+	orgID := c.Params("id")
+	if orgID == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Organization ID required")
+	}
+	limit := c.QueryInt("limit", 50)
+	offset := c.QueryInt("offset", 0)
+	if limit < 1 || limit > 200 {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "limit must be 1-200")
+	}
+	if offset < 0 {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "offset must be >=0")
+	}
+
+	policy, err := h.queries.Organization.WithContext(c.Context()).GetInactivityPolicy(orgID)
+	if err != nil {
+		h.logger.Error("Get inactivity policy of organization %s failed: %v", orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list dormant users")
+	}
+	if policy == nil {
+		policy = &models.InactivityPolicy{}
+	}
+	days := policy.DormantAfterDays
+	if days == 0 {
+		days = defaultDormantDays
+	}
+	days = c.QueryInt("days", days)
+	if days < 1 || days > maxInactivityDays {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, fmt.Sprintf("days must be 1-%d", maxInactivityDays))
+	}
+
+	users, total, err := h.queries.User.WithContext(c.Context()).ListDormantUsers(orgID, time.Now().AddDate(0, 0, -days),
+		policy.ExemptUserIDs, policy.ExemptGroupIDs, limit, offset)
+	if err != nil {
+		h.logger.Error("List dormant users of organization %s failed: %v", orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list dormant users")
+	}
+	if policy.SuspendAfterDays > 0 {
+		for i := range users {
+			if users[i].DormantSince != nil {
+				suspendAt := users[i].DormantSince.AddDate(0, 0, policy.SuspendAfterDays)
+				users[i].SuspendAt = &suspendAt
+			}
+		}
+	}
+	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Dormant users retrieved", Data: fiber.Map{
+		"items": users, "total": total, "days": days, "limit": limit, "offset": offset,
+	}})
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/events"
+)
+
+// publish puts e on the bus, when one is configured, attributed to the
+// caller's organization and user unless e names them
+func publish(bus events.Bus, c *fiber.Ctx, e events.Event) {
+	if bus == nil {
+		return
+	}
+	if e.OrganizationID == "" {
+		e.OrganizationID, _ = c.Locals("organization_id").(string)
+	}
+	if e.ActorID == "" {
+		e.ActorID, _ = c.Locals("user_id").(string)
+	}
+	bus.Publish(c.UserContext(), e)
+}
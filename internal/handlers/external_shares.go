@@ -0,0 +1,435 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+)
+
+const (
+	// defaultExternalShareTTL and maxExternalShareTTL bound how long a guest
+	// keeps access; the organization can lower the maximum
+	defaultExternalShareTTL = 30 * 24 * time.Hour
+	maxExternalShareTTL     = 365 * 24 * time.Hour
+
+	// guestShareTokenType is the token emailed to a guest, and
+	// guestSessionTokenType the session it opens
+	guestShareTokenType   = "guest_share"
+	guestSessionTokenType = "guest_session"
+)
+
+// SetEmail enables sharing with guests, who are sent their link by email
+func (h *ShareLinkHandler) SetEmail(email services.EmailService) {
+	h.email = email
+}
+
+// validateExternalSharingPolicy checks an organization's external sharing
+// settings
+func validateExternalSharingPolicy(p *models.ExternalSharingPolicy) error {
+	maxDays := int(maxExternalShareTTL / (24 * time.Hour))
+	if p.MaxDays < 0 || p.MaxDays > maxDays {
+		return fmt.Errorf("max_days must be between 0 and %d", maxDays)
+	}
+	for _, domain := range p.AllowedDomains {
+		if domain == "" || strings.ContainsAny(domain, "@ ") || domain != strings.ToLower(domain) {
+			return fmt.Errorf("allowed_domains must be lowercase domain names")
+		}
+	}
+	return nil
+}
+
+// externalShareTTL returns the longest an external share of the
+// organization may last
+func externalShareTTL(p *models.ExternalSharingPolicy) time.Duration {
+	if p.MaxDays > 0 {
+		return time.Duration(p.MaxDays) * 24 * time.Hour
+	}
+	return maxExternalShareTTL
+}
+
+// guestDomainAllowed reports whether the policy lets the email address be
+// shared with
+func guestDomainAllowed(p *models.ExternalSharingPolicy, email string) bool {
+	if len(p.AllowedDomains) == 0 {
+		return true
+	}
+	domain := email[strings.LastIndex(email, "@")+1:]
+	for _, allowed := range p.AllowedDomains {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateResourceExternalShare
+//
+//	@Summary      Share resource with a guest
+//	@Description  Share the resource read-only with someone outside the organization, by email address, until expires_at (default 30 days, at most 365 or the organization's external_sharing.max_days). The organization must enable external_sharing, and allowed_domains, when set, must include the address. The guest is emailed a link that opens the resource without an account; sharing again with the same guest replaces the open share.
+//	@Tags         Resource Management
+//	@Accept       json
+//	@Produce      json
+//	@Param        id       path  string  true  "Resource ID"
+//	@Param        request  body  object{email=string,access_level=string,expires_at=string}  true  "Guest and options"
+//	@Success      201  {object}  SuccessResponse{data=models.ExternalShare}  "Shared with guest"
+//	@Failure      400  {object}  ErrorResponse  "Invalid options"
+//	@Failure      403  {object}  ErrorResponse  "External sharing disabled, or domain not allowed"
+//	@Failure      404  {object}  ErrorResponse  "Resource not found"
+//	@Failure      409  {object}  ErrorResponse  "The address belongs to a member of the organization"
+//	@Failure      502  {object}  ErrorResponse  "Share saved but the email could not be sent"
+//	@Security     BearerAuth
+//	@Router       /resources/{id}/external-shares [post]
+func (h *ShareLinkHandler) CreateResourceExternalShare(c *fiber.Ctx) error {
+	resource, err := h.queries.Resource.WithContext(c.Context()).GetResource(c.Params("id"), c.Locals("organization_id").(string))
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Resource not found")
+		}
+		h.logger.Error("get resource for external share: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to share resource")
+	}
+	return h.createExternal(c, queries.AccessLogResource, resource.ID, resource.Name)
+}
+
+// CreateContentExternalShare
+//
+//	@Summary	Share content with a guest
+//	@Description	Share the content item, read-only or writable, with someone outside the organization, by email address, until expires_at (default 30 days, at most 365 or the organization's external_sharing.max_days). The organization must enable external_sharing, and allowed_domains, when set, must include the address. The guest is emailed a link that opens the item without an account; their edits are recorded as revisions by the owner. Owner only.
+//	@Tags		Content
+//	@Accept		json
+//	@Produce	json
+//	@Param		id		path	string	true	"Content ID"
+//	@Param		request	body	object{email=string,access_level=string,expires_at=string}	true	"Guest and options"
+//	@Success	201	{object}	object	"Shared with guest"
+//	@Failure	400	{object}	object	"Invalid options"
+//	@Failure	403	{object}	object	"Forbidden, external sharing disabled or domain not allowed"
+//	@Failure	409	{object}	object	"The address belongs to a member of the organization"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/external-shares [post]
+func (h *ShareLinkHandler) CreateContentExternalShare(c *fiber.Ctx) error {
+	item, responded, err := h.contentOwned(c)
+	if responded {
+		return err
+	}
+	return h.createExternal(c, queries.AccessLogContent, item.ID, item.Title)
+}
+
+func (h *ShareLinkHandler) createExternal(c *fiber.Ctx, resourceType, resourceID, itemName string) error {
+	if h.email == nil {
+		return apiError(c, fiber.StatusServiceUnavailable, apierror.CodeServiceUnavailable, "Sharing with guests is not available")
+	}
+	var req struct {
+		Email       string `json:"email"`
+		AccessLevel string `json:"access_level"`
+		ExpiresAt   string `json:"expires_at"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
+	}
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	if !strings.Contains(req.Email, "@") {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "A valid email address is required")
+	}
+	if req.AccessLevel == "" {
+		req.AccessLevel = "read"
+	}
+	switch {
+	case req.AccessLevel != "read" && req.AccessLevel != "write":
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "access_level must be read or write")
+	case req.AccessLevel == "write" && resourceType != queries.AccessLogContent:
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Resources can only be shared read-only with guests")
+	}
+
+	orgID := c.Locals("organization_id").(string)
+	userID := c.Locals("user_id").(string)
+	ctx := c.UserContext()
+	policy, err := h.queries.Organization.WithContext(ctx).GetExternalSharingPolicy(orgID)
+	if err != nil {
+		h.logger.Error("get external sharing policy of organization %s: %v", orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to share with guest")
+	}
+	if policy == nil || !policy.Enabled {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "External sharing is disabled for this organization")
+	}
+	if !guestDomainAllowed(policy, req.Email) {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "The organization does not allow sharing with this email domain")
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(defaultExternalShareTTL)
+	if req.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "expires_at must be RFC3339")
+		}
+		expiresAt = t
+	}
+	if maxTTL := externalShareTTL(policy); expiresAt.Sub(now) > maxTTL {
+		if req.ExpiresAt != "" {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed,
+				"expires_at must be within "+strconv.Itoa(int(maxTTL/(24*time.Hour)))+" days")
+		}
+		expiresAt = now.Add(maxTTL)
+	}
+	if !expiresAt.After(now) {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "expires_at must be in the future")
+	}
+
+	if member, err := h.queries.Auth.WithContext(ctx).GetUserByEmail(req.Email, orgID); err == nil && member != nil {
+		return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "This address belongs to a member of the organization; share with them directly")
+	}
+
+	guest, err := h.queries.Resource.WithContext(ctx).UpsertGuestPrincipal(orgID, req.Email, userID)
+	if err != nil {
+		h.logger.Error("create guest %s: %v", req.Email, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to share with guest")
+	}
+	share := &models.ExternalShare{
+		OrganizationID: orgID,
+		GuestID:        guest.ID,
+		GuestEmail:     guest.Email,
+		ResourceType:   resourceType,
+		ResourceID:     resourceID,
+		AccessLevel:    req.AccessLevel,
+		SharedBy:       &userID,
+		ExpiresAt:      expiresAt,
+	}
+	if err := h.queries.Resource.WithContext(ctx).CreateExternalShare(share); err != nil {
+		h.logger.Error("create external share: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to share with guest")
+	}
+
+	token, err := h.keys.Sign(jwt.MapClaims{
+		"sub":             share.ID,
+		"organization_id": orgID,
+		"type":            guestShareTokenType,
+		"aud":             tokenAudience(guestShareTokenType),
+		"iat":             now.Unix(),
+		"exp":             expiresAt.Unix(),
+	})
+	if err != nil {
+		h.logger.Error("sign external share %s: %v", share.ID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to share with guest")
+	}
+	sharer := userID
+	if user, err := h.queries.User.WithContext(ctx).GetUser(userID, orgID); err == nil {
+		sharer = user.Username
+		if user.DisplayName != "" {
+			sharer = user.DisplayName
+		}
+	}
+	if err := h.email.SendGuestShareEmail(req.Email, sharer, itemName, token, expiresAt); err != nil {
+		h.logger.Error("send external share %s: %v", share.ID, err)
+		return apiError(c, fiber.StatusBadGateway, apierror.CodeUpstreamError, "Share saved but the email could not be sent; share again to retry")
+	}
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{Status: fiber.StatusCreated, Message: "Shared with guest", Data: share})
+}
+
+// ListResourceExternalShares
+//
+//	@Summary      List resource guest shares
+//	@Description  List the shares of the resource with guests outside the organization, including revoked and expired ones unless active=true
+//	@Tags         Resource Management
+//	@Produce      json
+//	@Param        id      path   string  true   "Resource ID"
+//	@Param        active  query  bool    false  "Only shares in effect (true) or revoked and expired ones (false)"
+//	@Param        limit   query  int     false  "Limit (default 50, max 100)"
+//	@Param        cursor  query  string  false  "Opaque cursor from next_cursor of the previous page"
+//	@Success      200  {object}  SuccessResponse{data=queries.ListResult[models.ExternalShare]}  "Guest shares retrieved"
+//	@Failure      400  {object}  ErrorResponse  "Invalid filter"
+//	@Failure      500  {object}  ErrorResponse  "Internal server error"
+//	@Security     BearerAuth
+//	@Router       /resources/{id}/external-shares [get]
+func (h *ShareLinkHandler) ListResourceExternalShares(c *fiber.Ctx) error {
+	return h.listExternal(c, c.Locals("organization_id").(string), queries.AccessLogResource, c.Params("id"))
+}
+
+// ListContentExternalShares
+//
+//	@Summary	List content guest shares
+//	@Description	List the shares of the content item with guests outside the organization, including revoked and expired ones unless active=true. Owner only.
+//	@Tags		Content
+//	@Produce	json
+//	@Param		id		path	string	true	"Content ID"
+//	@Param		active	query	bool	false	"Only shares in effect (true) or revoked and expired ones (false)"
+//	@Success	200	{object}	object	"Guest shares"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/external-shares [get]
+func (h *ShareLinkHandler) ListContentExternalShares(c *fiber.Ctx) error {
+	if responded, err := h.requireContentOwner(c); responded {
+		return err
+	}
+	return h.listExternal(c, c.Locals("organization_id").(string), queries.AccessLogContent, c.Params("id"))
+}
+
+// ListExternalShares
+//
+//	@Summary      List external shares
+//	@Description  List every share of the organization's resources and content with guests outside it, newest first, for review. Organization admins only.
+//	@Tags         Organization Management
+//	@Produce      json
+//	@Param        id             path   string  true   "Organization ID"
+//	@Param        resource_type  query  string  false  "resource or content"
+//	@Param        resource_id    query  string  false  "Only shares of this item"
+//	@Param        email          query  string  false  "Only shares with this guest"
+//	@Param        active         query  bool    false  "Only shares in effect (true) or revoked and expired ones (false)"
+//	@Param        limit          query  int     false  "Limit (default 50, max 100)"
+//	@Param        cursor         query  string  false  "Opaque cursor from next_cursor of the previous page"
+//	@Success      200  {object}  SuccessResponse{data=queries.ListResult[models.ExternalShare]}  "External shares retrieved"
+//	@Failure      400  {object}  ErrorResponse  "Invalid filter"
+//	@Failure      500  {object}  ErrorResponse  "Internal server error"
+//	@Security     BearerAuth
+//	@Router       /organizations/{id}/external-shares [get]
+func (h *ShareLinkHandler) ListExternalShares(c *fiber.Ctx) error {
+	resourceType := c.Query("resource_type")
+	if resourceType != "" && resourceType != queries.AccessLogResource && resourceType != queries.AccessLogContent {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "resource_type must be resource or content")
+	}
+	return h.listExternal(c, c.Params("id"), resourceType, c.Query("resource_id"))
+}
+
+func (h *ShareLinkHandler) listExternal(c *fiber.Ctx, orgID, resourceType, resourceID string) error {
+	filter := queries.ExternalShareFilter{
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		GuestEmail:   strings.TrimSpace(c.Query("email")),
+	}
+	if v := c.Query("active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "active must be true or false")
+		}
+		filter.Active = &active
+	}
+	params := queries.ListParams{Limit: 50, SortBy: "created_at", Order: "DESC", Cursor: c.Query("cursor")}
+	if l := c.QueryInt("limit", 50); l > 0 && l <= 100 {
+		params.Limit = l
+	}
+	if o := c.QueryInt("offset", 0); o >= 0 {
+		params.Offset = o
+	}
+
+	shares, err := h.queries.Resource.WithContext(c.Context()).ListExternalShares(orgID, filter, params)
+	if err != nil {
+		if isInvalidCursorErr(err) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid pagination cursor")
+		}
+		h.logger.Error("list external shares: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list external shares")
+	}
+	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "External shares retrieved", Data: shares})
+}
+
+// RevokeResourceExternalShare
+//
+//	@Summary      Revoke resource guest share
+//	@Description  Revoke a share of the resource with a guest. Their link stops working and open sessions end.
+//	@Tags         Resource Management
+//	@Produce      json
+//	@Param        id        path  string  true  "Resource ID"
+//	@Param        share_id  path  string  true  "External share ID"
+//	@Success      200  {object}  SuccessResponse  "Guest share revoked"
+//	@Failure      404  {object}  ErrorResponse  "Share not found or already revoked"
+//	@Failure      500  {object}  ErrorResponse  "Internal server error"
+//	@Security     BearerAuth
+//	@Router       /resources/{id}/external-shares/{share_id} [delete]
+func (h *ShareLinkHandler) RevokeResourceExternalShare(c *fiber.Ctx) error {
+	return h.revokeExternal(c, c.Locals("organization_id").(string), queries.AccessLogResource, c.Params("id"))
+}
+
+// RevokeContentExternalShare
+//
+//	@Summary	Revoke content guest share
+//	@Description	Revoke a share of the content item with a guest. Their link stops working and open sessions end. Owner only.
+//	@Tags		Content
+//	@Produce	json
+//	@Param		id			path	string	true	"Content ID"
+//	@Param		share_id	path	string	true	"External share ID"
+//	@Success	200	{object}	object	"Guest share revoked"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	404	{object}	object	"Not found"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/external-shares/{share_id} [delete]
+func (h *ShareLinkHandler) RevokeContentExternalShare(c *fiber.Ctx) error {
+	if responded, err := h.requireContentOwner(c); responded {
+		return err
+	}
+	return h.revokeExternal(c, c.Locals("organization_id").(string), queries.AccessLogContent, c.Params("id"))
+}
+
+// RevokeExternalShare
+//
+//	@Summary      Revoke external share
+//	@Description  Revoke any share of the organization with a guest. Organization admins only.
+//	@Tags         Organization Management
+//	@Produce      json
+//	@Param        id        path  string  true  "Organization ID"
+//	@Param        share_id  path  string  true  "External share ID"
+//	@Success      200  {object}  SuccessResponse  "External share revoked"
+//	@Failure      404  {object}  ErrorResponse  "Share not found or already revoked"
+//	@Failure      500  {object}  ErrorResponse  "Internal server error"
+//	@Security     BearerAuth
+//	@Router       /organizations/{id}/external-shares/{share_id} [delete]
+func (h *ShareLinkHandler) RevokeExternalShare(c *fiber.Ctx) error {
+	return h.revokeExternal(c, c.Params("id"), "", "")
+}
+
+func (h *ShareLinkHandler) revokeExternal(c *fiber.Ctx, orgID, resourceType, resourceID string) error {
+	shareID := c.Params("share_id")
+	err := h.queries.Resource.WithContext(c.Context()).RevokeExternalShare(shareID, orgID, resourceType, resourceID, c.Locals("user_id").(string))
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "External share not found or already revoked")
+		}
+		h.logger.Error("revoke external share %s: %v", shareID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to revoke external share")
+	}
+	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "External share revoked", Data: fiber.Map{"id": shareID, "revoked": true}})
+}
+
+// RedeemGuestShare
+//
+//	@Summary      Redeem guest share
+//	@Description  Open an item shared with a guest using the token of the emailed link. Returns the item and a session token giving the share's access to it for an hour, or until the share expires or is revoked; send it as the X-Share-Token header to /public/shared. No authentication required.
+//	@Tags         Sharing
+//	@Accept       json
+//	@Produce      json
+//	@Param        request  body  object{token=string}  true  "Guest share token"
+//	@Success      200  {object}  SuccessResponse{data=object{session_token=string,expires_at=string,resource_type=string,resource_id=string,access_level=string,item=object}}  "Guest share opened"
+//	@Failure      400  {object}  ErrorResponse  "Missing token"
+//	@Failure      401  {object}  ErrorResponse  "Invalid, expired or revoked share (invalid_token, token_expired, token_revoked)"
+//	@Failure      404  {object}  ErrorResponse  "The shared item no longer exists"
+//	@Router       /public/guest-shares/redeem [post]
+func (h *ShareLinkHandler) RedeemGuestShare(c *fiber.Ctx) error {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "token is required")
+	}
+	claims, responded, err := h.parseToken(c, req.Token, guestShareTokenType)
+	if responded {
+		return err
+	}
+	shareID, _ := claims["sub"].(string)
+	orgID, _ := claims["organization_id"].(string)
+
+	share, err := h.queries.Resource.WithContext(c.Context()).TouchExternalShare(shareID, orgID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not usable") {
+			return apiError(c, fiber.StatusUnauthorized, apierror.CodeTokenRevoked, "Share was revoked or has expired")
+		}
+		h.logger.Error("open external share %s: %v", shareID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to open shared item")
+	}
+	return h.openSession(c, guestAccess(share), guestSessionTokenType, "Guest share opened")
+}
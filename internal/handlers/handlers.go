@@ -11,8 +11,11 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
 	"github.com/the-monkeys/monkeys-identity/internal/authz"
 	"github.com/the-monkeys/monkeys-identity/internal/database"
+	"github.com/the-monkeys/monkeys-identity/internal/events"
+	"github.com/the-monkeys/monkeys-identity/internal/middleware"
 	"github.com/the-monkeys/monkeys-identity/internal/models"
 	"github.com/the-monkeys/monkeys-identity/internal/queries"
 	"github.com/the-monkeys/monkeys-identity/internal/services"
@@ -21,13 +24,14 @@ import (
 
 // GroupHandler handles group-related operations
 type GroupHandler struct {
-	db      *database.DB
-	redis   *redis.Client
-	logger  *logger.Logger
-	queries *queries.Queries
+	db         *database.DB
+	redis      redis.UniversalClient
+	logger     *logger.Logger
+	queries    *queries.Queries
+	principals services.PrincipalResolver // set via SetPrincipals
 }
 
-func NewGroupHandler(db *database.DB, redis *redis.Client, logger *logger.Logger) *GroupHandler {
+func NewGroupHandler(db *database.DB, redis redis.UniversalClient, logger *logger.Logger) *GroupHandler {
 	return &GroupHandler{db: db, redis: redis, logger: logger, queries: queries.New(db, redis)}
 }
 
@@ -39,6 +43,7 @@ func NewGroupHandler(db *database.DB, redis *redis.Client, logger *logger.Logger
 //	@Accept		json
 //	@Produce	json
 //	@Param		limit	query	int	false	"Number of groups to return (default 50, max 200)"
+//	@Param		cursor	query	string	false	"Opaque cursor from next_cursor of the previous page; overrides offset"
 //	@Param		offset	query	int	false	"Number of groups to skip (default 0)"
 //	@Param		sort	query	string	false	"Sort by field (name, created_at)"
 //	@Param		order	query	string	false	"Sort order (asc, desc)"
@@ -56,16 +61,19 @@ func (h *GroupHandler) ListGroups(c *fiber.Ctx) error {
 	organizationID := c.Locals("organization_id").(string)
 
 	if limit < 1 || limit > 200 {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_limit", Message: "limit must be 1-200"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "limit must be 1-200")
 	}
 	if offset < 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_offset", Message: "offset must be >=0"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "offset must be >=0")
 	}
-	params := queries.ListParams{Limit: limit, Offset: offset, SortBy: sortBy, Order: order}
+	params := queries.ListParams{Limit: limit, Offset: offset, SortBy: sortBy, Order: order, Cursor: c.Query("cursor")}
 	result, err := h.queries.Group.ListGroups(params, organizationID)
 	if err != nil {
+		if isInvalidCursorErr(err) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid pagination cursor")
+		}
 		h.logger.Error("list groups failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to list groups"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list groups")
 	}
 	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Groups retrieved successfully", Data: result})
 }
@@ -87,11 +95,11 @@ func (h *GroupHandler) ListGroups(c *fiber.Ctx) error {
 func (h *GroupHandler) CreateGroup(c *fiber.Ctx) error {
 	var g models.Group
 	if err := c.BodyParser(&g); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_request_body", Message: "Failed to parse request body"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
 	}
 	organizationID := c.Locals("organization_id").(string)
 	if g.Name == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "validation_failed", Message: "name is required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "name is required")
 	}
 	g.OrganizationID = organizationID
 	g.ID = uuid.New().String()
@@ -107,14 +115,10 @@ func (h *GroupHandler) CreateGroup(c *fiber.Ctx) error {
 	if err := h.queries.Group.CreateGroup(&g); err != nil {
 		// Check for unique constraint violation
 		if err == queries.ErrGroupNameConflict {
-			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{
-				Status:  fiber.StatusConflict,
-				Error:   "group_already_exists",
-				Message: "A group with this name already exists in the organization",
-			})
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "A group with this name already exists in the organization")
 		}
 		h.logger.Error("create group failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to create group"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create group")
 	}
 	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{Status: fiber.StatusCreated, Message: "Group created successfully", Data: g})
 }
@@ -136,16 +140,16 @@ func (h *GroupHandler) CreateGroup(c *fiber.Ctx) error {
 func (h *GroupHandler) GetGroup(c *fiber.Ctx) error {
 	id := c.Params("id")
 	if id == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_group_id", Message: "Group ID is required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Group ID is required")
 	}
 	organizationID := c.Locals("organization_id").(string)
 	g, err := h.queries.Group.GetGroup(id, organizationID)
 	if err != nil {
 		if err.Error() == "group not found" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "group_not_found", Message: "Group not found"})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Group not found")
 		}
 		h.logger.Error("get group failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to get group"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to get group")
 	}
 	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Group retrieved successfully", Data: g})
 }
@@ -169,7 +173,7 @@ func (h *GroupHandler) GetGroup(c *fiber.Ctx) error {
 func (h *GroupHandler) UpdateGroup(c *fiber.Ctx) error {
 	id := c.Params("id")
 	if id == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_group_id", Message: "Group ID is required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Group ID is required")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
@@ -177,10 +181,10 @@ func (h *GroupHandler) UpdateGroup(c *fiber.Ctx) error {
 	existingGroup, err := h.queries.Group.GetGroup(id, organizationID)
 	if err != nil {
 		if err.Error() == "group not found" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "group_not_found", Message: "Group not found or deleted"})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Group not found or deleted")
 		}
 		h.logger.Error("get group failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to retrieve group"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve group")
 	}
 
 	// Parse update request
@@ -191,7 +195,7 @@ func (h *GroupHandler) UpdateGroup(c *fiber.Ctx) error {
 		Status      *string `json:"status"`
 	}
 	if err := c.BodyParser(&updateReq); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_request_body", Message: "Failed to parse request body"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
 	}
 
 	// Apply updates selectively
@@ -211,18 +215,14 @@ func (h *GroupHandler) UpdateGroup(c *fiber.Ctx) error {
 	existingGroup.ID = id
 	if err := h.queries.Group.UpdateGroup(existingGroup, organizationID); err != nil {
 		if err.Error() == "group not found or deleted" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "group_not_found", Message: "Group not found or deleted"})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Group not found or deleted")
 		}
 		// Check for unique constraint violation
 		if err == queries.ErrGroupNameConflict {
-			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{
-				Status:  fiber.StatusConflict,
-				Error:   "group_name_conflict",
-				Message: "A group with this name already exists in the organization",
-			})
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "A group with this name already exists in the organization")
 		}
 		h.logger.Error("update group failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to update group"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update group")
 	}
 	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Group updated successfully", Data: existingGroup})
 }
@@ -244,15 +244,15 @@ func (h *GroupHandler) UpdateGroup(c *fiber.Ctx) error {
 func (h *GroupHandler) DeleteGroup(c *fiber.Ctx) error {
 	id := c.Params("id")
 	if id == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_group_id", Message: "Group ID is required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Group ID is required")
 	}
 	organizationID := c.Locals("organization_id").(string)
 	if err := h.queries.Group.DeleteGroup(id, organizationID); err != nil {
 		if err.Error() == "group not found or deleted" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "group_not_found", Message: "Group not found or deleted"})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Group not found or deleted")
 		}
 		h.logger.Error("delete group failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to delete group"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to delete group")
 	}
 	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Group deleted successfully", Data: fiber.Map{"group_id": id, "deleted_at": time.Now()}})
 }
@@ -273,13 +273,13 @@ func (h *GroupHandler) DeleteGroup(c *fiber.Ctx) error {
 func (h *GroupHandler) GetGroupMembers(c *fiber.Ctx) error {
 	id := c.Params("id")
 	if id == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_group_id", Message: "Group ID is required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Group ID is required")
 	}
 	organizationID := c.Locals("organization_id").(string)
 	members, err := h.queries.Group.ListGroupMembers(id, organizationID)
 	if err != nil {
 		h.logger.Error("list group members failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to list group members"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list group members")
 	}
 	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Group members retrieved successfully", Data: fiber.Map{"group_id": id, "members": members, "count": len(members)}})
 }
@@ -287,7 +287,7 @@ func (h *GroupHandler) GetGroupMembers(c *fiber.Ctx) error {
 // AddGroupMember adds a member to a group
 //
 //	@Summary	Add group member
-//	@Description	Add a principal (user or service account) to a group. Principal must exist in the system. Required fields: principal_id (UUID), principal_type (user/service_account). Optional: role_in_group (defaults to \"member\"), expires_at (RFC3339 format). Membership is automatically timestamped with joined_at and tracks who added the member.
+//	@Description	Add a principal (user, service account or group) to a group. Principal must exist in the organization. Required fields: principal_id (UUID), principal_type (user/service_account). Optional: role_in_group (defaults to \"member\"), expires_at (RFC3339 format). Membership is automatically timestamped with joined_at and tracks who added the member.
 //	@Tags		Group Management
 //	@Accept		json
 //	@Produce	json
@@ -295,13 +295,15 @@ func (h *GroupHandler) GetGroupMembers(c *fiber.Ctx) error {
 //	@Param		request	body	object{principal_id=string,principal_type=string,role_in_group=string,expires_at=string}	true	"Membership details - Example: {\"principal_id\":\"39fc3320-9eab-47ea-86ea-dfc939d7159c\",\"principal_type\":\"user\",\"role_in_group\":\"member\"}"
 //	@Success	201	{object}	SuccessResponse{data=models.GroupMembership}	"Group member added successfully with generated membership ID and timestamps"
 //	@Failure	400	{object}	ErrorResponse	"Invalid request body, missing required fields, or invalid expires_at format"
-//	@Failure	500	{object}	ErrorResponse	"Internal server error or principal not found"
+//	@Failure	404	{object}	ErrorResponse	"Group or principal not found"
+//	@Failure	409	{object}	ErrorResponse	"The roles of the group would break a separation-of-duties rule for the principal (sod_violation)"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
 //	@Security	BearerAuth
 //	@Router		/groups/{id}/members [post]
 func (h *GroupHandler) AddGroupMember(c *fiber.Ctx) error {
 	id := c.Params("id")
 	if id == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_group_id", Message: "Group ID is required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Group ID is required")
 	}
 	var req struct {
 		PrincipalID   string `json:"principal_id"`
@@ -310,10 +312,10 @@ func (h *GroupHandler) AddGroupMember(c *fiber.Ctx) error {
 		ExpiresAt     string `json:"expires_at"`
 	}
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_request_body", Message: "Failed to parse request body"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
 	}
 	if req.PrincipalID == "" || req.PrincipalType == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "validation_failed", Message: "principal_id and principal_type are required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "principal_id and principal_type are required")
 	}
 	if req.RoleInGroup == "" {
 		req.RoleInGroup = "member"
@@ -322,19 +324,38 @@ func (h *GroupHandler) AddGroupMember(c *fiber.Ctx) error {
 	if req.ExpiresAt != "" {
 		t, err := time.Parse(time.RFC3339, req.ExpiresAt)
 		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_expires_at", Message: "expires_at must be RFC3339"})
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "expires_at must be RFC3339")
 		}
 		expires = t
 	}
 	addedBy := ""
 	organizationID := c.Locals("organization_id").(string)
+	if p, err := resolvePrincipal(c, h.principals, h.logger, organizationID, req.PrincipalID, req.PrincipalType, principalTypes...); p == nil {
+		return err
+	}
 	membership := &models.GroupMembership{ID: uuid.New().String(), GroupID: id, PrincipalID: req.PrincipalID, PrincipalType: req.PrincipalType, RoleInGroup: req.RoleInGroup, ExpiresAt: expires, AddedBy: addedBy}
+	if req.PrincipalType != "group" {
+		// Members hold the roles of the group
+		groupRoles, err := h.queries.Role.WithContext(c.Context()).GetGroupRoleNames(id, organizationID)
+		if err != nil {
+			h.logger.Error("get group roles failed: %v", err)
+			return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to add group member")
+		}
+		conflicts, err := services.SoDConflicts(c.Context(), h.queries, organizationID, req.PrincipalID, req.PrincipalType, groupRoles)
+		if err != nil {
+			h.logger.Error("check separation of duties failed: %v", err)
+			return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to add group member")
+		}
+		if len(conflicts) > 0 {
+			return sodViolation(c, conflicts)
+		}
+	}
 	if err := h.queries.Group.AddGroupMember(membership, organizationID); err != nil {
 		if isNotFoundErr(err) {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "not_found", Message: "Group or principal not found"})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Group or principal not found")
 		}
 		h.logger.Error("add group member failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to add group member"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to add group member")
 	}
 	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{Status: fiber.StatusCreated, Message: "Group member added successfully", Data: membership})
 }
@@ -360,15 +381,15 @@ func (h *GroupHandler) RemoveGroupMember(c *fiber.Ctx) error {
 	principalID := c.Params("user_id") // reuse param name pattern
 	principalType := c.Query("principal_type", "user")
 	if id == "" || principalID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_parameters", Message: "Group ID and principal ID are required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Group ID and principal ID are required")
 	}
 	organizationID := c.Locals("organization_id").(string)
 	if err := h.queries.Group.RemoveGroupMember(id, organizationID, principalID, principalType); err != nil {
 		if err.Error() == "membership not found" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "membership_not_found", Message: "Membership not found"})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Membership not found")
 		}
 		h.logger.Error("remove group member failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to remove group member"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to remove group member")
 	}
 	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Group member removed successfully", Data: fiber.Map{"group_id": id, "principal_id": principalID, "removed": true}})
 }
@@ -389,26 +410,28 @@ func (h *GroupHandler) RemoveGroupMember(c *fiber.Ctx) error {
 func (h *GroupHandler) GetGroupPermissions(c *fiber.Ctx) error {
 	id := c.Params("id")
 	if id == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_group_id", Message: "Group ID is required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Group ID is required")
 	}
 	organizationID := c.Locals("organization_id").(string)
 	perms, err := h.queries.Group.GetGroupPermissions(id, organizationID)
 	if err != nil {
 		h.logger.Error("get group permissions failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to get group permissions"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to get group permissions")
 	}
 	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Group permissions retrieved successfully", Data: fiber.Map{"group_id": id, "permissions": perms}})
 }
 
 // ResourceHandler handles resource-related operations
 type ResourceHandler struct {
-	db      *database.DB
-	redis   *redis.Client
-	logger  *logger.Logger
-	queries *queries.Queries
+	db         *database.DB
+	redis      redis.UniversalClient
+	logger     *logger.Logger
+	queries    *queries.Queries
+	integrity  services.ResourceIntegrityService // set via SetIntegrity after construction
+	principals services.PrincipalResolver        // set via SetPrincipals
 }
 
-func NewResourceHandler(db *database.DB, redis *redis.Client, logger *logger.Logger) *ResourceHandler {
+func NewResourceHandler(db *database.DB, redis redis.UniversalClient, logger *logger.Logger) *ResourceHandler {
 	return &ResourceHandler{db: db, redis: redis, logger: logger, queries: queries.New(db, redis)}
 }
 
@@ -420,8 +443,13 @@ func NewResourceHandler(db *database.DB, redis *redis.Client, logger *logger.Log
 //	@Accept		json
 //	@Produce	json
 //	@Param		organization_id	query	string	false	"Filter by organization ID"
+//	@Param		q	query	string	false	"Search resource name and ARN"
 //	@Param		type	query	string	false	"Filter by resource type"
+//	@Param		owner_id	query	string	false	"Filter by owner principal ID"
+//	@Param		status	query	string	false	"Filter by status (active, suspended, archived)"
+//	@Param		tag	query	string	false	"Filter by tag key, or key:value"
 //	@Param		limit	query	int	false	"Number of resources to return (default 20)"
+//	@Param		cursor	query	string	false	"Opaque cursor from next_cursor of the previous page; overrides offset"
 //	@Param		offset	query	int	false	"Number of resources to skip (default 0)"
 //	@Success	200	{object}	SuccessResponse	"Resources listed successfully"
 //	@Failure	500	{object}	ErrorResponse	"Internal server error"
@@ -447,14 +475,50 @@ func (h *ResourceHandler) ListResources(c *fiber.Ctx) error {
 		}
 	}
 
+	params.Cursor = c.Query("cursor")
+
+	filter := queries.ResourceFilter{
+		Query:   strings.TrimSpace(c.Query("q")),
+		Type:    c.Query("type"),
+		OwnerID: c.Query("owner_id"),
+		Status:  c.Query("status"),
+	}
+	switch filter.Type {
+	case "", "object", "service", "namespace", "infrastructure", "application", "configuration", "data", "documentation", "blog":
+	default:
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Unknown resource type")
+	}
+	switch filter.Status {
+	case "", "active", "suspended", "archived":
+	default:
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "status must be one of active, suspended, archived")
+	}
+	if filter.OwnerID != "" {
+		if _, err := uuid.Parse(filter.OwnerID); err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "owner_id must be a UUID")
+		}
+	}
+	if tag := c.Query("tag"); tag != "" {
+		filter.TagKey, filter.TagValue, _ = strings.Cut(tag, ":")
+	}
+
 	// Get organization ID from context
 	organizationID := c.Locals("organization_id").(string)
-	// Note: type filter not yet implemented in queries layer
+	if orgID := c.Query("organization_id"); orgID != "" && orgID != organizationID {
+		tc := middleware.GetTenantContext(c)
+		if tc == nil || !tc.CanAccessOrg(orgID) {
+			return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Access denied: you do not have access to this organization")
+		}
+		organizationID = orgID
+	}
 
-	result, err := h.queries.Resource.ListResources(params, organizationID)
+	result, err := h.queries.Resource.ListResources(params, organizationID, filter)
 	if err != nil {
+		if isInvalidCursorErr(err) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid pagination cursor")
+		}
 		h.logger.Error("list resources failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to retrieve resources"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve resources")
 	}
 
 	return c.Status(fiber.StatusOK).JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Resources listed successfully", Data: result})
@@ -476,14 +540,14 @@ func (h *ResourceHandler) ListResources(c *fiber.Ctx) error {
 func (h *ResourceHandler) CreateResource(c *fiber.Ctx) error {
 	var resource models.Resource
 	if err := c.BodyParser(&resource); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_request_body", Message: "Failed to parse request body"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
 
 	// Validate required fields
 	if resource.Name == "" || resource.Type == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "validation_failed", Message: "name and type are required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "name and type are required")
 	}
 	resource.OrganizationID = organizationID
 
@@ -504,6 +568,24 @@ func (h *ResourceHandler) CreateResource(c *fiber.Ctx) error {
 	if resource.LifecyclePolicy == "" {
 		resource.LifecyclePolicy = "{}"
 	}
+	policy, err := normalizeLifecyclePolicy(resource.LifecyclePolicy)
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, err.Error())
+	}
+	resource.LifecyclePolicy = policy
+	if resource.EncryptionKeyID != nil && *resource.EncryptionKeyID == "" {
+		resource.EncryptionKeyID = nil
+	}
+	if resource.EncryptionKeyID != nil {
+		msg, err := h.validateEncryptionKey(c.Context(), *resource.EncryptionKeyID, organizationID)
+		if err != nil {
+			h.logger.Error("get resource encryption key failed: %v", err)
+			return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create resource")
+		}
+		if msg != "" {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, msg)
+		}
+	}
 
 	// Generate ARN if not provided
 	// Format: arn:monkey:<service>:<region>:<account>:<resource-type>/<resource-id>
@@ -513,10 +595,10 @@ func (h *ResourceHandler) CreateResource(c *fiber.Ctx) error {
 
 	if err := h.queries.Resource.CreateResource(&resource); err != nil {
 		if isConflictErr(err) {
-			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Status: fiber.StatusConflict, Error: "conflict", Message: "A resource with this identifier already exists"})
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "A resource with this identifier already exists")
 		}
 		h.logger.Error("create resource failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to create resource"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create resource")
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{Status: fiber.StatusCreated, Message: "Resource created successfully", Data: resource})
@@ -539,7 +621,7 @@ func (h *ResourceHandler) CreateResource(c *fiber.Ctx) error {
 func (h *ResourceHandler) GetResource(c *fiber.Ctx) error {
 	resourceID := c.Params("id")
 	if resourceID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_resource_id", Message: "Resource ID is required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Resource ID is required")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
@@ -547,9 +629,9 @@ func (h *ResourceHandler) GetResource(c *fiber.Ctx) error {
 	if err != nil {
 		h.logger.Error("get resource failed: %v", err)
 		if err.Error() == "resource not found" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "resource_not_found", Message: "Resource not found"})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Resource not found")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to retrieve resource"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve resource")
 	}
 
 	return c.Status(fiber.StatusOK).JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Resource retrieved successfully", Data: resource})
@@ -573,12 +655,12 @@ func (h *ResourceHandler) GetResource(c *fiber.Ctx) error {
 func (h *ResourceHandler) UpdateResource(c *fiber.Ctx) error {
 	resourceID := c.Params("id")
 	if resourceID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_resource_id", Message: "Resource ID is required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Resource ID is required")
 	}
 
 	var updates models.Resource
 	if err := c.BodyParser(&updates); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_request_body", Message: "Failed to parse request body"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
@@ -588,9 +670,9 @@ func (h *ResourceHandler) UpdateResource(c *fiber.Ctx) error {
 	if err != nil {
 		h.logger.Error("get resource for update failed: %v", err)
 		if err.Error() == "resource not found" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "resource_not_found", Message: "Resource not found"})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Resource not found")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to retrieve resource for update"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve resource for update")
 	}
 
 	// Only overwrite fields that were provided (non-empty)
@@ -615,17 +697,39 @@ func (h *ResourceHandler) UpdateResource(c *fiber.Ctx) error {
 	if updates.AccessLevel != "" {
 		existing.AccessLevel = updates.AccessLevel
 	}
+	if updates.LifecyclePolicy != "" {
+		policy, err := normalizeLifecyclePolicy(updates.LifecyclePolicy)
+		if err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, err.Error())
+		}
+		existing.LifecyclePolicy = policy
+	}
+	// An empty encryption_key_id detaches the key
+	if updates.EncryptionKeyID != nil {
+		existing.EncryptionKeyID = nil
+		if *updates.EncryptionKeyID != "" {
+			msg, err := h.validateEncryptionKey(c.Context(), *updates.EncryptionKeyID, organizationID)
+			if err != nil {
+				h.logger.Error("get resource encryption key failed: %v", err)
+				return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update resource")
+			}
+			if msg != "" {
+				return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, msg)
+			}
+			existing.EncryptionKeyID = updates.EncryptionKeyID
+		}
+	}
 
 	if err := h.queries.Resource.UpdateResource(existing, organizationID); err != nil {
 		h.logger.Error("update resource failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to update resource"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update resource")
 	}
 
 	// Get the updated resource to return it
 	updatedResource, err := h.queries.Resource.GetResource(resourceID, organizationID)
 	if err != nil {
 		h.logger.Error("get updated resource failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Resource updated but failed to retrieve updated data"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Resource updated but failed to retrieve updated data")
 	}
 
 	return c.Status(fiber.StatusOK).JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Resource updated successfully", Data: updatedResource})
@@ -648,16 +752,16 @@ func (h *ResourceHandler) UpdateResource(c *fiber.Ctx) error {
 func (h *ResourceHandler) DeleteResource(c *fiber.Ctx) error {
 	resourceID := c.Params("id")
 	if resourceID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_resource_id", Message: "Resource ID is required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Resource ID is required")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
 	if err := h.queries.Resource.DeleteResource(resourceID, organizationID); err != nil {
 		h.logger.Error("delete resource failed: %v", err)
 		if err.Error() == "resource not found" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "resource_not_found", Message: "Resource not found"})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Resource not found")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to delete resource"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to delete resource")
 	}
 
 	return c.Status(fiber.StatusOK).JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Resource deleted successfully", Data: nil})
@@ -680,7 +784,7 @@ func (h *ResourceHandler) DeleteResource(c *fiber.Ctx) error {
 func (h *ResourceHandler) GetResourcePermissions(c *fiber.Ctx) error {
 	resourceID := c.Params("id")
 	if resourceID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_resource_id", Message: "Resource ID is required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Resource ID is required")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
@@ -688,9 +792,9 @@ func (h *ResourceHandler) GetResourcePermissions(c *fiber.Ctx) error {
 	if err != nil {
 		h.logger.Error("get resource permissions failed: %v", err)
 		if err.Error() == "resource not found" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "resource_not_found", Message: "Resource not found"})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Resource not found")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to retrieve resource permissions"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve resource permissions")
 	}
 
 	return c.Status(fiber.StatusOK).JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Resource permissions retrieved successfully", Data: permissions})
@@ -714,7 +818,7 @@ func (h *ResourceHandler) GetResourcePermissions(c *fiber.Ctx) error {
 func (h *ResourceHandler) SetResourcePermissions(c *fiber.Ctx) error {
 	resourceID := c.Params("id")
 	if resourceID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_resource_id", Message: "Resource ID is required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Resource ID is required")
 	}
 
 	var req struct {
@@ -724,11 +828,11 @@ func (h *ResourceHandler) SetResourcePermissions(c *fiber.Ctx) error {
 	}
 
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_request_body", Message: "Failed to parse request body"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
 	}
 
 	if req.PrincipalID == "" || req.PrincipalType == "" || len(req.Permissions) == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "validation_failed", Message: "principal_id, principal_type, and permissions are required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "principal_id, principal_type, and permissions are required")
 	}
 
 	// Convert permissions to ResourcePermission structs
@@ -749,9 +853,9 @@ func (h *ResourceHandler) SetResourcePermissions(c *fiber.Ctx) error {
 	if err := h.queries.Resource.SetResourcePermissions(resourceID, organizationID, permissions); err != nil {
 		h.logger.Error("set resource permissions failed: %v", err)
 		if err.Error() == "resource not found" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "resource_not_found", Message: "Resource not found"})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Resource not found")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to set resource permissions"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to set resource permissions")
 	}
 
 	return c.Status(fiber.StatusOK).JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Permissions set successfully", Data: nil})
@@ -760,52 +864,42 @@ func (h *ResourceHandler) SetResourcePermissions(c *fiber.Ctx) error {
 // GetResourceAccessLog retrieves access log for a resource
 //
 //	@Summary	Get resource access log
-//	@Description	Retrieve access events for a resource
+//	@Description	Retrieve the reads and writes of a resource, and the attempts at them that were denied, newest first. Entries are kept for the organization's resource_access_log_retention_days setting, else the server default.
 //	@Tags		Resource Management
 //	@Accept		json
 //	@Produce	json
 //	@Param		id	path	string	true	"Resource ID"
+//	@Param		user_id	query	string	false	"Only entries of this principal"
+//	@Param		action	query	string	false	"Only entries of this action, e.g. read or monkeys:resource:update"
+//	@Param		success	query	bool	false	"Only successful (true) or denied (false) accesses"
+//	@Param		start_time	query	string	false	"Start time (RFC3339)"
+//	@Param		end_time	query	string	false	"End time (RFC3339)"
 //	@Param		limit	query	int	false	"Number of log entries to return (default 50)"
+//	@Param		cursor	query	string	false	"Opaque cursor from next_cursor of the previous page; overrides offset"
 //	@Param		offset	query	int	false	"Number of log entries to skip (default 0)"
 //	@Success	200	{object}	SuccessResponse	"Access log retrieved successfully"
-//	@Failure	400	{object}	ErrorResponse	"Invalid resource ID"
-//	@Failure	404	{object}	ErrorResponse	"Resource not found"
+//	@Failure	400	{object}	ErrorResponse	"Invalid resource ID or filters"
 //	@Failure	500	{object}	ErrorResponse	"Internal server error"
 //	@Security	BearerAuth
 //	@Router		/resources/{id}/access-log [get]
 func (h *ResourceHandler) GetResourceAccessLog(c *fiber.Ctx) error {
 	resourceID := c.Params("id")
 	if resourceID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_resource_id", Message: "Resource ID is required"})
-	}
-
-	// Parse query parameters
-	params := queries.ListParams{
-		Limit:  50,
-		Offset: 0,
-		SortBy: "accessed_at",
-		Order:  "DESC",
-	}
-
-	if limit := c.Query("limit"); limit != "" {
-		if l, err := strconv.Atoi(limit); err == nil && l > 0 && l <= 100 {
-			params.Limit = l
-		}
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Resource ID is required")
 	}
-	if offset := c.Query("offset"); offset != "" {
-		if o, err := strconv.Atoi(offset); err == nil && o >= 0 {
-			params.Offset = o
-		}
+	filter, params, err := accessLogQuery(c, queries.AccessLogResource, resourceID)
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
 	}
 
 	organizationID := c.Locals("organization_id").(string)
-	accessLog, err := h.queries.Resource.GetResourceAccessLog(resourceID, organizationID, params)
+	accessLog, err := h.queries.Resource.WithContext(c.Context()).GetResourceAccessLog(organizationID, filter, params)
 	if err != nil {
-		h.logger.Error("get resource access log failed: %v", err)
-		if err.Error() == "resource not found" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "resource_not_found", Message: "Resource not found"})
+		if isInvalidCursorErr(err) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid pagination cursor")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to retrieve resource access log"})
+		h.logger.Error("get resource access log failed: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve resource access log")
 	}
 
 	return c.Status(fiber.StatusOK).JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Access log retrieved successfully", Data: accessLog})
@@ -814,7 +908,7 @@ func (h *ResourceHandler) GetResourceAccessLog(c *fiber.Ctx) error {
 // ShareResource shares a resource with a principal
 //
 //	@Summary	Share resource
-//	@Description	Share a resource with a user or group
+//	@Description	Share a resource with a user or group, optionally until expires_at. Expired shares stop granting access at once and are deleted by the share expiry job; user recipients are notified ahead of the expiry.
 //	@Tags		Resource Management
 //	@Accept		json
 //	@Produce	json
@@ -822,14 +916,14 @@ func (h *ResourceHandler) GetResourceAccessLog(c *fiber.Ctx) error {
 //	@Param		request	body	object	true	"Share details"
 //	@Success	200	{object}	SuccessResponse	"Resource shared successfully"
 //	@Failure	400	{object}	ErrorResponse	"Invalid request body or resource ID"
-//	@Failure	404	{object}	ErrorResponse	"Resource not found"
+//	@Failure	404	{object}	ErrorResponse	"Resource or principal not found"
 //	@Failure	500	{object}	ErrorResponse	"Internal server error"
 //	@Security	BearerAuth
 //	@Router		/resources/{id}/share [post]
 func (h *ResourceHandler) ShareResource(c *fiber.Ctx) error {
 	resourceID := c.Params("id")
 	if resourceID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_resource_id", Message: "Resource ID is required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Resource ID is required")
 	}
 
 	var req struct {
@@ -841,11 +935,11 @@ func (h *ResourceHandler) ShareResource(c *fiber.Ctx) error {
 	}
 
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_request_body", Message: "Failed to parse request body"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
 	}
 
 	if req.PrincipalID == "" || req.PrincipalType == "" || req.AccessLevel == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "validation_failed", Message: "principal_id, principal_type, and access_level are required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "principal_id, principal_type, and access_level are required")
 	}
 
 	share := queries.ResourceShare{
@@ -859,21 +953,29 @@ func (h *ResourceHandler) ShareResource(c *fiber.Ctx) error {
 
 	// Parse expires_at if provided
 	if req.ExpiresAt != "" {
-		if expTime, err := time.Parse(time.RFC3339, req.ExpiresAt); err == nil {
-			share.ExpiresAt = expTime
+		expTime, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "expires_at must be RFC3339")
 		}
+		if !expTime.After(time.Now()) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "expires_at must be in the future")
+		}
+		share.ExpiresAt = &expTime
 	}
 
 	organizationID := c.Locals("organization_id").(string)
+	if p, err := resolvePrincipal(c, h.principals, h.logger, organizationID, req.PrincipalID, req.PrincipalType, principalTypes...); p == nil {
+		return err
+	}
 	if err := h.queries.Resource.ShareResource(&share, organizationID); err != nil {
 		h.logger.Error("share resource failed: %v", err)
 		if err.Error() == "resource not found" || err.Error() == "resource not found or not in organization" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "resource_not_found", Message: "Resource not found"})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Resource not found")
 		}
 		if err.Error() == "resource already shared with this principal" {
-			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Status: fiber.StatusConflict, Error: "already_shared", Message: "Resource is already shared with this principal"})
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "Resource is already shared with this principal")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to share resource"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to share resource")
 	}
 
 	return c.Status(fiber.StatusOK).JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Resource shared successfully", Data: share})
@@ -897,7 +999,7 @@ func (h *ResourceHandler) ShareResource(c *fiber.Ctx) error {
 func (h *ResourceHandler) UnshareResource(c *fiber.Ctx) error {
 	resourceID := c.Params("id")
 	if resourceID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_resource_id", Message: "Resource ID is required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Resource ID is required")
 	}
 
 	var req struct {
@@ -906,20 +1008,20 @@ func (h *ResourceHandler) UnshareResource(c *fiber.Ctx) error {
 	}
 
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_request_body", Message: "Failed to parse request body"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
 	}
 
 	if req.PrincipalID == "" || req.PrincipalType == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "validation_failed", Message: "principal_id and principal_type are required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "principal_id and principal_type are required")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
 	if err := h.queries.Resource.UnshareResource(resourceID, organizationID, req.PrincipalID, req.PrincipalType); err != nil {
 		h.logger.Error("unshare resource failed: %v", err)
 		if err.Error() == "resource not found" || err.Error() == "share not found" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "not_found", Message: "Resource or share not found"})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Resource or share not found")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to unshare resource"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to unshare resource")
 	}
 
 	return c.Status(fiber.StatusOK).JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Resource unshared successfully", Data: nil})
@@ -928,14 +1030,15 @@ func (h *ResourceHandler) UnshareResource(c *fiber.Ctx) error {
 // PolicyHandler handles policy-related operations
 type PolicyHandler struct {
 	db      *database.DB
-	redis   *redis.Client
+	redis   redis.UniversalClient
 	logger  *logger.Logger
 	queries *queries.Queries
 	audit   services.AuditService
 	authz   services.AuthzService
+	events  events.Bus // set via SetEvents
 }
 
-func NewPolicyHandler(db *database.DB, redis *redis.Client, logger *logger.Logger, audit services.AuditService, authz services.AuthzService) *PolicyHandler {
+func NewPolicyHandler(db *database.DB, redis redis.UniversalClient, logger *logger.Logger, audit services.AuditService, authz services.AuthzService) *PolicyHandler {
 	return &PolicyHandler{
 		db:      db,
 		redis:   redis,
@@ -946,6 +1049,25 @@ func NewPolicyHandler(db *database.DB, redis *redis.Client, logger *logger.Logge
 	}
 }
 
+// SetEvents injects the bus policy changes are published on. Called from
+// route setup.
+func (h *PolicyHandler) SetEvents(bus events.Bus) {
+	h.events = bus
+}
+
+// publishPolicy publishes a policy.* event of the given type
+func (h *PolicyHandler) publishPolicy(c *fiber.Ctx, kind string, policy *models.Policy) {
+	publish(h.events, c, events.Event{
+		Type:    kind,
+		Subject: policy.ID,
+		Data: map[string]interface{}{
+			"name":         policy.Name,
+			"version":      policy.Version,
+			"lock_version": policy.LockVersion,
+		},
+	})
+}
+
 // ListPolicies lists policies
 //
 //	@Summary	List policies
@@ -954,6 +1076,7 @@ func NewPolicyHandler(db *database.DB, redis *redis.Client, logger *logger.Logge
 //	@Accept		json
 //	@Produce	json
 //	@Param		limit	query	int	false	"Number of policies per page (default: 50)"
+//	@Param		cursor	query	string	false	"Opaque cursor from next_cursor of the previous page; overrides offset"
 //	@Param		offset	query	int	false	"Number of policies to skip (default: 0)"
 //	@Param		sort_by	query	string	false	"Field to sort by (created_at, name, status)"
 //	@Param		order	query	string	false	"Sort order (asc, desc)"
@@ -986,14 +1109,16 @@ func (h *PolicyHandler) ListPolicies(c *fiber.Ctx) error {
 		params.Order = order
 	}
 
+	params.Cursor = c.Query("cursor")
+
 	organizationID := c.Locals("organization_id").(string)
 	result, err := h.queries.Policy.ListPolicies(params, organizationID)
 	if err != nil {
+		if isInvalidCursorErr(err) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid pagination cursor")
+		}
 		h.logger.Error("Failed to list policies: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to list policies",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list policies")
 	}
 
 	return c.JSON(result)
@@ -1028,10 +1153,7 @@ func (h *PolicyHandler) CreatePolicy(c *fiber.Ctx) error {
 
 	var req createPolicyRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Invalid JSON format",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid JSON format")
 	}
 
 	if req.ID == "" {
@@ -1039,10 +1161,7 @@ func (h *PolicyHandler) CreatePolicy(c *fiber.Ctx) error {
 	}
 
 	if len(req.Document) == 0 || !json.Valid(req.Document) {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_policy_document",
-			Message: "Policy document must be valid JSON",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidPolicyDocument, "Policy document must be valid JSON")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
@@ -1093,23 +1212,16 @@ func (h *PolicyHandler) CreatePolicy(c *fiber.Ctx) error {
 	if err != nil {
 		h.logger.Error("Failed to create policy: %v", err)
 		if strings.Contains(err.Error(), "invalid policy document") {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Error:   "invalid_policy_document",
-				Message: err.Error(),
-			})
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidPolicyDocument, err.Error())
 		}
 		// Handle duplicate key error for policy name
 		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
-			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{
-				Error:   "policy_already_exists",
-				Message: fmt.Sprintf("A policy with the name '%s' already exists in this organization", policy.Name),
-			})
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, fmt.Sprintf("A policy with the name '%s' already exists in this organization", policy.Name))
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to create policy",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create policy")
 	}
+	auditChange(c, h.audit, organizationID, "create_policy", "policy", policy.ID, nil, &policy)
+	h.publishPolicy(c, events.PolicyCreated, &policy)
 
 	return c.Status(fiber.StatusCreated).JSON(policy)
 }
@@ -1131,10 +1243,7 @@ func (h *PolicyHandler) CreatePolicy(c *fiber.Ctx) error {
 func (h *PolicyHandler) GetPolicy(c *fiber.Ctx) error {
 	id := c.Params("id")
 	if id == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Policy ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Policy ID is required")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
@@ -1142,42 +1251,37 @@ func (h *PolicyHandler) GetPolicy(c *fiber.Ctx) error {
 	if err != nil {
 		h.logger.Error("Failed to get policy: %v (policy_id: %s)", err, id)
 		if strings.Contains(err.Error(), "not found") {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "policy_not_found",
-				Message: "Policy not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Policy not found")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to retrieve policy",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve policy")
 	}
 
+	c.Set(fiber.HeaderETag, versionETag(policy.LockVersion))
 	return c.JSON(policy)
 }
 
 // UpdatePolicy updates a policy
 //
 //	@Summary	Update policy
-//	@Description	Update an existing policy and create new version if document changed
+//	@Description	Update an existing policy and create new version if document changed. The update must name the lock_version it is based on, as If-Match with the ETag of the policy or as lock_version in the body; if the policy changed since, nothing is written and 409 carries the current version.
 //	@Tags		Policy Management
 //	@Accept		json
 //	@Produce	json
 //	@Param		id	path	string	true	"Policy ID"
+//	@Param		If-Match	header	string	false	"ETag of the version the update is based on; * for any"
 //	@Param		request	body	models.Policy	true	"Updated policy"
 //	@Success	200	{object}	models.Policy	"Policy updated successfully"
 //	@Failure	400	{object}	ErrorResponse	"Invalid request or policy document"
 //	@Failure	404	{object}	ErrorResponse	"Policy not found"
+//	@Failure	409	{object}	ErrorResponse	"Policy changed since that version"
+//	@Failure	428	{object}	ErrorResponse	"No version given"
 //	@Failure	500	{object}	ErrorResponse	"Internal server error"
 //	@Security	BearerAuth
 //	@Router		/policies/{id} [put]
 func (h *PolicyHandler) UpdatePolicy(c *fiber.Ctx) error {
 	id := c.Params("id")
 	if id == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Policy ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Policy ID is required")
 	}
 
 	type updatePolicyRequest struct {
@@ -1192,28 +1296,24 @@ func (h *PolicyHandler) UpdatePolicy(c *fiber.Ctx) error {
 		Status         string          `json:"status"`
 		ApprovedBy     string          `json:"approved_by"`
 		ApprovedAt     *time.Time      `json:"approved_at"`
+		LockVersion    *int            `json:"lock_version"`
 	}
 
 	var req updatePolicyRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Invalid JSON format",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid JSON format")
+	}
+	lockVersion, err := requiredVersion(c, req.LockVersion)
+	if lockVersion < 0 {
+		return err
 	}
 
 	if len(req.Document) == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_policy_document",
-			Message: "Policy document is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidPolicyDocument, "Policy document is required")
 	}
 
 	if !json.Valid(req.Document) {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_policy_document",
-			Message: "Policy document must be valid JSON",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidPolicyDocument, "Policy document must be valid JSON")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
@@ -1238,6 +1338,7 @@ func (h *PolicyHandler) UpdatePolicy(c *fiber.Ctx) error {
 		Effect:         req.Effect,
 		IsSystemPolicy: req.IsSystemPolicy,
 		Status:         req.Status,
+		LockVersion:    lockVersion,
 	}
 
 	// Ensure ID matches path parameter
@@ -1259,39 +1360,44 @@ func (h *PolicyHandler) UpdatePolicy(c *fiber.Ctx) error {
 		policy.ApprovedAt = req.ApprovedAt
 	}
 
-	err := h.queries.Policy.UpdatePolicy(&policy, organizationID)
+	// In a transaction so that a conflicting update leaves no version record,
+	// reading the policy it replaces for the audit log
+	var before *models.Policy
+	err = h.queries.Transact(c.UserContext(), func(q *queries.Queries) error {
+		var err error
+		if before, err = q.Policy.GetPolicy(id, organizationID); err != nil {
+			return err
+		}
+		return q.Policy.UpdatePolicy(&policy, organizationID)
+	})
 	if err != nil {
+		if stale, resp := staleVersion(c, err, "Policy was changed since the version this update is based on"); stale {
+			return resp
+		}
 		h.logger.Error("Failed to update policy: %v (policy_id: %s)", err, id)
 		if strings.Contains(err.Error(), "not found") {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "policy_not_found",
-				Message: "Policy not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Policy not found")
 		}
 		if strings.Contains(err.Error(), "invalid policy document") {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Error:   "invalid_policy_document",
-				Message: err.Error(),
-			})
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidPolicyDocument, err.Error())
 		}
 		// Handle duplicate key error for policy name
 		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
-			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{
-				Error:   "policy_already_exists",
-				Message: fmt.Sprintf("A policy with the name '%s' already exists in this organization", policy.Name),
-			})
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, fmt.Sprintf("A policy with the name '%s' already exists in this organization", policy.Name))
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to update policy",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update policy")
 	}
 
+	h.publishPolicy(c, events.PolicyUpdated, &policy)
+
 	// Return updated policy
+	c.Set(fiber.HeaderETag, versionETag(policy.LockVersion))
 	updatedPolicy, err := h.queries.Policy.GetPolicy(id, organizationID)
 	if err != nil {
+		auditChange(c, h.audit, organizationID, "update_policy", "policy", id, before, &policy)
 		return c.JSON(policy) // fallback to input policy
 	}
+	auditChange(c, h.audit, organizationID, "update_policy", "policy", id, before, updatedPolicy)
 
 	return c.JSON(updatedPolicy)
 }
@@ -1313,27 +1419,23 @@ func (h *PolicyHandler) UpdatePolicy(c *fiber.Ctx) error {
 func (h *PolicyHandler) DeletePolicy(c *fiber.Ctx) error {
 	id := c.Params("id")
 	if id == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Policy ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Policy ID is required")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
-	err := h.queries.Policy.DeletePolicy(id, organizationID)
+	before, err := h.queries.Policy.GetPolicy(id, organizationID)
+	if err == nil {
+		err = h.queries.Policy.DeletePolicy(id, organizationID)
+	}
 	if err != nil {
 		h.logger.Error("Failed to delete policy: %v (policy_id: %s)", err, id)
 		if strings.Contains(err.Error(), "not found") {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "policy_not_found",
-				Message: "Policy not found or already deleted",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Policy not found or already deleted")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to delete policy",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to delete policy")
 	}
+	auditChange(c, h.audit, organizationID, "delete_policy", "policy", id, before, nil)
+	publish(h.events, c, events.Event{Type: events.PolicyDeleted, Subject: id})
 
 	return c.JSON(SuccessResponse{
 		Status:  200,
@@ -1344,44 +1446,68 @@ func (h *PolicyHandler) DeletePolicy(c *fiber.Ctx) error {
 // SimulatePolicy simulates evaluation of a policy
 //
 //	@Summary	Simulate policy
-//	@Description	Simulate the effect of a policy against hypothetical requests
+//	@Description	Evaluate a policy document against a context and test cases, reporting how each statement applied. Use /policies/{id}/simulate to test a saved policy; a policy_document in the body then overrides the saved one, e.g. to check an edit before saving it.
 //	@Tags		Policy Management
 //	@Accept		json
 //	@Produce	json
+//	@Param		id	path	string	true	"Policy ID"
 //	@Param		request	body	queries.PolicySimulationRequest	true	"Simulation input"
 //	@Success	200	{object}	queries.PolicySimulationResult	"Policy simulation completed"
 //	@Failure	400	{object}	ErrorResponse	"Invalid simulation request"
+//	@Failure	404	{object}	ErrorResponse	"Policy not found"
 //	@Failure	500	{object}	ErrorResponse	"Internal server error"
 //	@Security	BearerAuth
-//	@Router		/policies/simulate [post]
+//	@Router		/policies/{id}/simulate [post]
 func (h *PolicyHandler) SimulatePolicy(c *fiber.Ctx) error {
 	var request queries.PolicySimulationRequest
 	if err := c.BodyParser(&request); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Invalid JSON format",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid JSON format")
 	}
 
-	if request.PolicyDocument == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Policy document is required",
-		})
+	policyID := c.Params("id")
+	if request.PolicyDocument == "" && policyID != "" {
+		policy, err := h.queries.Policy.GetPolicy(policyID, c.Locals("organization_id").(string))
+		if err != nil {
+			if isNotFoundErr(err) {
+				return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Policy not found")
+			}
+			h.logger.Error("Failed to get policy for simulation: %v (policy_id: %s)", err, policyID)
+			return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to simulate policy")
+		}
+		request.PolicyDocument = policy.Document
 	}
 
-	result, err := h.queries.Policy.SimulatePolicy(&request)
-	if err != nil {
-		h.logger.Error("Failed to simulate policy: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to simulate policy",
-		})
+	if request.PolicyDocument == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Policy document is required")
 	}
 
+	result := h.authz.SimulatePolicy(&request)
+	result.PolicyID = policyID
 	return c.JSON(result)
 }
 
+// AnalyzePolicies reports problems in the organization's policies
+//
+//	@Summary	Analyze policies
+//	@Description	Lint every policy in the organization for full wildcard grants, overly broad grants and statements shadowed by earlier ones, and use the sampled decision log to find policies unused for unused_days. Findings are sorted most severe first.
+//	@Tags		Policy Management
+//	@Produce	json
+//	@Param		unused_days	query	int	false	"Days without a sampled match before a policy counts as unused (default: 90)"
+//	@Success	200	{object}	services.PolicyAnalysisReport	"Policy analysis completed"
+//	@Failure	403	{object}	ErrorResponse	"Admin role required"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Security	BearerAuth
+//	@Router		/policies/analysis [get]
+func (h *PolicyHandler) AnalyzePolicies(c *fiber.Ctx) error {
+	orgID := c.Locals("organization_id").(string)
+	report, err := h.authz.AnalyzePolicies(c.Context(), orgID, c.QueryInt("unused_days", services.DefaultUnusedPolicyDays))
+	if err != nil {
+		h.logger.Error("Failed to analyze policies: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to analyze policies")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Policy analysis completed", report)
+}
+
 // GetPolicyVersions lists policy versions
 //
 //	@Summary	List policy versions
@@ -1399,33 +1525,21 @@ func (h *PolicyHandler) SimulatePolicy(c *fiber.Ctx) error {
 func (h *PolicyHandler) GetPolicyVersions(c *fiber.Ctx) error {
 	id := c.Params("id")
 	if id == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Policy ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Policy ID is required")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
 	versions, err := h.queries.Policy.GetPolicyVersions(id, organizationID)
 	if err != nil {
 		if isNotFoundErr(err) {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "policy_not_found",
-				Message: "Policy not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Policy not found")
 		}
 		h.logger.Error("Failed to get policy versions: %v (policy_id: %s)", err, id)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to retrieve policy versions",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve policy versions")
 	}
 
 	if len(versions) == 0 {
-		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-			Error:   "policy_not_found",
-			Message: "Policy not found or has no versions",
-		})
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Policy not found or has no versions")
 	}
 
 	return c.JSON(versions)
@@ -1448,19 +1562,13 @@ func (h *PolicyHandler) GetPolicyVersions(c *fiber.Ctx) error {
 func (h *PolicyHandler) ApprovePolicy(c *fiber.Ctx) error {
 	id := c.Params("id")
 	if id == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Policy ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Policy ID is required")
 	}
 
 	// Get approver ID from JWT context
 	approvedBy, ok := c.Locals("user_id").(string)
 	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
-			Error:   "unauthorized",
-			Message: "Invalid session",
-		})
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid session")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
@@ -1468,21 +1576,12 @@ func (h *PolicyHandler) ApprovePolicy(c *fiber.Ctx) error {
 	if err != nil {
 		h.logger.Error("Failed to approve policy: %v (policy_id: %s)", err, id)
 		if strings.Contains(err.Error(), "not found") {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "policy_not_found",
-				Message: "Policy not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Policy not found")
 		}
 		if strings.Contains(err.Error(), "not in draft status") {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Error:   "invalid_policy_status",
-				Message: "Policy must be in draft status to approve",
-			})
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Policy must be in draft status to approve")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to approve policy",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to approve policy")
 	}
 
 	return c.JSON(SuccessResponse{
@@ -1509,43 +1608,34 @@ func (h *PolicyHandler) ApprovePolicy(c *fiber.Ctx) error {
 func (h *PolicyHandler) RollbackPolicy(c *fiber.Ctx) error {
 	id := c.Params("id")
 	if id == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Policy ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Policy ID is required")
 	}
 
 	var request struct {
 		Version string `json:"version"`
 	}
 	if err := c.BodyParser(&request); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Invalid JSON format",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid JSON format")
 	}
 
 	if request.Version == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Version is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Version is required")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
-	err := h.queries.Policy.RollbackPolicy(id, organizationID, request.Version)
+	before, err := h.queries.Policy.GetPolicy(id, organizationID)
+	if err == nil {
+		err = h.queries.Policy.RollbackPolicy(id, organizationID, request.Version)
+	}
 	if err != nil {
 		h.logger.Error("Failed to rollback policy: %v (policy_id: %s, version: %s)", err, id, request.Version)
 		if strings.Contains(err.Error(), "not found") {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "version_not_found",
-				Message: "Policy or version not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Policy or version not found")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to rollback policy",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to rollback policy")
+	}
+	if after, err := h.queries.Policy.GetPolicy(id, organizationID); err == nil {
+		auditChange(c, h.audit, organizationID, "rollback_policy", "policy", id, before, after)
 	}
 
 	return c.JSON(SuccessResponse{
@@ -1557,63 +1647,66 @@ func (h *PolicyHandler) RollbackPolicy(c *fiber.Ctx) error {
 // CheckPermission checks a single permission
 //
 //	@Summary	Check permission
-//	@Description	Check if a principal is allowed an action on a resource
+//	@Description	Check if a principal is allowed an action on a resource. Set explain to get the trace of which policies, permissions and shares were considered and which decided.
 //	@Tags		Authorization
 //	@Accept		json
 //	@Produce	json
 //	@Param		request	body	queries.PermissionCheckRequest	true	"Permission check request"
 //	@Success	200	{object}	queries.PermissionCheckResult	"Permission check completed"
 //	@Failure	400	{object}	ErrorResponse	"Invalid request"
+//	@Failure	403	{object}	ErrorResponse	"Explain requested for another principal by a non-admin"
 //	@Failure	500	{object}	ErrorResponse	"Internal server error"
 //	@Security	BearerAuth
 //	@Router		/authz/check [post]
 func (h *PolicyHandler) CheckPermission(c *fiber.Ctx) error {
 	var request queries.PermissionCheckRequest
 	if err := c.BodyParser(&request); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Invalid JSON format",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid JSON format")
 	}
 
 	if request.PrincipalID == "" || request.Resource == "" || request.Action == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "PrincipalID, Resource, and Action are required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "PrincipalID, Resource, and Action are required")
 	}
 
 	orgID := c.Locals("organization_id").(string)
 
 	// Convert structured context to map for evaluator
-	evalContext := make(map[string]interface{})
-	if request.Context != nil {
-		evalContext["principal"] = request.Context.Principal
-		evalContext["resource"] = request.Context.Resource
-		evalContext["action"] = request.Context.Action
-		evalContext["source_ip"] = request.Context.SourceIP
-		evalContext["request_time"] = request.Context.RequestTime
-		for k, v := range request.Context.Environment {
-			evalContext[k] = v
+	evalContext := request.Context.EvalContext()
+	if request.TokenScopes != nil {
+		evalContext["token_scopes"] = request.TokenScopes
+	}
+
+	// Traces name the policies that apply to a principal, so only admins may
+	// explain checks for someone else
+	if request.Explain && request.PrincipalID != c.Locals("user_id") {
+		if role, _ := c.Locals("role").(string); role != "admin" && role != "super_admin" {
+			return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only admins can explain permission checks for other principals")
 		}
 	}
 
-	decision, err := h.authz.Authorize(c.Context(), request.PrincipalID, request.PrincipalType, orgID, request.Action, request.Resource, evalContext)
+	var trace *authz.Trace
+	var err error
+	if request.Explain {
+		trace, err = h.authz.Explain(c.Context(), request.PrincipalID, request.PrincipalType, orgID, request.Action, request.Resource, evalContext)
+	} else {
+		var decision authz.Decision
+		decision, err = h.authz.Authorize(c.Context(), request.PrincipalID, request.PrincipalType, orgID, request.Action, request.Resource, evalContext)
+		trace = &authz.Trace{Decision: decision}
+	}
 	if err != nil {
 		h.logger.Error("Failed to check permission: %v", err)
 		h.audit.LogAccessCheck(c.Context(), orgID, request.PrincipalID, request.PrincipalType, "permission", request.Resource, request.Action, false, err.Error())
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to check permission",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to check permission")
 	}
 
 	result := queries.PermissionCheckResult{
-		Allowed:  decision == authz.DecisionAllow,
-		Decision: string(decision),
+		Allowed:  trace.Decision == authz.DecisionAllow,
+		Decision: string(trace.Decision),
 		Request:  &request,
 	}
+	if request.Explain {
+		result.Trace = trace
+	}
 
 	h.audit.LogAccessCheck(c.Context(), orgID, request.PrincipalID, request.PrincipalType, "permission", request.Resource, request.Action, result.Allowed, result.Decision)
 
@@ -1623,14 +1716,14 @@ func (h *PolicyHandler) CheckPermission(c *fiber.Ctx) error {
 // BulkCheckPermissions checks multiple permissions
 //
 //	@Summary	Bulk check permissions
-//	@Description	Check multiple action/resource pairs efficiently
+//	@Description	Check up to 200 action/resource pairs in one call, e.g. to render a permission-aware menu. The policies, resource permissions and shares of each principal are loaded once. Checks that cannot be decided get the "error" decision and an error message while the others are still answered, in request order.
 //	@Tags		Authorization
 //	@Accept		json
 //	@Produce	json
 //	@Param		request	body	object{requests=[]queries.PermissionCheckRequest}	true	"Bulk permission check request"
 //	@Success	200	{array}	queries.PermissionCheckResult	"Bulk permission check completed"
-//	@Failure	400	{object}	ErrorResponse	"Invalid request"
-//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Failure	400	{object}	ErrorResponse	"Invalid request or more than 200 checks"
+//	@Failure	403	{object}	ErrorResponse	"Explain requested for another principal by a non-admin"
 //	@Security	BearerAuth
 //	@Router		/authz/bulk-check [post]
 func (h *PolicyHandler) BulkCheckPermissions(c *fiber.Ctx) error {
@@ -1638,153 +1731,153 @@ func (h *PolicyHandler) BulkCheckPermissions(c *fiber.Ctx) error {
 		Requests []*queries.PermissionCheckRequest `json:"requests"`
 	}
 	if err := c.BodyParser(&request); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Invalid JSON format",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid JSON format")
 	}
 
 	if len(request.Requests) == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "At least one permission check request is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "At least one permission check request is required")
+	}
+	if len(request.Requests) > services.MaxBatchChecks {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed,
+			fmt.Sprintf("At most %d permission checks are allowed per request", services.MaxBatchChecks))
 	}
 
-	// Validate all requests
+	role, _ := c.Locals("role").(string)
 	for i, req := range request.Requests {
-		if req.PrincipalID == "" || req.Resource == "" || req.Action == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Error:   "invalid_request",
-				Message: fmt.Sprintf("Request %d: PrincipalID, Resource, and Action are required", i),
-			})
+		if req == nil {
+			request.Requests[i] = &queries.PermissionCheckRequest{}
+			continue
+		}
+		if req.Explain && req.PrincipalID != c.Locals("user_id") && role != "admin" && role != "super_admin" {
+			return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only admins can explain permission checks for other principals")
 		}
 	}
 
 	orgID := c.Locals("organization_id").(string)
-	results, err := h.queries.Policy.BulkCheckPermissions(orgID, request.Requests)
-	if err != nil {
-		h.logger.Error("Failed to bulk check permissions: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to check permissions",
-		})
-	}
+	return c.JSON(h.authz.AuthorizeBatch(c.Context(), orgID, request.Requests))
+}
 
-	return c.JSON(results)
+// effectivePermissionsPage is a page of a principal's effective permissions
+type effectivePermissionsPage struct {
+	*services.EffectivePermissions
+	Total   int  `json:"total"`
+	Limit   int  `json:"limit"`
+	Offset  int  `json:"offset"`
+	HasMore bool `json:"has_more"`
 }
 
-// GetEffectivePermissions retrieves effective permissions for current principal
+// GetEffectivePermissions lists the effective permissions of a principal
 //
 //	@Summary	Get effective permissions
-//	@Description	Retrieve effective permissions for authenticated principal
+//	@Description	List the deduplicated actions a principal is allowed per resource pattern, with the provenance of each grant: the policy statement and the role it is attached through (and the group the role is assigned to), or the resource permission or share. Actions an explicit deny covers outright are left out; denies are listed separately. Defaults to the caller; only admins may look up other principals.
 //	@Tags		Authorization
-//	@Accept		json
 //	@Produce	json
-//	@Param		principal_id	query	string	false	"Principal ID (if not provided, uses current user)"
-//	@Param		principal_type	query	string	false	"Principal type (user, group, role)"
-//	@Param		organization_id	query	string	false	"Organization ID"
-//	@Success	200	{object}	queries.EffectivePermissions	"Effective permissions retrieved"
+//	@Param		principal_id	query	string	false	"Principal ID (default: the caller)"
+//	@Param		principal_type	query	string	false	"Principal type (user, service_account, group; default user)"
+//	@Param		service	query	string	false	"Only list actions of this service, e.g. blog"
+//	@Param		limit	query	int	false	"Resource patterns per page (default 50, max 200)"
+//	@Param		offset	query	int	false	"Resource patterns to skip (default 0)"
+//	@Success	200	{object}	effectivePermissionsPage	"Effective permissions retrieved"
 //	@Failure	400	{object}	ErrorResponse	"Invalid request"
+//	@Failure	403	{object}	ErrorResponse	"Another principal requested by a non-admin"
 //	@Failure	500	{object}	ErrorResponse	"Internal server error"
 //	@Security	BearerAuth
 //	@Router		/authz/effective-permissions [get]
 func (h *PolicyHandler) GetEffectivePermissions(c *fiber.Ctx) error {
-	// TODO: Get these from JWT context if not provided
-	principalID := c.Query("principal_id", "current_user_id")
+	userID, _ := c.Locals("user_id").(string)
+	principalID := c.Query("principal_id", userID)
 	principalType := c.Query("principal_type", "user")
-	organizationID := c.Query("organization_id", "")
-	if organizationID == "" {
-		if orgID := c.Locals("organization_id"); orgID != nil {
-			organizationID = orgID.(string)
-		}
-	}
+	limit := c.QueryInt("limit", 50)
+	offset := c.QueryInt("offset", 0)
 
 	if principalID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Principal ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Principal ID is required")
+	}
+	if limit < 1 || limit > 200 {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "limit must be 1-200")
+	}
+	if offset < 0 {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "offset must be >=0")
+	}
+	// Effective permissions reveal how a principal is set up, so only
+	// admins may look at anyone but themselves
+	if principalID != userID || principalType != "user" {
+		if role, _ := c.Locals("role").(string); role != "admin" && role != "super_admin" {
+			return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only admins can view the permissions of other principals")
+		}
 	}
 
-	permissions, err := h.queries.Policy.GetEffectivePermissions(principalID, principalType, organizationID)
+	orgID := c.Locals("organization_id").(string)
+	permissions, err := h.authz.EffectivePermissions(c.Context(), orgID, principalID, principalType, c.Query("service"))
 	if err != nil {
 		h.logger.Error("Failed to get effective permissions: %v (principal_id: %s)", err, principalID)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to retrieve effective permissions",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve effective permissions")
 	}
 
-	return c.JSON(permissions)
+	total := len(permissions.Permissions)
+	start, end := offset, offset+limit
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+	permissions.Permissions = permissions.Permissions[start:end]
+	return c.JSON(effectivePermissionsPage{
+		EffectivePermissions: permissions,
+		Total:                total,
+		Limit:                limit,
+		Offset:               offset,
+		HasMore:              end < total,
+	})
 }
 
 // SimulateAccess simulates an access request
 //
 //	@Summary	Simulate access
-//	@Description	Simulate an access decision for a hypothetical request
+//	@Description	Simulate an access decision for a hypothetical request, with the full decision trace and a statement-by-statement report for every policy. Without policy_document the principal's existing policies, resource permissions and shares are evaluated. With it, the unsaved candidate policy is evaluated alone, or as if attached to the principal when include_existing is set. Nothing is saved or logged.
 //	@Tags		Authorization
 //	@Accept		json
 //	@Produce	json
-//	@Param		request	body	queries.PermissionCheckRequest	true	"Access simulation request"
-//	@Success	200	{object}	queries.PermissionCheckResult	"Access simulation completed"
+//	@Param		request	body	queries.AccessSimulationRequest	true	"Access simulation request"
+//	@Success	200	{object}	services.AccessSimulationResult	"Access simulation completed"
 //	@Failure	400	{object}	ErrorResponse	"Invalid request"
+//	@Failure	403	{object}	ErrorResponse	"Simulation for another principal requested by a non-admin"
 //	@Failure	500	{object}	ErrorResponse	"Internal server error"
 //	@Security	BearerAuth
 //	@Router		/authz/simulate-access [post]
 func (h *PolicyHandler) SimulateAccess(c *fiber.Ctx) error {
-	var request queries.PermissionCheckRequest
+	var request queries.AccessSimulationRequest
 	if err := c.BodyParser(&request); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Invalid JSON format",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid JSON format")
 	}
 
-	if request.PrincipalID == "" || request.Resource == "" || request.Action == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "PrincipalID, Resource, and Action are required",
-		})
+	if request.Resource == "" || request.Action == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Resource and Action are required")
+	}
+	usesExisting := request.PolicyDocument == "" || request.IncludeExisting
+	if usesExisting && request.PrincipalID == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "PrincipalID is required unless simulating a candidate policy on its own")
+	}
+	if request.PolicyDocument != "" {
+		if err := authz.ValidateDocument(request.PolicyDocument); err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, err.Error())
+		}
 	}
 
-	// Simulation is essentially the same as checking permission but in a "what-if" context
-	orgID := c.Locals("organization_id").(string)
-
-	// Convert structured context to map for evaluator
-	evalContext := make(map[string]interface{})
-	if request.Context != nil {
-		evalContext["principal"] = request.Context.Principal
-		evalContext["resource"] = request.Context.Resource
-		evalContext["action"] = request.Context.Action
-		evalContext["source_ip"] = request.Context.SourceIP
-		evalContext["request_time"] = request.Context.RequestTime
-		for k, v := range request.Context.Environment {
-			evalContext[k] = v
+	// Like explained checks, simulations reveal another principal's
+	// policies, so only admins may run them for someone else
+	if usesExisting && request.PrincipalID != c.Locals("user_id") {
+		if role, _ := c.Locals("role").(string); role != "admin" && role != "super_admin" {
+			return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only admins can simulate access for other principals")
 		}
 	}
 
-	decision, err := h.authz.Authorize(c.Context(), request.PrincipalID, request.PrincipalType, orgID, request.Action, request.Resource, evalContext)
+	orgID := c.Locals("organization_id").(string)
+	result, err := h.authz.Simulate(c.Context(), orgID, &request)
 	if err != nil {
 		h.logger.Error("Failed to simulate access: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to simulate access",
-		})
-	}
-
-	result := queries.PermissionCheckResult{
-		Allowed:  decision == authz.DecisionAllow,
-		Decision: string(decision),
-		Request:  &request,
-		Evaluation: &queries.PolicyEvaluationResult{
-			Effect:   string(decision),
-			Decision: string(decision),
-			Metadata: map[string]string{
-				"simulation": "true",
-			},
-		},
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to simulate access")
 	}
 
 	return c.JSON(result)
@@ -1792,13 +1885,17 @@ func (h *PolicyHandler) SimulateAccess(c *fiber.Ctx) error {
 
 // RoleHandler handles role-related operations
 type RoleHandler struct {
-	db      *database.DB
-	redis   *redis.Client
-	logger  *logger.Logger
-	queries *queries.Queries
+	db         *database.DB
+	redis      redis.UniversalClient
+	logger     *logger.Logger
+	queries    *queries.Queries
+	events     events.Bus                 // set via SetEvents
+	audit      services.AuditService      // set via SetAudit after construction
+	principals services.PrincipalResolver // set via SetPrincipals
+	authz      services.AuthzService      // set via SetAuthz after construction
 }
 
-func NewRoleHandler(db *database.DB, redis *redis.Client, logger *logger.Logger) *RoleHandler {
+func NewRoleHandler(db *database.DB, redis redis.UniversalClient, logger *logger.Logger) *RoleHandler {
 	return &RoleHandler{
 		db:      db,
 		redis:   redis,
@@ -1807,6 +1904,24 @@ func NewRoleHandler(db *database.DB, redis *redis.Client, logger *logger.Logger)
 	}
 }
 
+// SetEvents injects the bus role assignments are published on. Called
+// from route setup.
+func (h *RoleHandler) SetEvents(bus events.Bus) {
+	h.events = bus
+}
+
+// SetAudit injects the audit log role changes are recorded in. Called from
+// route setup.
+func (h *RoleHandler) SetAudit(audit services.AuditService) {
+	h.audit = audit
+}
+
+// SetAuthz injects the authorization service the permissions of delegated
+// administrators are resolved with. Called from route setup.
+func (h *RoleHandler) SetAuthz(authz services.AuthzService) {
+	h.authz = authz
+}
+
 // ListRoles lists all roles with pagination and filtering
 //
 //	@Summary		List roles
@@ -1815,6 +1930,7 @@ func NewRoleHandler(db *database.DB, redis *redis.Client, logger *logger.Logger)
 //	@Accept			json
 //	@Produce		json
 //	@Param			limit	query		int		false	"Number of roles to return (default: 50)"
+//	@Param			cursor	query		string	false	"Opaque cursor from next_cursor of the previous page; overrides offset"
 //	@Param			offset	query		int		false	"Number of roles to skip (default: 0)"
 //	@Param			sort	query		string	false	"Sort by field (name, created_at, updated_at, role_type)"
 //	@Param			order	query		string	false	"Sort order (asc, desc)"
@@ -1832,19 +1948,11 @@ func (h *RoleHandler) ListRoles(c *fiber.Ctx) error {
 
 	// Validate parameters
 	if limit < 1 || limit > 1000 {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "invalid_limit",
-			Message: "Limit must be between 1 and 1000",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Limit must be between 1 and 1000")
 	}
 
 	if offset < 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "invalid_offset",
-			Message: "Offset must be non-negative",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Offset must be non-negative")
 	}
 
 	params := queries.ListParams{
@@ -1852,18 +1960,18 @@ func (h *RoleHandler) ListRoles(c *fiber.Ctx) error {
 		Offset: offset,
 		SortBy: sortBy,
 		Order:  order,
+		Cursor: c.Query("cursor"),
 	}
 
 	// Call query layer
 	organizationID := c.Locals("organization_id").(string)
 	result, err := h.queries.Role.ListRoles(params, organizationID)
 	if err != nil {
+		if isInvalidCursorErr(err) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid pagination cursor")
+		}
 		h.logger.Error("Failed to list roles: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to retrieve roles",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve roles")
 	}
 
 	return c.JSON(SuccessResponse{
@@ -1892,28 +2000,16 @@ func (h *RoleHandler) CreateRole(c *fiber.Ctx) error {
 
 	// Parse request body
 	if err := c.BodyParser(&role); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "invalid_request_body",
-			Message: "Failed to parse request body",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
 	}
 
 	// Validate required fields
 	if role.Name == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "validation_failed",
-			Message: "Role name is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Role name is required")
 	}
 
 	if role.OrganizationID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "validation_failed",
-			Message: "Organization ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Organization ID is required")
 	}
 
 	// Set defaults
@@ -1946,21 +2042,14 @@ func (h *RoleHandler) CreateRole(c *fiber.Ctx) error {
 	err := h.queries.Role.CreateRole(&role)
 	if err != nil {
 		if err.Error() == "role already exists" {
-			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{
-				Status:  fiber.StatusConflict,
-				Error:   "role_exists",
-				Message: "Role with this name already exists in the organization",
-			})
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "Role with this name already exists in the organization")
 		}
 		h.logger.Error("Failed to create role: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to create role",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create role")
 	}
 
 	h.logger.Info("Role created successfully: %s", role.ID)
+	auditChange(c, h.audit, role.OrganizationID, "create_role", "role", role.ID, nil, &role)
 
 	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
 		Status:  fiber.StatusCreated,
@@ -1986,11 +2075,7 @@ func (h *RoleHandler) CreateRole(c *fiber.Ctx) error {
 func (h *RoleHandler) GetRole(c *fiber.Ctx) error {
 	roleID := c.Params("id")
 	if roleID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "invalid_role_id",
-			Message: "Role ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Role ID is required")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
@@ -1998,18 +2083,10 @@ func (h *RoleHandler) GetRole(c *fiber.Ctx) error {
 	role, err := h.queries.Role.GetRole(roleID, organizationID)
 	if err != nil {
 		if err.Error() == "role not found" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Status:  fiber.StatusNotFound,
-				Error:   "role_not_found",
-				Message: "Role not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Role not found")
 		}
 		h.logger.Error("Failed to get role: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to retrieve role",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve role")
 	}
 
 	return c.JSON(SuccessResponse{
@@ -2037,22 +2114,14 @@ func (h *RoleHandler) GetRole(c *fiber.Ctx) error {
 func (h *RoleHandler) UpdateRole(c *fiber.Ctx) error {
 	roleID := c.Params("id")
 	if roleID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "invalid_role_id",
-			Message: "Role ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Role ID is required")
 	}
 
 	var roleUpdates models.Role
 
 	// Parse request body
 	if err := c.BodyParser(&roleUpdates); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "invalid_request_body",
-			Message: "Failed to parse request body",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
 	}
 
 	// Set the ID from URL parameter
@@ -2065,21 +2134,14 @@ func (h *RoleHandler) UpdateRole(c *fiber.Ctx) error {
 	existingRole, err := h.queries.Role.GetRole(roleID, organizationID)
 	if err != nil {
 		if err.Error() == "role not found" || err.Error() == "role not found or already deleted" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Status:  fiber.StatusNotFound,
-				Error:   "role_not_found",
-				Message: "Role not found or already deleted",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Role not found or already deleted")
 		}
 		h.logger.Error("Failed to fetch existing role for update: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to update role",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update role")
 	}
 
 	// Merge updates into existing role
+	before := *existingRole
 	existingRole.Name = roleUpdates.Name
 	if roleUpdates.Description != nil {
 		existingRole.Description = roleUpdates.Description
@@ -2091,21 +2153,14 @@ func (h *RoleHandler) UpdateRole(c *fiber.Ctx) error {
 	err = h.queries.Role.UpdateRole(existingRole, organizationID)
 	if err != nil {
 		if err.Error() == "role not found or already deleted" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Status:  fiber.StatusNotFound,
-				Error:   "role_not_found",
-				Message: "Role not found or already deleted",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Role not found or already deleted")
 		}
 		h.logger.Error("Failed to update role: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to update role",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update role")
 	}
 
 	h.logger.Info("Role updated successfully: %s", roleID)
+	auditChange(c, h.audit, organizationID, "update_role", "role", roleID, &before, existingRole)
 
 	return c.JSON(SuccessResponse{
 		Status:  fiber.StatusOK,
@@ -2131,11 +2186,7 @@ func (h *RoleHandler) UpdateRole(c *fiber.Ctx) error {
 func (h *RoleHandler) DeleteRole(c *fiber.Ctx) error {
 	roleID := c.Params("id")
 	if roleID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "invalid_role_id",
-			Message: "Role ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Role ID is required")
 	}
 
 	// Call query layer
@@ -2145,46 +2196,27 @@ func (h *RoleHandler) DeleteRole(c *fiber.Ctx) error {
 	existingRole, err := h.queries.Role.GetRole(roleID, organizationID)
 	if err != nil {
 		if err.Error() == "role not found" || err.Error() == "role not found or already deleted" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Status:  fiber.StatusNotFound,
-				Error:   "role_not_found",
-				Message: "Role not found or already deleted",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Role not found or already deleted")
 		}
 		h.logger.Error("Failed to fetch role for delete check: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to delete role",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to delete role")
 	}
 
 	if existingRole.Name == "admin" {
-		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{
-			Status:  fiber.StatusForbidden,
-			Error:   "cannot_delete_admin_role",
-			Message: "The admin role cannot be deleted",
-		})
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "The admin role cannot be deleted")
 	}
 
 	err = h.queries.Role.DeleteRole(roleID, organizationID)
 	if err != nil {
 		if err.Error() == "role not found or already deleted" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Status:  fiber.StatusNotFound,
-				Error:   "role_not_found",
-				Message: "Role not found or already deleted",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Role not found or already deleted")
 		}
 		h.logger.Error("Failed to delete role: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to delete role",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to delete role")
 	}
 
 	h.logger.Info("Role deleted successfully: %s", roleID)
+	auditChange(c, h.audit, organizationID, "delete_role", "role", roleID, existingRole, nil)
 
 	return c.JSON(SuccessResponse{
 		Status:  fiber.StatusOK,
@@ -2196,11 +2228,7 @@ func (h *RoleHandler) DeleteRole(c *fiber.Ctx) error {
 func (h *RoleHandler) GetRolePolicies(c *fiber.Ctx) error {
 	roleID := c.Params("id")
 	if roleID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "invalid_role_id",
-			Message: "Role ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Role ID is required")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
@@ -2209,28 +2237,16 @@ func (h *RoleHandler) GetRolePolicies(c *fiber.Ctx) error {
 	// Ensure role exists (optional but provides clearer 404)
 	if _, err := h.queries.Role.GetRole(roleID, organizationID); err != nil {
 		if err.Error() == "role not found" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Status:  fiber.StatusNotFound,
-				Error:   "role_not_found",
-				Message: "Role not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Role not found")
 		}
 		h.logger.Error("Failed to verify role existence: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to retrieve role policies",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve role policies")
 	}
 
 	policies, err := h.queries.Role.GetRolePolicies(roleID, organizationID)
 	if err != nil {
 		h.logger.Error("Failed to get role policies: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to retrieve role policies",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve role policies")
 	}
 
 	h.logger.Info("Retrieved %d policies for role: %s", len(policies), roleID)
@@ -2249,11 +2265,7 @@ func (h *RoleHandler) GetRolePolicies(c *fiber.Ctx) error {
 func (h *RoleHandler) AttachPolicyToRole(c *fiber.Ctx) error {
 	roleID := c.Params("id")
 	if roleID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "invalid_role_id",
-			Message: "Role ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Role ID is required")
 	}
 
 	type attachRequest struct {
@@ -2263,18 +2275,10 @@ func (h *RoleHandler) AttachPolicyToRole(c *fiber.Ctx) error {
 
 	var req attachRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "invalid_request_body",
-			Message: "Failed to parse request body",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
 	}
 	if req.PolicyID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "validation_failed",
-			Message: "policy_id is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "policy_id is required")
 	}
 	// Attempt to derive attached_by from context (set by auth middleware) if not provided
 	if req.AttachedBy == "" {
@@ -2288,11 +2292,7 @@ func (h *RoleHandler) AttachPolicyToRole(c *fiber.Ctx) error {
 	if err != nil {
 		switch err.Error() {
 		case "role or policy not found":
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Status:  fiber.StatusNotFound,
-				Error:   "role_or_policy_not_found",
-				Message: "Role or policy not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Role or policy not found")
 		case "policy already attached to role":
 			// Treat as idempotent success (could also choose 409)
 			return c.Status(fiber.StatusOK).JSON(SuccessResponse{
@@ -2306,11 +2306,7 @@ func (h *RoleHandler) AttachPolicyToRole(c *fiber.Ctx) error {
 			})
 		default:
 			h.logger.Error("Failed to attach policy to role: %v", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-				Status:  fiber.StatusInternalServerError,
-				Error:   "internal_server_error",
-				Message: "Failed to attach policy to role",
-			})
+			return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to attach policy to role")
 		}
 	}
 
@@ -2330,29 +2326,17 @@ func (h *RoleHandler) DetachPolicyFromRole(c *fiber.Ctx) error {
 	roleID := c.Params("id")
 	policyID := c.Params("policy_id")
 	if roleID == "" || policyID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "invalid_parameters",
-			Message: "Role ID and policy ID are required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Role ID and policy ID are required")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
 	err := h.queries.Role.DetachPolicyFromRole(roleID, policyID, organizationID)
 	if err != nil {
 		if err.Error() == "policy not attached to role" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Status:  fiber.StatusNotFound,
-				Error:   "policy_not_attached",
-				Message: "Policy not attached to role",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Policy not attached to role")
 		}
 		h.logger.Error("Failed to detach policy from role: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to detach policy from role",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to detach policy from role")
 	}
 
 	h.logger.Info("Policy %s detached from role %s", policyID, roleID)
@@ -2370,40 +2354,24 @@ func (h *RoleHandler) DetachPolicyFromRole(c *fiber.Ctx) error {
 func (h *RoleHandler) GetRoleAssignments(c *fiber.Ctx) error {
 	roleID := c.Params("id")
 	if roleID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "invalid_role_id",
-			Message: "Role ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Role ID is required")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
 	// Validate role exists
 	if _, err := h.queries.Role.GetRole(roleID, organizationID); err != nil {
 		if err.Error() == "role not found" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Status:  fiber.StatusNotFound,
-				Error:   "role_not_found",
-				Message: "Role not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Role not found")
 		}
 		h.logger.Error("Failed to verify role existence: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to retrieve role assignments",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve role assignments")
 	}
 
 	// organizationID is already declared above via c.Locals
 	assignments, err := h.queries.Role.GetRoleAssignments(roleID, organizationID)
 	if err != nil {
 		h.logger.Error("Failed to get role assignments: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to retrieve role assignments",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve role assignments")
 	}
 
 	h.logger.Info("Retrieved %d assignments for role: %s", len(assignments), roleID)
@@ -2422,11 +2390,7 @@ func (h *RoleHandler) GetRoleAssignments(c *fiber.Ctx) error {
 func (h *RoleHandler) AssignRole(c *fiber.Ctx) error {
 	roleID := c.Params("id")
 	if roleID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "invalid_role_id",
-			Message: "Role ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Role ID is required")
 	}
 
 	type assignRequest struct {
@@ -2438,28 +2402,11 @@ func (h *RoleHandler) AssignRole(c *fiber.Ctx) error {
 
 	var req assignRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "invalid_request_body",
-			Message: "Failed to parse request body",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
 	}
 
 	if req.PrincipalID == "" || req.PrincipalType == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "validation_failed",
-			Message: "principal_id and principal_type are required",
-		})
-	}
-
-	allowedPrincipalTypes := map[string]bool{"user": true, "service_account": true}
-	if !allowedPrincipalTypes[req.PrincipalType] {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "invalid_principal_type",
-			Message: "principal_type must be 'user' or 'service_account'",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "principal_id and principal_type are required")
 	}
 
 	// Parse expires_at if provided
@@ -2467,11 +2414,7 @@ func (h *RoleHandler) AssignRole(c *fiber.Ctx) error {
 	if req.ExpiresAt != "" {
 		t, err := time.Parse(time.RFC3339, req.ExpiresAt)
 		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Status:  fiber.StatusBadRequest,
-				Error:   "invalid_expires_at",
-				Message: "expires_at must be RFC3339 format",
-			})
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "expires_at must be RFC3339 format")
 		}
 		expiresAt = &t
 	}
@@ -2498,26 +2441,43 @@ func (h *RoleHandler) AssignRole(c *fiber.Ctx) error {
 	}
 
 	organizationID := c.Locals("organization_id").(string)
+	if p, err := resolvePrincipal(c, h.principals, h.logger, organizationID, req.PrincipalID, req.PrincipalType, "user", "service_account"); p == nil {
+		return err
+	}
+	if refused, err := h.refuseRoleEscalation(c, roleID, organizationID); refused {
+		return err
+	}
+	if role, err := h.queries.Role.GetRole(roleID, organizationID); err == nil && role != nil {
+		conflicts, err := services.SoDConflicts(c.Context(), h.queries, organizationID, req.PrincipalID, req.PrincipalType, []string{role.Name})
+		if err != nil {
+			h.logger.Error("Failed to check separation of duties: %v", err)
+			return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to assign role")
+		}
+		if len(conflicts) > 0 {
+			return sodViolation(c, conflicts)
+		}
+	}
 	err := h.queries.Role.AssignRole(assignment, organizationID)
 	if err != nil {
 		switch err.Error() {
 		case "role or principal not found":
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Status:  fiber.StatusNotFound,
-				Error:   "role_or_principal_not_found",
-				Message: "Role or principal not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Role or principal not found")
 		default:
 			h.logger.Error("Failed to assign role: %v", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-				Status:  fiber.StatusInternalServerError,
-				Error:   "internal_server_error",
-				Message: "Failed to assign role",
-			})
+			return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to assign role")
 		}
 	}
 
 	h.logger.Info("Role %s assigned to principal %s (%s)", roleID, req.PrincipalID, req.PrincipalType)
+	publish(h.events, c, events.Event{
+		Type:    events.RoleAssigned,
+		Subject: req.PrincipalID,
+		Data: map[string]interface{}{
+			"role_id":        roleID,
+			"principal_type": req.PrincipalType,
+			"expires_at":     expiresAt,
+		},
+	})
 	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
 		Status:  fiber.StatusCreated,
 		Message: "Role assigned successfully",
@@ -2529,29 +2489,20 @@ func (h *RoleHandler) UnassignRole(c *fiber.Ctx) error {
 	roleID := c.Params("id")
 	principalID := c.Params("user_id") // route uses :user_id though it may be service account - keep param name
 	if roleID == "" || principalID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "invalid_parameters",
-			Message: "Role ID and principal ID are required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Role ID and principal ID are required")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
+	if refused, err := h.refuseRoleEscalation(c, roleID, organizationID); refused {
+		return err
+	}
 	err := h.queries.Role.UnassignRole(roleID, principalID, organizationID)
 	if err != nil {
 		if err.Error() == "role assignment not found" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Status:  fiber.StatusNotFound,
-				Error:   "role_assignment_not_found",
-				Message: "Role assignment not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Role assignment not found")
 		}
 		h.logger.Error("Failed to unassign role: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to unassign role",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to unassign role")
 	}
 
 	h.logger.Info("Role %s unassigned from principal %s", roleID, principalID)
@@ -2566,15 +2517,68 @@ func (h *RoleHandler) UnassignRole(c *fiber.Ctx) error {
 	})
 }
 
+// refuseRoleEscalation responds 403 when a delegated administrator, who
+// may assign roles without being an admin, tries to hand out or take away a
+// role granting something they do not hold themselves, such as admin or
+// policy-admin for a user-admin
+func (h *RoleHandler) refuseRoleEscalation(c *fiber.Ctx, roleID, organizationID string) (bool, error) {
+	if role, _ := c.Locals("role").(string); role == "admin" {
+		return false, nil
+	}
+	if tc := middleware.GetTenantContext(c); tc != nil && tc.IsRoot {
+		return false, nil
+	}
+
+	// Unknown roles have no policies and are reported by the assignment
+	// itself
+	policies, err := h.queries.Role.WithContext(c.Context()).GetRolePolicies(roleID, organizationID)
+	if err != nil {
+		h.logger.Error("Failed to get role policies: %v", err)
+		return true, apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to check the role's permissions")
+	}
+	var rules []authz.Rule
+	for _, p := range policies {
+		policyRules, err := authz.PolicyRules(p.Document, authz.Grant{Source: authz.SourcePolicy, ID: p.ID, Name: p.Name})
+		if err != nil {
+			continue // Malformed policies never apply
+		}
+		rules = append(rules, policyRules...)
+	}
+	if len(rules) == 0 {
+		return false, nil
+	}
+	if h.authz == nil {
+		return true, apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only admins can assign or unassign roles with permissions")
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	principalType, _ := c.Locals("principal_type").(string)
+	if principalType == "" {
+		principalType = "user"
+	}
+	held, err := h.authz.EffectivePermissions(c.Context(), organizationID, userID, principalType, "")
+	if err != nil {
+		h.logger.Error("Failed to resolve effective permissions: %v", err)
+		return true, apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to check the role's permissions")
+	}
+	if missing := authz.Exceeding(held.Permissions, held.Denied, rules); len(missing) > 0 {
+		return true, apiError(c, fiber.StatusForbidden, apierror.CodeForbidden,
+			"Only admins can assign or unassign roles granting permissions you do not hold",
+			fiber.Map{"missing_actions": missing})
+	}
+	return false, nil
+}
+
 // SessionHandler handles session-related operations
 type SessionHandler struct {
 	db      *database.DB
-	redis   *redis.Client
+	redis   redis.UniversalClient
 	logger  *logger.Logger
 	queries *queries.Queries
+	events  events.Bus // set via SetEvents
 }
 
-func NewSessionHandler(db *database.DB, redis *redis.Client, logger *logger.Logger) *SessionHandler {
+func NewSessionHandler(db *database.DB, redis redis.UniversalClient, logger *logger.Logger) *SessionHandler {
 	return &SessionHandler{
 		db:      db,
 		redis:   redis,
@@ -2583,17 +2587,26 @@ func NewSessionHandler(db *database.DB, redis *redis.Client, logger *logger.Logg
 	}
 }
 
-// ListSessions lists active sessions for the authenticated principal
+// SetEvents injects the bus session revocations are published on. Called
+// from route setup.
+func (h *SessionHandler) SetEvents(bus events.Bus) {
+	h.events = bus
+}
+
+// ListSessions lists the sessions of the authenticated principal, by
+// default the active ones
 //
 //	@Summary	List sessions
-//	@Description	Retrieve sessions associated with the current principal
+//	@Description	Retrieve sessions associated with the current principal. Sessions that were idle too long or reached their maximum lifetime are listed with status expired.
 //	@Tags		Session Management
 //	@Accept		json
 //	@Produce	json
 //	@Param		limit	query	int	false	"Number of sessions per page (default: 50)"
+//	@Param		cursor	query	string	false	"Opaque cursor from next_cursor of the previous page; overrides offset"
 //	@Param		offset	query	int	false	"Number of sessions to skip (default: 0)"
 //	@Param		sort_by	query	string	false	"Field to sort by (last_used_at, issued_at, expires_at)"
 //	@Param		order	query	string	false	"Sort order (asc, desc)"
+//	@Param		status	query	string	false	"Session status (active, expired, revoked, all; default: active)"
 //	@Success	200	{object}	SuccessResponse	"Sessions listed successfully"
 //	@Failure	400	{object}	ErrorResponse	"Invalid request parameters"
 //	@Failure	500	{object}	ErrorResponse	"Internal server error"
@@ -2626,14 +2639,27 @@ func (h *SessionHandler) ListSessions(c *fiber.Ctx) error {
 	principalID := c.Locals("user_id").(string)
 	principalType := "user" // Default to user for now
 
+	params.Cursor = c.Query("cursor")
+
+	status := queries.SessionStatusActive
+	switch c.Query("status") {
+	case "", queries.SessionStatusActive:
+	case queries.SessionStatusExpired, queries.SessionStatusRevoked:
+		status = c.Query("status")
+	case "all":
+		status = ""
+	default:
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "status must be active, expired, revoked or all")
+	}
+
 	orgID := c.Locals("organization_id").(string)
-	result, err := h.queries.Session.ListSessions(params, orgID, principalID, principalType)
+	result, err := h.queries.Session.ListSessions(params, orgID, principalID, principalType, status)
 	if err != nil {
+		if isInvalidCursorErr(err) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid pagination cursor")
+		}
 		h.logger.Error("Failed to list sessions: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to list sessions",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list sessions")
 	}
 
 	return c.JSON(result)
@@ -2655,10 +2681,7 @@ func (h *SessionHandler) GetCurrentSession(c *fiber.Ctx) error {
 	// Get session ID from JWT JTI claim (set by auth middleware)
 	sessionID, _ := c.Locals("session_id").(string)
 	if sessionID == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
-			Error:   "no_session",
-			Message: "No active session found",
-		})
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "No active session found")
 	}
 
 	orgID := c.Locals("organization_id").(string)
@@ -2666,15 +2689,9 @@ func (h *SessionHandler) GetCurrentSession(c *fiber.Ctx) error {
 	if err != nil {
 		h.logger.Error("Failed to get current session: %v (session_id: %s)", err, sessionID)
 		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "expired") {
-			return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
-				Error:   "session_invalid",
-				Message: "Session not found or expired",
-			})
+			return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Session not found or expired")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to retrieve session",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve session")
 	}
 
 	// Update last used timestamp
@@ -2703,10 +2720,7 @@ func (h *SessionHandler) RevokeCurrentSession(c *fiber.Ctx) error {
 	// Get session ID from JWT JTI claim (set by auth middleware)
 	sessionID, _ := c.Locals("session_id").(string)
 	if sessionID == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
-			Error:   "no_session",
-			Message: "No active session found",
-		})
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "No active session found")
 	}
 
 	orgID := c.Locals("organization_id").(string)
@@ -2714,16 +2728,15 @@ func (h *SessionHandler) RevokeCurrentSession(c *fiber.Ctx) error {
 	if err != nil {
 		h.logger.Error("Failed to revoke current session: %v (session_id: %s)", err, sessionID)
 		if strings.Contains(err.Error(), "not found") {
-			return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
-				Error:   "session_not_found",
-				Message: "Session not found",
-			})
+			return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Session not found")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to revoke session",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to revoke session")
 	}
+	publish(h.events, c, events.Event{
+		Type:    events.SessionRevoked,
+		Subject: c.Locals("user_id").(string),
+		Data:    map[string]interface{}{"session_id": sessionID},
+	})
 
 	return c.JSON(SuccessResponse{
 		Status:  200,
@@ -2749,10 +2762,7 @@ func (h *SessionHandler) RevokeCurrentSession(c *fiber.Ctx) error {
 func (h *SessionHandler) GetSession(c *fiber.Ctx) error {
 	sessionID := c.Params("id")
 	if sessionID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Session ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Session ID is required")
 	}
 
 	orgID := c.Locals("organization_id").(string)
@@ -2760,15 +2770,9 @@ func (h *SessionHandler) GetSession(c *fiber.Ctx) error {
 	if err != nil {
 		h.logger.Error("Failed to get session: %v (session_id: %s)", err, sessionID)
 		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "expired") {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "session_not_found",
-				Message: "Session not found or expired",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Session not found or expired")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to retrieve session",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve session")
 	}
 
 	// Check if current user can access this session
@@ -2778,10 +2782,7 @@ func (h *SessionHandler) GetSession(c *fiber.Ctx) error {
 		// Allow admin users to view any session
 		userRole := c.Locals("role").(string)
 		if userRole != "admin" && userRole != "super_admin" {
-			return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{
-				Error:   "access_denied",
-				Message: "You can only view your own sessions",
-			})
+			return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "You can only view your own sessions")
 		}
 	}
 
@@ -2809,10 +2810,7 @@ func (h *SessionHandler) GetSession(c *fiber.Ctx) error {
 func (h *SessionHandler) RevokeSession(c *fiber.Ctx) error {
 	sessionID := c.Params("id")
 	if sessionID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Session ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Session ID is required")
 	}
 
 	// First check if session exists
@@ -2821,25 +2819,16 @@ func (h *SessionHandler) RevokeSession(c *fiber.Ctx) error {
 	if err != nil {
 		h.logger.Error("Failed to find session for revocation: %v (session_id: %s)", err, sessionID)
 		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "expired") {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "session_not_found",
-				Message: "Session not found or expired",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Session not found or expired")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to retrieve session",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve session")
 	}
 
 	// Check authorization - admin can revoke any session, users can revoke their own
 	currentUserID := c.Locals("user_id").(string)
 	userRole := c.Locals("role").(string)
 	if userRole != "admin" && userRole != "super_admin" && session.PrincipalID != currentUserID {
-		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{
-			Error:   "access_denied",
-			Message: "You can only revoke your own sessions",
-		})
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "You can only revoke your own sessions")
 	}
 
 	// Blacklist the token associated with this session
@@ -2858,7 +2847,7 @@ func (h *SessionHandler) RevokeSession(c *fiber.Ctx) error {
 
 					ttl := time.Until(time.Unix(exp, 0))
 					if ttl > 0 {
-						if err := h.redis.Set(c.Context(), "blacklist:jti:"+jti, "revoked", ttl).Err(); err != nil {
+						if err := h.redis.Set(c.Context(), "blacklist:"+jti, "revoked", ttl).Err(); err != nil {
 							h.logger.Error("Failed to blacklist JTI %s: %v", jti, err)
 						} else {
 							h.logger.Info("Blacklisted JTI %s for revoked session %s", jti, sessionID)
@@ -2873,9 +2862,13 @@ func (h *SessionHandler) RevokeSession(c *fiber.Ctx) error {
 	err = h.queries.Session.RevokeSession(sessionID, orgID)
 	if err != nil {
 		h.logger.Error("Failed to revoke session: %v (session_id: %s)", err, sessionID)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to revoke session",
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to revoke session")
+	}
+	if session.PrincipalType == "user" {
+		publish(h.events, c, events.Event{
+			Type:    events.SessionRevoked,
+			Subject: session.PrincipalID,
+			Data:    map[string]interface{}{"session_id": sessionID},
 		})
 	}
 
@@ -2904,10 +2897,7 @@ func (h *SessionHandler) RevokeSession(c *fiber.Ctx) error {
 func (h *SessionHandler) ExtendSession(c *fiber.Ctx) error {
 	sessionID := c.Params("id")
 	if sessionID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Session ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Session ID is required")
 	}
 
 	var request struct {
@@ -2921,10 +2911,7 @@ func (h *SessionHandler) ExtendSession(c *fiber.Ctx) error {
 	// Parse duration
 	duration, err := time.ParseDuration(request.Duration)
 	if err != nil || duration <= 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_duration",
-			Message: "Invalid duration format. Use formats like '2h', '30m', '1h30m'",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid duration format. Use formats like '2h', '30m', '1h30m'")
 	}
 
 	// Limit maximum extension to prevent abuse
@@ -2938,15 +2925,9 @@ func (h *SessionHandler) ExtendSession(c *fiber.Ctx) error {
 	if err != nil {
 		h.logger.Error("Failed to find session for extension: %v (session_id: %s)", err, sessionID)
 		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "expired") {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "session_not_found",
-				Message: "Session not found or expired",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Session not found or expired")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to retrieve session",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve session")
 	}
 
 	// Check authorization - users can only extend their own sessions
@@ -2954,10 +2935,7 @@ func (h *SessionHandler) ExtendSession(c *fiber.Ctx) error {
 	if session.PrincipalID != currentUserID && session.PrincipalType == "user" {
 		userRole := c.Locals("role").(string)
 		if userRole != "admin" && userRole != "super_admin" {
-			return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{
-				Error:   "access_denied",
-				Message: "You can only extend your own sessions",
-			})
+			return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "You can only extend your own sessions")
 		}
 	}
 
@@ -2969,15 +2947,9 @@ func (h *SessionHandler) ExtendSession(c *fiber.Ctx) error {
 	if err != nil {
 		h.logger.Error("Failed to extend session: %v (session_id: %s)", err, sessionID)
 		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "not active") {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "session_not_found",
-				Message: "Session not found or not active",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Session not found or not active")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to extend session",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to extend session")
 	}
 
 	// Return updated session
@@ -2999,15 +2971,36 @@ func (h *SessionHandler) ExtendSession(c *fiber.Ctx) error {
 
 // AuditHandler handles audit and compliance operations
 type AuditHandler struct {
-	queries *queries.Queries
-	logger  *logger.Logger
-	audit   services.AuditService
+	queries    *queries.Queries
+	logger     *logger.Logger
+	audit      services.AuditService
+	events     events.Bus                 // set via SetEvents
+	principals services.PrincipalResolver // set via SetPrincipals
 }
 
 func NewAuditHandler(queries *queries.Queries, logger *logger.Logger, audit services.AuditService) *AuditHandler {
 	return &AuditHandler{queries: queries, logger: logger, audit: audit}
 }
 
+// SetEvents injects the bus access review assignments are published on.
+// Called from route setup.
+func (h *AuditHandler) SetEvents(bus events.Bus) {
+	h.events = bus
+}
+
+// publishAssignment publishes that the reviewer was assigned the review
+func (h *AuditHandler) publishAssignment(c *fiber.Ctx, review *models.AccessReview) {
+	publish(h.events, c, events.Event{
+		Type:    events.AccessReviewAssigned,
+		Subject: review.ID,
+		Data: map[string]interface{}{
+			"reviewer_id": review.ReviewerID,
+			"name":        review.Name,
+			"due_date":    review.DueDate,
+		},
+	})
+}
+
 // ListAuditEvents lists audit events
 //
 //	@Summary	List audit events
@@ -3019,6 +3012,7 @@ func NewAuditHandler(queries *queries.Queries, logger *logger.Logger, audit serv
 //	@Param		principal_id	query	string	false	"Principal (User) ID"
 //	@Param		action			query	string	false	"Action filter"
 //	@Param		resource_type	query	string	false	"Resource type filter"
+//	@Param		resource_id		query	string	false	"Resource ID filter"
 //	@Param		result			query	string	false	"Result filter (success/failure)"
 //	@Param		severity		query	string	false	"Severity filter"
 //	@Param		start_time		query	string	false	"Start time (RFC3339)"
@@ -3038,6 +3032,7 @@ func (h *AuditHandler) ListAuditEvents(c *fiber.Ctx) error {
 		PrincipalID:    c.Query("principal_id"),
 		Action:         c.Query("action"),
 		ResourceType:   c.Query("resource_type"),
+		ResourceID:     c.Query("resource_id"),
 		Result:         c.Query("result"),
 		Severity:       c.Query("severity"),
 	}
@@ -3052,10 +3047,7 @@ func (h *AuditHandler) ListAuditEvents(c *fiber.Ctx) error {
 		if startTime, err := time.Parse(time.RFC3339, startTimeStr); err == nil {
 			params.StartTime = &startTime
 		} else {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Error:   "invalid_start_time",
-				Message: "Invalid start_time format. Use RFC3339 format.",
-			})
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid start_time format. Use RFC3339 format.")
 		}
 	}
 
@@ -3063,10 +3055,7 @@ func (h *AuditHandler) ListAuditEvents(c *fiber.Ctx) error {
 		if endTime, err := time.Parse(time.RFC3339, endTimeStr); err == nil {
 			params.EndTime = &endTime
 		} else {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Error:   "invalid_end_time",
-				Message: "Invalid end_time format. Use RFC3339 format.",
-			})
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid end_time format. Use RFC3339 format.")
 		}
 	}
 
@@ -3084,10 +3073,13 @@ func (h *AuditHandler) ListAuditEvents(c *fiber.Ctx) error {
 	events, totalCount, err := h.queries.Audit.ListAuditEvents(params)
 	if err != nil {
 		h.logger.Error("Failed to list audit events: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to retrieve audit events",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve audit events")
+	}
+	if h.principals != nil {
+		if err := h.principals.EnrichAuditEvents(c.Context(), events); err != nil {
+			// The events are still worth returning without names
+			h.logger.Warn("Failed to resolve audit event principals: %v", err)
+		}
 	}
 
 	return c.JSON(fiber.Map{
@@ -3120,10 +3112,7 @@ func (h *AuditHandler) ListAuditEvents(c *fiber.Ctx) error {
 func (h *AuditHandler) GetAuditEvent(c *fiber.Ctx) error {
 	eventID := c.Params("id")
 	if eventID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_event_id",
-			Message: "Event ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Event ID is required")
 	}
 
 	// Get the audit event
@@ -3131,16 +3120,10 @@ func (h *AuditHandler) GetAuditEvent(c *fiber.Ctx) error {
 	event, err := h.queries.Audit.GetAuditEvent(eventID, orgID)
 	if err != nil {
 		if err.Error() == "audit event not found" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "audit_event_not_found",
-				Message: "Audit event not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Audit event not found")
 		}
 		h.logger.Error("Failed to get audit event: %v (event_id: %s)", err, eventID)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to retrieve audit event",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve audit event")
 	}
 
 	return c.JSON(fiber.Map{
@@ -3181,10 +3164,7 @@ func (h *AuditHandler) GenerateAccessReport(c *fiber.Ctx) error {
 		if startTime, err := time.Parse(time.RFC3339, startTimeStr); err == nil {
 			params.StartTime = &startTime
 		} else {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Error:   "invalid_start_time",
-				Message: "Invalid start_time format. Use RFC3339 format.",
-			})
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid start_time format. Use RFC3339 format.")
 		}
 	}
 
@@ -3192,10 +3172,7 @@ func (h *AuditHandler) GenerateAccessReport(c *fiber.Ctx) error {
 		if endTime, err := time.Parse(time.RFC3339, endTimeStr); err == nil {
 			params.EndTime = &endTime
 		} else {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Error:   "invalid_end_time",
-				Message: "Invalid end_time format. Use RFC3339 format.",
-			})
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid end_time format. Use RFC3339 format.")
 		}
 	}
 
@@ -3203,10 +3180,7 @@ func (h *AuditHandler) GenerateAccessReport(c *fiber.Ctx) error {
 	report, err := h.queries.Audit.GenerateAccessReport(params)
 	if err != nil {
 		h.logger.Error("Failed to generate access report: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to generate access report",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to generate access report")
 	}
 
 	return c.JSON(fiber.Map{
@@ -3253,10 +3227,7 @@ func (h *AuditHandler) GenerateComplianceReport(c *fiber.Ctx) error {
 		if startTime, err := time.Parse(time.RFC3339, startTimeStr); err == nil {
 			params.StartTime = &startTime
 		} else {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Error:   "invalid_start_time",
-				Message: "Invalid start_time format. Use RFC3339 format.",
-			})
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid start_time format. Use RFC3339 format.")
 		}
 	}
 
@@ -3264,10 +3235,7 @@ func (h *AuditHandler) GenerateComplianceReport(c *fiber.Ctx) error {
 		if endTime, err := time.Parse(time.RFC3339, endTimeStr); err == nil {
 			params.EndTime = &endTime
 		} else {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Error:   "invalid_end_time",
-				Message: "Invalid end_time format. Use RFC3339 format.",
-			})
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid end_time format. Use RFC3339 format.")
 		}
 	}
 
@@ -3275,10 +3243,7 @@ func (h *AuditHandler) GenerateComplianceReport(c *fiber.Ctx) error {
 	report, err := h.queries.Audit.GenerateComplianceReport(params)
 	if err != nil {
 		h.logger.Error("Failed to generate compliance report: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to generate compliance report",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to generate compliance report")
 	}
 
 	return c.JSON(fiber.Map{
@@ -3317,10 +3282,7 @@ func (h *AuditHandler) GeneratePolicyUsageReport(c *fiber.Ctx) error {
 		if startTime, err := time.Parse(time.RFC3339, startTimeStr); err == nil {
 			params.StartTime = &startTime
 		} else {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Error:   "invalid_start_time",
-				Message: "Invalid start_time format. Use RFC3339 format.",
-			})
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid start_time format. Use RFC3339 format.")
 		}
 	}
 
@@ -3328,10 +3290,7 @@ func (h *AuditHandler) GeneratePolicyUsageReport(c *fiber.Ctx) error {
 		if endTime, err := time.Parse(time.RFC3339, endTimeStr); err == nil {
 			params.EndTime = &endTime
 		} else {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Error:   "invalid_end_time",
-				Message: "Invalid end_time format. Use RFC3339 format.",
-			})
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid end_time format. Use RFC3339 format.")
 		}
 	}
 
@@ -3339,10 +3298,7 @@ func (h *AuditHandler) GeneratePolicyUsageReport(c *fiber.Ctx) error {
 	report, err := h.queries.Audit.GeneratePolicyUsageReport(params)
 	if err != nil {
 		h.logger.Error("Failed to generate policy usage report: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to generate policy usage report",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to generate policy usage report")
 	}
 
 	return c.JSON(fiber.Map{
@@ -3390,10 +3346,7 @@ func (h *AuditHandler) ListAccessReviews(c *fiber.Ctx) error {
 		if startTime, err := time.Parse(time.RFC3339, startTimeStr); err == nil {
 			params.StartTime = &startTime
 		} else {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Error:   "invalid_start_time",
-				Message: "Invalid start_time format. Use RFC3339 format.",
-			})
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid start_time format. Use RFC3339 format.")
 		}
 	}
 
@@ -3401,10 +3354,7 @@ func (h *AuditHandler) ListAccessReviews(c *fiber.Ctx) error {
 		if endTime, err := time.Parse(time.RFC3339, endTimeStr); err == nil {
 			params.EndTime = &endTime
 		} else {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Error:   "invalid_end_time",
-				Message: "Invalid end_time format. Use RFC3339 format.",
-			})
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid end_time format. Use RFC3339 format.")
 		}
 	}
 
@@ -3422,10 +3372,7 @@ func (h *AuditHandler) ListAccessReviews(c *fiber.Ctx) error {
 	reviews, totalCount, err := h.queries.Audit.ListAccessReviews(params)
 	if err != nil {
 		h.logger.Error("Failed to list access reviews: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to retrieve access reviews",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve access reviews")
 	}
 
 	return c.JSON(fiber.Map{
@@ -3457,18 +3404,12 @@ func (h *AuditHandler) ListAccessReviews(c *fiber.Ctx) error {
 func (h *AuditHandler) CreateAccessReview(c *fiber.Ctx) error {
 	var request models.AccessReview
 	if err := c.BodyParser(&request); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Invalid request body",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
 	}
 
 	// Validate required fields
 	if request.Name == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Name is required")
 	}
 
 	if request.OrganizationID == "" {
@@ -3476,10 +3417,7 @@ func (h *AuditHandler) CreateAccessReview(c *fiber.Ctx) error {
 	}
 
 	if request.ReviewerID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Reviewer ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Reviewer ID is required")
 	}
 
 	// Generate ID if not provided
@@ -3491,11 +3429,9 @@ func (h *AuditHandler) CreateAccessReview(c *fiber.Ctx) error {
 	createdReview, err := h.queries.Audit.CreateAccessReview(request)
 	if err != nil {
 		h.logger.Error("Failed to create access review: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to create access review",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create access review")
 	}
+	h.publishAssignment(c, createdReview)
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"status":  201,
@@ -3522,10 +3458,7 @@ func (h *AuditHandler) CreateAccessReview(c *fiber.Ctx) error {
 func (h *AuditHandler) GetAccessReview(c *fiber.Ctx) error {
 	reviewID := c.Params("id")
 	if reviewID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_review_id",
-			Message: "Review ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Review ID is required")
 	}
 
 	// Get the access review
@@ -3533,16 +3466,10 @@ func (h *AuditHandler) GetAccessReview(c *fiber.Ctx) error {
 	review, err := h.queries.Audit.GetAccessReview(reviewID, orgID)
 	if err != nil {
 		if err.Error() == "access review not found" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "access_review_not_found",
-				Message: "Access review not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Access review not found")
 		}
 		h.logger.Error("Failed to get access review: %v (review_id: %s)", err, reviewID)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to retrieve access review",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve access review")
 	}
 
 	return c.JSON(fiber.Map{
@@ -3571,35 +3498,30 @@ func (h *AuditHandler) GetAccessReview(c *fiber.Ctx) error {
 func (h *AuditHandler) UpdateAccessReview(c *fiber.Ctx) error {
 	reviewID := c.Params("id")
 	if reviewID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_review_id",
-			Message: "Review ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Review ID is required")
 	}
 
 	var request models.AccessReview
 	if err := c.BodyParser(&request); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Invalid request body",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
 	}
 
 	// Update the access review
 	orgID := c.Locals("organization_id").(string)
+	previousReviewer := ""
+	if previous, err := h.queries.Audit.GetAccessReview(reviewID, orgID); err == nil {
+		previousReviewer = previous.ReviewerID
+	}
 	updatedReview, err := h.queries.Audit.UpdateAccessReview(reviewID, orgID, request)
 	if err != nil {
 		if err.Error() == "access review not found" {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "access_review_not_found",
-				Message: "Access review not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Access review not found")
 		}
 		h.logger.Error("Failed to update access review: %v (review_id: %s)", err, reviewID)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to update access review",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update access review")
+	}
+	if updatedReview.ReviewerID != previousReviewer {
+		h.publishAssignment(c, updatedReview)
 	}
 
 	return c.JSON(fiber.Map{
@@ -3628,10 +3550,7 @@ func (h *AuditHandler) UpdateAccessReview(c *fiber.Ctx) error {
 func (h *AuditHandler) CompleteAccessReview(c *fiber.Ctx) error {
 	reviewID := c.Params("id")
 	if reviewID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_review_id",
-			Message: "Review ID is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Review ID is required")
 	}
 
 	var request struct {
@@ -3640,10 +3559,7 @@ func (h *AuditHandler) CompleteAccessReview(c *fiber.Ctx) error {
 	}
 
 	if err := c.BodyParser(&request); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_request",
-			Message: "Invalid request body",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
 	}
 
 	// Complete the access review
@@ -3651,16 +3567,10 @@ func (h *AuditHandler) CompleteAccessReview(c *fiber.Ctx) error {
 	err := h.queries.Audit.CompleteAccessReview(reviewID, orgID, request.Findings, request.Recommendations)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "access_review_not_found",
-				Message: "Access review not found or already completed",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Access review not found or already completed")
 		}
 		h.logger.Error("Failed to complete access review: %v (review_id: %s)", err, reviewID)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "internal_server_error",
-			Message: "Failed to complete access review",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to complete access review")
 	}
 
 	return c.JSON(fiber.Map{
@@ -3669,56 +3579,45 @@ func (h *AuditHandler) CompleteAccessReview(c *fiber.Ctx) error {
 	})
 }
 
-// GetSystemStats retrieves system-wide statistics
+// GetSystemStats returns the admin dashboard statistics
 //
 //	@Summary	Get system statistics
-//	@Description	Retrieve comprehensive system statistics for administrators
+//	@Description	Users by status (and, system-wide, by organization), new users, MFA adoption among active users, active sessions, policies by status, audit events by severity, and daily logins and OAuth2 token issuance over the last days days. Root administrators get system-wide numbers unless they pass organization_id; other administrators get their organization's. Numbers may be up to a minute old.
 //	@Tags		Admin
-//	@Accept		json
 //	@Produce	json
-//	@Success	200	{object}	SuccessResponse	"System statistics retrieved successfully"
+//	@Param		days	query	int	false	"Length of the trend window in days (default: 30, max: 90)"
+//	@Param		organization_id	query	string	false	"Organization to report on"
+//	@Success	200	{object}	models.SystemStats	"System statistics retrieved successfully"
+//	@Failure	400	{object}	ErrorResponse	"Invalid days"
 //	@Failure	401	{object}	ErrorResponse	"Unauthorized"
+//	@Failure	403	{object}	ErrorResponse	"Access denied to the organization"
 //	@Failure	500	{object}	ErrorResponse	"Internal server error"
 //	@Security	BearerAuth
 //	@Router		/admin/stats [get]
 func (h *AuditHandler) GetSystemStats(c *fiber.Ctx) error {
-	// This would typically gather statistics from various sources
-	stats := fiber.Map{
-		"system": fiber.Map{
-			"uptime":   time.Since(time.Now().Add(-24 * time.Hour)).String(), // Placeholder
-			"version":  "1.0.0",
-			"build":    "development",
-			"timezone": "UTC",
-		},
-		"users": fiber.Map{
-			"total_users":     1000, // These would be real queries
-			"active_users":    850,
-			"suspended_users": 50,
-			"new_users_today": 25,
-		},
-		"audit": fiber.Map{
-			"total_events":    50000,
-			"events_today":    1250,
-			"failed_logins":   125,
-			"security_alerts": 5,
-		},
-		"performance": fiber.Map{
-			"avg_response_time": "45ms",
-			"error_rate":        "0.02%",
-			"throughput":        "1250 req/min",
-		},
-		"storage": fiber.Map{
-			"database_size":  "2.5GB",
-			"cache_hit_rate": "94.5%",
-			"disk_usage":     "68%",
-		},
+	days := c.QueryInt("days", 30)
+	if days < 1 || days > queries.MaxStatsDays {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, fmt.Sprintf("days must be between 1 and %d", queries.MaxStatsDays))
 	}
 
-	return c.JSON(fiber.Map{
-		"status":  200,
-		"data":    stats,
-		"message": "System statistics retrieved successfully",
-	})
+	organizationID := c.Locals("organization_id").(string)
+	tc := middleware.GetTenantContext(c)
+	if tc != nil {
+		organizationID = tc.OrgFilter()
+	}
+	if orgID := c.Query("organization_id"); orgID != "" {
+		if tc == nil || !tc.CanAccessOrg(orgID) {
+			return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Access denied: you do not have access to this organization")
+		}
+		organizationID = orgID
+	}
+
+	stats, err := h.queries.Stats.WithContext(c.Context()).GetSystemStats(organizationID, days)
+	if err != nil {
+		h.logger.Error("Failed to compute system stats: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve system statistics")
+	}
+	return apiSuccess(c, fiber.StatusOK, "System statistics retrieved successfully", stats)
 }
 
 // SystemHealthCheck performs a comprehensive system health check
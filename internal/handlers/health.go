@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/database"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+	"github.com/the-monkeys/monkeys-identity/internal/signing"
+)
+
+// probeTimeout bounds each dependency check; the checks run concurrently, so
+// it also bounds the whole probe
+const probeTimeout = 2 * time.Second
+
+// Health states. A dependency is ok, degraded (working with reduced
+// guarantees) or down; the server is ok, degraded, or unhealthy when a
+// dependency it cannot work without is down.
+const (
+	healthOK        = "ok"
+	healthDegraded  = "degraded"
+	healthDown      = "down"
+	healthUnhealthy = "unhealthy"
+)
+
+// HealthHandler serves the liveness and readiness probes. The process is
+// live as long as it can answer; it is ready once startup has finished, while
+// Postgres is reachable and tokens can be signed, and until shutdown begins.
+// Redis only holds caches, revocations and rate limits that are skipped while
+// it is down, and mail is only needed for some flows, so their outages report
+// the server as degraded rather than not ready.
+type HealthHandler struct {
+	db    *database.DB
+	redis redis.UniversalClient
+	email services.EmailService // set via SetEmail after construction
+	keys  *signing.KeyManager   // set via SetSigningKeys after construction
+	ready atomic.Bool
+}
+
+func NewHealthHandler(db *database.DB, redis redis.UniversalClient) *HealthHandler {
+	return &HealthHandler{db: db, redis: redis}
+}
+
+// SetEmail adds the SMTP server to the readiness checks
+func (h *HealthHandler) SetEmail(email services.EmailService) {
+	h.email = email
+}
+
+// SetSigningKeys adds the token signing keys to the readiness checks
+func (h *HealthHandler) SetSigningKeys(keys *signing.KeyManager) {
+	h.keys = keys
+}
+
+// SetReady marks the server as able (or no longer able) to take traffic
+func (h *HealthHandler) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
+
+// DependencyHealth is the result of checking one dependency
+type DependencyHealth struct {
+	Status    string `json:"status"`
+	Critical  bool   `json:"critical"` // the server is unhealthy while it is down
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// errDegraded is returned by checks whose dependency works with reduced
+// guarantees
+var errDegraded = errors.New("degraded")
+
+type healthCheck struct {
+	name     string
+	critical bool
+	check    func(ctx context.Context) error
+}
+
+func (h *HealthHandler) checks() []healthCheck {
+	checks := []healthCheck{
+		{"database", true, h.db.PingContext},
+		{"redis", false, func(ctx context.Context) error { return h.redis.Ping(ctx).Err() }},
+	}
+	if h.email != nil {
+		checks = append(checks, healthCheck{"email", false, h.email.Ping})
+	}
+	if h.keys != nil {
+		checks = append(checks, healthCheck{"signing_keys", true, func(context.Context) error {
+			if err := h.keys.Check(); err != nil {
+				return err
+			}
+			if h.keys.Temporary() {
+				// Tokens are lost on restart and refused by other replicas
+				return errDegraded
+			}
+			return nil
+		}})
+	}
+	return checks
+}
+
+// checkDependencies runs every check concurrently, each within probeTimeout,
+// and returns their results with the overall status
+func (h *HealthHandler) checkDependencies(ctx context.Context) (string, map[string]DependencyHealth) {
+	checks := h.checks()
+	results := make([]DependencyHealth, len(checks))
+	var wg sync.WaitGroup
+	for i, hc := range checks {
+		wg.Add(1)
+		go func(i int, hc healthCheck) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := hc.check(ctx)
+			result := DependencyHealth{Status: healthOK, Critical: hc.critical, LatencyMS: time.Since(start).Milliseconds()}
+			// Causes are summarized; the probe is public and error messages
+			// name hosts
+			switch {
+			case err == nil:
+			case errors.Is(err, errDegraded):
+				result.Status, result.Error = healthDegraded, "temporary signing key"
+			case errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil:
+				result.Status, result.Error = healthDown, "timed out"
+			default:
+				result.Status, result.Error = healthDown, "check failed"
+			}
+			results[i] = result
+		}(i, hc)
+	}
+	wg.Wait()
+
+	status := healthOK
+	byName := make(map[string]DependencyHealth, len(checks))
+	for i, hc := range checks {
+		r := results[i]
+		byName[hc.name] = r
+		switch {
+		case r.Status == healthDown && r.Critical:
+			status = healthUnhealthy
+		case r.Status != healthOK && status == healthOK:
+			status = healthDegraded
+		}
+	}
+	return status, byName
+}
+
+// Live
+//
+//	@Summary		Liveness probe
+//	@Description	Reports that the process is running. Does not check dependencies.
+//	@Tags			System
+//	@Produce		json
+//	@Success		200	{object}	map[string]string	"Process is alive"
+//	@Router			/live [get]
+func (h *HealthHandler) Live(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// Ready
+//
+//	@Summary		Readiness probe
+//	@Description	Reports whether the server should receive traffic, with the status of each dependency: Postgres, Redis, the SMTP server and the token signing keys, each checked within 2s. The status is ok, degraded (Redis or SMTP down, or a temporary signing key; still ready) or unhealthy (starting, shutting down, Postgres down or tokens cannot be signed). Also served at /health/ready.
+//	@Tags			System
+//	@Produce		json
+//	@Success		200	{object}	map[string]interface{}	"Ready, ok or degraded"
+//	@Failure		503	{object}	map[string]interface{}	"Unhealthy"
+//	@Router			/ready [get]
+func (h *HealthHandler) Ready(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	if !h.ready.Load() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"status": healthUnhealthy, "reason": "starting or shutting down"})
+	}
+
+	status, checks := h.checkDependencies(c.Context())
+	code := fiber.StatusOK
+	if status == healthUnhealthy {
+		code = fiber.StatusServiceUnavailable
+	}
+	return c.Status(code).JSON(fiber.Map{"status": status, "checks": checks})
+}
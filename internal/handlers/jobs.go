@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/jobs"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+// JobHandler exposes the background job scheduler to administrators
+type JobHandler struct {
+	scheduler *jobs.Scheduler
+	logger    *logger.Logger
+	audit     services.AuditService
+}
+
+func NewJobHandler(scheduler *jobs.Scheduler, logger *logger.Logger, audit services.AuditService) *JobHandler {
+	return &JobHandler{scheduler: scheduler, logger: logger, audit: audit}
+}
+
+// ListJobs
+//
+//	@Summary		List background jobs
+//	@Description	List the registered background jobs with their schedule, next run, any run in progress and the last completed run
+//	@Tags			System Administration
+//	@Produce		json
+//	@Success		200	{object}	SuccessResponse	"Jobs retrieved"
+//	@Failure		403	{object}	ErrorResponse	"Forbidden"
+//	@Failure		500	{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/admin/jobs [get]
+func (h *JobHandler) ListJobs(c *fiber.Ctx) error {
+	infos, err := h.scheduler.Jobs(c.Context())
+	if err != nil {
+		h.logger.Error("Failed to list jobs: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list jobs")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Jobs retrieved", infos)
+}
+
+// GetJob
+//
+//	@Summary		Get background job
+//	@Description	Get the state of a background job
+//	@Tags			System Administration
+//	@Produce		json
+//	@Param			name	path		string			true	"Job name"
+//	@Success		200		{object}	SuccessResponse	"Job retrieved"
+//	@Failure		403		{object}	ErrorResponse	"Forbidden"
+//	@Failure		404		{object}	ErrorResponse	"Job not found"
+//	@Failure		500		{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/admin/jobs/{name} [get]
+func (h *JobHandler) GetJob(c *fiber.Ctx) error {
+	info, err := h.scheduler.Job(c.Context(), c.Params("name"))
+	if err != nil {
+		return h.jobError(c, err, "Failed to retrieve job")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Job retrieved", info)
+}
+
+// ListJobRuns
+//
+//	@Summary		List background job runs
+//	@Description	List the most recent runs of a background job, newest first
+//	@Tags			System Administration
+//	@Produce		json
+//	@Param			name	path		string			true	"Job name"
+//	@Param			limit	query		int				false	"Maximum number of runs (1-100, default 20)"
+//	@Success		200		{object}	SuccessResponse	"Job runs retrieved"
+//	@Failure		403		{object}	ErrorResponse	"Forbidden"
+//	@Failure		404		{object}	ErrorResponse	"Job not found"
+//	@Failure		500		{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/admin/jobs/{name}/runs [get]
+func (h *JobHandler) ListJobRuns(c *fiber.Ctx) error {
+	runs, err := h.scheduler.History(c.Context(), c.Params("name"), c.QueryInt("limit", 20))
+	if err != nil {
+		return h.jobError(c, err, "Failed to retrieve job runs")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Job runs retrieved", runs)
+}
+
+// TriggerJob
+//
+//	@Summary		Run background job now
+//	@Description	Start a run of a background job outside its schedule. The run proceeds asynchronously; poll the job or its runs for the outcome.
+//	@Tags			System Administration
+//	@Produce		json
+//	@Param			name	path		string			true	"Job name"
+//	@Success		202		{object}	SuccessResponse	"Job run started"
+//	@Failure		403		{object}	ErrorResponse	"Forbidden"
+//	@Failure		404		{object}	ErrorResponse	"Job not found"
+//	@Failure		409		{object}	ErrorResponse	"Job is already running"
+//	@Failure		500		{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/admin/jobs/{name}/run [post]
+func (h *JobHandler) TriggerJob(c *fiber.Ctx) error {
+	name := c.Params("name")
+	userID := c.Locals("user_id").(string)
+
+	run, err := h.scheduler.Trigger(name, userID)
+	if err != nil {
+		return h.jobError(c, err, "Failed to start job")
+	}
+
+	h.audit.LogEvent(c.Context(), models.AuditEvent{
+		OrganizationID: c.Locals("organization_id").(string),
+		PrincipalID:    utils.StringPtr(userID),
+		PrincipalType:  utils.StringPtr("user"),
+		Action:         "trigger_job",
+		ResourceType:   utils.StringPtr("job"),
+		ResourceID:     utils.StringPtr(name),
+		Result:         "success",
+		Severity:       "warn",
+	})
+
+	return apiSuccess(c, fiber.StatusAccepted, "Job run started", run)
+}
+
+func (h *JobHandler) jobError(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, jobs.ErrJobNotFound):
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Job not found")
+	case errors.Is(err, jobs.ErrJobRunning):
+		return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "Job is already running")
+	}
+	h.logger.Error("%s: %v", message, err)
+	return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, message)
+}
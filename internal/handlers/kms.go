@@ -0,0 +1,611 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/encryption"
+	"github.com/the-monkeys/monkeys-identity/internal/middleware"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+const (
+	// maxKMSPlaintext bounds what one encrypt call seals; larger data is
+	// meant to be encrypted with a data key sealed through the API
+	maxKMSPlaintext    = 64 << 10
+	maxKMSRotationDays = 3650
+)
+
+var kmsKeyName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]{0,99}$`)
+
+// KMSHandler serves the KMS API: named encryption keys of the organization,
+// their grants, and encrypt and decrypt calls with them
+type KMSHandler struct {
+	queries    *queries.Queries
+	kms        services.KMSService
+	audit      services.AuditService
+	logger     *logger.Logger
+	principals services.PrincipalResolver // set via SetPrincipals
+}
+
+func NewKMSHandler(q *queries.Queries, kms services.KMSService, audit services.AuditService, logger *logger.Logger) *KMSHandler {
+	return &KMSHandler{queries: q, kms: kms, audit: audit, logger: logger}
+}
+
+// KMSKeyRequest is the request body for creating a KMS key
+type KMSKeyRequest struct {
+	Name               string `json:"name"`
+	Description        string `json:"description,omitempty"`
+	RotationPeriodDays int    `json:"rotation_period_days,omitempty"` // 0 rotates by hand only
+}
+
+// UpdateKMSKeyRequest changes a KMS key; omitted fields are kept
+type UpdateKMSKeyRequest struct {
+	Name               *string `json:"name,omitempty"`
+	Description        *string `json:"description,omitempty"`
+	Status             *string `json:"status,omitempty"` // enabled, disabled
+	RotationPeriodDays *int    `json:"rotation_period_days,omitempty"`
+}
+
+// KMSGrantRequest is the request body for granting a principal the use of
+// a KMS key
+type KMSGrantRequest struct {
+	PrincipalID   string     `json:"principal_id"`
+	PrincipalType string     `json:"principal_type"` // user, service_account, group
+	Operations    []string   `json:"operations"`     // encrypt, decrypt
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+}
+
+// KMSEncryptRequest is the request body of an encrypt call. Plaintext is
+// base64; the same context must be given to decrypt.
+type KMSEncryptRequest struct {
+	Plaintext         string            `json:"plaintext"`
+	EncryptionContext map[string]string `json:"encryption_context,omitempty"`
+}
+
+// KMSDecryptRequest is the request body of a decrypt call
+type KMSDecryptRequest struct {
+	Ciphertext        string            `json:"ciphertext"`
+	EncryptionContext map[string]string `json:"encryption_context,omitempty"`
+}
+
+func (h *KMSHandler) logKeyChange(c *fiber.Ctx, action, organizationID, keyID string) {
+	h.audit.LogEvent(c.Context(), models.AuditEvent{
+		OrganizationID: organizationID,
+		PrincipalID:    utils.StringPtr(c.Locals("user_id").(string)),
+		PrincipalType:  utils.StringPtr("user"),
+		Action:         action,
+		ResourceType:   utils.StringPtr("kms_key"),
+		ResourceID:     utils.StringPtr(keyID),
+		Result:         "success",
+		Severity:       "warn",
+	})
+}
+
+// key loads the key named in the path, replying 404 when the organization
+// has none
+func (h *KMSHandler) key(c *fiber.Ctx) (*models.KMSKey, error) {
+	key, err := h.queries.KMS.WithContext(c.Context()).GetKey(c.Params("id"), c.Locals("organization_id").(string))
+	if err != nil {
+		if isNotFoundErr(err) {
+			return nil, apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Key not found")
+		}
+		h.logger.Error("Failed to get KMS key: %v", err)
+		return nil, apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve key")
+	}
+	return key, nil
+}
+
+func (h *KMSHandler) unavailable(c *fiber.Ctx) error {
+	return apiError(c, fiber.StatusServiceUnavailable, apierror.CodeServiceUnavailable,
+		"Key management needs an encryption master key (ENCRYPTION_MASTER_KEYS or ENCRYPTION_VAULT_TRANSIT_KEY)")
+}
+
+// ListKMSKeys returns the KMS keys of the organization
+//
+//	@Summary	List KMS keys
+//	@Tags		Key Management
+//	@Produce	json
+//	@Success	200	{array}		models.KMSKey	"Keys retrieved"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Security	BearerAuth
+//	@Router		/kms/keys [get]
+func (h *KMSHandler) ListKMSKeys(c *fiber.Ctx) error {
+	keys, err := h.queries.KMS.WithContext(c.Context()).ListKeys(c.Locals("organization_id").(string))
+	if err != nil {
+		h.logger.Error("Failed to list KMS keys: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve keys")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Keys retrieved", keys)
+}
+
+// CreateKMSKey creates a KMS key
+//
+//	@Summary	Create KMS key
+//	@Description	Create a named encryption key. Its material is generated by the server, wrapped by the encryption master key, and never returned. The creator is granted encrypt and decrypt; grant others with the grants endpoint. With rotation_period_days the key is rotated automatically.
+//	@Tags		Key Management
+//	@Accept		json
+//	@Produce	json
+//	@Param		request	body	KMSKeyRequest	true	"Key"
+//	@Success	201	{object}	models.KMSKey	"Key created"
+//	@Failure	400	{object}	ErrorResponse	"Invalid key"
+//	@Failure	409	{object}	ErrorResponse	"A key with this name exists"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Failure	503	{object}	ErrorResponse	"No encryption master key configured"
+//	@Security	BearerAuth
+//	@Router		/kms/keys [post]
+func (h *KMSHandler) CreateKMSKey(c *fiber.Ctx) error {
+	if !h.kms.Available() {
+		return h.unavailable(c)
+	}
+	var req KMSKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+	}
+	key := &models.KMSKey{
+		OrganizationID:     c.Locals("organization_id").(string),
+		Name:               strings.TrimSpace(req.Name),
+		Description:        strings.TrimSpace(req.Description),
+		Status:             "enabled",
+		RotationPeriodDays: req.RotationPeriodDays,
+		CreatedBy:          utils.StringPtr(c.Locals("user_id").(string)),
+	}
+	if msg := validateKMSKey(key); msg != "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, msg)
+	}
+
+	if err := h.kms.CreateKey(c.Context(), key); err != nil {
+		if isConflictErr(err) {
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "A key with this name already exists")
+		}
+		h.logger.Error("Failed to create KMS key: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create key")
+	}
+	h.logKeyChange(c, "kms_create_key", key.OrganizationID, key.ID)
+	return apiSuccess(c, fiber.StatusCreated, "Key created", key)
+}
+
+func validateKMSKey(key *models.KMSKey) string {
+	if !kmsKeyName.MatchString(key.Name) {
+		return "name must be 1 to 100 letters, digits, '.', '_', '/' or '-', starting with a letter or digit"
+	}
+	if key.Status != "enabled" && key.Status != "disabled" {
+		return "status must be enabled or disabled"
+	}
+	if key.RotationPeriodDays < 0 || key.RotationPeriodDays > maxKMSRotationDays {
+		return "rotation_period_days must be between 0 and 3650"
+	}
+	return ""
+}
+
+// GetKMSKey returns a KMS key of the organization
+//
+//	@Summary	Get KMS key
+//	@Tags		Key Management
+//	@Produce	json
+//	@Param		id	path	string	true	"Key ID"
+//	@Success	200	{object}	models.KMSKey	"Key retrieved"
+//	@Failure	404	{object}	ErrorResponse	"Key not found"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Security	BearerAuth
+//	@Router		/kms/keys/{id} [get]
+func (h *KMSHandler) GetKMSKey(c *fiber.Ctx) error {
+	key, err := h.key(c)
+	if key == nil {
+		return err
+	}
+	return apiSuccess(c, fiber.StatusOK, "Key retrieved", key)
+}
+
+// UpdateKMSKey changes a KMS key
+//
+//	@Summary	Update KMS key
+//	@Description	Rename, describe, enable or disable a key, or change its rotation period. A disabled key neither encrypts nor decrypts.
+//	@Tags		Key Management
+//	@Accept		json
+//	@Produce	json
+//	@Param		id		path	string				true	"Key ID"
+//	@Param		request	body	UpdateKMSKeyRequest	true	"Changes"
+//	@Success	200	{object}	models.KMSKey	"Key updated"
+//	@Failure	400	{object}	ErrorResponse	"Invalid key"
+//	@Failure	404	{object}	ErrorResponse	"Key not found"
+//	@Failure	409	{object}	ErrorResponse	"A key with this name exists"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Security	BearerAuth
+//	@Router		/kms/keys/{id} [put]
+func (h *KMSHandler) UpdateKMSKey(c *fiber.Ctx) error {
+	var req UpdateKMSKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+	}
+	key, err := h.key(c)
+	if key == nil {
+		return err
+	}
+	if req.Name != nil {
+		key.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		key.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Status != nil {
+		key.Status = *req.Status
+	}
+	if req.RotationPeriodDays != nil {
+		key.RotationPeriodDays = *req.RotationPeriodDays
+	}
+	if msg := validateKMSKey(key); msg != "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, msg)
+	}
+
+	if err := h.queries.KMS.WithContext(c.Context()).UpdateKey(key); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Key not found")
+		}
+		if isConflictErr(err) {
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "A key with this name already exists")
+		}
+		h.logger.Error("Failed to update KMS key: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update key")
+	}
+	h.logKeyChange(c, "kms_update_key", key.OrganizationID, key.ID)
+	return apiSuccess(c, fiber.StatusOK, "Key updated", key)
+}
+
+// DeleteKMSKey deletes a disabled KMS key
+//
+//	@Summary	Delete KMS key
+//	@Description	Delete a key with all its versions and grants. Nothing encrypted with it can be decrypted afterwards, so the key must be disabled first; resources naming it as their encryption_key_id are cleared.
+//	@Tags		Key Management
+//	@Produce	json
+//	@Param		id	path	string	true	"Key ID"
+//	@Success	200	{object}	SuccessResponse	"Key deleted"
+//	@Failure	404	{object}	ErrorResponse	"Key not found"
+//	@Failure	409	{object}	ErrorResponse	"Key is enabled"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Security	BearerAuth
+//	@Router		/kms/keys/{id} [delete]
+func (h *KMSHandler) DeleteKMSKey(c *fiber.Ctx) error {
+	key, err := h.key(c)
+	if key == nil {
+		return err
+	}
+	if key.Status != "disabled" {
+		return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "Disable the key before deleting it")
+	}
+	if err := h.queries.KMS.WithContext(c.Context()).DeleteKey(key.ID, key.OrganizationID); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Key not found")
+		}
+		h.logger.Error("Failed to delete KMS key: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to delete key")
+	}
+	h.logKeyChange(c, "kms_delete_key", key.OrganizationID, key.ID)
+	return apiSuccess(c, fiber.StatusOK, "Key deleted", nil)
+}
+
+// RotateKMSKey adds a version to a KMS key
+//
+//	@Summary	Rotate KMS key
+//	@Description	Generate a new version of the key, which encrypts from now on. Ciphertexts of earlier versions still decrypt.
+//	@Tags		Key Management
+//	@Produce	json
+//	@Param		id	path	string	true	"Key ID"
+//	@Success	200	{object}	models.KMSKey	"Key rotated"
+//	@Failure	404	{object}	ErrorResponse	"Key not found"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Failure	503	{object}	ErrorResponse	"No encryption master key configured"
+//	@Security	BearerAuth
+//	@Router		/kms/keys/{id}/rotate [post]
+func (h *KMSHandler) RotateKMSKey(c *fiber.Ctx) error {
+	if !h.kms.Available() {
+		return h.unavailable(c)
+	}
+	key, err := h.key(c)
+	if key == nil {
+		return err
+	}
+	rotated, err := h.kms.RotateKey(c.Context(), key, c.Locals("user_id").(string))
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Key not found")
+		}
+		h.logger.Error("Failed to rotate KMS key: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to rotate key")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Key rotated", rotated)
+}
+
+// ListKMSGrants returns the grants of a KMS key
+//
+//	@Summary	List KMS key grants
+//	@Tags		Key Management
+//	@Produce	json
+//	@Param		id	path	string	true	"Key ID"
+//	@Success	200	{array}		models.KMSKeyGrant	"Grants retrieved"
+//	@Failure	404	{object}	ErrorResponse	"Key not found"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Security	BearerAuth
+//	@Router		/kms/keys/{id}/grants [get]
+func (h *KMSHandler) ListKMSGrants(c *fiber.Ctx) error {
+	key, err := h.key(c)
+	if key == nil {
+		return err
+	}
+	grants, err := h.queries.KMS.WithContext(c.Context()).ListGrants(key.ID, key.OrganizationID)
+	if err != nil {
+		h.logger.Error("Failed to list KMS grants: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve grants")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Grants retrieved", grants)
+}
+
+// PutKMSGrant grants a principal the use of a KMS key
+//
+//	@Summary	Grant KMS key
+//	@Description	Allow a user, a service account or the members of a group to encrypt, decrypt or both with the key, until expires_at if given. Granting a principal again replaces its operations and expiry.
+//	@Tags		Key Management
+//	@Accept		json
+//	@Produce	json
+//	@Param		id		path	string			true	"Key ID"
+//	@Param		request	body	KMSGrantRequest	true	"Grant"
+//	@Success	200	{object}	models.KMSKeyGrant	"Grant saved"
+//	@Failure	400	{object}	ErrorResponse	"Invalid grant"
+//	@Failure	404	{object}	ErrorResponse	"Key or principal not found"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Security	BearerAuth
+//	@Router		/kms/keys/{id}/grants [post]
+func (h *KMSHandler) PutKMSGrant(c *fiber.Ctx) error {
+	var req KMSGrantRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+	}
+	if len(req.Operations) == 0 {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "operations must list encrypt, decrypt or both")
+	}
+	for _, op := range req.Operations {
+		if op != services.KMSEncrypt && op != services.KMSDecrypt {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "operations must list encrypt, decrypt or both")
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "expires_at must be in the future")
+	}
+
+	key, err := h.key(c)
+	if key == nil {
+		return err
+	}
+	if p, err := resolvePrincipal(c, h.principals, h.logger, key.OrganizationID, req.PrincipalID, req.PrincipalType, principalTypes...); p == nil {
+		return err
+	}
+
+	grant := &models.KMSKeyGrant{
+		KeyID:          key.ID,
+		OrganizationID: key.OrganizationID,
+		PrincipalID:    req.PrincipalID,
+		PrincipalType:  req.PrincipalType,
+		Operations:     req.Operations,
+		CreatedBy:      utils.StringPtr(c.Locals("user_id").(string)),
+		ExpiresAt:      req.ExpiresAt,
+	}
+	if err := h.queries.KMS.WithContext(c.Context()).PutGrant(grant); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Key not found")
+		}
+		h.logger.Error("Failed to save KMS grant: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to save grant")
+	}
+	h.logKeyChange(c, "kms_grant", key.OrganizationID, key.ID)
+	return apiSuccess(c, fiber.StatusOK, "Grant saved", grant)
+}
+
+// DeleteKMSGrant revokes a grant of a KMS key
+//
+//	@Summary	Revoke KMS key grant
+//	@Tags		Key Management
+//	@Produce	json
+//	@Param		id			path	string	true	"Key ID"
+//	@Param		grant_id	path	string	true	"Grant ID"
+//	@Success	200	{object}	SuccessResponse	"Grant revoked"
+//	@Failure	404	{object}	ErrorResponse	"Grant not found"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Security	BearerAuth
+//	@Router		/kms/keys/{id}/grants/{grant_id} [delete]
+func (h *KMSHandler) DeleteKMSGrant(c *fiber.Ctx) error {
+	organizationID := c.Locals("organization_id").(string)
+	if err := h.queries.KMS.WithContext(c.Context()).DeleteGrant(c.Params("grant_id"), c.Params("id"), organizationID); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Grant not found")
+		}
+		h.logger.Error("Failed to revoke KMS grant: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to revoke grant")
+	}
+	h.logKeyChange(c, "kms_revoke_grant", organizationID, c.Params("id"))
+	return apiSuccess(c, fiber.StatusOK, "Grant revoked", nil)
+}
+
+func kmsCaller(c *fiber.Ctx) services.KMSCaller {
+	return services.KMSCaller{
+		PrincipalID:   c.Locals("user_id").(string),
+		PrincipalType: callerPrincipalType(c),
+		IPAddress:     middleware.ClientIP(c),
+		UserAgent:     c.Get(fiber.HeaderUserAgent),
+	}
+}
+
+// kmsUseError replies to a failed encrypt or decrypt call
+func (h *KMSHandler) kmsUseError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrKMSUnavailable):
+		return h.unavailable(c)
+	case errors.Is(err, services.ErrKMSNotGranted):
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "No grant on this key allows you this operation")
+	case errors.Is(err, services.ErrKMSKeyDisabled):
+		return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "The key is disabled")
+	case errors.Is(err, services.ErrKMSWrongKey), errors.Is(err, encryption.ErrMalformed), errors.Is(err, encryption.ErrUnknownKey):
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "ciphertext was not produced by this key")
+	case errors.Is(err, encryption.ErrNotAuthentic):
+		// A wrong context fails like a tampered ciphertext
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "ciphertext does not decrypt with this key and encryption_context")
+	case isNotFoundErr(err):
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "ciphertext names a version this key does not have")
+	}
+	h.logger.Error("KMS operation failed: %v", err)
+	return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Key operation failed")
+}
+
+// KMSEncrypt encrypts data with a KMS key
+//
+//	@Summary	Encrypt with KMS key
+//	@Description	Encrypt up to 64 KiB of base64 plaintext with the current version of the key. Needs a grant of encrypt on the key. encryption_context is bound to the ciphertext and must be given again to decrypt it. Every call is recorded in the audit log as kms_encrypt.
+//	@Tags		Key Management
+//	@Accept		json
+//	@Produce	json
+//	@Param		id		path	string				true	"Key ID"
+//	@Param		request	body	KMSEncryptRequest	true	"Plaintext"
+//	@Success	200	{object}	SuccessResponse	"Data encrypted"
+//	@Failure	400	{object}	ErrorResponse	"Invalid plaintext"
+//	@Failure	403	{object}	ErrorResponse	"Not granted"
+//	@Failure	404	{object}	ErrorResponse	"Key not found"
+//	@Failure	409	{object}	ErrorResponse	"Key is disabled"
+//	@Failure	503	{object}	ErrorResponse	"No encryption master key configured"
+//	@Security	BearerAuth
+//	@Router		/kms/keys/{id}/encrypt [post]
+func (h *KMSHandler) KMSEncrypt(c *fiber.Ctx) error {
+	var req KMSEncryptRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(req.Plaintext)
+	if err != nil || len(plaintext) == 0 {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "plaintext must be non-empty base64")
+	}
+	if len(plaintext) > maxKMSPlaintext {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "plaintext must be at most 64 KiB")
+	}
+	key, err := h.key(c)
+	if key == nil {
+		return err
+	}
+
+	ciphertext, err := h.kms.Encrypt(c.Context(), kmsCaller(c), key, plaintext, req.EncryptionContext)
+	if err != nil {
+		return h.kmsUseError(c, err)
+	}
+	return apiSuccess(c, fiber.StatusOK, "Data encrypted", fiber.Map{
+		"key_id":     key.ID,
+		"version":    key.CurrentVersion,
+		"ciphertext": ciphertext,
+	})
+}
+
+// KMSDecrypt decrypts data encrypted with a KMS key
+//
+//	@Summary	Decrypt with KMS key
+//	@Description	Decrypt a ciphertext of the key, from any of its versions, given the encryption_context it was encrypted with. Needs a grant of decrypt on the key. The plaintext is returned base64. Every call is recorded in the audit log as kms_decrypt.
+//	@Tags		Key Management
+//	@Accept		json
+//	@Produce	json
+//	@Param		id		path	string				true	"Key ID"
+//	@Param		request	body	KMSDecryptRequest	true	"Ciphertext"
+//	@Success	200	{object}	SuccessResponse	"Data decrypted"
+//	@Failure	400	{object}	ErrorResponse	"Invalid ciphertext or context"
+//	@Failure	403	{object}	ErrorResponse	"Not granted"
+//	@Failure	404	{object}	ErrorResponse	"Key not found"
+//	@Failure	409	{object}	ErrorResponse	"Key is disabled"
+//	@Failure	503	{object}	ErrorResponse	"No encryption master key configured"
+//	@Security	BearerAuth
+//	@Router		/kms/keys/{id}/decrypt [post]
+func (h *KMSHandler) KMSDecrypt(c *fiber.Ctx) error {
+	var req KMSDecryptRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+	}
+	if req.Ciphertext == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "ciphertext is required")
+	}
+	key, err := h.key(c)
+	if key == nil {
+		return err
+	}
+
+	plaintext, err := h.kms.Decrypt(c.Context(), kmsCaller(c), key, req.Ciphertext, req.EncryptionContext)
+	if err != nil {
+		return h.kmsUseError(c, err)
+	}
+	return apiSuccess(c, fiber.StatusOK, "Data decrypted", fiber.Map{
+		"key_id":    key.ID,
+		"plaintext": base64.StdEncoding.EncodeToString(plaintext),
+	})
+}
+
+// GetKMSKeyUsage returns the audited uses of a KMS key
+//
+//	@Summary	KMS key usage
+//	@Description	List the audit events of a key, newest first: encrypt and decrypt calls (allowed or refused), rotations and changes to the key and its grants.
+//	@Tags		Key Management
+//	@Produce	json
+//	@Param		id		path	string	true	"Key ID"
+//	@Param		limit	query	int		false	"Limit (default: 50, max: 100)"
+//	@Param		offset	query	int		false	"Offset (default: 0)"
+//	@Success	200	{object}	SuccessResponse	"Key usage retrieved"
+//	@Failure	404	{object}	ErrorResponse	"Key not found"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Security	BearerAuth
+//	@Router		/kms/keys/{id}/usage [get]
+func (h *KMSHandler) GetKMSKeyUsage(c *fiber.Ctx) error {
+	key, err := h.key(c)
+	if key == nil {
+		return err
+	}
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	params := queries.ListAuditEventsParams{
+		OrganizationID: key.OrganizationID,
+		ResourceType:   "kms_key",
+		ResourceID:     key.ID,
+		Limit:          limit,
+		Offset:         c.QueryInt("offset", 0),
+	}
+	events, total, err := h.queries.Audit.ListAuditEvents(params)
+	if err != nil {
+		h.logger.Error("Failed to list KMS key usage: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve key usage")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Key usage retrieved", fiber.Map{
+		"events":      events,
+		"total_count": total,
+		"limit":       params.Limit,
+		"offset":      params.Offset,
+	})
+}
+
+// validateEncryptionKey checks that a resource's encryption_key_id names a
+// KMS key of the organization, returning why not
+func (h *ResourceHandler) validateEncryptionKey(ctx context.Context, keyID, organizationID string) (string, error) {
+	const msg = "encryption_key_id must be the ID of a KMS key of the organization"
+	if _, err := uuid.Parse(keyID); err != nil {
+		return msg, nil
+	}
+	if _, err := h.queries.KMS.WithContext(ctx).GetKey(keyID, organizationID); err != nil {
+		if isNotFoundErr(err) {
+			return msg, nil
+		}
+		return "", err
+	}
+	return "", nil
+}
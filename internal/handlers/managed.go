@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+// External IDs are chosen by infrastructure-as-code tools, e.g. the address
+// of a Terraform resource such as platform.billing-admin
+var externalIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:@-]{0,199}$`)
+
+// Results of an upsert
+const (
+	managedCreated   = "created"   // no resource had the external ID
+	managedImported  = "imported"  // an existing resource was bound to it
+	managedUpdated   = "updated"   // the spec differed and was written
+	managedUnchanged = "unchanged" // the spec matched; nothing was written
+)
+
+// errManagedUnchanged rolls back an update that left the spec as it was
+var errManagedUnchanged = errors.New("managed resource unchanged")
+
+// ManagedResource is a resource as infrastructure-as-code tools manage it:
+// its spec, the fields an upsert writes, and the content hash of the spec
+// for detecting drift. PUT .../external/{external_id} takes the spec as its
+// body, so an export applied as is changes nothing.
+type ManagedResource struct {
+	Kind        string      `json:"kind"`
+	ID          string      `json:"id"`
+	ExternalID  string      `json:"external_id,omitempty"`
+	Spec        interface{} `json:"spec"`
+	ContentHash string      `json:"content_hash"`
+	// Result is set on upserts: created, imported, updated or unchanged
+	Result string `json:"result,omitempty"`
+	// Credentials only shown once, such as the secret of a new OAuth client
+	Credentials interface{} `json:"credentials,omitempty"`
+}
+
+// managedError is a failed upsert to report to the caller as is
+type managedError struct {
+	status  int
+	code    apierror.Code
+	message string
+}
+
+func (e *managedError) Error() string { return e.message }
+
+func managedFail(status int, code apierror.Code, message string) error {
+	return &managedError{status: status, code: code, message: message}
+}
+
+// managedKind is how upserts and exports read and write one kind of
+// resource. The closures of an upsert capture the spec of the request.
+type managedKind struct {
+	kind  string // one of queries.ExternalKind*
+	label string // e.g. "Role", for messages
+	// read returns the spec of a resource
+	read func(q *queries.Queries, orgID, id string) (interface{}, error)
+	// create creates a resource from the spec and returns its ID and any
+	// credentials only shown now
+	create func(q *queries.Queries, orgID string) (string, interface{}, error)
+	// update writes the spec over a resource
+	update func(q *queries.Queries, orgID, id string) error
+	// written, when set, runs after a create or update has been committed
+	written func(id, result string)
+}
+
+// scope is the organization an external ID of the kind is scoped to;
+// organizations are their own scope
+func (mk managedKind) scope(orgID, id string) string {
+	if mk.kind == queries.ExternalKindOrganization {
+		return id
+	}
+	return orgID
+}
+
+// externalIDParam returns the external_id path parameter, responding and
+// returning "" when it is malformed
+func externalIDParam(c *fiber.Ctx) (string, error) {
+	externalID := c.Params("external_id")
+	if !externalIDPattern.MatchString(externalID) {
+		return "", apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed,
+			"external_id must start with a letter or digit and contain only letters, digits and . _ : @ - (at most 200 characters)")
+	}
+	return externalID, nil
+}
+
+// managedResource reads a resource into its managed form
+func managedResource(q *queries.Queries, mk managedKind, orgID, id string) (*ManagedResource, error) {
+	spec, err := mk.read(q, orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	externalID, err := q.ExternalID.Get(mk.kind, mk.scope(orgID, id), id)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := utils.ContentHash(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &ManagedResource{Kind: mk.kind, ID: id, ExternalID: externalID, Spec: spec, ContentHash: hash}, nil
+}
+
+// managedChange is what applying a spec did to a resource
+type managedChange struct {
+	ID     string
+	Result string
+	// Before is nil for created resources
+	Before, After *ManagedResource
+	// Credentials only shown once, such as the secret of a new OAuth client
+	Credentials interface{}
+}
+
+// applyManaged creates or updates the resource of the kind with the
+// external ID in the transaction of q; the closures of mk carry the spec.
+// adoptID, when set, names an existing resource without an external ID to
+// import instead of creating one. An update that would leave the spec as it
+// is is rolled back, so it writes nothing and reports "unchanged".
+func applyManaged(ctx context.Context, q *queries.Queries, mk managedKind, orgID, externalID, adoptID string) (*managedChange, error) {
+	change := &managedChange{Result: managedUpdated}
+	err := q.Savepoint(ctx, func(q *queries.Queries) error {
+		existing, err := q.ExternalID.Resolve(mk.kind, orgID, externalID)
+		switch {
+		case err == nil:
+			change.ID = existing
+		case !isNotFoundErr(err):
+			return err
+		case adoptID != "":
+			bound, err := q.ExternalID.Get(mk.kind, mk.scope(orgID, adoptID), adoptID)
+			if isNotFoundErr(err) {
+				return managedFail(fiber.StatusNotFound, apierror.CodeNotFound, mk.label+" to adopt not found")
+			}
+			if err != nil {
+				return err
+			}
+			if bound != "" {
+				return managedFail(fiber.StatusConflict, apierror.CodeConflict, mk.label+" to adopt already has the external ID "+bound)
+			}
+			if err := q.ExternalID.Set(mk.kind, mk.scope(orgID, adoptID), adoptID, externalID); err != nil {
+				return err
+			}
+			change.ID, change.Result = adoptID, managedImported
+		default:
+			id, credentials, err := mk.create(q, orgID)
+			if err != nil {
+				return err
+			}
+			if err := q.ExternalID.Set(mk.kind, mk.scope(orgID, id), id, externalID); err != nil {
+				return err
+			}
+			change.ID, change.Result, change.Credentials = id, managedCreated, credentials
+			change.After, err = managedResource(q, mk, orgID, id)
+			return err
+		}
+
+		if change.Before, err = managedResource(q, mk, orgID, change.ID); err != nil {
+			return err
+		}
+		if err := mk.update(q, orgID, change.ID); err != nil {
+			return err
+		}
+		if change.After, err = managedResource(q, mk, orgID, change.ID); err != nil {
+			return err
+		}
+		if change.Result == managedUpdated && change.After.ContentHash == change.Before.ContentHash {
+			return errManagedUnchanged
+		}
+		return nil
+	})
+	if errors.Is(err, errManagedUnchanged) {
+		// What was rolled back is what is there
+		change.Result, change.After = managedUnchanged, change.Before
+		return change, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// managedFailure returns a failed create or update of a resource of the
+// kind as reported to the caller, or nil for errors that are not the
+// caller's
+func managedFailure(mk managedKind, err error) *managedError {
+	var failed *managedError
+	switch {
+	case errors.As(err, &failed):
+		return failed
+	case isConflictErr(err):
+		return &managedError{fiber.StatusConflict, apierror.CodeConflict,
+			mk.label + " conflicts with an existing one, e.g. by name or external ID"}
+	case isNotFoundErr(err):
+		return &managedError{fiber.StatusNotFound, apierror.CodeNotFound, mk.label + " not found"}
+	}
+	return nil
+}
+
+// upsertManaged creates or updates the resource of the kind with the
+// external ID of the request. ?adopt={id} imports an existing resource
+// without an external ID instead of creating one.
+func upsertManaged(c *fiber.Ctx, qs *queries.Queries, log *logger.Logger, mk managedKind, orgID string) error {
+	externalID, err := externalIDParam(c)
+	if externalID == "" {
+		return err
+	}
+	adoptID := c.Query("adopt")
+	if adoptID != "" && !validID(adoptID) {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "adopt must be the ID of an existing "+mk.kind)
+	}
+
+	var change *managedChange
+	err = qs.Transact(c.UserContext(), func(q *queries.Queries) error {
+		var err error
+		change, err = applyManaged(c.UserContext(), q, mk, orgID, externalID, adoptID)
+		return err
+	})
+	if err != nil {
+		if failed := managedFailure(mk, err); failed != nil {
+			return apiError(c, failed.status, failed.code, failed.message)
+		}
+		log.Error("Failed to upsert %s %s: %v", mk.kind, externalID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to apply "+mk.kind)
+	}
+	if change.Result != managedUnchanged && mk.written != nil {
+		mk.written(change.ID, change.Result)
+	}
+
+	resource := *change.After
+	resource.Result = change.Result
+	resource.Credentials = change.Credentials
+	status := fiber.StatusOK
+	if change.Result == managedCreated {
+		status = fiber.StatusCreated
+	}
+	c.Set(fiber.HeaderETag, `"`+resource.ContentHash+`"`)
+	return apiSuccess(c, status, mk.label+" "+change.Result, resource)
+}
+
+// exportManaged responds with the managed form of the resource named by
+// the id or external_id path parameter. Its ETag is the content hash, so
+// drift checks can poll with If-None-Match.
+func exportManaged(c *fiber.Ctx, qs *queries.Queries, log *logger.Logger, mk managedKind, orgID string) error {
+	q := qs.WithContext(c.UserContext())
+	id := c.Params("id")
+	if c.Params("external_id") != "" {
+		externalID, err := externalIDParam(c)
+		if externalID == "" {
+			return err
+		}
+		if id, err = q.ExternalID.Resolve(mk.kind, orgID, externalID); err != nil {
+			if isNotFoundErr(err) {
+				return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, mk.label+" not found")
+			}
+			log.Error("Failed to resolve %s %s: %v", mk.kind, externalID, err)
+			return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to export "+mk.kind)
+		}
+	}
+
+	if !validID(id) {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, mk.label+" not found")
+	}
+	resource, err := managedResource(q, mk, orgID, id)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, mk.label+" not found")
+		}
+		log.Error("Failed to export %s %s: %v", mk.kind, id, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to export "+mk.kind)
+	}
+	if notModified(c, `"`+resource.ContentHash+`"`, time.Time{}, cacheRevalidate) {
+		return nil
+	}
+	return apiSuccess(c, fiber.StatusOK, mk.label+" exported", resource)
+}
+
+// parseSpec decodes the body of an upsert into spec, responding when it is
+// not valid JSON
+func parseSpec(c *fiber.Ctx, spec interface{}) (bool, error) {
+	if err := json.Unmarshal(c.Body(), spec); err != nil {
+		return false, apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid JSON format")
+	}
+	return true, nil
+}
+
+// validID reports whether id, taken from the request, is a UUID as the IDs
+// of every managed kind are; the database refuses anything else
+func validID(id string) bool {
+	_, err := uuid.Parse(id)
+	return err == nil
+}
+
+// specObject normalizes a JSON object field of a spec, empty meaning {}
+func specObject(field string, raw json.RawMessage) (string, error) {
+	obj, err := utils.NormalizeJSONObject(string(raw))
+	if err != nil {
+		return "", managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed, field+" must be a JSON object")
+	}
+	return obj, nil
+}
+
+// specStatus checks the status of a spec, empty meaning active
+func specStatus(status string) (string, error) {
+	switch status {
+	case "":
+		return "active", nil
+	case "active", "suspended", "archived":
+		return status, nil
+	}
+	return "", managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed, "status must be active, suspended or archived")
+}
+
+// respondSpecError responds to a spec that failed validation
+func respondSpecError(c *fiber.Ctx, err error) error {
+	var failed *managedError
+	if errors.As(err, &failed) {
+		return apiError(c, failed.status, failed.code, failed.message)
+	}
+	return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, err.Error())
+}
@@ -0,0 +1,921 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/events"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Managed specs hold the fields of a resource its owner chooses. Fields the
+// server maintains, such as timestamps, versions and secrets, are left out
+// so that they do not show up as drift. Omitted fields take the defaults of
+// the create endpoints, on updates too: an upsert replaces the whole spec.
+
+// RoleSpec is the managed form of a role
+type RoleSpec struct {
+	Name                string          `json:"name"`
+	Description         string          `json:"description"`
+	MaxSessionDuration  string          `json:"max_session_duration"`
+	TrustPolicy         json.RawMessage `json:"trust_policy"`
+	AssumeRolePolicy    json.RawMessage `json:"assume_role_policy"`
+	Tags                json.RawMessage `json:"tags"`
+	Path                string          `json:"path"`
+	PermissionsBoundary *string         `json:"permissions_boundary"`
+	Status              string          `json:"status"`
+}
+
+// PolicySpec is the managed form of a policy
+type PolicySpec struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Document    json.RawMessage `json:"document"`
+	PolicyType  string          `json:"policy_type"`
+	Effect      string          `json:"effect"`
+	Status      string          `json:"status"`
+}
+
+// ServiceAccountSpec is the managed form of a service account
+type ServiceAccountSpec struct {
+	Name              string          `json:"name"`
+	Description       string          `json:"description"`
+	KeyRotationPolicy json.RawMessage `json:"key_rotation_policy"`
+	AllowedIPRanges   []string        `json:"allowed_ip_ranges"`
+	MaxTokenLifetime  string          `json:"max_token_lifetime"`
+	Attributes        json.RawMessage `json:"attributes"`
+	Status            string          `json:"status"`
+}
+
+// GroupSpec is the managed form of a group. Its parent group and members
+// are not part of it: they are kept as they are on updates.
+type GroupSpec struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	GroupType   string          `json:"group_type"`
+	Attributes  json.RawMessage `json:"attributes"`
+	MaxMembers  int             `json:"max_members"`
+	Status      string          `json:"status"`
+}
+
+// OrganizationSpec is the managed form of an organization. Its settings and
+// origins have endpoints of their own and are not part of it.
+type OrganizationSpec struct {
+	Name         string          `json:"name"`
+	Slug         string          `json:"slug"`
+	Description  string          `json:"description"`
+	Metadata     json.RawMessage `json:"metadata"`
+	BillingTier  string          `json:"billing_tier"`
+	MaxUsers     int             `json:"max_users"`
+	MaxResources int             `json:"max_resources"`
+}
+
+// The managed form of an OAuth client is its RegisterClientRequest; the
+// secret is only returned, as credentials, when an upsert creates it.
+
+// Service account names must match the valid_sa_name constraint
+var serviceAccountNamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{3,}$`)
+
+// rawObject turns a JSONB column into a spec field
+func rawObject(s string) json.RawMessage {
+	if s == "" {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(s)
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// roleKind manages roles; spec is nil for exports
+func (h *RoleHandler) roleKind(spec *RoleSpec) managedKind {
+	apply := func(role *models.Role) {
+		role.Name = spec.Name
+		role.Description = &spec.Description
+		role.MaxSessionDuration = &spec.MaxSessionDuration
+		role.TrustPolicy = string(spec.TrustPolicy)
+		role.AssumeRolePolicy = string(spec.AssumeRolePolicy)
+		role.Tags = string(spec.Tags)
+		role.Path = &spec.Path
+		role.PermissionsBoundary = spec.PermissionsBoundary
+		role.Status = spec.Status
+	}
+	return managedKind{
+		kind:  queries.ExternalKindRole,
+		label: "Role",
+		read: func(q *queries.Queries, orgID, id string) (interface{}, error) {
+			role, err := q.Role.GetRole(id, orgID)
+			if err != nil {
+				return nil, err
+			}
+			return RoleSpec{
+				Name:                role.Name,
+				Description:         stringValue(role.Description),
+				MaxSessionDuration:  stringValue(role.MaxSessionDuration),
+				TrustPolicy:         rawObject(role.TrustPolicy),
+				AssumeRolePolicy:    rawObject(role.AssumeRolePolicy),
+				Tags:                rawObject(role.Tags),
+				Path:                stringValue(role.Path),
+				PermissionsBoundary: role.PermissionsBoundary,
+				Status:              role.Status,
+			}, nil
+		},
+		create: func(q *queries.Queries, orgID string) (string, interface{}, error) {
+			role := &models.Role{ID: uuid.New().String(), OrganizationID: orgID, RoleType: "custom"}
+			apply(role)
+			return role.ID, nil, q.Role.CreateRole(role)
+		},
+		update: func(q *queries.Queries, orgID, id string) error {
+			role, err := q.Role.GetRole(id, orgID)
+			if err != nil {
+				return err
+			}
+			if role.IsSystemRole {
+				return managedFail(fiber.StatusForbidden, apierror.CodeForbidden, "System roles cannot be managed")
+			}
+			apply(role)
+			return q.Role.UpdateRole(role, orgID)
+		},
+	}
+}
+
+func (s *RoleSpec) normalize() error {
+	var err error
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		return managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed, "Role name is required")
+	}
+	if s.MaxSessionDuration == "" {
+		s.MaxSessionDuration = "12 hours"
+	}
+	if s.Path == "" {
+		s.Path = "/"
+	}
+	if s.Path != "/" && (!strings.HasPrefix(s.Path, "/") || !strings.HasSuffix(s.Path, "/")) {
+		return managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed, "path must start and end with /")
+	}
+	if s.PermissionsBoundary != nil {
+		if *s.PermissionsBoundary == "" {
+			s.PermissionsBoundary = nil
+		} else if _, err := uuid.Parse(*s.PermissionsBoundary); err != nil {
+			return managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed, "permissions_boundary must be a policy ID")
+		}
+	}
+	if s.Status, err = specStatus(s.Status); err != nil {
+		return err
+	}
+	for field, raw := range map[string]*json.RawMessage{"trust_policy": &s.TrustPolicy, "assume_role_policy": &s.AssumeRolePolicy, "tags": &s.Tags} {
+		obj, err := specObject(field, *raw)
+		if err != nil {
+			return err
+		}
+		*raw = json.RawMessage(obj)
+	}
+	return nil
+}
+
+// UpsertRole creates or updates the role with an external ID
+//
+//	@Summary		Upsert role by external ID
+//	@Description	Creates the role with the external ID, or replaces the spec of the role that has it; fields left out take their defaults. An update that changes nothing writes nothing and reports result "unchanged". ?adopt={id} imports an existing role without an external ID. Responds with the role in its export form.
+//	@Tags			Role Management
+//	@Accept			json
+//	@Produce		json
+//	@Param			external_id	path		string			true	"External ID"
+//	@Param			adopt		query		string			false	"ID of an existing role to import"
+//	@Param			request		body		RoleSpec		true	"Role spec"
+//	@Success		200			{object}	ManagedResource	"Role updated, imported or unchanged"
+//	@Success		201			{object}	ManagedResource	"Role created"
+//	@Failure		400			{object}	ErrorResponse	"Invalid spec or external ID"
+//	@Failure		404			{object}	ErrorResponse	"Role to adopt not found"
+//	@Failure		409			{object}	ErrorResponse	"Name or external ID taken"
+//	@Failure		500			{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/roles/external/{external_id} [put]
+func (h *RoleHandler) UpsertRole(c *fiber.Ctx) error {
+	var spec RoleSpec
+	if ok, err := parseSpec(c, &spec); !ok {
+		return err
+	}
+	if err := spec.normalize(); err != nil {
+		return respondSpecError(c, err)
+	}
+	return upsertManaged(c, h.queries, h.logger, h.roleKind(&spec), c.Locals("organization_id").(string))
+}
+
+// ExportRole returns a role in its managed form
+//
+//	@Summary		Export role
+//	@Description	Returns the spec of a role, its external ID and the content hash of the spec, which is also its ETag. The spec can be applied as is with PUT /roles/external/{external_id}.
+//	@Tags			Role Management
+//	@Produce		json
+//	@Param			id			path		string			false	"Role ID"
+//	@Param			external_id	path		string			false	"External ID"
+//	@Success		200			{object}	ManagedResource	"Role exported"
+//	@Success		304			"Unchanged since the ETag in If-None-Match"
+//	@Failure		404			{object}	ErrorResponse	"Role not found"
+//	@Failure		500			{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/roles/{id}/export [get]
+//	@Router			/roles/external/{external_id}/export [get]
+func (h *RoleHandler) ExportRole(c *fiber.Ctx) error {
+	return exportManaged(c, h.queries, h.logger, h.roleKind(nil), c.Locals("organization_id").(string))
+}
+
+// policyKind manages policies; spec is nil for exports
+func (h *PolicyHandler) policyKind(c *fiber.Ctx, spec *PolicySpec) managedKind {
+	userID, _ := c.Locals("user_id").(string)
+	apply := func(policy *models.Policy) {
+		policy.Name = spec.Name
+		policy.Description = spec.Description
+		policy.Document = string(spec.Document)
+		policy.PolicyType = spec.PolicyType
+		policy.Effect = spec.Effect
+		policy.Status = spec.Status
+		if userID != "" {
+			policy.CreatedBy = &userID
+		}
+	}
+	return managedKind{
+		kind:  queries.ExternalKindPolicy,
+		label: "Policy",
+		read: func(q *queries.Queries, orgID, id string) (interface{}, error) {
+			policy, err := q.Policy.GetPolicy(id, orgID)
+			if err != nil {
+				return nil, err
+			}
+			return PolicySpec{
+				Name:        policy.Name,
+				Description: policy.Description,
+				Document:    rawObject(policy.Document),
+				PolicyType:  policy.PolicyType,
+				Effect:      policy.Effect,
+				Status:      policy.Status,
+			}, nil
+		},
+		create: func(q *queries.Queries, orgID string) (string, interface{}, error) {
+			policy := &models.Policy{ID: uuid.New().String(), OrganizationID: orgID, Version: "1.0.0"}
+			apply(policy)
+			return policy.ID, nil, q.Policy.CreatePolicy(policy)
+		},
+		update: func(q *queries.Queries, orgID, id string) error {
+			policy, err := q.Policy.GetPolicy(id, orgID)
+			if err != nil {
+				return err
+			}
+			if policy.IsSystemPolicy {
+				return managedFail(fiber.StatusForbidden, apierror.CodeForbidden, "System policies cannot be managed")
+			}
+			apply(policy)
+			// 0 matches any version: the spec replaces the policy as a whole
+			policy.LockVersion = 0
+			return q.Policy.UpdatePolicy(policy, orgID)
+		},
+		written: func(id, result string) {
+			policy, err := h.queries.Policy.GetPolicy(id, c.Locals("organization_id").(string))
+			if err != nil {
+				return
+			}
+			kind := events.PolicyUpdated
+			if result == managedCreated {
+				kind = events.PolicyCreated
+			}
+			h.publishPolicy(c, kind, policy)
+		},
+	}
+}
+
+func (s *PolicySpec) normalize() error {
+	var err error
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		return managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed, "Policy name is required")
+	}
+	// Like the create endpoint, the document may be a JSON-quoted string
+	var quoted string
+	if err := json.Unmarshal(s.Document, &quoted); err == nil {
+		s.Document = json.RawMessage(quoted)
+	}
+	var doc map[string]interface{}
+	if len(s.Document) == 0 || json.Unmarshal(s.Document, &doc) != nil || doc == nil {
+		return managedFail(fiber.StatusBadRequest, apierror.CodeInvalidPolicyDocument, "Policy document must be a JSON object")
+	}
+	if s.PolicyType == "" {
+		s.PolicyType = "access"
+	}
+	switch s.Effect {
+	case "":
+		s.Effect = "allow"
+	case "allow", "deny":
+	default:
+		return managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed, "effect must be allow or deny")
+	}
+	s.Status, err = specStatus(s.Status)
+	return err
+}
+
+// UpsertPolicy creates or updates the policy with an external ID
+//
+//	@Summary		Upsert policy by external ID
+//	@Description	Creates the policy with the external ID, or replaces the spec of the policy that has it; a changed document gets a new policy version. An update that changes nothing writes nothing, not even a version, and reports result "unchanged". ?adopt={id} imports an existing policy without an external ID. Responds with the policy in its export form.
+//	@Tags			Policy Management
+//	@Accept			json
+//	@Produce		json
+//	@Param			external_id	path		string			true	"External ID"
+//	@Param			adopt		query		string			false	"ID of an existing policy to import"
+//	@Param			request		body		PolicySpec		true	"Policy spec"
+//	@Success		200			{object}	ManagedResource	"Policy updated, imported or unchanged"
+//	@Success		201			{object}	ManagedResource	"Policy created"
+//	@Failure		400			{object}	ErrorResponse	"Invalid spec, policy document or external ID"
+//	@Failure		404			{object}	ErrorResponse	"Policy to adopt not found"
+//	@Failure		409			{object}	ErrorResponse	"Name or external ID taken"
+//	@Failure		500			{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/policies/external/{external_id} [put]
+func (h *PolicyHandler) UpsertPolicy(c *fiber.Ctx) error {
+	var spec PolicySpec
+	if ok, err := parseSpec(c, &spec); !ok {
+		return err
+	}
+	if err := spec.normalize(); err != nil {
+		return respondSpecError(c, err)
+	}
+	return upsertManaged(c, h.queries, h.logger, h.policyKind(c, &spec), c.Locals("organization_id").(string))
+}
+
+// ExportPolicy returns a policy in its managed form
+//
+//	@Summary		Export policy
+//	@Description	Returns the spec of a policy, its external ID and the content hash of the spec, which is also its ETag. The spec can be applied as is with PUT /policies/external/{external_id}.
+//	@Tags			Policy Management
+//	@Produce		json
+//	@Param			id			path		string			false	"Policy ID"
+//	@Param			external_id	path		string			false	"External ID"
+//	@Success		200			{object}	ManagedResource	"Policy exported"
+//	@Success		304			"Unchanged since the ETag in If-None-Match"
+//	@Failure		404			{object}	ErrorResponse	"Policy not found"
+//	@Failure		500			{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/policies/{id}/export [get]
+//	@Router			/policies/external/{external_id}/export [get]
+func (h *PolicyHandler) ExportPolicy(c *fiber.Ctx) error {
+	return exportManaged(c, h.queries, h.logger, h.policyKind(c, nil), c.Locals("organization_id").(string))
+}
+
+// serviceAccountKind manages service accounts; spec is nil for exports
+func (h *UserHandler) serviceAccountKind(spec *ServiceAccountSpec) managedKind {
+	apply := func(sa *models.ServiceAccount) {
+		sa.Name = spec.Name
+		sa.Description = spec.Description
+		sa.KeyRotationPolicy = string(spec.KeyRotationPolicy)
+		sa.AllowedIPRanges = spec.AllowedIPRanges
+		sa.MaxTokenLifetime = spec.MaxTokenLifetime
+		sa.Attributes = string(spec.Attributes)
+		sa.Status = spec.Status
+	}
+	return managedKind{
+		kind:  queries.ExternalKindServiceAccount,
+		label: "Service account",
+		read: func(q *queries.Queries, orgID, id string) (interface{}, error) {
+			sa, err := q.User.GetServiceAccount(id, orgID)
+			if err != nil {
+				return nil, err
+			}
+			ranges := sa.AllowedIPRanges
+			if ranges == nil {
+				ranges = []string{}
+			}
+			return ServiceAccountSpec{
+				Name:              sa.Name,
+				Description:       sa.Description,
+				KeyRotationPolicy: rawObject(sa.KeyRotationPolicy),
+				AllowedIPRanges:   ranges,
+				MaxTokenLifetime:  sa.MaxTokenLifetime,
+				Attributes:        rawObject(sa.Attributes),
+				Status:            sa.Status,
+			}, nil
+		},
+		create: func(q *queries.Queries, orgID string) (string, interface{}, error) {
+			sa := &models.ServiceAccount{ID: uuid.NewString(), OrganizationID: orgID}
+			apply(sa)
+			return sa.ID, nil, q.User.CreateServiceAccount(sa)
+		},
+		update: func(q *queries.Queries, orgID, id string) error {
+			sa, err := q.User.GetServiceAccount(id, orgID)
+			if err != nil {
+				return err
+			}
+			apply(sa)
+			return q.User.UpdateServiceAccount(sa, orgID)
+		},
+	}
+}
+
+func (s *ServiceAccountSpec) normalize() error {
+	var err error
+	if !serviceAccountNamePattern.MatchString(s.Name) {
+		return managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed,
+			"Service account name must be at least 3 characters of letters, numbers, dots, underscores, and hyphens")
+	}
+	if len(s.KeyRotationPolicy) == 0 {
+		s.KeyRotationPolicy = json.RawMessage(`{"enabled": true, "rotation_days": 90}`)
+	}
+	for field, raw := range map[string]*json.RawMessage{"key_rotation_policy": &s.KeyRotationPolicy, "attributes": &s.Attributes} {
+		obj, err := specObject(field, *raw)
+		if err != nil {
+			return err
+		}
+		*raw = json.RawMessage(obj)
+	}
+	if s.AllowedIPRanges == nil {
+		s.AllowedIPRanges = []string{}
+	}
+	if s.MaxTokenLifetime == "" {
+		s.MaxTokenLifetime = "24 hours"
+	}
+	s.Status, err = specStatus(s.Status)
+	return err
+}
+
+// UpsertServiceAccount creates or updates the service account with an
+// external ID
+//
+//	@Summary		Upsert service account by external ID
+//	@Description	Creates the service account with the external ID, or replaces the spec of the service account that has it; fields left out take their defaults. Its API keys are not part of the spec. An update that changes nothing writes nothing and reports result "unchanged". ?adopt={id} imports an existing service account without an external ID.
+//	@Tags			Service Accounts
+//	@Accept			json
+//	@Produce		json
+//	@Param			external_id	path		string				true	"External ID"
+//	@Param			adopt		query		string				false	"ID of an existing service account to import"
+//	@Param			request		body		ServiceAccountSpec	true	"Service account spec"
+//	@Success		200			{object}	ManagedResource		"Service account updated, imported or unchanged"
+//	@Success		201			{object}	ManagedResource		"Service account created"
+//	@Failure		400			{object}	ErrorResponse		"Invalid spec or external ID"
+//	@Failure		404			{object}	ErrorResponse		"Service account to adopt not found"
+//	@Failure		409			{object}	ErrorResponse		"Name or external ID taken"
+//	@Failure		500			{object}	ErrorResponse		"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/service-accounts/external/{external_id} [put]
+func (h *UserHandler) UpsertServiceAccount(c *fiber.Ctx) error {
+	var spec ServiceAccountSpec
+	if ok, err := parseSpec(c, &spec); !ok {
+		return err
+	}
+	if err := spec.normalize(); err != nil {
+		return respondSpecError(c, err)
+	}
+	return upsertManaged(c, h.queries, h.logger, h.serviceAccountKind(&spec), c.Locals("organization_id").(string))
+}
+
+// ExportServiceAccount returns a service account in its managed form
+//
+//	@Summary		Export service account
+//	@Description	Returns the spec of a service account, its external ID and the content hash of the spec, which is also its ETag.
+//	@Tags			Service Accounts
+//	@Produce		json
+//	@Param			id			path		string			false	"Service account ID"
+//	@Param			external_id	path		string			false	"External ID"
+//	@Success		200			{object}	ManagedResource	"Service account exported"
+//	@Success		304			"Unchanged since the ETag in If-None-Match"
+//	@Failure		404			{object}	ErrorResponse	"Service account not found"
+//	@Failure		500			{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/service-accounts/{id}/export [get]
+//	@Router			/service-accounts/external/{external_id}/export [get]
+func (h *UserHandler) ExportServiceAccount(c *fiber.Ctx) error {
+	return exportManaged(c, h.queries, h.logger, h.serviceAccountKind(nil), c.Locals("organization_id").(string))
+}
+
+// groupKind manages groups; spec is nil for exports
+func (h *GroupHandler) groupKind(spec *GroupSpec) managedKind {
+	apply := func(g *models.Group) {
+		g.Name = spec.Name
+		g.Description = spec.Description
+		g.GroupType = spec.GroupType
+		g.Attributes = string(spec.Attributes)
+		g.MaxMembers = spec.MaxMembers
+		g.Status = spec.Status
+	}
+	return managedKind{
+		kind:  queries.ExternalKindGroup,
+		label: "Group",
+		read: func(q *queries.Queries, orgID, id string) (interface{}, error) {
+			g, err := q.Group.GetGroup(id, orgID)
+			if err != nil {
+				return nil, err
+			}
+			return GroupSpec{
+				Name:        g.Name,
+				Description: g.Description,
+				GroupType:   g.GroupType,
+				Attributes:  rawObject(g.Attributes),
+				MaxMembers:  g.MaxMembers,
+				Status:      g.Status,
+			}, nil
+		},
+		create: func(q *queries.Queries, orgID string) (string, interface{}, error) {
+			g := &models.Group{ID: uuid.NewString(), OrganizationID: orgID}
+			apply(g)
+			return g.ID, nil, q.Group.CreateGroup(g)
+		},
+		update: func(q *queries.Queries, orgID, id string) error {
+			g, err := q.Group.GetGroup(id, orgID)
+			if err != nil {
+				return err
+			}
+			apply(g)
+			return q.Group.UpdateGroup(g, orgID)
+		},
+	}
+}
+
+func (s *GroupSpec) normalize() error {
+	var err error
+	s.Name = strings.TrimSpace(s.Name)
+	if len(s.Name) < 2 {
+		return managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed, "Group name must be at least 2 characters")
+	}
+	if s.GroupType == "" {
+		s.GroupType = "standard"
+	}
+	attributes, err := specObject("attributes", s.Attributes)
+	if err != nil {
+		return err
+	}
+	s.Attributes = json.RawMessage(attributes)
+	if s.MaxMembers == 0 {
+		s.MaxMembers = 1000
+	}
+	if s.MaxMembers < 0 {
+		return managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed, "max_members must not be negative")
+	}
+	s.Status, err = specStatus(s.Status)
+	return err
+}
+
+// UpsertGroup creates or updates the group with an external ID
+//
+//	@Summary		Upsert group by external ID
+//	@Description	Creates the group with the external ID, or replaces the spec of the group that has it; fields left out take their defaults. Its parent group and members are not part of the spec. An update that changes nothing writes nothing and reports result "unchanged". ?adopt={id} imports an existing group without an external ID.
+//	@Tags			Group Management
+//	@Accept			json
+//	@Produce		json
+//	@Param			external_id	path		string			true	"External ID"
+//	@Param			adopt		query		string			false	"ID of an existing group to import"
+//	@Param			request		body		GroupSpec		true	"Group spec"
+//	@Success		200			{object}	ManagedResource	"Group updated, imported or unchanged"
+//	@Success		201			{object}	ManagedResource	"Group created"
+//	@Failure		400			{object}	ErrorResponse	"Invalid spec or external ID"
+//	@Failure		404			{object}	ErrorResponse	"Group to adopt not found"
+//	@Failure		409			{object}	ErrorResponse	"Name or external ID taken"
+//	@Failure		500			{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/groups/external/{external_id} [put]
+func (h *GroupHandler) UpsertGroup(c *fiber.Ctx) error {
+	var spec GroupSpec
+	if ok, err := parseSpec(c, &spec); !ok {
+		return err
+	}
+	if err := spec.normalize(); err != nil {
+		return respondSpecError(c, err)
+	}
+	return upsertManaged(c, h.queries, h.logger, h.groupKind(&spec), c.Locals("organization_id").(string))
+}
+
+// ExportGroup returns a group in its managed form
+//
+//	@Summary		Export group
+//	@Description	Returns the spec of a group, its external ID and the content hash of the spec, which is also its ETag.
+//	@Tags			Group Management
+//	@Produce		json
+//	@Param			id			path		string			false	"Group ID"
+//	@Param			external_id	path		string			false	"External ID"
+//	@Success		200			{object}	ManagedResource	"Group exported"
+//	@Success		304			"Unchanged since the ETag in If-None-Match"
+//	@Failure		404			{object}	ErrorResponse	"Group not found"
+//	@Failure		500			{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/groups/{id}/export [get]
+//	@Router			/groups/external/{external_id}/export [get]
+func (h *GroupHandler) ExportGroup(c *fiber.Ctx) error {
+	return exportManaged(c, h.queries, h.logger, h.groupKind(nil), c.Locals("organization_id").(string))
+}
+
+// clientKind manages OAuth clients; spec is nil for exports
+func (h *OIDCHandler) clientKind(c *fiber.Ctx, spec *RegisterClientRequest) managedKind {
+	apply := func(client *models.OAuthClient) {
+		client.ClientName = spec.ClientName
+		client.RedirectURIs = spec.RedirectURIs
+		client.GrantTypes = spec.GrantTypes
+		client.Scope = spec.Scope
+		client.Audiences = spec.Audiences
+		client.AllowedOrigins = spec.AllowedOrigins
+		client.AllowWildcards = spec.AllowWildcards
+		client.IsPublic = spec.IsPublic
+		client.LogoURL = spec.LogoURL
+		client.TokenPolicy = spec.TokenPolicy
+		client.UpdatedAt = time.Now()
+	}
+	// Clients are looked up by ID alone, e.g. by the token endpoint
+	get := func(q *queries.Queries, orgID, id string) (*models.OAuthClient, error) {
+		client, err := q.OIDC.GetClientByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if client == nil || client.OrganizationID != orgID {
+			return nil, managedFail(fiber.StatusNotFound, apierror.CodeNotFound, "Client not found")
+		}
+		return client, nil
+	}
+	return managedKind{
+		kind:  queries.ExternalKindOAuthClient,
+		label: "Client",
+		read: func(q *queries.Queries, orgID, id string) (interface{}, error) {
+			client, err := get(q, orgID, id)
+			if err != nil {
+				return nil, err
+			}
+			return RegisterClientRequest{
+				ClientName:     client.ClientName,
+				RedirectURIs:   client.RedirectURIs,
+				Scope:          client.Scope,
+				IsPublic:       client.IsPublic,
+				LogoURL:        client.LogoURL,
+				Audiences:      client.Audiences,
+				GrantTypes:     client.GrantTypes,
+				AllowedOrigins: client.AllowedOrigins,
+				AllowWildcards: client.AllowWildcards,
+				TokenPolicy:    client.TokenPolicy,
+			}, nil
+		},
+		create: func(q *queries.Queries, orgID string) (string, interface{}, error) {
+			secret := generateClientSecret()
+			secretHash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+			if err != nil {
+				return "", nil, err
+			}
+			client := &models.OAuthClient{
+				ID:               generateClientID(),
+				OrganizationID:   orgID,
+				ClientSecretHash: string(secretHash),
+				ResponseTypes:    []string{"code"},
+				CreatedAt:        time.Now(),
+			}
+			apply(client)
+			if err := q.OIDC.CreateClient(client); err != nil {
+				return "", nil, err
+			}
+			return client.ID, fiber.Map{"client_id": client.ID, "client_secret": secret}, nil
+		},
+		update: func(q *queries.Queries, orgID, id string) error {
+			client, err := get(q, orgID, id)
+			if err != nil {
+				return err
+			}
+			apply(client)
+			return q.OIDC.UpdateClient(client)
+		},
+		written: func(id, result string) {
+			if spec.AllowWildcards {
+				h.logWildcardClient(c, "upsert_wildcard_oauth_client", c.Locals("organization_id").(string), id, spec)
+			}
+		},
+	}
+}
+
+// normalizeClientSpec validates a client spec as client registrations are
+// validated and fills in their defaults
+func (h *OIDCHandler) normalizeClientSpec(orgID string, spec *RegisterClientRequest) error {
+	if spec.ClientName == "" || len(spec.RedirectURIs) == 0 {
+		return managedFail(fiber.StatusBadRequest, apierror.CodeInvalidRequest, "client_name and redirect_uris are required")
+	}
+	if msg := validateGrantTypes(spec); msg != "" {
+		return managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed, msg)
+	}
+	if _, msg := validateClientURIs(spec); msg != "" {
+		return managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed, msg)
+	}
+	if len(spec.GrantTypes) == 0 {
+		spec.GrantTypes = []string{"authorization_code", "refresh_token"}
+	}
+	if spec.Scope == "" {
+		spec.Scope = defaultClientScope
+	}
+	msg, err := h.tokenPolicyProblem(orgID, spec)
+	if err != nil {
+		h.logger.Error("Failed to read client token limits: %v", err)
+		return managedFail(fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to validate client token policy")
+	}
+	if msg != "" {
+		return managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed, msg)
+	}
+	err = h.oidc.CheckClientScopes(orgID, spec.Scope, spec.Audiences)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, services.ErrUnknownScope), errors.Is(err, services.ErrUnknownAudience):
+		return managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed, err.Error())
+	}
+	h.logger.Error("Failed to check client scopes: %v", err)
+	return managedFail(fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to validate client scopes")
+}
+
+// UpsertClient creates or updates the OIDC client with an external ID
+//
+//	@Summary		Upsert OIDC client by external ID
+//	@Description	Creates the client with the external ID, or replaces the registration of the client that has it; fields left out take their defaults. The client secret is only returned, under credentials, when the client is created. An update that changes nothing writes nothing and reports result "unchanged". ?adopt={id} imports an existing client without an external ID.
+//	@Tags			Federation
+//	@Accept			json
+//	@Produce		json
+//	@Param			external_id	path		string					true	"External ID"
+//	@Param			adopt		query		string					false	"ID of an existing client to import"
+//	@Param			request		body		RegisterClientRequest	true	"Client registration"
+//	@Success		200			{object}	ManagedResource			"Client updated, imported or unchanged"
+//	@Success		201			{object}	ManagedResource			"Client created"
+//	@Failure		400			{object}	ErrorResponse			"Invalid registration or external ID"
+//	@Failure		404			{object}	ErrorResponse			"Client to adopt not found"
+//	@Failure		409			{object}	ErrorResponse			"External ID taken"
+//	@Failure		500			{object}	ErrorResponse			"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/oauth2/clients/external/{external_id} [put]
+func (h *OIDCHandler) UpsertClient(c *fiber.Ctx) error {
+	var spec RegisterClientRequest
+	if ok, err := parseSpec(c, &spec); !ok {
+		return err
+	}
+	orgID := c.Locals("organization_id").(string)
+	if err := h.normalizeClientSpec(orgID, &spec); err != nil {
+		return respondSpecError(c, err)
+	}
+	return upsertManaged(c, h.queries, &h.logger, h.clientKind(c, &spec), orgID)
+}
+
+// ExportClient returns an OIDC client in its managed form
+//
+//	@Summary		Export OIDC client
+//	@Description	Returns the registration of a client, without its secret, its external ID and the content hash of the registration, which is also its ETag.
+//	@Tags			Federation
+//	@Produce		json
+//	@Param			id			path		string			false	"Client ID"
+//	@Param			external_id	path		string			false	"External ID"
+//	@Success		200			{object}	ManagedResource	"Client exported"
+//	@Success		304			"Unchanged since the ETag in If-None-Match"
+//	@Failure		404			{object}	ErrorResponse	"Client not found"
+//	@Failure		500			{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/oauth2/clients/{id}/export [get]
+//	@Router			/oauth2/clients/external/{external_id}/export [get]
+func (h *OIDCHandler) ExportClient(c *fiber.Ctx) error {
+	return exportManaged(c, h.queries, &h.logger, h.clientKind(c, nil), c.Locals("organization_id").(string))
+}
+
+// organizationKind manages organizations; spec is nil for exports. The
+// organization ID passed to its closures is unused: organizations are
+// looked up by their own ID.
+func (h *OrganizationHandler) organizationKind(spec *OrganizationSpec) managedKind {
+	apply := func(org *models.Organization) {
+		org.Name = spec.Name
+		org.Description = &spec.Description
+		org.Metadata = string(spec.Metadata)
+		org.BillingTier = spec.BillingTier
+		org.MaxUsers = spec.MaxUsers
+		org.MaxResources = spec.MaxResources
+	}
+	return managedKind{
+		kind:  queries.ExternalKindOrganization,
+		label: "Organization",
+		read: func(q *queries.Queries, _, id string) (interface{}, error) {
+			org, err := q.Organization.GetOrganization(id)
+			if err != nil {
+				return nil, err
+			}
+			return OrganizationSpec{
+				Name:         org.Name,
+				Slug:         org.Slug,
+				Description:  stringValue(org.Description),
+				Metadata:     rawObject(org.Metadata),
+				BillingTier:  org.BillingTier,
+				MaxUsers:     org.MaxUsers,
+				MaxResources: org.MaxResources,
+			}, nil
+		},
+		create: func(q *queries.Queries, _ string) (string, interface{}, error) {
+			org := &models.Organization{ID: uuid.New().String(), Slug: spec.Slug, Settings: "{}", Status: "active"}
+			apply(org)
+			return org.ID, nil, q.Organization.CreateOrganization(org)
+		},
+		update: func(q *queries.Queries, _, id string) error {
+			org, err := q.Organization.GetOrganization(id)
+			if err != nil {
+				return err
+			}
+			if org.Slug != spec.Slug {
+				return managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed, "slug cannot be changed")
+			}
+			apply(org)
+			return q.Organization.UpdateOrganization(org)
+		},
+		written: func(id, result string) {
+			if result != managedCreated {
+				return
+			}
+			if err := services.SeedSystemRoles(h.queries.Role, id); err != nil {
+				h.logger.Warn("Failed to seed system roles for organization %s: %v", id, err)
+			}
+		},
+	}
+}
+
+// Organization slugs must match the valid_slug constraint
+var organizationSlugPattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+func (s *OrganizationSpec) normalize() error {
+	s.Name = strings.TrimSpace(s.Name)
+	if len(s.Name) < 2 {
+		return managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed, "name must be at least 2 characters")
+	}
+	if s.Slug == "" {
+		s.Slug = strings.ToLower(strings.ReplaceAll(s.Name, " ", "-"))
+	}
+	if !organizationSlugPattern.MatchString(s.Slug) {
+		return managedFail(fiber.StatusBadRequest, apierror.CodeValidationFailed, "slug may only contain lowercase letters, digits and hyphens")
+	}
+	metadata, err := specObject("metadata", s.Metadata)
+	if err != nil {
+		return err
+	}
+	s.Metadata = json.RawMessage(metadata)
+	if s.BillingTier == "" {
+		s.BillingTier = "free"
+	}
+	if s.MaxUsers == 0 {
+		s.MaxUsers = 100
+	}
+	if s.MaxResources == 0 {
+		s.MaxResources = 1000
+	}
+	return nil
+}
+
+// UpsertOrganization creates or updates the organization with an external
+// ID
+//
+//	@Summary		Upsert organization by external ID
+//	@Description	Root users only. Creates the organization with the external ID, seeding its system roles, or replaces the spec of the organization that has it; the slug cannot be changed. External IDs of organizations are unique across the deployment. An update that changes nothing writes nothing and reports result "unchanged". ?adopt={id} imports an existing organization without an external ID.
+//	@Tags			Organization Management
+//	@Accept			json
+//	@Produce		json
+//	@Param			external_id	path		string				true	"External ID"
+//	@Param			adopt		query		string				false	"ID of an existing organization to import"
+//	@Param			request		body		OrganizationSpec	true	"Organization spec"
+//	@Success		200			{object}	ManagedResource		"Organization updated, imported or unchanged"
+//	@Success		201			{object}	ManagedResource		"Organization created"
+//	@Failure		400			{object}	ErrorResponse		"Invalid spec or external ID"
+//	@Failure		403			{object}	ErrorResponse		"Caller is not a root user"
+//	@Failure		404			{object}	ErrorResponse		"Organization to adopt not found"
+//	@Failure		409			{object}	ErrorResponse		"Slug or external ID taken"
+//	@Failure		500			{object}	ErrorResponse		"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/organizations/external/{external_id} [put]
+func (h *OrganizationHandler) UpsertOrganization(c *fiber.Ctx) error {
+	var spec OrganizationSpec
+	if ok, err := parseSpec(c, &spec); !ok {
+		return err
+	}
+	if err := spec.normalize(); err != nil {
+		return respondSpecError(c, err)
+	}
+	return upsertManaged(c, h.queries, h.logger, h.organizationKind(&spec), "")
+}
+
+// ExportOrganization returns an organization in its managed form
+//
+//	@Summary		Export organization
+//	@Description	Returns the spec of an organization, its external ID and the content hash of the spec, which is also its ETag. Looking organizations up by external ID is limited to root users.
+//	@Tags			Organization Management
+//	@Produce		json
+//	@Param			id			path		string			false	"Organization ID"
+//	@Param			external_id	path		string			false	"External ID"
+//	@Success		200			{object}	ManagedResource	"Organization exported"
+//	@Success		304			"Unchanged since the ETag in If-None-Match"
+//	@Failure		404			{object}	ErrorResponse	"Organization not found"
+//	@Failure		500			{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/organizations/{id}/export [get]
+//	@Router			/organizations/external/{external_id}/export [get]
+func (h *OrganizationHandler) ExportOrganization(c *fiber.Ctx) error {
+	return exportManaged(c, h.queries, h.logger, h.organizationKind(nil), "")
+}
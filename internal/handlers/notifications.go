@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/events"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+// notificationHeartbeat keeps idle streams open through proxies and
+// detects clients that went away
+const notificationHeartbeat = 25 * time.Second
+
+type NotificationHandler struct {
+	notifications services.NotificationService
+	logger        *logger.Logger
+}
+
+func NewNotificationHandler(notifications services.NotificationService, logger *logger.Logger) *NotificationHandler {
+	return &NotificationHandler{notifications: notifications, logger: logger}
+}
+
+// Stream sends the authenticated user's notifications as server-sent events
+//
+//	@Summary	Notification stream
+//	@Description	Open a text/event-stream of the caller's notifications: collaborator.invited, content.published, role.assigned, role.expiring, role_renewal.requested, role_renewal.decided, share.expiring, resource.archived, resource.deleted, resource.recertification_due, session.revoked, access_review.assigned and, for organization admins, security_alert.raised. Each event is named after its type and carries the notification as JSON. Nothing is replayed on reconnect. The stream ends when the access token expires or the session is revoked; clients reconnect with a fresh token.
+//	@Tags		Notifications
+//	@Produce	text/event-stream
+//	@Success	200	{object}	models.Notification	"Event stream"
+//	@Failure	401	{object}	ErrorResponse	"Unauthorized"
+//	@Security	BearerAuth
+//	@Router		/notifications/stream [get]
+func (h *NotificationHandler) Stream(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+	sessionID, _ := c.Locals("session_id").(string)
+	var expiry <-chan time.Time
+	if exp, ok := c.Locals("token_expires_at").(time.Time); ok {
+		expiry = time.After(time.Until(exp))
+	}
+
+	notifications, cancel := h.notifications.Subscribe(userID)
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // no proxy buffering of the events
+
+	// The writer runs after the handler returned, so it must not use c
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+
+		heartbeat := time.NewTicker(notificationHeartbeat)
+		defer heartbeat.Stop()
+
+		fmt.Fprint(w, "retry: 5000\n\n")
+		if w.Flush() != nil {
+			return
+		}
+		for {
+			select {
+			case n, ok := <-notifications:
+				if !ok {
+					return // server shutting down
+				}
+				payload, err := json.Marshal(n)
+				if err != nil {
+					h.logger.Error("encode notification: %v", err)
+					continue
+				}
+				fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", n.ID, n.Type, payload)
+				if w.Flush() != nil {
+					return
+				}
+				if n.Type == events.SessionRevoked && revokesSession(n, sessionID) {
+					return
+				}
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+				if w.Flush() != nil {
+					return
+				}
+			case <-expiry:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// revokesSession reports whether a session.revoked notification covers
+// the session, either by naming it or by revoking all sessions of the user
+func revokesSession(n models.Notification, sessionID string) bool {
+	revoked, _ := n.Data["session_id"].(string)
+	return revoked == "" || revoked == sessionID
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+)
+
+const (
+	// maxStaticClaimBytes caps the JSON size of the value of a static claim
+	maxStaticClaimBytes   = 1024
+	maxClaimAttributePath = 128
+)
+
+var claimNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.:/-]{0,63}$`)
+
+// validateClaimRules checks custom token claims, of an organization's
+// token_claims or a client's token policy
+func validateClaimRules(rules []models.ClaimRule) error {
+	if len(rules) > services.MaxClaimRules {
+		return fmt.Errorf("at most %d claims are supported", services.MaxClaimRules)
+	}
+	seen := map[string]bool{}
+	for _, rule := range rules {
+		if !claimNamePattern.MatchString(rule.Claim) {
+			return fmt.Errorf("claim names must start with a letter and have at most 64 letters, digits or _.:/-: %q", rule.Claim)
+		}
+		if services.IsReservedClaim(rule.Claim) {
+			return fmt.Errorf("claim %s is set by the server", rule.Claim)
+		}
+		if seen[rule.Claim] {
+			return fmt.Errorf("claim %s is mapped twice", rule.Claim)
+		}
+		seen[rule.Claim] = true
+
+		switch rule.Source {
+		case models.ClaimSourceStatic:
+			if rule.Value == nil {
+				return fmt.Errorf("static claim %s needs a value", rule.Claim)
+			}
+			if encoded, _ := json.Marshal(rule.Value); len(encoded) > maxStaticClaimBytes {
+				return fmt.Errorf("the value of claim %s exceeds %d bytes", rule.Claim, maxStaticClaimBytes)
+			}
+		case models.ClaimSourceAttribute:
+			if rule.Attribute == "" || len(rule.Attribute) > maxClaimAttributePath ||
+				strings.HasPrefix(rule.Attribute, ".") || strings.HasSuffix(rule.Attribute, ".") || strings.Contains(rule.Attribute, "..") {
+				return fmt.Errorf("claim %s needs an attribute path such as hr.employee_id", rule.Claim)
+			}
+		case models.ClaimSourceGroups, models.ClaimSourceRoles:
+		default:
+			return fmt.Errorf("claim %s: source must be static, attribute, groups or roles", rule.Claim)
+		}
+		if rule.Source != models.ClaimSourceStatic && rule.Value != nil {
+			return fmt.Errorf("claim %s: only static claims take a value", rule.Claim)
+		}
+		if rule.Source != models.ClaimSourceAttribute && rule.Attribute != "" {
+			return fmt.Errorf("claim %s: only attribute claims take an attribute", rule.Claim)
+		}
+
+		for _, token := range rule.Tokens {
+			if token != services.ClaimTokenAccess && token != services.ClaimTokenID {
+				return fmt.Errorf("claim %s: tokens must be access_token or id_token", rule.Claim)
+			}
+		}
+	}
+	return nil
+}
+
+// settingsClaimRules returns the token_claims of organization settings
+func settingsClaimRules(settings string) []models.ClaimRule {
+	var s struct {
+		TokenClaims *models.TokenClaims `json:"token_claims"`
+	}
+	if json.Unmarshal([]byte(settings), &s) != nil || s.TokenClaims == nil {
+		return nil
+	}
+	return s.TokenClaims.Claims
+}
+
+// clientClaimRules returns the claims of a client's token policy
+func clientClaimRules(client *models.OAuthClient) []models.ClaimRule {
+	if client == nil || client.TokenPolicy == nil {
+		return nil
+	}
+	return client.TokenPolicy.Claims
+}
+
+// auditClaimRules records a change of the custom token claims of an
+// organization or, with a client ID as entityID, of one client, so that
+// claim mapping changes can be followed apart from other settings
+func auditClaimRules(c *fiber.Ctx, audit services.AuditService, orgID, entityID string, before, after []models.ClaimRule) {
+	if len(before) == 0 && len(after) == 0 {
+		return
+	}
+	old, _ := json.Marshal(before)
+	updated, _ := json.Marshal(after)
+	if string(old) == string(updated) {
+		return
+	}
+	auditChange(c, audit, orgID, "update_token_claims", "token_claims", entityID,
+		fiber.Map{"claims": before}, fiber.Map{"claims": after})
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+)
+
+// DeviceDecisionRequest is the body of POST /oauth2/device
+type DeviceDecisionRequest struct {
+	UserCode string `json:"user_code"`
+	Decision string `json:"decision"` // "allow" or "deny"
+}
+
+// DeviceAuthorization starts the device authorization grant
+//
+//	@Summary		OAuth2 Device Authorization
+//	@Description	Starts a device authorization (RFC 8628) for clients that cannot open a browser, such as CLIs and TVs. Returns a device_code for the client and a user_code the user enters on the verification page; the client then polls /oauth2/token with grant_type urn:ietf:params:oauth:grant-type:device_code at the given interval. The client must be registered for that grant type; confidential clients authenticate as on the token endpoint.
+//	@Tags			Federation
+//	@Accept			x-www-form-urlencoded
+//	@Produce		json
+//	@Param			client_id		formData	string	true	"Client ID"
+//	@Param			client_secret	formData	string	false	"Client secret of confidential clients, unless sent with Basic auth"
+//	@Param			scope			formData	string	false	"Scopes"
+//	@Success		200				{object}	services.DeviceAuthorizationResponse
+//	@Failure		400				{object}	map[string]string	"OAuth error"
+//	@Failure		401				{object}	map[string]string	"invalid_client"
+//	@Router			/oauth2/device_authorization [post]
+func (h *OIDCHandler) DeviceAuthorization(c *fiber.Ctx) error {
+	clientID, clientSecret := clientCredentials(c)
+	resp, err := h.oidc.StartDeviceAuthorization(clientID, clientSecret, c.FormValue("scope"))
+	if err != nil {
+		h.logger.Warn("Device authorization by client %s failed: %v", clientID, err)
+		status := fiber.StatusBadRequest
+		if err.Error() == "invalid_client" {
+			status = fiber.StatusUnauthorized
+		}
+		code := err.Error()
+		if !strings.HasPrefix(code, "invalid_") && code != "unauthorized_client" {
+			code, status = "server_error", fiber.StatusInternalServerError
+		}
+		return c.Status(status).JSON(fiber.Map{"error": code})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(resp)
+}
+
+// deviceCode serves the device_code grant polled by device clients
+func (h *OIDCHandler) deviceCode(c *fiber.Ctx, clientID, clientSecret string) error {
+	resp, err := h.oidc.ExchangeDeviceCode(c.FormValue("device_code"), clientID, clientSecret)
+	if err != nil {
+		code := err.Error()
+		status := fiber.StatusBadRequest
+		switch code {
+		case "authorization_pending", "slow_down":
+			// Polling before the user decides is expected
+			return c.Status(status).JSON(fiber.Map{"error": code})
+		case "invalid_client":
+			status = fiber.StatusUnauthorized
+		case "unauthorized_client", "access_denied", "expired_token":
+		default:
+			if !strings.HasPrefix(code, "invalid_") {
+				code, status = "server_error", fiber.StatusInternalServerError
+			}
+		}
+		h.logger.Warn("Device code grant for client %s failed: %v", clientID, err)
+		return c.Status(status).JSON(fiber.Map{"error": code})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(resp)
+}
+
+// GetDeviceAuthorization returns the device authorization a user code
+// belongs to, for the verification page
+//
+//	@Summary		Get device authorization
+//	@Description	Returns the client and scopes of the pending device authorization of a user code, so the verification page can ask the signed-in user to confirm. The code is accepted in any case, with or without its dash.
+//	@Tags			Federation
+//	@Produce		json
+//	@Param			user_code	query		string			true	"User code shown on the device"
+//	@Success		200			{object}	SuccessResponse	"Device authorization"
+//	@Failure		400			{object}	ErrorResponse	"user_code is required"
+//	@Failure		401			{object}	ErrorResponse	"Login required"
+//	@Failure		404			{object}	ErrorResponse	"Unknown or expired user code"
+//	@Failure		500			{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/oauth2/device [get]
+func (h *OIDCHandler) GetDeviceAuthorization(c *fiber.Ctx) error {
+	userCode := c.Query("user_code")
+	if userCode == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "user_code is required")
+	}
+	auth, err := h.oidc.LookupDeviceAuthorization(userCode)
+	if err != nil {
+		h.logger.Error("Failed to look up device authorization: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to look up device authorization")
+	}
+	if auth == nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Unknown or expired user code")
+	}
+	client, err := h.queries.OIDC.GetClientByID(auth.ClientID)
+	if err != nil {
+		h.logger.Error("Failed to get OIDC client: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to look up device authorization")
+	}
+	if client == nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Unknown or expired user code")
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Device authorization retrieved successfully", fiber.Map{
+		"user_code":   auth.UserCode,
+		"client_id":   client.ID,
+		"client_name": client.ClientName,
+		"logo_url":    client.LogoURL,
+		"scope":       auth.Scope,
+		"expires_at":  auth.ExpiresAt,
+		"branding":    brandingReference(h.queries.Organization, client.OrganizationID, h.config.PublicURL),
+	})
+}
+
+// DecideDeviceAuthorization records the user's decision on a device
+// authorization
+//
+//	@Summary		Approve or deny a device authorization
+//	@Description	Approves or denies the pending device authorization of a user code for the signed-in user. An approval is remembered as consent, like one given on the consent screen; the device collects its tokens on its next poll.
+//	@Tags			Federation
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		DeviceDecisionRequest	true	"User code and decision"
+//	@Success		200		{object}	SuccessResponse			"Decision recorded"
+//	@Failure		400		{object}	ErrorResponse			"Invalid request"
+//	@Failure		401		{object}	ErrorResponse			"Login required"
+//	@Failure		404		{object}	ErrorResponse			"Unknown or expired user code"
+//	@Failure		500		{object}	ErrorResponse			"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/oauth2/device [post]
+func (h *OIDCHandler) DecideDeviceAuthorization(c *fiber.Ctx) error {
+	var req DeviceDecisionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
+	}
+	if req.UserCode == "" || (req.Decision != "allow" && req.Decision != "deny") {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "user_code and a decision of allow or deny are required")
+	}
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Login required")
+	}
+	orgID, _ := c.Locals("organization_id").(string)
+
+	if err := h.oidc.DecideDeviceAuthorization(req.UserCode, userID, orgID, req.Decision == "allow"); err != nil {
+		if err.Error() == "invalid_grant" {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Unknown or expired user code")
+		}
+		h.logger.Error("Failed to record device authorization decision: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to record decision")
+	}
+
+	h.logger.Info("User %s chose %s for device user code %s", userID, req.Decision, req.UserCode)
+	return apiSuccess(c, fiber.StatusOK, "Decision recorded", fiber.Map{"decision": req.Decision})
+}
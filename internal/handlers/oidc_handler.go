@@ -3,6 +3,7 @@ package handlers
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"strings"
@@ -10,11 +11,13 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
 	"github.com/the-monkeys/monkeys-identity/internal/config"
 	"github.com/the-monkeys/monkeys-identity/internal/models"
 	"github.com/the-monkeys/monkeys-identity/internal/queries"
 	"github.com/the-monkeys/monkeys-identity/internal/services"
 	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -23,6 +26,7 @@ type OIDCHandler struct {
 	queries *queries.Queries
 	logger  logger.Logger
 	config  *config.Config
+	audit   services.AuditService
 }
 
 func NewOIDCHandler(oidc services.OIDCService, q *queries.Queries, logger logger.Logger, cfg *config.Config) *OIDCHandler {
@@ -34,6 +38,12 @@ func NewOIDCHandler(oidc services.OIDCService, q *queries.Queries, logger logger
 	}
 }
 
+// SetAudit injects the audit log client changes, and registrations with
+// wildcards, are recorded in. Called from route setup.
+func (h *OIDCHandler) SetAudit(audit services.AuditService) {
+	h.audit = audit
+}
+
 // GetDiscovery returns the OIDC discovery configuration
 //
 //	@Summary		OIDC Discovery
@@ -41,9 +51,10 @@ func NewOIDCHandler(oidc services.OIDCService, q *queries.Queries, logger logger
 //	@Tags			Federation
 //	@Produce		json
 //	@Success		200	{object}	map[string]interface{}
+//	@Success		304	"Not modified"
 //	@Router			/.well-known/openid-configuration [get]
 func (h *OIDCHandler) GetDiscovery(c *fiber.Ctx) error {
-	return c.JSON(h.oidc.GetDiscoveryConfiguration())
+	return conditionalJSON(c, h.oidc.GetDiscoveryConfiguration(), cacheDiscovery)
 }
 
 // GetJWKS returns the JSON Web Key Set
@@ -53,82 +64,183 @@ func (h *OIDCHandler) GetDiscovery(c *fiber.Ctx) error {
 //	@Tags			Federation
 //	@Produce		json
 //	@Success		200	{object}	map[string]interface{}
+//	@Success		304	"Not modified"
 //	@Router			/.well-known/jwks.json [get]
 func (h *OIDCHandler) GetJWKS(c *fiber.Ctx) error {
 	jwks, err := h.oidc.GetJWKS()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal_error"})
 	}
-	return c.JSON(jwks)
+	// Short-lived, so verifiers see new keys soon after rotation
+	return conditionalJSON(c, jwks, cacheJWKS)
 }
 
 // Authorize handles the OIDC authorization request
 //
 //	@Summary		OAuth2 Authorize
-//	@Description	Handles initial authorization request (login/consent)
 //	@Tags			Federation
+//	@Description	Handles initial authorization request (login/consent). A request pushed to /oauth2/par is passed as request_uri along with client_id, in place of the other parameters. When the user has to consent, the request is kept on the server and the consent page is only given its request_uri; it is answered once, when the code is issued or the user denies it.
 //	@Param			client_id		query	string	true	"Client ID"
-//	@Param			redirect_uri	query	string	true	"Redirect URI"
-//	@Param			response_type	query	string	true	"Response Type (code)"
-//	@Param			scope			query	string	true	"Scopes"
+//	@Param			request_uri		query	string	false	"request_uri returned by /oauth2/par"
+//	@Param			redirect_uri	query	string	false	"Redirect URI"
+//	@Param			response_type	query	string	false	"Response Type (code)"
+//	@Param			scope			query	string	false	"Scopes"
 //	@Param			state			query	string	false	"State"
 //	@Param			nonce			query	string	false	"Nonce"
+//	@Param			code_challenge			query	string	false	"PKCE code challenge (RFC 7636); required of public clients"
+//	@Param			code_challenge_method	query	string	false	"PKCE code challenge method; only S256"
 //	@Router			/oauth2/authorize [get]
 func (h *OIDCHandler) Authorize(c *fiber.Ctx) error {
 	clientID := c.Query("client_id")
-	redirectURI := c.Query("redirect_uri")
-	scope := c.Query("scope")
-	state := c.Query("state")
-	nonce := c.Query("nonce")
+
+	// Take the parameters of a pushed request from its request_uri; it stays
+	// usable until the request is answered, so the user can sign in and
+	// consent first
+	requestURI := c.Query("request_uri")
+	req := &models.PushedAuthorizationRequest{
+		ClientID:     clientID,
+		RedirectURI:  c.Query("redirect_uri"),
+		ResponseType: c.Query("response_type"),
+		Scope:        c.Query("scope"),
+		State:        c.Query("state"),
+		Nonce:        c.Query("nonce"),
+
+		CodeChallenge:       c.Query("code_challenge"),
+		CodeChallengeMethod: c.Query("code_challenge_method"),
+	}
+	if requestURI != "" {
+		pushed, err := h.oidc.ResolvePushedRequest(clientID, requestURI)
+		if err != nil {
+			return h.authorizeError(c, err)
+		}
+		req = pushed
+	}
 
 	// Validate client and redirect URI
-	client, err := h.oidc.ValidateClient(clientID, "", redirectURI)
+	client, err := h.oidc.ValidateClient(req.ClientID, "", req.RedirectURI)
 	if err != nil {
 		h.logger.Warn("OIDC Authorize validation failed: %v", err)
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
+	req.Scope, err = h.oidc.ResolveScope(client, req.Scope)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := h.oidc.CheckCodeChallenge(client, req.CodeChallenge, req.CodeChallengeMethod); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 
-	// Check if user is authenticated (set by auth middleware)
 	// Check if user is authenticated (set by auth middleware)
 	userID := c.Locals("user_id")
 	if userID == nil {
-		// Redirect to frontend login with return_to
-		returnTo := fmt.Sprintf("%s%s", h.config.OIDCIssuer, c.OriginalURL())
+		// Redirect to frontend login with return_to, the URL of this
+		// request as the browser reaches it through any gateway
+		returnTo := h.config.PublicURL + c.Path()
+		if query := string(c.Request().URI().QueryString()); query != "" {
+			returnTo += "?" + query
+		}
 		loginURL := fmt.Sprintf("%s/login?return_to=%s", h.config.FrontendURL, url.QueryEscape(returnTo))
 		return c.Redirect(loginURL)
 	}
 
-	// If trusted client, skip consent and issue code directly
-	if client.IsTrusted {
-		orgID, _ := c.Locals("organization_id").(string)
-		code, err := h.oidc.CreateAuthorizationCode(userID.(string), orgID, clientID, scope, nonce, redirectURI)
+	// Skip consent for trusted clients the organization allows and for
+	// scopes the user already granted
+	orgID, _ := c.Locals("organization_id").(string)
+	granted, err := h.oidc.ConsentCovers(userID.(string), req.ClientID, req.Scope)
+	if err != nil {
+		h.logger.Error("Failed to check OAuth consent: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
+	}
+	if granted || h.skipsConsent(client) {
+		// Trusted clients get a consent record too, so offline access can be revoked
+		if !granted {
+			if err := h.oidc.GrantConsent(userID.(string), orgID, req.ClientID, req.Scope); err != nil {
+				h.logger.Error("Failed to record OAuth consent: %v", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
+			}
+		}
+		if requestURI != "" {
+			if err := h.oidc.ConsumePushedRequest(requestURI); err != nil {
+				return h.authorizeError(c, err)
+			}
+		}
+
+		code, err := h.oidc.CreateAuthorizationCode(userID.(string), orgID, req)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
 		}
 
 		// Redirect back to client with code and state
-		return c.Redirect(fmt.Sprintf("%s?code=%s&state=%s", redirectURI, code, state))
+		return c.Redirect(authorizationResponse(req.RedirectURI, "code", code, "state", req.State))
+	}
+
+	// The consent page only gets the request_uri: the parameters of the
+	// request stay on the server until the user decides
+	if requestURI == "" {
+		if requestURI, err = h.oidc.StoreAuthorizationRequest(req); err != nil {
+			h.logger.Error("Failed to store authorization request: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
+		}
 	}
+	return c.Redirect(h.config.FrontendURL + "/consent?request_uri=" + url.QueryEscape(requestURI))
+}
 
-	// Redirect to consent page
-	consentURL := fmt.Sprintf("%s/consent?client_id=%s&scope=%s&state=%s&redirect_uri=%s",
-		h.config.FrontendURL, clientID, scope, state, redirectURI)
-	return c.Redirect(consentURL)
+// authorizeError answers an authorization request whose request_uri
+// failed to resolve or was already answered
+func (h *OIDCHandler) authorizeError(c *fiber.Ctx, err error) error {
+	h.logger.Warn("OIDC Authorize with request_uri failed: %v", err)
+	if !strings.HasPrefix(err.Error(), "invalid_") {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+}
+
+// authorizationResponse adds the parameters of an authorization response,
+// given as name and value pairs, to the query of the client's redirect URI
+func authorizationResponse(redirectURI string, params ...string) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		// Registered redirect URIs parse; this one was matched against them
+		return redirectURI
+	}
+	query := u.Query()
+	for i := 0; i+1 < len(params); i += 2 {
+		if params[i+1] != "" {
+			query.Set(params[i], params[i+1])
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
 }
 
 // GetPublicClientInfo returns public information about an OIDC client
 //
 //	@Summary		Get Public Client Info
-//	@Description	Returns public details (name, logo) for a client ID
+//	@Description	Returns public details (name, logo) for a client ID, and the branding of its organization for the consent page. The consent page passes the request_uri it was given instead, and also receives the scope requested.
 //	@Tags			Federation
-//	@Param			client_id	query	string	true	"Client ID"
+//	@Param			client_id	query	string	false	"Client ID"
+//	@Param			request_uri	query	string	false	"request_uri of an authorization request awaiting consent, in place of client_id"
 //	@Produce		json
 //	@Success		200	{object}	map[string]interface{}
+//	@Success		304	"Not modified"
+//	@Failure		400	{object}	ErrorResponse	"Neither client_id nor a valid request_uri"
 //	@Router			/oauth2/client-info [get]
 func (h *OIDCHandler) GetPublicClientInfo(c *fiber.Ctx) error {
 	clientID := c.Query("client_id")
+	var pending *models.PushedAuthorizationRequest
+	if requestURI := c.Query("request_uri"); requestURI != "" {
+		var err error
+		if pending, err = h.oidc.LookupAuthorizationRequest(requestURI); err != nil {
+			if !strings.HasPrefix(err.Error(), "invalid_") {
+				h.logger.Error("Failed to look up authorization request: %v", err)
+				return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch client info")
+			}
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "The authorization request expired or was already answered")
+		}
+		clientID = pending.ClientID
+	}
 	if clientID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "client_id_required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "client_id is required")
 	}
 
 	client, err := h.oidc.ValidateClient(clientID, "", "")
@@ -146,91 +258,114 @@ func (h *OIDCHandler) GetPublicClientInfo(c *fiber.Ctx) error {
 	client, err = h.queries.OIDC.GetClientByID(clientID)
 	if err != nil {
 		h.logger.Error("Failed to fetch client info: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch client info")
 	}
 	if client == nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "client_not_found"})
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Client not found")
 	}
 
-	return c.JSON(fiber.Map{
+	info := fiber.Map{
 		"client_id":   client.ID,
 		"client_name": client.ClientName,
 		"logo_url":    client.LogoURL,
 		"policy_uri":  client.PolicyURI,
 		"tos_uri":     client.TosURI,
-	})
+		// The consent page shows the client under its organization's branding
+		"branding": brandingReference(h.queries.Organization, client.OrganizationID, h.config.PublicURL),
+	}
+	if pending != nil {
+		info["scope"] = pending.Scope
+		c.Set(fiber.HeaderCacheControl, "no-store")
+		return c.JSON(info)
+	}
+	return conditionalJSON(c, info, cacheClientInfo)
 }
 
 type ConsentRequest struct {
-	ClientID    string `json:"client_id"`
-	RedirectURI string `json:"redirect_uri"`
-	Scope       string `json:"scope"`
-	State       string `json:"state"`
-	Nonce       string `json:"nonce"`
-	Decision    string `json:"decision"` // "allow" or "deny"
+	// RequestURI is the request_uri the authorize endpoint gave the
+	// consent page
+	RequestURI string `json:"request_uri"`
+	Decision   string `json:"decision"` // "allow" or "deny"
 }
 
 // HandleConsent processes the user's consent decision
 //
 //	@Summary		Handle Consent
-//	@Description	Processes user consent and returns redirect URL
+//	@Description	Answers the authorization request the consent page was sent with, by its request_uri, and returns the URL to send the user back to the client with. An allowed grant is remembered, and later requests for the same scopes skip the consent screen. Each request is answered once.
 //	@Tags			Federation
 //	@Accept			json
 //	@Produce		json
-//	@Success		200	{object}	map[string]string
+//	@Param			request	body		ConsentRequest	true	"request_uri and decision"
+//	@Success		200		{object}	map[string]string
+//	@Failure		400		{object}	ErrorResponse	"The request expired or was already answered"
 //	@Router			/oauth2/consent [post]
 func (h *OIDCHandler) HandleConsent(c *fiber.Ctx) error {
-	var req ConsentRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_request"})
+	var body ConsentRequest
+	if err := c.BodyParser(&body); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
 	}
 
 	// Check Auth
 	userIDRaw := c.Locals("user_id")
 	if userIDRaw == nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "login_required"})
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Login required")
 	}
 	userID := userIDRaw.(string)
 
-	if req.Decision != "allow" {
-		// User denied access
-		redirectURL := fmt.Sprintf("%s?error=access_denied&state=%s", req.RedirectURI, req.State)
-		return c.JSON(fiber.Map{"redirect_to": redirectURL})
+	req, err := h.oidc.LookupAuthorizationRequest(body.RequestURI)
+	if err != nil {
+		return h.consentError(c, err)
 	}
-
 	// Validate Client/RedirectURI again to be safe
-	_, err := h.oidc.ValidateClient(req.ClientID, "", req.RedirectURI)
+	client, err := h.oidc.ValidateClient(req.ClientID, "", req.RedirectURI)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+	}
+	if req.Scope, err = h.oidc.ResolveScope(client, req.Scope); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
 	}
 
-	// Create Code
+	if body.Decision != "allow" {
+		// User denied access
+		if err := h.oidc.ConsumePushedRequest(body.RequestURI); err != nil {
+			return h.consentError(c, err)
+		}
+		return c.JSON(fiber.Map{"redirect_to": authorizationResponse(req.RedirectURI, "error", "access_denied", "state", req.State)})
+	}
+
+	// Remember the grant so the user is not asked again for these scopes
 	orgID, _ := c.Locals("organization_id").(string)
-	code, err := h.oidc.CreateAuthorizationCode(userID, orgID, req.ClientID, req.Scope, req.Nonce, req.RedirectURI)
+	if err := h.oidc.GrantConsent(userID, orgID, req.ClientID, req.Scope); err != nil {
+		h.logger.Error("Failed to record OAuth consent: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to record consent")
+	}
+	if err := h.oidc.ConsumePushedRequest(body.RequestURI); err != nil {
+		return h.consentError(c, err)
+	}
+
+	// Create Code
+	code, err := h.oidc.CreateAuthorizationCode(userID, orgID, req)
 	if err != nil {
 		h.logger.Error("Failed to create auth code: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create authorization code")
 	}
-
-	redirectURL := fmt.Sprintf("%s?code=%s&state=%s", req.RedirectURI, code, req.State)
-	return c.JSON(fiber.Map{"redirect_to": redirectURL})
+	return c.JSON(fiber.Map{"redirect_to": authorizationResponse(req.RedirectURI, "code", code, "state", req.State)})
 }
 
-// Token handles the OAuth2 token exchange
-//
-//	@Summary		OAuth2 Token
-//	@Description	Exchanges authorization code for access/id tokens
-//	@Tags			Federation
-//	@Accept			x-www-form-urlencoded
-//	@Produce		json
-//	@Router			/oauth2/token [post]
-func (h *OIDCHandler) Token(c *fiber.Ctx) error {
-	grantType := c.FormValue("grant_type")
-	code := c.FormValue("code")
-	clientID := c.FormValue("client_id")
-	clientSecret := c.FormValue("client_secret")
+// consentError answers a consent decision whose authorization request
+// could not be looked up or was already answered
+func (h *OIDCHandler) consentError(c *fiber.Ctx, err error) error {
+	if !strings.HasPrefix(err.Error(), "invalid_") {
+		h.logger.Error("Failed to answer authorization request: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to process consent")
+	}
+	return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "The authorization request expired or was already answered")
+}
 
-	// Support Basic Auth for client credentials (RFC 6749 Section 2.3.1)
+// clientCredentials returns the client of a token request, from the form
+// or Basic auth (RFC 6749 Section 2.3.1)
+func clientCredentials(c *fiber.Ctx) (clientID, clientSecret string) {
+	clientID, clientSecret = c.FormValue("client_id"), c.FormValue("client_secret")
 	if clientID == "" {
 		authHeader := c.Get("Authorization")
 		if strings.HasPrefix(authHeader, "Basic ") {
@@ -244,12 +379,106 @@ func (h *OIDCHandler) Token(c *fiber.Ctx) error {
 			}
 		}
 	}
+	return clientID, clientSecret
+}
+
+// PushAuthorizationRequest accepts the parameters of an authorization
+// request ahead of the redirect (RFC 9126)
+//
+//	@Summary		OAuth2 Pushed Authorization Request
+//	@Description	Stores the parameters of an authorization request and returns a request_uri to pass to /oauth2/authorize with client_id, valid for five minutes and used once. Confidential clients authenticate as on the token endpoint. The parameters are checked as on /oauth2/authorize; only response_type code is supported, and public clients must send an S256 code_challenge.
+//	@Tags			Federation
+//	@Accept			x-www-form-urlencoded
+//	@Produce		json
+//	@Param			client_id		formData	string	true	"Client ID"
+//	@Param			client_secret	formData	string	false	"Client secret, unless sent with Basic auth"
+//	@Param			redirect_uri	formData	string	true	"Redirect URI"
+//	@Param			response_type	formData	string	true	"Response Type (code)"
+//	@Param			scope			formData	string	false	"Scopes"
+//	@Param			state			formData	string	false	"State"
+//	@Param			nonce			formData	string	false	"Nonce"
+//	@Param			code_challenge			formData	string	false	"PKCE code challenge (RFC 7636); required of public clients"
+//	@Param			code_challenge_method	formData	string	false	"PKCE code challenge method; only S256"
+//	@Success		201				{object}	map[string]interface{}	"request_uri and expires_in"
+//	@Failure		400				{object}	map[string]string		"OAuth error"
+//	@Failure		401				{object}	map[string]string		"invalid_client"
+//	@Router			/oauth2/par [post]
+func (h *OIDCHandler) PushAuthorizationRequest(c *fiber.Ctx) error {
+	clientID, clientSecret := clientCredentials(c)
+	if c.FormValue("request_uri") != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_request"})
+	}
+	requestURI, err := h.oidc.PushAuthorizationRequest(clientSecret, &models.PushedAuthorizationRequest{
+		ClientID:     clientID,
+		RedirectURI:  c.FormValue("redirect_uri"),
+		ResponseType: c.FormValue("response_type"),
+		Scope:        c.FormValue("scope"),
+		State:        c.FormValue("state"),
+		Nonce:        c.FormValue("nonce"),
+
+		CodeChallenge:       c.FormValue("code_challenge"),
+		CodeChallengeMethod: c.FormValue("code_challenge_method"),
+	})
+	if err != nil {
+		h.logger.Warn("Pushed authorization request by client %s failed: %v", clientID, err)
+		status := fiber.StatusBadRequest
+		if err.Error() == "invalid_client" {
+			status = fiber.StatusUnauthorized
+		}
+		code := err.Error()
+		if !strings.HasPrefix(code, "invalid_") && code != "unsupported_response_type" {
+			code, status = "server_error", fiber.StatusInternalServerError
+		}
+		return c.Status(status).JSON(fiber.Map{"error": code})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"request_uri": requestURI,
+		"expires_in":  int(services.PushedRequestLifetime.Seconds()),
+	})
+}
+
+// TokenClientID returns the client of a token request, for ClientCORS
+func TokenClientID(c *fiber.Ctx) string {
+	clientID, _ := clientCredentials(c)
+	return clientID
+}
+
+// BearerClientID returns the client an access token was issued to, for
+// ClientCORS after RequireAuth
+func BearerClientID(c *fiber.Ctx) string {
+	clientID, _ := c.Locals("client_id").(string)
+	return clientID
+}
+
+// Token handles the OAuth2 token exchange
+//
+//	@Summary		OAuth2 Token
+//	@Description	Exchanges an authorization code for access/id tokens (plus a refresh token when offline_access was granted); a code issued for a PKCE code_challenge needs its code_verifier, and public clients always use PKCE. Also exchanges a refresh token for a new access token, a device code for the tokens of the user who approved it (grant_type urn:ietf:params:oauth:grant-type:device_code, RFC 8628; answers authorization_pending or slow_down until then), or (grant_type urn:ietf:params:oauth:grant-type:token-exchange, RFC 8693) a user's access token for a narrowed token scoped to another service of the organization. Token exchange requires a confidential client registered for that grant type.
+//	@Tags			Federation
+//	@Accept			x-www-form-urlencoded
+//	@Produce		json
+//	@Router			/oauth2/token [post]
+func (h *OIDCHandler) Token(c *fiber.Ctx) error {
+	grantType := c.FormValue("grant_type")
+	code := c.FormValue("code")
+	clientID, clientSecret := clientCredentials(c)
 
+	if grantType == services.GrantTypeTokenExchange {
+		return h.tokenExchange(c, clientID, clientSecret)
+	}
+	if grantType == services.GrantTypeRefreshToken {
+		return h.refreshToken(c, clientID, clientSecret)
+	}
+	if grantType == services.GrantTypeDeviceCode {
+		return h.deviceCode(c, clientID, clientSecret)
+	}
 	if grantType != "authorization_code" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unsupported_grant_type"})
 	}
 
-	resp, err := h.oidc.ExchangeCodeForToken(code, clientID, clientSecret)
+	resp, err := h.oidc.ExchangeCodeForToken(code, clientID, clientSecret, c.FormValue("code_verifier"))
 	if err != nil {
 		h.logger.Warn("OIDC Token exchange failed: %v", err)
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
@@ -258,6 +487,57 @@ func (h *OIDCHandler) Token(c *fiber.Ctx) error {
 	return c.JSON(resp)
 }
 
+// tokenExchange serves the RFC 8693 token exchange grant
+func (h *OIDCHandler) tokenExchange(c *fiber.Ctx, clientID, clientSecret string) error {
+	resp, err := h.oidc.ExchangeToken(services.TokenExchangeRequest{
+		ClientID:           clientID,
+		ClientSecret:       clientSecret,
+		SubjectToken:       c.FormValue("subject_token"),
+		SubjectTokenType:   c.FormValue("subject_token_type"),
+		ActorToken:         c.FormValue("actor_token"),
+		RequestedTokenType: c.FormValue("requested_token_type"),
+		Audience:           c.FormValue("audience"),
+		Scope:              c.FormValue("scope"),
+	})
+	if err != nil {
+		h.logger.Warn("Token exchange by client %s failed: %v", clientID, err)
+		status := fiber.StatusBadRequest
+		if err.Error() == "invalid_client" {
+			status = fiber.StatusUnauthorized
+		}
+		code := err.Error()
+		if !strings.HasPrefix(code, "invalid_") && code != "unauthorized_client" {
+			code, status = "server_error", fiber.StatusInternalServerError
+		}
+		return c.Status(status).JSON(fiber.Map{"error": code})
+	}
+
+	h.logger.Info("Client %s exchanged a token for audience %s", clientID, c.FormValue("audience"))
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(resp)
+}
+
+// refreshToken serves the refresh_token grant. Refresh tokens stop working
+// once the user revokes the client's consent.
+func (h *OIDCHandler) refreshToken(c *fiber.Ctx, clientID, clientSecret string) error {
+	resp, err := h.oidc.RefreshAccessToken(c.FormValue("refresh_token"), clientID, clientSecret)
+	if err != nil {
+		h.logger.Warn("Refresh token grant for client %s failed: %v", clientID, err)
+		status := fiber.StatusBadRequest
+		if err.Error() == "invalid_client" {
+			status = fiber.StatusUnauthorized
+		}
+		code := err.Error()
+		if !strings.HasPrefix(code, "invalid_") && code != "unauthorized_client" {
+			code, status = "server_error", fiber.StatusInternalServerError
+		}
+		return c.Status(status).JSON(fiber.Map{"error": code})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(resp)
+}
+
 // UserInfo returns the standard OIDC user profile
 //
 //	@Summary		OIDC UserInfo
@@ -297,6 +577,9 @@ func (h *OIDCHandler) UserInfo(c *fiber.Ctx) error {
 	return c.JSON(profile)
 }
 
+// defaultClientScope is the scope of clients registered without one
+const defaultClientScope = "openid profile email"
+
 // RegisterClientRequest is the request body for registering a new OAuth2 client
 type RegisterClientRequest struct {
 	ClientName   string   `json:"client_name"`
@@ -304,6 +587,90 @@ type RegisterClientRequest struct {
 	Scope        string   `json:"scope"`
 	IsPublic     bool     `json:"is_public"`
 	LogoURL      *string  `json:"logo_url,omitempty"`
+	// Audiences are identifiers of the organization's APIs (see
+	// /oauth2/audiences) added to the aud claim of the client's access tokens
+	Audiences []string `json:"audiences,omitempty"`
+	// GrantTypes defaults to authorization_code and refresh_token. Add
+	// urn:ietf:params:oauth:grant-type:token-exchange to let a confidential
+	// client exchange user tokens for other services, and
+	// urn:ietf:params:oauth:grant-type:device_code to let a client without a
+	// browser, such as a CLI, sign users in with a user code.
+	GrantTypes []string `json:"grant_types,omitempty"`
+	// AllowedOrigins are the browser origins that may call the token and
+	// userinfo endpoints for the client, e.g. https://app.example.com
+	AllowedOrigins []string `json:"allowed_origins,omitempty"`
+	// AllowWildcards opts in to a wildcard host label (https://*.example.com)
+	// in redirect_uris and allowed_origins. It matches one DNS label only.
+	AllowWildcards bool `json:"allow_wildcards,omitempty"`
+	// TokenPolicy overrides the lifetimes and scopes of the client's tokens,
+	// within the organization's settings.client_token_limits
+	TokenPolicy *models.ClientTokenPolicy `json:"token_policy,omitempty"`
+}
+
+var supportedGrantTypes = map[string]bool{
+	"authorization_code":            true,
+	"refresh_token":                 true,
+	services.GrantTypeTokenExchange: true,
+	services.GrantTypeDeviceCode:    true,
+}
+
+// validateGrantTypes checks the grant types of a client registration
+func validateGrantTypes(req *RegisterClientRequest) string {
+	for _, gt := range req.GrantTypes {
+		if !supportedGrantTypes[gt] {
+			return "unsupported grant type: " + gt
+		}
+		if gt == services.GrantTypeTokenExchange && req.IsPublic {
+			return "public clients cannot use token exchange"
+		}
+	}
+	return ""
+}
+
+// validateClientURIs checks the origins of a client registration and the
+// wildcards in its redirect URIs, and reports whether any wildcard is used
+func validateClientURIs(req *RegisterClientRequest) (bool, string) {
+	wildcards := false
+	for _, uri := range req.RedirectURIs {
+		if !utils.IsURLPattern(uri) {
+			continue
+		}
+		wildcards = true
+		if err := utils.ValidateRedirectPattern(uri); err != nil {
+			return wildcards, err.Error()
+		}
+	}
+	for _, origin := range req.AllowedOrigins {
+		if err := utils.ValidateOriginPattern(origin); err != nil {
+			return wildcards, err.Error()
+		}
+		wildcards = wildcards || utils.IsURLPattern(origin)
+	}
+	if wildcards && !req.AllowWildcards {
+		return wildcards, "wildcards in redirect_uris or allowed_origins require allow_wildcards"
+	}
+	return wildcards, ""
+}
+
+// logWildcardClient records a client registration that uses wildcards,
+// which widen where codes and tokens can be sent
+func (h *OIDCHandler) logWildcardClient(c *fiber.Ctx, action, orgID, clientID string, req *RegisterClientRequest) {
+	if h.audit == nil {
+		return
+	}
+	userID, _ := c.Locals("user_id").(string)
+	detail, _ := json.Marshal(fiber.Map{"redirect_uris": req.RedirectURIs, "allowed_origins": req.AllowedOrigins})
+	h.audit.LogEvent(c.Context(), models.AuditEvent{
+		OrganizationID:    orgID,
+		PrincipalID:       utils.StringPtr(userID),
+		PrincipalType:     utils.StringPtr("user"),
+		Action:            action,
+		ResourceType:      utils.StringPtr("oauth_client"),
+		ResourceID:        utils.StringPtr(clientID),
+		Result:            "success",
+		AdditionalContext: string(detail),
+		Severity:          "warn",
+	})
 }
 
 // RegisterClient registers a new OIDC client for the organization
@@ -321,20 +688,30 @@ type RegisterClientRequest struct {
 func (h *OIDCHandler) RegisterClient(c *fiber.Ctx) error {
 	var req RegisterClientRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid request format",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
 	}
 
 	if req.ClientName == "" || len(req.RedirectURIs) == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "client_name and redirect_uris are required",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "client_name and redirect_uris are required")
+	}
+	if msg := validateGrantTypes(&req); msg != "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, msg)
+	}
+	wildcards, msg := validateClientURIs(&req)
+	if msg != "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, msg)
+	}
+	if len(req.GrantTypes) == 0 {
+		req.GrantTypes = []string{"authorization_code", "refresh_token"}
 	}
 
 	orgID := c.Locals("organization_id").(string)
+	if err := h.checkClientScopes(c, orgID, &req); err != nil {
+		return err
+	}
+	if err := h.checkClientTokenPolicy(c, orgID, &req); err != nil {
+		return err
+	}
 
 	// Generate client ID and secret
 	clientID := generateClientID()
@@ -344,10 +721,7 @@ func (h *OIDCHandler) RegisterClient(c *fiber.Ctx) error {
 	secretHash, err := bcrypt.GenerateFromPassword([]byte(clientSecret), bcrypt.DefaultCost)
 	if err != nil {
 		h.logger.Error("Failed to hash client secret: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to create client",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create client")
 	}
 
 	now := time.Now()
@@ -357,38 +731,48 @@ func (h *OIDCHandler) RegisterClient(c *fiber.Ctx) error {
 		ClientName:       req.ClientName,
 		ClientSecretHash: string(secretHash),
 		RedirectURIs:     req.RedirectURIs,
-		GrantTypes:       []string{"authorization_code", "refresh_token"},
+		GrantTypes:       req.GrantTypes,
 		ResponseTypes:    []string{"code"},
 		Scope:            req.Scope,
+		Audiences:        req.Audiences,
+		AllowedOrigins:   req.AllowedOrigins,
+		AllowWildcards:   req.AllowWildcards,
 		IsPublic:         req.IsPublic,
 		LogoURL:          req.LogoURL,
+		TokenPolicy:      req.TokenPolicy,
 		CreatedAt:        now,
 		UpdatedAt:        now,
 	}
 
 	if client.Scope == "" {
-		client.Scope = "openid profile email"
+		client.Scope = defaultClientScope
 	}
 
 	err = h.queries.OIDC.CreateClient(client)
 	if err != nil {
 		h.logger.Error("Failed to create OIDC client: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to register client",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to register client")
+	}
+	auditChange(c, h.audit, orgID, "create_oauth_client", "oauth_client", clientID, nil, client)
+	auditClaimRules(c, h.audit, orgID, clientID, nil, clientClaimRules(client))
+	if wildcards {
+		h.logWildcardClient(c, "create_wildcard_oauth_client", orgID, clientID, &req)
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"success": true,
 		"message": "OIDC client registered successfully. Save the client_secret — it cannot be retrieved later.",
 		"data": fiber.Map{
-			"client_id":     clientID,
-			"client_secret": clientSecret,
-			"client_name":   req.ClientName,
-			"redirect_uris": req.RedirectURIs,
-			"grant_types":   client.GrantTypes,
-			"scope":         client.Scope,
+			"client_id":       clientID,
+			"client_secret":   clientSecret,
+			"client_name":     req.ClientName,
+			"redirect_uris":   req.RedirectURIs,
+			"grant_types":     client.GrantTypes,
+			"scope":           client.Scope,
+			"audiences":       client.Audiences,
+			"allowed_origins": client.AllowedOrigins,
+			"allow_wildcards": client.AllowWildcards,
+			"token_policy":    client.TokenPolicy,
 		},
 	})
 }
@@ -397,41 +781,63 @@ func (h *OIDCHandler) RegisterClient(c *fiber.Ctx) error {
 func (h *OIDCHandler) UpdateClient(c *fiber.Ctx) error {
 	clientID := c.Params("id")
 	if clientID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "client_id is required",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "client_id is required")
 	}
 
 	var req RegisterClientRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid request format",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
 	}
-
-	client := &models.OAuthClient{
-		ClientName:   req.ClientName,
-		RedirectURIs: req.RedirectURIs,
-		Scope:        req.Scope,
-		IsPublic:     req.IsPublic,
-		LogoURL:      req.LogoURL,
+	if msg := validateGrantTypes(&req); msg != "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, msg)
+	}
+	wildcards, msg := validateClientURIs(&req)
+	if msg != "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, msg)
+	}
+	orgID, _ := c.Locals("organization_id").(string)
+	if err := h.checkClientScopes(c, orgID, &req); err != nil {
+		return err
+	}
+	if err := h.checkClientTokenPolicy(c, orgID, &req); err != nil {
+		return err
+	}
+	before, err := h.queries.OIDC.GetClientByID(clientID)
+	if err != nil {
+		h.logger.Error("Failed to get OIDC client: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update client")
+	}
+	if before == nil || before.OrganizationID != orgID {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Client not found")
 	}
 
-	err := h.oidc.UpdateClient(clientID, client)
+	client := &models.OAuthClient{
+		ClientName:     req.ClientName,
+		RedirectURIs:   req.RedirectURIs,
+		GrantTypes:     req.GrantTypes,
+		Scope:          req.Scope,
+		Audiences:      req.Audiences,
+		AllowedOrigins: req.AllowedOrigins,
+		AllowWildcards: req.AllowWildcards,
+		IsPublic:       req.IsPublic,
+		LogoURL:        req.LogoURL,
+		TokenPolicy:    req.TokenPolicy,
+	}
+
+	err = h.oidc.UpdateClient(clientID, client)
 	if err != nil {
 		if err.Error() == "client_not_found" {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error":   "Client not found",
-				"success": false,
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Client not found")
 		}
 		h.logger.Error("Failed to update OIDC client: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to update client",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update client")
+	}
+	if after, err := h.queries.OIDC.GetClientByID(clientID); err == nil && after != nil {
+		auditChange(c, h.audit, orgID, "update_oauth_client", "oauth_client", clientID, before, after)
+		auditClaimRules(c, h.audit, orgID, clientID, clientClaimRules(before), clientClaimRules(after))
+	}
+	if wildcards {
+		h.logWildcardClient(c, "update_wildcard_oauth_client", orgID, clientID, &req)
 	}
 
 	return c.JSON(fiber.Map{
@@ -455,10 +861,7 @@ func (h *OIDCHandler) ListClients(c *fiber.Ctx) error {
 	clients, err := h.queries.OIDC.ListClientsByOrg(orgID)
 	if err != nil {
 		h.logger.Error("Failed to list clients: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to retrieve clients",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve clients")
 	}
 
 	return c.JSON(fiber.Map{
@@ -483,20 +886,18 @@ func (h *OIDCHandler) DeleteClient(c *fiber.Ctx) error {
 	clientID := c.Params("id")
 	orgID := c.Locals("organization_id").(string)
 
-	err := h.queries.OIDC.DeleteClient(clientID, orgID)
+	before, err := h.queries.OIDC.GetClientByID(clientID)
+	if err == nil {
+		err = h.queries.OIDC.DeleteClient(clientID, orgID)
+	}
 	if err != nil {
 		if isNotFoundErr(err) {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error":   "Client not found",
-				"success": false,
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Client not found")
 		}
 		h.logger.Error("Failed to delete OIDC client: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to delete client",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to delete client")
 	}
+	auditChange(c, h.audit, orgID, "delete_oauth_client", "oauth_client", clientID, before, nil)
 
 	return c.JSON(fiber.Map{
 		"success": true,
@@ -504,6 +905,102 @@ func (h *OIDCHandler) DeleteClient(c *fiber.Ctx) error {
 	})
 }
 
+// maxSecretOverlapHours bounds how long a rotated client secret stays valid
+const maxSecretOverlapHours = 7 * 24
+
+// RotateClientSecretRequest is the body of POST /oauth2/clients/{id}/rotate-secret
+type RotateClientSecretRequest struct {
+	// OverlapHours keeps the old secret valid for this many hours, while the
+	// client's deployments switch over; 0 invalidates it at once, as for a
+	// leaked secret
+	OverlapHours int `json:"overlap_hours"`
+}
+
+// RotateClientSecret replaces the secret of an OIDC client
+//
+//	@Summary		Rotate OIDC client secret
+//	@Description	Generates a new secret for a confidential client. With overlap_hours the old secret is still accepted for that many hours (at most 168); without it, it stops working at once. Only the secret replaced by the latest rotation can overlap. The rotation is audited as rotate_oauth_client_secret.
+//	@Tags			Federation
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id		path		string						true	"Client ID"
+//	@Param			request	body		RotateClientSecretRequest	false	"Overlap window"
+//	@Success		200		{object}	SuccessResponse	"New secret; it cannot be retrieved later"
+//	@Failure		400		{object}	ErrorResponse	"Public client or invalid overlap"
+//	@Failure		404		{object}	ErrorResponse	"Client not found"
+//	@Failure		500		{object}	ErrorResponse	"Internal server error"
+//	@Router			/oauth2/clients/{id}/rotate-secret [post]
+func (h *OIDCHandler) RotateClientSecret(c *fiber.Ctx) error {
+	var req RotateClientSecretRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
+		}
+	}
+	if req.OverlapHours < 0 || req.OverlapHours > maxSecretOverlapHours {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed,
+			fmt.Sprintf("overlap_hours must be between 0 and %d", maxSecretOverlapHours))
+	}
+
+	orgID := c.Locals("organization_id").(string)
+	client, err := h.queries.OIDC.GetClientByID(c.Params("id"))
+	if err != nil {
+		h.logger.Error("Failed to get OIDC client: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to rotate client secret")
+	}
+	if client == nil || client.OrganizationID != orgID {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Client not found")
+	}
+	if client.IsPublic {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Public clients have no secret")
+	}
+
+	clientSecret := generateClientSecret()
+	secretHash, err := bcrypt.GenerateFromPassword([]byte(clientSecret), bcrypt.DefaultCost)
+	if err != nil {
+		h.logger.Error("Failed to hash client secret: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to rotate client secret")
+	}
+	var previousValidUntil *time.Time
+	if req.OverlapHours > 0 {
+		until := time.Now().Add(time.Duration(req.OverlapHours) * time.Hour)
+		previousValidUntil = &until
+	}
+	if err := h.queries.OIDC.RotateClientSecret(client.ID, orgID, string(secretHash), previousValidUntil); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Client not found")
+		}
+		h.logger.Error("Failed to rotate OIDC client secret: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to rotate client secret")
+	}
+
+	if h.audit != nil {
+		userID, _ := c.Locals("user_id").(string)
+		details, _ := json.Marshal(fiber.Map{
+			"overlap_hours":              req.OverlapHours,
+			"previous_secret_expires_at": previousValidUntil,
+		})
+		h.audit.LogEvent(c.Context(), models.AuditEvent{
+			OrganizationID:    orgID,
+			PrincipalID:       utils.StringPtr(userID),
+			PrincipalType:     utils.StringPtr(callerPrincipalType(c)),
+			Action:            "rotate_oauth_client_secret",
+			ResourceType:      utils.StringPtr("oauth_client"),
+			ResourceID:        utils.StringPtr(client.ID),
+			Result:            "success",
+			AdditionalContext: string(details),
+			Severity:          "warn",
+		})
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Client secret rotated. Save the client_secret — it cannot be retrieved later.", fiber.Map{
+		"client_id":                  client.ID,
+		"client_secret":              clientSecret,
+		"previous_secret_expires_at": previousValidUntil,
+	})
+}
+
 // generateClientID creates a valid UUID for the client identifier
 func generateClientID() string {
 	return uuid.New().String()
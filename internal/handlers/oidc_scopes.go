@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+)
+
+// Custom scope names look like blog:write or orders.read
+var scopeNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:/-]{0,254}$`)
+
+// reservedScopes are defined by OpenID Connect and cannot be redefined
+var reservedScopes = map[string]bool{"openid": true, "profile": true, "email": true, "offline_access": true}
+
+// OAuthScopeRequest is the request body for defining a custom OAuth scope
+type OAuthScopeRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Actions are the policy actions (wildcards allowed) granted to tokens
+	// carrying the scope, e.g. ["blog:post:create", "blog:post:update"]
+	Actions []string `json:"actions"`
+}
+
+// OAuthAudienceRequest is the request body for registering an API audience
+type OAuthAudienceRequest struct {
+	Identifier  string `json:"identifier"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// checkClientScopes writes an error response when a client registration
+// names scopes or audiences its organization has not defined
+func (h *OIDCHandler) checkClientScopes(c *fiber.Ctx, orgID string, req *RegisterClientRequest) error {
+	err := h.oidc.CheckClientScopes(orgID, req.Scope, req.Audiences)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, services.ErrUnknownScope), errors.Is(err, services.ErrUnknownAudience):
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, err.Error())
+	}
+	h.logger.Error("Failed to check client scopes: %v", err)
+	return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to validate client scopes")
+}
+
+// ListScopes returns the organization's custom OAuth scopes
+//
+//	@Summary		List OAuth Scopes
+//	@Description	List the custom OAuth scopes defined by the organization and the actions each grants
+//	@Tags			Federation
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	map[string]interface{}
+//	@Router			/oauth2/scopes [get]
+func (h *OIDCHandler) ListScopes(c *fiber.Ctx) error {
+	orgID := c.Locals("organization_id").(string)
+
+	scopes, err := h.queries.OIDC.ListScopesByOrg(orgID)
+	if err != nil {
+		h.logger.Error("Failed to list OAuth scopes: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve scopes")
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Scopes retrieved", scopes)
+}
+
+// CreateScope defines a custom OAuth scope for the organization
+//
+//	@Summary		Create OAuth Scope
+//	@Description	Define a custom OAuth scope (e.g. blog:write) and the policy actions it grants. Attach it to clients by listing it in their scope.
+//	@Tags			Federation
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			request	body		OAuthScopeRequest	true	"Scope definition"
+//	@Success		201		{object}	map[string]interface{}
+//	@Failure		400		{object}	map[string]interface{}
+//	@Failure		409		{object}	map[string]interface{}
+//	@Router			/oauth2/scopes [post]
+func (h *OIDCHandler) CreateScope(c *fiber.Ctx) error {
+	var req OAuthScopeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
+	}
+	if !scopeNamePattern.MatchString(req.Name) || reservedScopes[req.Name] {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "name must be a non-reserved scope token such as blog:write")
+	}
+	if msg := validateScopeActions(req.Actions); msg != "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, msg)
+	}
+
+	scope := &models.OAuthScope{
+		OrganizationID: c.Locals("organization_id").(string),
+		Name:           req.Name,
+		Description:    req.Description,
+		Actions:        req.Actions,
+	}
+	if err := h.queries.OIDC.CreateScope(scope); err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "A scope with this name already exists")
+		}
+		h.logger.Error("Failed to create OAuth scope: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create scope")
+	}
+
+	return apiSuccess(c, fiber.StatusCreated, "Scope created", scope)
+}
+
+// UpdateScope changes the description and actions of a custom scope
+//
+//	@Summary		Update OAuth Scope
+//	@Description	Change the description and granted actions of a custom OAuth scope. Takes effect for tokens already issued.
+//	@Tags			Federation
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id		path		string				true	"Scope ID"
+//	@Param			request	body		OAuthScopeRequest	true	"Scope definition (name is ignored)"
+//	@Success		200		{object}	map[string]interface{}
+//	@Failure		404		{object}	map[string]interface{}
+//	@Router			/oauth2/scopes/{id} [put]
+func (h *OIDCHandler) UpdateScope(c *fiber.Ctx) error {
+	var req OAuthScopeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
+	}
+	if msg := validateScopeActions(req.Actions); msg != "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, msg)
+	}
+
+	scope := &models.OAuthScope{
+		ID:             c.Params("id"),
+		OrganizationID: c.Locals("organization_id").(string),
+		Description:    req.Description,
+		Actions:        req.Actions,
+	}
+	if err := h.queries.OIDC.UpdateScope(scope); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Scope not found")
+		}
+		h.logger.Error("Failed to update OAuth scope: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update scope")
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Scope updated", scope)
+}
+
+// DeleteScope removes a custom OAuth scope
+//
+//	@Summary		Delete OAuth Scope
+//	@Description	Delete a custom OAuth scope. Tokens already carrying it no longer grant any action.
+//	@Tags			Federation
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"Scope ID"
+//	@Success		200	{object}	map[string]interface{}
+//	@Failure		404	{object}	map[string]interface{}
+//	@Router			/oauth2/scopes/{id} [delete]
+func (h *OIDCHandler) DeleteScope(c *fiber.Ctx) error {
+	orgID := c.Locals("organization_id").(string)
+
+	if err := h.queries.OIDC.DeleteScope(c.Params("id"), orgID); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Scope not found")
+		}
+		h.logger.Error("Failed to delete OAuth scope: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to delete scope")
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Scope deleted", nil)
+}
+
+// ListAudiences returns the organization's API audiences
+//
+//	@Summary		List API Audiences
+//	@Description	List the APIs of the organization that access tokens can be issued for
+//	@Tags			Federation
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	map[string]interface{}
+//	@Router			/oauth2/audiences [get]
+func (h *OIDCHandler) ListAudiences(c *fiber.Ctx) error {
+	orgID := c.Locals("organization_id").(string)
+
+	audiences, err := h.queries.OIDC.ListAudiencesByOrg(orgID)
+	if err != nil {
+		h.logger.Error("Failed to list OAuth audiences: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve audiences")
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Audiences retrieved", audiences)
+}
+
+// CreateAudience registers an API audience for the organization
+//
+//	@Summary		Create API Audience
+//	@Description	Register an API whose identifier can be attached to clients and is then added to the aud claim of their access tokens
+//	@Tags			Federation
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			request	body		OAuthAudienceRequest	true	"Audience definition"
+//	@Success		201		{object}	map[string]interface{}
+//	@Failure		400		{object}	map[string]interface{}
+//	@Failure		409		{object}	map[string]interface{}
+//	@Router			/oauth2/audiences [post]
+func (h *OIDCHandler) CreateAudience(c *fiber.Ctx) error {
+	var req OAuthAudienceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
+	}
+	req.Identifier = strings.TrimSpace(req.Identifier)
+	if req.Identifier == "" || len(req.Identifier) > 512 || strings.ContainsAny(req.Identifier, " \t\n") {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "identifier is required and may not contain whitespace")
+	}
+	if req.Name == "" {
+		req.Name = req.Identifier
+	}
+
+	audience := &models.OAuthAudience{
+		OrganizationID: c.Locals("organization_id").(string),
+		Identifier:     req.Identifier,
+		Name:           req.Name,
+		Description:    req.Description,
+	}
+	if err := h.queries.OIDC.CreateAudience(audience); err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "An audience with this identifier already exists")
+		}
+		h.logger.Error("Failed to create OAuth audience: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create audience")
+	}
+
+	return apiSuccess(c, fiber.StatusCreated, "Audience created", audience)
+}
+
+// DeleteAudience removes an API audience
+//
+//	@Summary		Delete API Audience
+//	@Description	Delete an API audience and detach it from the organization's clients
+//	@Tags			Federation
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"Audience ID"
+//	@Success		200	{object}	map[string]interface{}
+//	@Failure		404	{object}	map[string]interface{}
+//	@Router			/oauth2/audiences/{id} [delete]
+func (h *OIDCHandler) DeleteAudience(c *fiber.Ctx) error {
+	orgID := c.Locals("organization_id").(string)
+
+	if err := h.queries.OIDC.DeleteAudience(c.Params("id"), orgID); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Audience not found")
+		}
+		h.logger.Error("Failed to delete OAuth audience: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to delete audience")
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Audience deleted", nil)
+}
+
+func validateScopeActions(actions []string) string {
+	if len(actions) == 0 {
+		return "actions must list at least one policy action"
+	}
+	for _, a := range actions {
+		if strings.TrimSpace(a) == "" || strings.ContainsAny(a, " \t\n") {
+			return "actions may not be empty or contain whitespace"
+		}
+	}
+	return ""
+}
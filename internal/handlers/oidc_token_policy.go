@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// validateClientTokenLimits checks an organization's caps on the token
+// lifetimes of its clients
+func validateClientTokenLimits(l *models.ClientTokenLimits) error {
+	if _, err := checkTTL("max_access_token_ttl", l.MaxAccessTokenTTL, maxAccessTokenTTL); err != nil {
+		return err
+	}
+	if _, err := checkTTL("max_id_token_ttl", l.MaxIDTokenTTL, maxAccessTokenTTL); err != nil {
+		return err
+	}
+	_, err := checkTTL("max_refresh_token_ttl", l.MaxRefreshTokenTTL, maxRefreshTokenTTL)
+	return err
+}
+
+// validateClientTokenPolicy checks the token policy of a client with the
+// given scope against the server's limits and, when set, its organization's
+func validateClientTokenPolicy(p *models.ClientTokenPolicy, scope string, limits *models.ClientTokenLimits) error {
+	if limits == nil {
+		limits = &models.ClientTokenLimits{}
+	}
+	for _, ttl := range []struct {
+		name, value, limitName, limit string
+		max                           time.Duration
+	}{
+		{"access_token_ttl", p.AccessTokenTTL, "max_access_token_ttl", limits.MaxAccessTokenTTL, maxAccessTokenTTL},
+		{"id_token_ttl", p.IDTokenTTL, "max_id_token_ttl", limits.MaxIDTokenTTL, maxAccessTokenTTL},
+		{"refresh_token_ttl", p.RefreshTokenTTL, "max_refresh_token_ttl", limits.MaxRefreshTokenTTL, maxRefreshTokenTTL},
+	} {
+		d, err := checkTTL(ttl.name, ttl.value, ttl.max)
+		if err != nil {
+			return err
+		}
+		if max, err := time.ParseDuration(ttl.limit); err == nil && d > max {
+			return fmt.Errorf("%s exceeds the organization's %s of %s", ttl.name, ttl.limitName, max)
+		}
+	}
+
+	allowed := map[string]bool{}
+	for _, sc := range strings.Fields(scope) {
+		allowed[sc] = true
+	}
+	for _, sc := range p.AllowedScopes {
+		if !reservedScopes[sc] && !allowed[sc] {
+			return fmt.Errorf("allowed_scopes may only list scopes of the client: %s", sc)
+		}
+	}
+	if err := validateClaimRules(p.Claims); err != nil {
+		return fmt.Errorf("claims: %v", err)
+	}
+	return nil
+}
+
+// tokenPolicyProblem returns what is wrong with the token policy of a
+// client registration, or "" when it is valid or absent
+func (h *OIDCHandler) tokenPolicyProblem(orgID string, req *RegisterClientRequest) (string, error) {
+	if req.TokenPolicy == nil {
+		return "", nil
+	}
+	limits, err := h.queries.Organization.GetClientTokenLimits(orgID)
+	if err != nil {
+		return "", err
+	}
+	scope := req.Scope
+	if scope == "" {
+		scope = defaultClientScope
+	}
+	if err := validateClientTokenPolicy(req.TokenPolicy, scope, limits); err != nil {
+		return "Invalid token_policy: " + err.Error(), nil
+	}
+	return "", nil
+}
+
+// checkClientTokenPolicy writes an error response when the token policy of
+// a client registration is invalid or exceeds its organization's limits
+func (h *OIDCHandler) checkClientTokenPolicy(c *fiber.Ctx, orgID string, req *RegisterClientRequest) error {
+	msg, err := h.tokenPolicyProblem(orgID, req)
+	if err != nil {
+		h.logger.Error("Failed to read client token limits: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to validate client token policy")
+	}
+	if msg != "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, msg)
+	}
+	return nil
+}
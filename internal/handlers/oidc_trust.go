@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// ClientTrustRequest is the body of PUT /admin/oauth-clients/{id}/trust
+type ClientTrustRequest struct {
+	// IsTrusted lets the client skip the consent screen
+	IsTrusted bool `json:"is_trusted"`
+	// IsFirstParty marks an application the organization builds itself; it
+	// requires is_trusted
+	IsFirstParty bool `json:"is_first_party"`
+}
+
+// clientTrust is the trust status of a client as recorded in the audit log
+type clientTrust struct {
+	IsTrusted    bool `json:"is_trusted"`
+	IsFirstParty bool `json:"is_first_party"`
+}
+
+// trustAllowed reports whether the organization's policy lets a client with
+// this trust status skip consent
+func trustAllowed(policy *models.TrustedClientPolicy, trusted, firstParty bool) bool {
+	if !trusted {
+		return false
+	}
+	if policy == nil {
+		return true
+	}
+	return !policy.Disabled && (firstParty || !policy.FirstPartyOnly)
+}
+
+// skipsConsent reports whether a client may skip the consent screen. When
+// its organization's policy cannot be read the user is asked.
+func (h *OIDCHandler) skipsConsent(client *models.OAuthClient) bool {
+	if !client.IsTrusted {
+		return false
+	}
+	policy, err := h.queries.Organization.GetTrustedClientPolicy(client.OrganizationID)
+	if err != nil {
+		h.logger.Warn("Failed to read trusted client policy of organization %s: %v", client.OrganizationID, err)
+		return false
+	}
+	return trustAllowed(policy, client.IsTrusted, client.IsFirstParty)
+}
+
+// SetClientTrust marks an OIDC client trusted or first-party
+//
+//	@Summary		Set OIDC client trust
+//	@Description	Root only. Marks a client of any organization trusted, so that it skips the consent screen, and first-party, for applications the organization builds itself. The organization's trusted_clients settings must allow it: disabled refuses trusted clients and first_party_only refuses trusted clients that are not first-party. Every change is audited as update_oauth_client_trust.
+//	@Tags			Federation
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string				true	"Client ID"
+//	@Param			request	body		ClientTrustRequest	true	"Trust status"
+//	@Success		200		{object}	SuccessResponse{data=models.OAuthClient}	"Trust status updated"
+//	@Failure		400		{object}	ErrorResponse	"First-party client that is not trusted"
+//	@Failure		403		{object}	ErrorResponse	"Caller is not a root user"
+//	@Failure		404		{object}	ErrorResponse	"Client not found"
+//	@Failure		409		{object}	ErrorResponse	"The organization does not allow the trust status"
+//	@Failure		500		{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/admin/oauth-clients/{id}/trust [put]
+func (h *OIDCHandler) SetClientTrust(c *fiber.Ctx) error {
+	var req ClientTrustRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
+	}
+	if req.IsFirstParty && !req.IsTrusted {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "First-party clients must be trusted")
+	}
+
+	client, err := h.queries.OIDC.GetClientByID(c.Params("id"))
+	if err != nil {
+		h.logger.Error("Failed to get OIDC client: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update client trust")
+	}
+	if client == nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Client not found")
+	}
+	if req.IsTrusted {
+		policy, err := h.queries.Organization.GetTrustedClientPolicy(client.OrganizationID)
+		if err != nil {
+			h.logger.Error("Failed to read trusted client policy: %v", err)
+			return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update client trust")
+		}
+		if !trustAllowed(policy, req.IsTrusted, req.IsFirstParty) {
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict,
+				"The organization's trusted_clients settings do not allow this client to skip consent")
+		}
+	}
+
+	before := clientTrust{IsTrusted: client.IsTrusted, IsFirstParty: client.IsFirstParty}
+	after := clientTrust{IsTrusted: req.IsTrusted, IsFirstParty: req.IsFirstParty}
+	if before != after {
+		if err := h.queries.OIDC.SetClientTrust(client.ID, client.OrganizationID, req.IsTrusted, req.IsFirstParty); err != nil {
+			if isNotFoundErr(err) {
+				return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Client not found")
+			}
+			h.logger.Error("Failed to update OIDC client trust: %v", err)
+			return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update client trust")
+		}
+		auditChange(c, h.audit, client.OrganizationID, "update_oauth_client_trust", "oauth_client", client.ID, before, after)
+	}
+	client.IsTrusted, client.IsFirstParty = req.IsTrusted, req.IsFirstParty
+	return apiSuccess(c, fiber.StatusOK, "Client trust updated", client)
+}
+
+// ListTrustedClients lists the OIDC clients that skip consent
+//
+//	@Summary		List trusted OIDC clients
+//	@Description	Root only. Lists the trusted and first-party clients of every organization, or of one. A trusted client of an organization whose trusted_clients settings no longer allow it still asks for consent.
+//	@Tags			Federation
+//	@Produce		json
+//	@Param			organization_id	query		string			false	"Only clients of this organization"
+//	@Success		200				{object}	SuccessResponse	"Trusted clients"
+//	@Failure		403				{object}	ErrorResponse	"Caller is not a root user"
+//	@Failure		500				{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/admin/oauth-clients/trusted [get]
+func (h *OIDCHandler) ListTrustedClients(c *fiber.Ctx) error {
+	clients, err := h.queries.OIDC.ListTrustedClients(c.Query("organization_id"))
+	if err != nil {
+		h.logger.Error("Failed to list trusted clients: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve clients")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Trusted clients retrieved successfully", clients)
+}
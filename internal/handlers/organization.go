@@ -1,25 +1,39 @@
 package handlers
 
 import (
+	"encoding/json"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
 	"github.com/the-monkeys/monkeys-identity/internal/database"
 	"github.com/the-monkeys/monkeys-identity/internal/middleware"
 	"github.com/the-monkeys/monkeys-identity/internal/models"
 	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+	"github.com/the-monkeys/monkeys-identity/internal/storage"
 	"github.com/the-monkeys/monkeys-identity/pkg/logger"
 )
 
 type OrganizationHandler struct {
-	db      *database.DB
-	redis   *redis.Client
-	logger  *logger.Logger
-	queries *queries.Queries
-	cors    *middleware.DynamicCORS // set via SetCORS after construction
+	db        *database.DB
+	redis     redis.UniversalClient
+	logger    *logger.Logger
+	queries   *queries.Queries
+	cors      *middleware.DynamicCORS              // set via SetCORS after construction
+	settings  services.SettingsService             // set via SetSettings after construction
+	deletions services.OrganizationDeletionService // set via SetDeletions after construction
+	audit     services.AuditService                // set via SetAudit after construction
+	store     storage.Backend                      // set via SetBrandingStore after construction
+	baseURL   string                               // set via SetBrandingStore after construction
+	email     services.EmailService                // set via SetEmail after construction
+
+	claimsWebhooks bool                          // set via SetClaimsWebhooks after construction
+	directorySync  services.DirectorySyncService // set via SetDirectorySync after construction
 }
 
 type PublicOrganization struct {
@@ -27,7 +41,7 @@ type PublicOrganization struct {
 	Name string `json:"name"`
 }
 
-func NewOrganizationHandler(db *database.DB, redis *redis.Client, logger *logger.Logger) *OrganizationHandler {
+func NewOrganizationHandler(db *database.DB, redis redis.UniversalClient, logger *logger.Logger) *OrganizationHandler {
 	return &OrganizationHandler{db: db, redis: redis, logger: logger, queries: queries.New(db, redis)}
 }
 
@@ -38,6 +52,18 @@ func (h *OrganizationHandler) SetCORS(cors *middleware.DynamicCORS) {
 	h.cors = cors
 }
 
+// SetSettings injects the settings service so global settings updates reach
+// every replica. Called from route setup.
+func (h *OrganizationHandler) SetSettings(settings services.SettingsService) {
+	h.settings = settings
+}
+
+// SetAudit injects the audit log organization and settings changes are
+// recorded in. Called from route setup.
+func (h *OrganizationHandler) SetAudit(audit services.AuditService) {
+	h.audit = audit
+}
+
 // ListOrganizations lists tenant organizations (paginated)
 // ListOrganizations
 //
@@ -47,6 +73,7 @@ func (h *OrganizationHandler) SetCORS(cors *middleware.DynamicCORS) {
 //	@Accept       json
 //	@Produce      json
 //	@Param        limit   query   int   false  "Items per page (1-1000)"
+//	@Param        cursor  query   string   false  "Opaque cursor from next_cursor of the previous page; overrides offset"
 //	@Param        offset  query   int   false  "Offset for pagination"
 //	@Success      200  {object}  SuccessResponse  "Organizations retrieved"
 //	@Failure      400  {object}  ErrorResponse    "Invalid pagination parameters"
@@ -57,21 +84,24 @@ func (h *OrganizationHandler) ListOrganizations(c *fiber.Ctx) error {
 	limit := c.QueryInt("limit", 50)
 	offset := c.QueryInt("offset", 0)
 	if limit < 1 || limit > 1000 {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_limit", Message: "Limit must be between 1 and 1000"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Limit must be between 1 and 1000")
 	}
 	if offset < 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_offset", Message: "Offset must be non-negative"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Offset must be non-negative")
 	}
 
 	// Scope listing via tenant context — root sees all, org admin sees their org.
 	tc := middleware.GetTenantContext(c)
 	if tc == nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Status: fiber.StatusUnauthorized, Error: "tenant_context_missing", Message: "Tenant context not resolved"})
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Tenant context not resolved")
 	}
-	res, err := h.queries.Organization.ListOrganizations(queries.ListParams{Limit: limit, Offset: offset}, tc.OrgFilter())
+	res, err := h.queries.Organization.ListOrganizations(queries.ListParams{Limit: limit, Offset: offset, Cursor: c.Query("cursor")}, tc.OrgFilter())
 	if err != nil {
+		if isInvalidCursorErr(err) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid pagination cursor")
+		}
 		h.logger.Error("List organizations failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to list organizations"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list organizations")
 	}
 	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Organizations retrieved", Data: res})
 }
@@ -93,7 +123,7 @@ func (h *OrganizationHandler) ListPublicOrganizations(c *fiber.Ctx) error {
 	res, err := h.queries.Organization.ListOrganizations(queries.ListParams{Limit: 1000, Offset: 0}, "")
 	if err != nil {
 		h.logger.Error("List public organizations failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to list organizations"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list organizations")
 	}
 
 	publicOrgs := make([]PublicOrganization, 0, len(res.Items))
@@ -102,6 +132,13 @@ func (h *OrganizationHandler) ListPublicOrganizations(c *fiber.Ctx) error {
 		if middleware.IsInternalOrg(org.Slug) {
 			continue
 		}
+		// Invite-only organizations cannot be joined from the signup form
+		var settings struct {
+			Registration models.RegistrationPolicy `json:"registration"`
+		}
+		if json.Unmarshal([]byte(org.Settings), &settings) == nil && settings.Registration.InviteOnly {
+			continue
+		}
 		publicOrgs = append(publicOrgs, PublicOrganization{
 			ID:   org.ID,
 			Name: org.Name,
@@ -129,10 +166,10 @@ func (h *OrganizationHandler) ListPublicOrganizations(c *fiber.Ctx) error {
 func (h *OrganizationHandler) CreateOrganization(c *fiber.Ctx) error {
 	var org models.Organization
 	if err := c.BodyParser(&org); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_request_body", Message: "Failed to parse request body"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
 	}
 	if strings.TrimSpace(org.Name) == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "validation_failed", Message: "name is required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "name is required")
 	}
 	if org.Slug == "" {
 		// naive slug (lowercase, replace spaces)
@@ -164,10 +201,13 @@ func (h *OrganizationHandler) CreateOrganization(c *fiber.Ctx) error {
 	}
 	if err := h.queries.Organization.CreateOrganization(&org); err != nil {
 		if strings.Contains(err.Error(), "unique") {
-			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Status: fiber.StatusConflict, Error: "organization_exists", Message: "Organization with this name or slug already exists"})
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "Organization with this name or slug already exists")
 		}
 		h.logger.Error("Create organization failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to create organization"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create organization")
+	}
+	if err := services.SeedSystemRoles(h.queries.Role, org.ID); err != nil {
+		h.logger.Warn("Failed to seed system roles for organization %s: %v", org.ID, err)
 	}
 	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{Status: fiber.StatusCreated, Message: "Organization created", Data: org})
 }
@@ -189,15 +229,15 @@ func (h *OrganizationHandler) CreateOrganization(c *fiber.Ctx) error {
 func (h *OrganizationHandler) GetOrganization(c *fiber.Ctx) error {
 	id := c.Params("id")
 	if id == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_id", Message: "Organization ID required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Organization ID required")
 	}
 	org, err := h.queries.Organization.GetOrganization(id)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "organization_not_found", Message: "Organization not found"})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization not found")
 		}
 		h.logger.Error("Get organization failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to get organization"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to get organization")
 	}
 	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Organization retrieved", Data: org})
 }
@@ -221,19 +261,19 @@ func (h *OrganizationHandler) GetOrganization(c *fiber.Ctx) error {
 func (h *OrganizationHandler) UpdateOrganization(c *fiber.Ctx) error {
 	id := c.Params("id")
 	if id == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_id", Message: "Organization ID required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Organization ID required")
 	}
-	_, err := h.queries.Organization.GetOrganization(id)
+	before, err := h.queries.Organization.GetOrganization(id)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "organization_not_found", Message: "Organization not found"})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization not found")
 		}
 		h.logger.Error("Failed to fetch organization for update: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to retrieve organization"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve organization")
 	}
 	var upd models.Organization
 	if err := c.BodyParser(&upd); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_request_body", Message: "Failed to parse request body"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
 	}
 	upd.ID = id
 	if upd.Status == "" {
@@ -248,41 +288,70 @@ func (h *OrganizationHandler) UpdateOrganization(c *fiber.Ctx) error {
 	}
 	if err := h.queries.Organization.UpdateOrganization(&upd); err != nil {
 		if strings.Contains(err.Error(), "not found") {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "organization_not_found", Message: "Organization not found or deleted"})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization not found or deleted")
 		}
 		h.logger.Error("Update organization failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to update organization"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update organization")
+	}
+	if after, err := h.queries.Organization.GetOrganization(id); err == nil {
+		auditChange(c, h.audit, id, "update_organization", "organization", id, before, after)
 	}
 	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Organization updated", Data: upd})
 }
 
-// DeleteOrganization soft deletes an organization
-// DeleteOrganization
+// maxAnalyticsDays bounds the range of the organization analytics
+const maxAnalyticsDays = 366
+
+// GetOrganizationAnalytics
 //
-//	@Summary      Delete organization
-//	@Description  Soft delete an organization
+//	@Summary      Organization usage analytics
+//	@Description  Daily active users, logins and login failures, content published, API key requests and the most accessed resources of an organization, per UTC day and in total. Days are rolled up nightly, so the current day is not included. Defaults to the last 30 days.
 //	@Tags         Organization Management
 //	@Produce      json
-//	@Param        id  path  string  true  "Organization ID"
-//	@Success      200  {object}  SuccessResponse  "Organization deleted"
-//	@Failure      400  {object}  ErrorResponse    "Invalid organization ID"
-//	@Failure      404  {object}  ErrorResponse    "Organization not found"
+//	@Param        id    path   string  true   "Organization ID"
+//	@Param        from  query  string  false  "First day, YYYY-MM-DD"
+//	@Param        to    query  string  false  "Last day, YYYY-MM-DD (default: yesterday)"
+//	@Success      200  {object}  models.OrgUsageReport  "Analytics retrieved"
+//	@Failure      400  {object}  ErrorResponse    "Invalid range"
+//	@Failure      403  {object}  ErrorResponse    "Organization admin required"
 //	@Failure      500  {object}  ErrorResponse    "Internal server error"
 //	@Security     BearerAuth
-//	@Router       /organizations/{id} [delete]
-func (h *OrganizationHandler) DeleteOrganization(c *fiber.Ctx) error {
-	id := c.Params("id")
-	if id == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_id", Message: "Organization ID required"})
+//	@Router       /organizations/{id}/analytics [get]
+func (h *OrganizationHandler) GetOrganizationAnalytics(c *fiber.Ctx) error {
+	orgID := c.Params("id")
+	if orgID == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Organization ID required")
 	}
-	if err := h.queries.Organization.DeleteOrganization(id); err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "organization_not_found", Message: "Organization not found"})
+
+	to := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "to must be a date (YYYY-MM-DD)")
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -29)
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "from must be a date (YYYY-MM-DD)")
 		}
-		h.logger.Error("Delete organization failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to delete organization"})
+		from = t
+	}
+	if from.After(to) {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "from must not be after to")
+	}
+	if to.Sub(from) >= maxAnalyticsDays*24*time.Hour {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "The range may cover at most 366 days")
 	}
-	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Organization deleted", Data: fiber.Map{"organization_id": id, "deleted_at": time.Now()}})
+
+	report, err := h.queries.Stats.WithContext(c.Context()).GetOrgUsage(orgID, from, to)
+	if err != nil {
+		h.logger.Error("Get organization analytics failed: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to get analytics")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Analytics retrieved", report)
 }
 
 // GetOrganizationUsers
@@ -300,12 +369,12 @@ func (h *OrganizationHandler) DeleteOrganization(c *fiber.Ctx) error {
 func (h *OrganizationHandler) GetOrganizationUsers(c *fiber.Ctx) error {
 	orgID := c.Params("id")
 	if orgID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_id", Message: "Organization ID required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Organization ID required")
 	}
 	users, err := h.queries.Organization.ListOrganizationUsers(orgID)
 	if err != nil {
 		h.logger.Error("List org users failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to list users"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list users")
 	}
 	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Users retrieved", Data: fiber.Map{"organization_id": orgID, "users": users, "count": len(users)}})
 }
@@ -325,12 +394,12 @@ func (h *OrganizationHandler) GetOrganizationUsers(c *fiber.Ctx) error {
 func (h *OrganizationHandler) GetOrganizationGroups(c *fiber.Ctx) error {
 	orgID := c.Params("id")
 	if orgID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_id", Message: "Organization ID required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Organization ID required")
 	}
 	groups, err := h.queries.Organization.ListOrganizationGroups(orgID)
 	if err != nil {
 		h.logger.Error("List org groups failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to list groups"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list groups")
 	}
 	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Groups retrieved", Data: fiber.Map{"organization_id": orgID, "groups": groups, "count": len(groups)}})
 }
@@ -350,12 +419,12 @@ func (h *OrganizationHandler) GetOrganizationGroups(c *fiber.Ctx) error {
 func (h *OrganizationHandler) GetOrganizationResources(c *fiber.Ctx) error {
 	orgID := c.Params("id")
 	if orgID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_id", Message: "Organization ID required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Organization ID required")
 	}
 	resources, err := h.queries.Organization.ListOrganizationResources(orgID)
 	if err != nil {
 		h.logger.Error("List org resources failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to list resources"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list resources")
 	}
 	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Resources retrieved", Data: fiber.Map{"organization_id": orgID, "resources": resources, "count": len(resources)}})
 }
@@ -375,12 +444,12 @@ func (h *OrganizationHandler) GetOrganizationResources(c *fiber.Ctx) error {
 func (h *OrganizationHandler) GetOrganizationPolicies(c *fiber.Ctx) error {
 	orgID := c.Params("id")
 	if orgID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_id", Message: "Organization ID required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Organization ID required")
 	}
 	policies, err := h.queries.Organization.ListOrganizationPolicies(orgID)
 	if err != nil {
 		h.logger.Error("List org policies failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to list policies"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list policies")
 	}
 	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Policies retrieved", Data: fiber.Map{"organization_id": orgID, "policies": policies, "count": len(policies)}})
 }
@@ -400,12 +469,12 @@ func (h *OrganizationHandler) GetOrganizationPolicies(c *fiber.Ctx) error {
 func (h *OrganizationHandler) GetOrganizationRoles(c *fiber.Ctx) error {
 	orgID := c.Params("id")
 	if orgID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_id", Message: "Organization ID required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Organization ID required")
 	}
 	roles, err := h.queries.Organization.ListOrganizationRoles(orgID)
 	if err != nil {
 		h.logger.Error("List org roles failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to list roles"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list roles")
 	}
 	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Roles retrieved", Data: fiber.Map{"organization_id": orgID, "roles": roles, "count": len(roles)}})
 }
@@ -418,6 +487,7 @@ func (h *OrganizationHandler) GetOrganizationRoles(c *fiber.Ctx) error {
 //	@Produce      json
 //	@Param        id  path  string  true  "Organization ID"
 //	@Success      200  {object}  SuccessResponse  "Settings retrieved"
+//	@Success      304  "Not modified"
 //	@Failure      400  {object}  ErrorResponse    "Invalid organization ID"
 //	@Failure      404  {object}  ErrorResponse    "Organization not found"
 //	@Failure      500  {object}  ErrorResponse    "Internal server error"
@@ -426,17 +496,17 @@ func (h *OrganizationHandler) GetOrganizationRoles(c *fiber.Ctx) error {
 func (h *OrganizationHandler) GetOrganizationSettings(c *fiber.Ctx) error {
 	orgID := c.Params("id")
 	if orgID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_id", Message: "Organization ID required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Organization ID required")
 	}
 	settings, err := h.queries.Organization.GetOrganizationSettings(orgID)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "organization_not_found", Message: "Organization not found"})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization not found")
 		}
 		h.logger.Error("Get org settings failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to get settings"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to get settings")
 	}
-	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Settings retrieved", Data: fiber.Map{"organization_id": orgID, "settings": settings}})
+	return conditionalJSON(c, SuccessResponse{Status: fiber.StatusOK, Message: "Settings retrieved", Data: fiber.Map{"organization_id": orgID, "settings": settings}}, cacheRevalidate)
 }
 
 type updateSettingsRequest struct {
@@ -461,26 +531,211 @@ type updateSettingsRequest struct {
 func (h *OrganizationHandler) UpdateOrganizationSettings(c *fiber.Ctx) error {
 	orgID := c.Params("id")
 	if orgID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_id", Message: "Organization ID required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Organization ID required")
 	}
 	var req updateSettingsRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_request_body", Message: "Failed to parse request body"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
 	}
 	if strings.TrimSpace(req.Settings) == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "validation_failed", Message: "settings is required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "settings is required")
+	}
+	if msg := validateOrganizationSettings(req.Settings); msg != "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, msg)
 	}
-	if err := h.queries.Organization.UpdateOrganizationSettings(orgID, req.Settings); err != nil {
+	before, err := h.queries.Organization.GetOrganizationSettings(orgID)
+	if err == nil {
+		err = h.queries.Organization.UpdateOrganizationSettings(orgID, req.Settings)
+	}
+	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "organization_not_found", Message: "Organization not found"})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization not found")
 		}
 		h.logger.Error("Update org settings failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to update settings"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update settings")
 	}
+	auditChange(c, h.audit, orgID, "update_organization_settings", "organization_settings", orgID,
+		settingsSnapshot(before), settingsSnapshot(req.Settings))
+	auditClaimRules(c, h.audit, orgID, orgID, settingsClaimRules(before), settingsClaimRules(req.Settings))
 	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Settings updated", Data: fiber.Map{"organization_id": orgID}})
 }
 
-// Global settings (system-wide) placeholders — real implementation would use a dedicated table
+// settingsSnapshot is the settings JSON as recorded in the audit log; it is
+// an object once validated, and anything else is recorded as empty
+func settingsSnapshot(settings string) interface{} {
+	var snapshot map[string]interface{}
+	if json.Unmarshal([]byte(settings), &snapshot) != nil || snapshot == nil {
+		return map[string]interface{}{}
+	}
+	return snapshot
+}
+
+// validateOrganizationSettings checks the known keys of organization
+// settings, returning what is wrong with them or "" when they are valid
+func validateOrganizationSettings(settings string) string {
+	var known struct {
+		TokenLifetimes          *models.TokenLifetimes           `json:"token_lifetimes"`
+		AuthzDecisionSampleRate *float64                         `json:"authz_decision_sample_rate"`
+		Registration            *models.RegistrationPolicy       `json:"registration"`
+		Username                *models.UsernamePolicy           `json:"username"`
+		Comments                *models.CommentPolicy            `json:"comments"`
+		Attachments             *models.AttachmentPolicy         `json:"attachments"`
+		Password                *models.PasswordPolicy           `json:"password"`
+		Session                 *models.SessionPolicy            `json:"session"`
+		Inactivity              *models.InactivityPolicy         `json:"inactivity"`
+		SeparationOfDuties      *models.SeparationOfDutiesPolicy `json:"separation_of_duties"`
+		ExternalSharing         *models.ExternalSharingPolicy    `json:"external_sharing"`
+		TrustedClients          *models.TrustedClientPolicy      `json:"trusted_clients"`
+		ClientTokenLimits       *models.ClientTokenLimits        `json:"client_token_limits"`
+		Login                   *models.LoginPolicy              `json:"login"`
+		Branding                *models.Branding                 `json:"branding"`
+		TokenClaims             *models.TokenClaims              `json:"token_claims"`
+		AccessLogRetentionDays  *int                             `json:"resource_access_log_retention_days"`
+	}
+	if err := json.Unmarshal([]byte(settings), &known); err != nil {
+		return "settings must be a JSON object with valid known keys"
+	}
+	if known.TokenLifetimes != nil {
+		if err := validateTokenLifetimes(known.TokenLifetimes); err != nil {
+			return "Invalid token_lifetimes: " + err.Error()
+		}
+	}
+	if r := known.AuthzDecisionSampleRate; r != nil && (*r < 0 || *r > 1) {
+		return "authz_decision_sample_rate must be between 0 and 1"
+	}
+	if d := known.AccessLogRetentionDays; d != nil && (*d < 1 || *d > maxAccessLogRetentionDays) {
+		return "resource_access_log_retention_days must be between 1 and " + strconv.Itoa(maxAccessLogRetentionDays)
+	}
+	if known.Registration != nil {
+		if err := validateRegistrationPolicy(known.Registration); err != nil {
+			return "Invalid registration: " + err.Error()
+		}
+	}
+	if known.Username != nil {
+		if err := validateUsernamePolicy(known.Username); err != nil {
+			return "Invalid username: " + err.Error()
+		}
+	}
+	if known.Attachments != nil {
+		if err := validateAttachmentPolicy(known.Attachments); err != nil {
+			return "Invalid attachments: " + err.Error()
+		}
+	}
+	if known.Session != nil {
+		if err := validateSessionPolicy(known.Session); err != nil {
+			return "Invalid session: " + err.Error()
+		}
+	}
+	if known.Inactivity != nil {
+		if err := validateInactivityPolicy(known.Inactivity); err != nil {
+			return "Invalid inactivity: " + err.Error()
+		}
+	}
+	if known.SeparationOfDuties != nil {
+		if err := validateSeparationOfDutiesPolicy(known.SeparationOfDuties); err != nil {
+			return "Invalid separation_of_duties: " + err.Error()
+		}
+	}
+	if known.ExternalSharing != nil {
+		if err := validateExternalSharingPolicy(known.ExternalSharing); err != nil {
+			return "Invalid external_sharing: " + err.Error()
+		}
+	}
+	if known.ClientTokenLimits != nil {
+		if err := validateClientTokenLimits(known.ClientTokenLimits); err != nil {
+			return "Invalid client_token_limits: " + err.Error()
+		}
+	}
+	if known.Login != nil {
+		if err := validateLoginPolicy(known.Login); err != nil {
+			return "Invalid login: " + err.Error()
+		}
+	}
+	if known.Branding != nil {
+		if err := validateBranding(known.Branding); err != nil {
+			return "Invalid branding: " + err.Error()
+		}
+	}
+	if known.TokenClaims != nil {
+		if err := validateClaimRules(known.TokenClaims.Claims); err != nil {
+			return "Invalid token_claims: " + err.Error()
+		}
+	}
+	return ""
+}
+
+// GetUserAttributeSchema
+//
+//	@Summary      Get user attribute schema
+//	@Description  Retrieve the admin-defined schema that user attributes in this organization are validated against
+//	@Tags         Organization Management
+//	@Produce      json
+//	@Param        id  path  string  true  "Organization ID"
+//	@Success      200  {object}  SuccessResponse  "Schema retrieved"
+//	@Failure      400  {object}  ErrorResponse    "Invalid organization ID"
+//	@Failure      404  {object}  ErrorResponse    "Organization not found"
+//	@Failure      500  {object}  ErrorResponse    "Internal server error"
+//	@Security     BearerAuth
+//	@Router       /organizations/{id}/user-attribute-schema [get]
+func (h *OrganizationHandler) GetUserAttributeSchema(c *fiber.Ctx) error {
+	orgID := c.Params("id")
+	if orgID == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Organization ID required")
+	}
+	schema, err := h.queries.Organization.GetUserAttributeSchema(orgID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization not found")
+		}
+		h.logger.Error("Get user attribute schema failed: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to get user attribute schema")
+	}
+	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "User attribute schema retrieved", Data: fiber.Map{"organization_id": orgID, "schema": schema}})
+}
+
+// UpdateUserAttributeSchema
+//
+//	@Summary      Update user attribute schema
+//	@Description  Define the schema user attributes in this organization must satisfy. Send a null schema to remove it.
+//	@Tags         Organization Management
+//	@Accept       json
+//	@Produce      json
+//	@Param        id       path    string                  true  "Organization ID"
+//	@Param        request  body    models.AttributeSchema  true  "Attribute schema"
+//	@Success      200  {object}  SuccessResponse  "Schema updated"
+//	@Failure      400  {object}  ErrorResponse    "Invalid request"
+//	@Failure      404  {object}  ErrorResponse    "Organization not found"
+//	@Failure      500  {object}  ErrorResponse    "Internal server error"
+//	@Security     BearerAuth
+//	@Router       /organizations/{id}/user-attribute-schema [put]
+func (h *OrganizationHandler) UpdateUserAttributeSchema(c *fiber.Ctx) error {
+	orgID := c.Params("id")
+	if orgID == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Organization ID required")
+	}
+	var schema *models.AttributeSchema
+	if err := json.Unmarshal(c.Body(), &schema); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
+	}
+	if schema != nil {
+		for name, def := range schema.Properties {
+			switch def.Type {
+			case "", "any", "string", "number", "integer", "boolean", "array", "object":
+			default:
+				return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Unsupported type for attribute "+name+": "+def.Type)
+			}
+		}
+	}
+	if err := h.queries.Organization.UpdateUserAttributeSchema(orgID, schema); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization not found")
+		}
+		h.logger.Error("Update user attribute schema failed: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update user attribute schema")
+	}
+	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "User attribute schema updated", Data: fiber.Map{"organization_id": orgID, "schema": schema}})
+}
+
 // GetGlobalSettings
 //
 //	@Summary      Get global settings
@@ -495,11 +750,7 @@ func (h *OrganizationHandler) GetGlobalSettings(c *fiber.Ctx) error {
 	settings, err := h.queries.GlobalSettings.GetGlobalSettings()
 	if err != nil {
 		h.logger.Error("Failed to get global settings: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to retrieve global settings",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve global settings")
 	}
 
 	return c.JSON(SuccessResponse{
@@ -512,7 +763,7 @@ func (h *OrganizationHandler) GetGlobalSettings(c *fiber.Ctx) error {
 // UpdateGlobalSettings
 //
 //	@Summary      Update global settings
-//	@Description  Update system-wide global settings
+//	@Description  Update system-wide global settings. Every replica applies them within seconds.
 //	@Tags         System Administration
 //	@Accept       json
 //	@Produce      json
@@ -525,21 +776,19 @@ func (h *OrganizationHandler) GetGlobalSettings(c *fiber.Ctx) error {
 func (h *OrganizationHandler) UpdateGlobalSettings(c *fiber.Ctx) error {
 	var settingsUpdate models.GlobalSettings
 	if err := c.BodyParser(&settingsUpdate); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "invalid_request",
-			Message: "Invalid request body",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
 	}
 
-	updatedSettings, err := h.queries.GlobalSettings.UpdateGlobalSettings(settingsUpdate)
+	var updatedSettings *models.GlobalSettings
+	var err error
+	if h.settings != nil {
+		updatedSettings, err = h.settings.Update(c.Context(), settingsUpdate)
+	} else {
+		updatedSettings, err = h.queries.GlobalSettings.UpdateGlobalSettings(settingsUpdate)
+	}
 	if err != nil {
 		h.logger.Error("Failed to update global settings: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to update global settings",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update global settings")
 	}
 
 	return c.JSON(SuccessResponse{
@@ -565,18 +814,18 @@ func (h *OrganizationHandler) UpdateGlobalSettings(c *fiber.Ctx) error {
 func (h *OrganizationHandler) GetOrganizationOrigins(c *fiber.Ctx) error {
 	orgID := c.Params("id")
 	if orgID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_id", Message: "Organization ID required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Organization ID required")
 	}
 	if h.cors == nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "CORS middleware not configured"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "CORS middleware not configured")
 	}
 	origins, err := h.cors.GetOrganizationOrigins(c.Context(), orgID)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "organization_not_found", Message: "Organization not found"})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization not found")
 		}
 		h.logger.Error("Get org origins failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to get origins"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to get origins")
 	}
 	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Origins retrieved", Data: fiber.Map{"organization_id": orgID, "allowed_origins": origins}})
 }
@@ -603,31 +852,31 @@ type updateOriginsRequest struct {
 func (h *OrganizationHandler) UpdateOrganizationOrigins(c *fiber.Ctx) error {
 	orgID := c.Params("id")
 	if orgID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_id", Message: "Organization ID required"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Organization ID required")
 	}
 	if h.cors == nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "CORS middleware not configured"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "CORS middleware not configured")
 	}
 	var req updateOriginsRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "invalid_request_body", Message: "Failed to parse request body"})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
 	}
 	// Validate origins — must be valid URLs (scheme + host).
 	for _, o := range req.AllowedOrigins {
 		o = strings.TrimSpace(o)
 		if o == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "validation_failed", Message: "Empty origin is not allowed"})
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Empty origin is not allowed")
 		}
 		if !strings.HasPrefix(o, "http://") && !strings.HasPrefix(o, "https://") {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Status: fiber.StatusBadRequest, Error: "validation_failed", Message: "Origin must start with http:// or https://: " + o})
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Origin must start with http:// or https://: "+o)
 		}
 	}
 	if err := h.cors.UpdateOrganizationOrigins(c.Context(), orgID, req.AllowedOrigins); err != nil {
 		if strings.Contains(err.Error(), "not found") {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Status: fiber.StatusNotFound, Error: "organization_not_found", Message: "Organization not found"})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization not found")
 		}
 		h.logger.Error("Update org origins failed: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Status: fiber.StatusInternalServerError, Error: "internal_server_error", Message: "Failed to update origins"})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update origins")
 	}
 	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Origins updated — changes take effect immediately", Data: fiber.Map{"organization_id": orgID, "allowed_origins": req.AllowedOrigins}})
 }
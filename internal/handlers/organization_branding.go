@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/internal/storage"
+)
+
+// MaxBrandingLogoBytes is the largest logo an organization can upload
+const MaxBrandingLogoBytes = 512 << 10
+
+const maxBrandingProductName = 100
+
+// brandingLogoTypes are the image types a logo may be uploaded as. SVG is
+// left out as it can carry scripts.
+var brandingLogoTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+var hexColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// SetBrandingStore injects the storage backend uploaded logos are kept in
+// and the public base URL they are served from
+func (h *OrganizationHandler) SetBrandingStore(store storage.Backend, baseURL string) {
+	h.store = store
+	h.baseURL = strings.TrimSuffix(baseURL, "/")
+}
+
+// validateBranding checks the branding settings of an organization
+func validateBranding(b *models.Branding) error {
+	if len(b.ProductName) > maxBrandingProductName {
+		return fmt.Errorf("product_name must be at most %d characters", maxBrandingProductName)
+	}
+	for _, color := range []struct{ name, value string }{
+		{"primary_color", b.PrimaryColor}, {"accent_color", b.AccentColor}, {"background_color", b.BackgroundColor},
+	} {
+		if color.value != "" && !hexColor.MatchString(color.value) {
+			return fmt.Errorf("%s must be a hex color such as #1a73e8", color.name)
+		}
+	}
+	for _, link := range []struct{ name, value string }{
+		{"logo_url", b.LogoURL}, {"support_url", b.SupportURL}, {"privacy_policy_url", b.PrivacyPolicyURL}, {"terms_url", b.TermsURL},
+	} {
+		if link.value == "" {
+			continue
+		}
+		u, err := url.Parse(link.value)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("%s must be an http(s) URL", link.name)
+		}
+	}
+	if b.SupportEmail != "" && (!strings.Contains(b.SupportEmail, "@") || strings.ContainsAny(b.SupportEmail, " <>")) {
+		return fmt.Errorf("support_email must be an email address")
+	}
+	return nil
+}
+
+// brandingLogoKey is the storage key of an organization's uploaded logo
+func brandingLogoKey(orgID string) string {
+	return "branding/" + orgID + "/logo"
+}
+
+// GetPublicBranding returns the branding of an organization's hosted pages
+//
+//	@Summary		Get organization branding
+//	@Description	Returns the logo, colors, product name and support links the hosted login, consent and device pages show for an organization (settings.branding); fields it did not set are omitted. Cached publicly for five minutes.
+//	@Tags			Organization Management
+//	@Produce		json
+//	@Param			org	query		string			true	"Organization slug"
+//	@Success		200	{object}	SuccessResponse	"Branding"
+//	@Success		304	"Not modified"
+//	@Failure		400	{object}	ErrorResponse	"org is required"
+//	@Failure		404	{object}	ErrorResponse	"Organization not found"
+//	@Failure		500	{object}	ErrorResponse	"Internal server error"
+//	@Router			/public/branding [get]
+func (h *OrganizationHandler) GetPublicBranding(c *fiber.Ctx) error {
+	slug := strings.TrimSpace(c.Query("org"))
+	if slug == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "org is required")
+	}
+	org, err := publicOrganization(h.queries.Organization, slug)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization not found")
+		}
+		h.logger.Error("Failed to get organization %s: %v", slug, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve branding")
+	}
+	branding, err := h.queries.Organization.GetBranding(org.ID)
+	if err != nil {
+		h.logger.Error("Failed to read branding of organization %s: %v", org.ID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve branding")
+	}
+	if branding == nil {
+		branding = &models.Branding{}
+	}
+	return conditionalJSON(c, SuccessResponse{Status: fiber.StatusOK, Message: "Branding retrieved", Data: fiber.Map{
+		"organization": fiber.Map{"slug": org.Slug, "name": org.Name},
+		"branding":     branding,
+	}}, cacheBranding)
+}
+
+// GetBrandingLogo serves an organization's uploaded logo
+//
+//	@Summary		Get organization logo
+//	@Description	Serves the logo uploaded for an organization's hosted pages. Cached publicly for five minutes.
+//	@Tags			Organization Management
+//	@Produce		png
+//	@Param			org	query		string	true	"Organization slug"
+//	@Success		200	{file}		file	"The logo"
+//	@Failure		404	{object}	ErrorResponse	"No logo uploaded"
+//	@Failure		500	{object}	ErrorResponse	"Internal server error"
+//	@Router			/public/branding/logo [get]
+func (h *OrganizationHandler) GetBrandingLogo(c *fiber.Ctx) error {
+	if h.store == nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "No logo uploaded")
+	}
+	org, err := publicOrganization(h.queries.Organization, strings.TrimSpace(c.Query("org")))
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "No logo uploaded")
+		}
+		h.logger.Error("Failed to get organization: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to load logo")
+	}
+	r, err := h.store.Open(c.UserContext(), brandingLogoKey(org.ID))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "No logo uploaded")
+		}
+		h.logger.Error("open logo of organization %s: %v", org.ID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to load logo")
+	}
+	defer r.Close()
+	logo, err := io.ReadAll(io.LimitReader(r, MaxBrandingLogoBytes+1))
+	if err != nil {
+		h.logger.Error("read logo of organization %s: %v", org.ID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to load logo")
+	}
+
+	// Only image types are accepted on upload; anything else is not served
+	contentType := sniffContentType(logo)
+	if !brandingLogoTypes[contentType] {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "No logo uploaded")
+	}
+	if notModified(c, bodyETag(logo), time.Time{}, cacheBranding) {
+		return nil
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	return c.Send(logo)
+}
+
+// UploadBrandingLogo stores the logo of an organization's hosted pages
+//
+//	@Summary		Upload organization logo
+//	@Description	Uploads a PNG, JPEG, GIF or WebP logo of at most 512 KiB, recognized by its content rather than its declared type, and points settings.branding.logo_url at it.
+//	@Tags			Organization Management
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			id		path		string			true	"Organization ID"
+//	@Param			file	formData	file			true	"Logo image"
+//	@Success		200		{object}	SuccessResponse	"Logo uploaded"
+//	@Failure		400		{object}	ErrorResponse	"Missing file"
+//	@Failure		404		{object}	ErrorResponse	"Organization not found"
+//	@Failure		413		{object}	ErrorResponse	"Logo too large"
+//	@Failure		415		{object}	ErrorResponse	"Not a supported image"
+//	@Failure		500		{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/organizations/{id}/branding/logo [put]
+func (h *OrganizationHandler) UploadBrandingLogo(c *fiber.Ctx) error {
+	orgID := c.Params("id")
+	if h.store == nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Logo uploads are not enabled")
+	}
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Multipart field file is required")
+	}
+	if fh.Size > MaxBrandingLogoBytes {
+		return apiError(c, fiber.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, "Logo is too large",
+			fiber.Map{"max_bytes": MaxBrandingLogoBytes})
+	}
+	file, err := fh.Open()
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to read the uploaded file")
+	}
+	defer file.Close()
+	logo, err := io.ReadAll(io.LimitReader(file, MaxBrandingLogoBytes+1))
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to read the uploaded file")
+	}
+	if len(logo) > MaxBrandingLogoBytes {
+		return apiError(c, fiber.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, "Logo is too large",
+			fiber.Map{"max_bytes": MaxBrandingLogoBytes})
+	}
+	if contentType := sniffContentType(logo); !brandingLogoTypes[contentType] {
+		return apiError(c, fiber.StatusUnsupportedMediaType, apierror.CodeValidationFailed, "Logos must be PNG, JPEG, GIF or WebP images")
+	}
+
+	org, err := h.queries.Organization.GetOrganization(orgID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization not found")
+		}
+		h.logger.Error("Failed to get organization %s: %v", orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to upload logo")
+	}
+	if err := h.store.Put(c.UserContext(), brandingLogoKey(orgID), bytes.NewReader(logo)); err != nil {
+		h.logger.Error("store logo of organization %s: %v", orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to upload logo")
+	}
+
+	// The version parameter makes caches fetch a replaced logo at once
+	sum := sha256.Sum256(logo)
+	logoURL := h.baseURL + "/api/v1/public/branding/logo?org=" + url.QueryEscape(org.Slug) + "&v=" + hex.EncodeToString(sum[:6])
+	var settings map[string]interface{}
+	if err := json.Unmarshal([]byte(org.Settings), &settings); err != nil || settings == nil {
+		settings = map[string]interface{}{}
+	}
+	branding, _ := settings["branding"].(map[string]interface{})
+	if branding == nil {
+		branding = map[string]interface{}{}
+	}
+	before := branding["logo_url"]
+	branding["logo_url"] = logoURL
+	settings["branding"] = branding
+	updated, _ := json.Marshal(settings)
+	if err := h.queries.Organization.UpdateOrganizationSettings(orgID, string(updated)); err != nil {
+		h.logger.Error("Failed to update branding of organization %s: %v", orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to upload logo")
+	}
+	auditChange(c, h.audit, orgID, "update_organization_branding_logo", "organization_settings", orgID,
+		fiber.Map{"logo_url": before}, fiber.Map{"logo_url": logoURL})
+	return apiSuccess(c, fiber.StatusOK, "Logo uploaded", fiber.Map{"logo_url": logoURL})
+}
+
+// brandingReference is the branding of an organization as included in the
+// client info and device responses of the hosted pages, with the URL to
+// fetch it from; nil when it cannot be read
+func brandingReference(orgs queries.OrganizationQueries, orgID, baseURL string) fiber.Map {
+	org, err := orgs.GetOrganization(orgID)
+	if err != nil {
+		return nil
+	}
+	branding, err := orgs.GetBranding(orgID)
+	if err != nil {
+		return nil
+	}
+	if branding == nil {
+		branding = &models.Branding{}
+	}
+	return fiber.Map{
+		"organization": fiber.Map{"slug": org.Slug, "name": org.Name},
+		"branding":     branding,
+		"branding_url": strings.TrimSuffix(baseURL, "/") + "/api/v1/public/branding?org=" + url.QueryEscape(org.Slug),
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+)
+
+// ClaimsWebhookRequest is the body of PUT /organizations/{id}/claims-webhook.
+// Omitted fields keep their value, or take their default on creation.
+type ClaimsWebhookRequest struct {
+	URL          *string `json:"url,omitempty"`
+	Namespace    *string `json:"namespace,omitempty"`
+	TimeoutMS    *int    `json:"timeout_ms,omitempty"`    // default 1500
+	CacheSeconds *int    `json:"cache_seconds,omitempty"` // default 0
+	FailClosed   *bool   `json:"fail_closed,omitempty"`   // default false
+	Enabled      *bool   `json:"enabled,omitempty"`       // default true
+	// RotateSecret replaces the signing secret; a new webhook always gets one
+	RotateSecret bool `json:"rotate_secret,omitempty"`
+}
+
+// ClaimsWebhookResult is a claims webhook as returned to admins. Secret is
+// only set when it was just generated.
+type ClaimsWebhookResult struct {
+	*models.ClaimsWebhook
+	Secret string `json:"secret,omitempty"`
+	// ServerEnabled is false when the server turned all claims webhooks off
+	ServerEnabled bool `json:"server_enabled"`
+}
+
+// SetClaimsWebhooks tells whether the server calls claims webhooks at all
+func (h *OrganizationHandler) SetClaimsWebhooks(enabled bool) {
+	h.claimsWebhooks = enabled
+}
+
+// GetClaimsWebhook returns the claims webhook of an organization
+//
+//	@Summary		Get claims webhook
+//	@Description	Returns the organization's external claims provider, with the last error of its calls. The signing secret is never returned.
+//	@Tags			Organization Management
+//	@Produce		json
+//	@Param			id	path		string										true	"Organization ID"
+//	@Success		200	{object}	SuccessResponse{data=ClaimsWebhookResult}	"Claims webhook"
+//	@Failure		404	{object}	ErrorResponse								"No claims webhook"
+//	@Failure		500	{object}	ErrorResponse								"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/organizations/{id}/claims-webhook [get]
+func (h *OrganizationHandler) GetClaimsWebhook(c *fiber.Ctx) error {
+	hook, err := h.claimsWebhook(c)
+	if hook == nil {
+		return err
+	}
+	return apiSuccess(c, fiber.StatusOK, "Claims webhook retrieved successfully",
+		ClaimsWebhookResult{ClaimsWebhook: hook, ServerEnabled: h.claimsWebhooks})
+}
+
+// PutClaimsWebhook creates or changes the claims webhook of an organization
+//
+//	@Summary		Set claims webhook
+//	@Description	Registers an HTTPS endpoint called whenever tokens are issued to the organization's OIDC clients. It receives a signed POST (X-Monkeys-Signature, as for security rule webhooks) with the user, client, grant type and scope, and answers {"access_token": {...}, "id_token": {...}} with the claims to add, every one named under namespace. Claims mapped with token_claims keep their value. The call is abandoned after timeout_ms (100-3000); answers can be reused for cache_seconds (0-3600) per user, client and scope. When the webhook fails, tokens are issued without its claims, or refused with fail_closed. The signing secret is generated on creation and with rotate_secret, and only returned then.
+//	@Tags			Organization Management
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string										true	"Organization ID"
+//	@Param			request	body		ClaimsWebhookRequest						true	"Claims webhook"
+//	@Success		200		{object}	SuccessResponse{data=ClaimsWebhookResult}	"Claims webhook saved"
+//	@Failure		400		{object}	ErrorResponse								"Invalid claims webhook"
+//	@Failure		500		{object}	ErrorResponse								"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/organizations/{id}/claims-webhook [put]
+func (h *OrganizationHandler) PutClaimsWebhook(c *fiber.Ctx) error {
+	orgID := c.Params("id")
+	var req ClaimsWebhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+	}
+
+	q := h.queries.ClaimsWebhook.WithContext(c.Context())
+	before, err := q.GetWebhook(orgID)
+	if err != nil {
+		h.logger.Error("Failed to get claims webhook of organization %s: %v", orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to save claims webhook")
+	}
+	hook := &models.ClaimsWebhook{OrganizationID: orgID, TimeoutMS: 1500, Enabled: true}
+	if before != nil {
+		copied := *before
+		hook = &copied
+	} else if userID, ok := c.Locals("user_id").(string); ok && userID != "" {
+		hook.CreatedBy = &userID
+	}
+	if req.URL != nil {
+		hook.URL = strings.TrimSpace(*req.URL)
+	}
+	if req.Namespace != nil {
+		hook.Namespace = strings.TrimSpace(*req.Namespace)
+	}
+	if req.TimeoutMS != nil {
+		hook.TimeoutMS = *req.TimeoutMS
+	}
+	if req.CacheSeconds != nil {
+		hook.CacheSeconds = *req.CacheSeconds
+	}
+	if req.FailClosed != nil {
+		hook.FailClosed = *req.FailClosed
+	}
+	if req.Enabled != nil {
+		hook.Enabled = *req.Enabled
+	}
+	if err := services.ValidateClaimsWebhook(hook); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, err.Error())
+	}
+
+	var secret string
+	if before == nil || req.RotateSecret {
+		secret = generateClientSecret()
+		hook.Secret = secret
+	}
+	if err := q.PutWebhook(hook); err != nil {
+		h.logger.Error("Failed to save claims webhook of organization %s: %v", orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to save claims webhook")
+	}
+
+	action := "update_claims_webhook"
+	if before == nil {
+		action = "create_claims_webhook"
+	}
+	auditChange(c, h.audit, orgID, action, "claims_webhook", orgID, before, hook)
+	return apiSuccess(c, fiber.StatusOK, "Claims webhook saved successfully",
+		ClaimsWebhookResult{ClaimsWebhook: hook, Secret: secret, ServerEnabled: h.claimsWebhooks})
+}
+
+// DeleteClaimsWebhook removes the claims webhook of an organization
+//
+//	@Summary		Delete claims webhook
+//	@Description	Stops calling the organization's claims webhook and forgets its configuration and secret. Set enabled to false instead to pause it.
+//	@Tags			Organization Management
+//	@Produce		json
+//	@Param			id	path		string			true	"Organization ID"
+//	@Success		200	{object}	SuccessResponse	"Claims webhook deleted"
+//	@Failure		404	{object}	ErrorResponse	"No claims webhook"
+//	@Failure		500	{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/organizations/{id}/claims-webhook [delete]
+func (h *OrganizationHandler) DeleteClaimsWebhook(c *fiber.Ctx) error {
+	hook, err := h.claimsWebhook(c)
+	if hook == nil {
+		return err
+	}
+	if err := h.queries.ClaimsWebhook.WithContext(c.Context()).DeleteWebhook(hook.OrganizationID); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization has no claims webhook")
+		}
+		h.logger.Error("Failed to delete claims webhook of organization %s: %v", hook.OrganizationID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to delete claims webhook")
+	}
+	auditChange(c, h.audit, hook.OrganizationID, "delete_claims_webhook", "claims_webhook", hook.OrganizationID, hook, nil)
+	return apiSuccess(c, fiber.StatusOK, "Claims webhook deleted successfully", nil)
+}
+
+// TestClaimsWebhook calls the claims webhook of an organization for the
+// caller
+//
+//	@Summary		Test claims webhook
+//	@Description	Calls the organization's claims webhook as if a token were issued to the caller, with "test": true in the request, and returns the validated claims or why they were refused. Disabled webhooks can be tested; the cache and last_error are left alone.
+//	@Tags			Organization Management
+//	@Produce		json
+//	@Param			id	path		string													true	"Organization ID"
+//	@Success		200	{object}	SuccessResponse{data=services.ClaimsWebhookResponse}	"Claims answered"
+//	@Failure		404	{object}	ErrorResponse											"No claims webhook"
+//	@Failure		409	{object}	ErrorResponse											"Claims webhooks are turned off on this server"
+//	@Failure		502	{object}	ErrorResponse											"The webhook failed"
+//	@Security		BearerAuth
+//	@Router			/organizations/{id}/claims-webhook/test [post]
+func (h *OrganizationHandler) TestClaimsWebhook(c *fiber.Ctx) error {
+	if !h.claimsWebhooks {
+		return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "Claims webhooks are turned off on this server")
+	}
+	hook, err := h.claimsWebhook(c)
+	if hook == nil {
+		return err
+	}
+	userID, _ := c.Locals("user_id").(string)
+	user, err := h.queries.User.WithContext(c.Context()).GetUser(userID, hook.OrganizationID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Only users of the organization can test its claims webhook")
+		}
+		h.logger.Error("Failed to get user %s to test claims webhook: %v", userID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to test claims webhook")
+	}
+
+	req := services.NewClaimsWebhookRequest(user, "", "test", "openid")
+	req.Test = true
+	answer, err := services.CallClaimsWebhook(c.Context(), hook, req)
+	if err != nil {
+		return apiError(c, fiber.StatusBadGateway, apierror.CodeUpstreamError, "The claims webhook failed", err.Error())
+	}
+	return apiSuccess(c, fiber.StatusOK, "Claims webhook answered", answer)
+}
+
+// claimsWebhook returns the claims webhook of the organization in the path,
+// answering 404 when it has none
+func (h *OrganizationHandler) claimsWebhook(c *fiber.Ctx) (*models.ClaimsWebhook, error) {
+	orgID := c.Params("id")
+	hook, err := h.queries.ClaimsWebhook.WithContext(c.Context()).GetWebhook(orgID)
+	if err != nil {
+		h.logger.Error("Failed to get claims webhook of organization %s: %v", orgID, err)
+		return nil, apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve claims webhook")
+	}
+	if hook == nil {
+		return nil, apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization has no claims webhook")
+	}
+	return hook, nil
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/middleware"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+	"github.com/the-monkeys/monkeys-identity/internal/storage"
+)
+
+// maxDeletionReason bounds the reason recorded for an organization deletion
+const maxDeletionReason = 500
+
+// DeleteOrganizationRequest is the optional body of DELETE /organizations/{id}
+type DeleteOrganizationRequest struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+// SetDeletions injects the service that schedules and carries out
+// organization deletions. Called from route setup.
+func (h *OrganizationHandler) SetDeletions(deletions services.OrganizationDeletionService) {
+	h.deletions = deletions
+}
+
+// DeleteOrganization schedules the deletion of an organization
+// DeleteOrganization
+//
+//	@Summary      Delete organization
+//	@Description  Schedules the deletion of an organization after the ORG_DELETION_GRACE_DAYS grace period. The organization is suspended right away: its users and service accounts can no longer sign in, their sessions are revoked and their tokens refused with organization_disabled. A final data export is built in the background for root users to download. When the grace period has passed the organization and its users, service accounts, API keys, OAuth clients, content, resources, groups, roles and policies are soft-deleted. Root users can cancel until then. The system organization cannot be deleted.
+//	@Tags         Organization Management
+//	@Accept       json
+//	@Produce      json
+//	@Param        id       path  string                     true   "Organization ID"
+//	@Param        request  body  DeleteOrganizationRequest  false  "Reason for the deletion"
+//	@Success      202  {object}  SuccessResponse  "Deletion scheduled"
+//	@Failure      400  {object}  ErrorResponse    "Invalid organization ID or reason"
+//	@Failure      403  {object}  ErrorResponse    "The system organization cannot be deleted"
+//	@Failure      404  {object}  ErrorResponse    "Organization not found"
+//	@Failure      409  {object}  ErrorResponse    "Deletion already scheduled"
+//	@Failure      500  {object}  ErrorResponse    "Internal server error"
+//	@Security     BearerAuth
+//	@Router       /organizations/{id} [delete]
+func (h *OrganizationHandler) DeleteOrganization(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Organization ID required")
+	}
+	if tc := middleware.GetTenantContext(c); tc != nil && tc.IsRoot && tc.OrganizationID == id {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "The system organization cannot be deleted")
+	}
+
+	var req DeleteOrganizationRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
+		}
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) > maxDeletionReason {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "reason must be at most 500 characters")
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	deletion, err := h.deletions.Schedule(c.Context(), id, userID, req.Reason)
+	if err != nil {
+		if isConflictErr(err) {
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "Organization deletion is already scheduled")
+		}
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization not found")
+		}
+		h.logger.Error("Schedule deletion of organization %s failed: %v", id, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to delete organization")
+	}
+	h.logger.Info("User %s scheduled deletion of organization %s for %s", userID, id, deletion.ScheduledFor)
+	return apiSuccess(c, fiber.StatusAccepted, "Organization deletion scheduled", deletion)
+}
+
+// GetOrganizationDeletion
+//
+//	@Summary      Get organization deletion
+//	@Description  Returns the scheduled, cancelled or completed deletion of an organization, including the state of its final data export.
+//	@Tags         Organization Management
+//	@Produce      json
+//	@Param        id  path  string  true  "Organization ID"
+//	@Success      200  {object}  SuccessResponse  "Organization deletion"
+//	@Failure      404  {object}  ErrorResponse    "No deletion was scheduled"
+//	@Failure      500  {object}  ErrorResponse    "Internal server error"
+//	@Security     BearerAuth
+//	@Router       /organizations/{id}/deletion [get]
+func (h *OrganizationHandler) GetOrganizationDeletion(c *fiber.Ctx) error {
+	deletion, err := h.deletions.Get(c.Context(), c.Params("id"))
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "No deletion was scheduled for this organization")
+		}
+		h.logger.Error("Get deletion of organization %s failed: %v", c.Params("id"), err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to get organization deletion")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Organization deletion retrieved", deletion)
+}
+
+// CancelOrganizationDeletion
+//
+//	@Summary      Cancel organization deletion
+//	@Description  Root users only. Cancels a scheduled deletion before its deadline: the organization gets back the status it had, sign-ins are allowed again and the final export is discarded. Sessions revoked when the deletion was scheduled stay revoked.
+//	@Tags         Organization Management
+//	@Produce      json
+//	@Param        id  path  string  true  "Organization ID"
+//	@Success      200  {object}  SuccessResponse  "Deletion cancelled"
+//	@Failure      403  {object}  ErrorResponse    "Caller is not a root user"
+//	@Failure      404  {object}  ErrorResponse    "No deletion is scheduled"
+//	@Failure      500  {object}  ErrorResponse    "Internal server error"
+//	@Security     BearerAuth
+//	@Router       /organizations/{id}/deletion [delete]
+func (h *OrganizationHandler) CancelOrganizationDeletion(c *fiber.Ctx) error {
+	id := c.Params("id")
+	rootID, _ := c.Locals("user_id").(string)
+	deletion, err := h.deletions.Cancel(c.Context(), id, rootID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "No deletion is scheduled for this organization")
+		}
+		h.logger.Error("Cancel deletion of organization %s failed: %v", id, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to cancel organization deletion")
+	}
+	h.logger.Info("Root user %s cancelled deletion of organization %s", rootID, id)
+	return apiSuccess(c, fiber.StatusOK, "Organization deletion cancelled", deletion)
+}
+
+// DownloadOrganizationDeletionExport
+//
+//	@Summary      Download final organization export
+//	@Description  Root users only. Downloads the data export built when the deletion was scheduled: a ZIP archive with one JSON file per section (organization, users, service accounts, groups, roles, policies, resources, OAuth clients, content items and audit events). Credentials are never exported. It stays available after the deletion has been carried out.
+//	@Tags         Organization Management
+//	@Produce      application/zip
+//	@Param        id  path  string  true  "Organization ID"
+//	@Success      200  {file}    file           "ZIP archive"
+//	@Failure      403  {object}  ErrorResponse  "Caller is not a root user"
+//	@Failure      404  {object}  ErrorResponse  "No deletion was scheduled"
+//	@Failure      409  {object}  ErrorResponse  "Export not built yet"
+//	@Failure      500  {object}  ErrorResponse  "Internal server error"
+//	@Security     BearerAuth
+//	@Router       /organizations/{id}/deletion/export [get]
+func (h *OrganizationHandler) DownloadOrganizationDeletionExport(c *fiber.Ctx) error {
+	id := c.Params("id")
+	r, deletion, err := h.deletions.OpenExport(c.Context(), id)
+	if err != nil {
+		if errors.Is(err, services.ErrOrganizationExportNotReady) {
+			return apiError(c, fiber.StatusConflict, apierror.CodeExportNotReady, "The final export has not been built yet")
+		}
+		if isNotFoundErr(err) || errors.Is(err, storage.ErrNotFound) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "No final export exists for this organization")
+		}
+		h.logger.Error("Open final export of organization %s failed: %v", id, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to load organization export")
+	}
+
+	size := -1
+	if deletion.ExportSize != nil {
+		size = int(*deletion.ExportSize)
+	}
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="organization-`+id+`.zip"`)
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	return c.SendStream(r, size)
+}
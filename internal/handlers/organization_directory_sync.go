@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+)
+
+// DirectorySyncRequest is the body of PUT /organizations/{id}/directory-sync.
+// Omitted fields keep their value, or take their default on creation.
+type DirectorySyncRequest struct {
+	SourceType *string `json:"source_type,omitempty"` // default scim
+	BaseURL    *string `json:"base_url,omitempty"`
+	// Token authenticates to the source; it is kept when omitted
+	Token             *string            `json:"token,omitempty"`
+	AttributeMapping  *map[string]string `json:"attribute_mapping,omitempty"`
+	SyncGroups        *bool              `json:"sync_groups,omitempty"`        // default true
+	DeactivateMissing *bool              `json:"deactivate_missing,omitempty"` // default true
+	IntervalMinutes   *int               `json:"interval_minutes,omitempty"`   // default 360
+	Enabled           *bool              `json:"enabled,omitempty"`            // default true
+}
+
+// RunDirectorySyncRequest is the body of POST
+// /organizations/{id}/directory-sync/run
+type RunDirectorySyncRequest struct {
+	DryRun bool `json:"dry_run"`
+}
+
+// SetDirectorySync injects the service running directory syncs
+func (h *OrganizationHandler) SetDirectorySync(svc services.DirectorySyncService) {
+	h.directorySync = svc
+}
+
+// GetDirectorySync returns the directory sync of an organization
+//
+//	@Summary		Get directory sync
+//	@Description	Returns the organization's directory sync: the external directory its users and group memberships are pulled from, with the attribute mapping and schedule. The source token is never returned.
+//	@Tags			Organization Management
+//	@Produce		json
+//	@Param			id	path		string										true	"Organization ID"
+//	@Success		200	{object}	SuccessResponse{data=models.DirectorySync}	"Directory sync"
+//	@Failure		404	{object}	ErrorResponse								"No directory sync"
+//	@Failure		500	{object}	ErrorResponse								"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/organizations/{id}/directory-sync [get]
+func (h *OrganizationHandler) GetDirectorySync(c *fiber.Ctx) error {
+	sync, err := h.directorySyncConfig(c)
+	if sync == nil {
+		return err
+	}
+	return apiSuccess(c, fiber.StatusOK, "Directory sync retrieved successfully", sync)
+}
+
+// PutDirectorySync creates or changes the directory sync of an organization
+//
+//	@Summary		Set directory sync
+//	@Description	Configures a scheduled pull of users and group memberships from an external directory, such as the SCIM 2.0 API of an HR system (source_type scim; LDAP is not supported). base_url is the https SCIM base, whose /Users and /Groups are read with the bearer token. Every interval_minutes (15-10080) users are matched by their directory id, then adopted by email or created; email, display name and mapped attributes follow the directory, and users it deactivates, or removes with deactivate_missing, are suspended and signed out. With sync_groups, groups are matched by id, then adopted by name or created, and their members follow the directory; only synced users are removed from groups. attribute_mapping maps username, email, display_name and attributes.<name> to dot-separated paths of the SCIM user, such as "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User.department"; unmapped fields default to userName, the primary email and displayName.
+//	@Tags			Organization Management
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string										true	"Organization ID"
+//	@Param			request	body		DirectorySyncRequest						true	"Directory sync"
+//	@Success		200		{object}	SuccessResponse{data=models.DirectorySync}	"Directory sync saved"
+//	@Failure		400		{object}	ErrorResponse								"Invalid directory sync"
+//	@Failure		500		{object}	ErrorResponse								"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/organizations/{id}/directory-sync [put]
+func (h *OrganizationHandler) PutDirectorySync(c *fiber.Ctx) error {
+	orgID := c.Params("id")
+	var req DirectorySyncRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+	}
+
+	q := h.queries.DirectorySync.WithContext(c.Context())
+	before, err := q.GetSync(orgID)
+	if err != nil {
+		h.logger.Error("Failed to get directory sync of organization %s: %v", orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to save directory sync")
+	}
+	sync := &models.DirectorySync{
+		OrganizationID:    orgID,
+		SourceType:        models.DirectorySourceSCIM,
+		AttributeMapping:  map[string]string{},
+		SyncGroups:        true,
+		DeactivateMissing: true,
+		IntervalMinutes:   360,
+		Enabled:           true,
+	}
+	if before != nil {
+		copied := *before
+		sync = &copied
+	} else if userID, ok := c.Locals("user_id").(string); ok && userID != "" {
+		sync.CreatedBy = &userID
+	}
+	if req.SourceType != nil {
+		sync.SourceType = strings.TrimSpace(*req.SourceType)
+	}
+	if req.BaseURL != nil {
+		sync.BaseURL = strings.TrimSpace(*req.BaseURL)
+	}
+	if req.Token != nil {
+		sync.Token = strings.TrimSpace(*req.Token)
+	}
+	if req.AttributeMapping != nil {
+		sync.AttributeMapping = *req.AttributeMapping
+		if sync.AttributeMapping == nil {
+			sync.AttributeMapping = map[string]string{}
+		}
+	}
+	if req.SyncGroups != nil {
+		sync.SyncGroups = *req.SyncGroups
+	}
+	if req.DeactivateMissing != nil {
+		sync.DeactivateMissing = *req.DeactivateMissing
+	}
+	if req.IntervalMinutes != nil {
+		sync.IntervalMinutes = *req.IntervalMinutes
+	}
+	if req.Enabled != nil {
+		sync.Enabled = *req.Enabled
+	}
+	if err := services.ValidateDirectorySync(sync); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, err.Error())
+	}
+
+	if err := q.PutSync(sync); err != nil {
+		h.logger.Error("Failed to save directory sync of organization %s: %v", orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to save directory sync")
+	}
+
+	action := "update_directory_sync"
+	if before == nil {
+		action = "create_directory_sync"
+	}
+	auditChange(c, h.audit, orgID, action, "directory_sync", orgID, before, sync)
+	return apiSuccess(c, fiber.StatusOK, "Directory sync saved successfully", sync)
+}
+
+// DeleteDirectorySync removes the directory sync of an organization
+//
+//	@Summary		Delete directory sync
+//	@Description	Stops syncing the organization with its directory and forgets the configuration, token and links to directory users and groups. Synced users and groups are kept. Set enabled to false instead to pause it.
+//	@Tags			Organization Management
+//	@Produce		json
+//	@Param			id	path		string			true	"Organization ID"
+//	@Success		200	{object}	SuccessResponse	"Directory sync deleted"
+//	@Failure		404	{object}	ErrorResponse	"No directory sync"
+//	@Failure		500	{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/organizations/{id}/directory-sync [delete]
+func (h *OrganizationHandler) DeleteDirectorySync(c *fiber.Ctx) error {
+	sync, err := h.directorySyncConfig(c)
+	if sync == nil {
+		return err
+	}
+	if err := h.queries.DirectorySync.WithContext(c.Context()).DeleteSync(sync.OrganizationID); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization has no directory sync")
+		}
+		h.logger.Error("Failed to delete directory sync of organization %s: %v", sync.OrganizationID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to delete directory sync")
+	}
+	auditChange(c, h.audit, sync.OrganizationID, "delete_directory_sync", "directory_sync", sync.OrganizationID, sync, nil)
+	return apiSuccess(c, fiber.StatusOK, "Directory sync deleted successfully", nil)
+}
+
+// RunDirectorySync starts a run of the directory sync of an organization
+//
+//	@Summary		Run directory sync
+//	@Description	Starts a run of the organization's directory sync now, even when it is disabled, and returns it while it runs; follow it with GET /organizations/{id}/directory-sync/runs/{run_id}. With dry_run, nothing is changed and the run reports what would be.
+//	@Tags			Organization Management
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string											true	"Organization ID"
+//	@Param			request	body		RunDirectorySyncRequest							false	"Run options"
+//	@Success		202		{object}	SuccessResponse{data=models.DirectorySyncRun}	"Run started"
+//	@Failure		404		{object}	ErrorResponse									"No directory sync"
+//	@Failure		409		{object}	ErrorResponse									"A run is already in progress"
+//	@Failure		500		{object}	ErrorResponse									"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/organizations/{id}/directory-sync/run [post]
+func (h *OrganizationHandler) RunDirectorySync(c *fiber.Ctx) error {
+	orgID := c.Params("id")
+	var req RunDirectorySyncRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+		}
+	}
+	userID, _ := c.Locals("user_id").(string)
+	run, err := h.directorySync.StartRun(c.Context(), orgID, userID, req.DryRun)
+	if err != nil {
+		if errors.Is(err, services.ErrDirectorySyncRunning) {
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "A directory sync is already running")
+		}
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization has no directory sync")
+		}
+		h.logger.Error("Failed to start directory sync of organization %s: %v", orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to start directory sync")
+	}
+	return apiSuccess(c, fiber.StatusAccepted, "Directory sync started", run)
+}
+
+// ListDirectorySyncRuns lists the latest runs of the directory sync of an
+// organization
+//
+//	@Summary		List directory sync runs
+//	@Description	Returns the latest runs of the organization's directory sync, newest first, with the number of users created, updated, deactivated and reactivated, groups created and updated, memberships added and removed, and errors. Their changes are returned by GET /organizations/{id}/directory-sync/runs/{run_id}.
+//	@Tags			Organization Management
+//	@Produce		json
+//	@Param			id		path		string	true	"Organization ID"
+//	@Param			limit	query		int		false	"Runs to return (1-100, default 20)"
+//	@Success		200		{object}	SuccessResponse{data=object{items=[]models.DirectorySyncRun,count=int}}	"Runs"
+//	@Failure		400		{object}	ErrorResponse															"Invalid limit"
+//	@Failure		500		{object}	ErrorResponse															"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/organizations/{id}/directory-sync/runs [get]
+func (h *OrganizationHandler) ListDirectorySyncRuns(c *fiber.Ctx) error {
+	orgID := c.Params("id")
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Limit must be between 1 and 100")
+	}
+	runs, err := h.queries.DirectorySync.WithContext(c.Context()).ListRuns(orgID, limit)
+	if err != nil {
+		h.logger.Error("Failed to list directory sync runs of organization %s: %v", orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list directory sync runs")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Directory sync runs retrieved successfully", fiber.Map{
+		"items": runs, "count": len(runs),
+	})
+}
+
+// GetDirectorySyncRun returns a run of the directory sync of an organization
+//
+//	@Summary		Get directory sync run
+//	@Description	Returns a run of the organization's directory sync with its summary and up to 1000 of its changes: each user created, updated, deactivated or reactivated, group created or renamed, membership added or removed, and error.
+//	@Tags			Organization Management
+//	@Produce		json
+//	@Param			id		path		string											true	"Organization ID"
+//	@Param			run_id	path		string											true	"Run ID"
+//	@Success		200		{object}	SuccessResponse{data=models.DirectorySyncRun}	"Run"
+//	@Failure		404		{object}	ErrorResponse									"Run not found"
+//	@Failure		500		{object}	ErrorResponse									"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/organizations/{id}/directory-sync/runs/{run_id} [get]
+func (h *OrganizationHandler) GetDirectorySyncRun(c *fiber.Ctx) error {
+	orgID := c.Params("id")
+	run, err := h.queries.DirectorySync.WithContext(c.Context()).GetRun(c.Params("run_id"), orgID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Directory sync run not found")
+		}
+		h.logger.Error("Failed to get directory sync run %s: %v", c.Params("run_id"), err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve directory sync run")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Directory sync run retrieved successfully", run)
+}
+
+// directorySyncConfig returns the directory sync of the organization in the
+// path, answering 404 when it has none
+func (h *OrganizationHandler) directorySyncConfig(c *fiber.Ctx) (*models.DirectorySync, error) {
+	orgID := c.Params("id")
+	sync, err := h.queries.DirectorySync.WithContext(c.Context()).GetSync(orgID)
+	if err != nil {
+		h.logger.Error("Failed to get directory sync of organization %s: %v", orgID, err)
+		return nil, apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve directory sync")
+	}
+	if sync == nil {
+		return nil, apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization has no directory sync")
+	}
+	return sync, nil
+}
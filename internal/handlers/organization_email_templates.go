@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+)
+
+// EmailTemplateRequest is the body of PUT /organizations/{id}/email-templates/{kind},
+// and optionally of its preview and test endpoints
+type EmailTemplateRequest struct {
+	Subject  string `json:"subject"`
+	HTMLBody string `json:"html_body"`
+	TextBody string `json:"text_body"`
+}
+
+// EmailTemplateSummary is an entry of the list of an organization's email
+// templates
+type EmailTemplateSummary struct {
+	Kind       string   `json:"kind"`
+	Variables  []string `json:"variables"`
+	Customized bool     `json:"customized"`
+	// Version and UpdatedAt are those of the current version when the
+	// organization customized the kind
+	Version   int        `json:"version,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// SetEmail wires the email service used to preview and test templates
+func (h *OrganizationHandler) SetEmail(email services.EmailService) {
+	h.email = email
+}
+
+// emailTemplateKind returns the kind named by the path, answering 404 for
+// kinds organizations cannot customize
+func emailTemplateKind(c *fiber.Ctx) (string, error) {
+	kind := c.Params("kind")
+	if _, ok := services.EmailTemplateVariables[kind]; !ok {
+		return "", apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Unknown email template kind",
+			fiber.Map{"kinds": emailTemplateKinds()})
+	}
+	return kind, nil
+}
+
+func emailTemplateKinds() []string {
+	kinds := make([]string, 0, len(services.EmailTemplateVariables))
+	for kind := range services.EmailTemplateVariables {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// ListEmailTemplates lists the email kinds an organization can customize
+//
+//	@Summary		List email templates
+//	@Description	Lists the emails an organization can word itself (verification, password_reset, invitation and inactivity_warning) with the variables their templates may use and whether the organization customized them. Kinds it did not customize are sent as the built-in emails.
+//	@Tags			Organization Management
+//	@Produce		json
+//	@Param			id	path		string										true	"Organization ID"
+//	@Success		200	{object}	SuccessResponse{data=[]EmailTemplateSummary}	"Email templates"
+//	@Failure		500	{object}	ErrorResponse								"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/organizations/{id}/email-templates [get]
+func (h *OrganizationHandler) ListEmailTemplates(c *fiber.Ctx) error {
+	orgID := c.Params("id")
+	current, err := h.queries.EmailTemplate.ListCurrentTemplates(orgID)
+	if err != nil {
+		h.logger.Error("Failed to list email templates of organization %s: %v", orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list email templates")
+	}
+	byKind := make(map[string]models.EmailTemplate, len(current))
+	for _, t := range current {
+		byKind[t.Kind] = t
+	}
+
+	summaries := make([]EmailTemplateSummary, 0, len(services.EmailTemplateVariables))
+	for _, kind := range emailTemplateKinds() {
+		summary := EmailTemplateSummary{Kind: kind, Variables: services.EmailVariableNames(kind)}
+		if t, ok := byKind[kind]; ok {
+			updatedAt := t.CreatedAt
+			summary.Customized, summary.Version, summary.UpdatedAt = true, t.Version, &updatedAt
+		}
+		summaries = append(summaries, summary)
+	}
+	return apiSuccess(c, fiber.StatusOK, "Email templates retrieved successfully", summaries)
+}
+
+// GetEmailTemplate returns the template an organization sends for a kind
+//
+//	@Summary		Get email template
+//	@Description	Returns the current template of a kind, or the built-in one when the organization did not customize it, together with the built-in template to start from and the variables the kind allows.
+//	@Tags			Organization Management
+//	@Produce		json
+//	@Param			id		path		string			true	"Organization ID"
+//	@Param			kind	path		string			true	"Email kind"
+//	@Success		200		{object}	SuccessResponse	"Email template"
+//	@Failure		404		{object}	ErrorResponse	"Unknown kind"
+//	@Failure		500		{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/organizations/{id}/email-templates/{kind} [get]
+func (h *OrganizationHandler) GetEmailTemplate(c *fiber.Ctx) error {
+	orgID := c.Params("id")
+	kind, err := emailTemplateKind(c)
+	if kind == "" {
+		return err
+	}
+	current, err := h.queries.EmailTemplate.GetCurrentTemplate(orgID, kind)
+	if err != nil {
+		h.logger.Error("Failed to get email template %s of organization %s: %v", kind, orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve email template")
+	}
+
+	defaults := services.DefaultEmailTemplate(kind)
+	template := current
+	if template == nil {
+		template = defaults
+	}
+	return apiSuccess(c, fiber.StatusOK, "Email template retrieved successfully", fiber.Map{
+		"kind":       kind,
+		"variables":  services.EmailVariableNames(kind),
+		"customized": current != nil,
+		"template":   template,
+		"default":    defaults,
+	})
+}
+
+// UpdateEmailTemplate saves a new version of an organization's template
+//
+//	@Summary		Update email template
+//	@Description	Saves a template as the next version of its kind, which is sent from then on. The subject and text_body are text templates and html_body an HTML template, whose variables are escaped for where they appear. Templates may only use the variables of their kind, if/else and the functions eq, ne, not, and and or.
+//	@Tags			Organization Management
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string					true	"Organization ID"
+//	@Param			kind	path		string					true	"Email kind"
+//	@Param			request	body		EmailTemplateRequest	true	"Template"
+//	@Success		200		{object}	SuccessResponse{data=models.EmailTemplate}	"Template saved"
+//	@Failure		400		{object}	ErrorResponse			"Invalid template"
+//	@Failure		404		{object}	ErrorResponse			"Unknown kind"
+//	@Failure		500		{object}	ErrorResponse			"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/organizations/{id}/email-templates/{kind} [put]
+func (h *OrganizationHandler) UpdateEmailTemplate(c *fiber.Ctx) error {
+	orgID := c.Params("id")
+	kind, err := emailTemplateKind(c)
+	if kind == "" {
+		return err
+	}
+	var req EmailTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
+	}
+	tmpl := &models.EmailTemplate{OrganizationID: orgID, Kind: kind, Subject: req.Subject, HTMLBody: req.HTMLBody, TextBody: req.TextBody}
+	if err := services.ValidateEmailTemplate(tmpl); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, err.Error(),
+			fiber.Map{"variables": services.EmailVariableNames(kind)})
+	}
+	return h.saveEmailTemplate(c, tmpl, "update_email_template")
+}
+
+// saveEmailTemplate stores a template as the next version of its kind and
+// audits the change against the version it replaces
+func (h *OrganizationHandler) saveEmailTemplate(c *fiber.Ctx, tmpl *models.EmailTemplate, action string) error {
+	before, err := h.queries.EmailTemplate.GetCurrentTemplate(tmpl.OrganizationID, tmpl.Kind)
+	if err != nil {
+		h.logger.Error("Failed to get email template %s of organization %s: %v", tmpl.Kind, tmpl.OrganizationID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to save email template")
+	}
+	if userID, ok := c.Locals("user_id").(string); ok && userID != "" {
+		tmpl.CreatedBy = &userID
+	}
+	if err := h.queries.EmailTemplate.CreateTemplateVersion(tmpl); err != nil {
+		h.logger.Error("Failed to save email template %s of organization %s: %v", tmpl.Kind, tmpl.OrganizationID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to save email template")
+	}
+
+	var old interface{}
+	if before != nil {
+		old = before
+	}
+	auditChange(c, h.audit, tmpl.OrganizationID, action, "email_template", tmpl.Kind, old, tmpl)
+	h.logger.Info("Email template %s of organization %s saved as version %d", tmpl.Kind, tmpl.OrganizationID, tmpl.Version)
+	return apiSuccess(c, fiber.StatusOK, "Email template saved successfully", tmpl)
+}
+
+// DeleteEmailTemplate returns an organization to the built-in email
+//
+//	@Summary		Reset email template
+//	@Description	Deletes every version of the organization's template of a kind, so that the built-in email is sent again.
+//	@Tags			Organization Management
+//	@Produce		json
+//	@Param			id		path		string			true	"Organization ID"
+//	@Param			kind	path		string			true	"Email kind"
+//	@Success		200		{object}	SuccessResponse	"Template reset"
+//	@Failure		404		{object}	ErrorResponse	"Unknown kind or not customized"
+//	@Failure		500		{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/organizations/{id}/email-templates/{kind} [delete]
+func (h *OrganizationHandler) DeleteEmailTemplate(c *fiber.Ctx) error {
+	orgID := c.Params("id")
+	kind, err := emailTemplateKind(c)
+	if kind == "" {
+		return err
+	}
+	before, err := h.queries.EmailTemplate.GetCurrentTemplate(orgID, kind)
+	if err != nil {
+		h.logger.Error("Failed to get email template %s of organization %s: %v", kind, orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to reset email template")
+	}
+	if before == nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "The organization uses the built-in email")
+	}
+	deleted, err := h.queries.EmailTemplate.DeleteTemplates(orgID, kind)
+	if err != nil {
+		h.logger.Error("Failed to delete email template %s of organization %s: %v", kind, orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to reset email template")
+	}
+
+	auditChange(c, h.audit, orgID, "delete_email_template", "email_template", kind, before, nil)
+	return apiSuccess(c, fiber.StatusOK, "Email template reset to the default", fiber.Map{"kind": kind, "deleted_versions": deleted})
+}
+
+// ListEmailTemplateVersions returns the versions of an organization's
+// template
+//
+//	@Summary		List email template versions
+//	@Description	Returns every saved version of the organization's template of a kind, newest first.
+//	@Tags			Organization Management
+//	@Produce		json
+//	@Param			id		path		string											true	"Organization ID"
+//	@Param			kind	path		string											true	"Email kind"
+//	@Success		200		{object}	SuccessResponse{data=[]models.EmailTemplate}	"Versions"
+//	@Failure		404		{object}	ErrorResponse									"Unknown kind"
+//	@Failure		500		{object}	ErrorResponse									"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/organizations/{id}/email-templates/{kind}/versions [get]
+func (h *OrganizationHandler) ListEmailTemplateVersions(c *fiber.Ctx) error {
+	orgID := c.Params("id")
+	kind, err := emailTemplateKind(c)
+	if kind == "" {
+		return err
+	}
+	versions, err := h.queries.EmailTemplate.ListTemplateVersions(orgID, kind)
+	if err != nil {
+		h.logger.Error("Failed to list versions of email template %s of organization %s: %v", kind, orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list email template versions")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Email template versions retrieved successfully", versions)
+}
+
+// RestoreEmailTemplateVersion makes an earlier version current again
+//
+//	@Summary		Restore email template version
+//	@Description	Saves a copy of an earlier version as the next version, which is sent from then on. The versions in between are kept.
+//	@Tags			Organization Management
+//	@Produce		json
+//	@Param			id		path		string			true	"Organization ID"
+//	@Param			kind	path		string			true	"Email kind"
+//	@Param			version	path		int				true	"Version to restore"
+//	@Success		200		{object}	SuccessResponse{data=models.EmailTemplate}	"Template saved"
+//	@Failure		400		{object}	ErrorResponse	"Invalid version"
+//	@Failure		404		{object}	ErrorResponse	"Unknown kind or version"
+//	@Failure		500		{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/organizations/{id}/email-templates/{kind}/versions/{version}/restore [post]
+func (h *OrganizationHandler) RestoreEmailTemplateVersion(c *fiber.Ctx) error {
+	orgID := c.Params("id")
+	kind, err := emailTemplateKind(c)
+	if kind == "" {
+		return err
+	}
+	version, err := strconv.Atoi(c.Params("version"))
+	if err != nil || version < 1 {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "version must be a positive integer")
+	}
+	old, err := h.queries.EmailTemplate.GetTemplateVersion(orgID, kind, version)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Email template version not found")
+		}
+		h.logger.Error("Failed to get version %d of email template %s of organization %s: %v", version, kind, orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to restore email template")
+	}
+
+	tmpl := &models.EmailTemplate{OrganizationID: orgID, Kind: kind, Subject: old.Subject, HTMLBody: old.HTMLBody, TextBody: old.TextBody}
+	return h.saveEmailTemplate(c, tmpl, "restore_email_template")
+}
+
+// draftEmailTemplate returns the template a preview or test is about: the
+// one in the request body when it has one, else the organization's current
+// template of the kind or the built-in one
+func (h *OrganizationHandler) draftEmailTemplate(c *fiber.Ctx, orgID, kind string) (*models.EmailTemplate, error) {
+	var req EmailTemplateRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return nil, apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
+		}
+	}
+	if req.Subject != "" || req.HTMLBody != "" || req.TextBody != "" {
+		tmpl := &models.EmailTemplate{OrganizationID: orgID, Kind: kind, Subject: req.Subject, HTMLBody: req.HTMLBody, TextBody: req.TextBody}
+		if err := services.ValidateEmailTemplate(tmpl); err != nil {
+			return nil, apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, err.Error(),
+				fiber.Map{"variables": services.EmailVariableNames(kind)})
+		}
+		return tmpl, nil
+	}
+
+	current, err := h.queries.EmailTemplate.GetCurrentTemplate(orgID, kind)
+	if err != nil {
+		h.logger.Error("Failed to get email template %s of organization %s: %v", kind, orgID, err)
+		return nil, apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve email template")
+	}
+	if current == nil {
+		return services.DefaultEmailTemplate(kind), nil
+	}
+	return current, nil
+}
+
+// PreviewEmailTemplate renders a template with sample values
+//
+//	@Summary		Preview email template
+//	@Description	Renders the template in the body, or without one the organization's current template of the kind, with sample values of its variables and the organization's name. Nothing is saved or sent.
+//	@Tags			Organization Management
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string					true	"Organization ID"
+//	@Param			kind	path		string					true	"Email kind"
+//	@Param			request	body		EmailTemplateRequest	false	"Draft template"
+//	@Success		200		{object}	SuccessResponse{data=services.RenderedEmail}	"Rendered email"
+//	@Failure		400		{object}	ErrorResponse			"Invalid template"
+//	@Failure		404		{object}	ErrorResponse			"Unknown kind"
+//	@Failure		500		{object}	ErrorResponse			"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/organizations/{id}/email-templates/{kind}/preview [post]
+func (h *OrganizationHandler) PreviewEmailTemplate(c *fiber.Ctx) error {
+	orgID := c.Params("id")
+	kind, err := emailTemplateKind(c)
+	if kind == "" {
+		return err
+	}
+	tmpl, err := h.draftEmailTemplate(c, orgID, kind)
+	if tmpl == nil {
+		return err
+	}
+	email, err := h.email.PreviewEmail(orgID, tmpl)
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, err.Error())
+	}
+	return apiSuccess(c, fiber.StatusOK, "Email template rendered successfully", email)
+}
+
+// SendTestEmailTemplate sends a rendered template to the caller
+//
+//	@Summary		Send test email
+//	@Description	Renders the template in the body, or without one the organization's current template of the kind, with sample values and sends it to the signed-in administrator's own address, with the subject marked as a test.
+//	@Tags			Organization Management
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string					true	"Organization ID"
+//	@Param			kind	path		string					true	"Email kind"
+//	@Param			request	body		EmailTemplateRequest	false	"Draft template"
+//	@Success		200		{object}	SuccessResponse			"Test email sent"
+//	@Failure		400		{object}	ErrorResponse			"Invalid template or no email address"
+//	@Failure		404		{object}	ErrorResponse			"Unknown kind"
+//	@Failure		500		{object}	ErrorResponse			"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/organizations/{id}/email-templates/{kind}/test [post]
+func (h *OrganizationHandler) SendTestEmailTemplate(c *fiber.Ctx) error {
+	orgID := c.Params("id")
+	kind, err := emailTemplateKind(c)
+	if kind == "" {
+		return err
+	}
+	to, _ := c.Locals("email").(string)
+	if to == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Test emails are sent to your own address, which is unknown")
+	}
+	tmpl, err := h.draftEmailTemplate(c, orgID, kind)
+	if tmpl == nil {
+		return err
+	}
+	if err := h.email.SendTestEmail(orgID, to, tmpl); err != nil {
+		h.logger.Error("Failed to send test email %s of organization %s: %v", kind, orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to send test email")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Test email sent", fiber.Map{"kind": kind, "to": to})
+}
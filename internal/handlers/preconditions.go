@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+)
+
+// versionETag is the entity tag of a row at a lock_version
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// requiredVersion returns the lock_version an update is based on, taken
+// from If-Match or else from the lock_version field of the body (nil when
+// absent). If-Match: * returns 0, which matches any version. Without either,
+// or with an unusable If-Match, it responds and returns -1.
+func requiredVersion(c *fiber.Ctx, bodyVersion *int) (int, error) {
+	ifMatch := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	switch {
+	case ifMatch == "*":
+		return 0, nil
+	case ifMatch != "":
+		// Only the first tag is used: a row has a single current version
+		tag := strings.TrimSpace(strings.Split(ifMatch, ",")[0])
+		tag = strings.TrimPrefix(tag, "W/")
+		if v, err := strconv.Atoi(strings.Trim(tag, `"`)); err == nil && v > 0 {
+			return v, nil
+		}
+		return -1, apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "If-Match must be an entity tag returned by this API")
+	case bodyVersion != nil && *bodyVersion > 0:
+		return *bodyVersion, nil
+	}
+	return -1, apiError(c, fiber.StatusPreconditionRequired, apierror.CodePreconditionRequired,
+		"Send the version the update is based on as If-Match or lock_version")
+}
+
+// staleVersion responds 409 with the current version when err reports an
+// update against an outdated one
+func staleVersion(c *fiber.Ctx, err error, message string) (bool, error) {
+	var stale *queries.StaleVersionError
+	if !errors.As(err, &stale) {
+		return false, nil
+	}
+	c.Set(fiber.HeaderETag, versionETag(stale.Current))
+	return true, apiError(c, fiber.StatusConflict, apierror.CodeVersionConflict, message,
+		fiber.Map{"current_version": stale.Current})
+}
+
+// Cache-Control of conditional GET responses. Public documents are fetched
+// by every relying party; the rest are per caller and revalidated.
+const (
+	cacheDiscovery  = "public, max-age=3600"
+	cacheJWKS       = "public, max-age=300"
+	cacheClientInfo = "public, max-age=300"
+	cacheBranding   = "public, max-age=300"
+	cachePublished  = "private, max-age=60"
+	cacheRevalidate = "private, no-cache"
+)
+
+// bodyETag is the entity tag of a response without a version
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified sets the validators and Cache-Control of a GET response and
+// reports whether the caller's copy is current, in which case it has
+// responded 304. If-None-Match takes precedence over If-Modified-Since;
+// lastModified may be zero.
+func notModified(c *fiber.Ctx, etag string, lastModified time.Time, cacheControl string) bool {
+	c.Set(fiber.HeaderCacheControl, cacheControl)
+	c.Set(fiber.HeaderETag, etag)
+	if !lastModified.IsZero() {
+		c.Set(fiber.HeaderLastModified, lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	fresh := false
+	if ifNoneMatch := c.Get(fiber.HeaderIfNoneMatch); ifNoneMatch != "" {
+		fresh = etagMatches(ifNoneMatch, etag)
+	} else if since, err := http.ParseTime(c.Get(fiber.HeaderIfModifiedSince)); err == nil && !lastModified.IsZero() {
+		// HTTP dates have whole seconds
+		fresh = !lastModified.Truncate(time.Second).After(since)
+	}
+	if fresh {
+		c.Status(fiber.StatusNotModified)
+	}
+	return fresh
+}
+
+// etagMatches compares a list of entity tags against etag, weakly as
+// If-None-Match requires
+func etagMatches(list, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionalJSON responds with v, or 304 when the caller already has it,
+// tagging the response with a hash of its body
+func conditionalJSON(c *fiber.Ctx, v interface{}, cacheControl string) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if notModified(c, bodyETag(body), time.Time{}, cacheControl) {
+		return nil
+	}
+	c.Type("json")
+	return c.Send(body)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+// SetPrincipals makes group membership check the principals it adds.
+// Called from route setup.
+func (h *GroupHandler) SetPrincipals(principals services.PrincipalResolver) {
+	h.principals = principals
+}
+
+// SetPrincipals makes sharing check the principals resources are shared
+// with. Called from route setup.
+func (h *ResourceHandler) SetPrincipals(principals services.PrincipalResolver) {
+	h.principals = principals
+}
+
+// SetPrincipals makes role assignment check the principals it assigns
+// roles to. Called from route setup.
+func (h *RoleHandler) SetPrincipals(principals services.PrincipalResolver) {
+	h.principals = principals
+}
+
+// SetPrincipals makes grants check the principals they name. Called from
+// route setup.
+func (h *KMSHandler) SetPrincipals(principals services.PrincipalResolver) {
+	h.principals = principals
+}
+
+// SetPrincipals makes audit listings show the principal of each event.
+// Called from route setup.
+func (h *AuditHandler) SetPrincipals(principals services.PrincipalResolver) {
+	h.principals = principals
+}
+
+// resolvePrincipal looks up the principal a request names, limited to the
+// given types. It writes the error response and returns nil when the type
+// is not allowed or there is no such principal in the organization. Without
+// a resolver the principal is taken as given.
+func resolvePrincipal(c *fiber.Ctx, resolver services.PrincipalResolver, log *logger.Logger, organizationID, id, principalType string, types ...string) (*models.Principal, error) {
+	allowed := false
+	for _, t := range types {
+		allowed = allowed || t == principalType
+	}
+	if !allowed {
+		return nil, apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, principalTypeMessage(types))
+	}
+	if resolver == nil {
+		return &models.Principal{ID: id, Type: principalType, OrganizationID: organizationID}, nil
+	}
+	p, err := resolver.Resolve(c.Context(), organizationID, id, principalType)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return nil, apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Principal not found")
+		}
+		if errors.Is(err, services.ErrInvalidPrincipalType) {
+			return nil, apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, err.Error())
+		}
+		log.Error("Failed to resolve principal %s: %v", id, err)
+		return nil, apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to look up principal")
+	}
+	return p, nil
+}
+
+// callerPrincipalType returns the type of the authenticated principal:
+// service_account for API keys, user otherwise
+func callerPrincipalType(c *fiber.Ctx) string {
+	if principalType, _ := c.Locals("principal_type").(string); principalType != "" {
+		return principalType
+	}
+	return "user"
+}
+
+// principalTypes lists every type of principal
+var principalTypes = []string{"user", "service_account", "group"}
+
+func principalTypeMessage(types []string) string {
+	if len(types) == 2 {
+		return "principal_type must be '" + types[0] + "' or '" + types[1] + "'"
+	}
+	return services.ErrInvalidPrincipalType.Error()
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+)
+
+// sha256Hex matches a hex-encoded SHA-256 checksum
+var sha256Hex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// SetIntegrity enables checks of resources against their checksums
+func (h *ResourceHandler) SetIntegrity(integrity services.ResourceIntegrityService) {
+	h.integrity = integrity
+}
+
+// ResourceChecksumVerification is the outcome of a checksum check
+type ResourceChecksumVerification struct {
+	Match     bool                      `json:"match"`
+	Integrity *models.ResourceIntegrity `json:"integrity"`
+}
+
+// GetResourceChecksum returns the stored checksum of a resource
+//
+//	@Summary	Get resource checksum
+//	@Description	Show the SHA-256 checksum and size stored for a resource and the outcome of its last check: unverified, valid, mismatch or missing. blob_backed resources are stored by the server, which computes their checksum and checks them in the background.
+//	@Tags		Resource Management
+//	@Produce	json
+//	@Param		id	path	string	true	"Resource ID"
+//	@Success	200	{object}	SuccessResponse{data=models.ResourceIntegrity}	"Resource checksum retrieved successfully"
+//	@Failure	404	{object}	ErrorResponse	"Resource not found"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Security	BearerAuth
+//	@Router		/resources/{id}/checksum [get]
+func (h *ResourceHandler) GetResourceChecksum(c *fiber.Ctx) error {
+	organizationID := c.Locals("organization_id").(string)
+	integrity, err := h.queries.Resource.WithContext(c.Context()).GetResourceIntegrity(c.Params("id"), organizationID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Resource not found")
+		}
+		h.logger.Error("get resource checksum failed: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve resource checksum")
+	}
+	return c.Status(fiber.StatusOK).JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Resource checksum retrieved successfully", Data: integrity})
+}
+
+// SetResourceChecksum stores the checksum of a resource
+//
+//	@Summary	Set resource checksum
+//	@Description	Store the SHA-256 checksum, as 64 lowercase hex characters, and optionally the size of a resource whose content is kept outside the server. Copies of the resource are then checked against it. The checksum of a blob_backed resource is computed by the server and cannot be set.
+//	@Tags		Resource Management
+//	@Accept		json
+//	@Produce	json
+//	@Param		id	path	string	true	"Resource ID"
+//	@Param		body	body	object	true	"checksum and size_bytes"
+//	@Success	200	{object}	SuccessResponse{data=models.ResourceIntegrity}	"Resource checksum set successfully"
+//	@Failure	400	{object}	ErrorResponse	"Invalid checksum or size"
+//	@Failure	404	{object}	ErrorResponse	"Resource not found"
+//	@Failure	409	{object}	ErrorResponse	"Resource is stored by the server"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Security	BearerAuth
+//	@Router		/resources/{id}/checksum [put]
+func (h *ResourceHandler) SetResourceChecksum(c *fiber.Ctx) error {
+	var req struct {
+		Checksum  string `json:"checksum"`
+		SizeBytes *int64 `json:"size_bytes"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
+	}
+	req.Checksum = strings.TrimSpace(req.Checksum)
+	if !sha256Hex.MatchString(req.Checksum) {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "checksum must be a SHA-256 digest of 64 lowercase hex characters")
+	}
+	if req.SizeBytes != nil && *req.SizeBytes < 0 {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "size_bytes must not be negative")
+	}
+
+	resourceID := c.Params("id")
+	organizationID := c.Locals("organization_id").(string)
+	resources := h.queries.Resource.WithContext(c.Context())
+	integrity, err := resources.GetResourceIntegrity(resourceID, organizationID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Resource not found")
+		}
+		h.logger.Error("get resource checksum failed: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to set resource checksum")
+	}
+	if integrity.BlobBacked {
+		return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "The checksum of a resource stored by the server is computed by the server")
+	}
+	if err := resources.SetResourceChecksum(resourceID, organizationID, req.Checksum, req.SizeBytes); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Resource not found")
+		}
+		h.logger.Error("set resource checksum failed: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to set resource checksum")
+	}
+	integrity, err = resources.GetResourceIntegrity(resourceID, organizationID)
+	if err != nil {
+		h.logger.Error("get resource checksum failed: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Resource checksum set but failed to retrieve it")
+	}
+	return c.Status(fiber.StatusOK).JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Resource checksum set successfully", Data: integrity})
+}
+
+// VerifyResourceChecksum checks a resource against its stored checksum
+//
+//	@Summary	Verify resource checksum
+//	@Description	Check a resource against its stored SHA-256 checksum. A blob_backed resource is read back from storage and hashed by the server; for any other resource, send the checksum of the copy to check. A resource that stops matching raises a checksum_mismatch security alert for organizations with such a rule.
+//	@Tags		Resource Management
+//	@Accept		json
+//	@Produce	json
+//	@Param		id	path	string	true	"Resource ID"
+//	@Param		body	body	object	false	"checksum of the copy, required unless blob_backed"
+//	@Success	200	{object}	SuccessResponse{data=ResourceChecksumVerification}	"Resource checksum verified"
+//	@Failure	400	{object}	ErrorResponse	"Invalid checksum"
+//	@Failure	404	{object}	ErrorResponse	"Resource not found"
+//	@Failure	409	{object}	ErrorResponse	"Resource has no stored checksum"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Failure	503	{object}	ErrorResponse	"Checksum verification not available"
+//	@Security	BearerAuth
+//	@Router		/resources/{id}/checksum/verify [post]
+func (h *ResourceHandler) VerifyResourceChecksum(c *fiber.Ctx) error {
+	if h.integrity == nil {
+		return apiError(c, fiber.StatusServiceUnavailable, apierror.CodeServiceUnavailable, "Checksum verification is not available")
+	}
+	var req struct {
+		Checksum string `json:"checksum"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
+		}
+	}
+	req.Checksum = strings.TrimSpace(req.Checksum)
+
+	organizationID := c.Locals("organization_id").(string)
+	integrity, err := h.queries.Resource.WithContext(c.Context()).GetResourceIntegrity(c.Params("id"), organizationID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Resource not found")
+		}
+		h.logger.Error("get resource checksum failed: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to verify resource checksum")
+	}
+	if integrity.Checksum == nil {
+		return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "The resource has no stored checksum")
+	}
+
+	actorID, _ := c.Locals("user_id").(string)
+	var status string
+	if integrity.BlobBacked {
+		status, err = h.integrity.VerifyBlob(c.Context(), integrity, actorID)
+	} else {
+		if !sha256Hex.MatchString(req.Checksum) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "checksum must be a SHA-256 digest of 64 lowercase hex characters")
+		}
+		status, err = h.integrity.VerifyCopy(c.Context(), integrity, req.Checksum, actorID)
+	}
+	if err != nil {
+		h.logger.Error("verify resource checksum failed: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to verify resource checksum")
+	}
+	return c.Status(fiber.StatusOK).JSON(SuccessResponse{
+		Status:  fiber.StatusOK,
+		Message: "Resource checksum verified",
+		Data:    ResourceChecksumVerification{Match: status == queries.ChecksumValid, Integrity: integrity},
+	})
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// maxLifecycleDays bounds every period of a lifecycle policy
+const maxLifecycleDays = 3650
+
+// normalizeLifecyclePolicy checks a resource's lifecycle_policy against
+// models.LifecyclePolicy and returns it without the rules that are off.
+// Unknown keys are rejected so a misspelt rule is not silently ignored.
+func normalizeLifecyclePolicy(raw string) (string, error) {
+	var p models.LifecyclePolicy
+	dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return "", fmt.Errorf("lifecycle_policy must be a JSON object of archive_after_idle_days, delete_after_archived_days, recertify_every_days and recertify_grace_days")
+	}
+	for _, rule := range []struct {
+		name string
+		days int
+	}{
+		{"archive_after_idle_days", p.ArchiveAfterIdleDays},
+		{"delete_after_archived_days", p.DeleteAfterArchivedDays},
+		{"recertify_every_days", p.RecertifyEveryDays},
+		{"recertify_grace_days", p.RecertifyGraceDays},
+	} {
+		if rule.days < 0 || rule.days > maxLifecycleDays {
+			return "", fmt.Errorf("%s must be between 0 and %d", rule.name, maxLifecycleDays)
+		}
+	}
+	if p.RecertifyGraceDays > 0 && p.RecertifyEveryDays == 0 {
+		return "", fmt.Errorf("recertify_grace_days requires recertify_every_days")
+	}
+	normalized, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	return string(normalized), nil
+}
+
+// GetResourceLifecycle returns where a resource stands in its lifecycle policy
+//
+//	@Summary	Get resource lifecycle
+//	@Description	Show the lifecycle policy of a resource, its lifecycle state and the actions the lifecycle worker will take on it, soonest first, if nothing changes before: archive (idle or recertification_lapsed), request_recertification (recertification_due) and delete (archived). Reading, updating or recertifying the resource postpones the idle archive.
+//	@Tags		Resource Management
+//	@Produce	json
+//	@Param		id	path	string	true	"Resource ID"
+//	@Success	200	{object}	SuccessResponse{data=models.ResourceLifecycle}	"Resource lifecycle retrieved successfully"
+//	@Failure	404	{object}	ErrorResponse	"Resource not found"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Security	BearerAuth
+//	@Router		/resources/{id}/lifecycle [get]
+func (h *ResourceHandler) GetResourceLifecycle(c *fiber.Ctx) error {
+	organizationID := c.Locals("organization_id").(string)
+	lifecycle, err := h.queries.Resource.WithContext(c.Context()).GetResourceLifecycle(c.Params("id"), organizationID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Resource not found")
+		}
+		h.logger.Error("get resource lifecycle failed: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve resource lifecycle")
+	}
+	return c.Status(fiber.StatusOK).JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Resource lifecycle retrieved successfully", Data: lifecycle})
+}
+
+// RecertifyResource certifies that a resource is still needed
+//
+//	@Summary	Recertify resource
+//	@Description	Certify that a resource is still needed, answering a recertification request of its lifecycle policy. The next request falls due recertify_every_days later. A resource archived by its lifecycle policy, or by hand, is restored.
+//	@Tags		Resource Management
+//	@Produce	json
+//	@Param		id	path	string	true	"Resource ID"
+//	@Success	200	{object}	SuccessResponse{data=models.ResourceLifecycle}	"Resource recertified successfully"
+//	@Failure	404	{object}	ErrorResponse	"Resource not found"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Security	BearerAuth
+//	@Router		/resources/{id}/lifecycle/recertify [post]
+func (h *ResourceHandler) RecertifyResource(c *fiber.Ctx) error {
+	resourceID := c.Params("id")
+	organizationID := c.Locals("organization_id").(string)
+	resources := h.queries.Resource.WithContext(c.Context())
+	if err := resources.RecertifyResource(resourceID, organizationID); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Resource not found")
+		}
+		h.logger.Error("recertify resource failed: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to recertify resource")
+	}
+	lifecycle, err := resources.GetResourceLifecycle(resourceID, organizationID)
+	if err != nil {
+		h.logger.Error("get recertified resource lifecycle failed: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Resource recertified but failed to retrieve its lifecycle")
+	}
+	return c.Status(fiber.StatusOK).JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Resource recertified successfully", Data: lifecycle})
+}
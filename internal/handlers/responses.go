@@ -1,18 +1,26 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
 )
 
 // Common response structures for API documentation
 
-// ErrorResponse represents an error response
+// ErrorResponse represents an error response. See apierror for the code catalog.
 type ErrorResponse struct {
-	Status  int    `json:"status" example:"400"`
-	Error   string `json:"error" example:"invalid_request"`
-	Message string `json:"message" example:"The request was invalid"`
+	Success   bool        `json:"success" example:"false"`
+	Code      string      `json:"code" example:"invalid_request"`
+	Error     string      `json:"error" example:"invalid_request"` // Deprecated: mirrors code
+	Message   string      `json:"message" example:"The request was invalid"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty" example:"5f0c6a1e-3c1b-4d8e-9d59-0c2a5d3a7b91"`
 } //@name ErrorResponse
 
 // SuccessResponse represents a success response
@@ -34,6 +42,11 @@ func isNotFoundErr(err error) bool {
 	return strings.Contains(msg, "not found")
 }
 
+// isInvalidCursorErr returns true when a list query rejected the pagination cursor.
+func isInvalidCursorErr(err error) bool {
+	return errors.Is(err, queries.ErrInvalidCursor)
+}
+
 // isConflictErr returns true when a unique-constraint / duplicate-key violation occurred.
 func isConflictErr(err error) bool {
 	if err == nil {
@@ -46,17 +59,29 @@ func isConflictErr(err error) bool {
 		strings.Contains(msg, "conflict")
 }
 
+// ── Query parameter helpers ────────────────────────────────────────────
+
+// parseTimeQuery parses an optional RFC 3339 or YYYY-MM-DD query parameter.
+func parseTimeQuery(c *fiber.Ctx, name string) (*time.Time, error) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%s must be an RFC 3339 timestamp or a YYYY-MM-DD date", name)
+}
+
 // ── Standardized response helpers ──────────────────────────────────────
 
 // apiError sends a uniform JSON error response.
 //
-//	{ "success": false, "error": "<code>", "message": "<human-readable>" }
-func apiError(c *fiber.Ctx, httpStatus int, code string, message string) error {
-	return c.Status(httpStatus).JSON(fiber.Map{
-		"success": false,
-		"error":   code,
-		"message": message,
-	})
+//	{ "success": false, "code": "<code>", "message": "<human-readable>", "details": ..., "request_id": "<id>" }
+func apiError(c *fiber.Ctx, httpStatus int, code apierror.Code, message string, details ...interface{}) error {
+	return apierror.Respond(c, httpStatus, code, message, details...)
 }
 
 // apiSuccess sends a uniform JSON success response.
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/events"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+// maxRoleRenewal bounds how far a renewal may push the expiry of an
+// assignment
+const maxRoleRenewal = 365 * 24 * time.Hour
+
+type roleRenewalBody struct {
+	ExpiresAt string `json:"expires_at,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+type roleRenewalDecisionBody struct {
+	Comment string `json:"comment,omitempty"`
+}
+
+// RequestRoleRenewal
+//
+//	@Summary	Request a role renewal
+//	@Description	Ask for an expiring role assignment to be extended. Only the user holding the assignment and the admin who granted it may ask. Without expires_at the assignment is extended by its original term. The admin who granted the role is notified; anyone allowed to assign roles other than the requester decides.
+//	@Tags		Role Management
+//	@Accept		json
+//	@Produce	json
+//	@Param		assignment_id	path	string	true	"Role assignment ID"
+//	@Param		request	body	roleRenewalBody	false	"Requested expiry (RFC3339) and reason"
+//	@Success	201	{object}	SuccessResponse{data=models.RoleRenewalRequest}	"Renewal requested"
+//	@Failure	400	{object}	ErrorResponse	"Assignment does not expire or invalid expiry"
+//	@Failure	403	{object}	ErrorResponse	"Caller neither holds nor granted the assignment"
+//	@Failure	404	{object}	ErrorResponse	"Role assignment not found"
+//	@Failure	409	{object}	ErrorResponse	"A renewal is already pending"
+//	@Security	BearerAuth
+//	@Router		/roles/assignments/{assignment_id}/renewal [post]
+func (h *RoleHandler) RequestRoleRenewal(c *fiber.Ctx) error {
+	var req roleRenewalBody
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
+		}
+	}
+
+	organizationID := c.Locals("organization_id").(string)
+	userID, _ := c.Locals("user_id").(string)
+	assignment, err := h.queries.Role.WithContext(c.Context()).GetRoleAssignment(c.Params("assignment_id"), organizationID)
+	if err != nil {
+		if err.Error() == "role assignment not found" {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Role assignment not found")
+		}
+		h.logger.Error("Failed to get role assignment: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to request renewal")
+	}
+	holder := assignment.PrincipalType == "user" && assignment.PrincipalID == userID
+	if !holder && assignment.AssignedBy != userID {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only the holder of the assignment or the admin who granted it can request a renewal")
+	}
+	if assignment.ExpiresAt == nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Role assignment does not expire")
+	}
+
+	// By default the assignment is granted its original term again
+	requested := assignment.ExpiresAt.Add(assignment.ExpiresAt.Sub(assignment.AssignedAt))
+	if req.ExpiresAt != "" {
+		if requested, err = time.Parse(time.RFC3339, req.ExpiresAt); err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "expires_at must be RFC3339 format")
+		}
+	}
+	if !requested.After(*assignment.ExpiresAt) || !requested.After(time.Now()) {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "expires_at must be later than the current expiry")
+	}
+	if requested.After(time.Now().Add(maxRoleRenewal)) {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "expires_at must be within a year")
+	}
+
+	renewal, err := h.queries.Role.WithContext(c.Context()).CreateRoleRenewalRequest(&models.RoleRenewalRequest{
+		OrganizationID:     organizationID,
+		AssignmentID:       assignment.ID,
+		RequestedBy:        userID,
+		Reason:             req.Reason,
+		RequestedExpiresAt: requested,
+	})
+	if err != nil {
+		switch err.Error() {
+		case "role assignment not found":
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Role assignment not found")
+		case "renewal already requested":
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "A renewal of this assignment is already pending")
+		}
+		h.logger.Error("Failed to create renewal request: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to request renewal")
+	}
+
+	h.logRenewal(c, "request_role_renewal", renewal)
+	publish(h.events, c, events.Event{
+		Type:    events.RoleRenewalRequested,
+		Subject: renewal.ID,
+		Data: map[string]interface{}{
+			"assignment_id":        renewal.AssignmentID,
+			"role_id":              renewal.RoleID,
+			"role_name":            renewal.RoleName,
+			"principal_id":         renewal.PrincipalID,
+			"assigned_by":          renewal.AssignedBy,
+			"requested_expires_at": renewal.RequestedExpiresAt,
+		},
+	})
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Status:  fiber.StatusCreated,
+		Message: "Renewal requested",
+		Data:    renewal,
+	})
+}
+
+// ListRoleRenewalRequests
+//
+//	@Summary	List role renewal requests
+//	@Description	List the renewal requests of the organization's role assignments, the newest first
+//	@Tags		Role Management
+//	@Produce	json
+//	@Param		status	query	string	false	"Filter by status (pending, approved, denied)"
+//	@Param		limit	query	int	false	"Page size (1-200, default 50)"
+//	@Param		offset	query	int	false	"Number of requests to skip (default 0)"
+//	@Success	200	{object}	SuccessResponse{data=[]models.RoleRenewalRequest}	"Renewal requests retrieved"
+//	@Failure	400	{object}	ErrorResponse	"Invalid query parameters"
+//	@Security	BearerAuth
+//	@Router		/roles/renewal-requests [get]
+func (h *RoleHandler) ListRoleRenewalRequests(c *fiber.Ctx) error {
+	status := c.Query("status")
+	if status != "" && status != "pending" && status != "approved" && status != "denied" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "status must be pending, approved or denied")
+	}
+	limit := c.QueryInt("limit", 50)
+	offset := c.QueryInt("offset", 0)
+	if limit < 1 || limit > 200 {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "limit must be 1-200")
+	}
+	if offset < 0 {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "offset must be >=0")
+	}
+
+	organizationID := c.Locals("organization_id").(string)
+	requests, err := h.queries.Role.WithContext(c.Context()).ListRoleRenewalRequests(organizationID, status, limit, offset)
+	if err != nil {
+		h.logger.Error("Failed to list renewal requests: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list renewal requests")
+	}
+	return c.JSON(SuccessResponse{
+		Status:  fiber.StatusOK,
+		Message: "Renewal requests retrieved successfully",
+		Data:    requests,
+	})
+}
+
+// ApproveRoleRenewal
+//
+//	@Summary	Approve a role renewal
+//	@Description	Approve a pending renewal request, extending the role assignment to the requested expiry. Requesters cannot decide their own request.
+//	@Tags		Role Management
+//	@Accept		json
+//	@Produce	json
+//	@Param		id	path	string	true	"Renewal request ID"
+//	@Param		decision	body	roleRenewalDecisionBody	false	"Comment"
+//	@Success	200	{object}	SuccessResponse{data=models.RoleRenewalRequest}	"Renewal approved"
+//	@Failure	403	{object}	ErrorResponse	"Own request"
+//	@Failure	404	{object}	ErrorResponse	"Renewal request not found"
+//	@Failure	409	{object}	ErrorResponse	"Request already decided"
+//	@Security	BearerAuth
+//	@Router		/roles/renewal-requests/{id}/approve [post]
+func (h *RoleHandler) ApproveRoleRenewal(c *fiber.Ctx) error {
+	return h.decideRoleRenewal(c, true)
+}
+
+// DenyRoleRenewal
+//
+//	@Summary	Deny a role renewal
+//	@Description	Deny a pending renewal request; the role assignment expires as scheduled. Requesters cannot decide their own request.
+//	@Tags		Role Management
+//	@Accept		json
+//	@Produce	json
+//	@Param		id	path	string	true	"Renewal request ID"
+//	@Param		decision	body	roleRenewalDecisionBody	false	"Comment"
+//	@Success	200	{object}	SuccessResponse{data=models.RoleRenewalRequest}	"Renewal denied"
+//	@Failure	403	{object}	ErrorResponse	"Own request"
+//	@Failure	404	{object}	ErrorResponse	"Renewal request not found"
+//	@Failure	409	{object}	ErrorResponse	"Request already decided"
+//	@Security	BearerAuth
+//	@Router		/roles/renewal-requests/{id}/deny [post]
+func (h *RoleHandler) DenyRoleRenewal(c *fiber.Ctx) error {
+	return h.decideRoleRenewal(c, false)
+}
+
+func (h *RoleHandler) decideRoleRenewal(c *fiber.Ctx, approve bool) error {
+	var decision roleRenewalDecisionBody
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&decision); err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
+		}
+	}
+
+	organizationID := c.Locals("organization_id").(string)
+	userID, _ := c.Locals("user_id").(string)
+	roles := h.queries.Role.WithContext(c.Context())
+	pending, err := roles.GetRoleRenewalRequest(c.Params("id"), organizationID)
+	if err != nil {
+		if err.Error() == "renewal request not found" {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Renewal request not found")
+		}
+		h.logger.Error("Failed to get renewal request: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to decide renewal request")
+	}
+	if pending.RequestedBy == userID {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "You cannot decide your own renewal request")
+	}
+	if pending.Status != "pending" {
+		return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "Renewal request was already "+pending.Status)
+	}
+	if approve {
+		if refused, err := h.refuseRoleEscalation(c, pending.RoleID, organizationID); refused {
+			return err
+		}
+	}
+
+	renewal, err := roles.DecideRoleRenewalRequest(pending.ID, organizationID, userID, approve, decision.Comment)
+	if err != nil {
+		if err.Error() == "renewal request not pending" {
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "Renewal request was already decided")
+		}
+		h.logger.Error("Failed to decide renewal request: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to decide renewal request")
+	}
+
+	action := "deny_role_renewal"
+	if approve {
+		action = "approve_role_renewal"
+	}
+	h.logRenewal(c, action, renewal)
+	publish(h.events, c, events.Event{
+		Type:    events.RoleRenewalDecided,
+		Subject: renewal.ID,
+		Data: map[string]interface{}{
+			"assignment_id": renewal.AssignmentID,
+			"role_id":       renewal.RoleID,
+			"role_name":     renewal.RoleName,
+			"requested_by":  renewal.RequestedBy,
+			"status":        renewal.Status,
+			"expires_at":    renewal.CurrentExpiresAt,
+		},
+	})
+	return c.JSON(SuccessResponse{
+		Status:  fiber.StatusOK,
+		Message: "Renewal " + renewal.Status,
+		Data:    renewal,
+	})
+}
+
+func (h *RoleHandler) logRenewal(c *fiber.Ctx, action string, renewal *models.RoleRenewalRequest) {
+	if h.audit == nil {
+		return
+	}
+	userID, _ := c.Locals("user_id").(string)
+	h.audit.LogEvent(c.Context(), models.AuditEvent{
+		OrganizationID: renewal.OrganizationID,
+		PrincipalID:    utils.StringPtr(userID),
+		PrincipalType:  utils.StringPtr("user"),
+		Action:         action,
+		ResourceType:   utils.StringPtr("role_assignment"),
+		ResourceID:     utils.StringPtr(renewal.AssignmentID),
+		Result:         "success",
+		Severity:       "warn",
+	})
+}
@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/detection"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+// SecurityRuleRequest is the request body for creating a security rule.
+// Threshold, window and severity default to those of the type.
+type SecurityRuleRequest struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"` // failed_logins, policy_wildcard, mass_role_assignment, api_key_new_country, checksum_mismatch
+	Threshold     int    `json:"threshold,omitempty"`
+	WindowMinutes int    `json:"window_minutes,omitempty"`
+	Severity      string `json:"severity,omitempty"`      // critical, high, medium, low
+	Enabled       *bool  `json:"enabled,omitempty"`       // default true
+	NotifyAdmins  *bool  `json:"notify_admins,omitempty"` // default true
+	WebhookURL    string `json:"webhook_url,omitempty"`
+	WebhookSecret string `json:"webhook_secret,omitempty"`
+}
+
+// UpdateSecurityRuleRequest changes a security rule; omitted fields are
+// kept. An empty webhook_url removes the webhook and its secret.
+type UpdateSecurityRuleRequest struct {
+	Name          *string `json:"name,omitempty"`
+	Threshold     *int    `json:"threshold,omitempty"`
+	WindowMinutes *int    `json:"window_minutes,omitempty"`
+	Severity      *string `json:"severity,omitempty"`
+	Enabled       *bool   `json:"enabled,omitempty"`
+	NotifyAdmins  *bool   `json:"notify_admins,omitempty"`
+	WebhookURL    *string `json:"webhook_url,omitempty"`
+	WebhookSecret *string `json:"webhook_secret,omitempty"`
+}
+
+// AcknowledgeSecurityAlertRequest is the request body for acknowledging an
+// alert
+type AcknowledgeSecurityAlertRequest struct {
+	Note string `json:"note,omitempty"`
+}
+
+func (h *AuditHandler) logSecurityChange(c *fiber.Ctx, action, organizationID, resourceType, resourceID string) {
+	h.audit.LogEvent(c.Context(), models.AuditEvent{
+		OrganizationID: organizationID,
+		PrincipalID:    utils.StringPtr(c.Locals("user_id").(string)),
+		PrincipalType:  utils.StringPtr("user"),
+		Action:         action,
+		ResourceType:   utils.StringPtr(resourceType),
+		ResourceID:     utils.StringPtr(resourceID),
+		Result:         "success",
+		Severity:       "warn",
+	})
+}
+
+// ListSecurityRules returns the detection rules of the organization
+//
+//	@Summary	List security rules
+//	@Description	List the rules raising security alerts from the organization's audit events. Webhook secrets are never returned; webhook_signed tells whether a rule has one.
+//	@Tags		Audit & Compliance
+//	@Produce	json
+//	@Param		id	path	string	true	"Organization ID"
+//	@Success	200	{array}		models.SecurityRule	"Security rules retrieved"
+//	@Failure	403	{object}	ErrorResponse	"Organization admin required"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Security	BearerAuth
+//	@Router		/organizations/{id}/security-rules [get]
+func (h *AuditHandler) ListSecurityRules(c *fiber.Ctx) error {
+	rules, err := h.queries.Audit.WithContext(c.Context()).ListSecurityRules(c.Params("id"))
+	if err != nil {
+		h.logger.Error("Failed to list security rules: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve security rules")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Security rules retrieved", rules)
+}
+
+// CreateSecurityRule adds a detection rule to the organization
+//
+//	@Summary	Create security rule
+//	@Description	Raise an alert when threshold matching events fall within window_minutes: failed logins of one user or IP (failed_logins), policies granting wildcard access (policy_wildcard), role assignments made by one user (mass_role_assignment), an API key used from a new country (api_key_new_country, needs CLIENT_COUNTRY_HEADER) or a resource no longer matching its stored checksum (checksum_mismatch). A rule fires once per window and subject; alerts are stored, sent to the organization admins' notification streams and, with a webhook_url, posted to it signed with webhook_secret. Every replica picks the rule up within 30 seconds.
+//	@Tags		Audit & Compliance
+//	@Accept		json
+//	@Produce	json
+//	@Param		id		path	string	true	"Organization ID"
+//	@Param		request	body	SecurityRuleRequest	true	"Security rule"
+//	@Success	201	{object}	models.SecurityRule	"Security rule created"
+//	@Failure	400	{object}	ErrorResponse	"Invalid rule"
+//	@Failure	403	{object}	ErrorResponse	"Organization admin required"
+//	@Failure	409	{object}	ErrorResponse	"A rule with this name exists"
+//	@Failure	500	{object}	ErrorResponse	"Internal server error"
+//	@Security	BearerAuth
+//	@Router		/organizations/{id}/security-rules [post]
+func (h *AuditHandler) CreateSecurityRule(c *fiber.Ctx) error {
+	var req SecurityRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+	}
+
+	rule := &models.SecurityRule{
+		OrganizationID: c.Params("id"),
+		Name:           strings.TrimSpace(req.Name),
+		Type:           req.Type,
+		Threshold:      req.Threshold,
+		WindowMinutes:  req.WindowMinutes,
+		Severity:       req.Severity,
+		Enabled:        req.Enabled == nil || *req.Enabled,
+		NotifyAdmins:   req.NotifyAdmins == nil || *req.NotifyAdmins,
+		WebhookURL:     strings.TrimSpace(req.WebhookURL),
+		WebhookSecret:  req.WebhookSecret,
+		CreatedBy:      utils.StringPtr(c.Locals("user_id").(string)),
+	}
+	if err := detection.Validate(rule); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, err.Error())
+	}
+	rule.WebhookSigned = rule.WebhookSecret != ""
+
+	if err := h.queries.Audit.WithContext(c.Context()).CreateSecurityRule(rule); err != nil {
+		if isConflictErr(err) {
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "A security rule with this name already exists")
+		}
+		h.logger.Error("Failed to create security rule: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create security rule")
+	}
+
+	h.logSecurityChange(c, "create_security_rule", rule.OrganizationID, "security_rule", rule.ID)
+	return apiSuccess(c, fiber.StatusCreated, "Security rule created", rule)
+}
+
+// GetSecurityRule returns a detection rule of the organization
+//
+//	@Summary	Get security rule
+//	@Tags		Audit & Compliance
+//	@Produce	json
+//	@Param		id		path	string	true	"Organization ID"
+//	@Param		rule_id	path	string	true	"Security rule ID"
+//	@Success	200	{object}	models.SecurityRule	"Security rule retrieved"
+//	@Failure	404	{object}	ErrorResponse	"Security rule not found"
+//	@Security	BearerAuth
+//	@Router		/organizations/{id}/security-rules/{rule_id} [get]
+func (h *AuditHandler) GetSecurityRule(c *fiber.Ctx) error {
+	rule, err := h.queries.Audit.WithContext(c.Context()).GetSecurityRule(c.Params("rule_id"), c.Params("id"))
+	if err != nil {
+		return h.securityError(c, err, "Security rule not found", "Failed to retrieve security rule")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Security rule retrieved", rule)
+}
+
+// UpdateSecurityRule changes a detection rule of the organization
+//
+//	@Summary	Update security rule
+//	@Description	Rename, retune, enable or disable a security rule, or change its webhook. The type of a rule cannot change. The webhook secret is kept unless a new one is sent; an empty webhook_url removes the webhook.
+//	@Tags		Audit & Compliance
+//	@Accept		json
+//	@Produce	json
+//	@Param		id		path	string	true	"Organization ID"
+//	@Param		rule_id	path	string	true	"Security rule ID"
+//	@Param		request	body	UpdateSecurityRuleRequest	true	"Changes"
+//	@Success	200	{object}	models.SecurityRule	"Security rule updated"
+//	@Failure	400	{object}	ErrorResponse	"Invalid rule"
+//	@Failure	404	{object}	ErrorResponse	"Security rule not found"
+//	@Failure	409	{object}	ErrorResponse	"A rule with this name exists"
+//	@Security	BearerAuth
+//	@Router		/organizations/{id}/security-rules/{rule_id} [put]
+func (h *AuditHandler) UpdateSecurityRule(c *fiber.Ctx) error {
+	var req UpdateSecurityRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+	}
+
+	q := h.queries.Audit.WithContext(c.Context())
+	rule, err := q.GetSecurityRule(c.Params("rule_id"), c.Params("id"))
+	if err != nil {
+		return h.securityError(c, err, "Security rule not found", "Failed to update security rule")
+	}
+	if req.Name != nil {
+		rule.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Threshold != nil {
+		if rule.Threshold = *req.Threshold; rule.Threshold == 0 {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "threshold must be at least 1")
+		}
+	}
+	if req.WindowMinutes != nil {
+		if rule.WindowMinutes = *req.WindowMinutes; rule.WindowMinutes == 0 {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "window_minutes must be at least 1")
+		}
+	}
+	if req.Severity != nil {
+		if rule.Severity = *req.Severity; rule.Severity == "" {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "severity must not be empty")
+		}
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if req.NotifyAdmins != nil {
+		rule.NotifyAdmins = *req.NotifyAdmins
+	}
+	if req.WebhookURL != nil {
+		if rule.WebhookURL = strings.TrimSpace(*req.WebhookURL); rule.WebhookURL == "" {
+			rule.WebhookSecret = ""
+		}
+	}
+	if req.WebhookSecret != nil {
+		rule.WebhookSecret = *req.WebhookSecret
+	}
+	if err := detection.Validate(rule); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, err.Error())
+	}
+	rule.WebhookSigned = rule.WebhookSecret != ""
+
+	if err := q.UpdateSecurityRule(rule); err != nil {
+		if isConflictErr(err) {
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "A security rule with this name already exists")
+		}
+		return h.securityError(c, err, "Security rule not found", "Failed to update security rule")
+	}
+
+	h.logSecurityChange(c, "update_security_rule", rule.OrganizationID, "security_rule", rule.ID)
+	return apiSuccess(c, fiber.StatusOK, "Security rule updated", rule)
+}
+
+// DeleteSecurityRule removes a detection rule of the organization
+//
+//	@Summary	Delete security rule
+//	@Description	Delete a security rule. The alerts it raised are kept.
+//	@Tags		Audit & Compliance
+//	@Produce	json
+//	@Param		id		path	string	true	"Organization ID"
+//	@Param		rule_id	path	string	true	"Security rule ID"
+//	@Success	200	{object}	SuccessResponse	"Security rule deleted"
+//	@Failure	404	{object}	ErrorResponse	"Security rule not found"
+//	@Security	BearerAuth
+//	@Router		/organizations/{id}/security-rules/{rule_id} [delete]
+func (h *AuditHandler) DeleteSecurityRule(c *fiber.Ctx) error {
+	id, organizationID := c.Params("rule_id"), c.Params("id")
+	if err := h.queries.Audit.WithContext(c.Context()).DeleteSecurityRule(id, organizationID); err != nil {
+		return h.securityError(c, err, "Security rule not found", "Failed to delete security rule")
+	}
+	h.logSecurityChange(c, "delete_security_rule", organizationID, "security_rule", id)
+	return apiSuccess(c, fiber.StatusOK, "Security rule deleted", fiber.Map{"id": id})
+}
+
+// ListSecurityAlerts returns the alerts raised in the organization
+//
+//	@Summary	List security alerts
+//	@Description	List the alerts raised by the organization's security rules, the most recent first.
+//	@Tags		Audit & Compliance
+//	@Produce	json
+//	@Param		id		path	string	true	"Organization ID"
+//	@Param		status	query	string	false	"open or acknowledged"
+//	@Param		limit	query	int		false	"Number of alerts to return (default: 20, max: 100)"
+//	@Param		cursor	query	string	false	"Opaque cursor from next_cursor of the previous page"
+//	@Success	200	{object}	SuccessResponse	"Security alerts retrieved"
+//	@Failure	400	{object}	ErrorResponse	"Invalid query parameters"
+//	@Failure	403	{object}	ErrorResponse	"Organization admin required"
+//	@Security	BearerAuth
+//	@Router		/organizations/{id}/security-alerts [get]
+func (h *AuditHandler) ListSecurityAlerts(c *fiber.Ctx) error {
+	status := c.Query("status")
+	if status != "" && status != "open" && status != "acknowledged" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "status must be open or acknowledged")
+	}
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Limit must be between 1 and 100")
+	}
+
+	params := queries.ListParams{Limit: limit, Offset: c.QueryInt("offset", 0), Cursor: c.Query("cursor")}
+	result, err := h.queries.Audit.WithContext(c.Context()).ListSecurityAlerts(params, c.Params("id"), status)
+	if err != nil {
+		if isInvalidCursorErr(err) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid pagination cursor")
+		}
+		h.logger.Error("Failed to list security alerts: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve security alerts")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Security alerts retrieved", result)
+}
+
+// GetSecurityAlert returns an alert raised in the organization
+//
+//	@Summary	Get security alert
+//	@Tags		Audit & Compliance
+//	@Produce	json
+//	@Param		id			path	string	true	"Organization ID"
+//	@Param		alert_id	path	string	true	"Security alert ID"
+//	@Success	200	{object}	models.SecurityAlert	"Security alert retrieved"
+//	@Failure	404	{object}	ErrorResponse	"Security alert not found"
+//	@Security	BearerAuth
+//	@Router		/organizations/{id}/security-alerts/{alert_id} [get]
+func (h *AuditHandler) GetSecurityAlert(c *fiber.Ctx) error {
+	alert, err := h.queries.Audit.WithContext(c.Context()).GetSecurityAlert(c.Params("alert_id"), c.Params("id"))
+	if err != nil {
+		return h.securityError(c, err, "Security alert not found", "Failed to retrieve security alert")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Security alert retrieved", alert)
+}
+
+// AcknowledgeSecurityAlert marks an alert as handled
+//
+//	@Summary	Acknowledge security alert
+//	@Description	Mark an open alert as handled, with an optional note on what was done.
+//	@Tags		Audit & Compliance
+//	@Accept		json
+//	@Produce	json
+//	@Param		id			path	string	true	"Organization ID"
+//	@Param		alert_id	path	string	true	"Security alert ID"
+//	@Param		request		body	AcknowledgeSecurityAlertRequest	false	"Note"
+//	@Success	200	{object}	models.SecurityAlert	"Security alert acknowledged"
+//	@Failure	404	{object}	ErrorResponse	"Security alert not found"
+//	@Failure	409	{object}	ErrorResponse	"Security alert already acknowledged"
+//	@Security	BearerAuth
+//	@Router		/organizations/{id}/security-alerts/{alert_id}/acknowledge [post]
+func (h *AuditHandler) AcknowledgeSecurityAlert(c *fiber.Ctx) error {
+	var req AcknowledgeSecurityAlertRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+		}
+	}
+	if len(req.Note) > 2000 {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "note must be at most 2000 characters")
+	}
+
+	userID := c.Locals("user_id").(string)
+	alert, err := h.queries.Audit.WithContext(c.Context()).AcknowledgeSecurityAlert(c.Params("alert_id"), c.Params("id"), userID, strings.TrimSpace(req.Note))
+	if err != nil {
+		if isConflictErr(err) {
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "Security alert already acknowledged")
+		}
+		return h.securityError(c, err, "Security alert not found", "Failed to acknowledge security alert")
+	}
+
+	h.logSecurityChange(c, "acknowledge_security_alert", alert.OrganizationID, "security_alert", alert.ID)
+	return apiSuccess(c, fiber.StatusOK, "Security alert acknowledged", alert)
+}
+
+func (h *AuditHandler) securityError(c *fiber.Ctx, err error, notFound, message string) error {
+	if isNotFoundErr(err) {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, notFound)
+	}
+	h.logger.Error("%s: %v", message, err)
+	return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, message)
+}
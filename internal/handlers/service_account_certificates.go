@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/middleware"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+)
+
+// AddServiceAccountCertificateRequest is the body of POST
+// /service-accounts/{id}/certificates
+type AddServiceAccountCertificateRequest struct {
+	Name string `json:"name"`
+	// Certificate is the PEM encoded client certificate; only its public
+	// part is needed
+	Certificate string `json:"certificate"`
+}
+
+// SetEnterpriseAuthTiers sets the billing tiers whose organizations may
+// register client certificates (ENTERPRISE_AUTH_TIERS)
+func (h *UserHandler) SetEnterpriseAuthTiers(tiers []string) {
+	h.enterpriseTiers = tiers
+}
+
+// AddServiceAccountCertificate registers a client certificate for a
+// service account
+//
+//	@Summary		Register client certificate
+//	@Description	Pins a client certificate to the service account by its SHA-256 fingerprint. The service account then authenticates by presenting it in the TLS handshake, when the server terminates TLS with MTLS_CLIENT_AUTH. The certificate is not verified against a CA. Only organizations of the billing tiers in ENTERPRISE_AUTH_TIERS may register certificates.
+//	@Tags			Service Accounts
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		string												true	"Service account ID"
+//	@Param			certificate	body		AddServiceAccountCertificateRequest					true	"PEM certificate"
+//	@Success		201			{object}	SuccessResponse{data=models.ServiceAccountCertificate}	"Certificate registered"
+//	@Failure		400			{object}	ErrorResponse										"Not a valid or current certificate"
+//	@Failure		403			{object}	ErrorResponse										"Not available on the organization's plan"
+//	@Failure		404			{object}	ErrorResponse										"Service account not found"
+//	@Failure		409			{object}	ErrorResponse										"Certificate already registered"
+//	@Failure		500			{object}	ErrorResponse										"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/service-accounts/{id}/certificates [post]
+func (h *UserHandler) AddServiceAccountCertificate(c *fiber.Ctx) error {
+	organizationID := c.Locals("organization_id").(string)
+	if ok, err := h.enterpriseAuthAllowed(c, organizationID); !ok {
+		return err
+	}
+
+	var req AddServiceAccountCertificateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+	}
+	block, _ := pem.Decode([]byte(req.Certificate))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "certificate must be a PEM encoded certificate")
+	}
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "certificate could not be parsed", err.Error())
+	}
+	if time.Now().After(parsed.NotAfter) {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "certificate has expired")
+	}
+
+	cert := &models.ServiceAccountCertificate{
+		ID:               uuid.NewString(),
+		OrganizationID:   organizationID,
+		ServiceAccountID: c.Params("id"),
+		Name:             strings.TrimSpace(req.Name),
+		Fingerprint:      middleware.CertificateFingerprint(parsed),
+		Subject:          parsed.Subject.String(),
+		NotBefore:        parsed.NotBefore,
+		NotAfter:         parsed.NotAfter,
+	}
+	if userID, ok := c.Locals("user_id").(string); ok {
+		cert.CreatedBy = userID
+	}
+	if err := h.queries.User.AddServiceAccountCertificate(cert); err != nil {
+		switch {
+		case isNotFoundErr(err):
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Service account not found")
+		case errors.Is(err, queries.ErrCertificateRegistered):
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "Certificate is already registered")
+		}
+		h.logger.Error("Failed to register certificate: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to register certificate")
+	}
+
+	auditChange(c, h.audit, organizationID, "service_account_certificate_add", "service_account_certificate", cert.ID, nil, cert)
+	return apiSuccess(c, fiber.StatusCreated, "Certificate registered successfully", cert)
+}
+
+// ListServiceAccountCertificates lists the client certificates of a
+// service account
+//
+//	@Summary		List client certificates
+//	@Description	Lists the client certificates registered for the service account
+//	@Tags			Service Accounts
+//	@Produce		json
+//	@Param			id	path		string													true	"Service account ID"
+//	@Success		200	{object}	SuccessResponse{data=[]models.ServiceAccountCertificate}	"Certificates"
+//	@Failure		500	{object}	ErrorResponse											"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/service-accounts/{id}/certificates [get]
+func (h *UserHandler) ListServiceAccountCertificates(c *fiber.Ctx) error {
+	organizationID := c.Locals("organization_id").(string)
+	certs, err := h.queries.User.ListServiceAccountCertificates(c.Params("id"), organizationID)
+	if err != nil {
+		h.logger.Error("Failed to list certificates: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve certificates")
+	}
+	return apiSuccess(c, fiber.StatusOK, "Certificates retrieved successfully", certs)
+}
+
+// DeleteServiceAccountCertificate removes a client certificate
+//
+//	@Summary		Remove client certificate
+//	@Description	Removes a client certificate; the service account can no longer authenticate with it
+//	@Tags			Service Accounts
+//	@Produce		json
+//	@Param			id		path		string			true	"Service account ID"
+//	@Param			cert_id	path		string			true	"Certificate ID"
+//	@Success		200		{object}	SuccessResponse	"Certificate removed"
+//	@Failure		404		{object}	ErrorResponse	"Certificate not found"
+//	@Failure		500		{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/service-accounts/{id}/certificates/{cert_id} [delete]
+func (h *UserHandler) DeleteServiceAccountCertificate(c *fiber.Ctx) error {
+	saID, certID := c.Params("id"), c.Params("cert_id")
+	organizationID := c.Locals("organization_id").(string)
+	if err := h.queries.User.DeleteServiceAccountCertificate(saID, certID, organizationID); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Certificate not found")
+		}
+		h.logger.Error("Failed to remove certificate: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to remove certificate")
+	}
+
+	auditChange(c, h.audit, organizationID, "service_account_certificate_delete", "service_account_certificate", certID, fiber.Map{"service_account_id": saID}, nil)
+	return apiSuccess(c, fiber.StatusOK, "Certificate removed successfully", fiber.Map{"service_account_id": saID, "certificate_id": certID})
+}
+
+// enterpriseAuthAllowed refuses organizations outside
+// ENTERPRISE_AUTH_TIERS; when it returns false the response is written
+func (h *UserHandler) enterpriseAuthAllowed(c *fiber.Ctx, organizationID string) (bool, error) {
+	org, err := h.queries.Organization.GetOrganization(organizationID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return false, apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization not found")
+		}
+		h.logger.Error("Failed to get organization: %v", err)
+		return false, apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve organization")
+	}
+	if !services.EnterpriseAuthAllowed(h.enterpriseTiers, org.BillingTier) {
+		return false, apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Client certificates are not available on the organization's plan")
+	}
+	return true, nil
+}
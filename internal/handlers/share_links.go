@@ -0,0 +1,644 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/database"
+	"github.com/the-monkeys/monkeys-identity/internal/middleware"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+	"github.com/the-monkeys/monkeys-identity/internal/signing"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+const (
+	// defaultShareLinkTTL and maxShareLinkTTL bound how long a share link
+	// can be redeemed
+	defaultShareLinkTTL = 7 * 24 * time.Hour
+	maxShareLinkTTL     = 90 * 24 * time.Hour
+	// shareSessionTTL is how long the access granted by redeeming a link
+	// lasts, unless the link expires first
+	shareSessionTTL = time.Hour
+
+	// shareLinkTokenType and shareSessionTokenType tell share links and the
+	// sessions opened with them apart from other tokens signed with the
+	// same keys
+	shareLinkTokenType    = "share_link"
+	shareSessionTokenType = "share_session"
+
+	// shareSessionHeader carries the token returned by redemption
+	shareSessionHeader = "X-Share-Token"
+)
+
+// ShareLinkHandler lets owners of resources and content items mint links
+// that give whoever holds them access for a while, and share them with
+// guests outside the organization, and serves that access. Link tokens are
+// signed; what can change after minting, revocation and the number of uses,
+// is kept in share_links.
+type ShareLinkHandler struct {
+	queries *queries.Queries
+	keys    *signing.KeyManager
+	access  services.AccessLog
+	email   services.EmailService
+	logger  *logger.Logger
+}
+
+// NewShareLinkHandler creates a ShareLinkHandler. access may be nil to keep
+// shared accesses out of the resource access log.
+func NewShareLinkHandler(q *queries.Queries, keys *signing.KeyManager, access services.AccessLog, l *logger.Logger) *ShareLinkHandler {
+	return &ShareLinkHandler{queries: q, keys: keys, access: access, logger: l}
+}
+
+// CreateResourceLink
+//
+//	@Summary      Create resource share link
+//	@Description  Mint a link that gives whoever holds it read access to the resource until expires_at (default 7 days, at most 90), at most max_uses times when set. The token is returned only here; redeem it at /public/share-links/redeem.
+//	@Tags         Resource Management
+//	@Accept       json
+//	@Produce      json
+//	@Param        id       path  string  true  "Resource ID"
+//	@Param        request  body  object{access_level=string,expires_at=string,max_uses=int}  false  "Link options"
+//	@Success      201  {object}  SuccessResponse{data=object{link=models.ShareLink,token=string}}  "Share link created"
+//	@Failure      400  {object}  ErrorResponse  "Invalid options"
+//	@Failure      404  {object}  ErrorResponse  "Resource not found"
+//	@Failure      500  {object}  ErrorResponse  "Internal server error"
+//	@Security     BearerAuth
+//	@Router       /resources/{id}/share-links [post]
+func (h *ShareLinkHandler) CreateResourceLink(c *fiber.Ctx) error {
+	resourceID := c.Params("id")
+	orgID := c.Locals("organization_id").(string)
+	if _, err := h.queries.Resource.WithContext(c.Context()).GetResource(resourceID, orgID); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Resource not found")
+		}
+		h.logger.Error("get resource for share link: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create share link")
+	}
+	return h.create(c, queries.AccessLogResource, resourceID)
+}
+
+// CreateContentLink
+//
+//	@Summary	Create content share link
+//	@Description	Mint a link that gives whoever holds it read or write access to the content item until expires_at (default 7 days, at most 90), at most max_uses times when set. Owner only. The token is returned only here; redeem it at /public/share-links/redeem.
+//	@Tags		Content
+//	@Accept		json
+//	@Produce	json
+//	@Param		id		path	string	true	"Content ID"
+//	@Param		request	body	object{access_level=string,expires_at=string,max_uses=int}	false	"Link options"
+//	@Success	201	{object}	object	"Share link created"
+//	@Failure	400	{object}	object	"Invalid options"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	404	{object}	object	"Not found"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/share-links [post]
+func (h *ShareLinkHandler) CreateContentLink(c *fiber.Ctx) error {
+	if responded, err := h.requireContentOwner(c); responded {
+		return err
+	}
+	return h.create(c, queries.AccessLogContent, c.Params("id"))
+}
+
+func (h *ShareLinkHandler) create(c *fiber.Ctx, resourceType, resourceID string) error {
+	var req struct {
+		AccessLevel string `json:"access_level"`
+		ExpiresAt   string `json:"expires_at"`
+		MaxUses     *int   `json:"max_uses"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to parse request body")
+		}
+	}
+	if req.AccessLevel == "" {
+		req.AccessLevel = "read"
+	}
+	switch {
+	case req.AccessLevel != "read" && req.AccessLevel != "write":
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "access_level must be read or write")
+	case req.AccessLevel == "write" && resourceType != queries.AccessLogContent:
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Resource share links can only grant read access")
+	}
+	now := time.Now()
+	expiresAt := now.Add(defaultShareLinkTTL)
+	if req.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "expires_at must be RFC3339")
+		}
+		if !t.After(now) || t.Sub(now) > maxShareLinkTTL {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "expires_at must be in the future and within 90 days")
+		}
+		expiresAt = t
+	}
+	if req.MaxUses != nil && *req.MaxUses < 1 {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "max_uses must be at least 1")
+	}
+
+	userID := c.Locals("user_id").(string)
+	link := &models.ShareLink{
+		OrganizationID: c.Locals("organization_id").(string),
+		ResourceType:   resourceType,
+		ResourceID:     resourceID,
+		AccessLevel:    req.AccessLevel,
+		CreatedBy:      &userID,
+		ExpiresAt:      expiresAt,
+		MaxUses:        req.MaxUses,
+	}
+	if err := h.queries.Resource.WithContext(c.Context()).CreateShareLink(link); err != nil {
+		h.logger.Error("create share link: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create share link")
+	}
+	token, err := h.keys.Sign(jwt.MapClaims{
+		"sub":             link.ID,
+		"organization_id": link.OrganizationID,
+		"resource_type":   link.ResourceType,
+		"resource_id":     link.ResourceID,
+		"access_level":    link.AccessLevel,
+		"type":            shareLinkTokenType,
+		"aud":             tokenAudience(shareLinkTokenType),
+		"iat":             now.Unix(),
+		"exp":             link.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		h.logger.Error("sign share link %s: %v", link.ID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create share link")
+	}
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{Status: fiber.StatusCreated, Message: "Share link created", Data: fiber.Map{
+		"link": link, "token": token,
+	}})
+}
+
+// ListResourceLinks
+//
+//	@Summary      List resource share links
+//	@Description  List the share links of the resource with their use counts, including revoked and expired ones
+//	@Tags         Resource Management
+//	@Produce      json
+//	@Param        id  path  string  true  "Resource ID"
+//	@Success      200  {object}  SuccessResponse{data=object{items=[]models.ShareLink}}  "Share links retrieved"
+//	@Failure      500  {object}  ErrorResponse  "Internal server error"
+//	@Security     BearerAuth
+//	@Router       /resources/{id}/share-links [get]
+func (h *ShareLinkHandler) ListResourceLinks(c *fiber.Ctx) error {
+	return h.list(c, queries.AccessLogResource)
+}
+
+// ListContentLinks
+//
+//	@Summary	List content share links
+//	@Description	List the share links of the content item with their use counts, including revoked and expired ones. Owner only.
+//	@Tags		Content
+//	@Produce	json
+//	@Param		id	path	string	true	"Content ID"
+//	@Success	200	{object}	object	"Share links"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/share-links [get]
+func (h *ShareLinkHandler) ListContentLinks(c *fiber.Ctx) error {
+	if responded, err := h.requireContentOwner(c); responded {
+		return err
+	}
+	return h.list(c, queries.AccessLogContent)
+}
+
+func (h *ShareLinkHandler) list(c *fiber.Ctx, resourceType string) error {
+	links, err := h.queries.Resource.WithContext(c.Context()).ListShareLinks(c.Locals("organization_id").(string), resourceType, c.Params("id"))
+	if err != nil {
+		h.logger.Error("list share links: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list share links")
+	}
+	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Share links retrieved", Data: fiber.Map{"items": links}})
+}
+
+// RevokeResourceLink
+//
+//	@Summary      Revoke resource share link
+//	@Description  Revoke a share link of the resource. It can no longer be redeemed and the sessions opened with it end.
+//	@Tags         Resource Management
+//	@Produce      json
+//	@Param        id       path  string  true  "Resource ID"
+//	@Param        link_id  path  string  true  "Share link ID"
+//	@Success      200  {object}  SuccessResponse  "Share link revoked"
+//	@Failure      404  {object}  ErrorResponse  "Share link not found or already revoked"
+//	@Failure      500  {object}  ErrorResponse  "Internal server error"
+//	@Security     BearerAuth
+//	@Router       /resources/{id}/share-links/{link_id} [delete]
+func (h *ShareLinkHandler) RevokeResourceLink(c *fiber.Ctx) error {
+	return h.revoke(c, queries.AccessLogResource)
+}
+
+// RevokeContentLink
+//
+//	@Summary	Revoke content share link
+//	@Description	Revoke a share link of the content item. It can no longer be redeemed and the sessions opened with it end. Owner only.
+//	@Tags		Content
+//	@Produce	json
+//	@Param		id		path	string	true	"Content ID"
+//	@Param		link_id	path	string	true	"Share link ID"
+//	@Success	200	{object}	object	"Share link revoked"
+//	@Failure	403	{object}	object	"Forbidden"
+//	@Failure	404	{object}	object	"Not found"
+//	@Security	BearerAuth
+//	@Router		/content/{id}/share-links/{link_id} [delete]
+func (h *ShareLinkHandler) RevokeContentLink(c *fiber.Ctx) error {
+	if responded, err := h.requireContentOwner(c); responded {
+		return err
+	}
+	return h.revoke(c, queries.AccessLogContent)
+}
+
+func (h *ShareLinkHandler) revoke(c *fiber.Ctx, resourceType string) error {
+	linkID := c.Params("link_id")
+	err := h.queries.Resource.WithContext(c.Context()).RevokeShareLink(linkID, c.Locals("organization_id").(string),
+		resourceType, c.Params("id"), c.Locals("user_id").(string))
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Share link not found or already revoked")
+		}
+		h.logger.Error("revoke share link %s: %v", linkID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to revoke share link")
+	}
+	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Share link revoked", Data: fiber.Map{"id": linkID, "revoked": true}})
+}
+
+// RedeemShareLink
+//
+//	@Summary      Redeem share link
+//	@Description  Redeem a share link token, counting one use. Returns the shared item and a session token that gives the link's access to it for an hour, or until the link expires or is revoked. Send it as the X-Share-Token header to /public/shared. No authentication required.
+//	@Tags         Sharing
+//	@Accept       json
+//	@Produce      json
+//	@Param        request  body  object{token=string}  true  "Share link token"
+//	@Success      200  {object}  SuccessResponse{data=object{session_token=string,expires_at=string,resource_type=string,resource_id=string,access_level=string,item=object}}  "Share link redeemed"
+//	@Failure      400  {object}  ErrorResponse  "Missing token"
+//	@Failure      401  {object}  ErrorResponse  "Invalid, expired, revoked or used up link (invalid_token, token_expired, token_revoked)"
+//	@Failure      404  {object}  ErrorResponse  "The shared item no longer exists"
+//	@Router       /public/share-links/redeem [post]
+func (h *ShareLinkHandler) RedeemShareLink(c *fiber.Ctx) error {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "token is required")
+	}
+	claims, responded, err := h.parseToken(c, req.Token, shareLinkTokenType)
+	if responded {
+		return err
+	}
+	linkID, _ := claims["sub"].(string)
+	orgID, _ := claims["organization_id"].(string)
+
+	link, err := h.queries.Resource.WithContext(c.Context()).RedeemShareLink(linkID, orgID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not usable") {
+			return apiError(c, fiber.StatusUnauthorized, apierror.CodeTokenRevoked, "Share link was revoked, has expired or was used up")
+		}
+		h.logger.Error("redeem share link %s: %v", linkID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to redeem share link")
+	}
+	return h.openSession(c, linkAccess(link), shareSessionTokenType, "Share link redeemed")
+}
+
+// openSession responds to a redemption with the shared item and a session
+// token of the given type giving its access for shareSessionTTL, or until
+// the grant expires
+func (h *ShareLinkHandler) openSession(c *fiber.Ctx, a *sharedAccess, tokenType, message string) error {
+	item, responded, err := h.loadItem(c, a)
+	if responded {
+		return err
+	}
+
+	expiresAt := time.Now().Add(shareSessionTTL)
+	if a.ExpiresAt.Before(expiresAt) {
+		expiresAt = a.ExpiresAt
+	}
+	session, err := h.keys.Sign(jwt.MapClaims{
+		"sub":             a.ID,
+		"organization_id": a.OrganizationID,
+		"resource_type":   a.ResourceType,
+		"resource_id":     a.ResourceID,
+		"access_level":    a.AccessLevel,
+		"type":            tokenType,
+		"aud":             tokenAudience(tokenType),
+		"jti":             uuid.New().String(),
+		"iat":             time.Now().Unix(),
+		"exp":             expiresAt.Unix(),
+	})
+	if err != nil {
+		h.logger.Error("sign %s for %s: %v", tokenType, a.ID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to open shared item")
+	}
+	h.record(c, a, "redeem")
+	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: message, Data: fiber.Map{
+		"session_token": session,
+		"expires_at":    expiresAt,
+		"resource_type": a.ResourceType,
+		"resource_id":   a.ResourceID,
+		"access_level":  a.AccessLevel,
+		"item":          item,
+	}})
+}
+
+// GetShared
+//
+//	@Summary      Get shared item
+//	@Description  Retrieve the item a redeemed share link or guest share gives access to. No authentication required beyond the session token.
+//	@Tags         Sharing
+//	@Produce      json
+//	@Param        X-Share-Token  header  string  true  "Session token returned by redemption"
+//	@Success      200  {object}  SuccessResponse  "Shared item retrieved"
+//	@Failure      401  {object}  ErrorResponse  "Invalid or expired session, or the share was revoked"
+//	@Failure      404  {object}  ErrorResponse  "The shared item no longer exists"
+//	@Router       /public/shared [get]
+func (h *ShareLinkHandler) GetShared(c *fiber.Ctx) error {
+	a, responded, err := h.session(c)
+	if responded {
+		return err
+	}
+	item, responded, err := h.loadItem(c, a)
+	if responded {
+		return err
+	}
+	h.record(c, a, "read")
+	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Shared item retrieved", Data: fiber.Map{
+		"resource_type": a.ResourceType,
+		"access_level":  a.AccessLevel,
+		"item":          item,
+	}})
+}
+
+// UpdateShared
+//
+//	@Summary      Update shared content
+//	@Description  Edit the title, body or summary of a content item through a share link or guest share granting write access. The edit is recorded as a revision by whoever created the link or share. Like PUT /content/{id}, the update must name the version it is based on, as If-Match or lock_version.
+//	@Tags         Sharing
+//	@Accept       json
+//	@Produce      json
+//	@Param        X-Share-Token  header  string  true   "Session token returned by redemption"
+//	@Param        If-Match       header  string  false  "ETag of the version the update is based on; * for any"
+//	@Param        request        body    object{title=string,body=string,summary=string,lock_version=int}  true  "Updated fields"
+//	@Success      200  {object}  SuccessResponse  "Shared content updated"
+//	@Failure      401  {object}  ErrorResponse  "Invalid or expired session, or the share was revoked"
+//	@Failure      403  {object}  ErrorResponse  "The share only grants read access"
+//	@Failure      409  {object}  ErrorResponse  "Content changed since that version"
+//	@Failure      428  {object}  ErrorResponse  "No version given"
+//	@Router       /public/shared [put]
+func (h *ShareLinkHandler) UpdateShared(c *fiber.Ctx) error {
+	a, responded, err := h.session(c)
+	if responded {
+		return err
+	}
+	if a.AccessLevel != "write" || a.ResourceType != queries.AccessLogContent || a.EditedBy == nil {
+		h.record(c, a, "update", false)
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "This share only grants read access")
+	}
+
+	var req struct {
+		Title       *string `json:"title"`
+		Body        *string `json:"body"`
+		Summary     *string `json:"summary"`
+		LockVersion *int    `json:"lock_version"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid JSON body")
+	}
+	version, err := requiredVersion(c, req.LockVersion)
+	if version < 0 {
+		return err
+	}
+	item, err := h.queries.Content.WithContext(c.Context()).GetContent(a.ResourceID, a.OrganizationID)
+	if err != nil {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
+	}
+	if version > 0 {
+		item.LockVersion = version
+	}
+	if req.Title != nil {
+		item.Title = *req.Title
+		item.Slug = slugify(*req.Title)
+	}
+	if req.Body != nil {
+		item.Body = *req.Body
+	}
+	if req.Summary != nil {
+		item.Summary = *req.Summary
+	}
+
+	// Public routes run without a tenant; scope the write to the share's
+	ctx := database.WithTenant(c.UserContext(), a.OrganizationID)
+	err = h.queries.Transact(ctx, func(q *queries.Queries) error {
+		if err := q.Content.UpdateContent(item, a.OrganizationID); err != nil {
+			return err
+		}
+		_, err := q.Content.CreateRevision(item.ID, a.OrganizationID, *a.EditedBy, nil)
+		return err
+	})
+	if err != nil {
+		if stale, resp := staleVersion(c, err, "Content was changed since the version this update is based on"); stale {
+			return resp
+		}
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
+		}
+		h.logger.Error("update shared content %s: %v", item.ID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update content")
+	}
+	h.record(c, a, "update")
+	c.Set(fiber.HeaderETag, versionETag(item.LockVersion))
+	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Shared content updated", Data: item})
+}
+
+// requireContentOwner responds unless the caller owns the content item
+// addressed by the route
+func (h *ShareLinkHandler) requireContentOwner(c *fiber.Ctx) (bool, error) {
+	_, responded, err := h.contentOwned(c)
+	return responded, err
+}
+
+// contentOwned returns the content item addressed by the route, responding
+// unless the caller owns it
+func (h *ShareLinkHandler) contentOwned(c *fiber.Ctx) (*models.ContentItem, bool, error) {
+	item, err := h.queries.Content.WithContext(c.Context()).GetContent(c.Params("id"), c.Locals("organization_id").(string))
+	if err != nil {
+		return nil, true, apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Content not found")
+	}
+	if item.OwnerID != c.Locals("user_id").(string) {
+		return nil, true, apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only the content owner can manage how it is shared")
+	}
+	return item, false, nil
+}
+
+// parseToken verifies a share link, guest or session token of one of the
+// given types
+func (h *ShareLinkHandler) parseToken(c *fiber.Ctx, raw string, tokenTypes ...string) (jwt.MapClaims, bool, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(raw, claims, h.keys.Keyfunc)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, true, apiError(c, fiber.StatusUnauthorized, apierror.CodeTokenExpired, "Share link has expired")
+	}
+	if err != nil || !token.Valid {
+		return nil, true, apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid share link")
+	}
+	t, _ := claims["type"].(string)
+	for _, tokenType := range tokenTypes {
+		if t == tokenType && audienceAllowed(claims, tokenType) {
+			return claims, false, nil
+		}
+	}
+	return nil, true, apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid share link")
+}
+
+// tokenAudience is the audience of the tokens of a type that are not access
+// tokens. They are signed with the same keys, and verifiers that check the
+// audience, like pkg/authfiber, refuse them as API credentials.
+func tokenAudience(tokenType string) string {
+	return "urn:monkeys-identity:" + tokenType
+}
+
+// audienceAllowed reports whether claims carry the audience of tokenType.
+// Tokens issued before audiences were set have none and are accepted until
+// they expire, by their type alone.
+func audienceAllowed(claims jwt.MapClaims, tokenType string) bool {
+	aud, err := claims.GetAudience()
+	if err != nil {
+		return false
+	}
+	if len(aud) == 0 {
+		return true
+	}
+	for _, a := range aud {
+		if a == tokenAudience(tokenType) {
+			return true
+		}
+	}
+	return false
+}
+
+// sharedAccess is what a share session gives access to: one item, through
+// a share link or a share with a guest
+type sharedAccess struct {
+	// ID names the link or guest share
+	ID             string
+	OrganizationID string
+	ResourceType   string
+	ResourceID     string
+	AccessLevel    string
+	ExpiresAt      time.Time
+	// EditedBy is the user edits are attributed to, whoever created the
+	// link or share
+	EditedBy *string
+	// PrincipalID and PrincipalType name the holder in the access log
+	PrincipalID   string
+	PrincipalType string
+}
+
+func linkAccess(link *models.ShareLink) *sharedAccess {
+	return &sharedAccess{
+		ID:             link.ID,
+		OrganizationID: link.OrganizationID,
+		ResourceType:   link.ResourceType,
+		ResourceID:     link.ResourceID,
+		AccessLevel:    link.AccessLevel,
+		ExpiresAt:      link.ExpiresAt,
+		EditedBy:       link.CreatedBy,
+		PrincipalID:    link.ID,
+		PrincipalType:  "share_link",
+	}
+}
+
+func guestAccess(share *models.ExternalShare) *sharedAccess {
+	return &sharedAccess{
+		ID:             share.ID,
+		OrganizationID: share.OrganizationID,
+		ResourceType:   share.ResourceType,
+		ResourceID:     share.ResourceID,
+		AccessLevel:    share.AccessLevel,
+		ExpiresAt:      share.ExpiresAt,
+		EditedBy:       share.SharedBy,
+		PrincipalID:    share.GuestID,
+		PrincipalType:  "guest",
+	}
+}
+
+// session resolves the share session of the request to what it gives
+// access to. The link or guest share must not have been revoked since.
+func (h *ShareLinkHandler) session(c *fiber.Ctx) (*sharedAccess, bool, error) {
+	raw := c.Get(shareSessionHeader)
+	if raw == "" {
+		return nil, true, apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, shareSessionHeader+" header required")
+	}
+	claims, responded, err := h.parseToken(c, raw, shareSessionTokenType, guestSessionTokenType)
+	if responded {
+		return nil, true, err
+	}
+	id, _ := claims["sub"].(string)
+	orgID, _ := claims["organization_id"].(string)
+
+	var a *sharedAccess
+	revoked := false
+	if t, _ := claims["type"].(string); t == guestSessionTokenType {
+		var share *models.ExternalShare
+		if share, err = h.queries.Resource.WithContext(c.Context()).GetExternalShare(id, orgID); err == nil {
+			a, revoked = guestAccess(share), share.RevokedAt != nil
+		}
+	} else {
+		var link *models.ShareLink
+		if link, err = h.queries.Resource.WithContext(c.Context()).GetShareLink(id, orgID); err == nil {
+			a, revoked = linkAccess(link), link.RevokedAt != nil
+		}
+	}
+	if err != nil && !isNotFoundErr(err) {
+		h.logger.Error("get share %s: %v", id, err)
+		return nil, true, apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to check share")
+	}
+	if err != nil || revoked {
+		return nil, true, apiError(c, fiber.StatusUnauthorized, apierror.CodeTokenRevoked, "Share was revoked")
+	}
+	return a, false, nil
+}
+
+// loadItem fetches the resource or content item a session gives access to
+func (h *ShareLinkHandler) loadItem(c *fiber.Ctx, a *sharedAccess) (interface{}, bool, error) {
+	var item interface{}
+	var err error
+	if a.ResourceType == queries.AccessLogContent {
+		item, err = h.queries.Content.WithContext(c.Context()).GetContent(a.ResourceID, a.OrganizationID)
+	} else {
+		item, err = h.queries.Resource.WithContext(c.Context()).GetResource(a.ResourceID, a.OrganizationID)
+	}
+	if err != nil {
+		if isNotFoundErr(err) {
+			return nil, true, apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "The shared item no longer exists")
+		}
+		h.logger.Error("load shared %s %s: %v", a.ResourceType, a.ResourceID, err)
+		return nil, true, apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to load shared item")
+	}
+	return item, false, nil
+}
+
+// record adds an access through a link or guest share to the resource
+// access log, as a success unless told otherwise
+func (h *ShareLinkHandler) record(c *fiber.Ctx, a *sharedAccess, action string, success ...bool) {
+	if h.access == nil {
+		return
+	}
+	h.access.Record(queries.ResourceAccessLog{
+		OrganizationID: a.OrganizationID,
+		ResourceType:   a.ResourceType,
+		ResourceID:     a.ResourceID,
+		UserID:         a.PrincipalID,
+		PrincipalType:  a.PrincipalType,
+		Action:         action,
+		IPAddress:      strings.Clone(middleware.ClientIP(c)),
+		UserAgent:      strings.Clone(c.Get(fiber.HeaderUserAgent)),
+		Success:        len(success) == 0 || success[0],
+	})
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/authz"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// validateSeparationOfDutiesPolicy checks an organization's SoD rules. A
+// rule needs a unique name and at least two distinct roles to keep apart.
+func validateSeparationOfDutiesPolicy(p *models.SeparationOfDutiesPolicy) error {
+	names := map[string]bool{}
+	for i, rule := range p.Rules {
+		name := strings.TrimSpace(rule.Name)
+		if name == "" {
+			return fmt.Errorf("rules[%d].name is required", i)
+		}
+		if names[strings.ToLower(name)] {
+			return fmt.Errorf("rule %q is defined twice", name)
+		}
+		names[strings.ToLower(name)] = true
+		roles := map[string]bool{}
+		for _, role := range rule.Roles {
+			if strings.TrimSpace(role) == "" {
+				return fmt.Errorf("rule %q names an empty role", name)
+			}
+			roles[strings.ToLower(role)] = true
+		}
+		if len(roles) < 2 {
+			return fmt.Errorf("rule %q must name at least two distinct roles", name)
+		}
+	}
+	return nil
+}
+
+// sodViolation responds 409 naming the first broken rule; the details carry
+// all of them
+func sodViolation(c *fiber.Ctx, conflicts []authz.SoDConflict) error {
+	first := conflicts[0]
+	return apiError(c, fiber.StatusConflict, apierror.CodeSoDViolation,
+		fmt.Sprintf("Violates separation-of-duties rule %q: roles %s cannot be held together", first.Rule, strings.Join(first.Roles, ", ")),
+		fiber.Map{"conflicts": conflicts})
+}
+
+// ListSoDViolations
+//
+//	@Summary      List separation-of-duties violations
+//	@Description  Report the users and service accounts of the organization that currently hold, directly or through a group, more than one role of a separation-of-duties rule. New assignments and group memberships breaking a rule are refused; this lists those made before the rule existed, for remediation. One item is returned per principal and broken rule.
+//	@Tags         Role Management
+//	@Produce      json
+//	@Success      200  {object}  SuccessResponse{data=object{items=[]models.SoDViolation,count=int}}  "Violations retrieved"
+//	@Failure      500  {object}  ErrorResponse    "Internal server error"
+//	@Security     BearerAuth
+//	@Router       /roles/sod-violations [get]
+func (h *RoleHandler) ListSoDViolations(c *fiber.Ctx) error {
+	organizationID := c.Locals("organization_id").(string)
+	policy, err := h.queries.Organization.WithContext(c.Context()).GetSeparationOfDutiesPolicy(organizationID)
+	if err != nil {
+		h.logger.Error("Get separation-of-duties policy of organization %s failed: %v", organizationID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list separation-of-duties violations")
+	}
+	violations := []models.SoDViolation{}
+	if policy != nil && len(policy.Rules) > 0 {
+		held, err := h.queries.Role.WithContext(c.Context()).ListHeldRoleNames(organizationID)
+		if err != nil {
+			h.logger.Error("List held roles of organization %s failed: %v", organizationID, err)
+			return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list separation-of-duties violations")
+		}
+		for _, p := range held {
+			for _, conflict := range authz.SoDConflicts(policy.Rules, p.Roles) {
+				violations = append(violations, models.SoDViolation{
+					Rule:          conflict.Rule,
+					PrincipalID:   p.PrincipalID,
+					PrincipalType: p.PrincipalType,
+					Roles:         conflict.Roles,
+				})
+			}
+		}
+	}
+	return c.JSON(SuccessResponse{Status: fiber.StatusOK, Message: "Separation-of-duties violations retrieved", Data: fiber.Map{
+		"items": violations, "count": len(violations),
+	}})
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -10,7 +11,11 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/events"
+	"github.com/the-monkeys/monkeys-identity/internal/middleware"
 	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/password"
 	"github.com/the-monkeys/monkeys-identity/internal/queries"
 	"github.com/the-monkeys/monkeys-identity/internal/services"
 	"github.com/the-monkeys/monkeys-identity/pkg/logger"
@@ -19,34 +24,62 @@ import (
 )
 
 type UserHandler struct {
-	queries *queries.Queries
-	logger  *logger.Logger
-	audit   services.AuditService
+	queries  *queries.Queries
+	logger   *logger.Logger
+	audit    services.AuditService
+	exports  services.DataExportService
+	emails   services.EmailValidationService  // set via SetEmailValidator after construction
+	events   events.Bus                       // set via SetEvents after construction
+	authz    services.AuthzService            // set via SetAuthz after construction
+	breaches services.BreachedPasswordService // set via SetBreachedPasswords after construction
+
+	enterpriseTiers []string // set via SetEnterpriseAuthTiers after construction
 }
 
-func NewUserHandler(queries *queries.Queries, logger *logger.Logger, audit services.AuditService) *UserHandler {
+func NewUserHandler(queries *queries.Queries, logger *logger.Logger, audit services.AuditService, exports services.DataExportService) *UserHandler {
 	return &UserHandler{
 		queries: queries,
 		logger:  logger,
 		audit:   audit,
+		exports: exports,
 	}
 }
 
+// SetEmailValidator injects the address checks applied to email changes.
+// Called from route setup.
+func (h *UserHandler) SetEmailValidator(emails services.EmailValidationService) {
+	h.emails = emails
+}
+
+// SetBreachedPasswords injects the breach screening applied to passwords
+// set by administrators and password changes. Called from route setup.
+func (h *UserHandler) SetBreachedPasswords(breaches services.BreachedPasswordService) {
+	h.breaches = breaches
+}
+
+// SetEvents injects the bus user and session changes are published on.
+// Called from route setup.
+func (h *UserHandler) SetEvents(bus events.Bus) {
+	h.events = bus
+}
+
+// SetAuthz injects the authorization service effective permissions are
+// resolved with. Called from route setup.
+func (h *UserHandler) SetAuthz(authz services.AuthzService) {
+	h.authz = authz
+}
+
 // Helper function to hash passwords
-func hashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hashedPassword), nil
+func hashPassword(plaintext string) (string, error) {
+	return password.Hash(plaintext)
 }
 
 // ensureAndAssignUserRole creates a "user" role for the org if it doesn't exist
 // and assigns it to the given user.
-func (h *UserHandler) ensureAndAssignUserRole(userID, orgID, assignedBy string) error {
+func ensureAndAssignUserRole(q *queries.Queries, userID, orgID, assignedBy string) error {
 	// Upsert the "user" role for this organization
 	roleID := ""
-	err := h.queries.Role.EnsureRoleByName("user", "Standard user with basic access", orgID, &roleID)
+	err := q.Role.EnsureRoleByName("user", "Standard user with basic access", orgID, &roleID)
 	if err != nil {
 		return fmt.Errorf("failed to ensure user role: %w", err)
 	}
@@ -59,7 +92,7 @@ func (h *UserHandler) ensureAndAssignUserRole(userID, orgID, assignedBy string)
 		PrincipalType: "user",
 		AssignedBy:    assignedBy,
 	}
-	return h.queries.Role.AssignRole(assignment, orgID)
+	return q.Role.AssignRole(assignment, orgID)
 }
 
 // ListUsers retrieves a paginated list of users
@@ -71,9 +104,19 @@ func (h *UserHandler) ensureAndAssignUserRole(userID, orgID, assignedBy string)
 //	@Produce		json
 //	@Param			page	query		int		false	"Page number (default: 1)"
 //	@Param			limit	query		int		false	"Items per page (default: 10, max: 100)"
+//	@Param			cursor	query		string	false	"Opaque cursor from next_cursor of the previous page; overrides offset"
 //	@Param			sort	query		string	false	"Sort field (default: created_at)"
 //	@Param			order	query		string	false	"Sort order: asc or desc (default: desc)"
+//	@Param			q		query		string	false	"Search username, email and display name"
+//	@Param			status	query		string	false	"Filter by status (active, suspended, archived)"
+//	@Param			role	query		string	false	"Filter by assigned role name"
+//	@Param			mfa_enabled		query	bool	false	"Filter by MFA enrollment"
+//	@Param			created_after	query	string	false	"Only users created at or after this time (RFC 3339 or YYYY-MM-DD)"
+//	@Param			created_before	query	string	false	"Only users created before this time (RFC 3339 or YYYY-MM-DD)"
+//	@Param			organization_id	query	string	false	"Organization to list (root only; defaults to the caller's organization)"
 //	@Success		200		{object}	SuccessResponse		"Successfully retrieved users list"
+//	@Failure		400		{object}	ErrorResponse			"Invalid filter"
+//	@Failure		403		{object}	ErrorResponse			"Organization not accessible"
 //	@Failure		500		{object}	ErrorResponse			"Internal server error"
 //	@Security		BearerAuth
 //	@Router			/users [get]
@@ -98,13 +141,30 @@ func (h *UserHandler) ListUsers(c *fiber.Ctx) error {
 		Offset: offset,
 		SortBy: sortBy,
 		Order:  order,
+		Cursor: c.Query("cursor"),
+	}
+
+	filter, resp := parseUserFilter(c)
+	if filter == nil {
+		return resp
 	}
 
 	organizationID := c.Locals("organization_id").(string)
-	result, err := h.queries.User.ListUsers(params, organizationID)
+	if orgID := c.Query("organization_id"); orgID != "" && orgID != organizationID {
+		tc := middleware.GetTenantContext(c)
+		if tc == nil || !tc.CanAccessOrg(orgID) {
+			return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Access denied: you do not have access to this organization")
+		}
+		organizationID = orgID
+	}
+
+	result, err := h.queries.User.ListUsers(params, organizationID, *filter)
 	if err != nil {
+		if isInvalidCursorErr(err) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid pagination cursor")
+		}
 		h.logger.Error("Failed to list users: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to retrieve users. Please try again later.")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve users. Please try again later.")
 	}
 
 	return c.JSON(fiber.Map{
@@ -116,10 +176,45 @@ func (h *UserHandler) ListUsers(c *fiber.Ctx) error {
 			"total":      result.Total,
 			"totalPages": result.TotalPages,
 			"hasMore":    result.HasMore,
+			"nextCursor": result.NextCursor,
 		},
 	})
 }
 
+// parseUserFilter reads the ListUsers search and filter query parameters.
+// On invalid input it returns a nil filter together with the error response.
+func parseUserFilter(c *fiber.Ctx) (*queries.UserFilter, error) {
+	filter := &queries.UserFilter{
+		Query:  strings.TrimSpace(c.Query("q")),
+		Status: c.Query("status"),
+		Role:   c.Query("role"),
+	}
+
+	switch filter.Status {
+	case "", "active", "suspended", "archived":
+	default:
+		return nil, apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "status must be one of active, suspended, archived")
+	}
+
+	if v := c.Query("mfa_enabled"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "mfa_enabled must be true or false")
+		}
+		filter.MFAEnabled = &enabled
+	}
+
+	var err error
+	if filter.CreatedAfter, err = parseTimeQuery(c, "created_after"); err != nil {
+		return nil, apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+	}
+	if filter.CreatedBefore, err = parseTimeQuery(c, "created_before"); err != nil {
+		return nil, apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+	}
+
+	return filter, nil
+}
+
 // CreateUserRequest is the request body for creating a new user.
 type CreateUserRequest struct {
 	Username    string `json:"username"`
@@ -149,27 +244,30 @@ func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 	var req CreateUserRequest
 
 	if err := c.BodyParser(&req); err != nil {
-		return apiError(c, fiber.StatusBadRequest, "invalid_request", "Invalid request body")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
 	}
 
 	// Validate required fields
 	req.Email = strings.TrimSpace(strings.ToLower(req.Email))
 	if req.Email == "" || req.Password == "" {
-		return apiError(c, fiber.StatusBadRequest, "validation_error", "Email and password are required")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Email and password are required")
 	}
 
 	// Check if user already exists
 	organizationID := c.Locals("organization_id").(string)
 	existingUser, err := h.queries.Auth.GetUserByEmail(req.Email, organizationID)
 	if err == nil && existingUser != nil {
-		return apiError(c, fiber.StatusConflict, "conflict", "A user with this email already exists in your organization")
+		return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "A user with this email already exists in your organization")
+	}
+	if refused, err := rejectBreachedPassword(c, h.breaches, organizationID, req.Password); refused {
+		return err
 	}
 
-	// Hash password using bcrypt
+	// Hash password
 	hashedPassword, err := hashPassword(req.Password)
 	if err != nil {
 		h.logger.Error("Failed to hash password: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to process user creation. Please try again.")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to process user creation. Please try again.")
 	}
 
 	// Create new user — always scope to the caller's org
@@ -187,21 +285,22 @@ func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 		UpdatedAt:      time.Now(),
 	}
 
-	if err := h.queries.User.CreateUser(user); err != nil {
+	// The user and their default "user" role are created together
+	err = h.queries.Transact(c.UserContext(), func(q *queries.Queries) error {
+		if err := q.User.CreateUser(user); err != nil {
+			return err
+		}
+		return ensureAndAssignUserRole(q, user.ID, callerOrgID, c.Locals("user_id").(string))
+	})
+	if err != nil {
 		h.logger.Error("Failed to create user: %v", err)
 		if strings.Contains(err.Error(), "unique_username_per_org") {
-			return apiError(c, fiber.StatusConflict, "conflict", "A user with this username already exists in your organization")
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "A user with this username already exists in your organization")
 		}
 		if strings.Contains(err.Error(), "unique_email_per_org") {
-			return apiError(c, fiber.StatusConflict, "conflict", "A user with this email already exists in your organization")
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "A user with this email already exists in your organization")
 		}
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to create user. Please try again.")
-	}
-
-	// Assign default "user" role — ensure the role exists for this org first
-	if err := h.ensureAndAssignUserRole(user.ID, callerOrgID, c.Locals("user_id").(string)); err != nil {
-		h.logger.Warn("Failed to assign default user role: %v", err)
-		// Non-fatal: user is created, role assignment is best-effort
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create user. Please try again.")
 	}
 
 	// Don't return password hash
@@ -217,6 +316,11 @@ func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 		Result:         "success",
 		Severity:       "MEDIUM",
 	})
+	publish(h.events, c, events.Event{
+		Type:    events.UserCreated,
+		Subject: user.ID,
+		Data:    map[string]interface{}{"email": user.Email, "username": user.Username, "source": "admin"},
+	})
 
 	return apiSuccess(c, fiber.StatusCreated, "User created successfully", user)
 }
@@ -237,17 +341,17 @@ func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 func (h *UserHandler) GetUser(c *fiber.Ctx) error {
 	userID := c.Params("id")
 	if userID == "" {
-		return apiError(c, fiber.StatusBadRequest, "invalid_request", "User ID is required")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "User ID is required")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
 	user, err := h.queries.User.GetUser(userID, organizationID)
 	if err != nil {
 		if isNotFoundErr(err) {
-			return apiError(c, fiber.StatusNotFound, "not_found", "User not found")
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found")
 		}
 		h.logger.Error("Failed to get user: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to retrieve user")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve user")
 	}
 
 	// Don't return password hash
@@ -274,7 +378,7 @@ func (h *UserHandler) GetUser(c *fiber.Ctx) error {
 func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 	userID := c.Params("id")
 	if userID == "" {
-		return apiError(c, fiber.StatusBadRequest, "invalid_request", "User ID is required")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "User ID is required")
 	}
 
 	var req struct {
@@ -286,7 +390,7 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 	}
 
 	if err := c.BodyParser(&req); err != nil {
-		return apiError(c, fiber.StatusBadRequest, "invalid_request", "Invalid request body")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
 	}
 
 	// Get existing user
@@ -294,17 +398,23 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 	user, err := h.queries.User.GetUser(userID, organizationID)
 	if err != nil {
 		if isNotFoundErr(err) {
-			return apiError(c, fiber.StatusNotFound, "not_found", "User not found")
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found")
 		}
 		h.logger.Error("Failed to get user for update: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to retrieve user")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve user")
 	}
 
 	// Update fields if provided
 	if req.Username != "" {
 		user.Username = req.Username
 	}
-	if req.Email != "" {
+	if req.Email = strings.TrimSpace(strings.ToLower(req.Email)); req.Email != "" && req.Email != user.Email {
+		if middleware.Impersonator(c) != "" {
+			return apiError(c, fiber.StatusForbidden, apierror.CodeImpersonationRestricted, "This action is not available while impersonating a user")
+		}
+		if refused, err := rejectEmail(c, h.emails, req.Email); refused {
+			return err
+		}
 		user.Email = req.Email
 	}
 	if req.DisplayName != "" {
@@ -322,9 +432,9 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 	if err := h.queries.User.UpdateUser(user, organizationID); err != nil {
 		h.logger.Error("Failed to update user: %v", err)
 		if isConflictErr(err) {
-			return apiError(c, fiber.StatusConflict, "conflict", "A user with that username or email already exists")
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "A user with that username or email already exists")
 		}
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to update user. Please try again.")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update user. Please try again.")
 	}
 
 	// Don't return password hash
@@ -352,7 +462,7 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 func (h *UserHandler) DeleteUser(c *fiber.Ctx) error {
 	userID := c.Params("id")
 	if userID == "" {
-		return apiError(c, fiber.StatusBadRequest, "invalid_request", "User ID is required")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "User ID is required")
 	}
 
 	// Check if user exists
@@ -360,22 +470,130 @@ func (h *UserHandler) DeleteUser(c *fiber.Ctx) error {
 	_, err := h.queries.User.GetUser(userID, organizationID)
 	if err != nil {
 		if isNotFoundErr(err) {
-			return apiError(c, fiber.StatusNotFound, "not_found", "User not found")
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found")
 		}
 		h.logger.Error("Failed to check user existence: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to delete user")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to delete user")
 	}
 
 	if err := h.queries.User.DeleteUser(userID, organizationID); err != nil {
 		h.logger.Error("Failed to delete user: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to delete user. Please try again.")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to delete user. Please try again.")
+	}
+
+	// Deleted users must not keep using existing sessions
+	if err := h.queries.User.RevokeUserSessions(userID, organizationID); err != nil {
+		h.logger.Warn("Failed to revoke sessions of deleted user %s: %v", userID, err)
 	}
 
+	h.audit.LogEvent(c.Context(), models.AuditEvent{
+		OrganizationID: organizationID,
+		PrincipalID:    utils.StringPtr(c.Locals("user_id").(string)),
+		PrincipalType:  utils.StringPtr("user"),
+		Action:         "delete_user",
+		ResourceType:   utils.StringPtr("user"),
+		ResourceID:     utils.StringPtr(userID),
+		Result:         "success",
+		Severity:       "critical",
+	})
+
 	h.logger.Info("User deleted successfully: %s", userID)
 
 	return apiSuccess(c, fiber.StatusOK, "User deleted successfully", nil)
 }
 
+// RestoreUser restores a soft-deleted user
+//
+//	@Summary		Restore user
+//	@Description	Restore a soft-deleted user whose data has not yet been purged
+//	@Tags			User Management
+//	@Produce		json
+//	@Param			id	path		string			true	"User ID"
+//	@Success		200	{object}	SuccessResponse	"User restored successfully"
+//	@Failure		400	{object}	ErrorResponse	"Invalid user ID"
+//	@Failure		404	{object}	ErrorResponse	"User not found, not deleted, or already purged"
+//	@Failure		409	{object}	ErrorResponse	"Username or email is now taken by another user"
+//	@Failure		500	{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/users/{id}/restore [post]
+func (h *UserHandler) RestoreUser(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	if userID == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "User ID is required")
+	}
+
+	organizationID := c.Locals("organization_id").(string)
+	if err := h.queries.User.RestoreUser(userID, organizationID); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found, not deleted, or already purged")
+		}
+		if isConflictErr(err) {
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "The user's username or email is now taken by another user")
+		}
+		h.logger.Error("Failed to restore user: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to restore user")
+	}
+
+	h.audit.LogEvent(c.Context(), models.AuditEvent{
+		OrganizationID: organizationID,
+		PrincipalID:    utils.StringPtr(c.Locals("user_id").(string)),
+		PrincipalType:  utils.StringPtr("user"),
+		Action:         "restore_user",
+		ResourceType:   utils.StringPtr("user"),
+		ResourceID:     utils.StringPtr(userID),
+		Result:         "success",
+		Severity:       "critical",
+	})
+
+	h.logger.Info("User restored successfully: %s", userID)
+
+	return apiSuccess(c, fiber.StatusOK, "User restored successfully", nil)
+}
+
+// PurgeUser irreversibly anonymizes a soft-deleted user
+//
+//	@Summary		Purge user
+//	@Description	Irreversibly anonymize all personal data of a soft-deleted user without waiting for the grace period. The user must be deleted first.
+//	@Tags			User Management
+//	@Produce		json
+//	@Param			id	path		string			true	"User ID"
+//	@Success		200	{object}	SuccessResponse	"User purged successfully"
+//	@Failure		400	{object}	ErrorResponse	"Invalid user ID"
+//	@Failure		404	{object}	ErrorResponse	"User not found, not deleted, or already purged"
+//	@Failure		500	{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/users/{id}/purge [post]
+func (h *UserHandler) PurgeUser(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	if userID == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "User ID is required")
+	}
+
+	organizationID := c.Locals("organization_id").(string)
+	if err := h.queries.User.PurgeUser(userID, organizationID); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found, not deleted, or already purged")
+		}
+		h.logger.Error("Failed to purge user: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to purge user")
+	}
+
+	h.audit.LogEvent(c.Context(), models.AuditEvent{
+		OrganizationID: organizationID,
+		PrincipalID:    utils.StringPtr(c.Locals("user_id").(string)),
+		PrincipalType:  utils.StringPtr("user"),
+		Action:         "purge_user",
+		ResourceType:   utils.StringPtr("user"),
+		ResourceID:     utils.StringPtr(userID),
+		Result:         "success",
+		Severity:       "critical",
+	})
+
+	h.logger.Info("User purged successfully: %s", userID)
+
+	return apiSuccess(c, fiber.StatusOK, "User purged successfully", nil)
+}
+
 // GetUserProfile retrieves a user's profile information
 //
 //	@Summary		Get user profile
@@ -392,17 +610,17 @@ func (h *UserHandler) DeleteUser(c *fiber.Ctx) error {
 func (h *UserHandler) GetUserProfile(c *fiber.Ctx) error {
 	userID := c.Params("id")
 	if userID == "" {
-		return apiError(c, fiber.StatusBadRequest, "invalid_request", "User ID is required")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "User ID is required")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
 	user, err := h.queries.User.GetUserProfile(userID, organizationID)
 	if err != nil {
 		if isNotFoundErr(err) {
-			return apiError(c, fiber.StatusNotFound, "not_found", "User profile not found")
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User profile not found")
 		}
 		h.logger.Error("Failed to get user profile: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to retrieve user profile")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve user profile")
 	}
 
 	// Don't return sensitive information
@@ -430,10 +648,7 @@ func (h *UserHandler) GetUserProfile(c *fiber.Ctx) error {
 func (h *UserHandler) UpdateUserProfile(c *fiber.Ctx) error {
 	userID := c.Params("id")
 	if userID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "User ID is required",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "User ID is required")
 	}
 
 	var req struct {
@@ -444,7 +659,7 @@ func (h *UserHandler) UpdateUserProfile(c *fiber.Ctx) error {
 	}
 
 	if err := c.BodyParser(&req); err != nil {
-		return apiError(c, fiber.StatusBadRequest, "invalid_request", "Invalid request body")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
 	}
 
 	// Build updates map
@@ -456,20 +671,39 @@ func (h *UserHandler) UpdateUserProfile(c *fiber.Ctx) error {
 		updates["avatar_url"] = req.AvatarURL
 	}
 	if req.Attributes != "" {
-		updates["attributes"] = req.Attributes
+		attributes, err := utils.NormalizeJSONObject(req.Attributes)
+		if err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "attributes must be a JSON object")
+		}
+		schema, err := h.queries.Organization.GetUserAttributeSchema(c.Locals("organization_id").(string))
+		if err != nil {
+			h.logger.Error("Failed to get user attribute schema: %v", err)
+			return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to load attribute schema")
+		}
+		if err := validateUserAttributes(schema, attributes); err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, err.Error())
+		}
+		updates["attributes"] = attributes
 	}
 	if req.Preferences != "" {
-		updates["preferences"] = req.Preferences
+		preferences, err := utils.NormalizeJSONObject(req.Preferences)
+		if err != nil {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "preferences must be a JSON object")
+		}
+		updates["preferences"] = preferences
 	}
 	updates["updated_at"] = time.Now()
 
 	if len(updates) == 1 { // Only updated_at
-		return apiError(c, fiber.StatusBadRequest, "validation_error", "No valid fields to update")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "No valid fields to update")
 	}
 
-	if err := h.queries.User.UpdateUserProfile(userID, updates); err != nil {
+	if err := h.queries.User.UpdateUserProfile(userID, c.Locals("organization_id").(string), updates); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found")
+		}
 		h.logger.Error("Failed to update user profile: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to update user profile")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update user profile")
 	}
 
 	h.logger.Info("User profile updated successfully: %s", userID)
@@ -477,6 +711,230 @@ func (h *UserHandler) UpdateUserProfile(c *fiber.Ctx) error {
 	return apiSuccess(c, fiber.StatusOK, "User profile updated successfully", nil)
 }
 
+// PatchUserAttributes applies a JSON merge patch to a user's attributes
+//
+//	@Summary		Patch user attributes
+//	@Description	Apply an RFC 7396 JSON merge patch to a user's attributes. The result is validated against the organization's user attribute schema, if one is defined.
+//	@Tags			User Management
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string			true	"User ID"
+//	@Param			request	body		object			true	"JSON merge patch"
+//	@Success		200		{object}	SuccessResponse	"Attributes updated successfully"
+//	@Failure		400		{object}	ErrorResponse	"Invalid patch or schema violation"
+//	@Failure		404		{object}	ErrorResponse	"User not found"
+//	@Failure		500		{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/users/{id}/attributes [patch]
+func (h *UserHandler) PatchUserAttributes(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	if userID == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "User ID is required")
+	}
+
+	organizationID := c.Locals("organization_id").(string)
+	user, err := h.queries.User.GetUser(userID, organizationID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found")
+		}
+		h.logger.Error("Failed to get user: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve user")
+	}
+
+	merged, err := mergeJSONObject(user.Attributes, c.Body())
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+	}
+
+	schema, err := h.queries.Organization.GetUserAttributeSchema(organizationID)
+	if err != nil {
+		h.logger.Error("Failed to get user attribute schema: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to load attribute schema")
+	}
+	if err := validateUserAttributes(schema, merged); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, err.Error())
+	}
+
+	if err := h.queries.User.UpdateUserAttributes(userID, organizationID, merged); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found")
+		}
+		h.logger.Error("Failed to update user attributes: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update user attributes")
+	}
+
+	h.audit.LogEvent(c.Context(), models.AuditEvent{
+		OrganizationID: organizationID,
+		PrincipalID:    utils.StringPtr(c.Locals("user_id").(string)),
+		PrincipalType:  utils.StringPtr("user"),
+		Action:         "update_user_attributes",
+		ResourceType:   utils.StringPtr("user"),
+		ResourceID:     utils.StringPtr(userID),
+		Result:         "success",
+		Severity:       "warn",
+	})
+
+	return apiSuccess(c, fiber.StatusOK, "User attributes updated successfully", fiber.Map{
+		"id":         userID,
+		"attributes": json.RawMessage(merged),
+	})
+}
+
+// PatchUserPreferences applies a JSON merge patch to a user's preferences
+//
+//	@Summary		Patch user preferences
+//	@Description	Apply an RFC 7396 JSON merge patch to a user's preferences. Users may patch their own preferences; admins may patch any user in their organization.
+//	@Tags			User Management
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string			true	"User ID"
+//	@Param			request	body		object			true	"JSON merge patch"
+//	@Success		200		{object}	SuccessResponse	"Preferences updated successfully"
+//	@Failure		400		{object}	ErrorResponse	"Invalid patch"
+//	@Failure		403		{object}	ErrorResponse	"Forbidden"
+//	@Failure		404		{object}	ErrorResponse	"User not found"
+//	@Failure		500		{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/users/{id}/preferences [patch]
+func (h *UserHandler) PatchUserPreferences(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	if userID == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "User ID is required")
+	}
+
+	organizationID := c.Locals("organization_id").(string)
+	tc := middleware.GetTenantContext(c)
+	if tc == nil || (tc.UserID != userID && !tc.CanAdminOrg(organizationID)) {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "You can only update your own preferences")
+	}
+
+	user, err := h.queries.User.GetUser(userID, organizationID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found")
+		}
+		h.logger.Error("Failed to get user: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve user")
+	}
+
+	merged, err := mergeJSONObject(user.Preferences, c.Body())
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+	}
+
+	if err := h.queries.User.UpdateUserPreferences(userID, organizationID, merged); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found")
+		}
+		h.logger.Error("Failed to update user preferences: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update user preferences")
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "User preferences updated successfully", fiber.Map{
+		"id":          userID,
+		"preferences": json.RawMessage(merged),
+	})
+}
+
+// mergeJSONObject applies a JSON merge patch to a stored JSON object and
+// ensures the result is still an object.
+func mergeJSONObject(current string, patch []byte) (string, error) {
+	if len(patch) == 0 {
+		return "", fmt.Errorf("request body must be a JSON merge patch")
+	}
+	var patchObj map[string]interface{}
+	if err := json.Unmarshal(patch, &patchObj); err != nil || patchObj == nil {
+		return "", fmt.Errorf("merge patch must be a JSON object")
+	}
+
+	merged, err := utils.MergePatch([]byte(current), patch)
+	if err != nil {
+		return "", err
+	}
+	return string(merged), nil
+}
+
+// validateUserAttributes checks an attributes document against the
+// organization's attribute schema. A nil schema accepts any object.
+func validateUserAttributes(schema *models.AttributeSchema, attributes string) error {
+	if schema == nil {
+		return nil
+	}
+
+	var attrs map[string]interface{}
+	if err := json.Unmarshal([]byte(attributes), &attrs); err != nil {
+		return fmt.Errorf("attributes must be a JSON object")
+	}
+
+	for _, name := range schema.Required {
+		if _, ok := attrs[name]; !ok {
+			return fmt.Errorf("attribute %q is required", name)
+		}
+	}
+
+	for name, value := range attrs {
+		def, ok := schema.Properties[name]
+		if !ok {
+			if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+				return fmt.Errorf("attribute %q is not defined in the organization schema", name)
+			}
+			continue
+		}
+		if err := validateAttributeValue(name, def, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateAttributeValue(name string, def models.AttributeDefinition, value interface{}) error {
+	switch def.Type {
+	case "", "any":
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("attribute %q must be a string", name)
+		}
+		if def.MaxLength > 0 && len(str) > def.MaxLength {
+			return fmt.Errorf("attribute %q must be at most %d characters", name, def.MaxLength)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("attribute %q must be a number", name)
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != float64(int64(n)) {
+			return fmt.Errorf("attribute %q must be an integer", name)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("attribute %q must be a boolean", name)
+		}
+	case "array":
+		if _, ok := value.([]interface{}); !ok {
+			return fmt.Errorf("attribute %q must be an array", name)
+		}
+	case "object":
+		if _, ok := value.(map[string]interface{}); !ok {
+			return fmt.Errorf("attribute %q must be an object", name)
+		}
+	default:
+		return fmt.Errorf("attribute %q has unsupported schema type %q", name, def.Type)
+	}
+
+	if len(def.Enum) > 0 {
+		for _, allowed := range def.Enum {
+			if allowed == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("attribute %q must be one of the allowed values", name)
+	}
+	return nil
+}
+
 // ChangePassword allows a user to change their own password
 //
 //	@Summary		Change password
@@ -495,13 +953,13 @@ func (h *UserHandler) UpdateUserProfile(c *fiber.Ctx) error {
 func (h *UserHandler) ChangePassword(c *fiber.Ctx) error {
 	userID := c.Params("id")
 	if userID == "" {
-		return apiError(c, fiber.StatusBadRequest, "invalid_request", "User ID is required")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "User ID is required")
 	}
 
 	// Ensure user can only change their own password
 	authenticatedUserID := c.Locals("user_id").(string)
 	if userID != authenticatedUserID {
-		return apiError(c, fiber.StatusForbidden, "forbidden", "You can only change your own password")
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "You can only change your own password")
 	}
 
 	var req struct {
@@ -510,15 +968,15 @@ func (h *UserHandler) ChangePassword(c *fiber.Ctx) error {
 	}
 
 	if err := c.BodyParser(&req); err != nil {
-		return apiError(c, fiber.StatusBadRequest, "invalid_request", "Invalid request body")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
 	}
 
 	if req.CurrentPassword == "" || req.NewPassword == "" {
-		return apiError(c, fiber.StatusBadRequest, "validation_error", "Both current and new password are required")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Both current and new password are required")
 	}
 
 	if len(req.NewPassword) < 8 {
-		return apiError(c, fiber.StatusBadRequest, "validation_error", "New password must be at least 8 characters")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "New password must be at least 8 characters")
 	}
 
 	// Get user to verify current password
@@ -526,22 +984,25 @@ func (h *UserHandler) ChangePassword(c *fiber.Ctx) error {
 	user, err := h.queries.Auth.GetUserByID(userID, organizationID)
 	if err != nil {
 		if isNotFoundErr(err) {
-			return apiError(c, fiber.StatusNotFound, "not_found", "User not found")
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found")
 		}
 		h.logger.Error("Failed to get user for password change: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to retrieve user")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve user")
 	}
 
 	// Verify current password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.CurrentPassword)); err != nil {
-		return apiError(c, fiber.StatusUnauthorized, "invalid_credentials", "Current password is incorrect")
+	if err := password.Verify(user.PasswordHash, req.CurrentPassword); err != nil {
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeInvalidCredentials, "Current password is incorrect")
+	}
+	if refused, err := rejectBreachedPassword(c, h.breaches, organizationID, req.NewPassword); refused {
+		return err
 	}
 
 	// Hash new password
 	newHash, err := hashPassword(req.NewPassword)
 	if err != nil {
 		h.logger.Error("Failed to hash new password: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to process password change")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to process password change")
 	}
 
 	// Update password
@@ -552,7 +1013,7 @@ func (h *UserHandler) ChangePassword(c *fiber.Ctx) error {
 
 	if err := h.queries.User.UpdateUser(user, organizationID); err != nil {
 		h.logger.Error("Failed to update password: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to change password")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to change password")
 	}
 
 	h.audit.LogEvent(c.Context(), models.AuditEvent{
@@ -589,26 +1050,26 @@ func (h *UserHandler) ChangePassword(c *fiber.Ctx) error {
 func (h *UserHandler) SuspendUser(c *fiber.Ctx) error {
 	userID := c.Params("id")
 	if userID == "" {
-		return apiError(c, fiber.StatusBadRequest, "invalid_request", "User ID is required")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "User ID is required")
 	}
 
 	var req SuspendUserRequest
 
 	if err := c.BodyParser(&req); err != nil {
-		return apiError(c, fiber.StatusBadRequest, "invalid_request", "Invalid request body")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
 	}
 
 	if req.Reason == "" {
-		return apiError(c, fiber.StatusBadRequest, "validation_error", "Suspension reason is required")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Suspension reason is required")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
 	if err := h.queries.User.SuspendUser(userID, organizationID, req.Reason); err != nil {
 		if isNotFoundErr(err) {
-			return apiError(c, fiber.StatusNotFound, "not_found", "User not found")
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found")
 		}
 		h.logger.Error("Failed to suspend user: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to suspend user")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to suspend user")
 	}
 
 	h.logger.Info("User suspended successfully: %s, reason: %s", userID, req.Reason)
@@ -633,10 +1094,7 @@ func (h *UserHandler) SuspendUser(c *fiber.Ctx) error {
 func (h *UserHandler) ActivateUser(c *fiber.Ctx) error {
 	userID := c.Params("id")
 	if userID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "User ID is required",
-			"success": false,
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "User ID is required")
 	}
 
 	var req ActivateUserRequest
@@ -648,10 +1106,10 @@ func (h *UserHandler) ActivateUser(c *fiber.Ctx) error {
 	organizationID := c.Locals("organization_id").(string)
 	if err := h.queries.User.ActivateUser(userID, organizationID); err != nil {
 		if isNotFoundErr(err) {
-			return apiError(c, fiber.StatusNotFound, "not_found", "User not found")
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found")
 		}
 		h.logger.Error("Failed to activate user: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to activate user")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to activate user")
 	}
 
 	h.logger.Info("User activated successfully: %s", userID)
@@ -669,23 +1127,27 @@ func (h *UserHandler) ActivateUser(c *fiber.Ctx) error {
 //	@Param			id	path		string				true	"User ID"
 //	@Success		200	{object}	SuccessResponse	"Successfully retrieved user sessions"
 //	@Failure		400	{object}	ErrorResponse		"Invalid user ID"
+//	@Failure		403	{object}	ErrorResponse		"Forbidden"
 //	@Failure		500	{object}	ErrorResponse		"Internal server error"
 //	@Security		BearerAuth
 //	@Router			/users/{id}/sessions [get]
 func (h *UserHandler) GetUserSessions(c *fiber.Ctx) error {
 	userID := c.Params("id")
 	if userID == "" {
-		return apiError(c, fiber.StatusBadRequest, "invalid_request", "User ID is required")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "User ID is required")
+	}
+	if !canAccessUserData(c, userID) {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only organization admins can view other users' sessions")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
 	sessions, err := h.queries.User.GetUserSessions(userID, organizationID)
 	if err != nil {
 		h.logger.Error("Failed to get user sessions: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to retrieve user sessions")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve user sessions")
 	}
 
-	return apiSuccess(c, fiber.StatusOK, "User sessions retrieved", sessions)
+	return apiSuccess(c, fiber.StatusOK, "User sessions retrieved", sessionViews(c, sessions))
 }
 
 // RevokeUserSessions revokes all active sessions for a user
@@ -698,26 +1160,605 @@ func (h *UserHandler) GetUserSessions(c *fiber.Ctx) error {
 //	@Param			id	path		string			true	"User ID"
 //	@Success		200	{object}	SuccessResponse	"User sessions revoked successfully"
 //	@Failure		400	{object}	ErrorResponse	"Invalid user ID"
+//	@Failure		403	{object}	ErrorResponse	"Forbidden"
 //	@Failure		500	{object}	ErrorResponse	"Internal server error"
 //	@Security		BearerAuth
 //	@Router			/users/{id}/sessions [delete]
 func (h *UserHandler) RevokeUserSessions(c *fiber.Ctx) error {
 	userID := c.Params("id")
 	if userID == "" {
-		return apiError(c, fiber.StatusBadRequest, "invalid_request", "User ID is required")
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "User ID is required")
+	}
+	if !canAccessUserData(c, userID) {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only organization admins can revoke other users' sessions")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
 	if err := h.queries.User.RevokeUserSessions(userID, organizationID); err != nil {
 		h.logger.Error("Failed to revoke user sessions: %v", err)
-		return apiError(c, fiber.StatusInternalServerError, "server_error", "Failed to revoke user sessions")
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to revoke user sessions")
 	}
 
+	h.logSessionRevocation(c, organizationID, userID, "revoke_user_sessions")
+	publish(h.events, c, events.Event{Type: events.SessionRevoked, Subject: userID})
 	h.logger.Info("User sessions revoked successfully: %s", userID)
 
 	return apiSuccess(c, fiber.StatusOK, "User sessions revoked successfully", nil)
 }
 
+// RevokeUserSession revokes a single session of a user
+//
+//	@Summary		Revoke a user session
+//	@Description	Revoke one active session of a user. Users may revoke their own sessions; org admins any user's.
+//	@Tags			User Management
+//	@Produce		json
+//	@Param			id			path		string			true	"User ID"
+//	@Param			session_id	path		string			true	"Session ID"
+//	@Success		200			{object}	SuccessResponse	"Session revoked"
+//	@Failure		403			{object}	ErrorResponse	"Forbidden"
+//	@Failure		404			{object}	ErrorResponse	"Session not found"
+//	@Failure		500			{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/users/{id}/sessions/{session_id} [delete]
+func (h *UserHandler) RevokeUserSession(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	if !canAccessUserData(c, userID) {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "Only organization admins can revoke other users' sessions")
+	}
+	return h.revokeSession(c, userID, c.Params("session_id"))
+}
+
+// revokeSession revokes one session of userID in the caller's organization
+func (h *UserHandler) revokeSession(c *fiber.Ctx, userID, sessionID string) error {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid session ID")
+	}
+
+	organizationID := c.Locals("organization_id").(string)
+	if err := h.queries.User.RevokeUserSession(userID, organizationID, sessionID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Session not found")
+		}
+		h.logger.Error("Failed to revoke session %s: %v", sessionID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to revoke session")
+	}
+
+	h.logSessionRevocation(c, organizationID, userID, "revoke_user_session")
+	publish(h.events, c, events.Event{
+		Type:    events.SessionRevoked,
+		Subject: userID,
+		Data:    map[string]interface{}{"session_id": sessionID},
+	})
+	return apiSuccess(c, fiber.StatusOK, "Session revoked", nil)
+}
+
+func (h *UserHandler) logSessionRevocation(c *fiber.Ctx, organizationID, userID, action string) {
+	h.audit.LogEvent(c.Context(), models.AuditEvent{
+		OrganizationID: organizationID,
+		PrincipalID:    utils.StringPtr(c.Locals("user_id").(string)),
+		PrincipalType:  utils.StringPtr("user"),
+		Action:         action,
+		ResourceType:   utils.StringPtr("user"),
+		ResourceID:     utils.StringPtr(userID),
+		Result:         "success",
+		Severity:       "warn",
+	})
+}
+
+// sessionViews shapes sessions for API responses: device and location
+// details are included, the session token never is
+func sessionViews(c *fiber.Ctx, sessions []models.Session) []fiber.Map {
+	var current string
+	if tc := middleware.GetTenantContext(c); tc != nil {
+		current = tc.SessionID
+	}
+
+	result := make([]fiber.Map, 0, len(sessions))
+	for _, s := range sessions {
+		location := json.RawMessage(s.Location)
+		if !json.Valid(location) {
+			location = json.RawMessage("{}")
+		}
+		var userAgent string
+		if s.UserAgent != nil {
+			userAgent = *s.UserAgent
+		}
+		result = append(result, fiber.Map{
+			"id":                 s.ID,
+			"ip_address":         s.IPAddress,
+			"user_agent":         s.UserAgent,
+			"device":             describeDevice(userAgent),
+			"device_fingerprint": s.DeviceFingerprint,
+			"location":           location,
+			"mfa_verified":       s.MFAVerified,
+			"issued_at":          s.IssuedAt,
+			"last_used_at":       s.LastUsedAt,
+			"expires_at":         s.ExpiresAt,
+			"current":            s.ID == current,
+		})
+	}
+	return result
+}
+
+// describeDevice summarizes a User-Agent as "<browser> on <OS>"
+func describeDevice(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	os := "unknown OS"
+	for _, o := range []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Mac OS X", "macOS"},
+		{"Windows", "Windows"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, o.token) {
+			os = o.name
+			break
+		}
+	}
+
+	return browser + " on " + os
+}
+
+// Current user ("me") endpoints
+
+// MyOrganization describes the caller's membership in an organization
+type MyOrganization struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Slug   string `json:"slug"`
+	Status string `json:"status"`
+	Role   string `json:"role"`
+	IsRoot bool   `json:"is_root"`
+} //@name MyOrganization
+
+// GetMe retrieves the profile of the authenticated user
+//
+//	@Summary		Get current user
+//	@Description	Retrieve the profile of the authenticated user without needing to know the user ID
+//	@Tags			User Management
+//	@Produce		json
+//	@Success		200	{object}	SuccessResponse	"Successfully retrieved current user"
+//	@Failure		401	{object}	ErrorResponse	"Unauthorized"
+//	@Failure		404	{object}	ErrorResponse	"User not found"
+//	@Security		BearerAuth
+//	@Router			/users/me [get]
+func (h *UserHandler) GetMe(c *fiber.Ctx) error {
+	tc := middleware.GetTenantContext(c)
+	if tc == nil {
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Tenant context not resolved")
+	}
+
+	user, err := h.queries.User.GetUser(tc.UserID, tc.OrganizationID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found")
+		}
+		h.logger.Error("Failed to get current user: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve user")
+	}
+
+	// Don't return password hash
+	user.PasswordHash = ""
+
+	return apiSuccess(c, fiber.StatusOK, "User retrieved successfully", user)
+}
+
+// GetMyPermissions retrieves the effective permissions of the authenticated user
+//
+//	@Summary		Get current user permissions
+//	@Description	Retrieve the effective permissions granted to the authenticated user, per resource pattern and with the role, group or share each comes from
+//	@Tags			User Management
+//	@Produce		json
+//	@Param			service	query	string	false	"Only list actions of this service, e.g. blog"
+//	@Success		200	{object}	SuccessResponse	"Successfully retrieved effective permissions"
+//	@Failure		401	{object}	ErrorResponse	"Unauthorized"
+//	@Failure		500	{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/users/me/permissions [get]
+func (h *UserHandler) GetMyPermissions(c *fiber.Ctx) error {
+	tc := middleware.GetTenantContext(c)
+	if tc == nil {
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Tenant context not resolved")
+	}
+
+	permissions, err := h.authz.EffectivePermissions(c.Context(), tc.OrganizationID, tc.UserID, "user", c.Query("service"))
+	if err != nil {
+		h.logger.Error("Failed to get effective permissions for %s: %v", tc.UserID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve effective permissions")
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Effective permissions retrieved", fiber.Map{
+		"role":        tc.Role,
+		"is_root":     tc.IsRoot,
+		"permissions": permissions,
+	})
+}
+
+// GetMySessions retrieves the active sessions of the authenticated user
+//
+//	@Summary		Get current user sessions
+//	@Description	Retrieve all active sessions of the authenticated user with device, IP and location details, flagging the session making the request
+//	@Tags			User Management
+//	@Produce		json
+//	@Success		200	{object}	SuccessResponse	"Successfully retrieved sessions"
+//	@Failure		401	{object}	ErrorResponse	"Unauthorized"
+//	@Failure		500	{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/users/me/sessions [get]
+func (h *UserHandler) GetMySessions(c *fiber.Ctx) error {
+	tc := middleware.GetTenantContext(c)
+	if tc == nil {
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Tenant context not resolved")
+	}
+
+	sessions, err := h.queries.User.GetUserSessions(tc.UserID, tc.OrganizationID)
+	if err != nil {
+		h.logger.Error("Failed to get sessions for %s: %v", tc.UserID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve sessions")
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Sessions retrieved", sessionViews(c, sessions))
+}
+
+// RevokeMySession revokes one of the authenticated user's own sessions,
+// e.g. to sign out a lost device
+//
+//	@Summary		Revoke own session
+//	@Description	Revoke one active session of the authenticated user
+//	@Tags			User Management
+//	@Produce		json
+//	@Param			session_id	path		string			true	"Session ID"
+//	@Success		200			{object}	SuccessResponse	"Session revoked"
+//	@Failure		401			{object}	ErrorResponse	"Unauthorized"
+//	@Failure		404			{object}	ErrorResponse	"Session not found"
+//	@Failure		500			{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/users/me/sessions/{session_id} [delete]
+func (h *UserHandler) RevokeMySession(c *fiber.Ctx) error {
+	tc := middleware.GetTenantContext(c)
+	if tc == nil {
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Tenant context not resolved")
+	}
+	return h.revokeSession(c, tc.UserID, c.Params("session_id"))
+}
+
+// GetMyConsents lists the OAuth clients the authenticated user has granted access to
+//
+//	@Summary		List own OAuth consents
+//	@Description	List the applications the authenticated user has authorized, with the scopes granted to each
+//	@Tags			User Management
+//	@Produce		json
+//	@Success		200	{object}	SuccessResponse	"Consents retrieved"
+//	@Failure		401	{object}	ErrorResponse	"Unauthorized"
+//	@Failure		500	{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/users/me/consents [get]
+func (h *UserHandler) GetMyConsents(c *fiber.Ctx) error {
+	tc := middleware.GetTenantContext(c)
+	if tc == nil {
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Tenant context not resolved")
+	}
+
+	consents, err := h.queries.OIDC.ListConsentsByUser(tc.UserID, tc.OrganizationID)
+	if err != nil {
+		h.logger.Error("Failed to list consents for %s: %v", tc.UserID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve consents")
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Consents retrieved", consents)
+}
+
+// RevokeMyConsent withdraws the authenticated user's consent for an OAuth
+// client. The client's refresh tokens stop working and the consent screen is
+// shown again on its next authorization request.
+//
+//	@Summary		Revoke own OAuth consent
+//	@Description	Revoke the authenticated user's grant to an application, invalidating its refresh tokens
+//	@Tags			User Management
+//	@Produce		json
+//	@Param			client_id	path		string			true	"Client ID"
+//	@Success		200			{object}	SuccessResponse	"Consent revoked"
+//	@Failure		401			{object}	ErrorResponse	"Unauthorized"
+//	@Failure		404			{object}	ErrorResponse	"Consent not found"
+//	@Failure		500			{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/users/me/consents/{client_id} [delete]
+func (h *UserHandler) RevokeMyConsent(c *fiber.Ctx) error {
+	tc := middleware.GetTenantContext(c)
+	if tc == nil {
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Tenant context not resolved")
+	}
+	clientID := c.Params("client_id")
+
+	if err := h.queries.OIDC.DeleteConsent(tc.UserID, tc.OrganizationID, clientID); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Consent not found")
+		}
+		h.logger.Error("Failed to revoke consent of %s for client %s: %v", tc.UserID, clientID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to revoke consent")
+	}
+
+	h.audit.LogEvent(c.Context(), models.AuditEvent{
+		OrganizationID: tc.OrganizationID,
+		PrincipalID:    utils.StringPtr(tc.UserID),
+		PrincipalType:  utils.StringPtr("user"),
+		Action:         "revoke_oauth_consent",
+		ResourceType:   utils.StringPtr("oauth_client"),
+		ResourceID:     utils.StringPtr(clientID),
+		Result:         "success",
+		Severity:       "warn",
+	})
+
+	return apiSuccess(c, fiber.StatusOK, "Consent revoked", nil)
+}
+
+// GetMyOrganizations retrieves the organization memberships of the authenticated user
+//
+//	@Summary		Get current user organizations
+//	@Description	Retrieve the organizations the authenticated user belongs to along with their role in each
+//	@Tags			User Management
+//	@Produce		json
+//	@Success		200	{object}	SuccessResponse	"Successfully retrieved organizations"
+//	@Failure		401	{object}	ErrorResponse	"Unauthorized"
+//	@Failure		500	{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/users/me/organizations [get]
+func (h *UserHandler) GetMyOrganizations(c *fiber.Ctx) error {
+	tc := middleware.GetTenantContext(c)
+	if tc == nil {
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Tenant context not resolved")
+	}
+
+	org, err := h.queries.Organization.GetOrganization(tc.OrganizationID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiSuccess(c, fiber.StatusOK, "Organizations retrieved", []MyOrganization{})
+		}
+		h.logger.Error("Failed to get organization for %s: %v", tc.UserID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve organizations")
+	}
+
+	// A user belongs to exactly one organization; the list shape leaves room
+	// for cross-organization memberships.
+	memberships := []MyOrganization{{
+		ID:     org.ID,
+		Name:   org.Name,
+		Slug:   org.Slug,
+		Status: org.Status,
+		Role:   tc.Role,
+		IsRoot: tc.IsRoot,
+	}}
+
+	return apiSuccess(c, fiber.StatusOK, "Organizations retrieved", memberships)
+}
+
+// Personal data export endpoints
+
+// canAccessUserData reports whether the caller may read personal data of the
+// given user: users may access their own data, admins any user in their org.
+func canAccessUserData(c *fiber.Ctx, userID string) bool {
+	tc := middleware.GetTenantContext(c)
+	if tc == nil {
+		return false
+	}
+	return tc.UserID == userID || tc.CanAdminOrg(tc.OrganizationID)
+}
+
+// StartUserExport starts an asynchronous export of a user's personal data.
+// While an export of the user is still being assembled, that job is returned
+// instead of starting another, so repeated requests do not pile up jobs.
+//
+//	@Summary		Export user data
+//	@Description	Start assembling a bundle of the user's profile, sessions, role assignments, group memberships, content items and audit events, or return the export already being assembled. Poll GET /users/{id}/export/{job_id} with the returned job ID until it completes, then download it from /users/{id}/export/{job_id}/download.
+//	@Tags			User Management
+//	@Produce		json
+//	@Param			id	path		string			true	"User ID"
+//	@Success		202	{object}	SuccessResponse	"Export job started or in progress"
+//	@Failure		403	{object}	ErrorResponse	"Forbidden"
+//	@Failure		404	{object}	ErrorResponse	"User not found"
+//	@Failure		500	{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/users/{id}/export [get]
+func (h *UserHandler) StartUserExport(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	if !canAccessUserData(c, userID) {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "You can only export your own data")
+	}
+
+	organizationID := c.Locals("organization_id").(string)
+	if _, err := h.queries.User.GetUser(userID, organizationID); err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found")
+		}
+		h.logger.Error("Failed to get user: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve user")
+	}
+
+	jobs, err := h.exports.ListJobs(c.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to list data exports: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to start data export")
+	}
+	for _, job := range jobs {
+		if job.OrganizationID == organizationID && (job.Status == "pending" || job.Status == "running") {
+			return apiSuccess(c, fiber.StatusAccepted, "Data export in progress", job)
+		}
+	}
+
+	requestedBy := c.Locals("user_id").(string)
+	job, err := h.exports.StartExport(c.Context(), userID, organizationID, requestedBy)
+	if err != nil {
+		h.logger.Error("Failed to start data export: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to start data export")
+	}
+
+	h.audit.LogEvent(c.Context(), models.AuditEvent{
+		OrganizationID: organizationID,
+		PrincipalID:    utils.StringPtr(requestedBy),
+		PrincipalType:  utils.StringPtr("user"),
+		Action:         "export_user_data",
+		ResourceType:   utils.StringPtr("user"),
+		ResourceID:     utils.StringPtr(userID),
+		Result:         "success",
+		Severity:       "warn",
+	})
+
+	return apiSuccess(c, fiber.StatusAccepted, "Data export started", job)
+}
+
+// ListUserExports lists the data export jobs of a user
+//
+//	@Summary		List user data exports
+//	@Description	List the unexpired data export jobs of a user, newest first
+//	@Tags			User Management
+//	@Produce		json
+//	@Param			id	path		string			true	"User ID"
+//	@Success		200	{object}	SuccessResponse	"Export jobs retrieved"
+//	@Failure		403	{object}	ErrorResponse	"Forbidden"
+//	@Failure		500	{object}	ErrorResponse	"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/users/{id}/exports [get]
+func (h *UserHandler) ListUserExports(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	if !canAccessUserData(c, userID) {
+		return apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "You can only access your own exports")
+	}
+
+	jobs, err := h.exports.ListJobs(c.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to list data exports: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to list data exports")
+	}
+
+	organizationID := c.Locals("organization_id").(string)
+	visible := make([]models.DataExportJob, 0, len(jobs))
+	for _, job := range jobs {
+		if job.OrganizationID == organizationID {
+			visible = append(visible, job)
+		}
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Data exports retrieved", visible)
+}
+
+// GetUserExport returns the status of a data export job
+//
+//	@Summary		Get user data export status
+//	@Description	Poll the status of a data export job
+//	@Tags			User Management
+//	@Produce		json
+//	@Param			id		path		string			true	"User ID"
+//	@Param			job_id	path		string			true	"Export job ID"
+//	@Success		200		{object}	SuccessResponse	"Export job retrieved"
+//	@Failure		403		{object}	ErrorResponse	"Forbidden"
+//	@Failure		404		{object}	ErrorResponse	"Export job not found"
+//	@Security		BearerAuth
+//	@Router			/users/{id}/export/{job_id} [get]
+func (h *UserHandler) GetUserExport(c *fiber.Ctx) error {
+	job, resp := h.lookupExportJob(c)
+	if job == nil {
+		return resp
+	}
+	return apiSuccess(c, fiber.StatusOK, "Data export retrieved", job)
+}
+
+// DownloadUserExport downloads a completed data export
+//
+//	@Summary		Download user data export
+//	@Description	Download a completed data export as a single JSON document or as a ZIP archive with one file per section
+//	@Tags			User Management
+//	@Produce		json
+//	@Produce		application/zip
+//	@Param			id		path		string			true	"User ID"
+//	@Param			job_id	path		string			true	"Export job ID"
+//	@Param			format	query		string			false	"json (default) or zip"
+//	@Success		200		{file}		file			"Export bundle"
+//	@Failure		403		{object}	ErrorResponse	"Forbidden"
+//	@Failure		404		{object}	ErrorResponse	"Export job not found"
+//	@Failure		409		{object}	ErrorResponse	"Export not ready"
+//	@Security		BearerAuth
+//	@Router			/users/{id}/export/{job_id}/download [get]
+func (h *UserHandler) DownloadUserExport(c *fiber.Ctx) error {
+	job, resp := h.lookupExportJob(c)
+	if job == nil {
+		return resp
+	}
+	if job.Status != "completed" {
+		return apiError(c, fiber.StatusConflict, apierror.CodeExportNotReady, "Data export is "+job.Status)
+	}
+
+	filename := "user-data-" + job.UserID
+	var data []byte
+	var err error
+	switch c.Query("format", "json") {
+	case "json":
+		data, err = h.exports.GetBundle(c.Context(), job.ID)
+		filename += ".json"
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	case "zip":
+		data, err = h.exports.GetArchive(c.Context(), job.ID)
+		filename += ".zip"
+		c.Set(fiber.HeaderContentType, "application/zip")
+	default:
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "format must be json or zip")
+	}
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Data export has expired")
+		}
+		h.logger.Error("Failed to load data export %s: %v", job.ID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to load data export")
+	}
+
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	return c.Send(data)
+}
+
+// lookupExportJob resolves the export job addressed by the route and checks
+// that the caller may access it. On failure it returns a nil job together with
+// the already-written error response.
+func (h *UserHandler) lookupExportJob(c *fiber.Ctx) (*models.DataExportJob, error) {
+	userID := c.Params("id")
+	if !canAccessUserData(c, userID) {
+		return nil, apiError(c, fiber.StatusForbidden, apierror.CodeForbidden, "You can only access your own exports")
+	}
+
+	job, err := h.exports.GetJob(c.Context(), c.Params("job_id"))
+	if err != nil {
+		if isNotFoundErr(err) {
+			return nil, apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Data export not found")
+		}
+		h.logger.Error("Failed to get data export: %v", err)
+		return nil, apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve data export")
+	}
+
+	organizationID := c.Locals("organization_id").(string)
+	if job.UserID != userID || job.OrganizationID != organizationID {
+		return nil, apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Data export not found")
+	}
+	return job, nil
+}
+
 // Service Account endpoints
 
 // ListServiceAccounts retrieves a paginated list of service accounts
@@ -729,6 +1770,7 @@ func (h *UserHandler) RevokeUserSessions(c *fiber.Ctx) error {
 //	@Produce		json
 //	@Param			page	query		int		false	"Page number (default: 1)"
 //	@Param			limit	query		int		false	"Items per page (default: 10, max: 100)"
+//	@Param			cursor	query		string	false	"Opaque cursor from next_cursor of the previous page; overrides offset"
 //	@Param			sort	query		string	false	"Sort field (default: created_at)"
 //	@Param			order	query		string	false	"Sort order: asc or desc (default: desc)"
 //	@Success		200		{object}	SuccessResponse		"Successfully retrieved service accounts list"
@@ -756,18 +1798,18 @@ func (h *UserHandler) ListServiceAccounts(c *fiber.Ctx) error {
 		Offset: (page - 1) * limit,
 		SortBy: sort,
 		Order:  order,
+		Cursor: c.Query("cursor"),
 	}
 
 	// Call query layer
 	organizationID := c.Locals("organization_id").(string)
 	result, err := h.queries.User.ListServiceAccounts(params, organizationID)
 	if err != nil {
+		if isInvalidCursorErr(err) {
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid pagination cursor")
+		}
 		h.logger.Error("Failed to list service accounts: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to retrieve service accounts",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve service accounts")
 	}
 
 	return c.JSON(SuccessResponse{
@@ -796,38 +1838,22 @@ func (h *UserHandler) CreateServiceAccount(c *fiber.Ctx) error {
 
 	// Parse request body
 	if err := c.BodyParser(&sa); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "invalid_request",
-			Message: "Invalid request body",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
 	}
 
 	// Basic validation
 	if sa.Name == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "validation_error",
-			Message: "Service account name is required",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Service account name is required")
 	}
 
 	// Validate name format — must match DB constraint: alphanumeric, dots, underscores, hyphens only
 	for _, ch := range sa.Name {
 		if !((ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') || ch == '.' || ch == '_' || ch == '-') {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Status:  fiber.StatusBadRequest,
-				Error:   "validation_error",
-				Message: "Service account name may only contain letters, numbers, dots, underscores, and hyphens (no spaces)",
-			})
+			return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Service account name may only contain letters, numbers, dots, underscores, and hyphens (no spaces)")
 		}
 	}
 	if len(sa.Name) < 3 {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "validation_error",
-			Message: "Service account name must be at least 3 characters",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Service account name must be at least 3 characters")
 	}
 
 	// Set default values
@@ -851,18 +1877,10 @@ func (h *UserHandler) CreateServiceAccount(c *fiber.Ctx) error {
 	err := h.queries.User.CreateServiceAccount(&sa)
 	if err != nil {
 		if strings.Contains(err.Error(), "unique_sa_name_per_org") {
-			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{
-				Status:  fiber.StatusConflict,
-				Error:   "conflict",
-				Message: "A service account with this name already exists in your organization",
-			})
+			return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "A service account with this name already exists in your organization")
 		}
 		h.logger.Error("Failed to create service account: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to create service account",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to create service account")
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
@@ -893,18 +1911,10 @@ func (h *UserHandler) GetServiceAccount(c *fiber.Ctx) error {
 	sa, err := h.queries.User.GetServiceAccount(saID, organizationID)
 	if err != nil {
 		if isNotFoundErr(err) {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Status:  fiber.StatusNotFound,
-				Error:   "not_found",
-				Message: "Service account not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Service account not found")
 		}
 		h.logger.Error("Failed to get service account: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "server_error",
-			Message: "Failed to retrieve service account",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve service account")
 	}
 
 	return c.JSON(SuccessResponse{
@@ -935,11 +1945,7 @@ func (h *UserHandler) UpdateServiceAccount(c *fiber.Ctx) error {
 
 	// Parse request body
 	if err := c.BodyParser(&reqSa); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "invalid_request",
-			Message: "Invalid request body",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
@@ -948,18 +1954,10 @@ func (h *UserHandler) UpdateServiceAccount(c *fiber.Ctx) error {
 	existingSa, err := h.queries.User.GetServiceAccount(saID, organizationID)
 	if err != nil {
 		if isNotFoundErr(err) {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Status:  fiber.StatusNotFound,
-				Error:   "not_found",
-				Message: "Service account not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Service account not found")
 		}
 		h.logger.Error("Failed to get service account for update: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "server_error",
-			Message: "Failed to retrieve service account",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve service account")
 	}
 
 	// Apply updates
@@ -1002,11 +2000,7 @@ func (h *UserHandler) UpdateServiceAccount(c *fiber.Ctx) error {
 	err = h.queries.User.UpdateServiceAccount(existingSa, organizationID)
 	if err != nil {
 		h.logger.Error("Failed to update service account: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to update service account",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to update service account")
 	}
 
 	return c.JSON(SuccessResponse{
@@ -1037,18 +2031,10 @@ func (h *UserHandler) DeleteServiceAccount(c *fiber.Ctx) error {
 	err := h.queries.User.DeleteServiceAccount(saID, organizationID)
 	if err != nil {
 		if isNotFoundErr(err) {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Status:  fiber.StatusNotFound,
-				Error:   "not_found",
-				Message: "Service account not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Service account not found")
 		}
 		h.logger.Error("Failed to delete service account: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to delete service account",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to delete service account")
 	}
 
 	return c.JSON(SuccessResponse{
@@ -1079,11 +2065,7 @@ func (h *UserHandler) GenerateAPIKey(c *fiber.Ctx) error {
 
 	// Parse request body
 	if err := c.BodyParser(&apiKey); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Status:  fiber.StatusBadRequest,
-			Error:   "invalid_request",
-			Message: "Invalid request body",
-		})
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
 	}
 
 	organizationID := c.Locals("organization_id").(string)
@@ -1098,11 +2080,7 @@ func (h *UserHandler) GenerateAPIKey(c *fiber.Ctx) error {
 	secretBytes := make([]byte, 32)
 	if _, err := rand.Read(secretBytes); err != nil {
 		h.logger.Error("Failed to generate random secret: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to generate API key",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to generate API key")
 	}
 	apiSecret := "mk_" + hex.EncodeToString(secretBytes)
 
@@ -1113,21 +2091,18 @@ func (h *UserHandler) GenerateAPIKey(c *fiber.Ctx) error {
 		apiKey.KeyID = "aki_" + hex.EncodeToString(keyIDBytes)
 	}
 
-	// Hash the secret
-	hashedSecret, err := hashPassword(apiSecret) // reusing existing helper
+	// Hash the secret; API key secrets are random, so they stay on bcrypt
+	// whatever algorithm user passwords use, matching the API key middleware
+	hashedSecret, err := bcrypt.GenerateFromPassword([]byte(apiSecret), bcrypt.DefaultCost)
 	if err != nil {
 		h.logger.Error("Failed to hash secret: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to process API key generation",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to process API key generation")
 	}
 
 	// Set fields
 	apiKey.ID = uuid.NewString()
 	apiKey.ServiceAccountID = saID
-	apiKey.KeyHash = hashedSecret
+	apiKey.KeyHash = string(hashedSecret)
 	apiKey.Status = "active"
 	apiKey.CreatedAt = time.Now()
 
@@ -1140,18 +2115,10 @@ func (h *UserHandler) GenerateAPIKey(c *fiber.Ctx) error {
 	err = h.queries.User.GenerateAPIKey(saID, &apiKey, organizationID)
 	if err != nil {
 		if isNotFoundErr(err) {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Status:  fiber.StatusNotFound,
-				Error:   "not_found",
-				Message: "Service account not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Service account not found")
 		}
 		h.logger.Error("Failed to generate API key: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to generate API key",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to generate API key")
 	}
 
 	// Helper struct to return the secret (only once!)
@@ -1191,18 +2158,10 @@ func (h *UserHandler) ListAPIKeys(c *fiber.Ctx) error {
 	keys, err := h.queries.User.ListAPIKeys(saID, organizationID)
 	if err != nil {
 		if isNotFoundErr(err) {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Status:  fiber.StatusNotFound,
-				Error:   "not_found",
-				Message: "Service account not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Service account not found")
 		}
 		h.logger.Error("Failed to list API keys: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to retrieve API keys",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve API keys")
 	}
 
 	return c.JSON(SuccessResponse{
@@ -1235,18 +2194,10 @@ func (h *UserHandler) RevokeAPIKey(c *fiber.Ctx) error {
 	err := h.queries.User.RevokeAPIKey(saID, keyID, organizationID)
 	if err != nil {
 		if isNotFoundErr(err) {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Status:  fiber.StatusNotFound,
-				Error:   "not_found",
-				Message: "API key not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "API key not found")
 		}
 		h.logger.Error("Failed to revoke API key: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to revoke API key",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to revoke API key")
 	}
 
 	return c.JSON(SuccessResponse{
@@ -1277,18 +2228,10 @@ func (h *UserHandler) RotateServiceAccountKeys(c *fiber.Ctx) error {
 	err := h.queries.User.RotateServiceAccountKeys(saID, organizationID)
 	if err != nil {
 		if isNotFoundErr(err) {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Status:  fiber.StatusNotFound,
-				Error:   "not_found",
-				Message: "Service account not found",
-			})
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Service account not found")
 		}
 		h.logger.Error("Failed to rotate service account keys: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Status:  fiber.StatusInternalServerError,
-			Error:   "internal_server_error",
-			Message: "Failed to rotate service account keys",
-		})
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to rotate service account keys")
 	}
 
 	return c.JSON(SuccessResponse{
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/events"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+const (
+	defaultUsernameSimilarity = 0.6
+	defaultDuplicateLimit     = 100
+	maxDuplicateLimit         = 500
+)
+
+// MergeUsersRequest names the account folded into the one in the path
+type MergeUsersRequest struct {
+	SourceUserID string `json:"source_user_id" validate:"required"`
+}
+
+// FindDuplicateUsers lists pairs of users that probably belong to the same
+// person. ADMIN ONLY.
+//
+//	@Summary		Find duplicate users
+//	@Description	List pairs of users of the organization that probably belong to the same person: their emails deliver to the same mailbox (ignoring case, "+tag" suffixes and dots in Gmail addresses) or their usernames are alike. Each pair suggests the account to keep: the verified one, else the one used most recently, else the older one.
+//	@Tags			User Management
+//	@Produce		json
+//	@Param			min_similarity	query		number			false	"Minimum username similarity between 0.3 and 1 (default 0.6)"
+//	@Param			limit			query		int				false	"Maximum number of pairs (default 100, max 500)"
+//	@Success		200				{object}	SuccessResponse	"Duplicate candidates"
+//	@Failure		400				{object}	ErrorResponse	"Invalid parameters"
+//	@Failure		403				{object}	ErrorResponse	"Forbidden"
+//	@Security		BearerAuth
+//	@Router			/users/duplicates [get]
+func (h *UserHandler) FindDuplicateUsers(c *fiber.Ctx) error {
+	orgID := c.Locals("organization_id").(string)
+
+	minSimilarity := c.QueryFloat("min_similarity", defaultUsernameSimilarity)
+	if minSimilarity < 0.3 || minSimilarity > 1 {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "min_similarity must be between 0.3 and 1")
+	}
+	limit := c.QueryInt("limit", defaultDuplicateLimit)
+	if limit < 1 || limit > maxDuplicateLimit {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "limit must be between 1 and 500")
+	}
+
+	users, err := h.queries.Organization.WithContext(c.UserContext()).ListOrganizationUsers(orgID)
+	if err != nil {
+		h.logger.Error("Failed to list users of organization %s: %v", orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to find duplicate users")
+	}
+	similar, err := h.queries.User.WithContext(c.UserContext()).ListSimilarUsernames(orgID, minSimilarity, limit)
+	if err != nil {
+		h.logger.Error("Failed to find similar usernames in organization %s: %v", orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to find duplicate users")
+	}
+
+	byID := make(map[string]models.User, len(users))
+	byEmail := make(map[string][]string)
+	for _, u := range users {
+		byID[u.ID] = u
+		email := utils.CanonicalEmail(u.Email)
+		byEmail[email] = append(byEmail[email], u.ID)
+	}
+
+	candidates := map[[2]string]*models.DuplicateUserCandidate{}
+	candidate := func(a, b string) *models.DuplicateUserCandidate {
+		if b < a {
+			a, b = b, a
+		}
+		key := [2]string{a, b}
+		if candidates[key] == nil {
+			candidates[key] = &models.DuplicateUserCandidate{Users: [2]models.User{byID[a], byID[b]}}
+		}
+		return candidates[key]
+	}
+	for _, ids := range byEmail {
+		for i := range ids {
+			for j := i + 1; j < len(ids); j++ {
+				dup := candidate(ids[i], ids[j])
+				dup.Reasons = append(dup.Reasons, "same_email")
+			}
+		}
+	}
+	for _, pair := range similar {
+		if _, ok := byID[pair.UserIDs[0]]; !ok {
+			continue
+		}
+		if _, ok := byID[pair.UserIDs[1]]; !ok {
+			continue
+		}
+		dup := candidate(pair.UserIDs[0], pair.UserIDs[1])
+		dup.Reasons = append(dup.Reasons, "similar_username")
+		dup.UsernameSimilarity = pair.Similarity
+	}
+
+	result := make([]models.DuplicateUserCandidate, 0, len(candidates))
+	for _, dup := range candidates {
+		dup.SuggestedTargetID = suggestedMergeTarget(dup.Users[0], dup.Users[1]).ID
+		result = append(result, *dup)
+	}
+	// Shared mailboxes are the stronger signal, so they come first
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if sa, sb := a.Reasons[0] == "same_email", b.Reasons[0] == "same_email"; sa != sb {
+			return sa
+		}
+		if a.UsernameSimilarity != b.UsernameSimilarity {
+			return a.UsernameSimilarity > b.UsernameSimilarity
+		}
+		return a.Users[0].ID < b.Users[0].ID
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+
+	return apiSuccess(c, fiber.StatusOK, "Duplicate users retrieved", fiber.Map{
+		"candidates":     result,
+		"min_similarity": minSimilarity,
+	})
+}
+
+// suggestedMergeTarget picks the account of a duplicate pair to keep: the
+// one with a verified email, else the one used most recently, else the older
+func suggestedMergeTarget(a, b models.User) models.User {
+	if a.EmailVerified != b.EmailVerified {
+		if a.EmailVerified {
+			return a
+		}
+		return b
+	}
+	switch {
+	case a.LastLogin != nil && (b.LastLogin == nil || a.LastLogin.After(*b.LastLogin)):
+		return a
+	case b.LastLogin != nil && (a.LastLogin == nil || b.LastLogin.After(*a.LastLogin)):
+		return b
+	case b.CreatedAt.Before(a.CreatedAt):
+		return b
+	}
+	return a
+}
+
+// MergeUsers folds another user into this one. ADMIN ONLY.
+//
+//	@Summary		Merge users
+//	@Description	Fold the source user into the user in the path, which survives. The survivor takes over the source's role assignments and group memberships (keeping the later expiry where both had one), the content it owns or collaborates on, its sessions and its usernames, which keep resolving as aliases. The source's sessions are revoked and the source user is soft-deleted; its password, MFA and profile are not carried over. Requires a recent MFA verification.
+//	@Tags			User Management
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string				true	"ID of the user that survives"
+//	@Param			request	body		MergeUsersRequest	true	"User to merge away"
+//	@Success		200		{object}	SuccessResponse		"What was moved"
+//	@Failure		400		{object}	ErrorResponse		"Invalid request"
+//	@Failure		403		{object}	ErrorResponse		"Forbidden"
+//	@Failure		404		{object}	ErrorResponse		"User not found"
+//	@Security		BearerAuth
+//	@Router			/users/{id}/merge [post]
+func (h *UserHandler) MergeUsers(c *fiber.Ctx) error {
+	targetID := c.Params("id")
+	orgID := c.Locals("organization_id").(string)
+	actor := c.Locals("user_id").(string)
+
+	var req MergeUsersRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request format")
+	}
+	if req.SourceUserID == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "source_user_id is required")
+	}
+	if req.SourceUserID == targetID {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "source_user_id must differ from the user it is merged into")
+	}
+	if req.SourceUserID == actor {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "You cannot merge away your own account")
+	}
+
+	var merge *models.UserMerge
+	err := h.queries.Transact(c.UserContext(), func(q *queries.Queries) error {
+		var err error
+		merge, err = q.User.MergeUsers(req.SourceUserID, targetID, orgID)
+		return err
+	})
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Both users must exist in your organization")
+		}
+		h.logger.Error("Failed to merge user %s into %s: %v", req.SourceUserID, targetID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to merge users")
+	}
+
+	details, _ := json.Marshal(merge)
+	h.audit.LogEvent(c.Context(), models.AuditEvent{
+		OrganizationID:    orgID,
+		PrincipalID:       utils.StringPtr(actor),
+		PrincipalType:     utils.StringPtr("user"),
+		Action:            "merge_users",
+		ResourceType:      utils.StringPtr("user"),
+		ResourceID:        utils.StringPtr(targetID),
+		Result:            "success",
+		AdditionalContext: string(details),
+		Severity:          "critical",
+	})
+	if merge.RevokedSessions > 0 {
+		publish(h.events, c, events.Event{Type: events.SessionRevoked, Subject: req.SourceUserID})
+	}
+
+	h.logger.Info("User %s merged into %s by %s", req.SourceUserID, targetID, actor)
+	return apiSuccess(c, fiber.StatusOK, "Users merged successfully", merge)
+}
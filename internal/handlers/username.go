@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/middleware"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+// usernamePattern matches the users.valid_username constraint within the
+// length limits of RegisterRequest
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{3,50}$`)
+
+// reservedUsernames are refused in every organization: they collide with
+// routes and system accounts or invite impersonation of staff
+var reservedUsernames = map[string]bool{
+	"abuse": true, "admin": true, "administrator": true, "anonymous": true, "api": true,
+	"help": true, "me": true, "moderator": true, "no-reply": true, "noreply": true,
+	"null": true, "official": true, "postmaster": true, "root": true, "security": true,
+	"staff": true, "support": true, "system": true, "undefined": true, "webmaster": true,
+}
+
+const (
+	// defaultUsernameChangeCooldown applies when the organization sets no
+	// settings.username.change_cooldown_days
+	defaultUsernameChangeCooldown = 30 * 24 * time.Hour
+	// maxReservedUsernames bounds settings.username.reserved_names
+	maxReservedUsernames = 1000
+)
+
+// Reasons a username cannot be taken
+const (
+	usernameInvalid  = "invalid"
+	usernameReserved = "reserved"
+	usernameTaken    = "taken"
+)
+
+// validateUsernamePolicy checks the username settings of an organization
+func validateUsernamePolicy(p *models.UsernamePolicy) error {
+	if len(p.ReservedNames) > maxReservedUsernames {
+		return fmt.Errorf("at most %d reserved_names are supported", maxReservedUsernames)
+	}
+	for i, name := range p.ReservedNames {
+		if name = strings.TrimSpace(name); name == "" {
+			return fmt.Errorf("reserved_names must not contain empty names")
+		}
+		p.ReservedNames[i] = name
+	}
+	if d := p.ChangeCooldownDays; d != nil && (*d < 0 || *d > 3650) {
+		return fmt.Errorf("change_cooldown_days must be between 0 and 3650")
+	}
+	return nil
+}
+
+// usernameChangeCooldown returns the minimum time between two renames
+func usernameChangeCooldown(p *models.UsernamePolicy) time.Duration {
+	if p == nil || p.ChangeCooldownDays == nil {
+		return defaultUsernameChangeCooldown
+	}
+	return time.Duration(*p.ChangeCooldownDays) * 24 * time.Hour
+}
+
+// usernameUnavailable returns why userID (empty for a new user) cannot take
+// the username in the organization, or "" when it can
+func usernameUnavailable(ctx context.Context, q *queries.Queries, policy *models.UsernamePolicy, orgID, userID, username string) (string, error) {
+	if !usernamePattern.MatchString(username) {
+		return usernameInvalid, nil
+	}
+	lower := strings.ToLower(username)
+	if reservedUsernames[lower] {
+		return usernameReserved, nil
+	}
+	if policy != nil {
+		for _, name := range policy.ReservedNames {
+			if strings.ToLower(name) == lower {
+				return usernameReserved, nil
+			}
+		}
+	}
+	available, err := q.User.WithContext(ctx).UsernameAvailable(username, orgID, userID)
+	if err != nil {
+		return "", err
+	}
+	if !available {
+		return usernameTaken, nil
+	}
+	return "", nil
+}
+
+// usernameRefused responds to a username that cannot be taken
+func usernameRefused(c *fiber.Ctx, reason string) error {
+	switch reason {
+	case usernameTaken:
+		return apiError(c, fiber.StatusConflict, apierror.CodeConflict, "This username is already taken")
+	case usernameReserved:
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "This username is reserved")
+	}
+	return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "Username must be 3 to 50 letters, digits, dots, underscores or hyphens")
+}
+
+// CheckUsername reports whether a username can be registered
+//
+//	@Summary		Check username availability
+//	@Description	Check whether a username is free in an organization. Reserved and formerly used usernames are unavailable.
+//	@Tags			Authentication
+//	@Produce		json
+//	@Param			username		query		string			true	"Username"
+//	@Param			organization_id	query		string			true	"Organization ID"
+//	@Success		200				{object}	SuccessResponse	"Availability with a reason (invalid, reserved, taken) when unavailable"
+//	@Failure		400				{object}	ErrorResponse	"Missing parameters"
+//	@Failure		404				{object}	ErrorResponse	"Organization not found"
+//	@Failure		429				{object}	ErrorResponse	"Too many checks"
+//	@Router			/auth/check-username [get]
+func (h *AuthHandler) CheckUsername(c *fiber.Ctx) error {
+	username := strings.TrimSpace(c.Query("username"))
+	orgID := c.Query("organization_id")
+	if username == "" || orgID == "" {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "username and organization_id are required")
+	}
+	if _, err := uuid.Parse(orgID); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid organization_id")
+	}
+
+	policy, err := h.queries.Organization.WithContext(c.UserContext()).GetUsernamePolicy(orgID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization not found")
+		}
+		h.logger.Error("Failed to load username policy for org %s: %v", orgID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to check username")
+	}
+	reason, err := usernameUnavailable(c.UserContext(), h.queries, policy, orgID, "", username)
+	if err != nil {
+		h.logger.Error("Failed to check username availability: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to check username")
+	}
+
+	data := fiber.Map{"username": username, "available": reason == ""}
+	if reason != "" {
+		data["reason"] = reason
+	}
+	return apiSuccess(c, fiber.StatusOK, "Username checked", data)
+}
+
+// checkNewUsername refuses a registration whose username cannot be taken
+func (h *AuthHandler) checkNewUsername(c *fiber.Ctx, orgID, username string) (bool, error) {
+	policy, err := h.queries.Organization.WithContext(c.UserContext()).GetUsernamePolicy(orgID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return true, apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "Organization not found")
+		}
+		h.logger.Error("Failed to load username policy for org %s: %v", orgID, err)
+		return true, apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to process registration")
+	}
+	reason, err := usernameUnavailable(c.UserContext(), h.queries, policy, orgID, "", username)
+	if err != nil {
+		h.logger.Error("Failed to check username availability: %v", err)
+		return true, apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to process registration")
+	}
+	if reason != "" {
+		return true, usernameRefused(c, reason)
+	}
+	return false, nil
+}
+
+// ChangeUsernameRequest is the body of PATCH /users/me/username
+type ChangeUsernameRequest struct {
+	Username string `json:"username" validate:"required,min=3,max=50" example:"new.name"`
+} //@name ChangeUsernameRequest
+
+// ChangeMyUsername renames the authenticated user. The previous username
+// stays reserved for them and keeps resolving in content URLs, which
+// redirect to the new one.
+//
+//	@Summary		Change own username
+//	@Description	Rename the authenticated user, subject to the organization's reserved names and change cooldown
+//	@Tags			User Management
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		ChangeUsernameRequest	true	"New username"
+//	@Success		200		{object}	SuccessResponse			"Username changed"
+//	@Failure		400		{object}	ErrorResponse			"Invalid or reserved username"
+//	@Failure		401		{object}	ErrorResponse			"Unauthorized"
+//	@Failure		409		{object}	ErrorResponse			"Username taken"
+//	@Failure		429		{object}	ErrorResponse			"Changed too recently; details carry next_change_at"
+//	@Failure		500		{object}	ErrorResponse			"Internal server error"
+//	@Security		BearerAuth
+//	@Router			/users/me/username [patch]
+func (h *UserHandler) ChangeMyUsername(c *fiber.Ctx) error {
+	tc := middleware.GetTenantContext(c)
+	if tc == nil {
+		return apiError(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Tenant context not resolved")
+	}
+	var req ChangeUsernameRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+	}
+	req.Username = strings.TrimSpace(req.Username)
+
+	ctx := c.UserContext()
+	user, err := h.queries.User.WithContext(ctx).GetUser(tc.UserID, tc.OrganizationID)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "User not found")
+		}
+		h.logger.Error("Failed to get user for username change: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to change username")
+	}
+	if req.Username == user.Username {
+		return apiError(c, fiber.StatusBadRequest, apierror.CodeValidationFailed, "This is already your username")
+	}
+
+	policy, err := h.queries.Organization.WithContext(ctx).GetUsernamePolicy(tc.OrganizationID)
+	if err != nil {
+		h.logger.Error("Failed to load username policy for org %s: %v", tc.OrganizationID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to change username")
+	}
+	reason, err := usernameUnavailable(ctx, h.queries, policy, tc.OrganizationID, tc.UserID, req.Username)
+	if err != nil {
+		h.logger.Error("Failed to check username availability: %v", err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to change username")
+	}
+	if reason != "" {
+		return usernameRefused(c, reason)
+	}
+
+	last, err := h.queries.User.WithContext(ctx).LastUsernameChange(tc.UserID, tc.OrganizationID)
+	if err != nil {
+		h.logger.Error("Failed to read last username change of %s: %v", tc.UserID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to change username")
+	}
+	if last != nil {
+		next := last.Add(usernameChangeCooldown(policy))
+		if wait := time.Until(next); wait > 0 {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(wait.Seconds())+1))
+			return apiError(c, fiber.StatusTooManyRequests, apierror.CodeRateLimited, "Your username was changed too recently",
+				fiber.Map{"next_change_at": next})
+		}
+	}
+
+	previous, err := h.queries.User.WithContext(ctx).ChangeUsername(tc.UserID, tc.OrganizationID, req.Username)
+	if err != nil {
+		if isConflictErr(err) {
+			return usernameRefused(c, usernameTaken)
+		}
+		h.logger.Error("Failed to change username of %s: %v", tc.UserID, err)
+		return apiError(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to change username")
+	}
+
+	h.audit.LogEvent(c.Context(), models.AuditEvent{
+		OrganizationID:    tc.OrganizationID,
+		PrincipalID:       utils.StringPtr(tc.UserID),
+		PrincipalType:     utils.StringPtr("user"),
+		Action:            "change_username",
+		ResourceType:      utils.StringPtr("user"),
+		ResourceID:        utils.StringPtr(tc.UserID),
+		Result:            "success",
+		AdditionalContext: fmt.Sprintf(`{"previous_username":%q,"username":%q}`, previous, req.Username),
+		Severity:          "warn",
+	})
+
+	return apiSuccess(c, fiber.StatusOK, "Username changed", fiber.Map{
+		"username":          req.Username,
+		"previous_username": previous,
+	})
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+)
+
+// cacheSecurityTxt lets caches hold security.txt for a day; it changes with
+// the configuration only
+const cacheSecurityTxt = "public, max-age=86400"
+
+// GetAuthorizationServerMetadata returns the OAuth 2.0 authorization server
+// metadata
+//
+//	@Summary		OAuth 2.0 authorization server metadata
+//	@Description	Returns the authorization server metadata of RFC 8414, for OAuth clients that do not read the OpenID Connect discovery document. When OIDC_ISSUER has a path, the metadata is also served with that path appended, as RFC 8414 section 3 asks; other paths are not found.
+//	@Tags			Federation
+//	@Produce		json
+//	@Success		200	{object}	map[string]interface{}
+//	@Success		304	"Not modified"
+//	@Failure		404	{object}	ErrorResponse	"Not the issuer's path"
+//	@Router			/.well-known/oauth-authorization-server [get]
+func (h *OIDCHandler) GetAuthorizationServerMetadata(c *fiber.Ctx) error {
+	if suffix := strings.Trim(c.Params("*"), "/"); suffix != "" {
+		issuer, err := url.Parse(h.config.OIDCIssuer)
+		if err != nil || suffix != strings.Trim(issuer.Path, "/") {
+			return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "No authorization server at this path")
+		}
+	}
+	return conditionalJSON(c, h.oidc.GetAuthorizationServerMetadata(), cacheDiscovery)
+}
+
+// ChangePassword sends password managers to the page where users change
+// their password
+//
+//	@Summary		Change password URL
+//	@Description	Redirects to the account settings page of the web app (FRONTEND_URL), where users change their password, as the W3C well-known URL for changing passwords defines
+//	@Tags			Federation
+//	@Success		302	"Redirect to the account settings page"
+//	@Router			/.well-known/change-password [get]
+func (h *OIDCHandler) ChangePassword(c *fiber.Ctx) error {
+	return c.Redirect(h.config.FrontendURL+"/account-settings", fiber.StatusFound)
+}
+
+// GetSecurityTxt returns the security.txt of the deployment
+//
+//	@Summary		security.txt
+//	@Description	Returns the security contact information of RFC 9116, from SECURITY_CONTACTS, SECURITY_POLICY_URL and SECURITY_TXT_EXPIRES. Not found unless SECURITY_CONTACTS is set.
+//	@Tags			Federation
+//	@Produce		plain
+//	@Success		200	{string}	string			"security.txt"
+//	@Success		304	"Not modified"
+//	@Failure		404	{object}	ErrorResponse	"No security contacts configured"
+//	@Router			/.well-known/security.txt [get]
+func (h *OIDCHandler) GetSecurityTxt(c *fiber.Ctx) error {
+	if len(h.config.SecurityContacts) == 0 {
+		return apiError(c, fiber.StatusNotFound, apierror.CodeNotFound, "No security contacts are configured")
+	}
+
+	var b strings.Builder
+	for _, contact := range h.config.SecurityContacts {
+		b.WriteString("Contact: " + contact + "\n")
+	}
+	b.WriteString("Expires: " + h.config.SecurityTxtExpires.UTC().Format(time.RFC3339) + "\n")
+	if h.config.SecurityPolicyURL != "" {
+		b.WriteString("Policy: " + h.config.SecurityPolicyURL + "\n")
+	}
+	b.WriteString("Canonical: " + h.config.PublicURL + "/.well-known/security.txt\n")
+	b.WriteString("Preferred-Languages: en\n")
+
+	body := []byte(b.String())
+	if notModified(c, bodyETag(body), time.Time{}, cacheSecurityTxt) {
+		return nil
+	}
+	c.Type("txt", "utf-8")
+	return c.Send(body)
+}
@@ -0,0 +1,384 @@
+// Package jobs runs recurring background work. Jobs are registered with a
+// cron-like schedule and executed by every replica's Scheduler; a Redis lock
+// makes sure that only one replica runs a given job at a time, and the outcome
+// of every run is kept in a bounded history in Redis.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+const (
+	defaultTimeout = 10 * time.Minute
+	// lockMargin keeps the lock alive a little past the job timeout so a
+	// run that is being cancelled is not overlapped by another replica
+	lockMargin    = time.Minute
+	historyLength = 100
+)
+
+var (
+	// ErrJobNotFound is returned for operations on an unregistered job
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobRunning is returned when a job is triggered while a run is in
+	// progress on any replica
+	ErrJobRunning = errors.New("job is already running")
+)
+
+// Func is the work performed by a job. It should return promptly once ctx
+// is cancelled.
+type Func func(ctx context.Context) error
+
+// Job describes a recurring unit of work
+type Job struct {
+	Name        string
+	Description string
+	Schedule    string        // see ParseSchedule
+	Timeout     time.Duration // defaults to 10 minutes
+	Run         Func
+}
+
+// Run records a single execution of a job
+type Run struct {
+	ID          string     `json:"id"`
+	Job         string     `json:"job"`
+	Trigger     string     `json:"trigger"` // schedule, manual
+	TriggeredBy string     `json:"triggered_by,omitempty"`
+	Instance    string     `json:"instance"`
+	Status      string     `json:"status"` // running, succeeded, failed
+	Error       string     `json:"error,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	DurationMS  int64      `json:"duration_ms,omitempty"`
+}
+
+// Info summarizes a registered job for the admin API
+type Info struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Schedule    string     `json:"schedule"`
+	Timeout     string     `json:"timeout"`
+	NextRun     *time.Time `json:"next_run,omitempty"`
+	Running     *Run       `json:"running,omitempty"`
+	LastRun     *Run       `json:"last_run,omitempty"`
+}
+
+type entry struct {
+	job      Job
+	schedule Schedule
+	next     time.Time
+}
+
+// Scheduler executes registered jobs on their schedules
+type Scheduler struct {
+	redis    redis.UniversalClient
+	logger   *logger.Logger
+	instance string
+
+	mu      sync.RWMutex
+	entries map[string]*entry
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewScheduler creates a Scheduler. Jobs must be registered before Start.
+func NewScheduler(redis redis.UniversalClient, l *logger.Logger) *Scheduler {
+	instance, err := os.Hostname()
+	if err != nil || instance == "" {
+		instance = "unknown"
+	}
+	instance += ":" + uuid.NewString()[:8]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		redis:    redis,
+		logger:   l,
+		instance: instance,
+		entries:  make(map[string]*entry),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+func lockKey(name string) string    { return "jobs:lock:" + name }
+func historyKey(name string) string { return "jobs:history:" + name }
+
+// Register adds a job to the scheduler
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" || job.Run == nil {
+		return fmt.Errorf("job must have a name and a run function")
+	}
+	schedule, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = defaultTimeout
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.entries[job.Name]; exists {
+		return fmt.Errorf("job %s is already registered", job.Name)
+	}
+	s.entries[job.Name] = &entry{job: job, schedule: schedule}
+	return nil
+}
+
+// Start launches one scheduling loop per registered job
+func (s *Scheduler) Start() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, e := range s.entries {
+		s.wg.Add(1)
+		go s.loop(e)
+	}
+	s.logger.Info("Job scheduler started with %d jobs (instance %s)", len(s.entries), s.instance)
+}
+
+// Stop cancels running jobs and waits for them and the scheduling loops to exit
+func (s *Scheduler) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(e *entry) {
+	defer s.wg.Done()
+	for {
+		next := e.schedule.Next(time.Now())
+		if next.IsZero() {
+			s.logger.Warn("Job %s has no upcoming run; schedule %q never matches", e.job.Name, e.job.Schedule)
+			return
+		}
+		s.mu.Lock()
+		e.next = next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		run, err := s.acquire(e, "schedule", "")
+		if errors.Is(err, ErrJobRunning) {
+			// Another replica (or a manual trigger) got there first
+			continue
+		}
+		if err != nil {
+			s.logger.Error("Job %s: failed to acquire lock: %v", e.job.Name, err)
+			continue
+		}
+		s.execute(e, run)
+	}
+}
+
+// Trigger starts a run of the named job immediately, outside its schedule.
+// The run proceeds in the background; the returned Run has status running.
+func (s *Scheduler) Trigger(name, triggeredBy string) (*Run, error) {
+	s.mu.RLock()
+	e, ok := s.entries[name]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+
+	run, err := s.acquire(e, "manual", triggeredBy)
+	if err != nil {
+		return nil, err
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.execute(e, run)
+	}()
+	return run, nil
+}
+
+// acquire takes the distributed lock of a job. The lock value is the Run
+// being started so that other replicas can report what is in progress.
+func (s *Scheduler) acquire(e *entry, trigger, triggeredBy string) (*Run, error) {
+	run := &Run{
+		ID:          uuid.NewString(),
+		Job:         e.job.Name,
+		Trigger:     trigger,
+		TriggeredBy: triggeredBy,
+		Instance:    s.instance,
+		Status:      "running",
+		StartedAt:   time.Now(),
+	}
+	raw, err := json.Marshal(run)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.redis.SetNX(s.ctx, lockKey(e.job.Name), raw, e.job.Timeout+lockMargin).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrJobRunning
+	}
+	return run, nil
+}
+
+// releaseScript deletes the lock only if it still belongs to this run
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func (s *Scheduler) execute(e *entry, run *Run) {
+	lockValue, _ := json.Marshal(run)
+
+	ctx, cancel := context.WithTimeout(s.ctx, e.job.Timeout)
+	err := safeRun(ctx, e.job.Run)
+	cancel()
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+	run.DurationMS = finished.Sub(run.StartedAt).Milliseconds()
+	if err != nil {
+		run.Status = "failed"
+		run.Error = err.Error()
+		s.logger.Error("Job %s failed after %s: %v", e.job.Name, finished.Sub(run.StartedAt), err)
+	} else {
+		run.Status = "succeeded"
+		s.logger.Debug("Job %s succeeded in %s", e.job.Name, finished.Sub(run.StartedAt))
+	}
+
+	// The scheduler context may already be cancelled during shutdown; the
+	// bookkeeping below must still happen
+	bg, cancelBg := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelBg()
+
+	if raw, err := json.Marshal(run); err == nil {
+		pipe := s.redis.TxPipeline()
+		pipe.LPush(bg, historyKey(e.job.Name), raw)
+		pipe.LTrim(bg, historyKey(e.job.Name), 0, historyLength-1)
+		if _, err := pipe.Exec(bg); err != nil {
+			s.logger.Error("Job %s: failed to record run history: %v", e.job.Name, err)
+		}
+	}
+	if err := releaseScript.Run(bg, s.redis, []string{lockKey(e.job.Name)}, string(lockValue)).Err(); err != nil {
+		s.logger.Error("Job %s: failed to release lock: %v", e.job.Name, err)
+	}
+}
+
+// safeRun executes fn, converting a panic into an error so a faulty job
+// cannot take the scheduler down
+func safeRun(ctx context.Context, fn Func) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
+
+// Jobs lists the registered jobs with their current state, sorted by name
+func (s *Scheduler) Jobs(ctx context.Context) ([]Info, error) {
+	s.mu.RLock()
+	names := make([]string, 0, len(s.entries))
+	for name := range s.entries {
+		names = append(names, name)
+	}
+	s.mu.RUnlock()
+	sort.Strings(names)
+
+	infos := make([]Info, 0, len(names))
+	for _, name := range names {
+		info, err := s.Job(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, *info)
+	}
+	return infos, nil
+}
+
+// Job returns the state of a single registered job
+func (s *Scheduler) Job(ctx context.Context, name string) (*Info, error) {
+	s.mu.RLock()
+	e, ok := s.entries[name]
+	var next time.Time
+	if ok {
+		next = e.next
+	}
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+
+	info := &Info{
+		Name:        e.job.Name,
+		Description: e.job.Description,
+		Schedule:    e.job.Schedule,
+		Timeout:     e.job.Timeout.String(),
+	}
+	if !next.IsZero() {
+		info.NextRun = &next
+	}
+
+	raw, err := s.redis.Get(ctx, lockKey(name)).Bytes()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	if err == nil {
+		var running Run
+		if json.Unmarshal(raw, &running) == nil {
+			info.Running = &running
+		}
+	}
+
+	history, err := s.History(ctx, name, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) > 0 {
+		info.LastRun = &history[0]
+	}
+	return info, nil
+}
+
+// History returns the most recent runs of a job, newest first
+func (s *Scheduler) History(ctx context.Context, name string, limit int) ([]Run, error) {
+	s.mu.RLock()
+	_, ok := s.entries[name]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	if limit <= 0 || limit > historyLength {
+		limit = historyLength
+	}
+
+	items, err := s.redis.LRange(ctx, historyKey(name), 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]Run, 0, len(items))
+	for _, item := range items {
+		var run Run
+		if err := json.Unmarshal([]byte(item), &run); err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
@@ -0,0 +1,155 @@
+// Package kerberos accepts the Kerberos 5 service tickets browsers and
+// desktops send through SPNEGO (HTTP Negotiate, RFC 4559) on intranets.
+// Tickets are decrypted and their authenticators checked by gokrb5, with the
+// service's keys from a keytab. Only tickets encrypted with the AES
+// encryption types are accepted, and NTLM is refused.
+package kerberos
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+// MaxClockSkew is how far the clocks of clients and the server may differ
+const MaxClockSkew = 5 * time.Minute
+
+// ErrUnsupportedMechanism is returned for Negotiate tokens of another
+// mechanism than Kerberos, such as NTLM
+var ErrUnsupportedMechanism = errors.New("kerberos: only Kerberos is supported through Negotiate")
+
+// Principal is the client a ticket was issued to
+type Principal struct {
+	Name  string // components joined with "/", such as alice
+	Realm string // such as CORP.EXAMPLE.COM
+}
+
+func (p Principal) String() string { return p.Name + "@" + p.Realm }
+
+// Context is an accepted security context
+type Context struct {
+	Client Principal
+	// ExpiresAt is the end of the ticket
+	ExpiresAt time.Time
+	// ReplayKey identifies the authenticator; seeing it twice within
+	// MaxClockSkew is a replay. gokrb5 only remembers authenticators per
+	// process, so replicas have to share these.
+	ReplayKey string
+	// ResponseToken is returned to the client in WWW-Authenticate to
+	// complete SPNEGO; it is empty for bare Kerberos tokens
+	ResponseToken []byte
+}
+
+// Acceptor accepts the tickets of one or every service principal of a
+// keytab
+type Acceptor struct {
+	keytab   *keytab.Keytab
+	service  string
+	settings *service.Settings
+}
+
+// NewAcceptor accepts tickets for spn, a service principal such as
+// HTTP/iam.corp.example.com, or for any principal of the keytab when spn
+// is empty
+func NewAcceptor(kt *keytab.Keytab, spn string) *Acceptor {
+	return &Acceptor{
+		keytab:  kt,
+		service: strings.TrimSpace(spn),
+		// The PAC is Active Directory's group data, which sign-in does
+		// not use
+		settings: service.NewSettings(kt, service.MaxClockSkew(MaxClockSkew), service.DecodePAC(false)),
+	}
+}
+
+// Principals lists the principals of the keytab, such as
+// HTTP/iam.corp.example.com@CORP.EXAMPLE.COM
+func (a *Acceptor) Principals() []string {
+	seen := map[string]bool{}
+	var principals []string
+	for _, e := range a.keytab.Entries {
+		p := strings.Join(e.Principal.Components, "/") + "@" + e.Principal.Realm
+		if !seen[p] {
+			seen[p] = true
+			principals = append(principals, p)
+		}
+	}
+	return principals
+}
+
+// Accept validates a SPNEGO token, or a bare Kerberos GSS-API token, and
+// returns the client it authenticates
+func (a *Acceptor) Accept(token []byte) (*Context, error) {
+	var krb spnego.KRB5Token
+	var spnegoToken spnego.SPNEGOToken
+	isSPNEGO := spnegoToken.Unmarshal(token) == nil && spnegoToken.Init
+	if isSPNEGO {
+		// The optimistic token is for the client's preferred mechanism
+		mechs := spnegoToken.NegTokenInit.MechTypes
+		if len(mechs) == 0 || !isKerberos(mechs[0]) {
+			return nil, ErrUnsupportedMechanism
+		}
+		if len(spnegoToken.NegTokenInit.MechTokenBytes) == 0 {
+			return nil, errors.New("kerberos: NegTokenInit carries no Kerberos token")
+		}
+		if err := krb.Unmarshal(spnegoToken.NegTokenInit.MechTokenBytes); err != nil {
+			return nil, fmt.Errorf("kerberos: %v", err)
+		}
+	} else if err := krb.Unmarshal(token); err != nil {
+		return nil, ErrUnsupportedMechanism
+	}
+	if !krb.IsAPReq() {
+		return nil, errors.New("kerberos: not an AP-REQ")
+	}
+
+	req := &krb.APReq
+	switch req.Ticket.EncPart.EType {
+	case etypeID.AES128_CTS_HMAC_SHA1_96, etypeID.AES256_CTS_HMAC_SHA1_96,
+		etypeID.AES128_CTS_HMAC_SHA256_128, etypeID.AES256_CTS_HMAC_SHA384_192:
+	default:
+		return nil, fmt.Errorf("kerberos: encryption type %d is not accepted, only AES", req.Ticket.EncPart.EType)
+	}
+	// Principal names are case-sensitive
+	sname := req.Ticket.SName.PrincipalNameString()
+	if a.service != "" && sname != a.service {
+		return nil, fmt.Errorf("kerberos: ticket is for %s, not %s", sname, a.service)
+	}
+	ok, creds, err := service.VerifyAPREQ(req, a.settings)
+	if err != nil {
+		return nil, fmt.Errorf("kerberos: %v", err)
+	}
+	if !ok {
+		return nil, errors.New("kerberos: the ticket was refused")
+	}
+
+	client := Principal{Name: creds.CName().PrincipalNameString(), Realm: creds.Domain()}
+	replay := sha256.Sum256(append([]byte(req.Ticket.Realm+"\x00"+sname+"\x00"), req.EncryptedAuthenticator.Cipher...))
+	ctx := &Context{
+		Client:    client,
+		ExpiresAt: creds.ValidUntil(),
+		ReplayKey: hex.EncodeToString(replay[:]),
+	}
+	if isSPNEGO {
+		resp := spnego.NegTokenResp{
+			NegState:      asn1.Enumerated(spnego.NegStateAcceptCompleted),
+			SupportedMech: spnegoToken.NegTokenInit.MechTypes[0],
+		}
+		if ctx.ResponseToken, err = resp.Marshal(); err != nil {
+			return nil, err
+		}
+	}
+	return ctx, nil
+}
+
+func isKerberos(mech asn1.ObjectIdentifier) bool {
+	return gssapi.OIDKRB5.OID().Equal(mech) || gssapi.OIDMSLegacyKRB5.OID().Equal(mech)
+}
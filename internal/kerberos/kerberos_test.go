@@ -0,0 +1,184 @@
+package kerberos
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+const (
+	testService = "HTTP/iam.corp.example.com"
+	testRealm   = "CORP.EXAMPLE.COM"
+)
+
+// testKeytab holds the service's keys, derived from password
+func testKeytab(t *testing.T, password string, etypes ...int32) *keytab.Keytab {
+	t.Helper()
+	kt := keytab.New()
+	for _, etype := range etypes {
+		if err := kt.AddEntry(testService, testRealm, password, time.Now(), 3, etype); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return kt
+}
+
+type testRequest struct {
+	service string
+	client  string
+	etype   int32
+	start   time.Time
+	end     time.Time
+	// keys the ticket is encrypted with, which the KDC shares with the
+	// service
+	keys   *keytab.Keytab
+	spnego bool
+	mechs  []asn1.ObjectIdentifier
+}
+
+func defaultRequest(t *testing.T) testRequest {
+	now := time.Now()
+	return testRequest{
+		service: testService,
+		client:  "alice",
+		etype:   etypeID.AES256_CTS_HMAC_SHA1_96,
+		start:   now.Add(-time.Hour),
+		end:     now.Add(9 * time.Hour),
+		keys:    testKeytab(t, "service-secret", etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.RC4_HMAC),
+		spnego:  true,
+		mechs:   []asn1.ObjectIdentifier{gssapi.OIDMSLegacyKRB5.OID(), gssapi.OIDKRB5.OID()},
+	}
+}
+
+// token builds the Negotiate token a client would send, with a ticket as
+// the KDC would issue it
+func (r testRequest) token(t *testing.T) []byte {
+	t.Helper()
+	// The ticket is looked up in the keytab under the service's name
+	keys := keytab.New()
+	for _, e := range r.keys.Entries {
+		e.Principal.Components = strings.Split(r.service, "/")
+		keys.Entries = append(keys.Entries, e)
+	}
+	tkt, sessionKey, err := messages.NewTicket(
+		types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, r.client), testRealm,
+		types.NewPrincipalName(nametype.KRB_NT_SRV_INST, r.service), testRealm,
+		types.NewKrbFlags(), keys, r.etype, 3, r.start, r.start, r.end, r.end,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := client.NewWithPassword(r.client, testRealm, "client-secret", config.New())
+	krb, err := spnego.NewKRB5TokenAPREQ(cl, tkt, sessionKey, []int{gssapi.ContextFlagInteg}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := krb.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.spnego {
+		return raw
+	}
+	neg := spnego.SPNEGOToken{Init: true, NegTokenInit: spnego.NegTokenInit{MechTypes: r.mechs, MechTokenBytes: raw}}
+	token, err := neg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestAccept(t *testing.T) {
+	acceptor := NewAcceptor(testKeytab(t, "service-secret", etypeID.AES256_CTS_HMAC_SHA1_96), testService)
+	if got := acceptor.Principals(); len(got) != 1 || got[0] != testService+"@"+testRealm {
+		t.Errorf("Principals() = %v", got)
+	}
+
+	req := defaultRequest(t)
+	ctx, err := acceptor.Accept(req.token(t))
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	if ctx.Client.String() != "alice@"+testRealm {
+		t.Errorf("client = %s", ctx.Client)
+	}
+	if !ctx.ExpiresAt.Equal(req.end.Truncate(time.Second)) {
+		t.Errorf("ExpiresAt = %v, want %v", ctx.ExpiresAt, req.end)
+	}
+	if ctx.ReplayKey == "" {
+		t.Error("no replay key")
+	}
+	var resp spnego.SPNEGOToken
+	if err := resp.Unmarshal(ctx.ResponseToken); err != nil || !resp.Resp {
+		t.Fatalf("response token is not a NegTokenResp: %v", err)
+	}
+	if resp.NegTokenResp.State() != spnego.NegStateAcceptCompleted || !resp.NegTokenResp.SupportedMech.Equal(gssapi.OIDMSLegacyKRB5.OID()) {
+		t.Errorf("NegTokenResp = %+v", resp.NegTokenResp)
+	}
+
+	// A fresh authenticator for the same ticket is another replay key
+	again, err := acceptor.Accept(req.token(t))
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	if again.ReplayKey == ctx.ReplayKey {
+		t.Error("two authenticators share a replay key")
+	}
+
+	req.spnego = false
+	bare, err := NewAcceptor(req.keys, "").Accept(req.token(t))
+	if err != nil {
+		t.Fatalf("Accept of a bare Kerberos token: %v", err)
+	}
+	if bare.Client.Name != "alice" || len(bare.ResponseToken) != 0 {
+		t.Errorf("bare Kerberos context = %+v", bare)
+	}
+}
+
+func TestAcceptRefuses(t *testing.T) {
+	tests := []struct {
+		name    string
+		service string
+		change  func(*testRequest)
+		want    string
+	}{
+		{"expired ticket", "", func(r *testRequest) { r.end = time.Now().Add(-time.Hour) }, "expired"},
+		{"future ticket", "", func(r *testRequest) { r.start = time.Now().Add(time.Hour) }, "not yet valid"},
+		{"other service", "HTTP/other.corp.example.com", func(*testRequest) {}, "not HTTP/other"},
+		{"service of another case", "http/IAM.corp.example.com", func(*testRequest) {}, "not http/IAM"},
+		{"unknown service", "", func(r *testRequest) { r.service = "HTTP/other.corp.example.com" }, "key not found"},
+		{"wrong key", "", func(r *testRequest) {
+			r.keys = testKeytab(t, "other-secret", etypeID.AES256_CTS_HMAC_SHA1_96)
+		}, "decrypting"},
+		{"RC4 ticket", "", func(r *testRequest) { r.etype = etypeID.RC4_HMAC }, "only AES"},
+		{"NTLM first", "", func(r *testRequest) {
+			r.mechs = []asn1.ObjectIdentifier{{1, 3, 6, 1, 4, 1, 311, 2, 2, 10}, gssapi.OIDKRB5.OID()}
+		}, "only Kerberos"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := defaultRequest(t)
+			tt.change(&req)
+			acceptor := NewAcceptor(testKeytab(t, "service-secret", etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.RC4_HMAC), tt.service)
+			_, err := acceptor.Accept(req.token(t))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Accept: err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+	acceptor := NewAcceptor(testKeytab(t, "service-secret", etypeID.AES256_CTS_HMAC_SHA1_96), "")
+	if _, err := acceptor.Accept([]byte("NTLMSSP\x00\x01\x00\x00\x00")); err != ErrUnsupportedMechanism {
+		t.Errorf("Accept of a raw NTLM message: err = %v", err)
+	}
+}
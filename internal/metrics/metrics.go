@@ -0,0 +1,285 @@
+// Package metrics defines the Prometheus metrics of the IAM server and the
+// Fiber glue to record and expose them.
+package metrics
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "monkeys_iam"
+
+var (
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by method, route pattern and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	httpRequestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "HTTP requests currently being served.",
+	})
+
+	loginAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "login_attempts_total",
+		Help:      "Login attempts by result (success, failure) and reason.",
+	}, []string{"result", "reason"})
+
+	loginThrottled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "login_throttled_total",
+		Help:      "Login attempts refused because the email is in a progressive delay, by the delay in effect.",
+	}, []string{"delay"})
+
+	authzCheckDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "authz",
+		Name:      "check_duration_seconds",
+		Help:      "Authorization check latency by decision.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"decision"})
+
+	policyCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "authz",
+		Name:      "policy_cache_lookups_total",
+		Help:      "Parsed policy document cache lookups by result (hit, miss).",
+	}, []string{"result"})
+
+	auditExportEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "audit_export",
+		Name:      "events_total",
+		Help:      "Audit events exported to SIEM sinks by sink type and result (delivered, failed, dropped).",
+	}, []string{"sink_type", "result"})
+
+	auditExportQueued = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "audit_export",
+		Name:      "queued_events",
+		Help:      "Audit events waiting to be exported, by sink type.",
+	}, []string{"sink_type"})
+
+	auditExportBatchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "audit_export",
+		Name:      "batch_duration_seconds",
+		Help:      "Time to deliver a batch of audit events to a sink, retries included, by sink type.",
+		Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"sink_type"})
+)
+
+// Middleware records the latency and status of every request. Requests are
+// labelled with the matched route pattern (e.g. /api/v1/users/:id) rather
+// than the raw path to keep label cardinality bounded.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		httpRequestsInFlight.Inc()
+		defer httpRequestsInFlight.Dec()
+
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if fe, ok := err.(*fiber.Error); ok {
+			// The error handler writes the status after this middleware returns
+			status = fe.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+
+		route := "unmatched"
+		if r := c.Route(); r != nil && r.Path != "/" && r.Path != "" {
+			route = r.Path
+		} else if status != fiber.StatusNotFound {
+			route = "/"
+		}
+
+		httpRequestDuration.WithLabelValues(c.Method(), route, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format. When token is
+// not empty, scrapers must present it as a bearer token.
+func Handler(token string) fiber.Handler {
+	serve := adaptor.HTTPHandler(promhttp.Handler())
+	return func(c *fiber.Ctx) error {
+		if token != "" && subtle.ConstantTimeCompare([]byte(c.Get(fiber.HeaderAuthorization)), []byte("Bearer "+token)) != 1 {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+		return serve(c)
+	}
+}
+
+// RecordLogin counts a login attempt. reason should be one of a small fixed
+// set of values (e.g. invalid_password, mfa) so label cardinality stays low.
+func RecordLogin(success bool, reason string) {
+	result := "failure"
+	if success {
+		result = "success"
+	}
+	loginAttempts.WithLabelValues(result, reason).Inc()
+}
+
+// RecordLoginThrottled counts a login attempt refused during a progressive
+// delay. The delays are configured, so the label cardinality stays low.
+func RecordLoginThrottled(delay time.Duration) {
+	loginThrottled.WithLabelValues(delay.String()).Inc()
+}
+
+// ObserveAuthzCheck records the latency of an authorization check
+func ObserveAuthzCheck(decision string, elapsed time.Duration) {
+	authzCheckDuration.WithLabelValues(decision).Observe(elapsed.Seconds())
+}
+
+// RecordPolicyCacheLookup counts a parsed policy cache lookup
+func RecordPolicyCacheLookup(hit bool) {
+	if hit {
+		policyCacheLookups.WithLabelValues("hit").Inc()
+	} else {
+		policyCacheLookups.WithLabelValues("miss").Inc()
+	}
+}
+
+// RecordAuditExport counts n audit events of a sink type by result:
+// delivered, failed (after the retries) or dropped (queue full)
+func RecordAuditExport(sinkType, result string, n int) {
+	auditExportEvents.WithLabelValues(sinkType, result).Add(float64(n))
+}
+
+// AuditExportQueued adjusts the number of audit events waiting for a sink
+// type
+func AuditExportQueued(sinkType string, delta int) {
+	auditExportQueued.WithLabelValues(sinkType).Add(float64(delta))
+}
+
+// ObserveAuditExportBatch records how long a batch took to deliver
+func ObserveAuditExportBatch(sinkType string, elapsed time.Duration) {
+	auditExportBatchDuration.WithLabelValues(sinkType).Observe(elapsed.Seconds())
+}
+
+// RegisterDBStats exposes the connection pool statistics of db
+func RegisterDBStats(db *sql.DB, name string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterRedisBreaker exposes whether Redis calls are being skipped after
+// repeated connection failures
+func RegisterRedisBreaker(open func() bool) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "redis",
+		Name:      "circuit_open",
+		Help:      "Whether Redis calls are short-circuited after repeated connection failures (1) or not (0).",
+	}, func() float64 {
+		if open() {
+			return 1
+		}
+		return 0
+	}))
+}
+
+// RegisterReplica exposes the health and replication lag of a database
+// replica as measured by its periodic checks
+func RegisterReplica(name string, healthy func() bool, lag func() time.Duration) {
+	labels := prometheus.Labels{"replica": name}
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Subsystem:   "db",
+		Name:        "replica_healthy",
+		Help:        "Whether the replica is reachable and within the lag tolerance (1) or skipped (0).",
+		ConstLabels: labels,
+	}, func() float64 {
+		if healthy() {
+			return 1
+		}
+		return 0
+	}))
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Subsystem:   "db",
+		Name:        "replica_lag_seconds",
+		Help:        "Replication lag of the replica at its last check.",
+		ConstLabels: labels,
+	}, func() float64 { return lag().Seconds() }))
+}
+
+// RegisterActiveSessions exposes the number of active sessions, counted by
+// count at scrape time
+func RegisterActiveSessions(count func(ctx context.Context) (int, error)) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "sessions",
+		Name:      "active",
+		Help:      "Sessions that are active and not yet expired.",
+	}, func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		n, err := count(ctx)
+		if err != nil {
+			return math.NaN()
+		}
+		return float64(n)
+	}))
+}
+
+// PasswordHashCount is the number of stored password hashes of one algorithm
+// that do or do not use the configured parameters
+type PasswordHashCount struct {
+	Algorithm string
+	Current   bool
+	Count     int
+}
+
+// RegisterPasswordHashes exposes the distribution of stored password hashes
+// over algorithms, counted by count at scrape time
+func RegisterPasswordHashes(count func(ctx context.Context) ([]PasswordHashCount, error)) {
+	prometheus.MustRegister(&passwordHashCollector{
+		count: count,
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "auth", "password_hashes"),
+			"Stored password hashes by algorithm and whether they use the configured parameters; outdated ones are replaced at the next login.",
+			[]string{"algorithm", "current"}, nil),
+	})
+}
+
+type passwordHashCollector struct {
+	count func(ctx context.Context) ([]PasswordHashCount, error)
+	desc  *prometheus.Desc
+}
+
+func (c *passwordHashCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *passwordHashCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	counts, err := c.count(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	for _, n := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n.Count), n.Algorithm, strconv.FormatBool(n.Current))
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+)
+
+// RecordAccess adds the request to the resource access log once the handler
+// is done: as a success when it succeeded and a failure when it refused the
+// caller. Requests that failed for other reasons, such as an unknown :id or
+// an invalid body, accessed nothing and are not recorded. Denials by
+// RequirePermission are recorded by the authorization service, so the
+// middleware goes after it.
+func RecordAccess(log services.AccessLog, resourceType, action string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		if log == nil {
+			return err
+		}
+		id := c.Params("id")
+		if _, parseErr := uuid.Parse(id); parseErr != nil {
+			return err
+		}
+		status := c.Response().StatusCode()
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		}
+		var success bool
+		switch {
+		case err == nil && status < fiber.StatusBadRequest:
+			success = true
+		case status == fiber.StatusUnauthorized || status == fiber.StatusForbidden:
+			success = false
+		default:
+			return err
+		}
+
+		orgID, _ := c.Locals("organization_id").(string)
+		userID, _ := c.Locals("user_id").(string)
+		principalType, _ := c.Locals("principal_type").(string)
+		if orgID == "" {
+			return err
+		}
+		// Fiber reuses the request buffers the params and headers point
+		// into, and the entry is written after the request is done
+		log.Record(queries.ResourceAccessLog{
+			OrganizationID: orgID,
+			ResourceType:   resourceType,
+			ResourceID:     strings.Clone(id),
+			UserID:         userID,
+			PrincipalType:  principalType,
+			Action:         action,
+			IPAddress:      strings.Clone(ClientIP(c)),
+			UserAgent:      strings.Clone(c.Get(fiber.HeaderUserAgent)),
+			Success:        success,
+		})
+		return err
+	}
+}
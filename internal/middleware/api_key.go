@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/detection"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// APIKeyHeader carries service account API key credentials in the form
+// "<key_id>:<secret>"
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyVerifiedTTL bounds how long a successful secret check is reused
+// before bcrypt runs again. The key itself is still looked up on every
+// request, so revocation and expiry take effect immediately.
+const apiKeyVerifiedTTL = 5 * time.Minute
+
+// apiKeyCountriesTTL is how long the countries an API key was used from are
+// remembered after its last use
+const apiKeyCountriesTTL = 90 * 24 * time.Hour
+
+// SetAPIKeyStore enables API key authentication in RequireAuth
+func (am *AuthMiddleware) SetAPIKeyStore(keys queries.UserQueries) {
+	am.apiKeys = keys
+}
+
+// SetAudit enables the api_key_new_country audit event, which security
+// rules of that type alert on
+func (am *AuthMiddleware) SetAudit(audit services.AuditService) {
+	am.audit = audit
+}
+
+func apiKeyVerifiedKey(keyID string) string { return "apikey:verified:" + keyID }
+
+func apiKeyCountriesKey(keyID string) string { return "apikey:countries:" + keyID }
+
+// authenticateAPIKey validates an X-API-Key credential and populates the
+// request locals with the owning service account as the principal
+func (am *AuthMiddleware) authenticateAPIKey(c *fiber.Ctx, credential string) error {
+	if am.apiKeys == nil {
+		return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "API key authentication is not enabled")
+	}
+
+	keyID, secret, ok := strings.Cut(credential, ":")
+	if !ok || keyID == "" || secret == "" {
+		return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Malformed API key")
+	}
+
+	key, err := am.apiKeys.WithContext(c.Context()).GetActiveAPIKeyByKeyID(keyID)
+	if err != nil {
+		return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid API key")
+	}
+
+	// bcrypt is deliberately slow; remember a digest of the last secret that
+	// verified so repeated calls with the same key stay cheap
+	digest := sha256.Sum256([]byte(secret))
+	digestHex := hex.EncodeToString(digest[:])
+	cached, _ := am.redis.Get(c.Context(), apiKeyVerifiedKey(keyID)).Result()
+	if subtle.ConstantTimeCompare([]byte(cached), []byte(digestHex)) != 1 {
+		if bcrypt.CompareHashAndPassword([]byte(key.KeyHash), []byte(secret)) != nil {
+			return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid API key")
+		}
+		am.redis.Set(c.Context(), apiKeyVerifiedKey(keyID), digestHex, apiKeyVerifiedTTL)
+	}
+
+	if services.OrganizationDisabled(c.Context(), am.redis, key.OrganizationID) {
+		return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeOrganizationDisabled, OrganizationDisabledMessage)
+	}
+
+	go am.apiKeys.RecordAPIKeyUse(key.ID)
+	if country := ClientCountry(c); country != "" && am.audit != nil {
+		am.recordAPIKeyCountry(c, key, country)
+	}
+
+	c.Locals("user_id", key.ServiceAccountID)
+	c.Locals("organization_id", key.OrganizationID)
+	c.Locals("email", "")
+	c.Locals("role", "service_account")
+	c.Locals("principal_type", "service_account")
+	c.Locals("api_key_id", key.KeyID)
+	c.Locals("api_key_rate_limit", key.RateLimitPerHour)
+
+	return c.Next()
+}
+
+// recordAPIKeyCountry remembers the countries an API key is used from and
+// audits the first use from each country after the first one
+func (am *AuthMiddleware) recordAPIKeyCountry(c *fiber.Ctx, key *models.APIKey, country string) {
+	setKey := apiKeyCountriesKey(key.KeyID)
+	var added *redis.IntCmd
+	var known *redis.StringSliceCmd
+	_, err := am.redis.TxPipelined(c.Context(), func(pipe redis.Pipeliner) error {
+		added = pipe.SAdd(c.Context(), setKey, country)
+		known = pipe.SMembers(c.Context(), setKey)
+		pipe.Expire(c.Context(), setKey, apiKeyCountriesTTL)
+		return nil
+	})
+	if err != nil || added.Val() == 0 || len(known.Val()) < 2 {
+		return
+	}
+
+	var previous []string
+	for _, k := range known.Val() {
+		if k != country {
+			previous = append(previous, k)
+		}
+	}
+	sort.Strings(previous)
+	details, _ := json.Marshal(map[string]interface{}{"country": country, "known_countries": previous})
+	am.audit.LogEvent(c.Context(), models.AuditEvent{
+		OrganizationID:    key.OrganizationID,
+		PrincipalID:       &key.ServiceAccountID,
+		PrincipalType:     utils.StringPtr("service_account"),
+		Action:            detection.ActionAPIKeyNewCountry,
+		ResourceType:      utils.StringPtr("api_key"),
+		ResourceID:        &key.KeyID,
+		AdditionalContext: string(details),
+		Result:            "success",
+		Severity:          "warn",
+	})
+}
@@ -1,54 +1,127 @@
 package middleware
 
 import (
-	"crypto/rsa"
+	"errors"
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
 	"github.com/the-monkeys/monkeys-identity/internal/authz"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
 	"github.com/the-monkeys/monkeys-identity/internal/services"
-	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+	"github.com/the-monkeys/monkeys-identity/internal/signing"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
 )
 
+// OrganizationDisabledMessage is returned to users and service accounts of an
+// organization that is scheduled for deletion
+const OrganizationDisabledMessage = "Your organization is scheduled for deletion and can no longer be signed in to. Contact support to cancel the deletion."
+
+// SessionExpiredMessage is returned for tokens of a session that was idle too
+// long or reached its maximum lifetime
+const SessionExpiredMessage = "Your session has expired. Please sign in again."
+
 type AuthMiddleware struct {
-	jwtSecret string
-	publicKey *rsa.PublicKey
-	redis     *redis.Client
+	keys     *signing.KeyManager
+	redis    redis.UniversalClient
+	apiKeys  queries.UserQueries    // set via SetAPIKeyStore; nil disables API keys
+	sessions queries.SessionQueries // set via SetSessionStore; required by RequireRecentMFA and to enforce session limits
+	roles    queries.AuthQueries    // set via SetRoleStore; nil makes RequireRole trust the token
+	roleTTL  time.Duration
+	audit    services.AuditService // set via SetAudit; records API keys used from new countries
+
+	clientCerts     queries.UserQueries // set via SetClientCertStore; nil disables client certificates
+	enterpriseTiers []string
+
+	logger *logger.Logger // set via SetLogger; nil drops the middleware's warnings
+	// When the last failure to record session activity was logged, in
+	// Unix nanoseconds, and how many failures were not logged since
+	sessionErrorLoggedAt atomic.Int64
+	sessionErrorsSkipped atomic.Int64
 }
 
+// sessionErrorLogInterval is how often failures to record session activity
+// are logged. While the session store is down every request fails to.
+const sessionErrorLogInterval = time.Minute
+
+// AccessTokenType is the type claim of access tokens. Refresh, ID, share
+// link, guest, invitation and download tokens are signed with the same keys
+// and must not authenticate API requests.
+const AccessTokenType = "access"
+
 type Claims struct {
 	UserID         string `json:"user_id"`
 	OrganizationID string `json:"organization_id"`
 	Email          string `json:"email"`
 	Role           string `json:"role"`
 	JTI            string `json:"jti"`
+	Type           string `json:"type"`
+	// Act is set on tokens issued by token exchange (RFC 8693) and names the
+	// service acting for the user, and on tokens minted from a delegation
+	// grant, where it names the service account
+	Act map[string]interface{} `json:"act,omitempty"`
+	// DelegationID and DelegatedActions are set on tokens a service account
+	// minted from a user's delegation grant
+	DelegationID     string   `json:"delegation_id,omitempty"`
+	DelegatedActions []string `json:"delegated_actions,omitempty"`
+	// ClientID and Scope are set on access tokens issued to OAuth clients
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// ImpersonatedBy is set on tokens a root user obtained to act as the
+	// user and names the root user
+	ImpersonatedBy string `json:"impersonated_by,omitempty"`
+	// SessionID is set on tokens of a session whose idle timeout and
+	// maximum lifetime are enforced; access tokens renewed by refresh
+	// carry it with a new jti
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func NewAuthMiddleware(jwtSecret string, privKeyPEM string, redis *redis.Client) *AuthMiddleware {
-	am := &AuthMiddleware{
-		jwtSecret: jwtSecret,
-		redis:     redis,
+func NewAuthMiddleware(keys *signing.KeyManager, redis redis.UniversalClient) *AuthMiddleware {
+	return &AuthMiddleware{
+		keys:  keys,
+		redis: redis,
 	}
+}
 
-	if privKeyPEM != "" {
-		if priv, err := utils.LoadRSAPrivateKey(privKeyPEM); err == nil {
-			am.publicKey = &priv.PublicKey
-		} else {
-			fmt.Printf("Error loading RSA private key in middleware: %v\n", err)
-		}
-	}
+// SetLogger gives the middleware a logger for failures that do not fail the
+// request
+func (am *AuthMiddleware) SetLogger(l *logger.Logger) {
+	am.logger = l
+}
 
-	return am
+// logSessionError logs a failure to record session activity, at most once
+// per sessionErrorLogInterval, with the number of failures not logged since
+func (am *AuthMiddleware) logSessionError(err error) {
+	if am.logger == nil {
+		return
+	}
+	now := time.Now().UnixNano()
+	last := am.sessionErrorLoggedAt.Load()
+	if now-last < int64(sessionErrorLogInterval) || !am.sessionErrorLoggedAt.CompareAndSwap(last, now) {
+		am.sessionErrorsSkipped.Add(1)
+		return
+	}
+	if skipped := am.sessionErrorsSkipped.Swap(0); skipped > 0 {
+		am.logger.Warn("Failed to record session activity: %v (%d more failures since the last report)", err, skipped)
+		return
+	}
+	am.logger.Warn("Failed to record session activity: %v", err)
 }
 
-// RequireAuth validates JWT token
+// RequireAuth validates JWT token, or a service account API key sent in the
+// X-API-Key header
 func (am *AuthMiddleware) RequireAuth() fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		if credential := c.Get(APIKeyHeader); credential != "" {
+			return am.authenticateAPIKey(c, credential)
+		}
+
 		// Get Authorization header
 		authHeader := c.Get("Authorization")
 		var tokenString string
@@ -67,60 +140,67 @@ func (am *AuthMiddleware) RequireAuth() fiber.Handler {
 		}
 
 		if tokenString == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Authorization required",
-				"success": false,
-			})
+			// A service account may instead present a client certificate
+			if cert := clientCertificate(c); cert != nil && am.clientCerts != nil {
+				return am.authenticateClientCert(c, cert)
+			}
+			return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Authorization required")
 		}
 
 		// Parse and validate token
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			// Check signing method
-			if _, ok := token.Method.(*jwt.SigningMethodRSA); ok {
-				if am.publicKey == nil {
-					return nil, fmt.Errorf("public key not configured for RS256")
-				}
-				return am.publicKey, nil
-			}
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
-				return []byte(am.jwtSecret), nil
-			}
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		})
+		// RS256 by kid, or HS256 during the migration window
+		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, am.keys.Keyfunc)
 
 		if err != nil || !token.Valid {
 			fmt.Printf("Token validation failed: %v\n", err)
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Invalid or expired token",
-				"success": false,
-			})
+			return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid or expired token")
 		}
 
 		// Extract claims
 		claims, ok := token.Claims.(*Claims)
 		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Invalid token claims",
-				"success": false,
-			})
+			return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid token claims")
+		}
+		if claims.Type != AccessTokenType {
+			return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Not an access token")
 		}
 
 		// Check token expiration
 		if claims.ExpiresAt.Before(time.Now()) {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Token has expired",
-				"success": false,
-			})
+			return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeTokenExpired, "Token has expired")
+		}
+
+		// Delegated tokens are scoped to the downstream service they were
+		// exchanged for, not to this API. Tokens minted from a delegation
+		// grant are the exception.
+		if claims.Act != nil && claims.DelegationID == "" {
+			return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Delegated tokens are not accepted by this API")
 		}
 
 		// Check if token is blacklisted (revoked)
 		if claims.JTI != "" {
 			exists, err := am.redis.Exists(c.Context(), "blacklist:"+claims.JTI).Result()
 			if err == nil && exists > 0 {
-				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-					"error":   "Token has been revoked",
-					"success": false,
-				})
+				return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeTokenRevoked, "Token has been revoked")
+			}
+		}
+
+		if services.OrganizationDisabled(c.Context(), am.redis, claims.OrganizationID) {
+			return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeOrganizationDisabled, OrganizationDisabledMessage)
+		}
+
+		// Requests count as session activity, restarting the idle timeout
+		sessionID := claims.JTI // JTI == session ID stored in DB for tokens without sid
+		if claims.SessionID != "" {
+			sessionID = claims.SessionID
+			if am.sessions != nil {
+				err := am.sessions.WithContext(c.Context()).TouchSession(sessionID, claims.OrganizationID)
+				if errors.Is(err, queries.ErrSessionExpired) {
+					return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeSessionExpired, SessionExpiredMessage)
+				}
+				if err != nil {
+					am.logSessionError(err)
+				}
 			}
 		}
 
@@ -135,34 +215,45 @@ func (am *AuthMiddleware) RequireAuth() fiber.Handler {
 		c.Locals("organization_id", claims.OrganizationID)
 		c.Locals("email", claims.Email)
 		c.Locals("role", claims.Role)
-		c.Locals("session_id", claims.JTI) // JTI == session ID stored in DB
+		c.Locals("session_id", sessionID)
+		c.Locals("token_expires_at", claims.ExpiresAt.Time)
+		if claims.ClientID != "" {
+			c.Locals("client_id", claims.ClientID)
+			c.Locals("token_scopes", strings.Fields(claims.Scope))
+		}
+		if claims.ImpersonatedBy != "" {
+			c.Locals("impersonated_by", claims.ImpersonatedBy)
+			c.Set(ImpersonatedByHeader, claims.ImpersonatedBy)
+		}
+		if claims.DelegationID != "" {
+			return am.delegatedRequest(c, claims)
+		}
 
 		return c.Next()
 	}
 }
 
-// RequireRole validates user has specific role
+// RequireRole validates user has specific role. With a role store the role
+// is the caller's current assignment, which also replaces the token's role
+// for the handlers that follow.
 func (am *AuthMiddleware) RequireRole(allowedRoles ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		userRole := c.Locals("role")
-		if userRole == nil {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error":   "Role information not found",
-				"success": false,
-			})
+		role, err := am.currentRole(c)
+		if err != nil {
+			return apierror.Respond(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to resolve role")
+		}
+		if role == "" {
+			return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeForbidden, "Role information not found")
 		}
+		c.Locals("role", role)
 
-		role := userRole.(string)
 		for _, allowedRole := range allowedRoles {
 			if role == allowedRole {
 				return c.Next()
 			}
 		}
 
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error":   "Insufficient permissions",
-			"success": false,
-		})
+		return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeForbidden, "Insufficient permissions")
 	}
 }
 
@@ -172,10 +263,7 @@ func (am *AuthMiddleware) RequireOrgAccess() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		callerOrgID := c.Locals("organization_id")
 		if callerOrgID == nil {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error":   "Organization context not found",
-				"success": false,
-			})
+			return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeForbidden, "Organization context not found")
 		}
 
 		targetOrgID := c.Params("id")
@@ -185,10 +273,7 @@ func (am *AuthMiddleware) RequireOrgAccess() fiber.Handler {
 		}
 
 		if callerOrgID.(string) != targetOrgID {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error":   "Access denied: you can only manage your own organization",
-				"success": false,
-			})
+			return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeForbidden, "Access denied: you can only manage your own organization")
 		}
 
 		return c.Next()
@@ -216,22 +301,27 @@ func (am *AuthMiddleware) RequirePermission(authzSvc services.AuthzService, acti
 			resource = fmt.Sprintf("arn:monkeys:resource:%s:%s/%s", orgID, resType, id)
 		}
 
-		decision, err := authzSvc.Authorize(c.Context(), userID, "user", orgID, action, resource, map[string]interface{}{
-			"ip": c.IP(),
-		})
+		principalType, _ := c.Locals("principal_type").(string)
+		if principalType == "" {
+			principalType = "user"
+		}
+
+		evalContext := map[string]interface{}{
+			"ip": ClientIP(c),
+		}
+		// OAuth client tokens may only perform what their scopes grant
+		if scopes, ok := c.Locals("token_scopes").([]string); ok {
+			evalContext["token_scopes"] = scopes
+		}
+
+		decision, err := authzSvc.Authorize(c.Context(), userID, principalType, orgID, action, resource, evalContext)
 
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error":   "Authorization check failed",
-				"success": false,
-			})
+			return apierror.Respond(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Authorization check failed")
 		}
 
 		if decision != authz.DecisionAllow {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error":   "Forbidden: Insufficient permissions",
-				"success": false,
-			})
+			return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeForbidden, "Forbidden: Insufficient permissions")
 		}
 
 		return c.Next()
@@ -258,21 +348,12 @@ func (am *AuthMiddleware) OptionalAuth() fiber.Handler {
 		if tokenString == "" {
 			return c.Next()
 		}
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodRSA); ok {
-				if am.publicKey == nil {
-					return nil, fmt.Errorf("public key not configured for RS256")
-				}
-				return am.publicKey, nil
-			}
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
-				return []byte(am.jwtSecret), nil
-			}
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		})
+		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, am.keys.Keyfunc)
 
 		if err == nil && token.Valid {
-			if claims, ok := token.Claims.(*Claims); ok {
+			// Impersonation sessions must not sign the user in to other
+			// applications, which would outlive them
+			if claims, ok := token.Claims.(*Claims); ok && claims.Type == AccessTokenType && claims.Act == nil && claims.ImpersonatedBy == "" {
 				userID := claims.UserID
 				if userID == "" {
 					userID = claims.Subject
@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/config"
+	"github.com/the-monkeys/monkeys-identity/internal/signing"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+// TestRequireAuthAcceptsOnlyAccessTokens checks that the other tokens signed
+// with the same keys, like public share links, are no API credentials
+func TestRequireAuthAcceptsOnlyAccessTokens(t *testing.T) {
+	keys, err := signing.NewKeyManager(&config.Config{}, logger.New("error"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Unreachable: revocation and organization checks fail open
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", DialTimeout: 50 * time.Millisecond, MaxRetries: -1})
+	t.Cleanup(func() { rdb.Close() })
+	am := NewAuthMiddleware(keys, rdb)
+
+	app := fiber.New()
+	app.Get("/users", am.RequireAuth(), func(c *fiber.Ctx) error {
+		return c.SendString(c.Locals("user_id").(string))
+	})
+	app.Get("/optional", am.OptionalAuth(), func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		return c.SendString(userID)
+	})
+
+	sign := func(tokenType string, extra jwt.MapClaims) string {
+		t.Helper()
+		claims := jwt.MapClaims{
+			"sub":             "link-1",
+			"organization_id": "org-1",
+			"exp":             time.Now().Add(time.Hour).Unix(),
+			"iat":             time.Now().Unix(),
+		}
+		if tokenType != "" {
+			claims["type"] = tokenType
+		}
+		for k, v := range extra {
+			claims[k] = v
+		}
+		token, err := keys.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"access token", sign(AccessTokenType, jwt.MapClaims{"user_id": "user-1", "role": "user"}), http.StatusOK},
+		{"share link", sign("share_link", jwt.MapClaims{"aud": "urn:monkeys-identity:share_link"}), http.StatusUnauthorized},
+		{"share session", sign("share_session", nil), http.StatusUnauthorized},
+		{"guest share", sign("guest_share", nil), http.StatusUnauthorized},
+		{"attachment download", sign("attachment_download", nil), http.StatusUnauthorized},
+		{"content invitation", sign("content_invitation", nil), http.StatusUnauthorized},
+		{"refresh token", sign("refresh", jwt.MapClaims{"user_id": "user-1"}), http.StatusUnauthorized},
+		{"ID token", sign("", jwt.MapClaims{"aud": "client-1"}), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("RequireAuth status = %d, want %d", resp.StatusCode, tt.want)
+			}
+
+			req = httptest.NewRequest(http.MethodGet, "/optional", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			resp, err = app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 64)
+			n, _ := resp.Body.Read(buf)
+			if signedIn := n > 0; signedIn != (tt.want == http.StatusOK) {
+				t.Errorf("OptionalAuth signed in as %q", buf[:n])
+			}
+		})
+	}
+}
+
+func TestLogSessionErrorIsRateLimited(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	am := &AuthMiddleware{logger: logger.New("warn")}
+	for i := 0; i < 100; i++ {
+		am.logSessionError(errors.New("redis: connection refused"))
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 1 {
+		t.Fatalf("logged %d lines for 100 failures in a burst, want 1", lines)
+	}
+
+	buf.Reset()
+	am.sessionErrorLoggedAt.Add(-int64(sessionErrorLogInterval))
+	am.logSessionError(errors.New("redis: connection refused"))
+	if !strings.Contains(buf.String(), "(99 more failures since the last report)") {
+		t.Errorf("log after the interval = %q, want the count of skipped failures", buf.String())
+	}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+)
+
+// BodyLimit caps the request bodies of the routes under Prefix. Segments of
+// Prefix starting with ":" match any one path segment, e.g.
+// /api/v1/content/:id/attachments.
+type BodyLimit struct {
+	Prefix string
+	Limit  int
+}
+
+// BodyLimits rejects requests whose body is larger than the limit of the
+// most specific rule matching their path, or defaultLimit when none does,
+// with 413. Fiber's BodyLimit must be at least the largest of the limits;
+// it still cuts off bodies before they are read, this only narrows it.
+func BodyLimits(defaultLimit int, rules ...BodyLimit) fiber.Handler {
+	type rule struct {
+		segments []string
+		limit    int
+	}
+	compiled := make([]rule, 0, len(rules))
+	for _, r := range rules {
+		compiled = append(compiled, rule{segments: pathSegments(r.Prefix), limit: r.Limit})
+	}
+
+	return func(c *fiber.Ctx) error {
+		limit, matched := defaultLimit, -1
+		path := pathSegments(c.Path())
+		for _, r := range compiled {
+			if len(r.segments) > matched && matchSegments(r.segments, path) {
+				limit, matched = r.limit, len(r.segments)
+			}
+		}
+
+		size := c.Request().Header.ContentLength()
+		if size < 0 {
+			// Chunked: the body has been read by now
+			size = len(c.Body())
+		}
+		if size > limit {
+			return apierror.Respond(c, fiber.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge,
+				"Request body is too large", fiber.Map{"limit_bytes": limit})
+		}
+		return c.Next()
+	}
+}
+
+func pathSegments(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// matchSegments reports whether prefix matches the start of path
+func matchSegments(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i, seg := range prefix {
+		if !strings.HasPrefix(seg, ":") && seg != path[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/authz"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+)
+
+// RequireCapability guards an administrative route with a capability, the
+// policy action it stands for, e.g. monkeys:iam:create_user. Admins always
+// pass; anyone else passes when their policies allow the capability, so an
+// organization can delegate part of administration, such as user
+// management, through the delegated system roles (user-admin,
+// policy-admin, auditor, billing-admin) or its own policies without
+// handing out the admin role. Like RequireRole it resolves the caller's
+// current role first.
+func (am *AuthMiddleware) RequireCapability(authzSvc services.AuthzService, capability string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, err := am.currentRole(c)
+		if err != nil {
+			return apierror.Respond(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to resolve role")
+		}
+		c.Locals("role", role)
+		if role == "admin" {
+			return c.Next()
+		}
+		if tc := GetTenantContext(c); tc != nil && tc.IsRoot {
+			return c.Next()
+		}
+
+		userID, _ := c.Locals("user_id").(string)
+		orgID, _ := c.Locals("organization_id").(string)
+		principalType, _ := c.Locals("principal_type").(string)
+		if principalType == "" {
+			principalType = "user"
+		}
+		evalContext := map[string]interface{}{"ip": ClientIP(c)}
+		if scopes, ok := c.Locals("token_scopes").([]string); ok {
+			evalContext["token_scopes"] = scopes
+		}
+
+		// Capabilities are organization-wide, so they are checked on every
+		// resource of the caller's organization
+		decision, err := authzSvc.Authorize(c.Context(), userID, principalType, orgID, capability, "*", evalContext)
+		if err != nil {
+			return apierror.Respond(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Authorization check failed")
+		}
+		if decision != authz.DecisionAllow {
+			return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeForbidden, "Insufficient permissions",
+				fiber.Map{"required_capability": capability})
+		}
+		return c.Next()
+	}
+}
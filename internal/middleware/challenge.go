@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+)
+
+// ChallengeResponseHeader carries the solution to a challenge issued by
+// RequireChallenge or GET /auth/challenge
+const ChallengeResponseHeader = "X-Challenge-Response"
+
+// RequireChallenge makes clients solve a CAPTCHA or proof-of-work challenge
+// before reaching the handler. It only applies to IPs the rate limiter has
+// flagged as suspicious, unless always is set. When no challenge provider is
+// configured it does nothing.
+func RequireChallenge(challenges services.ChallengeService, limiter *RateLimiter, always bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !challenges.Enabled() {
+			return c.Next()
+		}
+		if !always && !limiter.Suspicious(c.Context(), ClientIP(c)) {
+			return c.Next()
+		}
+
+		response := c.Get(ChallengeResponseHeader)
+		if response == "" {
+			challenge, err := challenges.Issue(c.Context())
+			if err != nil {
+				return apierror.Respond(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to issue challenge")
+			}
+			return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeChallengeRequired, "Solve the challenge and retry with the "+ChallengeResponseHeader+" header", challenge)
+		}
+
+		if err := challenges.Verify(c.Context(), response, ClientIP(c)); err != nil {
+			return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeChallengeFailed, "Challenge verification failed")
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+)
+
+// SetClientCertStore enables client certificate authentication in
+// RequireAuth for service accounts of organizations in tiers. The server
+// must terminate TLS and ask for certificates (MTLS_CLIENT_AUTH).
+func (am *AuthMiddleware) SetClientCertStore(certs queries.UserQueries, tiers []string) {
+	am.clientCerts = certs
+	am.enterpriseTiers = tiers
+}
+
+// CertificateFingerprint is the hex SHA-256 of a DER certificate, which
+// pins it to a service account
+func CertificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// clientCertificate returns the certificate the client presented in the
+// TLS handshake, or nil
+func clientCertificate(c *fiber.Ctx) *x509.Certificate {
+	state := c.Context().TLSConnectionState()
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	return state.PeerCertificates[0]
+}
+
+// authenticateClientCert maps a client certificate to the service account
+// it is registered to and populates the request locals like an API key.
+// The handshake proved the client holds the certificate's private key.
+func (am *AuthMiddleware) authenticateClientCert(c *fiber.Ctx, cert *x509.Certificate) error {
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Client certificate is expired or not yet valid")
+	}
+
+	registered, err := am.clientCerts.WithContext(c.Context()).GetServiceAccountCertificateByFingerprint(CertificateFingerprint(cert))
+	if err != nil {
+		return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Unknown client certificate")
+	}
+	if !services.EnterpriseAuthAllowed(am.enterpriseTiers, registered.BillingTier) {
+		return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeForbidden, "Client certificate authentication is not available on the organization's plan")
+	}
+	if services.OrganizationDisabled(c.Context(), am.redis, registered.OrganizationID) {
+		return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeOrganizationDisabled, OrganizationDisabledMessage)
+	}
+
+	go am.clientCerts.RecordServiceAccountCertificateUse(registered.ID)
+
+	c.Locals("user_id", registered.ServiceAccountID)
+	c.Locals("organization_id", registered.OrganizationID)
+	c.Locals("email", "")
+	c.Locals("role", "service_account")
+	c.Locals("principal_type", "service_account")
+	c.Locals("client_certificate_id", registered.ID)
+
+	return c.Next()
+}
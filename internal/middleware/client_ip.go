@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/services"
+)
+
+// ClientIPLocal is the Locals key of the resolved client IP. Fiber locals
+// are also values of c.Context(), so services given the request context can
+// read it too, with services.ClientIPFromContext.
+var ClientIPLocal = services.ClientIPKey
+
+// ClientCountryLocal is the Locals key of the client's ISO country code,
+// set when a trusted proxy reports it
+const ClientCountryLocal = "client_country"
+
+// ClientIPResolver works out the IP of the client behind the load balancers
+// and reverse proxies the server trusts
+type ClientIPResolver struct {
+	trusted       []*net.IPNet
+	countryHeader string
+}
+
+// NewClientIPResolver creates a resolver trusting the given IPs and CIDR
+// ranges; with none, the peer of the connection is always the client
+func NewClientIPResolver(trustedProxies []string) (*ClientIPResolver, error) {
+	r := &ClientIPResolver{}
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("trusted proxy %q is not an IP address or CIDR range", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			r.trusted = append(r.trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q is not an IP address or CIDR range", proxy)
+		}
+		r.trusted = append(r.trusted, network)
+	}
+	return r, nil
+}
+
+// SetCountryHeader names the header trusted proxies set to the client's
+// country code, such as CF-IPCountry
+func (r *ClientIPResolver) SetCountryHeader(header string) {
+	r.countryHeader = header
+}
+
+func (r *ClientIPResolver) isTrusted(ip net.IP) bool {
+	for _, network := range r.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the client IP of a request from peer, the address the
+// connection came from. Forwarding headers are only read when the peer is a
+// trusted proxy: X-Forwarded-For is walked from the right, past the trusted
+// proxies that appended to it, to the first address a client could not have
+// forged. X-Real-IP is used when there is no X-Forwarded-For.
+func (r *ClientIPResolver) Resolve(peer, forwardedFor, realIP string) string {
+	peerIP := net.ParseIP(peer)
+	if peerIP == nil || !r.isTrusted(peerIP) {
+		return peer
+	}
+
+	if forwardedFor != "" {
+		hops := strings.Split(forwardedFor, ",")
+		client := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := parseForwardedIP(hops[i])
+			if ip == nil {
+				// Garbage in the chain; the last valid hop is all we know
+				break
+			}
+			client = ip.String()
+			if !r.isTrusted(ip) {
+				break
+			}
+		}
+		return client
+	}
+	if ip := parseForwardedIP(realIP); ip != nil {
+		return ip.String()
+	}
+	return peer
+}
+
+// Country returns the two letter country code a trusted proxy reported for
+// the client, or "" when the peer is not trusted or the country is unknown
+func (r *ClientIPResolver) Country(peer, header string) string {
+	if r.countryHeader == "" {
+		return ""
+	}
+	peerIP := net.ParseIP(peer)
+	if peerIP == nil || !r.isTrusted(peerIP) {
+		return ""
+	}
+	country := strings.ToUpper(strings.TrimSpace(header))
+	if len(country) != 2 || country == "XX" || country[0] < 'A' || country[0] > 'Z' || country[1] < 'A' || country[1] > 'Z' {
+		return ""
+	}
+	return country
+}
+
+// parseForwardedIP parses one hop of a forwarding header, which some
+// proxies write with a port or, for IPv6, in brackets
+func parseForwardedIP(hop string) net.IP {
+	hop = strings.TrimSpace(hop)
+	if ip := net.ParseIP(hop); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		return net.ParseIP(host)
+	}
+	return net.ParseIP(strings.Trim(hop, "[]"))
+}
+
+// RequestContext resolves the client IP of every request once, so rate
+// limiting, challenges, sessions and audit logs all see the same address.
+// It must run before any of them.
+func RequestContext(resolver *ClientIPResolver) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		peer := c.Context().RemoteIP().String()
+		c.Locals(ClientIPLocal, resolver.Resolve(peer, c.Get(fiber.HeaderXForwardedFor), c.Get("X-Real-IP")))
+		if resolver.countryHeader != "" {
+			if country := resolver.Country(peer, c.Get(resolver.countryHeader)); country != "" {
+				c.Locals(ClientCountryLocal, country)
+			}
+		}
+		return c.Next()
+	}
+}
+
+// ClientIP returns the client IP resolved by RequestContext, or the peer
+// of the connection on routes it does not cover
+func ClientIP(c *fiber.Ctx) string {
+	if ip, ok := c.Locals(ClientIPLocal).(string); ok && ip != "" {
+		return ip
+	}
+	return c.IP()
+}
+
+// ClientCountry returns the country code resolved by RequestContext, or ""
+func ClientCountry(c *fiber.Ctx) string {
+	country, _ := c.Locals(ClientCountryLocal).(string)
+	return country
+}
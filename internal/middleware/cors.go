@@ -16,16 +16,23 @@ import (
 const (
 	// Redis key where all allowed origins are cached as a Set.
 	corsOriginsKey = "cors:allowed_origins"
-	// How long the Redis cache lives before the next request triggers a refresh.
+	// How long the Redis cache lives; replicas rewrite it well before then.
 	corsCacheTTL = 5 * time.Minute
+	// corsInvalidationChannel tells every replica to reload the origins after
+	// one of them changed an organization's allowed_origins.
+	corsInvalidationChannel = "cors:invalidate"
+	// corsRefreshInterval bounds how stale a replica can be when it missed an
+	// invalidation, e.g. during a Redis outage.
+	corsRefreshInterval = time.Minute
 )
 
 // DynamicCORS is a middleware that allows origins stored per-organization in
-// the database + a static list from .env. Origins are cached in Redis so the
-// DB is only queried every corsCacheTTL.
+// the database + a static list from .env. Origins are cached in Redis and in
+// memory, reloaded when any replica changes them and every
+// corsRefreshInterval as a fallback.
 type DynamicCORS struct {
 	db            *sql.DB
-	redis         *redis.Client
+	redis         redis.UniversalClient
 	logger        *logger.Logger
 	staticOrigins map[string]bool // from .env ALLOWED_ORIGINS
 	allowAll      bool            // true when static list contains "*"
@@ -34,11 +41,24 @@ type DynamicCORS struct {
 	mu          sync.RWMutex
 	memoryCache map[string]bool
 	memoryCacheAt time.Time
+
+	stop chan struct{}
+	done chan struct{}
+
+	// OAuth clients may allow their own origins on a few endpoints.
+	clients     ClientOrigins
+	clientPaths map[string]bool
+}
+
+// ClientOrigins looks up the browser origins OAuth clients registered.
+type ClientOrigins interface {
+	ClientAllowsOrigin(clientID, origin string) bool
+	AnyClientAllowsOrigin(origin string) bool
 }
 
 // NewDynamicCORS creates the middleware.
 // staticOrigins is the comma-separated ALLOWED_ORIGINS value from config.
-func NewDynamicCORS(db *sql.DB, redis *redis.Client, logger *logger.Logger, staticOrigins string) *DynamicCORS {
+func NewDynamicCORS(db *sql.DB, redis redis.UniversalClient, logger *logger.Logger, staticOrigins string) *DynamicCORS {
 	static := make(map[string]bool)
 	allowAll := false
 	for _, o := range strings.Split(staticOrigins, ",") {
@@ -59,6 +79,8 @@ func NewDynamicCORS(db *sql.DB, redis *redis.Client, logger *logger.Logger, stat
 		staticOrigins: static,
 		allowAll:      allowAll,
 		memoryCache:   make(map[string]bool),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
 	}
 
 	// Seed cache on startup so the first request is fast.
@@ -67,6 +89,71 @@ func NewDynamicCORS(db *sql.DB, redis *redis.Client, logger *logger.Logger, stat
 	return d
 }
 
+// SetClientOrigins lets the origins registered by OAuth clients call the
+// given paths: preflights pass when any client registered the origin, and
+// ClientCORS checks the actual request against its own client. Called from
+// route setup.
+func (d *DynamicCORS) SetClientOrigins(clients ClientOrigins, paths ...string) {
+	d.clients = clients
+	d.clientPaths = make(map[string]bool, len(paths))
+	for _, p := range paths {
+		d.clientPaths[p] = true
+	}
+}
+
+// ClientCORS allows the request's origin when the OAuth client returned by
+// clientID registered it. Client origins are not sent
+// Access-Control-Allow-Credentials: those requests authenticate with the
+// client's credentials or a bearer token, never with session cookies.
+func (d *DynamicCORS) ClientCORS(clientID func(c *fiber.Ctx) string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		origin := c.Get("Origin")
+		if origin == "" || d.clients == nil || len(c.Response().Header.Peek("Access-Control-Allow-Origin")) > 0 {
+			return c.Next()
+		}
+		if id := clientID(c); id != "" && d.clients.ClientAllowsOrigin(id, origin) {
+			d.setClientHeaders(c, origin)
+		}
+		return c.Next()
+	}
+}
+
+// Start reloads the origins whenever an invalidation is published and on a
+// fixed interval, which also keeps the Redis cache from expiring.
+func (d *DynamicCORS) Start(ctx context.Context) {
+	sub := d.redis.Subscribe(ctx, corsInvalidationChannel)
+	go func() {
+		defer close(d.done)
+		defer sub.Close()
+
+		ticker := time.NewTicker(corsRefreshInterval)
+		defer ticker.Stop()
+		messages := sub.Channel()
+		for {
+			select {
+			case <-messages:
+				d.refreshCache()
+			case <-ticker.C:
+				d.refreshCache()
+			case <-ctx.Done():
+				return
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the subscription and waits for it to close.
+func (d *DynamicCORS) Stop() {
+	select {
+	case <-d.stop:
+	default:
+		close(d.stop)
+	}
+	<-d.done
+}
+
 // Handler returns the Fiber middleware handler.
 func (d *DynamicCORS) Handler() fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -107,6 +194,9 @@ func (d *DynamicCORS) Handler() fiber.Handler {
 		// Origin not allowed — still process the request but don't set CORS
 		// headers. The browser will block the response on the client side.
 		if c.Method() == fiber.MethodOptions {
+			if d.clients != nil && d.clientPaths[c.Path()] && d.clients.AnyClientAllowsOrigin(origin) {
+				d.setClientHeaders(c, origin)
+			}
 			return c.SendStatus(fiber.StatusNoContent)
 		}
 		return c.Next()
@@ -117,11 +207,20 @@ func (d *DynamicCORS) Handler() fiber.Handler {
 func (d *DynamicCORS) setHeaders(c *fiber.Ctx, origin string) {
 	c.Set("Access-Control-Allow-Origin", origin)
 	c.Set("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE,OPTIONS,PATCH")
-	c.Set("Access-Control-Allow-Headers", "Origin,Content-Type,Accept,Authorization,X-Request-ID")
+	c.Set("Access-Control-Allow-Headers", "Origin,Content-Type,Accept,Authorization,X-Request-ID,X-CSRF-Token,X-Session-Mode")
 	c.Set("Access-Control-Allow-Credentials", "true")
 	c.Set("Vary", "Origin")
 }
 
+// setClientHeaders writes the CORS response headers for an OAuth client's
+// origin, without credentials.
+func (d *DynamicCORS) setClientHeaders(c *fiber.Ctx, origin string) {
+	c.Set("Access-Control-Allow-Origin", origin)
+	c.Set("Access-Control-Allow-Methods", "GET,POST,OPTIONS")
+	c.Set("Access-Control-Allow-Headers", "Content-Type,Accept,Authorization,X-Request-ID")
+	c.Set("Vary", "Origin")
+}
+
 // isAllowedDynamic checks Redis cache, then memory fallback.
 func (d *DynamicCORS) isAllowedDynamic(origin string) bool {
 	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
@@ -162,8 +261,9 @@ func (d *DynamicCORS) refreshCache() {
 		allOrigins[o] = true
 	}
 
-	// Write to Redis as a Set with TTL.
-	pipe := d.redis.Pipeline()
+	// Write to Redis as a Set with TTL, atomically so concurrent lookups
+	// never see it empty.
+	pipe := d.redis.TxPipeline()
 	pipe.Del(ctx, corsOriginsKey)
 	if len(allOrigins) > 0 {
 		members := make([]interface{}, 0, len(allOrigins))
@@ -183,7 +283,7 @@ func (d *DynamicCORS) refreshCache() {
 	d.memoryCacheAt = time.Now()
 	d.mu.Unlock()
 
-	d.logger.Info("CORS origin cache refreshed: %d origins", len(allOrigins))
+	d.logger.Debug("CORS origin cache refreshed: %d origins", len(allOrigins))
 }
 
 // loadOriginsFromDB aggregates allowed_origins from all active organizations.
@@ -206,10 +306,17 @@ func (d *DynamicCORS) loadOriginsFromDB(ctx context.Context) ([]string, error) {
 	return origins, rows.Err()
 }
 
-// InvalidateCache forces a reload from DB. Call this after an organization
-// updates its allowed_origins.
+// InvalidateCache forces a reload from DB on every replica. Call this after
+// an organization updates its allowed_origins.
 func (d *DynamicCORS) InvalidateCache() {
-	go d.refreshCache()
+	go func() {
+		d.refreshCache()
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := d.redis.Publish(ctx, corsInvalidationChannel, time.Now().UnixNano()).Err(); err != nil {
+			d.logger.Warn("Failed to notify replicas of the CORS origin change, they pick it up within %s: %v", corsRefreshInterval, err)
+		}
+	}()
 }
 
 // GetOrganizationOrigins returns the allowed_origins for a single org.
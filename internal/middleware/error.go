@@ -4,42 +4,22 @@ import (
 	"errors"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
 )
 
-// ErrorHandler handles all application errors
+// ErrorHandler handles all application errors and renders them in the
+// standard error envelope. Errors that are neither *apierror.Error nor
+// *fiber.Error are reported as internal_error without leaking their text.
 func ErrorHandler(c *fiber.Ctx, err error) error {
-	// Default error response
-	code := fiber.StatusInternalServerError
-	message := "Internal Server Error"
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		return apierror.RespondError(c, apiErr)
+	}
 
-	// Check if it's a Fiber error
 	var e *fiber.Error
 	if errors.As(err, &e) {
-		code = e.Code
-		message = e.Message
-	}
-
-	// Custom error types can be handled here
-	switch err.Error() {
-	case "unauthorized":
-		code = fiber.StatusUnauthorized
-		message = "Unauthorized access"
-	case "forbidden":
-		code = fiber.StatusForbidden
-		message = "Access forbidden"
-	case "not_found":
-		code = fiber.StatusNotFound
-		message = "Resource not found"
-	case "validation_error":
-		code = fiber.StatusBadRequest
-		message = "Validation failed"
+		return apierror.Respond(c, e.Code, apierror.CodeForStatus(e.Code), e.Message)
 	}
 
-	return c.Status(code).JSON(fiber.Map{
-		"error": fiber.Map{
-			"code":    code,
-			"message": message,
-		},
-		"success": false,
-	})
+	return apierror.Respond(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
 }
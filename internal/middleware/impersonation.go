@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+)
+
+// ImpersonatedByHeader is set on every response to a request made with an
+// impersonation token and names the root user, so clients can show a banner
+const ImpersonatedByHeader = "X-Impersonated-By"
+
+// Impersonator returns the root user acting as the caller, or "" when the
+// caller is signed in as themselves
+func Impersonator(c *fiber.Ctx) string {
+	rootID, _ := c.Locals("impersonated_by").(string)
+	return rootID
+}
+
+// BlockImpersonation refuses requests made during impersonation. It guards
+// self-service operations that change how the user signs in, such as
+// password and MFA changes, which support staff must never make for them.
+func BlockImpersonation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if Impersonator(c) != "" {
+			return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeImpersonationRestricted,
+				"This action is not available while impersonating a user")
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+)
+
+// mfaEnrolledCacheKey caches that a user has MFA enabled; only positive
+// results are cached so a fresh enrollment takes effect immediately
+func mfaEnrolledCacheKey(orgID, userID string) string {
+	return "mfa_enrolled:" + orgID + ":" + userID
+}
+
+// RequireMFAEnrollment enforces the global require_mfa setting: while
+// required reports true, users who have not enabled MFA are refused with 403
+// mfa_required until they complete enrollment under /auth/mfa, which must
+// not be behind this guard. Service accounts pass. Must run after
+// RequireAuth and SetRoleStore.
+func (am *AuthMiddleware) RequireMFAEnrollment(required func() bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !required() || am.roles == nil {
+			return c.Next()
+		}
+		if principalType, _ := c.Locals("principal_type").(string); principalType == "service_account" {
+			return c.Next()
+		}
+		userID, _ := c.Locals("user_id").(string)
+		orgID, _ := c.Locals("organization_id").(string)
+		if userID == "" {
+			return c.Next()
+		}
+
+		key := mfaEnrolledCacheKey(orgID, userID)
+		if am.roleTTL > 0 {
+			if n, err := am.redis.Exists(c.Context(), key).Result(); err == nil && n > 0 {
+				return c.Next()
+			}
+		}
+
+		user, err := am.roles.WithContext(c.Context()).GetUserByID(userID, orgID)
+		if err != nil {
+			return apierror.Respond(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Failed to check MFA enrollment")
+		}
+		if !user.MFAEnabled {
+			return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeMFARequired,
+				"Multi-factor authentication is required. Set it up at /auth/mfa/setup to continue.",
+				fiber.Map{"enrollment_required": true})
+		}
+		if am.roleTTL > 0 {
+			am.redis.Set(c.Context(), key, 1, am.roleTTL)
+		}
+		return c.Next()
+	}
+}
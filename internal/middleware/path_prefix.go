@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// StripPathPrefix serves the routes under the path prefix of PUBLIC_URL as
+// well as at the root, so the server works behind gateways that forward the
+// prefix and behind those that strip it. The rewritten path is what the
+// routes match; URLs sent to clients are built from PUBLIC_URL.
+//
+// It must be the first handler of the app: Fiber resumes routing from the
+// same position after the path changes, which is only the same handler in
+// every route tree for the first one.
+func StripPathPrefix(prefix string) fiber.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return func(c *fiber.Ctx) error {
+		if prefix == "" {
+			return c.Next()
+		}
+		path := c.Path()
+		if path == prefix {
+			c.Path("/")
+		} else if rest := strings.TrimPrefix(path, prefix); rest != path && strings.HasPrefix(rest, "/") {
+			c.Path(rest)
+		}
+		return c.Next()
+	}
+}
@@ -1,25 +1,140 @@
 package middleware
 
 import (
+	"context"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
 )
 
-// RateLimiter creates a new rate limiter middleware
-func RateLimiter(max int, expiration time.Duration) fiber.Handler {
-	return limiter.New(limiter.Config{
-		Max:        max,
-		Expiration: expiration,
-		KeyGenerator: func(c *fiber.Ctx) string {
-			return c.IP()
-		},
-		LimitReached: func(c *fiber.Ctx) error {
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error":   "rate_limit_exceeded",
-				"message": "Too many requests, please try again later.",
-			})
-		},
-	})
+// slidingWindowScript counts the requests of a key within the trailing window
+// and admits the current one if the budget allows. It returns
+// {allowed, count, retry_after_ms}.
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call("ZREMRANGEBYSCORE", key, 0, now - window)
+local count = redis.call("ZCARD", key)
+if count < limit then
+	redis.call("ZADD", key, now, ARGV[4])
+	redis.call("PEXPIRE", key, window)
+	return {1, count + 1, 0}
+end
+
+local retry = window
+local oldest = redis.call("ZRANGE", key, 0, 0, "WITHSCORES")
+if oldest[2] then
+	retry = tonumber(oldest[2]) + window - now
+end
+return {0, count, retry}
+`)
+
+// suspiciousTTL is how long an IP stays flagged after tripping a
+// ChallengeAt threshold
+const suspiciousTTL = 30 * time.Minute
+
+// RateLimitBudget is the number of requests allowed within a sliding window
+type RateLimitBudget struct {
+	Limit  int
+	Window time.Duration
+	// ChallengeAt flags the client IP as suspicious once it has made this
+	// many requests in the window (0 disables flagging). Flagged IPs must
+	// solve a challenge on endpoints guarded by RequireChallenge.
+	ChallengeAt int
+}
+
+// RateLimiter enforces Redis-backed sliding-window budgets, so limits hold
+// across all replicas. If Redis is unavailable requests are let through
+// rather than failing the API.
+type RateLimiter struct {
+	redis  redis.UniversalClient
+	logger *logger.Logger
+}
+
+func NewRateLimiter(redis redis.UniversalClient, logger *logger.Logger) *RateLimiter {
+	return &RateLimiter{redis: redis, logger: logger}
+}
+
+// PerIP limits requests by client IP. scope separates independent budgets,
+// e.g. the stricter one on authentication endpoints.
+func (rl *RateLimiter) PerIP(scope string, budget RateLimitBudget) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ip := ClientIP(c)
+		return rl.enforce(c, "ratelimit:"+scope+":ip:"+ip, budget, ip)
+	}
+}
+
+// PerPrincipal limits authenticated requests. Requests made with an API key
+// are limited per key using the key's rate_limit_per_hour (falling back to
+// apiKeyBudget when unset); all other requests are limited per user. It must
+// run after RequireAuth.
+func (rl *RateLimiter) PerPrincipal(userBudget, apiKeyBudget RateLimitBudget) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if keyID, ok := c.Locals("api_key_id").(string); ok && keyID != "" {
+			budget := apiKeyBudget
+			if perHour, _ := c.Locals("api_key_rate_limit").(int); perHour > 0 {
+				budget = RateLimitBudget{Limit: perHour, Window: time.Hour}
+			}
+			return rl.enforce(c, "ratelimit:apikey:"+keyID, budget, "")
+		}
+		if userID, ok := c.Locals("user_id").(string); ok && userID != "" {
+			return rl.enforce(c, "ratelimit:user:"+userID, userBudget, "")
+		}
+		return c.Next()
+	}
+}
+
+func suspiciousKey(ip string) string { return "ratelimit:suspicious:" + ip }
+
+// Suspicious reports whether ip has recently exceeded a ChallengeAt threshold
+func (rl *RateLimiter) Suspicious(ctx context.Context, ip string) bool {
+	n, err := rl.redis.Exists(ctx, suspiciousKey(ip)).Result()
+	return err == nil && n > 0
+}
+
+// enforce applies budget to key. If flagIP is set and the budget has a
+// ChallengeAt threshold, the IP is flagged once the threshold is reached.
+func (rl *RateLimiter) enforce(c *fiber.Ctx, key string, budget RateLimitBudget, flagIP string) error {
+	if budget.Limit <= 0 || budget.Window <= 0 {
+		return c.Next()
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 250*time.Millisecond)
+	defer cancel()
+
+	now := time.Now().UnixMilli()
+	res, err := slidingWindowScript.Run(ctx, rl.redis, []string{key},
+		now, budget.Window.Milliseconds(), budget.Limit, strconv.FormatInt(now, 10)+"-"+uuid.NewString()).Int64Slice()
+	if err != nil || len(res) != 3 {
+		rl.logger.Warn("Rate limiter unavailable, allowing request: %v", err)
+		return c.Next()
+	}
+	allowed, count, retryMS := res[0] == 1, res[1], res[2]
+
+	if flagIP != "" && budget.ChallengeAt > 0 && (count >= int64(budget.ChallengeAt) || !allowed) {
+		if rl.redis.SetNX(ctx, suspiciousKey(flagIP), time.Now().Unix(), suspiciousTTL).Val() {
+			rl.logger.Warn("Flagged %s as suspicious after %d requests in %s", flagIP, count, budget.Window)
+		}
+	}
+
+	c.Set("X-RateLimit-Limit", strconv.Itoa(budget.Limit))
+	c.Set("X-RateLimit-Remaining", strconv.FormatInt(max(int64(budget.Limit)-count, 0), 10))
+
+	if !allowed {
+		retryAfter := (retryMS + 999) / 1000
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(retryAfter, 10))
+		return apierror.Respond(c, fiber.StatusTooManyRequests, apierror.CodeRateLimited, "Too many requests, please try again later.")
+	}
+	return c.Next()
 }
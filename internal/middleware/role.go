@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+)
+
+// SetRoleStore makes RequireRole check the caller's current role assignment
+// instead of the role baked into the token at login, so a revoked role stops
+// working without waiting for the token to expire. The role is cached in
+// Redis for ttl; a ttl of zero reads it from the database on every check.
+func (am *AuthMiddleware) SetRoleStore(roles queries.AuthQueries, ttl time.Duration) {
+	am.roles = roles
+	am.roleTTL = ttl
+}
+
+// currentRole resolves the caller's role. Without a role store, and for
+// service accounts, whose role is fixed at authentication, it is the role
+// set by RequireAuth. Users without an assigned role are "user", as at login.
+func (am *AuthMiddleware) currentRole(c *fiber.Ctx) (string, error) {
+	role, _ := c.Locals("role").(string)
+	if am.roles == nil {
+		return role, nil
+	}
+	if principalType, _ := c.Locals("principal_type").(string); principalType == "service_account" {
+		return role, nil
+	}
+	userID, _ := c.Locals("user_id").(string)
+	orgID, _ := c.Locals("organization_id").(string)
+	if userID == "" || orgID == "" {
+		return role, nil
+	}
+
+	key := queries.PrimaryRoleCacheKey(orgID, userID)
+	if am.roleTTL > 0 {
+		if cached, err := am.redis.Get(c.Context(), key).Result(); err == nil {
+			return cached, nil
+		}
+	}
+
+	role, err := am.roles.WithContext(c.Context()).GetPrimaryRoleForUser(userID, orgID)
+	if err != nil {
+		return "", err
+	}
+	if role == "" {
+		role = "user"
+	}
+	if am.roleTTL > 0 {
+		am.redis.Set(c.Context(), key, role, am.roleTTL)
+	}
+	return role, nil
+}
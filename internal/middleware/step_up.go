@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+)
+
+// SetSessionStore gives the middleware access to sessions for step-up checks
+func (am *AuthMiddleware) SetSessionStore(sessions queries.SessionQueries) {
+	am.sessions = sessions
+}
+
+// RequireRecentMFA guards sensitive operations with step-up authentication:
+// the caller's session must have passed an MFA check within maxAge.
+// Otherwise it responds 403 mfa_required, and the client should collect a
+// code, POST it to /auth/mfa/verify with the same session and retry. Service
+// accounts authenticated by API key have no interactive session and pass.
+// A maxAge of zero disables the check. Must run after RequireAuth.
+func (am *AuthMiddleware) RequireRecentMFA(maxAge time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if maxAge <= 0 {
+			return c.Next()
+		}
+		if principalType, _ := c.Locals("principal_type").(string); principalType == "service_account" {
+			return c.Next()
+		}
+
+		details := fiber.Map{"max_age_seconds": int(maxAge / time.Second)}
+
+		sessionID, _ := c.Locals("session_id").(string)
+		orgID, _ := c.Locals("organization_id").(string)
+		if am.sessions == nil || sessionID == "" {
+			return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeMFARequired, "Verify your MFA code to continue", details)
+		}
+
+		session, err := am.sessions.WithContext(c.Context()).GetSession(sessionID, orgID)
+		if err != nil {
+			return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeMFARequired, "Verify your MFA code to continue", details)
+		}
+		if !session.MFAVerified || session.MFAVerifiedAt == nil || time.Since(*session.MFAVerifiedAt) > maxAge {
+			if session.MFAVerifiedAt != nil {
+				details["mfa_verified_at"] = session.MFAVerifiedAt.UTC()
+			}
+			return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeMFARequired, "This operation requires a recent MFA verification", details)
+		}
+
+		return c.Next()
+	}
+}
@@ -21,6 +21,8 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/internal/database"
 )
 
 // ---------------------------------------------------------------------------
@@ -146,10 +148,7 @@ func (tm *TenantMiddleware) ResolveTenant() fiber.Handler {
 		sessionID, _ := c.Locals("session_id").(string)
 
 		if userID == "" || orgID == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Authentication context incomplete",
-				"success": false,
-			})
+			return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication context incomplete")
 		}
 
 		tc := &TenantContext{
@@ -162,6 +161,12 @@ func (tm *TenantMiddleware) ResolveTenant() fiber.Handler {
 		}
 
 		c.Locals(tenantContextKey, tc)
+		// Root users manage every organization, so their transactions are
+		// not confined by row-level security. Only transactions are: see
+		// database.DB.SetRowLevelSecurity
+		if !tc.IsRoot {
+			c.SetUserContext(database.WithTenant(c.UserContext(), orgID))
+		}
 		return c.Next()
 	}
 }
@@ -173,25 +178,16 @@ func (tm *TenantMiddleware) RequireOrgAccess() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		tc := GetTenantContext(c)
 		if tc == nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Tenant context not resolved",
-				"success": false,
-			})
+			return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Tenant context not resolved")
 		}
 
 		targetOrgID := c.Params("id")
 		if targetOrgID == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Organization ID is required",
-				"success": false,
-			})
+			return apierror.Respond(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Organization ID is required")
 		}
 
 		if !tc.CanAccessOrg(targetOrgID) {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error":   "Access denied: you do not have access to this organization",
-				"success": false,
-			})
+			return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeForbidden, "Access denied: you do not have access to this organization")
 		}
 
 		return c.Next()
@@ -205,25 +201,16 @@ func (tm *TenantMiddleware) RequireOrgAdmin() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		tc := GetTenantContext(c)
 		if tc == nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Tenant context not resolved",
-				"success": false,
-			})
+			return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Tenant context not resolved")
 		}
 
 		targetOrgID := c.Params("id")
 		if targetOrgID == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Organization ID is required",
-				"success": false,
-			})
+			return apierror.Respond(c, fiber.StatusBadRequest, apierror.CodeInvalidRequest, "Organization ID is required")
 		}
 
 		if !tc.CanAdminOrg(targetOrgID) {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error":   "Access denied: admin privileges required for this organization",
-				"success": false,
-			})
+			return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeForbidden, "Access denied: admin privileges required for this organization")
 		}
 
 		return c.Next()
@@ -237,17 +224,11 @@ func (tm *TenantMiddleware) RequireAdmin() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		tc := GetTenantContext(c)
 		if tc == nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Tenant context not resolved",
-				"success": false,
-			})
+			return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Tenant context not resolved")
 		}
 
 		if !tc.IsRoot && !tc.isAdminRole() {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error":   "Access denied: admin role required",
-				"success": false,
-			})
+			return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeForbidden, "Access denied: admin role required")
 		}
 
 		return c.Next()
@@ -261,17 +242,11 @@ func (tm *TenantMiddleware) RequireRoot() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		tc := GetTenantContext(c)
 		if tc == nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Tenant context not resolved",
-				"success": false,
-			})
+			return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Tenant context not resolved")
 		}
 
 		if !tc.IsRoot {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error":   "Access denied: root privileges required",
-				"success": false,
-			})
+			return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeForbidden, "Access denied: root privileges required")
 		}
 
 		return c.Next()
@@ -294,7 +269,7 @@ const (
 // The resolved ID is cached in Redis so subsequent restarts are fast.
 // If the system org does not exist (e.g. migrations haven't run), an empty
 // string is returned and root-user detection is disabled gracefully.
-func ResolveSystemOrgID(ctx context.Context, db *sql.DB, redisClient *redis.Client, slug string) string {
+func ResolveSystemOrgID(ctx context.Context, db *sql.DB, redisClient redis.UniversalClient, slug string) string {
 	// Try Redis cache first
 	if redisClient != nil {
 		cached, err := redisClient.Get(ctx, systemOrgCacheKey).Result()
@@ -15,9 +15,10 @@ type ContentItem struct {
 	ParentID       *string    `json:"parent_id,omitempty" db:"parent_id"` // nullable — for comments / threads
 	OwnerID        string     `json:"owner_id" db:"owner_id"`
 	OrganizationID string     `json:"organization_id" db:"organization_id"`
-	Status         string     `json:"status" db:"status"` // draft, published, archived, private, hidden
-	Tags           string     `json:"tags" db:"tags"`     // JSONB
-	Metadata       string     `json:"metadata" db:"metadata"` // JSONB — type-specific data
+	Status         string     `json:"status" db:"status"`                       // draft, published, archived, private, hidden
+	Tags           string     `json:"tags" db:"tags"`                           // JSONB
+	Metadata       string     `json:"metadata" db:"metadata"`                   // JSONB — type-specific data
+	LockVersion    int        `json:"lock_version,omitempty" db:"lock_version"` // send back as If-Match when updating
 	PublishedAt    *time.Time `json:"published_at" db:"published_at"`
 	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
@@ -26,11 +27,12 @@ type ContentItem struct {
 
 // ContentCollaborator represents a user's role on a specific content item
 type ContentCollaborator struct {
-	ContentID string    `json:"content_id" db:"content_id"`
-	UserID    string    `json:"user_id" db:"user_id"`
-	Role      string    `json:"role" db:"role"` // owner, co-author
-	InvitedBy string    `json:"invited_by" db:"invited_by"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ContentID string     `json:"content_id" db:"content_id"`
+	UserID    string     `json:"user_id" db:"user_id"`
+	Role      string     `json:"role" db:"role"` // owner, co-author
+	InvitedBy string     `json:"invited_by" db:"invited_by"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
 }
 
 // ContentCollaboratorWithUser extends collaborator with user display information
@@ -40,3 +42,94 @@ type ContentCollaboratorWithUser struct {
 	Email       string `json:"email" db:"email"`
 	DisplayName string `json:"display_name" db:"display_name"`
 }
+
+// Comment moderation states
+const (
+	CommentPending  = "pending"
+	CommentApproved = "approved"
+	CommentHidden   = "hidden"
+)
+
+// Comment is a comment content item in a thread, with the first page of its
+// replies. ReplyCount counts every reply visible to the reader, so replies
+// beyond the returned ones are listed from the comment's own thread.
+type Comment struct {
+	ContentItem
+	ModerationStatus string     `json:"moderation_status" db:"moderation_status"`
+	ReplyCount       int        `json:"reply_count"`
+	Replies          []*Comment `json:"replies"`
+	HasMoreReplies   bool       `json:"has_more_replies"`
+}
+
+// ContentRevision is one saved state of a content item. Revisions are
+// numbered from 1 per item; RestoredFrom is set when the revision was
+// created by restoring an earlier one.
+type ContentRevision struct {
+	ID                string    `json:"id" db:"id"`
+	ContentID         string    `json:"content_id" db:"content_id"`
+	Revision          int       `json:"revision" db:"revision"`
+	Title             string    `json:"title" db:"title"`
+	Slug              string    `json:"slug" db:"slug"`
+	Body              string    `json:"body,omitempty" db:"body"`
+	Summary           string    `json:"summary,omitempty" db:"summary"`
+	CoverImageURL     string    `json:"cover_image_url,omitempty" db:"cover_image_url"`
+	Tags              string    `json:"tags,omitempty" db:"tags"`         // JSONB
+	Metadata          string    `json:"metadata,omitempty" db:"metadata"` // JSONB
+	AuthorID          *string   `json:"author_id" db:"author_id"`         // nil once the author is deleted
+	AuthorUsername    string    `json:"author_username,omitempty" db:"author_username"`
+	AuthorDisplayName string    `json:"author_display_name,omitempty" db:"author_display_name"`
+	RestoredFrom      *int      `json:"restored_from,omitempty" db:"restored_from"`
+	CreatedAt         time.Time `json:"created_at" db:"created_at"`
+}
+
+// Reaction types
+const (
+	ReactionLike = "like"
+	ReactionClap = "clap"
+)
+
+// Bookmark is a content item saved by a user
+type Bookmark struct {
+	ContentItem
+	BookmarkedAt time.Time `json:"bookmarked_at" db:"bookmarked_at"`
+}
+
+// Content invitation states
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+)
+
+// ContentInvitation invites an email address without a user in the
+// organization to collaborate on a content item
+type ContentInvitation struct {
+	ID             string     `json:"id" db:"id"`
+	ContentID      string     `json:"content_id" db:"content_id"`
+	OrganizationID string     `json:"organization_id" db:"organization_id"`
+	Email          string     `json:"email" db:"email"`
+	Role           string     `json:"role" db:"role"`
+	Status         string     `json:"status" db:"status"`
+	InvitedBy      *string    `json:"invited_by,omitempty" db:"invited_by"`
+	AcceptedBy     *string    `json:"accepted_by,omitempty" db:"accepted_by"`
+	ExpiresAt      time.Time  `json:"expires_at" db:"expires_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty" db:"accepted_at"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// ContentAttachment is a file uploaded to a content item. It shares its ID
+// with a resource of type object, through which it can be shared.
+type ContentAttachment struct {
+	ID             string    `json:"id" db:"id"`
+	ARN            string    `json:"arn" db:"arn"`
+	ContentID      string    `json:"content_id" db:"content_id"`
+	OrganizationID string    `json:"organization_id" db:"organization_id"`
+	StorageKey     string    `json:"-" db:"storage_key"`
+	Filename       string    `json:"filename" db:"filename"`
+	ContentType    string    `json:"content_type" db:"content_type"`
+	SizeBytes      int64     `json:"size_bytes" db:"size_bytes"`
+	Checksum       string    `json:"checksum" db:"checksum"`
+	UploadedBy     *string   `json:"uploaded_by,omitempty" db:"uploaded_by"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -18,6 +19,7 @@ type User struct {
 	MFAEnabled          bool       `json:"mfa_enabled" db:"mfa_enabled"`
 	MFAMethods          []string   `json:"mfa_methods" db:"mfa_methods"`
 	TOTPSecret          string     `json:"-" db:"totp_secret"`           // Hidden from JSON
+	MFAPhone            string     `json:"-" db:"mfa_phone"`             // SMS OTP number, hidden from JSON
 	MFABackupCodes      []string   `json:"-" db:"mfa_backup_codes"`      // Hidden from JSON
 	Attributes          string     `json:"attributes" db:"attributes"`   // JSONB as string
 	Preferences         string     `json:"preferences" db:"preferences"` // JSONB as string
@@ -31,6 +33,186 @@ type User struct {
 	DeletedAt           *time.Time `json:"deleted_at" db:"deleted_at"`
 }
 
+// AttributeSchema describes the admin-defined shape of user attributes within
+// an organization. It is stored in the organization settings under
+// "user_attribute_schema".
+type AttributeSchema struct {
+	Properties           map[string]AttributeDefinition `json:"properties"`
+	Required             []string                       `json:"required,omitempty"`
+	AdditionalProperties *bool                          `json:"additional_properties,omitempty"`
+}
+
+// AttributeDefinition constrains a single user attribute
+type AttributeDefinition struct {
+	Type        string        `json:"type"` // string, number, integer, boolean, array, object
+	Description string        `json:"description,omitempty"`
+	Enum        []interface{} `json:"enum,omitempty"`
+	MaxLength   int           `json:"max_length,omitempty"`
+}
+
+// TokenLifetimes overrides the server's default token lifetimes for one
+// organization. It is stored in the organization settings under
+// "token_lifetimes"; values are Go durations such as "15m" or "720h".
+type TokenLifetimes struct {
+	AccessTokenTTL  string `json:"access_token_ttl,omitempty"`
+	RefreshTokenTTL string `json:"refresh_token_ttl,omitempty"`
+}
+
+// RegistrationPolicy restricts self-service signup into one organization. It
+// is stored in the organization settings under "registration".
+type RegistrationPolicy struct {
+	// InviteOnly turns public registration off; members are added by
+	// administrators, e.g. through user import with invitations
+	InviteOnly bool `json:"invite_only,omitempty"`
+	// AllowedEmailDomains limits registration to addresses at these domains
+	// (exact match, case-insensitive); empty allows any domain
+	AllowedEmailDomains []string `json:"allowed_email_domains,omitempty"`
+}
+
+// Branding customizes the hosted login, consent and device pages of an
+// organization. It is stored in the organization settings under "branding";
+// colors are hex triplets such as "#1a73e8".
+type Branding struct {
+	ProductName string `json:"product_name,omitempty"`
+	// LogoURL is an http(s) image URL, or that of a logo uploaded to
+	// /organizations/{id}/branding/logo
+	LogoURL          string `json:"logo_url,omitempty"`
+	PrimaryColor     string `json:"primary_color,omitempty"`
+	AccentColor      string `json:"accent_color,omitempty"`
+	BackgroundColor  string `json:"background_color,omitempty"`
+	SupportURL       string `json:"support_url,omitempty"`
+	SupportEmail     string `json:"support_email,omitempty"`
+	PrivacyPolicyURL string `json:"privacy_policy_url,omitempty"`
+	TermsURL         string `json:"terms_url,omitempty"`
+}
+
+// LoginPolicy routes users to an organization's sign-in flow. It is stored
+// in the organization settings under "login".
+type LoginPolicy struct {
+	// EmailDomains are the lowercase email domains /auth/orgs routes to the
+	// organization; organizations that list none are never suggested
+	EmailDomains []string `json:"email_domains,omitempty"`
+	// SSOProviders are offered on the organization's login page ahead of
+	// the password form
+	SSOProviders []LoginProvider `json:"sso_providers,omitempty"`
+	// KerberosRealms are the uppercase realms whose users sign in to the
+	// organization with SPNEGO, as the user named like their principal
+	KerberosRealms []string `json:"kerberos_realms,omitempty"`
+}
+
+// LoginProvider is a single sign-on option of an organization's login page
+type LoginProvider struct {
+	Name string `json:"name"`
+	// URL starts the provider's sign-in, e.g. its authorization endpoint
+	URL string `json:"url"`
+}
+
+// UsernamePolicy governs usernames within one organization. It is stored in
+// the organization settings under "username".
+type UsernamePolicy struct {
+	// ReservedNames cannot be registered or renamed to, in addition to the
+	// built-in ones such as admin and system (case-insensitive)
+	ReservedNames []string `json:"reserved_names,omitempty"`
+	// ChangeCooldownDays is the minimum time between two renames of a user;
+	// unset uses the default of 30 days and 0 allows renaming at any time
+	ChangeCooldownDays *int `json:"change_cooldown_days,omitempty"`
+}
+
+// PasswordPolicy configures password checks within one organization. It is
+// stored in the organization settings under "password".
+type PasswordPolicy struct {
+	// BreachCheck refuses passwords found in known breaches when the server
+	// has a breached password source configured; unset follows the server
+	BreachCheck *bool `json:"breach_check,omitempty"`
+}
+
+// SessionPolicy limits session lifetimes within one organization. It is
+// stored in the organization settings under "session"; values are Go
+// durations such as "30m" or "12h" and can only shorten the server-wide
+// limits.
+type SessionPolicy struct {
+	// IdleTimeout expires sessions that have not been used for this long
+	IdleTimeout string `json:"idle_timeout,omitempty"`
+	// MaxLifetime expires sessions this long after sign-in, however active
+	MaxLifetime string `json:"max_lifetime,omitempty"`
+}
+
+// InactivityPolicy flags the accounts of one organization that have not
+// signed in for a while, notifying them and the org admins, and optionally
+// suspends them after a grace period. It is stored in the organization
+// settings under "inactivity".
+type InactivityPolicy struct {
+	// DormantAfterDays flags an account this many days after its last
+	// sign-in, or its creation if it never signed in; 0 disables the policy
+	DormantAfterDays int `json:"dormant_after_days,omitempty"`
+	// SuspendAfterDays suspends a flagged account that has still not
+	// signed in this many days later; 0 only flags it
+	SuspendAfterDays int `json:"suspend_after_days,omitempty"`
+	// ExemptUserIDs and ExemptGroupIDs name the service-linked accounts,
+	// such as integration or break-glass users, that are never flagged
+	ExemptUserIDs  []string `json:"exempt_user_ids,omitempty"`
+	ExemptGroupIDs []string `json:"exempt_group_ids,omitempty"`
+}
+
+// DormantUser is an active account that has not signed in for the
+// inactivity period of its organization. DormantSince is when it was
+// flagged and notified, nil until the inactivity job has run; SuspendAt is
+// when it will be suspended unless it signs in.
+type DormantUser struct {
+	ID           string     `json:"id"`
+	Username     string     `json:"username"`
+	Email        string     `json:"email"`
+	DisplayName  string     `json:"display_name"`
+	LastLogin    *time.Time `json:"last_login"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DormantSince *time.Time `json:"dormant_since"`
+	SuspendAt    *time.Time `json:"suspend_at,omitempty"`
+}
+
+// SoDRule is a separation-of-duties constraint: nobody may hold more than
+// one of Roles, whether assigned directly or through a group. Roles are
+// role names, compared case-insensitively.
+type SoDRule struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Roles       []string `json:"roles"`
+}
+
+// SeparationOfDutiesPolicy holds the SoD rules of one organization. It is
+// stored in the organization settings under "separation_of_duties".
+type SeparationOfDutiesPolicy struct {
+	Rules []SoDRule `json:"rules,omitempty"`
+}
+
+// SoDViolation is a principal holding more than one role of an SoD rule
+type SoDViolation struct {
+	Rule          string   `json:"rule"`
+	PrincipalID   string   `json:"principal_id"`
+	PrincipalType string   `json:"principal_type"`
+	Roles         []string `json:"roles"`
+}
+
+// CommentPolicy configures comment moderation within one organization. It is
+// stored in the organization settings under "comments".
+type CommentPolicy struct {
+	// RequireApproval holds new comments as pending until the owner of the
+	// commented content or an org admin approves them
+	RequireApproval bool `json:"require_approval,omitempty"`
+}
+
+// AttachmentPolicy limits content attachments within one organization. It is
+// stored in the organization settings under "attachments" and can only
+// narrow the server-wide limits.
+type AttachmentPolicy struct {
+	// MaxFileSizeBytes is the largest upload accepted
+	MaxFileSizeBytes int64 `json:"max_file_size_bytes,omitempty"`
+	// MaxTotalBytes is the storage all attachments of the organization
+	// may use together
+	MaxTotalBytes int64 `json:"max_total_bytes,omitempty"`
+	// AllowedContentTypes lists the accepted media types, such as image/png
+	AllowedContentTypes []string `json:"allowed_content_types,omitempty"`
+}
+
 // Organization represents a tenant entity
 type Organization struct {
 	ID             string     `json:"id" db:"id"`
@@ -50,6 +232,26 @@ type Organization struct {
 	DeletedAt      *time.Time `json:"deleted_at" db:"deleted_at"`
 }
 
+// OrganizationDeletion is the scheduled deletion of an organization. The
+// organization is suspended until ScheduledFor, when it and everything in it
+// is soft-deleted unless a root user cancels first.
+type OrganizationDeletion struct {
+	OrganizationID string     `json:"organization_id" db:"organization_id"`
+	RequestedBy    *string    `json:"requested_by" db:"requested_by"`
+	Reason         string     `json:"reason" db:"reason"`
+	PriorStatus    string     `json:"prior_status" db:"prior_status"`
+	RequestedAt    time.Time  `json:"requested_at" db:"requested_at"`
+	ScheduledFor   time.Time  `json:"scheduled_for" db:"scheduled_for"`
+	Status         string     `json:"status" db:"status"`               // scheduled, cancelled, completed
+	ExportStatus   string     `json:"export_status" db:"export_status"` // pending, completed, failed
+	ExportKey      string     `json:"-" db:"export_key"`
+	ExportSize     *int64     `json:"export_size,omitempty" db:"export_size"`
+	ExportError    string     `json:"export_error,omitempty" db:"export_error"`
+	CancelledBy    *string    `json:"cancelled_by,omitempty" db:"cancelled_by"`
+	CancelledAt    *time.Time `json:"cancelled_at,omitempty" db:"cancelled_at"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+}
+
 // ServiceAccount represents a machine identity
 type ServiceAccount struct {
 	ID                string     `json:"id" db:"id"`
@@ -99,6 +301,20 @@ type GroupMembership struct {
 	Email string `json:"email,omitempty"`
 }
 
+// Principal is a user, service account or group as any of them can be
+// referenced: by role assignments, shares, group memberships, grants and
+// audit events. Email is only set for users.
+type Principal struct {
+	ID             string    `json:"id"`
+	Type           string    `json:"type"` // user, service_account, group
+	OrganizationID string    `json:"organization_id"`
+	Name           string    `json:"name"`
+	DisplayName    string    `json:"display_name"`
+	Email          string    `json:"email,omitempty"`
+	Status         string    `json:"status"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
 // Resource represents any accessible object or service
 type Resource struct {
 	ID               string     `json:"id" db:"id"`
@@ -126,6 +342,73 @@ type Resource struct {
 	DeletedAt        *time.Time `json:"deleted_at" db:"deleted_at"`
 }
 
+// LifecyclePolicy is the schema of a resource's lifecycle_policy. Zero
+// fields are off.
+type LifecyclePolicy struct {
+	// ArchiveAfterIdleDays archives the resource once it has not been read,
+	// updated or recertified for that many days
+	ArchiveAfterIdleDays int `json:"archive_after_idle_days,omitempty"`
+	// DeleteAfterArchivedDays deletes the resource once it has been archived
+	// for that many days, however it was archived
+	DeleteAfterArchivedDays int `json:"delete_after_archived_days,omitempty"`
+	// RecertifyEveryDays asks the owner to certify the resource is still
+	// needed that many days after it was created or last certified
+	RecertifyEveryDays int `json:"recertify_every_days,omitempty"`
+	// RecertifyGraceDays is how long the owner has to answer before the
+	// resource is archived; 30 when zero
+	RecertifyGraceDays int `json:"recertify_grace_days,omitempty"`
+}
+
+// LifecycleAction is a transition the lifecycle worker will make to a
+// resource at DueAt, if nothing changes before. Action is archive, delete
+// or request_recertification; Reason is idle, archived,
+// recertification_due or recertification_lapsed.
+type LifecycleAction struct {
+	Action string    `json:"action"`
+	Reason string    `json:"reason"`
+	DueAt  time.Time `json:"due_at"`
+}
+
+// ResourceLifecycle is where a resource stands in its lifecycle policy
+type ResourceLifecycle struct {
+	ResourceID                 string            `json:"resource_id"`
+	Status                     string            `json:"status"`
+	Policy                     LifecyclePolicy   `json:"policy"`
+	LastActivityAt             time.Time         `json:"last_activity_at"`
+	ArchivedAt                 *time.Time        `json:"archived_at,omitempty"`
+	CertifiedAt                time.Time         `json:"certified_at"`
+	RecertificationRequestedAt *time.Time        `json:"recertification_requested_at,omitempty"`
+	Upcoming                   []LifecycleAction `json:"upcoming"`
+}
+
+// LifecycleTransition is a lifecycle action the worker made to a resource
+type LifecycleTransition struct {
+	OrganizationID string  `json:"organization_id"`
+	ResourceID     string  `json:"resource_id"`
+	ResourceName   string  `json:"resource_name"`
+	OwnerID        *string `json:"owner_id,omitempty"`
+	OwnerType      *string `json:"owner_type,omitempty"`
+	Action         string  `json:"action"`
+	Reason         string  `json:"reason"`
+}
+
+// ResourceIntegrity is the stored SHA-256 checksum of a resource and the
+// outcome of its last check: unverified, valid, mismatch or missing.
+// BlobBacked resources have their content in the server's storage, under
+// StorageKey, and are checked by the server itself.
+type ResourceIntegrity struct {
+	ResourceID     string     `json:"resource_id"`
+	OrganizationID string     `json:"-"`
+	ResourceName   string     `json:"-"`
+	Algorithm      string     `json:"algorithm"`
+	Checksum       *string    `json:"checksum"`
+	SizeBytes      *int64     `json:"size_bytes"`
+	Status         string     `json:"status"`
+	VerifiedAt     *time.Time `json:"verified_at,omitempty"`
+	BlobBacked     bool       `json:"blob_backed"`
+	StorageKey     string     `json:"-"`
+}
+
 // Policy represents access control policies
 type Policy struct {
 	ID             string     `json:"id" db:"id"`
@@ -141,6 +424,7 @@ type Policy struct {
 	ApprovedBy     *string    `json:"approved_by" db:"approved_by"`
 	ApprovedAt     *time.Time `json:"approved_at" db:"approved_at"`
 	Status         string     `json:"status" db:"status"`
+	LockVersion    int        `json:"lock_version,omitempty" db:"lock_version"` // send back as If-Match when updating
 	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
 	DeletedAt      *time.Time `json:"deleted_at" db:"deleted_at"`
@@ -175,6 +459,22 @@ type RolePolicy struct {
 	AttachedBy string    `json:"attached_by" db:"attached_by"`
 }
 
+// ManagedPolicy is a policy from the system catalog that is kept in sync
+// across every organization
+type ManagedPolicy struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Document    string `json:"document"`
+}
+
+// SystemRoleTemplate is a role from the system catalog and the managed
+// policies attached to it
+type SystemRoleTemplate struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Policies    []string `json:"policies"`
+}
+
 // RoleAssignment represents assignment of roles to principals
 type RoleAssignment struct {
 	ID            string     `json:"id" db:"id"`
@@ -187,26 +487,134 @@ type RoleAssignment struct {
 	Conditions    *string    `json:"conditions" db:"conditions"` // JSONB as string
 }
 
+// ExpiringRoleAssignment is a role assignment whose expiry is near, with
+// what its reminder names
+type ExpiringRoleAssignment struct {
+	RoleAssignment
+	OrganizationID string `json:"organization_id"`
+	RoleName       string `json:"role_name"`
+}
+
+// ExpiringShare is a resource share or content co-authorship whose expiry
+// is near, with what its reminder names. Kind is resource or content;
+// AccessLevel holds the co-author role of content.
+type ExpiringShare struct {
+	Kind           string    `json:"kind"`
+	OrganizationID string    `json:"organization_id"`
+	ItemID         string    `json:"item_id"`
+	ItemName       string    `json:"item_name"`
+	PrincipalID    string    `json:"principal_id"`
+	PrincipalType  string    `json:"principal_type"`
+	AccessLevel    string    `json:"access_level"`
+	SharedBy       string    `json:"shared_by"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// RoleRenewalRequest asks for a role assignment to be extended until
+// RequestedExpiresAt. Status is pending, approved or denied.
+type RoleRenewalRequest struct {
+	ID                 string     `json:"id"`
+	OrganizationID     string     `json:"organization_id"`
+	AssignmentID       string     `json:"assignment_id"`
+	RoleID             string     `json:"role_id"`
+	RoleName           string     `json:"role_name"`
+	PrincipalID        string     `json:"principal_id"`
+	PrincipalType      string     `json:"principal_type"`
+	AssignedBy         string     `json:"assigned_by,omitempty"`
+	CurrentExpiresAt   *time.Time `json:"current_expires_at"`
+	RequestedBy        string     `json:"requested_by"`
+	Reason             string     `json:"reason"`
+	RequestedExpiresAt time.Time  `json:"requested_expires_at"`
+	Status             string     `json:"status"`
+	DecidedBy          *string    `json:"decided_by,omitempty"`
+	DecidedAt          *time.Time `json:"decided_at,omitempty"`
+	DecisionComment    string     `json:"decision_comment,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+// ShareLink gives whoever holds its signed token AccessLevel (read or
+// write) on one resource or content item until ExpiresAt, at most MaxUses
+// times when set
+type ShareLink struct {
+	ID             string     `json:"id"`
+	OrganizationID string     `json:"organization_id"`
+	ResourceType   string     `json:"resource_type"`
+	ResourceID     string     `json:"resource_id"`
+	AccessLevel    string     `json:"access_level"`
+	CreatedBy      *string    `json:"created_by,omitempty"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	MaxUses        *int       `json:"max_uses,omitempty"`
+	UseCount       int        `json:"use_count"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy      *string    `json:"revoked_by,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// ExternalSharingPolicy lets the members of one organization share
+// resources and content with people outside it, as guests. It is stored in
+// the organization settings under "external_sharing"; without it external
+// sharing is disabled.
+type ExternalSharingPolicy struct {
+	Enabled bool `json:"enabled"`
+	// AllowedDomains limits guests to email addresses of these domains when
+	// set
+	AllowedDomains []string `json:"allowed_domains,omitempty"`
+	// MaxDays caps how long an external share lasts; 0 uses the server's
+	// limit
+	MaxDays int `json:"max_days,omitempty"`
+}
+
+// GuestPrincipal is someone outside the organization that a resource or
+// content item of it was shared with, known by email address
+type GuestPrincipal struct {
+	ID             string     `json:"id"`
+	OrganizationID string     `json:"organization_id"`
+	Email          string     `json:"email"`
+	CreatedBy      *string    `json:"created_by,omitempty"`
+	LastAccessAt   *time.Time `json:"last_access_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// ExternalShare gives a guest AccessLevel (read or write) on one resource
+// or content item until ExpiresAt
+type ExternalShare struct {
+	ID             string     `json:"id"`
+	OrganizationID string     `json:"organization_id"`
+	GuestID        string     `json:"guest_id"`
+	GuestEmail     string     `json:"guest_email"`
+	ResourceType   string     `json:"resource_type"`
+	ResourceID     string     `json:"resource_id"`
+	AccessLevel    string     `json:"access_level"`
+	SharedBy       *string    `json:"shared_by,omitempty"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	LastAccessAt   *time.Time `json:"last_access_at,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy      *string    `json:"revoked_by,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
 // Session represents active authentication sessions
 type Session struct {
-	ID                string    `json:"id" db:"id"`
-	SessionToken      string    `json:"session_token" db:"session_token"`
-	PrincipalID       string    `json:"principal_id" db:"principal_id"`
-	PrincipalType     string    `json:"principal_type" db:"principal_type"`
-	OrganizationID    string    `json:"organization_id" db:"organization_id"`
-	AssumedRoleID     *string   `json:"assumed_role_id" db:"assumed_role_id"`
-	Permissions       string    `json:"permissions" db:"permissions"` // JSONB as string
-	Context           string    `json:"context" db:"context"`         // JSONB as string
-	MFAVerified       bool      `json:"mfa_verified" db:"mfa_verified"`
-	MFAMethodsUsed    []string  `json:"mfa_methods_used" db:"mfa_methods_used"`
-	IPAddress         *string   `json:"ip_address" db:"ip_address"`
-	UserAgent         *string   `json:"user_agent" db:"user_agent"`
-	DeviceFingerprint *string   `json:"device_fingerprint" db:"device_fingerprint"`
-	Location          string    `json:"location" db:"location"` // JSONB as string
-	IssuedAt          time.Time `json:"issued_at" db:"issued_at"`
-	ExpiresAt         time.Time `json:"expires_at" db:"expires_at"`
-	LastUsedAt        time.Time `json:"last_used_at" db:"last_used_at"`
-	Status            string    `json:"status" db:"status"`
+	ID                string     `json:"id" db:"id"`
+	SessionToken      string     `json:"session_token" db:"session_token"`
+	PrincipalID       string     `json:"principal_id" db:"principal_id"`
+	PrincipalType     string     `json:"principal_type" db:"principal_type"`
+	OrganizationID    string     `json:"organization_id" db:"organization_id"`
+	AssumedRoleID     *string    `json:"assumed_role_id" db:"assumed_role_id"`
+	Permissions       string     `json:"permissions" db:"permissions"` // JSONB as string
+	Context           string     `json:"context" db:"context"`         // JSONB as string
+	MFAVerified       bool       `json:"mfa_verified" db:"mfa_verified"`
+	MFAMethodsUsed    []string   `json:"mfa_methods_used" db:"mfa_methods_used"`
+	MFAVerifiedAt     *time.Time `json:"mfa_verified_at" db:"mfa_verified_at"`
+	IPAddress         *string    `json:"ip_address" db:"ip_address"`
+	UserAgent         *string    `json:"user_agent" db:"user_agent"`
+	DeviceFingerprint *string    `json:"device_fingerprint" db:"device_fingerprint"`
+	Location          string     `json:"location" db:"location"` // JSONB as string
+	IssuedAt          time.Time  `json:"issued_at" db:"issued_at"`
+	ExpiresAt         time.Time  `json:"expires_at" db:"expires_at"`
+	LastUsedAt        time.Time  `json:"last_used_at" db:"last_used_at"`
+	Status            string     `json:"status" db:"status"`
 }
 
 // APIKey represents long-lived credentials for service accounts
@@ -228,6 +636,24 @@ type APIKey struct {
 	CreatedBy        string    `json:"created_by" db:"created_by"`
 }
 
+// ServiceAccountCertificate is a client certificate a service account
+// authenticates with over mutual TLS, pinned by its SHA-256 fingerprint
+type ServiceAccountCertificate struct {
+	ID               string     `json:"id" db:"id"`
+	OrganizationID   string     `json:"organization_id" db:"organization_id"`
+	ServiceAccountID string     `json:"service_account_id" db:"service_account_id"`
+	Name             string     `json:"name" db:"name"`
+	Fingerprint      string     `json:"fingerprint" db:"fingerprint"` // hex SHA-256 of the DER certificate
+	Subject          string     `json:"subject" db:"subject"`
+	NotBefore        time.Time  `json:"not_before" db:"not_before"`
+	NotAfter         time.Time  `json:"not_after" db:"not_after"`
+	LastUsedAt       *time.Time `json:"last_used_at" db:"last_used_at"`
+	CreatedBy        string     `json:"created_by" db:"created_by"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	// BillingTier of the organization, filled in for authentication only
+	BillingTier string `json:"-" db:"-"`
+}
+
 // OAuthClient represents a registered OIDC client/application
 type OAuthClient struct {
 	ID               string     `json:"id" db:"id"`
@@ -238,14 +664,130 @@ type OAuthClient struct {
 	GrantTypes       []string   `json:"grant_types" db:"grant_types"`
 	ResponseTypes    []string   `json:"response_types" db:"response_types"`
 	Scope            string     `json:"scope" db:"scope"`
+	Audiences        []string   `json:"audiences" db:"audiences"`
+	AllowedOrigins   []string   `json:"allowed_origins" db:"allowed_origins"`
+	AllowWildcards   bool       `json:"allow_wildcards" db:"allow_wildcards"`
 	IsPublic         bool       `json:"is_public" db:"is_public"`
 	IsTrusted        bool       `json:"is_trusted" db:"is_trusted"`
+	IsFirstParty     bool       `json:"is_first_party" db:"is_first_party"`
 	LogoURL          *string    `json:"logo_url" db:"logo_url"`
 	PolicyURI        *string    `json:"policy_uri" db:"policy_uri"`
 	TosURI           *string    `json:"tos_uri" db:"tos_uri"`
 	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt        time.Time  `json:"updated_at" db:"updated_at"`
 	DeletedAt        *time.Time `json:"deleted_at" db:"deleted_at"`
+	// PreviousSecretHash is the secret replaced by the last rotation, still
+	// accepted until PreviousSecretExpiresAt
+	PreviousSecretHash      string     `json:"-" db:"previous_secret_hash"`
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at,omitempty" db:"previous_secret_expires_at"`
+	SecretRotatedAt         *time.Time `json:"secret_rotated_at,omitempty" db:"secret_rotated_at"`
+	// TokenPolicy overrides the lifetimes and scopes of the client's tokens
+	TokenPolicy *ClientTokenPolicy `json:"token_policy,omitempty" db:"token_policy"`
+}
+
+// ClientTokenPolicy overrides how tokens are issued to one OIDC client.
+// Lifetimes are Go durations such as "15m"; empty ones keep the defaults.
+// They cannot exceed the organization's client_token_limits.
+type ClientTokenPolicy struct {
+	AccessTokenTTL  string `json:"access_token_ttl,omitempty"`
+	IDTokenTTL      string `json:"id_token_ttl,omitempty"`
+	RefreshTokenTTL string `json:"refresh_token_ttl,omitempty"`
+	// AllowedScopes is the most the client's tokens may carry, standard
+	// scopes included; empty allows every scope of the client
+	AllowedScopes []string `json:"allowed_scopes,omitempty"`
+	// DisableRefreshTokens stops the client getting refresh tokens, even
+	// with offline_access, and refreshing those it already has
+	DisableRefreshTokens bool `json:"disable_refresh_tokens,omitempty"`
+	// Claims are added to the client's tokens after those of its
+	// organization's token_claims, replacing any of the same name
+	Claims []ClaimRule `json:"claims,omitempty"`
+}
+
+// Sources of the value of a custom token claim
+const (
+	ClaimSourceStatic    = "static"
+	ClaimSourceAttribute = "attribute"
+	ClaimSourceGroups    = "groups"
+	ClaimSourceRoles     = "roles"
+)
+
+// ClaimRule adds a custom claim to the access and/or ID tokens issued to
+// OIDC clients. The value is Value for static claims, the user attribute at
+// the dot-separated Attribute path, or the names of the user's groups or
+// roles. Claims whose attribute is missing are left out.
+type ClaimRule struct {
+	Claim     string      `json:"claim"`
+	Source    string      `json:"source"`
+	Value     interface{} `json:"value,omitempty"`
+	Attribute string      `json:"attribute,omitempty"`
+	// Tokens are access_token and/or id_token; empty means both
+	Tokens []string `json:"tokens,omitempty"`
+}
+
+// TokenClaims maps user data into the tokens of every OIDC client of an
+// organization. It is stored in the organization settings under
+// "token_claims".
+type TokenClaims struct {
+	Claims []ClaimRule `json:"claims"`
+}
+
+// ClientTokenLimits caps the token lifetimes the OIDC clients of one
+// organization may set. It is stored in the organization settings under
+// "client_token_limits"; values are Go durations and empty ones leave the
+// lifetime uncapped below the server's limits.
+type ClientTokenLimits struct {
+	MaxAccessTokenTTL  string `json:"max_access_token_ttl,omitempty"`
+	MaxIDTokenTTL      string `json:"max_id_token_ttl,omitempty"`
+	MaxRefreshTokenTTL string `json:"max_refresh_token_ttl,omitempty"`
+}
+
+// TrustedClientPolicy governs which OIDC clients of one organization may
+// skip the consent screen. It is stored in the organization settings under
+// "trusted_clients"; without it trusted clients are allowed.
+type TrustedClientPolicy struct {
+	// Disabled makes every client ask for consent and stops clients being
+	// marked trusted
+	Disabled bool `json:"disabled,omitempty"`
+	// FirstPartyOnly lets only first-party clients skip consent
+	FirstPartyOnly bool `json:"first_party_only,omitempty"`
+}
+
+// OAuthScope is an organization-defined OAuth scope. Actions lists the
+// policy actions (wildcards allowed) a token carrying the scope may perform.
+type OAuthScope struct {
+	ID             string    `json:"id" db:"id"`
+	OrganizationID string    `json:"organization_id" db:"organization_id"`
+	Name           string    `json:"name" db:"name"`
+	Description    string    `json:"description" db:"description"`
+	Actions        []string  `json:"actions" db:"actions"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// OAuthAudience is an API of an organization that access tokens can be
+// issued for. Identifier is the value placed in the aud claim.
+type OAuthAudience struct {
+	ID             string    `json:"id" db:"id"`
+	OrganizationID string    `json:"organization_id" db:"organization_id"`
+	Identifier     string    `json:"identifier" db:"identifier"`
+	Name           string    `json:"name" db:"name"`
+	Description    string    `json:"description" db:"description"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// OAuthConsent records the scopes a user has granted an OAuth client.
+// ClientName and LogoURL are filled in when listing a user's consents.
+type OAuthConsent struct {
+	ID             string    `json:"id" db:"id"`
+	UserID         string    `json:"user_id" db:"user_id"`
+	ClientID       string    `json:"client_id" db:"client_id"`
+	OrganizationID string    `json:"organization_id" db:"organization_id"`
+	Scopes         []string  `json:"scopes" db:"scopes"`
+	ClientName     string    `json:"client_name,omitempty" db:"client_name"`
+	LogoURL        *string   `json:"logo_url,omitempty" db:"logo_url"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
 }
 
 // OIDCAuthCode represents a temporary authorization code
@@ -260,6 +802,46 @@ type OIDCAuthCode struct {
 	Used           bool      `json:"used" db:"used"`
 	OrganizationID string    `json:"organization_id" db:"organization_id"`
 	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+
+	// CodeChallenge binds the code to the PKCE verifier of the client that
+	// asked for it (RFC 7636); empty when the request carried none
+	CodeChallenge       string `json:"code_challenge,omitempty" db:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method,omitempty" db:"code_challenge_method"`
+}
+
+// PushedAuthorizationRequest holds the parameters of an authorization
+// request under a request_uri until it is answered: one a client pushed to
+// the PAR endpoint (RFC 9126), or one the authorize endpoint keeps while
+// the user decides on consent
+type PushedAuthorizationRequest struct {
+	ClientID     string    `json:"client_id"`
+	RedirectURI  string    `json:"redirect_uri"`
+	ResponseType string    `json:"response_type"`
+	Scope        string    `json:"scope"`
+	State        string    `json:"state,omitempty"`
+	Nonce        string    `json:"nonce,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+
+	// PKCE parameters (RFC 7636), bound to the code issued
+	CodeChallenge       string `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string `json:"code_challenge_method,omitempty"`
+}
+
+// DeviceAuthorization is a device authorization request (RFC 8628) from
+// its start until the client collects its tokens
+type DeviceAuthorization struct {
+	DeviceCode string `json:"device_code"`
+	UserCode   string `json:"user_code"`
+	ClientID   string `json:"client_id"`
+	Scope      string `json:"scope"`
+	// Status is pending until the user approves or denies the request
+	Status         string `json:"status"`
+	UserID         string `json:"user_id,omitempty"`
+	OrganizationID string `json:"organization_id,omitempty"`
+	// Interval is the polling interval in seconds; slow_down raises it
+	Interval     int        `json:"interval"`
+	LastPolledAt *time.Time `json:"last_polled_at,omitempty"`
+	ExpiresAt    time.Time  `json:"expires_at"`
 }
 
 // AuditEvent represents audit trail entries
@@ -282,6 +864,268 @@ type AuditEvent struct {
 	RequestID         *string   `json:"request_id" db:"request_id"`
 	AdditionalContext string    `json:"additional_context" db:"additional_context"` // JSONB as string
 	Severity          string    `json:"severity" db:"severity"`
+
+	// Principal is the resolved actor, set when listing events
+	Principal *Principal `json:"principal,omitempty" db:"-"`
+}
+
+// AuditSink is a SIEM destination the audit events of an organization are
+// exported to. Config depends on Type (splunk_hec, syslog, s3) and holds
+// secrets, which the API never returns.
+type AuditSink struct {
+	ID             string          `json:"id"`
+	OrganizationID string          `json:"organization_id"`
+	Name           string          `json:"name"`
+	Type           string          `json:"type"`
+	Config         json.RawMessage `json:"config"`
+	Enabled        bool            `json:"enabled"`
+	CreatedBy      *string         `json:"created_by,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// SecurityRule is a detection rule evaluated over the audit stream of an
+// organization. It fires when Threshold occurrences fall within
+// WindowMinutes, at most once per window and subject. The webhook secret is
+// write-only.
+type SecurityRule struct {
+	ID             string    `json:"id"`
+	OrganizationID string    `json:"organization_id"`
+	Name           string    `json:"name"`
+	Type           string    `json:"type"` // failed_logins, policy_wildcard, mass_role_assignment, api_key_new_country, checksum_mismatch
+	Threshold      int       `json:"threshold"`
+	WindowMinutes  int       `json:"window_minutes"`
+	Severity       string    `json:"severity"` // critical, high, medium, low
+	Enabled        bool      `json:"enabled"`
+	NotifyAdmins   bool      `json:"notify_admins"`
+	WebhookURL     string    `json:"webhook_url,omitempty"`
+	WebhookSecret  string    `json:"-"`
+	WebhookSigned  bool      `json:"webhook_signed"`
+	CreatedBy      *string   `json:"created_by,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// SecurityAlert is raised when a security rule matches. Subject is what the
+// rule counted by: a user, an IP address, a policy or an API key.
+type SecurityAlert struct {
+	ID             string          `json:"id"`
+	OrganizationID string          `json:"organization_id"`
+	RuleID         *string         `json:"rule_id,omitempty"`
+	RuleName       string          `json:"rule_name"`
+	RuleType       string          `json:"rule_type"`
+	Severity       string          `json:"severity"`
+	Subject        string          `json:"subject"`
+	Summary        string          `json:"summary"`
+	Details        json.RawMessage `json:"details"`
+	Status         string          `json:"status"` // open, acknowledged
+	RaisedAt       time.Time       `json:"raised_at"`
+	AcknowledgedBy *string         `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt *time.Time      `json:"acknowledged_at,omitempty"`
+	Note           string          `json:"note,omitempty"`
+}
+
+// DataEncryptionKey is a data key of field encryption: a random AES-256 key
+// stored wrapped by the master key named by MasterKeyID. Encrypted values
+// name the data key they were sealed with; only the active key seals new
+// values.
+type DataEncryptionKey struct {
+	ID          string     `json:"id"`
+	MasterKeyID string     `json:"master_key_id"`
+	WrappedKey  []byte     `json:"-"`
+	Status      string     `json:"status"` // active, retired
+	CreatedAt   time.Time  `json:"created_at"`
+	RetiredAt   *time.Time `json:"retired_at,omitempty"`
+}
+
+// KMSKey is a named encryption key of an organization. Callers encrypt and
+// decrypt through the KMS API with the grants of the key; the key material
+// never leaves the server. Rotation adds a version that encrypts from then
+// on, while earlier versions still decrypt.
+type KMSKey struct {
+	ID                 string    `json:"id"`
+	OrganizationID     string    `json:"organization_id"`
+	Name               string    `json:"name"`
+	Description        string    `json:"description"`
+	Status             string    `json:"status"` // enabled, disabled
+	CurrentVersion     int       `json:"current_version"`
+	RotationPeriodDays int       `json:"rotation_period_days"` // 0 rotates by hand only
+	RotatedAt          time.Time `json:"rotated_at"`
+	CreatedBy          *string   `json:"created_by,omitempty"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// KMSKeyVersion is the material of one version of a KMS key, wrapped by the
+// master key named by MasterKeyID
+type KMSKeyVersion struct {
+	KeyID       string    `json:"key_id"`
+	Version     int       `json:"version"`
+	MasterKeyID string    `json:"master_key_id"`
+	WrappedKey  []byte    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// KMSKeyGrant allows a user, service account or the members of a group to
+// use a KMS key for the listed operations
+type KMSKeyGrant struct {
+	ID             string     `json:"id"`
+	KeyID          string     `json:"key_id"`
+	OrganizationID string     `json:"organization_id"`
+	PrincipalID    string     `json:"principal_id"`
+	PrincipalType  string     `json:"principal_type"` // user, service_account, group
+	Operations     []string   `json:"operations"`     // encrypt, decrypt
+	CreatedBy      *string    `json:"created_by,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+}
+
+// DelegationGrant is a user's consent for a service account to act on
+// their behalf, limited to Actions. A grant is active until it expires or
+// is revoked.
+type DelegationGrant struct {
+	ID                 string     `json:"id"`
+	OrganizationID     string     `json:"organization_id"`
+	UserID             string     `json:"user_id"`
+	ServiceAccountID   string     `json:"service_account_id"`
+	ServiceAccountName string     `json:"service_account_name,omitempty"`
+	Actions            []string   `json:"actions"`
+	CreatedAt          time.Time  `json:"created_at"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
+	RevokedAt          *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt         *time.Time `json:"last_used_at,omitempty"`
+}
+
+// EmailTemplate is a version of an organization's own wording of one kind
+// of email. Subject and TextBody are text templates and HTMLBody an HTML
+// template, which may only use the variables of their kind.
+type EmailTemplate struct {
+	OrganizationID string    `json:"organization_id"`
+	Kind           string    `json:"kind"`
+	Version        int       `json:"version"`
+	Subject        string    `json:"subject"`
+	HTMLBody       string    `json:"html_body"`
+	TextBody       string    `json:"text_body,omitempty"`
+	CreatedBy      *string   `json:"created_by,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ClaimsWebhook is an organization's external claims provider, called when
+// tokens are issued to its OIDC clients. Every claim it adds must start with
+// Namespace. The secret signs the calls and is never returned.
+type ClaimsWebhook struct {
+	OrganizationID string `json:"organization_id"`
+	URL            string `json:"url"`
+	Secret         string `json:"-"`
+	Namespace      string `json:"namespace"`
+	TimeoutMS      int    `json:"timeout_ms"`
+	// CacheSeconds keeps the answer for a user and client that long; 0
+	// calls the webhook for every token
+	CacheSeconds int `json:"cache_seconds"`
+	// FailClosed refuses to issue tokens when the webhook fails, rather
+	// than issuing them without its claims
+	FailClosed    bool       `json:"fail_closed"`
+	Enabled       bool       `json:"enabled"`
+	LastError     *string    `json:"last_error,omitempty"`
+	LastFailureAt *time.Time `json:"last_failure_at,omitempty"`
+	CreatedBy     *string    `json:"created_by,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// Sources a directory sync can pull from
+const (
+	DirectorySourceSCIM = "scim"
+)
+
+// DirectorySync is an organization's scheduled pull of users and group
+// memberships from an external directory. The token authenticates to the
+// source and is never returned.
+type DirectorySync struct {
+	OrganizationID string `json:"organization_id"`
+	SourceType     string `json:"source_type"`
+	BaseURL        string `json:"base_url"`
+	Token          string `json:"-"`
+	// AttributeMapping maps username, email, display_name and
+	// attributes.<name> to dot-separated paths of the source's user records
+	AttributeMapping  map[string]string `json:"attribute_mapping"`
+	SyncGroups        bool              `json:"sync_groups"`
+	DeactivateMissing bool              `json:"deactivate_missing"`
+	IntervalMinutes   int               `json:"interval_minutes"`
+	Enabled           bool              `json:"enabled"`
+	LastRunAt         *time.Time        `json:"last_run_at,omitempty"`
+	CreatedBy         *string           `json:"created_by,omitempty"`
+	CreatedAt         time.Time         `json:"created_at"`
+	UpdatedAt         time.Time         `json:"updated_at"`
+}
+
+// DirectorySyncLink binds a user or group of the directory to the local one
+// a sync manages
+type DirectorySyncLink struct {
+	Kind       string `json:"kind"` // user, group
+	ExternalID string `json:"external_id"`
+	LocalID    string `json:"local_id"`
+	// Deactivated is set on users the sync suspended
+	Deactivated bool `json:"deactivated"`
+}
+
+// DirectorySyncSummary counts what a directory sync run changed, or would
+// change in a dry run
+type DirectorySyncSummary struct {
+	SourceUsers        int `json:"source_users"`
+	SourceGroups       int `json:"source_groups"`
+	UsersCreated       int `json:"users_created"`
+	UsersUpdated       int `json:"users_updated"`
+	UsersDeactivated   int `json:"users_deactivated"`
+	UsersReactivated   int `json:"users_reactivated"`
+	GroupsCreated      int `json:"groups_created"`
+	GroupsUpdated      int `json:"groups_updated"`
+	MembershipsAdded   int `json:"memberships_added"`
+	MembershipsRemoved int `json:"memberships_removed"`
+	Errors             int `json:"errors"`
+}
+
+// DirectorySyncChange is one change of a directory sync run
+type DirectorySyncChange struct {
+	// Action is create, update, deactivate, reactivate, add_member,
+	// remove_member or error
+	Action     string   `json:"action"`
+	Kind       string   `json:"kind"` // user, group, membership
+	ExternalID string   `json:"external_id,omitempty"`
+	ID         string   `json:"id,omitempty"`
+	Name       string   `json:"name,omitempty"`
+	Fields     []string `json:"fields,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// DirectorySyncRun is one run of a directory sync
+type DirectorySyncRun struct {
+	ID             string                `json:"id"`
+	OrganizationID string                `json:"organization_id"`
+	Trigger        string                `json:"trigger"` // schedule, manual
+	TriggeredBy    *string               `json:"triggered_by,omitempty"`
+	DryRun         bool                  `json:"dry_run"`
+	Status         string                `json:"status"` // running, succeeded, failed
+	Error          string                `json:"error,omitempty"`
+	Summary        DirectorySyncSummary  `json:"summary"`
+	Changes        []DirectorySyncChange `json:"changes,omitempty"`
+	StartedAt      time.Time             `json:"started_at"`
+	FinishedAt     *time.Time            `json:"finished_at,omitempty"`
+}
+
+// AuthzDecision is a sampled authorization decision. Trace holds the
+// authz.Trace explaining it.
+type AuthzDecision struct {
+	ID             string          `json:"id" db:"id"`
+	OrganizationID string          `json:"organization_id" db:"organization_id"`
+	PrincipalID    string          `json:"principal_id" db:"principal_id"`
+	PrincipalType  string          `json:"principal_type" db:"principal_type"`
+	Action         string          `json:"action" db:"action"`
+	Resource       string          `json:"resource" db:"resource"`
+	Decision       string          `json:"decision" db:"decision"`
+	Reason         string          `json:"reason" db:"reason"`
+	Trace          json.RawMessage `json:"trace,omitempty" db:"trace"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
 }
 
 // AccessReview represents periodic access certification records
@@ -301,6 +1145,190 @@ type AccessReview struct {
 	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// DataExportJob tracks an asynchronous export of a user's personal data
+type DataExportJob struct {
+	ID             string     `json:"id"`
+	UserID         string     `json:"user_id"`
+	OrganizationID string     `json:"organization_id"`
+	RequestedBy    string     `json:"requested_by"`
+	Status         string     `json:"status"` // pending, running, completed, failed
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+}
+
+// Notification is an event pushed to the open notification streams of a
+// user, its Type the type of the event. Notifications are not stored: users
+// without an open stream miss them.
+type Notification struct {
+	ID             string                 `json:"id"`
+	Type           string                 `json:"type"`
+	OrganizationID string                 `json:"organization_id,omitempty"`
+	Data           map[string]interface{} `json:"data,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+}
+
+// SystemStats is the admin dashboard summary of the whole system, or of one
+// organization when OrganizationID is set. Trends cover the last Days days,
+// oldest first.
+type SystemStats struct {
+	OrganizationID string           `json:"organization_id,omitempty"`
+	Days           int              `json:"days"`
+	GeneratedAt    time.Time        `json:"generated_at"`
+	Users          UserStats        `json:"users"`
+	MFA            MFAStats         `json:"mfa"`
+	ActiveSessions int64            `json:"active_sessions"`
+	Policies       map[string]int64 `json:"policies"`     // by status
+	AuditEvents    map[string]int64 `json:"audit_events"` // by severity, over the window
+	Logins         []DailyLogins    `json:"logins"`
+	Tokens         []DailyTokens    `json:"oidc_tokens"`
+}
+
+// UserStats counts the users that are not deleted
+type UserStats struct {
+	Total          int64               `json:"total"`
+	New            int64               `json:"new"` // created within the window
+	ByStatus       map[string]int64    `json:"by_status"`
+	ByOrganization []OrganizationCount `json:"by_organization,omitempty"` // largest organizations, system stats only
+}
+
+// OrganizationCount is the number of users of an organization
+type OrganizationCount struct {
+	OrganizationID string `json:"organization_id"`
+	Name           string `json:"name"`
+	Users          int64  `json:"users"`
+}
+
+// MFAStats is the MFA adoption among active users
+type MFAStats struct {
+	ActiveUsers  int64   `json:"active_users"`
+	Enabled      int64   `json:"enabled"`
+	AdoptionRate float64 `json:"adoption_rate"` // 0 to 1
+}
+
+// DailyLogins counts the login attempts of a UTC day (YYYY-MM-DD)
+type DailyLogins struct {
+	Date      string `json:"date"`
+	Succeeded int64  `json:"succeeded"`
+	Failed    int64  `json:"failed"`
+}
+
+// DailyTokens counts the OAuth2 access tokens issued on a UTC day
+type DailyTokens struct {
+	Date        string           `json:"date"`
+	Issued      int64            `json:"issued"`
+	ByGrantType map[string]int64 `json:"by_grant_type,omitempty"`
+}
+
+// OrgUsageDay is the usage of an organization on a UTC day, as rolled up by
+// the nightly org_usage_rollup job
+type OrgUsageDay struct {
+	Day              string           `json:"day"` // YYYY-MM-DD
+	ActiveUsers      int64            `json:"active_users"`
+	Logins           int64            `json:"logins"`
+	LoginFailures    int64            `json:"login_failures"`
+	ContentPublished int64            `json:"content_published"`
+	APIKeyRequests   int64            `json:"api_key_requests"`
+	TopResources     []ResourceAccess `json:"top_resources"`
+}
+
+// ResourceAccess counts the audited accesses to a resource
+type ResourceAccess struct {
+	ResourceType string `json:"resource_type"`
+	ResourceID   string `json:"resource_id"`
+	Count        int64  `json:"count"`
+}
+
+// OrgUsageReport is the usage of an organization over a range of days.
+// Days without a rollup are missing from Days.
+type OrgUsageReport struct {
+	OrganizationID string        `json:"organization_id"`
+	From           string        `json:"from"`
+	To             string        `json:"to"`
+	Days           []OrgUsageDay `json:"days"`
+	Totals         OrgUsageTotal `json:"totals"`
+}
+
+// OrgUsageTotal sums the usage of a report; active users are not unique
+// over days, so only their daily average is given
+type OrgUsageTotal struct {
+	AverageDailyActiveUsers float64          `json:"average_daily_active_users"`
+	Logins                  int64            `json:"logins"`
+	LoginFailures           int64            `json:"login_failures"`
+	ContentPublished        int64            `json:"content_published"`
+	APIKeyRequests          int64            `json:"api_key_requests"`
+	TopResources            []ResourceAccess `json:"top_resources"`
+}
+
+// UserImportRow is a single user record of a bulk import
+type UserImportRow struct {
+	Username    string `json:"username"`
+	Email       string `json:"email"`
+	DisplayName string `json:"display_name,omitempty"`
+	Password    string `json:"password,omitempty"`
+	Role        string `json:"role,omitempty"`
+}
+
+// UserImportRowResult reports the outcome of one import row
+type UserImportRowResult struct {
+	Row    int      `json:"row"` // 1-based position in the uploaded file, excluding the CSV header
+	Email  string   `json:"email"`
+	Status string   `json:"status"` // valid (dry run), created, failed
+	UserID string   `json:"user_id,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// UserImportJob tracks an asynchronous bulk user import
+type UserImportJob struct {
+	ID             string                `json:"id"`
+	OrganizationID string                `json:"organization_id"`
+	RequestedBy    string                `json:"requested_by"`
+	Status         string                `json:"status"` // pending, running, completed, failed
+	DryRun         bool                  `json:"dry_run"`
+	SendInvites    bool                  `json:"send_invites"`
+	Total          int                   `json:"total"`
+	Processed      int                   `json:"processed"`
+	Succeeded      int                   `json:"succeeded"`
+	Failed         int                   `json:"failed"`
+	Results        []UserImportRowResult `json:"results"`
+	Error          string                `json:"error,omitempty"`
+	CreatedAt      time.Time             `json:"created_at"`
+	CompletedAt    *time.Time            `json:"completed_at,omitempty"`
+	ExpiresAt      time.Time             `json:"expires_at"`
+}
+
+// SimilarUsernames is a pair of users in one organization whose usernames
+// are alike, as found by trigram similarity
+type SimilarUsernames struct {
+	UserIDs    [2]string `json:"user_ids"`
+	Similarity float64   `json:"similarity"`
+}
+
+// DuplicateUserCandidate is a pair of users that probably belong to the same
+// person. Reasons lists why they were paired: same_email when their emails
+// deliver to the same mailbox, similar_username when their usernames are
+// alike. SuggestedTargetID is the account to keep when merging them.
+type DuplicateUserCandidate struct {
+	Users              [2]User  `json:"users"`
+	Reasons            []string `json:"reasons"`
+	UsernameSimilarity float64  `json:"username_similarity,omitempty"`
+	SuggestedTargetID  string   `json:"suggested_target_id"`
+}
+
+// UserMerge reports what was moved from a merged user to the user that
+// absorbed it. Assignments and memberships both users had are counted once.
+type UserMerge struct {
+	SourceUserID     string `json:"source_user_id"`
+	TargetUserID     string `json:"target_user_id"`
+	RoleAssignments  int64  `json:"role_assignments"`
+	GroupMemberships int64  `json:"group_memberships"`
+	ContentItems     int64  `json:"content_items"`
+	Collaborations   int64  `json:"collaborations"`
+	Sessions         int64  `json:"sessions"`
+	RevokedSessions  int    `json:"revoked_sessions"`
+}
+
 // GlobalSettings represents system-wide configuration settings
 type GlobalSettings struct {
 	ID                      string    `json:"id" db:"id"`
@@ -319,6 +1347,24 @@ type GlobalSettings struct {
 	UpdatedAt               time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// DefaultGlobalSettings returns the settings a new installation starts with
+func DefaultGlobalSettings() GlobalSettings {
+	return GlobalSettings{
+		ID:                      "default",
+		MaintenanceMode:         false,
+		MaintenanceMessage:      "",
+		MaxUsersPerOrganization: 1000,
+		MaxSessionDuration:      480, // 8 hours
+		PasswordMinLength:       8,
+		RequireMFA:              false,
+		AllowRegistration:       true,
+		EmailVerificationReq:    true,
+		TokenExpirationMinutes:  60,
+		AuditLogRetentionDays:   90,
+		Settings:                "{}",
+	}
+}
+
 // MFA Request/Response Models
 
 // SetupMFARequest represents the request to setup MFA
@@ -335,6 +1381,14 @@ type SetupMFAResponse struct {
 	Message     string   `json:"message"`
 }
 
+// SendMFACodeRequest requests an email or SMS one-time code. MFAToken is
+// the token returned by login when verifying a sign-in; without it the code
+// is sent to the authenticated user.
+type SendMFACodeRequest struct {
+	MFAToken string `json:"mfa_token,omitempty"`
+	Method   string `json:"method" validate:"required,oneof=sms email"`
+}
+
 // VerifyMFARequest represents the request to verify MFA code
 type VerifyMFARequest struct {
 	UserID     string `json:"user_id" validate:"required"`
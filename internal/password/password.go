@@ -0,0 +1,270 @@
+// Package password hashes and verifies user passwords. Hashes are
+// self-describing, so hashes of every supported algorithm verify whatever the
+// configured algorithm is, and NeedsRehash tells when a stored hash should be
+// replaced after the next successful login.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/the-monkeys/monkeys-identity/internal/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported algorithms
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+	// argon2MaxMemory bounds the memory a stored hash can make Verify use
+	argon2MaxMemory = 4 * 1024 * 1024 // KiB
+)
+
+var (
+	// ErrMismatch is returned by Verify when the password does not match
+	ErrMismatch = errors.New("password does not match")
+	// ErrUnsupportedHash is returned by Verify for hashes of an unknown
+	// algorithm or with invalid parameters
+	ErrUnsupportedHash = errors.New("unsupported password hash")
+)
+
+// Params selects the algorithm and cost of new hashes
+type Params struct {
+	Algorithm         string // Bcrypt or Argon2id
+	BcryptCost        int
+	Argon2Memory      uint32 // KiB
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+}
+
+// DefaultParams hashes with bcrypt at its default cost, and sets the OWASP
+// recommended Argon2id parameters for when Argon2id is selected
+var DefaultParams = Params{
+	Algorithm:         Bcrypt,
+	BcryptCost:        bcrypt.DefaultCost,
+	Argon2Memory:      64 * 1024,
+	Argon2Iterations:  3,
+	Argon2Parallelism: 2,
+}
+
+// Hasher hashes passwords with the configured parameters
+type Hasher struct {
+	params Params
+}
+
+// New validates params and returns a Hasher using them
+func New(params Params) (*Hasher, error) {
+	switch params.Algorithm {
+	case Bcrypt:
+		if params.BcryptCost < bcrypt.MinCost || params.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case Argon2id:
+		if params.Argon2Memory < 8*uint32(params.Argon2Parallelism) || params.Argon2Memory > argon2MaxMemory {
+			return nil, fmt.Errorf("argon2id memory must be between 8 KiB per lane and %d KiB", argon2MaxMemory)
+		}
+		if params.Argon2Iterations < 1 || params.Argon2Parallelism < 1 {
+			return nil, fmt.Errorf("argon2id iterations and parallelism must be at least 1")
+		}
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q (want %s or %s)", params.Algorithm, Bcrypt, Argon2id)
+	}
+	return &Hasher{params: params}, nil
+}
+
+// FromConfig returns a Hasher with the parameters set by
+// PASSWORD_HASH_ALGORITHM, BCRYPT_COST and the ARGON2_* settings
+func FromConfig(cfg *config.Config) (*Hasher, error) {
+	if cfg.Argon2MemoryKB < 1 || cfg.Argon2Iterations < 1 || cfg.Argon2Parallelism < 1 || cfg.Argon2Parallelism > 255 {
+		return nil, fmt.Errorf("ARGON2_MEMORY_KB, ARGON2_ITERATIONS and ARGON2_PARALLELISM (at most 255) must be positive")
+	}
+	return New(Params{
+		Algorithm:         strings.ToLower(cfg.PasswordHashAlgorithm),
+		BcryptCost:        cfg.BcryptCost,
+		Argon2Memory:      uint32(cfg.Argon2MemoryKB),
+		Argon2Iterations:  uint32(cfg.Argon2Iterations),
+		Argon2Parallelism: uint8(cfg.Argon2Parallelism),
+	})
+}
+
+// Algorithm returns the algorithm new hashes use
+func (h *Hasher) Algorithm() string {
+	return h.params.Algorithm
+}
+
+// Hash hashes a password with the configured algorithm
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.params.Algorithm == Argon2id {
+		salt := make([]byte, argon2SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		p := argon2Params{
+			version:     argon2.Version,
+			memory:      h.params.Argon2Memory,
+			iterations:  h.params.Argon2Iterations,
+			parallelism: h.params.Argon2Parallelism,
+		}
+		key := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, argon2KeyLength)
+		return p.header() + base64.RawStdEncoding.EncodeToString(salt) + "$" + base64.RawStdEncoding.EncodeToString(key), nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.params.BcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify checks a password against a hash of any supported algorithm. It
+// returns ErrMismatch when the password is wrong.
+func (h *Hasher) Verify(hash, password string) error {
+	switch Algorithm(hash) {
+	case Bcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrMismatch
+		}
+		return err
+	case Argon2id:
+		p, rest, ok := parseArgon2(hash)
+		if !ok {
+			return ErrUnsupportedHash
+		}
+		encodedSalt, encodedKey, ok := strings.Cut(rest, "$")
+		if !ok {
+			return ErrUnsupportedHash
+		}
+		salt, err := base64.RawStdEncoding.DecodeString(encodedSalt)
+		if err != nil {
+			return ErrUnsupportedHash
+		}
+		key, err := base64.RawStdEncoding.DecodeString(encodedKey)
+		if err != nil || len(key) == 0 {
+			return ErrUnsupportedHash
+		}
+		computed := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(computed, key) != 1 {
+			return ErrMismatch
+		}
+		return nil
+	}
+	return ErrUnsupportedHash
+}
+
+// NeedsRehash reports whether a hash uses another algorithm or other
+// parameters than new hashes. Only the leading parameters of the hash are
+// read, so it also accepts a hash truncated after them.
+func (h *Hasher) NeedsRehash(hash string) bool {
+	switch Algorithm(hash) {
+	case Bcrypt:
+		cost, ok := bcryptCost(hash)
+		return !ok || h.params.Algorithm != Bcrypt || cost != h.params.BcryptCost
+	case Argon2id:
+		p, _, ok := parseArgon2(hash)
+		return !ok || h.params.Algorithm != Argon2id || p.version != argon2.Version ||
+			p.memory != h.params.Argon2Memory || p.iterations != h.params.Argon2Iterations ||
+			p.parallelism != h.params.Argon2Parallelism
+	}
+	return false
+}
+
+// Algorithm returns the algorithm of a hash, or "unknown"
+func Algorithm(hash string) string {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return Argon2id
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return Bcrypt
+	}
+	return "unknown"
+}
+
+// bcryptCost reads the cost of a "$2a$10$..." hash
+func bcryptCost(hash string) (int, bool) {
+	if len(hash) < 7 || hash[6] != '$' {
+		return 0, false
+	}
+	cost, err := strconv.Atoi(hash[4:6])
+	return cost, err == nil
+}
+
+type argon2Params struct {
+	version     int
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+func (p argon2Params) header() string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$", p.version, p.memory, p.iterations, p.parallelism)
+}
+
+// parseArgon2 reads the parameters of a
+// "$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>" hash and returns what
+// follows them
+func parseArgon2(hash string) (argon2Params, string, bool) {
+	var p argon2Params
+	parts := strings.SplitN(strings.TrimPrefix(hash, "$argon2id$"), "$", 3)
+	if len(parts) < 2 {
+		return p, "", false
+	}
+	if _, err := fmt.Sscanf(parts[0], "v=%d", &p.version); err != nil {
+		return p, "", false
+	}
+	if _, err := fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return p, "", false
+	}
+	if p.memory == 0 || p.memory > argon2MaxMemory || p.iterations == 0 || p.parallelism == 0 {
+		return p, "", false
+	}
+	rest := ""
+	if len(parts) == 3 {
+		rest = parts[2]
+	}
+	return p, rest, true
+}
+
+var defaultHasher atomic.Pointer[Hasher]
+
+func init() {
+	h, _ := New(DefaultParams)
+	defaultHasher.Store(h)
+}
+
+// SetDefault replaces the hasher used by the package level functions.
+// Called once at startup with the configured parameters.
+func SetDefault(h *Hasher) {
+	defaultHasher.Store(h)
+}
+
+// Default returns the hasher used by the package level functions
+func Default() *Hasher {
+	return defaultHasher.Load()
+}
+
+// Hash hashes a password with the default hasher
+func Hash(password string) (string, error) {
+	return Default().Hash(password)
+}
+
+// Verify checks a password against a hash with the default hasher
+func Verify(hash, password string) error {
+	return Default().Verify(hash, password)
+}
+
+// NeedsRehash reports whether the default hasher would hash differently
+func NeedsRehash(hash string) bool {
+	return Default().NeedsRehash(hash)
+}
@@ -0,0 +1,107 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2 keeps the tests fast
+var testArgon2 = Params{Algorithm: Argon2id, Argon2Memory: 64, Argon2Iterations: 1, Argon2Parallelism: 1}
+
+func mustNew(t *testing.T, p Params) *Hasher {
+	t.Helper()
+	h, err := New(p)
+	if err != nil {
+		t.Fatalf("New(%+v): %v", p, err)
+	}
+	return h
+}
+
+func TestHashAndVerify(t *testing.T) {
+	for _, p := range []Params{{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost}, testArgon2} {
+		h := mustNew(t, p)
+		hash, err := h.Hash("correct horse")
+		if err != nil {
+			t.Fatalf("%s: Hash: %v", p.Algorithm, err)
+		}
+		if Algorithm(hash) != p.Algorithm {
+			t.Errorf("Algorithm(%q) = %s, want %s", hash, Algorithm(hash), p.Algorithm)
+		}
+		if err := h.Verify(hash, "correct horse"); err != nil {
+			t.Errorf("%s: Verify: %v", p.Algorithm, err)
+		}
+		if err := h.Verify(hash, "battery staple"); !errors.Is(err, ErrMismatch) {
+			t.Errorf("%s: Verify with a wrong password: err = %v", p.Algorithm, err)
+		}
+		if h.NeedsRehash(hash) {
+			t.Errorf("%s: fresh hash needs a rehash", p.Algorithm)
+		}
+	}
+}
+
+func TestVerifyAcrossAlgorithms(t *testing.T) {
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	h := mustNew(t, testArgon2)
+	if err := h.Verify(string(legacy), "secret"); err != nil {
+		t.Errorf("argon2id hasher rejects a bcrypt hash: %v", err)
+	}
+	if !h.NeedsRehash(string(legacy)) {
+		t.Error("bcrypt hash does not need a rehash when argon2id is configured")
+	}
+	for _, hash := range []string{"", "plain", "$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5", "$argon2id$v=19$m=64,t=1,p=1$!!$a2V5"} {
+		if err := h.Verify(hash, "secret"); !errors.Is(err, ErrUnsupportedHash) {
+			t.Errorf("Verify(%q): err = %v, want ErrUnsupportedHash", hash, err)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	bcrypt12 := mustNew(t, Params{Algorithm: Bcrypt, BcryptCost: 12})
+	argon := mustNew(t, Params{Algorithm: Argon2id, Argon2Memory: 65536, Argon2Iterations: 3, Argon2Parallelism: 2})
+	for _, tc := range []struct {
+		h    *Hasher
+		hash string
+		want bool
+	}{
+		{bcrypt12, "$2a$12$", false},
+		{bcrypt12, "$2b$10$abc", true},
+		{bcrypt12, "$argon2id$v=19$m=65536,t=3,p=2$", true},
+		{argon, "$argon2id$v=19$m=65536,t=3,p=2$", false},
+		{argon, "$argon2id$v=19$m=65536,t=2,p=2$salt$key", true},
+		{argon, "$argon2id$v=16$m=65536,t=3,p=2$", true},
+		{argon, "$2a$12$", true},
+		{argon, "unknown", false},
+	} {
+		if got := tc.h.NeedsRehash(tc.hash); got != tc.want {
+			t.Errorf("%s NeedsRehash(%q) = %v, want %v", tc.h.Algorithm(), tc.hash, got, tc.want)
+		}
+	}
+}
+
+func TestNewRejectsInvalidParams(t *testing.T) {
+	for _, p := range []Params{
+		{Algorithm: "md5"},
+		{Algorithm: Bcrypt, BcryptCost: 2},
+		{Algorithm: Argon2id, Argon2Memory: 4, Argon2Iterations: 1, Argon2Parallelism: 1},
+		{Algorithm: Argon2id, Argon2Memory: 64, Argon2Iterations: 0, Argon2Parallelism: 1},
+	} {
+		if _, err := New(p); err == nil {
+			t.Errorf("New(%+v) accepted invalid parameters", p)
+		}
+	}
+}
+
+func TestDefault(t *testing.T) {
+	defer SetDefault(Default())
+	SetDefault(mustNew(t, testArgon2))
+	hash, err := Hash("secret")
+	if err != nil || !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("Hash = %q, %v", hash, err)
+	}
+	if err := Verify(hash, "secret"); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
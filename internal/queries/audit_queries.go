@@ -22,6 +22,8 @@ type AuditQueries interface {
 	GetAuditEvent(eventID, organizationID string) (*models.AuditEvent, error)
 	ListAuditEvents(params ListAuditEventsParams) ([]models.AuditEvent, int, error)
 	GetAuditEventsByUser(userID, organizationID string, limit int) ([]models.AuditEvent, error)
+	GetAuditEventsReferencingUser(userID, organizationID string, limit int) ([]models.AuditEvent, error)
+	ListEntityChanges(organizationID, resourceType, resourceID string, limit int) ([]models.AuditEvent, error)
 	DeleteOldAuditEvents(olderThan time.Duration, organizationID string) (int64, error)
 
 	// Report Generation
@@ -36,16 +38,37 @@ type AuditQueries interface {
 	UpdateAccessReview(reviewID, organizationID string, review models.AccessReview) (*models.AccessReview, error)
 	CompleteAccessReview(reviewID, organizationID string, findings string, recommendations string) error
 	DeleteAccessReview(reviewID, organizationID string) error
+
+	// Audit Sink Operations
+	CreateAuditSink(sink *models.AuditSink) error
+	ListAuditSinks(organizationID string) ([]models.AuditSink, error)
+	ListEnabledAuditSinks() ([]models.AuditSink, error)
+	GetAuditSink(id, organizationID string) (*models.AuditSink, error)
+	UpdateAuditSink(sink *models.AuditSink) error
+	DeleteAuditSink(id, organizationID string) error
+
+	// Security Rule and Alert Operations
+	CreateSecurityRule(rule *models.SecurityRule) error
+	ListSecurityRules(organizationID string) ([]models.SecurityRule, error)
+	ListEnabledSecurityRules() ([]models.SecurityRule, error)
+	GetSecurityRule(id, organizationID string) (*models.SecurityRule, error)
+	UpdateSecurityRule(rule *models.SecurityRule) error
+	DeleteSecurityRule(id, organizationID string) error
+	CreateSecurityAlert(alert *models.SecurityAlert) error
+	ListSecurityAlerts(params ListParams, organizationID, status string) (*ListResult[models.SecurityAlert], error)
+	GetSecurityAlert(id, organizationID string) (*models.SecurityAlert, error)
+	AcknowledgeSecurityAlert(id, organizationID, acknowledgedBy, note string) (*models.SecurityAlert, error)
+	ListSecurityAlertRecipients(organizationID string) ([]string, error)
 }
 
 type auditQueries struct {
 	db    *database.DB
-	redis *redis.Client
+	redis redis.UniversalClient
 	tx    *sql.Tx
 	ctx   context.Context
 }
 
-func NewAuditQueries(db *database.DB, redis *redis.Client) AuditQueries {
+func NewAuditQueries(db *database.DB, redis redis.UniversalClient) AuditQueries {
 	return &auditQueries{db: db, redis: redis, ctx: context.Background()}
 }
 
@@ -69,6 +92,19 @@ func (q *auditQueries) getDB() interface {
 	return q.db
 }
 
+// getReadDB is getDB for reads that tolerate replication lag, which may be
+// served by a replica
+func (q *auditQueries) getReadDB() interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+} {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.Reader()
+}
+
 // toNullUUID returns nil if the string is empty, otherwise returns the string.
 // This is useful for UUID columns in PostgreSQL that should be NULL instead of an empty string.
 func toNullUUID(id string) interface{} {
@@ -175,6 +211,7 @@ type ListAuditEventsParams struct {
 	PrincipalID    string
 	Action         string
 	ResourceType   string
+	ResourceID     string
 	Result         string
 	Severity       string
 	StartTime      *time.Time
@@ -224,6 +261,12 @@ func (q *auditQueries) ListAuditEvents(params ListAuditEventsParams) ([]models.A
 		argIndex++
 	}
 
+	if params.ResourceID != "" {
+		whereConditions = append(whereConditions, fmt.Sprintf("resource_id = $%d", argIndex))
+		args = append(args, params.ResourceID)
+		argIndex++
+	}
+
 	if params.Result != "" {
 		whereConditions = append(whereConditions, fmt.Sprintf("result = $%d", argIndex))
 		args = append(args, params.Result)
@@ -253,7 +296,7 @@ func (q *auditQueries) ListAuditEvents(params ListAuditEventsParams) ([]models.A
 	// Count total records
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM audit_events WHERE %s", whereClause)
 	var totalCount int
-	db := q.getDB()
+	db := q.getReadDB()
 	err := db.QueryRow(countQuery, args...).Scan(&totalCount)
 	if err != nil {
 		return nil, 0, err
@@ -403,7 +446,7 @@ func (q *auditQueries) GenerateAccessReport(params AccessReportParams) (*AccessR
 
 	whereClause := strings.Join(whereConditions, " AND ")
 
-	db := q.getDB()
+	db := q.getReadDB()
 
 	// Get summary statistics
 	summaryQuery := fmt.Sprintf(`
@@ -610,7 +653,7 @@ func (q *auditQueries) GenerateComplianceReport(params ComplianceReportParams) (
 
 	whereClause := strings.Join(whereConditions, " AND ")
 
-	db := q.getDB()
+	db := q.getReadDB()
 
 	// Get security events summary
 	securityEventsQuery := fmt.Sprintf(`
@@ -788,7 +831,7 @@ func (q *auditQueries) GeneratePolicyUsageReport(params PolicyUsageReportParams)
 
 	whereClause := strings.Join(whereConditions, " AND ")
 
-	db := q.getDB()
+	db := q.getReadDB()
 
 	// Get policy usage summary
 	summaryQuery := fmt.Sprintf(`
@@ -969,6 +1012,124 @@ func (q *auditQueries) GetAuditEventsByUser(userID, organizationID string, limit
 	return events, rows.Err()
 }
 
+// ListEntityChanges retrieves the audit events recording a before/after
+// snapshot of one entity, oldest first. The limit keeps the most recent
+// changes.
+func (q *auditQueries) ListEntityChanges(organizationID, resourceType, resourceID string, limit int) ([]models.AuditEvent, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	query := `
+		SELECT id, event_id, timestamp, organization_id, principal_id, principal_type,
+			   session_id, action, resource_type, resource_id, resource_arn,
+			   result, error_message, ip_address, user_agent, request_id,
+			   additional_context, severity
+		FROM (
+			SELECT * FROM audit_events
+			WHERE organization_id = $1 AND resource_type = $2 AND resource_id = $3
+			  AND additional_context ? 'changed_fields'
+			ORDER BY timestamp DESC
+			LIMIT $4
+		) recent
+		ORDER BY timestamp ASC`
+
+	db := q.getReadDB()
+	rows, err := db.Query(query, organizationID, resourceType, resourceID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var event models.AuditEvent
+		err := rows.Scan(
+			&event.ID,
+			&event.EventID,
+			&event.Timestamp,
+			&event.OrganizationID,
+			&event.PrincipalID,
+			&event.PrincipalType,
+			&event.SessionID,
+			&event.Action,
+			&event.ResourceType,
+			&event.ResourceID,
+			&event.ResourceARN,
+			&event.Result,
+			&event.ErrorMessage,
+			&event.IPAddress,
+			&event.UserAgent,
+			&event.RequestID,
+			&event.AdditionalContext,
+			&event.Severity,
+		)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// GetAuditEventsReferencingUser retrieves audit events where the user is either
+// the acting principal or the target resource
+func (q *auditQueries) GetAuditEventsReferencingUser(userID, organizationID string, limit int) ([]models.AuditEvent, error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+
+	query := `
+		SELECT id, event_id, timestamp, organization_id, principal_id, principal_type,
+			   session_id, action, resource_type, resource_id, resource_arn,
+			   result, error_message, ip_address, user_agent, request_id,
+			   additional_context, severity
+		FROM audit_events
+		WHERE organization_id = $2
+		  AND (principal_id = $1 OR (resource_type = 'user' AND resource_id = $1))
+		ORDER BY timestamp DESC
+		LIMIT $3`
+
+	db := q.getDB()
+	rows, err := db.Query(query, userID, organizationID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	for rows.Next() {
+		var event models.AuditEvent
+		err := rows.Scan(
+			&event.ID,
+			&event.EventID,
+			&event.Timestamp,
+			&event.OrganizationID,
+			&event.PrincipalID,
+			&event.PrincipalType,
+			&event.SessionID,
+			&event.Action,
+			&event.ResourceType,
+			&event.ResourceID,
+			&event.ResourceARN,
+			&event.Result,
+			&event.ErrorMessage,
+			&event.IPAddress,
+			&event.UserAgent,
+			&event.RequestID,
+			&event.AdditionalContext,
+			&event.Severity,
+		)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
 // DeleteOldAuditEvents removes audit events older than the specified duration for an organization
 func (q *auditQueries) DeleteOldAuditEvents(olderThan time.Duration, organizationID string) (int64, error) {
 	cutoffTime := time.Now().Add(-olderThan)
@@ -1033,7 +1194,7 @@ func (q *auditQueries) ListAccessReviews(params ListAccessReviewsParams) ([]mode
 	// Count total records
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM access_reviews WHERE %s", whereClause)
 	var totalCount int
-	db := q.getDB()
+	db := q.getReadDB()
 	err := db.QueryRow(countQuery, args...).Scan(&totalCount)
 	if err != nil {
 		return nil, 0, err
@@ -0,0 +1,107 @@
+package queries
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+const auditSinkColumns = `id, organization_id, name, type, config, enabled, created_by, created_at, updated_at`
+
+func (q *auditQueries) conn() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.DB
+}
+
+func scanAuditSink(row interface{ Scan(...interface{}) error }) (*models.AuditSink, error) {
+	var sink models.AuditSink
+	var config []byte
+	var createdBy sql.NullString
+	if err := row.Scan(&sink.ID, &sink.OrganizationID, &sink.Name, &sink.Type, &config, &sink.Enabled,
+		&createdBy, &sink.CreatedAt, &sink.UpdatedAt); err != nil {
+		return nil, err
+	}
+	sink.Config = config
+	if createdBy.Valid {
+		sink.CreatedBy = &createdBy.String
+	}
+	return &sink, nil
+}
+
+func (q *auditQueries) listAuditSinks(query string, args ...interface{}) ([]models.AuditSink, error) {
+	rows, err := q.conn().QueryContext(q.ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sinks := []models.AuditSink{}
+	for rows.Next() {
+		sink, err := scanAuditSink(rows)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, *sink)
+	}
+	return sinks, rows.Err()
+}
+
+func (q *auditQueries) CreateAuditSink(sink *models.AuditSink) error {
+	query := `
+		INSERT INTO audit_sinks (organization_id, name, type, config, enabled, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, updated_at`
+	return q.conn().QueryRowContext(q.ctx, query,
+		sink.OrganizationID, sink.Name, sink.Type, string(sink.Config), sink.Enabled, sink.CreatedBy,
+	).Scan(&sink.ID, &sink.CreatedAt, &sink.UpdatedAt)
+}
+
+func (q *auditQueries) ListAuditSinks(organizationID string) ([]models.AuditSink, error) {
+	return q.listAuditSinks(`SELECT `+auditSinkColumns+` FROM audit_sinks WHERE organization_id = $1 ORDER BY name`, organizationID)
+}
+
+// ListEnabledAuditSinks returns the enabled sinks of every organization,
+// for the exporters
+func (q *auditQueries) ListEnabledAuditSinks() ([]models.AuditSink, error) {
+	return q.listAuditSinks(`
+		SELECT ` + auditSinkColumns + ` FROM audit_sinks
+		WHERE enabled AND organization_id IN (SELECT id FROM organizations WHERE deleted_at IS NULL)`)
+}
+
+func (q *auditQueries) GetAuditSink(id, organizationID string) (*models.AuditSink, error) {
+	row := q.conn().QueryRowContext(q.ctx,
+		`SELECT `+auditSinkColumns+` FROM audit_sinks WHERE id = $1 AND organization_id = $2`, id, organizationID)
+	sink, err := scanAuditSink(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("audit sink not found")
+	}
+	return sink, err
+}
+
+func (q *auditQueries) UpdateAuditSink(sink *models.AuditSink) error {
+	query := `
+		UPDATE audit_sinks SET name = $3, config = $4, enabled = $5, updated_at = NOW()
+		WHERE id = $1 AND organization_id = $2
+		RETURNING updated_at`
+	err := q.conn().QueryRowContext(q.ctx, query,
+		sink.ID, sink.OrganizationID, sink.Name, string(sink.Config), sink.Enabled,
+	).Scan(&sink.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("audit sink not found")
+	}
+	return err
+}
+
+func (q *auditQueries) DeleteAuditSink(id, organizationID string) error {
+	result, err := q.conn().ExecContext(q.ctx, `DELETE FROM audit_sinks WHERE id = $1 AND organization_id = $2`, id, organizationID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("audit sink not found")
+	}
+	return nil
+}
@@ -21,15 +21,18 @@ type AuthQueries interface {
 	// User management
 	GetUserByEmail(email string, organizationID string) (*models.User, error)
 	GetUserByID(id string, organizationID string) (*models.User, error)
+	IsUserDeleted(id string) (bool, error)
+	IsEmailDeleted(email string) (bool, error)
 	CreateUser(user *models.User) error
 	CreateAdminUser(user *models.User) error
 	CheckAdminExists() (bool, error)
 	UpdateUser(user *models.User, organizationID string) error
 	UpdateLastLogin(userID string, organizationID string) error
 	UpdatePassword(userID, passwordHash string, organizationID string) error
+	RehashPassword(userID, organizationID, oldHash, newHash string) error
 	UpdateEmailVerification(userID string, verified bool, organizationID string) error
 	GetPrimaryRoleForUser(userID string, organizationID string) (string, error)
-	EnableMFA(userID, organizationID string, secret string, backupCodes []string) error
+	EnableMFA(userID, organizationID, method, secret, phone string, backupCodes []string) error
 	DisableMFA(userID, organizationID string) error
 
 	// Session management
@@ -45,6 +48,7 @@ type AuthQueries interface {
 	SetEmailVerificationToken(userID, token string, expiry time.Duration) error
 	GetEmailVerificationToken(token string) (string, error)
 	DeleteEmailVerificationToken(token string) error
+	IsTokenRevoked(jti string) (bool, error)
 
 	// MFA
 	UpdateBackupCodes(userID, organizationID string, codes []string) error
@@ -53,7 +57,7 @@ type AuthQueries interface {
 // authQueries implements AuthQueries
 type authQueries struct {
 	db    *database.DB
-	redis *redis.Client
+	redis redis.UniversalClient
 	tx    *sql.Tx
 	ctx   context.Context
 }
@@ -62,7 +66,7 @@ type authQueries struct {
 var ErrOrganizationNotFound = errors.New("organization not found")
 
 // NewAuthQueries creates a new AuthQueries instance
-func NewAuthQueries(db *database.DB, redis *redis.Client) AuthQueries {
+func NewAuthQueries(db *database.DB, redis redis.UniversalClient) AuthQueries {
 	return &authQueries{
 		db:    db,
 		redis: redis,
@@ -118,8 +122,8 @@ func (q *authQueries) query(query string, args ...interface{}) (*sql.Rows, error
 func (q *authQueries) GetUserByEmail(email string, organizationID string) (*models.User, error) {
 	query := `
 		SELECT id, username, email, COALESCE(display_name, ''), organization_id, COALESCE(password_hash, ''), 
-		       status, email_verified, mfa_enabled, mfa_methods, COALESCE(totp_secret, ''), mfa_backup_codes,
-		       created_at, updated_at, last_login
+		       status, email_verified, mfa_enabled, ARRAY(SELECT jsonb_array_elements_text(mfa_methods)),
+		       COALESCE(totp_secret, ''), COALESCE(mfa_phone, ''), mfa_backup_codes, created_at, updated_at, last_login
 		FROM users WHERE email = $1 AND deleted_at IS NULL`
 	args := []interface{}{email}
 	if organizationID != "" {
@@ -133,13 +137,16 @@ func (q *authQueries) GetUserByEmail(email string, organizationID string) (*mode
 		&user.ID, &user.Username, &user.Email, &user.DisplayName,
 		&user.OrganizationID, &user.PasswordHash, &user.Status,
 		&user.EmailVerified, &user.MFAEnabled, (*database.StringArray)(&user.MFAMethods),
-		&user.TOTPSecret, (*database.StringArray)(&user.MFABackupCodes),
+		&user.TOTPSecret, &user.MFAPhone, (*database.StringArray)(&user.MFABackupCodes),
 		&user.CreatedAt, &user.UpdatedAt, &user.LastLogin,
 	)
 
 	if err != nil {
 		return nil, err
 	}
+	if err := openUserSecrets(q.db, &user); err != nil {
+		return nil, err
+	}
 
 	return &user, nil
 }
@@ -148,8 +155,8 @@ func (q *authQueries) GetUserByEmail(email string, organizationID string) (*mode
 func (q *authQueries) GetUserByID(id string, organizationID string) (*models.User, error) {
 	query := `
 		SELECT id, username, email, COALESCE(display_name, ''), organization_id, COALESCE(password_hash, ''), 
-		       status, email_verified, mfa_enabled, mfa_methods, COALESCE(totp_secret, ''), mfa_backup_codes,
-		       created_at, updated_at, last_login
+		       status, email_verified, mfa_enabled, ARRAY(SELECT jsonb_array_elements_text(mfa_methods)),
+		       COALESCE(totp_secret, ''), COALESCE(mfa_phone, ''), mfa_backup_codes, created_at, updated_at, last_login
 		FROM users WHERE id = $1 AND deleted_at IS NULL`
 	args := []interface{}{id}
 	if organizationID != "" {
@@ -162,17 +169,39 @@ func (q *authQueries) GetUserByID(id string, organizationID string) (*models.Use
 		&user.ID, &user.Username, &user.Email, &user.DisplayName,
 		&user.OrganizationID, &user.PasswordHash, &user.Status,
 		&user.EmailVerified, &user.MFAEnabled, (*database.StringArray)(&user.MFAMethods),
-		&user.TOTPSecret, (*database.StringArray)(&user.MFABackupCodes),
+		&user.TOTPSecret, &user.MFAPhone, (*database.StringArray)(&user.MFABackupCodes),
 		&user.CreatedAt, &user.UpdatedAt, &user.LastLogin,
 	)
 
 	if err != nil {
 		return nil, err
 	}
+	if err := openUserSecrets(q.db, &user); err != nil {
+		return nil, err
+	}
 
 	return &user, nil
 }
 
+// IsUserDeleted reports whether the user ID belongs to a soft-deleted account
+// that has not yet been purged. Used to give clear auth errors.
+func (q *authQueries) IsUserDeleted(id string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE id = $1 AND status = 'deleted' AND purged_at IS NULL)`
+	var deleted bool
+	err := q.queryRow(query, id).Scan(&deleted)
+	return deleted, err
+}
+
+// IsEmailDeleted reports whether the email only belongs to soft-deleted
+// accounts that have not yet been purged.
+func (q *authQueries) IsEmailDeleted(email string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE email = $1 AND status = 'deleted' AND purged_at IS NULL)
+		AND NOT EXISTS(SELECT 1 FROM users WHERE email = $1 AND status != 'deleted')`
+	var deleted bool
+	err := q.queryRow(query, email).Scan(&deleted)
+	return deleted, err
+}
+
 // CreateUser creates a new user in the database
 func (q *authQueries) CreateUser(user *models.User) error {
 	query := `
@@ -397,6 +426,14 @@ func (q *authQueries) organizationExists(tx *sql.Tx, organizationID string) (boo
 	return exists, err
 }
 
+// PrimaryRoleCacheKey is the Redis key under which a user's primary role is
+// cached. Changes to role assignments and to roles delete it once committed.
+func PrimaryRoleCacheKey(organizationID, userID string) string {
+	return "primary_role:" + organizationID + ":" + userID
+}
+
+// GetPrimaryRoleForUser returns the name of the user's oldest active,
+// unexpired role in the organization, or "" when none is assigned
 func (q *authQueries) GetPrimaryRoleForUser(userID string, organizationID string) (string, error) {
 	query := `
 		SELECT r.name
@@ -405,7 +442,9 @@ func (q *authQueries) GetPrimaryRoleForUser(userID string, organizationID string
 		WHERE ra.principal_id = $1
 		  AND ra.principal_type = 'user'
 		  AND r.organization_id = $2
-		ORDER BY r.created_at ASC
+		  AND r.status = 'active'
+		  AND (ra.expires_at IS NULL OR ra.expires_at > NOW())
+		ORDER BY r.created_at ASC, r.name ASC
 		LIMIT 1
 	`
 
@@ -464,9 +503,10 @@ func (q *authQueries) UpdateUser(user *models.User, organizationID string) error
 	return err
 }
 
-// UpdateLastLogin updates the last login timestamp for a user
+// UpdateLastLogin updates the last login timestamp for a user, who is then
+// no longer dormant
 func (q *authQueries) UpdateLastLogin(userID string, organizationID string) error {
-	query := `UPDATE users SET last_login = $1 WHERE id = $2 AND organization_id = $3`
+	query := `UPDATE users SET last_login = $1, dormant_since = NULL WHERE id = $2 AND organization_id = $3`
 	_, err := q.exec(query, time.Now(), userID, organizationID)
 	return err
 }
@@ -485,6 +525,16 @@ func (q *authQueries) UpdatePassword(userID, passwordHash string, organizationID
 	return err
 }
 
+// RehashPassword replaces a password hash with a hash of the same password
+// using the current algorithm. Unlike UpdatePassword it leaves
+// password_changed_at alone, and it does nothing when the password was
+// changed since oldHash was read.
+func (q *authQueries) RehashPassword(userID, organizationID, oldHash, newHash string) error {
+	query := `UPDATE users SET password_hash = $1 WHERE id = $2 AND organization_id = $3 AND password_hash = $4`
+	_, err := q.exec(query, newHash, userID, organizationID, oldHash)
+	return err
+}
+
 // UpdateEmailVerification updates a user's email verification status
 func (q *authQueries) UpdateEmailVerification(userID string, verified bool, organizationID string) error {
 	if organizationID != "" {
@@ -498,17 +548,27 @@ func (q *authQueries) UpdateEmailVerification(userID string, verified bool, orga
 	return err
 }
 
-func (q *authQueries) EnableMFA(userID, organizationID string, secret string, backupCodes []string) error {
+// EnableMFA enrolls the user in MFA with a single method. secret is the TOTP
+// secret and phone the SMS number; each is only set for its method.
+func (q *authQueries) EnableMFA(userID, organizationID, method, secret, phone string, backupCodes []string) error {
 	query := `
 		UPDATE users 
 		SET mfa_enabled = TRUE, 
-		    mfa_methods = ARRAY['totp']::mfa_method[], 
-		    totp_secret = $1, 
-		    mfa_backup_codes = $2,
-		    updated_at = $3
-		WHERE id = $4 AND organization_id = $5
+		    mfa_methods = jsonb_build_array($1::text), 
+		    totp_secret = NULLIF($2, ''), 
+		    mfa_phone = NULLIF($3, ''),
+		    mfa_backup_codes = $4,
+		    updated_at = $5
+		WHERE id = $6 AND organization_id = $7
 	`
-	_, err := q.exec(query, secret, database.StringArray(backupCodes), time.Now(), userID, organizationID)
+	secret, err := q.db.EncryptField(secret, totpSecretAAD(userID))
+	if err != nil {
+		return err
+	}
+	if backupCodes, err = sealBackupCodes(q.db, userID, backupCodes); err != nil {
+		return err
+	}
+	_, err = q.exec(query, method, secret, phone, database.StringArray(backupCodes), time.Now(), userID, organizationID)
 	return err
 }
 
@@ -516,8 +576,9 @@ func (q *authQueries) DisableMFA(userID, organizationID string) error {
 	query := `
 		UPDATE users 
 		SET mfa_enabled = FALSE, 
-		    mfa_methods = '{}', 
+		    mfa_methods = '[]', 
 		    totp_secret = NULL, 
+		    mfa_phone = NULL,
 		    mfa_backup_codes = NULL,
 		    updated_at = $1
 		WHERE id = $2 AND organization_id = $3
@@ -533,7 +594,11 @@ func (q *authQueries) UpdateBackupCodes(userID, organizationID string, codes []s
 		    updated_at = $2
 		WHERE id = $3 AND organization_id = $4
 	`
-	_, err := q.exec(query, database.StringArray(codes), time.Now(), userID, organizationID)
+	codes, err := sealBackupCodes(q.db, userID, codes)
+	if err != nil {
+		return err
+	}
+	_, err = q.exec(query, database.StringArray(codes), time.Now(), userID, organizationID)
 	return err
 }
 
@@ -570,6 +635,12 @@ func (q *authQueries) DeleteSession(sessionID string) error {
 	return q.redis.Del(q.ctx, sessionKey).Err()
 }
 
+// IsTokenRevoked reports whether a token's jti is on the revocation blacklist
+func (q *authQueries) IsTokenRevoked(jti string) (bool, error) {
+	n, err := q.redis.Exists(q.ctx, "blacklist:"+jti).Result()
+	return n > 0, err
+}
+
 // InvalidateUserSessions removes all sessions for a user
 func (q *authQueries) InvalidateUserSessions(userID string) error {
 	pattern := "session:*"
@@ -0,0 +1,211 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/database"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// AuthzDecisionQueries stores sampled authorization decisions
+type AuthzDecisionQueries interface {
+	WithTx(tx *sql.Tx) AuthzDecisionQueries
+	WithContext(ctx context.Context) AuthzDecisionQueries
+
+	LogDecision(d *models.AuthzDecision) error
+	ListDecisions(params ListAuthzDecisionsParams) ([]models.AuthzDecision, int, error)
+	GetDecision(id, organizationID string) (*models.AuthzDecision, error)
+	PurgeDecisions(before time.Time) (int64, error)
+	PolicyMatchCounts(organizationID string, since time.Time) (int, map[string]int, error)
+}
+
+// ListAuthzDecisionsParams filters ListDecisions
+type ListAuthzDecisionsParams struct {
+	OrganizationID string
+	PrincipalID    string
+	Action         string
+	Decision       string
+	StartTime      *time.Time
+	EndTime        *time.Time
+	Limit          int
+	Offset         int
+}
+
+type authzDecisionQueries struct {
+	db    *database.DB
+	redis redis.UniversalClient
+	tx    *sql.Tx
+	ctx   context.Context
+}
+
+func NewAuthzDecisionQueries(db *database.DB, redis redis.UniversalClient) AuthzDecisionQueries {
+	return &authzDecisionQueries{db: db, redis: redis, ctx: context.Background()}
+}
+
+func (q *authzDecisionQueries) WithTx(tx *sql.Tx) AuthzDecisionQueries {
+	return &authzDecisionQueries{db: q.db, redis: q.redis, tx: tx, ctx: q.ctx}
+}
+
+func (q *authzDecisionQueries) WithContext(ctx context.Context) AuthzDecisionQueries {
+	return &authzDecisionQueries{db: q.db, redis: q.redis, tx: q.tx, ctx: ctx}
+}
+
+func (q *authzDecisionQueries) conn() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.DB
+}
+
+// reader returns the connection for reads that tolerate replication lag:
+// the transaction if there is one, otherwise a replica
+func (q *authzDecisionQueries) reader() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.Reader()
+}
+
+func (q *authzDecisionQueries) LogDecision(d *models.AuthzDecision) error {
+	trace := d.Trace
+	if len(trace) == 0 {
+		trace = []byte("{}")
+	}
+	query := `
+		INSERT INTO authz_decisions (organization_id, principal_id, principal_type, action, resource, decision, reason, trace)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at`
+	return q.conn().QueryRowContext(q.ctx, query,
+		d.OrganizationID, d.PrincipalID, d.PrincipalType, d.Action, d.Resource, d.Decision, d.Reason, string(trace),
+	).Scan(&d.ID, &d.CreatedAt)
+}
+
+func (q *authzDecisionQueries) ListDecisions(params ListAuthzDecisionsParams) ([]models.AuthzDecision, int, error) {
+	where := []string{"organization_id = $1"}
+	args := []interface{}{params.OrganizationID}
+	add := func(cond string, v interface{}) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if params.PrincipalID != "" {
+		add("principal_id = $%d", params.PrincipalID)
+	}
+	if params.Action != "" {
+		add("action = $%d", params.Action)
+	}
+	if params.Decision != "" {
+		add("decision = $%d", params.Decision)
+	}
+	if params.StartTime != nil {
+		add("created_at >= $%d", *params.StartTime)
+	}
+	if params.EndTime != nil {
+		add("created_at < $%d", *params.EndTime)
+	}
+	whereClause := strings.Join(where, " AND ")
+
+	var total int
+	if err := q.reader().QueryRowContext(q.ctx, "SELECT COUNT(*) FROM authz_decisions WHERE "+whereClause, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	if params.Limit <= 0 {
+		params.Limit = 50
+	}
+	if params.Offset < 0 {
+		params.Offset = 0
+	}
+	query := fmt.Sprintf(`
+		SELECT id, organization_id, principal_id, principal_type, action, resource, decision, reason, trace, created_at
+		FROM authz_decisions
+		WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d OFFSET $%d`, whereClause, len(args)+1, len(args)+2)
+	args = append(args, params.Limit, params.Offset)
+
+	rows, err := q.reader().QueryContext(q.ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	decisions := []models.AuthzDecision{}
+	for rows.Next() {
+		d, err := scanAuthzDecision(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		decisions = append(decisions, *d)
+	}
+	return decisions, total, rows.Err()
+}
+
+func (q *authzDecisionQueries) GetDecision(id, organizationID string) (*models.AuthzDecision, error) {
+	row := q.conn().QueryRowContext(q.ctx, `
+		SELECT id, organization_id, principal_id, principal_type, action, resource, decision, reason, trace, created_at
+		FROM authz_decisions
+		WHERE id = $1 AND organization_id = $2`, id, organizationID)
+	d, err := scanAuthzDecision(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("decision not found")
+	}
+	return d, err
+}
+
+// PurgeDecisions deletes decisions recorded before the cutoff
+func (q *authzDecisionQueries) PurgeDecisions(before time.Time) (int64, error) {
+	res, err := q.conn().ExecContext(q.ctx, `DELETE FROM authz_decisions WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// PolicyMatchCounts returns how many decisions were recorded since the given
+// time and, per policy ID, how many of them the policy allowed or denied
+func (q *authzDecisionQueries) PolicyMatchCounts(organizationID string, since time.Time) (int, map[string]int, error) {
+	var total int
+	if err := q.reader().QueryRowContext(q.ctx,
+		`SELECT COUNT(*) FROM authz_decisions WHERE organization_id = $1 AND created_at >= $2`,
+		organizationID, since).Scan(&total); err != nil {
+		return 0, nil, err
+	}
+
+	rows, err := q.reader().QueryContext(q.ctx, `
+		SELECT step->>'id', COUNT(*)
+		FROM authz_decisions d, jsonb_array_elements(d.trace->'steps') AS step
+		WHERE d.organization_id = $1 AND d.created_at >= $2
+		  AND step->>'source' = 'policy' AND step->>'id' IS NOT NULL AND step->>'effect' IN ('allow', 'deny')
+		GROUP BY step->>'id'`, organizationID, since)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	matches := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return 0, nil, err
+		}
+		matches[id] = n
+	}
+	return total, matches, rows.Err()
+}
+
+func scanAuthzDecision(row interface{ Scan(...interface{}) error }) (*models.AuthzDecision, error) {
+	var d models.AuthzDecision
+	var trace []byte
+	if err := row.Scan(&d.ID, &d.OrganizationID, &d.PrincipalID, &d.PrincipalType, &d.Action, &d.Resource,
+		&d.Decision, &d.Reason, &trace, &d.CreatedAt); err != nil {
+		return nil, err
+	}
+	d.Trace = trace
+	return &d, nil
+}
@@ -0,0 +1,138 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/database"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// ClaimsWebhookQueries stores organizations' external claims providers and
+// caches their answers
+type ClaimsWebhookQueries interface {
+	WithTx(tx *sql.Tx) ClaimsWebhookQueries
+	WithContext(ctx context.Context) ClaimsWebhookQueries
+
+	// GetWebhook returns the claims webhook of an organization, or nil when
+	// it has none
+	GetWebhook(organizationID string) (*models.ClaimsWebhook, error)
+	// PutWebhook creates or replaces the claims webhook of an organization
+	PutWebhook(hook *models.ClaimsWebhook) error
+	// DeleteWebhook removes the claims webhook of an organization
+	DeleteWebhook(organizationID string) error
+	// RecordFailure keeps the last error of a webhook call for admins
+	RecordFailure(organizationID, message string) error
+
+	// GetCachedClaims returns a cached webhook answer, or nil
+	GetCachedClaims(organizationID, key string) ([]byte, error)
+	// CacheClaims keeps a webhook answer for ttl
+	CacheClaims(organizationID, key string, answer []byte, ttl time.Duration) error
+}
+
+type claimsWebhookQueries struct {
+	db    *database.DB
+	redis redis.UniversalClient
+	tx    *sql.Tx
+	ctx   context.Context
+}
+
+// NewClaimsWebhookQueries creates a new ClaimsWebhookQueries instance
+func NewClaimsWebhookQueries(db *database.DB, redis redis.UniversalClient) ClaimsWebhookQueries {
+	return &claimsWebhookQueries{db: db, redis: redis, ctx: context.Background()}
+}
+
+func (q *claimsWebhookQueries) WithTx(tx *sql.Tx) ClaimsWebhookQueries {
+	return &claimsWebhookQueries{db: q.db, redis: q.redis, tx: tx, ctx: q.ctx}
+}
+
+func (q *claimsWebhookQueries) WithContext(ctx context.Context) ClaimsWebhookQueries {
+	return &claimsWebhookQueries{db: q.db, redis: q.redis, tx: q.tx, ctx: ctx}
+}
+
+func (q *claimsWebhookQueries) conn() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.DB
+}
+
+func (q *claimsWebhookQueries) GetWebhook(organizationID string) (*models.ClaimsWebhook, error) {
+	var hook models.ClaimsWebhook
+	err := q.conn().QueryRowContext(q.ctx, `
+		SELECT organization_id, url, secret, namespace, timeout_ms, cache_seconds, fail_closed, enabled,
+		       last_error, last_failure_at, created_by, created_at, updated_at
+		FROM claims_webhooks
+		WHERE organization_id = $1`, organizationID,
+	).Scan(&hook.OrganizationID, &hook.URL, &hook.Secret, &hook.Namespace, &hook.TimeoutMS, &hook.CacheSeconds,
+		&hook.FailClosed, &hook.Enabled, &hook.LastError, &hook.LastFailureAt, &hook.CreatedBy, &hook.CreatedAt, &hook.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get claims webhook: %w", err)
+	}
+	return &hook, nil
+}
+
+func (q *claimsWebhookQueries) PutWebhook(hook *models.ClaimsWebhook) error {
+	// A changed configuration starts over without the last error
+	err := q.conn().QueryRowContext(q.ctx, `
+		INSERT INTO claims_webhooks (organization_id, url, secret, namespace, timeout_ms, cache_seconds, fail_closed, enabled, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (organization_id) DO UPDATE SET
+			url = EXCLUDED.url, secret = EXCLUDED.secret, namespace = EXCLUDED.namespace,
+			timeout_ms = EXCLUDED.timeout_ms, cache_seconds = EXCLUDED.cache_seconds,
+			fail_closed = EXCLUDED.fail_closed, enabled = EXCLUDED.enabled,
+			last_error = NULL, last_failure_at = NULL, updated_at = NOW()
+		WHERE claims_webhooks.organization_id = $1
+		RETURNING created_by, created_at, updated_at`,
+		hook.OrganizationID, hook.URL, hook.Secret, hook.Namespace, hook.TimeoutMS, hook.CacheSeconds,
+		hook.FailClosed, hook.Enabled, hook.CreatedBy,
+	).Scan(&hook.CreatedBy, &hook.CreatedAt, &hook.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save claims webhook: %w", err)
+	}
+	hook.LastError, hook.LastFailureAt = nil, nil
+	return nil
+}
+
+func (q *claimsWebhookQueries) DeleteWebhook(organizationID string) error {
+	res, err := q.conn().ExecContext(q.ctx, `DELETE FROM claims_webhooks WHERE organization_id = $1`, organizationID)
+	if err != nil {
+		return fmt.Errorf("failed to delete claims webhook: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("claims webhook not found")
+	}
+	return nil
+}
+
+func (q *claimsWebhookQueries) RecordFailure(organizationID, message string) error {
+	_, err := q.conn().ExecContext(q.ctx, `
+		UPDATE claims_webhooks SET last_error = $2, last_failure_at = NOW()
+		WHERE organization_id = $1`, organizationID, message)
+	return err
+}
+
+func claimsCacheKey(organizationID, key string) string {
+	return "claims_webhook:" + organizationID + ":" + key
+}
+
+func (q *claimsWebhookQueries) GetCachedClaims(organizationID, key string) ([]byte, error) {
+	answer, err := q.redis.Get(q.ctx, claimsCacheKey(organizationID, key)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached claims: %w", err)
+	}
+	return answer, nil
+}
+
+func (q *claimsWebhookQueries) CacheClaims(organizationID, key string, answer []byte, ttl time.Duration) error {
+	return q.redis.Set(q.ctx, claimsCacheKey(organizationID, key), answer, ttl).Err()
+}
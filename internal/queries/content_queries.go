@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/redis/go-redis/v9"
 	"github.com/the-monkeys/monkeys-identity/internal/database"
 	"github.com/the-monkeys/monkeys-identity/internal/models"
@@ -26,6 +27,7 @@ type ContentQueries interface {
 	CreateContent(item *models.ContentItem) error
 	GetContent(id, organizationID string) (*models.ContentItem, error)
 	ListContent(params ListParams, organizationID, userID, contentType string) (*ListResult[*models.ContentItem], error)
+	ListPublishedByOwner(params ListParams, organizationID, ownerID, contentType string) (*ListResult[*models.ContentItem], error)
 	UpdateContent(item *models.ContentItem, organizationID string) error
 	DeleteContent(id, organizationID string) error
 
@@ -33,22 +35,71 @@ type ContentQueries interface {
 	UpdateContentStatus(id, organizationID, status string) error
 
 	// Collaborator management
-	AddCollaborator(contentID, userID, role, invitedBy string) error
-	RemoveCollaborator(contentID, userID string) error
-	ListCollaborators(contentID string) ([]models.ContentCollaboratorWithUser, error)
-	GetCollaboratorRole(contentID, userID string) (string, error)
+	AddCollaborator(contentID, userID, role, invitedBy, organizationID string, expiresAt *time.Time) error
+	RemoveCollaborator(contentID, userID, organizationID string) error
+	ListCollaborators(contentID, organizationID string) ([]models.ContentCollaboratorWithUser, error)
+	GetCollaboratorRole(contentID, userID, organizationID string) (string, error)
+	ClaimExpiringCollaborators(before time.Time, limit int) ([]models.ExpiringShare, error)
+	DeleteExpiredCollaborators() (int64, error)
+
+	// Ownership transfer
+	TransferOwnership(contentID, newOwnerID, transferredBy, organizationID string) (string, error)
+	TransferAllOwnership(fromUserID, toUserID, transferredBy, organizationID string) (int, error)
+
+	// Collaborator invitations by email
+	CreateInvitation(inv *models.ContentInvitation) error
+	GetInvitation(id, organizationID string) (*models.ContentInvitation, error)
+	ListInvitations(contentID, organizationID string) ([]models.ContentInvitation, error)
+	RevokeInvitation(id, contentID, organizationID string) error
+	AcceptInvitation(id, userID, organizationID string) (string, error)
+	AcceptInvitationsForUser(userID string) (int, error)
+
+	// Comment threads
+	CreateComment(item *models.ContentItem, moderationStatus string) error
+	GetThreadRoot(contentID, organizationID string) (*models.ContentItem, error)
+	ListComments(params ListParams, organizationID, parentID string, filter CommentFilter) (*ListResult[*models.Comment], error)
+	ListReplies(organizationID string, parentIDs []string, perParent int, filter CommentFilter) ([]*models.Comment, error)
+	ModerateComment(id, organizationID, status string) error
+
+	// Revision history
+	CreateRevision(contentID, organizationID, authorID string, restoredFrom *int) (*models.ContentRevision, error)
+	ListRevisions(params ListParams, contentID, organizationID string) (*ListResult[*models.ContentRevision], error)
+	GetRevision(contentID, organizationID string, revision int) (*models.ContentRevision, error)
+
+	// Reactions and bookmarks
+	AddReaction(contentID, userID, organizationID, reactionType string) (bool, error)
+	RemoveReaction(contentID, userID, organizationID, reactionType string) (bool, error)
+	AddBookmark(contentID, userID, organizationID string) (bool, error)
+	RemoveBookmark(contentID, userID, organizationID string) (bool, error)
+	ListBookmarks(params ListParams, userID, organizationID string) (*ListResult[*models.Bookmark], error)
+	RecountEngagement(contentID string) error
+
+	// Attachments
+	LockAttachmentUsage(organizationID string) (int64, error)
+	CreateAttachment(a *models.ContentAttachment) error
+	ListAttachments(contentID, organizationID string) ([]models.ContentAttachment, error)
+	GetAttachment(id, organizationID string) (*models.ContentAttachment, error)
+	DeleteAttachment(id, contentID, organizationID string) (string, error)
+	AttachmentSharedWith(id, principalID, principalType, organizationID string) (bool, error)
+}
+
+// CommentFilter selects the comments of a thread a reader may see
+type CommentFilter struct {
+	ViewerID         string // sees approved comments and their own in any state
+	Moderator        bool   // sees every comment
+	ModerationStatus string // optional: only comments in this state
 }
 
 // ── Implementation ─────────────────────────────────────────────────────
 
 type contentQueries struct {
 	db    *database.DB
-	redis *redis.Client
+	redis redis.UniversalClient
 	tx    *sql.Tx
 	ctx   context.Context
 }
 
-func NewContentQueries(db *database.DB, redis *redis.Client) ContentQueries {
+func NewContentQueries(db *database.DB, redis redis.UniversalClient) ContentQueries {
 	return &contentQueries{db: db, redis: redis, ctx: context.Background()}
 }
 
@@ -67,28 +118,41 @@ func (q *contentQueries) conn() DBTX {
 	return q.db.DB
 }
 
+// reader returns the connection for reads that tolerate replication lag:
+// the transaction if there is one, otherwise a replica
+func (q *contentQueries) reader() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.Reader()
+}
+
 // ── Content CRUD ───────────────────────────────────────────────────────
 
+// clientMetadata strips the engagement counts, which only RecountEngagement
+// writes, from metadata given by a client
+const clientMetadata = `(%s::jsonb - 'reactions' - 'bookmarks')`
+
 func (q *contentQueries) CreateContent(item *models.ContentItem) error {
 	query := `
 		INSERT INTO content_items (id, content_type, title, slug, body, summary, cover_image_url,
 		                           parent_id, owner_id, organization_id, status, tags, metadata,
 		                           created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NOW(), NOW())
-		RETURNING id, created_at, updated_at`
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, ` + fmt.Sprintf(clientMetadata, "$13") + `, NOW(), NOW())
+		RETURNING id, metadata, lock_version, created_at, updated_at`
 
 	return q.conn().QueryRowContext(q.ctx, query,
 		item.ID, item.ContentType, item.Title, item.Slug, item.Body, item.Summary,
 		item.CoverImageURL, item.ParentID, item.OwnerID, item.OrganizationID,
 		item.Status, item.Tags, item.Metadata,
-	).Scan(&item.ID, &item.CreatedAt, &item.UpdatedAt)
+	).Scan(&item.ID, &item.Metadata, &item.LockVersion, &item.CreatedAt, &item.UpdatedAt)
 }
 
 func (q *contentQueries) GetContent(id, organizationID string) (*models.ContentItem, error) {
 	query := `
 		SELECT id, content_type, title, slug, body, summary, cover_image_url,
 		       parent_id, owner_id, organization_id, status, tags, metadata,
-		       published_at, created_at, updated_at
+		       lock_version, published_at, created_at, updated_at
 		FROM content_items
 		WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL`
 
@@ -96,7 +160,7 @@ func (q *contentQueries) GetContent(id, organizationID string) (*models.ContentI
 	err := q.conn().QueryRowContext(q.ctx, query, id, organizationID).Scan(
 		&c.ID, &c.ContentType, &c.Title, &c.Slug, &c.Body, &c.Summary, &c.CoverImageURL,
 		&c.ParentID, &c.OwnerID, &c.OrganizationID, &c.Status, &c.Tags, &c.Metadata,
-		&c.PublishedAt, &c.CreatedAt, &c.UpdatedAt,
+		&c.LockVersion, &c.PublishedAt, &c.CreatedAt, &c.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("content not found")
@@ -110,15 +174,33 @@ func (q *contentQueries) ListContent(params ListParams, organizationID, userID,
 	where := `c.organization_id = $1 AND c.deleted_at IS NULL
 	           AND (c.owner_id = $2 OR EXISTS (
 	               SELECT 1 FROM content_collaborators cc WHERE cc.content_id = c.id AND cc.user_id = $2
+	                 AND (cc.expires_at IS NULL OR cc.expires_at > NOW())
 	           ))`
 	if contentType != "" {
 		args = append(args, contentType)
 		where += fmt.Sprintf(` AND c.content_type = $%d`, len(args))
 	}
+	return q.listContent(params, where, args)
+}
 
+// ListPublishedByOwner lists the published content of one author, e.g. for
+// their public profile
+func (q *contentQueries) ListPublishedByOwner(params ListParams, organizationID, ownerID, contentType string) (*ListResult[*models.ContentItem], error) {
+	args := []interface{}{organizationID, ownerID}
+	where := `c.organization_id = $1 AND c.deleted_at IS NULL AND c.owner_id = $2 AND c.status = 'published'`
+	if contentType != "" {
+		args = append(args, contentType)
+		where += fmt.Sprintf(` AND c.content_type = $%d`, len(args))
+	}
+	return q.listContent(params, where, args)
+}
+
+// listContent runs a paginated content listing filtered by where, whose
+// placeholders are bound to args
+func (q *contentQueries) listContent(params ListParams, where string, args []interface{}) (*ListResult[*models.ContentItem], error) {
 	countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM content_items c WHERE %s`, where)
 	var total int64
-	if err := q.conn().QueryRowContext(q.ctx, countQuery, args...).Scan(&total); err != nil {
+	if err := q.reader().QueryRowContext(q.ctx, countQuery, args...).Scan(&total); err != nil {
 		return nil, fmt.Errorf("count content: %w", err)
 	}
 
@@ -127,11 +209,11 @@ func (q *contentQueries) ListContent(params ListParams, organizationID, userID,
 		limit = 20
 	}
 	offset := params.Offset
-	sortBy := "c.updated_at"
+	sortBy := "updated_at"
 	if params.SortBy != "" {
 		allowed := map[string]bool{"title": true, "status": true, "created_at": true, "updated_at": true, "content_type": true}
 		if allowed[params.SortBy] {
-			sortBy = "c." + params.SortBy
+			sortBy = params.SortBy
 		}
 	}
 	order := "DESC"
@@ -139,21 +221,30 @@ func (q *contentQueries) ListContent(params ListParams, organizationID, userID,
 		order = "ASC"
 	}
 
+	ks, err := newKeyset(params, sortBy, "c."+sortBy, "c.id", order)
+	if err != nil {
+		return nil, err
+	}
+	if clause, cursorArgs := ks.where(len(args) + 1); clause != "" {
+		where += " AND " + clause
+		args = append(args, cursorArgs...)
+	}
+
 	// Append limit/offset placeholders
 	limitIdx := len(args) + 1
 	offsetIdx := len(args) + 2
-	args = append(args, limit, offset)
+	args = append(args, ks.limit(limit), ks.offset(offset))
 
 	query := fmt.Sprintf(`
 		SELECT c.id, c.content_type, c.title, c.slug, c.body, c.summary, c.cover_image_url,
 		       c.parent_id, c.owner_id, c.organization_id, c.status, c.tags, c.metadata,
-		       c.published_at, c.created_at, c.updated_at
+		       c.lock_version, c.published_at, c.created_at, c.updated_at
 		FROM content_items c
 		WHERE %s
-		ORDER BY %s %s
-		LIMIT $%d OFFSET $%d`, where, sortBy, order, limitIdx, offsetIdx)
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, where, ks.orderBy(), limitIdx, offsetIdx)
 
-	rows, err := q.conn().QueryContext(q.ctx, query, args...)
+	rows, err := q.reader().QueryContext(q.ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("list content: %w", err)
 	}
@@ -165,7 +256,7 @@ func (q *contentQueries) ListContent(params ListParams, organizationID, userID,
 		if err := rows.Scan(
 			&ci.ID, &ci.ContentType, &ci.Title, &ci.Slug, &ci.Body, &ci.Summary, &ci.CoverImageURL,
 			&ci.ParentID, &ci.OwnerID, &ci.OrganizationID, &ci.Status, &ci.Tags, &ci.Metadata,
-			&ci.PublishedAt, &ci.CreatedAt, &ci.UpdatedAt,
+			&ci.LockVersion, &ci.PublishedAt, &ci.CreatedAt, &ci.UpdatedAt,
 		); err != nil {
 			return nil, fmt.Errorf("scan content: %w", err)
 		}
@@ -177,36 +268,73 @@ func (q *contentQueries) ListContent(params ListParams, organizationID, userID,
 		totalPages = int((total + int64(limit) - 1) / int64(limit))
 	}
 
+	items, hasMore, nextCursor := page(ks, items, limit, func(ci *models.ContentItem) (string, string) {
+		switch sortBy {
+		case "title":
+			return ci.Title, ci.ID
+		case "status":
+			return ci.Status, ci.ID
+		case "content_type":
+			return ci.ContentType, ci.ID
+		case "created_at":
+			return cursorTime(ci.CreatedAt), ci.ID
+		}
+		return cursorTime(ci.UpdatedAt), ci.ID
+	})
+
 	return &ListResult[*models.ContentItem]{
 		Items:      items,
 		Total:      total,
 		Limit:      limit,
-		Offset:     offset,
-		HasMore:    int64(offset+limit) < total,
+		Offset:     ks.offset(offset),
+		HasMore:    hasMore,
 		TotalPages: totalPages,
+		NextCursor: nextCursor,
 	}, nil
 }
 
+// UpdateContent saves the editable fields of an item. The engagement counts
+// in metadata are kept as stored whatever metadata the item carries. The
+// update is made against item.LockVersion, the version the caller read
+// (0 for any), and fails with a StaleVersionError if the item changed since.
 func (q *contentQueries) UpdateContent(item *models.ContentItem, organizationID string) error {
 	query := `
 		UPDATE content_items
 		SET title = $1, slug = $2, body = $3, summary = $4, cover_image_url = $5,
-		    tags = $6, metadata = $7, updated_at = NOW()
-		WHERE id = $8 AND organization_id = $9 AND deleted_at IS NULL`
+		    tags = $6, updated_at = NOW(), lock_version = lock_version + 1,
+		    metadata = ` + fmt.Sprintf(clientMetadata, "$7") + ` || jsonb_strip_nulls(jsonb_build_object(
+		        'reactions', metadata->'reactions', 'bookmarks', metadata->'bookmarks'))
+		WHERE id = $8 AND organization_id = $9 AND deleted_at IS NULL AND ($10 = 0 OR lock_version = $10)
+		RETURNING metadata, lock_version, updated_at`
 
-	res, err := q.conn().ExecContext(q.ctx, query,
+	err := q.conn().QueryRowContext(q.ctx, query,
 		item.Title, item.Slug, item.Body, item.Summary, item.CoverImageURL,
 		item.Tags, item.Metadata,
-		item.ID, organizationID,
-	)
+		item.ID, organizationID, item.LockVersion,
+	).Scan(&item.Metadata, &item.LockVersion, &item.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return q.staleOrMissing(item.ID, organizationID)
+	}
 	if err != nil {
 		return fmt.Errorf("update content: %w", err)
 	}
-	n, _ := res.RowsAffected()
-	if n == 0 {
+	return nil
+}
+
+// staleOrMissing explains why a versioned update matched no row
+func (q *contentQueries) staleOrMissing(id, organizationID string) error {
+	var current int
+	err := q.conn().QueryRowContext(q.ctx,
+		`SELECT lock_version FROM content_items WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL`,
+		id, organizationID,
+	).Scan(&current)
+	if err == sql.ErrNoRows {
 		return fmt.Errorf("content not found")
 	}
-	return nil
+	if err != nil {
+		return fmt.Errorf("update content: %w", err)
+	}
+	return &StaleVersionError{Current: current}
 }
 
 func (q *contentQueries) DeleteContent(id, organizationID string) error {
@@ -233,7 +361,7 @@ func (q *contentQueries) UpdateContentStatus(id, organizationID, status string)
 	}
 
 	query := fmt.Sprintf(`
-		UPDATE content_items SET status = $1, updated_at = NOW()%s
+		UPDATE content_items SET status = $1, updated_at = NOW(), lock_version = lock_version + 1%s
 		WHERE id = $2 AND organization_id = $3 AND deleted_at IS NULL`, publishedClause)
 
 	res, err := q.conn().ExecContext(q.ctx, query, args...)
@@ -249,22 +377,35 @@ func (q *contentQueries) UpdateContentStatus(id, organizationID, status string)
 
 // ── Collaborators ──────────────────────────────────────────────────────
 
-func (q *contentQueries) AddCollaborator(contentID, userID, role, invitedBy string) error {
+// AddCollaborator grants a user a role on a content item, until expiresAt
+// unless nil. Both must belong to the organization.
+func (q *contentQueries) AddCollaborator(contentID, userID, role, invitedBy, organizationID string, expiresAt *time.Time) error {
 	query := `
-		INSERT INTO content_collaborators (content_id, user_id, role, invited_by, created_at)
-		VALUES ($1, $2, $3, $4, NOW())
-		ON CONFLICT (content_id, user_id) DO UPDATE SET role = EXCLUDED.role`
+		INSERT INTO content_collaborators (content_id, user_id, role, invited_by, expires_at, created_at)
+		SELECT ci.id, u.id, $3, $4, $6, NOW()
+		FROM content_items ci
+		JOIN users u ON u.id = $2 AND u.organization_id = ci.organization_id AND u.deleted_at IS NULL
+		WHERE ci.id = $1 AND ci.organization_id = $5 AND ci.deleted_at IS NULL
+		ON CONFLICT (content_id, user_id) DO UPDATE
+		SET role = EXCLUDED.role, expires_at = EXCLUDED.expires_at, expiry_reminded_at = NULL`
 
-	_, err := q.conn().ExecContext(q.ctx, query, contentID, userID, role, invitedBy)
+	res, err := q.conn().ExecContext(q.ctx, query, contentID, userID, role, invitedBy, organizationID, expiresAt)
 	if err != nil {
 		return fmt.Errorf("add collaborator: %w", err)
 	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("content or user not found")
+	}
 	return nil
 }
 
-func (q *contentQueries) RemoveCollaborator(contentID, userID string) error {
-	query := `DELETE FROM content_collaborators WHERE content_id = $1 AND user_id = $2 AND role != 'owner'`
-	res, err := q.conn().ExecContext(q.ctx, query, contentID, userID)
+func (q *contentQueries) RemoveCollaborator(contentID, userID, organizationID string) error {
+	query := `
+		DELETE FROM content_collaborators cc
+		USING content_items ci
+		WHERE cc.content_id = ci.id AND ci.organization_id = $3
+		  AND cc.content_id = $1 AND cc.user_id = $2 AND cc.role != 'owner'`
+	res, err := q.conn().ExecContext(q.ctx, query, contentID, userID, organizationID)
 	if err != nil {
 		return fmt.Errorf("remove collaborator: %w", err)
 	}
@@ -275,16 +416,18 @@ func (q *contentQueries) RemoveCollaborator(contentID, userID string) error {
 	return nil
 }
 
-func (q *contentQueries) ListCollaborators(contentID string) ([]models.ContentCollaboratorWithUser, error) {
+func (q *contentQueries) ListCollaborators(contentID, organizationID string) ([]models.ContentCollaboratorWithUser, error) {
 	query := `
-		SELECT cc.content_id, cc.user_id, cc.role, COALESCE(cc.invited_by::text, ''), cc.created_at,
+		SELECT cc.content_id, cc.user_id, cc.role, COALESCE(cc.invited_by::text, ''), cc.expires_at, cc.created_at,
 		       u.username, u.email, COALESCE(u.display_name, '')
 		FROM content_collaborators cc
+		JOIN content_items ci ON ci.id = cc.content_id
 		JOIN users u ON u.id = cc.user_id
-		WHERE cc.content_id = $1
+		WHERE cc.content_id = $1 AND ci.organization_id = $2
+		  AND (cc.expires_at IS NULL OR cc.expires_at > NOW())
 		ORDER BY cc.created_at`
 
-	rows, err := q.conn().QueryContext(q.ctx, query, contentID)
+	rows, err := q.conn().QueryContext(q.ctx, query, contentID, organizationID)
 	if err != nil {
 		return nil, fmt.Errorf("list collaborators: %w", err)
 	}
@@ -294,7 +437,7 @@ func (q *contentQueries) ListCollaborators(contentID string) ([]models.ContentCo
 	for rows.Next() {
 		var c models.ContentCollaboratorWithUser
 		if err := rows.Scan(
-			&c.ContentID, &c.UserID, &c.Role, &c.InvitedBy, &c.CreatedAt,
+			&c.ContentID, &c.UserID, &c.Role, &c.InvitedBy, &c.ExpiresAt, &c.CreatedAt,
 			&c.Username, &c.Email, &c.DisplayName,
 		); err != nil {
 			return nil, fmt.Errorf("scan collaborator: %w", err)
@@ -304,14 +447,872 @@ func (q *contentQueries) ListCollaborators(contentID string) ([]models.ContentCo
 	return collabs, nil
 }
 
-// GetCollaboratorRole returns the role a user has on a content item.
-// Returns "" if the user has no access. This is a single-row PK lookup — O(1).
-func (q *contentQueries) GetCollaboratorRole(contentID, userID string) (string, error) {
-	query := `SELECT role FROM content_collaborators WHERE content_id = $1 AND user_id = $2`
+// GetCollaboratorRole returns the role a user has on a content item of the
+// organization. Returns "" if the user has no access, or it expired. This is
+// a PK lookup joined to the item for the tenant check.
+func (q *contentQueries) GetCollaboratorRole(contentID, userID, organizationID string) (string, error) {
+	query := `
+		SELECT cc.role
+		FROM content_collaborators cc
+		JOIN content_items ci ON ci.id = cc.content_id
+		WHERE cc.content_id = $1 AND cc.user_id = $2 AND ci.organization_id = $3
+		  AND (cc.expires_at IS NULL OR cc.expires_at > NOW())`
 	var role string
-	err := q.conn().QueryRowContext(q.ctx, query, contentID, userID).Scan(&role)
+	err := q.conn().QueryRowContext(q.ctx, query, contentID, userID, organizationID).Scan(&role)
 	if err == sql.ErrNoRows {
 		return "", nil // No access
 	}
 	return role, err
 }
+
+// ── Ownership transfer ─────────────────────────────────────────────────
+
+// transferCollaborators keeps content_collaborators in line with the
+// ownership change made by the updated CTE (id, previous_owner, owner): the
+// new owner gets the owner row and the previous owner stays a co-author.
+const transferCollaborators = `
+		), demoted AS (
+			UPDATE content_collaborators cc SET role = 'co-author'
+			FROM updated u
+			WHERE cc.content_id = u.id AND cc.user_id = u.previous_owner AND u.previous_owner <> u.owner
+		), promoted AS (
+			INSERT INTO content_collaborators (content_id, user_id, role, invited_by, created_at)
+			SELECT u.id, u.owner, 'owner', $3, NOW() FROM updated u
+			ON CONFLICT (content_id, user_id) DO UPDATE SET role = 'owner'
+		)`
+
+// TransferOwnership makes another user of the organization the owner of a
+// content item and returns the previous owner
+func (q *contentQueries) TransferOwnership(contentID, newOwnerID, transferredBy, organizationID string) (string, error) {
+	query := `
+		WITH item AS (
+			SELECT id, owner_id FROM content_items
+			WHERE id = $1 AND organization_id = $4 AND deleted_at IS NULL
+			FOR UPDATE
+		), target AS (
+			SELECT id FROM users WHERE id = $2 AND organization_id = $4 AND deleted_at IS NULL
+		), updated AS (
+			UPDATE content_items ci SET owner_id = t.id, updated_at = NOW()
+			FROM item i, target t
+			WHERE ci.id = i.id
+			RETURNING ci.id, i.owner_id AS previous_owner, t.id AS owner` + transferCollaborators + `
+		SELECT previous_owner FROM updated`
+
+	var previous string
+	err := q.conn().QueryRowContext(q.ctx, query, contentID, newOwnerID, transferredBy, organizationID).Scan(&previous)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("content or new owner not found")
+	}
+	if err != nil {
+		return "", fmt.Errorf("transfer ownership: %w", err)
+	}
+	return previous, nil
+}
+
+// TransferAllOwnership hands every content item a user owns in the
+// organization, deleted ones included, to another user and returns how
+// many were transferred. Comments stay with their author.
+func (q *contentQueries) TransferAllOwnership(fromUserID, toUserID, transferredBy, organizationID string) (int, error) {
+	query := `
+		WITH target AS (
+			SELECT id FROM users WHERE id = $2 AND organization_id = $4 AND deleted_at IS NULL
+		), updated AS (
+			UPDATE content_items ci SET owner_id = t.id, updated_at = NOW()
+			FROM target t
+			WHERE ci.owner_id = $1 AND ci.organization_id = $4 AND ci.content_type <> 'comment'
+			RETURNING ci.id, $1::uuid AS previous_owner, t.id AS owner` + transferCollaborators + `
+		SELECT COUNT(*) FROM updated`
+
+	var transferred int
+	if err := q.conn().QueryRowContext(q.ctx, query, fromUserID, toUserID, transferredBy, organizationID).Scan(&transferred); err != nil {
+		return 0, fmt.Errorf("transfer ownership: %w", err)
+	}
+	return transferred, nil
+}
+
+// ── Invitations ────────────────────────────────────────────────────────
+
+const invitationColumns = `id, content_id, organization_id, email, role, status, invited_by, accepted_by,
+		       expires_at, created_at, accepted_at, revoked_at`
+
+func scanInvitation(row interface{ Scan(...interface{}) error }, inv *models.ContentInvitation) error {
+	return row.Scan(
+		&inv.ID, &inv.ContentID, &inv.OrganizationID, &inv.Email, &inv.Role, &inv.Status, &inv.InvitedBy, &inv.AcceptedBy,
+		&inv.ExpiresAt, &inv.CreatedAt, &inv.AcceptedAt, &inv.RevokedAt,
+	)
+}
+
+// CreateInvitation stores a pending invitation to a content item of the
+// organization. Inviting an address with a pending invitation renews that
+// one, so inv may come back with an existing ID.
+func (q *contentQueries) CreateInvitation(inv *models.ContentInvitation) error {
+	query := `
+		INSERT INTO content_invitations (content_id, organization_id, email, role, invited_by, expires_at)
+		SELECT ci.id, ci.organization_id, $3, $4, $5, $6
+		FROM content_items ci
+		WHERE ci.id = $1 AND ci.organization_id = $2 AND ci.deleted_at IS NULL
+		ON CONFLICT (content_id, LOWER(email)) WHERE status = 'pending'
+		DO UPDATE SET invited_by = EXCLUDED.invited_by, expires_at = EXCLUDED.expires_at, created_at = NOW()
+		RETURNING ` + invitationColumns
+
+	err := scanInvitation(q.conn().QueryRowContext(q.ctx, query,
+		inv.ContentID, inv.OrganizationID, inv.Email, inv.Role, inv.InvitedBy, inv.ExpiresAt,
+	), inv)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("content not found")
+	}
+	return err
+}
+
+func (q *contentQueries) GetInvitation(id, organizationID string) (*models.ContentInvitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM content_invitations WHERE id = $1 AND organization_id = $2`
+	inv := &models.ContentInvitation{}
+	err := scanInvitation(q.conn().QueryRowContext(q.ctx, query, id, organizationID), inv)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("invitation not found")
+	}
+	return inv, err
+}
+
+// ListInvitations returns the pending invitations to a content item, newest
+// first. Expired ones are included until revoked.
+func (q *contentQueries) ListInvitations(contentID, organizationID string) ([]models.ContentInvitation, error) {
+	query := `
+		SELECT ` + invitationColumns + `
+		FROM content_invitations
+		WHERE content_id = $1 AND organization_id = $2 AND status = 'pending'
+		ORDER BY created_at DESC`
+
+	rows, err := q.conn().QueryContext(q.ctx, query, contentID, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("list invitations: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := []models.ContentInvitation{}
+	for rows.Next() {
+		var inv models.ContentInvitation
+		if err := scanInvitation(rows, &inv); err != nil {
+			return nil, fmt.Errorf("scan invitation: %w", err)
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, rows.Err()
+}
+
+// RevokeInvitation withdraws a pending invitation to a content item
+func (q *contentQueries) RevokeInvitation(id, contentID, organizationID string) error {
+	query := `
+		UPDATE content_invitations SET status = 'revoked', revoked_at = NOW()
+		WHERE id = $1 AND content_id = $2 AND organization_id = $3 AND status = 'pending'`
+	res, err := q.conn().ExecContext(q.ctx, query, id, contentID, organizationID)
+	if err != nil {
+		return fmt.Errorf("revoke invitation: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("invitation not found")
+	}
+	return nil
+}
+
+// acceptInvitations turns the invitations selected by the accepted CTE
+// (content_id, role, invited_by, user_id) into collaborator rows. An
+// existing role, the owner's in particular, is kept.
+const acceptInvitations = `
+		), added AS (
+			INSERT INTO content_collaborators (content_id, user_id, role, invited_by, created_at)
+			SELECT a.content_id, a.user_id, a.role, a.invited_by, NOW()
+			FROM accepted a
+			JOIN content_items ci ON ci.id = a.content_id AND ci.deleted_at IS NULL
+			ON CONFLICT (content_id, user_id) DO NOTHING
+		)`
+
+// AcceptInvitation makes the user a collaborator on the content of a pending,
+// unexpired invitation and returns the content ID. The caller checks that
+// the invitation was addressed to the user.
+func (q *contentQueries) AcceptInvitation(id, userID, organizationID string) (string, error) {
+	query := `
+		WITH accepted AS (
+			UPDATE content_invitations
+			SET status = 'accepted', accepted_by = $2, accepted_at = NOW()
+			WHERE id = $1 AND organization_id = $3 AND status = 'pending' AND expires_at > NOW()
+			RETURNING content_id, role, invited_by, $2::uuid AS user_id` + acceptInvitations + `
+		SELECT content_id FROM accepted`
+
+	var contentID string
+	err := q.conn().QueryRowContext(q.ctx, query, id, userID, organizationID).Scan(&contentID)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("invitation not found or expired")
+	}
+	if err != nil {
+		return "", fmt.Errorf("accept invitation: %w", err)
+	}
+	return contentID, nil
+}
+
+// AcceptInvitationsForUser accepts every pending invitation to the user's
+// email address in their organization. Call it once the user has proven
+// they own the address.
+func (q *contentQueries) AcceptInvitationsForUser(userID string) (int, error) {
+	query := `
+		WITH accepted AS (
+			UPDATE content_invitations inv
+			SET status = 'accepted', accepted_by = u.id, accepted_at = NOW()
+			FROM users u
+			WHERE u.id = $1 AND u.deleted_at IS NULL
+			  AND inv.organization_id = u.organization_id AND LOWER(inv.email) = LOWER(u.email)
+			  AND inv.status = 'pending' AND inv.expires_at > NOW()
+			RETURNING inv.content_id, inv.role, inv.invited_by, u.id AS user_id` + acceptInvitations + `
+		SELECT COUNT(*) FROM accepted`
+
+	var accepted int
+	if err := q.conn().QueryRowContext(q.ctx, query, userID).Scan(&accepted); err != nil {
+		return 0, fmt.Errorf("accept invitations: %w", err)
+	}
+	return accepted, nil
+}
+
+// ── Comments ───────────────────────────────────────────────────────────
+
+// commentColumns are selected for comments, prefixed with the table alias c
+const commentColumns = `c.id, c.content_type, c.title, c.slug, c.body, c.summary, c.cover_image_url,
+		       c.parent_id, c.owner_id, c.organization_id, c.status, c.tags, c.metadata,
+		       c.published_at, c.created_at, c.updated_at, c.moderation_status`
+
+// bind appends the filter's arguments and returns a function rendering the
+// visibility predicate for a table alias, so that the thread and its reply
+// counts share the placeholders
+func (f CommentFilter) bind(args []interface{}) ([]interface{}, func(alias string) string) {
+	var viewer, status int
+	if !f.Moderator {
+		args = append(args, f.ViewerID)
+		viewer = len(args)
+	}
+	if f.ModerationStatus != "" {
+		args = append(args, f.ModerationStatus)
+		status = len(args)
+	}
+	return args, func(a string) string {
+		clause := fmt.Sprintf(`%[1]s.content_type = 'comment' AND %[1]s.deleted_at IS NULL`, a)
+		if viewer > 0 {
+			clause += fmt.Sprintf(` AND (%[1]s.moderation_status = 'approved' OR %[1]s.owner_id::text = $%[2]d)`, a, viewer)
+		}
+		if status > 0 {
+			clause += fmt.Sprintf(` AND %s.moderation_status = $%d`, a, status)
+		}
+		return clause
+	}
+}
+
+// replyCount is a correlated subquery counting the visible replies of c
+func replyCount(visible func(string) string) string {
+	return `(SELECT COUNT(*) FROM content_items r
+		 WHERE r.parent_id = c.id AND r.organization_id = c.organization_id AND ` + visible("r") + `)`
+}
+
+func scanComment(rows *sql.Rows) (*models.Comment, error) {
+	cm := &models.Comment{}
+	var moderation sql.NullString
+	if err := rows.Scan(
+		&cm.ID, &cm.ContentType, &cm.Title, &cm.Slug, &cm.Body, &cm.Summary, &cm.CoverImageURL,
+		&cm.ParentID, &cm.OwnerID, &cm.OrganizationID, &cm.Status, &cm.Tags, &cm.Metadata,
+		&cm.PublishedAt, &cm.CreatedAt, &cm.UpdatedAt, &moderation, &cm.ReplyCount,
+	); err != nil {
+		return nil, fmt.Errorf("scan comment: %w", err)
+	}
+	cm.ModerationStatus = moderation.String
+	cm.Replies = []*models.Comment{}
+	return cm, nil
+}
+
+// CreateComment inserts a published comment in the given moderation state
+func (q *contentQueries) CreateComment(item *models.ContentItem, moderationStatus string) error {
+	query := `
+		INSERT INTO content_items (id, content_type, title, slug, body, summary, cover_image_url,
+		                           parent_id, owner_id, organization_id, status, tags, metadata,
+		                           moderation_status, published_at, created_at, updated_at)
+		VALUES ($1, 'comment', $2, $3, $4, $5, $6, $7, $8, $9, 'published', $10, ` + fmt.Sprintf(clientMetadata, "$11") + `, $12, NOW(), NOW(), NOW())
+		RETURNING id, status, metadata, published_at, created_at, updated_at`
+
+	item.ContentType = "comment"
+	return q.conn().QueryRowContext(q.ctx, query,
+		item.ID, item.Title, item.Slug, item.Body, item.Summary,
+		item.CoverImageURL, item.ParentID, item.OwnerID, item.OrganizationID,
+		item.Tags, item.Metadata, moderationStatus,
+	).Scan(&item.ID, &item.Status, &item.Metadata, &item.PublishedAt, &item.CreatedAt, &item.UpdatedAt)
+}
+
+// GetThreadRoot returns the content a comment thread hangs off: the item
+// itself unless it is a comment, otherwise its nearest ancestor that is not
+// a comment
+func (q *contentQueries) GetThreadRoot(contentID, organizationID string) (*models.ContentItem, error) {
+	query := `
+		WITH RECURSIVE chain AS (
+			SELECT id, parent_id, content_type, 0 AS depth
+			FROM content_items
+			WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL
+			UNION ALL
+			SELECT p.id, p.parent_id, p.content_type, chain.depth + 1
+			FROM content_items p
+			JOIN chain ON p.id = chain.parent_id
+			WHERE chain.content_type = 'comment' AND p.organization_id = $2 AND chain.depth < 1000
+		)
+		SELECT c.id, c.content_type, c.title, c.slug, c.body, c.summary, c.cover_image_url,
+		       c.parent_id, c.owner_id, c.organization_id, c.status, c.tags, c.metadata,
+		       c.published_at, c.created_at, c.updated_at
+		FROM chain
+		JOIN content_items c ON c.id = chain.id
+		WHERE chain.content_type != 'comment' AND c.deleted_at IS NULL
+		ORDER BY chain.depth
+		LIMIT 1`
+
+	c := &models.ContentItem{}
+	err := q.reader().QueryRowContext(q.ctx, query, contentID, organizationID).Scan(
+		&c.ID, &c.ContentType, &c.Title, &c.Slug, &c.Body, &c.Summary, &c.CoverImageURL,
+		&c.ParentID, &c.OwnerID, &c.OrganizationID, &c.Status, &c.Tags, &c.Metadata,
+		&c.PublishedAt, &c.CreatedAt, &c.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("content not found")
+	}
+	return c, err
+}
+
+// ListComments pages through the direct comments on a content item or
+// replies to a comment, oldest first unless params.Order is DESC. Their own
+// replies are not loaded; see ListReplies.
+func (q *contentQueries) ListComments(params ListParams, organizationID, parentID string, filter CommentFilter) (*ListResult[*models.Comment], error) {
+	args, visible := filter.bind([]interface{}{organizationID, parentID})
+	where := `c.organization_id = $1 AND c.parent_id = $2 AND ` + visible("c")
+
+	var total int64
+	countQuery := `SELECT COUNT(*) FROM content_items c WHERE ` + where
+	if err := q.reader().QueryRowContext(q.ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("count comments: %w", err)
+	}
+
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	order := "ASC"
+	if strings.EqualFold(params.Order, "DESC") {
+		order = "DESC"
+	}
+	ks, err := newKeyset(params, "created_at", "c.created_at", "c.id", order)
+	if err != nil {
+		return nil, err
+	}
+	if clause, cursorArgs := ks.where(len(args) + 1); clause != "" {
+		where += " AND " + clause
+		args = append(args, cursorArgs...)
+	}
+	args = append(args, ks.limit(limit), ks.offset(params.Offset))
+
+	query := fmt.Sprintf(`
+		SELECT %s, %s
+		FROM content_items c
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, commentColumns, replyCount(visible), where, ks.orderBy(), len(args)-1, len(args))
+
+	rows, err := q.reader().QueryContext(q.ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list comments: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []*models.Comment
+	for rows.Next() {
+		cm, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, cm)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list comments: %w", err)
+	}
+
+	comments, hasMore, nextCursor := page(ks, comments, limit, func(cm *models.Comment) (string, string) {
+		return cursorTime(cm.CreatedAt), cm.ID
+	})
+	return &ListResult[*models.Comment]{
+		Items:      comments,
+		Total:      total,
+		Limit:      limit,
+		Offset:     ks.offset(params.Offset),
+		HasMore:    hasMore,
+		TotalPages: int((total + int64(limit) - 1) / int64(limit)),
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// ListReplies returns up to perParent of the oldest visible replies to each
+// of the comments, ordered by parent and then by age
+func (q *contentQueries) ListReplies(organizationID string, parentIDs []string, perParent int, filter CommentFilter) ([]*models.Comment, error) {
+	if len(parentIDs) == 0 || perParent <= 0 {
+		return nil, nil
+	}
+	args, visible := filter.bind([]interface{}{organizationID, pq.Array(parentIDs), perParent})
+	query := fmt.Sprintf(`
+		SELECT id, content_type, title, slug, body, summary, cover_image_url,
+		       parent_id, owner_id, organization_id, status, tags, metadata,
+		       published_at, created_at, updated_at, moderation_status, reply_count
+		FROM (
+			SELECT %s, %s AS reply_count,
+			       ROW_NUMBER() OVER (PARTITION BY c.parent_id ORDER BY c.created_at, c.id) AS position
+			FROM content_items c
+			WHERE c.organization_id = $1 AND c.parent_id = ANY($2::uuid[]) AND %s
+		) replies
+		WHERE position <= $3
+		ORDER BY parent_id, created_at, id`, commentColumns, replyCount(visible), visible("c"))
+
+	rows, err := q.reader().QueryContext(q.ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list replies: %w", err)
+	}
+	defer rows.Close()
+
+	var replies []*models.Comment
+	for rows.Next() {
+		cm, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, cm)
+	}
+	return replies, rows.Err()
+}
+
+// ModerateComment sets the moderation state of a comment
+func (q *contentQueries) ModerateComment(id, organizationID, status string) error {
+	query := `
+		UPDATE content_items SET moderation_status = $1, updated_at = NOW()
+		WHERE id = $2 AND organization_id = $3 AND content_type = 'comment' AND deleted_at IS NULL`
+	res, err := q.conn().ExecContext(q.ctx, query, status, id, organizationID)
+	if err != nil {
+		return fmt.Errorf("moderate comment: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("comment not found")
+	}
+	return nil
+}
+
+// ── Revisions ──────────────────────────────────────────────────────────
+
+// CreateRevision snapshots the stored state of a content item as its next
+// revision. Run it in the transaction that changed the item: the row lock
+// taken by the change serializes revision numbers.
+func (q *contentQueries) CreateRevision(contentID, organizationID, authorID string, restoredFrom *int) (*models.ContentRevision, error) {
+	query := `
+		INSERT INTO content_revisions (content_id, organization_id, revision, title, slug, body, summary,
+		                               cover_image_url, tags, metadata, author_id, restored_from)
+		SELECT ci.id, ci.organization_id,
+		       (SELECT COALESCE(MAX(r.revision), 0) + 1 FROM content_revisions r WHERE r.content_id = ci.id),
+		       ci.title, ci.slug, ci.body, ci.summary, ci.cover_image_url, ci.tags, ci.metadata, $3, $4
+		FROM content_items ci
+		WHERE ci.id = $1 AND ci.organization_id = $2 AND ci.deleted_at IS NULL
+		RETURNING id, content_id, revision, title, COALESCE(slug, ''), COALESCE(body, ''), COALESCE(summary, ''),
+		          COALESCE(cover_image_url, ''), COALESCE(tags, '[]'), COALESCE(metadata, '{}'),
+		          author_id, restored_from, created_at`
+
+	r := &models.ContentRevision{}
+	err := q.conn().QueryRowContext(q.ctx, query, contentID, organizationID, authorID, restoredFrom).Scan(
+		&r.ID, &r.ContentID, &r.Revision, &r.Title, &r.Slug, &r.Body, &r.Summary,
+		&r.CoverImageURL, &r.Tags, &r.Metadata, &r.AuthorID, &r.RestoredFrom, &r.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("content not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create revision: %w", err)
+	}
+	return r, nil
+}
+
+// ListRevisions pages through the revisions of a content item, newest
+// first, with their authors. Bodies are left out; see GetRevision.
+func (q *contentQueries) ListRevisions(params ListParams, contentID, organizationID string) (*ListResult[*models.ContentRevision], error) {
+	args := []interface{}{contentID, organizationID}
+	where := `r.content_id = $1 AND r.organization_id = $2`
+
+	var total int64
+	countQuery := `SELECT COUNT(*) FROM content_revisions r WHERE ` + where
+	if err := q.reader().QueryRowContext(q.ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("count revisions: %w", err)
+	}
+
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	order := "DESC"
+	if strings.EqualFold(params.Order, "ASC") {
+		order = "ASC"
+	}
+	ks, err := newKeyset(params, "created_at", "r.created_at", "r.id", order)
+	if err != nil {
+		return nil, err
+	}
+	if clause, cursorArgs := ks.where(len(args) + 1); clause != "" {
+		where += " AND " + clause
+		args = append(args, cursorArgs...)
+	}
+	args = append(args, ks.limit(limit), ks.offset(params.Offset))
+
+	query := fmt.Sprintf(`
+		SELECT r.id, r.content_id, r.revision, r.title, COALESCE(r.slug, ''), r.author_id,
+		       COALESCE(u.username, ''), COALESCE(u.display_name, ''), r.restored_from, r.created_at
+		FROM content_revisions r
+		LEFT JOIN users u ON u.id = r.author_id
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, where, ks.orderBy(), len(args)-1, len(args))
+
+	rows, err := q.reader().QueryContext(q.ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list revisions: %w", err)
+	}
+	defer rows.Close()
+
+	var revisions []*models.ContentRevision
+	for rows.Next() {
+		r := &models.ContentRevision{}
+		if err := rows.Scan(
+			&r.ID, &r.ContentID, &r.Revision, &r.Title, &r.Slug, &r.AuthorID,
+			&r.AuthorUsername, &r.AuthorDisplayName, &r.RestoredFrom, &r.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan revision: %w", err)
+		}
+		revisions = append(revisions, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list revisions: %w", err)
+	}
+
+	revisions, hasMore, nextCursor := page(ks, revisions, limit, func(r *models.ContentRevision) (string, string) {
+		return cursorTime(r.CreatedAt), r.ID
+	})
+	return &ListResult[*models.ContentRevision]{
+		Items:      revisions,
+		Total:      total,
+		Limit:      limit,
+		Offset:     ks.offset(params.Offset),
+		HasMore:    hasMore,
+		TotalPages: int((total + int64(limit) - 1) / int64(limit)),
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// GetRevision returns one revision of a content item in full
+func (q *contentQueries) GetRevision(contentID, organizationID string, revision int) (*models.ContentRevision, error) {
+	query := `
+		SELECT r.id, r.content_id, r.revision, r.title, COALESCE(r.slug, ''), COALESCE(r.body, ''),
+		       COALESCE(r.summary, ''), COALESCE(r.cover_image_url, ''), COALESCE(r.tags, '[]'),
+		       COALESCE(r.metadata, '{}'), r.author_id, COALESCE(u.username, ''),
+		       COALESCE(u.display_name, ''), r.restored_from, r.created_at
+		FROM content_revisions r
+		LEFT JOIN users u ON u.id = r.author_id
+		WHERE r.content_id = $1 AND r.organization_id = $2 AND r.revision = $3`
+
+	r := &models.ContentRevision{}
+	err := q.reader().QueryRowContext(q.ctx, query, contentID, organizationID, revision).Scan(
+		&r.ID, &r.ContentID, &r.Revision, &r.Title, &r.Slug, &r.Body,
+		&r.Summary, &r.CoverImageURL, &r.Tags,
+		&r.Metadata, &r.AuthorID, &r.AuthorUsername,
+		&r.AuthorDisplayName, &r.RestoredFrom, &r.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("revision not found")
+	}
+	return r, err
+}
+
+// ── Reactions and bookmarks ────────────────────────────────────────────
+
+// AddReaction records a user's reaction of the given type and reports
+// whether it is new; reacting twice with one type is a no-op
+func (q *contentQueries) AddReaction(contentID, userID, organizationID, reactionType string) (bool, error) {
+	query := `
+		INSERT INTO content_reactions (content_id, user_id, reaction_type, organization_id)
+		SELECT ci.id, $2, $3, ci.organization_id
+		FROM content_items ci
+		WHERE ci.id = $1 AND ci.organization_id = $4 AND ci.deleted_at IS NULL
+		ON CONFLICT (content_id, user_id, reaction_type) DO NOTHING`
+	return q.changed(q.conn().ExecContext(q.ctx, query, contentID, userID, reactionType, organizationID))
+}
+
+// RemoveReaction withdraws a user's reaction and reports whether there was one
+func (q *contentQueries) RemoveReaction(contentID, userID, organizationID, reactionType string) (bool, error) {
+	query := `
+		DELETE FROM content_reactions
+		WHERE content_id = $1 AND user_id = $2 AND reaction_type = $3 AND organization_id = $4`
+	return q.changed(q.conn().ExecContext(q.ctx, query, contentID, userID, reactionType, organizationID))
+}
+
+// AddBookmark saves a content item for a user and reports whether it was
+// not saved already
+func (q *contentQueries) AddBookmark(contentID, userID, organizationID string) (bool, error) {
+	query := `
+		INSERT INTO content_bookmarks (user_id, content_id, organization_id)
+		SELECT $2, ci.id, ci.organization_id
+		FROM content_items ci
+		WHERE ci.id = $1 AND ci.organization_id = $3 AND ci.deleted_at IS NULL
+		ON CONFLICT (user_id, content_id) DO NOTHING`
+	return q.changed(q.conn().ExecContext(q.ctx, query, contentID, userID, organizationID))
+}
+
+// RemoveBookmark unsaves a content item and reports whether it was saved
+func (q *contentQueries) RemoveBookmark(contentID, userID, organizationID string) (bool, error) {
+	query := `DELETE FROM content_bookmarks WHERE content_id = $1 AND user_id = $2 AND organization_id = $3`
+	return q.changed(q.conn().ExecContext(q.ctx, query, contentID, userID, organizationID))
+}
+
+func (q *contentQueries) changed(res sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ListBookmarks pages through a user's saved items, most recently saved
+// first. Items deleted since, or no longer readable by the user because
+// they were unpublished, are left out.
+func (q *contentQueries) ListBookmarks(params ListParams, userID, organizationID string) (*ListResult[*models.Bookmark], error) {
+	args := []interface{}{userID, organizationID}
+	where := `b.user_id = $1 AND b.organization_id = $2 AND c.deleted_at IS NULL
+		  AND (c.status = 'published' OR c.owner_id = $1 OR EXISTS (
+		       SELECT 1 FROM content_collaborators cc WHERE cc.content_id = c.id AND cc.user_id = $1
+		         AND (cc.expires_at IS NULL OR cc.expires_at > NOW())))`
+
+	var total int64
+	countQuery := `SELECT COUNT(*) FROM content_bookmarks b JOIN content_items c ON c.id = b.content_id WHERE ` + where
+	if err := q.reader().QueryRowContext(q.ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("count bookmarks: %w", err)
+	}
+
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	ks, err := newKeyset(params, "created_at", "b.created_at", "b.content_id", "DESC")
+	if err != nil {
+		return nil, err
+	}
+	if clause, cursorArgs := ks.where(len(args) + 1); clause != "" {
+		where += " AND " + clause
+		args = append(args, cursorArgs...)
+	}
+	args = append(args, ks.limit(limit), ks.offset(params.Offset))
+
+	query := fmt.Sprintf(`
+		SELECT c.id, c.content_type, c.title, c.slug, c.body, c.summary, c.cover_image_url,
+		       c.parent_id, c.owner_id, c.organization_id, c.status, c.tags, c.metadata,
+		       c.published_at, c.created_at, c.updated_at, b.created_at
+		FROM content_bookmarks b
+		JOIN content_items c ON c.id = b.content_id
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, where, ks.orderBy(), len(args)-1, len(args))
+
+	rows, err := q.reader().QueryContext(q.ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list bookmarks: %w", err)
+	}
+	defer rows.Close()
+
+	var bookmarks []*models.Bookmark
+	for rows.Next() {
+		b := &models.Bookmark{}
+		if err := rows.Scan(
+			&b.ID, &b.ContentType, &b.Title, &b.Slug, &b.Body, &b.Summary, &b.CoverImageURL,
+			&b.ParentID, &b.OwnerID, &b.OrganizationID, &b.Status, &b.Tags, &b.Metadata,
+			&b.PublishedAt, &b.CreatedAt, &b.UpdatedAt, &b.BookmarkedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan bookmark: %w", err)
+		}
+		bookmarks = append(bookmarks, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list bookmarks: %w", err)
+	}
+
+	bookmarks, hasMore, nextCursor := page(ks, bookmarks, limit, func(b *models.Bookmark) (string, string) {
+		return cursorTime(b.BookmarkedAt), b.ID
+	})
+	return &ListResult[*models.Bookmark]{
+		Items:      bookmarks,
+		Total:      total,
+		Limit:      limit,
+		Offset:     ks.offset(params.Offset),
+		HasMore:    hasMore,
+		TotalPages: int((total + int64(limit) - 1) / int64(limit)),
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// RecountEngagement writes the reaction counts by type and the bookmark
+// count of a content item into its metadata. It is run by the counter flush
+// job across organizations; updated_at is left alone so that reactions do
+// not reorder content lists.
+func (q *contentQueries) RecountEngagement(contentID string) error {
+	query := `
+		UPDATE content_items ci
+		SET metadata = COALESCE(ci.metadata, '{}'::jsonb) || jsonb_build_object(
+		    'reactions', COALESCE((
+		        SELECT jsonb_object_agg(reaction_type, n)
+		        FROM (SELECT reaction_type, COUNT(*) AS n FROM content_reactions
+		              WHERE content_id = ci.id GROUP BY reaction_type) r
+		    ), '{}'::jsonb),
+		    'bookmarks', (SELECT COUNT(*) FROM content_bookmarks WHERE content_id = ci.id))
+		WHERE ci.id = $1`
+	_, err := q.conn().ExecContext(q.ctx, query, contentID)
+	if err != nil {
+		return fmt.Errorf("recount engagement: %w", err)
+	}
+	return nil
+}
+
+// ── Attachments ────────────────────────────────────────────────────────
+
+const attachmentColumns = `a.id, r.arn, a.content_id, a.organization_id, a.storage_key, a.filename,
+	a.content_type, a.size_bytes, a.checksum, a.uploaded_by, a.created_at`
+
+func scanAttachment(row interface{ Scan(...interface{}) error }, a *models.ContentAttachment) error {
+	return row.Scan(&a.ID, &a.ARN, &a.ContentID, &a.OrganizationID, &a.StorageKey, &a.Filename,
+		&a.ContentType, &a.SizeBytes, &a.Checksum, &a.UploadedBy, &a.CreatedAt)
+}
+
+// LockAttachmentUsage returns the bytes used by the attachments of an
+// organization and, inside a transaction, holds the organization's upload
+// lock until it ends so that concurrent uploads cannot both fit the quota
+func (q *contentQueries) LockAttachmentUsage(organizationID string) (int64, error) {
+	if q.tx != nil {
+		if _, err := q.tx.ExecContext(q.ctx, `SELECT pg_advisory_xact_lock(hashtext('content_attachments:' || $1))`, organizationID); err != nil {
+			return 0, fmt.Errorf("lock attachment usage: %w", err)
+		}
+	}
+	var used int64
+	err := q.conn().QueryRowContext(q.ctx,
+		`SELECT COALESCE(SUM(size_bytes), 0) FROM content_attachments WHERE organization_id = $1`, organizationID,
+	).Scan(&used)
+	if err != nil {
+		return 0, fmt.Errorf("attachment usage: %w", err)
+	}
+	return used, nil
+}
+
+// CreateAttachment records an uploaded file of a content item. Its resource,
+// with the same ID, must have been created first.
+func (q *contentQueries) CreateAttachment(a *models.ContentAttachment) error {
+	query := `
+		INSERT INTO content_attachments (id, content_id, organization_id, storage_key, filename,
+		                                 content_type, size_bytes, checksum, uploaded_by)
+		SELECT $1, ci.id, ci.organization_id, $4, $5, $6, $7, $8, $9
+		FROM content_items ci
+		WHERE ci.id = $2 AND ci.organization_id = $3 AND ci.deleted_at IS NULL
+		RETURNING created_at`
+
+	err := q.conn().QueryRowContext(q.ctx, query,
+		a.ID, a.ContentID, a.OrganizationID, a.StorageKey, a.Filename,
+		a.ContentType, a.SizeBytes, a.Checksum, a.UploadedBy,
+	).Scan(&a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("content not found")
+	}
+	if err != nil {
+		return fmt.Errorf("create attachment: %w", err)
+	}
+	return nil
+}
+
+// ListAttachments returns the attachments of a content item, oldest first
+func (q *contentQueries) ListAttachments(contentID, organizationID string) ([]models.ContentAttachment, error) {
+	query := `
+		SELECT ` + attachmentColumns + `
+		FROM content_attachments a
+		JOIN resources r ON r.id = a.id
+		WHERE a.content_id = $1 AND a.organization_id = $2
+		ORDER BY a.created_at, a.id`
+
+	rows, err := q.reader().QueryContext(q.ctx, query, contentID, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("list attachments: %w", err)
+	}
+	defer rows.Close()
+
+	attachments := []models.ContentAttachment{}
+	for rows.Next() {
+		var a models.ContentAttachment
+		if err := scanAttachment(rows, &a); err != nil {
+			return nil, fmt.Errorf("scan attachment: %w", err)
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+func (q *contentQueries) GetAttachment(id, organizationID string) (*models.ContentAttachment, error) {
+	query := `
+		SELECT ` + attachmentColumns + `
+		FROM content_attachments a
+		JOIN resources r ON r.id = a.id
+		WHERE a.id = $1 AND a.organization_id = $2`
+
+	var a models.ContentAttachment
+	err := scanAttachment(q.conn().QueryRowContext(q.ctx, query, id, organizationID), &a)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("attachment not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// DeleteAttachment deletes the resource of an attachment, and with it the
+// attachment, and returns the storage key of the file for the caller to
+// remove
+func (q *contentQueries) DeleteAttachment(id, contentID, organizationID string) (string, error) {
+	query := `
+		DELETE FROM resources r
+		USING content_attachments a
+		WHERE r.id = a.id AND a.id = $1 AND a.content_id = $2 AND a.organization_id = $3
+		RETURNING a.storage_key`
+
+	var key string
+	err := q.conn().QueryRowContext(q.ctx, query, id, contentID, organizationID).Scan(&key)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("attachment not found")
+	}
+	if err != nil {
+		return "", fmt.Errorf("delete attachment: %w", err)
+	}
+	return key, nil
+}
+
+// AttachmentSharedWith reports whether the resource of an attachment is
+// shared, unexpired, with the principal or a group the principal belongs to
+func (q *contentQueries) AttachmentSharedWith(id, principalID, principalType, organizationID string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+		    SELECT 1
+		    FROM resource_shares rs
+		    JOIN resources r ON r.id = rs.resource_id
+		    WHERE rs.resource_id = $1 AND r.organization_id = $3 AND r.deleted_at IS NULL
+		      AND (rs.expires_at IS NULL OR rs.expires_at > NOW())
+		      AND ((rs.principal_type::text = $4 AND rs.principal_id = $2)
+		           OR (rs.principal_type = 'group' AND rs.principal_id IN (
+		               SELECT gm.group_id FROM group_memberships gm
+		               WHERE gm.principal_id = $2 AND gm.principal_type::text = $4
+		                 AND (gm.expires_at IS NULL OR gm.expires_at > NOW())))))`
+
+	var shared bool
+	if err := q.reader().QueryRowContext(q.ctx, query, id, principalID, organizationID, principalType).Scan(&shared); err != nil {
+		return false, fmt.Errorf("check attachment shares: %w", err)
+	}
+	return shared, nil
+}
@@ -0,0 +1,162 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/database"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// DelegationQueries stores the consents of users for service accounts to
+// act on their behalf
+type DelegationQueries interface {
+	WithTx(tx *sql.Tx) DelegationQueries
+	WithContext(ctx context.Context) DelegationQueries
+
+	// ListActiveGrants returns the unexpired, unrevoked grants of the
+	// organization, of a user and/or to a service account when they are set
+	ListActiveGrants(organizationID, userID, serviceAccountID string) ([]models.DelegationGrant, error)
+	// PutGrant creates the active grant of a user to a service account of
+	// the organization, or replaces its actions and expiry
+	PutGrant(grant *models.DelegationGrant) error
+	// GetActiveGrant returns the unexpired, unrevoked grant of a user to a
+	// service account
+	GetActiveGrant(userID, serviceAccountID, organizationID string) (*models.DelegationGrant, error)
+	// RevokeGrant revokes an active grant; userID, when set, must be the
+	// user who gave it
+	RevokeGrant(id, organizationID, userID string) (*models.DelegationGrant, error)
+	// TouchGrant records that a token was minted from a grant
+	TouchGrant(id, organizationID string) error
+}
+
+type delegationQueries struct {
+	db    *database.DB
+	redis redis.UniversalClient
+	tx    *sql.Tx
+	ctx   context.Context
+}
+
+// NewDelegationQueries creates a new DelegationQueries instance
+func NewDelegationQueries(db *database.DB, redis redis.UniversalClient) DelegationQueries {
+	return &delegationQueries{db: db, redis: redis, ctx: context.Background()}
+}
+
+func (q *delegationQueries) WithTx(tx *sql.Tx) DelegationQueries {
+	return &delegationQueries{db: q.db, redis: q.redis, tx: tx, ctx: q.ctx}
+}
+
+func (q *delegationQueries) WithContext(ctx context.Context) DelegationQueries {
+	return &delegationQueries{db: q.db, redis: q.redis, tx: q.tx, ctx: ctx}
+}
+
+func (q *delegationQueries) conn() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.DB
+}
+
+const delegationGrantColumns = `g.id, g.organization_id, g.user_id, g.service_account_id, COALESCE(sa.name, ''),
+	g.actions, g.created_at, g.expires_at, g.revoked_at, g.last_used_at`
+
+// delegationGrantActive holds for grants that still allow minting tokens
+const delegationGrantActive = `g.revoked_at IS NULL AND (g.expires_at IS NULL OR g.expires_at > NOW())`
+
+func scanDelegationGrant(row interface{ Scan(...interface{}) error }) (*models.DelegationGrant, error) {
+	var g models.DelegationGrant
+	if err := row.Scan(&g.ID, &g.OrganizationID, &g.UserID, &g.ServiceAccountID, &g.ServiceAccountName,
+		pq.Array(&g.Actions), &g.CreatedAt, &g.ExpiresAt, &g.RevokedAt, &g.LastUsedAt); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (q *delegationQueries) ListActiveGrants(organizationID, userID, serviceAccountID string) ([]models.DelegationGrant, error) {
+	rows, err := q.conn().QueryContext(q.ctx, `
+		SELECT `+delegationGrantColumns+`
+		FROM delegation_grants g
+		LEFT JOIN service_accounts sa ON sa.id = g.service_account_id
+		WHERE g.organization_id = $1 AND `+delegationGrantActive+`
+		  AND ($2 = '' OR g.user_id::text = $2) AND ($3 = '' OR g.service_account_id::text = $3)
+		ORDER BY g.created_at DESC`, organizationID, userID, serviceAccountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list delegation grants: %w", err)
+	}
+	defer rows.Close()
+
+	grants := []models.DelegationGrant{}
+	for rows.Next() {
+		g, err := scanDelegationGrant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan delegation grant: %w", err)
+		}
+		grants = append(grants, *g)
+	}
+	return grants, rows.Err()
+}
+
+func (q *delegationQueries) PutGrant(grant *models.DelegationGrant) error {
+	// The service account must belong to the user's organization
+	err := q.conn().QueryRowContext(q.ctx, `
+		INSERT INTO delegation_grants (organization_id, user_id, service_account_id, actions, expires_at)
+		SELECT $1, $2, sa.id, $4, $5
+		FROM service_accounts sa
+		WHERE sa.id = $3 AND sa.organization_id = $1 AND sa.deleted_at IS NULL
+		ON CONFLICT (user_id, service_account_id) WHERE revoked_at IS NULL
+		DO UPDATE SET actions = EXCLUDED.actions, expires_at = EXCLUDED.expires_at
+		RETURNING id, created_at, last_used_at`,
+		grant.OrganizationID, grant.UserID, grant.ServiceAccountID, pq.Array(grant.Actions), grant.ExpiresAt,
+	).Scan(&grant.ID, &grant.CreatedAt, &grant.LastUsedAt)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("service account not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save delegation grant: %w", err)
+	}
+	return nil
+}
+
+func (q *delegationQueries) GetActiveGrant(userID, serviceAccountID, organizationID string) (*models.DelegationGrant, error) {
+	g, err := scanDelegationGrant(q.conn().QueryRowContext(q.ctx, `
+		SELECT `+delegationGrantColumns+`
+		FROM delegation_grants g
+		LEFT JOIN service_accounts sa ON sa.id = g.service_account_id
+		WHERE g.user_id = $1 AND g.service_account_id = $2 AND g.organization_id = $3 AND `+delegationGrantActive,
+		userID, serviceAccountID, organizationID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("delegation grant not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get delegation grant: %w", err)
+	}
+	return g, nil
+}
+
+func (q *delegationQueries) RevokeGrant(id, organizationID, userID string) (*models.DelegationGrant, error) {
+	g, err := scanDelegationGrant(q.conn().QueryRowContext(q.ctx, `
+		WITH g AS (
+			UPDATE delegation_grants SET revoked_at = NOW()
+			WHERE id = $1 AND organization_id = $2 AND ($3 = '' OR user_id::text = $3) AND revoked_at IS NULL
+			RETURNING *
+		)
+		SELECT `+delegationGrantColumns+`
+		FROM g
+		LEFT JOIN service_accounts sa ON sa.id = g.service_account_id`, id, organizationID, userID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("delegation grant not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke delegation grant: %w", err)
+	}
+	return g, nil
+}
+
+func (q *delegationQueries) TouchGrant(id, organizationID string) error {
+	_, err := q.conn().ExecContext(q.ctx,
+		`UPDATE delegation_grants SET last_used_at = NOW() WHERE id = $1 AND organization_id = $2`, id, organizationID)
+	return err
+}
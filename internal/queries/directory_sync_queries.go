@@ -0,0 +1,332 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/database"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// DirectorySyncQueries stores organizations' directory syncs, the users and
+// groups they manage and the reports of their runs
+type DirectorySyncQueries interface {
+	WithTx(tx *sql.Tx) DirectorySyncQueries
+	WithContext(ctx context.Context) DirectorySyncQueries
+
+	// GetSync returns the directory sync of an organization, or nil when it
+	// has none
+	GetSync(organizationID string) (*models.DirectorySync, error)
+	// PutSync creates or replaces the directory sync of an organization
+	PutSync(sync *models.DirectorySync) error
+	// DeleteSync removes the directory sync of an organization and its
+	// links; the users and groups it created stay
+	DeleteSync(organizationID string) error
+	// ListDueSyncs returns the enabled syncs of every organization whose
+	// interval has passed since their last run
+	ListDueSyncs() ([]models.DirectorySync, error)
+	// MarkSyncRun records that a sync started a run
+	MarkSyncRun(organizationID string) error
+
+	// ListLinks returns the users or groups a sync manages
+	ListLinks(organizationID, kind string) ([]models.DirectorySyncLink, error)
+	// PutLink binds a user or group of the directory to a local one
+	PutLink(organizationID string, link *models.DirectorySyncLink) error
+	// DeleteLink forgets a user or group of the directory
+	DeleteLink(organizationID, kind, externalID string) error
+
+	// CreateRun records the start of a run
+	CreateRun(run *models.DirectorySyncRun) error
+	// FinishRun stores the outcome and report of a run
+	FinishRun(run *models.DirectorySyncRun) error
+	// ListRuns returns the latest runs of an organization without their
+	// changes, newest first
+	ListRuns(organizationID string, limit int) ([]models.DirectorySyncRun, error)
+	// GetRun returns a run with its changes
+	GetRun(id, organizationID string) (*models.DirectorySyncRun, error)
+
+	// LockSync keeps other replicas from running an organization's sync
+	// for ttl; it reports false when a run holds the lock
+	LockSync(organizationID string, ttl time.Duration) (bool, error)
+	// UnlockSync releases the lock of an organization's sync
+	UnlockSync(organizationID string) error
+}
+
+type directorySyncQueries struct {
+	db    *database.DB
+	redis redis.UniversalClient
+	tx    *sql.Tx
+	ctx   context.Context
+}
+
+// NewDirectorySyncQueries creates a new DirectorySyncQueries instance
+func NewDirectorySyncQueries(db *database.DB, redis redis.UniversalClient) DirectorySyncQueries {
+	return &directorySyncQueries{db: db, redis: redis, ctx: context.Background()}
+}
+
+func (q *directorySyncQueries) WithTx(tx *sql.Tx) DirectorySyncQueries {
+	return &directorySyncQueries{db: q.db, redis: q.redis, tx: tx, ctx: q.ctx}
+}
+
+func (q *directorySyncQueries) WithContext(ctx context.Context) DirectorySyncQueries {
+	return &directorySyncQueries{db: q.db, redis: q.redis, tx: q.tx, ctx: ctx}
+}
+
+func (q *directorySyncQueries) conn() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.DB
+}
+
+const directorySyncColumns = `organization_id, source_type, base_url, token, attribute_mapping, sync_groups,
+	deactivate_missing, interval_minutes, enabled, last_run_at, created_by, created_at, updated_at`
+
+func scanDirectorySync(row interface{ Scan(...interface{}) error }) (*models.DirectorySync, error) {
+	var sync models.DirectorySync
+	var mapping []byte
+	if err := row.Scan(&sync.OrganizationID, &sync.SourceType, &sync.BaseURL, &sync.Token, &mapping, &sync.SyncGroups,
+		&sync.DeactivateMissing, &sync.IntervalMinutes, &sync.Enabled, &sync.LastRunAt, &sync.CreatedBy,
+		&sync.CreatedAt, &sync.UpdatedAt); err != nil {
+		return nil, err
+	}
+	sync.AttributeMapping = map[string]string{}
+	if len(mapping) > 0 {
+		if err := json.Unmarshal(mapping, &sync.AttributeMapping); err != nil {
+			return nil, fmt.Errorf("failed to decode attribute mapping: %w", err)
+		}
+	}
+	return &sync, nil
+}
+
+func (q *directorySyncQueries) GetSync(organizationID string) (*models.DirectorySync, error) {
+	sync, err := scanDirectorySync(q.conn().QueryRowContext(q.ctx,
+		`SELECT `+directorySyncColumns+` FROM directory_syncs WHERE organization_id = $1`, organizationID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get directory sync: %w", err)
+	}
+	return sync, nil
+}
+
+func (q *directorySyncQueries) PutSync(sync *models.DirectorySync) error {
+	mapping, err := json.Marshal(sync.AttributeMapping)
+	if err != nil {
+		return err
+	}
+	err = q.conn().QueryRowContext(q.ctx, `
+		INSERT INTO directory_syncs (organization_id, source_type, base_url, token, attribute_mapping, sync_groups,
+			deactivate_missing, interval_minutes, enabled, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (organization_id) DO UPDATE SET
+			source_type = EXCLUDED.source_type, base_url = EXCLUDED.base_url, token = EXCLUDED.token,
+			attribute_mapping = EXCLUDED.attribute_mapping, sync_groups = EXCLUDED.sync_groups,
+			deactivate_missing = EXCLUDED.deactivate_missing, interval_minutes = EXCLUDED.interval_minutes,
+			enabled = EXCLUDED.enabled, updated_at = NOW()
+		WHERE directory_syncs.organization_id = $1
+		RETURNING last_run_at, created_by, created_at, updated_at`,
+		sync.OrganizationID, sync.SourceType, sync.BaseURL, sync.Token, string(mapping), sync.SyncGroups,
+		sync.DeactivateMissing, sync.IntervalMinutes, sync.Enabled, sync.CreatedBy,
+	).Scan(&sync.LastRunAt, &sync.CreatedBy, &sync.CreatedAt, &sync.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save directory sync: %w", err)
+	}
+	return nil
+}
+
+func (q *directorySyncQueries) DeleteSync(organizationID string) error {
+	res, err := q.conn().ExecContext(q.ctx, `
+		WITH links AS (DELETE FROM directory_sync_links WHERE organization_id = $1)
+		DELETE FROM directory_syncs WHERE organization_id = $1`, organizationID)
+	if err != nil {
+		return fmt.Errorf("failed to delete directory sync: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("directory sync not found")
+	}
+	return nil
+}
+
+func (q *directorySyncQueries) ListDueSyncs() ([]models.DirectorySync, error) {
+	rows, err := q.conn().QueryContext(q.ctx, `
+		SELECT `+directorySyncColumns+` FROM directory_syncs
+		WHERE enabled
+		  AND (last_run_at IS NULL OR last_run_at + interval_minutes * INTERVAL '1 minute' <= NOW())
+		  AND organization_id IN (SELECT id FROM organizations WHERE deleted_at IS NULL)
+		ORDER BY last_run_at NULLS FIRST`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var syncs []models.DirectorySync
+	for rows.Next() {
+		sync, err := scanDirectorySync(rows)
+		if err != nil {
+			return nil, err
+		}
+		syncs = append(syncs, *sync)
+	}
+	return syncs, rows.Err()
+}
+
+func (q *directorySyncQueries) MarkSyncRun(organizationID string) error {
+	_, err := q.conn().ExecContext(q.ctx,
+		`UPDATE directory_syncs SET last_run_at = NOW() WHERE organization_id = $1`, organizationID)
+	return err
+}
+
+func (q *directorySyncQueries) ListLinks(organizationID, kind string) ([]models.DirectorySyncLink, error) {
+	rows, err := q.conn().QueryContext(q.ctx, `
+		SELECT kind, external_id, local_id, deactivated FROM directory_sync_links
+		WHERE organization_id = $1 AND kind = $2`, organizationID, kind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list directory sync links: %w", err)
+	}
+	defer rows.Close()
+
+	links := []models.DirectorySyncLink{}
+	for rows.Next() {
+		var link models.DirectorySyncLink
+		if err := rows.Scan(&link.Kind, &link.ExternalID, &link.LocalID, &link.Deactivated); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (q *directorySyncQueries) PutLink(organizationID string, link *models.DirectorySyncLink) error {
+	_, err := q.conn().ExecContext(q.ctx, `
+		INSERT INTO directory_sync_links (organization_id, kind, external_id, local_id, deactivated)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (organization_id, kind, external_id) DO UPDATE SET
+			local_id = EXCLUDED.local_id, deactivated = EXCLUDED.deactivated, synced_at = NOW()
+		WHERE directory_sync_links.organization_id = $1`,
+		organizationID, link.Kind, link.ExternalID, link.LocalID, link.Deactivated)
+	if err != nil {
+		return fmt.Errorf("failed to save directory sync link: %w", err)
+	}
+	return nil
+}
+
+func (q *directorySyncQueries) DeleteLink(organizationID, kind, externalID string) error {
+	_, err := q.conn().ExecContext(q.ctx, `
+		DELETE FROM directory_sync_links WHERE organization_id = $1 AND kind = $2 AND external_id = $3`,
+		organizationID, kind, externalID)
+	return err
+}
+
+func (q *directorySyncQueries) CreateRun(run *models.DirectorySyncRun) error {
+	return q.conn().QueryRowContext(q.ctx, `
+		INSERT INTO directory_sync_runs (organization_id, trigger, triggered_by, dry_run, status)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, started_at`,
+		run.OrganizationID, run.Trigger, run.TriggeredBy, run.DryRun, run.Status,
+	).Scan(&run.ID, &run.StartedAt)
+}
+
+func (q *directorySyncQueries) FinishRun(run *models.DirectorySyncRun) error {
+	summary, err := json.Marshal(run.Summary)
+	if err != nil {
+		return err
+	}
+	changes := run.Changes
+	if changes == nil {
+		changes = []models.DirectorySyncChange{}
+	}
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	var runError *string
+	if run.Error != "" {
+		runError = &run.Error
+	}
+	return q.conn().QueryRowContext(q.ctx, `
+		UPDATE directory_sync_runs
+		SET status = $3, error = $4, summary = $5, changes = $6, finished_at = NOW()
+		WHERE id = $1 AND organization_id = $2
+		RETURNING finished_at`,
+		run.ID, run.OrganizationID, run.Status, runError, string(summary), string(changesJSON),
+	).Scan(&run.FinishedAt)
+}
+
+func scanDirectorySyncRun(row interface{ Scan(...interface{}) error }, withChanges bool) (*models.DirectorySyncRun, error) {
+	var run models.DirectorySyncRun
+	var runError sql.NullString
+	var summary, changes []byte
+	dest := []interface{}{&run.ID, &run.OrganizationID, &run.Trigger, &run.TriggeredBy, &run.DryRun, &run.Status,
+		&runError, &summary, &run.StartedAt, &run.FinishedAt}
+	if withChanges {
+		dest = append(dest, &changes)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	run.Error = runError.String
+	if err := json.Unmarshal(summary, &run.Summary); err != nil {
+		return nil, fmt.Errorf("failed to decode run summary: %w", err)
+	}
+	if withChanges {
+		if err := json.Unmarshal(changes, &run.Changes); err != nil {
+			return nil, fmt.Errorf("failed to decode run changes: %w", err)
+		}
+	}
+	return &run, nil
+}
+
+const directorySyncRunColumns = `id, organization_id, trigger, triggered_by, dry_run, status, error, summary, started_at, finished_at`
+
+func (q *directorySyncQueries) ListRuns(organizationID string, limit int) ([]models.DirectorySyncRun, error) {
+	rows, err := q.conn().QueryContext(q.ctx, `
+		SELECT `+directorySyncRunColumns+` FROM directory_sync_runs
+		WHERE organization_id = $1
+		ORDER BY started_at DESC
+		LIMIT $2`, organizationID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list directory sync runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []models.DirectorySyncRun{}
+	for rows.Next() {
+		run, err := scanDirectorySyncRun(rows, false)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
+func (q *directorySyncQueries) GetRun(id, organizationID string) (*models.DirectorySyncRun, error) {
+	run, err := scanDirectorySyncRun(q.conn().QueryRowContext(q.ctx, `
+		SELECT `+directorySyncRunColumns+`, changes FROM directory_sync_runs
+		WHERE id = $1 AND organization_id = $2`, id, organizationID), true)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("directory sync run not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get directory sync run: %w", err)
+	}
+	return run, nil
+}
+
+func directorySyncLockKey(organizationID string) string {
+	return "directory_sync:lock:" + organizationID
+}
+
+func (q *directorySyncQueries) LockSync(organizationID string, ttl time.Duration) (bool, error) {
+	return q.redis.SetNX(q.ctx, directorySyncLockKey(organizationID), time.Now().Unix(), ttl).Result()
+}
+
+func (q *directorySyncQueries) UnlockSync(organizationID string) error {
+	return q.redis.Del(q.ctx, directorySyncLockKey(organizationID)).Err()
+}
@@ -0,0 +1,161 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/database"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// EmailTemplateQueries stores the versions of organizations' email templates
+type EmailTemplateQueries interface {
+	WithTx(tx *sql.Tx) EmailTemplateQueries
+	WithContext(ctx context.Context) EmailTemplateQueries
+
+	// ListCurrentTemplates returns the latest version of each kind the
+	// organization customized
+	ListCurrentTemplates(organizationID string) ([]models.EmailTemplate, error)
+	// GetCurrentTemplate returns the latest version of a kind, or nil when
+	// the organization uses the built-in email
+	GetCurrentTemplate(organizationID, kind string) (*models.EmailTemplate, error)
+	// ListTemplateVersions returns the versions of a kind, newest first
+	ListTemplateVersions(organizationID, kind string) ([]models.EmailTemplate, error)
+	// GetTemplateVersion returns one version of a kind
+	GetTemplateVersion(organizationID, kind string, version int) (*models.EmailTemplate, error)
+	// CreateTemplateVersion saves a template as the next version of its kind
+	CreateTemplateVersion(tmpl *models.EmailTemplate) error
+	// DeleteTemplates removes every version of a kind, returning the
+	// organization to the built-in email
+	DeleteTemplates(organizationID, kind string) (int64, error)
+}
+
+type emailTemplateQueries struct {
+	db    *database.DB
+	redis redis.UniversalClient
+	tx    *sql.Tx
+	ctx   context.Context
+}
+
+// NewEmailTemplateQueries creates a new EmailTemplateQueries instance
+func NewEmailTemplateQueries(db *database.DB, redis redis.UniversalClient) EmailTemplateQueries {
+	return &emailTemplateQueries{db: db, redis: redis, ctx: context.Background()}
+}
+
+func (q *emailTemplateQueries) WithTx(tx *sql.Tx) EmailTemplateQueries {
+	return &emailTemplateQueries{db: q.db, redis: q.redis, tx: tx, ctx: q.ctx}
+}
+
+func (q *emailTemplateQueries) WithContext(ctx context.Context) EmailTemplateQueries {
+	return &emailTemplateQueries{db: q.db, redis: q.redis, tx: q.tx, ctx: ctx}
+}
+
+func (q *emailTemplateQueries) conn() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.DB
+}
+
+const emailTemplateColumns = `organization_id, kind, version, subject, html_body, text_body, created_by, created_at`
+
+func scanEmailTemplate(row interface{ Scan(...interface{}) error }) (*models.EmailTemplate, error) {
+	var t models.EmailTemplate
+	if err := row.Scan(&t.OrganizationID, &t.Kind, &t.Version, &t.Subject, &t.HTMLBody, &t.TextBody,
+		&t.CreatedBy, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (q *emailTemplateQueries) listTemplates(query string, args ...interface{}) ([]models.EmailTemplate, error) {
+	rows, err := q.conn().QueryContext(q.ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list email templates: %w", err)
+	}
+	defer rows.Close()
+
+	templates := []models.EmailTemplate{}
+	for rows.Next() {
+		t, err := scanEmailTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan email template: %w", err)
+		}
+		templates = append(templates, *t)
+	}
+	return templates, rows.Err()
+}
+
+func (q *emailTemplateQueries) ListCurrentTemplates(organizationID string) ([]models.EmailTemplate, error) {
+	return q.listTemplates(`
+		SELECT DISTINCT ON (kind) `+emailTemplateColumns+`
+		FROM email_templates
+		WHERE organization_id = $1
+		ORDER BY kind, version DESC`, organizationID)
+}
+
+func (q *emailTemplateQueries) GetCurrentTemplate(organizationID, kind string) (*models.EmailTemplate, error) {
+	t, err := scanEmailTemplate(q.conn().QueryRowContext(q.ctx, `
+		SELECT `+emailTemplateColumns+`
+		FROM email_templates
+		WHERE organization_id = $1 AND kind = $2
+		ORDER BY version DESC
+		LIMIT 1`, organizationID, kind))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get email template: %w", err)
+	}
+	return t, nil
+}
+
+func (q *emailTemplateQueries) ListTemplateVersions(organizationID, kind string) ([]models.EmailTemplate, error) {
+	return q.listTemplates(`
+		SELECT `+emailTemplateColumns+`
+		FROM email_templates
+		WHERE organization_id = $1 AND kind = $2
+		ORDER BY version DESC`, organizationID, kind)
+}
+
+func (q *emailTemplateQueries) GetTemplateVersion(organizationID, kind string, version int) (*models.EmailTemplate, error) {
+	t, err := scanEmailTemplate(q.conn().QueryRowContext(q.ctx, `
+		SELECT `+emailTemplateColumns+`
+		FROM email_templates
+		WHERE organization_id = $1 AND kind = $2 AND version = $3`, organizationID, kind, version))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("email template version not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get email template version: %w", err)
+	}
+	return t, nil
+}
+
+func (q *emailTemplateQueries) CreateTemplateVersion(tmpl *models.EmailTemplate) error {
+	// Concurrent saves of the same kind collide on the primary key rather
+	// than overwrite each other
+	err := q.conn().QueryRowContext(q.ctx, `
+		INSERT INTO email_templates (organization_id, kind, version, subject, html_body, text_body, created_by)
+		SELECT $1, $2, COALESCE(MAX(version), 0) + 1, $3, $4, $5, $6
+		FROM email_templates
+		WHERE organization_id = $1 AND kind = $2
+		RETURNING version, created_at`,
+		tmpl.OrganizationID, tmpl.Kind, tmpl.Subject, tmpl.HTMLBody, tmpl.TextBody, tmpl.CreatedBy,
+	).Scan(&tmpl.Version, &tmpl.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save email template: %w", err)
+	}
+	return nil
+}
+
+func (q *emailTemplateQueries) DeleteTemplates(organizationID, kind string) (int64, error) {
+	res, err := q.conn().ExecContext(q.ctx,
+		`DELETE FROM email_templates WHERE organization_id = $1 AND kind = $2`, organizationID, kind)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete email templates: %w", err)
+	}
+	return res.RowsAffected()
+}
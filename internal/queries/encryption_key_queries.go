@@ -0,0 +1,119 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/database"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// EncryptionKeyQueries stores the wrapped data keys of field encryption.
+// They are deployment wide, not scoped to an organization.
+type EncryptionKeyQueries interface {
+	WithTx(tx *sql.Tx) EncryptionKeyQueries
+	WithContext(ctx context.Context) EncryptionKeyQueries
+
+	ListDataKeys() ([]models.DataEncryptionKey, error)
+	// CreateDataKey stores the first active key; it fails with a unique
+	// violation when there already is one
+	CreateDataKey(key *models.DataEncryptionKey) error
+	// RotateDataKey retires the active key and stores key as the active one
+	RotateDataKey(key *models.DataEncryptionKey) error
+	RewrapDataKey(id, masterKeyID string, wrapped []byte) error
+}
+
+type encryptionKeyQueries struct {
+	db    *database.DB
+	redis redis.UniversalClient
+	tx    *sql.Tx
+	ctx   context.Context
+}
+
+// NewEncryptionKeyQueries creates a new EncryptionKeyQueries instance
+func NewEncryptionKeyQueries(db *database.DB, redis redis.UniversalClient) EncryptionKeyQueries {
+	return &encryptionKeyQueries{db: db, redis: redis, ctx: context.Background()}
+}
+
+func (q *encryptionKeyQueries) WithTx(tx *sql.Tx) EncryptionKeyQueries {
+	return &encryptionKeyQueries{db: q.db, redis: q.redis, tx: tx, ctx: q.ctx}
+}
+
+func (q *encryptionKeyQueries) WithContext(ctx context.Context) EncryptionKeyQueries {
+	return &encryptionKeyQueries{db: q.db, redis: q.redis, tx: q.tx, ctx: ctx}
+}
+
+func (q *encryptionKeyQueries) conn() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.DB
+}
+
+func (q *encryptionKeyQueries) ListDataKeys() ([]models.DataEncryptionKey, error) {
+	rows, err := q.conn().QueryContext(q.ctx, `
+		SELECT id, master_key_id, wrapped_key, status, created_at, retired_at
+		FROM data_encryption_keys ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.DataEncryptionKey
+	for rows.Next() {
+		var key models.DataEncryptionKey
+		var retiredAt sql.NullTime
+		if err := rows.Scan(&key.ID, &key.MasterKeyID, &key.WrappedKey, &key.Status, &key.CreatedAt, &retiredAt); err != nil {
+			return nil, err
+		}
+		if retiredAt.Valid {
+			key.RetiredAt = &retiredAt.Time
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (q *encryptionKeyQueries) insert(conn DBTX, key *models.DataEncryptionKey) error {
+	key.Status = "active"
+	return conn.QueryRowContext(q.ctx, `
+		INSERT INTO data_encryption_keys (master_key_id, wrapped_key, status)
+		VALUES ($1, $2, 'active')
+		RETURNING id, created_at`,
+		key.MasterKeyID, key.WrappedKey,
+	).Scan(&key.ID, &key.CreatedAt)
+}
+
+func (q *encryptionKeyQueries) CreateDataKey(key *models.DataEncryptionKey) error {
+	return q.insert(q.conn(), key)
+}
+
+func (q *encryptionKeyQueries) RotateDataKey(key *models.DataEncryptionKey) error {
+	if q.tx != nil {
+		return q.rotate(q.tx, key)
+	}
+	tx, err := q.db.BeginTx(q.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := q.rotate(tx, key); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (q *encryptionKeyQueries) rotate(tx *sql.Tx, key *models.DataEncryptionKey) error {
+	if _, err := tx.ExecContext(q.ctx,
+		`UPDATE data_encryption_keys SET status = 'retired', retired_at = NOW() WHERE status = 'active'`); err != nil {
+		return err
+	}
+	return q.insert(tx, key)
+}
+
+func (q *encryptionKeyQueries) RewrapDataKey(id, masterKeyID string, wrapped []byte) error {
+	_, err := q.conn().ExecContext(q.ctx,
+		`UPDATE data_encryption_keys SET master_key_id = $2, wrapped_key = $3 WHERE id = $1`, id, masterKeyID, wrapped)
+	return err
+}
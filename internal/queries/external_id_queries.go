@@ -0,0 +1,144 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/database"
+)
+
+// Kinds of resources that can carry an external ID
+const (
+	ExternalKindOrganization   = "organization"
+	ExternalKindRole           = "role"
+	ExternalKindPolicy         = "policy"
+	ExternalKindOAuthClient    = "oauth_client"
+	ExternalKindServiceAccount = "service_account"
+	ExternalKindGroup          = "group"
+)
+
+// externalTables maps each kind to its table and the column scoping it to
+// an organization. Organizations are scoped by their own ID, so their
+// external IDs are unique across the deployment.
+var externalTables = map[string]struct{ table, scope string }{
+	ExternalKindOrganization:   {"organizations", "id"},
+	ExternalKindRole:           {"roles", "organization_id"},
+	ExternalKindPolicy:         {"policies", "organization_id"},
+	ExternalKindOAuthClient:    {"oauth_clients", "organization_id"},
+	ExternalKindServiceAccount: {"service_accounts", "organization_id"},
+	ExternalKindGroup:          {"groups", "organization_id"},
+}
+
+// ExternalIDQueries maps the stable IDs infrastructure-as-code tools assign
+// to managed resources onto the resources' own IDs
+type ExternalIDQueries interface {
+	WithTx(tx *sql.Tx) ExternalIDQueries
+	WithContext(ctx context.Context) ExternalIDQueries
+
+	// Resolve returns the ID of the resource of kind with externalID in the
+	// organization. organizationID is ignored for organizations.
+	Resolve(kind, organizationID, externalID string) (string, error)
+	// Get returns the external ID of a resource, empty when it has none
+	Get(kind, organizationID, id string) (string, error)
+	// Set binds externalID to a resource that has no external ID yet; it
+	// fails with a conflict when the resource is bound to another one
+	Set(kind, organizationID, id, externalID string) error
+}
+
+type externalIDQueries struct {
+	db    *database.DB
+	redis redis.UniversalClient
+	tx    *sql.Tx
+	ctx   context.Context
+}
+
+func NewExternalIDQueries(db *database.DB, redis redis.UniversalClient) ExternalIDQueries {
+	return &externalIDQueries{db: db, redis: redis, ctx: context.Background()}
+}
+
+func (q *externalIDQueries) WithTx(tx *sql.Tx) ExternalIDQueries {
+	return &externalIDQueries{db: q.db, redis: q.redis, tx: tx, ctx: q.ctx}
+}
+
+func (q *externalIDQueries) WithContext(ctx context.Context) ExternalIDQueries {
+	return &externalIDQueries{db: q.db, redis: q.redis, tx: q.tx, ctx: ctx}
+}
+
+func (q *externalIDQueries) conn() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.DB
+}
+
+func externalTable(kind string) (string, string, error) {
+	t, ok := externalTables[kind]
+	if !ok {
+		return "", "", fmt.Errorf("unknown resource kind %q", kind)
+	}
+	return t.table, t.scope, nil
+}
+
+func (q *externalIDQueries) Resolve(kind, organizationID, externalID string) (string, error) {
+	table, scope, err := externalTable(kind)
+	if err != nil {
+		return "", err
+	}
+	query := `SELECT id FROM ` + table + ` WHERE external_id = $1 AND deleted_at IS NULL`
+	args := []interface{}{externalID}
+	if scope != "id" {
+		query += ` AND ` + scope + ` = $2`
+		args = append(args, organizationID)
+	}
+
+	var id string
+	err = q.conn().QueryRowContext(q.ctx, query, args...).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("%s with external ID %q not found", kind, externalID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve external ID: %w", err)
+	}
+	return id, nil
+}
+
+func (q *externalIDQueries) Get(kind, organizationID, id string) (string, error) {
+	table, scope, err := externalTable(kind)
+	if err != nil {
+		return "", err
+	}
+	var externalID sql.NullString
+	err = q.conn().QueryRowContext(q.ctx,
+		`SELECT external_id FROM `+table+` WHERE id = $1 AND `+scope+` = $2 AND deleted_at IS NULL`,
+		id, organizationID).Scan(&externalID)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("%s not found", kind)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get external ID: %w", err)
+	}
+	return externalID.String, nil
+}
+
+func (q *externalIDQueries) Set(kind, organizationID, id, externalID string) error {
+	table, scope, err := externalTable(kind)
+	if err != nil {
+		return err
+	}
+	result, err := q.conn().ExecContext(q.ctx, `
+		UPDATE `+table+` SET external_id = $3
+		WHERE id = $1 AND `+scope+` = $2 AND deleted_at IS NULL
+		  AND (external_id IS NULL OR external_id = $3)`,
+		id, organizationID, externalID)
+	if err != nil {
+		// The unique index refuses an external ID another resource holds
+		return fmt.Errorf("failed to set external ID: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("external ID conflict: %s not found or bound to another external ID", kind)
+	}
+	return nil
+}
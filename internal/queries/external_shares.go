@@ -0,0 +1,206 @@
+package queries
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// ExternalShareFilter narrows ListExternalShares. Empty fields match
+// everything; Active selects the shares that are neither revoked nor
+// expired, or the others.
+type ExternalShareFilter struct {
+	ResourceType string
+	ResourceID   string
+	GuestEmail   string
+	Active       *bool
+}
+
+const externalShareColumns = `
+	es.id, es.organization_id, es.guest_id, g.email, es.resource_type, es.resource_id, es.access_level,
+	es.shared_by::text, es.expires_at, es.last_access_at, es.revoked_at, es.revoked_by::text, es.created_at`
+
+func scanExternalShare(row interface{ Scan(...interface{}) error }) (*models.ExternalShare, error) {
+	var s models.ExternalShare
+	if err := row.Scan(&s.ID, &s.OrganizationID, &s.GuestID, &s.GuestEmail, &s.ResourceType, &s.ResourceID,
+		&s.AccessLevel, &s.SharedBy, &s.ExpiresAt, &s.LastAccessAt, &s.RevokedAt, &s.RevokedBy, &s.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// UpsertGuestPrincipal returns the guest of the organization with the email
+// address, creating it if needed
+func (q *resourceQueries) UpsertGuestPrincipal(organizationID, email, createdBy string) (*models.GuestPrincipal, error) {
+	var g models.GuestPrincipal
+	err := q.conn().QueryRowContext(q.ctx, `
+		INSERT INTO guest_principals (organization_id, email, created_by)
+		VALUES ($1, $2, NULLIF($3, '')::uuid)
+		ON CONFLICT (organization_id, email) DO UPDATE SET email = EXCLUDED.email
+		RETURNING id, organization_id, email, created_by::text, last_access_at, created_at`,
+		organizationID, email, createdBy).Scan(&g.ID, &g.OrganizationID, &g.Email, &g.CreatedBy, &g.LastAccessAt, &g.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create guest principal: %w", err)
+	}
+	return &g, nil
+}
+
+// CreateExternalShare shares an item with a guest, replacing the open
+// share of the guest on it if any, and fills in the ID and creation time
+func (q *resourceQueries) CreateExternalShare(share *models.ExternalShare) error {
+	err := q.conn().QueryRowContext(q.ctx, `
+		INSERT INTO external_shares (organization_id, guest_id, resource_type, resource_id, access_level, shared_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (guest_id, resource_type, resource_id) WHERE revoked_at IS NULL
+		DO UPDATE SET access_level = EXCLUDED.access_level, shared_by = EXCLUDED.shared_by,
+		              expires_at = EXCLUDED.expires_at, created_at = NOW()
+		RETURNING id, created_at`,
+		share.OrganizationID, share.GuestID, share.ResourceType, share.ResourceID, share.AccessLevel,
+		share.SharedBy, share.ExpiresAt).Scan(&share.ID, &share.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create external share: %w", err)
+	}
+	return nil
+}
+
+// ListExternalShares returns the shares of the organization with guests
+// matching the filter, the newest first
+func (q *resourceQueries) ListExternalShares(organizationID string, filter ExternalShareFilter, params ListParams) (*ListResult[*models.ExternalShare], error) {
+	ks, err := newKeyset(params, "created_at", "es.created_at", "es.id", "DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	where := []string{"es.organization_id = $1"}
+	args := []interface{}{organizationID}
+	add := func(cond string, v interface{}) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if filter.ResourceType != "" {
+		add("es.resource_type = $%d", filter.ResourceType)
+	}
+	if filter.ResourceID != "" {
+		add("es.resource_id = $%d", filter.ResourceID)
+	}
+	if filter.GuestEmail != "" {
+		add("g.email = $%d", strings.ToLower(filter.GuestEmail))
+	}
+	if filter.Active != nil {
+		if *filter.Active {
+			where = append(where, "es.revoked_at IS NULL AND es.expires_at > NOW()")
+		} else {
+			where = append(where, "(es.revoked_at IS NOT NULL OR es.expires_at <= NOW())")
+		}
+	}
+	whereClause := strings.Join(where, " AND ")
+	from := " FROM external_shares es JOIN guest_principals g ON g.id = es.guest_id WHERE "
+
+	var total int
+	if err := q.reader().QueryRowContext(q.ctx, "SELECT COUNT(*)"+from+whereClause, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("failed to count external shares: %w", err)
+	}
+
+	pageWhere := whereClause
+	pageArgs := append([]interface{}{}, args...)
+	if clause, cursorArgs := ks.where(len(pageArgs) + 1); clause != "" {
+		pageWhere += " AND " + clause
+		pageArgs = append(pageArgs, cursorArgs...)
+	}
+	query := fmt.Sprintf("SELECT %s%s%s ORDER BY %s LIMIT $%d OFFSET $%d",
+		externalShareColumns, from, pageWhere, ks.orderBy(), len(pageArgs)+1, len(pageArgs)+2)
+	pageArgs = append(pageArgs, ks.limit(params.Limit), ks.offset(params.Offset))
+
+	rows, err := q.reader().QueryContext(q.ctx, query, pageArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list external shares: %w", err)
+	}
+	defer rows.Close()
+
+	shares := []*models.ExternalShare{}
+	for rows.Next() {
+		s, err := scanExternalShare(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan external share: %w", err)
+		}
+		shares = append(shares, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list external shares: %w", err)
+	}
+
+	shares, hasMore, nextCursor := page(ks, shares, params.Limit, func(s *models.ExternalShare) (string, string) {
+		return cursorTime(s.CreatedAt), s.ID
+	})
+	return &ListResult[*models.ExternalShare]{
+		Items:      shares,
+		Total:      int64(total),
+		Limit:      params.Limit,
+		Offset:     ks.offset(params.Offset),
+		HasMore:    hasMore,
+		TotalPages: (total + params.Limit - 1) / params.Limit,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// GetExternalShare retrieves one share of the organization with a guest
+func (q *resourceQueries) GetExternalShare(id, organizationID string) (*models.ExternalShare, error) {
+	s, err := scanExternalShare(q.conn().QueryRowContext(q.ctx, `SELECT `+externalShareColumns+`
+		FROM external_shares es JOIN guest_principals g ON g.id = es.guest_id
+		WHERE es.id = $1 AND es.organization_id = $2`, id, organizationID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("external share not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get external share: %w", err)
+	}
+	return s, nil
+}
+
+// RevokeExternalShare revokes a share of the organization with a guest.
+// With a resource type, the share must be of that item; admins revoke any.
+func (q *resourceQueries) RevokeExternalShare(id, organizationID, resourceType, resourceID, revokedBy string) error {
+	query := `
+		UPDATE external_shares SET revoked_at = NOW(), revoked_by = NULLIF($3, '')::uuid
+		WHERE id = $1 AND organization_id = $2 AND revoked_at IS NULL`
+	args := []interface{}{id, organizationID, revokedBy}
+	if resourceType != "" {
+		query += ` AND resource_type = $4 AND resource_id = $5`
+		args = append(args, resourceType, resourceID)
+	}
+	res, err := q.conn().ExecContext(q.ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to revoke external share: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("external share not found")
+	}
+	return nil
+}
+
+// TouchExternalShare records an access by the guest of a share of the
+// organization that is neither revoked nor expired, and returns it
+func (q *resourceQueries) TouchExternalShare(id, organizationID string) (*models.ExternalShare, error) {
+	s, err := scanExternalShare(q.conn().QueryRowContext(q.ctx, `
+		WITH touched AS (
+			UPDATE external_shares SET last_access_at = NOW()
+			WHERE id = $1 AND organization_id = $2 AND revoked_at IS NULL AND expires_at > NOW()
+			RETURNING *
+		), g AS (
+			UPDATE guest_principals gp SET last_access_at = NOW()
+			FROM touched t
+			WHERE gp.id = t.guest_id
+			RETURNING gp.id, gp.email
+		)
+		SELECT `+externalShareColumns+`
+		FROM touched es JOIN g ON g.id = es.guest_id`, id, organizationID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("external share not usable")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to access external share: %w", err)
+	}
+	return s, nil
+}
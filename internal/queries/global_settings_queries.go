@@ -22,11 +22,11 @@ type globalSettingsQueries struct {
 	db    *database.DB
 	tx    *sql.Tx
 	ctx   context.Context
-	redis *redis.Client
+	redis redis.UniversalClient
 }
 
 // NewGlobalSettingsQueries creates a new GlobalSettingsQueries instance
-func NewGlobalSettingsQueries(db *database.DB, redis *redis.Client) GlobalSettingsQueries {
+func NewGlobalSettingsQueries(db *database.DB, redis redis.UniversalClient) GlobalSettingsQueries {
 	return &globalSettingsQueries{
 		db:    db,
 		ctx:   context.Background(),
@@ -148,20 +148,7 @@ func (q *globalSettingsQueries) UpdateGlobalSettings(settings models.GlobalSetti
 
 // CreateDefaultGlobalSettings creates default global settings
 func (q *globalSettingsQueries) CreateDefaultGlobalSettings() (*models.GlobalSettings, error) {
-	settings := models.GlobalSettings{
-		ID:                      "default",
-		MaintenanceMode:         false,
-		MaintenanceMessage:      "",
-		MaxUsersPerOrganization: 1000,
-		MaxSessionDuration:      480, // 8 hours
-		PasswordMinLength:       8,
-		RequireMFA:              false,
-		AllowRegistration:       true,
-		EmailVerificationReq:    true,
-		TokenExpirationMinutes:  60,
-		AuditLogRetentionDays:   90,
-		Settings:                "{}",
-	}
+	settings := models.DefaultGlobalSettings()
 
 	query := `
 		INSERT INTO global_settings (
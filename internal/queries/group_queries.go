@@ -26,11 +26,14 @@ type GroupQueries interface {
 	ListGroups(params ListParams, orgID string) (*ListResult[models.Group], error)
 	CreateGroup(g *models.Group) error
 	GetGroup(id, organizationID string) (*models.Group, error)
+	// GetGroupByName returns the group of an organization with a name
+	GetGroupByName(name, organizationID string) (*models.Group, error)
 	UpdateGroup(g *models.Group, organizationID string) error
 	DeleteGroup(id, organizationID string) error
 
 	// Membership
 	ListGroupMembers(groupID, organizationID string) ([]models.GroupMembership, error)
+	ListPrincipalGroupMemberships(principalID, principalType, organizationID string) ([]models.GroupMembership, error)
 	AddGroupMember(m *models.GroupMembership, organizationID string) error
 	RemoveGroupMember(groupID, organizationID, principalID, principalType string) error
 
@@ -40,12 +43,12 @@ type GroupQueries interface {
 
 type groupQueries struct {
 	db    *database.DB
-	redis *redis.Client
+	redis redis.UniversalClient
 	tx    *sql.Tx
 	ctx   context.Context
 }
 
-func NewGroupQueries(db *database.DB, redis *redis.Client) GroupQueries {
+func NewGroupQueries(db *database.DB, redis redis.UniversalClient) GroupQueries {
 	return &groupQueries{db: db, redis: redis, ctx: context.Background()}
 }
 
@@ -81,6 +84,15 @@ func (q *groupQueries) queryRow(query string, args ...interface{}) *sql.Row {
 	return q.db.QueryRowContext(q.ctx, query, args...)
 }
 
+// reader returns the connection for reads that tolerate replication lag:
+// the transaction if there is one, otherwise a replica
+func (q *groupQueries) reader() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.Reader()
+}
+
 func (q *groupQueries) ListGroups(params ListParams, orgID string) (*ListResult[models.Group], error) {
 	base := `SELECT ` + groupSelectCols + `, COUNT(*) OVER() as total_count FROM groups WHERE status != 'deleted'`
 	args := []interface{}{}
@@ -100,7 +112,18 @@ func (q *groupQueries) ListGroups(params ListParams, orgID string) (*ListResult[
 	if strings.ToUpper(params.Order) == "ASC" {
 		order = "ASC"
 	}
-	base += fmt.Sprintf(" ORDER BY %s %s", sortBy, order)
+	ks, err := newKeyset(params, sortBy, sortBy, "id", order)
+	if err != nil {
+		return nil, err
+	}
+	// The window count is evaluated before the cursor predicate so that the
+	// total always covers the whole result set
+	base = "SELECT * FROM (" + base + ") page"
+	if clause, cursorArgs := ks.where(len(args) + 1); clause != "" {
+		base += " WHERE " + clause
+		args = append(args, cursorArgs...)
+	}
+	base += " ORDER BY " + ks.orderBy()
 	// Pagination placeholders
 	limit := params.Limit
 	if limit <= 0 || limit > 200 {
@@ -110,15 +133,9 @@ func (q *groupQueries) ListGroups(params ListParams, orgID string) (*ListResult[
 	if offset < 0 {
 		offset = 0
 	}
-	// add limit/offset arguments adjusting indexes
-	if len(args) == 0 {
-		base += " LIMIT $1 OFFSET $2"
-		args = append(args, limit, offset)
-	} else {
-		base += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
-		args = append(args, limit, offset)
-	}
-	rows, err := q.query(base, args...)
+	base += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, ks.limit(limit), ks.offset(offset))
+	rows, err := q.reader().QueryContext(q.ctx, base, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -132,7 +149,18 @@ func (q *groupQueries) ListGroups(params ListParams, orgID string) (*ListResult[
 		}
 		list = append(list, g)
 	}
-	return &ListResult[models.Group]{Items: list, Total: total, Limit: limit, Offset: offset, HasMore: int64(offset+len(list)) < total}, nil
+	list, hasMore, nextCursor := page(ks, list, limit, func(g models.Group) (string, string) {
+		switch sortBy {
+		case "name":
+			return g.Name, g.ID
+		case "group_type":
+			return g.GroupType, g.ID
+		case "updated_at":
+			return cursorTime(g.UpdatedAt), g.ID
+		}
+		return cursorTime(g.CreatedAt), g.ID
+	})
+	return &ListResult[models.Group]{Items: list, Total: total, Limit: limit, Offset: ks.offset(offset), HasMore: hasMore, NextCursor: nextCursor}, nil
 }
 
 func (q *groupQueries) CreateGroup(g *models.Group) error {
@@ -165,6 +193,19 @@ func (q *groupQueries) GetGroup(id, organizationID string) (*models.Group, error
 	return &g, nil
 }
 
+func (q *groupQueries) GetGroupByName(name, organizationID string) (*models.Group, error) {
+	stmt := `SELECT ` + groupSelectCols + ` FROM groups WHERE name=$1 AND organization_id=$2 AND status != 'deleted'`
+	var g models.Group
+	err := q.queryRow(stmt, name, organizationID).Scan(&g.ID, &g.Name, &g.Description, &g.OrganizationID, &g.ParentGroupID, &g.GroupType, &g.Attributes, &g.MaxMembers, &g.Status, &g.CreatedAt, &g.UpdatedAt, &g.DeletedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("group not found")
+		}
+		return nil, err
+	}
+	return &g, nil
+}
+
 func (q *groupQueries) UpdateGroup(g *models.Group, organizationID string) error {
 	stmt := `UPDATE groups SET name=$2, description=$3, parent_group_id=$4, group_type=$5, attributes=$6, max_members=$7, status=$8, updated_at=NOW() WHERE id=$1 AND organization_id=$9 AND status != 'deleted' RETURNING updated_at`
 	err := q.queryRow(stmt, g.ID, g.Name, g.Description, g.ParentGroupID, g.GroupType, g.Attributes, g.MaxMembers, g.Status, organizationID).Scan(&g.UpdatedAt)
@@ -199,13 +240,12 @@ func (q *groupQueries) DeleteGroup(id, organizationID string) error {
 func (q *groupQueries) ListGroupMembers(groupID, organizationID string) ([]models.GroupMembership, error) {
 	stmt := `
 		SELECT 
-			gm.id, gm.group_id, gm.principal_id, gm.principal_type, gm.role_in_group, gm.joined_at, gm.expires_at, gm.added_by,
-			COALESCE(u.display_name, u.username, sa.name, 'Unknown') as name,
-			COALESCE(u.email, '') as email
+			gm.id, gm.group_id, gm.principal_id, gm.principal_type, gm.role_in_group, gm.joined_at, gm.expires_at, COALESCE(gm.added_by::text, ''),
+			COALESCE(p.display_name, 'Unknown') as name,
+			COALESCE(p.email, '') as email
 		FROM group_memberships gm
 		JOIN groups g ON gm.group_id = g.id
-		LEFT JOIN users u ON gm.principal_id = u.id AND gm.principal_type = 'user'
-		LEFT JOIN service_accounts sa ON gm.principal_id = sa.id AND gm.principal_type = 'service_account'
+		LEFT JOIN principals p ON p.id = gm.principal_id AND p.principal_type = gm.principal_type
 		WHERE gm.group_id = $1 AND g.organization_id = $2`
 	rows, err := q.query(stmt, groupID, organizationID)
 	if err != nil {
@@ -223,6 +263,36 @@ func (q *groupQueries) ListGroupMembers(groupID, organizationID string) ([]model
 	return members, nil
 }
 
+// ListPrincipalGroupMemberships returns the groups a principal belongs to.
+// The Name field carries the group name.
+func (q *groupQueries) ListPrincipalGroupMemberships(principalID, principalType, organizationID string) ([]models.GroupMembership, error) {
+	stmt := `
+		SELECT gm.id, gm.group_id, gm.principal_id, gm.principal_type, COALESCE(gm.role_in_group, 'member'),
+		       gm.joined_at, gm.expires_at, COALESCE(gm.added_by::text, ''), g.name
+		FROM group_memberships gm
+		JOIN groups g ON gm.group_id = g.id
+		WHERE gm.principal_id = $1 AND gm.principal_type = $2 AND g.organization_id = $3 AND g.status != 'deleted'
+		ORDER BY gm.joined_at DESC`
+	rows, err := q.query(stmt, principalID, principalType, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var memberships []models.GroupMembership
+	for rows.Next() {
+		var m models.GroupMembership
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&m.ID, &m.GroupID, &m.PrincipalID, &m.PrincipalType, &m.RoleInGroup, &m.JoinedAt, &expiresAt, &m.AddedBy, &m.Name); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			m.ExpiresAt = expiresAt.Time
+		}
+		memberships = append(memberships, m)
+	}
+	return memberships, rows.Err()
+}
+
 func (q *groupQueries) AddGroupMember(m *models.GroupMembership, organizationID string) error {
 	// Verify group exists in organization
 	var exists bool
@@ -236,7 +306,7 @@ func (q *groupQueries) AddGroupMember(m *models.GroupMembership, organizationID
 	}
 
 	stmt := `INSERT INTO group_memberships (id, group_id, principal_id, principal_type, role_in_group, expires_at, added_by)
-			 VALUES ($1,$2,$3,$4,$5,$6,$7)
+			 VALUES ($1,$2,$3,$4,$5,$6,NULLIF($7, '')::uuid)
 			 ON CONFLICT (group_id, principal_id, principal_type) DO UPDATE SET role_in_group=EXCLUDED.role_in_group, expires_at=EXCLUDED.expires_at
 			 RETURNING joined_at`
 	return q.queryRow(stmt, m.ID, m.GroupID, m.PrincipalID, m.PrincipalType, m.RoleInGroup, m.ExpiresAt, m.AddedBy).Scan(&m.JoinedAt)
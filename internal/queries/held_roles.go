@@ -0,0 +1,94 @@
+package queries
+
+import (
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// heldRoles lists the role names each user and service account of
+// organization $1 holds, directly or through a group, as
+// (principal_id, principal_type, name) rows
+const heldRoles = `
+	WITH held AS (
+		SELECT ra.principal_id, ra.principal_type::text AS principal_type, r.name
+		FROM role_assignments ra
+		JOIN roles r ON r.id = ra.role_id
+		WHERE r.organization_id = $1 AND r.status != 'deleted'
+		  AND ra.principal_type IN ('user', 'service_account')
+		  AND (ra.expires_at IS NULL OR ra.expires_at > NOW())
+
+		UNION
+
+		SELECT gm.principal_id, gm.principal_type::text, r.name
+		FROM group_memberships gm
+		JOIN role_assignments ra ON ra.principal_id = gm.group_id AND ra.principal_type = 'group'
+		JOIN roles r ON r.id = ra.role_id
+		WHERE r.organization_id = $1 AND r.status != 'deleted'
+		  AND gm.principal_type IN ('user', 'service_account')
+		  AND (ra.expires_at IS NULL OR ra.expires_at > NOW())
+		  AND (gm.expires_at IS NULL OR gm.expires_at > NOW())
+	)`
+
+// PrincipalRoles is the role names held by one principal
+type PrincipalRoles struct {
+	PrincipalID   string
+	PrincipalType string
+	Roles         []string
+}
+
+// GetHeldRoleNames returns the names of the unexpired roles a principal of
+// the organization holds, directly or through a group
+func (q *roleQueries) GetHeldRoleNames(principalID, principalType, organizationID string) ([]string, error) {
+	var roles []string
+	err := q.conn().QueryRowContext(q.ctx, heldRoles+`
+		SELECT COALESCE(array_agg(DISTINCT name), '{}') FROM held
+		WHERE principal_id = $2 AND principal_type = $3`,
+		organizationID, principalID, principalType).Scan(pq.Array(&roles))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get held roles: %w", err)
+	}
+	return roles, nil
+}
+
+// GetGroupRoleNames returns the names of the unexpired roles assigned to a
+// group of the organization, which its members hold
+func (q *roleQueries) GetGroupRoleNames(groupID, organizationID string) ([]string, error) {
+	var roles []string
+	err := q.conn().QueryRowContext(q.ctx, `
+		SELECT COALESCE(array_agg(DISTINCT r.name), '{}')
+		FROM role_assignments ra
+		JOIN roles r ON r.id = ra.role_id
+		WHERE ra.principal_id = $1 AND ra.principal_type = 'group'
+		  AND r.organization_id = $2 AND r.status != 'deleted'
+		  AND (ra.expires_at IS NULL OR ra.expires_at > NOW())`,
+		groupID, organizationID).Scan(pq.Array(&roles))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group roles: %w", err)
+	}
+	return roles, nil
+}
+
+// ListHeldRoleNames returns the role names held by every user and service
+// account of the organization that holds more than one role
+func (q *roleQueries) ListHeldRoleNames(organizationID string) ([]PrincipalRoles, error) {
+	rows, err := q.reader().QueryContext(q.ctx, heldRoles+`
+		SELECT principal_id, principal_type, array_agg(DISTINCT name) FROM held
+		GROUP BY principal_id, principal_type
+		HAVING COUNT(DISTINCT name) > 1
+		ORDER BY principal_type, principal_id`, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list held roles: %w", err)
+	}
+	defer rows.Close()
+
+	var held []PrincipalRoles
+	for rows.Next() {
+		var p PrincipalRoles
+		if err := rows.Scan(&p.PrincipalID, &p.PrincipalType, pq.Array(&p.Roles)); err != nil {
+			return nil, fmt.Errorf("failed to scan held roles: %w", err)
+		}
+		held = append(held, p)
+	}
+	return held, rows.Err()
+}
@@ -0,0 +1,113 @@
+package queries
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// dormantUsers selects the active users of organization $1 who have not
+// signed in since $2, except those listed in $3 or members of the groups
+// listed in $4
+const dormantUsers = `
+	u.organization_id = $1 AND u.status = 'active' AND u.deleted_at IS NULL
+	AND COALESCE(u.last_login, u.created_at) < $2
+	AND NOT (u.id = ANY($3::uuid[]))
+	AND NOT EXISTS (
+		SELECT 1 FROM group_memberships gm
+		WHERE gm.principal_id = u.id AND gm.principal_type = 'user' AND gm.group_id = ANY($4::uuid[])
+		  AND (gm.expires_at IS NULL OR gm.expires_at > NOW())
+	)`
+
+// FlagDormantUsers marks the users of the organization who have not signed
+// in since inactiveSince as dormant and returns those newly flagged. Flags
+// of users who are no longer dormant, because the policy or its exemptions
+// changed, are cleared.
+func (q *userQueries) FlagDormantUsers(organizationID string, inactiveSince time.Time, exemptUsers, exemptGroups []string) ([]models.DormantUser, error) {
+	args := []interface{}{organizationID, inactiveSince, pq.Array(exemptUsers), pq.Array(exemptGroups)}
+	if _, err := q.exec(`
+		UPDATE users SET dormant_since = NULL
+		WHERE organization_id = $1 AND dormant_since IS NOT NULL
+		  AND id NOT IN (SELECT u.id FROM users u WHERE `+dormantUsers+`)`, args...); err != nil {
+		return nil, fmt.Errorf("failed to clear dormant flags: %w", err)
+	}
+
+	rows, err := q.query(`
+		UPDATE users u SET dormant_since = NOW()
+		WHERE `+dormantUsers+` AND u.dormant_since IS NULL
+		RETURNING u.id, u.username, u.email, COALESCE(u.display_name, ''), u.last_login, u.created_at, u.dormant_since`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to flag dormant users: %w", err)
+	}
+	defer rows.Close()
+	return scanDormantUsers(rows)
+}
+
+// SuspendDormantUsers suspends the users of the organization flagged as
+// dormant before flaggedBefore who are still dormant, and returns their IDs
+func (q *userQueries) SuspendDormantUsers(organizationID string, inactiveSince, flaggedBefore time.Time, exemptUsers, exemptGroups []string) ([]string, error) {
+	rows, err := q.query(`
+		UPDATE users u SET
+			status = 'suspended',
+			attributes = u.attributes || jsonb_build_object('suspension_reason', 'inactive'),
+			updated_at = NOW()
+		WHERE `+dormantUsers+` AND u.dormant_since < $5
+		RETURNING u.id`,
+		organizationID, inactiveSince, pq.Array(exemptUsers), pq.Array(exemptGroups), flaggedBefore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suspend dormant users: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ListDormantUsers returns the users of the organization who have not
+// signed in since inactiveSince, the longest inactive first, and their
+// total count
+func (q *userQueries) ListDormantUsers(organizationID string, inactiveSince time.Time, exemptUsers, exemptGroups []string, limit, offset int) ([]models.DormantUser, int, error) {
+	args := []interface{}{organizationID, inactiveSince, pq.Array(exemptUsers), pq.Array(exemptGroups)}
+	var total int
+	if err := q.reader().QueryRowContext(q.ctx, `SELECT COUNT(*) FROM users u WHERE `+dormantUsers, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count dormant users: %w", err)
+	}
+
+	rows, err := q.reader().QueryContext(q.ctx, `
+		SELECT u.id, u.username, u.email, COALESCE(u.display_name, ''), u.last_login, u.created_at, u.dormant_since
+		FROM users u
+		WHERE `+dormantUsers+`
+		ORDER BY COALESCE(u.last_login, u.created_at), u.id
+		LIMIT $5 OFFSET $6`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list dormant users: %w", err)
+	}
+	defer rows.Close()
+	users, err := scanDormantUsers(rows)
+	return users, total, err
+}
+
+func scanDormantUsers(rows interface {
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+}) ([]models.DormantUser, error) {
+	users := []models.DormantUser{}
+	for rows.Next() {
+		var u models.DormantUser
+		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.DisplayName, &u.LastLogin, &u.CreatedAt, &u.DormantSince); err != nil {
+			return nil, fmt.Errorf("failed to scan dormant user: %w", err)
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
@@ -0,0 +1,331 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/database"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// KMSQueries stores the named encryption keys of organizations, the wrapped
+// material of their versions and the grants to use them
+type KMSQueries interface {
+	WithTx(tx *sql.Tx) KMSQueries
+	WithContext(ctx context.Context) KMSQueries
+
+	ListKeys(organizationID string) ([]models.KMSKey, error)
+	GetKey(id, organizationID string) (*models.KMSKey, error)
+	// CreateKey stores a key with its first version
+	CreateKey(key *models.KMSKey, version *models.KMSKeyVersion) error
+	UpdateKey(key *models.KMSKey) error
+	// DeleteKey deletes a key with its material and grants; ciphertexts
+	// sealed with it can no longer be decrypted
+	DeleteKey(id, organizationID string) error
+	// RotateKey stores version as the next version of the key, which
+	// encrypts from then on
+	RotateKey(id, organizationID string, version *models.KMSKeyVersion) (*models.KMSKey, error)
+	GetKeyVersion(keyID, organizationID string, version int) (*models.KMSKeyVersion, error)
+
+	ListGrants(keyID, organizationID string) ([]models.KMSKeyGrant, error)
+	// PutGrant creates the grant of a principal on a key, or replaces its
+	// operations and expiry
+	PutGrant(grant *models.KMSKeyGrant) error
+	DeleteGrant(id, keyID, organizationID string) error
+	// OperationAllowed reports whether an unexpired grant on the key allows
+	// the principal, directly or through a group, the operation
+	OperationAllowed(keyID, organizationID, principalID, principalType, operation string) (bool, error)
+
+	// Key rotation, across organizations
+	ListRotationsDue(limit int) ([]models.KMSKey, error)
+}
+
+type kmsQueries struct {
+	db    *database.DB
+	redis redis.UniversalClient
+	tx    *sql.Tx
+	ctx   context.Context
+}
+
+// NewKMSQueries creates a new KMSQueries instance
+func NewKMSQueries(db *database.DB, redis redis.UniversalClient) KMSQueries {
+	return &kmsQueries{db: db, redis: redis, ctx: context.Background()}
+}
+
+func (q *kmsQueries) WithTx(tx *sql.Tx) KMSQueries {
+	return &kmsQueries{db: q.db, redis: q.redis, tx: tx, ctx: q.ctx}
+}
+
+func (q *kmsQueries) WithContext(ctx context.Context) KMSQueries {
+	return &kmsQueries{db: q.db, redis: q.redis, tx: q.tx, ctx: ctx}
+}
+
+func (q *kmsQueries) conn() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.DB
+}
+
+// inTx runs fn in the caller's transaction, or in one of its own
+func (q *kmsQueries) inTx(fn func(tx *sql.Tx) error) error {
+	if q.tx != nil {
+		return fn(q.tx)
+	}
+	tx, err := q.db.BeginTx(q.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const kmsKeyColumns = `id, organization_id, name, description, status, current_version,
+	rotation_period_days, rotated_at, created_by, created_at, updated_at`
+
+func scanKMSKey(row interface{ Scan(...interface{}) error }) (*models.KMSKey, error) {
+	var k models.KMSKey
+	var createdBy sql.NullString
+	if err := row.Scan(&k.ID, &k.OrganizationID, &k.Name, &k.Description, &k.Status, &k.CurrentVersion,
+		&k.RotationPeriodDays, &k.RotatedAt, &createdBy, &k.CreatedAt, &k.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if createdBy.Valid {
+		k.CreatedBy = &createdBy.String
+	}
+	return &k, nil
+}
+
+func (q *kmsQueries) listKeys(query string, args ...interface{}) ([]models.KMSKey, error) {
+	rows, err := q.conn().QueryContext(q.ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []models.KMSKey{}
+	for rows.Next() {
+		k, err := scanKMSKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan key: %w", err)
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+func (q *kmsQueries) ListKeys(organizationID string) ([]models.KMSKey, error) {
+	return q.listKeys(`SELECT `+kmsKeyColumns+` FROM kms_keys WHERE organization_id = $1 ORDER BY name`, organizationID)
+}
+
+func (q *kmsQueries) GetKey(id, organizationID string) (*models.KMSKey, error) {
+	k, err := scanKMSKey(q.conn().QueryRowContext(q.ctx,
+		`SELECT `+kmsKeyColumns+` FROM kms_keys WHERE id = $1 AND organization_id = $2`, id, organizationID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("key not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key: %w", err)
+	}
+	return k, nil
+}
+
+func (q *kmsQueries) CreateKey(key *models.KMSKey, version *models.KMSKeyVersion) error {
+	return q.inTx(func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(q.ctx, `
+			INSERT INTO kms_keys (organization_id, name, description, status, rotation_period_days, created_by)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id, current_version, rotated_at, created_at, updated_at`,
+			key.OrganizationID, key.Name, key.Description, key.Status, key.RotationPeriodDays, key.CreatedBy,
+		).Scan(&key.ID, &key.CurrentVersion, &key.RotatedAt, &key.CreatedAt, &key.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create key: %w", err)
+		}
+		version.KeyID, version.Version = key.ID, key.CurrentVersion
+		return q.insertVersion(tx, key.OrganizationID, version)
+	})
+}
+
+func (q *kmsQueries) insertVersion(tx *sql.Tx, organizationID string, v *models.KMSKeyVersion) error {
+	err := tx.QueryRowContext(q.ctx, `
+		INSERT INTO kms_key_versions (key_id, version, organization_id, master_key_id, wrapped_key)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at`,
+		v.KeyID, v.Version, organizationID, v.MasterKeyID, v.WrappedKey,
+	).Scan(&v.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to store key version: %w", err)
+	}
+	return nil
+}
+
+func (q *kmsQueries) UpdateKey(key *models.KMSKey) error {
+	err := q.conn().QueryRowContext(q.ctx, `
+		UPDATE kms_keys SET name = $3, description = $4, status = $5, rotation_period_days = $6, updated_at = NOW()
+		WHERE id = $1 AND organization_id = $2
+		RETURNING updated_at`,
+		key.ID, key.OrganizationID, key.Name, key.Description, key.Status, key.RotationPeriodDays,
+	).Scan(&key.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("key not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update key: %w", err)
+	}
+	return nil
+}
+
+func (q *kmsQueries) DeleteKey(id, organizationID string) error {
+	res, err := q.conn().ExecContext(q.ctx, `DELETE FROM kms_keys WHERE id = $1 AND organization_id = $2`, id, organizationID)
+	if err != nil {
+		return fmt.Errorf("failed to delete key: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("key not found")
+	}
+	return nil
+}
+
+func (q *kmsQueries) RotateKey(id, organizationID string, version *models.KMSKeyVersion) (*models.KMSKey, error) {
+	var key *models.KMSKey
+	err := q.inTx(func(tx *sql.Tx) error {
+		var err error
+		key, err = scanKMSKey(tx.QueryRowContext(q.ctx, `
+			UPDATE kms_keys SET current_version = current_version + 1, rotated_at = NOW(), updated_at = NOW()
+			WHERE id = $1 AND organization_id = $2
+			RETURNING `+kmsKeyColumns, id, organizationID))
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("key not found")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to rotate key: %w", err)
+		}
+		version.KeyID, version.Version = key.ID, key.CurrentVersion
+		return q.insertVersion(tx, organizationID, version)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (q *kmsQueries) GetKeyVersion(keyID, organizationID string, version int) (*models.KMSKeyVersion, error) {
+	v := models.KMSKeyVersion{KeyID: keyID, Version: version}
+	err := q.conn().QueryRowContext(q.ctx, `
+		SELECT master_key_id, wrapped_key, created_at FROM kms_key_versions
+		WHERE key_id = $1 AND organization_id = $2 AND version = $3`, keyID, organizationID, version,
+	).Scan(&v.MasterKeyID, &v.WrappedKey, &v.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("key version not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key version: %w", err)
+	}
+	return &v, nil
+}
+
+const kmsGrantColumns = `id, key_id, organization_id, principal_id, principal_type, operations, created_by, created_at, expires_at`
+
+func scanKMSGrant(row interface{ Scan(...interface{}) error }) (*models.KMSKeyGrant, error) {
+	var g models.KMSKeyGrant
+	var createdBy sql.NullString
+	if err := row.Scan(&g.ID, &g.KeyID, &g.OrganizationID, &g.PrincipalID, &g.PrincipalType,
+		pq.Array(&g.Operations), &createdBy, &g.CreatedAt, &g.ExpiresAt); err != nil {
+		return nil, err
+	}
+	if createdBy.Valid {
+		g.CreatedBy = &createdBy.String
+	}
+	return &g, nil
+}
+
+func (q *kmsQueries) ListGrants(keyID, organizationID string) ([]models.KMSKeyGrant, error) {
+	rows, err := q.conn().QueryContext(q.ctx, `
+		SELECT `+kmsGrantColumns+` FROM kms_key_grants
+		WHERE key_id = $1 AND organization_id = $2
+		ORDER BY created_at, id`, keyID, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list grants: %w", err)
+	}
+	defer rows.Close()
+
+	grants := []models.KMSKeyGrant{}
+	for rows.Next() {
+		g, err := scanKMSGrant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan grant: %w", err)
+		}
+		grants = append(grants, *g)
+	}
+	return grants, rows.Err()
+}
+
+func (q *kmsQueries) PutGrant(grant *models.KMSKeyGrant) error {
+	g, err := scanKMSGrant(q.conn().QueryRowContext(q.ctx, `
+		INSERT INTO kms_key_grants (key_id, organization_id, principal_id, principal_type, operations, created_by, expires_at)
+		SELECT k.id, k.organization_id, $3, $4, $5, $6, $7
+		FROM kms_keys k WHERE k.id = $1 AND k.organization_id = $2
+		ON CONFLICT (key_id, principal_id, principal_type)
+		DO UPDATE SET operations = EXCLUDED.operations, expires_at = EXCLUDED.expires_at
+		RETURNING `+kmsGrantColumns,
+		grant.KeyID, grant.OrganizationID, grant.PrincipalID, grant.PrincipalType,
+		pq.Array(grant.Operations), grant.CreatedBy, grant.ExpiresAt))
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("key not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store grant: %w", err)
+	}
+	*grant = *g
+	return nil
+}
+
+func (q *kmsQueries) DeleteGrant(id, keyID, organizationID string) error {
+	res, err := q.conn().ExecContext(q.ctx,
+		`DELETE FROM kms_key_grants WHERE id = $1 AND key_id = $2 AND organization_id = $3`, id, keyID, organizationID)
+	if err != nil {
+		return fmt.Errorf("failed to delete grant: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("grant not found")
+	}
+	return nil
+}
+
+func (q *kmsQueries) OperationAllowed(keyID, organizationID, principalID, principalType, operation string) (bool, error) {
+	var allowed bool
+	err := q.conn().QueryRowContext(q.ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM kms_key_grants g
+			WHERE g.key_id = $1 AND g.organization_id = $2 AND $5 = ANY(g.operations)
+			  AND (g.expires_at IS NULL OR g.expires_at > NOW())
+			  AND ((g.principal_type::text = $4 AND g.principal_id::text = $3)
+			    OR (g.principal_type = 'group' AND EXISTS (
+			        SELECT 1 FROM group_memberships m
+			        WHERE m.group_id = g.principal_id AND m.principal_id::text = $3
+			          AND m.principal_type::text = $4
+			          AND (m.expires_at IS NULL OR m.expires_at > NOW()))))
+		)`, keyID, organizationID, principalID, principalType, operation).Scan(&allowed)
+	if err != nil {
+		return false, fmt.Errorf("failed to check key grants: %w", err)
+	}
+	return allowed, nil
+}
+
+// ListRotationsDue returns up to limit enabled keys of every organization
+// whose rotation period has passed since they were last rotated, the most
+// overdue first
+func (q *kmsQueries) ListRotationsDue(limit int) ([]models.KMSKey, error) {
+	return q.listKeys(`
+		SELECT `+kmsKeyColumns+` FROM kms_keys
+		WHERE status = 'enabled' AND rotation_period_days > 0
+		  AND rotated_at + make_interval(days => rotation_period_days) <= NOW()
+		ORDER BY rotated_at + make_interval(days => rotation_period_days)
+		LIMIT $1`, limit)
+}
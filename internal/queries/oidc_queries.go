@@ -3,7 +3,9 @@ package queries
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/lib/pq"
 	"github.com/redis/go-redis/v9"
@@ -21,21 +23,64 @@ type OIDCQueries interface {
 	ListClientsByOrg(orgID string) ([]*models.OAuthClient, error)
 	UpdateClient(client *models.OAuthClient) error
 	DeleteClient(clientID, orgID string) error
+	// ListClientOrigins returns the allowed_origins of every client
+	ListClientOrigins() ([]string, error)
+	// SetClientTrust marks a client trusted and/or first-party, or neither
+	SetClientTrust(clientID, orgID string, trusted, firstParty bool) error
+	// RotateClientSecret replaces a client's secret. When previousValidUntil
+	// is set the old secret is also accepted until then.
+	RotateClientSecret(clientID, orgID, secretHash string, previousValidUntil *time.Time) error
+	// ListTrustedClients returns the trusted clients of an organization, or
+	// of every organization when orgID is empty
+	ListTrustedClients(orgID string) ([]*models.OAuthClient, error)
 
 	// Auth code management
 	SaveAuthCode(code *models.OIDCAuthCode) error
 	GetAuthCode(code string) (*models.OIDCAuthCode, error)
 	MarkAuthCodeUsed(code string) error
+
+	// Pushed authorization requests, kept in Redis until used or expired
+	SavePushedRequest(id string, req *models.PushedAuthorizationRequest) error
+	// GetPushedRequest returns nil when the request expired or was used
+	GetPushedRequest(id string) (*models.PushedAuthorizationRequest, error)
+	// DeletePushedRequest reports whether this call removed the request,
+	// so that of concurrent callers only one answers it
+	DeletePushedRequest(id string) (bool, error)
+
+	// Device authorization requests, kept in Redis under both codes until
+	// the client collects its tokens or they expire
+	SaveDeviceAuthorization(auth *models.DeviceAuthorization) error
+	// GetDeviceAuthorization returns nil when the request expired or was used
+	GetDeviceAuthorization(deviceCode string) (*models.DeviceAuthorization, error)
+	GetDeviceAuthorizationByUserCode(userCode string) (*models.DeviceAuthorization, error)
+	// DeleteDeviceAuthorization reports whether this call removed the
+	// device code, so that of concurrent polls only one redeems it
+	DeleteDeviceAuthorization(auth *models.DeviceAuthorization) (bool, error)
+
+	// Consent management
+	GetConsent(userID, clientID string) (*models.OAuthConsent, error)
+	SaveConsent(consent *models.OAuthConsent) error
+	ListConsentsByUser(userID, orgID string) ([]*models.OAuthConsent, error)
+	DeleteConsent(userID, orgID, clientID string) error
+
+	// Custom scopes and audiences
+	ListScopesByOrg(orgID string) ([]*models.OAuthScope, error)
+	CreateScope(scope *models.OAuthScope) error
+	UpdateScope(scope *models.OAuthScope) error
+	DeleteScope(id, orgID string) error
+	ListAudiencesByOrg(orgID string) ([]*models.OAuthAudience, error)
+	CreateAudience(audience *models.OAuthAudience) error
+	DeleteAudience(id, orgID string) error
 }
 
 type oidcQueries struct {
 	db    *database.DB
-	redis *redis.Client
+	redis redis.UniversalClient
 	ctx   context.Context
 	tx    *sql.Tx
 }
 
-func NewOIDCQueries(db *database.DB, redis *redis.Client) OIDCQueries {
+func NewOIDCQueries(db *database.DB, redis redis.UniversalClient) OIDCQueries {
 	return &oidcQueries{
 		db:    db,
 		redis: redis,
@@ -68,6 +113,13 @@ func (q *oidcQueries) exec(query string, args ...interface{}) (sql.Result, error
 	return q.db.ExecContext(q.ctx, query, args...)
 }
 
+func (q *oidcQueries) query(query string, args ...interface{}) (*sql.Rows, error) {
+	if q.tx != nil {
+		return q.tx.QueryContext(q.ctx, query, args...)
+	}
+	return q.db.QueryContext(q.ctx, query, args...)
+}
+
 func (q *oidcQueries) queryRow(query string, args ...interface{}) *sql.Row {
 	if q.tx != nil {
 		return q.tx.QueryRowContext(q.ctx, query, args...)
@@ -75,22 +127,51 @@ func (q *oidcQueries) queryRow(query string, args ...interface{}) *sql.Row {
 	return q.db.QueryRowContext(q.ctx, query, args...)
 }
 
-func (q *oidcQueries) GetClientByID(id string) (*models.OAuthClient, error) {
-	query := `
-		SELECT id, organization_id, client_name, client_secret_hash, redirect_uris, 
-		       grant_types, response_types, scope, is_public, is_trusted, 
-		       logo_url, policy_uri, tos_uri, created_at, updated_at
-		FROM oauth_clients
-		WHERE id = $1 AND deleted_at IS NULL`
+// oauthClientColumns are the columns scanOAuthClient reads
+const oauthClientColumns = `id, organization_id, client_name, client_secret_hash, redirect_uris,
+		       grant_types, response_types, scope, audiences, allowed_origins, allow_wildcards,
+		       is_public, is_trusted, is_first_party, logo_url, policy_uri, tos_uri, created_at, updated_at,
+		       COALESCE(previous_secret_hash, ''), previous_secret_expires_at, secret_rotated_at, token_policy`
 
+func scanOAuthClient(row interface{ Scan(...interface{}) error }) (*models.OAuthClient, error) {
 	client := &models.OAuthClient{}
-
-	err := q.queryRow(query, id).Scan(
+	var tokenPolicy []byte
+	err := row.Scan(
 		&client.ID, &client.OrganizationID, &client.ClientName, &client.ClientSecretHash,
-		pq.Array(&client.RedirectURIs), pq.Array(&client.GrantTypes), pq.Array(&client.ResponseTypes), &client.Scope, &client.IsPublic,
-		&client.IsTrusted, &client.LogoURL, &client.PolicyURI, &client.TosURI,
+		pq.Array(&client.RedirectURIs), pq.Array(&client.GrantTypes), pq.Array(&client.ResponseTypes), &client.Scope, pq.Array(&client.Audiences),
+		pq.Array(&client.AllowedOrigins), &client.AllowWildcards, &client.IsPublic,
+		&client.IsTrusted, &client.IsFirstParty, &client.LogoURL, &client.PolicyURI, &client.TosURI,
 		&client.CreatedAt, &client.UpdatedAt,
+		&client.PreviousSecretHash, &client.PreviousSecretExpiresAt, &client.SecretRotatedAt, &tokenPolicy,
 	)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokenPolicy) > 0 && string(tokenPolicy) != "null" {
+		client.TokenPolicy = &models.ClientTokenPolicy{}
+		if err := json.Unmarshal(tokenPolicy, client.TokenPolicy); err != nil {
+			return nil, fmt.Errorf("invalid token policy of client %s: %w", client.ID, err)
+		}
+	}
+	return client, nil
+}
+
+// tokenPolicyParam is the token_policy column value of a client
+func tokenPolicyParam(client *models.OAuthClient) interface{} {
+	if client.TokenPolicy == nil {
+		return nil
+	}
+	raw, _ := json.Marshal(client.TokenPolicy)
+	return string(raw)
+}
+
+func (q *oidcQueries) GetClientByID(id string) (*models.OAuthClient, error) {
+	query := `
+		SELECT ` + oauthClientColumns + `
+		FROM oauth_clients
+		WHERE id = $1 AND deleted_at IS NULL`
+
+	client, err := scanOAuthClient(q.queryRow(query, id))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -104,11 +185,12 @@ func (q *oidcQueries) GetClientByID(id string) (*models.OAuthClient, error) {
 
 func (q *oidcQueries) SaveAuthCode(code *models.OIDCAuthCode) error {
 	query := `
-		INSERT INTO oidc_codes (code, user_id, client_id, scope, nonce, redirect_uri, expires_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+		INSERT INTO oidc_codes (code, user_id, client_id, scope, nonce, redirect_uri, expires_at, code_challenge, code_challenge_method)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, ''))`
 
 	_, err := q.exec(query,
-		code.Code, code.UserID, code.ClientID, code.Scope, code.Nonce, code.RedirectURI, code.ExpiresAt)
+		code.Code, code.UserID, code.ClientID, code.Scope, code.Nonce, code.RedirectURI, code.ExpiresAt,
+		code.CodeChallenge, code.CodeChallengeMethod)
 
 	if err != nil {
 		return fmt.Errorf("failed to save oidc code: %w", err)
@@ -118,7 +200,8 @@ func (q *oidcQueries) SaveAuthCode(code *models.OIDCAuthCode) error {
 
 func (q *oidcQueries) GetAuthCode(code string) (*models.OIDCAuthCode, error) {
 	query := `
-		SELECT code, user_id, client_id, scope, nonce, redirect_uri, expires_at, used, created_at
+		SELECT code, user_id, client_id, scope, nonce, redirect_uri, expires_at, used, created_at,
+			COALESCE(code_challenge, ''), COALESCE(code_challenge_method, '')
 		FROM oidc_codes
 		WHERE code = $1`
 
@@ -126,7 +209,7 @@ func (q *oidcQueries) GetAuthCode(code string) (*models.OIDCAuthCode, error) {
 	err := q.queryRow(query, code).Scan(
 		&authCode.Code, &authCode.UserID, &authCode.ClientID, &authCode.Scope,
 		&authCode.Nonce, &authCode.RedirectURI, &authCode.ExpiresAt, &authCode.Used,
-		&authCode.CreatedAt,
+		&authCode.CreatedAt, &authCode.CodeChallenge, &authCode.CodeChallengeMethod,
 	)
 
 	if err == sql.ErrNoRows {
@@ -153,15 +236,16 @@ func (q *oidcQueries) MarkAuthCodeUsed(code string) error {
 func (q *oidcQueries) CreateClient(client *models.OAuthClient) error {
 	query := `
 		INSERT INTO oauth_clients (id, organization_id, client_name, client_secret_hash, 
-			redirect_uris, grant_types, response_types, scope, is_public, is_trusted,
-			logo_url, policy_uri, tos_uri, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`
+			redirect_uris, grant_types, response_types, scope, audiences, is_public, is_trusted,
+			logo_url, policy_uri, tos_uri, created_at, updated_at, allowed_origins, allow_wildcards, token_policy)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)`
 
 	_, err := q.exec(query,
 		client.ID, client.OrganizationID, client.ClientName, client.ClientSecretHash,
 		pq.Array(client.RedirectURIs), pq.Array(client.GrantTypes),
-		pq.Array(client.ResponseTypes), client.Scope, client.IsPublic, client.IsTrusted,
-		client.LogoURL, client.PolicyURI, client.TosURI, client.CreatedAt, client.UpdatedAt)
+		pq.Array(client.ResponseTypes), client.Scope, pq.Array(client.Audiences), client.IsPublic, client.IsTrusted,
+		client.LogoURL, client.PolicyURI, client.TosURI, client.CreatedAt, client.UpdatedAt,
+		pq.Array(client.AllowedOrigins), client.AllowWildcards, tokenPolicyParam(client))
 
 	if err != nil {
 		return fmt.Errorf("failed to create oauth client: %w", err)
@@ -172,9 +256,7 @@ func (q *oidcQueries) CreateClient(client *models.OAuthClient) error {
 // ListClientsByOrg returns all OIDC clients for an organization
 func (q *oidcQueries) ListClientsByOrg(orgID string) ([]*models.OAuthClient, error) {
 	query := `
-		SELECT id, organization_id, client_name, client_secret_hash, redirect_uris, 
-		       grant_types, response_types, scope, is_public, is_trusted, 
-		       logo_url, policy_uri, tos_uri, created_at, updated_at
+		SELECT ` + oauthClientColumns + `
 		FROM oauth_clients
 		WHERE organization_id = $1 AND deleted_at IS NULL
 		ORDER BY created_at DESC`
@@ -194,13 +276,7 @@ func (q *oidcQueries) ListClientsByOrg(orgID string) ([]*models.OAuthClient, err
 
 	var clients []*models.OAuthClient
 	for rows.Next() {
-		client := &models.OAuthClient{}
-		err := rows.Scan(
-			&client.ID, &client.OrganizationID, &client.ClientName, &client.ClientSecretHash,
-			pq.Array(&client.RedirectURIs), pq.Array(&client.GrantTypes), pq.Array(&client.ResponseTypes), &client.Scope, &client.IsPublic,
-			&client.IsTrusted, &client.LogoURL, &client.PolicyURI, &client.TosURI,
-			&client.CreatedAt, &client.UpdatedAt,
-		)
+		client, err := scanOAuthClient(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan oauth client: %w", err)
 		}
@@ -216,14 +292,16 @@ func (q *oidcQueries) UpdateClient(client *models.OAuthClient) error {
 		UPDATE oauth_clients
 		SET client_name = $1, redirect_uris = $2, grant_types = $3, 
 		    response_types = $4, scope = $5, is_public = $6, is_trusted = $7, 
-		    logo_url = $8, policy_uri = $9, tos_uri = $10, updated_at = $11
+		    logo_url = $8, policy_uri = $9, tos_uri = $10, updated_at = $11, audiences = $14,
+		    allowed_origins = $15, allow_wildcards = $16, token_policy = $17
 		WHERE id = $12 AND organization_id = $13 AND deleted_at IS NULL`
 
 	_, err := q.exec(query,
 		client.ClientName, pq.Array(client.RedirectURIs),
 		pq.Array(client.GrantTypes), pq.Array(client.ResponseTypes),
 		client.Scope, client.IsPublic, client.IsTrusted, client.LogoURL,
-		client.PolicyURI, client.TosURI, client.UpdatedAt, client.ID, client.OrganizationID)
+		client.PolicyURI, client.TosURI, client.UpdatedAt, client.ID, client.OrganizationID,
+		pq.Array(client.Audiences), pq.Array(client.AllowedOrigins), client.AllowWildcards, tokenPolicyParam(client))
 
 	if err != nil {
 		return fmt.Errorf("failed to update oauth client: %w", err)
@@ -231,6 +309,88 @@ func (q *oidcQueries) UpdateClient(client *models.OAuthClient) error {
 	return nil
 }
 
+// ListClientOrigins returns the distinct origin patterns registered by all
+// clients, for answering CORS preflight requests
+func (q *oidcQueries) ListClientOrigins() ([]string, error) {
+	rows, err := q.query(`
+		SELECT DISTINCT unnest(allowed_origins)
+		FROM oauth_clients
+		WHERE deleted_at IS NULL AND cardinality(allowed_origins) > 0`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list oauth client origins: %w", err)
+	}
+	defer rows.Close()
+
+	var origins []string
+	for rows.Next() {
+		var origin string
+		if err := rows.Scan(&origin); err != nil {
+			return nil, fmt.Errorf("failed to scan oauth client origin: %w", err)
+		}
+		origins = append(origins, origin)
+	}
+	return origins, rows.Err()
+}
+
+// SetClientTrust changes whether a client skips consent. Client
+// registration and updates leave it unchanged.
+func (q *oidcQueries) SetClientTrust(clientID, orgID string, trusted, firstParty bool) error {
+	result, err := q.exec(`
+		UPDATE oauth_clients SET is_trusted = $3, is_first_party = $4, updated_at = NOW()
+		WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL`,
+		clientID, orgID, trusted, firstParty)
+	if err != nil {
+		return fmt.Errorf("failed to update oauth client trust: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("client not found")
+	}
+	return nil
+}
+
+func (q *oidcQueries) RotateClientSecret(clientID, orgID, secretHash string, previousValidUntil *time.Time) error {
+	result, err := q.exec(`
+		UPDATE oauth_clients
+		SET previous_secret_hash = CASE WHEN $4::timestamptz IS NULL THEN NULL ELSE client_secret_hash END,
+		    previous_secret_expires_at = $4, client_secret_hash = $3,
+		    secret_rotated_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL`,
+		clientID, orgID, secretHash, previousValidUntil)
+	if err != nil {
+		return fmt.Errorf("failed to rotate oauth client secret: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("client not found")
+	}
+	return nil
+}
+
+// ListTrustedClients returns trusted and first-party clients, for root
+// users reviewing which applications skip consent
+func (q *oidcQueries) ListTrustedClients(orgID string) ([]*models.OAuthClient, error) {
+	rows, err := q.query(`
+		SELECT `+oauthClientColumns+`
+		FROM oauth_clients
+		WHERE is_trusted AND deleted_at IS NULL AND ($1 = '' OR organization_id::text = $1)
+		ORDER BY organization_id, created_at DESC`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trusted oauth clients: %w", err)
+	}
+	defer rows.Close()
+
+	clients := []*models.OAuthClient{}
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan oauth client: %w", err)
+		}
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
+
 // DeleteClient soft-deletes an OIDC client
 func (q *oidcQueries) DeleteClient(clientID, orgID string) error {
 	query := `UPDATE oauth_clients SET deleted_at = NOW() WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL`
@@ -244,3 +404,340 @@ func (q *oidcQueries) DeleteClient(clientID, orgID string) error {
 	}
 	return nil
 }
+
+func pushedRequestKey(id string) string {
+	return "oauth_par:" + id
+}
+
+// SavePushedRequest stores a pushed authorization request until it expires
+func (q *oidcQueries) SavePushedRequest(id string, req *models.PushedAuthorizationRequest) error {
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pushed authorization request: %w", err)
+	}
+	return q.redis.Set(q.ctx, pushedRequestKey(id), raw, time.Until(req.ExpiresAt)).Err()
+}
+
+func (q *oidcQueries) GetPushedRequest(id string) (*models.PushedAuthorizationRequest, error) {
+	raw, err := q.redis.Get(q.ctx, pushedRequestKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pushed authorization request: %w", err)
+	}
+	var req models.PushedAuthorizationRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return nil, fmt.Errorf("invalid pushed authorization request: %w", err)
+	}
+	return &req, nil
+}
+
+func (q *oidcQueries) DeletePushedRequest(id string) (bool, error) {
+	n, err := q.redis.Del(q.ctx, pushedRequestKey(id)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete pushed authorization request: %w", err)
+	}
+	return n == 1, nil
+}
+
+func deviceCodeKey(deviceCode string) string {
+	return "oauth_device:" + deviceCode
+}
+
+func userCodeKey(userCode string) string {
+	return "oauth_device_user:" + userCode
+}
+
+// SaveDeviceAuthorization stores a device authorization request, or an
+// update of it, until it expires
+func (q *oidcQueries) SaveDeviceAuthorization(auth *models.DeviceAuthorization) error {
+	raw, err := json.Marshal(auth)
+	if err != nil {
+		return fmt.Errorf("failed to marshal device authorization: %w", err)
+	}
+	ttl := time.Until(auth.ExpiresAt)
+	if ttl <= 0 {
+		return fmt.Errorf("device authorization expired")
+	}
+	pipe := q.redis.TxPipeline()
+	pipe.Set(q.ctx, deviceCodeKey(auth.DeviceCode), raw, ttl)
+	pipe.Set(q.ctx, userCodeKey(auth.UserCode), auth.DeviceCode, ttl)
+	if _, err := pipe.Exec(q.ctx); err != nil {
+		return fmt.Errorf("failed to save device authorization: %w", err)
+	}
+	return nil
+}
+
+func (q *oidcQueries) GetDeviceAuthorization(deviceCode string) (*models.DeviceAuthorization, error) {
+	raw, err := q.redis.Get(q.ctx, deviceCodeKey(deviceCode)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device authorization: %w", err)
+	}
+	var auth models.DeviceAuthorization
+	if err := json.Unmarshal(raw, &auth); err != nil {
+		return nil, fmt.Errorf("invalid device authorization: %w", err)
+	}
+	return &auth, nil
+}
+
+func (q *oidcQueries) GetDeviceAuthorizationByUserCode(userCode string) (*models.DeviceAuthorization, error) {
+	deviceCode, err := q.redis.Get(q.ctx, userCodeKey(userCode)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device authorization: %w", err)
+	}
+	return q.GetDeviceAuthorization(deviceCode)
+}
+
+func (q *oidcQueries) DeleteDeviceAuthorization(auth *models.DeviceAuthorization) (bool, error) {
+	pipe := q.redis.TxPipeline()
+	deleted := pipe.Del(q.ctx, deviceCodeKey(auth.DeviceCode))
+	pipe.Del(q.ctx, userCodeKey(auth.UserCode))
+	if _, err := pipe.Exec(q.ctx); err != nil {
+		return false, fmt.Errorf("failed to delete device authorization: %w", err)
+	}
+	return deleted.Val() == 1, nil
+}
+
+// GetConsent returns the user's consent for a client, or nil if none was given
+func (q *oidcQueries) GetConsent(userID, clientID string) (*models.OAuthConsent, error) {
+	query := `
+		SELECT id, user_id, client_id, organization_id, scopes, created_at, updated_at
+		FROM oauth_consents
+		WHERE user_id = $1 AND client_id = $2`
+
+	consent := &models.OAuthConsent{}
+	err := q.queryRow(query, userID, clientID).Scan(
+		&consent.ID, &consent.UserID, &consent.ClientID, &consent.OrganizationID,
+		pq.Array(&consent.Scopes), &consent.CreatedAt, &consent.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth consent: %w", err)
+	}
+
+	return consent, nil
+}
+
+// SaveConsent records a grant, adding its scopes to any earlier grant of the
+// same client. consent.ID is set to the stored grant's ID.
+func (q *oidcQueries) SaveConsent(consent *models.OAuthConsent) error {
+	query := `
+		INSERT INTO oauth_consents (user_id, client_id, organization_id, scopes)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, client_id) DO UPDATE
+		SET scopes = ARRAY(SELECT DISTINCT unnest(oauth_consents.scopes || EXCLUDED.scopes)),
+		    updated_at = NOW()
+		RETURNING id, scopes, created_at, updated_at`
+
+	err := q.queryRow(query, consent.UserID, consent.ClientID, consent.OrganizationID, pq.Array(consent.Scopes)).Scan(
+		&consent.ID, pq.Array(&consent.Scopes), &consent.CreatedAt, &consent.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save oauth consent: %w", err)
+	}
+	return nil
+}
+
+// ListConsentsByUser returns the clients a user has granted access to
+func (q *oidcQueries) ListConsentsByUser(userID, orgID string) ([]*models.OAuthConsent, error) {
+	query := `
+		SELECT oc.id, oc.user_id, oc.client_id, oc.organization_id, oc.scopes,
+		       c.client_name, c.logo_url, oc.created_at, oc.updated_at
+		FROM oauth_consents oc
+		JOIN oauth_clients c ON c.id = oc.client_id AND c.deleted_at IS NULL
+		WHERE oc.user_id = $1 AND oc.organization_id = $2
+		ORDER BY oc.updated_at DESC`
+
+	var db interface {
+		QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	} = q.db
+	if q.tx != nil {
+		db = q.tx
+	}
+
+	rows, err := db.QueryContext(q.ctx, query, userID, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list oauth consents: %w", err)
+	}
+	defer rows.Close()
+
+	consents := []*models.OAuthConsent{}
+	for rows.Next() {
+		consent := &models.OAuthConsent{}
+		err := rows.Scan(
+			&consent.ID, &consent.UserID, &consent.ClientID, &consent.OrganizationID, pq.Array(&consent.Scopes),
+			&consent.ClientName, &consent.LogoURL, &consent.CreatedAt, &consent.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan oauth consent: %w", err)
+		}
+		consents = append(consents, consent)
+	}
+
+	return consents, rows.Err()
+}
+
+// DeleteConsent revokes a user's grant to a client
+func (q *oidcQueries) DeleteConsent(userID, orgID, clientID string) error {
+	query := `DELETE FROM oauth_consents WHERE user_id = $1 AND organization_id = $2 AND client_id = $3`
+	result, err := q.exec(query, userID, orgID, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to delete oauth consent: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("consent not found")
+	}
+	return nil
+}
+
+// ListScopesByOrg returns the custom OAuth scopes defined by an organization
+func (q *oidcQueries) ListScopesByOrg(orgID string) ([]*models.OAuthScope, error) {
+	rows, err := q.query(`
+		SELECT id, organization_id, name, COALESCE(description, ''), actions, created_at, updated_at
+		FROM oauth_scopes
+		WHERE organization_id = $1
+		ORDER BY name`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list oauth scopes: %w", err)
+	}
+	defer rows.Close()
+
+	scopes := []*models.OAuthScope{}
+	for rows.Next() {
+		scope := &models.OAuthScope{}
+		err := rows.Scan(&scope.ID, &scope.OrganizationID, &scope.Name, &scope.Description,
+			pq.Array(&scope.Actions), &scope.CreatedAt, &scope.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan oauth scope: %w", err)
+		}
+		scopes = append(scopes, scope)
+	}
+
+	return scopes, rows.Err()
+}
+
+// CreateScope defines a custom OAuth scope for an organization
+func (q *oidcQueries) CreateScope(scope *models.OAuthScope) error {
+	query := `
+		INSERT INTO oauth_scopes (organization_id, name, description, actions)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at`
+
+	err := q.queryRow(query, scope.OrganizationID, scope.Name, scope.Description, pq.Array(scope.Actions)).Scan(
+		&scope.ID, &scope.CreatedAt, &scope.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create oauth scope: %w", err)
+	}
+	return nil
+}
+
+// UpdateScope changes the description and actions of a custom scope. The
+// name is fixed once clients and tokens refer to it.
+func (q *oidcQueries) UpdateScope(scope *models.OAuthScope) error {
+	query := `
+		UPDATE oauth_scopes
+		SET description = $1, actions = $2, updated_at = NOW()
+		WHERE id = $3 AND organization_id = $4
+		RETURNING name, created_at, updated_at`
+
+	err := q.queryRow(query, scope.Description, pq.Array(scope.Actions), scope.ID, scope.OrganizationID).Scan(
+		&scope.Name, &scope.CreatedAt, &scope.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("scope not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update oauth scope: %w", err)
+	}
+	return nil
+}
+
+// DeleteScope removes a custom scope. Tokens already carrying it no longer
+// grant any action.
+func (q *oidcQueries) DeleteScope(id, orgID string) error {
+	result, err := q.exec(`DELETE FROM oauth_scopes WHERE id = $1 AND organization_id = $2`, id, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete oauth scope: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("scope not found")
+	}
+	return nil
+}
+
+// ListAudiencesByOrg returns the API audiences defined by an organization
+func (q *oidcQueries) ListAudiencesByOrg(orgID string) ([]*models.OAuthAudience, error) {
+	rows, err := q.query(`
+		SELECT id, organization_id, identifier, name, COALESCE(description, ''), created_at, updated_at
+		FROM oauth_audiences
+		WHERE organization_id = $1
+		ORDER BY identifier`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list oauth audiences: %w", err)
+	}
+	defer rows.Close()
+
+	audiences := []*models.OAuthAudience{}
+	for rows.Next() {
+		audience := &models.OAuthAudience{}
+		err := rows.Scan(&audience.ID, &audience.OrganizationID, &audience.Identifier, &audience.Name,
+			&audience.Description, &audience.CreatedAt, &audience.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan oauth audience: %w", err)
+		}
+		audiences = append(audiences, audience)
+	}
+
+	return audiences, rows.Err()
+}
+
+// CreateAudience registers an API audience for an organization
+func (q *oidcQueries) CreateAudience(audience *models.OAuthAudience) error {
+	query := `
+		INSERT INTO oauth_audiences (organization_id, identifier, name, description)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at`
+
+	err := q.queryRow(query, audience.OrganizationID, audience.Identifier, audience.Name, audience.Description).Scan(
+		&audience.ID, &audience.CreatedAt, &audience.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create oauth audience: %w", err)
+	}
+	return nil
+}
+
+// DeleteAudience removes an API audience and detaches it from the
+// organization's clients
+func (q *oidcQueries) DeleteAudience(id, orgID string) error {
+	var identifier string
+	err := q.queryRow(`DELETE FROM oauth_audiences WHERE id = $1 AND organization_id = $2 RETURNING identifier`, id, orgID).Scan(&identifier)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("audience not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete oauth audience: %w", err)
+	}
+
+	query := `
+		UPDATE oauth_clients
+		SET audiences = array_remove(audiences, $1), updated_at = NOW()
+		WHERE organization_id = $2 AND $1 = ANY(audiences)`
+	if _, err := q.exec(query, identifier, orgID); err != nil {
+		return fmt.Errorf("failed to detach oauth audience from clients: %w", err)
+	}
+	return nil
+}
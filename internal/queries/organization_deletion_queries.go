@@ -0,0 +1,243 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/database"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// OrganizationDeletionQueries tracks scheduled organization deletions and
+// carries them out. Statements that belong together (scheduling and session
+// revocation, the cascade of Complete) are expected to run in one transaction.
+type OrganizationDeletionQueries interface {
+	WithTx(tx *sql.Tx) OrganizationDeletionQueries
+	WithContext(ctx context.Context) OrganizationDeletionQueries
+
+	// Schedule records the deletion of d.OrganizationID at d.ScheduledFor and
+	// suspends the organization, filling in the recorded fields of d. It fails
+	// with a conflict when the organization is deleted or its deletion is
+	// already scheduled.
+	Schedule(d *models.OrganizationDeletion) error
+	Get(organizationID string) (*models.OrganizationDeletion, error)
+	// Cancel stops a scheduled deletion and restores the status the
+	// organization had when it was scheduled
+	Cancel(organizationID, cancelledBy string) (*models.OrganizationDeletion, error)
+	// ListScheduled returns the deletions that are still scheduled, the
+	// earliest due first
+	ListScheduled() ([]models.OrganizationDeletion, error)
+	// SetExport records the outcome of building the final data export: its
+	// storage key and size, or the error that prevented it
+	SetExport(organizationID, key string, size int64, exportErr string) error
+	// Complete soft-deletes an organization whose deletion is due together
+	// with its users, service accounts, API keys, sessions, OAuth clients,
+	// content, resources, groups, roles and policies. It returns the number
+	// of rows affected per kind.
+	Complete(organizationID string) (map[string]int64, error)
+}
+
+// organizationCascade soft-deletes the contents of an organization, in the
+// order Complete runs it
+var organizationCascade = []struct{ kind, query string }{
+	{"users", `UPDATE users SET status = 'deleted', deleted_at = NOW(), updated_at = NOW() WHERE organization_id = $1 AND deleted_at IS NULL`},
+	{"service_accounts", `UPDATE service_accounts SET status = 'deleted', deleted_at = NOW(), updated_at = NOW() WHERE organization_id = $1 AND deleted_at IS NULL`},
+	{"api_keys", `UPDATE api_keys SET status = 'deleted' WHERE organization_id = $1 AND status != 'deleted'`},
+	{"sessions", `UPDATE sessions SET status = 'revoked', last_used_at = NOW() WHERE organization_id = $1 AND status = 'active'`},
+	{"oauth_clients", `UPDATE oauth_clients SET deleted_at = NOW(), updated_at = NOW() WHERE organization_id = $1 AND deleted_at IS NULL`},
+	{"content_items", `UPDATE content_items SET deleted_at = NOW(), updated_at = NOW() WHERE organization_id = $1 AND deleted_at IS NULL`},
+	{"resources", `UPDATE resources SET status = 'deleted', deleted_at = NOW(), updated_at = NOW() WHERE organization_id = $1 AND deleted_at IS NULL`},
+	{"groups", `UPDATE groups SET status = 'deleted', deleted_at = NOW(), updated_at = NOW() WHERE organization_id = $1 AND deleted_at IS NULL`},
+	{"roles", `UPDATE roles SET status = 'deleted', deleted_at = NOW(), updated_at = NOW() WHERE organization_id = $1 AND deleted_at IS NULL`},
+	{"policies", `UPDATE policies SET status = 'deleted', deleted_at = NOW(), updated_at = NOW() WHERE organization_id = $1 AND deleted_at IS NULL`},
+}
+
+type organizationDeletionQueries struct {
+	db    *database.DB
+	redis redis.UniversalClient
+	tx    *sql.Tx
+	ctx   context.Context
+}
+
+func NewOrganizationDeletionQueries(db *database.DB, redis redis.UniversalClient) OrganizationDeletionQueries {
+	return &organizationDeletionQueries{db: db, redis: redis, ctx: context.Background()}
+}
+
+func (q *organizationDeletionQueries) WithTx(tx *sql.Tx) OrganizationDeletionQueries {
+	return &organizationDeletionQueries{db: q.db, redis: q.redis, tx: tx, ctx: q.ctx}
+}
+
+func (q *organizationDeletionQueries) WithContext(ctx context.Context) OrganizationDeletionQueries {
+	return &organizationDeletionQueries{db: q.db, redis: q.redis, tx: q.tx, ctx: ctx}
+}
+
+func (q *organizationDeletionQueries) conn() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.DB
+}
+
+const organizationDeletionColumns = `organization_id, requested_by, reason, prior_status, requested_at, scheduled_for,
+	status, export_status, export_key, export_size, export_error, cancelled_by, cancelled_at, completed_at`
+
+func scanOrganizationDeletion(row interface{ Scan(...interface{}) error }) (*models.OrganizationDeletion, error) {
+	var d models.OrganizationDeletion
+	var requestedBy, exportKey, exportError, cancelledBy sql.NullString
+	var exportSize sql.NullInt64
+	var cancelledAt, completedAt sql.NullTime
+	err := row.Scan(&d.OrganizationID, &requestedBy, &d.Reason, &d.PriorStatus, &d.RequestedAt, &d.ScheduledFor,
+		&d.Status, &d.ExportStatus, &exportKey, &exportSize, &exportError, &cancelledBy, &cancelledAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+	if requestedBy.Valid {
+		d.RequestedBy = &requestedBy.String
+	}
+	d.ExportKey = exportKey.String
+	if exportSize.Valid {
+		d.ExportSize = &exportSize.Int64
+	}
+	d.ExportError = exportError.String
+	if cancelledBy.Valid {
+		d.CancelledBy = &cancelledBy.String
+	}
+	if cancelledAt.Valid {
+		d.CancelledAt = &cancelledAt.Time
+	}
+	if completedAt.Valid {
+		d.CompletedAt = &completedAt.Time
+	}
+	return &d, nil
+}
+
+func (q *organizationDeletionQueries) Schedule(d *models.OrganizationDeletion) error {
+	// A cancelled deletion is replaced; a scheduled or completed one is not
+	row := q.conn().QueryRowContext(q.ctx, `
+		INSERT INTO organization_deletions (organization_id, requested_by, reason, prior_status, scheduled_for)
+		SELECT id, $2, $3, status, $4 FROM organizations WHERE id = $1 AND status != 'deleted'
+		ON CONFLICT (organization_id) DO UPDATE SET
+			requested_by = EXCLUDED.requested_by, reason = EXCLUDED.reason,
+			prior_status = EXCLUDED.prior_status, requested_at = NOW(),
+			scheduled_for = EXCLUDED.scheduled_for, status = 'scheduled',
+			export_status = 'pending', export_key = NULL, export_size = NULL, export_error = NULL,
+			cancelled_by = NULL, cancelled_at = NULL, completed_at = NULL
+		WHERE organization_deletions.status = 'cancelled'
+		RETURNING `+organizationDeletionColumns,
+		d.OrganizationID, d.RequestedBy, d.Reason, d.ScheduledFor)
+	scheduled, err := scanOrganizationDeletion(row)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("deletion conflict: organization is deleted or already scheduled for deletion")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to schedule organization deletion: %w", err)
+	}
+	*d = *scheduled
+
+	if _, err := q.conn().ExecContext(q.ctx,
+		`UPDATE organizations SET status = 'suspended', updated_at = NOW() WHERE id = $1`, d.OrganizationID); err != nil {
+		return fmt.Errorf("failed to suspend organization: %w", err)
+	}
+	return nil
+}
+
+func (q *organizationDeletionQueries) Get(organizationID string) (*models.OrganizationDeletion, error) {
+	row := q.conn().QueryRowContext(q.ctx,
+		`SELECT `+organizationDeletionColumns+` FROM organization_deletions WHERE organization_id = $1`, organizationID)
+	d, err := scanOrganizationDeletion(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("organization deletion not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization deletion: %w", err)
+	}
+	return d, nil
+}
+
+func (q *organizationDeletionQueries) Cancel(organizationID, cancelledBy string) (*models.OrganizationDeletion, error) {
+	row := q.conn().QueryRowContext(q.ctx, `
+		UPDATE organization_deletions SET status = 'cancelled', cancelled_by = $2, cancelled_at = NOW()
+		WHERE organization_id = $1 AND status = 'scheduled'
+		RETURNING `+organizationDeletionColumns,
+		organizationID, cancelledBy)
+	d, err := scanOrganizationDeletion(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("organization deletion not found or no longer scheduled")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel organization deletion: %w", err)
+	}
+
+	if _, err := q.conn().ExecContext(q.ctx,
+		`UPDATE organizations SET status = $2, updated_at = NOW() WHERE id = $1 AND status = 'suspended'`,
+		organizationID, d.PriorStatus); err != nil {
+		return nil, fmt.Errorf("failed to restore organization status: %w", err)
+	}
+	return d, nil
+}
+
+func (q *organizationDeletionQueries) ListScheduled() ([]models.OrganizationDeletion, error) {
+	rows, err := q.conn().QueryContext(q.ctx,
+		`SELECT `+organizationDeletionColumns+` FROM organization_deletions WHERE status = 'scheduled' ORDER BY scheduled_for`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scheduled organization deletions: %w", err)
+	}
+	defer rows.Close()
+
+	var deletions []models.OrganizationDeletion
+	for rows.Next() {
+		d, err := scanOrganizationDeletion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan organization deletion: %w", err)
+		}
+		deletions = append(deletions, *d)
+	}
+	return deletions, rows.Err()
+}
+
+func (q *organizationDeletionQueries) SetExport(organizationID, key string, size int64, exportErr string) error {
+	status := "completed"
+	if exportErr != "" {
+		status = "failed"
+	}
+	_, err := q.conn().ExecContext(q.ctx, `
+		UPDATE organization_deletions
+		SET export_status = $2, export_key = NULLIF($3, ''), export_size = NULLIF($4::bigint, 0), export_error = NULLIF($5, '')
+		WHERE organization_id = $1 AND status = 'scheduled'`,
+		organizationID, status, key, size, exportErr)
+	if err != nil {
+		return fmt.Errorf("failed to record organization export: %w", err)
+	}
+	return nil
+}
+
+func (q *organizationDeletionQueries) Complete(organizationID string) (map[string]int64, error) {
+	result, err := q.conn().ExecContext(q.ctx, `
+		UPDATE organization_deletions SET status = 'completed', completed_at = NOW()
+		WHERE organization_id = $1 AND status = 'scheduled' AND scheduled_for <= NOW()`,
+		organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete organization deletion: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, fmt.Errorf("organization deletion not found or not due")
+	}
+
+	counts := make(map[string]int64, len(organizationCascade))
+	for _, step := range organizationCascade {
+		result, err := q.conn().ExecContext(q.ctx, step.query, organizationID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete %s of organization: %w", step.kind, err)
+		}
+		counts[step.kind], _ = result.RowsAffected()
+	}
+
+	if _, err := q.conn().ExecContext(q.ctx,
+		`UPDATE organizations SET status = 'deleted', deleted_at = NOW(), updated_at = NOW() WHERE id = $1 AND status != 'deleted'`,
+		organizationID); err != nil {
+		return nil, fmt.Errorf("failed to delete organization: %w", err)
+	}
+	return counts, nil
+}
@@ -21,6 +21,13 @@ type OrganizationQueries interface {
 	ListOrganizations(params ListParams, orgFilter string) (*ListResult[models.Organization], error)
 	CreateOrganization(org *models.Organization) error
 	GetOrganization(id string) (*models.Organization, error)
+	GetOrganizationBySlug(slug string) (*models.Organization, error)
+	// ListOrganizationsByLoginDomain returns the active organizations whose
+	// login settings route the email domain to them
+	ListOrganizationsByLoginDomain(domain string) ([]*models.Organization, error)
+	// ListOrganizationsByKerberosRealm returns the active organizations whose
+	// login settings accept SPNEGO sign-ins from the realm
+	ListOrganizationsByKerberosRealm(realm string) ([]*models.Organization, error)
 	UpdateOrganization(org *models.Organization) error
 	DeleteOrganization(id string) error
 
@@ -34,16 +41,34 @@ type OrganizationQueries interface {
 	// Settings
 	GetOrganizationSettings(orgID string) (string, error)
 	UpdateOrganizationSettings(orgID string, settings string) error
+	GetUserAttributeSchema(orgID string) (*models.AttributeSchema, error)
+	UpdateUserAttributeSchema(orgID string, schema *models.AttributeSchema) error
+	GetTokenLifetimes(orgID string) (*models.TokenLifetimes, error)
+	GetDecisionSampleRate(orgID string) (*float64, error)
+	GetRegistrationPolicy(orgID string) (*models.RegistrationPolicy, error)
+	GetUsernamePolicy(orgID string) (*models.UsernamePolicy, error)
+	GetPasswordPolicy(orgID string) (*models.PasswordPolicy, error)
+	GetSessionPolicy(orgID string) (*models.SessionPolicy, error)
+	GetInactivityPolicy(orgID string) (*models.InactivityPolicy, error)
+	GetSeparationOfDutiesPolicy(orgID string) (*models.SeparationOfDutiesPolicy, error)
+	GetExternalSharingPolicy(orgID string) (*models.ExternalSharingPolicy, error)
+	GetTrustedClientPolicy(orgID string) (*models.TrustedClientPolicy, error)
+	GetClientTokenLimits(orgID string) (*models.ClientTokenLimits, error)
+	GetBranding(orgID string) (*models.Branding, error)
+	GetTokenClaims(orgID string) (*models.TokenClaims, error)
+	ListInactivityPolicies() (map[string]models.InactivityPolicy, error)
+	GetCommentPolicy(orgID string) (*models.CommentPolicy, error)
+	GetAttachmentPolicy(orgID string) (*models.AttachmentPolicy, error)
 }
 
 type organizationQueries struct {
 	db    *database.DB
-	redis *redis.Client
+	redis redis.UniversalClient
 	tx    *sql.Tx
 	ctx   context.Context
 }
 
-func NewOrganizationQueries(db *database.DB, redis *redis.Client) OrganizationQueries {
+func NewOrganizationQueries(db *database.DB, redis redis.UniversalClient) OrganizationQueries {
 	return &organizationQueries{db: db, redis: redis, ctx: context.Background()}
 }
 
@@ -55,6 +80,15 @@ func (q *organizationQueries) WithContext(ctx context.Context) OrganizationQueri
 	return &organizationQueries{db: q.db, redis: q.redis, tx: q.tx, ctx: ctx}
 }
 
+// reader returns the connection for reads that tolerate replication lag:
+// the transaction if there is one, otherwise a replica
+func (q *organizationQueries) reader() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.Reader()
+}
+
 // ListOrganizations returns paginated organizations (excluding deleted).
 //
 // The orgFilter parameter controls tenant scoping:
@@ -73,38 +107,34 @@ func (q *organizationQueries) ListOrganizations(params ListParams, orgFilter str
 		offset = 0
 	}
 
-	var query string
-	var args []interface{}
+	ks, err := newKeyset(params, "created_at", "created_at", "id", "DESC")
+	if err != nil {
+		return nil, err
+	}
 
+	query := `
+		SELECT id, name, slug, parent_id, description, metadata, settings, allowed_origins, billing_tier,
+		       max_users, max_resources, status, created_at, updated_at, deleted_at,
+		       COUNT(*) OVER() as total_count
+		FROM organizations
+		WHERE status != 'deleted'`
+	args := []interface{}{ks.limit(limit), ks.offset(offset)}
 	if orgFilter != "" {
-		query = `
-			SELECT id, name, slug, parent_id, description, metadata, settings, allowed_origins, billing_tier,
-			       max_users, max_resources, status, created_at, updated_at, deleted_at,
-			       COUNT(*) OVER() as total_count
-			FROM organizations
-			WHERE status != 'deleted' AND id = $3
-			ORDER BY created_at DESC
-			LIMIT $1 OFFSET $2`
-		args = []interface{}{limit, offset, orgFilter}
-	} else {
-		query = `
-			SELECT id, name, slug, parent_id, description, metadata, settings, allowed_origins, billing_tier,
-			       max_users, max_resources, status, created_at, updated_at, deleted_at,
-			       COUNT(*) OVER() as total_count
-			FROM organizations
-			WHERE status != 'deleted'
-			ORDER BY created_at DESC
-			LIMIT $1 OFFSET $2`
-		args = []interface{}{limit, offset}
+		args = append(args, orgFilter)
+		query += fmt.Sprintf(" AND id = $%d", len(args))
 	}
 
+	// The window count is evaluated before the cursor predicate so that the
+	// total always covers the whole result set
+	query = "SELECT * FROM (" + query + ") page"
+	if clause, cursorArgs := ks.where(len(args) + 1); clause != "" {
+		query += " WHERE " + clause
+		args = append(args, cursorArgs...)
+	}
+	query += " ORDER BY " + ks.orderBy() + " LIMIT $1 OFFSET $2"
+
 	var rows *sql.Rows
-	var err error
-	if q.tx != nil {
-		rows, err = q.tx.QueryContext(q.ctx, query, args...)
-	} else {
-		rows, err = q.db.QueryContext(q.ctx, query, args...)
-	}
+	rows, err = q.reader().QueryContext(q.ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -124,8 +154,11 @@ func (q *organizationQueries) ListOrganizations(params ListParams, orgFilter str
 		}
 		items = append(items, org)
 	}
+	items, hasMore, nextCursor := page(ks, items, limit, func(org models.Organization) (string, string) {
+		return cursorTime(org.CreatedAt), org.ID
+	})
 	return &ListResult[models.Organization]{
-		Items: items, Total: total, Limit: limit, Offset: offset, HasMore: int64(offset+len(items)) < total,
+		Items: items, Total: total, Limit: limit, Offset: ks.offset(offset), HasMore: hasMore, NextCursor: nextCursor,
 	}, nil
 }
 
@@ -148,15 +181,83 @@ func (q *organizationQueries) CreateOrganization(org *models.Organization) error
 }
 
 func (q *organizationQueries) GetOrganization(id string) (*models.Organization, error) {
+	return q.getOrganization("id", id)
+}
+
+// GetOrganizationBySlug returns the organization with the given slug
+func (q *organizationQueries) GetOrganizationBySlug(slug string) (*models.Organization, error) {
+	return q.getOrganization("slug", slug)
+}
+
+func (q *organizationQueries) ListOrganizationsByKerberosRealm(realm string) ([]*models.Organization, error) {
+	query := `
+		SELECT id, name, slug, billing_tier
+		FROM organizations
+		WHERE status = 'active' AND settings->'login'->'kerberos_realms' ? $1
+		ORDER BY name`
+	var rows *sql.Rows
+	var err error
+	if q.tx != nil {
+		rows, err = q.tx.QueryContext(q.ctx, query, realm)
+	} else {
+		rows, err = q.db.QueryContext(q.ctx, query, realm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations by Kerberos realm: %w", err)
+	}
+	defer rows.Close()
+
+	var orgs []*models.Organization
+	for rows.Next() {
+		var org models.Organization
+		if err := rows.Scan(&org.ID, &org.Name, &org.Slug, &org.BillingTier); err != nil {
+			return nil, fmt.Errorf("failed to scan organization: %w", err)
+		}
+		orgs = append(orgs, &org)
+	}
+	return orgs, rows.Err()
+}
+
+func (q *organizationQueries) ListOrganizationsByLoginDomain(domain string) ([]*models.Organization, error) {
+	query := `
+		SELECT id, name, slug
+		FROM organizations
+		WHERE status = 'active' AND settings->'login'->'email_domains' ? $1
+		ORDER BY name`
+	var rows *sql.Rows
+	var err error
+	if q.tx != nil {
+		rows, err = q.tx.QueryContext(q.ctx, query, domain)
+	} else {
+		rows, err = q.db.QueryContext(q.ctx, query, domain)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations by login domain: %w", err)
+	}
+	defer rows.Close()
+
+	var orgs []*models.Organization
+	for rows.Next() {
+		var org models.Organization
+		if err := rows.Scan(&org.ID, &org.Name, &org.Slug); err != nil {
+			return nil, fmt.Errorf("failed to scan organization: %w", err)
+		}
+		orgs = append(orgs, &org)
+	}
+	return orgs, rows.Err()
+}
+
+// getOrganization looks an organization up by a unique column (id or slug)
+func (q *organizationQueries) getOrganization(column, value string) (*models.Organization, error) {
 	query := `SELECT id, name, slug, parent_id, description, metadata, settings, allowed_origins, billing_tier, max_users, max_resources, status, created_at, updated_at, deleted_at
-			  FROM organizations WHERE id = $1 AND status != 'deleted'`
+			  FROM organizations WHERE ` + column + ` = $1 AND status != 'deleted'`
 	var org models.Organization
 	var err error
 	if q.tx != nil {
-		err = q.tx.QueryRowContext(q.ctx, query, id).Scan(&org.ID, &org.Name, &org.Slug, &org.ParentID, &org.Description,
+		err = q.tx.QueryRowContext(q.ctx, query, value).Scan(&org.ID, &org.Name, &org.Slug, &org.ParentID, &org.Description,
 			&org.Metadata, &org.Settings, pq.Array(&org.AllowedOrigins), &org.BillingTier, &org.MaxUsers, &org.MaxResources, &org.Status, &org.CreatedAt, &org.UpdatedAt, &org.DeletedAt)
 	} else {
-		err = q.db.QueryRowContext(q.ctx, query, id).Scan(&org.ID, &org.Name, &org.Slug, &org.ParentID, &org.Description,
+		err = q.db.QueryRowContext(q.ctx, query, value).Scan(&org.ID, &org.Name, &org.Slug, &org.ParentID, &org.Description,
 			&org.Metadata, &org.Settings, pq.Array(&org.AllowedOrigins), &org.BillingTier, &org.MaxUsers, &org.MaxResources, &org.Status, &org.CreatedAt, &org.UpdatedAt, &org.DeletedAt)
 	}
 	if err != nil {
@@ -249,6 +350,9 @@ func (q *organizationQueries) ListOrganizationUsers(orgID string) ([]models.User
 		} else {
 			u.MFABackupCodes = []string{}
 		}
+		if err := openUserSecrets(q.db, &u); err != nil {
+			return nil, err
+		}
 
 		users = append(users, u)
 	}
@@ -398,3 +502,311 @@ func (q *organizationQueries) UpdateOrganizationSettings(orgID string, settings
 	}
 	return nil
 }
+
+// GetUserAttributeSchema returns the user attribute schema stored in the
+// organization settings, or nil when the organization has not defined one.
+func (q *organizationQueries) GetUserAttributeSchema(orgID string) (*models.AttributeSchema, error) {
+	query := `SELECT settings->'user_attribute_schema' FROM organizations WHERE id=$1 AND status != 'deleted'`
+	var raw sql.NullString
+	var err error
+	if q.tx != nil {
+		err = q.tx.QueryRowContext(q.ctx, query, orgID).Scan(&raw)
+	} else {
+		err = q.db.QueryRowContext(q.ctx, query, orgID).Scan(&raw)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("organization not found")
+		}
+		return nil, err
+	}
+	if !raw.Valid || raw.String == "null" {
+		return nil, nil
+	}
+
+	var schema models.AttributeSchema
+	if err := json.Unmarshal([]byte(raw.String), &schema); err != nil {
+		return nil, fmt.Errorf("invalid user attribute schema: %w", err)
+	}
+	return &schema, nil
+}
+
+// UpdateUserAttributeSchema stores the user attribute schema in the
+// organization settings. A nil schema removes it.
+func (q *organizationQueries) UpdateUserAttributeSchema(orgID string, schema *models.AttributeSchema) error {
+	query := `UPDATE organizations SET settings = settings - 'user_attribute_schema', updated_at=NOW() WHERE id=$1 AND status != 'deleted'`
+	args := []interface{}{orgID}
+	if schema != nil {
+		raw, err := json.Marshal(schema)
+		if err != nil {
+			return fmt.Errorf("failed to marshal user attribute schema: %w", err)
+		}
+		query = `UPDATE organizations SET settings = jsonb_set(settings, '{user_attribute_schema}', $2::jsonb), updated_at=NOW() WHERE id=$1 AND status != 'deleted'`
+		args = append(args, string(raw))
+	}
+
+	var res sql.Result
+	var err error
+	if q.tx != nil {
+		res, err = q.tx.ExecContext(q.ctx, query, args...)
+	} else {
+		res, err = q.db.ExecContext(q.ctx, query, args...)
+	}
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("organization not found or deleted")
+	}
+	return nil
+}
+
+// GetTokenLifetimes returns the token lifetime overrides stored in the
+// organization settings, or nil when the organization uses the defaults.
+func (q *organizationQueries) GetTokenLifetimes(orgID string) (*models.TokenLifetimes, error) {
+	query := `SELECT settings->'token_lifetimes' FROM organizations WHERE id=$1 AND status != 'deleted'`
+	var raw sql.NullString
+	var err error
+	if q.tx != nil {
+		err = q.tx.QueryRowContext(q.ctx, query, orgID).Scan(&raw)
+	} else {
+		err = q.db.QueryRowContext(q.ctx, query, orgID).Scan(&raw)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("organization not found")
+		}
+		return nil, err
+	}
+	if !raw.Valid || raw.String == "null" {
+		return nil, nil
+	}
+
+	var lifetimes models.TokenLifetimes
+	if err := json.Unmarshal([]byte(raw.String), &lifetimes); err != nil {
+		return nil, fmt.Errorf("invalid token lifetimes: %w", err)
+	}
+	return &lifetimes, nil
+}
+
+// GetDecisionSampleRate returns the fraction of authorization decisions the
+// organization wants logged, or nil when it uses the server default.
+func (q *organizationQueries) GetDecisionSampleRate(orgID string) (*float64, error) {
+	query := `SELECT settings->'authz_decision_sample_rate' FROM organizations WHERE id=$1 AND status != 'deleted'`
+	var raw sql.NullString
+	var err error
+	if q.tx != nil {
+		err = q.tx.QueryRowContext(q.ctx, query, orgID).Scan(&raw)
+	} else {
+		err = q.db.QueryRowContext(q.ctx, query, orgID).Scan(&raw)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("organization not found")
+		}
+		return nil, err
+	}
+	if !raw.Valid || raw.String == "null" {
+		return nil, nil
+	}
+
+	var rate float64
+	if err := json.Unmarshal([]byte(raw.String), &rate); err != nil {
+		return nil, fmt.Errorf("invalid decision sample rate: %w", err)
+	}
+	return &rate, nil
+}
+
+// GetRegistrationPolicy returns the signup restrictions stored in the
+// organization settings, or nil when registration is unrestricted.
+func (q *organizationQueries) GetRegistrationPolicy(orgID string) (*models.RegistrationPolicy, error) {
+	var policy models.RegistrationPolicy
+	if found, err := q.setting(orgID, "registration", &policy); !found {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// GetUsernamePolicy returns the username rules stored in the organization
+// settings, or nil when the organization uses the defaults.
+func (q *organizationQueries) GetUsernamePolicy(orgID string) (*models.UsernamePolicy, error) {
+	var policy models.UsernamePolicy
+	if found, err := q.setting(orgID, "username", &policy); !found {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// GetPasswordPolicy returns the password checks configured in the
+// organization settings, or nil when it uses the defaults.
+func (q *organizationQueries) GetPasswordPolicy(orgID string) (*models.PasswordPolicy, error) {
+	var policy models.PasswordPolicy
+	if found, err := q.setting(orgID, "password", &policy); !found {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// GetSessionPolicy returns the session limits configured in the
+// organization settings, or nil when it uses the server's.
+func (q *organizationQueries) GetSessionPolicy(orgID string) (*models.SessionPolicy, error) {
+	var policy models.SessionPolicy
+	if found, err := q.setting(orgID, "session", &policy); !found {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// GetInactivityPolicy returns the inactive account policy of the
+// organization, or nil when it has none.
+func (q *organizationQueries) GetInactivityPolicy(orgID string) (*models.InactivityPolicy, error) {
+	var policy models.InactivityPolicy
+	if found, err := q.setting(orgID, "inactivity", &policy); !found {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// GetSeparationOfDutiesPolicy returns the SoD rules of the organization, or
+// nil when it has none.
+func (q *organizationQueries) GetSeparationOfDutiesPolicy(orgID string) (*models.SeparationOfDutiesPolicy, error) {
+	var policy models.SeparationOfDutiesPolicy
+	if found, err := q.setting(orgID, "separation_of_duties", &policy); !found {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// GetExternalSharingPolicy returns the external sharing settings of the
+// organization, or nil when it has none and external sharing is disabled.
+func (q *organizationQueries) GetExternalSharingPolicy(orgID string) (*models.ExternalSharingPolicy, error) {
+	var policy models.ExternalSharingPolicy
+	if found, err := q.setting(orgID, "external_sharing", &policy); !found {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// GetTrustedClientPolicy returns the trusted client settings of the
+// organization, or nil when it has none and trusted clients are allowed.
+func (q *organizationQueries) GetTrustedClientPolicy(orgID string) (*models.TrustedClientPolicy, error) {
+	var policy models.TrustedClientPolicy
+	if found, err := q.setting(orgID, "trusted_clients", &policy); !found {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// GetBranding returns the branding of the organization's hosted pages, or
+// nil when it uses the defaults.
+func (q *organizationQueries) GetBranding(orgID string) (*models.Branding, error) {
+	var branding models.Branding
+	if found, err := q.setting(orgID, "branding", &branding); !found {
+		return nil, err
+	}
+	return &branding, nil
+}
+
+// GetTokenClaims returns the custom claims of the tokens of the
+// organization's OIDC clients, or nil when it has none.
+func (q *organizationQueries) GetTokenClaims(orgID string) (*models.TokenClaims, error) {
+	var claims models.TokenClaims
+	if found, err := q.setting(orgID, "token_claims", &claims); !found {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// GetClientTokenLimits returns the caps on the token lifetimes of the
+// organization's OIDC clients, or nil when it has none.
+func (q *organizationQueries) GetClientTokenLimits(orgID string) (*models.ClientTokenLimits, error) {
+	var limits models.ClientTokenLimits
+	if found, err := q.setting(orgID, "client_token_limits", &limits); !found {
+		return nil, err
+	}
+	return &limits, nil
+}
+
+// ListInactivityPolicies returns the inactive account policies of the
+// active organizations that flag dormant accounts, by organization ID
+func (q *organizationQueries) ListInactivityPolicies() (map[string]models.InactivityPolicy, error) {
+	query := `
+		SELECT id, settings->'inactivity' FROM organizations
+		WHERE status = 'active' AND deleted_at IS NULL
+		  AND COALESCE((settings->'inactivity'->>'dormant_after_days')::int, 0) > 0`
+	var rows *sql.Rows
+	var err error
+	if q.tx != nil {
+		rows, err = q.tx.QueryContext(q.ctx, query)
+	} else {
+		rows, err = q.db.QueryContext(q.ctx, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := map[string]models.InactivityPolicy{}
+	for rows.Next() {
+		var id, raw string
+		if err := rows.Scan(&id, &raw); err != nil {
+			return nil, err
+		}
+		var policy models.InactivityPolicy
+		if err := json.Unmarshal([]byte(raw), &policy); err != nil {
+			return nil, fmt.Errorf("invalid inactivity settings of organization %s: %w", id, err)
+		}
+		policies[id] = policy
+	}
+	return policies, rows.Err()
+}
+
+// GetCommentPolicy returns the comment moderation settings of the
+// organization, or nil when it uses the defaults.
+func (q *organizationQueries) GetCommentPolicy(orgID string) (*models.CommentPolicy, error) {
+	var policy models.CommentPolicy
+	if found, err := q.setting(orgID, "comments", &policy); !found {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// GetAttachmentPolicy returns the attachment limits of the organization, or
+// nil when it uses the server-wide ones.
+func (q *organizationQueries) GetAttachmentPolicy(orgID string) (*models.AttachmentPolicy, error) {
+	var policy models.AttachmentPolicy
+	if found, err := q.setting(orgID, "attachments", &policy); !found {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// setting decodes one key of the organization settings into dst and reports
+// whether it was set
+func (q *organizationQueries) setting(orgID, key string, dst interface{}) (bool, error) {
+	query := `SELECT settings->$2 FROM organizations WHERE id=$1 AND status != 'deleted'`
+	var raw sql.NullString
+	var err error
+	if q.tx != nil {
+		err = q.tx.QueryRowContext(q.ctx, query, orgID, key).Scan(&raw)
+	} else {
+		err = q.db.QueryRowContext(q.ctx, query, orgID, key).Scan(&raw)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, fmt.Errorf("organization not found")
+		}
+		return false, err
+	}
+	if !raw.Valid || raw.String == "null" {
+		return false, nil
+	}
+	if err := json.Unmarshal([]byte(raw.String), dst); err != nil {
+		return false, fmt.Errorf("invalid %s settings: %w", key, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,123 @@
+package queries
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded or
+// was issued for a different sort order than the one requested
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor is the decoded form of ListParams.Cursor / ListResult.NextCursor.
+// Clients treat the encoded value as opaque.
+type cursor struct {
+	SortBy string `json:"s"`
+	Order  string `json:"o"`
+	Value  string `json:"v"`
+	ID     string `json:"i"`
+}
+
+func encodeCursor(c cursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// keyset orders a list query by (sort column, id) so that it can be resumed
+// from a cursor instead of an offset. Offset pagination keeps working: when
+// no cursor is given the query is paged with LIMIT/OFFSET as before, but every
+// page still reports a NextCursor the client may switch to.
+type keyset struct {
+	sortBy   string // public sort key, bound into the cursor
+	column   string // SQL expression of the sort key
+	idColumn string
+	order    string // ASC or DESC
+	after    *cursor
+}
+
+// newKeyset validates params.Cursor against the effective sort order
+func newKeyset(params ListParams, sortBy, column, idColumn, order string) (*keyset, error) {
+	k := &keyset{sortBy: sortBy, column: column, idColumn: idColumn, order: strings.ToUpper(order)}
+	if params.Cursor == "" {
+		return k, nil
+	}
+	c, err := decodeCursor(params.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	if c.SortBy != k.sortBy || c.Order != k.order {
+		return nil, fmt.Errorf("%w: cursor was issued for a different sort order", ErrInvalidCursor)
+	}
+	k.after = c
+	return k, nil
+}
+
+// where returns the predicate selecting rows after the cursor, using
+// placeholders starting at $next. It is empty in offset mode.
+func (k *keyset) where(next int) (string, []interface{}) {
+	if k.after == nil {
+		return "", nil
+	}
+	op := ">"
+	if k.order == "DESC" {
+		op = "<"
+	}
+	return fmt.Sprintf("(%s, %s) %s ($%d, $%d)", k.column, k.idColumn, op, next, next+1),
+		[]interface{}{k.after.Value, k.after.ID}
+}
+
+// orderBy returns the ORDER BY list including the id tie-breaker
+func (k *keyset) orderBy() string {
+	return fmt.Sprintf("%s %s, %s %s", k.column, k.order, k.idColumn, k.order)
+}
+
+// limit returns the LIMIT to query with: one extra look-ahead row so that
+// HasMore can be answered without relying on the total count
+func (k *keyset) limit(limit int) int {
+	return limit + 1
+}
+
+// offset returns the OFFSET to query with; cursors replace offsets
+func (k *keyset) offset(offset int) int {
+	if k.after != nil {
+		return 0
+	}
+	return offset
+}
+
+// page trims the look-ahead row and returns whether more rows follow together
+// with the cursor of the last returned row
+func page[T any](k *keyset, items []T, limit int, key func(T) (value, id string)) ([]T, bool, string) {
+	if len(items) <= limit {
+		return items, false, ""
+	}
+	items = items[:limit]
+	value, id := key(items[len(items)-1])
+	return items, true, encodeCursor(cursor{SortBy: k.sortBy, Order: k.order, Value: value, ID: id})
+}
+
+// escapeLike escapes the LIKE/ILIKE wildcards in a user-supplied search term
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// cursorTime formats a timestamp sort key without losing precision
+func cursorTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/authz"
 	"github.com/the-monkeys/monkeys-identity/internal/database"
 	"github.com/the-monkeys/monkeys-identity/internal/models"
 )
@@ -33,11 +34,12 @@ type PolicyQueries interface {
 	RollbackPolicy(policyID, organizationID, toVersion string) error
 
 	// Policy simulation and evaluation
-	SimulatePolicy(request *PolicySimulationRequest) (*PolicySimulationResult, error)
 	EvaluatePolicy(policyDocument string, context *PolicyEvaluationContext) (*PolicyEvaluationResult, error)
-	BulkCheckPermissions(organizationID string, requests []*PermissionCheckRequest) ([]*PermissionCheckResult, error)
-	GetEffectivePermissions(principalID, principalType, organizationID string) (*EffectivePermissions, error)
 	GetPrincipalPolicies(principalID, principalType, organizationID string) ([]*models.Policy, error)
+	// GetPrincipalPolicyGrants is GetPrincipalPolicies with the role and
+	// group each policy comes through; a policy reached several ways is
+	// returned once per way
+	GetPrincipalPolicyGrants(principalID, principalType, organizationID string) ([]PolicyGrant, error)
 }
 
 // Policy versioning and simulation types
@@ -52,6 +54,8 @@ type PolicyVersion struct {
 }
 
 type PolicySimulationRequest struct {
+	// PolicyDocument is the candidate document; when simulating a saved
+	// policy it defaults to that policy's document
 	PolicyDocument string                      `json:"policy_document"`
 	Context        *PolicyEvaluationContext    `json:"context"`
 	TestCases      []*PolicySimulationTestCase `json:"test_cases"`
@@ -92,6 +96,24 @@ type PolicyEvaluationContext struct {
 	SessionID   string            `json:"session_id"`
 }
 
+// EvalContext converts the context into the map policy conditions are
+// evaluated against
+func (c *PolicyEvaluationContext) EvalContext() map[string]interface{} {
+	evalContext := make(map[string]interface{})
+	if c == nil {
+		return evalContext
+	}
+	evalContext["principal"] = c.Principal
+	evalContext["resource"] = c.Resource
+	evalContext["action"] = c.Action
+	evalContext["source_ip"] = c.SourceIP
+	evalContext["request_time"] = c.RequestTime
+	for k, v := range c.Environment {
+		evalContext[k] = v
+	}
+	return evalContext
+}
+
 type PolicyEvaluationResult struct {
 	Effect        string            `json:"effect"`   // allow, deny, not_applicable
 	Decision      string            `json:"decision"` // final decision after combining policies
@@ -99,6 +121,8 @@ type PolicyEvaluationResult struct {
 	Conditions    map[string]bool   `json:"conditions,omitempty"`
 	Reasons       []string          `json:"reasons"`
 	Metadata      map[string]string `json:"metadata,omitempty"`
+	// Statements reports how each statement of the policy applied
+	Statements []authz.StatementResult `json:"statements,omitempty"`
 }
 
 type PermissionCheckRequest struct {
@@ -108,6 +132,11 @@ type PermissionCheckRequest struct {
 	Resource       string                   `json:"resource"`
 	Action         string                   `json:"action"`
 	Context        *PolicyEvaluationContext `json:"context"`
+	// TokenScopes limits the check to the scopes of an OAuth client token
+	// the principal presented to a downstream service
+	TokenScopes []string `json:"token_scopes,omitempty"`
+	// Explain asks for the trace of how the decision was reached
+	Explain bool `json:"explain,omitempty"`
 }
 
 type PermissionCheckResult struct {
@@ -116,31 +145,49 @@ type PermissionCheckResult struct {
 	Policies   []string                `json:"policies"`
 	Evaluation *PolicyEvaluationResult `json:"evaluation"`
 	Request    *PermissionCheckRequest `json:"request"`
-}
-
-type EffectivePermissions struct {
-	PrincipalID   string                `json:"principal_id"`
-	PrincipalType string                `json:"principal_type"`
-	Permissions   []EffectivePermission `json:"permissions"`
-	GeneratedAt   time.Time             `json:"generated_at"`
-}
-
-type EffectivePermission struct {
-	Resource   string   `json:"resource"`
-	Actions    []string `json:"actions"`
-	Effect     string   `json:"effect"`
-	Source     string   `json:"source"` // policy name or role
-	Conditions []string `json:"conditions,omitempty"`
+	Trace      *authz.Trace            `json:"trace,omitempty"`
+	// Error is why a check of a batch could not be decided
+	Error string `json:"error,omitempty"`
+}
+
+// AccessSimulationRequest is a hypothetical access request. Without a policy
+// document it is evaluated against the principal's existing policies,
+// resource permissions and shares; with one, against that unsaved candidate
+// alone or, when include_existing is set, as if it were attached to the
+// principal.
+type AccessSimulationRequest struct {
+	PrincipalID     string                   `json:"principal_id"`
+	PrincipalType   string                   `json:"principal_type"`
+	Resource        string                   `json:"resource"`
+	Action          string                   `json:"action"`
+	Context         *PolicyEvaluationContext `json:"context"`
+	TokenScopes     []string                 `json:"token_scopes,omitempty"`
+	PolicyDocument  string                   `json:"policy_document,omitempty"`
+	IncludeExisting bool                     `json:"include_existing,omitempty"`
+}
+
+// PolicyGrant is a policy that applies to a principal and the role
+// assignment it comes through
+type PolicyGrant struct {
+	PolicyID   string
+	PolicyName string
+	Document   string
+	RoleID     string
+	RoleName   string
+	// GroupID and GroupName are empty for roles assigned to the principal
+	// itself
+	GroupID   string
+	GroupName string
 }
 
 type policyQueries struct {
 	db    *database.DB
-	redis *redis.Client
+	redis redis.UniversalClient
 	tx    *sql.Tx
 	ctx   context.Context
 }
 
-func NewPolicyQueries(db *database.DB, redis *redis.Client) PolicyQueries {
+func NewPolicyQueries(db *database.DB, redis redis.UniversalClient) PolicyQueries {
 	return &policyQueries{db: db, redis: redis, ctx: context.Background()}
 }
 
@@ -152,11 +199,20 @@ func (q *policyQueries) WithContext(ctx context.Context) PolicyQueries {
 	return &policyQueries{db: q.db, redis: q.redis, tx: q.tx, ctx: ctx}
 }
 
+// reader returns the connection for reads that tolerate replication lag:
+// the transaction if there is one, otherwise a replica
+func (q *policyQueries) reader() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.Reader()
+}
+
 func (q *policyQueries) ListPolicies(params ListParams, organizationID string) (*ListResult[*models.Policy], error) {
 	query := `
 		SELECT id, name, description, version, organization_id, document, policy_type,
 		       effect, is_system_policy, created_by, approved_by, approved_at, status,
-		       created_at, updated_at, deleted_at
+		       lock_version, created_at, updated_at, deleted_at
 		FROM policies 
 		WHERE deleted_at IS NULL`
 	args := []interface{}{}
@@ -168,19 +224,30 @@ func (q *policyQueries) ListPolicies(params ListParams, organizationID string) (
 		args = append(args, organizationID)
 	}
 
-	if params.SortBy != "" {
-		query += fmt.Sprintf(" ORDER BY %s %s", params.SortBy, params.Order)
-	} else {
-		query += " ORDER BY created_at DESC"
+	sortBy := "created_at"
+	switch params.SortBy {
+	case "created_at", "updated_at", "name", "status", "policy_type":
+		sortBy = params.SortBy
+	}
+	order := "DESC"
+	if strings.EqualFold(params.Order, "ASC") {
+		order = "ASC"
+	}
+	ks, err := newKeyset(params, sortBy, sortBy, "id", order)
+	if err != nil {
+		return nil, err
+	}
+	if clause, cursorArgs := ks.where(argCount + 1); clause != "" {
+		query += " AND " + clause
+		args = append(args, cursorArgs...)
+		argCount += len(cursorArgs)
 	}
 
+	query += " ORDER BY " + ks.orderBy()
 	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argCount+1, argCount+2)
-	args = append(args, params.Limit, params.Offset)
+	args = append(args, ks.limit(params.Limit), ks.offset(params.Offset))
 
-	var db DBTX = q.db
-	if q.tx != nil {
-		db = q.tx
-	}
+	db := q.reader()
 
 	rows, err := db.QueryContext(q.ctx, query, args...)
 	if err != nil {
@@ -193,7 +260,7 @@ func (q *policyQueries) ListPolicies(params ListParams, organizationID string) (
 		var p models.Policy
 		err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.Version, &p.OrganizationID,
 			&p.Document, &p.PolicyType, &p.Effect, &p.IsSystemPolicy, &p.CreatedBy,
-			&p.ApprovedBy, &p.ApprovedAt, &p.Status, &p.CreatedAt, &p.UpdatedAt, &p.DeletedAt)
+			&p.ApprovedBy, &p.ApprovedAt, &p.Status, &p.LockVersion, &p.CreatedAt, &p.UpdatedAt, &p.DeletedAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan policy: %w", err)
 		}
@@ -215,13 +282,28 @@ func (q *policyQueries) ListPolicies(params ListParams, organizationID string) (
 		return nil, fmt.Errorf("failed to count policies: %w", err)
 	}
 
+	policyPtrs, hasMore, nextCursor := page(ks, policyPtrs, params.Limit, func(p *models.Policy) (string, string) {
+		switch sortBy {
+		case "updated_at":
+			return cursorTime(p.UpdatedAt), p.ID
+		case "name":
+			return p.Name, p.ID
+		case "status":
+			return p.Status, p.ID
+		case "policy_type":
+			return p.PolicyType, p.ID
+		}
+		return cursorTime(p.CreatedAt), p.ID
+	})
+
 	return &ListResult[*models.Policy]{
 		Items:      policyPtrs,
 		Total:      int64(total),
 		Limit:      params.Limit,
-		Offset:     params.Offset,
-		HasMore:    (params.Offset + params.Limit) < total,
+		Offset:     ks.offset(params.Offset),
+		HasMore:    hasMore,
 		TotalPages: (total + params.Limit - 1) / params.Limit,
+		NextCursor: nextCursor,
 	}, nil
 }
 
@@ -262,6 +344,7 @@ func (q *policyQueries) CreatePolicy(policy *models.Policy) error {
 	if err != nil {
 		return fmt.Errorf("failed to create policy: %w", err)
 	}
+	policy.LockVersion = 1
 
 	// Create initial version record
 	versionQuery := `
@@ -284,7 +367,7 @@ func (q *policyQueries) GetPolicy(id, organizationID string) (*models.Policy, er
 	query := `
 		SELECT id, name, description, version, organization_id, document, policy_type,
 		       effect, is_system_policy, created_by, approved_by, approved_at, status,
-		       created_at, updated_at, deleted_at
+		       lock_version, created_at, updated_at, deleted_at
 		FROM policies 
 		WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL`
 
@@ -297,7 +380,7 @@ func (q *policyQueries) GetPolicy(id, organizationID string) (*models.Policy, er
 	err := db.QueryRowContext(q.ctx, query, id, organizationID).Scan(
 		&p.ID, &p.Name, &p.Description, &p.Version, &p.OrganizationID,
 		&p.Document, &p.PolicyType, &p.Effect, &p.IsSystemPolicy, &p.CreatedBy,
-		&p.ApprovedBy, &p.ApprovedAt, &p.Status, &p.CreatedAt, &p.UpdatedAt, &p.DeletedAt)
+		&p.ApprovedBy, &p.ApprovedAt, &p.Status, &p.LockVersion, &p.CreatedAt, &p.UpdatedAt, &p.DeletedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("policy not found")
@@ -324,6 +407,11 @@ func (q *policyQueries) UpdatePolicy(policy *models.Policy, organizationID strin
 	if policy.Status == "" {
 		policy.Status = currentPolicy.Status
 	}
+	// policy.LockVersion is the version the caller read; 0 matches any
+	if policy.LockVersion != 0 && policy.LockVersion != currentPolicy.LockVersion {
+		return &StaleVersionError{Current: currentPolicy.LockVersion}
+	}
+	expected := currentPolicy.LockVersion
 
 	// Create new version if document changed
 	if currentPolicy.Document != policy.Document {
@@ -354,8 +442,9 @@ func (q *policyQueries) UpdatePolicy(policy *models.Policy, organizationID strin
 	query := `
 		UPDATE policies SET
 			name = $2, description = $3, version = $4, document = $5, policy_type = $6,
-			effect = $7, status = $8, updated_at = $9
-		WHERE id = $1 AND organization_id = $10 AND deleted_at IS NULL`
+			effect = $7, status = $8, updated_at = $9, lock_version = lock_version + 1
+		WHERE id = $1 AND organization_id = $10 AND deleted_at IS NULL AND lock_version = $11
+		RETURNING lock_version`
 
 	var db DBTX = q.db
 	if q.tx != nil {
@@ -363,21 +452,21 @@ func (q *policyQueries) UpdatePolicy(policy *models.Policy, organizationID strin
 	}
 
 	policy.UpdatedAt = time.Now()
-	result, err := db.ExecContext(q.ctx, query,
+	err = db.QueryRowContext(q.ctx, query,
 		policy.ID, policy.Name, policy.Description, policy.Version, policy.Document,
-		policy.PolicyType, policy.Effect, policy.Status, policy.UpdatedAt, organizationID)
+		policy.PolicyType, policy.Effect, policy.Status, policy.UpdatedAt, organizationID, expected,
+	).Scan(&policy.LockVersion)
 
-	if err != nil {
-		return fmt.Errorf("failed to update policy: %w", err)
+	if err == sql.ErrNoRows {
+		// Changed or deleted since it was read above
+		latest, getErr := q.GetPolicy(policy.ID, organizationID)
+		if getErr != nil {
+			return fmt.Errorf("policy not found or already deleted")
+		}
+		return &StaleVersionError{Current: latest.LockVersion}
 	}
-
-	rows, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to check update result: %w", err)
-	}
-
-	if rows == 0 {
-		return fmt.Errorf("policy not found or already deleted")
+		return fmt.Errorf("failed to update policy: %w", err)
 	}
 
 	return nil
@@ -444,7 +533,8 @@ func (q *policyQueries) GetPolicyVersions(policyID, organizationID string) ([]*P
 func (q *policyQueries) ApprovePolicy(policyID, organizationID, approvedBy string) error {
 	query := `
 		UPDATE policies SET 
-			status = 'active', approved_by = $2, approved_at = $3, updated_at = $3
+			status = 'active', approved_by = $2, approved_at = $3, updated_at = $3,
+			lock_version = lock_version + 1
 		WHERE id = $1 AND organization_id = $4 AND deleted_at IS NULL`
 
 	var db DBTX = q.db
@@ -505,7 +595,8 @@ func (q *policyQueries) RollbackPolicy(policyID, organizationID, toVersion strin
 	// Update policy to use the target version
 	updateQuery := `
 		UPDATE policies SET 
-			document = $2, version = $3, status = 'active', updated_at = $4
+			document = $2, version = $3, status = 'active', updated_at = $4,
+			lock_version = lock_version + 1
 		WHERE id = $1 AND organization_id = $5 AND deleted_at IS NULL`
 
 	now := time.Now()
@@ -526,73 +617,6 @@ func (q *policyQueries) RollbackPolicy(policyID, organizationID, toVersion strin
 	return nil
 }
 
-// Continuing with simulation and evaluation methods...
-func (q *policyQueries) SimulatePolicy(request *PolicySimulationRequest) (*PolicySimulationResult, error) {
-	result := &PolicySimulationResult{
-		Valid:       true,
-		Errors:      []string{},
-		TestResults: []*PolicyTestResult{},
-	}
-
-	// Validate policy document syntax
-	if err := q.validatePolicyDocument(request.PolicyDocument); err != nil {
-		result.Valid = false
-		result.Errors = append(result.Errors, err.Error())
-		return result, nil
-	}
-
-	// Evaluate policy with provided context
-	if request.Context != nil {
-		evaluation, err := q.EvaluatePolicy(request.PolicyDocument, request.Context)
-		if err != nil {
-			result.Valid = false
-			result.Errors = append(result.Errors, err.Error())
-		} else {
-			result.Evaluation = evaluation
-		}
-	}
-
-	// Run test cases if provided
-	for _, testCase := range request.TestCases {
-		testResult := &PolicyTestResult{
-			TestCase: testCase,
-		}
-
-		// Build context from test case if not provided
-		context := testCase.Context
-		if context == nil {
-			context = &PolicyEvaluationContext{
-				Principal: testCase.Principal,
-				Resource:  testCase.Resource,
-				Action:    testCase.Action,
-			}
-		}
-
-		evaluation, err := q.EvaluatePolicy(request.PolicyDocument, context)
-		if err != nil {
-			testResult.Result = &PolicyEvaluationResult{
-				Effect:   "error",
-				Decision: "error",
-				Reasons:  []string{err.Error()},
-			}
-			testResult.Passed = false
-			testResult.Message = err.Error()
-		} else {
-			testResult.Result = evaluation
-			testResult.Passed = (evaluation.Effect == testCase.Expected)
-			if testResult.Passed {
-				testResult.Message = "Test passed"
-			} else {
-				testResult.Message = fmt.Sprintf("Expected %s, got %s", testCase.Expected, evaluation.Effect)
-			}
-		}
-
-		result.TestResults = append(result.TestResults, testResult)
-	}
-
-	return result, nil
-}
-
 func (q *policyQueries) EvaluatePolicy(policyDocument string, context *PolicyEvaluationContext) (*PolicyEvaluationResult, error) {
 	// Parse policy document
 	var policy map[string]interface{}
@@ -686,99 +710,6 @@ func (q *policyQueries) CheckPermission(organizationID string, request *Permissi
 	return result, nil
 }
 
-func (q *policyQueries) BulkCheckPermissions(organizationID string, requests []*PermissionCheckRequest) ([]*PermissionCheckResult, error) {
-	results := make([]*PermissionCheckResult, len(requests))
-
-	for i, request := range requests {
-		result, err := q.CheckPermission(organizationID, request)
-		if err != nil {
-			results[i] = &PermissionCheckResult{
-				Allowed:  false,
-				Decision: "error",
-				Request:  request,
-				Evaluation: &PolicyEvaluationResult{
-					Effect:   "deny",
-					Decision: "error",
-					Reasons:  []string{err.Error()},
-				},
-			}
-		} else {
-			results[i] = result
-		}
-	}
-
-	return results, nil
-}
-
-func (q *policyQueries) GetEffectivePermissions(principalID, principalType, organizationID string) (*EffectivePermissions, error) {
-	// Get all policies for the principal
-	policies, err := q.getPrincipalPolicies(principalID, principalType, organizationID)
-	if err != nil {
-		return nil, err
-	}
-
-	effective := &EffectivePermissions{
-		PrincipalID:   principalID,
-		PrincipalType: principalType,
-		Permissions:   []EffectivePermission{},
-		GeneratedAt:   time.Now(),
-	}
-
-	resourcePermissions := make(map[string]*EffectivePermission)
-
-	// Process each policy
-	for _, policy := range policies {
-		var policyDoc map[string]interface{}
-		if err := json.Unmarshal([]byte(policy.Document), &policyDoc); err != nil {
-			continue // Skip invalid policies
-		}
-
-		statements, ok := policyDoc["Statement"].([]interface{})
-		if !ok {
-			continue
-		}
-
-		for _, stmt := range statements {
-			statement := stmt.(map[string]interface{})
-			effect := strings.ToLower(statement["Effect"].(string))
-
-			// Extract resources and actions
-			resources := q.extractStringArray(statement["Resource"])
-			actions := q.extractStringArray(statement["Action"])
-
-			for _, resource := range resources {
-				if perm, exists := resourcePermissions[resource]; exists {
-					// Merge actions
-					for _, action := range actions {
-						if !q.contains(perm.Actions, action) {
-							perm.Actions = append(perm.Actions, action)
-						}
-					}
-					// Deny overrides allow
-					if effect == "deny" {
-						perm.Effect = "deny"
-					}
-				} else {
-					resourcePermissions[resource] = &EffectivePermission{
-						Resource: resource,
-						Actions:  actions,
-						Effect:   effect,
-						Source:   policy.Name,
-					}
-				}
-			}
-		}
-	}
-
-	// Convert map to slice
-	for _, perm := range resourcePermissions {
-		effective.Permissions = append(effective.Permissions, *perm)
-	}
-
-	return effective, nil
-}
-
-// Helper methods
 func (q *policyQueries) validatePolicyDocument(document string) error {
 	var policy map[string]interface{}
 	if err := json.Unmarshal([]byte(document), &policy); err != nil {
@@ -889,6 +820,56 @@ func (q *policyQueries) GetPrincipalPolicies(principalID, principalType, organiz
 	return q.getPrincipalPolicies(principalID, principalType, organizationID)
 }
 
+func (q *policyQueries) GetPrincipalPolicyGrants(principalID, principalType, organizationID string) ([]PolicyGrant, error) {
+	query := `
+		WITH principal_roles AS (
+			SELECT ra.role_id, NULL::uuid AS group_id
+			FROM role_assignments ra
+			WHERE ra.principal_id = $1 AND ra.principal_type = $2
+			  AND (ra.expires_at IS NULL OR ra.expires_at > NOW())
+
+			UNION
+
+			SELECT ra.role_id, gm.group_id
+			FROM role_assignments ra
+			JOIN group_memberships gm ON ra.principal_id = gm.group_id
+			WHERE gm.principal_id = $1 AND gm.principal_type = $2
+			  AND ra.principal_type = 'group'
+			  AND (ra.expires_at IS NULL OR ra.expires_at > NOW())
+			  AND (gm.expires_at IS NULL OR gm.expires_at > NOW())
+		)
+		SELECT p.id, p.name, p.document, r.id, r.name,
+		       COALESCE(g.id::text, ''), COALESCE(g.name, '')
+		FROM principal_roles pr
+		JOIN roles r ON r.id = pr.role_id
+		JOIN role_policies rp ON rp.role_id = pr.role_id
+		JOIN policies p ON p.id = rp.policy_id
+		LEFT JOIN groups g ON g.id = pr.group_id
+		WHERE p.status = 'active' AND p.organization_id = $3
+		ORDER BY p.name, r.name, g.name NULLS FIRST`
+
+	var db DBTX = q.db
+	if q.tx != nil {
+		db = q.tx
+	}
+
+	rows, err := db.QueryContext(q.ctx, query, principalID, principalType, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get principal policy grants: %w", err)
+	}
+	defer rows.Close()
+
+	var grants []PolicyGrant
+	for rows.Next() {
+		var g PolicyGrant
+		if err := rows.Scan(&g.PolicyID, &g.PolicyName, &g.Document, &g.RoleID, &g.RoleName, &g.GroupID, &g.GroupName); err != nil {
+			return nil, fmt.Errorf("failed to scan policy grant: %w", err)
+		}
+		grants = append(grants, g)
+	}
+	return grants, rows.Err()
+}
+
 func (q *policyQueries) getPrincipalPolicies(principalID, principalType, organizationID string) ([]*models.Policy, error) {
 	// 1. Get direct policy attachments
 	// 2. Get policies through role assignments (Direct + via Groups)
@@ -948,12 +929,3 @@ func (q *policyQueries) getPrincipalPolicies(principalID, principalType, organiz
 
 	return policies, nil
 }
-
-func (q *policyQueries) contains(slice []string, item string) bool {
-	for _, s := range slice {
-		if s == item {
-			return true
-		}
-	}
-	return false
-}
@@ -0,0 +1,102 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/database"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// PrincipalQueries looks up users, service accounts and groups alike
+// through the principals view
+type PrincipalQueries interface {
+	WithTx(tx *sql.Tx) PrincipalQueries
+	WithContext(ctx context.Context) PrincipalQueries
+
+	// GetPrincipal returns the principal of the organization with the ID,
+	// a UUID. An empty principalType matches a principal of any type.
+	GetPrincipal(id, principalType, organizationID string) (*models.Principal, error)
+	// ListPrincipals returns the principals of the organization among ids,
+	// which must be UUIDs; IDs that name none are left out
+	ListPrincipals(ids []string, organizationID string) ([]models.Principal, error)
+}
+
+type principalQueries struct {
+	db    *database.DB
+	redis redis.UniversalClient
+	tx    *sql.Tx
+	ctx   context.Context
+}
+
+// NewPrincipalQueries creates a new PrincipalQueries instance
+func NewPrincipalQueries(db *database.DB, redis redis.UniversalClient) PrincipalQueries {
+	return &principalQueries{db: db, redis: redis, ctx: context.Background()}
+}
+
+func (q *principalQueries) WithTx(tx *sql.Tx) PrincipalQueries {
+	return &principalQueries{db: q.db, redis: q.redis, tx: tx, ctx: q.ctx}
+}
+
+func (q *principalQueries) WithContext(ctx context.Context) PrincipalQueries {
+	return &principalQueries{db: q.db, redis: q.redis, tx: q.tx, ctx: ctx}
+}
+
+func (q *principalQueries) conn() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.DB
+}
+
+const principalColumns = `id, principal_type, organization_id, name, display_name, COALESCE(email, ''), status, created_at`
+
+func scanPrincipal(row interface{ Scan(...interface{}) error }) (*models.Principal, error) {
+	var p models.Principal
+	if err := row.Scan(&p.ID, &p.Type, &p.OrganizationID, &p.Name, &p.DisplayName, &p.Email, &p.Status, &p.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (q *principalQueries) GetPrincipal(id, principalType, organizationID string) (*models.Principal, error) {
+	p, err := scanPrincipal(q.conn().QueryRowContext(q.ctx, `
+		SELECT `+principalColumns+`
+		FROM principals
+		WHERE id = $1 AND organization_id = $2 AND ($3 = '' OR principal_type::text = $3)
+		LIMIT 1`, id, organizationID, principalType))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("principal not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get principal: %w", err)
+	}
+	return p, nil
+}
+
+func (q *principalQueries) ListPrincipals(ids []string, organizationID string) ([]models.Principal, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	rows, err := q.conn().QueryContext(q.ctx, `
+		SELECT `+principalColumns+`
+		FROM principals
+		WHERE id = ANY($1::uuid[]) AND organization_id = $2`, pq.Array(ids), organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("list principals: %w", err)
+	}
+	defer rows.Close()
+
+	var principals []models.Principal
+	for rows.Next() {
+		p, err := scanPrincipal(rows)
+		if err != nil {
+			return nil, err
+		}
+		principals = append(principals, *p)
+	}
+	return principals, rows.Err()
+}
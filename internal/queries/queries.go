@@ -22,12 +22,24 @@ type Queries struct {
 	GlobalSettings GlobalSettingsQueries
 	OIDC           OIDCQueries
 	Content        ContentQueries
+	AuthzDecision  AuthzDecisionQueries
+	Stats          StatsQueries
+	ExternalID     ExternalIDQueries
+	OrgDeletion    OrganizationDeletionQueries
+	EncryptionKey  EncryptionKeyQueries
+	KMS            KMSQueries
+	Principal      PrincipalQueries
+	Delegation     DelegationQueries
+	EmailTemplate  EmailTemplateQueries
+	ClaimsWebhook  ClaimsWebhookQueries
+	DirectorySync  DirectorySyncQueries
 	db             *database.DB
-	redis          *redis.Client
+	redis          redis.UniversalClient
+	tx             *sql.Tx // set by WithTx
 }
 
 // New creates a new Queries instance with all query implementations
-func New(db *database.DB, redis *redis.Client) *Queries {
+func New(db *database.DB, redis redis.UniversalClient) *Queries {
 	return &Queries{
 		Auth:           NewAuthQueries(db, redis),
 		User:           NewUserQueries(db, redis),
@@ -41,6 +53,17 @@ func New(db *database.DB, redis *redis.Client) *Queries {
 		GlobalSettings: NewGlobalSettingsQueries(db, redis),
 		OIDC:           NewOIDCQueries(db, redis),
 		Content:        NewContentQueries(db, redis),
+		AuthzDecision:  NewAuthzDecisionQueries(db, redis),
+		Stats:          NewStatsQueries(db, redis),
+		ExternalID:     NewExternalIDQueries(db, redis),
+		OrgDeletion:    NewOrganizationDeletionQueries(db, redis),
+		EncryptionKey:  NewEncryptionKeyQueries(db, redis),
+		KMS:            NewKMSQueries(db, redis),
+		Principal:      NewPrincipalQueries(db, redis),
+		Delegation:     NewDelegationQueries(db, redis),
+		EmailTemplate:  NewEmailTemplateQueries(db, redis),
+		ClaimsWebhook:  NewClaimsWebhookQueries(db, redis),
+		DirectorySync:  NewDirectorySyncQueries(db, redis),
 		db:             db,
 		redis:          redis,
 	}
@@ -61,8 +84,20 @@ func (q *Queries) WithTx(tx *sql.Tx) *Queries {
 		GlobalSettings: q.GlobalSettings.WithTx(tx),
 		OIDC:           q.OIDC.WithTx(tx),
 		Content:        q.Content.WithTx(tx),
+		AuthzDecision:  q.AuthzDecision.WithTx(tx),
+		Stats:          q.Stats.WithTx(tx),
+		ExternalID:     q.ExternalID.WithTx(tx),
+		OrgDeletion:    q.OrgDeletion.WithTx(tx),
+		EncryptionKey:  q.EncryptionKey.WithTx(tx),
+		KMS:            q.KMS.WithTx(tx),
+		Principal:      q.Principal.WithTx(tx),
+		Delegation:     q.Delegation.WithTx(tx),
+		EmailTemplate:  q.EmailTemplate.WithTx(tx),
+		ClaimsWebhook:  q.ClaimsWebhook.WithTx(tx),
+		DirectorySync:  q.DirectorySync.WithTx(tx),
 		db:             q.db,
 		redis:          q.redis,
+		tx:             tx,
 	}
 }
 
@@ -81,8 +116,20 @@ func (q *Queries) WithContext(ctx context.Context) *Queries {
 		GlobalSettings: q.GlobalSettings.WithContext(ctx),
 		OIDC:           q.OIDC.WithContext(ctx),
 		Content:        q.Content.WithContext(ctx),
+		AuthzDecision:  q.AuthzDecision.WithContext(ctx),
+		Stats:          q.Stats.WithContext(ctx),
+		ExternalID:     q.ExternalID.WithContext(ctx),
+		OrgDeletion:    q.OrgDeletion.WithContext(ctx),
+		EncryptionKey:  q.EncryptionKey.WithContext(ctx),
+		KMS:            q.KMS.WithContext(ctx),
+		Principal:      q.Principal.WithContext(ctx),
+		Delegation:     q.Delegation.WithContext(ctx),
+		EmailTemplate:  q.EmailTemplate.WithContext(ctx),
+		ClaimsWebhook:  q.ClaimsWebhook.WithContext(ctx),
+		DirectorySync:  q.DirectorySync.WithContext(ctx),
 		db:             q.db,
 		redis:          q.redis,
+		tx:             q.tx,
 	}
 }
 
@@ -92,14 +139,16 @@ type ListParams struct {
 	Offset int
 	SortBy string
 	Order  string // ASC, DESC
+	Cursor string // Opaque cursor from ListResult.NextCursor; takes precedence over Offset
 }
 
 // Common response for list queries
 type ListResult[T any] struct {
-	Items      []T   `json:"items"`
-	Total      int64 `json:"total"`
-	Limit      int   `json:"limit"`
-	Offset     int   `json:"offset"`
-	HasMore    bool  `json:"has_more"`
-	TotalPages int   `json:"total_pages"`
+	Items      []T    `json:"items"`
+	Total      int64  `json:"total"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	HasMore    bool   `json:"has_more"`
+	TotalPages int    `json:"total_pages"`
+	NextCursor string `json:"next_cursor,omitempty"`
 }
@@ -0,0 +1,88 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/the-monkeys/monkeys-identity/internal/database"
+)
+
+// recorder is a database/sql driver that records every statement and its
+// arguments and behaves like a database without matching rows
+type recorder struct {
+	mu         sync.Mutex
+	statements []recordedStatement
+}
+
+type recordedStatement struct {
+	query string
+	args  []driver.Value
+}
+
+func (r *recorder) record(query string, args []driver.Value) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statements = append(r.statements, recordedStatement{query: query, args: args})
+}
+
+func (r *recorder) last(t *testing.T) recordedStatement {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.statements) == 0 {
+		t.Fatal("no statement was executed")
+	}
+	return r.statements[len(r.statements)-1]
+}
+
+func (r *recorder) Connect(context.Context) (driver.Conn, error) { return recorderConn{r}, nil }
+func (r *recorder) Driver() driver.Driver                        { return nil }
+
+type recorderConn struct{ r *recorder }
+
+func (c recorderConn) Prepare(query string) (driver.Stmt, error) {
+	return recorderStmt{r: c.r, query: query}, nil
+}
+func (c recorderConn) Close() error              { return nil }
+func (c recorderConn) Begin() (driver.Tx, error) { return recorderTx{c.r}, nil }
+
+// recorderTx records the end of a transaction as a COMMIT or ROLLBACK
+// statement
+type recorderTx struct{ r *recorder }
+
+func (tx recorderTx) Commit() error   { tx.r.record("COMMIT", nil); return nil }
+func (tx recorderTx) Rollback() error { tx.r.record("ROLLBACK", nil); return nil }
+
+type recorderStmt struct {
+	r     *recorder
+	query string
+}
+
+func (s recorderStmt) Close() error  { return nil }
+func (s recorderStmt) NumInput() int { return -1 }
+func (s recorderStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.r.record(s.query, args)
+	return driver.RowsAffected(0), nil
+}
+func (s recorderStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.r.record(s.query, args)
+	return emptyRows{}, nil
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string              { return []string{"col"} }
+func (emptyRows) Close() error                   { return nil }
+func (emptyRows) Next(dest []driver.Value) error { return io.EOF }
+
+func newRecorderDB(t *testing.T) (*database.DB, *recorder) {
+	t.Helper()
+	r := &recorder{}
+	db := sql.OpenDB(r)
+	t.Cleanup(func() { db.Close() })
+	return &database.DB{DB: db}, r
+}
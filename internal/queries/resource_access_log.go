@@ -0,0 +1,210 @@
+package queries
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Resource types recorded in the access log
+const (
+	AccessLogResource = "resource"
+	AccessLogContent  = "content"
+)
+
+// ResourceAccessLog is one read or write of a resource or content item, or
+// a denied attempt at one
+type ResourceAccessLog struct {
+	ID             string    `json:"id" db:"id"`
+	OrganizationID string    `json:"organization_id" db:"organization_id"`
+	ResourceType   string    `json:"resource_type" db:"resource_type"`
+	ResourceID     string    `json:"resource_id" db:"resource_id"`
+	UserID         string    `json:"user_id" db:"user_id"`
+	PrincipalType  string    `json:"principal_type" db:"principal_type"`
+	Action         string    `json:"action" db:"action"`
+	IPAddress      string    `json:"ip_address" db:"ip_address"`
+	UserAgent      string    `json:"user_agent" db:"user_agent"`
+	Timestamp      time.Time `json:"timestamp" db:"timestamp"`
+	Success        bool      `json:"success" db:"success"`
+	Details        string    `json:"details" db:"details"`
+}
+
+// ResourceAccessLogFilter narrows GetResourceAccessLog. Empty fields match
+// everything.
+type ResourceAccessLogFilter struct {
+	ResourceType string
+	ResourceID   string
+	UserID       string
+	Action       string
+	Success      *bool
+	StartTime    *time.Time
+	EndTime      *time.Time
+}
+
+// RecordResourceAccess writes a batch of access log entries
+func (q *resourceQueries) RecordResourceAccess(entries []ResourceAccessLog) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	const columns = 11
+	values := make([]string, 0, len(entries))
+	args := make([]interface{}, 0, len(entries)*columns)
+	for i, e := range entries {
+		n := i * columns
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, NULLIF($%d, ''), $%d, $%d, NULLIF($%d, ''), NULLIF($%d, ''), $%d, $%d, NULLIF($%d, ''))",
+			n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10, n+11))
+		args = append(args, e.OrganizationID, e.ResourceType, e.ResourceID, e.UserID, e.PrincipalType,
+			e.Action, e.IPAddress, e.UserAgent, e.Timestamp, e.Success, e.Details)
+	}
+	_, err := q.conn().ExecContext(q.ctx, `
+		INSERT INTO resource_access_log
+			(organization_id, resource_type, resource_id, user_id, principal_type, action, ip_address, user_agent, timestamp, success, details)
+		VALUES `+strings.Join(values, ", "), args...)
+	if err != nil {
+		return fmt.Errorf("failed to record resource access: %w", err)
+	}
+
+	// Resources used are not idle, for their lifecycle policy
+	var used []string
+	var last time.Time
+	for _, e := range entries {
+		if e.ResourceType == AccessLogResource && e.Success {
+			used = append(used, e.ResourceID)
+			if e.Timestamp.After(last) {
+				last = e.Timestamp
+			}
+		}
+	}
+	if len(used) == 0 {
+		return nil
+	}
+	_, err = q.conn().ExecContext(q.ctx, `
+		UPDATE resources SET accessed_at = $2
+		WHERE id = ANY($1::uuid[]) AND (accessed_at IS NULL OR accessed_at < $2)`, pq.Array(used), last)
+	if err != nil {
+		return fmt.Errorf("failed to record resource use: %w", err)
+	}
+	return nil
+}
+
+// GetResourceAccessLog returns the access log entries of the organization
+// matching the filter, the newest first
+func (q *resourceQueries) GetResourceAccessLog(organizationID string, filter ResourceAccessLogFilter, params ListParams) (*ListResult[*ResourceAccessLog], error) {
+	ks, err := newKeyset(params, "timestamp", "ral.timestamp", "ral.id", "DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	where := []string{"ral.organization_id = $1"}
+	args := []interface{}{organizationID}
+	add := func(cond string, v interface{}) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if filter.ResourceType != "" {
+		add("ral.resource_type = $%d", filter.ResourceType)
+	}
+	if filter.ResourceID != "" {
+		add("ral.resource_id = $%d", filter.ResourceID)
+	}
+	if filter.UserID != "" {
+		add("ral.user_id = $%d", filter.UserID)
+	}
+	if filter.Action != "" {
+		add("ral.action = $%d", filter.Action)
+	}
+	if filter.Success != nil {
+		add("ral.success = $%d", *filter.Success)
+	}
+	if filter.StartTime != nil {
+		add("ral.timestamp >= $%d", *filter.StartTime)
+	}
+	if filter.EndTime != nil {
+		add("ral.timestamp < $%d", *filter.EndTime)
+	}
+	whereClause := strings.Join(where, " AND ")
+
+	var total int
+	if err := q.reader().QueryRowContext(q.ctx,
+		"SELECT COUNT(*) FROM resource_access_log ral WHERE "+whereClause, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("failed to count access log: %w", err)
+	}
+
+	pageWhere := whereClause
+	pageArgs := append([]interface{}{}, args...)
+	if clause, cursorArgs := ks.where(len(pageArgs) + 1); clause != "" {
+		pageWhere += " AND " + clause
+		pageArgs = append(pageArgs, cursorArgs...)
+	}
+	query := fmt.Sprintf(`
+		SELECT ral.id, ral.organization_id, ral.resource_type, ral.resource_id, COALESCE(ral.user_id, ''), ral.principal_type,
+		       ral.action, COALESCE(ral.ip_address, ''), COALESCE(ral.user_agent, ''), ral.timestamp, ral.success,
+		       COALESCE(ral.details, '')
+		FROM resource_access_log ral
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, pageWhere, ks.orderBy(), len(pageArgs)+1, len(pageArgs)+2)
+	pageArgs = append(pageArgs, ks.limit(params.Limit), ks.offset(params.Offset))
+
+	rows, err := q.reader().QueryContext(q.ctx, query, pageArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access log: %w", err)
+	}
+	defer rows.Close()
+
+	logs := []*ResourceAccessLog{}
+	for rows.Next() {
+		var log ResourceAccessLog
+		if err := rows.Scan(&log.ID, &log.OrganizationID, &log.ResourceType, &log.ResourceID, &log.UserID,
+			&log.PrincipalType, &log.Action, &log.IPAddress, &log.UserAgent, &log.Timestamp, &log.Success,
+			&log.Details); err != nil {
+			return nil, fmt.Errorf("failed to scan access log: %w", err)
+		}
+		logs = append(logs, &log)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get access log: %w", err)
+	}
+
+	logs, hasMore, nextCursor := page(ks, logs, params.Limit, func(l *ResourceAccessLog) (string, string) {
+		return cursorTime(l.Timestamp), l.ID
+	})
+	return &ListResult[*ResourceAccessLog]{
+		Items:      logs,
+		Total:      int64(total),
+		Limit:      params.Limit,
+		Offset:     ks.offset(params.Offset),
+		HasMore:    hasMore,
+		TotalPages: (total + params.Limit - 1) / params.Limit,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// PurgeResourceAccessLog deletes the access log entries older than the
+// retention of their organization: its resource_access_log_retention_days
+// setting, else the given default. A default of zero or less keeps the
+// entries of organizations without the setting.
+func (q *resourceQueries) PurgeResourceAccessLog(defaultRetentionDays int) (int64, error) {
+	res, err := q.conn().ExecContext(q.ctx, `
+		WITH retention AS (
+			SELECT id, COALESCE((settings->>'resource_access_log_retention_days')::int, $1) AS days
+			FROM organizations
+		)
+		DELETE FROM resource_access_log ral
+		USING retention r
+		WHERE ral.organization_id = r.id AND r.days > 0
+		  AND ral.timestamp < NOW() - make_interval(days => r.days)`, defaultRetentionDays)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge resource access log: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (q *resourceQueries) conn() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.DB
+}
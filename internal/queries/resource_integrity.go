@@ -0,0 +1,116 @@
+package queries
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// Checksum states of a resource
+const (
+	ChecksumUnverified = "unverified"
+	ChecksumValid      = "valid"
+	ChecksumMismatch   = "mismatch"
+	ChecksumMissing    = "missing"
+)
+
+func scanResourceIntegrity(row interface{ Scan(...interface{}) error }) (*models.ResourceIntegrity, error) {
+	i := models.ResourceIntegrity{Algorithm: "sha256"}
+	var storageKey sql.NullString
+	if err := row.Scan(&i.ResourceID, &i.OrganizationID, &i.ResourceName, &i.Checksum, &i.SizeBytes,
+		&i.Status, &i.VerifiedAt, &storageKey); err != nil {
+		return nil, err
+	}
+	i.BlobBacked = storageKey.Valid
+	i.StorageKey = storageKey.String
+	return &i, nil
+}
+
+// GetResourceIntegrity returns the stored checksum of a resource of the
+// organization and the outcome of its last check. Blobs are checked against
+// the checksum recorded when they were uploaded.
+func (q *resourceQueries) GetResourceIntegrity(id, organizationID string) (*models.ResourceIntegrity, error) {
+	i, err := scanResourceIntegrity(q.conn().QueryRowContext(q.ctx, `
+		SELECT r.id, r.organization_id, r.name, COALESCE(a.checksum, r.checksum), COALESCE(a.size_bytes, r.size_bytes),
+		       r.checksum_status, r.checksum_verified_at, a.storage_key
+		FROM resources r
+		LEFT JOIN content_attachments a ON a.id = r.id
+		WHERE r.id = $1 AND r.organization_id = $2 AND r.deleted_at IS NULL`, id, organizationID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("resource not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resource integrity: %w", err)
+	}
+	return i, nil
+}
+
+// SetResourceChecksum stores the checksum, and size if given, of a resource
+// of the organization whose content is not stored by the server. The
+// resource is unverified until a copy is checked against it.
+func (q *resourceQueries) SetResourceChecksum(id, organizationID, checksum string, sizeBytes *int64) error {
+	res, err := q.conn().ExecContext(q.ctx, `
+		UPDATE resources r SET checksum = $3, size_bytes = COALESCE($4, r.size_bytes),
+		       checksum_status = 'unverified', checksum_verified_at = NULL, updated_at = NOW()
+		WHERE r.id = $1 AND r.organization_id = $2 AND r.deleted_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM content_attachments a WHERE a.id = r.id)`,
+		id, organizationID, checksum, sizeBytes)
+	if err != nil {
+		return fmt.Errorf("failed to set resource checksum: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("resource not found")
+	}
+	return nil
+}
+
+// RecordChecksumVerification stores the outcome of a check of a resource
+// of the organization against its checksum
+func (q *resourceQueries) RecordChecksumVerification(id, organizationID, status string) error {
+	res, err := q.conn().ExecContext(q.ctx, `
+		UPDATE resources SET checksum_status = $3, checksum_verified_at = NOW()
+		WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL`, id, organizationID, status)
+	if err != nil {
+		return fmt.Errorf("failed to record checksum verification: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("resource not found")
+	}
+	return nil
+}
+
+// ClaimChecksumVerifications marks up to limit blob-backed resources of
+// every organization not checked since the given time as checked now, and
+// returns them for the caller to check, the least recently checked first
+func (q *resourceQueries) ClaimChecksumVerifications(before time.Time, limit int) ([]models.ResourceIntegrity, error) {
+	rows, err := q.conn().QueryContext(q.ctx, `
+		UPDATE resources u SET checksum_verified_at = NOW()
+		FROM content_attachments a
+		WHERE a.id = u.id AND u.id IN (
+			SELECT r.id FROM resources r
+			JOIN content_attachments ca ON ca.id = r.id
+			WHERE r.deleted_at IS NULL
+			  AND (r.checksum_verified_at IS NULL OR r.checksum_verified_at <= $1)
+			ORDER BY r.checksum_verified_at NULLS FIRST
+			LIMIT $2
+			FOR UPDATE OF r SKIP LOCKED
+		)
+		RETURNING u.id, u.organization_id, u.name, a.checksum, a.size_bytes,
+		          u.checksum_status, u.checksum_verified_at, a.storage_key`, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim checksum verifications: %w", err)
+	}
+	defer rows.Close()
+
+	claimed := []models.ResourceIntegrity{}
+	for rows.Next() {
+		i, err := scanResourceIntegrity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan resource integrity: %w", err)
+		}
+		claimed = append(claimed, *i)
+	}
+	return claimed, rows.Err()
+}
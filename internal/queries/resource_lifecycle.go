@@ -0,0 +1,218 @@
+package queries
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// defaultRecertifyGraceDays is how long owners have to recertify a
+// resource when its policy does not say
+const defaultRecertifyGraceDays = 30
+
+// Lifecycle actions and their reasons
+const (
+	LifecycleArchive                = "archive"
+	LifecycleDelete                 = "delete"
+	LifecycleRequestRecertification = "request_recertification"
+
+	LifecycleReasonIdle                  = "idle"
+	LifecycleReasonArchived              = "archived"
+	LifecycleReasonRecertificationDue    = "recertification_due"
+	LifecycleReasonRecertificationLapsed = "recertification_lapsed"
+)
+
+// lifecycleDays is the SQL for a number of days set in the lifecycle
+// policy of the resource aliased r, NULL when unset or not a number
+func lifecycleDays(key string) string {
+	return fmt.Sprintf(`(CASE WHEN jsonb_typeof(r.lifecycle_policy->'%[1]s') = 'number'
+		THEN (r.lifecycle_policy->>'%[1]s')::numeric::int END)`, key)
+}
+
+// lastActivity is the SQL for when the resource aliased r was last read,
+// updated or recertified
+const lastActivity = `GREATEST(r.created_at, r.updated_at, r.accessed_at, r.certified_at)`
+
+// GetResourceLifecycle returns where a resource of the organization stands
+// in its lifecycle policy, with the actions coming up
+func (q *resourceQueries) GetResourceLifecycle(id, organizationID string) (*models.ResourceLifecycle, error) {
+	var l models.ResourceLifecycle
+	var policy string
+	err := q.conn().QueryRowContext(q.ctx, `
+		SELECT r.id, r.status, r.lifecycle_policy, `+lastActivity+`, r.archived_at,
+		       COALESCE(r.certified_at, r.created_at), r.recertification_requested_at
+		FROM resources r
+		WHERE r.id = $1 AND r.organization_id = $2 AND r.deleted_at IS NULL`, id, organizationID).Scan(
+		&l.ResourceID, &l.Status, &policy, &l.LastActivityAt, &l.ArchivedAt, &l.CertifiedAt, &l.RecertificationRequestedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("resource not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resource lifecycle: %w", err)
+	}
+	// Policies stored before they had a schema may not fit it; what does
+	// not is off, as for the worker
+	_ = json.Unmarshal([]byte(policy), &l.Policy)
+	l.Upcoming = planLifecycle(&l)
+	return &l, nil
+}
+
+// planLifecycle returns the actions the worker will take on the resource,
+// soonest first, if nothing changes before. Only the first archive counts;
+// what would follow it on an active resource is left out.
+func planLifecycle(l *models.ResourceLifecycle) []models.LifecycleAction {
+	p := l.Policy
+	actions := []models.LifecycleAction{}
+	switch l.Status {
+	case "active":
+		var archive *models.LifecycleAction
+		consider := func(a models.LifecycleAction) {
+			if archive == nil || a.DueAt.Before(archive.DueAt) {
+				archive = &a
+			}
+		}
+		if p.ArchiveAfterIdleDays > 0 {
+			consider(models.LifecycleAction{
+				Action: LifecycleArchive,
+				Reason: LifecycleReasonIdle,
+				DueAt:  l.LastActivityAt.AddDate(0, 0, p.ArchiveAfterIdleDays),
+			})
+		}
+		var request *models.LifecycleAction
+		if p.RecertifyEveryDays > 0 {
+			grace := p.RecertifyGraceDays
+			if grace <= 0 {
+				grace = defaultRecertifyGraceDays
+			}
+			requestedAt := l.RecertificationRequestedAt
+			if requestedAt == nil {
+				due := l.CertifiedAt.AddDate(0, 0, p.RecertifyEveryDays)
+				request = &models.LifecycleAction{
+					Action: LifecycleRequestRecertification,
+					Reason: LifecycleReasonRecertificationDue,
+					DueAt:  due,
+				}
+				requestedAt = &due
+			}
+			consider(models.LifecycleAction{
+				Action: LifecycleArchive,
+				Reason: LifecycleReasonRecertificationLapsed,
+				DueAt:  requestedAt.AddDate(0, 0, grace),
+			})
+		}
+		if request != nil && (archive == nil || request.DueAt.Before(archive.DueAt)) {
+			actions = append(actions, *request)
+		}
+		if archive != nil {
+			actions = append(actions, *archive)
+			if p.DeleteAfterArchivedDays > 0 {
+				actions = append(actions, models.LifecycleAction{
+					Action: LifecycleDelete,
+					Reason: LifecycleReasonArchived,
+					DueAt:  archive.DueAt.AddDate(0, 0, p.DeleteAfterArchivedDays),
+				})
+			}
+		}
+	case "archived":
+		if p.DeleteAfterArchivedDays > 0 && l.ArchivedAt != nil {
+			actions = append(actions, models.LifecycleAction{
+				Action: LifecycleDelete,
+				Reason: LifecycleReasonArchived,
+				DueAt:  l.ArchivedAt.AddDate(0, 0, p.DeleteAfterArchivedDays),
+			})
+		}
+	}
+	sort.SliceStable(actions, func(i, j int) bool { return actions[i].DueAt.Before(actions[j].DueAt) })
+	return actions
+}
+
+// RecertifyResource records that the owner certified a resource of the
+// organization is still needed, restoring it if it was archived
+func (q *resourceQueries) RecertifyResource(id, organizationID string) error {
+	res, err := q.conn().ExecContext(q.ctx, `
+		UPDATE resources SET certified_at = NOW(), recertification_requested_at = NULL,
+		       status = CASE WHEN status = 'archived' THEN 'active'::entity_status ELSE status END,
+		       archived_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL`, id, organizationID)
+	if err != nil {
+		return fmt.Errorf("failed to recertify resource: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("resource not found")
+	}
+	return nil
+}
+
+// transitionResources applies set to up to limit resources of every
+// organization with a lifecycle policy matching cond, and returns them as
+// the transition named by action and reason
+func (q *resourceQueries) transitionResources(set, cond, action, reason string, limit int) ([]models.LifecycleTransition, error) {
+	rows, err := q.conn().QueryContext(q.ctx, `
+		UPDATE resources u SET `+set+`
+		WHERE u.id IN (
+			SELECT r.id FROM resources r
+			WHERE r.deleted_at IS NULL AND r.lifecycle_policy <> '{}'::jsonb AND `+cond+`
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING u.organization_id, u.id, u.name, u.owner_id::text, u.owner_type::text`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s resources: %w", action, err)
+	}
+	defer rows.Close()
+
+	transitions := []models.LifecycleTransition{}
+	for rows.Next() {
+		t := models.LifecycleTransition{Action: action, Reason: reason}
+		if err := rows.Scan(&t.OrganizationID, &t.ResourceID, &t.ResourceName, &t.OwnerID, &t.OwnerType); err != nil {
+			return nil, fmt.Errorf("failed to scan lifecycle transition: %w", err)
+		}
+		transitions = append(transitions, t)
+	}
+	return transitions, rows.Err()
+}
+
+// ArchiveIdleResources archives up to limit active resources idle for
+// longer than their policy's archive_after_idle_days
+func (q *resourceQueries) ArchiveIdleResources(limit int) ([]models.LifecycleTransition, error) {
+	return q.transitionResources(
+		`status = 'archived', archived_at = NOW(), updated_at = NOW()`,
+		fmt.Sprintf(`r.status = 'active' AND %[1]s > 0 AND %[2]s <= NOW() - make_interval(days => %[1]s)`,
+			lifecycleDays("archive_after_idle_days"), lastActivity),
+		LifecycleArchive, LifecycleReasonIdle, limit)
+}
+
+// RequestRecertifications marks up to limit active resources due for
+// recertification, and not yet asked, as asked
+func (q *resourceQueries) RequestRecertifications(limit int) ([]models.LifecycleTransition, error) {
+	return q.transitionResources(
+		`recertification_requested_at = NOW()`,
+		fmt.Sprintf(`r.status = 'active' AND %[1]s > 0 AND r.recertification_requested_at IS NULL
+		 AND COALESCE(r.certified_at, r.created_at) <= NOW() - make_interval(days => %[1]s)`,
+			lifecycleDays("recertify_every_days")),
+		LifecycleRequestRecertification, LifecycleReasonRecertificationDue, limit)
+}
+
+// ArchiveUncertifiedResources archives up to limit active resources whose
+// owner was asked to recertify them longer ago than the grace period
+func (q *resourceQueries) ArchiveUncertifiedResources(limit int) ([]models.LifecycleTransition, error) {
+	return q.transitionResources(
+		`status = 'archived', archived_at = NOW(), updated_at = NOW()`,
+		fmt.Sprintf(`r.status = 'active' AND %s > 0
+		 AND r.recertification_requested_at <= NOW() - make_interval(days => COALESCE(NULLIF(%s, 0), %d))`,
+			lifecycleDays("recertify_every_days"), lifecycleDays("recertify_grace_days"), defaultRecertifyGraceDays),
+		LifecycleArchive, LifecycleReasonRecertificationLapsed, limit)
+}
+
+// DeleteArchivedResources deletes up to limit resources archived for
+// longer than their policy's delete_after_archived_days
+func (q *resourceQueries) DeleteArchivedResources(limit int) ([]models.LifecycleTransition, error) {
+	return q.transitionResources(
+		`deleted_at = NOW()`,
+		fmt.Sprintf(`r.status = 'archived' AND %[1]s > 0 AND r.archived_at <= NOW() - make_interval(days => %[1]s)`,
+			lifecycleDays("delete_after_archived_days")),
+		LifecycleDelete, LifecycleReasonArchived, limit)
+}
@@ -0,0 +1,112 @@
+package queries
+
+import (
+	"testing"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+func TestPlanLifecycle(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0).UTC()
+	days := func(n int) time.Time { return now.AddDate(0, 0, n) }
+	requested := days(-5)
+	archived := days(-10)
+
+	for _, tc := range []struct {
+		name string
+		l    models.ResourceLifecycle
+		want []models.LifecycleAction
+	}{
+		{
+			name: "no policy",
+			l:    models.ResourceLifecycle{Status: "active", LastActivityAt: now, CertifiedAt: now},
+			want: []models.LifecycleAction{},
+		},
+		{
+			name: "idle then deleted",
+			l: models.ResourceLifecycle{
+				Status:         "active",
+				Policy:         models.LifecyclePolicy{ArchiveAfterIdleDays: 90, DeleteAfterArchivedDays: 30},
+				LastActivityAt: now,
+				CertifiedAt:    now,
+			},
+			want: []models.LifecycleAction{
+				{Action: LifecycleArchive, Reason: LifecycleReasonIdle, DueAt: days(90)},
+				{Action: LifecycleDelete, Reason: LifecycleReasonArchived, DueAt: days(120)},
+			},
+		},
+		{
+			name: "recertification due",
+			l: models.ResourceLifecycle{
+				Status:         "active",
+				Policy:         models.LifecyclePolicy{RecertifyEveryDays: 365},
+				LastActivityAt: now,
+				CertifiedAt:    now,
+			},
+			want: []models.LifecycleAction{
+				{Action: LifecycleRequestRecertification, Reason: LifecycleReasonRecertificationDue, DueAt: days(365)},
+				{Action: LifecycleArchive, Reason: LifecycleReasonRecertificationLapsed, DueAt: days(365 + defaultRecertifyGraceDays)},
+			},
+		},
+		{
+			name: "recertification requested",
+			l: models.ResourceLifecycle{
+				Status:                     "active",
+				Policy:                     models.LifecyclePolicy{RecertifyEveryDays: 365, RecertifyGraceDays: 14},
+				LastActivityAt:             now,
+				CertifiedAt:                days(-370),
+				RecertificationRequestedAt: &requested,
+			},
+			want: []models.LifecycleAction{
+				{Action: LifecycleArchive, Reason: LifecycleReasonRecertificationLapsed, DueAt: days(9)},
+			},
+		},
+		{
+			name: "idle before recertification",
+			l: models.ResourceLifecycle{
+				Status:         "active",
+				Policy:         models.LifecyclePolicy{ArchiveAfterIdleDays: 30, RecertifyEveryDays: 365},
+				LastActivityAt: now,
+				CertifiedAt:    now,
+			},
+			want: []models.LifecycleAction{
+				{Action: LifecycleArchive, Reason: LifecycleReasonIdle, DueAt: days(30)},
+			},
+		},
+		{
+			name: "archived",
+			l: models.ResourceLifecycle{
+				Status:         "archived",
+				Policy:         models.LifecyclePolicy{ArchiveAfterIdleDays: 30, DeleteAfterArchivedDays: 30, RecertifyEveryDays: 365},
+				LastActivityAt: now,
+				CertifiedAt:    now,
+				ArchivedAt:     &archived,
+			},
+			want: []models.LifecycleAction{
+				{Action: LifecycleDelete, Reason: LifecycleReasonArchived, DueAt: days(20)},
+			},
+		},
+		{
+			name: "suspended",
+			l: models.ResourceLifecycle{
+				Status:         "suspended",
+				Policy:         models.LifecyclePolicy{ArchiveAfterIdleDays: 30},
+				LastActivityAt: now,
+				CertifiedAt:    now,
+			},
+			want: []models.LifecycleAction{},
+		},
+	} {
+		got := planLifecycle(&tc.l)
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: planLifecycle = %+v, want %+v", tc.name, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i].Action != tc.want[i].Action || got[i].Reason != tc.want[i].Reason || !got[i].DueAt.Equal(tc.want[i].DueAt) {
+				t.Errorf("%s: planLifecycle[%d] = %+v, want %+v", tc.name, i, got[i], tc.want[i])
+			}
+		}
+	}
+}
@@ -25,7 +25,7 @@ type ResourceQueries interface {
 	WithContext(ctx context.Context) ResourceQueries
 
 	// Resource CRUD operations
-	ListResources(params ListParams, organizationID string) (*ListResult[*models.Resource], error)
+	ListResources(params ListParams, organizationID string, filter ResourceFilter) (*ListResult[*models.Resource], error)
 	CreateResource(resource *models.Resource) error
 	GetResource(id, organizationID string) (*models.Resource, error)
 	UpdateResource(resource *models.Resource, organizationID string) error
@@ -34,7 +34,26 @@ type ResourceQueries interface {
 	// Resource permissions
 	GetResourcePermissions(resourceID, organizationID string) ([]ResourcePermission, error)
 	SetResourcePermissions(resourceID, organizationID string, permissions []ResourcePermission) error
-	GetResourceAccessLog(resourceID, organizationID string, params ListParams) (*ListResult[*ResourceAccessLog], error)
+
+	// Resource access log
+	RecordResourceAccess(entries []ResourceAccessLog) error
+	GetResourceAccessLog(organizationID string, filter ResourceAccessLogFilter, params ListParams) (*ListResult[*ResourceAccessLog], error)
+	PurgeResourceAccessLog(defaultRetentionDays int) (int64, error)
+
+	// Share links
+	CreateShareLink(link *models.ShareLink) error
+	ListShareLinks(organizationID, resourceType, resourceID string) ([]models.ShareLink, error)
+	GetShareLink(id, organizationID string) (*models.ShareLink, error)
+	RevokeShareLink(id, organizationID, resourceType, resourceID, revokedBy string) error
+	RedeemShareLink(id, organizationID string) (*models.ShareLink, error)
+
+	// Sharing with guests outside the organization
+	UpsertGuestPrincipal(organizationID, email, createdBy string) (*models.GuestPrincipal, error)
+	CreateExternalShare(share *models.ExternalShare) error
+	ListExternalShares(organizationID string, filter ExternalShareFilter, params ListParams) (*ListResult[*models.ExternalShare], error)
+	GetExternalShare(id, organizationID string) (*models.ExternalShare, error)
+	RevokeExternalShare(id, organizationID, resourceType, resourceID, revokedBy string) error
+	TouchExternalShare(id, organizationID string) (*models.ExternalShare, error)
 
 	// Resource sharing
 	ShareResource(share *ResourceShare, organizationID string) error
@@ -42,6 +61,26 @@ type ResourceQueries interface {
 	GetResourceShares(resourceID, organizationID string) ([]ResourceShare, error)
 	GetPrincipalShares(principalID, principalType, organizationID string) ([]ResourceShare, error)
 	GetPrincipalPermissions(principalID, principalType, organizationID string) ([]ResourcePermission, error)
+
+	// Share expiry, across organizations
+	ClaimExpiringShares(before time.Time, limit int) ([]models.ExpiringShare, error)
+	DeleteExpiredShares() (int64, error)
+
+	// Lifecycle policies
+	GetResourceLifecycle(id, organizationID string) (*models.ResourceLifecycle, error)
+	RecertifyResource(id, organizationID string) error
+	// Lifecycle transitions, across organizations
+	ArchiveIdleResources(limit int) ([]models.LifecycleTransition, error)
+	RequestRecertifications(limit int) ([]models.LifecycleTransition, error)
+	ArchiveUncertifiedResources(limit int) ([]models.LifecycleTransition, error)
+	DeleteArchivedResources(limit int) ([]models.LifecycleTransition, error)
+
+	// Content integrity
+	GetResourceIntegrity(id, organizationID string) (*models.ResourceIntegrity, error)
+	SetResourceChecksum(id, organizationID, checksum string, sizeBytes *int64) error
+	RecordChecksumVerification(id, organizationID, status string) error
+	// Blob checks, across organizations
+	ClaimChecksumVerifications(before time.Time, limit int) ([]models.ResourceIntegrity, error)
 }
 
 type ResourcePermission struct {
@@ -56,36 +95,24 @@ type ResourcePermission struct {
 }
 
 type ResourceShare struct {
-	ID            string    `json:"id" db:"id"`
-	ResourceID    string    `json:"resource_id" db:"resource_id"`
-	PrincipalID   string    `json:"principal_id" db:"principal_id"`
-	PrincipalType string    `json:"principal_type" db:"principal_type"`
-	AccessLevel   string    `json:"access_level" db:"access_level"`
-	ExpiresAt     time.Time `json:"expires_at" db:"expires_at"`
-	SharedBy      string    `json:"shared_by" db:"shared_by"`
-	CreatedAt     time.Time `json:"created_at" db:"created_at"`
-}
-
-type ResourceAccessLog struct {
-	ID         string    `json:"id" db:"id"`
-	ResourceID string    `json:"resource_id" db:"resource_id"`
-	UserID     string    `json:"user_id" db:"user_id"`
-	Action     string    `json:"action" db:"action"`
-	IPAddress  string    `json:"ip_address" db:"ip_address"`
-	UserAgent  string    `json:"user_agent" db:"user_agent"`
-	Timestamp  time.Time `json:"timestamp" db:"timestamp"`
-	Success    bool      `json:"success" db:"success"`
-	Details    string    `json:"details" db:"details"`
+	ID            string     `json:"id" db:"id"`
+	ResourceID    string     `json:"resource_id" db:"resource_id"`
+	PrincipalID   string     `json:"principal_id" db:"principal_id"`
+	PrincipalType string     `json:"principal_type" db:"principal_type"`
+	AccessLevel   string     `json:"access_level" db:"access_level"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	SharedBy      string     `json:"shared_by" db:"shared_by"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
 }
 
 type resourceQueries struct {
 	db    *database.DB
-	redis *redis.Client
+	redis redis.UniversalClient
 	tx    *sql.Tx
 	ctx   context.Context
 }
 
-func NewResourceQueries(db *database.DB, redis *redis.Client) ResourceQueries {
+func NewResourceQueries(db *database.DB, redis redis.UniversalClient) ResourceQueries {
 	return &resourceQueries{db: db, redis: redis, ctx: context.Background()}
 }
 
@@ -97,36 +124,99 @@ func (q *resourceQueries) WithContext(ctx context.Context) ResourceQueries {
 	return &resourceQueries{db: q.db, redis: q.redis, tx: q.tx, ctx: ctx}
 }
 
-func (q *resourceQueries) ListResources(params ListParams, organizationID string) (*ListResult[*models.Resource], error) {
+// reader returns the connection for reads that tolerate replication lag:
+// the transaction if there is one, otherwise a replica
+func (q *resourceQueries) reader() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.Reader()
+}
+
+// ResourceFilter narrows ListResources results. Zero values disable a filter.
+type ResourceFilter struct {
+	Query    string // Case-insensitive substring of name or ARN
+	Type     string
+	OwnerID  string
+	Status   string
+	TagKey   string
+	TagValue string // Only checked when TagKey is set
+}
+
+// conditions appends the filter's SQL predicates on resources to conds
+func (f ResourceFilter) conditions(conds []string, args []interface{}) ([]string, []interface{}) {
+	if f.Query != "" {
+		args = append(args, "%"+escapeLike(f.Query)+"%")
+		conds = append(conds, fmt.Sprintf("(name ILIKE $%d OR arn ILIKE $%d)", len(args), len(args)))
+	}
+	if f.Type != "" {
+		args = append(args, f.Type)
+		conds = append(conds, fmt.Sprintf("type = $%d", len(args)))
+	}
+	if f.OwnerID != "" {
+		args = append(args, f.OwnerID)
+		conds = append(conds, fmt.Sprintf("owner_id = $%d", len(args)))
+	}
+	if f.Status != "" {
+		args = append(args, f.Status)
+		conds = append(conds, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if f.TagKey != "" {
+		args = append(args, f.TagKey)
+		if f.TagValue != "" {
+			args = append(args, f.TagValue)
+			conds = append(conds, fmt.Sprintf("tags ->> $%d = $%d", len(args)-1, len(args)))
+		} else {
+			conds = append(conds, fmt.Sprintf("jsonb_exists(tags, $%d)", len(args)))
+		}
+	}
+	return conds, args
+}
+
+func (q *resourceQueries) ListResources(params ListParams, organizationID string, filter ResourceFilter) (*ListResult[*models.Resource], error) {
 	query := `
 		SELECT id, arn, name, description, type, organization_id, parent_resource_id, 
 		       owner_id, owner_type, attributes, tags, encryption_key_id, lifecycle_policy,
 		       access_level, content_type, size_bytes, checksum, version, status,
 		       created_at, updated_at, accessed_at, deleted_at
 		FROM resources 
-		WHERE deleted_at IS NULL`
+		WHERE `
+	conds := []string{"deleted_at IS NULL"}
 	args := []interface{}{}
-	argCount := 0
-
 	if organizationID != "" {
-		argCount++
-		query += fmt.Sprintf(" AND organization_id = $%d", argCount)
 		args = append(args, organizationID)
+		conds = append(conds, "organization_id = $1")
 	}
+	conds, args = filter.conditions(conds, args)
+	where := strings.Join(conds, " AND ")
+	countArgs := args
+	query += where
+	argCount := len(args)
 
-	if params.SortBy != "" {
-		query += fmt.Sprintf(" ORDER BY %s %s", params.SortBy, params.Order)
-	} else {
-		query += " ORDER BY created_at DESC"
+	sortBy := "created_at"
+	switch params.SortBy {
+	case "name", "type", "created_at", "updated_at":
+		sortBy = params.SortBy
+	}
+	order := "DESC"
+	if strings.EqualFold(params.Order, "ASC") {
+		order = "ASC"
+	}
+	ks, err := newKeyset(params, sortBy, sortBy, "id", order)
+	if err != nil {
+		return nil, err
+	}
+	if clause, cursorArgs := ks.where(argCount + 1); clause != "" {
+		query += " AND " + clause
+		args = append(args, cursorArgs...)
+		argCount += len(cursorArgs)
 	}
 
+	query += " ORDER BY " + ks.orderBy()
 	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argCount+1, argCount+2)
-	args = append(args, params.Limit, params.Offset)
+	args = append(args, ks.limit(params.Limit), ks.offset(params.Offset))
 
-	var db DBTX = q.db
-	if q.tx != nil {
-		db = q.tx
-	}
+	db := q.reader()
 
 	rows, err := db.QueryContext(q.ctx, query, args...)
 	if err != nil {
@@ -155,12 +245,7 @@ func (q *resourceQueries) ListResources(params ListParams, organizationID string
 	}
 
 	// Get total count
-	countQuery := `SELECT COUNT(*) FROM resources WHERE deleted_at IS NULL`
-	countArgs := []interface{}{}
-	if organizationID != "" {
-		countQuery += " AND organization_id = $1"
-		countArgs = append(countArgs, organizationID)
-	}
+	countQuery := `SELECT COUNT(*) FROM resources WHERE ` + where
 
 	var total int
 	err = db.QueryRowContext(q.ctx, countQuery, countArgs...).Scan(&total)
@@ -168,13 +253,26 @@ func (q *resourceQueries) ListResources(params ListParams, organizationID string
 		return nil, fmt.Errorf("failed to count resources: %w", err)
 	}
 
+	resourcePtrs, hasMore, nextCursor := page(ks, resourcePtrs, params.Limit, func(r *models.Resource) (string, string) {
+		switch sortBy {
+		case "name":
+			return r.Name, r.ID
+		case "type":
+			return r.Type, r.ID
+		case "updated_at":
+			return cursorTime(r.UpdatedAt), r.ID
+		}
+		return cursorTime(r.CreatedAt), r.ID
+	})
+
 	return &ListResult[*models.Resource]{
 		Items:      resourcePtrs,
 		Total:      int64(total),
 		Limit:      params.Limit,
-		Offset:     params.Offset,
-		HasMore:    (params.Offset + params.Limit) < total,
+		Offset:     ks.offset(params.Offset),
+		HasMore:    hasMore,
 		TotalPages: (total + params.Limit - 1) / params.Limit,
+		NextCursor: nextCursor,
 	}, nil
 }
 
@@ -247,7 +345,10 @@ func (q *resourceQueries) UpdateResource(resource *models.Resource, organization
 			owner_id = $6, owner_type = $7, attributes = $8, tags = $9,
 			encryption_key_id = $10, lifecycle_policy = $11, access_level = $12,
 			content_type = $13, size_bytes = $14, checksum = $15, version = $16,
-			status = $17, updated_at = $18
+			status = $17, updated_at = $18,
+			archived_at = CASE WHEN $17 = 'archived' THEN COALESCE(archived_at, $18) END,
+			recertification_requested_at = CASE WHEN status = 'archived' AND $17 != 'archived'
+				THEN NULL ELSE recertification_requested_at END
 		WHERE id = $1 AND organization_id = $19 AND deleted_at IS NULL`
 
 	var db DBTX = q.db
@@ -377,65 +478,6 @@ func (q *resourceQueries) SetResourcePermissions(resourceID, organizationID stri
 	return nil
 }
 
-func (q *resourceQueries) GetResourceAccessLog(resourceID, organizationID string, params ListParams) (*ListResult[*ResourceAccessLog], error) {
-	query := `
-		SELECT ral.id, ral.resource_id, ral.user_id, ral.action, ral.ip_address, ral.user_agent, ral.timestamp, ral.success, ral.details
-		FROM resource_access_log ral
-		JOIN resources r ON ral.resource_id = r.id
-		WHERE ral.resource_id = $1 AND r.organization_id = $4
-		ORDER BY ral.timestamp DESC
-		LIMIT $2 OFFSET $3`
-
-	var db DBTX = q.db
-	if q.tx != nil {
-		db = q.tx
-	}
-
-	rows, err := db.QueryContext(q.ctx, query, resourceID, params.Limit, params.Offset, organizationID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get access log: %w", err)
-	}
-	defer rows.Close()
-
-	var logs []ResourceAccessLog
-	for rows.Next() {
-		var log ResourceAccessLog
-		err := rows.Scan(&log.ID, &log.ResourceID, &log.UserID, &log.Action,
-			&log.IPAddress, &log.UserAgent, &log.Timestamp, &log.Success, &log.Details)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan access log: %w", err)
-		}
-		logs = append(logs, log)
-	}
-
-	// Get total count
-	var total int
-	countQuery := `
-		SELECT COUNT(*) 
-		FROM resource_access_log ral
-		JOIN resources r ON ral.resource_id = r.id
-		WHERE ral.resource_id = $1 AND r.organization_id = $2`
-	err = db.QueryRowContext(q.ctx, countQuery, resourceID, organizationID).Scan(&total)
-	if err != nil {
-		return nil, fmt.Errorf("failed to count access log: %w", err)
-	}
-
-	// Convert to pointers for generic return type
-	var logPtrs []*ResourceAccessLog
-	for i := range logs {
-		logPtrs = append(logPtrs, &logs[i])
-	}
-
-	return &ListResult[*ResourceAccessLog]{
-		Items:      logPtrs,
-		Total:      int64(total),
-		Limit:      params.Limit,
-		Offset:     params.Offset,
-		HasMore:    (params.Offset + params.Limit) < total,
-		TotalPages: (total + params.Limit - 1) / params.Limit,
-	}, nil
-}
-
 func (q *resourceQueries) ShareResource(share *ResourceShare, organizationID string) error {
 	var db DBTX = q.db
 	if q.tx != nil {
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/the-monkeys/monkeys-identity/internal/database"
@@ -30,21 +31,37 @@ type RoleQueries interface {
 
 	// Role assignment operations
 	GetRoleAssignments(roleID, organizationID string) ([]models.RoleAssignment, error)
+	ListPrincipalRoleAssignments(principalID, principalType, organizationID string) ([]models.RoleAssignment, error)
 	AssignRole(assignment *models.RoleAssignment, organizationID string) error
 	UnassignRole(roleID, principalID, organizationID string) error
+	GetRoleAssignment(assignmentID, organizationID string) (*models.RoleAssignment, error)
+	ClaimExpiringRoleAssignments(before time.Time, limit int) ([]models.ExpiringRoleAssignment, error)
+	GetHeldRoleNames(principalID, principalType, organizationID string) ([]string, error)
+	GetGroupRoleNames(groupID, organizationID string) ([]string, error)
+	ListHeldRoleNames(organizationID string) ([]PrincipalRoles, error)
+
+	// Role renewal requests
+	CreateRoleRenewalRequest(req *models.RoleRenewalRequest) (*models.RoleRenewalRequest, error)
+	GetRoleRenewalRequest(id, organizationID string) (*models.RoleRenewalRequest, error)
+	ListRoleRenewalRequests(organizationID, status string, limit, offset int) ([]models.RoleRenewalRequest, error)
+	DecideRoleRenewalRequest(id, organizationID, decidedBy string, approve bool, comment string) (*models.RoleRenewalRequest, error)
 
 	// Role helpers
 	EnsureRoleByName(name, description, organizationID string, outRoleID *string) error
+	GetRoleIDByName(name, organizationID string) (string, error)
+
+	// System catalog
+	ReconcileSystemRoles(organizationID string, policies []models.ManagedPolicy, roles []models.SystemRoleTemplate) error
 }
 
 type roleQueries struct {
 	db    *database.DB
-	redis *redis.Client
+	redis redis.UniversalClient
 	tx    *sql.Tx
 	ctx   context.Context
 }
 
-func NewRoleQueries(db *database.DB, redis *redis.Client) RoleQueries {
+func NewRoleQueries(db *database.DB, redis redis.UniversalClient) RoleQueries {
 	return &roleQueries{db: db, redis: redis, ctx: context.Background()}
 }
 
@@ -56,6 +73,15 @@ func (q *roleQueries) WithContext(ctx context.Context) RoleQueries {
 	return &roleQueries{db: q.db, redis: q.redis, tx: q.tx, ctx: ctx}
 }
 
+// reader returns the connection for reads that tolerate replication lag:
+// the transaction if there is one, otherwise a replica
+func (q *roleQueries) reader() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.Reader()
+}
+
 // Role-specific query methods
 
 // ListRoles retrieves all roles with pagination and filtering
@@ -89,57 +115,44 @@ func (q *roleQueries) ListRoles(params ListParams, organizationID string) (*List
 		order = "ASC"
 	}
 
-	query += fmt.Sprintf(" ORDER BY %s %s", orderBy, order)
+	sortColumn := orderBy
+	switch orderBy {
+	case "updated_at":
+		sortColumn = "COALESCE(updated_at, created_at)"
+	case "organization_id":
+		sortColumn = "organization_id::text"
+	}
+	ks, err := newKeyset(params, orderBy, sortColumn, "id", order)
+	if err != nil {
+		return nil, err
+	}
+
+	// The window count is evaluated before the cursor predicate so that the
+	// total always covers the whole result set
+	query = "SELECT * FROM (" + query + ") page"
+	if clause, cursorArgs := ks.where(argIndex); clause != "" {
+		query += " WHERE " + clause
+		args = append(args, cursorArgs...)
+		argIndex += len(cursorArgs)
+	}
+	query += " ORDER BY " + ks.orderBy()
 
 	// Add pagination
 	if params.Limit > 0 {
 		query += fmt.Sprintf(" LIMIT $%d", argIndex)
-		args = append(args, params.Limit)
+		args = append(args, ks.limit(params.Limit))
 		argIndex++
 	}
 
-	if params.Offset > 0 {
+	if offset := ks.offset(params.Offset); offset > 0 {
 		query += fmt.Sprintf(" OFFSET $%d", argIndex)
-		args = append(args, params.Offset)
+		args = append(args, offset)
 		argIndex++
 	}
 
 	// Use transaction if available, otherwise use database
-	if q.tx != nil {
-		rows, err := q.tx.QueryContext(q.ctx, query, args...)
-		if err != nil {
-			return nil, fmt.Errorf("failed to query roles: %w", err)
-		}
-		defer rows.Close()
-
-		var roles []models.Role
-		var totalCount int64
-
-		for rows.Next() {
-			var role models.Role
-			err := rows.Scan(
-				&role.ID, &role.Name, &role.Description, &role.OrganizationID,
-				&role.RoleType, &role.MaxSessionDuration, &role.TrustPolicy,
-				&role.AssumeRolePolicy, &role.Tags, &role.IsSystemRole,
-				&role.Path, &role.PermissionsBoundary, &role.Status,
-				&role.CreatedAt, &role.UpdatedAt, &role.DeletedAt, &totalCount,
-			)
-			if err != nil {
-				return nil, fmt.Errorf("failed to scan role: %w", err)
-			}
-			roles = append(roles, role)
-		}
-
-		return &ListResult[models.Role]{
-			Items:   roles,
-			Total:   totalCount,
-			Limit:   params.Limit,
-			Offset:  params.Offset,
-			HasMore: int64(params.Offset+len(roles)) < totalCount,
-		}, nil
-	}
-
-	rows, err := q.db.QueryContext(q.ctx, query, args...)
+	var rows *sql.Rows
+	rows, err = q.reader().QueryContext(q.ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query roles: %w", err)
 	}
@@ -163,13 +176,31 @@ func (q *roleQueries) ListRoles(params ListParams, organizationID string) (*List
 		roles = append(roles, role)
 	}
 
-	return &ListResult[models.Role]{
+	result := &ListResult[models.Role]{
 		Items:   roles,
 		Total:   totalCount,
 		Limit:   params.Limit,
-		Offset:  params.Offset,
-		HasMore: int64(params.Offset+len(roles)) < totalCount,
-	}, nil
+		Offset:  ks.offset(params.Offset),
+		HasMore: int64(ks.offset(params.Offset)+len(roles)) < totalCount,
+	}
+	if params.Limit > 0 {
+		result.Items, result.HasMore, result.NextCursor = page(ks, roles, params.Limit, func(r models.Role) (string, string) {
+			switch orderBy {
+			case "name":
+				return r.Name, r.ID
+			case "role_type":
+				return r.RoleType, r.ID
+			case "organization_id":
+				return r.OrganizationID, r.ID
+			case "updated_at":
+				if r.UpdatedAt != nil {
+					return cursorTime(*r.UpdatedAt), r.ID
+				}
+			}
+			return cursorTime(r.CreatedAt), r.ID
+		})
+	}
+	return result, nil
 }
 
 // CreateRole creates a new role
@@ -282,7 +313,8 @@ func (q *roleQueries) UpdateRole(role *models.Role, organizationID string) error
 		return fmt.Errorf("failed to update role: %w", err)
 	}
 
-	return nil
+	// The primary role of its holders is looked up by name among active roles
+	return q.invalidateRoleHolders(role.ID, organizationID)
 }
 
 // DeleteRole soft deletes a role
@@ -315,7 +347,7 @@ func (q *roleQueries) DeleteRole(id, organizationID string) error {
 		return fmt.Errorf("role not found or already deleted")
 	}
 
-	return nil
+	return q.invalidateRoleHolders(id, organizationID)
 }
 
 // GetRolePolicies retrieves all policies attached to a role
@@ -501,6 +533,26 @@ func (q *roleQueries) EnsureRoleByName(name, description, organizationID string,
 	return nil
 }
 
+// GetRoleIDByName looks up an active role of the organization by name
+func (q *roleQueries) GetRoleIDByName(name, organizationID string) (string, error) {
+	query := `SELECT id FROM roles WHERE name = $1 AND organization_id = $2 AND status != 'deleted'`
+
+	var id string
+	var err error
+	if q.tx != nil {
+		err = q.tx.QueryRowContext(q.ctx, query, name, organizationID).Scan(&id)
+	} else {
+		err = q.db.QueryRowContext(q.ctx, query, name, organizationID).Scan(&id)
+	}
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("role not found")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get role %q: %w", name, err)
+	}
+	return id, nil
+}
+
 // AssignRole assigns a role to a principal (user or service account)
 func (q *roleQueries) AssignRole(assignment *models.RoleAssignment, organizationID string) error {
 	query := `
@@ -514,6 +566,7 @@ func (q *roleQueries) AssignRole(assignment *models.RoleAssignment, organization
 			assigned_by = EXCLUDED.assigned_by,
 			assigned_at = NOW(),
 			expires_at = EXCLUDED.expires_at,
+			expiry_reminded_at = NULL,
 			conditions = EXCLUDED.conditions
 		RETURNING assigned_at
 	`
@@ -541,6 +594,7 @@ func (q *roleQueries) AssignRole(assignment *models.RoleAssignment, organization
 		return fmt.Errorf("failed to assign role: %w", err)
 	}
 
+	q.invalidatePrimaryRole(organizationID, assignment.PrincipalID)
 	return nil
 }
 
@@ -574,5 +628,98 @@ func (q *roleQueries) UnassignRole(roleID, principalID, organizationID string) e
 		return fmt.Errorf("role assignment not found")
 	}
 
+	q.invalidatePrimaryRole(organizationID, principalID)
+	return nil
+}
+
+// invalidatePrimaryRole drops the cached primary role of a principal so that
+// role checks see an assignment change immediately rather than on expiry
+func (q *roleQueries) invalidatePrimaryRole(organizationID, principalID string) {
+	invalidatePrimaryRoles(q.ctx, q.redis, q.tx, organizationID, principalID)
+}
+
+// invalidateRoleHolders drops the cached primary role of every user the role
+// is assigned to, after a change to the role itself (its name or status)
+func (q *roleQueries) invalidateRoleHolders(roleID, organizationID string) error {
+	if q.redis == nil {
+		return nil
+	}
+	rows, err := q.conn().QueryContext(q.ctx, `
+		SELECT principal_id FROM role_assignments
+		WHERE role_id = $1 AND principal_type = 'user'`, roleID)
+	if err != nil {
+		return fmt.Errorf("failed to list role holders: %w", err)
+	}
+	defer rows.Close()
+	var holders []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("failed to scan role holder: %w", err)
+		}
+		holders = append(holders, id)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list role holders: %w", err)
+	}
+	invalidatePrimaryRoles(q.ctx, q.redis, q.tx, organizationID, holders...)
 	return nil
 }
+
+// invalidatePrimaryRoles drops the cached primary roles of the users once tx,
+// if any, has committed
+func invalidatePrimaryRoles(ctx context.Context, rdb redis.UniversalClient, tx *sql.Tx, organizationID string, userIDs ...string) {
+	if rdb == nil || len(userIDs) == 0 {
+		return
+	}
+	afterCommit(tx, func() {
+		// One DEL per key, as the keys may live on different cluster nodes
+		pipe := rdb.Pipeline()
+		for _, id := range userIDs {
+			pipe.Del(ctx, PrimaryRoleCacheKey(organizationID, id))
+		}
+		pipe.Exec(ctx)
+	})
+}
+
+// ListPrincipalRoleAssignments returns every role assignment held by a principal
+func (q *roleQueries) ListPrincipalRoleAssignments(principalID, principalType, organizationID string) ([]models.RoleAssignment, error) {
+	query := `
+		SELECT ra.id, ra.role_id, ra.principal_id, ra.principal_type, COALESCE(ra.assigned_by::text, ''),
+		       ra.assigned_at, ra.expires_at, ra.conditions
+		FROM role_assignments ra
+		JOIN roles r ON ra.role_id = r.id
+		WHERE ra.principal_id = $1 AND ra.principal_type = $2 AND r.organization_id = $3
+		ORDER BY ra.assigned_at DESC
+	`
+
+	var rows *sql.Rows
+	var err error
+
+	if q.tx != nil {
+		rows, err = q.tx.QueryContext(q.ctx, query, principalID, principalType, organizationID)
+	} else {
+		rows, err = q.db.QueryContext(q.ctx, query, principalID, principalType, organizationID)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to query principal role assignments: %w", err)
+	}
+	defer rows.Close()
+
+	var assignments []models.RoleAssignment
+	for rows.Next() {
+		var assignment models.RoleAssignment
+		err := rows.Scan(
+			&assignment.ID, &assignment.RoleID, &assignment.PrincipalID,
+			&assignment.PrincipalType, &assignment.AssignedBy,
+			&assignment.AssignedAt, &assignment.ExpiresAt, &assignment.Conditions,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan role assignment: %w", err)
+		}
+		assignments = append(assignments, assignment)
+	}
+
+	return assignments, rows.Err()
+}
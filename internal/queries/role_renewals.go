@@ -0,0 +1,190 @@
+package queries
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+const roleRenewalColumns = `
+	rr.id, rr.organization_id, rr.assignment_id, ra.role_id, r.name, ra.principal_id, ra.principal_type,
+	COALESCE(ra.assigned_by::text, ''), ra.expires_at, COALESCE(rr.requested_by::text, ''), rr.reason,
+	rr.requested_expires_at, rr.status, rr.decided_by, rr.decided_at, rr.decision_comment, rr.created_at
+	FROM role_renewal_requests rr
+	JOIN role_assignments ra ON ra.id = rr.assignment_id
+	JOIN roles r ON r.id = ra.role_id`
+
+func scanRoleRenewal(row interface{ Scan(...interface{}) error }) (*models.RoleRenewalRequest, error) {
+	var req models.RoleRenewalRequest
+	if err := row.Scan(&req.ID, &req.OrganizationID, &req.AssignmentID, &req.RoleID, &req.RoleName,
+		&req.PrincipalID, &req.PrincipalType, &req.AssignedBy, &req.CurrentExpiresAt, &req.RequestedBy,
+		&req.Reason, &req.RequestedExpiresAt, &req.Status, &req.DecidedBy, &req.DecidedAt,
+		&req.DecisionComment, &req.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (q *roleQueries) conn() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.DB
+}
+
+// ClaimExpiringRoleAssignments marks up to limit role assignments of every
+// organization expiring before the given time, and not yet reminded of it,
+// as reminded and returns them
+func (q *roleQueries) ClaimExpiringRoleAssignments(before time.Time, limit int) ([]models.ExpiringRoleAssignment, error) {
+	rows, err := q.conn().QueryContext(q.ctx, `
+		UPDATE role_assignments ra SET expiry_reminded_at = NOW()
+		FROM roles r
+		WHERE r.id = ra.role_id AND ra.id IN (
+			SELECT a.id FROM role_assignments a
+			JOIN roles ar ON ar.id = a.role_id
+			WHERE a.expires_at > NOW() AND a.expires_at <= $1 AND a.expiry_reminded_at IS NULL
+			  AND ar.status != 'deleted'
+			ORDER BY a.expires_at
+			LIMIT $2
+			FOR UPDATE OF a SKIP LOCKED
+		)
+		RETURNING ra.id, ra.role_id, ra.principal_id, ra.principal_type, COALESCE(ra.assigned_by::text, ''),
+		          ra.assigned_at, ra.expires_at, r.organization_id, r.name`, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim expiring role assignments: %w", err)
+	}
+	defer rows.Close()
+
+	assignments := []models.ExpiringRoleAssignment{}
+	for rows.Next() {
+		var a models.ExpiringRoleAssignment
+		if err := rows.Scan(&a.ID, &a.RoleID, &a.PrincipalID, &a.PrincipalType, &a.AssignedBy,
+			&a.AssignedAt, &a.ExpiresAt, &a.OrganizationID, &a.RoleName); err != nil {
+			return nil, fmt.Errorf("failed to scan role assignment: %w", err)
+		}
+		assignments = append(assignments, a)
+	}
+	return assignments, rows.Err()
+}
+
+// GetRoleAssignment retrieves one role assignment of the organization
+func (q *roleQueries) GetRoleAssignment(assignmentID, organizationID string) (*models.RoleAssignment, error) {
+	var a models.RoleAssignment
+	err := q.reader().QueryRowContext(q.ctx, `
+		SELECT ra.id, ra.role_id, ra.principal_id, ra.principal_type, COALESCE(ra.assigned_by::text, ''),
+		       ra.assigned_at, ra.expires_at, ra.conditions
+		FROM role_assignments ra
+		JOIN roles r ON ra.role_id = r.id
+		WHERE ra.id = $1 AND r.organization_id = $2`, assignmentID, organizationID).Scan(
+		&a.ID, &a.RoleID, &a.PrincipalID, &a.PrincipalType, &a.AssignedBy, &a.AssignedAt, &a.ExpiresAt, &a.Conditions)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("role assignment not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role assignment: %w", err)
+	}
+	return &a, nil
+}
+
+// CreateRoleRenewalRequest opens a request to extend a role assignment of
+// the organization until req.RequestedExpiresAt
+func (q *roleQueries) CreateRoleRenewalRequest(req *models.RoleRenewalRequest) (*models.RoleRenewalRequest, error) {
+	var id string
+	err := q.conn().QueryRowContext(q.ctx, `
+		INSERT INTO role_renewal_requests (organization_id, assignment_id, requested_by, reason, requested_expires_at)
+		SELECT r.organization_id, ra.id, NULLIF($2, '')::uuid, $3, $4
+		FROM role_assignments ra
+		JOIN roles r ON r.id = ra.role_id
+		WHERE ra.id = $1 AND r.organization_id = $5
+		RETURNING id`,
+		req.AssignmentID, req.RequestedBy, req.Reason, req.RequestedExpiresAt, req.OrganizationID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("role assignment not found")
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "idx_role_renewal_requests_pending") {
+			return nil, fmt.Errorf("renewal already requested")
+		}
+		return nil, fmt.Errorf("failed to create renewal request: %w", err)
+	}
+	return q.getRoleRenewalRequest(q.conn(), id, req.OrganizationID)
+}
+
+// GetRoleRenewalRequest retrieves one renewal request of the organization
+func (q *roleQueries) GetRoleRenewalRequest(id, organizationID string) (*models.RoleRenewalRequest, error) {
+	return q.getRoleRenewalRequest(q.reader(), id, organizationID)
+}
+
+func (q *roleQueries) getRoleRenewalRequest(db DBTX, id, organizationID string) (*models.RoleRenewalRequest, error) {
+	req, err := scanRoleRenewal(db.QueryRowContext(q.ctx,
+		`SELECT `+roleRenewalColumns+` WHERE rr.id = $1 AND rr.organization_id = $2`, id, organizationID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("renewal request not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get renewal request: %w", err)
+	}
+	return req, nil
+}
+
+// ListRoleRenewalRequests returns the renewal requests of the organization
+// with the given status, or all of them, the newest first
+func (q *roleQueries) ListRoleRenewalRequests(organizationID, status string, limit, offset int) ([]models.RoleRenewalRequest, error) {
+	rows, err := q.reader().QueryContext(q.ctx, `SELECT `+roleRenewalColumns+`
+		WHERE rr.organization_id = $1 AND ($2 = '' OR rr.status = $2)
+		ORDER BY rr.created_at DESC, rr.id DESC
+		LIMIT $3 OFFSET $4`, organizationID, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list renewal requests: %w", err)
+	}
+	defer rows.Close()
+
+	requests := []models.RoleRenewalRequest{}
+	for rows.Next() {
+		req, err := scanRoleRenewal(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan renewal request: %w", err)
+		}
+		requests = append(requests, *req)
+	}
+	return requests, rows.Err()
+}
+
+// DecideRoleRenewalRequest approves or denies a pending renewal request of
+// the organization. Approval moves the expiry of the assignment to the
+// requested time. Nobody may decide their own request.
+func (q *roleQueries) DecideRoleRenewalRequest(id, organizationID, decidedBy string, approve bool, comment string) (*models.RoleRenewalRequest, error) {
+	status := "denied"
+	if approve {
+		status = "approved"
+	}
+	var decided int
+	err := q.conn().QueryRowContext(q.ctx, `
+		WITH decided AS (
+			UPDATE role_renewal_requests SET
+				status = $4, decided_by = $3, decided_at = NOW(), decision_comment = $5
+			WHERE id = $1 AND organization_id = $2 AND status = 'pending'
+			  AND requested_by IS DISTINCT FROM $3::uuid
+			RETURNING assignment_id, status, requested_expires_at
+		), renewed AS (
+			UPDATE role_assignments ra SET expires_at = d.requested_expires_at, expiry_reminded_at = NULL
+			FROM decided d
+			WHERE ra.id = d.assignment_id AND d.status = 'approved'
+		)
+		SELECT COUNT(*) FROM decided`, id, organizationID, decidedBy, status, comment).Scan(&decided)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decide renewal request: %w", err)
+	}
+	if decided == 0 {
+		return nil, fmt.Errorf("renewal request not pending")
+	}
+	req, err := q.getRoleRenewalRequest(q.conn(), id, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	q.invalidatePrimaryRole(organizationID, req.PrincipalID)
+	return req, nil
+}
@@ -0,0 +1,260 @@
+package queries
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+const securityRuleColumns = `id, organization_id, name, type, threshold, window_minutes, severity, enabled,
+	notify_admins, webhook_url, webhook_secret, created_by, created_at, updated_at`
+
+const securityAlertColumns = `id, organization_id, rule_id, rule_name, rule_type, severity, subject, summary,
+	details, status, raised_at, acknowledged_by, acknowledged_at, note`
+
+func scanSecurityRule(row interface{ Scan(...interface{}) error }) (*models.SecurityRule, error) {
+	var rule models.SecurityRule
+	var webhookURL, webhookSecret, createdBy sql.NullString
+	if err := row.Scan(&rule.ID, &rule.OrganizationID, &rule.Name, &rule.Type, &rule.Threshold, &rule.WindowMinutes,
+		&rule.Severity, &rule.Enabled, &rule.NotifyAdmins, &webhookURL, &webhookSecret, &createdBy,
+		&rule.CreatedAt, &rule.UpdatedAt); err != nil {
+		return nil, err
+	}
+	rule.WebhookURL = webhookURL.String
+	rule.WebhookSecret = webhookSecret.String
+	rule.WebhookSigned = rule.WebhookSecret != ""
+	if createdBy.Valid {
+		rule.CreatedBy = &createdBy.String
+	}
+	return &rule, nil
+}
+
+func scanSecurityAlert(row interface{ Scan(...interface{}) error }) (*models.SecurityAlert, error) {
+	var alert models.SecurityAlert
+	var details []byte
+	var ruleID, acknowledgedBy sql.NullString
+	var acknowledgedAt sql.NullTime
+	if err := row.Scan(&alert.ID, &alert.OrganizationID, &ruleID, &alert.RuleName, &alert.RuleType, &alert.Severity,
+		&alert.Subject, &alert.Summary, &details, &alert.Status, &alert.RaisedAt, &acknowledgedBy, &acknowledgedAt,
+		&alert.Note); err != nil {
+		return nil, err
+	}
+	alert.Details = details
+	if ruleID.Valid {
+		alert.RuleID = &ruleID.String
+	}
+	if acknowledgedBy.Valid {
+		alert.AcknowledgedBy = &acknowledgedBy.String
+	}
+	if acknowledgedAt.Valid {
+		alert.AcknowledgedAt = &acknowledgedAt.Time
+	}
+	return &alert, nil
+}
+
+func (q *auditQueries) listSecurityRules(query string, args ...interface{}) ([]models.SecurityRule, error) {
+	rows, err := q.conn().QueryContext(q.ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []models.SecurityRule{}
+	for rows.Next() {
+		rule, err := scanSecurityRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *rule)
+	}
+	return rules, rows.Err()
+}
+
+func (q *auditQueries) CreateSecurityRule(rule *models.SecurityRule) error {
+	query := `
+		INSERT INTO security_rules (organization_id, name, type, threshold, window_minutes, severity, enabled,
+			notify_admins, webhook_url, webhook_secret, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), NULLIF($10, ''), $11)
+		RETURNING id, created_at, updated_at`
+	return q.conn().QueryRowContext(q.ctx, query,
+		rule.OrganizationID, rule.Name, rule.Type, rule.Threshold, rule.WindowMinutes, rule.Severity, rule.Enabled,
+		rule.NotifyAdmins, rule.WebhookURL, rule.WebhookSecret, rule.CreatedBy,
+	).Scan(&rule.ID, &rule.CreatedAt, &rule.UpdatedAt)
+}
+
+func (q *auditQueries) ListSecurityRules(organizationID string) ([]models.SecurityRule, error) {
+	return q.listSecurityRules(`SELECT `+securityRuleColumns+` FROM security_rules WHERE organization_id = $1 ORDER BY name`, organizationID)
+}
+
+// ListEnabledSecurityRules returns the enabled rules of every organization,
+// for the detection engine
+func (q *auditQueries) ListEnabledSecurityRules() ([]models.SecurityRule, error) {
+	return q.listSecurityRules(`
+		SELECT ` + securityRuleColumns + ` FROM security_rules
+		WHERE enabled AND organization_id IN (SELECT id FROM organizations WHERE deleted_at IS NULL)`)
+}
+
+func (q *auditQueries) GetSecurityRule(id, organizationID string) (*models.SecurityRule, error) {
+	row := q.conn().QueryRowContext(q.ctx,
+		`SELECT `+securityRuleColumns+` FROM security_rules WHERE id = $1 AND organization_id = $2`, id, organizationID)
+	rule, err := scanSecurityRule(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("security rule not found")
+	}
+	return rule, err
+}
+
+func (q *auditQueries) UpdateSecurityRule(rule *models.SecurityRule) error {
+	query := `
+		UPDATE security_rules SET name = $3, threshold = $4, window_minutes = $5, severity = $6, enabled = $7,
+			notify_admins = $8, webhook_url = NULLIF($9, ''), webhook_secret = NULLIF($10, ''), updated_at = NOW()
+		WHERE id = $1 AND organization_id = $2
+		RETURNING updated_at`
+	err := q.conn().QueryRowContext(q.ctx, query,
+		rule.ID, rule.OrganizationID, rule.Name, rule.Threshold, rule.WindowMinutes, rule.Severity, rule.Enabled,
+		rule.NotifyAdmins, rule.WebhookURL, rule.WebhookSecret,
+	).Scan(&rule.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("security rule not found")
+	}
+	return err
+}
+
+func (q *auditQueries) DeleteSecurityRule(id, organizationID string) error {
+	result, err := q.conn().ExecContext(q.ctx, `DELETE FROM security_rules WHERE id = $1 AND organization_id = $2`, id, organizationID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("security rule not found")
+	}
+	return nil
+}
+
+func (q *auditQueries) CreateSecurityAlert(alert *models.SecurityAlert) error {
+	details := string(alert.Details)
+	if details == "" {
+		details = "{}"
+	}
+	query := `
+		INSERT INTO security_alerts (organization_id, rule_id, rule_name, rule_type, severity, subject, summary, details)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, status, raised_at`
+	return q.conn().QueryRowContext(q.ctx, query,
+		alert.OrganizationID, alert.RuleID, alert.RuleName, alert.RuleType, alert.Severity, alert.Subject,
+		alert.Summary, details,
+	).Scan(&alert.ID, &alert.Status, &alert.RaisedAt)
+}
+
+// ListSecurityAlerts pages through the alerts of the organization, the most
+// recent first, optionally only those with the given status
+func (q *auditQueries) ListSecurityAlerts(params ListParams, organizationID, status string) (*ListResult[models.SecurityAlert], error) {
+	ks, err := newKeyset(params, "raised_at", "raised_at", "id", "DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{ks.limit(params.Limit), ks.offset(params.Offset), organizationID, status}
+	filter := `organization_id = $3 AND ($4 = '' OR status = $4)`
+	after := ""
+	if clause, cursorArgs := ks.where(5); clause != "" {
+		after = " AND " + clause
+		args = append(args, cursorArgs...)
+	}
+
+	rows, err := q.conn().QueryContext(q.ctx, `
+		SELECT `+securityAlertColumns+` FROM security_alerts
+		WHERE `+filter+after+`
+		ORDER BY `+ks.orderBy()+`
+		LIMIT $1 OFFSET $2`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []models.SecurityAlert{}
+	for rows.Next() {
+		alert, err := scanSecurityAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, *alert)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var total int64
+	if err := q.conn().QueryRowContext(q.ctx,
+		`SELECT COUNT(*) FROM security_alerts WHERE organization_id = $1 AND ($2 = '' OR status = $2)`,
+		organizationID, status).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	alerts, hasMore, nextCursor := page(ks, alerts, params.Limit, func(a models.SecurityAlert) (string, string) {
+		return cursorTime(a.RaisedAt), a.ID
+	})
+	return &ListResult[models.SecurityAlert]{
+		Items:      alerts,
+		Total:      total,
+		Limit:      params.Limit,
+		Offset:     ks.offset(params.Offset),
+		HasMore:    hasMore,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+func (q *auditQueries) GetSecurityAlert(id, organizationID string) (*models.SecurityAlert, error) {
+	row := q.conn().QueryRowContext(q.ctx,
+		`SELECT `+securityAlertColumns+` FROM security_alerts WHERE id = $1 AND organization_id = $2`, id, organizationID)
+	alert, err := scanSecurityAlert(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("security alert not found")
+	}
+	return alert, err
+}
+
+// AcknowledgeSecurityAlert marks an open alert as handled. Acknowledging an
+// acknowledged alert is a conflict.
+func (q *auditQueries) AcknowledgeSecurityAlert(id, organizationID, acknowledgedBy, note string) (*models.SecurityAlert, error) {
+	row := q.conn().QueryRowContext(q.ctx, `
+		UPDATE security_alerts SET status = 'acknowledged', acknowledged_by = $3, acknowledged_at = NOW(), note = $4
+		WHERE id = $1 AND organization_id = $2 AND status = 'open'
+		RETURNING `+securityAlertColumns,
+		id, organizationID, acknowledgedBy, note)
+	alert, err := scanSecurityAlert(row)
+	if err != sql.ErrNoRows {
+		return alert, err
+	}
+	if _, err := q.GetSecurityAlert(id, organizationID); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("security alert conflict: already acknowledged")
+}
+
+// ListSecurityAlertRecipients returns the active users of the organization
+// holding its admin role, who are notified of alerts
+func (q *auditQueries) ListSecurityAlertRecipients(organizationID string) ([]string, error) {
+	rows, err := q.conn().QueryContext(q.ctx, `
+		SELECT DISTINCT u.id FROM users u
+		JOIN role_assignments ra ON ra.principal_id = u.id AND ra.principal_type = 'user'
+		JOIN roles r ON r.id = ra.role_id
+		WHERE u.organization_id = $1 AND u.status = 'active' AND u.deleted_at IS NULL
+		  AND r.name = 'admin' AND r.organization_id = $1 AND r.deleted_at IS NULL
+		  AND (ra.expires_at IS NULL OR ra.expires_at > NOW())`, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,120 @@
+package queries
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// ErrCertificateRegistered is returned when a certificate is already pinned
+// to a service account; a fingerprint identifies one principal only
+var ErrCertificateRegistered = errors.New("certificate is already registered")
+
+// AddServiceAccountCertificate pins a certificate to a service account of
+// the organization
+func (q *userQueries) AddServiceAccountCertificate(cert *models.ServiceAccountCertificate) error {
+	query := `
+		INSERT INTO service_account_certificates (
+			id, organization_id, service_account_id, name, fingerprint, subject, not_before, not_after, created_by
+		)
+		SELECT $1, sa.organization_id, sa.id, $4, $5, $6, $7, $8, $9
+		FROM service_accounts sa
+		WHERE sa.id = $2 AND sa.organization_id = $3 AND sa.deleted_at IS NULL
+		RETURNING created_at
+	`
+	createdBy := sql.NullString{String: cert.CreatedBy, Valid: cert.CreatedBy != ""}
+	err := q.queryRow(query,
+		cert.ID, cert.ServiceAccountID, cert.OrganizationID, cert.Name, cert.Fingerprint,
+		cert.Subject, cert.NotBefore, cert.NotAfter, createdBy,
+	).Scan(&cert.CreatedAt)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("service account not found")
+	}
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return ErrCertificateRegistered
+	}
+	return err
+}
+
+func (q *userQueries) ListServiceAccountCertificates(saID, organizationID string) ([]models.ServiceAccountCertificate, error) {
+	query := `
+		SELECT id, organization_id, service_account_id, name, fingerprint, subject,
+		       not_before, not_after, last_used_at, created_by, created_at
+		FROM service_account_certificates
+		WHERE service_account_id = $1 AND organization_id = $2
+		ORDER BY created_at
+	`
+	rows, err := q.query(query, saID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	certs := []models.ServiceAccountCertificate{}
+	for rows.Next() {
+		var cert models.ServiceAccountCertificate
+		var lastUsedAt sql.NullTime
+		var createdBy sql.NullString
+		if err := rows.Scan(
+			&cert.ID, &cert.OrganizationID, &cert.ServiceAccountID, &cert.Name, &cert.Fingerprint, &cert.Subject,
+			&cert.NotBefore, &cert.NotAfter, &lastUsedAt, &createdBy, &cert.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if lastUsedAt.Valid {
+			cert.LastUsedAt = &lastUsedAt.Time
+		}
+		cert.CreatedBy = createdBy.String
+		certs = append(certs, cert)
+	}
+	return certs, rows.Err()
+}
+
+func (q *userQueries) DeleteServiceAccountCertificate(saID, certID, organizationID string) error {
+	result, err := q.exec(`DELETE FROM service_account_certificates WHERE id = $1 AND service_account_id = $2 AND organization_id = $3`,
+		certID, saID, organizationID)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("certificate not found")
+	}
+	return nil
+}
+
+// GetServiceAccountCertificateByFingerprint looks up the certificate a TLS
+// client presented, with the billing tier of its organization, for
+// authentication. Certificates of inactive service accounts and deleted
+// organizations are not found.
+func (q *userQueries) GetServiceAccountCertificateByFingerprint(fingerprint string) (*models.ServiceAccountCertificate, error) {
+	query := `
+		SELECT c.id, c.organization_id, c.service_account_id, c.name, c.fingerprint, c.subject,
+		       c.not_before, c.not_after, o.billing_tier
+		FROM service_account_certificates c
+		JOIN service_accounts sa ON sa.id = c.service_account_id
+		JOIN organizations o ON o.id = c.organization_id
+		WHERE c.fingerprint = $1 AND sa.status = 'active' AND sa.deleted_at IS NULL AND o.deleted_at IS NULL
+	`
+	var cert models.ServiceAccountCertificate
+	err := q.queryRow(query, fingerprint).Scan(
+		&cert.ID, &cert.OrganizationID, &cert.ServiceAccountID, &cert.Name, &cert.Fingerprint, &cert.Subject,
+		&cert.NotBefore, &cert.NotAfter, &cert.BillingTier,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("certificate not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// RecordServiceAccountCertificateUse sets the last-used time of a certificate
+func (q *userQueries) RecordServiceAccountCertificateUse(id string) error {
+	_, err := q.exec(`UPDATE service_account_certificates SET last_used_at = NOW() WHERE id = $1`, id)
+	return err
+}
@@ -3,7 +3,10 @@ package queries
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -24,8 +27,10 @@ type SessionQueries interface {
 	UpdateSession(session *models.Session, organizationID string) error
 	DeleteSession(sessionID, organizationID string) error
 
-	// Session listing and filtering
-	ListSessions(params ListParams, organizationID, principalID, principalType string) (*ListResult[*models.Session], error)
+	// Session listing and filtering. status is one of the SessionStatus*
+	// values, or empty for every session; a session that ran past its
+	// expiry is reported as expired before the expiry job marks it so.
+	ListSessions(params ListParams, organizationID, principalID, principalType, status string) (*ListResult[*models.Session], error)
 	ListUserSessions(userID, organizationID string) ([]*models.Session, error)
 	ListActiveSessions(organizationID string) ([]*models.Session, error)
 
@@ -33,13 +38,31 @@ type SessionQueries interface {
 	ExtendSession(sessionID, organizationID string, newExpiresAt time.Time) error
 	RevokeSession(sessionID, organizationID string) error
 	RevokeAllUserSessions(userID, organizationID string) error
+	// RevokeOrganizationSessions revokes every active session of the
+	// organization and returns their IDs and expiry
+	RevokeOrganizationSessions(organizationID string) ([]*models.Session, error)
 	RevokeExpiredSessions() (int, error)
 	UpdateLastUsed(sessionID, organizationID string) error
+	MarkMFAVerified(sessionID, organizationID, method string) error
+
+	// Session lifetime enforcement
+	// TrackSession starts enforcing the limits of an active session: it
+	// ends at session.ExpiresAt unless TouchSession pushes that back. idle
+	// is zero without an idle timeout, deadline zero without a maximum
+	// lifetime.
+	TrackSession(session *models.Session, idle time.Duration, deadline time.Time) error
+	// TouchSession records activity of a tracked session, restarting its
+	// idle timeout. Once the session has timed out or was revoked it
+	// returns ErrSessionExpired and an active session is marked expired.
+	TouchSession(sessionID, organizationID string) error
+	// ExpireSession marks an active session expired
+	ExpireSession(sessionID, organizationID string) error
 
 	// Session security and monitoring
 	GetSessionsByIP(ipAddress, organizationID string) ([]*models.Session, error)
 	GetSessionsByDeviceFingerprint(fingerprint, organizationID string) ([]*models.Session, error)
 	CountActiveSessions(organizationID, principalID, principalType string) (int, error)
+	CountAllActiveSessions() (int, error)
 	GetConcurrentSessions(organizationID, principalID, principalType string) ([]*models.Session, error)
 
 	// Session analytics
@@ -47,6 +70,25 @@ type SessionQueries interface {
 	GetSessionActivity(sessionID, organizationID string, limit int) ([]*SessionActivity, error)
 }
 
+// Session statuses
+const (
+	SessionStatusActive  = "active"
+	SessionStatusExpired = "expired"
+	SessionStatusRevoked = "revoked"
+)
+
+// ErrSessionExpired is returned by TouchSession for a session that timed
+// out, reached its maximum lifetime or was revoked
+var ErrSessionExpired = errors.New("session expired")
+
+// sessionTouchInterval is how often the activity of a session is written.
+// Idle timeouts are enforced with this granularity.
+const sessionTouchInterval = time.Minute
+
+// sessionStatusColumn reports sessions that ran past their expiry as
+// expired, whether or not the expiry job has marked them yet
+const sessionStatusColumn = "CASE WHEN status = 'active' AND expires_at <= NOW() THEN 'expired' ELSE status END"
+
 // Session analytics and monitoring types
 type SessionStats struct {
 	TotalSessions          int64         `json:"total_sessions"`
@@ -71,12 +113,12 @@ type SessionActivity struct {
 
 type sessionQueries struct {
 	db    *database.DB
-	redis *redis.Client
+	redis redis.UniversalClient
 	tx    *sql.Tx
 	ctx   context.Context
 }
 
-func NewSessionQueries(db *database.DB, redis *redis.Client) SessionQueries {
+func NewSessionQueries(db *database.DB, redis redis.UniversalClient) SessionQueries {
 	return &sessionQueries{db: db, redis: redis, ctx: context.Background()}
 }
 
@@ -94,9 +136,9 @@ func (q *sessionQueries) CreateSession(session *models.Session) error {
 			id, session_token, principal_id, principal_type, organization_id,
 			assumed_role_id, permissions, context, mfa_verified, mfa_methods_used,
 			ip_address, user_agent, device_fingerprint, location,
-			issued_at, expires_at, last_used_at, status
+			issued_at, expires_at, last_used_at, status, mfa_verified_at
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19
 		)`
 
 	var db DBTX = q.db
@@ -109,7 +151,7 @@ func (q *sessionQueries) CreateSession(session *models.Session) error {
 		session.OrganizationID, session.AssumedRoleID, session.Permissions, session.Context,
 		session.MFAVerified, pq.Array(session.MFAMethodsUsed), session.IPAddress, session.UserAgent,
 		session.DeviceFingerprint, session.Location, session.IssuedAt, session.ExpiresAt,
-		session.LastUsedAt, session.Status)
+		session.LastUsedAt, session.Status, session.MFAVerifiedAt)
 
 	if err != nil {
 		return fmt.Errorf("failed to create session: %w", err)
@@ -142,7 +184,7 @@ func (q *sessionQueries) GetSession(sessionID, organizationID string) (*models.S
 		SELECT id, session_token, principal_id, principal_type, organization_id,
 		       assumed_role_id, permissions, context, mfa_verified, mfa_methods_used,
 		       ip_address, user_agent, device_fingerprint, location,
-		       issued_at, expires_at, last_used_at, status
+		       issued_at, expires_at, last_used_at, status, mfa_verified_at
 		FROM sessions 
 		WHERE id = $1 AND organization_id = $2 AND status = 'active'`
 
@@ -156,7 +198,7 @@ func (q *sessionQueries) GetSession(sessionID, organizationID string) (*models.S
 		&s.ID, &s.SessionToken, &s.PrincipalID, &s.PrincipalType, &s.OrganizationID,
 		&s.AssumedRoleID, &s.Permissions, &s.Context, &s.MFAVerified, pq.Array(&s.MFAMethodsUsed),
 		&s.IPAddress, &s.UserAgent, &s.DeviceFingerprint, &s.Location,
-		&s.IssuedAt, &s.ExpiresAt, &s.LastUsedAt, &s.Status)
+		&s.IssuedAt, &s.ExpiresAt, &s.LastUsedAt, &s.Status, &s.MFAVerifiedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("session not found")
@@ -167,8 +209,7 @@ func (q *sessionQueries) GetSession(sessionID, organizationID string) (*models.S
 
 	// Check if session is expired
 	if time.Now().After(s.ExpiresAt) {
-		// Mark as expired
-		q.RevokeSession(sessionID, organizationID)
+		q.ExpireSession(sessionID, organizationID)
 		return nil, fmt.Errorf("session expired")
 	}
 
@@ -210,7 +251,7 @@ func (q *sessionQueries) GetSessionByToken(token, organizationID string) (*model
 
 	// Check if session is expired
 	if time.Now().After(s.ExpiresAt) {
-		q.RevokeSession(s.ID, organizationID)
+		q.ExpireSession(s.ID, organizationID)
 		return nil, fmt.Errorf("session expired")
 	}
 
@@ -286,12 +327,12 @@ func (q *sessionQueries) DeleteSession(sessionID, organizationID string) error {
 	return nil
 }
 
-func (q *sessionQueries) ListSessions(params ListParams, organizationID, principalID, principalType string) (*ListResult[*models.Session], error) {
+func (q *sessionQueries) ListSessions(params ListParams, organizationID, principalID, principalType, status string) (*ListResult[*models.Session], error) {
 	query := `
 		SELECT id, session_token, principal_id, principal_type, organization_id,
 		       assumed_role_id, permissions, context, mfa_verified, mfa_methods_used,
 		       ip_address, user_agent, device_fingerprint, location,
-		       issued_at, expires_at, last_used_at, status
+		       issued_at, expires_at, last_used_at, ` + sessionStatusColumn + `
 		FROM sessions 
 		WHERE organization_id = $1`
 
@@ -310,16 +351,34 @@ func (q *sessionQueries) ListSessions(params ListParams, organizationID, princip
 		args = append(args, principalType)
 	}
 
-	query += " AND status = 'active'"
+	if status != "" {
+		argCount++
+		query += fmt.Sprintf(" AND %s = $%d", sessionStatusColumn, argCount)
+		args = append(args, status)
+	}
 
-	if params.SortBy != "" {
-		query += fmt.Sprintf(" ORDER BY %s %s", params.SortBy, params.Order)
-	} else {
-		query += " ORDER BY last_used_at DESC"
+	sortBy := "last_used_at"
+	switch params.SortBy {
+	case "last_used_at", "issued_at", "expires_at", "status":
+		sortBy = params.SortBy
+	}
+	order := "DESC"
+	if strings.EqualFold(params.Order, "ASC") {
+		order = "ASC"
+	}
+	ks, err := newKeyset(params, sortBy, sortBy, "id", order)
+	if err != nil {
+		return nil, err
+	}
+	if clause, cursorArgs := ks.where(argCount + 1); clause != "" {
+		query += " AND " + clause
+		args = append(args, cursorArgs...)
+		argCount += len(cursorArgs)
 	}
 
+	query += " ORDER BY " + ks.orderBy()
 	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argCount+1, argCount+2)
-	args = append(args, params.Limit, params.Offset)
+	args = append(args, ks.limit(params.Limit), ks.offset(params.Offset))
 
 	var db DBTX = q.db
 	if q.tx != nil {
@@ -369,7 +428,11 @@ func (q *sessionQueries) ListSessions(params ListParams, organizationID, princip
 		countArgs = append(countArgs, principalType)
 	}
 
-	countQuery += " AND status = 'active'"
+	if status != "" {
+		countArgCount++
+		countQuery += fmt.Sprintf(" AND %s = $%d", sessionStatusColumn, countArgCount)
+		countArgs = append(countArgs, status)
+	}
 
 	var total int
 	err = db.QueryRowContext(q.ctx, countQuery, countArgs...).Scan(&total)
@@ -377,18 +440,31 @@ func (q *sessionQueries) ListSessions(params ListParams, organizationID, princip
 		return nil, fmt.Errorf("failed to count sessions: %w", err)
 	}
 
+	sessionPtrs, hasMore, nextCursor := page(ks, sessionPtrs, params.Limit, func(s *models.Session) (string, string) {
+		switch sortBy {
+		case "issued_at":
+			return cursorTime(s.IssuedAt), s.ID
+		case "expires_at":
+			return cursorTime(s.ExpiresAt), s.ID
+		case "status":
+			return s.Status, s.ID
+		}
+		return cursorTime(s.LastUsedAt), s.ID
+	})
+
 	return &ListResult[*models.Session]{
 		Items:      sessionPtrs,
 		Total:      int64(total),
 		Limit:      params.Limit,
-		Offset:     params.Offset,
-		HasMore:    (params.Offset + params.Limit) < total,
+		Offset:     ks.offset(params.Offset),
+		HasMore:    hasMore,
 		TotalPages: (total + params.Limit - 1) / params.Limit,
+		NextCursor: nextCursor,
 	}, nil
 }
 
 func (q *sessionQueries) ListUserSessions(userID, organizationID string) ([]*models.Session, error) {
-	result, err := q.ListSessions(ListParams{Limit: 100, Offset: 0}, organizationID, userID, "user")
+	result, err := q.ListSessions(ListParams{Limit: 100, Offset: 0}, organizationID, userID, "user", SessionStatusActive)
 	if err != nil {
 		return nil, err
 	}
@@ -498,32 +574,67 @@ func (q *sessionQueries) RevokeSession(sessionID, organizationID string) error {
 }
 
 func (q *sessionQueries) RevokeAllUserSessions(userID, organizationID string) error {
-	query := `UPDATE sessions SET status = 'revoked', last_used_at = NOW() WHERE principal_id = $1 AND principal_type = 'user' AND organization_id = $2 AND status = 'active'`
+	query := `UPDATE sessions SET status = 'revoked', last_used_at = NOW() WHERE principal_id = $1 AND principal_type = 'user' AND organization_id = $2 AND status = 'active' RETURNING id`
 
 	var db DBTX = q.db
 	if q.tx != nil {
 		db = q.tx
 	}
 
-	result, err := db.ExecContext(q.ctx, query, userID, organizationID)
+	rows, err := db.QueryContext(q.ctx, query, userID, organizationID)
 	if err != nil {
 		return fmt.Errorf("failed to revoke user sessions: %w", err)
 	}
+	defer rows.Close()
 
-	rows, err := result.RowsAffected()
+	var sessionIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("failed to scan revoked session: %w", err)
+		}
+		sessionIDs = append(sessionIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range sessionIDs {
+		q.removeCachedSession(id)
+	}
+	return nil
+}
+
+func (q *sessionQueries) RevokeOrganizationSessions(organizationID string) ([]*models.Session, error) {
+	query := `UPDATE sessions SET status = 'revoked', last_used_at = NOW() WHERE organization_id = $1 AND status = 'active' RETURNING id, expires_at`
+
+	var db DBTX = q.db
+	if q.tx != nil {
+		db = q.tx
+	}
+
+	rows, err := db.QueryContext(q.ctx, query, organizationID)
 	if err != nil {
-		return fmt.Errorf("failed to check revoke result: %w", err)
+		return nil, fmt.Errorf("failed to revoke organization sessions: %w", err)
 	}
+	defer rows.Close()
 
-	// Remove from cache - get all user sessions first
-	if q.redis != nil && rows > 0 {
-		sessions, _ := q.ListUserSessions(userID, organizationID)
-		for _, session := range sessions {
-			q.removeCachedSession(session.ID)
+	var sessions []*models.Session
+	for rows.Next() {
+		s := &models.Session{OrganizationID: organizationID, Status: "revoked"}
+		if err := rows.Scan(&s.ID, &s.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan revoked session: %w", err)
 		}
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return nil
+	for _, session := range sessions {
+		q.removeCachedSession(session.ID)
+	}
+	return sessions, nil
 }
 
 func (q *sessionQueries) RevokeExpiredSessions() (int, error) {
@@ -563,6 +674,171 @@ func (q *sessionQueries) UpdateLastUsed(sessionID, organizationID string) error
 	return nil
 }
 
+// MarkMFAVerified records that the session just passed an MFA check with
+// method, restarting the step-up window
+func (q *sessionQueries) MarkMFAVerified(sessionID, organizationID, method string) error {
+	query := `
+		UPDATE sessions
+		SET mfa_verified = TRUE,
+		    mfa_verified_at = NOW(),
+		    mfa_methods_used = CASE WHEN $3 = ANY(COALESCE(mfa_methods_used, '{}')) THEN mfa_methods_used
+		                            ELSE array_append(COALESCE(mfa_methods_used, '{}'), $3) END
+		WHERE id = $1 AND organization_id = $2 AND status = 'active'`
+
+	var db DBTX = q.db
+	if q.tx != nil {
+		db = q.tx
+	}
+
+	result, err := db.ExecContext(q.ctx, query, sessionID, organizationID, method)
+	if err != nil {
+		return fmt.Errorf("failed to mark session MFA verified: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("session not found or not active")
+	}
+
+	return nil
+}
+
+// sessionActivity is the Redis record of a tracked session, stored as
+// "<idle seconds> <deadline unix> <last seen unix>". The key expires when
+// the session does.
+type sessionActivity struct {
+	idle     time.Duration
+	deadline time.Time // zero without a maximum lifetime
+	lastSeen time.Time
+}
+
+func sessionActivityKey(sessionID string) string {
+	return "session_activity:" + sessionID
+}
+
+func (a sessionActivity) String() string {
+	var deadline int64
+	if !a.deadline.IsZero() {
+		deadline = a.deadline.Unix()
+	}
+	return fmt.Sprintf("%d %d %d", int64(a.idle/time.Second), deadline, a.lastSeen.Unix())
+}
+
+func parseSessionActivity(raw string) (sessionActivity, bool) {
+	var a sessionActivity
+	fields := strings.Fields(raw)
+	if len(fields) != 3 {
+		return a, false
+	}
+	var n [3]int64
+	for i, f := range fields {
+		v, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			return a, false
+		}
+		n[i] = v
+	}
+	a.idle = time.Duration(n[0]) * time.Second
+	if n[1] > 0 {
+		a.deadline = time.Unix(n[1], 0)
+	}
+	a.lastSeen = time.Unix(n[2], 0)
+	return a, true
+}
+
+// expiresAt is when the session ends if it is not used after now
+func (a sessionActivity) expiresAt(now time.Time) time.Time {
+	end := now.Add(a.idle)
+	if !a.deadline.IsZero() && a.deadline.Before(end) {
+		end = a.deadline
+	}
+	return end
+}
+
+func (q *sessionQueries) TrackSession(session *models.Session, idle time.Duration, deadline time.Time) error {
+	query := `UPDATE sessions SET expires_at = $3, last_used_at = NOW() WHERE id = $1 AND organization_id = $2 AND status = 'active'`
+
+	var db DBTX = q.db
+	if q.tx != nil {
+		db = q.tx
+	}
+
+	if _, err := db.ExecContext(q.ctx, query, session.ID, session.OrganizationID, session.ExpiresAt); err != nil {
+		return fmt.Errorf("failed to update session expiry: %w", err)
+	}
+	if q.redis == nil {
+		return nil
+	}
+	ttl := time.Until(session.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	activity := sessionActivity{idle: idle, deadline: deadline, lastSeen: time.Now()}
+	return q.redis.Set(q.ctx, sessionActivityKey(session.ID), activity.String(), ttl).Err()
+}
+
+func (q *sessionQueries) TouchSession(sessionID, organizationID string) error {
+	if q.redis == nil {
+		return nil
+	}
+
+	key := sessionActivityKey(sessionID)
+	raw, err := q.redis.Get(q.ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		q.ExpireSession(sessionID, organizationID)
+		return ErrSessionExpired
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read session activity: %w", err)
+	}
+	activity, ok := parseSessionActivity(raw)
+	if !ok {
+		return fmt.Errorf("invalid activity record of session %s", sessionID)
+	}
+
+	// Without an idle timeout the key simply expires with the session
+	now := time.Now()
+	if activity.idle <= 0 || now.Sub(activity.lastSeen) < sessionTouchInterval {
+		return nil
+	}
+	activity.lastSeen = now
+	expiresAt := activity.expiresAt(now)
+	if !expiresAt.After(now) {
+		q.ExpireSession(sessionID, organizationID)
+		return ErrSessionExpired
+	}
+	// XX so that a session revoked meanwhile is not brought back
+	if err := q.redis.SetXX(q.ctx, key, activity.String(), expiresAt.Sub(now)).Err(); err != nil {
+		return fmt.Errorf("failed to record session activity: %w", err)
+	}
+
+	query := `UPDATE sessions SET last_used_at = NOW(), expires_at = $3 WHERE id = $1 AND organization_id = $2 AND status = 'active'`
+
+	var db DBTX = q.db
+	if q.tx != nil {
+		db = q.tx
+	}
+
+	if _, err := db.ExecContext(q.ctx, query, sessionID, organizationID, expiresAt); err != nil {
+		return fmt.Errorf("failed to record session activity: %w", err)
+	}
+	return nil
+}
+
+func (q *sessionQueries) ExpireSession(sessionID, organizationID string) error {
+	query := `UPDATE sessions SET status = 'expired' WHERE id = $1 AND organization_id = $2 AND status = 'active'`
+
+	var db DBTX = q.db
+	if q.tx != nil {
+		db = q.tx
+	}
+
+	if _, err := db.ExecContext(q.ctx, query, sessionID, organizationID); err != nil {
+		return fmt.Errorf("failed to expire session: %w", err)
+	}
+
+	q.removeCachedSession(sessionID)
+	return nil
+}
+
 func (q *sessionQueries) GetSessionsByIP(ipAddress, organizationID string) ([]*models.Session, error) {
 	query := `
 		SELECT id, session_token, principal_id, principal_type, organization_id,
@@ -656,6 +932,23 @@ func (q *sessionQueries) CountActiveSessions(organizationID, principalID, princi
 	return count, nil
 }
 
+// CountAllActiveSessions counts the unexpired active sessions across all organizations
+func (q *sessionQueries) CountAllActiveSessions() (int, error) {
+	query := `SELECT COUNT(*) FROM sessions WHERE status = 'active' AND expires_at > NOW()`
+
+	var db DBTX = q.db
+	if q.tx != nil {
+		db = q.tx
+	}
+
+	var count int
+	if err := db.QueryRowContext(q.ctx, query).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count active sessions: %w", err)
+	}
+
+	return count, nil
+}
+
 func (q *sessionQueries) GetConcurrentSessions(organizationID, principalID, principalType string) ([]*models.Session, error) {
 	return q.ListUserSessions(principalID, organizationID)
 }
@@ -744,5 +1037,5 @@ func (q *sessionQueries) removeCachedSession(sessionID string) error {
 	}
 
 	key := fmt.Sprintf("session:%s", sessionID)
-	return q.redis.Del(q.ctx, key).Err()
+	return q.redis.Del(q.ctx, key, sessionActivityKey(sessionID)).Err()
 }
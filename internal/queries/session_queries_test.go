@@ -0,0 +1,45 @@
+package queries
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionActivityRoundTrip(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	for _, a := range []sessionActivity{
+		{idle: 30 * time.Minute, deadline: now.Add(8 * time.Hour), lastSeen: now},
+		{idle: 0, lastSeen: now},
+	} {
+		parsed, ok := parseSessionActivity(a.String())
+		if !ok {
+			t.Fatalf("parseSessionActivity(%q) failed", a.String())
+		}
+		if parsed.idle != a.idle || !parsed.deadline.Equal(a.deadline) || !parsed.lastSeen.Equal(a.lastSeen) {
+			t.Errorf("round trip of %q = %+v, want %+v", a.String(), parsed, a)
+		}
+	}
+
+	for _, raw := range []string{"", "1800 0", "a b c", "1800 0 1 2"} {
+		if _, ok := parseSessionActivity(raw); ok {
+			t.Errorf("parseSessionActivity(%q) succeeded", raw)
+		}
+	}
+}
+
+func TestSessionActivityExpiresAt(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	for _, tc := range []struct {
+		name string
+		a    sessionActivity
+		want time.Time
+	}{
+		{"idle", sessionActivity{idle: 30 * time.Minute}, now.Add(30 * time.Minute)},
+		{"deadline first", sessionActivity{idle: 30 * time.Minute, deadline: now.Add(10 * time.Minute)}, now.Add(10 * time.Minute)},
+		{"idle first", sessionActivity{idle: 30 * time.Minute, deadline: now.Add(time.Hour)}, now.Add(30 * time.Minute)},
+	} {
+		if got := tc.a.expiresAt(now); !got.Equal(tc.want) {
+			t.Errorf("%s: expiresAt = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
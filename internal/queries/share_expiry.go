@@ -0,0 +1,94 @@
+package queries
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// scanExpiringShares reads the rows returned by the claims below
+func scanExpiringShares(rows *sql.Rows, kind string) ([]models.ExpiringShare, error) {
+	shares := []models.ExpiringShare{}
+	for rows.Next() {
+		s := models.ExpiringShare{Kind: kind}
+		if err := rows.Scan(&s.ItemID, &s.PrincipalID, &s.PrincipalType, &s.AccessLevel, &s.SharedBy,
+			&s.ExpiresAt, &s.OrganizationID, &s.ItemName); err != nil {
+			return nil, fmt.Errorf("failed to scan expiring share: %w", err)
+		}
+		shares = append(shares, s)
+	}
+	return shares, rows.Err()
+}
+
+// ClaimExpiringShares marks up to limit resource shares of every
+// organization expiring before the given time, and not yet reminded of it,
+// as reminded and returns them
+func (q *resourceQueries) ClaimExpiringShares(before time.Time, limit int) ([]models.ExpiringShare, error) {
+	rows, err := q.conn().QueryContext(q.ctx, `
+		UPDATE resource_shares rs SET expiry_reminded_at = NOW()
+		FROM resources r
+		WHERE r.id = rs.resource_id AND rs.id IN (
+			SELECT s.id FROM resource_shares s
+			JOIN resources sr ON sr.id = s.resource_id
+			WHERE s.expires_at > NOW() AND s.expires_at <= $1 AND s.expiry_reminded_at IS NULL
+			  AND sr.deleted_at IS NULL
+			ORDER BY s.expires_at
+			LIMIT $2
+			FOR UPDATE OF s SKIP LOCKED
+		)
+		RETURNING rs.resource_id, rs.principal_id, rs.principal_type, rs.access_level, COALESCE(rs.shared_by, ''),
+		          rs.expires_at, r.organization_id, r.name`, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim expiring resource shares: %w", err)
+	}
+	defer rows.Close()
+	return scanExpiringShares(rows, AccessLogResource)
+}
+
+// DeleteExpiredShares deletes the resource shares of every organization
+// past their expiry
+func (q *resourceQueries) DeleteExpiredShares() (int64, error) {
+	res, err := q.conn().ExecContext(q.ctx, `DELETE FROM resource_shares WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired resource shares: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// ClaimExpiringCollaborators marks up to limit co-authorships of every
+// organization expiring before the given time, and not yet reminded of it,
+// as reminded and returns them
+func (q *contentQueries) ClaimExpiringCollaborators(before time.Time, limit int) ([]models.ExpiringShare, error) {
+	rows, err := q.conn().QueryContext(q.ctx, `
+		UPDATE content_collaborators cc SET expiry_reminded_at = NOW()
+		FROM content_items ci
+		WHERE ci.id = cc.content_id AND (cc.content_id, cc.user_id) IN (
+			SELECT c.content_id, c.user_id FROM content_collaborators c
+			JOIN content_items i ON i.id = c.content_id
+			WHERE c.expires_at > NOW() AND c.expires_at <= $1 AND c.expiry_reminded_at IS NULL
+			  AND i.deleted_at IS NULL
+			ORDER BY c.expires_at
+			LIMIT $2
+			FOR UPDATE OF c SKIP LOCKED
+		)
+		RETURNING cc.content_id, cc.user_id, 'user', cc.role, COALESCE(cc.invited_by::text, ''),
+		          cc.expires_at, ci.organization_id, ci.title`, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim expiring collaborators: %w", err)
+	}
+	defer rows.Close()
+	return scanExpiringShares(rows, AccessLogContent)
+}
+
+// DeleteExpiredCollaborators deletes the co-authorships of every
+// organization past their expiry. Owner rows never expire.
+func (q *contentQueries) DeleteExpiredCollaborators() (int64, error) {
+	res, err := q.conn().ExecContext(q.ctx, `
+		DELETE FROM content_collaborators WHERE expires_at <= NOW() AND role != 'owner'`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired collaborators: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,110 @@
+package queries
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+const shareLinkColumns = `
+	id, organization_id, resource_type, resource_id, access_level, created_by::text, expires_at,
+	max_uses, use_count, last_used_at, revoked_at, revoked_by::text, created_at`
+
+func scanShareLink(row interface{ Scan(...interface{}) error }) (*models.ShareLink, error) {
+	var l models.ShareLink
+	var maxUses sql.NullInt64
+	if err := row.Scan(&l.ID, &l.OrganizationID, &l.ResourceType, &l.ResourceID, &l.AccessLevel, &l.CreatedBy,
+		&l.ExpiresAt, &maxUses, &l.UseCount, &l.LastUsedAt, &l.RevokedAt, &l.RevokedBy, &l.CreatedAt); err != nil {
+		return nil, err
+	}
+	if maxUses.Valid {
+		n := int(maxUses.Int64)
+		l.MaxUses = &n
+	}
+	return &l, nil
+}
+
+// CreateShareLink stores a new share link, filling in its ID and creation
+// time
+func (q *resourceQueries) CreateShareLink(link *models.ShareLink) error {
+	err := q.conn().QueryRowContext(q.ctx, `
+		INSERT INTO share_links (organization_id, resource_type, resource_id, access_level, created_by, expires_at, max_uses)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`,
+		link.OrganizationID, link.ResourceType, link.ResourceID, link.AccessLevel, link.CreatedBy,
+		link.ExpiresAt, link.MaxUses).Scan(&link.ID, &link.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create share link: %w", err)
+	}
+	return nil
+}
+
+// ListShareLinks returns the share links of one resource or content item of
+// the organization, the newest first
+func (q *resourceQueries) ListShareLinks(organizationID, resourceType, resourceID string) ([]models.ShareLink, error) {
+	rows, err := q.reader().QueryContext(q.ctx, `SELECT `+shareLinkColumns+`
+		FROM share_links
+		WHERE organization_id = $1 AND resource_type = $2 AND resource_id = $3
+		ORDER BY created_at DESC, id DESC`, organizationID, resourceType, resourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list share links: %w", err)
+	}
+	defer rows.Close()
+
+	links := []models.ShareLink{}
+	for rows.Next() {
+		l, err := scanShareLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan share link: %w", err)
+		}
+		links = append(links, *l)
+	}
+	return links, rows.Err()
+}
+
+// GetShareLink retrieves one share link of the organization
+func (q *resourceQueries) GetShareLink(id, organizationID string) (*models.ShareLink, error) {
+	l, err := scanShareLink(q.conn().QueryRowContext(q.ctx, `SELECT `+shareLinkColumns+`
+		FROM share_links WHERE id = $1 AND organization_id = $2`, id, organizationID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("share link not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share link: %w", err)
+	}
+	return l, nil
+}
+
+// RevokeShareLink revokes a share link of the given resource or content
+// item of the organization. Sessions opened with it end as well.
+func (q *resourceQueries) RevokeShareLink(id, organizationID, resourceType, resourceID, revokedBy string) error {
+	res, err := q.conn().ExecContext(q.ctx, `
+		UPDATE share_links SET revoked_at = NOW(), revoked_by = NULLIF($5, '')::uuid
+		WHERE id = $1 AND organization_id = $2 AND resource_type = $3 AND resource_id = $4
+		  AND revoked_at IS NULL`, id, organizationID, resourceType, resourceID, revokedBy)
+	if err != nil {
+		return fmt.Errorf("failed to revoke share link: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("share link not found")
+	}
+	return nil
+}
+
+// RedeemShareLink counts one use of a share link of the organization that
+// is neither revoked, expired nor used up, and returns it
+func (q *resourceQueries) RedeemShareLink(id, organizationID string) (*models.ShareLink, error) {
+	l, err := scanShareLink(q.conn().QueryRowContext(q.ctx, `
+		UPDATE share_links SET use_count = use_count + 1, last_used_at = NOW()
+		WHERE id = $1 AND organization_id = $2 AND revoked_at IS NULL AND expires_at > NOW()
+		  AND (max_uses IS NULL OR use_count < max_uses)
+		RETURNING `+shareLinkColumns, id, organizationID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("share link not usable")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem share link: %w", err)
+	}
+	return l, nil
+}
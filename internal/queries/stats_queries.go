@@ -0,0 +1,498 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/database"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+const (
+	// MaxStatsDays is the longest trend window GetSystemStats accepts
+	MaxStatsDays = 90
+	// statsCacheTTL is how long computed stats are served from Redis: the
+	// dashboard polls them, and the aggregates scan large tables
+	statsCacheTTL = time.Minute
+	// statsCounterRetention keeps the daily counters in Redis a little
+	// longer than the longest window, which also leaves the usage rollup
+	// time to read them
+	statsCounterRetention = (MaxStatsDays + 5) * 24 * time.Hour
+	// statsTopOrganizations bounds the per-organization user counts
+	statsTopOrganizations = 20
+	// usageTopResources is how many of the most accessed resources a day of
+	// usage keeps
+	usageTopResources = 10
+)
+
+// StatsQueries computes the aggregates of the admin dashboard
+type StatsQueries interface {
+	WithTx(tx *sql.Tx) StatsQueries
+	WithContext(ctx context.Context) StatsQueries
+
+	// GetSystemStats returns the stats of an organization, or of every
+	// organization when organizationID is empty, with trends over the last
+	// days days. Results are cached for a minute.
+	GetSystemStats(organizationID string, days int) (*models.SystemStats, error)
+	// RecordTokenIssued counts an OAuth2 access token issued to a client of
+	// the organization; failures are ignored
+	RecordTokenIssued(organizationID, grantType string)
+	// RollupOrgUsage computes the usage of every organization on the UTC day
+	// and stores it in org_usage_daily, replacing an earlier rollup
+	RollupOrgUsage(day time.Time) (int64, error)
+	// GetOrgUsage returns the rolled up usage of an organization from one day
+	// to another, both included
+	GetOrgUsage(organizationID string, from, to time.Time) (*models.OrgUsageReport, error)
+}
+
+type statsQueries struct {
+	db    *database.DB
+	redis redis.UniversalClient
+	tx    *sql.Tx
+	ctx   context.Context
+}
+
+func NewStatsQueries(db *database.DB, redis redis.UniversalClient) StatsQueries {
+	return &statsQueries{db: db, redis: redis, ctx: context.Background()}
+}
+
+func (q *statsQueries) WithTx(tx *sql.Tx) StatsQueries {
+	return &statsQueries{db: q.db, redis: q.redis, tx: tx, ctx: q.ctx}
+}
+
+func (q *statsQueries) WithContext(ctx context.Context) StatsQueries {
+	return &statsQueries{db: q.db, redis: q.redis, tx: q.tx, ctx: ctx}
+}
+
+func (q *statsQueries) conn() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.DB
+}
+
+// reader returns the connection for reads that tolerate replication lag:
+// the transaction if there is one, otherwise a replica
+func (q *statsQueries) reader() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.Reader()
+}
+
+// statsScope names the cache and counter keys of an organization, or of the
+// whole system
+func statsScope(organizationID string) string {
+	if organizationID == "" {
+		return "all"
+	}
+	return organizationID
+}
+
+func statsCacheKey(organizationID string, days int) string {
+	return fmt.Sprintf("stats:system:%s:%d", statsScope(organizationID), days)
+}
+
+func tokenStatsKey(organizationID string, day time.Time) string {
+	return fmt.Sprintf("stats:oidc_tokens:%s:%s", statsScope(organizationID), day.Format("2006-01-02"))
+}
+
+// apiKeyStatsKey is a hash of the API key requests of a day by organization
+func apiKeyStatsKey(day time.Time) string {
+	return "stats:api_keys:" + day.Format("2006-01-02")
+}
+
+func (q *statsQueries) GetSystemStats(organizationID string, days int) (*models.SystemStats, error) {
+	if days <= 0 || days > MaxStatsDays {
+		return nil, fmt.Errorf("days must be between 1 and %d", MaxStatsDays)
+	}
+
+	key := statsCacheKey(organizationID, days)
+	if q.redis != nil {
+		if cached, err := q.redis.Get(q.ctx, key).Bytes(); err == nil {
+			var stats models.SystemStats
+			if json.Unmarshal(cached, &stats) == nil {
+				return &stats, nil
+			}
+		}
+	}
+
+	now := time.Now().UTC()
+	since := now.Truncate(24*time.Hour).AddDate(0, 0, -(days - 1))
+	stats := &models.SystemStats{
+		OrganizationID: organizationID,
+		Days:           days,
+		GeneratedAt:    now,
+	}
+
+	var err error
+	if stats.Users.ByStatus, err = q.countBy("users", "status", "deleted_at IS NULL", organizationID); err != nil {
+		return nil, fmt.Errorf("count users by status: %w", err)
+	}
+	if stats.Policies, err = q.countBy("policies", "status", "deleted_at IS NULL", organizationID); err != nil {
+		return nil, fmt.Errorf("count policies: %w", err)
+	}
+	if stats.AuditEvents, err = q.countBy("audit_events", "COALESCE(severity, 'info')", "timestamp >= $1", organizationID, since); err != nil {
+		return nil, fmt.Errorf("count audit events: %w", err)
+	}
+	if stats.Logins, err = q.loginsPerDay(organizationID, since, days); err != nil {
+		return nil, fmt.Errorf("count logins: %w", err)
+	}
+	if organizationID == "" {
+		if stats.Users.ByOrganization, err = q.usersByOrganization(); err != nil {
+			return nil, fmt.Errorf("count users by organization: %w", err)
+		}
+	}
+	if err := q.countUsers(stats, organizationID, since); err != nil {
+		return nil, fmt.Errorf("count users: %w", err)
+	}
+
+	sessionQuery := `SELECT COUNT(*) FROM sessions WHERE status = 'active' AND expires_at > NOW()`
+	sessionArgs := []interface{}{}
+	if organizationID != "" {
+		sessionQuery += " AND organization_id = $1"
+		sessionArgs = append(sessionArgs, organizationID)
+	}
+	if err := q.reader().QueryRowContext(q.ctx, sessionQuery, sessionArgs...).Scan(&stats.ActiveSessions); err != nil {
+		return nil, fmt.Errorf("count active sessions: %w", err)
+	}
+
+	stats.Tokens = q.tokensPerDay(organizationID, since, days)
+
+	if q.redis != nil {
+		if payload, err := json.Marshal(stats); err == nil {
+			q.redis.Set(q.ctx, key, payload, statsCacheTTL)
+		}
+	}
+	return stats, nil
+}
+
+// countBy counts the rows of table matching where, grouped by column.
+// where may use $1 onwards for args; the organization guard comes after.
+func (q *statsQueries) countBy(table, column, where, organizationID string, args ...interface{}) (map[string]int64, error) {
+	query := fmt.Sprintf("SELECT %s::text, COUNT(*) FROM %s WHERE %s", column, table, where)
+	if organizationID != "" {
+		args = append(args, organizationID)
+		query += fmt.Sprintf(" AND organization_id = $%d", len(args))
+	}
+	query += " GROUP BY 1"
+
+	rows, err := q.reader().QueryContext(q.ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var key string
+		var n int64
+		if err := rows.Scan(&key, &n); err != nil {
+			return nil, err
+		}
+		counts[key] = n
+	}
+	return counts, rows.Err()
+}
+
+// countUsers fills the user totals and the MFA adoption among active users
+func (q *statsQueries) countUsers(stats *models.SystemStats, organizationID string, since time.Time) error {
+	query := `
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE created_at >= $1),
+		       COUNT(*) FILTER (WHERE status = 'active'),
+		       COUNT(*) FILTER (WHERE status = 'active' AND mfa_enabled)
+		FROM users
+		WHERE deleted_at IS NULL`
+	args := []interface{}{since}
+	if organizationID != "" {
+		query += " AND organization_id = $2"
+		args = append(args, organizationID)
+	}
+	err := q.reader().QueryRowContext(q.ctx, query, args...).Scan(
+		&stats.Users.Total, &stats.Users.New, &stats.MFA.ActiveUsers, &stats.MFA.Enabled,
+	)
+	if err != nil {
+		return err
+	}
+	if stats.MFA.ActiveUsers > 0 {
+		stats.MFA.AdoptionRate = float64(stats.MFA.Enabled) / float64(stats.MFA.ActiveUsers)
+	}
+	return nil
+}
+
+// usersByOrganization returns the user counts of the largest organizations
+func (q *statsQueries) usersByOrganization() ([]models.OrganizationCount, error) {
+	query := `
+		SELECT o.id, o.name, COUNT(u.id)
+		FROM organizations o
+		LEFT JOIN users u ON u.organization_id = o.id AND u.deleted_at IS NULL
+		WHERE o.deleted_at IS NULL
+		GROUP BY o.id, o.name
+		ORDER BY COUNT(u.id) DESC, o.name
+		LIMIT $1`
+	rows, err := q.reader().QueryContext(q.ctx, query, statsTopOrganizations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []models.OrganizationCount
+	for rows.Next() {
+		var oc models.OrganizationCount
+		if err := rows.Scan(&oc.OrganizationID, &oc.Name, &oc.Users); err != nil {
+			return nil, err
+		}
+		counts = append(counts, oc)
+	}
+	return counts, rows.Err()
+}
+
+// loginsPerDay returns the logins recorded in the audit log for each day
+// since since, days without logins included
+func (q *statsQueries) loginsPerDay(organizationID string, since time.Time, days int) ([]models.DailyLogins, error) {
+	query := `
+		SELECT to_char(timestamp AT TIME ZONE 'UTC', 'YYYY-MM-DD'),
+		       COUNT(*) FILTER (WHERE result = 'success'),
+		       COUNT(*) FILTER (WHERE result = 'failure')
+		FROM audit_events
+		WHERE action = 'login' AND timestamp >= $1`
+	args := []interface{}{since}
+	if organizationID != "" {
+		query += " AND organization_id = $2"
+		args = append(args, organizationID)
+	}
+	query += " GROUP BY 1"
+
+	rows, err := q.reader().QueryContext(q.ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byDay := make(map[string]models.DailyLogins)
+	for rows.Next() {
+		var d models.DailyLogins
+		if err := rows.Scan(&d.Date, &d.Succeeded, &d.Failed); err != nil {
+			return nil, err
+		}
+		byDay[d.Date] = d
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	logins := make([]models.DailyLogins, days)
+	for i := range logins {
+		date := since.AddDate(0, 0, i).Format("2006-01-02")
+		logins[i] = byDay[date]
+		logins[i].Date = date
+	}
+	return logins, nil
+}
+
+// tokensPerDay reads the token counters of RecordTokenIssued. Without Redis,
+// or when it fails, the days read as zero.
+func (q *statsQueries) tokensPerDay(organizationID string, since time.Time, days int) []models.DailyTokens {
+	tokens := make([]models.DailyTokens, days)
+	for i := range tokens {
+		tokens[i].Date = since.AddDate(0, 0, i).Format("2006-01-02")
+	}
+	if q.redis == nil {
+		return tokens
+	}
+
+	pipe := q.redis.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, days)
+	for i := range tokens {
+		cmds[i] = pipe.HGetAll(q.ctx, tokenStatsKey(organizationID, since.AddDate(0, 0, i)))
+	}
+	if _, err := pipe.Exec(q.ctx); err != nil && err != redis.Nil {
+		return tokens
+	}
+	for i, cmd := range cmds {
+		for grantType, value := range cmd.Val() {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			if tokens[i].ByGrantType == nil {
+				tokens[i].ByGrantType = make(map[string]int64)
+			}
+			tokens[i].ByGrantType[grantType] = n
+			tokens[i].Issued += n
+		}
+	}
+	return tokens
+}
+
+func (q *statsQueries) RecordTokenIssued(organizationID, grantType string) {
+	if q.redis == nil {
+		return
+	}
+	now := time.Now().UTC()
+	keys := []string{tokenStatsKey("", now)}
+	if organizationID != "" {
+		keys = append(keys, tokenStatsKey(organizationID, now))
+	}
+	pipe := q.redis.Pipeline()
+	for _, key := range keys {
+		pipe.HIncrBy(q.ctx, key, grantType, 1)
+		pipe.Expire(q.ctx, key, statsCounterRetention)
+	}
+	pipe.Exec(q.ctx)
+}
+
+func (q *statsQueries) RollupOrgUsage(day time.Time) (int64, error) {
+	start := day.UTC().Truncate(24 * time.Hour)
+	end := start.Add(24 * time.Hour)
+
+	apiKeyRequests := "{}"
+	if q.redis != nil {
+		counts, err := q.redis.HGetAll(q.ctx, apiKeyStatsKey(start)).Result()
+		if err != nil && err != redis.Nil {
+			return 0, fmt.Errorf("read API key requests: %w", err)
+		}
+		payload, err := json.Marshal(counts)
+		if err != nil {
+			return 0, err
+		}
+		apiKeyRequests = string(payload)
+	}
+
+	query := `
+		WITH activity AS (
+			SELECT organization_id,
+			       COUNT(DISTINCT principal_id) FILTER (WHERE principal_type = 'user' AND result = 'success') AS active_users,
+			       COUNT(*) FILTER (WHERE action = 'login' AND result = 'success') AS logins,
+			       COUNT(*) FILTER (WHERE action = 'login' AND result = 'failure') AS login_failures
+			FROM audit_events
+			WHERE timestamp >= $2 AND timestamp < $3
+			GROUP BY organization_id
+		), resource_hits AS (
+			SELECT organization_id, COALESCE(resource_type, '') AS resource_type, resource_id, COUNT(*) AS hits,
+			       ROW_NUMBER() OVER (PARTITION BY organization_id ORDER BY COUNT(*) DESC, resource_id) AS rank
+			FROM audit_events
+			WHERE timestamp >= $2 AND timestamp < $3 AND resource_id IS NOT NULL
+			GROUP BY organization_id, resource_type, resource_id
+		), top_resources AS (
+			SELECT organization_id,
+			       jsonb_agg(jsonb_build_object('resource_type', resource_type, 'resource_id', resource_id, 'count', hits) ORDER BY rank) AS resources
+			FROM resource_hits
+			WHERE rank <= $5
+			GROUP BY organization_id
+		), published AS (
+			SELECT organization_id, COUNT(*) AS content_published
+			FROM content_items
+			WHERE published_at >= $2 AND published_at < $3 AND deleted_at IS NULL
+			GROUP BY organization_id
+		)
+		INSERT INTO org_usage_daily (organization_id, day, active_users, logins, login_failures,
+		                             content_published, api_key_requests, top_resources, computed_at)
+		SELECT o.id, $1::date, COALESCE(a.active_users, 0), COALESCE(a.logins, 0), COALESCE(a.login_failures, 0),
+		       COALESCE(p.content_published, 0), COALESCE(k.value::bigint, 0), COALESCE(t.resources, '[]'::jsonb), NOW()
+		FROM organizations o
+		LEFT JOIN activity a ON a.organization_id = o.id
+		LEFT JOIN top_resources t ON t.organization_id = o.id
+		LEFT JOIN published p ON p.organization_id = o.id
+		LEFT JOIN jsonb_each_text($4::jsonb) k ON k.key = o.id::text
+		WHERE o.deleted_at IS NULL
+		ON CONFLICT (organization_id, day) DO UPDATE SET
+			active_users = EXCLUDED.active_users,
+			logins = EXCLUDED.logins,
+			login_failures = EXCLUDED.login_failures,
+			content_published = EXCLUDED.content_published,
+			api_key_requests = EXCLUDED.api_key_requests,
+			top_resources = EXCLUDED.top_resources,
+			computed_at = EXCLUDED.computed_at`
+	result, err := q.conn().ExecContext(q.ctx, query,
+		start.Format("2006-01-02"), start, end, apiKeyRequests, usageTopResources)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (q *statsQueries) GetOrgUsage(organizationID string, from, to time.Time) (*models.OrgUsageReport, error) {
+	query := `
+		SELECT to_char(day, 'YYYY-MM-DD'), active_users, logins, login_failures,
+		       content_published, api_key_requests, top_resources
+		FROM org_usage_daily
+		WHERE organization_id = $1 AND day BETWEEN $2::date AND $3::date
+		ORDER BY day`
+	report := &models.OrgUsageReport{
+		OrganizationID: organizationID,
+		From:           from.Format("2006-01-02"),
+		To:             to.Format("2006-01-02"),
+		Days:           []models.OrgUsageDay{},
+	}
+	rows, err := q.reader().QueryContext(q.ctx, query, organizationID, report.From, report.To)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.OrgUsageDay
+		var topResources []byte
+		if err := rows.Scan(&d.Day, &d.ActiveUsers, &d.Logins, &d.LoginFailures,
+			&d.ContentPublished, &d.APIKeyRequests, &topResources); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(topResources, &d.TopResources); err != nil {
+			return nil, fmt.Errorf("decode top resources of %s: %w", d.Day, err)
+		}
+		report.Days = append(report.Days, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	report.Totals = totalOrgUsage(report.Days)
+	return report, nil
+}
+
+// totalOrgUsage sums days of usage; the top resources of the range are
+// those with the most accesses over the days they made the daily top
+func totalOrgUsage(days []models.OrgUsageDay) models.OrgUsageTotal {
+	total := models.OrgUsageTotal{TopResources: []models.ResourceAccess{}}
+	if len(days) == 0 {
+		return total
+	}
+
+	var activeUsers int64
+	hits := make(map[models.ResourceAccess]int64)
+	for _, d := range days {
+		activeUsers += d.ActiveUsers
+		total.Logins += d.Logins
+		total.LoginFailures += d.LoginFailures
+		total.ContentPublished += d.ContentPublished
+		total.APIKeyRequests += d.APIKeyRequests
+		for _, r := range d.TopResources {
+			hits[models.ResourceAccess{ResourceType: r.ResourceType, ResourceID: r.ResourceID}] += r.Count
+		}
+	}
+	total.AverageDailyActiveUsers = float64(activeUsers) / float64(len(days))
+
+	for r, n := range hits {
+		r.Count = n
+		total.TopResources = append(total.TopResources, r)
+	}
+	sort.Slice(total.TopResources, func(i, j int) bool {
+		a, b := total.TopResources[i], total.TopResources[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.ResourceID < b.ResourceID
+	})
+	if len(total.TopResources) > usageTopResources {
+		total.TopResources = total.TopResources[:usageTopResources]
+	}
+	return total
+}
@@ -0,0 +1,123 @@
+package queries
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// ReconcileSystemRoles brings an organization's managed policies and system
+// roles in line with the catalog: missing ones are created, deleted ones are
+// restored and changed documents are rewritten. Policies and roles that an
+// organization created itself under a catalog name are left alone. Catalog
+// policies no longer in a role's template are detached from it.
+func (q *roleQueries) ReconcileSystemRoles(organizationID string, policies []models.ManagedPolicy, roles []models.SystemRoleTemplate) error {
+	if q.tx != nil {
+		return q.reconcileSystemRoles(q.tx, organizationID, policies, roles)
+	}
+
+	tx, err := q.db.BeginTx(q.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := q.reconcileSystemRoles(tx, organizationID, policies, roles); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (q *roleQueries) reconcileSystemRoles(tx *sql.Tx, organizationID string, policies []models.ManagedPolicy, roles []models.SystemRoleTemplate) error {
+	now := time.Now()
+
+	policyQuery := `
+		INSERT INTO policies (id, name, description, organization_id, document, policy_type, effect, is_system_policy, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5::jsonb, 'access', 'allow', TRUE, 'active', $6, $6)
+		ON CONFLICT (organization_id, name) DO UPDATE
+			SET description = EXCLUDED.description,
+			    document = EXCLUDED.document,
+			    status = 'active',
+			    deleted_at = NULL,
+			    updated_at = CASE
+			        WHEN policies.document IS DISTINCT FROM EXCLUDED.document
+			          OR policies.description IS DISTINCT FROM EXCLUDED.description
+			          OR policies.status != 'active'
+			        THEN EXCLUDED.updated_at ELSE policies.updated_at END
+			WHERE policies.is_system_policy
+		RETURNING id
+	`
+	policyIDs := make(map[string]string, len(policies))
+	catalog := make([]string, 0, len(policies))
+	for _, p := range policies {
+		catalog = append(catalog, p.Name)
+		var id string
+		err := tx.QueryRowContext(q.ctx, policyQuery, uuid.NewString(), p.Name, p.Description, organizationID, p.Document, now).Scan(&id)
+		if err == sql.ErrNoRows {
+			// A custom policy already uses this name
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to reconcile policy %q: %w", p.Name, err)
+		}
+		policyIDs[p.Name] = id
+	}
+
+	roleQuery := `
+		INSERT INTO roles (id, name, description, organization_id, is_system_role, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, TRUE, 'active', $5, $5)
+		ON CONFLICT (name, organization_id) DO UPDATE
+			SET description = EXCLUDED.description,
+			    status = 'active',
+			    deleted_at = NULL,
+			    updated_at = CASE
+			        WHEN roles.description IS DISTINCT FROM EXCLUDED.description
+			          OR roles.status != 'active'
+			        THEN EXCLUDED.updated_at ELSE roles.updated_at END
+			WHERE roles.is_system_role
+		RETURNING id
+	`
+	attachQuery := `
+		INSERT INTO role_policies (id, role_id, policy_id, attached_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (role_id, policy_id) DO NOTHING
+	`
+	detachQuery := `
+		DELETE FROM role_policies rp
+		USING policies p
+		WHERE rp.policy_id = p.id
+		  AND rp.role_id = $1
+		  AND p.is_system_policy
+		  AND p.name = ANY($2)
+		  AND NOT (p.name = ANY($3))
+	`
+	for _, r := range roles {
+		var roleID string
+		err := tx.QueryRowContext(q.ctx, roleQuery, uuid.NewString(), r.Name, r.Description, organizationID, now).Scan(&roleID)
+		if err == sql.ErrNoRows {
+			// A custom role already uses this name
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to reconcile role %q: %w", r.Name, err)
+		}
+
+		for _, name := range r.Policies {
+			policyID, ok := policyIDs[name]
+			if !ok {
+				continue
+			}
+			if _, err := tx.ExecContext(q.ctx, attachQuery, uuid.NewString(), roleID, policyID, now); err != nil {
+				return fmt.Errorf("failed to attach policy %q to role %q: %w", name, r.Name, err)
+			}
+		}
+		if _, err := tx.ExecContext(q.ctx, detachQuery, roleID, pq.Array(catalog), pq.Array(r.Policies)); err != nil {
+			return fmt.Errorf("failed to detach stale policies from role %q: %w", r.Name, err)
+		}
+	}
+	return nil
+}
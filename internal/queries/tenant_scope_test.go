@@ -0,0 +1,700 @@
+package queries
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+var organizationGuard = regexp.MustCompile(`organization_id\s*=\s*\$\d`)
+
+// assertScoped fails unless the statement filters on organization_id and is
+// bound to the caller's organization
+func assertScoped(t *testing.T, stmt recordedStatement, orgID string) {
+	t.Helper()
+	if !organizationGuard.MatchString(stmt.query) {
+		t.Errorf("statement has no organization guard:\n%s", stmt.query)
+	}
+	for _, arg := range stmt.args {
+		if arg == orgID {
+			return
+		}
+	}
+	t.Errorf("statement is not bound to organization %s: args %v", orgID, stmt.args)
+}
+
+func TestTenantScoping(t *testing.T) {
+	const (
+		orgID     = "org-a"
+		contentID = "content-of-org-b"
+		userID    = "user-of-org-b"
+	)
+	db, rec := newRecorderDB(t)
+
+	t.Run("UpdateUserProfile", func(t *testing.T) {
+		err := NewUserQueries(db, nil).UpdateUserProfile(userID, orgID, map[string]interface{}{"display_name": "x"})
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("err = %v, want not found for a user outside the organization", err)
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	getters := map[string]func() error{
+		"GetUser":   func() error { _, err := NewUserQueries(db, nil).GetUser(userID, orgID); return err },
+		"GetRole":   func() error { _, err := NewRoleQueries(db, nil).GetRole("role-of-org-b", orgID); return err },
+		"GetGroup":  func() error { _, err := NewGroupQueries(db, nil).GetGroup("group-of-org-b", orgID); return err },
+		"GetPolicy": func() error { _, err := NewPolicyQueries(db, nil).GetPolicy("policy-of-org-b", orgID); return err },
+		"GetResource": func() error {
+			_, err := NewResourceQueries(db, nil).GetResource("resource-of-org-b", orgID)
+			return err
+		},
+		"ChangeUsername": func() error {
+			_, err := NewUserQueries(db, nil).ChangeUsername(userID, orgID, "renamed")
+			return err
+		},
+		"CreateRevision": func() error {
+			_, err := NewContentQueries(db, nil).CreateRevision(contentID, orgID, "author", nil)
+			return err
+		},
+		"GetSecurityRule": func() error {
+			_, err := NewAuditQueries(db, nil).GetSecurityRule("rule-of-org-b", orgID)
+			return err
+		},
+		"AcknowledgeSecurityAlert": func() error {
+			_, err := NewAuditQueries(db, nil).AcknowledgeSecurityAlert("alert-of-org-b", orgID, "admin", "")
+			return err
+		},
+		"GetRevision": func() error {
+			_, err := NewContentQueries(db, nil).GetRevision(contentID, orgID, 1)
+			return err
+		},
+		"GetInvitation": func() error {
+			_, err := NewContentQueries(db, nil).GetInvitation("invitation-of-org-b", orgID)
+			return err
+		},
+		"AcceptInvitation": func() error {
+			_, err := NewContentQueries(db, nil).AcceptInvitation("invitation-of-org-b", userID, orgID)
+			return err
+		},
+		"CreateAttachment": func() error {
+			return NewContentQueries(db, nil).CreateAttachment(&models.ContentAttachment{ID: "attachment", ContentID: contentID, OrganizationID: orgID})
+		},
+		"GetAttachment": func() error {
+			_, err := NewContentQueries(db, nil).GetAttachment("attachment-of-org-b", orgID)
+			return err
+		},
+		"DeleteAttachment": func() error {
+			_, err := NewContentQueries(db, nil).DeleteAttachment("attachment-of-org-b", contentID, orgID)
+			return err
+		},
+		"TransferOwnership": func() error {
+			_, err := NewContentQueries(db, nil).TransferOwnership(contentID, userID, "admin", orgID)
+			return err
+		},
+		"GetThreadRoot": func() error {
+			_, err := NewContentQueries(db, nil).GetThreadRoot(contentID, orgID)
+			return err
+		},
+		"ModerateComment": func() error {
+			return NewContentQueries(db, nil).ModerateComment(contentID, orgID, "hidden")
+		},
+		"ResolveExternalID": func() error {
+			_, err := NewExternalIDQueries(db, nil).Resolve(ExternalKindRole, orgID, "role-of-org-b")
+			return err
+		},
+		"GetExternalID": func() error {
+			_, err := NewExternalIDQueries(db, nil).Get(ExternalKindPolicy, orgID, "policy-of-org-b")
+			return err
+		},
+		"SetExternalID": func() error {
+			return NewExternalIDQueries(db, nil).Set(ExternalKindServiceAccount, orgID, "sa-of-org-b", "ops-bot")
+		},
+		"GetOrganizationDeletion": func() error {
+			_, err := NewOrganizationDeletionQueries(db, nil).Get(orgID)
+			return err
+		},
+		"ResolveUsername": func() error {
+			_, _, err := NewUserQueries(db, nil).ResolveUsername("name-in-org-b", orgID)
+			return err
+		},
+	}
+	for name, get := range getters {
+		t.Run(name, func(t *testing.T) {
+			if err := get(); err == nil {
+				t.Error("returned a row from outside the organization")
+			}
+			assertScoped(t, rec.last(t), orgID)
+		})
+	}
+
+	t.Run("TrackSession", func(t *testing.T) {
+		session := &models.Session{ID: "session-of-org-b", OrganizationID: orgID, ExpiresAt: time.Now().Add(time.Hour)}
+		if err := NewSessionQueries(db, nil).TrackSession(session, 30*time.Minute, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("ExpireSession", func(t *testing.T) {
+		if err := NewSessionQueries(db, nil).ExpireSession("session-of-org-b", orgID); err != nil {
+			t.Fatal(err)
+		}
+		stmt := rec.last(t)
+		assertScoped(t, stmt, orgID)
+		if !strings.Contains(stmt.query, "status = 'active'") {
+			t.Error("expiring a session can overwrite its revocation")
+		}
+	})
+
+	t.Run("ListEntityChanges", func(t *testing.T) {
+		changes, err := NewAuditQueries(db, nil).ListEntityChanges(orgID, "policy", "policy-of-org-b", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 0 {
+			t.Errorf("got %d changes", len(changes))
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("FlagDormantUsers", func(t *testing.T) {
+		flagged, err := NewUserQueries(db, nil).FlagDormantUsers(orgID, time.Now(), nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(flagged) != 0 {
+			t.Errorf("got %d flagged users", len(flagged))
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("SuspendDormantUsers", func(t *testing.T) {
+		if _, err := NewUserQueries(db, nil).SuspendDormantUsers(orgID, time.Now(), time.Now(), []string{userID}, nil); err != nil {
+			t.Fatal(err)
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("GetRoleAssignment", func(t *testing.T) {
+		_, err := NewRoleQueries(db, nil).GetRoleAssignment("assignment-of-org-b", orgID)
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("err = %v, want not found for an assignment outside the organization", err)
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("CreateRoleRenewalRequest", func(t *testing.T) {
+		_, err := NewRoleQueries(db, nil).CreateRoleRenewalRequest(&models.RoleRenewalRequest{
+			OrganizationID: orgID, AssignmentID: "assignment-of-org-b", RequestedExpiresAt: time.Now(),
+		})
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("err = %v, want not found for an assignment outside the organization", err)
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("ListRoleRenewalRequests", func(t *testing.T) {
+		requests, err := NewRoleQueries(db, nil).ListRoleRenewalRequests(orgID, "pending", 50, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(requests) != 0 {
+			t.Errorf("got %d requests", len(requests))
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("DecideRoleRenewalRequest", func(t *testing.T) {
+		if _, err := NewRoleQueries(db, nil).DecideRoleRenewalRequest("request-of-org-b", orgID, userID, true, ""); err == nil {
+			t.Error("deciding a request outside the organization succeeded")
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("GetHeldRoleNames", func(t *testing.T) {
+		NewRoleQueries(db, nil).GetHeldRoleNames(userID, "user", orgID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("GetGroupRoleNames", func(t *testing.T) {
+		NewRoleQueries(db, nil).GetGroupRoleNames("group-of-org-b", orgID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("GetResourceAccessLog", func(t *testing.T) {
+		NewResourceQueries(db, nil).GetResourceAccessLog(orgID, ResourceAccessLogFilter{
+			ResourceType: AccessLogContent,
+			ResourceID:   contentID,
+		}, ListParams{Limit: 50})
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("ListShareLinks", func(t *testing.T) {
+		NewResourceQueries(db, nil).ListShareLinks(orgID, AccessLogContent, contentID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("GetShareLink", func(t *testing.T) {
+		NewResourceQueries(db, nil).GetShareLink("link-of-org-b", orgID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("RevokeShareLink", func(t *testing.T) {
+		NewResourceQueries(db, nil).RevokeShareLink("link-of-org-b", orgID, AccessLogContent, contentID, userID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("RedeemShareLink", func(t *testing.T) {
+		NewResourceQueries(db, nil).RedeemShareLink("link-of-org-b", orgID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("GetResourceLifecycle", func(t *testing.T) {
+		NewResourceQueries(db, nil).GetResourceLifecycle("resource-of-org-b", orgID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("RecertifyResource", func(t *testing.T) {
+		NewResourceQueries(db, nil).RecertifyResource("resource-of-org-b", orgID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("GetResourceIntegrity", func(t *testing.T) {
+		NewResourceQueries(db, nil).GetResourceIntegrity("resource-of-org-b", orgID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("SetResourceChecksum", func(t *testing.T) {
+		NewResourceQueries(db, nil).SetResourceChecksum("resource-of-org-b", orgID, strings.Repeat("0", 64), nil)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("RecordChecksumVerification", func(t *testing.T) {
+		NewResourceQueries(db, nil).RecordChecksumVerification("resource-of-org-b", orgID, ChecksumMismatch)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	kmsStatements := map[string]func(){
+		"ListKMSKeys":  func() { NewKMSQueries(db, nil).ListKeys(orgID) },
+		"GetKMSKey":    func() { NewKMSQueries(db, nil).GetKey("key-of-org-b", orgID) },
+		"DeleteKMSKey": func() { NewKMSQueries(db, nil).DeleteKey("key-of-org-b", orgID) },
+		"UpdateKMSKey": func() {
+			NewKMSQueries(db, nil).UpdateKey(&models.KMSKey{ID: "key-of-org-b", OrganizationID: orgID, Name: "k", Status: "enabled"})
+		},
+		"GetKMSKeyVersion": func() { NewKMSQueries(db, nil).GetKeyVersion("key-of-org-b", orgID, 1) },
+		"ListKMSGrants":    func() { NewKMSQueries(db, nil).ListGrants("key-of-org-b", orgID) },
+		"PutKMSGrant": func() {
+			NewKMSQueries(db, nil).PutGrant(&models.KMSKeyGrant{KeyID: "key-of-org-b", OrganizationID: orgID,
+				PrincipalID: userID, PrincipalType: "user", Operations: []string{"encrypt"}})
+		},
+		"DeleteKMSGrant": func() { NewKMSQueries(db, nil).DeleteGrant("grant-of-org-b", "key-of-org-b", orgID) },
+		"KMSOperationAllowed": func() {
+			NewKMSQueries(db, nil).OperationAllowed("key-of-org-b", orgID, userID, "user", "decrypt")
+		},
+	}
+	for name, run := range kmsStatements {
+		t.Run(name, func(t *testing.T) {
+			run()
+			assertScoped(t, rec.last(t), orgID)
+		})
+	}
+
+	t.Run("GetPrincipal", func(t *testing.T) {
+		_, err := NewPrincipalQueries(db, nil).GetPrincipal(userID, "", orgID)
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("err = %v, want not found for a principal outside the organization", err)
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("ListPrincipals", func(t *testing.T) {
+		principals, err := NewPrincipalQueries(db, nil).ListPrincipals([]string{userID, "group-of-org-b"}, orgID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(principals) != 0 {
+			t.Errorf("got %d principals", len(principals))
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("AttachmentSharedWith", func(t *testing.T) {
+		NewContentQueries(db, nil).AttachmentSharedWith("attachment-of-org-b", userID, "service_account", orgID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("ListActiveDelegationGrants", func(t *testing.T) {
+		NewDelegationQueries(db, nil).ListActiveGrants(orgID, "", "sa-of-org-b")
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("PutDelegationGrant", func(t *testing.T) {
+		err := NewDelegationQueries(db, nil).PutGrant(&models.DelegationGrant{
+			OrganizationID: orgID, UserID: userID, ServiceAccountID: "sa-of-org-b", Actions: []string{"content:publish"},
+		})
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("err = %v, want not found for a service account outside the organization", err)
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("GetActiveDelegationGrant", func(t *testing.T) {
+		NewDelegationQueries(db, nil).GetActiveGrant(userID, "sa-of-org-b", orgID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("RevokeDelegationGrant", func(t *testing.T) {
+		NewDelegationQueries(db, nil).RevokeGrant("grant-of-org-b", orgID, "")
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("TouchDelegationGrant", func(t *testing.T) {
+		NewDelegationQueries(db, nil).TouchGrant("grant-of-org-b", orgID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("ListCurrentEmailTemplates", func(t *testing.T) {
+		NewEmailTemplateQueries(db, nil).ListCurrentTemplates(orgID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("GetCurrentEmailTemplate", func(t *testing.T) {
+		NewEmailTemplateQueries(db, nil).GetCurrentTemplate(orgID, "verification")
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("ListEmailTemplateVersions", func(t *testing.T) {
+		NewEmailTemplateQueries(db, nil).ListTemplateVersions(orgID, "verification")
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("GetEmailTemplateVersion", func(t *testing.T) {
+		NewEmailTemplateQueries(db, nil).GetTemplateVersion(orgID, "verification", 1)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("CreateEmailTemplateVersion", func(t *testing.T) {
+		NewEmailTemplateQueries(db, nil).CreateTemplateVersion(&models.EmailTemplate{
+			OrganizationID: orgID, Kind: "verification", Subject: "Verify", HTMLBody: "<p>{{.VerificationLink}}</p>",
+		})
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("DeleteEmailTemplates", func(t *testing.T) {
+		NewEmailTemplateQueries(db, nil).DeleteTemplates(orgID, "verification")
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("GetClaimsWebhook", func(t *testing.T) {
+		NewClaimsWebhookQueries(db, nil).GetWebhook(orgID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("PutClaimsWebhook", func(t *testing.T) {
+		NewClaimsWebhookQueries(db, nil).PutWebhook(&models.ClaimsWebhook{
+			OrganizationID: orgID, URL: "https://claims.example.com", Secret: "s", Namespace: "https://example.com/",
+		})
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("DeleteClaimsWebhook", func(t *testing.T) {
+		NewClaimsWebhookQueries(db, nil).DeleteWebhook(orgID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("RecordClaimsWebhookFailure", func(t *testing.T) {
+		NewClaimsWebhookQueries(db, nil).RecordFailure(orgID, "timeout")
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("GetDirectorySync", func(t *testing.T) {
+		NewDirectorySyncQueries(db, nil).GetSync(orgID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("PutDirectorySync", func(t *testing.T) {
+		NewDirectorySyncQueries(db, nil).PutSync(&models.DirectorySync{
+			OrganizationID: orgID, SourceType: models.DirectorySourceSCIM, BaseURL: "https://hr.example.com/scim/v2", Token: "t",
+		})
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("DeleteDirectorySync", func(t *testing.T) {
+		NewDirectorySyncQueries(db, nil).DeleteSync(orgID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("ListDirectorySyncLinks", func(t *testing.T) {
+		NewDirectorySyncQueries(db, nil).ListLinks(orgID, "user")
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("PutDirectorySyncLink", func(t *testing.T) {
+		NewDirectorySyncQueries(db, nil).PutLink(orgID, &models.DirectorySyncLink{Kind: "user", ExternalID: "e1", LocalID: userID})
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("DeleteDirectorySyncLink", func(t *testing.T) {
+		NewDirectorySyncQueries(db, nil).DeleteLink(orgID, "user", "e1")
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("FinishDirectorySyncRun", func(t *testing.T) {
+		NewDirectorySyncQueries(db, nil).FinishRun(&models.DirectorySyncRun{ID: "run-of-org-b", OrganizationID: orgID, Status: "succeeded"})
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("GetDirectorySyncRun", func(t *testing.T) {
+		_, err := NewDirectorySyncQueries(db, nil).GetRun("run-of-org-b", orgID)
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("err = %v, want not found for a run outside the organization", err)
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("AddServiceAccountCertificate", func(t *testing.T) {
+		err := NewUserQueries(db, nil).AddServiceAccountCertificate(&models.ServiceAccountCertificate{
+			ID: "cert", ServiceAccountID: "sa-of-org-b", OrganizationID: orgID, Fingerprint: strings.Repeat("ab", 32),
+		})
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("err = %v, want not found for a service account outside the organization", err)
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("ListServiceAccountCertificates", func(t *testing.T) {
+		NewUserQueries(db, nil).ListServiceAccountCertificates("sa-of-org-b", orgID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("DeleteServiceAccountCertificate", func(t *testing.T) {
+		err := NewUserQueries(db, nil).DeleteServiceAccountCertificate("sa-of-org-b", "cert-of-org-b", orgID)
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("err = %v, want not found for a certificate outside the organization", err)
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("GetGroupByName", func(t *testing.T) {
+		NewGroupQueries(db, nil).GetGroupByName("engineering", orgID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("SetClientTrust", func(t *testing.T) {
+		err := NewOIDCQueries(db, nil).SetClientTrust("client-of-org-b", orgID, true, false)
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("err = %v, want not found for a client outside the organization", err)
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("RotateClientSecret", func(t *testing.T) {
+		err := NewOIDCQueries(db, nil).RotateClientSecret("client-of-org-b", orgID, "hash", nil)
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("err = %v, want not found for a client outside the organization", err)
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("ListExternalShares", func(t *testing.T) {
+		NewResourceQueries(db, nil).ListExternalShares(orgID, ExternalShareFilter{GuestEmail: "guest@example.com"}, ListParams{Limit: 50})
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("GetExternalShare", func(t *testing.T) {
+		NewResourceQueries(db, nil).GetExternalShare("share-of-org-b", orgID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("RevokeExternalShare", func(t *testing.T) {
+		NewResourceQueries(db, nil).RevokeExternalShare("share-of-org-b", orgID, "", "", userID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("TouchExternalShare", func(t *testing.T) {
+		NewResourceQueries(db, nil).TouchExternalShare("share-of-org-b", orgID)
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("ListHeldRoleNames", func(t *testing.T) {
+		held, err := NewRoleQueries(db, nil).ListHeldRoleNames(orgID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(held) != 0 {
+			t.Errorf("got %d principals", len(held))
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("RehashPassword", func(t *testing.T) {
+		if err := NewAuthQueries(db, nil).RehashPassword(userID, orgID, "$2a$10$old", "$2a$12$new"); err != nil {
+			t.Fatal(err)
+		}
+		stmt := rec.last(t)
+		assertScoped(t, stmt, orgID)
+		if !strings.Contains(stmt.query, "password_hash = $4") {
+			t.Error("rehash can overwrite a password changed since it was read")
+		}
+	})
+
+	t.Run("ListSimilarUsernames", func(t *testing.T) {
+		pairs, err := NewUserQueries(db, nil).ListSimilarUsernames(orgID, 0.6, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pairs) != 0 {
+			t.Errorf("got %d pairs", len(pairs))
+		}
+		stmt := rec.last(t)
+		assertScoped(t, stmt, orgID)
+		if !strings.Contains(stmt.query, "b.organization_id = a.organization_id") {
+			t.Error("usernames are paired across organizations")
+		}
+	})
+
+	t.Run("MergeUsers", func(t *testing.T) {
+		rec.mu.Lock()
+		from := len(rec.statements)
+		rec.mu.Unlock()
+
+		_, err := NewUserQueries(db, nil).MergeUsers(userID, "other-user-of-org-b", orgID)
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("err = %v, want not found for users outside the organization", err)
+		}
+
+		rec.mu.Lock()
+		stmts := append([]recordedStatement(nil), rec.statements[from:]...)
+		rec.mu.Unlock()
+		if len(stmts) != 1 {
+			t.Fatalf("ran %d statements, want only the lookup of both users", len(stmts))
+		}
+		assertScoped(t, stmts[0], orgID)
+	})
+
+	t.Run("GetSystemStats", func(t *testing.T) {
+		rec.mu.Lock()
+		from := len(rec.statements)
+		rec.mu.Unlock()
+
+		NewStatsQueries(db, nil).GetSystemStats(orgID, 7)
+
+		rec.mu.Lock()
+		stmts := append([]recordedStatement(nil), rec.statements[from:]...)
+		rec.mu.Unlock()
+		if len(stmts) == 0 {
+			t.Fatal("no statement was executed")
+		}
+		for _, stmt := range stmts {
+			if strings.Contains(stmt.query, "FROM organizations") {
+				t.Errorf("organization stats list other organizations:\n%s", stmt.query)
+			}
+			assertScoped(t, stmt, orgID)
+		}
+	})
+
+	t.Run("GetOrgUsage", func(t *testing.T) {
+		day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+		report, err := NewStatsQueries(db, nil).GetOrgUsage(orgID, day, day.AddDate(0, 0, 6))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Days) != 0 {
+			t.Errorf("got %d days of usage", len(report.Days))
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	content := NewContentQueries(db, nil)
+
+	t.Run("AddCollaborator", func(t *testing.T) {
+		err := content.AddCollaborator(contentID, userID, "co-author", "inviter", orgID, nil)
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("err = %v, want not found for content outside the organization", err)
+		}
+		stmt := rec.last(t)
+		assertScoped(t, stmt, orgID)
+		if !strings.Contains(stmt.query, "u.organization_id = ci.organization_id") {
+			t.Error("collaborators from another organization can be added")
+		}
+	})
+
+	t.Run("RemoveCollaborator", func(t *testing.T) {
+		if err := content.RemoveCollaborator(contentID, userID, orgID); err == nil {
+			t.Error("removed a collaborator of content outside the organization")
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("ListCollaborators", func(t *testing.T) {
+		collabs, err := content.ListCollaborators(contentID, orgID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(collabs) != 0 {
+			t.Errorf("got %d collaborators", len(collabs))
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("GetCollaboratorRole", func(t *testing.T) {
+		role, err := content.GetCollaboratorRole(contentID, userID, orgID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if role != "" {
+			t.Errorf("role = %q, want none", role)
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("AddReaction", func(t *testing.T) {
+		added, err := content.AddReaction(contentID, userID, orgID, "like")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added {
+			t.Error("reacted to content outside the organization")
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+
+	t.Run("AddBookmark", func(t *testing.T) {
+		added, err := content.AddBookmark(contentID, userID, orgID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added {
+			t.Error("bookmarked content outside the organization")
+		}
+		assertScoped(t, rec.last(t), orgID)
+	})
+}
+
+func TestOrganizationDeletionCascade(t *testing.T) {
+	const orgID = "org-a"
+
+	for _, step := range organizationCascade {
+		t.Run(step.kind, func(t *testing.T) {
+			if !organizationGuard.MatchString(step.query) {
+				t.Errorf("cascade statement has no organization guard:\n%s", step.query)
+			}
+		})
+	}
+
+	t.Run("NotDue", func(t *testing.T) {
+		db, rec := newRecorderDB(t)
+		if _, err := NewOrganizationDeletionQueries(db, nil).Complete(orgID); err == nil || !strings.Contains(err.Error(), "not due") {
+			t.Errorf("err = %v, want not due", err)
+		}
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		if len(rec.statements) != 1 {
+			t.Errorf("ran %d statements, want only the claim of the deletion", len(rec.statements))
+		}
+		assertScoped(t, rec.statements[0], orgID)
+	})
+}
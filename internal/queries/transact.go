@@ -0,0 +1,152 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// transactAttempts bounds how often Transact runs a transaction that failed
+// on a serialization failure or deadlock
+const transactAttempts = 3
+
+// Transact runs fn in a transaction with every query interface bound to it,
+// committing when fn returns nil and rolling back otherwise. ctx applies to
+// every query, and a tenant set with database.WithTenant scopes the
+// transaction under row-level security (queries outside Transact are not
+// scoped). Transactions that fail on a
+// serialization failure or deadlock are retried, so fn must not have side
+// effects outside the database. Called on Queries already bound to a
+// transaction, fn joins that transaction instead.
+func (q *Queries) Transact(ctx context.Context, fn func(q *Queries) error) error {
+	if q.tx != nil {
+		return fn(q.WithContext(ctx))
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := q.transactOnce(ctx, fn)
+		if err == nil || !isRetryableTxError(err) || attempt == transactAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt*attempt) * 10 * time.Millisecond):
+		}
+	}
+}
+
+func (q *Queries) transactOnce(ctx context.Context, fn func(q *Queries) error) (err error) {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	commitHooks.begin(tx)
+	defer func() {
+		hooks := commitHooks.end(tx)
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if err == nil {
+			for _, hook := range hooks {
+				hook()
+			}
+		}
+	}()
+
+	if err := fn(q.WithContext(ctx).WithTx(tx)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// commitHooks holds the functions to run once the transactions begun by
+// Transact commit
+var commitHooks = txHooks{hooks: map[*sql.Tx][]func(){}}
+
+type txHooks struct {
+	mu    sync.Mutex
+	hooks map[*sql.Tx][]func()
+}
+
+func (h *txHooks) begin(tx *sql.Tx) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hooks[tx] = nil
+}
+
+func (h *txHooks) end(tx *sql.Tx) []func() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hooks := h.hooks[tx]
+	delete(h.hooks, tx)
+	return hooks
+}
+
+// afterCommit runs fn once tx has committed, and not at all when it rolls
+// back. Without a transaction, or with one not begun by Transact, fn runs
+// right away. Cache invalidations go through it, so that a request reading
+// between the invalidation and the commit cannot cache the old rows again.
+func afterCommit(tx *sql.Tx, fn func()) {
+	if tx != nil {
+		commitHooks.mu.Lock()
+		hooks, ok := commitHooks.hooks[tx]
+		if ok {
+			commitHooks.hooks[tx] = append(hooks, fn)
+		}
+		commitHooks.mu.Unlock()
+		if ok {
+			return
+		}
+	}
+	fn()
+}
+
+// Savepoint runs fn in a savepoint of the transaction q is bound to: when
+// fn returns an error, what it did is rolled back and the error returned,
+// while the transaction goes on. Called on Queries without a transaction,
+// it is Transact.
+func (q *Queries) Savepoint(ctx context.Context, fn func(q *Queries) error) (err error) {
+	if q.tx == nil {
+		return q.Transact(ctx, fn)
+	}
+	// Savepoints of the same name nest: rollbacks and releases apply to the
+	// innermost one
+	if _, err := q.tx.ExecContext(ctx, "SAVEPOINT queries_savepoint"); err != nil {
+		return fmt.Errorf("failed to create savepoint: %w", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			q.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT queries_savepoint")
+			panic(p)
+		}
+	}()
+
+	if err := fn(q.WithContext(ctx)); err != nil {
+		if _, rbErr := q.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT queries_savepoint"); rbErr != nil {
+			return fmt.Errorf("failed to roll back to savepoint: %v (after %w)", rbErr, err)
+		}
+		return err
+	}
+	if _, err := q.tx.ExecContext(ctx, "RELEASE SAVEPOINT queries_savepoint"); err != nil {
+		return fmt.Errorf("failed to release savepoint: %w", err)
+	}
+	return nil
+}
+
+// isRetryableTxError reports whether err is a serialization failure or
+// deadlock, after which the whole transaction can be run again
+func isRetryableTxError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
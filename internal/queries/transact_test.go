@@ -0,0 +1,160 @@
+package queries
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestTransact(t *testing.T) {
+	db, rec := newRecorderDB(t)
+	q := New(db, nil)
+	ctx := context.Background()
+
+	t.Run("commits", func(t *testing.T) {
+		err := q.Transact(ctx, func(tq *Queries) error {
+			_, err := tq.AuthzDecision.PurgeDecisions(time.Now())
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rec.last(t).query; got != "COMMIT" {
+			t.Errorf("transaction ended with %q, want COMMIT", got)
+		}
+	})
+
+	t.Run("rolls back on error", func(t *testing.T) {
+		boom := errors.New("boom")
+		err := q.Transact(ctx, func(tq *Queries) error { return boom })
+		if !errors.Is(err, boom) {
+			t.Errorf("err = %v, want %v", err, boom)
+		}
+		if got := rec.last(t).query; got != "ROLLBACK" {
+			t.Errorf("transaction ended with %q, want ROLLBACK", got)
+		}
+	})
+
+	t.Run("retries serialization failures", func(t *testing.T) {
+		calls := 0
+		err := q.Transact(ctx, func(tq *Queries) error {
+			calls++
+			return &pq.Error{Code: "40001"}
+		})
+		if err == nil || calls != transactAttempts {
+			t.Errorf("err = %v after %d calls, want a failure after %d", err, calls, transactAttempts)
+		}
+
+		calls = 0
+		q.Transact(ctx, func(tq *Queries) error {
+			calls++
+			return &pq.Error{Code: "23505"}
+		})
+		if calls != 1 {
+			t.Errorf("unique violation was retried: %d calls", calls)
+		}
+	})
+
+	t.Run("nested calls join the transaction", func(t *testing.T) {
+		rec.mu.Lock()
+		rec.statements = nil
+		rec.mu.Unlock()
+
+		err := q.Transact(ctx, func(outer *Queries) error {
+			return outer.Transact(ctx, func(inner *Queries) error {
+				if inner.tx != outer.tx {
+					t.Error("inner call runs in a different transaction")
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		commits := 0
+		for _, stmt := range rec.statements {
+			if stmt.query == "COMMIT" {
+				commits++
+			}
+		}
+		if commits != 1 {
+			t.Errorf("%d commits, want 1", commits)
+		}
+	})
+
+	t.Run("runs hooks after commit only", func(t *testing.T) {
+		ran := 0
+		err := q.Transact(ctx, func(tq *Queries) error {
+			afterCommit(tq.tx, func() { ran++ })
+			if ran != 0 {
+				t.Error("hook ran before the commit")
+			}
+			return nil
+		})
+		if err != nil || ran != 1 {
+			t.Errorf("err = %v, hook ran %d times; want it run once", err, ran)
+		}
+
+		ran = 0
+		q.Transact(ctx, func(tq *Queries) error {
+			afterCommit(tq.tx, func() { ran++ })
+			return errors.New("boom")
+		})
+		if ran != 0 {
+			t.Errorf("hook of a rolled back transaction ran %d times", ran)
+		}
+
+		afterCommit(nil, func() { ran++ })
+		if ran != 1 {
+			t.Error("hook without a transaction did not run right away")
+		}
+	})
+}
+
+func TestSavepoint(t *testing.T) {
+	db, rec := newRecorderDB(t)
+	q := New(db, nil)
+	ctx := context.Background()
+
+	queriesOf := func() []string {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		var out []string
+		for _, stmt := range rec.statements {
+			out = append(out, stmt.query)
+		}
+		rec.statements = nil
+		return out
+	}
+
+	boom := errors.New("boom")
+	err := q.Transact(ctx, func(tq *Queries) error {
+		if err := tq.Savepoint(ctx, func(*Queries) error { return boom }); !errors.Is(err, boom) {
+			t.Errorf("err = %v, want %v", err, boom)
+		}
+		return tq.Savepoint(ctx, func(*Queries) error { return nil })
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"SAVEPOINT queries_savepoint", "ROLLBACK TO SAVEPOINT queries_savepoint",
+		"SAVEPOINT queries_savepoint", "RELEASE SAVEPOINT queries_savepoint",
+		"COMMIT",
+	}
+	if got := queriesOf(); strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("statements = %q, want %q", got, want)
+	}
+
+	// Outside a transaction it runs its own
+	if err := q.Savepoint(ctx, func(*Queries) error { return boom }); !errors.Is(err, boom) {
+		t.Errorf("err = %v, want %v", err, boom)
+	}
+	if got := queriesOf(); len(got) != 1 || got[0] != "ROLLBACK" {
+		t.Errorf("statements = %q, want a rolled back transaction", got)
+	}
+}
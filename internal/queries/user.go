@@ -5,11 +5,13 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/lib/pq"
 	"github.com/redis/go-redis/v9"
 	"github.com/the-monkeys/monkeys-identity/internal/database"
 	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
 )
 
 // UserQueries defines all user management database operations
@@ -19,23 +21,51 @@ type UserQueries interface {
 	WithContext(ctx context.Context) UserQueries
 
 	// User CRUD operations
-	ListUsers(params ListParams, organizationID string) (*ListResult[models.User], error)
+	ListUsers(params ListParams, organizationID string, filter UserFilter) (*ListResult[models.User], error)
 	GetUser(id, organizationID string) (*models.User, error)
 	CreateUser(user *models.User) error
 	UpdateUser(user *models.User, organizationID string) error
 	DeleteUser(id, organizationID string) error
+	UsernameExists(username, organizationID string) (bool, error)
+	UsernameAvailable(username, organizationID, userID string) (bool, error)
+	ChangeUsername(userID, organizationID, username string) (string, error)
+	LastUsernameChange(userID, organizationID string) (*time.Time, error)
+	ResolveUsername(username, organizationID string) (userID, current string, err error)
 
 	// User profile operations (using User model for now)
 	GetUserProfile(userID, organizationID string) (*models.User, error)
-	UpdateUserProfile(userID string, updates map[string]interface{}) error
+	UpdateUserProfile(userID, organizationID string, updates map[string]interface{}) error
+	UpdateUserAttributes(userID, organizationID, attributes string) error
+	UpdateUserPreferences(userID, organizationID, preferences string) error
 
 	// User status operations
 	SuspendUser(userID, organizationID, reason string) error
 	ActivateUser(userID, organizationID string) error
 
+	// Deletion lifecycle operations
+	RestoreUser(id, organizationID string) error
+	PurgeUser(id, organizationID string) error
+	PurgeDeletedUsers(deletedBefore time.Time) (int, error)
+
+	// Inactive account operations
+	FlagDormantUsers(organizationID string, inactiveSince time.Time, exemptUsers, exemptGroups []string) ([]models.DormantUser, error)
+	SuspendDormantUsers(organizationID string, inactiveSince, flaggedBefore time.Time, exemptUsers, exemptGroups []string) ([]string, error)
+	ListDormantUsers(organizationID string, inactiveSince time.Time, exemptUsers, exemptGroups []string, limit, offset int) ([]models.DormantUser, int, error)
+
+	// Password hash operations
+	CountPasswordHashSchemes() (map[string]int, error)
+
+	// Field encryption operations
+	ReencryptUserSecrets(afterID string, limit int) (next string, updated int, err error)
+
+	// Duplicate account operations
+	ListSimilarUsernames(organizationID string, minSimilarity float64, limit int) ([]models.SimilarUsernames, error)
+	MergeUsers(sourceID, targetID, organizationID string) (*models.UserMerge, error)
+
 	// User session operations
 	GetUserSessions(userID, organizationID string) ([]models.Session, error)
 	RevokeUserSessions(userID, organizationID string) error
+	RevokeUserSession(userID, organizationID, sessionID string) error
 
 	// Service account operations
 	ListServiceAccounts(params ListParams, organizationID string) (*ListResult[models.ServiceAccount], error)
@@ -48,19 +78,28 @@ type UserQueries interface {
 	GenerateAPIKey(saID string, key *models.APIKey, organizationID string) error
 	ListAPIKeys(saID, organizationID string) ([]models.APIKey, error)
 	RevokeAPIKey(saID, keyID, organizationID string) error
+	GetActiveAPIKeyByKeyID(keyID string) (*models.APIKey, error)
+	RecordAPIKeyUse(id string) error
 	RotateServiceAccountKeys(saID, organizationID string) error
+
+	// Client certificate operations
+	AddServiceAccountCertificate(cert *models.ServiceAccountCertificate) error
+	ListServiceAccountCertificates(saID, organizationID string) ([]models.ServiceAccountCertificate, error)
+	DeleteServiceAccountCertificate(saID, certID, organizationID string) error
+	GetServiceAccountCertificateByFingerprint(fingerprint string) (*models.ServiceAccountCertificate, error)
+	RecordServiceAccountCertificateUse(id string) error
 }
 
 // userQueries implements UserQueries
 type userQueries struct {
 	db    *database.DB
-	redis *redis.Client
+	redis redis.UniversalClient
 	tx    *sql.Tx
 	ctx   context.Context
 }
 
 // NewUserQueries creates a new UserQueries instance
-func NewUserQueries(db *database.DB, redis *redis.Client) UserQueries {
+func NewUserQueries(db *database.DB, redis redis.UniversalClient) UserQueries {
 	return &userQueries{
 		db:    db,
 		redis: redis,
@@ -112,13 +151,62 @@ func (q *userQueries) query(query string, args ...interface{}) (*sql.Rows, error
 	return q.db.QueryContext(q.ctx, query, args...)
 }
 
-// Placeholder implementations - these will be implemented as needed
-func (q *userQueries) ListUsers(params ListParams, organizationID string) (*ListResult[models.User], error) {
+// reader returns the connection for reads that tolerate replication lag:
+// the transaction if there is one, otherwise a replica
+func (q *userQueries) reader() DBTX {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.db.Reader()
+}
+
+// UserFilter narrows ListUsers results. Zero values disable a filter.
+type UserFilter struct {
+	Query         string // Case-insensitive substring of username, email or display name
+	Status        string
+	Role          string // Name of a role assigned to the user
+	MFAEnabled    *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+// conditions appends the filter's SQL predicates on users u to conds
+func (f UserFilter) conditions(conds []string, args []interface{}) ([]string, []interface{}) {
+	if f.Query != "" {
+		args = append(args, "%"+escapeLike(f.Query)+"%")
+		n := len(args)
+		conds = append(conds, fmt.Sprintf("(u.username ILIKE $%d OR u.email ILIKE $%d OR u.display_name ILIKE $%d)", n, n, n))
+	}
+	if f.Status != "" {
+		args = append(args, f.Status)
+		conds = append(conds, fmt.Sprintf("u.status = $%d", len(args)))
+	}
+	if f.Role != "" {
+		args = append(args, f.Role)
+		conds = append(conds, fmt.Sprintf(`EXISTS (SELECT 1 FROM role_assignments ra JOIN roles r ON r.id = ra.role_id
+			WHERE ra.principal_id = u.id AND ra.principal_type = 'user' AND r.name = $%d)`, len(args)))
+	}
+	if f.MFAEnabled != nil {
+		args = append(args, *f.MFAEnabled)
+		conds = append(conds, fmt.Sprintf("u.mfa_enabled = $%d", len(args)))
+	}
+	if f.CreatedAfter != nil {
+		args = append(args, *f.CreatedAfter)
+		conds = append(conds, fmt.Sprintf("u.created_at >= $%d", len(args)))
+	}
+	if f.CreatedBefore != nil {
+		args = append(args, *f.CreatedBefore)
+		conds = append(conds, fmt.Sprintf("u.created_at < $%d", len(args)))
+	}
+	return conds, args
+}
+
+func (q *userQueries) ListUsers(params ListParams, organizationID string, filter UserFilter) (*ListResult[models.User], error) {
 	// Build the query with sorting
-	sortColumn := "created_at" // default
+	sortBy := "created_at" // default
 	switch params.SortBy {
 	case "username", "email", "display_name", "created_at", "updated_at":
-		sortColumn = params.SortBy
+		sortBy = params.SortBy
 	}
 
 	order := "DESC"
@@ -126,6 +214,25 @@ func (q *userQueries) ListUsers(params ListParams, organizationID string) (*List
 		order = "ASC"
 	}
 
+	sortColumn := "u." + sortBy
+	if sortBy == "display_name" {
+		sortColumn = "COALESCE(u.display_name, '')"
+	}
+	ks, err := newKeyset(params, sortBy, sortColumn, "u.id", order)
+	if err != nil {
+		return nil, err
+	}
+
+	conds, args := filter.conditions([]string{"u.deleted_at IS NULL", "u.organization_id = $1"}, []interface{}{organizationID})
+	where := strings.Join(conds, " AND ")
+	countArgs := args
+
+	if clause, cursorArgs := ks.where(len(args) + 1); clause != "" {
+		conds = append(conds, clause)
+		args = append(args, cursorArgs...)
+	}
+	args = append(args, ks.limit(params.Limit), ks.offset(params.Offset))
+
 	// Query to get users with pagination and role join
 	query := `
 		SELECT u.id, u.username, u.email, u.email_verified, u.display_name, u.avatar_url,
@@ -136,12 +243,12 @@ func (q *userQueries) ListUsers(params ListParams, organizationID string) (*List
 		                 WHERE ra.principal_id = u.id AND ra.principal_type = 'user' 
 		                 ORDER BY r.is_system_role DESC LIMIT 1), 'user') as role
 		FROM users u
-		WHERE u.deleted_at IS NULL AND u.organization_id = $3
-		ORDER BY u.` + sortColumn + ` ` + order + `
-		LIMIT $1 OFFSET $2
-	`
+		WHERE ` + strings.Join(conds, " AND ") + `
+		ORDER BY ` + ks.orderBy() + fmt.Sprintf(`
+		LIMIT $%d OFFSET $%d
+	`, len(args)-1, len(args))
 
-	rows, err := q.query(query, params.Limit, params.Offset, organizationID)
+	rows, err := q.reader().QueryContext(q.ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -169,7 +276,9 @@ func (q *userQueries) ListUsers(params ListParams, organizationID string) (*List
 		// Handle nullable JSON strings
 		user.Attributes = "{}"
 		if attributes.Valid && attributes.String != "" {
-			user.Attributes = attributes.String
+			if user.Attributes, err = openAttributes(q.db, user.ID, attributes.String); err != nil {
+				return nil, err
+			}
 		}
 		user.Preferences = "{}"
 		if preferences.Valid && preferences.String != "" {
@@ -182,27 +291,45 @@ func (q *userQueries) ListUsers(params ListParams, organizationID string) (*List
 
 		users = append(users, user)
 	} // Get total count for pagination
-	countQuery := `SELECT COUNT(*) FROM users WHERE deleted_at IS NULL AND organization_id = $1`
+	countQuery := `SELECT COUNT(*) FROM users u WHERE ` + where
 	var total int64
-	err = q.queryRow(countQuery, organizationID).Scan(&total)
+	err = q.reader().QueryRowContext(q.ctx, countQuery, countArgs...).Scan(&total)
 	if err != nil {
 		return nil, err
 	}
 
 	// Calculate pagination metadata
 	totalPages := int((total + int64(params.Limit) - 1) / int64(params.Limit))
-	hasMore := params.Offset+params.Limit < int(total)
+	users, hasMore, nextCursor := page(ks, users, params.Limit, func(u models.User) (string, string) {
+		return userSortValue(u, sortBy), u.ID
+	})
 
 	return &ListResult[models.User]{
 		Items:      users,
 		Total:      total,
 		Limit:      params.Limit,
-		Offset:     params.Offset,
+		Offset:     ks.offset(params.Offset),
 		HasMore:    hasMore,
 		TotalPages: totalPages,
+		NextCursor: nextCursor,
 	}, nil
 }
 
+// userSortValue returns the keyset sort value of a user for the ListUsers sort keys
+func userSortValue(u models.User, sortBy string) string {
+	switch sortBy {
+	case "username":
+		return u.Username
+	case "email":
+		return u.Email
+	case "display_name":
+		return u.DisplayName
+	case "updated_at":
+		return cursorTime(u.UpdatedAt)
+	}
+	return cursorTime(u.CreatedAt)
+}
+
 func (q *userQueries) GetUser(id, organizationID string) (*models.User, error) {
 	query := `
 		SELECT
@@ -240,7 +367,9 @@ func (q *userQueries) GetUser(id, organizationID string) (*models.User, error) {
 	// Handle nullable JSON strings
 	user.Attributes = "{}"
 	if attributes.Valid && attributes.String != "" {
-		user.Attributes = attributes.String
+		if user.Attributes, err = openAttributes(q.db, user.ID, attributes.String); err != nil {
+			return nil, err
+		}
 	}
 	user.Preferences = "{}"
 	if preferences.Valid && preferences.String != "" {
@@ -277,16 +406,29 @@ func (q *userQueries) CreateUser(user *models.User) error {
 		// This would need proper JSON marshaling in a real implementation
 		mfaMethodsJSON = "[]"
 	}
-	attributesJSON := "{}"
-	preferencesJSON := "{}"
+	attributesJSON, err := utils.NormalizeJSONObject(user.Attributes)
+	if err != nil {
+		return fmt.Errorf("invalid attributes: %w", err)
+	}
+	preferencesJSON, err := utils.NormalizeJSONObject(user.Preferences)
+	if err != nil {
+		return fmt.Errorf("invalid preferences: %w", err)
+	}
+	if attributesJSON, err = sealAttributes(q.db, user.ID, attributesJSON); err != nil {
+		return err
+	}
 	var mfaBackupCodesStr *string
 	if user.MFABackupCodes != nil && len(user.MFABackupCodes) > 0 {
+		sealedCodes, err := sealBackupCodes(q.db, user.ID, user.MFABackupCodes)
+		if err != nil {
+			return err
+		}
 		// For now, store as simple string - proper JSON marshaling would be needed
-		codes := strings.Join(user.MFABackupCodes, ",")
+		codes := strings.Join(sealedCodes, ",")
 		mfaBackupCodesStr = &codes
 	}
 
-	_, err := q.exec(query,
+	_, err = q.exec(query,
 		user.ID, user.Username, user.Email, user.EmailVerified, user.DisplayName,
 		user.AvatarURL, user.OrganizationID, user.PasswordHash, user.PasswordChangedAt,
 		user.MFAEnabled, mfaMethodsJSON, mfaBackupCodesStr, attributesJSON, preferencesJSON,
@@ -324,20 +466,23 @@ func (q *userQueries) UpdateUser(user *models.User, organizationID string) error
 	// Since fields are now pointers in the model, we can pass them directly to the query
 
 	// Use the fields from the user model
-	attributesJSON := user.Attributes
-	if attributesJSON == "" {
-		attributesJSON = "{}"
+	attributesJSON, err := utils.NormalizeJSONObject(user.Attributes)
+	if err != nil {
+		return fmt.Errorf("invalid attributes: %w", err)
+	}
+	if attributesJSON, err = sealAttributes(q.db, user.ID, attributesJSON); err != nil {
+		return err
 	}
-	preferencesJSON := user.Preferences
-	if preferencesJSON == "" {
-		preferencesJSON = "{}"
+	preferencesJSON, err := utils.NormalizeJSONObject(user.Preferences)
+	if err != nil {
+		return fmt.Errorf("invalid preferences: %w", err)
 	}
 
 	// Placeholder for MFA fields (maintaining existing logic pattern)
 	mfaMethodsJSON := "{}"
 	MFABackupCodesJSON := "{}"
 
-	_, err := q.exec(query,
+	_, err = q.exec(query,
 		user.ID, user.Username, user.Email, user.EmailVerified, user.DisplayName,
 		user.AvatarURL, user.OrganizationID, user.PasswordHash, user.PasswordChangedAt,
 		user.MFAEnabled, mfaMethodsJSON, MFABackupCodesJSON, attributesJSON, preferencesJSON,
@@ -374,13 +519,239 @@ func (q *userQueries) DeleteUser(id, organizationID string) error {
 	return nil
 }
 
+// UsernameExists reports whether a non-deleted user of the organization
+// already uses the username
+func (q *userQueries) UsernameExists(username, organizationID string) (bool, error) {
+	var exists bool
+	err := q.queryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE username = $1 AND organization_id = $2 AND status != 'deleted')`,
+		username, organizationID).Scan(&exists)
+	return exists, err
+}
+
+// UsernameAvailable reports whether userID (empty for a new user) may take
+// the username: no other non-deleted user has it and it is not a username
+// another user renamed away from
+func (q *userQueries) UsernameAvailable(username, organizationID, userID string) (bool, error) {
+	var taken bool
+	err := q.queryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM users
+			WHERE organization_id = $1 AND username = $2 AND status != 'deleted' AND id::text != $3
+		) OR EXISTS(
+			SELECT 1 FROM username_aliases
+			WHERE organization_id = $1 AND username = $2 AND user_id::text != $3
+		)`, organizationID, username, userID).Scan(&taken)
+	return !taken, err
+}
+
+// ChangeUsername renames a user and returns the previous username, which is
+// kept as an alias of the user. Renaming back to one of the user's own
+// aliases releases that alias.
+func (q *userQueries) ChangeUsername(userID, organizationID, username string) (string, error) {
+	query := `
+		WITH previous AS (
+			SELECT id, organization_id, username FROM users
+			WHERE id = $1 AND organization_id = $2 AND status != 'deleted'
+			FOR UPDATE
+		), reclaimed AS (
+			DELETE FROM username_aliases a USING previous p
+			WHERE a.organization_id = p.organization_id AND a.username = $3 AND a.user_id = p.id
+		), retired AS (
+			INSERT INTO username_aliases (organization_id, username, user_id)
+			SELECT organization_id, username, id FROM previous
+			ON CONFLICT (organization_id, username) DO UPDATE SET user_id = EXCLUDED.user_id, created_at = NOW()
+		)
+		UPDATE users u SET username = $3, updated_at = NOW()
+		FROM previous p
+		WHERE u.id = p.id
+		RETURNING p.username
+	`
+	var previous string
+	if err := q.queryRow(query, userID, organizationID, username).Scan(&previous); err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("user not found")
+		}
+		return "", err
+	}
+	return previous, nil
+}
+
+// LastUsernameChange returns when the user was last renamed, or nil if never
+func (q *userQueries) LastUsernameChange(userID, organizationID string) (*time.Time, error) {
+	var changed sql.NullTime
+	err := q.queryRow(`SELECT MAX(created_at) FROM username_aliases WHERE user_id = $1 AND organization_id = $2`,
+		userID, organizationID).Scan(&changed)
+	if err != nil || !changed.Valid {
+		return nil, err
+	}
+	return &changed.Time, nil
+}
+
+// ResolveUsername finds the non-deleted user known by the username, either
+// as their current username or as one they renamed away from, and returns
+// their ID and current username
+func (q *userQueries) ResolveUsername(username, organizationID string) (string, string, error) {
+	query := `
+		SELECT id, username FROM (
+			SELECT id, username, 0 AS rank FROM users
+			WHERE organization_id = $1 AND username = $2 AND status != 'deleted'
+			UNION ALL
+			SELECT u.id, u.username, 1 AS rank FROM username_aliases a
+			JOIN users u ON u.id = a.user_id
+			WHERE a.organization_id = $1 AND a.username = $2 AND u.status != 'deleted'
+		) matches
+		ORDER BY rank
+		LIMIT 1
+	`
+	var userID, current string
+	if err := q.reader().QueryRowContext(q.ctx, query, organizationID, username).Scan(&userID, &current); err != nil {
+		if err == sql.ErrNoRows {
+			return "", "", fmt.Errorf("user not found")
+		}
+		return "", "", err
+	}
+	return userID, current, nil
+}
+
+// RestoreUser reverses a soft delete. Users whose PII has already been purged
+// cannot be restored.
+func (q *userQueries) RestoreUser(id, organizationID string) error {
+	query := `
+		UPDATE users SET
+			status = 'active',
+			deleted_at = NULL,
+			updated_at = NOW()
+		WHERE id = $1 AND organization_id = $2 AND status = 'deleted' AND purged_at IS NULL
+	`
+
+	result, err := q.exec(query, id, organizationID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("user not found, not deleted, or already purged")
+	}
+
+	return nil
+}
+
+// anonymizeUserColumns scrubs every piece of PII held on a user row. The
+// synthetic username and email keep the row valid under the table constraints.
+const anonymizeUserColumns = `
+	username = 'purged-' || id,
+	email = 'purged-' || id || '@purged.invalid',
+	email_verified = FALSE,
+	display_name = NULL,
+	avatar_url = NULL,
+	password_hash = NULL,
+	totp_secret = NULL,
+	mfa_enabled = FALSE,
+	mfa_backup_codes = NULL,
+	attributes = '{}',
+	preferences = '{}',
+	last_login = NULL,
+	purged_at = NOW(),
+	updated_at = NOW()`
+
+// PurgeUser irreversibly anonymizes a soft-deleted user and removes their
+// sessions, which carry IP addresses and user agents.
+func (q *userQueries) PurgeUser(id, organizationID string) error {
+	query := `
+		WITH purged AS (
+			UPDATE users SET ` + anonymizeUserColumns + `
+			WHERE id = $1 AND organization_id = $2 AND status = 'deleted' AND purged_at IS NULL
+			RETURNING id
+		), removed_sessions AS (
+			DELETE FROM sessions s USING purged p
+			WHERE s.principal_id = p.id AND s.principal_type = 'user'
+		), removed_aliases AS (
+			DELETE FROM username_aliases a USING purged p
+			WHERE a.user_id = p.id
+		), removed_bookmarks AS (
+			DELETE FROM content_bookmarks b USING purged p
+			WHERE b.user_id = p.id
+		)
+		SELECT COUNT(*) FROM purged
+	`
+
+	var purged int
+	if err := q.queryRow(query, id, organizationID).Scan(&purged); err != nil {
+		return err
+	}
+	if purged == 0 {
+		return fmt.Errorf("user not found, not deleted, or already purged")
+	}
+
+	return nil
+}
+
+// PurgeDeletedUsers anonymizes every user soft-deleted before the given time
+// and returns how many were purged.
+func (q *userQueries) PurgeDeletedUsers(deletedBefore time.Time) (int, error) {
+	query := `
+		WITH purged AS (
+			UPDATE users SET ` + anonymizeUserColumns + `
+			WHERE status = 'deleted' AND purged_at IS NULL AND deleted_at < $1
+			RETURNING id
+		), removed_sessions AS (
+			DELETE FROM sessions s USING purged p
+			WHERE s.principal_id = p.id AND s.principal_type = 'user'
+		), removed_aliases AS (
+			DELETE FROM username_aliases a USING purged p
+			WHERE a.user_id = p.id
+		), removed_bookmarks AS (
+			DELETE FROM content_bookmarks b USING purged p
+			WHERE b.user_id = p.id
+		)
+		SELECT COUNT(*) FROM purged
+	`
+
+	var purged int
+	if err := q.queryRow(query, deletedBefore).Scan(&purged); err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// CountPasswordHashSchemes counts the password hashes of the users that are
+// not deleted by their leading algorithm and parameters, e.g. "$2a$10$" or
+// "$argon2id$v=19$m=65536,t=3,p=2$"
+func (q *userQueries) CountPasswordHashSchemes() (map[string]int, error) {
+	query := `
+		SELECT COALESCE(substring(password_hash from '^\$[^$]+\$[^$]+\$(?:[^$]+\$)?'), ''), COUNT(*)
+		FROM users
+		WHERE deleted_at IS NULL AND COALESCE(password_hash, '') <> ''
+		GROUP BY 1`
+	rows, err := q.reader().QueryContext(q.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var scheme string
+		var n int
+		if err := rows.Scan(&scheme, &n); err != nil {
+			return nil, err
+		}
+		counts[scheme] = n
+	}
+	return counts, rows.Err()
+}
+
 func (q *userQueries) GetUserProfile(userID, organizationID string) (*models.User, error) {
 	// For now, profile is the same as user data but without sensitive fields
 	// This can be extended later to include additional profile-specific data
 	return q.GetUser(userID, organizationID)
 }
 
-func (q *userQueries) UpdateUserProfile(userID string, updates map[string]interface{}) error {
+func (q *userQueries) UpdateUserProfile(userID, organizationID string, updates map[string]interface{}) error {
 	if len(updates) == 0 {
 		return nil
 	}
@@ -391,14 +762,21 @@ func (q *userQueries) UpdateUserProfile(userID string, updates map[string]interf
 	paramIdx := 1
 
 	for key, value := range updates {
+		if doc, ok := value.(string); ok && key == "attributes" {
+			sealed, err := sealAttributes(q.db, userID, doc)
+			if err != nil {
+				return err
+			}
+			value = sealed
+		}
 		setClauses = append(setClauses, fmt.Sprintf("%s = $%d", key, paramIdx))
 		args = append(args, value)
 		paramIdx++
 	}
 
-	query := fmt.Sprintf("UPDATE users SET %s WHERE id = $%d AND deleted_at IS NULL",
-		strings.Join(setClauses, ", "), paramIdx)
-	args = append(args, userID)
+	query := fmt.Sprintf("UPDATE users SET %s WHERE id = $%d AND organization_id = $%d AND deleted_at IS NULL",
+		strings.Join(setClauses, ", "), paramIdx, paramIdx+1)
+	args = append(args, userID, organizationID)
 
 	result, err := q.exec(query, args...)
 	if err != nil {
@@ -416,6 +794,44 @@ func (q *userQueries) UpdateUserProfile(userID string, updates map[string]interf
 	return nil
 }
 
+// UpdateUserAttributes replaces the attributes document of a user
+func (q *userQueries) UpdateUserAttributes(userID, organizationID, attributes string) error {
+	return q.updateUserJSONColumn("attributes", userID, organizationID, attributes)
+}
+
+// UpdateUserPreferences replaces the preferences document of a user
+func (q *userQueries) UpdateUserPreferences(userID, organizationID, preferences string) error {
+	return q.updateUserJSONColumn("preferences", userID, organizationID, preferences)
+}
+
+func (q *userQueries) updateUserJSONColumn(column, userID, organizationID, value string) error {
+	doc, err := utils.NormalizeJSONObject(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", column, err)
+	}
+	if column == "attributes" {
+		if doc, err = sealAttributes(q.db, userID, doc); err != nil {
+			return err
+		}
+	}
+
+	query := fmt.Sprintf(`UPDATE users SET %s = $1::jsonb, updated_at = NOW()
+		WHERE id = $2 AND organization_id = $3 AND deleted_at IS NULL`, column)
+	result, err := q.exec(query, doc, userID, organizationID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
 func (q *userQueries) SuspendUser(userID, organizationID, reason string) error {
 	query := `
 		UPDATE users SET
@@ -445,6 +861,7 @@ func (q *userQueries) ActivateUser(userID, organizationID string) error {
 		UPDATE users SET
 			status = 'active',
 			attributes = attributes - 'suspension_reason',
+			dormant_since = NULL,
 			updated_at = NOW()
 		WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL
 	`
@@ -464,13 +881,17 @@ func (q *userQueries) ActivateUser(userID, organizationID string) error {
 	return nil
 }
 
+// GetUserSessions returns the unexpired active sessions of a user, most
+// recently used first
 func (q *userQueries) GetUserSessions(userID, organizationID string) ([]models.Session, error) {
 	query := `
-		SELECT id, session_token, principal_id, principal_type, organization_id, 
-		       assumed_role_id, mfa_verified, ip_address, user_agent, 
-		       issued_at, expires_at, status
-		FROM sessions 
-		WHERE principal_id = $1 AND principal_type = 'user' AND organization_id = $2 AND status = 'active'
+		SELECT id, principal_id, principal_type, organization_id,
+		       assumed_role_id, mfa_verified, ip_address, user_agent, device_fingerprint,
+		       COALESCE(location::text, '{}'), issued_at, expires_at, COALESCE(last_used_at, issued_at), status
+		FROM sessions
+		WHERE principal_id = $1 AND principal_type = 'user' AND organization_id = $2
+		  AND status = 'active' AND expires_at > NOW()
+		ORDER BY COALESCE(last_used_at, issued_at) DESC
 	`
 	rows, err := q.query(query, userID, organizationID)
 	if err != nil {
@@ -482,9 +903,9 @@ func (q *userQueries) GetUserSessions(userID, organizationID string) ([]models.S
 	for rows.Next() {
 		var s models.Session
 		err := rows.Scan(
-			&s.ID, &s.SessionToken, &s.PrincipalID, &s.PrincipalType, &s.OrganizationID,
-			&s.AssumedRoleID, &s.MFAVerified, &s.IPAddress, &s.UserAgent,
-			&s.IssuedAt, &s.ExpiresAt, &s.Status,
+			&s.ID, &s.PrincipalID, &s.PrincipalType, &s.OrganizationID,
+			&s.AssumedRoleID, &s.MFAVerified, &s.IPAddress, &s.UserAgent, &s.DeviceFingerprint,
+			&s.Location, &s.IssuedAt, &s.ExpiresAt, &s.LastUsedAt, &s.Status,
 		)
 		if err != nil {
 			return nil, err
@@ -492,26 +913,83 @@ func (q *userQueries) GetUserSessions(userID, organizationID string) ([]models.S
 
 		sessions = append(sessions, s)
 	}
-	return sessions, nil
+	return sessions, rows.Err()
 }
 
+// RevokeUserSessions revokes every active session of a user and blacklists
+// their access tokens so they stop working immediately
 func (q *userQueries) RevokeUserSessions(userID, organizationID string) error {
-	query := `UPDATE sessions SET status = 'revoked' WHERE principal_id = $1 AND principal_type = 'user' AND organization_id = $2 AND status = 'active'`
-	_, err := q.exec(query, userID, organizationID)
+	query := `UPDATE sessions SET status = 'revoked' WHERE principal_id = $1 AND principal_type = 'user' AND organization_id = $2 AND status = 'active' RETURNING id, expires_at`
+	return q.revokeSessions(query, userID, organizationID)
+}
+
+// RevokeUserSession revokes one active session of a user
+func (q *userQueries) RevokeUserSession(userID, organizationID, sessionID string) error {
+	query := `UPDATE sessions SET status = 'revoked' WHERE principal_id = $1 AND principal_type = 'user' AND organization_id = $2 AND id = $3 AND status = 'active' RETURNING id, expires_at`
+	n, err := q.revokeSessionsCount(query, userID, organizationID, sessionID)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("session not found")
+	}
+	return nil
+}
+
+func (q *userQueries) revokeSessions(query string, args ...interface{}) error {
+	_, err := q.revokeSessionsCount(query, args...)
 	return err
 }
 
+// revokeSessionsCount runs an UPDATE ... RETURNING id, expires_at on sessions
+// and blacklists each returned session ID, which is the access token's jti
+func (q *userQueries) revokeSessionsCount(query string, args ...interface{}) (int, error) {
+	rows, err := q.query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var id string
+		var expiresAt time.Time
+		if err := rows.Scan(&id, &expiresAt); err != nil {
+			return n, err
+		}
+		n++
+		if ttl := time.Until(expiresAt); ttl > 0 {
+			if err := q.redis.Set(q.ctx, "blacklist:"+id, "revoked", ttl).Err(); err != nil {
+				return n, fmt.Errorf("failed to blacklist session %s: %w", id, err)
+			}
+		}
+	}
+	return n, rows.Err()
+}
+
 func (q *userQueries) ListServiceAccounts(params ListParams, organizationID string) (*ListResult[models.ServiceAccount], error) {
+	ks, err := newKeyset(params, "created_at", "created_at", "id", "DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{ks.limit(params.Limit), ks.offset(params.Offset), organizationID}
+	after := ""
+	if clause, cursorArgs := ks.where(4); clause != "" {
+		after = " AND " + clause
+		args = append(args, cursorArgs...)
+	}
+
 	query := `
 		SELECT id, name, description, organization_id, key_rotation_policy, 
 		       allowed_ip_ranges, max_token_lifetime, last_key_rotation, attributes, 
 		       status, created_at, updated_at, deleted_at
 		FROM service_accounts 
-		WHERE organization_id = $3 AND deleted_at IS NULL
-		ORDER BY created_at DESC
+		WHERE organization_id = $3 AND deleted_at IS NULL` + after + `
+		ORDER BY ` + ks.orderBy() + `
 		LIMIT $1 OFFSET $2
 	`
-	rows, err := q.query(query, params.Limit, params.Offset, organizationID)
+	rows, err := q.query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -549,12 +1027,17 @@ func (q *userQueries) ListServiceAccounts(params ListParams, organizationID stri
 		return nil, err
 	}
 
+	sas, hasMore, nextCursor := page(ks, sas, params.Limit, func(sa models.ServiceAccount) (string, string) {
+		return cursorTime(sa.CreatedAt), sa.ID
+	})
+
 	return &ListResult[models.ServiceAccount]{
-		Items:   sas,
-		Total:   total,
-		Limit:   params.Limit,
-		Offset:  params.Offset,
-		HasMore: params.Offset+len(sas) < int(total),
+		Items:      sas,
+		Total:      total,
+		Limit:      params.Limit,
+		Offset:     ks.offset(params.Offset),
+		HasMore:    hasMore,
+		NextCursor: nextCursor,
 	}, nil
 }
 
@@ -705,6 +1188,52 @@ func (q *userQueries) RevokeAPIKey(saID, keyID, organizationID string) error {
 	return err
 }
 
+// GetActiveAPIKeyByKeyID looks up an active, unexpired API key by its public
+// key ID, including the secret hash, for authentication
+func (q *userQueries) GetActiveAPIKeyByKeyID(keyID string) (*models.APIKey, error) {
+	query := `
+		SELECT k.id, k.name, k.key_id, k.key_hash, k.service_account_id, k.organization_id,
+		       k.scopes, k.allowed_ip_ranges, k.rate_limit_per_hour, k.expires_at, k.status
+		FROM api_keys k
+		JOIN service_accounts sa ON sa.id = k.service_account_id
+		WHERE k.key_id = $1 AND k.status = 'active' AND k.expires_at > NOW()
+		  AND sa.status = 'active'
+	`
+	var key models.APIKey
+	err := q.queryRow(query, keyID).Scan(
+		&key.ID, &key.Name, &key.KeyID, &key.KeyHash, &key.ServiceAccountID, &key.OrganizationID,
+		pq.Array(&key.Scopes), pq.Array(&key.AllowedIPRanges), &key.RateLimitPerHour, &key.ExpiresAt, &key.Status,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("api key not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// RecordAPIKeyUse bumps the usage counter and last-used timestamp of an API
+// key, and the daily API key requests of its organization
+func (q *userQueries) RecordAPIKeyUse(id string) error {
+	var organizationID string
+	err := q.queryRow(`UPDATE api_keys SET last_used_at = NOW(), usage_count = usage_count + 1 WHERE id = $1 RETURNING organization_id`, id).Scan(&organizationID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if q.redis != nil {
+		key := apiKeyStatsKey(time.Now().UTC())
+		pipe := q.redis.Pipeline()
+		pipe.HIncrBy(q.ctx, key, organizationID, 1)
+		pipe.Expire(q.ctx, key, statsCounterRetention)
+		pipe.Exec(q.ctx)
+	}
+	return nil
+}
+
 func (q *userQueries) RotateServiceAccountKeys(saID, organizationID string) error {
 	// Revoke all existing keys and update last_key_rotation
 	tx, err := q.db.Begin()
@@ -0,0 +1,175 @@
+package queries
+
+import (
+	"fmt"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// ListSimilarUsernames returns pairs of non-deleted users of the organization
+// whose usernames have a trigram similarity of at least minSimilarity, the
+// most similar first
+func (q *userQueries) ListSimilarUsernames(organizationID string, minSimilarity float64, limit int) ([]models.SimilarUsernames, error) {
+	query := `
+		SELECT a.id, b.id, similarity(a.username, b.username) AS score
+		FROM users a
+		JOIN users b ON b.organization_id = a.organization_id AND a.id < b.id AND a.username % b.username
+		WHERE a.organization_id = $1 AND a.deleted_at IS NULL AND b.deleted_at IS NULL
+		  AND similarity(a.username, b.username) >= $2
+		ORDER BY score DESC, a.id, b.id
+		LIMIT $3
+	`
+	rows, err := q.query(query, organizationID, minSimilarity, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list similar usernames: %w", err)
+	}
+	defer rows.Close()
+
+	pairs := []models.SimilarUsernames{}
+	for rows.Next() {
+		var p models.SimilarUsernames
+		if err := rows.Scan(&p.UserIDs[0], &p.UserIDs[1], &p.Similarity); err != nil {
+			return nil, fmt.Errorf("failed to scan similar usernames: %w", err)
+		}
+		pairs = append(pairs, p)
+	}
+	return pairs, rows.Err()
+}
+
+// MergeUsers folds the source user into the target user and soft-deletes the
+// source. The target takes over the source's role assignments and group
+// memberships (keeping the later expiry where both had one), the content it
+// owns or collaborates on, its sessions, which are revoked first, and its
+// usernames, which become aliases of the target. It must run in a
+// transaction.
+func (q *userQueries) MergeUsers(sourceID, targetID, organizationID string) (*models.UserMerge, error) {
+	rows, err := q.query(`
+		SELECT id FROM users
+		WHERE id IN ($1, $2) AND organization_id = $3 AND deleted_at IS NULL
+		ORDER BY id
+		FOR UPDATE`, sourceID, targetID, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock users: %w", err)
+	}
+	locked := 0
+	for rows.Next() {
+		locked++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to lock users: %w", err)
+	}
+	if locked != 2 {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	merge := &models.UserMerge{SourceUserID: sourceID, TargetUserID: targetID}
+
+	// Both users are known to belong to the organization, so statements on
+	// tables without an organization_id are keyed on them alone
+	merge.RoleAssignments, err = q.mergePrincipalRows("role_assignments", "role_id", sourceID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	merge.GroupMemberships, err = q.mergePrincipalRows("group_memberships", "group_id", sourceID, targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := q.exec(`UPDATE content_items SET owner_id = $2, updated_at = NOW() WHERE owner_id = $1 AND organization_id = $3`,
+		sourceID, targetID, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move content: %w", err)
+	}
+	merge.ContentItems, _ = result.RowsAffected()
+
+	if _, err := q.exec(`
+		UPDATE content_collaborators t SET role = 'owner'
+		FROM content_collaborators s
+		WHERE s.user_id = $1 AND s.role = 'owner' AND t.user_id = $2 AND t.content_id = s.content_id`,
+		sourceID, targetID); err != nil {
+		return nil, fmt.Errorf("failed to merge collaborations: %w", err)
+	}
+	result, err = q.exec(`
+		DELETE FROM content_collaborators s
+		USING content_collaborators t
+		WHERE s.user_id = $1 AND t.user_id = $2 AND t.content_id = s.content_id`,
+		sourceID, targetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge collaborations: %w", err)
+	}
+	merge.Collaborations, _ = result.RowsAffected()
+	result, err = q.exec(`UPDATE content_collaborators SET user_id = $2 WHERE user_id = $1`, sourceID, targetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move collaborations: %w", err)
+	}
+	moved, _ := result.RowsAffected()
+	merge.Collaborations += moved
+
+	merge.RevokedSessions, err = q.revokeSessionsCount(`
+		UPDATE sessions SET status = 'revoked'
+		WHERE principal_id = $1 AND principal_type = 'user' AND organization_id = $2 AND status = 'active'
+		RETURNING id, expires_at`, sourceID, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	result, err = q.exec(`UPDATE sessions SET principal_id = $2 WHERE principal_id = $1 AND principal_type = 'user' AND organization_id = $3`,
+		sourceID, targetID, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move sessions: %w", err)
+	}
+	merge.Sessions, _ = result.RowsAffected()
+
+	if _, err := q.exec(`
+		WITH source AS (
+			SELECT organization_id, username FROM users WHERE id = $1 AND organization_id = $3
+		), moved AS (
+			UPDATE username_aliases SET user_id = $2 WHERE user_id = $1 AND organization_id = $3
+		)
+		INSERT INTO username_aliases (organization_id, username, user_id)
+		SELECT organization_id, username, $2 FROM source
+		ON CONFLICT (organization_id, username) DO UPDATE SET user_id = EXCLUDED.user_id, created_at = NOW()`,
+		sourceID, targetID, organizationID); err != nil {
+		return nil, fmt.Errorf("failed to move usernames: %w", err)
+	}
+
+	if err := q.DeleteUser(sourceID, organizationID); err != nil {
+		return nil, fmt.Errorf("failed to delete merged user: %w", err)
+	}
+	invalidatePrimaryRoles(q.ctx, q.redis, q.tx, organizationID, sourceID, targetID)
+	return merge, nil
+}
+
+// mergePrincipalRows hands the source user's rows of a role_assignments-like
+// table to the target. Where both have a row for the same key the target's
+// keeps the later expiry (none beats any) and the source's is dropped. It
+// returns how many of the source's rows were carried over.
+func (q *userQueries) mergePrincipalRows(table, key, sourceID, targetID string) (int64, error) {
+	if _, err := q.exec(`
+		UPDATE `+table+` t SET expires_at = CASE
+			WHEN t.expires_at IS NULL OR s.expires_at IS NULL THEN NULL
+			ELSE GREATEST(t.expires_at, s.expires_at) END
+		FROM `+table+` s
+		WHERE s.principal_id = $1 AND s.principal_type = 'user'
+		  AND t.principal_id = $2 AND t.principal_type = 'user' AND t.`+key+` = s.`+key,
+		sourceID, targetID); err != nil {
+		return 0, fmt.Errorf("failed to merge %s: %w", table, err)
+	}
+	result, err := q.exec(`
+		DELETE FROM `+table+` s
+		USING `+table+` t
+		WHERE s.principal_id = $1 AND s.principal_type = 'user'
+		  AND t.principal_id = $2 AND t.principal_type = 'user' AND t.`+key+` = s.`+key,
+		sourceID, targetID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to merge %s: %w", table, err)
+	}
+	merged, _ := result.RowsAffected()
+	result, err = q.exec(`UPDATE `+table+` SET principal_id = $2 WHERE principal_id = $1 AND principal_type = 'user'`,
+		sourceID, targetID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to move %s: %w", table, err)
+	}
+	moved, _ := result.RowsAffected()
+	return merged + moved, nil
+}
@@ -0,0 +1,271 @@
+package queries
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/the-monkeys/monkeys-identity/internal/database"
+	"github.com/the-monkeys/monkeys-identity/internal/encryption"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// The additional data of an encrypted user field names the column and the
+// user, so a value copied to another column or user does not decrypt
+
+func totpSecretAAD(userID string) string { return "users.totp_secret:" + userID }
+
+func backupCodesAAD(userID string) string { return "users.mfa_backup_codes:" + userID }
+
+func attributeAAD(userID, name string) string { return "users.attributes." + name + ":" + userID }
+
+// sealBackupCodes encrypts each backup code of a user
+func sealBackupCodes(db *database.DB, userID string, codes []string) ([]string, error) {
+	if codes == nil {
+		return nil, nil
+	}
+	sealed := make([]string, len(codes))
+	for i, code := range codes {
+		var err error
+		if sealed[i], err = db.EncryptField(code, backupCodesAAD(userID)); err != nil {
+			return nil, err
+		}
+	}
+	return sealed, nil
+}
+
+func openBackupCodes(db *database.DB, userID string, codes []string) ([]string, error) {
+	if !db.FieldEncryption() || codes == nil {
+		return codes, nil
+	}
+	opened := make([]string, len(codes))
+	for i, code := range codes {
+		var err error
+		if opened[i], err = db.DecryptField(code, backupCodesAAD(userID)); err != nil {
+			return nil, err
+		}
+	}
+	return opened, nil
+}
+
+// sealAttributes encrypts the configured attributes of an attributes
+// document. An encrypted attribute is stored as a string holding the sealed
+// JSON of its value.
+func sealAttributes(db *database.DB, userID, doc string) (string, error) {
+	if !db.FieldEncryption() || doc == "" {
+		return doc, nil
+	}
+	var attrs map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(doc), &attrs); err != nil {
+		return "", fmt.Errorf("invalid attributes: %w", err)
+	}
+	changed := false
+	for name, value := range attrs {
+		if !db.EncryptedAttribute(name) || sealedAttribute(value) != "" {
+			continue
+		}
+		sealed, err := db.EncryptField(string(value), attributeAAD(userID, name))
+		if err != nil {
+			return "", err
+		}
+		attrs[name], _ = json.Marshal(sealed)
+		changed = true
+	}
+	if !changed {
+		return doc, nil
+	}
+	out, err := json.Marshal(attrs)
+	return string(out), err
+}
+
+// openAttributes decrypts the encrypted attributes of an attributes document
+func openAttributes(db *database.DB, userID, doc string) (string, error) {
+	if !db.FieldEncryption() || !strings.Contains(doc, encryption.Prefix) {
+		return doc, nil
+	}
+	var attrs map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(doc), &attrs); err != nil {
+		return doc, nil
+	}
+	for name, value := range attrs {
+		sealed := sealedAttribute(value)
+		if sealed == "" {
+			continue
+		}
+		opened, err := db.DecryptField(sealed, attributeAAD(userID, name))
+		if err != nil {
+			return "", fmt.Errorf("failed to decrypt attribute %s: %w", name, err)
+		}
+		attrs[name] = json.RawMessage(opened)
+	}
+	out, err := json.Marshal(attrs)
+	return string(out), err
+}
+
+// reencryptAttributes seals the configured attributes with the current key
+// and decrypts attributes that are no longer configured to be encrypted. It
+// reports whether the document changed.
+func reencryptAttributes(db *database.DB, userID, doc string) (string, bool, error) {
+	var attrs map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(doc), &attrs); err != nil {
+		return doc, false, nil
+	}
+	changed := false
+	for name, value := range attrs {
+		aad := attributeAAD(userID, name)
+		sealed := sealedAttribute(value)
+		switch {
+		case sealed != "" && db.EncryptedAttribute(name):
+			resealed, rotated, err := db.ReencryptField(sealed, aad)
+			if err != nil {
+				return "", false, fmt.Errorf("attribute %s: %w", name, err)
+			}
+			if !rotated {
+				continue
+			}
+			attrs[name], _ = json.Marshal(resealed)
+		case sealed != "":
+			opened, err := db.DecryptField(sealed, aad)
+			if err != nil {
+				return "", false, fmt.Errorf("attribute %s: %w", name, err)
+			}
+			attrs[name] = json.RawMessage(opened)
+		case db.EncryptedAttribute(name):
+			resealed, err := db.EncryptField(string(value), aad)
+			if err != nil {
+				return "", false, fmt.Errorf("attribute %s: %w", name, err)
+			}
+			attrs[name], _ = json.Marshal(resealed)
+		default:
+			continue
+		}
+		changed = true
+	}
+	if !changed {
+		return doc, false, nil
+	}
+	out, err := json.Marshal(attrs)
+	return string(out), true, err
+}
+
+// sealedAttribute returns the encrypted value an attribute holds, or "" for
+// a plain attribute
+func sealedAttribute(value json.RawMessage) string {
+	var s string
+	if json.Unmarshal(value, &s) != nil || !strings.HasPrefix(s, encryption.Prefix) {
+		return ""
+	}
+	return s
+}
+
+// openUserSecrets decrypts the encrypted fields of a user read from the
+// database
+func openUserSecrets(db *database.DB, user *models.User) error {
+	var err error
+	if user.TOTPSecret, err = db.DecryptField(user.TOTPSecret, totpSecretAAD(user.ID)); err != nil {
+		return fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+	}
+	if user.MFABackupCodes, err = openBackupCodes(db, user.ID, user.MFABackupCodes); err != nil {
+		return fmt.Errorf("failed to decrypt backup codes: %w", err)
+	}
+	if user.Attributes, err = openAttributes(db, user.ID, user.Attributes); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReencryptUserSecrets seals the encrypted fields of up to limit users after
+// afterID, in ID order, with the current data key. It returns the ID to
+// continue from, empty once every user has been visited, and how many users
+// it updated.
+func (q *userQueries) ReencryptUserSecrets(afterID string, limit int) (string, int, error) {
+	query := `
+		SELECT id, totp_secret, mfa_backup_codes, attributes::text
+		FROM users
+		WHERE ($1 = '' OR id > $1::uuid)
+		  AND (totp_secret IS NOT NULL OR mfa_backup_codes IS NOT NULL OR attributes IS NOT NULL)
+		ORDER BY id
+		LIMIT $2`
+	rows, err := q.query(query, afterID, limit)
+	if err != nil {
+		return "", 0, err
+	}
+	type stored struct {
+		id          string
+		totpSecret  sql.NullString
+		backupCodes database.StringArray
+		attributes  sql.NullString
+	}
+	var users []stored
+	for rows.Next() {
+		var u stored
+		if err := rows.Scan(&u.id, &u.totpSecret, &u.backupCodes, &u.attributes); err != nil {
+			rows.Close()
+			return "", 0, err
+		}
+		users = append(users, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", 0, err
+	}
+
+	updated := 0
+	for _, u := range users {
+		secret, secretChanged, err := q.db.ReencryptField(u.totpSecret.String, totpSecretAAD(u.id))
+		if err != nil {
+			return "", updated, fmt.Errorf("user %s TOTP secret: %w", u.id, err)
+		}
+		var codes database.StringArray
+		codesChanged := false
+		if u.backupCodes != nil {
+			codes = make(database.StringArray, len(u.backupCodes))
+			for i, code := range u.backupCodes {
+				var changed bool
+				if codes[i], changed, err = q.db.ReencryptField(code, backupCodesAAD(u.id)); err != nil {
+					return "", updated, fmt.Errorf("user %s backup codes: %w", u.id, err)
+				}
+				codesChanged = codesChanged || changed
+			}
+		}
+		attributes, attributesChanged := u.attributes.String, false
+		if u.attributes.Valid {
+			if attributes, attributesChanged, err = reencryptAttributes(q.db, u.id, u.attributes.String); err != nil {
+				return "", updated, fmt.Errorf("user %s: %w", u.id, err)
+			}
+		}
+		if !secretChanged && !codesChanged && !attributesChanged {
+			continue
+		}
+
+		// Only write over the values that were read, so a concurrent change
+		// such as a used backup code is not undone
+		result, err := q.exec(`
+			UPDATE users SET totp_secret = NULLIF($2, ''), mfa_backup_codes = $3, attributes = $4::jsonb
+			WHERE id = $1
+			  AND totp_secret IS NOT DISTINCT FROM $5
+			  AND mfa_backup_codes IS NOT DISTINCT FROM $6::text[]
+			  AND attributes::text IS NOT DISTINCT FROM $7`,
+			u.id, secret, codes, nullIfInvalid(attributes, u.attributes.Valid),
+			u.totpSecret, u.backupCodes, u.attributes)
+		if err != nil {
+			return "", updated, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			updated++
+		}
+	}
+
+	if len(users) < limit {
+		return "", updated, nil
+	}
+	return users[len(users)-1].id, updated, nil
+}
+
+func nullIfInvalid(value string, valid bool) interface{} {
+	if !valid {
+		return nil
+	}
+	return value
+}
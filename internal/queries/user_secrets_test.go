@@ -0,0 +1,106 @@
+package queries
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/the-monkeys/monkeys-identity/internal/encryption"
+)
+
+// testCipher seals values reversibly under a named key, checking the
+// additional data like the real cipher does
+type testCipher struct{ key string }
+
+func (c *testCipher) Encrypt(plaintext, aad string) (string, error) {
+	return encryption.Prefix + c.key + ":" + base64.RawURLEncoding.EncodeToString([]byte(aad+"|"+plaintext)), nil
+}
+
+func (c *testCipher) Decrypt(value, aad string) (string, error) {
+	if !strings.HasPrefix(value, encryption.Prefix) {
+		return value, nil
+	}
+	_, encoded, _ := strings.Cut(strings.TrimPrefix(value, encryption.Prefix), ":")
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	gotAAD, plaintext, _ := strings.Cut(string(raw), "|")
+	if gotAAD != aad {
+		return "", errors.New("additional data mismatch")
+	}
+	return plaintext, nil
+}
+
+func (c *testCipher) Current(value string) bool {
+	id, ok := encryption.KeyID(value)
+	return ok && id == c.key
+}
+
+func TestUserSecretsAreSealed(t *testing.T) {
+	db, rec := newRecorderDB(t)
+	cipher := &testCipher{key: "k1"}
+	db.SetFieldCipher(cipher, []string{"ssn"})
+
+	if err := NewAuthQueries(db, nil).EnableMFA("user-1", "org-a", "totp", "JBSWY3DPEHPK3PXP", "", []string{"code-1", "code-2"}); err != nil {
+		t.Fatalf("EnableMFA: %v", err)
+	}
+	stmt := rec.last(t)
+	secret, codes := stmt.args[1].(string), stmt.args[3].(string)
+	if strings.Contains(secret, "JBSWY3DPEHPK3PXP") || !strings.HasPrefix(secret, encryption.Prefix) {
+		t.Errorf("TOTP secret stored as %q", secret)
+	}
+	if strings.Contains(codes, "code-1") || strings.Count(codes, encryption.Prefix) != 2 {
+		t.Errorf("backup codes stored as %q", codes)
+	}
+	if plain, _ := db.DecryptField(secret, totpSecretAAD("user-1")); plain != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("stored TOTP secret decrypts to %q", plain)
+	}
+
+	NewUserQueries(db, nil).UpdateUserAttributes("user-1", "org-a", `{"ssn": "123-45-6789", "team": "blue"}`)
+	doc := rec.last(t).args[0].(string)
+	if strings.Contains(doc, "123-45-6789") || !strings.Contains(doc, `"team":"blue"`) {
+		t.Fatalf("attributes stored as %s", doc)
+	}
+
+	opened, err := openAttributes(db, "user-1", doc)
+	if err != nil {
+		t.Fatalf("openAttributes: %v", err)
+	}
+	var attrs map[string]string
+	json.Unmarshal([]byte(opened), &attrs)
+	if attrs["ssn"] != "123-45-6789" || attrs["team"] != "blue" {
+		t.Errorf("opened attributes = %s", opened)
+	}
+	if _, err := openAttributes(db, "user-2", doc); err == nil {
+		t.Error("attributes of one user decrypted for another")
+	}
+}
+
+func TestReencryptAttributes(t *testing.T) {
+	db, _ := newRecorderDB(t)
+	db.SetFieldCipher(&testCipher{key: "k1"}, []string{"ssn", "salary"})
+	doc, _ := sealAttributes(db, "user-1", `{"ssn": "123", "salary": 100, "team": "blue"}`)
+
+	if _, changed, _ := reencryptAttributes(db, "user-1", doc); changed {
+		t.Error("attributes sealed with the current key were changed")
+	}
+
+	// After rotating the key and no longer encrypting salary, ssn is
+	// resealed, salary decrypted and team left alone
+	db.SetFieldCipher(&testCipher{key: "k2"}, []string{"ssn"})
+	out, changed, err := reencryptAttributes(db, "user-1", doc)
+	if err != nil || !changed {
+		t.Fatalf("reencryptAttributes = %v, %v", changed, err)
+	}
+	var attrs map[string]json.RawMessage
+	json.Unmarshal([]byte(out), &attrs)
+	if id, _ := encryption.KeyID(sealedAttribute(attrs["ssn"])); id != "k2" {
+		t.Errorf("ssn = %s, want sealed with k2", attrs["ssn"])
+	}
+	if string(attrs["salary"]) != "100" || string(attrs["team"]) != `"blue"` {
+		t.Errorf("reencrypted attributes = %s", out)
+	}
+}
@@ -0,0 +1,13 @@
+package queries
+
+import "fmt"
+
+// StaleVersionError is returned by updates made against a lock_version that
+// is no longer the stored one: the row was changed since the caller read it.
+type StaleVersionError struct {
+	Current int // the version stored now
+}
+
+func (e *StaleVersionError) Error() string {
+	return fmt.Sprintf("stale version: the current version is %d", e.Current)
+}
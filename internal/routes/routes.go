@@ -2,64 +2,65 @@ package routes
 
 import (
 	"context"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/jcmturner/gokrb5/v8/keytab"
 	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
 	"github.com/the-monkeys/monkeys-identity/internal/config"
 	"github.com/the-monkeys/monkeys-identity/internal/database"
+	"github.com/the-monkeys/monkeys-identity/internal/encryption"
+	"github.com/the-monkeys/monkeys-identity/internal/events"
 	"github.com/the-monkeys/monkeys-identity/internal/handlers"
+	"github.com/the-monkeys/monkeys-identity/internal/jobs"
+	"github.com/the-monkeys/monkeys-identity/internal/kerberos"
 	"github.com/the-monkeys/monkeys-identity/internal/middleware"
 	"github.com/the-monkeys/monkeys-identity/internal/queries"
 	"github.com/the-monkeys/monkeys-identity/internal/services"
+	"github.com/the-monkeys/monkeys-identity/internal/signing"
+	"github.com/the-monkeys/monkeys-identity/internal/storage"
 	"github.com/the-monkeys/monkeys-identity/pkg/logger"
-	"github.com/the-monkeys/monkeys-identity/pkg/utils"
 )
 
 func SetupRoutes(
 	root fiber.Router,
 	api fiber.Router,
 	db *database.DB,
-	redis *redis.Client,
+	redis redis.UniversalClient,
 	logger *logger.Logger,
 	cfg *config.Config,
 	auditService services.AuditService,
+	decisionLog services.DecisionLog,
+	accessLog services.AccessLog,
 	mfaService services.MFAService,
 	dynamicCORS *middleware.DynamicCORS,
+	scheduler *jobs.Scheduler,
+	settings services.SettingsService,
+	notifications services.NotificationService,
+	bus events.Bus,
+	health *handlers.HealthHandler,
 ) {
-	// Ensure we have a valid JWT private key for RS256 signing
-	var privKey *rsa.PrivateKey
-	var err error
-	if cfg.JWTPrivateKey != "" {
-		privKey, err = utils.LoadRSAPrivateKey(cfg.JWTPrivateKey)
-		if err != nil {
-			logger.Warn("Failed to load provided JWT private key: %v. Generating a temporary one instead.", err)
-		}
-	}
-
-	if privKey == nil {
-		logger.Warn("Using temporary RSA key for this session (not for production use)")
-		// Generate a new 2048-bit RSA key
-		privKey, err = rsa.GenerateKey(rand.Reader, 2048)
-		if err != nil {
-			logger.Error("Failed to generate temporary RSA key: %v", err)
-		} else {
-			// Encode to PEM format for consistent transport/storage
-			privBytes := x509.MarshalPKCS1PrivateKey(privKey)
-			privPEM := pem.EncodeToMemory(&pem.Block{
-				Type:  "RSA PRIVATE KEY",
-				Bytes: privBytes,
-			})
-			cfg.JWTPrivateKey = string(privPEM)
-		}
+	// Token signing keys: the active RS256 key, retired keys and the HS256
+	// migration window. A temporary key is generated when none is configured.
+	signingKeys, err := signing.NewKeyManager(cfg, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize token signing keys: %v", err)
 	}
 
 	// Initialize middleware with the guaranteed key
-	authMiddleware := middleware.NewAuthMiddleware(cfg.JWTSecret, cfg.JWTPrivateKey, redis)
+	authMiddleware := middleware.NewAuthMiddleware(signingKeys, redis)
+	authMiddleware.SetAPIKeyStore(queries.New(db, redis).User)
+	authMiddleware.SetSessionStore(queries.New(db, redis).Session)
+	authMiddleware.SetRoleStore(queries.New(db, redis).Auth, cfg.RoleCacheTTL)
+	authMiddleware.SetAudit(auditService)
+	authMiddleware.SetLogger(logger)
+	if cfg.MTLSClientAuth {
+		authMiddleware.SetClientCertStore(queries.New(db, redis).User, cfg.EnterpriseAuthTiers)
+	}
+	// Step-up: sensitive operations need an MFA check of the session within STEP_UP_MFA_MAX_AGE
+	stepUp := authMiddleware.RequireRecentMFA(cfg.StepUpMFAMaxAge)
 
 	// Resolve system organization by slug (not hardcoded UUID).
 	// This determines root-user detection at the middleware level.
@@ -75,55 +76,207 @@ func SetupRoutes(
 	q := queries.New(db, redis)
 
 	// Initialize services
-	authzSvc := services.NewAuthzService(q)
-	oidcSvc := services.NewOIDCService(q, cfg)
-	emailSvc := services.NewEmailService(cfg, logger)
+	authzSvc := services.NewAuthzService(q, decisionLog, accessLog)
+	// Delegated administration: admin routes that organizations may hand to
+	// the user-admin, policy-admin, auditor and billing-admin roles (or
+	// their own policies) require the capability instead of the admin role
+	capability := func(action string) fiber.Handler {
+		return authMiddleware.RequireCapability(authzSvc, action)
+	}
+	// Reads and writes of resources and content items go to the resource
+	// access log
+	resourceAccess := func(action string) fiber.Handler {
+		return middleware.RecordAccess(accessLog, queries.AccessLogResource, action)
+	}
+	contentAccess := func(action string) fiber.Handler {
+		return middleware.RecordAccess(accessLog, queries.AccessLogContent, action)
+	}
+	oidcSvc := services.NewOIDCService(q, cfg, signingKeys)
+	emailSvc := services.NewEmailService(cfg, q, logger)
+	// Readiness also checks the SMTP server and that tokens can be signed
+	health.SetEmail(emailSvc)
+	health.SetSigningKeys(signingKeys)
+	otpSvc := services.NewOTPService(redis, emailSvc, services.NewSMSProvider(cfg, logger), logger)
+	emailValidator := services.NewEmailValidationService(cfg, logger)
+	breachedPasswords, err := services.NewBreachedPasswordService(cfg, q.Organization, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize breached password check: %v", err)
+	}
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(q, redis, logger, cfg, auditService, mfaService, emailSvc)
+	authHandler := handlers.NewAuthHandler(q, redis, logger, cfg, auditService, mfaService, emailSvc, otpSvc, signingKeys)
 	authHandler.SetCORS(dynamicCORS)
-	userHandler := handlers.NewUserHandler(q, logger, auditService)
+	authHandler.SetSettings(settings)
+	authHandler.SetEmailValidator(emailValidator)
+	authHandler.SetBreachedPasswords(breachedPasswords)
+	authHandler.SetLoginThrottle(services.NewLoginThrottleService(cfg, redis, logger))
+	authHandler.SetEvents(bus)
+	authHandler.SetImpersonation(services.NewImpersonationService(q.Session, redis, auditService, logger))
+	authHandler.SetDelegation(services.NewDelegationService(q, redis, auditService, logger))
+	if cfg.KerberosKeytabFile != "" {
+		kt, err := keytab.Load(cfg.KerberosKeytabFile)
+		if err != nil {
+			logger.Fatal("Failed to load Kerberos keytab: %v", err)
+		}
+		acceptor := kerberos.NewAcceptor(kt, cfg.KerberosServicePrincipal)
+		if len(acceptor.Principals()) == 0 {
+			logger.Fatal("Invalid Kerberos keytab: it holds no keys")
+		}
+		logger.Info("SPNEGO sign-in enabled for %s", strings.Join(acceptor.Principals(), ", "))
+		authHandler.SetKerberos(acceptor)
+	}
+	dataExportSvc := services.NewDataExportService(q, redis, logger)
+	userHandler := handlers.NewUserHandler(q, logger, auditService, dataExportSvc)
+	userHandler.SetEmailValidator(emailValidator)
+	userHandler.SetBreachedPasswords(breachedPasswords)
+	userHandler.SetEvents(bus)
+	userHandler.SetAuthz(authzSvc)
+	userHandler.SetEnterpriseAuthTiers(cfg.EnterpriseAuthTiers)
 	organizationHandler := handlers.NewOrganizationHandler(db, redis, logger)
 	organizationHandler.SetCORS(dynamicCORS)
+	organizationHandler.SetSettings(settings)
+	organizationHandler.SetAudit(auditService)
+	userImportSvc := services.NewUserImportService(q, redis, emailSvc, logger)
+	userImportHandler := handlers.NewUserImportHandler(userImportSvc, logger, auditService)
+	// Principals named by memberships, shares, assignments and grants must
+	// exist in the organization
+	principals := services.NewPrincipalResolver(q)
 	groupHandler := handlers.NewGroupHandler(db, redis, logger)
+	groupHandler.SetPrincipals(principals)
 	resourceHandler := handlers.NewResourceHandler(db, redis, logger)
+	resourceHandler.SetPrincipals(principals)
 	policyHandler := handlers.NewPolicyHandler(db, redis, logger, auditService, authzSvc)
+	policyHandler.SetEvents(bus)
 	roleHandler := handlers.NewRoleHandler(db, redis, logger)
+	roleHandler.SetEvents(bus)
+	roleHandler.SetAudit(auditService)
+	roleHandler.SetPrincipals(principals)
+	roleHandler.SetAuthz(authzSvc)
 	sessionHandler := handlers.NewSessionHandler(db, redis, logger)
+	sessionHandler.SetEvents(bus)
 	oidcHandler := handlers.NewOIDCHandler(oidcSvc, q, *logger, cfg)
+	oidcHandler.SetAudit(auditService)
 
 	contentHandler := handlers.NewContentHandler(db, redis, logger)
+	contentHandler.SetCounters(services.NewContentCounterService(q, redis, logger))
+	contentHandler.SetInvitations(signingKeys, emailSvc)
+	attachmentStore, err := storage.New(cfg)
+	if err != nil {
+		logger.Fatal("Failed to initialize attachment storage: %v", err)
+	}
+	contentHandler.SetAttachments(attachmentStore, signingKeys, cfg)
+	organizationHandler.SetBrandingStore(attachmentStore, cfg.PublicURL)
+	organizationHandler.SetEmail(emailSvc)
+	organizationHandler.SetClaimsWebhooks(cfg.ClaimsWebhooks)
+	organizationHandler.SetDirectorySync(services.NewDirectorySyncService(q, bus, auditService, logger))
+	// Final exports of organizations scheduled for deletion are kept in the
+	// same storage backend
+	organizationHandler.SetDeletions(services.NewOrganizationDeletionService(q, redis, attachmentStore, auditService,
+		time.Duration(cfg.OrgDeletionGraceDays)*24*time.Hour, logger))
+	resourceHandler.SetIntegrity(services.NewResourceIntegrityService(q, attachmentStore, auditService, cfg.ChecksumVerifyInterval, logger))
+	// KMS key material is wrapped by the field encryption master key
+	masterKey, err := encryption.FromConfig(cfg)
+	if err != nil {
+		logger.Fatal("Invalid field encryption configuration: %v", err)
+	}
+	kmsHandler := handlers.NewKMSHandler(q, services.NewKMSService(q, masterKey, auditService, logger), auditService, logger)
+	kmsHandler.SetPrincipals(principals)
+	contentHandler.SetEvents(bus)
+	notificationHandler := handlers.NewNotificationHandler(notifications, logger)
+	shareLinkHandler := handlers.NewShareLinkHandler(q, signingKeys, accessLog, logger)
+	shareLinkHandler.SetEmail(emailSvc)
 
 	// Create queries instance for audit handler
 	auditQueries := queries.New(db, redis)
 	auditHandler := handlers.NewAuditHandler(auditQueries, logger, auditService)
-
-	// Global API Rate Limiting
+	auditHandler.SetEvents(bus)
+	auditHandler.SetPrincipals(principals)
+	jobHandler := handlers.NewJobHandler(scheduler, logger, auditService)
+	applyHandler := handlers.NewApplyHandler(q, logger, auditService, roleHandler, policyHandler, groupHandler, oidcHandler)
+
+	// Body size limits per route group: auth endpoints take small forms,
+	// policies moderately sized documents, content and imports the most
+	api.Use(middleware.BodyLimits(cfg.BodyLimitDefault,
+		middleware.BodyLimit{Prefix: "/api/v1/auth", Limit: cfg.BodyLimitAuth},
+		middleware.BodyLimit{Prefix: "/api/v1/oauth2", Limit: cfg.BodyLimitAuth},
+		middleware.BodyLimit{Prefix: "/api/v1/oauth2/clients", Limit: cfg.BodyLimitDefault},
+		middleware.BodyLimit{Prefix: "/api/v1/policies", Limit: cfg.BodyLimitPolicy},
+		// Configuration bundles carry policy documents among the rest
+		middleware.BodyLimit{Prefix: "/api/v1/admin/apply", Limit: cfg.BodyLimitPolicy},
+		middleware.BodyLimit{Prefix: "/api/v1/content", Limit: cfg.BodyLimitContent},
+		// Multipart framing on top of the attachment itself, whose size the
+		// upload handler checks
+		middleware.BodyLimit{Prefix: "/api/v1/content/:id/attachments", Limit: int(cfg.AttachmentMaxBytes) + 64<<10},
+		middleware.BodyLimit{Prefix: "/api/v1/organizations/:id/users/import", Limit: cfg.BodyLimitImport},
+		middleware.BodyLimit{Prefix: "/api/v1/organizations/:id/branding/logo", Limit: handlers.MaxBrandingLogoBytes + 64<<10},
+	))
+
+	// Rate limiting (Redis-backed, shared by all replicas). Every request
+	// counts against its client IP; unauthenticated auth endpoints have a
+	// much smaller per-IP budget against credential stuffing, and
+	// authenticated requests are additionally limited per user or API key.
+	rateLimiter := middleware.NewRateLimiter(redis, logger)
+	authRateLimit := func(c *fiber.Ctx) error { return c.Next() }
+	usernameCheckRateLimit := func(c *fiber.Ctx) error { return c.Next() }
+	principalRateLimit := func(c *fiber.Ctx) error { return c.Next() }
 	if cfg.RateLimitEnabled {
-		// General API limit: 1000 requests per minute
-		api.Use(middleware.RateLimiter(1000, 1*time.Minute))
+		api.Use(rateLimiter.PerIP("api", middleware.RateLimitBudget{Limit: cfg.RateLimitIPPerMinute, Window: time.Minute}))
+		authRateLimit = rateLimiter.PerIP("auth", middleware.RateLimitBudget{Limit: cfg.RateLimitAuthPerMinute, Window: time.Minute, ChallengeAt: cfg.ChallengeAfterPerMinute})
+		usernameCheckRateLimit = rateLimiter.PerIP("username-check", middleware.RateLimitBudget{Limit: cfg.RateLimitUsernameCheckPerMinute, Window: time.Minute})
+		principalRateLimit = rateLimiter.PerPrincipal(
+			middleware.RateLimitBudget{Limit: cfg.RateLimitUserPerMinute, Window: time.Minute},
+			middleware.RateLimitBudget{Limit: cfg.RateLimitAPIKeyPerHour, Window: time.Hour},
+		)
 	}
 
+	// Cookie sessions: state-changing requests authenticated by session
+	// cookies must carry the double-submit CSRF token
+	csrfProtect := func(c *fiber.Ctx) error { return c.Next() }
+	if cfg.SessionCookies {
+		csrfProtect = middleware.CSRFProtect()
+	}
+
+	// Bot challenges on abuse-prone signup/reset endpoints, for IPs the auth
+	// rate limit flagged (or every request with CHALLENGE_ALWAYS)
+	challengeSvc := services.NewChallengeService(cfg, redis, logger)
+	challengeHandler := handlers.NewChallengeHandler(challengeSvc, rateLimiter, cfg.ChallengeAlways, logger)
+	requireChallenge := middleware.RequireChallenge(challengeSvc, rateLimiter, cfg.ChallengeAlways)
+
 	// Public routes (no authentication required)
 	public := api.Group("/public")
 	public.Get("/health", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"status": "ok", "service": "monkeys-iam"})
 	})
 	public.Get("/organizations", organizationHandler.ListPublicOrganizations)
+	public.Get("/branding", organizationHandler.GetPublicBranding)
+	public.Get("/branding/logo", organizationHandler.GetBrandingLogo)
+	public.Get("/attachments/:id", contentHandler.DownloadAttachment)
+	public.Post("/share-links/redeem", authRateLimit, shareLinkHandler.RedeemShareLink)
+	public.Get("/shared", shareLinkHandler.GetShared)
+	public.Put("/shared", shareLinkHandler.UpdateShared)
+	public.Post("/guest-shares/redeem", authRateLimit, shareLinkHandler.RedeemGuestShare)
+	public.Get("/error-codes", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"success": true, "data": apierror.Catalog})
+	})
 
 	// Authentication routes
-	auth := api.Group("/auth")
-	if cfg.RateLimitEnabled {
-		// Stricter limit for auth endpoints: 100 requests per minute to prevent brute force
-		auth.Use(middleware.RateLimiter(100, 1*time.Minute))
-	}
+	auth := api.Group("/auth", authRateLimit, csrfProtect)
 	auth.Post("/login", authHandler.Login)
+	// Multi-tenant frontends route users to their organization's sign-in
+	auth.Get("/login", authHandler.GetLoginOptions)
+	auth.Get("/orgs", authHandler.DiscoverOrganizations)
+	auth.Get("/spnego", authHandler.SPNEGOLogin)
 	auth.Post("/login/mfa-verify", authHandler.LoginMFAVerify)
-	auth.Post("/register", authHandler.Register)
-	auth.Post("/register-org", authHandler.RegisterOrganization)
+	auth.Post("/login/mfa-send", authHandler.LoginMFASend)
+	auth.Get("/challenge", challengeHandler.GetChallenge)
+	auth.Post("/register", requireChallenge, authHandler.Register)
+	auth.Post("/register-org", requireChallenge, authHandler.RegisterOrganization)
+	auth.Get("/check-username", usernameCheckRateLimit, authHandler.CheckUsername)
 	auth.Post("/refresh", authHandler.RefreshToken)
 	auth.Post("/logout", authMiddleware.RequireAuth(), authHandler.Logout)
-	auth.Post("/forgot-password", authHandler.ForgotPassword)
+	// Service accounts mint tokens to act for users who delegated to them
+	auth.Post("/delegation/token", authMiddleware.RequireAuth(), tenantMw.ResolveTenant(), authHandler.MintDelegatedToken)
+	auth.Post("/forgot-password", requireChallenge, authHandler.ForgotPassword)
 	auth.Post("/reset-password", authHandler.ResetPassword)
 	auth.Post("/verify-email", authHandler.VerifyEmail)
 	auth.Post("/resend-verification", authHandler.ResendVerification)
@@ -135,45 +288,106 @@ func SetupRoutes(
 	federation := root.Group("/")
 	federation.Get("/.well-known/openid-configuration", oidcHandler.GetDiscovery)
 	federation.Get("/.well-known/jwks.json", oidcHandler.GetJWKS)
+	federation.Get("/.well-known/oauth-authorization-server", oidcHandler.GetAuthorizationServerMetadata)
+	federation.Get("/.well-known/oauth-authorization-server/*", oidcHandler.GetAuthorizationServerMetadata)
+	federation.Get("/.well-known/change-password", oidcHandler.ChangePassword)
+	federation.Get("/.well-known/security.txt", oidcHandler.GetSecurityTxt)
+
+	// Browser-based clients may call the token and userinfo endpoints from
+	// the origins they registered
+	dynamicCORS.SetClientOrigins(oidcSvc, "/api/v1/oauth2/token", "/api/v1/oauth2/userinfo")
 
 	oauth2 := api.Group("/oauth2")
 	oauth2.Get("/authorize", authMiddleware.OptionalAuth(), oidcHandler.Authorize)
-	oauth2.Post("/token", oidcHandler.Token)
-	oauth2.Get("/userinfo", authMiddleware.RequireAuth(), oidcHandler.UserInfo)
+	oauth2.Post("/token", authRateLimit, dynamicCORS.ClientCORS(handlers.TokenClientID), oidcHandler.Token)
+	oauth2.Post("/par", authRateLimit, dynamicCORS.ClientCORS(handlers.TokenClientID), oidcHandler.PushAuthorizationRequest)
+	oauth2.Post("/device_authorization", authRateLimit, oidcHandler.DeviceAuthorization)
+	oauth2.Get("/device", authRateLimit, authMiddleware.RequireAuth(), oidcHandler.GetDeviceAuthorization)
+	oauth2.Post("/device", authRateLimit, csrfProtect, authMiddleware.RequireAuth(), oidcHandler.DecideDeviceAuthorization)
+	oauth2.Get("/userinfo", authMiddleware.RequireAuth(), dynamicCORS.ClientCORS(handlers.BearerClientID), oidcHandler.UserInfo)
 	oauth2.Get("/client-info", oidcHandler.GetPublicClientInfo)
-	oauth2.Post("/consent", authMiddleware.RequireAuth(), oidcHandler.HandleConsent)
+	oauth2.Post("/consent", csrfProtect, authMiddleware.RequireAuth(), oidcHandler.HandleConsent)
 
 	// OIDC Client Management routes (for ecosystem app registration)
-	oidcClients := oauth2.Group("/clients", authMiddleware.RequireAuth())
+	oidcClients := oauth2.Group("/clients", csrfProtect, authMiddleware.RequireAuth())
 	oidcClients.Post("/", authMiddleware.RequireRole("admin"), oidcHandler.RegisterClient)
 	oidcClients.Get("/", oidcHandler.ListClients)
 	oidcClients.Put("/:id", authMiddleware.RequireRole("admin"), oidcHandler.UpdateClient)
 	oidcClients.Delete("/:id", authMiddleware.RequireRole("admin"), oidcHandler.DeleteClient)
+	oidcClients.Post("/:id/rotate-secret", authMiddleware.RequireRole("admin"), stepUp, oidcHandler.RotateClientSecret)
+	oidcClients.Get("/:id/export", authMiddleware.RequireRole("admin"), oidcHandler.ExportClient)
+	oidcClients.Put("/external/:external_id", authMiddleware.RequireRole("admin"), oidcHandler.UpsertClient)
+	oidcClients.Get("/external/:external_id/export", authMiddleware.RequireRole("admin"), oidcHandler.ExportClient)
+
+	// Organization-defined OAuth scopes and API audiences
+	oidcScopes := oauth2.Group("/scopes", csrfProtect, authMiddleware.RequireAuth())
+	oidcScopes.Get("/", oidcHandler.ListScopes)
+	oidcScopes.Post("/", authMiddleware.RequireRole("admin"), oidcHandler.CreateScope)
+	oidcScopes.Put("/:id", authMiddleware.RequireRole("admin"), oidcHandler.UpdateScope)
+	oidcScopes.Delete("/:id", authMiddleware.RequireRole("admin"), oidcHandler.DeleteScope)
+
+	oidcAudiences := oauth2.Group("/audiences", csrfProtect, authMiddleware.RequireAuth())
+	oidcAudiences.Get("/", oidcHandler.ListAudiences)
+	oidcAudiences.Post("/", authMiddleware.RequireRole("admin"), oidcHandler.CreateAudience)
+	oidcAudiences.Delete("/:id", authMiddleware.RequireRole("admin"), oidcHandler.DeleteAudience)
+
+	// Impersonation sessions may use the API as the user but not change
+	// how the user signs in
+	notImpersonating := middleware.BlockImpersonation()
 
 	// MFA routes
 	mfa := auth.Group("/mfa")
-	mfa.Post("/setup", authMiddleware.RequireAuth(), authHandler.SetupMFA)
-	mfa.Post("/verify", authMiddleware.RequireAuth(), authHandler.VerifyMFA)
-	mfa.Post("/backup-codes", authMiddleware.RequireAuth(), authHandler.GenerateBackupCodes)
-	mfa.Delete("/disable", authMiddleware.RequireAuth(), authHandler.DisableMFA)
-
-	// Protected routes (authentication + tenant resolution required)
-	protected := api.Group("/", authMiddleware.RequireAuth(), tenantMw.ResolveTenant())
+	mfa.Post("/setup", authMiddleware.RequireAuth(), notImpersonating, authHandler.SetupMFA)
+	mfa.Post("/verify", authMiddleware.RequireAuth(), notImpersonating, authHandler.VerifyMFA)
+	mfa.Post("/send", authMiddleware.RequireAuth(), notImpersonating, authHandler.SendMFACode)
+	mfa.Post("/backup-codes", authMiddleware.RequireAuth(), notImpersonating, authHandler.GenerateBackupCodes)
+	mfa.Delete("/disable", authMiddleware.RequireAuth(), notImpersonating, authHandler.DisableMFA)
+
+	// Protected routes (authentication + tenant resolution required). While
+	// the global require_mfa setting is on, users must enroll in MFA under
+	// /auth/mfa before using them.
+	protected := api.Group("/", csrfProtect, authMiddleware.RequireAuth(), tenantMw.ResolveTenant(), principalRateLimit,
+		authMiddleware.RequireMFAEnrollment(settings.RequireMFA))
 
 	// User management routes
 	users := protected.Group("/users")
 	users.Get("/", userHandler.ListUsers)
-	users.Post("/", authMiddleware.RequireRole("admin"), userHandler.CreateUser)
+	users.Post("/", capability("monkeys:iam:create_user"), userHandler.CreateUser)
+	users.Get("/me", userHandler.GetMe)
+	users.Get("/me/permissions", userHandler.GetMyPermissions)
+	users.Get("/me/sessions", userHandler.GetMySessions)
+	users.Delete("/me/sessions/:session_id", userHandler.RevokeMySession)
+	users.Get("/me/consents", userHandler.GetMyConsents)
+	users.Delete("/me/consents/:client_id", userHandler.RevokeMyConsent)
+	// Consent for service accounts to act on the user's behalf
+	users.Get("/me/delegations", authHandler.ListMyDelegations)
+	users.Post("/me/delegations", notImpersonating, authHandler.GrantDelegation)
+	users.Delete("/me/delegations/:id", authHandler.RevokeMyDelegation)
+	users.Get("/me/organizations", userHandler.GetMyOrganizations)
+	users.Patch("/me/username", notImpersonating, userHandler.ChangeMyUsername)
+	users.Get("/me/bookmarks", contentHandler.ListMyBookmarks)
+	users.Get("/duplicates", authMiddleware.RequireRole("admin"), userHandler.FindDuplicateUsers)
 	users.Get("/:id", userHandler.GetUser)
 	users.Put("/:id", userHandler.UpdateUser)
-	users.Delete("/:id", authMiddleware.RequireRole("admin"), userHandler.DeleteUser)
+	users.Delete("/:id", capability("monkeys:iam:delete_user"), userHandler.DeleteUser)
 	users.Get("/:id/profile", userHandler.GetUserProfile)
 	users.Put("/:id/profile", userHandler.UpdateUserProfile)
-	users.Post("/:id/suspend", authMiddleware.RequireRole("admin"), userHandler.SuspendUser)
-	users.Post("/:id/activate", authMiddleware.RequireRole("admin"), userHandler.ActivateUser)
+	users.Patch("/:id/attributes", capability("monkeys:iam:update_user"), userHandler.PatchUserAttributes)
+	users.Patch("/:id/preferences", userHandler.PatchUserPreferences)
+	users.Post("/:id/suspend", capability("monkeys:iam:suspend_user"), userHandler.SuspendUser)
+	users.Post("/:id/activate", capability("monkeys:iam:activate_user"), userHandler.ActivateUser)
+	users.Post("/:id/restore", capability("monkeys:iam:restore_user"), userHandler.RestoreUser)
+	users.Post("/:id/purge", authMiddleware.RequireRole("admin"), userHandler.PurgeUser)
+	users.Post("/:id/merge", authMiddleware.RequireRole("admin"), stepUp, userHandler.MergeUsers)
+	users.Post("/:id/transfer-content", authMiddleware.RequireRole("admin"), contentHandler.TransferUserContent)
 	users.Get("/:id/sessions", userHandler.GetUserSessions)
 	users.Delete("/:id/sessions", userHandler.RevokeUserSessions)
-	users.Post("/:id/change-password", userHandler.ChangePassword)
+	users.Delete("/:id/sessions/:session_id", userHandler.RevokeUserSession)
+	users.Post("/:id/change-password", notImpersonating, userHandler.ChangePassword)
+	users.Get("/:id/export", userHandler.StartUserExport)
+	users.Get("/:id/exports", userHandler.ListUserExports)
+	users.Get("/:id/export/:job_id", userHandler.GetUserExport)
+	users.Get("/:id/export/:job_id/download", userHandler.DownloadUserExport)
 
 	// Organization management routes
 	// Authorization is enforced at the middleware level via TenantMiddleware:
@@ -182,72 +396,149 @@ func SetupRoutes(
 	// - Regular User: no org-level admin access (blocked by RequireAdmin/RequireOrgAdmin)
 	orgs := protected.Group("/organizations")
 	orgs.Get("/", tenantMw.RequireAdmin(), organizationHandler.ListOrganizations)
+	// Registered before the /:id routes, which would take external IDs such
+	// as "settings" for their own
+	orgs.Put("/external/:external_id", tenantMw.RequireRoot(), organizationHandler.UpsertOrganization)
+	orgs.Get("/external/:external_id/export", tenantMw.RequireRoot(), organizationHandler.ExportOrganization)
 	// Create org API temporarily muted — org creation happens via /auth/register-org during signup.
 	// An org admin can add more users to their org but should not create new orgs via this endpoint.
 	// orgs.Post("/", tenantMw.RequireRoot(), organizationHandler.CreateOrganization)
 	orgs.Get("/:id", tenantMw.RequireOrgAccess(), organizationHandler.GetOrganization)
 	orgs.Put("/:id", tenantMw.RequireOrgAdmin(), organizationHandler.UpdateOrganization)
-	orgs.Delete("/:id", tenantMw.RequireOrgAdmin(), organizationHandler.DeleteOrganization)
+	orgs.Delete("/:id", tenantMw.RequireOrgAdmin(), stepUp, organizationHandler.DeleteOrganization)
+	orgs.Get("/:id/deletion", tenantMw.RequireOrgAdmin(), organizationHandler.GetOrganizationDeletion)
+	orgs.Delete("/:id/deletion", tenantMw.RequireRoot(), organizationHandler.CancelOrganizationDeletion)
+	orgs.Get("/:id/deletion/export", tenantMw.RequireRoot(), organizationHandler.DownloadOrganizationDeletionExport)
+	orgs.Get("/:id/export", tenantMw.RequireOrgAdmin(), organizationHandler.ExportOrganization)
+	orgs.Get("/:id/analytics", tenantMw.RequireOrgAccess(), capability("monkeys:billing:view_usage"), organizationHandler.GetOrganizationAnalytics)
+	orgs.Get("/:id/audit-sinks", tenantMw.RequireOrgAdmin(), auditHandler.ListAuditSinks)
+	orgs.Post("/:id/audit-sinks", tenantMw.RequireOrgAdmin(), auditHandler.CreateAuditSink)
+	orgs.Get("/:id/audit-sinks/:sink_id", tenantMw.RequireOrgAdmin(), auditHandler.GetAuditSink)
+	orgs.Put("/:id/audit-sinks/:sink_id", tenantMw.RequireOrgAdmin(), auditHandler.UpdateAuditSink)
+	orgs.Delete("/:id/audit-sinks/:sink_id", tenantMw.RequireOrgAdmin(), auditHandler.DeleteAuditSink)
+	orgs.Post("/:id/audit-sinks/:sink_id/test", tenantMw.RequireOrgAdmin(), auditHandler.TestAuditSink)
+	orgs.Get("/:id/security-rules", tenantMw.RequireOrgAdmin(), auditHandler.ListSecurityRules)
+	orgs.Post("/:id/security-rules", tenantMw.RequireOrgAdmin(), auditHandler.CreateSecurityRule)
+	orgs.Get("/:id/security-rules/:rule_id", tenantMw.RequireOrgAdmin(), auditHandler.GetSecurityRule)
+	orgs.Put("/:id/security-rules/:rule_id", tenantMw.RequireOrgAdmin(), auditHandler.UpdateSecurityRule)
+	orgs.Delete("/:id/security-rules/:rule_id", tenantMw.RequireOrgAdmin(), auditHandler.DeleteSecurityRule)
+	orgs.Get("/:id/security-alerts", tenantMw.RequireOrgAdmin(), auditHandler.ListSecurityAlerts)
+	orgs.Get("/:id/security-alerts/:alert_id", tenantMw.RequireOrgAdmin(), auditHandler.GetSecurityAlert)
+	orgs.Post("/:id/security-alerts/:alert_id/acknowledge", tenantMw.RequireOrgAdmin(), auditHandler.AcknowledgeSecurityAlert)
 	orgs.Get("/:id/users", tenantMw.RequireOrgAccess(), organizationHandler.GetOrganizationUsers)
+	orgs.Get("/:id/dormant-users", tenantMw.RequireOrgAdmin(), organizationHandler.ListDormantUsers)
+	orgs.Get("/:id/external-shares", tenantMw.RequireOrgAdmin(), shareLinkHandler.ListExternalShares)
+	orgs.Delete("/:id/external-shares/:share_id", tenantMw.RequireOrgAdmin(), shareLinkHandler.RevokeExternalShare)
+	orgs.Post("/:id/users/import", tenantMw.RequireOrgAccess(), capability("monkeys:iam:import_users"), userImportHandler.ImportUsers)
+	orgs.Get("/:id/users/import/:job_id", tenantMw.RequireOrgAccess(), capability("monkeys:iam:import_users"), userImportHandler.GetUserImportJob)
+	orgs.Get("/:id/users/export", tenantMw.RequireOrgAccess(), capability("monkeys:iam:export_users"), userImportHandler.ExportUsers)
 	orgs.Get("/:id/groups", tenantMw.RequireOrgAccess(), organizationHandler.GetOrganizationGroups)
 	orgs.Get("/:id/resources", tenantMw.RequireOrgAccess(), organizationHandler.GetOrganizationResources)
 	orgs.Get("/:id/policies", tenantMw.RequireOrgAccess(), organizationHandler.GetOrganizationPolicies)
 	orgs.Get("/:id/roles", tenantMw.RequireOrgAccess(), organizationHandler.GetOrganizationRoles)
 	orgs.Get("/:id/settings", tenantMw.RequireOrgAccess(), organizationHandler.GetOrganizationSettings)
 	orgs.Put("/:id/settings", tenantMw.RequireOrgAdmin(), organizationHandler.UpdateOrganizationSettings)
+	orgs.Put("/:id/branding/logo", tenantMw.RequireOrgAdmin(), organizationHandler.UploadBrandingLogo)
+	orgs.Get("/:id/email-templates", tenantMw.RequireOrgAdmin(), organizationHandler.ListEmailTemplates)
+	orgs.Get("/:id/email-templates/:kind", tenantMw.RequireOrgAdmin(), organizationHandler.GetEmailTemplate)
+	orgs.Put("/:id/email-templates/:kind", tenantMw.RequireOrgAdmin(), organizationHandler.UpdateEmailTemplate)
+	orgs.Delete("/:id/email-templates/:kind", tenantMw.RequireOrgAdmin(), organizationHandler.DeleteEmailTemplate)
+	orgs.Get("/:id/email-templates/:kind/versions", tenantMw.RequireOrgAdmin(), organizationHandler.ListEmailTemplateVersions)
+	orgs.Post("/:id/email-templates/:kind/versions/:version/restore", tenantMw.RequireOrgAdmin(), organizationHandler.RestoreEmailTemplateVersion)
+	orgs.Post("/:id/email-templates/:kind/preview", tenantMw.RequireOrgAdmin(), organizationHandler.PreviewEmailTemplate)
+	orgs.Post("/:id/email-templates/:kind/test", tenantMw.RequireOrgAdmin(), authRateLimit, organizationHandler.SendTestEmailTemplate)
+	orgs.Get("/:id/claims-webhook", tenantMw.RequireOrgAdmin(), organizationHandler.GetClaimsWebhook)
+	orgs.Put("/:id/claims-webhook", tenantMw.RequireOrgAdmin(), organizationHandler.PutClaimsWebhook)
+	orgs.Delete("/:id/claims-webhook", tenantMw.RequireOrgAdmin(), organizationHandler.DeleteClaimsWebhook)
+	orgs.Post("/:id/claims-webhook/test", tenantMw.RequireOrgAdmin(), authRateLimit, organizationHandler.TestClaimsWebhook)
+	orgs.Get("/:id/directory-sync", tenantMw.RequireOrgAdmin(), organizationHandler.GetDirectorySync)
+	orgs.Put("/:id/directory-sync", tenantMw.RequireOrgAdmin(), organizationHandler.PutDirectorySync)
+	orgs.Delete("/:id/directory-sync", tenantMw.RequireOrgAdmin(), organizationHandler.DeleteDirectorySync)
+	orgs.Post("/:id/directory-sync/run", tenantMw.RequireOrgAdmin(), authRateLimit, organizationHandler.RunDirectorySync)
+	orgs.Get("/:id/directory-sync/runs", tenantMw.RequireOrgAdmin(), organizationHandler.ListDirectorySyncRuns)
+	orgs.Get("/:id/directory-sync/runs/:run_id", tenantMw.RequireOrgAdmin(), organizationHandler.GetDirectorySyncRun)
+	orgs.Get("/:id/user-attribute-schema", tenantMw.RequireOrgAccess(), organizationHandler.GetUserAttributeSchema)
+	orgs.Put("/:id/user-attribute-schema", tenantMw.RequireOrgAdmin(), organizationHandler.UpdateUserAttributeSchema)
 	orgs.Get("/:id/origins", tenantMw.RequireOrgAccess(), organizationHandler.GetOrganizationOrigins)
 	orgs.Put("/:id/origins", tenantMw.RequireOrgAdmin(), organizationHandler.UpdateOrganizationOrigins)
 
 	// Group management routes
 	groups := protected.Group("/groups")
 	groups.Get("/", groupHandler.ListGroups)
-	groups.Post("/", authMiddleware.RequireRole("admin"), groupHandler.CreateGroup)
+	groups.Post("/", capability("monkeys:iam:create_group"), groupHandler.CreateGroup)
 	groups.Get("/:id", groupHandler.GetGroup)
-	groups.Put("/:id", authMiddleware.RequireRole("admin"), groupHandler.UpdateGroup)
+	groups.Put("/:id", capability("monkeys:iam:update_group"), groupHandler.UpdateGroup)
 	groups.Delete("/:id", authMiddleware.RequirePermission(authzSvc, "monkeys:iam:delete_group"), groupHandler.DeleteGroup)
 	groups.Get("/:id/members", groupHandler.GetGroupMembers)
 	groups.Post("/:id/members", authMiddleware.RequirePermission(authzSvc, "monkeys:iam:manage_group_membership"), groupHandler.AddGroupMember)
 	groups.Delete("/:id/members/:user_id", authMiddleware.RequirePermission(authzSvc, "monkeys:iam:manage_group_membership"), groupHandler.RemoveGroupMember)
 	groups.Get("/:id/permissions", authMiddleware.RequirePermission(authzSvc, "monkeys:iam:view_group_permissions"), groupHandler.GetGroupPermissions)
+	groups.Get("/:id/export", groupHandler.ExportGroup)
+	groups.Put("/external/:external_id", capability("monkeys:iam:create_group"), capability("monkeys:iam:update_group"), groupHandler.UpsertGroup)
+	groups.Get("/external/:external_id/export", groupHandler.ExportGroup)
 
 	// Resource management routes
 	resources := protected.Group("/resources")
 	resources.Get("/", resourceHandler.ListResources)
 	resources.Post("/", resourceHandler.CreateResource)
-	resources.Get("/:id", resourceHandler.GetResource)
-	resources.Put("/:id", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:update"), resourceHandler.UpdateResource)
-	resources.Delete("/:id", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:delete"), resourceHandler.DeleteResource)
-	resources.Get("/:id/permissions", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:view_permissions"), resourceHandler.GetResourcePermissions)
-	resources.Post("/:id/permissions", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:manage_permissions"), resourceHandler.SetResourcePermissions)
+	resources.Get("/:id", resourceAccess("read"), resourceHandler.GetResource)
+	resources.Put("/:id", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:update"), resourceAccess("update"), resourceHandler.UpdateResource)
+	resources.Delete("/:id", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:delete"), resourceAccess("delete"), resourceHandler.DeleteResource)
+	resources.Get("/:id/permissions", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:view_permissions"), resourceAccess("view_permissions"), resourceHandler.GetResourcePermissions)
+	resources.Post("/:id/permissions", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:manage_permissions"), resourceAccess("manage_permissions"), resourceHandler.SetResourcePermissions)
 	resources.Get("/:id/access-log", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:view_audit"), resourceHandler.GetResourceAccessLog)
-	resources.Post("/:id/share", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:share"), resourceHandler.ShareResource)
-	resources.Delete("/:id/share", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:unshare"), resourceHandler.UnshareResource)
+	resources.Get("/:id/lifecycle", resourceHandler.GetResourceLifecycle)
+	resources.Post("/:id/lifecycle/recertify", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:update"), resourceAccess("recertify"), resourceHandler.RecertifyResource)
+	resources.Get("/:id/checksum", resourceHandler.GetResourceChecksum)
+	resources.Put("/:id/checksum", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:update"), resourceAccess("set_checksum"), resourceHandler.SetResourceChecksum)
+	resources.Post("/:id/checksum/verify", resourceAccess("verify_checksum"), resourceHandler.VerifyResourceChecksum)
+	resources.Post("/:id/share", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:share"), resourceAccess("share"), resourceHandler.ShareResource)
+	resources.Delete("/:id/share", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:unshare"), resourceAccess("unshare"), resourceHandler.UnshareResource)
+	resources.Post("/:id/share-links", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:share"), resourceAccess("create_share_link"), shareLinkHandler.CreateResourceLink)
+	resources.Get("/:id/share-links", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:share"), shareLinkHandler.ListResourceLinks)
+	resources.Delete("/:id/share-links/:link_id", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:unshare"), resourceAccess("revoke_share_link"), shareLinkHandler.RevokeResourceLink)
+	resources.Post("/:id/external-shares", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:share"), resourceAccess("share_external"), shareLinkHandler.CreateResourceExternalShare)
+	resources.Get("/:id/external-shares", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:share"), shareLinkHandler.ListResourceExternalShares)
+	resources.Delete("/:id/external-shares/:share_id", authMiddleware.RequirePermission(authzSvc, "monkeys:resource:unshare"), resourceAccess("revoke_external_share"), shareLinkHandler.RevokeResourceExternalShare)
 
 	// Policy management routes
 	policies := protected.Group("/policies")
 	policies.Get("/", policyHandler.ListPolicies)
-	policies.Post("/", authMiddleware.RequireRole("admin"), policyHandler.CreatePolicy)
+	policies.Post("/", capability("monkeys:iam:create_policy"), stepUp, policyHandler.CreatePolicy)
+	policies.Get("/analysis", capability("monkeys:policy:analyze"), policyHandler.AnalyzePolicies)
 	policies.Get("/:id", policyHandler.GetPolicy)
-	policies.Put("/:id", authMiddleware.RequireRole("admin"), policyHandler.UpdatePolicy)
-	policies.Delete("/:id", authMiddleware.RequireRole("admin"), policyHandler.DeletePolicy)
+	policies.Put("/:id", capability("monkeys:iam:update_policy"), stepUp, policyHandler.UpdatePolicy)
+	policies.Delete("/:id", capability("monkeys:iam:delete_policy"), stepUp, policyHandler.DeletePolicy)
+	policies.Get("/:id/export", policyHandler.ExportPolicy)
+	policies.Put("/external/:external_id", capability("monkeys:iam:create_policy"), capability("monkeys:iam:update_policy"), stepUp, policyHandler.UpsertPolicy)
+	policies.Get("/external/:external_id/export", policyHandler.ExportPolicy)
+	policies.Post("/simulate", policyHandler.SimulatePolicy)
 	policies.Post("/:id/simulate", policyHandler.SimulatePolicy)
 	policies.Get("/:id/versions", policyHandler.GetPolicyVersions)
-	policies.Post("/:id/approve", authMiddleware.RequireRole("admin"), policyHandler.ApprovePolicy)
-	policies.Post("/:id/rollback", authMiddleware.RequireRole("admin"), policyHandler.RollbackPolicy)
+	policies.Post("/:id/approve", capability("monkeys:iam:approve_policy"), stepUp, policyHandler.ApprovePolicy)
+	policies.Post("/:id/rollback", capability("monkeys:iam:rollback_policy"), stepUp, policyHandler.RollbackPolicy)
 
 	// Role management routes
 	roles := protected.Group("/roles")
 	roles.Get("/", roleHandler.ListRoles)
-	roles.Post("/", authMiddleware.RequireRole("admin"), roleHandler.CreateRole)
+	roles.Post("/assignments/:assignment_id/renewal", roleHandler.RequestRoleRenewal)
+	roles.Get("/renewal-requests", capability("monkeys:iam:assign_role"), roleHandler.ListRoleRenewalRequests)
+	roles.Post("/renewal-requests/:id/approve", capability("monkeys:iam:assign_role"), roleHandler.ApproveRoleRenewal)
+	roles.Post("/renewal-requests/:id/deny", capability("monkeys:iam:assign_role"), roleHandler.DenyRoleRenewal)
+	roles.Get("/sod-violations", capability("monkeys:iam:assign_role"), roleHandler.ListSoDViolations)
+	roles.Post("/", capability("monkeys:iam:create_role"), roleHandler.CreateRole)
 	roles.Get("/:id", roleHandler.GetRole)
-	roles.Put("/:id", authMiddleware.RequireRole("admin"), roleHandler.UpdateRole)
-	roles.Delete("/:id", authMiddleware.RequireRole("admin"), roleHandler.DeleteRole)
+	roles.Put("/:id", capability("monkeys:iam:update_role"), roleHandler.UpdateRole)
+	roles.Delete("/:id", capability("monkeys:iam:delete_role"), roleHandler.DeleteRole)
+	roles.Get("/:id/export", roleHandler.ExportRole)
+	roles.Put("/external/:external_id", capability("monkeys:iam:create_role"), capability("monkeys:iam:update_role"), roleHandler.UpsertRole)
+	roles.Get("/external/:external_id/export", roleHandler.ExportRole)
 	roles.Get("/:id/policies", roleHandler.GetRolePolicies)
-	roles.Post("/:id/policies", authMiddleware.RequireRole("admin"), roleHandler.AttachPolicyToRole)
-	roles.Delete("/:id/policies/:policy_id", authMiddleware.RequireRole("admin"), roleHandler.DetachPolicyFromRole)
+	roles.Post("/:id/policies", capability("monkeys:iam:attach_role_policy"), roleHandler.AttachPolicyToRole)
+	roles.Delete("/:id/policies/:policy_id", capability("monkeys:iam:detach_role_policy"), roleHandler.DetachPolicyFromRole)
 	roles.Get("/:id/assignments", roleHandler.GetRoleAssignments)
-	roles.Post("/:id/assign", authMiddleware.RequireRole("admin"), roleHandler.AssignRole)
-	roles.Delete("/:id/assign/:user_id", authMiddleware.RequireRole("admin"), roleHandler.UnassignRole)
+	roles.Post("/:id/assign", capability("monkeys:iam:assign_role"), roleHandler.AssignRole)
+	roles.Delete("/:id/assign/:user_id", capability("monkeys:iam:unassign_role"), roleHandler.UnassignRole)
 
 	// Session management routes
 	sessions := protected.Group("/sessions")
@@ -255,9 +546,14 @@ func SetupRoutes(
 	sessions.Get("/current", sessionHandler.GetCurrentSession)
 	sessions.Delete("/current", sessionHandler.RevokeCurrentSession)
 	sessions.Get("/:id", sessionHandler.GetSession)
-	sessions.Delete("/:id", authMiddleware.RequireRole("admin"), sessionHandler.RevokeSession)
+	sessions.Delete("/:id", capability("monkeys:iam:revoke_session"), sessionHandler.RevokeSession)
 	sessions.Post("/:id/extend", sessionHandler.ExtendSession)
 
+	// Real-time notifications as server-sent events; EventSource clients
+	// authenticate with the access_token cookie
+	notificationRoutes := protected.Group("/notifications")
+	notificationRoutes.Get("/stream", notificationHandler.Stream)
+
 	// Service Account routes
 	serviceAccounts := protected.Group("/service-accounts")
 	serviceAccounts.Get("/", authMiddleware.RequireRole("admin"), userHandler.ListServiceAccounts)
@@ -265,10 +561,34 @@ func SetupRoutes(
 	serviceAccounts.Get("/:id", authMiddleware.RequireRole("admin"), userHandler.GetServiceAccount)
 	serviceAccounts.Put("/:id", authMiddleware.RequireRole("admin"), userHandler.UpdateServiceAccount)
 	serviceAccounts.Delete("/:id", authMiddleware.RequireRole("admin"), userHandler.DeleteServiceAccount)
-	serviceAccounts.Post("/:id/keys", authMiddleware.RequireRole("admin"), userHandler.GenerateAPIKey)
+	serviceAccounts.Get("/:id/export", authMiddleware.RequireRole("admin"), userHandler.ExportServiceAccount)
+	serviceAccounts.Put("/external/:external_id", authMiddleware.RequireRole("admin"), userHandler.UpsertServiceAccount)
+	serviceAccounts.Get("/external/:external_id/export", authMiddleware.RequireRole("admin"), userHandler.ExportServiceAccount)
+	serviceAccounts.Post("/:id/keys", authMiddleware.RequireRole("admin"), stepUp, userHandler.GenerateAPIKey)
 	serviceAccounts.Get("/:id/keys", authMiddleware.RequireRole("admin"), userHandler.ListAPIKeys)
 	serviceAccounts.Delete("/:id/keys/:key_id", authMiddleware.RequireRole("admin"), userHandler.RevokeAPIKey)
-	serviceAccounts.Post("/:id/rotate-keys", authMiddleware.RequireRole("admin"), userHandler.RotateServiceAccountKeys)
+	serviceAccounts.Post("/:id/rotate-keys", authMiddleware.RequireRole("admin"), stepUp, userHandler.RotateServiceAccountKeys)
+	serviceAccounts.Post("/:id/certificates", authMiddleware.RequireRole("admin"), stepUp, userHandler.AddServiceAccountCertificate)
+	serviceAccounts.Get("/:id/certificates", authMiddleware.RequireRole("admin"), userHandler.ListServiceAccountCertificates)
+	serviceAccounts.Delete("/:id/certificates/:cert_id", authMiddleware.RequireRole("admin"), userHandler.DeleteServiceAccountCertificate)
+	serviceAccounts.Get("/:id/delegations", authMiddleware.RequireRole("admin"), authHandler.ListServiceAccountDelegations)
+	serviceAccounts.Delete("/:id/delegations/:grant_id", authMiddleware.RequireRole("admin"), authHandler.RevokeServiceAccountDelegation)
+
+	// Key management routes. Encrypting and decrypting with a key is
+	// governed by the key's grants rather than by policies.
+	kmsKeys := protected.Group("/kms/keys")
+	kmsKeys.Get("/", authMiddleware.RequirePermission(authzSvc, "monkeys:kms:list"), kmsHandler.ListKMSKeys)
+	kmsKeys.Post("/", authMiddleware.RequirePermission(authzSvc, "monkeys:kms:create_key"), kmsHandler.CreateKMSKey)
+	kmsKeys.Get("/:id", authMiddleware.RequirePermission(authzSvc, "monkeys:kms:get"), kmsHandler.GetKMSKey)
+	kmsKeys.Put("/:id", authMiddleware.RequirePermission(authzSvc, "monkeys:kms:update_key"), kmsHandler.UpdateKMSKey)
+	kmsKeys.Delete("/:id", authMiddleware.RequirePermission(authzSvc, "monkeys:kms:delete_key"), stepUp, kmsHandler.DeleteKMSKey)
+	kmsKeys.Post("/:id/rotate", authMiddleware.RequirePermission(authzSvc, "monkeys:kms:rotate_key"), kmsHandler.RotateKMSKey)
+	kmsKeys.Get("/:id/grants", authMiddleware.RequirePermission(authzSvc, "monkeys:kms:get"), kmsHandler.ListKMSGrants)
+	kmsKeys.Post("/:id/grants", authMiddleware.RequirePermission(authzSvc, "monkeys:kms:manage_grants"), kmsHandler.PutKMSGrant)
+	kmsKeys.Delete("/:id/grants/:grant_id", authMiddleware.RequirePermission(authzSvc, "monkeys:kms:manage_grants"), kmsHandler.DeleteKMSGrant)
+	kmsKeys.Get("/:id/usage", authMiddleware.RequirePermission(authzSvc, "monkeys:kms:view_usage"), kmsHandler.GetKMSKeyUsage)
+	kmsKeys.Post("/:id/encrypt", kmsHandler.KMSEncrypt)
+	kmsKeys.Post("/:id/decrypt", kmsHandler.KMSDecrypt)
 
 	// Authorization & Permission checking routes
 	authz := protected.Group("/authz")
@@ -276,14 +596,17 @@ func SetupRoutes(
 	authz.Post("/bulk-check", policyHandler.BulkCheckPermissions)
 	authz.Get("/effective-permissions", policyHandler.GetEffectivePermissions)
 	authz.Post("/simulate-access", policyHandler.SimulateAccess)
+	authz.Get("/decisions", capability("monkeys:authz:read_decisions"), policyHandler.ListAuthzDecisions)
+	authz.Get("/decisions/:id", capability("monkeys:authz:read_decisions"), policyHandler.GetAuthzDecision)
 
 	// Audit and Compliance routes
 	audit := protected.Group("/audit")
-	audit.Get("/events", authMiddleware.RequireRole("admin"), auditHandler.ListAuditEvents)
-	audit.Get("/events/:id", authMiddleware.RequireRole("admin"), auditHandler.GetAuditEvent)
-	audit.Get("/reports/access", authMiddleware.RequireRole("admin"), auditHandler.GenerateAccessReport)
-	audit.Get("/reports/compliance", authMiddleware.RequireRole("admin"), auditHandler.GenerateComplianceReport)
-	audit.Get("/reports/policy-usage", authMiddleware.RequireRole("admin"), auditHandler.GeneratePolicyUsageReport)
+	audit.Get("/events", capability("monkeys:audit:read_events"), auditHandler.ListAuditEvents)
+	audit.Get("/events/:id", capability("monkeys:audit:read_events"), auditHandler.GetAuditEvent)
+	audit.Get("/changes", capability("monkeys:audit:read_events"), auditHandler.ListEntityChanges)
+	audit.Get("/reports/access", capability("monkeys:audit:export"), auditHandler.GenerateAccessReport)
+	audit.Get("/reports/compliance", capability("monkeys:audit:export"), auditHandler.GenerateComplianceReport)
+	audit.Get("/reports/policy-usage", capability("monkeys:audit:export"), auditHandler.GeneratePolicyUsageReport)
 
 	// Access Reviews routes
 	reviews := protected.Group("/access-reviews")
@@ -301,6 +624,26 @@ func SetupRoutes(
 	admin.Delete("/maintenance-mode", auditHandler.DisableMaintenanceMode)
 	admin.Get("/settings", organizationHandler.GetGlobalSettings)
 	admin.Put("/settings", organizationHandler.UpdateGlobalSettings)
+	// Declarative configuration bundles of the caller's organization
+	admin.Post("/apply", stepUp, applyHandler.Apply)
+
+	// Support impersonation ("login as user"), for the root user only
+	admin.Post("/impersonate/:user_id", tenantMw.RequireRoot(), authHandler.StartImpersonation)
+	admin.Get("/impersonations", tenantMw.RequireRoot(), authHandler.ListImpersonations)
+	admin.Delete("/impersonations/:session_id", tenantMw.RequireRoot(), authHandler.StopImpersonation)
+
+	// Which OIDC clients of any organization skip consent, for the root
+	// user only; the organization's settings decide whether they may
+	admin.Get("/oauth-clients/trusted", tenantMw.RequireRoot(), oidcHandler.ListTrustedClients)
+	admin.Put("/oauth-clients/:id/trust", tenantMw.RequireRoot(), stepUp, oidcHandler.SetClientTrust)
+
+	// Background jobs are shared by all tenants, so only the root user may
+	// inspect or trigger them
+	adminJobs := admin.Group("/jobs", tenantMw.RequireRoot())
+	adminJobs.Get("/", jobHandler.ListJobs)
+	adminJobs.Get("/:name", jobHandler.GetJob)
+	adminJobs.Get("/:name/runs", jobHandler.ListJobRuns)
+	adminJobs.Post("/:name/run", jobHandler.TriggerJob)
 
 	// Content routes — scalable per-item authorization via content_collaborators table.
 	// Any authenticated user can create content; per-item permissions are checked
@@ -309,11 +652,37 @@ func SetupRoutes(
 	content := protected.Group("/content")
 	content.Post("/", contentHandler.CreateContent)
 	content.Get("/", contentHandler.ListContent)
-	content.Get("/:id", contentHandler.GetContent)
-	content.Put("/:id", contentHandler.UpdateContent)
-	content.Delete("/:id", contentHandler.DeleteContent)
-	content.Patch("/:id/status", contentHandler.UpdateContentStatus)
+	content.Get("/authors/:username", contentHandler.ListAuthorContent)
+	content.Post("/invitations/accept", contentHandler.AcceptInvitation)
+	content.Get("/:id", contentAccess("read"), contentHandler.GetContent)
+	content.Put("/:id", contentAccess("update"), contentHandler.UpdateContent)
+	content.Delete("/:id", contentAccess("delete"), contentHandler.DeleteContent)
+	content.Patch("/:id/status", contentAccess("update_status"), contentHandler.UpdateContentStatus)
+	content.Post("/:id/transfer", contentAccess("transfer"), contentHandler.TransferOwnership)
+	content.Get("/:id/access-log", contentHandler.GetContentAccessLog)
+	content.Get("/:id/revisions", contentHandler.ListRevisions)
+	content.Get("/:id/revisions/diff", contentHandler.DiffRevisions)
+	content.Get("/:id/revisions/:revision", contentAccess("read_revision"), contentHandler.GetRevision)
+	content.Post("/:id/revisions/:revision/restore", contentAccess("restore_revision"), contentHandler.RestoreRevision)
+	content.Post("/:id/reactions", contentHandler.AddReaction)
+	content.Delete("/:id/reactions/:type", contentHandler.RemoveReaction)
+	content.Post("/:id/attachments", contentAccess("upload_attachment"), contentHandler.UploadAttachment)
+	content.Get("/:id/attachments", contentHandler.ListAttachments)
+	content.Get("/:id/attachments/:attachment_id/url", contentAccess("download_attachment"), contentHandler.GetAttachmentURL)
+	content.Delete("/:id/attachments/:attachment_id", contentAccess("delete_attachment"), contentHandler.DeleteAttachment)
+	content.Post("/:id/bookmark", contentHandler.AddBookmark)
+	content.Delete("/:id/bookmark", contentHandler.RemoveBookmark)
+	content.Get("/:id/comments", contentHandler.ListComments)
+	content.Patch("/:id/moderation", contentHandler.ModerateComment)
 	content.Post("/:id/collaborators", contentHandler.InviteCollaborator)
 	content.Get("/:id/collaborators", contentHandler.ListCollaborators)
 	content.Delete("/:id/collaborators/:user_id", contentHandler.RemoveCollaborator)
+	content.Get("/:id/invitations", contentHandler.ListInvitations)
+	content.Delete("/:id/invitations/:invitation_id", contentHandler.RevokeInvitation)
+	content.Post("/:id/share-links", contentAccess("create_share_link"), shareLinkHandler.CreateContentLink)
+	content.Get("/:id/share-links", shareLinkHandler.ListContentLinks)
+	content.Delete("/:id/share-links/:link_id", contentAccess("revoke_share_link"), shareLinkHandler.RevokeContentLink)
+	content.Post("/:id/external-shares", contentAccess("share_external"), shareLinkHandler.CreateContentExternalShare)
+	content.Get("/:id/external-shares", shareLinkHandler.ListContentExternalShares)
+	content.Delete("/:id/external-shares/:share_id", contentAccess("revoke_external_share"), shareLinkHandler.RevokeContentExternalShare)
 }
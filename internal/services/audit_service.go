@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -18,15 +19,42 @@ type AuditService interface {
 	LogAccessDenied(ctx context.Context, orgID, principalID, principalType, resourceType, resourceID, message string)
 	LogAccessCheck(ctx context.Context, orgID, principalID, principalType, resourceType, resourceID, action string, allowed bool, reason string)
 	LogLogin(ctx context.Context, orgID, userID, ip, userAgent string, success bool, err string)
+	// AddExporter hands every event written to exporter, in addition to
+	// the exporters added before. Call before Start.
+	AddExporter(exporter AuditExporter)
 	Start(ctx context.Context)
 	Stop()
 }
 
+// clientIPKey is the type of ClientIPKey, so no string key of another
+// package can collide with it
+type clientIPKey struct{}
+
+// ClientIPKey is the context key of the client IP events are attributed to.
+// The request context middleware sets it as a fiber local, and fiber locals
+// are values of the request's context.
+var ClientIPKey = clientIPKey{}
+
+// ClientIPFromContext returns the client IP stored under ClientIPKey, or ""
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(ClientIPKey).(string)
+	return ip
+}
+
+// AuditExporter receives the audit events written, to send them on to the
+// SIEM sinks of their organization or match them against its security
+// rules; Export must not block
+type AuditExporter interface {
+	Export(event models.AuditEvent)
+}
+
 type auditService struct {
-	queries queries.AuditQueries
-	logger  *logger.Logger
-	events  chan models.AuditEvent
-	done    chan struct{}
+	queries   queries.AuditQueries
+	logger    *logger.Logger
+	exporters []AuditExporter
+	events    chan models.AuditEvent
+	stop      chan struct{}
+	done      chan struct{}
 }
 
 // NewAuditService creates a new instance of AuditService
@@ -35,10 +63,22 @@ func NewAuditService(q queries.AuditQueries, l *logger.Logger) AuditService {
 		queries: q,
 		logger:  l,
 		events:  make(chan models.AuditEvent, 1000), // Buffered channel for async logging
+		stop:    make(chan struct{}),
 		done:    make(chan struct{}),
 	}
 }
 
+func (s *auditService) AddExporter(exporter AuditExporter) {
+	s.exporters = append(s.exporters, exporter)
+}
+
+// export hands a written event to the exporters
+func (s *auditService) export(event models.AuditEvent) {
+	for _, exporter := range s.exporters {
+		exporter.Export(event)
+	}
+}
+
 // Start starts the background worker for processing audit events
 func (s *auditService) Start(ctx context.Context) {
 	go func() {
@@ -48,20 +88,32 @@ func (s *auditService) Start(ctx context.Context) {
 			case event := <-s.events:
 				if err := s.queries.LogAuditEvent(event); err != nil {
 					s.logger.Error("Failed to log audit event [%s]: %v", event.Action, err)
+				} else {
+					s.export(event)
 				}
 			case <-ctx.Done():
 				s.logger.Info("Audit worker stopping...")
 				s.drainEvents()
 				close(s.done)
 				return
+			case <-s.stop:
+				s.logger.Info("Audit worker stopping...")
+				s.drainEvents()
+				close(s.done)
+				return
 			}
 		}
 	}()
 }
 
-// Stop stops the audit worker
+// Stop stops the audit worker, writing any queued events first, and waits
+// for it to exit
 func (s *auditService) Stop() {
-	// Draining handled in Start via context cancellation
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
 	<-s.done
 }
 
@@ -72,6 +124,8 @@ func (s *auditService) drainEvents() {
 		case event := <-s.events:
 			if err := s.queries.LogAuditEvent(event); err != nil {
 				s.logger.Error("Failed to log final audit event [%s]: %v", event.Action, err)
+			} else {
+				s.export(event)
 			}
 		default:
 			return
@@ -94,6 +148,15 @@ func (s *auditService) LogEvent(ctx context.Context, event models.AuditEvent) {
 		// Default to system organization if not specified
 		event.OrganizationID = "00000000-0000-0000-0000-000000000000"
 	}
+	if event.IPAddress == nil && ctx != nil {
+		if ip := ClientIPFromContext(ctx); ip != "" {
+			event.IPAddress = &ip
+		}
+	}
+
+	if ctx != nil {
+		attributeDelegation(ctx, &event)
+	}
 
 	select {
 	case s.events <- event:
@@ -103,6 +166,32 @@ func (s *auditService) LogEvent(ctx context.Context, event models.AuditEvent) {
 	}
 }
 
+// attributeDelegation records the service account acting for the user in
+// events logged while serving a request made with a delegated token, so
+// the event names both identities. The delegation middleware sets the
+// acting principal as a fiber local, which is a value of the context.
+func attributeDelegation(ctx context.Context, event *models.AuditEvent) {
+	actorID, _ := ctx.Value("delegated_by").(string)
+	if actorID == "" || (event.PrincipalID != nil && *event.PrincipalID == actorID) {
+		return
+	}
+	details := map[string]interface{}{}
+	if event.AdditionalContext != "" && json.Unmarshal([]byte(event.AdditionalContext), &details) != nil {
+		return
+	}
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	details["acting_principal_id"] = actorID
+	details["acting_principal_type"] = "service_account"
+	if grantID, _ := ctx.Value("delegation_id").(string); grantID != "" {
+		details["delegation_id"] = grantID
+	}
+	if raw, err := json.Marshal(details); err == nil {
+		event.AdditionalContext = string(raw)
+	}
+}
+
 // LogAccessDenied is a helper for logging unauthorized access attempts
 func (s *auditService) LogAccessDenied(ctx context.Context, orgID, principalID, principalType, resourceType, resourceID, message string) {
 	s.LogEvent(ctx, models.AuditEvent{
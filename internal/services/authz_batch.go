@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+
+	"github.com/the-monkeys/monkeys-identity/internal/authz"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+)
+
+// MaxBatchChecks is the most requests AuthorizeBatch decides in one call
+const MaxBatchChecks = 200
+
+// principalGrants is everything a principal is granted that evaluation
+// reads: attached and group policies, resource permissions and shares
+type principalGrants struct {
+	policies    []*models.Policy
+	permissions []queries.ResourcePermission
+	shares      []queries.ResourceShare
+	err         error
+}
+
+// loadGrants fetches the grants of a principal. Like a single check, it
+// fails on policies only; unreadable permissions and shares are skipped.
+func (s *authzService) loadGrants(ctx context.Context, principalID, principalType, orgID string) *principalGrants {
+	g := &principalGrants{}
+	g.policies, g.err = s.queries.Policy.WithContext(ctx).GetPrincipalPolicies(principalID, principalType, orgID)
+	if g.err != nil {
+		return g
+	}
+	if g.policies == nil {
+		g.policies = []*models.Policy{}
+	}
+	g.permissions, _ = s.queries.Resource.WithContext(ctx).GetPrincipalPermissions(principalID, principalType, orgID)
+	g.shares, _ = s.queries.Resource.WithContext(ctx).GetPrincipalShares(principalID, principalType, orgID)
+	return g
+}
+
+func (s *authzService) principalPermissions(ctx context.Context, req evalRequest) ([]queries.ResourcePermission, error) {
+	if req.grants != nil {
+		return req.grants.permissions, nil
+	}
+	return s.queries.Resource.WithContext(ctx).GetPrincipalPermissions(req.principalID, req.principalType, req.orgID)
+}
+
+func (s *authzService) principalShares(ctx context.Context, req evalRequest) ([]queries.ResourceShare, error) {
+	if req.grants != nil {
+		return req.grants.shares, nil
+	}
+	return s.queries.Resource.WithContext(ctx).GetPrincipalShares(req.principalID, req.principalType, req.orgID)
+}
+
+// AuthorizeBatch decides requests in an organization, in order. The grants
+// of each principal are loaded once and every request of theirs evaluated
+// against them in memory, so a batch costs a few queries per principal
+// rather than per request. Requests that cannot be decided, including
+// those beyond MaxBatchChecks, get the "error" decision and an Error; the
+// rest are still answered.
+func (s *authzService) AuthorizeBatch(ctx context.Context, orgID string, requests []*queries.PermissionCheckRequest) []*queries.PermissionCheckResult {
+	type principal struct{ id, typ string }
+	grants := map[principal]*principalGrants{}
+
+	results := make([]*queries.PermissionCheckResult, len(requests))
+	for i, req := range requests {
+		if i >= MaxBatchChecks {
+			results[i] = batchError(req, "too many checks in one batch")
+			continue
+		}
+		if req.PrincipalID == "" || req.Resource == "" || req.Action == "" {
+			results[i] = batchError(req, "principal_id, resource and action are required")
+			continue
+		}
+
+		key := principal{req.PrincipalID, req.PrincipalType}
+		g, ok := grants[key]
+		if !ok {
+			g = s.loadGrants(ctx, req.PrincipalID, req.PrincipalType, orgID)
+			grants[key] = g
+		}
+		if g.err != nil {
+			results[i] = batchError(req, "failed to fetch policies")
+			continue
+		}
+
+		evalContext := req.Context.EvalContext()
+		if req.TokenScopes != nil {
+			evalContext["token_scopes"] = req.TokenScopes
+		}
+		trace, err := s.check(ctx, evalRequest{
+			principalID:   req.PrincipalID,
+			principalType: req.PrincipalType,
+			orgID:         orgID,
+			action:        req.Action,
+			resource:      req.Resource,
+			context:       evalContext,
+			explain:       req.Explain,
+			grants:        g,
+		})
+		if err != nil {
+			results[i] = batchError(req, "failed to evaluate")
+			continue
+		}
+		results[i] = &queries.PermissionCheckResult{
+			Allowed:  trace.Decision == authz.DecisionAllow,
+			Decision: string(trace.Decision),
+			Request:  req,
+		}
+		if req.Explain {
+			results[i].Trace = trace
+		}
+	}
+	return results
+}
+
+func batchError(req *queries.PermissionCheckRequest, message string) *queries.PermissionCheckResult {
+	return &queries.PermissionCheckResult{Decision: "error", Error: message, Request: req}
+}
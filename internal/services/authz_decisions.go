@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/jobs"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+// sampleRateTTL bounds how long a changed organization sample rate takes to
+// apply
+const sampleRateTTL = time.Minute
+
+// DecisionLog records a sample of authorization decisions, with the trace of
+// how each was reached, for admins to inspect
+type DecisionLog interface {
+	// Sampled reports whether the next decision in the organization should
+	// be recorded
+	Sampled(ctx context.Context, orgID string) bool
+	Record(decision models.AuthzDecision)
+	RegisterJobs(scheduler *jobs.Scheduler) error
+	Start(ctx context.Context)
+	Stop()
+}
+
+type decisionLog struct {
+	queries     *queries.Queries
+	logger      *logger.Logger
+	defaultRate float64
+	retention   time.Duration
+
+	mu    sync.Mutex
+	rates map[string]cachedSampleRate
+
+	decisions chan models.AuthzDecision
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+type cachedSampleRate struct {
+	rate    float64
+	expires time.Time
+}
+
+// NewDecisionLog creates a DecisionLog. defaultRate applies to organizations
+// without an authz_decision_sample_rate setting; a retention of zero or less
+// keeps decisions forever.
+func NewDecisionLog(q *queries.Queries, defaultRate float64, retention time.Duration, l *logger.Logger) DecisionLog {
+	return &decisionLog{
+		queries:     q,
+		logger:      l,
+		defaultRate: defaultRate,
+		retention:   retention,
+		rates:       make(map[string]cachedSampleRate),
+		decisions:   make(chan models.AuthzDecision, 1000),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+func (s *decisionLog) Sampled(ctx context.Context, orgID string) bool {
+	if orgID == "" {
+		return false
+	}
+	rate := s.sampleRate(ctx, orgID)
+	return rate > 0 && (rate >= 1 || rand.Float64() < rate)
+}
+
+func (s *decisionLog) sampleRate(ctx context.Context, orgID string) float64 {
+	s.mu.Lock()
+	cached, ok := s.rates[orgID]
+	s.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.rate
+	}
+
+	rate := s.defaultRate
+	override, err := s.queries.Organization.WithContext(ctx).GetDecisionSampleRate(orgID)
+	if err != nil {
+		s.logger.Warn("Failed to load decision sample rate for org %s: %v", orgID, err)
+	} else if override != nil {
+		rate = *override
+	}
+
+	s.mu.Lock()
+	s.rates[orgID] = cachedSampleRate{rate: rate, expires: time.Now().Add(sampleRateTTL)}
+	s.mu.Unlock()
+	return rate
+}
+
+// Record queues a decision to be written; it is dropped when the queue is full
+func (s *decisionLog) Record(decision models.AuthzDecision) {
+	select {
+	case s.decisions <- decision:
+	default:
+		s.logger.Warn("Authz decision queue full, dropping decision for %s", decision.Action)
+	}
+}
+
+// Start starts the background worker writing recorded decisions
+func (s *decisionLog) Start(ctx context.Context) {
+	go func() {
+		defer close(s.done)
+		for {
+			select {
+			case d := <-s.decisions:
+				s.write(d)
+			case <-ctx.Done():
+				s.drain()
+				return
+			case <-s.stop:
+				s.drain()
+				return
+			}
+		}
+	}()
+}
+
+// Stop writes any queued decisions and waits for the worker to exit
+func (s *decisionLog) Stop() {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.done
+}
+
+func (s *decisionLog) drain() {
+	for {
+		select {
+		case d := <-s.decisions:
+			s.write(d)
+		default:
+			return
+		}
+	}
+}
+
+func (s *decisionLog) write(d models.AuthzDecision) {
+	if err := s.queries.AuthzDecision.LogDecision(&d); err != nil {
+		s.logger.Error("Failed to log authz decision [%s]: %v", d.Action, err)
+	}
+}
+
+// RegisterJobs schedules the daily purge of decisions past the retention
+// period
+func (s *decisionLog) RegisterJobs(scheduler *jobs.Scheduler) error {
+	if s.retention <= 0 {
+		return nil
+	}
+	return scheduler.Register(jobs.Job{
+		Name:        "authz_decision_purge",
+		Description: "Delete sampled authorization decisions older than " + s.retention.String(),
+		Schedule:    "@daily",
+		Timeout:     10 * time.Minute,
+		Run: func(ctx context.Context) error {
+			purged, err := s.queries.AuthzDecision.WithContext(ctx).PurgeDecisions(time.Now().Add(-s.retention))
+			if err != nil {
+				return err
+			}
+			if purged > 0 {
+				s.logger.Info("Purged %d authz decisions past retention", purged)
+			}
+			return nil
+		},
+	})
+}
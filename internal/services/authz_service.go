@@ -2,66 +2,252 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/the-monkeys/monkeys-identity/internal/authz"
+	"github.com/the-monkeys/monkeys-identity/internal/metrics"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
 	"github.com/the-monkeys/monkeys-identity/internal/queries"
 )
 
 // AuthzService defines the interface for the unified authorization service
 type AuthzService interface {
 	Authorize(ctx context.Context, principalID, principalType, orgID, action, resource string, context map[string]interface{}) (authz.Decision, error)
+	// Explain is Authorize that also returns the trace of how the decision
+	// was reached
+	Explain(ctx context.Context, principalID, principalType, orgID, action, resource string, context map[string]interface{}) (*authz.Trace, error)
+	// EffectivePermissions lists what a principal is allowed per resource
+	// pattern and where each grant comes from, optionally for one service
+	EffectivePermissions(ctx context.Context, orgID, principalID, principalType, service string) (*EffectivePermissions, error)
+	// AuthorizeBatch decides up to MaxBatchChecks requests, loading the
+	// grants of each principal once
+	AuthorizeBatch(ctx context.Context, orgID string, requests []*queries.PermissionCheckRequest) []*queries.PermissionCheckResult
+	// Simulate evaluates a hypothetical request, optionally with an unsaved
+	// candidate policy, and reports each policy statement by statement
+	Simulate(ctx context.Context, orgID string, req *queries.AccessSimulationRequest) (*AccessSimulationResult, error)
+	// SimulatePolicy evaluates a policy document against test cases
+	SimulatePolicy(req *queries.PolicySimulationRequest) *queries.PolicySimulationResult
+	// AnalyzePolicies reports risky, shadowed and unused policies
+	AnalyzePolicies(ctx context.Context, orgID string, unusedDays int) (*PolicyAnalysisReport, error)
 }
 
 type authzService struct {
-	queries *queries.Queries
-	eval    *authz.Evaluator
+	queries   *queries.Queries
+	eval      *authz.Evaluator
+	decisions DecisionLog
+	access    AccessLog
 }
 
-// NewAuthzService creates a new AuthzService instance
-func NewAuthzService(q *queries.Queries) AuthzService {
+// NewAuthzService creates a new AuthzService instance. decisions may be nil
+// to disable decision sampling, access to leave denied resource checks out
+// of the resource access log.
+func NewAuthzService(q *queries.Queries, decisions DecisionLog, access AccessLog) AuthzService {
 	return &authzService{
-		queries: q,
-		eval:    authz.NewEvaluator(),
+		queries:   q,
+		eval:      authz.NewEvaluator(),
+		decisions: decisions,
+		access:    access,
 	}
 }
 
 // Authorize performs a comprehensive authorization check
 func (s *authzService) Authorize(ctx context.Context, principalID, principalType, orgID, action, resource string, context map[string]interface{}) (authz.Decision, error) {
-	// 1. Get all applicable PBAC policies (Direct + Group inherited)
-	policies, err := s.queries.Policy.WithContext(ctx).GetPrincipalPolicies(principalID, principalType, orgID)
+	trace, err := s.check(ctx, evalRequest{
+		principalID:   principalID,
+		principalType: principalType,
+		orgID:         orgID,
+		action:        action,
+		resource:      resource,
+		context:       context,
+	})
 	if err != nil {
-		return authz.DecisionDeny, fmt.Errorf("failed to fetch policies: %w", err)
+		return authz.DecisionDeny, err
 	}
+	return trace.Decision, nil
+}
 
-	// 2. Evaluate PBAC policies
-	var finalDecision authz.Decision = authz.DecisionNotApplicable
-	for _, p := range policies {
-		decision, err := s.eval.Evaluate(p.Document, action, resource, context)
+func (s *authzService) Explain(ctx context.Context, principalID, principalType, orgID, action, resource string, context map[string]interface{}) (*authz.Trace, error) {
+	return s.check(ctx, evalRequest{
+		principalID:   principalID,
+		principalType: principalType,
+		orgID:         orgID,
+		action:        action,
+		resource:      resource,
+		context:       context,
+		explain:       true,
+	})
+}
+
+// check evaluates a request, records metrics, logs the decision when it is
+// sampled and adds denied resource checks to the resource access log
+func (s *authzService) check(ctx context.Context, req evalRequest) (*authz.Trace, error) {
+	start := time.Now()
+	sampled := s.decisions != nil && s.decisions.Sampled(ctx, req.orgID)
+	// Explanations are asked for by admins investigating access, not made
+	// on behalf of the principal
+	enforced := !req.explain
+	req.explain = req.explain || sampled
+	trace, err := s.evaluate(ctx, req)
+	if err != nil {
+		metrics.ObserveAuthzCheck("error", time.Since(start))
+		return nil, err
+	}
+	metrics.ObserveAuthzCheck(string(trace.Decision), time.Since(start))
+	if trace.Decision != authz.DecisionAllow && enforced {
+		s.recordDenied(req, trace.Reason)
+	}
+
+	if sampled {
+		raw, _ := json.Marshal(trace)
+		s.decisions.Record(models.AuthzDecision{
+			OrganizationID: req.orgID,
+			PrincipalID:    req.principalID,
+			PrincipalType:  req.principalType,
+			Action:         req.action,
+			Resource:       req.resource,
+			Decision:       string(trace.Decision),
+			Reason:         trace.Reason,
+			Trace:          raw,
+		})
+	}
+	return trace, nil
+}
+
+// accessLogTypes maps the resource types of resource ARNs to those of the
+// resource access log
+var accessLogTypes = map[string]string{
+	"resources": queries.AccessLogResource,
+	"content":   queries.AccessLogContent,
+}
+
+// recordDenied adds a denied check against a resource or content item of
+// the caller's organization to the resource access log. Allowed checks are
+// left to the handlers, which know whether the access then succeeded.
+func (s *authzService) recordDenied(req evalRequest, reason string) {
+	if s.access == nil {
+		return
+	}
+	orgID, typ, id, ok := authz.ParseResourceARN(req.resource)
+	if !ok || orgID != req.orgID || accessLogTypes[typ] == "" {
+		return
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return
+	}
+	// The IP may point into request buffers reused before the entry is written
+	ip, _ := req.context["ip"].(string)
+	ip = strings.Clone(ip)
+	// The log names actions as the routes do, e.g. "update" for
+	// monkeys:resource:update
+	action := req.action
+	if i := strings.LastIndex(action, ":"); i >= 0 {
+		action = action[i+1:]
+	}
+	s.access.Record(queries.ResourceAccessLog{
+		OrganizationID: orgID,
+		ResourceType:   accessLogTypes[typ],
+		ResourceID:     id,
+		UserID:         req.principalID,
+		PrincipalType:  req.principalType,
+		Action:         action,
+		IPAddress:      ip,
+		Success:        false,
+		Details:        reason,
+	})
+}
+
+// evalRequest is a request to evaluate
+type evalRequest struct {
+	principalID, principalType, orgID string
+	action, resource                  string
+	context                           map[string]interface{}
+	// explain evaluates everything instead of stopping at the first
+	// explicit deny
+	explain bool
+	// policies replaces the principal's attached policies when non-nil
+	policies []*models.Policy
+	// policiesOnly skips resource permissions and shares
+	policiesOnly bool
+	// grants replaces the principal's policies, resource permissions and
+	// shares when non-nil
+	grants *principalGrants
+}
+
+// evaluate decides a request. Unless explain is set it stops at the first
+// explicit deny, so the trace only covers what was evaluated up to there.
+func (s *authzService) evaluate(ctx context.Context, req evalRequest) (*authz.Trace, error) {
+	principalID, principalType, orgID := req.principalID, req.principalType, req.orgID
+	action, resource, context := req.action, req.resource, req.context
+	trace := &authz.Trace{Steps: []authz.TraceStep{}}
+	var denied, allowed *authz.TraceStep
+	// consider records a step and reports whether evaluation can stop
+	consider := func(step authz.TraceStep) bool {
+		trace.Add(step)
+		switch step.Effect {
+		case authz.DecisionDeny:
+			if denied == nil {
+				denied = &step
+			}
+			return !req.explain
+		case authz.DecisionAllow:
+			if allowed == nil {
+				allowed = &step
+			}
+		}
+		return false
+	}
+
+	// 1. Get all applicable PBAC policies (Direct + Group inherited)
+	policies := req.policies
+	if req.grants != nil {
+		policies = req.grants.policies
+	}
+	if policies == nil {
+		var err error
+		policies, err = s.queries.Policy.WithContext(ctx).GetPrincipalPolicies(principalID, principalType, orgID)
 		if err != nil {
-			continue // Skip malformed policies
+			return nil, fmt.Errorf("failed to fetch policies: %w", err)
 		}
+	}
 
-		if decision == authz.DecisionDeny {
-			return authz.DecisionDeny, nil // Explicit Deny overrides everything
+	// 2. Evaluate PBAC policies
+	for _, p := range policies {
+		decision, statement, err := s.eval.EvaluateStatement(p.Document, action, resource, context)
+		step := authz.TraceStep{Source: authz.SourcePolicy, ID: p.ID, Name: p.Name, Effect: decision, Statement: statement}
+		if err != nil {
+			// Skip malformed policies
+			step.Effect = authz.DecisionNotApplicable
+			step.Error = err.Error()
 		}
-		if decision == authz.DecisionAllow {
-			finalDecision = authz.DecisionAllow
+		if consider(step) {
+			trace.Decide(authz.DecisionDeny, denied) // Explicit Deny overrides everything
+			return trace, nil
 		}
 	}
 
+	if req.policiesOnly {
+		return s.decide(ctx, trace, denied, allowed, orgID, action, context)
+	}
+
 	// 3. Evaluate Resource-based permissions (Simplified PBAC)
 	// These are stored in the resource_permissions table
-	resPerms, err := s.queries.Resource.WithContext(ctx).GetPrincipalPermissions(principalID, principalType, orgID)
+	resPerms, err := s.principalPermissions(ctx, req)
 	if err == nil {
 		for _, rp := range resPerms {
 			if rp.ResourceID == resource && s.eval.MatchWildcard(rp.Permission, action) {
+				step := authz.TraceStep{Source: authz.SourceResourcePermission, ID: rp.ID, Name: rp.Permission, Effect: authz.DecisionNotApplicable}
 				if strings.EqualFold(rp.Effect, "deny") {
-					return authz.DecisionDeny, nil
+					step.Effect = authz.DecisionDeny
+				} else if strings.EqualFold(rp.Effect, "allow") {
+					step.Effect = authz.DecisionAllow
 				}
-				if strings.EqualFold(rp.Effect, "allow") {
-					finalDecision = authz.DecisionAllow
+				if consider(step) {
+					trace.Decide(authz.DecisionDeny, denied)
+					return trace, nil
 				}
 			}
 		}
@@ -69,24 +255,77 @@ func (s *authzService) Authorize(ctx context.Context, principalID, principalType
 
 	// 4. Evaluate ReBAC (Resource Shares)
 	// These are stored in the resource_shares table
-	shares, err := s.queries.Resource.WithContext(ctx).GetPrincipalShares(principalID, principalType, orgID)
+	shares, err := s.principalShares(ctx, req)
 	if err == nil {
 		for _, share := range shares {
-			if share.ResourceID == resource {
+			if share.ResourceID == resource && !shareExpired(share, time.Now()) {
 				// Map access levels to actions
+				step := authz.TraceStep{Source: authz.SourceResourceShare, ID: share.ID, Name: share.AccessLevel, Effect: authz.DecisionNotApplicable}
 				if s.authorizeShare(share.AccessLevel, action) {
-					finalDecision = authz.DecisionAllow
+					step.Effect = authz.DecisionAllow
 				}
+				consider(step)
 			}
 		}
 	}
 
+	return s.decide(ctx, trace, denied, allowed, orgID, action, context)
+}
+
+// decide completes a trace once policies and grants have been evaluated:
+// explicit denies win, nothing allowed means the default deny, and OAuth
+// client tokens must also hold a scope covering the action
+func (s *authzService) decide(ctx context.Context, trace *authz.Trace, denied, allowed *authz.TraceStep, orgID, action string, context map[string]interface{}) (*authz.Trace, error) {
+	if denied != nil {
+		trace.Decide(authz.DecisionDeny, denied)
+		return trace, nil
+	}
 	// Default Deny if no explicit allow was found
-	if finalDecision == authz.DecisionNotApplicable {
-		return authz.DecisionDeny, nil
+	if allowed == nil {
+		trace.Decide(authz.DecisionDeny, nil)
+		return trace, nil
 	}
 
-	return finalDecision, nil
+	// 5. Tokens issued to OAuth clients are further limited to the actions
+	// their scopes map to
+	if scopes, ok := context["token_scopes"].([]string); ok {
+		permitted, err := s.scopesPermit(ctx, orgID, scopes, action)
+		if err != nil {
+			return nil, err
+		}
+		step := authz.TraceStep{Source: authz.SourceTokenScope, Name: strings.Join(scopes, " "), Effect: authz.DecisionAllow}
+		if !permitted {
+			step.Effect = authz.DecisionDeny
+			trace.Add(step)
+			trace.Decide(authz.DecisionDeny, &step)
+			return trace, nil
+		}
+		trace.Add(step)
+	}
+
+	trace.Decide(authz.DecisionAllow, allowed)
+	return trace, nil
+}
+
+// scopesPermit reports whether the organization's custom scopes map any of
+// scopes to action
+func (s *authzService) scopesPermit(ctx context.Context, orgID string, scopes []string, action string) (bool, error) {
+	defined, err := s.queries.OIDC.WithContext(ctx).ListScopesByOrg(orgID)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch oauth scopes: %w", err)
+	}
+	mapping := authz.ScopeActions{}
+	for _, d := range defined {
+		mapping[d.Name] = d.Actions
+	}
+	return mapping.Permits(scopes, action), nil
+}
+
+// shareExpired reports whether a share has lapsed. Shares are loaded
+// unexpired, but a batch evaluates the grants it loaded once against all of
+// its requests.
+func shareExpired(share queries.ResourceShare, now time.Time) bool {
+	return share.ExpiresAt != nil && !share.ExpiresAt.After(now)
 }
 
 // authorizeShare maps high-level access tiers to specific actions
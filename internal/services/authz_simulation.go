@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/the-monkeys/monkeys-identity/internal/authz"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+)
+
+// candidatePolicyName names the unsaved policy document in simulation results
+const candidatePolicyName = "(candidate)"
+
+// AccessSimulationResult is the outcome of a simulated access request
+type AccessSimulationResult struct {
+	Allowed  bool         `json:"allowed"`
+	Decision string       `json:"decision"`
+	Trace    *authz.Trace `json:"trace"`
+	// Policies reports every evaluated policy statement by statement
+	Policies []PolicySimulation `json:"policies"`
+}
+
+// PolicySimulation is how one policy applied to a simulated request
+type PolicySimulation struct {
+	PolicyID   string                  `json:"policy_id,omitempty"`
+	Name       string                  `json:"name"`
+	Candidate  bool                    `json:"candidate,omitempty"`
+	Decision   authz.Decision          `json:"decision"`
+	Statements []authz.StatementResult `json:"statements"`
+	Error      string                  `json:"error,omitempty"`
+}
+
+// Simulate evaluates a hypothetical request without logging it. The
+// candidate policy document, if any, must already be valid.
+func (s *authzService) Simulate(ctx context.Context, orgID string, req *queries.AccessSimulationRequest) (*AccessSimulationResult, error) {
+	evalContext := req.Context.EvalContext()
+	if req.TokenScopes != nil {
+		evalContext["token_scopes"] = req.TokenScopes
+	}
+
+	candidateOnly := req.PolicyDocument != "" && !req.IncludeExisting
+	policies := []*models.Policy{}
+	if !candidateOnly {
+		existing, err := s.queries.Policy.WithContext(ctx).GetPrincipalPolicies(req.PrincipalID, req.PrincipalType, orgID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch policies: %w", err)
+		}
+		policies = append(policies, existing...)
+	}
+	if req.PolicyDocument != "" {
+		policies = append(policies, &models.Policy{Name: candidatePolicyName, Document: req.PolicyDocument})
+	}
+
+	trace, err := s.evaluate(ctx, evalRequest{
+		principalID:   req.PrincipalID,
+		principalType: req.PrincipalType,
+		orgID:         orgID,
+		action:        req.Action,
+		resource:      req.Resource,
+		context:       evalContext,
+		explain:       true,
+		policies:      policies,
+		policiesOnly:  candidateOnly,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &AccessSimulationResult{
+		Allowed:  trace.Decision == authz.DecisionAllow,
+		Decision: string(trace.Decision),
+		Trace:    trace,
+		Policies: make([]PolicySimulation, 0, len(policies)),
+	}
+	for _, p := range policies {
+		sim := PolicySimulation{PolicyID: p.ID, Name: p.Name, Candidate: p.ID == ""}
+		sim.Decision, sim.Statements, err = s.eval.EvaluateStatements(p.Document, req.Action, req.Resource, evalContext)
+		if err != nil {
+			sim.Decision = authz.DecisionNotApplicable
+			sim.Error = err.Error()
+		}
+		result.Policies = append(result.Policies, sim)
+	}
+	return result, nil
+}
+
+// SimulatePolicy evaluates a policy document on its own against the
+// request's context and test cases
+func (s *authzService) SimulatePolicy(req *queries.PolicySimulationRequest) *queries.PolicySimulationResult {
+	result := &queries.PolicySimulationResult{
+		Valid:       true,
+		Errors:      []string{},
+		TestResults: []*queries.PolicyTestResult{},
+	}
+	if err := authz.ValidateDocument(req.PolicyDocument); err != nil {
+		result.Valid = false
+		result.Errors = append(result.Errors, err.Error())
+		return result
+	}
+
+	if req.Context != nil {
+		result.Evaluation = s.evaluatePolicy(req.PolicyDocument, req.Context.Action, req.Context.Resource, req.Context.EvalContext())
+	}
+
+	for _, tc := range req.TestCases {
+		action, resource := tc.Action, tc.Resource
+		if tc.Context != nil {
+			if action == "" {
+				action = tc.Context.Action
+			}
+			if resource == "" {
+				resource = tc.Context.Resource
+			}
+		}
+		evalContext := tc.Context.EvalContext()
+		if tc.Principal != "" {
+			evalContext["principal"] = tc.Principal
+		}
+
+		evaluation := s.evaluatePolicy(req.PolicyDocument, action, resource, evalContext)
+		testResult := &queries.PolicyTestResult{
+			TestCase: tc,
+			Result:   evaluation,
+			Passed:   strings.EqualFold(evaluation.Effect, tc.Expected),
+		}
+		if testResult.Passed {
+			testResult.Message = "Test passed"
+		} else {
+			testResult.Message = fmt.Sprintf("Expected %s, got %s", tc.Expected, evaluation.Effect)
+		}
+		result.TestResults = append(result.TestResults, testResult)
+	}
+	return result
+}
+
+// evaluatePolicy reports how a single policy document decides a request.
+// Effect is the policy's own answer; Decision applies the default deny.
+func (s *authzService) evaluatePolicy(document, action, resource string, evalContext map[string]interface{}) *queries.PolicyEvaluationResult {
+	decision, statements, err := s.eval.EvaluateStatements(document, action, resource, evalContext)
+	if err != nil {
+		return &queries.PolicyEvaluationResult{Effect: "error", Decision: "error", Reasons: []string{err.Error()}}
+	}
+
+	result := &queries.PolicyEvaluationResult{
+		Effect:     string(decision),
+		Decision:   string(decision),
+		Reasons:    []string{},
+		Statements: statements,
+	}
+	if decision == authz.DecisionNotApplicable {
+		result.Decision = string(authz.DecisionDeny)
+		result.Reasons = append(result.Reasons, fmt.Sprintf("No statement matched action %s on resource %s; denied by default", action, resource))
+	}
+	for _, st := range statements {
+		switch {
+		case st.Error != "":
+			result.Reasons = append(result.Reasons, fmt.Sprintf("Statement %s: condition error: %s", statementLabel(st), st.Error))
+		case st.Decisive:
+			result.Reasons = append(result.Reasons, fmt.Sprintf("Statement %s matched: %s", statementLabel(st), st.Effect))
+		case st.Matched:
+			result.Reasons = append(result.Reasons, fmt.Sprintf("Statement %s also matched but an earlier statement decided", statementLabel(st)))
+		}
+	}
+	return result
+}
+
+func statementLabel(st authz.StatementResult) string {
+	if st.Sid != "" {
+		return st.Sid
+	}
+	return fmt.Sprintf("#%d", st.Index)
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/config"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+const (
+	BreachedPasswordOff   = "off"
+	BreachedPasswordAPI   = "api"
+	BreachedPasswordBloom = "bloom"
+
+	breachedPasswordAPIWait = 3 * time.Second
+)
+
+// ErrPasswordBreached is returned for a password found in a known breach
+var ErrPasswordBreached = errors.New("password appears in a known data breach")
+
+// BreachedPasswordService screens new passwords against known breaches
+type BreachedPasswordService interface {
+	// Check returns ErrPasswordBreached when the password is known to be
+	// breached and the organization has not opted out. When no source can
+	// answer it logs the failure and accepts the password.
+	Check(ctx context.Context, orgID, password string) error
+}
+
+type breachedPasswordService struct {
+	mode     string
+	apiURL   string
+	minCount int
+	filter   *utils.BloomFilter
+	client   *http.Client
+	orgs     queries.OrganizationQueries
+	logger   *logger.Logger
+}
+
+// NewBreachedPasswordService creates a new instance of
+// BreachedPasswordService. The bloom filter of BREACHED_PASSWORD_BLOOM_FILE
+// is loaded into memory.
+func NewBreachedPasswordService(cfg *config.Config, orgs queries.OrganizationQueries, l *logger.Logger) (BreachedPasswordService, error) {
+	s := &breachedPasswordService{
+		mode:     cfg.BreachedPasswordCheck,
+		apiURL:   strings.TrimRight(cfg.BreachedPasswordAPIURL, "/"),
+		minCount: cfg.BreachedPasswordMinCount,
+		client:   &http.Client{Timeout: breachedPasswordAPIWait},
+		orgs:     orgs,
+		logger:   l,
+	}
+	if s.mode != BreachedPasswordOff && cfg.BreachedPasswordBloomFile != "" {
+		f, err := os.Open(cfg.BreachedPasswordBloomFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open breached password filter: %w", err)
+		}
+		defer f.Close()
+		if s.filter, err = utils.ReadBloomFilter(f); err != nil {
+			return nil, fmt.Errorf("breached password filter %s: %w", cfg.BreachedPasswordBloomFile, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *breachedPasswordService) Check(ctx context.Context, orgID, password string) error {
+	if s.mode == BreachedPasswordOff || password == "" {
+		return nil
+	}
+	if orgID != "" {
+		policy, err := s.orgs.WithContext(ctx).GetPasswordPolicy(orgID)
+		if err != nil && !strings.Contains(err.Error(), "not found") {
+			s.logger.Warn("Failed to load password policy of organization %s: %v", orgID, err)
+		}
+		if policy != nil && policy.BreachCheck != nil && !*policy.BreachCheck {
+			return nil
+		}
+	}
+
+	// SHA-1 because the breach corpus is published as SHA-1 hashes; it only
+	// selects what to look up and is never stored
+	sum := sha1.Sum([]byte(password))
+	if s.mode == BreachedPasswordAPI {
+		breached, err := s.queryAPI(ctx, strings.ToUpper(hex.EncodeToString(sum[:])))
+		if err == nil {
+			if breached {
+				return ErrPasswordBreached
+			}
+			return nil
+		}
+		if s.filter == nil {
+			// An API outage must not block signups and password changes
+			s.logger.Warn("Breached password check unavailable, accepting the password: %v", err)
+			return nil
+		}
+		s.logger.Warn("Breached password API unavailable, using the local filter: %v", err)
+	}
+	if s.filter != nil && s.filter.Contains(sum[:]) {
+		return ErrPasswordBreached
+	}
+	return nil
+}
+
+// queryAPI asks the range API for the hashes sharing the first five hex
+// digits of hash, so the password never leaves the server (k-anonymity)
+func (s *breachedPasswordService) queryAPI(ctx context.Context, hash string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.apiURL+"/range/"+hash[:5], nil)
+	if err != nil {
+		return false, err
+	}
+	// Padding hides the size of the response, which could hint at the prefix
+	req.Header.Set("Add-Padding", "true")
+	req.Header.Set("User-Agent", "monkeys-identity")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("range API responded %s", resp.Status)
+	}
+
+	suffix := hash[5:]
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		candidate, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.EqualFold(candidate, suffix) {
+			continue
+		}
+		// Padding entries have a count of 0
+		n, _ := strconv.Atoi(count)
+		return n > 0 && n >= s.minCount, nil
+	}
+	return false, scanner.Err()
+}
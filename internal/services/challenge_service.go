@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/config"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+const (
+	ChallengeProviderHCaptcha  = "hcaptcha"
+	ChallengeProviderTurnstile = "turnstile"
+	ChallengeProviderPoW       = "pow"
+
+	powChallengeTTL   = 5 * time.Minute
+	challengeHTTPWait = 5 * time.Second
+)
+
+var challengeVerifyURLs = map[string]string{
+	ChallengeProviderHCaptcha:  "https://api.hcaptcha.com/siteverify",
+	ChallengeProviderTurnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// Challenge tells a client what it has to solve. For CAPTCHA providers the
+// client renders the widget with SiteKey and sends the widget's token; for
+// proof-of-work it finds a Nonce such that SHA-256("<Prefix>:<Nonce>") starts
+// with Difficulty zero bits and sends "<ID>:<Nonce>".
+type Challenge struct {
+	Provider   string     `json:"provider"`
+	SiteKey    string     `json:"site_key,omitempty"`
+	ID         string     `json:"id,omitempty"`
+	Prefix     string     `json:"prefix,omitempty"`
+	Difficulty int        `json:"difficulty,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// ChallengeService issues and verifies bot challenges (CAPTCHA or
+// proof-of-work) for abuse-prone unauthenticated endpoints
+type ChallengeService interface {
+	Enabled() bool
+	Issue(ctx context.Context) (*Challenge, error)
+	Verify(ctx context.Context, response, remoteIP string) error
+}
+
+type challengeService struct {
+	provider   string
+	siteKey    string
+	secretKey  string
+	difficulty int
+	redis      redis.UniversalClient
+	http       *http.Client
+	logger     *logger.Logger
+}
+
+// NewChallengeService creates a new instance of ChallengeService. A CAPTCHA
+// provider configured without keys falls back to proof-of-work.
+func NewChallengeService(cfg *config.Config, redis redis.UniversalClient, l *logger.Logger) ChallengeService {
+	s := &challengeService{
+		provider:   cfg.ChallengeProvider,
+		siteKey:    cfg.ChallengeSiteKey,
+		secretKey:  cfg.ChallengeSecretKey,
+		difficulty: cfg.ChallengePoWDifficulty,
+		redis:      redis,
+		http:       &http.Client{Timeout: challengeHTTPWait},
+		logger:     l,
+	}
+	_, captcha := challengeVerifyURLs[s.provider]
+	switch {
+	case captcha && (s.siteKey == "" || s.secretKey == ""):
+		l.Warn("CHALLENGE_PROVIDER=%s is missing its site/secret key; falling back to proof-of-work", s.provider)
+		s.provider = ChallengeProviderPoW
+	case !captcha && s.provider != "" && s.provider != ChallengeProviderPoW:
+		l.Warn("Unknown CHALLENGE_PROVIDER %q; falling back to proof-of-work", s.provider)
+		s.provider = ChallengeProviderPoW
+	}
+	if s.difficulty <= 0 || s.difficulty > 32 {
+		s.difficulty = 20
+	}
+	return s
+}
+
+func powChallengeKey(id string) string { return "challenge:pow:" + id }
+
+// Enabled reports whether a challenge provider is configured
+func (s *challengeService) Enabled() bool {
+	return s.provider != ""
+}
+
+// Issue returns the challenge a client has to solve. Proof-of-work challenges
+// are single-use and expire after a few minutes.
+func (s *challengeService) Issue(ctx context.Context) (*Challenge, error) {
+	if s.provider != ChallengeProviderPoW {
+		return &Challenge{Provider: s.provider, SiteKey: s.siteKey}, nil
+	}
+
+	prefix := make([]byte, 16)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	challenge := &Challenge{
+		Provider:   ChallengeProviderPoW,
+		ID:         uuid.NewString(),
+		Prefix:     hex.EncodeToString(prefix),
+		Difficulty: s.difficulty,
+	}
+	expiresAt := time.Now().Add(powChallengeTTL)
+	challenge.ExpiresAt = &expiresAt
+
+	value := fmt.Sprintf("%s:%d", challenge.Prefix, challenge.Difficulty)
+	if err := s.redis.Set(ctx, powChallengeKey(challenge.ID), value, powChallengeTTL).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+// Verify checks a client's challenge response
+func (s *challengeService) Verify(ctx context.Context, response, remoteIP string) error {
+	if response == "" {
+		return fmt.Errorf("challenge response is missing")
+	}
+	if s.provider == ChallengeProviderPoW {
+		return s.verifyPoW(ctx, response)
+	}
+	return s.verifyCaptcha(ctx, response, remoteIP)
+}
+
+func (s *challengeService) verifyPoW(ctx context.Context, response string) error {
+	id, nonce, ok := strings.Cut(response, ":")
+	if !ok || id == "" || nonce == "" {
+		return fmt.Errorf("malformed proof-of-work response")
+	}
+
+	// GetDel makes every challenge single-use, even for a wrong answer
+	stored, err := s.redis.GetDel(ctx, powChallengeKey(id)).Result()
+	if err == redis.Nil {
+		return fmt.Errorf("challenge expired or already used")
+	}
+	if err != nil {
+		return err
+	}
+
+	prefix, rawDifficulty, _ := strings.Cut(stored, ":")
+	difficulty, err := strconv.Atoi(rawDifficulty)
+	if err != nil {
+		return fmt.Errorf("corrupt challenge")
+	}
+
+	sum := sha256.Sum256([]byte(prefix + ":" + nonce))
+	if leadingZeroBits(sum[:]) < difficulty {
+		return fmt.Errorf("proof-of-work does not meet the difficulty")
+	}
+	return nil
+}
+
+// leadingZeroBits counts the zero bits at the start of b
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, x := range b {
+		if x != 0 {
+			return n + bits.LeadingZeros8(x)
+		}
+		n += 8
+	}
+	return n
+}
+
+func (s *challengeService) verifyCaptcha(ctx context.Context, token, remoteIP string) error {
+	form := url.Values{
+		"secret":   {s.secretKey},
+		"response": {token},
+		"remoteip": {remoteIP},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, challengeVerifyURLs[s.provider], strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("captcha verification unavailable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("captcha verification returned an invalid response: %w", err)
+	}
+	if !result.Success {
+		s.logger.Debug("Captcha verification failed: %v", result.ErrorCodes)
+		return fmt.Errorf("captcha verification failed")
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/detection"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// Limits of organizations' claims webhooks
+const (
+	MinClaimsWebhookTimeout = 100 * time.Millisecond
+	MaxClaimsWebhookTimeout = 3 * time.Second
+	// MaxClaimsWebhookCache caps how long a webhook answer is reused
+	MaxClaimsWebhookCache = time.Hour
+
+	// ClaimsWebhookEvent names the calls in the detection.EventHeader
+	ClaimsWebhookEvent = "token.issuing"
+
+	maxClaimsWebhookURL      = 2048
+	maxClaimsWebhookResponse = 16 << 10
+)
+
+var (
+	claimsNamespacePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.:/-]{0,98}[_.:/-]$`)
+
+	// claimsWebhookClient never follows redirects, so that a webhook cannot
+	// send its calls, and the user context in them, elsewhere
+	claimsWebhookClient = &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+)
+
+// ClaimsWebhookRequest is the JSON body posted to a claims webhook
+type ClaimsWebhookRequest struct {
+	Type           string            `json:"type"`
+	Test           bool              `json:"test,omitempty"`
+	OrganizationID string            `json:"organization_id"`
+	ClientID       string            `json:"client_id"`
+	GrantType      string            `json:"grant_type"`
+	Scope          string            `json:"scope"`
+	User           ClaimsWebhookUser `json:"user"`
+}
+
+// ClaimsWebhookUser is the user context sent to a claims webhook
+type ClaimsWebhookUser struct {
+	ID            string          `json:"id"`
+	Username      string          `json:"username"`
+	Email         string          `json:"email"`
+	EmailVerified bool            `json:"email_verified"`
+	DisplayName   string          `json:"display_name"`
+	Attributes    json.RawMessage `json:"attributes,omitempty"`
+}
+
+// ClaimsWebhookResponse is what a claims webhook answers: the claims to add
+// to each token, every one named under the webhook's namespace
+type ClaimsWebhookResponse struct {
+	AccessToken map[string]interface{} `json:"access_token,omitempty"`
+	IDToken     map[string]interface{} `json:"id_token,omitempty"`
+}
+
+// NewClaimsWebhookRequest describes the issuance of a token to a user
+func NewClaimsWebhookRequest(user *models.User, clientID, grantType, scope string) *ClaimsWebhookRequest {
+	req := &ClaimsWebhookRequest{
+		Type:           ClaimsWebhookEvent,
+		OrganizationID: user.OrganizationID,
+		ClientID:       clientID,
+		GrantType:      grantType,
+		Scope:          scope,
+		User: ClaimsWebhookUser{
+			ID:            user.ID,
+			Username:      user.Username,
+			Email:         user.Email,
+			EmailVerified: user.EmailVerified,
+			DisplayName:   user.DisplayName,
+		},
+	}
+	if json.Valid([]byte(user.Attributes)) {
+		req.User.Attributes = json.RawMessage(user.Attributes)
+	}
+	return req
+}
+
+// ValidateClaimsWebhook checks the configuration of a claims webhook
+func ValidateClaimsWebhook(hook *models.ClaimsWebhook) error {
+	u, err := url.Parse(hook.URL)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil || len(hook.URL) > maxClaimsWebhookURL {
+		return fmt.Errorf("url must be an https URL without credentials")
+	}
+	if !claimsNamespacePattern.MatchString(hook.Namespace) {
+		return fmt.Errorf("namespace must start with a letter, end with one of _.:/- and have at most 100 letters, digits or _.:/-, such as https://example.com/")
+	}
+	timeout := time.Duration(hook.TimeoutMS) * time.Millisecond
+	if timeout < MinClaimsWebhookTimeout || timeout > MaxClaimsWebhookTimeout {
+		return fmt.Errorf("timeout_ms must be between %d and %d",
+			MinClaimsWebhookTimeout.Milliseconds(), MaxClaimsWebhookTimeout.Milliseconds())
+	}
+	if hook.CacheSeconds < 0 || time.Duration(hook.CacheSeconds)*time.Second > MaxClaimsWebhookCache {
+		return fmt.Errorf("cache_seconds must be between 0 and %d", int(MaxClaimsWebhookCache.Seconds()))
+	}
+	return nil
+}
+
+// CallClaimsWebhook posts a request to a claims webhook, signed with its
+// secret, and returns its answer once validated. The call is abandoned after
+// the webhook's timeout.
+func CallClaimsWebhook(ctx context.Context, hook *models.ClaimsWebhook, req *ClaimsWebhookRequest) (*ClaimsWebhookResponse, error) {
+	if err := ValidateClaimsWebhook(hook); err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(hook.TimeoutMS)*time.Millisecond)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set("User-Agent", "Monkeys-IAM-Webhook")
+	httpReq.Header.Set(detection.EventHeader, ClaimsWebhookEvent)
+	httpReq.Header.Set(detection.SignatureHeader, detection.Sign(hook.Secret, time.Now(), body))
+
+	resp, err := claimsWebhookClient.Do(httpReq)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("webhook did not answer within %dms", hook.TimeoutMS)
+		}
+		return nil, fmt.Errorf("webhook call failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("webhook responded %s", resp.Status)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxClaimsWebhookResponse+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook answer: %v", err)
+	}
+	if len(raw) > maxClaimsWebhookResponse {
+		return nil, fmt.Errorf("webhook answer exceeds %d bytes", maxClaimsWebhookResponse)
+	}
+	var answer ClaimsWebhookResponse
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&answer); err != nil {
+		return nil, fmt.Errorf("webhook answer is not a claims object: %v", err)
+	}
+	for token, claims := range map[string]map[string]interface{}{
+		ClaimTokenAccess: answer.AccessToken, ClaimTokenID: answer.IDToken,
+	} {
+		if err := checkWebhookClaims(hook.Namespace, claims); err != nil {
+			return nil, fmt.Errorf("%s: %v", token, err)
+		}
+	}
+	return &answer, nil
+}
+
+// checkWebhookClaims checks that the claims a webhook answered for one token
+// are namespaced, not set by the server and within the size guards
+func checkWebhookClaims(namespace string, claims map[string]interface{}) error {
+	if len(claims) > MaxClaimRules {
+		return fmt.Errorf("at most %d claims are supported", MaxClaimRules)
+	}
+	for name := range claims {
+		if !strings.HasPrefix(name, namespace) || len(name) == len(namespace) {
+			return fmt.Errorf("claim %q is not under the namespace %s", name, namespace)
+		}
+		if len(name) > len(namespace)+64 {
+			return fmt.Errorf("claim %q is too long", name)
+		}
+		if reservedClaims[name] {
+			return fmt.Errorf("claim %s is set by the server", name)
+		}
+	}
+	if encoded, _ := json.Marshal(claims); len(encoded) > maxCustomClaimsBytes {
+		return fmt.Errorf("claims exceed %d bytes", maxCustomClaimsBytes)
+	}
+	return nil
+}
+
+// addWebhookClaims adds the answer of the organization's claims webhook to
+// custom claims. Mapped claims keep their value and the size guard of each
+// token still holds. A failed call is recorded on the webhook; tokens are
+// then issued without its claims, or refused when it fails closed.
+func (s *oidcService) addWebhookClaims(out *customClaims, sizes map[string]int, client *models.OAuthClient, userID, orgID, scope, grantType string) error {
+	if !s.config.ClaimsWebhooks {
+		return nil
+	}
+	hooks := s.queries.ClaimsWebhook
+	hook, err := hooks.GetWebhook(orgID)
+	if err != nil {
+		return err
+	}
+	if hook == nil || !hook.Enabled {
+		return nil
+	}
+
+	answer, err := s.webhookAnswer(hook, client, userID, orgID, scope, grantType)
+	if err != nil {
+		_ = hooks.RecordFailure(orgID, err.Error())
+		if hook.FailClosed {
+			return errors.New("server_error")
+		}
+		return nil
+	}
+	for token, claims := range map[string]map[string]interface{}{
+		ClaimTokenAccess: answer.AccessToken, ClaimTokenID: answer.IDToken,
+	} {
+		target := out.access
+		if token == ClaimTokenID {
+			target = out.id
+		}
+		for name, value := range claims {
+			if _, mapped := target[name]; mapped {
+				continue
+			}
+			encoded, err := json.Marshal(value)
+			if err != nil || sizes[token]+len(encoded) > maxCustomClaimsBytes {
+				continue
+			}
+			sizes[token] += len(encoded)
+			target[name] = value
+		}
+	}
+	return nil
+}
+
+// webhookAnswer calls the claims webhook, or reuses its answer for the same
+// user, client and scope while the webhook's cache lasts
+func (s *oidcService) webhookAnswer(hook *models.ClaimsWebhook, client *models.OAuthClient, userID, orgID, scope, grantType string) (*ClaimsWebhookResponse, error) {
+	hooks := s.queries.ClaimsWebhook
+	// Changing the webhook changes the key, leaving older answers unused
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		strconv.FormatInt(hook.UpdatedAt.UnixNano(), 10), client.ID, userID, grantType, scope,
+	}, "\x00")))
+	key := hex.EncodeToString(sum[:])
+	if hook.CacheSeconds > 0 {
+		if cached, err := hooks.GetCachedClaims(orgID, key); err == nil && cached != nil {
+			var answer ClaimsWebhookResponse
+			if json.Unmarshal(cached, &answer) == nil {
+				return &answer, nil
+			}
+		}
+	}
+
+	user, err := s.queries.User.GetUser(userID, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user for claims webhook: %v", err)
+	}
+	answer, err := CallClaimsWebhook(context.Background(), hook, NewClaimsWebhookRequest(user, client.ID, grantType, scope))
+	if err != nil {
+		return nil, err
+	}
+	if hook.CacheSeconds > 0 {
+		if encoded, err := json.Marshal(answer); err == nil {
+			_ = hooks.CacheClaims(orgID, key, encoded, time.Duration(hook.CacheSeconds)*time.Second)
+		}
+	}
+	return answer, nil
+}
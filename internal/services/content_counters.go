@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/jobs"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+const (
+	// contentCountersDirtyKey holds the IDs of content whose counters changed
+	// since the last flush
+	contentCountersDirtyKey = "content:counters:dirty"
+	// contentCountersPendingPrefix prefixes a hash of counter changes not yet
+	// flushed into the content's metadata
+	contentCountersPendingPrefix = "content:counters:pending:"
+	contentCountersFlushBatch    = 500
+
+	// CounterBookmarks counts the bookmarks of a content item; the other
+	// counters are the reaction types
+	CounterBookmarks = "bookmarks"
+)
+
+// ContentCounterService keeps the reaction and bookmark counts of content.
+// The reaction and bookmark tables are the source of truth; their counts are
+// denormalized into content metadata by a periodic flush, and Redis holds
+// the changes made since so that readers see live counts.
+type ContentCounterService interface {
+	// Add records a change of a counter. Failures are logged: the next
+	// flush of the item repairs its counts.
+	Add(ctx context.Context, contentID, counter string, delta int64)
+	// Counts returns the counts of an item: the flushed ones from its
+	// metadata plus the pending changes
+	Counts(ctx context.Context, item *models.ContentItem) map[string]int64
+	// Flush recounts every item with pending changes and returns how many
+	// were written
+	Flush(ctx context.Context) (int, error)
+	RegisterJobs(scheduler *jobs.Scheduler) error
+}
+
+type contentCounterService struct {
+	queries *queries.Queries
+	redis   redis.UniversalClient
+	logger  *logger.Logger
+}
+
+// NewContentCounterService creates a new instance of ContentCounterService
+func NewContentCounterService(q *queries.Queries, redis redis.UniversalClient, l *logger.Logger) ContentCounterService {
+	return &contentCounterService{queries: q, redis: redis, logger: l}
+}
+
+func (s *contentCounterService) Add(ctx context.Context, contentID, counter string, delta int64) {
+	pipe := s.redis.TxPipeline()
+	pipe.HIncrBy(ctx, contentCountersPendingPrefix+contentID, counter, delta)
+	pipe.SAdd(ctx, contentCountersDirtyKey, contentID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		s.logger.Warn("Failed to record %s counter change of content %s: %v", counter, contentID, err)
+	}
+}
+
+func (s *contentCounterService) Counts(ctx context.Context, item *models.ContentItem) map[string]int64 {
+	counts := map[string]int64{models.ReactionLike: 0, models.ReactionClap: 0, CounterBookmarks: 0}
+
+	var flushed struct {
+		Reactions map[string]int64 `json:"reactions"`
+		Bookmarks int64            `json:"bookmarks"`
+	}
+	if item.Metadata != "" {
+		if err := json.Unmarshal([]byte(item.Metadata), &flushed); err != nil {
+			s.logger.Warn("Unreadable metadata on content %s: %v", item.ID, err)
+		}
+	}
+	for reaction, n := range flushed.Reactions {
+		counts[reaction] = n
+	}
+	counts[CounterBookmarks] = flushed.Bookmarks
+
+	pending, err := s.redis.HGetAll(ctx, contentCountersPendingPrefix+item.ID).Result()
+	if err != nil {
+		s.logger.Warn("Failed to read pending counters of content %s: %v", item.ID, err)
+		return counts
+	}
+	for counter, raw := range pending {
+		if delta, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			counts[counter] += delta
+		}
+	}
+	for counter, n := range counts {
+		if n < 0 {
+			counts[counter] = 0
+		}
+	}
+	return counts
+}
+
+// Flush takes items off the dirty set, drops their pending changes and then
+// recounts them. A change recorded between the two is counted by the
+// recount and again as pending until the item's next flush, so live counts
+// may briefly run high but never drift.
+func (s *contentCounterService) Flush(ctx context.Context) (int, error) {
+	flushed := 0
+	for {
+		ids, err := s.redis.SPopN(ctx, contentCountersDirtyKey, contentCountersFlushBatch).Result()
+		if err != nil {
+			return flushed, fmt.Errorf("failed to take dirty content counters: %w", err)
+		}
+		if len(ids) == 0 {
+			return flushed, nil
+		}
+		for i, id := range ids {
+			if err := ctx.Err(); err != nil {
+				s.requeue(ids[i:])
+				return flushed, err
+			}
+			if err := s.redis.Del(ctx, contentCountersPendingPrefix+id).Err(); err != nil {
+				s.requeue(ids[i:])
+				return flushed, fmt.Errorf("failed to clear pending counters: %w", err)
+			}
+			if err := s.queries.Content.WithContext(ctx).RecountEngagement(id); err != nil {
+				s.logger.Error("Failed to recount engagement of content %s: %v", id, err)
+				s.requeue(ids[i : i+1])
+				continue
+			}
+			flushed++
+		}
+	}
+}
+
+// requeue marks items dirty again so that the next flush retries them
+func (s *contentCounterService) requeue(ids []string) {
+	members := make([]interface{}, len(ids))
+	for i, id := range ids {
+		members[i] = id
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.redis.SAdd(ctx, contentCountersDirtyKey, members...).Err(); err != nil {
+		s.logger.Error("Failed to requeue %d content counters: %v", len(ids), err)
+	}
+}
+
+// RegisterJobs schedules the flush every minute
+func (s *contentCounterService) RegisterJobs(scheduler *jobs.Scheduler) error {
+	return scheduler.Register(jobs.Job{
+		Name:        "content_counter_flush",
+		Description: "Write reaction and bookmark counts of recently changed content into its metadata",
+		Schedule:    "@every 1m",
+		Timeout:     5 * time.Minute,
+		Run: func(ctx context.Context) error {
+			n, err := s.Flush(ctx)
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				s.logger.Debug("Flushed counters of %d content items", n)
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+const (
+	dataExportTTL          = 24 * time.Hour
+	dataExportBuildTimeout = 5 * time.Minute
+	dataExportAuditLimit   = 10000
+	dataExportContentLimit = 10000
+)
+
+// DataExportService assembles downloadable bundles of a user's personal data
+// (GDPR Art. 15/20). Bundles are built asynchronously and kept in Redis for a
+// limited time.
+type DataExportService interface {
+	StartExport(ctx context.Context, userID, organizationID, requestedBy string) (*models.DataExportJob, error)
+	GetJob(ctx context.Context, jobID string) (*models.DataExportJob, error)
+	ListJobs(ctx context.Context, userID string) ([]models.DataExportJob, error)
+	GetBundle(ctx context.Context, jobID string) ([]byte, error)
+	GetArchive(ctx context.Context, jobID string) ([]byte, error)
+}
+
+type dataExportService struct {
+	queries *queries.Queries
+	redis   redis.UniversalClient
+	logger  *logger.Logger
+}
+
+// NewDataExportService creates a new instance of DataExportService
+func NewDataExportService(q *queries.Queries, redis redis.UniversalClient, l *logger.Logger) DataExportService {
+	return &dataExportService{queries: q, redis: redis, logger: l}
+}
+
+func dataExportJobKey(jobID string) string    { return "data_export:" + jobID }
+func dataExportBundleKey(jobID string) string { return "data_export:" + jobID + ":bundle" }
+func dataExportUserKey(userID string) string  { return "data_export:user:" + userID }
+
+// StartExport records a pending export job and builds the bundle in the background
+func (s *dataExportService) StartExport(ctx context.Context, userID, organizationID, requestedBy string) (*models.DataExportJob, error) {
+	now := time.Now()
+	job := &models.DataExportJob{
+		ID:             uuid.NewString(),
+		UserID:         userID,
+		OrganizationID: organizationID,
+		RequestedBy:    requestedBy,
+		Status:         "pending",
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(dataExportTTL),
+	}
+
+	if err := s.saveJob(ctx, job); err != nil {
+		return nil, err
+	}
+	if err := s.redis.SAdd(ctx, dataExportUserKey(userID), job.ID).Err(); err != nil {
+		return nil, fmt.Errorf("failed to index export job: %w", err)
+	}
+	s.redis.Expire(ctx, dataExportUserKey(userID), dataExportTTL)
+
+	go s.run(*job)
+
+	return job, nil
+}
+
+// GetJob returns the current state of an export job
+func (s *dataExportService) GetJob(ctx context.Context, jobID string) (*models.DataExportJob, error) {
+	raw, err := s.redis.Get(ctx, dataExportJobKey(jobID)).Bytes()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("export job not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var job models.DataExportJob
+	if err := json.Unmarshal(raw, &job); err != nil {
+		return nil, fmt.Errorf("failed to decode export job: %w", err)
+	}
+	return &job, nil
+}
+
+// ListJobs returns the unexpired export jobs of a user, newest first
+func (s *dataExportService) ListJobs(ctx context.Context, userID string) ([]models.DataExportJob, error) {
+	ids, err := s.redis.SMembers(ctx, dataExportUserKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]models.DataExportJob, 0, len(ids))
+	for _, id := range ids {
+		job, err := s.GetJob(ctx, id)
+		if err != nil {
+			// Expired jobs drop out of the index lazily
+			s.redis.SRem(ctx, dataExportUserKey(userID), id)
+			continue
+		}
+		jobs = append(jobs, *job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.After(jobs[j].CreatedAt) })
+	return jobs, nil
+}
+
+// GetBundle returns the JSON bundle of a completed export job
+func (s *dataExportService) GetBundle(ctx context.Context, jobID string) ([]byte, error) {
+	job, err := s.GetJob(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != "completed" {
+		return nil, fmt.Errorf("export job is %s", job.Status)
+	}
+
+	bundle, err := s.redis.Get(ctx, dataExportBundleKey(jobID)).Bytes()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("export bundle not found")
+	}
+	return bundle, err
+}
+
+// GetArchive returns the bundle of a completed export job as a ZIP archive
+// with one JSON file per section
+func (s *dataExportService) GetArchive(ctx context.Context, jobID string) ([]byte, error) {
+	bundle, err := s.GetBundle(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(bundle, &sections); err != nil {
+		return nil, fmt.Errorf("failed to decode export bundle: %w", err)
+	}
+
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		w, err := zw.Create(name + ".json")
+		if err != nil {
+			return nil, err
+		}
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, sections[name], "", "  "); err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(pretty.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *dataExportService) run(job models.DataExportJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), dataExportBuildTimeout)
+	defer cancel()
+
+	job.Status = "running"
+	if err := s.saveJob(ctx, &job); err != nil {
+		s.logger.Error("Failed to update export job %s: %v", job.ID, err)
+	}
+
+	bundle, err := s.build(ctx, job)
+	if err == nil {
+		err = s.redis.Set(ctx, dataExportBundleKey(job.ID), bundle, time.Until(job.ExpiresAt)).Err()
+	}
+
+	completedAt := time.Now()
+	job.CompletedAt = &completedAt
+	if err != nil {
+		s.logger.Error("Data export %s for user %s failed: %v", job.ID, job.UserID, err)
+		job.Status = "failed"
+		job.Error = "Failed to assemble export bundle"
+	} else {
+		s.logger.Info("Data export %s for user %s completed", job.ID, job.UserID)
+		job.Status = "completed"
+	}
+
+	if err := s.saveJob(ctx, &job); err != nil {
+		s.logger.Error("Failed to update export job %s: %v", job.ID, err)
+	}
+}
+
+// build collects every section of the export bundle
+func (s *dataExportService) build(ctx context.Context, job models.DataExportJob) ([]byte, error) {
+	q := s.queries.WithContext(ctx)
+
+	user, err := q.User.GetUser(job.UserID, job.OrganizationID)
+	if err != nil {
+		return nil, fmt.Errorf("profile: %w", err)
+	}
+	user.PasswordHash = ""
+	user.TOTPSecret = ""
+	user.MFABackupCodes = nil
+
+	sessions, err := q.Session.ListUserSessions(job.UserID, job.OrganizationID)
+	if err != nil {
+		return nil, fmt.Errorf("sessions: %w", err)
+	}
+	for _, session := range sessions {
+		session.SessionToken = ""
+	}
+
+	roleAssignments, err := q.Role.ListPrincipalRoleAssignments(job.UserID, "user", job.OrganizationID)
+	if err != nil {
+		return nil, fmt.Errorf("role assignments: %w", err)
+	}
+
+	groupMemberships, err := q.Group.ListPrincipalGroupMemberships(job.UserID, "user", job.OrganizationID)
+	if err != nil {
+		return nil, fmt.Errorf("group memberships: %w", err)
+	}
+
+	content, err := q.Content.ListContent(queries.ListParams{Limit: dataExportContentLimit}, job.OrganizationID, job.UserID, "")
+	if err != nil {
+		return nil, fmt.Errorf("content items: %w", err)
+	}
+
+	auditEvents, err := q.Audit.GetAuditEventsReferencingUser(job.UserID, job.OrganizationID, dataExportAuditLimit)
+	if err != nil {
+		return nil, fmt.Errorf("audit events: %w", err)
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"export": map[string]interface{}{
+			"job_id":          job.ID,
+			"user_id":         job.UserID,
+			"organization_id": job.OrganizationID,
+			"generated_at":    time.Now(),
+		},
+		"profile":           user,
+		"sessions":          emptyIfNil(sessions),
+		"role_assignments":  emptyIfNil(roleAssignments),
+		"group_memberships": emptyIfNil(groupMemberships),
+		"content_items":     emptyIfNil(content.Items),
+		"audit_events":      emptyIfNil(auditEvents),
+	})
+}
+
+func (s *dataExportService) saveJob(ctx context.Context, job *models.DataExportJob) error {
+	raw, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(job.ExpiresAt)
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	if err := s.redis.Set(ctx, dataExportJobKey(job.ID), raw, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save export job: %w", err)
+	}
+	return nil
+}
+
+// emptyIfNil keeps nil slices from being encoded as JSON null
+func emptyIfNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
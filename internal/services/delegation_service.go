@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/authz"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+// MaxDelegatedTokenLifetime bounds the tokens a service account mints from
+// a delegation grant, and so how long a revoked grant must be remembered
+const MaxDelegatedTokenLifetime = 15 * time.Minute
+
+var (
+	// ErrDelegationNotGranted is returned when the user has no active grant
+	// to the service account covering the requested actions
+	ErrDelegationNotGranted = errors.New("the user has not delegated these actions to the service account")
+	// ErrInvalidDelegatedAction is returned for actions that cannot be
+	// delegated
+	ErrInvalidDelegatedAction = errors.New("action cannot be delegated")
+)
+
+func delegationRevokedKey(grantID string) string {
+	return "delegation_revoked:" + grantID
+}
+
+// DelegationRevoked reports whether a delegation grant was revoked while
+// tokens minted from it may still be valid. Like the token blacklist it
+// fails open when Redis is unavailable.
+func DelegationRevoked(ctx context.Context, redis redis.UniversalClient, grantID string) bool {
+	n, err := redis.Exists(ctx, delegationRevokedKey(grantID)).Result()
+	return err == nil && n > 0
+}
+
+// DelegationService manages the consents of users for service accounts to
+// act on their behalf. Backend jobs use them to perform listed actions for
+// a user, e.g. publishing scheduled content, with tokens that carry both
+// identities. Giving, revoking and using a grant is audited.
+type DelegationService interface {
+	// Grant records the consent of grant.UserID, replacing an active grant
+	// to the same service account
+	Grant(ctx context.Context, grant *models.DelegationGrant) error
+	// Revoke revokes an active grant. userID, when set, must be the user
+	// who gave it; revokedBy is recorded on the audit event.
+	Revoke(ctx context.Context, id, organizationID, userID, revokedBy string) (*models.DelegationGrant, error)
+	// Authorize returns the active grant of the user to the service
+	// account and the actions a token may carry: those requested, which
+	// the grant must all cover, or every action of the grant
+	Authorize(ctx context.Context, serviceAccountID, userID, organizationID string, actions []string) (*models.DelegationGrant, []string, error)
+}
+
+type delegationService struct {
+	queries *queries.Queries
+	redis   redis.UniversalClient
+	audit   AuditService
+	logger  *logger.Logger
+}
+
+// NewDelegationService creates a new instance of DelegationService
+func NewDelegationService(q *queries.Queries, redis redis.UniversalClient, audit AuditService, l *logger.Logger) DelegationService {
+	return &delegationService{queries: q, redis: redis, audit: audit, logger: l}
+}
+
+func (s *delegationService) Grant(ctx context.Context, grant *models.DelegationGrant) error {
+	if len(grant.Actions) == 0 {
+		return ErrInvalidDelegatedAction
+	}
+	for _, action := range grant.Actions {
+		if !authz.IsDelegableAction(action) {
+			return ErrInvalidDelegatedAction
+		}
+	}
+	if err := s.queries.Delegation.WithContext(ctx).PutGrant(grant); err != nil {
+		return err
+	}
+	s.auditGrant(ctx, "delegation_grant", grant, grant.UserID, map[string]interface{}{
+		"actions":    grant.Actions,
+		"expires_at": grant.ExpiresAt,
+	})
+	return nil
+}
+
+func (s *delegationService) Revoke(ctx context.Context, id, organizationID, userID, revokedBy string) (*models.DelegationGrant, error) {
+	grant, err := s.queries.Delegation.WithContext(ctx).RevokeGrant(id, organizationID, userID)
+	if err != nil {
+		return nil, err
+	}
+	// Tokens already minted stop working at once
+	if err := s.redis.Set(ctx, delegationRevokedKey(grant.ID), "revoked", MaxDelegatedTokenLifetime).Err(); err != nil {
+		s.logger.Error("Failed to record revocation of delegation grant %s: %v", grant.ID, err)
+	}
+	s.auditGrant(ctx, "delegation_revoke", grant, revokedBy, map[string]interface{}{"user_id": grant.UserID})
+	return grant, nil
+}
+
+func (s *delegationService) Authorize(ctx context.Context, serviceAccountID, userID, organizationID string, actions []string) (*models.DelegationGrant, []string, error) {
+	grant, err := s.queries.Delegation.WithContext(ctx).GetActiveGrant(userID, serviceAccountID, organizationID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, nil, ErrDelegationNotGranted
+		}
+		return nil, nil, err
+	}
+	if len(actions) == 0 {
+		return grant, grant.Actions, nil
+	}
+	for _, action := range actions {
+		if !containsString(grant.Actions, action) {
+			return nil, nil, ErrDelegationNotGranted
+		}
+	}
+	return grant, actions, nil
+}
+
+func (s *delegationService) auditGrant(ctx context.Context, action string, grant *models.DelegationGrant, actorID string, details map[string]interface{}) {
+	raw, _ := json.Marshal(details)
+	s.audit.LogEvent(ctx, models.AuditEvent{
+		OrganizationID:    grant.OrganizationID,
+		PrincipalID:       utils.StringPtr(actorID),
+		PrincipalType:     utils.StringPtr("user"),
+		Action:            action,
+		ResourceType:      utils.StringPtr("service_account"),
+		ResourceID:        utils.StringPtr(grant.ServiceAccountID),
+		Result:            "success",
+		AdditionalContext: string(raw),
+		Severity:          "info",
+	})
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+const (
+	// MaxDirectoryUsers caps the users, and separately the groups, one run
+	// reads from a directory
+	MaxDirectoryUsers = 50000
+
+	scimPageSize     = 100
+	scimRequestWait  = 30 * time.Second
+	scimMaxPageBytes = 10 << 20
+)
+
+// directorySource reads the users and groups of an external directory
+type directorySource interface {
+	// Users returns the raw user records of the directory
+	Users(ctx context.Context) ([]map[string]interface{}, error)
+	// Groups returns the groups of the directory with the IDs of their
+	// member users
+	Groups(ctx context.Context) ([]directoryGroup, error)
+}
+
+// directoryGroup is a group read from a directory
+type directoryGroup struct {
+	ExternalID string
+	Name       string
+	Members    []string
+}
+
+// newDirectorySource returns the client of a sync's source
+func newDirectorySource(sync *models.DirectorySync) (directorySource, error) {
+	switch sync.SourceType {
+	case models.DirectorySourceSCIM:
+		return &scimSource{
+			baseURL: strings.TrimRight(sync.BaseURL, "/"),
+			token:   sync.Token,
+			client: &http.Client{
+				Timeout: scimRequestWait,
+				// The bearer token must not follow a redirect elsewhere
+				CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported directory source %q", sync.SourceType)
+}
+
+// scimSource pulls from a SCIM 2.0 service provider (RFC 7644), such as the
+// SCIM API of an HR system
+type scimSource struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// scimListResponse is a page of a SCIM list
+type scimListResponse struct {
+	TotalResults int               `json:"totalResults"`
+	ItemsPerPage int               `json:"itemsPerPage"`
+	Resources    []json.RawMessage `json:"Resources"`
+}
+
+func (s *scimSource) Users(ctx context.Context) ([]map[string]interface{}, error) {
+	var users []map[string]interface{}
+	err := s.list(ctx, "Users", func(raw json.RawMessage) error {
+		var user map[string]interface{}
+		if err := json.Unmarshal(raw, &user); err != nil {
+			return fmt.Errorf("invalid SCIM user: %v", err)
+		}
+		users = append(users, user)
+		return nil
+	})
+	return users, err
+}
+
+func (s *scimSource) Groups(ctx context.Context) ([]directoryGroup, error) {
+	var groups []directoryGroup
+	err := s.list(ctx, "Groups", func(raw json.RawMessage) error {
+		var group struct {
+			ID          string `json:"id"`
+			DisplayName string `json:"displayName"`
+			Members     []struct {
+				Value string `json:"value"`
+				Type  string `json:"type"`
+			} `json:"members"`
+		}
+		if err := json.Unmarshal(raw, &group); err != nil {
+			return fmt.Errorf("invalid SCIM group: %v", err)
+		}
+		g := directoryGroup{ExternalID: group.ID, Name: group.DisplayName}
+		for _, m := range group.Members {
+			// Nested groups are not flattened; only users become members
+			if m.Value != "" && (m.Type == "" || strings.EqualFold(m.Type, "User")) {
+				g.Members = append(g.Members, m.Value)
+			}
+		}
+		groups = append(groups, g)
+		return nil
+	})
+	return groups, err
+}
+
+// list reads every page of a SCIM resource type
+func (s *scimSource) list(ctx context.Context, resource string, each func(json.RawMessage) error) error {
+	read := 0
+	for start := 1; ; {
+		page, err := s.page(ctx, resource, start)
+		if err != nil {
+			return err
+		}
+		for _, raw := range page.Resources {
+			if read++; read > MaxDirectoryUsers {
+				return fmt.Errorf("the directory has more than %d %s", MaxDirectoryUsers, strings.ToLower(resource))
+			}
+			if err := each(raw); err != nil {
+				return err
+			}
+		}
+		start += len(page.Resources)
+		if len(page.Resources) == 0 || start > page.TotalResults {
+			return nil
+		}
+	}
+}
+
+func (s *scimSource) page(ctx context.Context, resource string, start int) (*scimListResponse, error) {
+	query := url.Values{"startIndex": {strconv.Itoa(start)}, "count": {strconv.Itoa(scimPageSize)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"/"+resource+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("Accept", "application/scim+json, application/json")
+	req.Header.Set("User-Agent", "Monkeys-IAM-Directory-Sync")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the directory: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("the directory answered %s to GET /%s", resp.Status, resource)
+	}
+
+	var page scimListResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, scimMaxPageBytes)).Decode(&page); err != nil {
+		return nil, fmt.Errorf("invalid SCIM list of %s: %v", resource, err)
+	}
+	return &page, nil
+}
+
+// directoryUser is a user of a directory, mapped to local fields
+type directoryUser struct {
+	ExternalID  string
+	Username    string
+	Email       string
+	DisplayName string
+	Active      bool
+	// Attributes holds the mapped attributes; nil values remove them
+	Attributes map[string]interface{}
+}
+
+// mapDirectoryUser applies an attribute mapping to a raw user record. Fields
+// without a mapping take their SCIM default: userName, the primary email and
+// displayName or name.formatted.
+func mapDirectoryUser(raw map[string]interface{}, mapping map[string]string) (*directoryUser, error) {
+	u := &directoryUser{Active: true, Attributes: map[string]interface{}{}}
+	u.ExternalID = pathString(raw, "id")
+	if u.ExternalID == "" {
+		return nil, fmt.Errorf("user record has no id")
+	}
+	if active, ok := raw["active"].(bool); ok {
+		u.Active = active
+	}
+
+	u.Username = pathString(raw, "userName")
+	if path, ok := mapping["username"]; ok {
+		u.Username = pathString(raw, path)
+	}
+	u.Email = primaryEmail(raw)
+	if path, ok := mapping["email"]; ok {
+		u.Email = pathString(raw, path)
+	}
+	u.Email = strings.ToLower(strings.TrimSpace(u.Email))
+	u.DisplayName = pathString(raw, "displayName")
+	if u.DisplayName == "" {
+		u.DisplayName = pathString(raw, "name.formatted")
+	}
+	if path, ok := mapping["display_name"]; ok {
+		u.DisplayName = pathString(raw, path)
+	}
+
+	for target, path := range mapping {
+		if name, ok := strings.CutPrefix(target, "attributes."); ok {
+			u.Attributes[name] = lookupPath(raw, path)
+		}
+	}
+	return u, nil
+}
+
+// primaryEmail returns the primary email of a SCIM user, or its first one
+func primaryEmail(raw map[string]interface{}) string {
+	emails, _ := raw["emails"].([]interface{})
+	first := ""
+	for _, e := range emails {
+		email, _ := e.(map[string]interface{})
+		value, _ := email["value"].(string)
+		if primary, _ := email["primary"].(bool); primary && value != "" {
+			return value
+		}
+		if first == "" {
+			first = value
+		}
+	}
+	return first
+}
+
+// lookupPath returns the value at a dot-separated path of a record, or nil.
+// Keys may themselves contain dots, as SCIM extension schemas do
+// ("urn:ietf:params:scim:schemas:extension:enterprise:2.0:User.department"):
+// the longest key matching the start of the path wins. A number indexes an
+// array.
+func lookupPath(value interface{}, path string) interface{} {
+	for path != "" {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			key, rest, found := "", "", false
+			for i := len(path); i > 0; i-- {
+				if i < len(path) && path[i] != '.' {
+					continue
+				}
+				if _, ok := v[path[:i]]; ok {
+					key, rest, found = path[:i], strings.TrimPrefix(path[i:], "."), true
+					break
+				}
+			}
+			if !found {
+				return nil
+			}
+			value, path = v[key], rest
+		case []interface{}:
+			head, rest, _ := strings.Cut(path, ".")
+			i, err := strconv.Atoi(head)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil
+			}
+			value, path = v[i], rest
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// pathString returns the value at a path when it is a string, or a number
+// or boolean written as one
+func pathString(raw map[string]interface{}, path string) string {
+	switch v := lookupPath(raw, path).(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
@@ -0,0 +1,851 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-monkeys/monkeys-identity/internal/events"
+	"github.com/the-monkeys/monkeys-identity/internal/jobs"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/password"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+// Limits of organizations' directory syncs
+const (
+	MinDirectorySyncInterval = 15
+	MaxDirectorySyncInterval = 7 * 24 * 60
+	MaxDirectoryMappings     = 50
+
+	// MaxDirectorySyncChanges caps the changes a run records; its summary
+	// still counts all of them
+	MaxDirectorySyncChanges = 1000
+
+	directorySyncTimeout = 30 * time.Minute
+	// directorySyncReason is the suspension reason of users the sync
+	// deactivated
+	directorySyncReason = "directory_sync"
+)
+
+// ErrDirectorySyncRunning is returned when a run of the organization's
+// directory sync is already in progress
+var ErrDirectorySyncRunning = errors.New("a directory sync is already running")
+
+var directoryAttributePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,63}$`)
+
+// DirectorySyncService reconciles the users and group memberships of
+// organizations with their external directory. Users are matched by the
+// directory's ID, then adopted by email or created; users removed or
+// deactivated in the directory are suspended. Groups are matched by ID,
+// then adopted by name or created, and their members follow the directory;
+// only users the sync manages are removed from them.
+type DirectorySyncService interface {
+	// StartRun starts a run of an organization's sync in the background and
+	// returns it while it is running
+	StartRun(ctx context.Context, organizationID, triggeredBy string, dryRun bool) (*models.DirectorySyncRun, error)
+	// RunDue runs the enabled syncs whose interval has passed
+	RunDue(ctx context.Context) error
+	RegisterJobs(scheduler *jobs.Scheduler) error
+}
+
+type directorySyncService struct {
+	queries *queries.Queries
+	bus     events.Bus
+	audit   AuditService
+	logger  *logger.Logger
+}
+
+// NewDirectorySyncService creates a new instance of DirectorySyncService
+func NewDirectorySyncService(q *queries.Queries, bus events.Bus, audit AuditService, l *logger.Logger) DirectorySyncService {
+	return &directorySyncService{
+		queries: q,
+		bus:     bus,
+		audit:   audit,
+		logger:  l,
+	}
+}
+
+// ValidateDirectorySync checks the configuration of a directory sync
+func ValidateDirectorySync(sync *models.DirectorySync) error {
+	if sync.SourceType != models.DirectorySourceSCIM {
+		return fmt.Errorf("source_type must be %q; LDAP directories are not supported", models.DirectorySourceSCIM)
+	}
+	u, err := url.Parse(sync.BaseURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil || u.RawQuery != "" || len(sync.BaseURL) > 2048 {
+		return fmt.Errorf("base_url must be an https URL without credentials or query, such as https://hr.example.com/scim/v2")
+	}
+	if sync.Token == "" {
+		return fmt.Errorf("token is required")
+	}
+	if sync.IntervalMinutes < MinDirectorySyncInterval || sync.IntervalMinutes > MaxDirectorySyncInterval {
+		return fmt.Errorf("interval_minutes must be between %d and %d", MinDirectorySyncInterval, MaxDirectorySyncInterval)
+	}
+	if len(sync.AttributeMapping) > MaxDirectoryMappings {
+		return fmt.Errorf("attribute_mapping supports at most %d entries", MaxDirectoryMappings)
+	}
+	for target, path := range sync.AttributeMapping {
+		name, isAttribute := strings.CutPrefix(target, "attributes.")
+		switch {
+		case target == "username", target == "email", target == "display_name":
+		case isAttribute && directoryAttributePattern.MatchString(name):
+		default:
+			return fmt.Errorf("attribute_mapping: %q must be username, email, display_name or attributes.<name>", target)
+		}
+		if path == "" || len(path) > 256 {
+			return fmt.Errorf("attribute_mapping: the path of %s must have 1 to 256 characters", target)
+		}
+	}
+	return nil
+}
+
+// RegisterJobs schedules the check for due syncs
+func (s *directorySyncService) RegisterJobs(scheduler *jobs.Scheduler) error {
+	return scheduler.Register(jobs.Job{
+		Name:        "directory_sync",
+		Description: "Reconcile users and group memberships with the external directories whose sync interval has passed",
+		Schedule:    "@every 5m",
+		Timeout:     directorySyncTimeout,
+		Run:         s.RunDue,
+	})
+}
+
+func (s *directorySyncService) RunDue(ctx context.Context) error {
+	syncs, err := s.queries.DirectorySync.WithContext(ctx).ListDueSyncs()
+	if err != nil {
+		return err
+	}
+	for i := range syncs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		sync := &syncs[i]
+		run, err := s.begin(ctx, sync, "schedule", "", false)
+		if errors.Is(err, ErrDirectorySyncRunning) {
+			continue
+		}
+		if err != nil {
+			// One organization failing must not hold back the others
+			s.logger.Error("Failed to start the directory sync of organization %s: %v", sync.OrganizationID, err)
+			continue
+		}
+		s.execute(ctx, sync, run)
+	}
+	return nil
+}
+
+func (s *directorySyncService) StartRun(ctx context.Context, organizationID, triggeredBy string, dryRun bool) (*models.DirectorySyncRun, error) {
+	sync, err := s.queries.DirectorySync.WithContext(ctx).GetSync(organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if sync == nil {
+		return nil, fmt.Errorf("directory sync not found")
+	}
+	run, err := s.begin(ctx, sync, "manual", triggeredBy, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	started := *run
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), directorySyncTimeout)
+		defer cancel()
+		s.execute(ctx, sync, run)
+	}()
+	return &started, nil
+}
+
+// begin takes the organization's sync lock and records a new run
+func (s *directorySyncService) begin(ctx context.Context, sync *models.DirectorySync, trigger, triggeredBy string, dryRun bool) (*models.DirectorySyncRun, error) {
+	q := s.queries.DirectorySync.WithContext(ctx)
+	locked, err := q.LockSync(sync.OrganizationID, directorySyncTimeout+5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, ErrDirectorySyncRunning
+	}
+	run := &models.DirectorySyncRun{
+		OrganizationID: sync.OrganizationID,
+		Trigger:        trigger,
+		DryRun:         dryRun,
+		Status:         "running",
+	}
+	if triggeredBy != "" {
+		run.TriggeredBy = &triggeredBy
+	}
+	if err := q.CreateRun(run); err != nil {
+		_ = q.UnlockSync(sync.OrganizationID)
+		return nil, err
+	}
+	return run, nil
+}
+
+// execute runs a sync, then records and audits its outcome
+func (s *directorySyncService) execute(ctx context.Context, sync *models.DirectorySync, run *models.DirectorySyncRun) {
+	q := s.queries.WithContext(ctx)
+	defer func() {
+		if err := s.queries.DirectorySync.UnlockSync(sync.OrganizationID); err != nil {
+			s.logger.Warn("Failed to release the directory sync lock of organization %s: %v", sync.OrganizationID, err)
+		}
+	}()
+
+	r := &directoryReconciler{
+		service: s,
+		ctx:     ctx,
+		q:       q,
+		sync:    sync,
+		run:     run,
+		userIDs: map[string]string{},
+		managed: map[string]bool{},
+	}
+	run.Status = "succeeded"
+	if err := r.reconcile(); err != nil {
+		run.Status = "failed"
+		run.Error = err.Error()
+	}
+	// The outcome is recorded even when the run ran out of time
+	finish := s.queries.WithContext(context.Background())
+	if err := finish.DirectorySync.FinishRun(run); err != nil {
+		s.logger.Error("Failed to record directory sync run %s: %v", run.ID, err)
+	}
+	if !run.DryRun {
+		if err := finish.DirectorySync.MarkSyncRun(sync.OrganizationID); err != nil {
+			s.logger.Warn("Failed to mark the directory sync of organization %s as run: %v", sync.OrganizationID, err)
+		}
+	}
+
+	details, _ := json.Marshal(map[string]interface{}{
+		"run_id":  run.ID,
+		"trigger": run.Trigger,
+		"dry_run": run.DryRun,
+		"summary": run.Summary,
+		"error":   run.Error,
+	})
+	event := models.AuditEvent{
+		OrganizationID:    sync.OrganizationID,
+		PrincipalType:     utils.StringPtr("system"),
+		Action:            "directory_sync_run",
+		ResourceType:      utils.StringPtr("directory_sync"),
+		ResourceID:        utils.StringPtr(sync.OrganizationID),
+		Result:            "success",
+		AdditionalContext: string(details),
+		Severity:          "info",
+	}
+	if run.Status == "failed" {
+		event.Result = "failure"
+		event.Severity = "warn"
+	}
+	s.audit.LogEvent(context.Background(), event)
+
+	sum := run.Summary
+	s.logger.Info("Directory sync run %s of organization %s %s (dry run: %t): %d users created, %d updated, %d deactivated, %d reactivated; %d groups created, %d updated; %d memberships added, %d removed; %d errors",
+		run.ID, sync.OrganizationID, run.Status, run.DryRun, sum.UsersCreated, sum.UsersUpdated, sum.UsersDeactivated,
+		sum.UsersReactivated, sum.GroupsCreated, sum.GroupsUpdated, sum.MembershipsAdded, sum.MembershipsRemoved, sum.Errors)
+}
+
+// directoryReconciler carries the state of one run
+type directoryReconciler struct {
+	service *directorySyncService
+	ctx     context.Context
+	q       *queries.Queries
+	sync    *models.DirectorySync
+	run     *models.DirectorySyncRun
+
+	// userIDs maps the directory's user IDs to local ones; users a dry run
+	// would create map to a placeholder
+	userIDs map[string]string
+	// managed holds the local IDs of the users the sync links
+	managed map[string]bool
+}
+
+func (r *directoryReconciler) reconcile() error {
+	source, err := newDirectorySource(r.sync)
+	if err != nil {
+		return err
+	}
+	users, err := source.Users(r.ctx)
+	if err != nil {
+		return err
+	}
+	var groups []directoryGroup
+	if r.sync.SyncGroups {
+		if groups, err = source.Groups(r.ctx); err != nil {
+			return err
+		}
+	}
+	r.run.Summary.SourceUsers = len(users)
+	r.run.Summary.SourceGroups = len(groups)
+
+	if err := r.reconcileUsers(users); err != nil {
+		return err
+	}
+	if r.sync.SyncGroups {
+		return r.reconcileGroups(groups)
+	}
+	return nil
+}
+
+func (r *directoryReconciler) reconcileUsers(raw []map[string]interface{}) error {
+	links, err := r.q.DirectorySync.ListLinks(r.sync.OrganizationID, "user")
+	if err != nil {
+		return err
+	}
+	if len(raw) == 0 && len(links) > 0 {
+		// An empty answer is far more likely a broken source than everyone
+		// having left
+		return fmt.Errorf("the directory returned no users; refusing to deactivate the %d users it synced", len(links))
+	}
+	linked := make(map[string]models.DirectorySyncLink, len(links))
+	for _, link := range links {
+		linked[link.ExternalID] = link
+		r.managed[link.LocalID] = true
+	}
+
+	seen := map[string]bool{}
+	for _, record := range raw {
+		if err := r.ctx.Err(); err != nil {
+			return err
+		}
+		u, err := mapDirectoryUser(record, r.sync.AttributeMapping)
+		if err != nil {
+			r.fail("user", "", "", err)
+			continue
+		}
+		if seen[u.ExternalID] {
+			r.fail("user", u.ExternalID, "", errors.New("the directory lists this user twice"))
+			continue
+		}
+		seen[u.ExternalID] = true
+		link, isLinked := linked[u.ExternalID]
+		if err := r.reconcileUser(u, link, isLinked); err != nil {
+			r.fail("user", u.ExternalID, u.Email, err)
+		}
+	}
+
+	if !r.sync.DeactivateMissing {
+		return nil
+	}
+	for _, link := range links {
+		if seen[link.ExternalID] || link.Deactivated {
+			continue
+		}
+		user, err := r.q.User.GetUser(link.LocalID, r.sync.OrganizationID)
+		if err != nil {
+			r.fail("user", link.ExternalID, "", err)
+			continue
+		}
+		if err := r.deactivate(user, link, "removed from the directory"); err != nil {
+			r.fail("user", link.ExternalID, user.Email, err)
+		}
+	}
+	return nil
+}
+
+// reconcileUser creates, adopts or updates the local user of a directory
+// user, then follows its active flag
+func (r *directoryReconciler) reconcileUser(u *directoryUser, link models.DirectorySyncLink, isLinked bool) error {
+	orgID := r.sync.OrganizationID
+	var user *models.User
+	if isLinked {
+		found, err := r.q.User.GetUser(link.LocalID, orgID)
+		if err != nil && !strings.Contains(err.Error(), "not found") {
+			return err
+		}
+		if found == nil {
+			// The local user was deleted; link the directory user anew
+			if !r.run.DryRun {
+				if err := r.q.DirectorySync.DeleteLink(orgID, "user", u.ExternalID); err != nil {
+					return err
+				}
+			}
+			delete(r.managed, link.LocalID)
+			isLinked = false
+		}
+		user = found
+	}
+	if user == nil && u.Email != "" {
+		found, err := r.q.Auth.GetUserByEmail(u.Email, orgID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if found != nil {
+			// GetUserByEmail leaves out attributes
+			if user, err = r.q.User.GetUser(found.ID, orgID); err != nil {
+				return err
+			}
+		}
+	}
+	if user == nil {
+		if !u.Active {
+			return nil
+		}
+		return r.createUser(u)
+	}
+	if !isLinked {
+		link = models.DirectorySyncLink{Kind: "user", ExternalID: u.ExternalID, LocalID: user.ID}
+		if !r.run.DryRun {
+			if err := r.q.DirectorySync.PutLink(orgID, &link); err != nil {
+				return err
+			}
+		}
+		r.managed[user.ID] = true
+	}
+	r.userIDs[u.ExternalID] = user.ID
+
+	if err := r.updateUser(u, user); err != nil {
+		return err
+	}
+	switch {
+	case !u.Active && user.Status == "active":
+		return r.deactivate(user, link, "deactivated in the directory")
+	case u.Active && link.Deactivated:
+		return r.reactivate(user, link)
+	}
+	return nil
+}
+
+func (r *directoryReconciler) createUser(u *directoryUser) error {
+	orgID := r.sync.OrganizationID
+	if !importEmailPattern.MatchString(u.Email) {
+		return fmt.Errorf("invalid email address %q", u.Email)
+	}
+	name := u.Username
+	if name == "" {
+		name = u.Email
+	}
+	username := usernameFromEmail(name)
+	taken, err := r.q.User.UsernameExists(username, orgID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		username = strings.TrimRight(username[:min(len(username), 91)], "-_.") + "-" + randomHex(4)
+	}
+	attributes, _, err := mergeDirectoryAttributes("{}", u.Attributes)
+	if err != nil {
+		return err
+	}
+
+	r.run.Summary.UsersCreated++
+	change := models.DirectorySyncChange{Action: "create", Kind: "user", ExternalID: u.ExternalID, Name: u.Email}
+	if r.run.DryRun {
+		r.userIDs[u.ExternalID] = "pending:" + u.ExternalID
+		r.record(change)
+		return nil
+	}
+
+	// Synced users sign in through SSO or reset their password; until then
+	// the account has a random one nobody knows
+	hash, err := password.Hash(randomHex(24))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	user := &models.User{
+		ID:             uuid.NewString(),
+		Username:       username,
+		Email:          u.Email,
+		DisplayName:    u.DisplayName,
+		OrganizationID: orgID,
+		PasswordHash:   hash,
+		Attributes:     attributes,
+		Status:         "active",
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := r.q.User.CreateUser(user); err != nil {
+		r.run.Summary.UsersCreated--
+		return fmt.Errorf("failed to create user: %v", err)
+	}
+	r.userIDs[u.ExternalID] = user.ID
+	r.managed[user.ID] = true
+	if err := r.q.DirectorySync.PutLink(orgID, &models.DirectorySyncLink{Kind: "user", ExternalID: u.ExternalID, LocalID: user.ID}); err != nil {
+		return err
+	}
+
+	var roleID string
+	if err := r.q.Role.EnsureRoleByName("user", "Standard user with basic access", orgID, &roleID); err != nil {
+		r.service.logger.Warn("Directory sync of organization %s: failed to ensure default role: %v", orgID, err)
+	} else if err := r.q.Role.AssignRole(&models.RoleAssignment{
+		ID:            uuid.NewString(),
+		RoleID:        roleID,
+		PrincipalID:   user.ID,
+		PrincipalType: "user",
+	}, orgID); err != nil {
+		r.service.logger.Warn("Directory sync of organization %s: failed to assign role to %s: %v", orgID, user.ID, err)
+	}
+	r.service.bus.Publish(r.ctx, events.Event{
+		Type:           events.UserCreated,
+		OrganizationID: orgID,
+		Subject:        user.ID,
+		Data:           map[string]interface{}{"source": "directory_sync"},
+	})
+	change.ID = user.ID
+	r.record(change)
+	return nil
+}
+
+// updateUser brings the email, display name and mapped attributes of a
+// user in line with the directory. Usernames are only set on creation.
+func (r *directoryReconciler) updateUser(u *directoryUser, user *models.User) error {
+	orgID := r.sync.OrganizationID
+	updates := map[string]interface{}{}
+	var fields []string
+	if u.Email != "" && u.Email != strings.ToLower(user.Email) {
+		if !importEmailPattern.MatchString(u.Email) {
+			return fmt.Errorf("invalid email address %q", u.Email)
+		}
+		if other, err := r.q.Auth.GetUserByEmail(u.Email, orgID); err == nil && other.ID != user.ID {
+			return fmt.Errorf("email %s is used by another user", u.Email)
+		}
+		updates["email"] = u.Email
+		updates["email_verified"] = false
+		fields = append(fields, "email")
+	}
+	if u.DisplayName != "" && u.DisplayName != user.DisplayName {
+		updates["display_name"] = u.DisplayName
+		fields = append(fields, "display_name")
+	}
+	attributes, changed, err := mergeDirectoryAttributes(user.Attributes, u.Attributes)
+	if err != nil {
+		return err
+	}
+	if changed {
+		fields = append(fields, "attributes")
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	r.run.Summary.UsersUpdated++
+	if !r.run.DryRun {
+		if err := r.q.User.UpdateUserProfile(user.ID, orgID, updates); err != nil {
+			r.run.Summary.UsersUpdated--
+			return fmt.Errorf("failed to update user: %v", err)
+		}
+		if changed {
+			if err := r.q.User.UpdateUserAttributes(user.ID, orgID, attributes); err != nil {
+				r.run.Summary.UsersUpdated--
+				return fmt.Errorf("failed to update user attributes: %v", err)
+			}
+		}
+	}
+	r.record(models.DirectorySyncChange{Action: "update", Kind: "user", ExternalID: u.ExternalID, ID: user.ID, Name: user.Email, Fields: fields})
+	return nil
+}
+
+// deactivate suspends a user the directory removed or deactivated, and ends
+// their sessions
+func (r *directoryReconciler) deactivate(user *models.User, link models.DirectorySyncLink, why string) error {
+	orgID := r.sync.OrganizationID
+	if user.Status != "active" {
+		return nil
+	}
+	r.run.Summary.UsersDeactivated++
+	change := models.DirectorySyncChange{Action: "deactivate", Kind: "user", ExternalID: link.ExternalID, ID: user.ID, Name: user.Email}
+	if r.run.DryRun {
+		r.record(change)
+		return nil
+	}
+	if err := r.q.User.SuspendUser(user.ID, orgID, directorySyncReason); err != nil {
+		r.run.Summary.UsersDeactivated--
+		return fmt.Errorf("failed to suspend user: %v", err)
+	}
+	link.Deactivated = true
+	if err := r.q.DirectorySync.PutLink(orgID, &link); err != nil {
+		return err
+	}
+	if err := r.q.User.RevokeUserSessions(user.ID, orgID); err != nil {
+		r.service.logger.Warn("Failed to revoke the sessions of deactivated user %s: %v", user.ID, err)
+	}
+	details, _ := json.Marshal(map[string]interface{}{"reason": directorySyncReason, "detail": why, "external_id": link.ExternalID})
+	r.service.audit.LogEvent(r.ctx, models.AuditEvent{
+		OrganizationID:    orgID,
+		PrincipalType:     utils.StringPtr("system"),
+		Action:            "suspend_directory_user",
+		ResourceType:      utils.StringPtr("user"),
+		ResourceID:        utils.StringPtr(user.ID),
+		Result:            "success",
+		AdditionalContext: string(details),
+		Severity:          "warn",
+	})
+	r.service.bus.Publish(r.ctx, events.Event{
+		Type:           events.UserSuspended,
+		OrganizationID: orgID,
+		Subject:        user.ID,
+		Data:           map[string]interface{}{"reason": directorySyncReason},
+	})
+	r.record(change)
+	return nil
+}
+
+// reactivate lifts the suspension of a user the sync deactivated. Users
+// suspended for other reasons stay suspended.
+func (r *directoryReconciler) reactivate(user *models.User, link models.DirectorySyncLink) error {
+	orgID := r.sync.OrganizationID
+	link.Deactivated = false
+	if user.Status == "suspended" {
+		r.run.Summary.UsersReactivated++
+		change := models.DirectorySyncChange{Action: "reactivate", Kind: "user", ExternalID: link.ExternalID, ID: user.ID, Name: user.Email}
+		if r.run.DryRun {
+			r.record(change)
+			return nil
+		}
+		if err := r.q.User.ActivateUser(user.ID, orgID); err != nil {
+			r.run.Summary.UsersReactivated--
+			return fmt.Errorf("failed to reactivate user: %v", err)
+		}
+		r.record(change)
+	}
+	if r.run.DryRun {
+		return nil
+	}
+	return r.q.DirectorySync.PutLink(orgID, &link)
+}
+
+func (r *directoryReconciler) reconcileGroups(groups []directoryGroup) error {
+	orgID := r.sync.OrganizationID
+	links, err := r.q.DirectorySync.ListLinks(orgID, "group")
+	if err != nil {
+		return err
+	}
+	linked := make(map[string]string, len(links))
+	for _, link := range links {
+		linked[link.ExternalID] = link.LocalID
+	}
+
+	seen := map[string]bool{}
+	for _, g := range groups {
+		if err := r.ctx.Err(); err != nil {
+			return err
+		}
+		g.Name = strings.TrimSpace(g.Name)
+		switch {
+		case g.ExternalID == "":
+			r.fail("group", "", g.Name, errors.New("group record has no id"))
+			continue
+		case g.Name == "":
+			r.fail("group", g.ExternalID, "", errors.New("group record has no displayName"))
+			continue
+		case seen[g.ExternalID]:
+			r.fail("group", g.ExternalID, g.Name, errors.New("the directory lists this group twice"))
+			continue
+		}
+		seen[g.ExternalID] = true
+		groupID, err := r.reconcileGroup(g, linked[g.ExternalID])
+		if err != nil {
+			r.fail("group", g.ExternalID, g.Name, err)
+			continue
+		}
+		if err := r.reconcileMembers(g, groupID); err != nil {
+			r.fail("group", g.ExternalID, g.Name, err)
+		}
+	}
+	// Groups removed from the directory are left to admins
+	return nil
+}
+
+// reconcileGroup creates, adopts or renames the local group of a directory
+// group and returns its ID, which is empty when a dry run would create it
+func (r *directoryReconciler) reconcileGroup(g directoryGroup, localID string) (string, error) {
+	orgID := r.sync.OrganizationID
+	var group *models.Group
+	if localID != "" {
+		found, err := r.q.Group.GetGroup(localID, orgID)
+		if err != nil && !strings.Contains(err.Error(), "not found") {
+			return "", err
+		}
+		group = found
+	}
+	linked := group != nil
+	if group == nil {
+		found, err := r.q.Group.GetGroupByName(g.Name, orgID)
+		if err != nil && !strings.Contains(err.Error(), "not found") {
+			return "", err
+		}
+		group = found
+	}
+
+	if group == nil {
+		r.run.Summary.GroupsCreated++
+		change := models.DirectorySyncChange{Action: "create", Kind: "group", ExternalID: g.ExternalID, Name: g.Name}
+		if r.run.DryRun {
+			r.record(change)
+			return "", nil
+		}
+		group = &models.Group{
+			ID:             uuid.NewString(),
+			Name:           g.Name,
+			Description:    "Synchronized from the organization's directory",
+			OrganizationID: orgID,
+			GroupType:      "standard",
+			Attributes:     "{}",
+			Status:         "active",
+		}
+		if err := r.q.Group.CreateGroup(group); err != nil {
+			r.run.Summary.GroupsCreated--
+			return "", fmt.Errorf("failed to create group: %v", err)
+		}
+		change.ID = group.ID
+		r.record(change)
+	} else if group.Name != g.Name {
+		r.run.Summary.GroupsUpdated++
+		change := models.DirectorySyncChange{Action: "update", Kind: "group", ExternalID: g.ExternalID, ID: group.ID, Name: g.Name, Fields: []string{"name"}}
+		if !r.run.DryRun {
+			renamed := *group
+			renamed.Name = g.Name
+			if err := r.q.Group.UpdateGroup(&renamed, orgID); err != nil {
+				r.run.Summary.GroupsUpdated--
+				return "", fmt.Errorf("failed to rename group: %v", err)
+			}
+		}
+		r.record(change)
+	}
+
+	if !linked && !r.run.DryRun {
+		link := models.DirectorySyncLink{Kind: "group", ExternalID: g.ExternalID, LocalID: group.ID}
+		if err := r.q.DirectorySync.PutLink(orgID, &link); err != nil {
+			return "", err
+		}
+	}
+	return group.ID, nil
+}
+
+// reconcileMembers adds the directory members of a group and removes the
+// synced users the directory no longer lists. Additions breaking a
+// separation-of-duties rule are refused, as they are through the API.
+func (r *directoryReconciler) reconcileMembers(g directoryGroup, groupID string) error {
+	orgID := r.sync.OrganizationID
+	current := map[string]bool{}
+	var groupRoles []string
+	if groupID != "" {
+		members, err := r.q.Group.ListGroupMembers(groupID, orgID)
+		if err != nil {
+			return err
+		}
+		for _, m := range members {
+			if m.PrincipalType == "user" {
+				current[m.PrincipalID] = true
+			}
+		}
+		if groupRoles, err = r.q.Role.GetGroupRoleNames(groupID, orgID); err != nil {
+			return err
+		}
+	}
+
+	desired := map[string]bool{}
+	for _, externalID := range g.Members {
+		userID, ok := r.userIDs[externalID]
+		if !ok {
+			// Not a user of this run, such as one without an email
+			continue
+		}
+		desired[userID] = true
+		if current[userID] {
+			continue
+		}
+		if !strings.HasPrefix(userID, "pending:") && len(groupRoles) > 0 {
+			conflicts, err := SoDConflicts(r.ctx, r.q, orgID, userID, "user", groupRoles)
+			if err != nil {
+				return err
+			}
+			if len(conflicts) > 0 {
+				r.fail("membership", externalID, g.Name, fmt.Errorf("violates separation-of-duties rule %q", conflicts[0].Rule))
+				continue
+			}
+		}
+		r.run.Summary.MembershipsAdded++
+		change := models.DirectorySyncChange{Action: "add_member", Kind: "membership", ExternalID: externalID, ID: groupID, Name: g.Name}
+		if !r.run.DryRun {
+			membership := &models.GroupMembership{
+				ID:            uuid.NewString(),
+				GroupID:       groupID,
+				PrincipalID:   userID,
+				PrincipalType: "user",
+				RoleInGroup:   "member",
+			}
+			if err := r.q.Group.AddGroupMember(membership, orgID); err != nil {
+				r.run.Summary.MembershipsAdded--
+				r.fail("membership", externalID, g.Name, fmt.Errorf("failed to add member: %v", err))
+				continue
+			}
+		}
+		r.record(change)
+	}
+
+	removed := make([]string, 0)
+	for userID := range current {
+		if !desired[userID] && r.managed[userID] {
+			removed = append(removed, userID)
+		}
+	}
+	sort.Strings(removed)
+	for _, userID := range removed {
+		r.run.Summary.MembershipsRemoved++
+		change := models.DirectorySyncChange{Action: "remove_member", Kind: "membership", ID: groupID, Name: g.Name, Fields: []string{userID}}
+		if !r.run.DryRun {
+			if err := r.q.Group.RemoveGroupMember(groupID, orgID, userID, "user"); err != nil {
+				r.run.Summary.MembershipsRemoved--
+				r.fail("membership", "", g.Name, fmt.Errorf("failed to remove member %s: %v", userID, err))
+				continue
+			}
+		}
+		r.record(change)
+	}
+	return nil
+}
+
+// record keeps a change of the run, up to MaxDirectorySyncChanges
+func (r *directoryReconciler) record(change models.DirectorySyncChange) {
+	if len(r.run.Changes) < MaxDirectorySyncChanges {
+		r.run.Changes = append(r.run.Changes, change)
+	}
+}
+
+// fail counts and records an error on one user, group or membership; the
+// run goes on with the others
+func (r *directoryReconciler) fail(kind, externalID, name string, err error) {
+	r.run.Summary.Errors++
+	r.record(models.DirectorySyncChange{Action: "error", Kind: kind, ExternalID: externalID, Name: name, Error: err.Error()})
+}
+
+// mergeDirectoryAttributes applies mapped attributes to a user's attributes
+// document, removing those the directory left empty. It returns the new
+// document and whether it changed.
+func mergeDirectoryAttributes(doc string, mapped map[string]interface{}) (string, bool, error) {
+	attributes := map[string]interface{}{}
+	if strings.TrimSpace(doc) != "" {
+		if err := json.Unmarshal([]byte(doc), &attributes); err != nil {
+			return "", false, fmt.Errorf("invalid user attributes: %v", err)
+		}
+	}
+	changed := false
+	for name, value := range mapped {
+		old, present := attributes[name]
+		switch {
+		case value == nil && present:
+			delete(attributes, name)
+			changed = true
+		case value != nil && (!present || !reflect.DeepEqual(old, value)):
+			attributes[name] = value
+			changed = true
+		}
+	}
+	encoded, err := json.Marshal(attributes)
+	if err != nil {
+		return "", false, err
+	}
+	return string(encoded), changed, nil
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/authz"
+)
+
+// EffectivePermissions is everything a principal is allowed in an
+// organization, per resource pattern, with where each grant comes from
+type EffectivePermissions struct {
+	PrincipalID   string                      `json:"principal_id"`
+	PrincipalType string                      `json:"principal_type"`
+	Permissions   []authz.EffectivePermission `json:"permissions"`
+	// Denied lists explicit denies, which override the permissions they
+	// overlap
+	Denied      []authz.EffectivePermission `json:"denied"`
+	GeneratedAt time.Time                   `json:"generated_at"`
+}
+
+// EffectivePermissions resolves the policies (with the role and group they
+// come through), resource permissions and shares of a principal. With a
+// service, only its actions, e.g. "blog" for "blog:post:read", are listed.
+func (s *authzService) EffectivePermissions(ctx context.Context, orgID, principalID, principalType, service string) (*EffectivePermissions, error) {
+	policyGrants, err := s.queries.Policy.WithContext(ctx).GetPrincipalPolicyGrants(principalID, principalType, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch policies: %w", err)
+	}
+	var rules []authz.Rule
+	for _, pg := range policyGrants {
+		policyRules, err := authz.PolicyRules(pg.Document, authz.Grant{
+			Source:    authz.SourcePolicy,
+			ID:        pg.PolicyID,
+			Name:      pg.PolicyName,
+			RoleID:    pg.RoleID,
+			RoleName:  pg.RoleName,
+			GroupID:   pg.GroupID,
+			GroupName: pg.GroupName,
+		})
+		if err != nil {
+			continue // Malformed policies never apply
+		}
+		rules = append(rules, policyRules...)
+	}
+
+	perms, err := s.queries.Resource.WithContext(ctx).GetPrincipalPermissions(principalID, principalType, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch resource permissions: %w", err)
+	}
+	for _, rp := range perms {
+		effect := authz.DecisionAllow
+		if strings.EqualFold(rp.Effect, "deny") {
+			effect = authz.DecisionDeny
+		}
+		rules = append(rules, authz.Rule{
+			Effect:    effect,
+			Actions:   []string{rp.Permission},
+			Resources: []string{rp.ResourceID},
+			Grant:     authz.Grant{Source: authz.SourceResourcePermission, ID: rp.ID, Name: rp.Permission},
+		})
+	}
+
+	shares, err := s.queries.Resource.WithContext(ctx).GetPrincipalShares(principalID, principalType, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch resource shares: %w", err)
+	}
+	now := time.Now()
+	for _, share := range shares {
+		if shareExpired(share, now) {
+			continue
+		}
+		// As enforced by authorizeShare
+		grant := authz.Grant{Source: authz.SourceResourceShare, ID: share.ID, Name: share.AccessLevel}
+		var actions []string
+		switch strings.ToLower(share.AccessLevel) {
+		case "owner":
+			actions = []string{"*"}
+		case "editor":
+			actions = []string{"*"}
+			grant.Except = []string{"delete", "share"}
+		case "viewer":
+			actions = []string{"list", "read", "view"}
+		default:
+			continue
+		}
+		rules = append(rules, authz.Rule{Effect: authz.DecisionAllow, Actions: actions, Resources: []string{share.ResourceID}, Grant: grant})
+	}
+
+	allowed, denied := authz.Effective(rules)
+	if service != "" {
+		allowed, denied = authz.FilterService(allowed, service), authz.FilterService(denied, service)
+	}
+	return &EffectivePermissions{
+		PrincipalID:   principalID,
+		PrincipalType: principalType,
+		Permissions:   allowed,
+		Denied:        denied,
+		GeneratedAt:   time.Now(),
+	}, nil
+}
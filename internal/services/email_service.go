@@ -2,41 +2,80 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"mime"
+	"net"
 	"net/smtp"
+	"net/url"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/the-monkeys/monkeys-identity/internal/config"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
 	"github.com/the-monkeys/monkeys-identity/pkg/logger"
 )
 
 type EmailService interface {
-	SendVerificationEmail(toEmail, username, token string) error
-	SendPasswordResetEmail(toEmail, username, token string) error
+	SendVerificationEmail(orgID, toEmail, username, token string) error
+	SendPasswordResetEmail(orgID, toEmail, username, token string) error
+	SendInvitationEmail(orgID, toEmail, username, organizationName, token string) error
+	SendOTPEmail(toEmail, username, code string, expiresIn time.Duration) error
+	SendCollaboratorInvitationEmail(toEmail, inviterName, contentTitle, token string, expiresIn time.Duration) error
+	SendInactivityWarningEmail(orgID, toEmail, username string, suspendAt time.Time) error
+	SendGuestShareEmail(toEmail, sharerName, itemTitle, token string, expiresAt time.Time) error
+
+	// PreviewEmail renders a template with the sample values of its kind
+	PreviewEmail(orgID string, tmpl *models.EmailTemplate) (*RenderedEmail, error)
+	// SendTestEmail sends a preview of a template to toEmail
+	SendTestEmail(orgID, toEmail string, tmpl *models.EmailTemplate) error
+
+	// Ping checks that the SMTP server greets and answers EHLO, without
+	// sending anything
+	Ping(ctx context.Context) error
 }
 
 type emailService struct {
-	config *config.Config
-	logger *logger.Logger
+	config  *config.Config
+	queries *queries.Queries
+	logger  *logger.Logger
 }
 
-func NewEmailService(cfg *config.Config, logger *logger.Logger) EmailService {
+// NewEmailService creates the email service. Organization templates are
+// read through q; with a nil q every organization gets the built-in emails.
+func NewEmailService(cfg *config.Config, q *queries.Queries, logger *logger.Logger) EmailService {
 	return &emailService{
-		config: cfg,
-		logger: logger,
+		config:  cfg,
+		queries: q,
+		logger:  logger,
+	}
+}
+
+// message formats an email, as multipart/alternative when it has a text
+// body besides the HTML one
+func (s *emailService) message(to, subject, htmlBody, textBody string) string {
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\n",
+		s.config.SMTPFrom,
+		to,
+		mime.QEncoding.Encode("UTF-8", subject))
+	if textBody == "" {
+		return msg + "Content-Type: text/html; charset=UTF-8\r\n\r\n" + htmlBody
 	}
+
+	boundary := randomHex(16)
+	return msg + fmt.Sprintf("Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary) +
+		"--" + boundary + "\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n" + textBody + "\r\n" +
+		"--" + boundary + "\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n" + htmlBody + "\r\n" +
+		"--" + boundary + "--\r\n"
 }
 
-func (s *emailService) sendMail(to []string, subject string, body string) error {
+func (s *emailService) sendMail(to []string, subject, htmlBody, textBody string) error {
 	addr := fmt.Sprintf("%s:%d", s.config.SMTPHost, s.config.SMTPPort)
 
 	// Format message
-	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n%s",
-		s.config.SMTPFrom,
-		to[0],
-		subject,
-		body)
+	msg := s.message(to[0], subject, htmlBody, textBody)
 
 	// If credentials are provided, use the standard smtp.SendMail with PLAIN auth.
 	// For unauthenticated relays like Mailpit, dial manually and skip AUTH entirely.
@@ -91,10 +130,34 @@ func (s *emailService) sendMail(to []string, subject string, body string) error
 	return nil
 }
 
-func (s *emailService) SendVerificationEmail(toEmail, username, token string) error {
-	verificationLink := fmt.Sprintf("%s/verify-email?token=%s", s.config.FrontendURL, token)
+func (s *emailService) Ping(ctx context.Context) error {
+	addr := fmt.Sprintf("%s:%d", s.config.SMTPHost, s.config.SMTPPort)
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
 
-	tmpl := `
+	client, err := smtp.NewClient(conn, s.config.SMTPHost)
+	if err != nil {
+		return err
+	}
+	if err := client.Hello("localhost"); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// defaultEmailTemplates are the built-in emails of the kinds organizations
+// can reword, written in the same template language as theirs
+var defaultEmailTemplates = map[string]struct{ subject, html string }{
+	EmailKindVerification: {
+		subject: "Verify your email address - Monkeys Identity",
+		html: `
 		<!DOCTYPE html>
 		<html>
 		<head>
@@ -115,31 +178,250 @@ func (s *emailService) SendVerificationEmail(toEmail, username, token string) er
 			</div>
 		</body>
 		</html>
+	`,
+	},
+	EmailKindPasswordReset: {
+		subject: "Password Reset - Monkeys Identity",
+		html: `
+		<!DOCTYPE html>
+		<html>
+		<head>
+			<style>
+				body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+				.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+				.btn { display: inline-block; padding: 10px 20px; background-color: #28a745; color: #fff !important; text-decoration: none; border-radius: 5px; }
+			</style>
+		</head>
+		<body>
+			<div class="container">
+				<h2>Password Reset Request</h2>
+				<p>Hello {{.Username}},</p>
+				<p>We received a request to reset your password for your Monkeys Identity account. Click the button below to set a new password:</p>
+				<p><a href="{{.ResetLink}}" class="btn">Reset Password</a></p>
+				<p>If the button doesn't work, you can copy and paste this link into your browser:</p>
+				<p>{{.ResetLink}}</p>
+				<p>This link will expire in 1 hour.</p>
+				<p>If you didn't request a password reset, you can safely ignore this email.</p>
+			</div>
+		</body>
+		</html>
+	`,
+	},
+	EmailKindInvitation: {
+		subject: "You're invited to {{.OrganizationName}} - Monkeys Identity",
+		html: `
+		<!DOCTYPE html>
+		<html>
+		<head>
+			<style>
+				body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+				.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+				.btn { display: inline-block; padding: 10px 20px; background-color: #007bff; color: #fff !important; text-decoration: none; border-radius: 5px; }
+			</style>
+		</head>
+		<body>
+			<div class="container">
+				<h2>You have been invited to {{.OrganizationName}}</h2>
+				<p>Hello {{.Username}},</p>
+				<p>An administrator created a Monkeys Identity account for you. Click the button below to choose your password:</p>
+				<p><a href="{{.SetupLink}}" class="btn">Set Password</a></p>
+				<p>If the button doesn't work, you can copy and paste this link into your browser:</p>
+				<p>{{.SetupLink}}</p>
+				<p>This link will expire in 72 hours.</p>
+			</div>
+		</body>
+		</html>
+	`,
+	},
+	EmailKindInactivityWarning: {
+		subject: "Your account is inactive - Monkeys Identity",
+		html: `
+		<!DOCTYPE html>
+		<html>
+		<head>
+			<style>
+				body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+				.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+				.btn { display: inline-block; padding: 10px 20px; background-color: #007bff; color: #fff !important; text-decoration: none; border-radius: 5px; }
+			</style>
+		</head>
+		<body>
+			<div class="container">
+				<h2>Your account is inactive</h2>
+				<p>Hello {{.Username}},</p>
+				<p>You haven't signed in to Monkeys Identity for a while, so your organization has flagged your account as inactive.</p>
+				{{if .SuspendAt}}<p>Unless you sign in before {{.SuspendAt}}, your account will be suspended and an administrator will have to reactivate it.</p>{{end}}
+				<p><a href="{{.LoginLink}}" class="btn">Sign In</a></p>
+				<p>If you no longer need this account, you can ignore this email.</p>
+			</div>
+		</body>
+		</html>
+	`,
+	},
+}
+
+// sendTemplate sends an email of a kind organizations can reword
+func (s *emailService) sendTemplate(orgID, kind, toEmail string, data map[string]string) error {
+	email, err := s.render(orgID, kind, data)
+	if err != nil {
+		return err
+	}
+	return s.sendMail([]string{toEmail}, email.Subject, email.HTMLBody, email.TextBody)
+}
+
+// render fills in the organization's own template of a kind, falling back
+// to the built-in email when it has none or it fails to render
+func (s *emailService) render(orgID, kind string, data map[string]string) (*RenderedEmail, error) {
+	if tmpl := s.organizationTemplate(orgID, kind); tmpl != nil {
+		if _, ok := data["OrganizationName"]; !ok {
+			data["OrganizationName"] = s.organizationName(orgID)
+		}
+		email, err := renderEmailTemplate(tmpl, data)
+		if err == nil {
+			return email, nil
+		}
+		s.logger.Warn("Email template %s v%d of organization %s failed to render, sending the default: %v", kind, tmpl.Version, orgID, err)
+	}
+	return renderEmailTemplate(DefaultEmailTemplate(kind), data)
+}
+
+// organizationTemplate returns the current template of a kind of the
+// organization, or nil when the built-in email should be sent
+func (s *emailService) organizationTemplate(orgID, kind string) *models.EmailTemplate {
+	if s.queries == nil || orgID == "" {
+		return nil
+	}
+	tmpl, err := s.queries.EmailTemplate.GetCurrentTemplate(orgID, kind)
+	if err != nil {
+		s.logger.Warn("Failed to get email template %s of organization %s, sending the default: %v", kind, orgID, err)
+		return nil
+	}
+	return tmpl
+}
+
+func (s *emailService) organizationName(orgID string) string {
+	if s.queries == nil || orgID == "" {
+		return ""
+	}
+	org, err := s.queries.Organization.GetOrganization(orgID)
+	if err != nil {
+		s.logger.Warn("Failed to get organization %s for an email: %v", orgID, err)
+		return ""
+	}
+	return org.Name
+}
+
+// PreviewEmail renders a template with the sample values of its kind and
+// the organization's name
+func (s *emailService) PreviewEmail(orgID string, tmpl *models.EmailTemplate) (*RenderedEmail, error) {
+	sample, ok := EmailTemplateVariables[tmpl.Kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown email template kind %q", tmpl.Kind)
+	}
+	data := make(map[string]string, len(sample))
+	for name, value := range sample {
+		data[name] = value
+	}
+	if name := s.organizationName(orgID); name != "" {
+		data["OrganizationName"] = name
+	}
+	return renderEmailTemplate(tmpl, data)
+}
+
+// SendTestEmail sends a preview of a template, marked as a test
+func (s *emailService) SendTestEmail(orgID, toEmail string, tmpl *models.EmailTemplate) error {
+	email, err := s.PreviewEmail(orgID, tmpl)
+	if err != nil {
+		return err
+	}
+	return s.sendMail([]string{toEmail}, "[Test] "+email.Subject, email.HTMLBody, email.TextBody)
+}
+
+func (s *emailService) SendVerificationEmail(orgID, toEmail, username, token string) error {
+	return s.sendTemplate(orgID, EmailKindVerification, toEmail, map[string]string{
+		"Username":         username,
+		"VerificationLink": fmt.Sprintf("%s/verify-email?token=%s", s.config.FrontendURL, token),
+	})
+}
+
+func (s *emailService) SendPasswordResetEmail(orgID, toEmail, username, token string) error {
+	return s.sendTemplate(orgID, EmailKindPasswordReset, toEmail, map[string]string{
+		"Username":  username,
+		"ResetLink": fmt.Sprintf("%s/reset-password?token=%s", s.config.FrontendURL, token),
+	})
+}
+
+func (s *emailService) SendInvitationEmail(orgID, toEmail, username, organizationName, token string) error {
+	return s.sendTemplate(orgID, EmailKindInvitation, toEmail, map[string]string{
+		"Username":         username,
+		"OrganizationName": organizationName,
+		"SetupLink":        fmt.Sprintf("%s/reset-password?token=%s", s.config.FrontendURL, token),
+	})
+}
+
+// SendInactivityWarningEmail tells a user their account was flagged as
+// dormant and, unless suspendAt is zero, when it will be suspended
+func (s *emailService) SendInactivityWarningEmail(orgID, toEmail, username string, suspendAt time.Time) error {
+	var when string
+	if !suspendAt.IsZero() {
+		when = suspendAt.UTC().Format("January 2, 2006")
+	}
+	return s.sendTemplate(orgID, EmailKindInactivityWarning, toEmail, map[string]string{
+		"Username":  username,
+		"SuspendAt": when,
+		"LoginLink": fmt.Sprintf("%s/login", s.config.FrontendURL),
+	})
+}
+func (s *emailService) SendOTPEmail(toEmail, username, code string, expiresIn time.Duration) error {
+	tmpl := `
+		<!DOCTYPE html>
+		<html>
+		<head>
+			<style>
+				body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+				.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+				.code { font-size: 28px; font-weight: bold; letter-spacing: 6px; }
+			</style>
+		</head>
+		<body>
+			<div class="container">
+				<h2>Your verification code</h2>
+				<p>Hello {{.Username}},</p>
+				<p>Use the following code to finish signing in to Monkeys Identity:</p>
+				<p class="code">{{.Code}}</p>
+				<p>This code will expire in {{.Minutes}} minutes.</p>
+				<p>If you didn't try to sign in, someone may know your password. Change it as soon as possible.</p>
+			</div>
+		</body>
+		</html>
 	`
 
-	t, err := template.New("verification").Parse(tmpl)
+	t, err := template.New("otp").Parse(tmpl)
 	if err != nil {
 		return err
 	}
 
 	var body bytes.Buffer
 	err = t.Execute(&body, struct {
-		Username         string
-		VerificationLink string
+		Username string
+		Code     string
+		Minutes  int
 	}{
-		Username:         username,
-		VerificationLink: verificationLink,
+		Username: username,
+		Code:     code,
+		Minutes:  int(expiresIn / time.Minute),
 	})
 	if err != nil {
 		return err
 	}
 
-	return s.sendMail([]string{toEmail}, "Verify your email address - Monkeys Identity", body.String())
+	return s.sendMail([]string{toEmail}, "Your verification code - Monkeys Identity", body.String(), "")
 }
 
-func (s *emailService) SendPasswordResetEmail(toEmail, username, token string) error {
-	resetLink := fmt.Sprintf("%s/reset-password?token=%s", s.config.FrontendURL, token)
+func (s *emailService) SendCollaboratorInvitationEmail(toEmail, inviterName, contentTitle, token string, expiresIn time.Duration) error {
+	acceptLink := fmt.Sprintf("%s/content/invitations/accept?token=%s", s.config.FrontendURL, url.QueryEscape(token))
 
+	// Names and titles are chosen by users and escaped
 	tmpl := `
 		<!DOCTYPE html>
 		<html>
@@ -147,40 +429,97 @@ func (s *emailService) SendPasswordResetEmail(toEmail, username, token string) e
 			<style>
 				body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
 				.container { max-width: 600px; margin: 0 auto; padding: 20px; }
-				.btn { display: inline-block; padding: 10px 20px; background-color: #28a745; color: #fff !important; text-decoration: none; border-radius: 5px; }
+				.btn { display: inline-block; padding: 10px 20px; background-color: #007bff; color: #fff !important; text-decoration: none; border-radius: 5px; }
 			</style>
 		</head>
 		<body>
 			<div class="container">
-				<h2>Password Reset Request</h2>
-				<p>Hello {{.Username}},</p>
-				<p>We received a request to reset your password for your Monkeys Identity account. Click the button below to set a new password:</p>
-				<p><a href="{{.ResetLink}}" class="btn">Reset Password</a></p>
+				<h2>You have been invited to collaborate</h2>
+				<p>{{html .InviterName}} invited you to co-author <strong>{{html .ContentTitle}}</strong> on Monkeys Identity.</p>
+				<p>Sign in or create an account with this email address, then accept the invitation:</p>
+				<p><a href="{{.AcceptLink}}" class="btn">Accept Invitation</a></p>
 				<p>If the button doesn't work, you can copy and paste this link into your browser:</p>
-				<p>{{.ResetLink}}</p>
-				<p>This link will expire in 1 hour.</p>
-				<p>If you didn't request a password reset, you can safely ignore this email.</p>
+				<p>{{.AcceptLink}}</p>
+				<p>This invitation will expire in {{.Days}} days.</p>
+			</div>
+		</body>
+		</html>
+	`
+
+	t, err := template.New("collaborator_invitation").Parse(tmpl)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	err = t.Execute(&body, struct {
+		InviterName  string
+		ContentTitle string
+		AcceptLink   string
+		Days         int
+	}{
+		InviterName:  inviterName,
+		ContentTitle: contentTitle,
+		AcceptLink:   acceptLink,
+		Days:         int(expiresIn / (24 * time.Hour)),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.sendMail([]string{toEmail}, "You're invited to collaborate - Monkeys Identity", body.String(), "")
+}
+
+// SendGuestShareEmail gives someone outside the organization the link to
+// an item shared with them
+func (s *emailService) SendGuestShareEmail(toEmail, sharerName, itemTitle, token string, expiresAt time.Time) error {
+	openLink := fmt.Sprintf("%s/shared/guest?token=%s", s.config.FrontendURL, url.QueryEscape(token))
+
+	// Names and titles are chosen by users and escaped
+	tmpl := `
+		<!DOCTYPE html>
+		<html>
+		<head>
+			<style>
+				body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+				.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+				.btn { display: inline-block; padding: 10px 20px; background-color: #007bff; color: #fff !important; text-decoration: none; border-radius: 5px; }
+			</style>
+		</head>
+		<body>
+			<div class="container">
+				<h2>Something was shared with you</h2>
+				<p>{{html .SharerName}} shared <strong>{{html .ItemTitle}}</strong> with you on Monkeys Identity.</p>
+				<p>No account is needed to open it:</p>
+				<p><a href="{{.OpenLink}}" class="btn">Open</a></p>
+				<p>If the button doesn't work, you can copy and paste this link into your browser:</p>
+				<p>{{.OpenLink}}</p>
+				<p>The link works until {{.ExpiresAt}}. Don't forward it: anyone holding it gets the same access.</p>
 			</div>
 		</body>
 		</html>
 	`
 
-	t, err := template.New("reset").Parse(tmpl)
+	t, err := template.New("guest_share").Parse(tmpl)
 	if err != nil {
 		return err
 	}
 
 	var body bytes.Buffer
 	err = t.Execute(&body, struct {
-		Username  string
-		ResetLink string
+		SharerName string
+		ItemTitle  string
+		OpenLink   string
+		ExpiresAt  string
 	}{
-		Username:  username,
-		ResetLink: resetLink,
+		SharerName: sharerName,
+		ItemTitle:  itemTitle,
+		OpenLink:   openLink,
+		ExpiresAt:  expiresAt.UTC().Format("January 2, 2006"),
 	})
 	if err != nil {
 		return err
 	}
 
-	return s.sendMail([]string{toEmail}, "Password Reset - Monkeys Identity", body.String())
+	return s.sendMail([]string{toEmail}, "Shared with you - Monkeys Identity", body.String(), "")
 }
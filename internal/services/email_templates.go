@@ -0,0 +1,228 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// The kinds of email organizations can reword
+const (
+	EmailKindVerification      = "verification"
+	EmailKindPasswordReset     = "password_reset"
+	EmailKindInvitation        = "invitation"
+	EmailKindInactivityWarning = "inactivity_warning"
+)
+
+// Limits on the size of organization email templates
+const (
+	MaxEmailSubjectLength  = 200
+	MaxEmailTemplateLength = 64 << 10
+)
+
+// EmailTemplateVariables lists, per kind, the variables a template may use
+// and the sample values previews are rendered with. Templates can only read
+// these; everything else about the recipient stays out of reach.
+var EmailTemplateVariables = map[string]map[string]string{
+	EmailKindVerification: {
+		"Username":         "jane.doe",
+		"VerificationLink": "https://example.com/verify-email?token=sample",
+		"OrganizationName": "Example Org",
+	},
+	EmailKindPasswordReset: {
+		"Username":         "jane.doe",
+		"ResetLink":        "https://example.com/reset-password?token=sample",
+		"OrganizationName": "Example Org",
+	},
+	EmailKindInvitation: {
+		"Username":         "jane.doe",
+		"OrganizationName": "Example Org",
+		"SetupLink":        "https://example.com/reset-password?token=sample",
+	},
+	EmailKindInactivityWarning: {
+		"Username":         "jane.doe",
+		"SuspendAt":        "January 2, 2006",
+		"LoginLink":        "https://example.com/login",
+		"OrganizationName": "Example Org",
+	},
+}
+
+// emailTemplateFuncs are the only functions templates may call
+var emailTemplateFuncs = map[string]bool{"eq": true, "ne": true, "not": true, "and": true, "or": true}
+
+// EmailVariableNames returns the variables of a kind, sorted
+func EmailVariableNames(kind string) []string {
+	names := make([]string, 0, len(EmailTemplateVariables[kind]))
+	for name := range EmailTemplateVariables[kind] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultEmailTemplate returns the built-in email of a kind, sent to
+// organizations that have not customized it; nil for unknown kinds
+func DefaultEmailTemplate(kind string) *models.EmailTemplate {
+	d, ok := defaultEmailTemplates[kind]
+	if !ok {
+		return nil
+	}
+	return &models.EmailTemplate{Kind: kind, Subject: d.subject, HTMLBody: d.html}
+}
+
+// RenderedEmail is an email template filled in with its variables
+type RenderedEmail struct {
+	Subject  string `json:"subject"`
+	HTMLBody string `json:"html_body"`
+	TextBody string `json:"text_body,omitempty"`
+}
+
+// ValidateEmailTemplate checks that a template parses and only uses the
+// variables of its kind, with no definitions, calls of other templates or
+// functions beyond comparisons
+func ValidateEmailTemplate(tmpl *models.EmailTemplate) error {
+	vars, ok := EmailTemplateVariables[tmpl.Kind]
+	if !ok {
+		return fmt.Errorf("unknown email template kind %q", tmpl.Kind)
+	}
+	switch {
+	case strings.TrimSpace(tmpl.Subject) == "":
+		return fmt.Errorf("subject is required")
+	case len(tmpl.Subject) > MaxEmailSubjectLength:
+		return fmt.Errorf("subject must be at most %d characters", MaxEmailSubjectLength)
+	case strings.ContainsAny(tmpl.Subject, "\r\n"):
+		return fmt.Errorf("subject must be a single line")
+	case strings.TrimSpace(tmpl.HTMLBody) == "":
+		return fmt.Errorf("html_body is required")
+	case len(tmpl.HTMLBody) > MaxEmailTemplateLength || len(tmpl.TextBody) > MaxEmailTemplateLength:
+		return fmt.Errorf("bodies must be at most %d bytes", MaxEmailTemplateLength)
+	}
+
+	for _, part := range []struct{ name, text string }{
+		{"subject", tmpl.Subject}, {"html_body", tmpl.HTMLBody}, {"text_body", tmpl.TextBody},
+	} {
+		t, err := template.New(part.name).Parse(part.text)
+		if err != nil {
+			return fmt.Errorf("%s does not parse: %v", part.name, err)
+		}
+		if len(t.Templates()) > 1 {
+			return fmt.Errorf("%s may not define templates", part.name)
+		}
+		if t.Tree != nil {
+			if err := checkEmailTemplateNode(t.Tree.Root, vars); err != nil {
+				return fmt.Errorf("%s: %v", part.name, err)
+			}
+		}
+	}
+
+	// The HTML escaper only reports misplaced variables, such as one that
+	// opens a tag, when the template runs
+	if _, err := renderEmailTemplate(tmpl, vars); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkEmailTemplateNode walks a template's parse tree, allowing text,
+// comments, if/else and pipelines of whitelisted variables, literals and
+// comparison functions
+func checkEmailTemplateNode(node parse.Node, vars map[string]string) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkEmailTemplateNode(child, vars); err != nil {
+				return err
+			}
+		}
+	case *parse.TextNode, *parse.CommentNode:
+	case *parse.ActionNode:
+		return checkEmailTemplateNode(n.Pipe, vars)
+	case *parse.IfNode:
+		if err := checkEmailTemplateNode(n.Pipe, vars); err != nil {
+			return err
+		}
+		if err := checkEmailTemplateNode(n.List, vars); err != nil {
+			return err
+		}
+		return checkEmailTemplateNode(n.ElseList, vars)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		if len(n.Decl) > 0 {
+			return fmt.Errorf("variables may not be declared")
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				if err := checkEmailTemplateNode(arg, vars); err != nil {
+					return err
+				}
+			}
+		}
+	case *parse.FieldNode:
+		if len(n.Ident) != 1 {
+			return fmt.Errorf("%s is not a variable", n)
+		}
+		if _, ok := vars[n.Ident[0]]; !ok {
+			return fmt.Errorf("unknown variable %s", n)
+		}
+	case *parse.IdentifierNode:
+		if !emailTemplateFuncs[n.Ident] {
+			return fmt.Errorf("function %s is not allowed", n.Ident)
+		}
+	case *parse.StringNode, *parse.NumberNode, *parse.BoolNode:
+	default:
+		return fmt.Errorf("%s is not allowed", node)
+	}
+	return nil
+}
+
+// renderEmailTemplate fills in a template: the subject and text body as
+// text, the HTML body with its variables escaped for where they appear
+func renderEmailTemplate(tmpl *models.EmailTemplate, data map[string]string) (*RenderedEmail, error) {
+	var out RenderedEmail
+	var err error
+	if out.Subject, err = executeTextTemplate("subject", tmpl.Subject, data); err != nil {
+		return nil, err
+	}
+	// Header values must stay on one line whatever the variables hold
+	out.Subject = strings.Join(strings.Fields(out.Subject), " ")
+	if out.TextBody, err = executeTextTemplate("text_body", tmpl.TextBody, data); err != nil {
+		return nil, err
+	}
+
+	t, err := htmltemplate.New("html_body").Option("missingkey=zero").Parse(tmpl.HTMLBody)
+	if err != nil {
+		return nil, fmt.Errorf("html_body does not parse: %v", err)
+	}
+	var body bytes.Buffer
+	if err := t.Execute(&body, data); err != nil {
+		return nil, fmt.Errorf("html_body does not render: %v", err)
+	}
+	out.HTMLBody = body.String()
+	return &out, nil
+}
+
+func executeTextTemplate(name, text string, data map[string]string) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	t, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("%s does not parse: %v", name, err)
+	}
+	var out bytes.Buffer
+	if err := t.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("%s does not render: %v", name, err)
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/config"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+const (
+	EmailValidationOff    = "off"
+	EmailValidationWarn   = "warn"
+	EmailValidationReject = "reject"
+
+	// maxEmailLength is the longest address SMTP can deliver to (RFC 5321)
+	maxEmailLength = 254
+	emailDNSWait   = 3 * time.Second
+)
+
+//go:embed disposable_domains.txt
+var builtinDisposableDomains string
+
+var (
+	ErrEmailInvalid      = errors.New("email address is not valid")
+	ErrEmailDisposable   = errors.New("disposable email addresses are not accepted")
+	ErrEmailNoMailServer = errors.New("email domain does not accept mail")
+)
+
+// EmailValidationService screens addresses given at registration and email
+// change before any verification email is sent to them
+type EmailValidationService interface {
+	// Validate returns ErrEmailInvalid for a malformed address. A disposable
+	// domain (ErrEmailDisposable) or one without mail servers
+	// (ErrEmailNoMailServer) is only returned in reject mode; in warn mode
+	// it is logged and the address accepted.
+	Validate(ctx context.Context, email string) error
+}
+
+type emailValidationService struct {
+	mode       string
+	checkMX    bool
+	disposable map[string]bool
+	resolver   *net.Resolver
+	logger     *logger.Logger
+}
+
+// NewEmailValidationService creates a new instance of EmailValidationService
+// using the built-in disposable domain list extended by
+// EMAIL_DISPOSABLE_DOMAINS
+func NewEmailValidationService(cfg *config.Config, l *logger.Logger) EmailValidationService {
+	s := &emailValidationService{
+		mode:       cfg.EmailValidationMode,
+		checkMX:    cfg.EmailCheckMX,
+		disposable: make(map[string]bool),
+		resolver:   net.DefaultResolver,
+		logger:     l,
+	}
+	scanner := bufio.NewScanner(strings.NewReader(builtinDisposableDomains))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			s.disposable[strings.ToLower(line)] = true
+		}
+	}
+	for _, domain := range cfg.EmailDisposableDomains {
+		s.disposable[strings.ToLower(strings.Trim(domain, ". "))] = true
+	}
+	return s
+}
+
+func (s *emailValidationService) Validate(ctx context.Context, email string) error {
+	domain, err := emailDomain(email)
+	if err != nil {
+		return err
+	}
+	if s.mode == EmailValidationOff {
+		return nil
+	}
+
+	problem := s.check(ctx, domain)
+	if problem == nil {
+		return nil
+	}
+	if s.mode == EmailValidationReject {
+		return problem
+	}
+	s.logger.Warn("Accepting questionable email address %s: %v", email, problem)
+	return nil
+}
+
+func (s *emailValidationService) check(ctx context.Context, domain string) error {
+	if s.isDisposable(domain) {
+		return ErrEmailDisposable
+	}
+	if !s.checkMX {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, emailDNSWait)
+	defer cancel()
+	accepts, err := s.acceptsMail(ctx, domain)
+	if err != nil {
+		// A DNS outage must not block signups; verification still catches it
+		s.logger.Warn("Failed to look up mail servers for %s: %v", domain, err)
+		return nil
+	}
+	if !accepts {
+		return ErrEmailNoMailServer
+	}
+	return nil
+}
+
+// isDisposable matches the domain and every parent domain against the
+// blocklist, so subdomains of a disposable provider are caught too
+func (s *emailValidationService) isDisposable(domain string) bool {
+	for {
+		if s.disposable[domain] {
+			return true
+		}
+		dot := strings.IndexByte(domain, '.')
+		if dot < 0 {
+			return false
+		}
+		domain = domain[dot+1:]
+	}
+}
+
+// acceptsMail reports whether the domain has a mail server: an MX record
+// other than the null MX (RFC 7505) or, failing that, an address record
+// (RFC 5321 implicit MX). Only temporary lookup failures return an error.
+func (s *emailValidationService) acceptsMail(ctx context.Context, domain string) (bool, error) {
+	mxs, err := s.resolver.LookupMX(ctx, domain)
+	if err == nil && len(mxs) > 0 {
+		for _, mx := range mxs {
+			if mx.Host != "." && mx.Host != "" {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	if err != nil && !isNotFound(err) {
+		return false, err
+	}
+
+	addrs, err := s.resolver.LookupHost(ctx, domain)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return len(addrs) > 0, nil
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// emailDomain checks the syntax of a bare address and returns its lower
+// cased domain
+func emailDomain(email string) (string, error) {
+	if len(email) > maxEmailLength {
+		return "", fmt.Errorf("%w: longer than %d characters", ErrEmailInvalid, maxEmailLength)
+	}
+	addr, err := mail.ParseAddress(email)
+	// Display names and comments parse too; only a bare address is accepted
+	if err != nil || addr.Address != email || addr.Name != "" {
+		return "", ErrEmailInvalid
+	}
+	at := strings.LastIndexByte(email, '@')
+	domain := strings.ToLower(email[at+1:])
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, "[") || strings.HasSuffix(domain, ".") {
+		return "", ErrEmailInvalid
+	}
+	return domain, nil
+}
@@ -0,0 +1,15 @@
+package services
+
+import "strings"
+
+// EnterpriseAuthAllowed reports whether organizations of a billing tier may
+// sign in with SPNEGO and authenticate service accounts with client
+// certificates. tiers is ENTERPRISE_AUTH_TIERS.
+func EnterpriseAuthAllowed(tiers []string, tier string) bool {
+	for _, t := range tiers {
+		if strings.EqualFold(t, tier) {
+			return true
+		}
+	}
+	return false
+}
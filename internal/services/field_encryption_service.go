@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/encryption"
+	"github.com/the-monkeys/monkeys-identity/internal/jobs"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+// reencryptBatchSize is how many users the re-encryption job reads at a time
+const reencryptBatchSize = 500
+
+// FieldEncryptionService rotates the data key encrypted fields are sealed
+// with and re-encrypts stored values with the current key
+type FieldEncryptionService interface {
+	RegisterJobs(scheduler *jobs.Scheduler) error
+}
+
+type fieldEncryptionService struct {
+	keyring  *encryption.Keyring
+	queries  queries.UserQueries
+	rotation time.Duration
+	logger   *logger.Logger
+}
+
+// NewFieldEncryptionService creates a new instance of FieldEncryptionService.
+// keyring is nil when field encryption is not configured. A rotation period
+// of zero or less keeps the data key until it is rotated by hand.
+func NewFieldEncryptionService(keyring *encryption.Keyring, q queries.UserQueries, rotation time.Duration, l *logger.Logger) FieldEncryptionService {
+	return &fieldEncryptionService{
+		keyring:  keyring,
+		queries:  q,
+		rotation: rotation,
+		logger:   l,
+	}
+}
+
+// RegisterJobs schedules the daily key rotation and re-encryption unless
+// field encryption is disabled
+func (s *fieldEncryptionService) RegisterJobs(scheduler *jobs.Scheduler) error {
+	if s.keyring == nil {
+		s.logger.Info("Field re-encryption job disabled (no encryption master key configured)")
+		return nil
+	}
+	return scheduler.Register(jobs.Job{
+		Name:        "field_reencrypt",
+		Description: "Rewrap data keys with the current master key, rotate the data key and re-encrypt user secrets",
+		Schedule:    "@daily",
+		Timeout:     time.Hour,
+		Run:         s.run,
+	})
+}
+
+func (s *fieldEncryptionService) run(ctx context.Context) error {
+	rewrapped, err := s.keyring.Rewrap()
+	if err != nil {
+		return err
+	}
+	if rewrapped > 0 {
+		s.logger.Info("Rewrapped %d data keys with the current master key", rewrapped)
+	}
+
+	if _, created := s.keyring.ActiveKey(); s.rotation > 0 && time.Since(created) > s.rotation {
+		id, err := s.keyring.Rotate()
+		if err != nil {
+			return err
+		}
+		s.logger.Info("Rotated the data encryption key to %s", id)
+	}
+
+	q := s.queries.WithContext(ctx)
+	total := 0
+	after := ""
+	for {
+		next, updated, err := q.ReencryptUserSecrets(after, reencryptBatchSize)
+		total += updated
+		if err != nil {
+			return err
+		}
+		if next == "" {
+			break
+		}
+		after = next
+	}
+	if total > 0 {
+		s.logger.Info("Re-encrypted the secrets of %d users", total)
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/jobs"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+// impersonationsKey is a hash of the open impersonations by session ID
+const impersonationsKey = "impersonations"
+
+// Why an impersonation ended, recorded on its stop event
+const (
+	ImpersonationStopped = "stopped" // a root user ended it
+	ImpersonationLogout  = "logout"  // the impersonation session logged out
+	ImpersonationExpired = "expired" // its token expired
+)
+
+// ErrImpersonationNotFound is returned when stopping an impersonation that
+// is not open, e.g. because it already ended
+var ErrImpersonationNotFound = errors.New("impersonation not found")
+
+// Impersonation is a session a root user opened as another user for support
+type Impersonation struct {
+	SessionID      string    `json:"session_id"`
+	RootUserID     string    `json:"root_user_id"`
+	UserID         string    `json:"user_id"`
+	OrganizationID string    `json:"organization_id"`
+	Reason         string    `json:"reason"`
+	IPAddress      string    `json:"ip_address,omitempty"`
+	StartedAt      time.Time `json:"started_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// ImpersonationService keeps track of open impersonations and audits them.
+// Every impersonation gets an impersonation_start event in the
+// organization of the impersonated user and exactly one matching
+// impersonation_stop event, with the same session_id, however it ends.
+type ImpersonationService interface {
+	// Start records an impersonation whose session has been created
+	Start(ctx context.Context, imp *Impersonation, userAgent string) error
+	// Stop ends an impersonation: its session is revoked and its token
+	// blacklisted. endedBy is the user ending it, reason one of the
+	// Impersonation* reasons.
+	Stop(ctx context.Context, sessionID, endedBy, reason string) (*Impersonation, error)
+	// List returns the open impersonations, oldest first
+	List(ctx context.Context) ([]*Impersonation, error)
+	// EndExpired records the end of impersonations whose token expired
+	EndExpired(ctx context.Context) (int, error)
+	RegisterJobs(scheduler *jobs.Scheduler) error
+}
+
+type impersonationService struct {
+	sessions queries.SessionQueries
+	redis    redis.UniversalClient
+	audit    AuditService
+	logger   *logger.Logger
+}
+
+// NewImpersonationService creates a new instance of ImpersonationService
+func NewImpersonationService(sessions queries.SessionQueries, redis redis.UniversalClient, audit AuditService, l *logger.Logger) ImpersonationService {
+	return &impersonationService{sessions: sessions, redis: redis, audit: audit, logger: l}
+}
+
+func (s *impersonationService) Start(ctx context.Context, imp *Impersonation, userAgent string) error {
+	raw, err := json.Marshal(imp)
+	if err != nil {
+		return err
+	}
+	if err := s.redis.HSet(ctx, impersonationsKey, imp.SessionID, raw).Err(); err != nil {
+		return fmt.Errorf("failed to record impersonation: %w", err)
+	}
+
+	details, _ := json.Marshal(map[string]interface{}{
+		"reason":     imp.Reason,
+		"expires_at": imp.ExpiresAt,
+	})
+	s.audit.LogEvent(ctx, models.AuditEvent{
+		OrganizationID:    imp.OrganizationID,
+		PrincipalID:       utils.StringPtr(imp.RootUserID),
+		PrincipalType:     utils.StringPtr("user"),
+		SessionID:         utils.StringPtr(imp.SessionID),
+		Action:            "impersonation_start",
+		ResourceType:      utils.StringPtr("user"),
+		ResourceID:        utils.StringPtr(imp.UserID),
+		Result:            "success",
+		IPAddress:         utils.StringPtr(imp.IPAddress),
+		UserAgent:         utils.StringPtr(userAgent),
+		AdditionalContext: string(details),
+		Severity:          "critical",
+	})
+	return nil
+}
+
+func (s *impersonationService) Stop(ctx context.Context, sessionID, endedBy, reason string) (*Impersonation, error) {
+	raw, err := s.redis.HGet(ctx, impersonationsKey, sessionID).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrImpersonationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var imp Impersonation
+	if err := json.Unmarshal([]byte(raw), &imp); err != nil {
+		return nil, err
+	}
+
+	// Whoever removes the record writes the stop event, so an
+	// impersonation ended twice at once is recorded once
+	removed, err := s.redis.HDel(ctx, impersonationsKey, sessionID).Result()
+	if err != nil {
+		return nil, err
+	}
+	if removed == 0 {
+		return nil, ErrImpersonationNotFound
+	}
+
+	now := time.Now()
+	if ttl := imp.ExpiresAt.Sub(now); ttl > 0 {
+		if err := s.redis.Set(ctx, "blacklist:"+sessionID, "revoked", ttl).Err(); err != nil {
+			s.logger.Error("Failed to blacklist impersonation session %s: %v", sessionID, err)
+		}
+	}
+	if err := s.sessions.WithContext(ctx).RevokeSession(sessionID, imp.OrganizationID); err != nil && reason != ImpersonationExpired {
+		s.logger.Warn("Failed to revoke impersonation session %s: %v", sessionID, err)
+	}
+
+	end := now
+	if reason == ImpersonationExpired {
+		end = imp.ExpiresAt
+	}
+	details, _ := json.Marshal(map[string]interface{}{
+		"ended_by":         endedBy,
+		"end_reason":       reason,
+		"duration_seconds": int64(end.Sub(imp.StartedAt) / time.Second),
+	})
+	s.audit.LogEvent(ctx, models.AuditEvent{
+		OrganizationID:    imp.OrganizationID,
+		PrincipalID:       utils.StringPtr(imp.RootUserID),
+		PrincipalType:     utils.StringPtr("user"),
+		SessionID:         utils.StringPtr(sessionID),
+		Action:            "impersonation_stop",
+		ResourceType:      utils.StringPtr("user"),
+		ResourceID:        utils.StringPtr(imp.UserID),
+		Result:            "success",
+		AdditionalContext: string(details),
+		Severity:          "critical",
+	})
+	return &imp, nil
+}
+
+func (s *impersonationService) List(ctx context.Context) ([]*Impersonation, error) {
+	all, err := s.redis.HGetAll(ctx, impersonationsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Impersonation, 0, len(all))
+	for sessionID, raw := range all {
+		var imp Impersonation
+		if err := json.Unmarshal([]byte(raw), &imp); err != nil {
+			s.logger.Warn("Skipping unreadable impersonation record %s: %v", sessionID, err)
+			continue
+		}
+		out = append(out, &imp)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.Before(out[j].StartedAt) })
+	return out, nil
+}
+
+func (s *impersonationService) EndExpired(ctx context.Context) (int, error) {
+	open, err := s.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	ended := 0
+	now := time.Now()
+	for _, imp := range open {
+		if imp.ExpiresAt.After(now) {
+			continue
+		}
+		if _, err := s.Stop(ctx, imp.SessionID, "", ImpersonationExpired); err != nil {
+			if errors.Is(err, ErrImpersonationNotFound) {
+				continue
+			}
+			return ended, err
+		}
+		ended++
+	}
+	return ended, nil
+}
+
+// RegisterJobs schedules recording the end of expired impersonations every
+// minute
+func (s *impersonationService) RegisterJobs(scheduler *jobs.Scheduler) error {
+	return scheduler.Register(jobs.Job{
+		Name:        "impersonation_expiry",
+		Description: "Record the end of impersonation sessions whose token expired",
+		Schedule:    "@every 1m",
+		Timeout:     time.Minute,
+		Run: func(ctx context.Context) error {
+			n, err := s.EndExpired(ctx)
+			if n > 0 {
+				s.logger.Info("Ended %d expired impersonation sessions", n)
+			}
+			return err
+		},
+	})
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/database"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/migrations"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+// defaultOrgID is the organization created by the seed migration
+const defaultOrgID = "00000000-0000-4000-8000-000000000001"
+
+// integrationQueries connects to the database of TEST_DATABASE_URL, migrated
+// to the latest version, and the Redis of TEST_REDIS_URL. Tests using it are
+// skipped unless both are set.
+func integrationQueries(t *testing.T) (*queries.Queries, redis.UniversalClient) {
+	t.Helper()
+	databaseURL, redisURL := os.Getenv("TEST_DATABASE_URL"), os.Getenv("TEST_REDIS_URL")
+	if databaseURL == "" || redisURL == "" {
+		t.Skip("TEST_DATABASE_URL and TEST_REDIS_URL are not set")
+	}
+
+	db, err := database.Connect(databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	migrator, err := database.NewMigrator(db.DB, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdb := redis.NewClient(opts)
+	t.Cleanup(func() { rdb.Close() })
+	return queries.New(db, rdb), rdb
+}
+
+// TestImpersonationAuditEvents checks that the start and stop of an
+// impersonation are written to the audit log, which only takes the
+// severities its check constraint allows
+func TestImpersonationAuditEvents(t *testing.T) {
+	q, rdb := integrationQueries(t)
+	l := logger.New("error")
+
+	audit := NewAuditService(q.Audit, l)
+	audit.Start(context.Background())
+	svc := NewImpersonationService(q.Session, rdb, audit, l)
+
+	now := time.Now()
+	imp := &Impersonation{
+		SessionID:      uuid.New().String(),
+		RootUserID:     uuid.New().String(),
+		UserID:         uuid.New().String(),
+		OrganizationID: defaultOrgID,
+		Reason:         "support ticket",
+		IPAddress:      "192.0.2.1",
+		StartedAt:      now,
+		ExpiresAt:      now.Add(time.Hour),
+	}
+	// Audit events reference the impersonation session
+	if err := q.Session.CreateSession(&models.Session{
+		ID:             imp.SessionID,
+		SessionToken:   uuid.New().String(),
+		PrincipalID:    imp.UserID,
+		PrincipalType:  "user",
+		OrganizationID: imp.OrganizationID,
+		Permissions:    "{}",
+		Context:        "{}",
+		Location:       "{}",
+		IssuedAt:       now,
+		ExpiresAt:      imp.ExpiresAt,
+		LastUsedAt:     now,
+		Status:         "active",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.Start(context.Background(), imp, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Stop(context.Background(), imp.SessionID, imp.RootUserID, ImpersonationStopped); err != nil {
+		t.Fatal(err)
+	}
+	audit.Stop()
+
+	events, _, err := q.Audit.ListAuditEvents(queries.ListAuditEventsParams{
+		OrganizationID: imp.OrganizationID,
+		PrincipalID:    imp.RootUserID,
+		Limit:          10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, event := range events {
+		got[event.Action] = event.Severity
+	}
+	for _, action := range []string{"impersonation_start", "impersonation_stop"} {
+		if severity, ok := got[action]; !ok {
+			t.Errorf("no %s event was written", action)
+		} else if severity != "critical" {
+			t.Errorf("%s severity = %q, want critical", action, severity)
+		}
+	}
+}
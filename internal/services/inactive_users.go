@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/events"
+	"github.com/the-monkeys/monkeys-identity/internal/jobs"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+// inactiveUsersReport is the type of the notification summarizing a sweep
+// for the org admins
+const inactiveUsersReport = "inactive_users.report"
+
+// InactiveUserService enforces the inactivity policies of organizations.
+// Users who have not signed in for dormant_after_days are flagged as
+// dormant and warned by email; those still dormant suspend_after_days
+// later are suspended. Org admins are notified of both.
+type InactiveUserService interface {
+	// Sweep applies the inactivity policy of every organization that has one
+	Sweep(ctx context.Context) error
+	RegisterJobs(scheduler *jobs.Scheduler) error
+}
+
+type inactiveUserService struct {
+	queries  *queries.Queries
+	email    EmailService
+	notifier NotificationService
+	bus      events.Bus
+	audit    AuditService
+	logger   *logger.Logger
+}
+
+// NewInactiveUserService creates a new instance of InactiveUserService
+func NewInactiveUserService(q *queries.Queries, email EmailService, notifier NotificationService, bus events.Bus, audit AuditService, l *logger.Logger) InactiveUserService {
+	return &inactiveUserService{
+		queries:  q,
+		email:    email,
+		notifier: notifier,
+		bus:      bus,
+		audit:    audit,
+		logger:   l,
+	}
+}
+
+// RegisterJobs schedules the daily sweep
+func (s *inactiveUserService) RegisterJobs(scheduler *jobs.Scheduler) error {
+	return scheduler.Register(jobs.Job{
+		Name:        "inactive_users",
+		Description: "Flag, warn and suspend the users inactive for longer than their organization's inactivity policy allows",
+		Schedule:    "@daily",
+		Timeout:     30 * time.Minute,
+		Run:         s.Sweep,
+	})
+}
+
+func (s *inactiveUserService) Sweep(ctx context.Context) error {
+	policies, err := s.queries.Organization.WithContext(ctx).ListInactivityPolicies()
+	if err != nil {
+		return err
+	}
+	for orgID, policy := range policies {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.sweepOrganization(ctx, orgID, policy); err != nil {
+			// One organization failing must not hold back the others
+			s.logger.Error("Failed to apply the inactivity policy of organization %s: %v", orgID, err)
+		}
+	}
+	return nil
+}
+
+func (s *inactiveUserService) sweepOrganization(ctx context.Context, orgID string, policy models.InactivityPolicy) error {
+	now := time.Now()
+	inactiveSince := now.AddDate(0, 0, -policy.DormantAfterDays)
+	users := s.queries.User.WithContext(ctx)
+
+	flagged, err := users.FlagDormantUsers(orgID, inactiveSince, policy.ExemptUserIDs, policy.ExemptGroupIDs)
+	if err != nil {
+		return err
+	}
+	var suspendAt time.Time
+	if policy.SuspendAfterDays > 0 {
+		suspendAt = now.AddDate(0, 0, policy.SuspendAfterDays)
+	}
+	for _, u := range flagged {
+		if err := s.email.SendInactivityWarningEmail(orgID, u.Email, u.Username, suspendAt); err != nil {
+			s.logger.Warn("Failed to send inactivity warning to user %s: %v", u.ID, err)
+		}
+		data := map[string]interface{}{"last_login": u.LastLogin}
+		if !suspendAt.IsZero() {
+			data["suspend_at"] = suspendAt
+		}
+		s.bus.Publish(ctx, events.Event{
+			Type:           events.UserDormant,
+			OrganizationID: orgID,
+			Subject:        u.ID,
+			Data:           data,
+		})
+	}
+
+	var suspended []string
+	if policy.SuspendAfterDays > 0 {
+		flaggedBefore := now.AddDate(0, 0, -policy.SuspendAfterDays)
+		suspended, err = users.SuspendDormantUsers(orgID, inactiveSince, flaggedBefore, policy.ExemptUserIDs, policy.ExemptGroupIDs)
+		if err != nil {
+			return err
+		}
+	}
+	for _, userID := range suspended {
+		if err := users.RevokeUserSessions(userID, orgID); err != nil {
+			s.logger.Warn("Failed to revoke the sessions of suspended user %s: %v", userID, err)
+		}
+		details, _ := json.Marshal(map[string]interface{}{
+			"reason":             "inactive",
+			"dormant_after_days": policy.DormantAfterDays,
+			"suspend_after_days": policy.SuspendAfterDays,
+		})
+		s.audit.LogEvent(ctx, models.AuditEvent{
+			OrganizationID:    orgID,
+			PrincipalType:     utils.StringPtr("system"),
+			Action:            "suspend_inactive_user",
+			ResourceType:      utils.StringPtr("user"),
+			ResourceID:        utils.StringPtr(userID),
+			Result:            "success",
+			AdditionalContext: string(details),
+			Severity:          "warn",
+		})
+		s.bus.Publish(ctx, events.Event{
+			Type:           events.UserSuspended,
+			OrganizationID: orgID,
+			Subject:        userID,
+			Data:           map[string]interface{}{"reason": "inactive"},
+		})
+	}
+
+	if len(flagged) == 0 && len(suspended) == 0 {
+		return nil
+	}
+	s.logger.Info("Organization %s: flagged %d dormant users, suspended %d", orgID, len(flagged), len(suspended))
+	s.notifyAdmins(ctx, orgID, flagged, suspended, now)
+	return nil
+}
+
+// notifyAdmins sends the org admins one summary of the sweep
+func (s *inactiveUserService) notifyAdmins(ctx context.Context, orgID string, flagged []models.DormantUser, suspended []string, now time.Time) {
+	admins, err := s.queries.Audit.WithContext(ctx).ListSecurityAlertRecipients(orgID)
+	if err != nil {
+		s.logger.Warn("Failed to list the admins of organization %s: %v", orgID, err)
+		return
+	}
+	flaggedIDs := make([]string, 0, len(flagged))
+	for _, u := range flagged {
+		flaggedIDs = append(flaggedIDs, u.ID)
+	}
+	for _, adminID := range admins {
+		s.notifier.Notify(ctx, adminID, models.Notification{
+			Type:           inactiveUsersReport,
+			OrganizationID: orgID,
+			Data: map[string]interface{}{
+				"flagged_user_ids":   flaggedIDs,
+				"suspended_user_ids": suspended,
+			},
+			CreatedAt: now,
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/encryption"
+	"github.com/the-monkeys/monkeys-identity/internal/jobs"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+// KMS operations a grant can allow
+const (
+	KMSEncrypt = "encrypt"
+	KMSDecrypt = "decrypt"
+)
+
+// kmsRotationBatch bounds the keys rotated per query of the rotation job
+const kmsRotationBatch = 100
+
+var (
+	// ErrKMSUnavailable is returned when no encryption master key is
+	// configured to wrap key material
+	ErrKMSUnavailable = errors.New("key management is not configured")
+	// ErrKMSKeyDisabled is returned for operations with a disabled key
+	ErrKMSKeyDisabled = errors.New("key is disabled")
+	// ErrKMSNotGranted is returned when no grant on the key allows the
+	// caller the operation
+	ErrKMSNotGranted = errors.New("no grant on the key allows this operation")
+	// ErrKMSWrongKey is returned for ciphertexts sealed with another key
+	ErrKMSWrongKey = errors.New("ciphertext was not encrypted with this key")
+)
+
+// KMSCaller is the principal calling the KMS API, as recorded in the usage
+// audit
+type KMSCaller struct {
+	PrincipalID   string
+	PrincipalType string // user, service_account
+	IPAddress     string
+	UserAgent     string
+}
+
+// KMSService manages the named encryption keys of organizations and
+// encrypts and decrypts with them. Key material is generated by the server
+// and wrapped by the encryption master key; callers only ever see
+// ciphertexts. Every encrypt and decrypt call is audited, allowed or not.
+type KMSService interface {
+	// Available reports whether a master key is configured
+	Available() bool
+	// CreateKey generates the first version of a key and grants its
+	// creator encrypt and decrypt
+	CreateKey(ctx context.Context, key *models.KMSKey) error
+	// RotateKey adds a version to a key, which encrypts from then on
+	RotateKey(ctx context.Context, key *models.KMSKey, actorID string) (*models.KMSKey, error)
+	Encrypt(ctx context.Context, caller KMSCaller, key *models.KMSKey, plaintext []byte, encryptionContext map[string]string) (string, error)
+	Decrypt(ctx context.Context, caller KMSCaller, key *models.KMSKey, ciphertext string, encryptionContext map[string]string) ([]byte, error)
+	RegisterJobs(scheduler *jobs.Scheduler) error
+}
+
+type kmsService struct {
+	queries *queries.Queries
+	master  encryption.MasterKey
+	audit   AuditService
+	logger  *logger.Logger
+
+	mu       sync.RWMutex
+	versions map[string]*encryption.KeyVersion // by "<key ID>:<version>"
+}
+
+// NewKMSService creates a new instance of KMSService. master is nil when
+// no encryption master key is configured, which leaves the KMS unavailable.
+func NewKMSService(q *queries.Queries, master encryption.MasterKey, audit AuditService, l *logger.Logger) KMSService {
+	return &kmsService{
+		queries:  q,
+		master:   master,
+		audit:    audit,
+		logger:   l,
+		versions: make(map[string]*encryption.KeyVersion),
+	}
+}
+
+func (s *kmsService) Available() bool { return s.master != nil }
+
+func (s *kmsService) CreateKey(ctx context.Context, key *models.KMSKey) error {
+	if s.master == nil {
+		return ErrKMSUnavailable
+	}
+	version, err := encryption.NewKeyVersion(s.master)
+	if err != nil {
+		return err
+	}
+	kms := s.queries.KMS.WithContext(ctx)
+	if err := kms.CreateKey(key, version); err != nil {
+		return err
+	}
+	if key.CreatedBy != nil {
+		grant := &models.KMSKeyGrant{
+			KeyID:          key.ID,
+			OrganizationID: key.OrganizationID,
+			PrincipalID:    *key.CreatedBy,
+			PrincipalType:  "user",
+			Operations:     []string{KMSEncrypt, KMSDecrypt},
+			CreatedBy:      key.CreatedBy,
+		}
+		if err := kms.PutGrant(grant); err != nil {
+			// The key is usable once an admin grants it
+			s.logger.Warn("Failed to grant key %s to its creator: %v", key.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *kmsService) RotateKey(ctx context.Context, key *models.KMSKey, actorID string) (*models.KMSKey, error) {
+	if s.master == nil {
+		return nil, ErrKMSUnavailable
+	}
+	version, err := encryption.NewKeyVersion(s.master)
+	if err != nil {
+		return nil, err
+	}
+	rotated, err := s.queries.KMS.WithContext(ctx).RotateKey(key.ID, key.OrganizationID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	event := models.AuditEvent{
+		OrganizationID:    rotated.OrganizationID,
+		PrincipalType:     utils.StringPtr("system"),
+		Action:            "kms_rotate_key",
+		ResourceType:      utils.StringPtr("kms_key"),
+		ResourceID:        utils.StringPtr(rotated.ID),
+		Result:            "success",
+		AdditionalContext: fmt.Sprintf(`{"version":%d}`, rotated.CurrentVersion),
+		Severity:          "info",
+	}
+	if actorID != "" {
+		event.PrincipalID = utils.StringPtr(actorID)
+		event.PrincipalType = utils.StringPtr("user")
+	}
+	s.audit.LogEvent(ctx, event)
+	return rotated, nil
+}
+
+func (s *kmsService) Encrypt(ctx context.Context, caller KMSCaller, key *models.KMSKey, plaintext []byte, encryptionContext map[string]string) (string, error) {
+	aad, err := kmsAdditionalData(encryptionContext)
+	if err != nil {
+		return "", err
+	}
+	var ciphertext string
+	err = s.use(ctx, caller, key, KMSEncrypt, key.CurrentVersion, encryptionContext, func(v *encryption.KeyVersion) error {
+		ciphertext, err = v.Seal(plaintext, aad)
+		return err
+	})
+	return ciphertext, err
+}
+
+func (s *kmsService) Decrypt(ctx context.Context, caller KMSCaller, key *models.KMSKey, ciphertext string, encryptionContext map[string]string) ([]byte, error) {
+	aad, err := kmsAdditionalData(encryptionContext)
+	if err != nil {
+		return nil, err
+	}
+	keyID, version, err := encryption.ParseKMSCiphertext(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if keyID != key.ID {
+		return nil, ErrKMSWrongKey
+	}
+	var plaintext []byte
+	err = s.use(ctx, caller, key, KMSDecrypt, version, encryptionContext, func(v *encryption.KeyVersion) error {
+		plaintext, err = v.Open(ciphertext, aad)
+		return err
+	})
+	return plaintext, err
+}
+
+// kmsAdditionalData turns the caller's encryption context into the
+// additional data of the ciphertext. Map keys marshal sorted, so the same
+// context always gives the same bytes.
+func kmsAdditionalData(encryptionContext map[string]string) ([]byte, error) {
+	if len(encryptionContext) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(encryptionContext)
+}
+
+// use checks the key and the caller's grants, runs op with the key version
+// and audits the call
+func (s *kmsService) use(ctx context.Context, caller KMSCaller, key *models.KMSKey, operation string, version int,
+	encryptionContext map[string]string, op func(v *encryption.KeyVersion) error) error {
+	err := s.check(ctx, caller, key, operation)
+	if err == nil {
+		var v *encryption.KeyVersion
+		if v, err = s.version(ctx, key, version); err == nil {
+			err = op(v)
+		}
+	}
+	s.auditUse(ctx, caller, key, operation, version, encryptionContext, err)
+	return err
+}
+
+func (s *kmsService) check(ctx context.Context, caller KMSCaller, key *models.KMSKey, operation string) error {
+	if s.master == nil {
+		return ErrKMSUnavailable
+	}
+	if key.Status != "enabled" {
+		return ErrKMSKeyDisabled
+	}
+	allowed, err := s.queries.KMS.WithContext(ctx).OperationAllowed(key.ID, key.OrganizationID, caller.PrincipalID, caller.PrincipalType, operation)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrKMSNotGranted
+	}
+	return nil
+}
+
+// version returns the unwrapped material of a key version, unwrapping it
+// on first use. Unwrapping may be a call to Vault.
+func (s *kmsService) version(ctx context.Context, key *models.KMSKey, version int) (*encryption.KeyVersion, error) {
+	id := key.ID + ":" + strconv.Itoa(version)
+	s.mu.RLock()
+	v, ok := s.versions[id]
+	s.mu.RUnlock()
+	if ok {
+		return v, nil
+	}
+
+	stored, err := s.queries.KMS.WithContext(ctx).GetKeyVersion(key.ID, key.OrganizationID, version)
+	if err != nil {
+		return nil, err
+	}
+	if v, err = encryption.OpenKeyVersion(s.master, stored); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.versions[id] = v
+	s.mu.Unlock()
+	return v, nil
+}
+
+func (s *kmsService) auditUse(ctx context.Context, caller KMSCaller, key *models.KMSKey, operation string, version int,
+	encryptionContext map[string]string, useErr error) {
+	details, _ := json.Marshal(map[string]interface{}{
+		"key_name":           key.Name,
+		"version":            version,
+		"encryption_context": encryptionContext,
+	})
+	event := models.AuditEvent{
+		OrganizationID:    key.OrganizationID,
+		PrincipalID:       utils.StringPtr(caller.PrincipalID),
+		PrincipalType:     utils.StringPtr(caller.PrincipalType),
+		Action:            "kms_" + operation,
+		ResourceType:      utils.StringPtr("kms_key"),
+		ResourceID:        utils.StringPtr(key.ID),
+		Result:            "success",
+		AdditionalContext: string(details),
+		Severity:          "info",
+	}
+	if caller.IPAddress != "" {
+		event.IPAddress = utils.StringPtr(caller.IPAddress)
+	}
+	if caller.UserAgent != "" {
+		event.UserAgent = utils.StringPtr(caller.UserAgent)
+	}
+	if useErr != nil {
+		event.Result = "failure"
+		event.ErrorMessage = utils.StringPtr(useErr.Error())
+		event.Severity = "warn"
+	}
+	s.audit.LogEvent(ctx, event)
+}
+
+// RegisterJobs schedules the daily rotation of keys with a rotation period
+func (s *kmsService) RegisterJobs(scheduler *jobs.Scheduler) error {
+	if s.master == nil {
+		return nil
+	}
+	return scheduler.Register(jobs.Job{
+		Name:        "kms_key_rotation",
+		Description: "Rotate KMS keys whose rotation period has passed",
+		Schedule:    "@daily",
+		Timeout:     30 * time.Minute,
+		Run:         s.rotateDue,
+	})
+}
+
+func (s *kmsService) rotateDue(ctx context.Context) error {
+	rotated := 0
+	for {
+		due, err := s.queries.KMS.WithContext(ctx).ListRotationsDue(kmsRotationBatch)
+		if err != nil {
+			return err
+		}
+		for i := range due {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if _, err := s.RotateKey(ctx, &due[i], ""); err != nil {
+				// A key that keeps failing would be listed again; stop
+				// rather than spin on it
+				return fmt.Errorf("failed to rotate key %s: %w", due[i].ID, err)
+			}
+			rotated++
+		}
+		if len(due) < kmsRotationBatch {
+			break
+		}
+	}
+	if rotated > 0 {
+		s.logger.Info("Rotated %d KMS keys", rotated)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/config"
+	"github.com/the-monkeys/monkeys-identity/internal/metrics"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+// loginThrottleWait bounds the Redis calls of a login attempt
+const loginThrottleWait = 250 * time.Millisecond
+
+// LoginThrottleService slows down online password guessing against one
+// account with progressive delays. Unlike a lockout it never blocks the
+// legitimate user for long, and unlike the per-IP rate limit it also holds
+// against guesses spread over many addresses.
+type LoginThrottleService interface {
+	// Wait returns how long the identifier must wait before its next login
+	// attempt, zero when it may try now. Attempts made while waiting are
+	// counted in the login_throttled_total metric.
+	Wait(ctx context.Context, identifier string) time.Duration
+	// Failed records a failed login and returns the delay now imposed
+	Failed(ctx context.Context, identifier string) time.Duration
+	// Succeeded forgets the failed logins of the identifier
+	Succeeded(ctx context.Context, identifier string)
+}
+
+type loginThrottleService struct {
+	delays []time.Duration
+	window time.Duration
+	redis  redis.UniversalClient
+	logger *logger.Logger
+}
+
+// NewLoginThrottleService creates a new instance of LoginThrottleService.
+// Without LOGIN_THROTTLE_DELAYS it never delays a login.
+func NewLoginThrottleService(cfg *config.Config, redis redis.UniversalClient, l *logger.Logger) LoginThrottleService {
+	return &loginThrottleService{
+		delays: cfg.LoginThrottleDelays,
+		window: cfg.LoginThrottleWindow,
+		redis:  redis,
+		logger: l,
+	}
+}
+
+// loginThrottleKey hashes the identifier so that Redis holds no email
+// addresses
+func loginThrottleKey(identifier string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(identifier))))
+	return "login_throttle:" + hex.EncodeToString(sum[:])
+}
+
+// delayAfter returns the delay imposed after the nth consecutive failure
+func (s *loginThrottleService) delayAfter(failures int64) time.Duration {
+	if failures < 1 {
+		return 0
+	}
+	if failures > int64(len(s.delays)) {
+		return s.delays[len(s.delays)-1]
+	}
+	return s.delays[failures-1]
+}
+
+func (s *loginThrottleService) Wait(ctx context.Context, identifier string) time.Duration {
+	if len(s.delays) == 0 {
+		return 0
+	}
+	ctx, cancel := context.WithTimeout(ctx, loginThrottleWait)
+	defer cancel()
+
+	values, err := s.redis.HMGet(ctx, loginThrottleKey(identifier), "until", "delay").Result()
+	if err != nil {
+		s.logger.Warn("Login throttle unavailable, allowing the attempt: %v", err)
+		return 0
+	}
+	until, _ := values[0].(string)
+	untilMS, err := strconv.ParseInt(until, 10, 64)
+	if err != nil {
+		return 0
+	}
+	wait := time.Until(time.UnixMilli(untilMS))
+	if wait <= 0 {
+		return 0
+	}
+	delay, _ := values[1].(string)
+	delayMS, _ := strconv.ParseInt(delay, 10, 64)
+	metrics.RecordLoginThrottled(time.Duration(delayMS) * time.Millisecond)
+	return wait
+}
+
+func (s *loginThrottleService) Failed(ctx context.Context, identifier string) time.Duration {
+	if len(s.delays) == 0 {
+		return 0
+	}
+	ctx, cancel := context.WithTimeout(ctx, loginThrottleWait)
+	defer cancel()
+
+	key := loginThrottleKey(identifier)
+	pipe := s.redis.TxPipeline()
+	failures := pipe.HIncrBy(ctx, key, "failures", 1)
+	pipe.PExpire(ctx, key, s.window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		s.logger.Warn("Failed to record a failed login in the throttle: %v", err)
+		return 0
+	}
+
+	delay := s.delayAfter(failures.Val())
+	if delay <= 0 {
+		return 0
+	}
+	pipe = s.redis.TxPipeline()
+	pipe.HSet(ctx, key, "until", time.Now().Add(delay).UnixMilli(), "delay", delay.Milliseconds())
+	if delay > s.window {
+		pipe.PExpire(ctx, key, delay)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		s.logger.Warn("Failed to record a login delay in the throttle: %v", err)
+		return 0
+	}
+	return delay
+}
+
+func (s *loginThrottleService) Succeeded(ctx context.Context, identifier string) {
+	if len(s.delays) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, loginThrottleWait)
+	defer cancel()
+
+	if err := s.redis.Del(ctx, loginThrottleKey(identifier)).Err(); err != nil {
+		s.logger.Warn("Failed to reset the login throttle: %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/events"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+const (
+	// notificationChannelPrefix is followed by the user ID: every replica
+	// publishes there and receives from all of them with one pattern
+	// subscription, whatever the number of open streams
+	notificationChannelPrefix = "notifications:user:"
+	// notificationBuffer is how many notifications a slow stream may fall
+	// behind before further ones are dropped for it
+	notificationBuffer = 32
+)
+
+// NotificationService pushes events to the users' open notification
+// streams, on whichever replica they are connected to. Delivery is best
+// effort and nothing is stored for users without an open stream.
+type NotificationService interface {
+	// Notify delivers n to every open stream of the user
+	Notify(ctx context.Context, userID string, n models.Notification)
+	// Subscribe returns the notifications of the user until cancel is
+	// called. The channel is closed when the service stops.
+	Subscribe(userID string) (notifications <-chan models.Notification, cancel func())
+	// Relay notifies the users concerned by the events of the bus that
+	// users are told about. Call before the bus starts.
+	Relay(bus events.Bus, content queries.ContentQueries)
+	Start(ctx context.Context)
+	// Stop ends the subscription and closes the channels of all streams
+	Stop()
+}
+
+type notificationService struct {
+	redis  redis.UniversalClient
+	logger *logger.Logger
+
+	mu      sync.Mutex
+	streams map[string]map[chan models.Notification]struct{}
+	stopped bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewNotificationService creates a NotificationService; streams receive
+// nothing until Start
+func NewNotificationService(redis redis.UniversalClient, l *logger.Logger) NotificationService {
+	return &notificationService{
+		redis:   redis,
+		logger:  l,
+		streams: make(map[string]map[chan models.Notification]struct{}),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+func (s *notificationService) Notify(ctx context.Context, userID string, n models.Notification) {
+	if userID == "" {
+		return
+	}
+	if n.ID == "" {
+		n.ID = uuid.New().String()
+	}
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = time.Now().UTC()
+	}
+	payload, err := json.Marshal(n)
+	if err != nil {
+		s.logger.Error("Failed to encode %s notification: %v", n.Type, err)
+		return
+	}
+	if err := s.redis.Publish(ctx, notificationChannelPrefix+userID, payload).Err(); err != nil {
+		s.logger.Warn("Failed to publish %s notification for user %s: %v", n.Type, userID, err)
+	}
+}
+
+func (s *notificationService) Subscribe(userID string) (<-chan models.Notification, func()) {
+	ch := make(chan models.Notification, notificationBuffer)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		close(ch)
+		return ch, func() {}
+	}
+	if s.streams[userID] == nil {
+		s.streams[userID] = make(map[chan models.Notification]struct{})
+	}
+	s.streams[userID][ch] = struct{}{}
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if _, ok := s.streams[userID][ch]; !ok {
+				return // already closed by Stop
+			}
+			delete(s.streams[userID], ch)
+			if len(s.streams[userID]) == 0 {
+				delete(s.streams, userID)
+			}
+			close(ch)
+		})
+	}
+}
+
+func (s *notificationService) Relay(bus events.Bus, content queries.ContentQueries) {
+	relay := func(ctx context.Context, e events.Event) {
+		for _, userID := range s.recipients(ctx, content, e) {
+			s.Notify(ctx, userID, models.Notification{
+				ID:             e.ID,
+				Type:           e.Type,
+				OrganizationID: e.OrganizationID,
+				Data:           notificationData(e),
+				CreatedAt:      e.OccurredAt,
+			})
+		}
+	}
+	for _, kind := range []string{
+		events.CollaboratorInvited, events.ContentPublished, events.RoleAssigned,
+		events.SessionRevoked, events.AccessReviewAssigned, events.RoleExpiring,
+		events.RoleRenewalRequested, events.RoleRenewalDecided, events.ShareExpiring,
+		events.ResourceArchived, events.ResourceDeleted, events.ResourceRecertificationDue,
+	} {
+		bus.Subscribe(kind, relay)
+	}
+}
+
+// recipients returns the users notified of an event
+func (s *notificationService) recipients(ctx context.Context, content queries.ContentQueries, e events.Event) []string {
+	switch e.Type {
+	case events.RoleAssigned:
+		if e.Data["principal_type"] == "user" {
+			return []string{e.Subject}
+		}
+	case events.SessionRevoked:
+		return []string{e.Subject}
+	case events.ShareExpiring:
+		// Group recipients are not expanded to their members
+		if e.Data["principal_type"] == "user" {
+			return []string{e.Subject}
+		}
+	case events.ResourceArchived, events.ResourceDeleted, events.ResourceRecertificationDue:
+		if e.Data["owner_type"] == "user" {
+			if ownerID, _ := e.Data["owner_id"].(string); ownerID != "" {
+				return []string{ownerID}
+			}
+		}
+	case events.RoleExpiring:
+		// The holder and whoever granted the role
+		var users []string
+		if e.Data["principal_type"] == "user" {
+			users = append(users, e.Subject)
+		}
+		if assigner, _ := e.Data["assigned_by"].(string); assigner != "" && assigner != e.Subject {
+			users = append(users, assigner)
+		}
+		return users
+	case events.RoleRenewalRequested:
+		// Whoever granted the role decides, unless they asked themselves
+		if assigner, _ := e.Data["assigned_by"].(string); assigner != "" && assigner != e.ActorID {
+			return []string{assigner}
+		}
+	case events.RoleRenewalDecided:
+		if requester, _ := e.Data["requested_by"].(string); requester != "" {
+			return []string{requester}
+		}
+	case events.CollaboratorInvited:
+		if userID, _ := e.Data["user_id"].(string); userID != "" {
+			return []string{userID}
+		}
+	case events.AccessReviewAssigned:
+		if reviewerID, _ := e.Data["reviewer_id"].(string); reviewerID != "" {
+			return []string{reviewerID}
+		}
+	case events.ContentPublished:
+		// The owner and co-authors, except whoever published it
+		collabs, err := content.WithContext(ctx).ListCollaborators(e.Subject, e.OrganizationID)
+		if err != nil {
+			s.logger.Warn("Failed to list collaborators to notify of %s event %s: %v", e.Type, e.ID, err)
+			return nil
+		}
+		var users []string
+		for _, collab := range collabs {
+			if collab.UserID != e.ActorID {
+				users = append(users, collab.UserID)
+			}
+		}
+		return users
+	}
+	return nil
+}
+
+// notificationData is what a notification tells of its event: the data of
+// the event, with the subject under the name its type gives it
+func notificationData(e events.Event) map[string]interface{} {
+	data := make(map[string]interface{}, len(e.Data)+2)
+	for k, v := range e.Data {
+		data[k] = v
+	}
+	switch e.Type {
+	case events.CollaboratorInvited, events.ContentPublished:
+		data["content_id"] = e.Subject
+	case events.AccessReviewAssigned:
+		data["review_id"] = e.Subject
+	case events.RoleRenewalRequested, events.RoleRenewalDecided:
+		data["request_id"] = e.Subject
+	case events.ResourceArchived, events.ResourceDeleted, events.ResourceRecertificationDue:
+		data["resource_id"] = e.Subject
+	}
+	if e.ActorID != "" {
+		data["actor_id"] = e.ActorID
+	}
+	return data
+}
+
+// Start relays the notifications published by every replica to the
+// streams open on this one
+func (s *notificationService) Start(ctx context.Context) {
+	sub := s.redis.PSubscribe(ctx, notificationChannelPrefix+"*")
+	go func() {
+		defer close(s.done)
+		defer sub.Close()
+
+		messages := sub.Channel()
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				s.deliver(strings.TrimPrefix(msg.Channel, notificationChannelPrefix), msg.Payload)
+			case <-ctx.Done():
+				return
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *notificationService) Stop() {
+	s.mu.Lock()
+	if !s.stopped {
+		s.stopped = true
+		close(s.stop)
+		for userID, streams := range s.streams {
+			for ch := range streams {
+				close(ch)
+			}
+			delete(s.streams, userID)
+		}
+	}
+	s.mu.Unlock()
+	<-s.done
+}
+
+func (s *notificationService) deliver(userID, payload string) {
+	var n models.Notification
+	if err := json.Unmarshal([]byte(payload), &n); err != nil {
+		s.logger.Warn("Ignoring malformed notification for user %s: %v", userID, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.streams[userID] {
+		select {
+		case ch <- n:
+		default:
+			s.logger.Warn("Dropped %s notification for user %s: stream is not keeping up", n.Type, userID)
+		}
+	}
+}
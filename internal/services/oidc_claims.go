@@ -0,0 +1,215 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// Size guards of custom token claims
+const (
+	// MaxClaimRules is the most claims an organization or a client may map
+	MaxClaimRules = 20
+	// MaxClaimListLength caps the group and role names put in one claim
+	MaxClaimListLength = 50
+	// maxCustomClaimsBytes caps the JSON size of the custom claims of one
+	// token; claims that would exceed it are left out, in rule order, so
+	// that a large attribute cannot bloat every token
+	maxCustomClaimsBytes = 4096
+)
+
+// The tokens a claim rule can target
+const (
+	ClaimTokenAccess = "access_token"
+	ClaimTokenID     = "id_token"
+)
+
+// reservedClaims are set by the server and cannot be mapped
+var reservedClaims = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true, "nbf": true, "iat": true, "jti": true,
+	"nonce": true, "azp": true, "auth_time": true, "acr": true, "amr": true, "at_hash": true, "c_hash": true,
+	"sid": true, "act": true, "may_act": true, "cnf": true,
+	"scope": true, "client_id": true, "type": true, "organization_id": true, "grant_id": true,
+	"email": true, "email_verified": true, "name": true, "preferred_username": true,
+}
+
+// IsReservedClaim reports whether a claim is set by the server
+func IsReservedClaim(name string) bool {
+	return reservedClaims[name]
+}
+
+// customClaims are the mapped claims of one user's access and ID tokens
+type customClaims struct {
+	access, id jwt.MapClaims
+}
+
+// claimRules returns the claim rules of a client: its organization's, with
+// those of the client's token policy replacing any of the same name
+func (s *oidcService) claimRules(client *models.OAuthClient) ([]models.ClaimRule, error) {
+	mapping, err := s.queries.Organization.GetTokenClaims(client.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	var rules []models.ClaimRule
+	if mapping != nil {
+		rules = append(rules, mapping.Claims...)
+	}
+	if client.TokenPolicy == nil {
+		return rules, nil
+	}
+	for _, rule := range client.TokenPolicy.Claims {
+		replaced := false
+		for i := range rules {
+			if rules[i].Claim == rule.Claim {
+				rules[i], replaced = rule, true
+			}
+		}
+		if !replaced {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// resolveCustomClaims evaluates the claim rules of a client for a user, then
+// adds what the organization's claims webhook answers for the grant.
+// User attributes, groups and roles are only read when a rule needs them.
+func (s *oidcService) resolveCustomClaims(client *models.OAuthClient, userID, orgID, scope, grantType string) (*customClaims, error) {
+	rules, err := s.claimRules(client)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		attributes map[string]interface{}
+		groups     []string
+		roles      []string
+		loaded     = map[string]bool{}
+	)
+	out := &customClaims{access: jwt.MapClaims{}, id: jwt.MapClaims{}}
+	sizes := map[string]int{}
+	for _, rule := range rules {
+		if reservedClaims[rule.Claim] {
+			continue
+		}
+
+		var value interface{}
+		switch rule.Source {
+		case models.ClaimSourceStatic:
+			value = rule.Value
+		case models.ClaimSourceAttribute:
+			if !loaded[rule.Source] {
+				loaded[rule.Source] = true
+				user, err := s.queries.User.GetUser(userID, orgID)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read user attributes for claims: %w", err)
+				}
+				if user.Attributes != "" {
+					_ = json.Unmarshal([]byte(user.Attributes), &attributes)
+				}
+			}
+			value = attributePath(attributes, rule.Attribute)
+		case models.ClaimSourceGroups:
+			if !loaded[rule.Source] {
+				loaded[rule.Source] = true
+				memberships, err := s.queries.Group.ListPrincipalGroupMemberships(userID, "user", orgID)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read groups for claims: %w", err)
+				}
+				now := time.Now()
+				for _, m := range memberships {
+					if m.ExpiresAt.IsZero() || m.ExpiresAt.After(now) {
+						groups = append(groups, m.Name)
+					}
+				}
+				groups = claimList(groups)
+			}
+			value = groups
+		case models.ClaimSourceRoles:
+			if !loaded[rule.Source] {
+				loaded[rule.Source] = true
+				names, err := s.queries.Role.GetHeldRoleNames(userID, "user", orgID)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read roles for claims: %w", err)
+				}
+				roles = claimList(names)
+			}
+			value = roles
+		}
+		if value == nil {
+			continue
+		}
+
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+		for _, token := range claimTokens(rule) {
+			if sizes[token]+len(encoded) > maxCustomClaimsBytes {
+				continue
+			}
+			sizes[token] += len(encoded)
+			if token == ClaimTokenID {
+				out.id[rule.Claim] = value
+			} else {
+				out.access[rule.Claim] = value
+			}
+		}
+	}
+	if err := s.addWebhookClaims(out, sizes, client, userID, orgID, scope, grantType); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// claimTokens returns the tokens a rule puts its claim in
+func claimTokens(rule models.ClaimRule) []string {
+	if len(rule.Tokens) == 0 {
+		return []string{ClaimTokenAccess, ClaimTokenID}
+	}
+	return rule.Tokens
+}
+
+// claimList sorts names, drops duplicates and caps their number
+func claimList(names []string) []string {
+	sort.Strings(names)
+	list := []string{}
+	for i, name := range names {
+		if i > 0 && name == names[i-1] {
+			continue
+		}
+		if len(list) == MaxClaimListLength {
+			break
+		}
+		list = append(list, name)
+	}
+	return list
+}
+
+// attributePath returns the value at a dot-separated path of user
+// attributes, or nil when there is none
+func attributePath(attributes map[string]interface{}, path string) interface{} {
+	var value interface{} = attributes
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		if value, ok = m[key]; !ok {
+			return nil
+		}
+	}
+	return value
+}
+
+// addClaims copies custom claims into the claims of a token
+func addClaims(claims, custom jwt.MapClaims) {
+	for name, value := range custom {
+		claims[name] = value
+	}
+}
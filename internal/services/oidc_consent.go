@@ -0,0 +1,156 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+const (
+	GrantTypeRefreshToken = "refresh_token"
+	ScopeOfflineAccess    = "offline_access"
+)
+
+// ConsentCovers reports whether the user has already granted the client
+// every scope in scope
+func (s *oidcService) ConsentCovers(userID, clientID, scope string) (bool, error) {
+	consent, err := s.queries.OIDC.GetConsent(userID, clientID)
+	if err != nil || consent == nil {
+		return false, err
+	}
+	for _, sc := range strings.Fields(scope) {
+		if !containsString(consent.Scopes, sc) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// GrantConsent remembers that the user granted the client scope, adding to
+// any scopes granted earlier
+func (s *oidcService) GrantConsent(userID, orgID, clientID, scope string) error {
+	return s.queries.OIDC.SaveConsent(&models.OAuthConsent{
+		UserID:         userID,
+		ClientID:       clientID,
+		OrganizationID: orgID,
+		Scopes:         strings.Fields(scope),
+	})
+}
+
+// issueRefreshToken signs a refresh token bound to the user's current
+// consent. The token carries the consent ID, so deleting the consent (even if
+// the user later consents again) invalidates it.
+func (s *oidcService) issueRefreshToken(userID, clientID, scope string, ttl time.Duration) (string, error) {
+	consent, err := s.queries.OIDC.GetConsent(userID, clientID)
+	if err != nil {
+		return "", err
+	}
+	if consent == nil {
+		return "", errors.New("invalid_grant")
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":             s.config.OIDCIssuer,
+		"sub":             userID,
+		"aud":             clientID,
+		"exp":             now.Add(ttl).Unix(),
+		"iat":             now.Unix(),
+		"jti":             uuid.New().String(),
+		"client_id":       clientID,
+		"organization_id": consent.OrganizationID,
+		"grant_id":        consent.ID,
+		"scope":           scope,
+		"type":            "refresh",
+	}
+
+	signed, err := s.keys.Sign(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign refresh_token: %w", err)
+	}
+	return signed, nil
+}
+
+// RefreshAccessToken issues a new access token for a refresh token. The
+// token is rejected once the consent it was issued under has been revoked.
+// Errors are RFC 6749 error codes.
+func (s *oidcService) RefreshAccessToken(refreshToken, clientID, clientSecret string) (*TokenResponse, error) {
+	if refreshToken == "" {
+		return nil, errors.New("invalid_request")
+	}
+
+	client, err := s.queries.OIDC.GetClientByID(clientID)
+	if err != nil || client == nil {
+		return nil, errors.New("invalid_client")
+	}
+	if !client.IsPublic {
+		if clientSecret == "" || !clientSecretMatches(client, clientSecret) {
+			return nil, errors.New("invalid_client")
+		}
+	}
+	if !refreshTokensAllowed(client) {
+		return nil, errors.New("unauthorized_client")
+	}
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(refreshToken, claims, s.keys.Keyfunc)
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid_grant")
+	}
+	if tokenType, _ := claims["type"].(string); tokenType != "refresh" {
+		return nil, errors.New("invalid_grant")
+	}
+	if tokenClient, _ := claims["client_id"].(string); tokenClient != client.ID {
+		return nil, errors.New("invalid_grant")
+	}
+	if jti, _ := claims["jti"].(string); jti != "" {
+		if revoked, err := s.queries.Auth.IsTokenRevoked(jti); err != nil || revoked {
+			return nil, errors.New("invalid_grant")
+		}
+	}
+
+	userID, _ := claims["sub"].(string)
+	grantID, _ := claims["grant_id"].(string)
+	scope, _ := claims["scope"].(string)
+
+	consent, err := s.queries.OIDC.GetConsent(userID, client.ID)
+	if err != nil {
+		return nil, err
+	}
+	if consent == nil || consent.ID != grantID {
+		return nil, errors.New("invalid_grant")
+	}
+	if s.organizationDeleting(consent.OrganizationID) {
+		return nil, errors.New("invalid_grant")
+	}
+
+	// The client's token policy may have been narrowed since
+	scope, _ = allowedScope(client, scope)
+	ttls, err := s.tokenTTLs(client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve token lifetimes: %w", err)
+	}
+	// Mapped claims carry the user's current attributes, groups and roles
+	custom, err := s.resolveCustomClaims(client, userID, consent.OrganizationID, scope, GrantTypeRefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := s.issueAccessToken(userID, consent.OrganizationID, client, scope, ttls.access, custom.access)
+	if err != nil {
+		return nil, err
+	}
+	s.queries.Stats.RecordTokenIssued(consent.OrganizationID, GrantTypeRefreshToken)
+
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(ttls.access / time.Second),
+		Scope:        scope,
+	}, nil
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// RFC 8628 identifiers and the lifetimes of device authorizations
+const (
+	GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+	DeviceCodeLifetime  = 10 * time.Minute
+	// devicePollInterval is the initial polling interval in seconds; each
+	// slow_down adds the same again
+	devicePollInterval = 5
+
+	DeviceStatusPending  = "pending"
+	DeviceStatusApproved = "approved"
+	DeviceStatusDenied   = "denied"
+)
+
+// userCodeAlphabet leaves out vowels, so that user codes spell no words,
+// and characters easily mistaken for others (RFC 8628 Section 6.1)
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// DeviceAuthorizationResponse is the RFC 8628 device authorization response
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// StartDeviceAuthorization begins a device authorization for a client
+// registered for the device_code grant. Confidential clients must
+// authenticate. Errors are RFC 6749 error codes.
+func (s *oidcService) StartDeviceAuthorization(clientID, clientSecret, scope string) (*DeviceAuthorizationResponse, error) {
+	client, err := s.deviceClient(clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if scope, err = s.ResolveScope(client, scope); err != nil {
+		return nil, err
+	}
+
+	auth := &models.DeviceAuthorization{
+		DeviceCode: randomHex(32),
+		UserCode:   newUserCode(),
+		ClientID:   client.ID,
+		Scope:      scope,
+		Status:     DeviceStatusPending,
+		Interval:   devicePollInterval,
+		ExpiresAt:  time.Now().Add(DeviceCodeLifetime),
+	}
+	if err := s.queries.OIDC.SaveDeviceAuthorization(auth); err != nil {
+		return nil, err
+	}
+
+	verificationURI := s.config.FrontendURL + "/device"
+	return &DeviceAuthorizationResponse{
+		DeviceCode:              auth.DeviceCode,
+		UserCode:                auth.UserCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + auth.UserCode,
+		ExpiresIn:               int64(DeviceCodeLifetime / time.Second),
+		Interval:                auth.Interval,
+	}, nil
+}
+
+// LookupDeviceAuthorization returns the pending device authorization a user
+// code belongs to, for the verification page; nil when there is none
+func (s *oidcService) LookupDeviceAuthorization(userCode string) (*models.DeviceAuthorization, error) {
+	auth, err := s.queries.OIDC.GetDeviceAuthorizationByUserCode(normalizeUserCode(userCode))
+	if err != nil || auth == nil || auth.Status != DeviceStatusPending {
+		return nil, err
+	}
+	return auth, nil
+}
+
+// DecideDeviceAuthorization records the user's decision on a pending device
+// authorization. An approval is remembered as consent, which refresh tokens
+// issued to the device depend on. Errors are RFC 6749 error codes.
+func (s *oidcService) DecideDeviceAuthorization(userCode, userID, orgID string, allow bool) error {
+	auth, err := s.LookupDeviceAuthorization(userCode)
+	if err != nil {
+		return err
+	}
+	if auth == nil {
+		return errors.New("invalid_grant")
+	}
+
+	auth.Status = DeviceStatusDenied
+	if allow {
+		if err := s.GrantConsent(userID, orgID, auth.ClientID, auth.Scope); err != nil {
+			return err
+		}
+		auth.Status, auth.UserID, auth.OrganizationID = DeviceStatusApproved, userID, orgID
+	}
+	return s.queries.OIDC.SaveDeviceAuthorization(auth)
+}
+
+// ExchangeDeviceCode serves a client polling the token endpoint with a
+// device code. Until the user decides it answers authorization_pending, or
+// slow_down when the client polls faster than its interval. Errors are
+// RFC 8628 error codes.
+func (s *oidcService) ExchangeDeviceCode(deviceCode, clientID, clientSecret string) (*TokenResponse, error) {
+	client, err := s.deviceClient(clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := s.queries.OIDC.GetDeviceAuthorization(deviceCode)
+	if err != nil {
+		return nil, err
+	}
+	// Redis drops device codes once they expire, so unknown codes are
+	// reported as expired; either way the client has to start again
+	if auth == nil || time.Now().After(auth.ExpiresAt) {
+		return nil, errors.New("expired_token")
+	}
+	if auth.ClientID != client.ID {
+		return nil, errors.New("invalid_grant")
+	}
+
+	switch auth.Status {
+	case DeviceStatusPending:
+		now := time.Now()
+		slowDown := auth.LastPolledAt != nil && now.Sub(*auth.LastPolledAt) < time.Duration(auth.Interval)*time.Second
+		auth.LastPolledAt = &now
+		if slowDown {
+			auth.Interval += devicePollInterval
+		}
+		if err := s.queries.OIDC.SaveDeviceAuthorization(auth); err != nil {
+			return nil, err
+		}
+		if slowDown {
+			return nil, errors.New("slow_down")
+		}
+		return nil, errors.New("authorization_pending")
+	case DeviceStatusDenied:
+		if _, err := s.queries.OIDC.DeleteDeviceAuthorization(auth); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("access_denied")
+	}
+
+	// Approved: the device code is good for one set of tokens, issued to
+	// the poll that removes it. Approval is final, so the code read above
+	// is the one removed.
+	redeemed, err := s.queries.OIDC.DeleteDeviceAuthorization(auth)
+	if err != nil {
+		return nil, err
+	}
+	if !redeemed {
+		return nil, errors.New("invalid_grant")
+	}
+	if s.organizationDeleting(auth.OrganizationID) {
+		return nil, errors.New("invalid_grant")
+	}
+	return s.issueTokens(client, auth.UserID, auth.OrganizationID, auth.Scope, nil, GrantTypeDeviceCode)
+}
+
+// deviceClient returns the client of a device authorization request, which
+// must be registered for the device_code grant
+func (s *oidcService) deviceClient(clientID, clientSecret string) (*models.OAuthClient, error) {
+	client, err := s.queries.OIDC.GetClientByID(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, errors.New("invalid_client")
+	}
+	if !client.IsPublic && (clientSecret == "" || !clientSecretMatches(client, clientSecret)) {
+		return nil, errors.New("invalid_client")
+	}
+	if !containsString(client.GrantTypes, GrantTypeDeviceCode) {
+		return nil, errors.New("unauthorized_client")
+	}
+	return client, nil
+}
+
+// newUserCode returns a random user code of the form BCDF-GHJK
+func newUserCode() string {
+	var b strings.Builder
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := 0; i < 8; i++ {
+		if i == 4 {
+			b.WriteByte('-')
+		}
+		n, _ := rand.Int(rand.Reader, max)
+		b.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	return b.String()
+}
+
+// normalizeUserCode puts a user code as typed by the user (any case, with
+// or without the dash or spaces) in the form it was issued in
+func normalizeUserCode(userCode string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(userCode) {
+		if r == '-' || r == ' ' {
+			continue
+		}
+		if b.Len() == 4 {
+			b.WriteByte('-')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+// clientOriginsTTL bounds how long a new or removed client origin takes to
+// affect preflight requests
+const clientOriginsTTL = time.Minute
+
+// ClientAllowsOrigin reports whether the client registered an origin
+// matching origin. Wildcard origins only count for clients that opted in.
+func (s *oidcService) ClientAllowsOrigin(clientID, origin string) bool {
+	client, err := s.queries.OIDC.GetClientByID(clientID)
+	if err != nil || client == nil {
+		return false
+	}
+	return clientOriginMatches(client, origin)
+}
+
+func clientOriginMatches(client *models.OAuthClient, origin string) bool {
+	for _, pattern := range client.AllowedOrigins {
+		if utils.IsURLPattern(pattern) && !client.AllowWildcards {
+			continue
+		}
+		if utils.MatchOrigin(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// AnyClientAllowsOrigin answers preflights, which do not name the client. It
+// may admit an origin of another client: the actual request is checked
+// against its own client by ClientAllowsOrigin.
+func (s *oidcService) AnyClientAllowsOrigin(origin string) bool {
+	s.originsMu.Lock()
+	defer s.originsMu.Unlock()
+	if time.Since(s.originsAt) > clientOriginsTTL {
+		origins, err := s.queries.OIDC.ListClientOrigins()
+		if err != nil {
+			return false
+		}
+		s.origins, s.originsAt = origins, time.Now()
+	}
+	for _, pattern := range s.origins {
+		if utils.MatchOrigin(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
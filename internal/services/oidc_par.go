@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+const (
+	// RequestURIPrefix starts the request_uri of pushed authorization
+	// requests (RFC 9126 Section 2.2)
+	RequestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+	// PushedRequestLifetime is how long a request_uri can be used; long
+	// enough for the user to sign in on the way
+	PushedRequestLifetime = 5 * time.Minute
+)
+
+// PushAuthorizationRequest validates an authorization request a client
+// pushed to the PAR endpoint and stores it, returning the request_uri the
+// client sends the user to the authorize endpoint with. Confidential clients
+// must authenticate, and public clients must send a PKCE challenge. Errors
+// are RFC 6749 error codes.
+func (s *oidcService) PushAuthorizationRequest(clientSecret string, req *models.PushedAuthorizationRequest) (string, error) {
+	client, err := s.queries.OIDC.GetClientByID(req.ClientID)
+	if err != nil {
+		return "", err
+	}
+	if client == nil {
+		return "", errors.New("invalid_client")
+	}
+	if !client.IsPublic && (clientSecret == "" || !clientSecretMatches(client, clientSecret)) {
+		return "", errors.New("invalid_client")
+	}
+	if req.ResponseType != "code" {
+		return "", errors.New("unsupported_response_type")
+	}
+	if _, err := s.ValidateClient(req.ClientID, "", req.RedirectURI); err != nil {
+		return "", err
+	}
+	if req.Scope, err = s.ResolveScope(client, req.Scope); err != nil {
+		return "", err
+	}
+	if err := s.CheckCodeChallenge(client, req.CodeChallenge, req.CodeChallengeMethod); err != nil {
+		return "", err
+	}
+
+	return s.StoreAuthorizationRequest(req)
+}
+
+// StoreAuthorizationRequest keeps a validated authorization request for
+// PushedRequestLifetime and returns the request_uri that refers to it
+func (s *oidcService) StoreAuthorizationRequest(req *models.PushedAuthorizationRequest) (string, error) {
+	id := randomHex(32)
+	req.ExpiresAt = time.Now().Add(PushedRequestLifetime)
+	if err := s.queries.OIDC.SavePushedRequest(id, req); err != nil {
+		return "", err
+	}
+	return RequestURIPrefix + id, nil
+}
+
+// ResolvePushedRequest returns the authorization request a request_uri
+// refers to, which clientID must have pushed. Errors are RFC 6749 error
+// codes.
+func (s *oidcService) ResolvePushedRequest(clientID, requestURI string) (*models.PushedAuthorizationRequest, error) {
+	req, err := s.LookupAuthorizationRequest(requestURI)
+	if err != nil {
+		return nil, err
+	}
+	if req.ClientID != clientID {
+		return nil, errors.New("invalid_request_uri")
+	}
+	return req, nil
+}
+
+// LookupAuthorizationRequest returns the authorization request a
+// request_uri refers to, for the consent page, which only knows the
+// request_uri. Errors are RFC 6749 error codes.
+func (s *oidcService) LookupAuthorizationRequest(requestURI string) (*models.PushedAuthorizationRequest, error) {
+	id, ok := strings.CutPrefix(requestURI, RequestURIPrefix)
+	if !ok || id == "" {
+		return nil, errors.New("invalid_request_uri")
+	}
+	req, err := s.queries.OIDC.GetPushedRequest(id)
+	if err != nil {
+		return nil, err
+	}
+	if req == nil || time.Now().After(req.ExpiresAt) {
+		return nil, errors.New("invalid_request_uri")
+	}
+	return req, nil
+}
+
+// ConsumePushedRequest ends a request_uri as the authorization request it
+// holds is answered, so that it cannot be replayed. It fails with
+// invalid_request_uri when the request was already answered, by a
+// concurrent request among others; the caller must not answer it again.
+func (s *oidcService) ConsumePushedRequest(requestURI string) error {
+	id, ok := strings.CutPrefix(requestURI, RequestURIPrefix)
+	if !ok || id == "" {
+		return errors.New("invalid_request_uri")
+	}
+	removed, err := s.queries.OIDC.DeletePushedRequest(id)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return errors.New("invalid_request_uri")
+	}
+	return nil
+}
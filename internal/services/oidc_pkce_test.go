@@ -0,0 +1,56 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+func TestCheckCodeChallenge(t *testing.T) {
+	s := &oidcService{}
+	challenge := strings.Repeat("a", 43)
+	public, confidential := &models.OAuthClient{IsPublic: true}, &models.OAuthClient{}
+
+	tests := []struct {
+		name      string
+		client    *models.OAuthClient
+		challenge string
+		method    string
+		ok        bool
+	}{
+		{"public client with S256", public, challenge, "S256", true},
+		{"confidential client with S256", confidential, challenge, "S256", true},
+		{"confidential client without PKCE", confidential, "", "", true},
+		{"public client without PKCE", public, "", "", false},
+		{"plain", public, challenge, "plain", false},
+		{"no method", confidential, challenge, "", false},
+		{"method without challenge", confidential, "", "S256", false},
+		{"short challenge", public, "abc", "S256", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.CheckCodeChallenge(tt.client, tt.challenge, tt.method)
+			if (err == nil) != tt.ok {
+				t.Errorf("CheckCodeChallenge = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCodeVerifierMatches(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mJ92K1qW8YtmFJrN5Q0pOj1Dp2OtLo"
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	if !codeVerifierMatches(challenge, verifier) {
+		t.Error("the verifier of the challenge does not match")
+	}
+	for _, v := range []string{"", verifier[:42], verifier[:42] + "x", challenge, verifier + " "} {
+		if codeVerifierMatches(challenge, v) {
+			t.Errorf("verifier %q matches", v)
+		}
+	}
+}
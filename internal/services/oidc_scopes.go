@@ -0,0 +1,89 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// standardScopes are understood by every client; any other scope must be
+// defined by the organization and listed in the client's scope
+var standardScopes = []string{"openid", "profile", "email", ScopeOfflineAccess}
+
+var (
+	ErrUnknownScope    = errors.New("unknown scope")
+	ErrUnknownAudience = errors.New("unknown audience")
+)
+
+// ResolveScope checks the scopes of an authorization request against the
+// client registration. Errors are RFC 6749 error codes.
+func (s *oidcService) ResolveScope(client *models.OAuthClient, requested string) (string, error) {
+	allowed := strings.Fields(client.Scope)
+	scopes := strings.Fields(requested)
+	for _, sc := range scopes {
+		if !containsString(standardScopes, sc) && !containsString(allowed, sc) {
+			return "", errors.New("invalid_scope")
+		}
+	}
+	// The client's token policy may allow fewer scopes than it lists
+	resolved, ok := allowedScope(client, strings.Join(scopes, " "))
+	if !ok {
+		return "", errors.New("invalid_scope")
+	}
+	return resolved, nil
+}
+
+// CheckClientScopes verifies that the custom scopes and audiences of a
+// client registration are defined by its organization
+func (s *oidcService) CheckClientScopes(orgID, scope string, audiences []string) error {
+	var custom []string
+	for _, sc := range strings.Fields(scope) {
+		if !containsString(standardScopes, sc) {
+			custom = append(custom, sc)
+		}
+	}
+
+	if len(custom) > 0 {
+		defined, err := s.queries.OIDC.ListScopesByOrg(orgID)
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(defined))
+		for _, d := range defined {
+			names = append(names, d.Name)
+		}
+		for _, sc := range custom {
+			if !containsString(names, sc) {
+				return fmt.Errorf("%w: %s", ErrUnknownScope, sc)
+			}
+		}
+	}
+
+	if len(audiences) > 0 {
+		defined, err := s.queries.OIDC.ListAudiencesByOrg(orgID)
+		if err != nil {
+			return err
+		}
+		identifiers := make([]string, 0, len(defined))
+		for _, d := range defined {
+			identifiers = append(identifiers, d.Identifier)
+		}
+		for _, aud := range audiences {
+			if !containsString(identifiers, aud) {
+				return fmt.Errorf("%w: %s", ErrUnknownAudience, aud)
+			}
+		}
+	}
+	return nil
+}
+
+// tokenAudience is the aud claim of a client's access tokens: the client
+// itself, plus the APIs attached to it
+func tokenAudience(client *models.OAuthClient) interface{} {
+	if len(client.Audiences) == 0 {
+		return client.ID
+	}
+	return append([]string{client.ID}, client.Audiences...)
+}
@@ -1,11 +1,10 @@
 package services
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
-	"encoding/base64"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -13,24 +12,69 @@ import (
 	"github.com/the-monkeys/monkeys-identity/internal/config"
 	"github.com/the-monkeys/monkeys-identity/internal/models"
 	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/internal/signing"
 	"github.com/the-monkeys/monkeys-identity/pkg/utils"
 	"golang.org/x/crypto/bcrypt"
 )
 
-const jwksKeyID = "monkeys-iam-main-key"
-
 type OIDCService interface {
 	ValidateClient(clientID, clientSecret, redirectURI string) (*models.OAuthClient, error)
-	CreateAuthorizationCode(userID, orgID, clientID, scope, nonce, redirectURI string) (string, error)
-	ExchangeCodeForToken(code, clientID, clientSecret string) (*TokenResponse, error)
+	// CreateAuthorizationCode issues the code answering an authorization
+	// request the user approved
+	CreateAuthorizationCode(userID, orgID string, req *models.PushedAuthorizationRequest) (string, error)
+	// ExchangeCodeForToken redeems a code; codeVerifier is the PKCE secret
+	// of the challenge the code was issued for
+	ExchangeCodeForToken(code, clientID, clientSecret, codeVerifier string) (*TokenResponse, error)
+	ExchangeToken(req TokenExchangeRequest) (*TokenExchangeResponse, error)
+	RefreshAccessToken(refreshToken, clientID, clientSecret string) (*TokenResponse, error)
+	ConsentCovers(userID, clientID, scope string) (bool, error)
+	GrantConsent(userID, orgID, clientID, scope string) error
+	ResolveScope(client *models.OAuthClient, requested string) (string, error)
+	// CheckCodeChallenge checks the PKCE parameters of an authorization
+	// request; public clients must send them
+	CheckCodeChallenge(client *models.OAuthClient, challenge, method string) error
+	CheckClientScopes(orgID, scope string, audiences []string) error
+	// PushAuthorizationRequest stores an authorization request pushed by a
+	// client (RFC 9126) and returns its request_uri
+	PushAuthorizationRequest(clientSecret string, req *models.PushedAuthorizationRequest) (string, error)
+	// StoreAuthorizationRequest keeps a validated authorization request
+	// under a new request_uri, while the user decides on consent
+	StoreAuthorizationRequest(req *models.PushedAuthorizationRequest) (string, error)
+	// ResolvePushedRequest returns the request a request_uri refers to
+	ResolvePushedRequest(clientID, requestURI string) (*models.PushedAuthorizationRequest, error)
+	// LookupAuthorizationRequest returns the request a request_uri refers
+	// to, whichever client it is for
+	LookupAuthorizationRequest(requestURI string) (*models.PushedAuthorizationRequest, error)
+	// ConsumePushedRequest ends a request_uri as it is answered; it fails
+	// when the request was already answered
+	ConsumePushedRequest(requestURI string) error
+	// StartDeviceAuthorization begins an RFC 8628 device authorization
+	StartDeviceAuthorization(clientID, clientSecret, scope string) (*DeviceAuthorizationResponse, error)
+	// LookupDeviceAuthorization returns the pending device authorization of
+	// a user code, or nil
+	LookupDeviceAuthorization(userCode string) (*models.DeviceAuthorization, error)
+	// DecideDeviceAuthorization approves or denies a device authorization
+	DecideDeviceAuthorization(userCode, userID, orgID string, allow bool) error
+	// ExchangeDeviceCode serves the device_code grant
+	ExchangeDeviceCode(deviceCode, clientID, clientSecret string) (*TokenResponse, error)
+	// GetDiscoveryConfiguration is the OpenID Connect discovery document
 	GetDiscoveryConfiguration() map[string]interface{}
+	// GetAuthorizationServerMetadata is the OAuth 2.0 authorization server
+	// metadata of RFC 8414, for clients that do not speak OpenID Connect
+	GetAuthorizationServerMetadata() map[string]interface{}
 	GetJWKS() (map[string]interface{}, error)
 	UpdateClient(clientID string, client *models.OAuthClient) error
+	// ClientAllowsOrigin reports whether the client registered an origin
+	// matching origin
+	ClientAllowsOrigin(clientID, origin string) bool
+	// AnyClientAllowsOrigin reports whether any client registered an origin
+	// matching origin, for CORS preflight requests which do not name the client
+	AnyClientAllowsOrigin(origin string) bool
 }
 
 type TokenResponse struct {
 	AccessToken  string `json:"access_token"`
-	IDToken      string `json:"id_token"`
+	IDToken      string `json:"id_token,omitempty"`
 	RefreshToken string `json:"refresh_token,omitempty"`
 	TokenType    string `json:"token_type"`
 	ExpiresIn    int64  `json:"expires_in"`
@@ -38,35 +82,33 @@ type TokenResponse struct {
 }
 
 type oidcService struct {
-	queries    *queries.Queries
-	config     *config.Config
-	privateKey *rsa.PrivateKey
+	queries *queries.Queries
+	config  *config.Config
+	keys    *signing.KeyManager
+
+	// origins caches the origin patterns of all clients for preflights
+	originsMu sync.Mutex
+	origins   []string
+	originsAt time.Time
 }
 
-func NewOIDCService(queries *queries.Queries, cfg *config.Config) OIDCService {
-	s := &oidcService{
+func NewOIDCService(queries *queries.Queries, cfg *config.Config, keys *signing.KeyManager) OIDCService {
+	return &oidcService{
 		queries: queries,
 		config:  cfg,
+		keys:    keys,
 	}
+}
 
-	// Try to load private key from config
-	if cfg.JWTPrivateKey != "" {
-		priv, err := utils.LoadRSAPrivateKey(cfg.JWTPrivateKey)
-		if err == nil {
-			s.privateKey = priv
-		}
-	}
-
-	// Generate a temporary key if none provided (useful for development)
-	if s.privateKey == nil {
-		fmt.Println("WARNING: No OIDC private key provided. Generating a temporary one...")
-		key, err := rsa.GenerateKey(rand.Reader, 2048)
-		if err == nil {
-			s.privateKey = key
-		}
+// clientSecretMatches reports whether secret is the client's secret, or the
+// secret its last rotation replaced while that is still accepted
+func clientSecretMatches(client *models.OAuthClient, secret string) bool {
+	if bcrypt.CompareHashAndPassword([]byte(client.ClientSecretHash), []byte(secret)) == nil {
+		return true
 	}
-
-	return s
+	return client.PreviousSecretHash != "" && client.PreviousSecretExpiresAt != nil &&
+		time.Now().Before(*client.PreviousSecretExpiresAt) &&
+		bcrypt.CompareHashAndPassword([]byte(client.PreviousSecretHash), []byte(secret)) == nil
 }
 
 func (s *oidcService) ValidateClient(clientID, clientSecret, redirectURI string) (*models.OAuthClient, error) {
@@ -81,15 +123,16 @@ func (s *oidcService) ValidateClient(clientID, clientSecret, redirectURI string)
 	// Verify secret if it's a confidential client and secret is provided
 	// (Secret is not required for front-channel authorize/consent requests)
 	if !client.IsPublic && clientSecret != "" {
-		if err := bcrypt.CompareHashAndPassword([]byte(client.ClientSecretHash), []byte(clientSecret)); err != nil {
+		if !clientSecretMatches(client, clientSecret) {
 			return nil, errors.New("invalid_client_secret")
 		}
 	}
 
-	// Validate redirect URI
+	// Validate redirect URI; wildcard patterns only count for clients that
+	// opted in to them
 	validURI := false
 	for _, uri := range client.RedirectURIs {
-		if uri == redirectURI {
+		if uri == redirectURI || (client.AllowWildcards && utils.MatchRedirectURI(uri, redirectURI)) {
 			validURI = true
 			break
 		}
@@ -101,18 +144,22 @@ func (s *oidcService) ValidateClient(clientID, clientSecret, redirectURI string)
 	return client, nil
 }
 
-func (s *oidcService) CreateAuthorizationCode(userID, orgID, clientID, scope, nonce, redirectURI string) (string, error) {
+func (s *oidcService) CreateAuthorizationCode(userID, orgID string, req *models.PushedAuthorizationRequest) (string, error) {
 	code := uuid.New().String()
 	authCode := &models.OIDCAuthCode{
 		Code:           code,
 		UserID:         userID,
 		OrganizationID: orgID,
-		ClientID:       clientID,
-		Scope:          scope,
-		RedirectURI:    redirectURI,
+		ClientID:       req.ClientID,
+		Scope:          req.Scope,
+		RedirectURI:    req.RedirectURI,
 		ExpiresAt:      time.Now().Add(10 * time.Minute),
+
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
 	}
-	if nonce != "" {
+	if req.Nonce != "" {
+		nonce := req.Nonce
 		authCode.Nonce = &nonce
 	}
 
@@ -123,7 +170,14 @@ func (s *oidcService) CreateAuthorizationCode(userID, orgID, clientID, scope, no
 	return code, nil
 }
 
-func (s *oidcService) ExchangeCodeForToken(code, clientID, clientSecret string) (*TokenResponse, error) {
+// organizationDeleting reports whether the organization is scheduled for
+// deletion; its users get no new tokens
+func (s *oidcService) organizationDeleting(organizationID string) bool {
+	deletion, err := s.queries.OrgDeletion.Get(organizationID)
+	return err == nil && deletion.Status == "scheduled"
+}
+
+func (s *oidcService) ExchangeCodeForToken(code, clientID, clientSecret, codeVerifier string) (*TokenResponse, error) {
 	authCode, err := s.queries.OIDC.GetAuthCode(code)
 	if err != nil {
 		return nil, err
@@ -131,6 +185,9 @@ func (s *oidcService) ExchangeCodeForToken(code, clientID, clientSecret string)
 	if authCode == nil || authCode.Used || authCode.ExpiresAt.Before(time.Now()) {
 		return nil, errors.New("invalid_grant")
 	}
+	if s.organizationDeleting(authCode.OrganizationID) {
+		return nil, errors.New("invalid_grant")
+	}
 
 	// Validate client and secret
 	client, err := s.ValidateClient(clientID, clientSecret, authCode.RedirectURI)
@@ -142,27 +199,49 @@ func (s *oidcService) ExchangeCodeForToken(code, clientID, clientSecret string)
 	if !client.IsPublic && clientSecret == "" {
 		return nil, errors.New("invalid_client_secret")
 	}
+	// A code issued for a PKCE challenge is only redeemed with its verifier,
+	// and a verifier without a challenge is refused (RFC 9700 Section 2.1.1)
+	if authCode.CodeChallenge != "" {
+		if !codeVerifierMatches(authCode.CodeChallenge, codeVerifier) {
+			return nil, errors.New("invalid_grant")
+		}
+	} else if codeVerifier != "" {
+		return nil, errors.New("invalid_grant")
+	}
 
 	// Mark code as used
 	if err := s.queries.OIDC.MarkAuthCodeUsed(code); err != nil {
 		return nil, err
 	}
+	return s.issueTokens(client, authCode.UserID, authCode.OrganizationID, authCode.Scope, authCode.Nonce, "authorization_code")
+}
 
+// issueTokens issues the ID and access tokens of a user's authorization of
+// a client, plus a refresh token when offline_access was granted
+func (s *oidcService) issueTokens(client *models.OAuthClient, userID, orgID, scope string, nonce *string, grantType string) (*TokenResponse, error) {
 	// Fetch user profile for ID token claims
-	user, err := s.queries.Auth.GetUserByID(authCode.UserID, authCode.OrganizationID)
+	user, err := s.queries.Auth.GetUserByID(userID, orgID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch user for ID token claims: %w", err)
 	}
+	ttls, err := s.tokenTTLs(client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve token lifetimes: %w", err)
+	}
+	custom, err := s.resolveCustomClaims(client, userID, orgID, scope, grantType)
+	if err != nil {
+		return nil, err
+	}
 
 	// Generate ID Token (OIDC)
 	now := time.Now()
 	idClaims := jwt.MapClaims{
 		"iss":   s.config.OIDCIssuer,
-		"sub":   authCode.UserID,
-		"aud":   clientID,
-		"exp":   now.Add(time.Hour).Unix(),
+		"sub":   userID,
+		"aud":   client.ID,
+		"exp":   now.Add(ttls.id).Unix(),
 		"iat":   now.Unix(),
-		"nonce": authCode.Nonce,
+		"nonce": nonce,
 	}
 
 	// Add profile and email claims based on requested scopes
@@ -172,58 +251,97 @@ func (s *oidcService) ExchangeCodeForToken(code, clientID, clientSecret string)
 		idClaims["name"] = user.DisplayName
 		idClaims["preferred_username"] = user.Username
 	}
+	addClaims(idClaims, custom.id)
 
-	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, idClaims)
-	idToken.Header["kid"] = jwksKeyID
-	idTokenString, err := idToken.SignedString(s.privateKey)
+	idTokenString, err := s.keys.Sign(idClaims)
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign id_token: %w", err)
 	}
 
-	// Access Token (Structured RS256 JWT)
+	accessTokenString, err := s.issueAccessToken(userID, orgID, client, scope, ttls.access, custom.access)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &TokenResponse{
+		AccessToken: accessTokenString,
+		IDToken:     idTokenString,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(ttls.access / time.Second),
+		Scope:       scope,
+	}
+
+	// Offline access is tied to the remembered consent so revoking it ends the refresh tokens
+	if containsString(strings.Fields(scope), ScopeOfflineAccess) && refreshTokensAllowed(client) {
+		refreshToken, err := s.issueRefreshToken(userID, client.ID, scope, ttls.refresh)
+		if err != nil {
+			return nil, err
+		}
+		resp.RefreshToken = refreshToken
+	}
+
+	s.queries.Stats.RecordTokenIssued(orgID, grantType)
+	return resp, nil
+}
+
+// issueAccessToken signs a structured RS256 access token for a client,
+// with the custom claims mapped for it
+func (s *oidcService) issueAccessToken(userID, orgID string, client *models.OAuthClient, scope string, ttl time.Duration, custom jwt.MapClaims) (string, error) {
+	now := time.Now()
 	accessClaims := jwt.MapClaims{
 		"iss":             s.config.OIDCIssuer,
-		"sub":             authCode.UserID,
-		"aud":             clientID,
-		"exp":             now.Add(time.Hour).Unix(),
+		"sub":             userID,
+		"aud":             tokenAudience(client),
+		"exp":             now.Add(ttl).Unix(),
 		"iat":             now.Unix(),
-		"scope":           authCode.Scope,
-		"client_id":       clientID,
+		"jti":             uuid.New().String(),
+		"scope":           scope,
+		"client_id":       client.ID,
 		"type":            "access",
-		"organization_id": authCode.OrganizationID,
+		"organization_id": orgID,
 	}
+	addClaims(accessClaims, custom)
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodRS256, accessClaims)
-	accessToken.Header["kid"] = jwksKeyID
-	accessTokenString, err := accessToken.SignedString(s.privateKey)
+	signed, err := s.keys.Sign(accessClaims)
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign access_token: %w", err)
+		return "", fmt.Errorf("failed to sign access_token: %w", err)
 	}
-
-	return &TokenResponse{
-		AccessToken: accessTokenString,
-		IDToken:     idTokenString,
-		TokenType:   "Bearer",
-		ExpiresIn:   3600,
-		Scope:       authCode.Scope,
-	}, nil
+	return signed, nil
 }
 
-func (s *oidcService) GetDiscoveryConfiguration() map[string]interface{} {
-	issuer := s.config.OIDCIssuer
+// serverMetadata is what the OpenID Connect discovery document and the
+// RFC 8414 metadata share. Every URL is built from PUBLIC_URL, so a
+// deployment behind a path prefix publishes URLs under that prefix.
+func (s *oidcService) serverMetadata() map[string]interface{} {
+	base := s.config.PublicURL
 	return map[string]interface{}{
-		"issuer":                                issuer,
-		"authorization_endpoint":                issuer + "/api/v1/oauth2/authorize",
-		"token_endpoint":                        issuer + "/api/v1/oauth2/token",
-		"userinfo_endpoint":                     issuer + "/api/v1/oauth2/userinfo",
-		"jwks_uri":                              issuer + "/.well-known/jwks.json",
-		"scopes_supported":                      []string{"openid", "profile", "email"},
+		"issuer":                                s.config.OIDCIssuer,
+		"authorization_endpoint":                base + "/api/v1/oauth2/authorize",
+		"token_endpoint":                        base + "/api/v1/oauth2/token",
+		"pushed_authorization_request_endpoint": base + "/api/v1/oauth2/par",
+		"device_authorization_endpoint":         base + "/api/v1/oauth2/device_authorization",
+		"jwks_uri":                              base + "/.well-known/jwks.json",
+		"scopes_supported":                      []string{"openid", "profile", "email", ScopeOfflineAccess},
+		"grant_types_supported":                 []string{"authorization_code", GrantTypeRefreshToken, GrantTypeTokenExchange, GrantTypeDeviceCode},
 		"response_types_supported":              []string{"code", "token", "id_token"},
-		"subject_types_supported":               []string{"public"},
-		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"require_pushed_authorization_requests": false,
+		"code_challenge_methods_supported":      []string{PKCEMethodS256},
 	}
 }
 
+func (s *oidcService) GetDiscoveryConfiguration() map[string]interface{} {
+	doc := s.serverMetadata()
+	doc["userinfo_endpoint"] = s.config.PublicURL + "/api/v1/oauth2/userinfo"
+	doc["subject_types_supported"] = []string{"public"}
+	doc["id_token_signing_alg_values_supported"] = []string{"RS256"}
+	return doc
+}
+
+func (s *oidcService) GetAuthorizationServerMetadata() map[string]interface{} {
+	return s.serverMetadata()
+}
+
 func (s *oidcService) UpdateClient(clientID string, client *models.OAuthClient) error {
 	existing, err := s.queries.OIDC.GetClientByID(clientID)
 	if err != nil {
@@ -235,38 +353,26 @@ func (s *oidcService) UpdateClient(clientID string, client *models.OAuthClient)
 
 	// Update fields
 	existing.ClientName = client.ClientName
+	if len(client.GrantTypes) > 0 {
+		existing.GrantTypes = client.GrantTypes
+	}
 	existing.RedirectURIs = client.RedirectURIs
 	existing.Scope = client.Scope
+	if client.Audiences != nil {
+		existing.Audiences = client.Audiences
+	}
+	existing.AllowedOrigins = client.AllowedOrigins
+	existing.AllowWildcards = client.AllowWildcards
 	existing.IsPublic = client.IsPublic
 	existing.LogoURL = client.LogoURL
 	existing.PolicyURI = client.PolicyURI
 	existing.TosURI = client.TosURI
+	existing.TokenPolicy = client.TokenPolicy
 	existing.UpdatedAt = time.Now()
 
 	return s.queries.OIDC.UpdateClient(existing)
 }
 
 func (s *oidcService) GetJWKS() (map[string]interface{}, error) {
-	if s.privateKey == nil {
-		return nil, errors.New("no_private_key_available")
-	}
-
-	publicKey := s.privateKey.Public().(*rsa.PublicKey)
-
-	// RFC 7517: n and e must be base64url-encoded (no padding)
-	nBytes := publicKey.N.Bytes()
-	nBase64 := base64.RawURLEncoding.EncodeToString(nBytes)
-
-	return map[string]interface{}{
-		"keys": []map[string]interface{}{
-			{
-				"kty": "RSA",
-				"alg": "RS256",
-				"use": "sig",
-				"kid": jwksKeyID,
-				"n":   nBase64,
-				"e":   "AQAB",
-			},
-		},
-	}, nil
+	return s.keys.JWKS(), nil
 }
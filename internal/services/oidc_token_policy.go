@@ -0,0 +1,78 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// defaultClientTokenTTL is the lifetime of the access and ID tokens of
+// clients that do not set their own
+const defaultClientTokenTTL = time.Hour
+
+// clientTokenTTLs are the lifetimes of the tokens issued to one client
+type clientTokenTTLs struct {
+	access, id, refresh time.Duration
+}
+
+// tokenTTLs returns the lifetimes of a client's tokens: those of its token
+// policy, else the defaults, capped by its organization's client token
+// limits. Limits lowered after the client set its policy apply at once.
+func (s *oidcService) tokenTTLs(client *models.OAuthClient) (clientTokenTTLs, error) {
+	ttls := clientTokenTTLs{access: defaultClientTokenTTL, id: defaultClientTokenTTL, refresh: s.config.RefreshTokenTTL}
+	if p := client.TokenPolicy; p != nil {
+		override(&ttls.access, p.AccessTokenTTL)
+		override(&ttls.id, p.IDTokenTTL)
+		override(&ttls.refresh, p.RefreshTokenTTL)
+	}
+
+	limits, err := s.queries.Organization.GetClientTokenLimits(client.OrganizationID)
+	if err != nil {
+		return ttls, err
+	}
+	if limits != nil {
+		capAt(&ttls.access, limits.MaxAccessTokenTTL)
+		capAt(&ttls.id, limits.MaxIDTokenTTL)
+		capAt(&ttls.refresh, limits.MaxRefreshTokenTTL)
+	}
+	return ttls, nil
+}
+
+// override sets *d to the duration in value, when it holds a valid one
+func override(d *time.Duration, value string) {
+	if v, err := time.ParseDuration(value); err == nil && v > 0 {
+		*d = v
+	}
+}
+
+// capAt lowers *d to the duration in value, when it holds a valid one
+func capAt(d *time.Duration, value string) {
+	if v, err := time.ParseDuration(value); err == nil && v > 0 && v < *d {
+		*d = v
+	}
+}
+
+// allowedScope returns the scopes of scope the client's token policy lets
+// its tokens carry, and whether that is all of them
+func allowedScope(client *models.OAuthClient, scope string) (string, bool) {
+	if client.TokenPolicy == nil || len(client.TokenPolicy.AllowedScopes) == 0 {
+		return scope, true
+	}
+	var kept []string
+	all := true
+	for _, sc := range strings.Fields(scope) {
+		if containsString(client.TokenPolicy.AllowedScopes, sc) {
+			kept = append(kept, sc)
+		} else {
+			all = false
+		}
+	}
+	return strings.Join(kept, " "), all
+}
+
+// refreshTokensAllowed reports whether the client may get and use refresh
+// tokens
+func refreshTokensAllowed(client *models.OAuthClient) bool {
+	return client.TokenPolicy == nil || !client.TokenPolicy.DisableRefreshTokens
+}
@@ -0,0 +1,468 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/jobs"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/internal/storage"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+const (
+	// disabledOrganizationsKey is a set of the organizations whose users and
+	// service accounts may not sign in or use their tokens
+	disabledOrganizationsKey = "disabled_organizations"
+
+	orgExportTimeout    = 15 * time.Minute
+	orgExportPageSize   = 1000
+	orgExportAuditLimit = 100000
+)
+
+// ErrOrganizationExportNotReady is returned when downloading the final export
+// of an organization before it has been built
+var ErrOrganizationExportNotReady = errors.New("organization export not ready")
+
+// OrganizationDisabled reports whether sign-ins to the organization are
+// disabled. Like the token blacklist it fails open when Redis is unavailable.
+func OrganizationDisabled(ctx context.Context, redis redis.UniversalClient, organizationID string) bool {
+	if organizationID == "" {
+		return false
+	}
+	disabled, err := redis.SIsMember(ctx, disabledOrganizationsKey, organizationID).Result()
+	return err == nil && disabled
+}
+
+// OrganizationDeletionService deletes organizations after a grace period.
+// Scheduling a deletion suspends the organization, signs everyone in it out
+// and builds a final data export in the storage backend. Once the grace
+// period has passed a job soft-deletes the organization and its contents;
+// until then a root user can cancel.
+type OrganizationDeletionService interface {
+	Schedule(ctx context.Context, organizationID, requestedBy, reason string) (*models.OrganizationDeletion, error)
+	Get(ctx context.Context, organizationID string) (*models.OrganizationDeletion, error)
+	Cancel(ctx context.Context, organizationID, cancelledBy string) (*models.OrganizationDeletion, error)
+	// OpenExport returns a reader of the final export, a ZIP archive with one
+	// JSON file per section; the caller closes it
+	OpenExport(ctx context.Context, organizationID string) (io.ReadCloser, *models.OrganizationDeletion, error)
+	// RunDue builds missing exports and carries out the deletions that are
+	// due, returning how many were carried out
+	RunDue(ctx context.Context) (int, error)
+	RegisterJobs(scheduler *jobs.Scheduler) error
+}
+
+type organizationDeletionService struct {
+	queries     *queries.Queries
+	redis       redis.UniversalClient
+	store       storage.Backend
+	audit       AuditService
+	logger      *logger.Logger
+	gracePeriod time.Duration
+}
+
+// NewOrganizationDeletionService creates a new instance of
+// OrganizationDeletionService
+func NewOrganizationDeletionService(q *queries.Queries, redis redis.UniversalClient, store storage.Backend, audit AuditService, gracePeriod time.Duration, l *logger.Logger) OrganizationDeletionService {
+	return &organizationDeletionService{queries: q, redis: redis, store: store, audit: audit, logger: l, gracePeriod: gracePeriod}
+}
+
+func organizationExportKey(organizationID string, at time.Time) string {
+	return fmt.Sprintf("organization-exports/%s/%s.zip", organizationID, at.UTC().Format("20060102T150405Z"))
+}
+
+func (s *organizationDeletionService) Schedule(ctx context.Context, organizationID, requestedBy, reason string) (*models.OrganizationDeletion, error) {
+	q := s.queries.WithContext(ctx)
+	if _, err := q.Organization.GetOrganization(organizationID); err != nil {
+		return nil, err
+	}
+
+	d := &models.OrganizationDeletion{
+		OrganizationID: organizationID,
+		RequestedBy:    utils.StringPtr(requestedBy),
+		Reason:         reason,
+		ScheduledFor:   time.Now().Add(s.gracePeriod),
+	}
+	var revoked []*models.Session
+	err := q.Transact(ctx, func(q *queries.Queries) error {
+		if err := q.OrgDeletion.Schedule(d); err != nil {
+			return err
+		}
+		var err error
+		revoked, err = q.Session.RevokeOrganizationSessions(organizationID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.redis.SAdd(ctx, disabledOrganizationsKey, organizationID).Err(); err != nil {
+		// The deletion job restores the set from the database
+		s.logger.Error("Failed to disable sign-ins of organization %s: %v", organizationID, err)
+	}
+	// Access tokens of the revoked sessions stop working now rather than
+	// when they expire, and stay revoked if the deletion is cancelled
+	now := time.Now()
+	for _, session := range revoked {
+		if ttl := session.ExpiresAt.Sub(now); ttl > 0 {
+			s.redis.Set(ctx, "blacklist:"+session.ID, "revoked", ttl)
+		}
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), orgExportTimeout)
+		defer cancel()
+		s.export(ctx, organizationID)
+	}()
+
+	details, _ := json.Marshal(map[string]interface{}{
+		"reason":           reason,
+		"scheduled_for":    d.ScheduledFor,
+		"revoked_sessions": len(revoked),
+	})
+	s.audit.LogEvent(ctx, models.AuditEvent{
+		OrganizationID:    organizationID,
+		PrincipalID:       utils.StringPtr(requestedBy),
+		PrincipalType:     utils.StringPtr("user"),
+		Action:            "organization_deletion_scheduled",
+		ResourceType:      utils.StringPtr("organization"),
+		ResourceID:        utils.StringPtr(organizationID),
+		Result:            "success",
+		AdditionalContext: string(details),
+		Severity:          "critical",
+	})
+	return d, nil
+}
+
+func (s *organizationDeletionService) Get(ctx context.Context, organizationID string) (*models.OrganizationDeletion, error) {
+	return s.queries.WithContext(ctx).OrgDeletion.Get(organizationID)
+}
+
+func (s *organizationDeletionService) Cancel(ctx context.Context, organizationID, cancelledBy string) (*models.OrganizationDeletion, error) {
+	var d *models.OrganizationDeletion
+	err := s.queries.WithContext(ctx).Transact(ctx, func(q *queries.Queries) error {
+		var err error
+		d, err = q.OrgDeletion.Cancel(organizationID, cancelledBy)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.redis.SRem(ctx, disabledOrganizationsKey, organizationID).Err(); err != nil {
+		s.logger.Error("Failed to enable sign-ins of organization %s: %v", organizationID, err)
+	}
+	// The export of an organization that stays is not kept around
+	if d.ExportKey != "" {
+		if err := s.store.Delete(ctx, d.ExportKey); err != nil {
+			s.logger.Warn("Failed to delete export of organization %s: %v", organizationID, err)
+		}
+	}
+
+	details, _ := json.Marshal(map[string]interface{}{
+		"scheduled_for": d.ScheduledFor,
+		"prior_status":  d.PriorStatus,
+	})
+	s.audit.LogEvent(ctx, models.AuditEvent{
+		OrganizationID:    organizationID,
+		PrincipalID:       utils.StringPtr(cancelledBy),
+		PrincipalType:     utils.StringPtr("user"),
+		Action:            "organization_deletion_cancelled",
+		ResourceType:      utils.StringPtr("organization"),
+		ResourceID:        utils.StringPtr(organizationID),
+		Result:            "success",
+		AdditionalContext: string(details),
+		Severity:          "critical",
+	})
+	return d, nil
+}
+
+func (s *organizationDeletionService) OpenExport(ctx context.Context, organizationID string) (io.ReadCloser, *models.OrganizationDeletion, error) {
+	d, err := s.Get(ctx, organizationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if d.Status == "cancelled" {
+		return nil, nil, fmt.Errorf("organization deletion not found")
+	}
+	if d.ExportStatus != "completed" || d.ExportKey == "" {
+		return nil, nil, ErrOrganizationExportNotReady
+	}
+	r, err := s.store.Open(ctx, d.ExportKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, d, nil
+}
+
+func (s *organizationDeletionService) RunDue(ctx context.Context) (int, error) {
+	q := s.queries.WithContext(ctx)
+	scheduled, err := q.OrgDeletion.ListScheduled()
+	if err != nil {
+		return 0, err
+	}
+	s.syncDisabled(ctx, scheduled)
+
+	completed := 0
+	now := time.Now()
+	for _, d := range scheduled {
+		// Exports still pending past the build timeout were lost, e.g. to a
+		// restart, and failed ones are retried
+		if d.ExportStatus == "failed" || (d.ExportStatus == "pending" && now.Sub(d.RequestedAt) > orgExportTimeout) {
+			if s.export(ctx, d.OrganizationID) {
+				d.ExportStatus = "completed"
+			}
+		}
+		if d.ScheduledFor.After(now) {
+			continue
+		}
+		// Nothing is deleted before its final export exists; the deletion
+		// stays scheduled until the export succeeds or a root user cancels
+		if d.ExportStatus != "completed" {
+			s.logger.Error("Deletion of organization %s is due but its final export is missing", d.OrganizationID)
+			continue
+		}
+		if err := s.complete(ctx, d); err != nil {
+			s.logger.Error("Failed to delete organization %s: %v", d.OrganizationID, err)
+			continue
+		}
+		completed++
+	}
+	return completed, nil
+}
+
+// syncDisabled restores the set of disabled organizations from the
+// scheduled deletions, which are the source of truth
+func (s *organizationDeletionService) syncDisabled(ctx context.Context, scheduled []models.OrganizationDeletion) {
+	want := make(map[string]bool, len(scheduled))
+	for _, d := range scheduled {
+		want[d.OrganizationID] = true
+		s.redis.SAdd(ctx, disabledOrganizationsKey, d.OrganizationID)
+	}
+	members, err := s.redis.SMembers(ctx, disabledOrganizationsKey).Result()
+	if err != nil {
+		s.logger.Warn("Failed to read disabled organizations: %v", err)
+		return
+	}
+	for _, id := range members {
+		if !want[id] {
+			s.redis.SRem(ctx, disabledOrganizationsKey, id)
+		}
+	}
+}
+
+func (s *organizationDeletionService) complete(ctx context.Context, d models.OrganizationDeletion) error {
+	var counts map[string]int64
+	err := s.queries.WithContext(ctx).Transact(ctx, func(q *queries.Queries) error {
+		var err error
+		counts, err = q.OrgDeletion.Complete(d.OrganizationID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s.redis.SRem(ctx, disabledOrganizationsKey, d.OrganizationID)
+	s.logger.Info("Deleted organization %s scheduled for %s", d.OrganizationID, d.ScheduledFor.Format(time.RFC3339))
+
+	details, _ := json.Marshal(map[string]interface{}{
+		"requested_by":  d.RequestedBy,
+		"scheduled_for": d.ScheduledFor,
+		"deleted":       counts,
+	})
+	s.audit.LogEvent(ctx, models.AuditEvent{
+		OrganizationID:    d.OrganizationID,
+		PrincipalType:     utils.StringPtr("system"),
+		Action:            "organization_deleted",
+		ResourceType:      utils.StringPtr("organization"),
+		ResourceID:        utils.StringPtr(d.OrganizationID),
+		Result:            "success",
+		AdditionalContext: string(details),
+		Severity:          "critical",
+	})
+	return nil
+}
+
+// export builds the final export of an organization, stores it and records
+// the outcome, reporting whether it succeeded
+func (s *organizationDeletionService) export(ctx context.Context, organizationID string) bool {
+	q := s.queries.WithContext(ctx)
+	archive, err := s.buildExport(ctx, organizationID)
+	if err != nil {
+		s.logger.Error("Final export of organization %s failed: %v", organizationID, err)
+		if err := q.OrgDeletion.SetExport(organizationID, "", 0, "Failed to assemble export"); err != nil {
+			s.logger.Error("Failed to record export of organization %s: %v", organizationID, err)
+		}
+		return false
+	}
+
+	key := organizationExportKey(organizationID, time.Now())
+	if err := s.store.Put(ctx, key, bytes.NewReader(archive)); err != nil {
+		s.logger.Error("Failed to store final export of organization %s: %v", organizationID, err)
+		if err := q.OrgDeletion.SetExport(organizationID, "", 0, "Failed to store export"); err != nil {
+			s.logger.Error("Failed to record export of organization %s: %v", organizationID, err)
+		}
+		return false
+	}
+	if err := q.OrgDeletion.SetExport(organizationID, key, int64(len(archive)), ""); err != nil {
+		s.logger.Error("Failed to record export of organization %s: %v", organizationID, err)
+		s.store.Delete(ctx, key)
+		return false
+	}
+	s.logger.Info("Final export of organization %s stored (%d bytes)", organizationID, len(archive))
+	return true
+}
+
+// buildExport collects every section of the export into a ZIP archive
+func (s *organizationDeletionService) buildExport(ctx context.Context, organizationID string) ([]byte, error) {
+	q := s.queries.WithContext(ctx)
+
+	org, err := q.Organization.GetOrganization(organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("organization: %w", err)
+	}
+	users, err := q.Organization.ListOrganizationUsers(organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("users: %w", err)
+	}
+	groups, err := q.Organization.ListOrganizationGroups(organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("groups: %w", err)
+	}
+	roles, err := q.Organization.ListOrganizationRoles(organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("roles: %w", err)
+	}
+	policies, err := q.Organization.ListOrganizationPolicies(organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("policies: %w", err)
+	}
+	resources, err := q.Organization.ListOrganizationResources(organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("resources: %w", err)
+	}
+	clients, err := q.OIDC.ListClientsByOrg(organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("oauth clients: %w", err)
+	}
+
+	var serviceAccounts []models.ServiceAccount
+	params := queries.ListParams{Limit: orgExportPageSize}
+	for {
+		page, err := q.User.ListServiceAccounts(params, organizationID)
+		if err != nil {
+			return nil, fmt.Errorf("service accounts: %w", err)
+		}
+		serviceAccounts = append(serviceAccounts, page.Items...)
+		if !page.HasMore {
+			break
+		}
+		params.Offset += len(page.Items)
+		params.Cursor = page.NextCursor
+	}
+
+	// Content is listed per owner; collaborators see the same items again
+	var content []*models.ContentItem
+	seen := make(map[string]bool)
+	for _, user := range users {
+		params := queries.ListParams{Limit: orgExportPageSize}
+		for {
+			page, err := q.Content.ListContent(params, organizationID, user.ID, "")
+			if err != nil {
+				return nil, fmt.Errorf("content items: %w", err)
+			}
+			for _, item := range page.Items {
+				if !seen[item.ID] {
+					seen[item.ID] = true
+					content = append(content, item)
+				}
+			}
+			if !page.HasMore {
+				break
+			}
+			params.Offset += len(page.Items)
+			params.Cursor = page.NextCursor
+		}
+	}
+
+	var auditEvents []models.AuditEvent
+	for len(auditEvents) < orgExportAuditLimit {
+		events, _, err := q.Audit.ListAuditEvents(queries.ListAuditEventsParams{
+			OrganizationID: organizationID,
+			Limit:          orgExportPageSize,
+			Offset:         len(auditEvents),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("audit events: %w", err)
+		}
+		auditEvents = append(auditEvents, events...)
+		if len(events) < orgExportPageSize {
+			break
+		}
+	}
+
+	sections := []struct {
+		name string
+		data interface{}
+	}{
+		{"export", map[string]interface{}{
+			"organization_id": organizationID,
+			"generated_at":    time.Now(),
+			"audit_truncated": len(auditEvents) >= orgExportAuditLimit,
+		}},
+		{"organization", org},
+		{"users", emptyIfNil(users)},
+		{"service_accounts", emptyIfNil(serviceAccounts)},
+		{"groups", emptyIfNil(groups)},
+		{"roles", emptyIfNil(roles)},
+		{"policies", emptyIfNil(policies)},
+		{"resources", emptyIfNil(resources)},
+		{"oauth_clients", emptyIfNil(clients)},
+		{"content_items", emptyIfNil(content)},
+		{"audit_events", emptyIfNil(auditEvents)},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, section := range sections {
+		w, err := zw.Create(section.name + ".json")
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(section.data); err != nil {
+			return nil, fmt.Errorf("%s: %w", section.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RegisterJobs schedules building missing exports and carrying out due
+// deletions every five minutes
+func (s *organizationDeletionService) RegisterJobs(scheduler *jobs.Scheduler) error {
+	return scheduler.Register(jobs.Job{
+		Name:        "organization_deletion",
+		Description: "Delete organizations whose deletion grace period (" + s.gracePeriod.String() + ") has passed",
+		Schedule:    "@every 5m",
+		Timeout:     30 * time.Minute,
+		Run: func(ctx context.Context) error {
+			n, err := s.RunDue(ctx)
+			if n > 0 {
+				s.logger.Info("Deleted %d organizations past their deletion grace period", n)
+			}
+			return err
+		},
+	})
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+// One-time passcode delivery methods
+const (
+	OTPMethodEmail = "email"
+	OTPMethodSMS   = "sms"
+
+	otpDigits      = 6
+	otpTTL         = 5 * time.Minute
+	otpMaxAttempts = 5
+	otpResendWait  = 30 * time.Second
+)
+
+var (
+	ErrOTPExpired         = errors.New("code expired or not requested")
+	ErrOTPInvalid         = errors.New("invalid code")
+	ErrOTPTooManyAttempts = errors.New("too many attempts, request a new code")
+	ErrOTPResendTooSoon   = errors.New("a code was sent recently, wait before requesting another")
+	ErrOTPMethodDisabled  = errors.New("delivery method is not available")
+)
+
+// OTPRecipient is where a one-time passcode is delivered
+type OTPRecipient struct {
+	UserID   string
+	Username string
+	Email    string
+	Phone    string
+}
+
+// OTPService issues and verifies one-time passcodes delivered by email or
+// SMS. Codes are stored hashed in Redis, expire after five minutes and are
+// burnt after five wrong guesses. Purpose separates codes issued for
+// different flows (e.g. "setup" and "login") so one cannot stand in for the
+// other.
+type OTPService interface {
+	Send(ctx context.Context, purpose, method string, to OTPRecipient) error
+	Verify(ctx context.Context, purpose, method, userID, code string) error
+	MethodEnabled(method string) bool
+}
+
+type otpService struct {
+	redis  redis.UniversalClient
+	email  EmailService
+	sms    SMSProvider
+	logger *logger.Logger
+}
+
+// NewOTPService creates a new instance of OTPService. sms may be nil, in
+// which case SMS codes are unavailable.
+func NewOTPService(redis redis.UniversalClient, email EmailService, sms SMSProvider, l *logger.Logger) OTPService {
+	return &otpService{redis: redis, email: email, sms: sms, logger: l}
+}
+
+func otpKey(purpose, userID string) string {
+	return "mfa_otp:" + purpose + ":" + userID
+}
+
+func hashOTP(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *otpService) MethodEnabled(method string) bool {
+	switch method {
+	case OTPMethodEmail:
+		return s.email != nil
+	case OTPMethodSMS:
+		return s.sms != nil
+	}
+	return false
+}
+
+// Send generates a code, stores it and delivers it. A new code replaces any
+// pending one for the same purpose.
+func (s *otpService) Send(ctx context.Context, purpose, method string, to OTPRecipient) error {
+	if !s.MethodEnabled(method) {
+		return ErrOTPMethodDisabled
+	}
+	if method == OTPMethodSMS && to.Phone == "" {
+		return ErrOTPMethodDisabled
+	}
+
+	ok, err := s.redis.SetNX(ctx, otpKey(purpose, to.UserID)+":sent", "1", otpResendWait).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrOTPResendTooSoon
+	}
+
+	code, err := generateOTP()
+	if err != nil {
+		return err
+	}
+
+	key := otpKey(purpose, to.UserID)
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, "hash", hashOTP(code), "method", method, "attempts", 0)
+	pipe.Expire(ctx, key, otpTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	switch method {
+	case OTPMethodEmail:
+		err = s.email.SendOTPEmail(to.Email, to.Username, code, otpTTL)
+	case OTPMethodSMS:
+		err = s.sms.Send(ctx, to.Phone, fmt.Sprintf("Your Monkeys Identity verification code is %s. It expires in %d minutes.", code, int(otpTTL/time.Minute)))
+	}
+	if err != nil {
+		s.redis.Del(ctx, key, key+":sent")
+		return fmt.Errorf("failed to deliver %s code: %w", method, err)
+	}
+	return nil
+}
+
+// Verify checks a code sent with method. A correct code is consumed.
+func (s *otpService) Verify(ctx context.Context, purpose, method, userID, code string) error {
+	key := otpKey(purpose, userID)
+	pipe := s.redis.TxPipeline()
+	incr := pipe.HIncrBy(ctx, key, "attempts", 1)
+	get := pipe.HGetAll(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	stored := get.Val()
+	if stored["hash"] == "" {
+		// The counter just recreated an expired key
+		s.redis.Del(ctx, key)
+		return ErrOTPExpired
+	}
+	if incr.Val() > otpMaxAttempts {
+		s.redis.Del(ctx, key)
+		return ErrOTPTooManyAttempts
+	}
+
+	if stored["method"] != method || subtle.ConstantTimeCompare([]byte(stored["hash"]), []byte(hashOTP(code))) != 1 {
+		return ErrOTPInvalid
+	}
+
+	s.redis.Del(ctx, key, key+":sent")
+	return nil
+}
+
+func generateOTP() (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(otpDigits), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", otpDigits, n), nil
+}
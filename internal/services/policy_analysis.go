@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/authz"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+)
+
+// DefaultUnusedPolicyDays is the window without a sampled match after which
+// a policy is reported as unused
+const DefaultUnusedPolicyDays = 90
+
+// PolicyAnalysisReport lists problems found in an organization's policies,
+// most severe first
+type PolicyAnalysisReport struct {
+	OrganizationID   string    `json:"organization_id"`
+	GeneratedAt      time.Time `json:"generated_at"`
+	PoliciesAnalyzed int       `json:"policies_analyzed"`
+	UnusedDays       int       `json:"unused_days"`
+	// DecisionsSampled is how many logged decisions the unused policy check
+	// was based on; with none, unused policies are not reported
+	DecisionsSampled int             `json:"decisions_sampled"`
+	Summary          map[string]int  `json:"summary"`
+	Findings         []PolicyFinding `json:"findings"`
+}
+
+// PolicyFinding is a lint finding attributed to a policy
+type PolicyFinding struct {
+	PolicyID   string `json:"policy_id"`
+	PolicyName string `json:"policy_name"`
+	authz.LintFinding
+}
+
+// AnalyzePolicies lints every policy of the organization and, from the
+// sampled decision log, reports active policies that have not allowed or
+// denied anything within unusedDays
+func (s *authzService) AnalyzePolicies(ctx context.Context, orgID string, unusedDays int) (*PolicyAnalysisReport, error) {
+	if unusedDays <= 0 {
+		unusedDays = DefaultUnusedPolicyDays
+	}
+	policies, err := s.orgPolicies(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	since := time.Now().AddDate(0, 0, -unusedDays)
+	sampled, matches, err := s.queries.AuthzDecision.WithContext(ctx).PolicyMatchCounts(orgID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read decision log: %w", err)
+	}
+
+	report := &PolicyAnalysisReport{
+		OrganizationID:   orgID,
+		GeneratedAt:      time.Now(),
+		PoliciesAnalyzed: len(policies),
+		UnusedDays:       unusedDays,
+		DecisionsSampled: sampled,
+		Summary:          map[string]int{},
+		Findings:         []PolicyFinding{},
+	}
+	add := func(p *models.Policy, f authz.LintFinding) {
+		report.Findings = append(report.Findings, PolicyFinding{PolicyID: p.ID, PolicyName: p.Name, LintFinding: f})
+		report.Summary[f.Severity]++
+	}
+
+	for _, p := range policies {
+		findings, err := authz.LintDocument(p.Document)
+		if err != nil {
+			add(p, authz.LintFinding{
+				Rule:           authz.RuleInvalidDocument,
+				Severity:       authz.SeverityHigh,
+				Message:        err.Error(),
+				Recommendation: "Fix the document; the policy is skipped during authorization",
+			})
+			continue
+		}
+		for _, f := range findings {
+			add(p, f)
+		}
+
+		if sampled > 0 && p.Status == "active" && p.CreatedAt.Before(since) && matches[p.ID] == 0 {
+			add(p, authz.LintFinding{
+				Rule:           authz.RuleUnusedPolicy,
+				Severity:       authz.SeverityLow,
+				Message:        fmt.Sprintf("Did not allow or deny any of the %d decisions sampled in the last %d days", sampled, unusedDays),
+				Recommendation: "Detach or delete the policy if it is no longer needed",
+			})
+		}
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		a, b := report.Findings[i], report.Findings[j]
+		if ra, rb := authz.SeverityRank(a.Severity), authz.SeverityRank(b.Severity); ra != rb {
+			return ra < rb
+		}
+		return a.PolicyName < b.PolicyName
+	})
+	return report, nil
+}
+
+// orgPolicies loads every policy of the organization
+func (s *authzService) orgPolicies(ctx context.Context, orgID string) ([]*models.Policy, error) {
+	var policies []*models.Policy
+	params := queries.ListParams{Limit: 100}
+	for {
+		page, err := s.queries.Policy.WithContext(ctx).ListPolicies(params, orgID)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, page.Items...)
+		if !page.HasMore || page.NextCursor == "" {
+			return policies, nil
+		}
+		params.Cursor = page.NextCursor
+	}
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+)
+
+// ErrInvalidPrincipalType is returned for a principal type other than user,
+// service_account and group
+var ErrInvalidPrincipalType = errors.New("principal_type must be user, service_account or group")
+
+// IsPrincipalType reports whether t is a type of principal
+func IsPrincipalType(t string) bool {
+	switch t {
+	case "user", "service_account", "group":
+		return true
+	}
+	return false
+}
+
+// PrincipalResolver resolves the ID of a user, service account or group to
+// the principal, whatever its type. Role assignment, sharing, group
+// membership and KMS grants check the principals they name with it, and
+// audit listings show who acted.
+type PrincipalResolver interface {
+	// Resolve returns the principal of the organization with the ID. An
+	// empty principalType resolves a principal of any type. The error
+	// reads "principal not found" when there is none.
+	Resolve(ctx context.Context, organizationID, id, principalType string) (*models.Principal, error)
+	// ResolveAll returns the principals of the organization among ids, by
+	// ID. IDs that name no principal are left out.
+	ResolveAll(ctx context.Context, organizationID string, ids []string) (map[string]*models.Principal, error)
+	// EnrichAuditEvents sets the Principal of the events whose actor is a
+	// principal of their organization
+	EnrichAuditEvents(ctx context.Context, events []models.AuditEvent) error
+}
+
+type principalResolver struct {
+	queries *queries.Queries
+}
+
+// NewPrincipalResolver creates a new instance of PrincipalResolver
+func NewPrincipalResolver(q *queries.Queries) PrincipalResolver {
+	return &principalResolver{queries: q}
+}
+
+func (r *principalResolver) Resolve(ctx context.Context, organizationID, id, principalType string) (*models.Principal, error) {
+	if principalType != "" && !IsPrincipalType(principalType) {
+		return nil, ErrInvalidPrincipalType
+	}
+	// Principal IDs are UUIDs; anything else names no principal
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("principal not found")
+	}
+	return r.queries.Principal.WithContext(ctx).GetPrincipal(id, principalType, organizationID)
+}
+
+func (r *principalResolver) ResolveAll(ctx context.Context, organizationID string, ids []string) (map[string]*models.Principal, error) {
+	seen := make(map[string]bool, len(ids))
+	valid := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if _, err := uuid.Parse(id); err == nil {
+			valid = append(valid, id)
+		}
+	}
+	principals, err := r.queries.Principal.WithContext(ctx).ListPrincipals(valid, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*models.Principal, len(principals))
+	for i := range principals {
+		byID[principals[i].ID] = &principals[i]
+	}
+	return byID, nil
+}
+
+func (r *principalResolver) EnrichAuditEvents(ctx context.Context, events []models.AuditEvent) error {
+	byOrg := make(map[string][]string)
+	for _, e := range events {
+		if e.PrincipalID != nil && *e.PrincipalID != "" {
+			byOrg[e.OrganizationID] = append(byOrg[e.OrganizationID], *e.PrincipalID)
+		}
+	}
+	for organizationID, ids := range byOrg {
+		principals, err := r.ResolveAll(ctx, organizationID, ids)
+		if err != nil {
+			return err
+		}
+		for i := range events {
+			e := &events[i]
+			if e.OrganizationID != organizationID || e.PrincipalID == nil {
+				continue
+			}
+			if p, ok := principals[*e.PrincipalID]; ok && (e.PrincipalType == nil || *e.PrincipalType == p.Type) {
+				e.Principal = p
+			}
+		}
+	}
+	return nil
+}
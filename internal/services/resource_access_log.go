@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/jobs"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+// accessLogBatch bounds the entries written in one statement
+const accessLogBatch = 100
+
+// AccessLog records reads and writes of resources and content items, and
+// denied attempts at them, off the request path
+type AccessLog interface {
+	// Record queues an entry to be written; it is dropped when the queue is
+	// full
+	Record(entry queries.ResourceAccessLog)
+	RegisterJobs(scheduler *jobs.Scheduler) error
+	Start(ctx context.Context)
+	Stop()
+}
+
+type accessLog struct {
+	queries       *queries.Queries
+	logger        *logger.Logger
+	retentionDays int
+
+	entries chan queries.ResourceAccessLog
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewAccessLog creates an AccessLog. Entries are kept for retentionDays
+// unless the organization sets resource_access_log_retention_days; zero or
+// less keeps them forever.
+func NewAccessLog(q *queries.Queries, retentionDays int, l *logger.Logger) AccessLog {
+	return &accessLog{
+		queries:       q,
+		logger:        l,
+		retentionDays: retentionDays,
+		entries:       make(chan queries.ResourceAccessLog, 5000),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+func (s *accessLog) Record(entry queries.ResourceAccessLog) {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	if entry.PrincipalType == "" {
+		entry.PrincipalType = "user"
+	}
+	select {
+	case s.entries <- entry:
+	default:
+		s.logger.Warn("Resource access log queue full, dropping %s of %s %s", entry.Action, entry.ResourceType, entry.ResourceID)
+	}
+}
+
+// Start starts the background worker writing recorded entries in batches
+func (s *accessLog) Start(ctx context.Context) {
+	go func() {
+		defer close(s.done)
+		for {
+			select {
+			case e := <-s.entries:
+				s.write(s.batch(e))
+			case <-ctx.Done():
+				s.drain()
+				return
+			case <-s.stop:
+				s.drain()
+				return
+			}
+		}
+	}()
+}
+
+// Stop writes any queued entries and waits for the worker to exit
+func (s *accessLog) Stop() {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.done
+}
+
+// batch collects the entries queued behind first, up to accessLogBatch
+func (s *accessLog) batch(first queries.ResourceAccessLog) []queries.ResourceAccessLog {
+	batch := []queries.ResourceAccessLog{first}
+	for len(batch) < accessLogBatch {
+		select {
+		case e := <-s.entries:
+			batch = append(batch, e)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (s *accessLog) drain() {
+	for {
+		select {
+		case e := <-s.entries:
+			s.write(s.batch(e))
+		default:
+			return
+		}
+	}
+}
+
+func (s *accessLog) write(batch []queries.ResourceAccessLog) {
+	if err := s.queries.Resource.RecordResourceAccess(batch); err != nil {
+		s.logger.Error("Failed to write %d resource access log entries: %v", len(batch), err)
+	}
+}
+
+// RegisterJobs schedules the daily purge of entries past the retention of
+// their organization
+func (s *accessLog) RegisterJobs(scheduler *jobs.Scheduler) error {
+	description := "Delete resource access log entries past their organization's retention"
+	if s.retentionDays > 0 {
+		description += " (default " + strconv.Itoa(s.retentionDays) + " days)"
+	}
+	return scheduler.Register(jobs.Job{
+		Name:        "resource_access_log_purge",
+		Description: description,
+		Schedule:    "@daily",
+		Timeout:     30 * time.Minute,
+		Run: func(ctx context.Context) error {
+			purged, err := s.queries.Resource.WithContext(ctx).PurgeResourceAccessLog(s.retentionDays)
+			if err != nil {
+				return err
+			}
+			if purged > 0 {
+				s.logger.Info("Purged %d resource access log entries past retention", purged)
+			}
+			return nil
+		},
+	})
+}
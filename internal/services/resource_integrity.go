@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/detection"
+	"github.com/the-monkeys/monkeys-identity/internal/jobs"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/internal/storage"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+// checksumVerifyBatch bounds the blobs claimed for checking at once
+const checksumVerifyBatch = 100
+
+// ResourceIntegrityService checks the content of resources against their
+// stored SHA-256 checksums. Blobs held in the server's storage are hashed
+// by the server, on request and in the background; other resources are
+// checked against the checksum a client computed of its copy. A resource
+// that stops matching is audited as resource_checksum_mismatch, which
+// checksum_mismatch security rules turn into alerts.
+type ResourceIntegrityService interface {
+	// VerifyBlob hashes the stored blob of a blob-backed resource and
+	// records whether it still matches, returning the new status
+	VerifyBlob(ctx context.Context, r *models.ResourceIntegrity, actorID string) (string, error)
+	// VerifyCopy records whether the checksum of a client's copy of a
+	// resource matches, returning the new status
+	VerifyCopy(ctx context.Context, r *models.ResourceIntegrity, checksum, actorID string) (string, error)
+	// Sweep checks the blobs not checked for the verify interval and returns
+	// how many were checked
+	Sweep(ctx context.Context) (int, error)
+	RegisterJobs(scheduler *jobs.Scheduler) error
+}
+
+type resourceIntegrityService struct {
+	queries  *queries.Queries
+	store    storage.Backend
+	audit    AuditService
+	interval time.Duration
+	logger   *logger.Logger
+}
+
+// NewResourceIntegrityService creates a new instance of
+// ResourceIntegrityService. An interval of zero or less disables the
+// background check, not checks on request.
+func NewResourceIntegrityService(q *queries.Queries, store storage.Backend, audit AuditService, interval time.Duration, l *logger.Logger) ResourceIntegrityService {
+	return &resourceIntegrityService{
+		queries:  q,
+		store:    store,
+		audit:    audit,
+		interval: interval,
+		logger:   l,
+	}
+}
+
+// RegisterJobs schedules the hourly background check, unless disabled
+func (s *resourceIntegrityService) RegisterJobs(scheduler *jobs.Scheduler) error {
+	if s.interval <= 0 {
+		s.logger.Info("Background checksum verification disabled (CHECKSUM_VERIFY_INTERVAL is 0)")
+		return nil
+	}
+	return scheduler.Register(jobs.Job{
+		Name:        "resource_checksum_verify",
+		Description: "Check stored blobs not checked for " + s.interval.String() + " against their SHA-256 checksum",
+		Schedule:    "@hourly",
+		Timeout:     30 * time.Minute,
+		Run: func(ctx context.Context) error {
+			_, err := s.Sweep(ctx)
+			return err
+		},
+	})
+}
+
+func (s *resourceIntegrityService) Sweep(ctx context.Context) (int, error) {
+	before := time.Now().Add(-s.interval)
+	checked := 0
+	for {
+		claimed, err := s.queries.Resource.WithContext(ctx).ClaimChecksumVerifications(before, checksumVerifyBatch)
+		if err != nil {
+			return checked, err
+		}
+		for i := range claimed {
+			if err := ctx.Err(); err != nil {
+				return checked, err
+			}
+			if _, err := s.VerifyBlob(ctx, &claimed[i], ""); err != nil {
+				// One unreadable blob must not hold back the others
+				s.logger.Warn("Failed to verify the checksum of resource %s: %v", claimed[i].ResourceID, err)
+				continue
+			}
+			checked++
+		}
+		if len(claimed) < checksumVerifyBatch {
+			break
+		}
+	}
+	if checked > 0 {
+		s.logger.Info("Verified the checksums of %d stored blobs", checked)
+	}
+	return checked, nil
+}
+
+func (s *resourceIntegrityService) VerifyBlob(ctx context.Context, r *models.ResourceIntegrity, actorID string) (string, error) {
+	blob, err := s.store.Open(ctx, r.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return s.record(ctx, r, queries.ChecksumMissing, "", nil, "blob", actorID)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer blob.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, blob)
+	if err != nil {
+		return "", err
+	}
+	actual := hex.EncodeToString(hash.Sum(nil))
+	status := queries.ChecksumValid
+	if r.Checksum == nil || *r.Checksum != actual || (r.SizeBytes != nil && *r.SizeBytes != size) {
+		status = queries.ChecksumMismatch
+	}
+	return s.record(ctx, r, status, actual, &size, "blob", actorID)
+}
+
+func (s *resourceIntegrityService) VerifyCopy(ctx context.Context, r *models.ResourceIntegrity, checksum, actorID string) (string, error) {
+	status := queries.ChecksumValid
+	if r.Checksum == nil || *r.Checksum != checksum {
+		status = queries.ChecksumMismatch
+	}
+	return s.record(ctx, r, status, checksum, nil, "client", actorID)
+}
+
+// record stores the outcome of a check and audits a resource that stopped
+// matching. Repeated checks of a resource already known not to match are
+// not audited again.
+func (s *resourceIntegrityService) record(ctx context.Context, r *models.ResourceIntegrity, status, actual string, size *int64, source, actorID string) (string, error) {
+	if err := s.queries.Resource.WithContext(ctx).RecordChecksumVerification(r.ResourceID, r.OrganizationID, status); err != nil {
+		return "", err
+	}
+	previous := r.Status
+	r.Status = status
+	now := time.Now()
+	r.VerifiedAt = &now
+	if status == queries.ChecksumValid || status == previous {
+		return status, nil
+	}
+
+	context := map[string]interface{}{
+		"resource_name": r.ResourceName,
+		"status":        status,
+		"source":        source,
+		"actual":        actual,
+	}
+	if r.Checksum != nil {
+		context["expected"] = *r.Checksum
+	}
+	if size != nil {
+		context["size_bytes"] = *size
+		if r.SizeBytes != nil {
+			context["expected_size_bytes"] = *r.SizeBytes
+		}
+	}
+	details, _ := json.Marshal(context)
+	event := models.AuditEvent{
+		OrganizationID:    r.OrganizationID,
+		PrincipalType:     utils.StringPtr("system"),
+		Action:            detection.ActionChecksumMismatch,
+		ResourceType:      utils.StringPtr("resource"),
+		ResourceID:        utils.StringPtr(r.ResourceID),
+		Result:            "failure",
+		AdditionalContext: string(details),
+		Severity:          "critical",
+	}
+	if actorID != "" {
+		event.PrincipalID = utils.StringPtr(actorID)
+		event.PrincipalType = utils.StringPtr("user")
+	}
+	s.audit.LogEvent(ctx, event)
+	s.logger.Warn("Resource %s of organization %s no longer matches its checksum (%s)", r.ResourceID, r.OrganizationID, status)
+	return status, nil
+}
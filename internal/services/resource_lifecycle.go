@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/events"
+	"github.com/the-monkeys/monkeys-identity/internal/jobs"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+// resourceLifecycleBatch bounds the resources transitioned in one statement
+const resourceLifecycleBatch = 500
+
+// ResourceLifecycleService executes the lifecycle policies of resources:
+// it archives idle resources, asks owners to recertify the resources due
+// for it, archives those not recertified in time and deletes the resources
+// archived for long enough. Every transition is audited and published for
+// the owner.
+type ResourceLifecycleService interface {
+	// Run makes the transitions due across organizations and returns how
+	// many were made
+	Run(ctx context.Context) (int, error)
+	RegisterJobs(scheduler *jobs.Scheduler) error
+}
+
+type resourceLifecycleService struct {
+	queries *queries.Queries
+	bus     events.Bus
+	audit   AuditService
+	logger  *logger.Logger
+}
+
+// NewResourceLifecycleService creates a new instance of ResourceLifecycleService
+func NewResourceLifecycleService(q *queries.Queries, bus events.Bus, audit AuditService, l *logger.Logger) ResourceLifecycleService {
+	return &resourceLifecycleService{
+		queries: q,
+		bus:     bus,
+		audit:   audit,
+		logger:  l,
+	}
+}
+
+// RegisterJobs schedules the hourly run
+func (s *resourceLifecycleService) RegisterJobs(scheduler *jobs.Scheduler) error {
+	return scheduler.Register(jobs.Job{
+		Name:        "resource_lifecycle",
+		Description: "Archive, recertify and delete resources as their lifecycle policies say",
+		Schedule:    "@hourly",
+		Timeout:     15 * time.Minute,
+		Run: func(ctx context.Context) error {
+			_, err := s.Run(ctx)
+			return err
+		},
+	})
+}
+
+func (s *resourceLifecycleService) Run(ctx context.Context) (int, error) {
+	resources := s.queries.Resource.WithContext(ctx)
+	// Deleting first keeps resources archived in this run for the full
+	// period
+	steps := []func(int) ([]models.LifecycleTransition, error){
+		resources.DeleteArchivedResources,
+		resources.ArchiveUncertifiedResources,
+		resources.ArchiveIdleResources,
+		resources.RequestRecertifications,
+	}
+	made := 0
+	for _, step := range steps {
+		for {
+			if err := ctx.Err(); err != nil {
+				return made, err
+			}
+			transitions, err := step(resourceLifecycleBatch)
+			if err != nil {
+				return made, err
+			}
+			for _, t := range transitions {
+				s.record(ctx, t)
+			}
+			made += len(transitions)
+			if len(transitions) < resourceLifecycleBatch {
+				break
+			}
+		}
+	}
+	if made > 0 {
+		s.logger.Info("Made %d resource lifecycle transitions", made)
+	}
+	return made, nil
+}
+
+// record audits a transition and publishes it for the owner
+func (s *resourceLifecycleService) record(ctx context.Context, t models.LifecycleTransition) {
+	action, eventType, severity := "archive_resource", events.ResourceArchived, "info"
+	switch t.Action {
+	case queries.LifecycleDelete:
+		action, eventType, severity = "delete_resource", events.ResourceDeleted, "warn"
+	case queries.LifecycleRequestRecertification:
+		action, eventType = "request_resource_recertification", events.ResourceRecertificationDue
+	}
+	details, _ := json.Marshal(map[string]interface{}{
+		"reason":        t.Reason,
+		"resource_name": t.ResourceName,
+	})
+	s.audit.LogEvent(ctx, models.AuditEvent{
+		OrganizationID:    t.OrganizationID,
+		PrincipalType:     utils.StringPtr("system"),
+		Action:            action,
+		ResourceType:      utils.StringPtr("resource"),
+		ResourceID:        utils.StringPtr(t.ResourceID),
+		Result:            "success",
+		AdditionalContext: string(details),
+		Severity:          severity,
+	})
+
+	data := map[string]interface{}{
+		"reason":        t.Reason,
+		"resource_name": t.ResourceName,
+	}
+	if t.OwnerID != nil && t.OwnerType != nil {
+		data["owner_id"] = *t.OwnerID
+		data["owner_type"] = *t.OwnerType
+	}
+	s.bus.Publish(ctx, events.Event{
+		Type:           eventType,
+		OrganizationID: t.OrganizationID,
+		Subject:        t.ResourceID,
+		Data:           data,
+	})
+}
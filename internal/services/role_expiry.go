@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/events"
+	"github.com/the-monkeys/monkeys-identity/internal/jobs"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+// roleExpiryBatch bounds the assignments reminded in one statement
+const roleExpiryBatch = 500
+
+// RoleExpiryService reminds the holders of expiring role assignments, and
+// the admins who granted them, ahead of the expiry so that they can request
+// a renewal instead of letting access lapse
+type RoleExpiryService interface {
+	// RemindExpiring publishes a role.expiring event for every assignment
+	// expiring within the reminder period that has not been reminded yet
+	RemindExpiring(ctx context.Context) (int, error)
+	RegisterJobs(scheduler *jobs.Scheduler) error
+}
+
+type roleExpiryService struct {
+	roles      queries.RoleQueries
+	bus        events.Bus
+	remindDays int
+	logger     *logger.Logger
+}
+
+// NewRoleExpiryService creates a new instance of RoleExpiryService. A
+// reminder period of zero days or less disables reminders.
+func NewRoleExpiryService(roles queries.RoleQueries, bus events.Bus, remindDays int, l *logger.Logger) RoleExpiryService {
+	return &roleExpiryService{
+		roles:      roles,
+		bus:        bus,
+		remindDays: remindDays,
+		logger:     l,
+	}
+}
+
+// RegisterJobs schedules the hourly reminders unless they are disabled
+func (s *roleExpiryService) RegisterJobs(scheduler *jobs.Scheduler) error {
+	if s.remindDays <= 0 {
+		s.logger.Info("Role expiry reminders disabled (ROLE_EXPIRY_REMINDER_DAYS not set)")
+		return nil
+	}
+	return scheduler.Register(jobs.Job{
+		Name:        "role_expiry_reminders",
+		Description: "Remind holders and assigners of role assignments expiring within " + strconv.Itoa(s.remindDays) + " days",
+		Schedule:    "@hourly",
+		Timeout:     10 * time.Minute,
+		Run: func(ctx context.Context) error {
+			_, err := s.RemindExpiring(ctx)
+			return err
+		},
+	})
+}
+
+func (s *roleExpiryService) RemindExpiring(ctx context.Context) (int, error) {
+	before := time.Now().AddDate(0, 0, s.remindDays)
+	reminded := 0
+	for {
+		assignments, err := s.roles.WithContext(ctx).ClaimExpiringRoleAssignments(before, roleExpiryBatch)
+		if err != nil {
+			return reminded, err
+		}
+		for _, a := range assignments {
+			s.bus.Publish(ctx, events.Event{
+				Type:           events.RoleExpiring,
+				OrganizationID: a.OrganizationID,
+				Subject:        a.PrincipalID,
+				Data: map[string]interface{}{
+					"assignment_id":  a.ID,
+					"role_id":        a.RoleID,
+					"role_name":      a.RoleName,
+					"principal_type": a.PrincipalType,
+					"assigned_by":    a.AssignedBy,
+					"expires_at":     a.ExpiresAt,
+					"renewal_path":   "/api/v1/roles/assignments/" + a.ID + "/renewal",
+				},
+			})
+		}
+		reminded += len(assignments)
+		if len(assignments) < roleExpiryBatch {
+			break
+		}
+	}
+	if reminded > 0 {
+		s.logger.Info("Reminded %d expiring role assignments", reminded)
+	}
+	return reminded, nil
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/jobs"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+// SessionExpiryService marks sessions that timed out or reached their
+// maximum lifetime as expired. Their tokens are refused as soon as that
+// happens; the job only brings the stored status in line.
+type SessionExpiryService interface {
+	// ExpireSessions marks every active session past its expiry expired
+	ExpireSessions(ctx context.Context) (int, error)
+	RegisterJobs(scheduler *jobs.Scheduler) error
+}
+
+type sessionExpiryService struct {
+	sessions queries.SessionQueries
+	logger   *logger.Logger
+}
+
+// NewSessionExpiryService creates a new instance of SessionExpiryService
+func NewSessionExpiryService(sessions queries.SessionQueries, l *logger.Logger) SessionExpiryService {
+	return &sessionExpiryService{sessions: sessions, logger: l}
+}
+
+func (s *sessionExpiryService) ExpireSessions(ctx context.Context) (int, error) {
+	return s.sessions.WithContext(ctx).RevokeExpiredSessions()
+}
+
+// RegisterJobs schedules marking expired sessions every minute, the
+// granularity at which idle timeouts are tracked
+func (s *sessionExpiryService) RegisterJobs(scheduler *jobs.Scheduler) error {
+	return scheduler.Register(jobs.Job{
+		Name:        "session_expiry",
+		Description: "Mark sessions that were idle too long or reached their maximum lifetime as expired",
+		Schedule:    "@every 1m",
+		Timeout:     time.Minute,
+		Run: func(ctx context.Context) error {
+			n, err := s.ExpireSessions(ctx)
+			if n > 0 {
+				s.logger.Info("Marked %d sessions expired", n)
+			}
+			return err
+		},
+	})
+}
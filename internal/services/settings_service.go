@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+const (
+	// settingsInvalidationChannel tells every replica to reload the global
+	// settings after one of them changed them
+	settingsInvalidationChannel = "global_settings:invalidate"
+	// settingsRefreshInterval bounds how stale a replica can be when it
+	// missed an invalidation, e.g. during a Redis outage
+	settingsRefreshInterval = time.Minute
+)
+
+// SettingsService serves the system-wide settings from memory. They are
+// loaded at startup, reloaded when any replica updates them and
+// periodically as a fallback.
+type SettingsService interface {
+	// Current returns a copy of the settings in effect
+	Current() models.GlobalSettings
+	AllowRegistration() bool
+	RequireMFA() bool
+	EmailVerificationRequired() bool
+	PasswordMinLength() int
+	MaxSessionDuration() time.Duration
+	// Setting decodes the key of the free-form settings document into dst
+	// and reports whether it was present
+	Setting(key string, dst interface{}) bool
+
+	Reload(ctx context.Context) error
+	// Update stores new settings and tells every replica to reload them
+	Update(ctx context.Context, settings models.GlobalSettings) (*models.GlobalSettings, error)
+	Start(ctx context.Context)
+	Stop()
+}
+
+type settingsService struct {
+	queries *queries.Queries
+	redis   redis.UniversalClient
+	logger  *logger.Logger
+
+	current atomic.Pointer[models.GlobalSettings]
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewSettingsService creates a SettingsService serving the defaults until
+// the first Reload
+func NewSettingsService(q *queries.Queries, redis redis.UniversalClient, l *logger.Logger) SettingsService {
+	s := &settingsService{
+		queries: q,
+		redis:   redis,
+		logger:  l,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	defaults := models.DefaultGlobalSettings()
+	s.current.Store(&defaults)
+	return s
+}
+
+func (s *settingsService) Current() models.GlobalSettings {
+	return *s.current.Load()
+}
+
+func (s *settingsService) AllowRegistration() bool {
+	return s.current.Load().AllowRegistration
+}
+
+func (s *settingsService) RequireMFA() bool {
+	return s.current.Load().RequireMFA
+}
+
+func (s *settingsService) EmailVerificationRequired() bool {
+	return s.current.Load().EmailVerificationReq
+}
+
+func (s *settingsService) PasswordMinLength() int {
+	return s.current.Load().PasswordMinLength
+}
+
+func (s *settingsService) MaxSessionDuration() time.Duration {
+	return time.Duration(s.current.Load().MaxSessionDuration) * time.Minute
+}
+
+func (s *settingsService) Setting(key string, dst interface{}) bool {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(s.current.Load().Settings), &doc); err != nil {
+		return false
+	}
+	raw, ok := doc[key]
+	return ok && json.Unmarshal(raw, dst) == nil
+}
+
+// Reload reads the settings from the database
+func (s *settingsService) Reload(ctx context.Context) error {
+	settings, err := s.queries.GlobalSettings.WithContext(ctx).GetGlobalSettings()
+	if err != nil {
+		return err
+	}
+	s.current.Store(settings)
+	return nil
+}
+
+func (s *settingsService) Update(ctx context.Context, settings models.GlobalSettings) (*models.GlobalSettings, error) {
+	updated, err := s.queries.GlobalSettings.WithContext(ctx).UpdateGlobalSettings(settings)
+	if err != nil {
+		return nil, err
+	}
+	stored := *updated
+	s.current.Store(&stored)
+
+	if err := s.redis.Publish(ctx, settingsInvalidationChannel, updated.UpdatedAt.UnixNano()).Err(); err != nil {
+		s.logger.Warn("Failed to notify replicas of the settings change, they pick it up within %s: %v", settingsRefreshInterval, err)
+	}
+	return updated, nil
+}
+
+// Start reloads the settings whenever an invalidation is published and on
+// a fixed interval
+func (s *settingsService) Start(ctx context.Context) {
+	sub := s.redis.Subscribe(ctx, settingsInvalidationChannel)
+	go func() {
+		defer close(s.done)
+		defer sub.Close()
+
+		ticker := time.NewTicker(settingsRefreshInterval)
+		defer ticker.Stop()
+		messages := sub.Channel()
+		for {
+			select {
+			case <-messages:
+				s.reload(ctx, "invalidation")
+			case <-ticker.C:
+				s.reload(ctx, "refresh")
+			case <-ctx.Done():
+				return
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the subscription and waits for it to close
+func (s *settingsService) Stop() {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.done
+}
+
+func (s *settingsService) reload(ctx context.Context, reason string) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := s.Reload(ctx); err != nil {
+		s.logger.Warn("Failed to reload global settings on %s, keeping the previous ones: %v", reason, err)
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/events"
+	"github.com/the-monkeys/monkeys-identity/internal/jobs"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+// shareExpiryBatch bounds the shares reminded in one statement
+const shareExpiryBatch = 500
+
+// ShareExpiryService reminds the recipients of expiring resource shares and
+// co-authorships ahead of the expiry, and deletes them once expired. They
+// stop granting access as soon as they expire; the sweep only removes the
+// rows.
+type ShareExpiryService interface {
+	// RemindExpiring publishes a share.expiring event for every share and
+	// co-authorship expiring within the reminder period that has not been
+	// reminded yet
+	RemindExpiring(ctx context.Context) (int, error)
+	// DeleteExpired deletes the shares and co-authorships past their expiry
+	DeleteExpired(ctx context.Context) (int64, error)
+	RegisterJobs(scheduler *jobs.Scheduler) error
+}
+
+type shareExpiryService struct {
+	queries    *queries.Queries
+	bus        events.Bus
+	remindDays int
+	logger     *logger.Logger
+}
+
+// NewShareExpiryService creates a new instance of ShareExpiryService. A
+// reminder period of zero days or less disables reminders, not the sweep.
+func NewShareExpiryService(q *queries.Queries, bus events.Bus, remindDays int, l *logger.Logger) ShareExpiryService {
+	return &shareExpiryService{
+		queries:    q,
+		bus:        bus,
+		remindDays: remindDays,
+		logger:     l,
+	}
+}
+
+// RegisterJobs schedules the hourly sweep and, unless disabled, reminders
+func (s *shareExpiryService) RegisterJobs(scheduler *jobs.Scheduler) error {
+	err := scheduler.Register(jobs.Job{
+		Name:        "share_expiry_sweep",
+		Description: "Delete expired resource shares and co-authorships",
+		Schedule:    "@hourly",
+		Timeout:     10 * time.Minute,
+		Run: func(ctx context.Context) error {
+			_, err := s.DeleteExpired(ctx)
+			return err
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if s.remindDays <= 0 {
+		s.logger.Info("Share expiry reminders disabled (SHARE_EXPIRY_REMINDER_DAYS not set)")
+		return nil
+	}
+	return scheduler.Register(jobs.Job{
+		Name:        "share_expiry_reminders",
+		Description: "Remind recipients of resource shares and co-authorships expiring within " + strconv.Itoa(s.remindDays) + " days",
+		Schedule:    "@hourly",
+		Timeout:     10 * time.Minute,
+		Run: func(ctx context.Context) error {
+			_, err := s.RemindExpiring(ctx)
+			return err
+		},
+	})
+}
+
+func (s *shareExpiryService) RemindExpiring(ctx context.Context) (int, error) {
+	before := time.Now().AddDate(0, 0, s.remindDays)
+	reminded := 0
+	for _, claim := range []func(time.Time, int) ([]models.ExpiringShare, error){
+		s.queries.Resource.WithContext(ctx).ClaimExpiringShares,
+		s.queries.Content.WithContext(ctx).ClaimExpiringCollaborators,
+	} {
+		for {
+			shares, err := claim(before, shareExpiryBatch)
+			if err != nil {
+				return reminded, err
+			}
+			for _, share := range shares {
+				s.bus.Publish(ctx, events.Event{
+					Type:           events.ShareExpiring,
+					OrganizationID: share.OrganizationID,
+					Subject:        share.PrincipalID,
+					Data: map[string]interface{}{
+						"kind":           share.Kind,
+						"item_id":        share.ItemID,
+						"item_name":      share.ItemName,
+						"principal_type": share.PrincipalType,
+						"access_level":   share.AccessLevel,
+						"shared_by":      share.SharedBy,
+						"expires_at":     share.ExpiresAt,
+					},
+				})
+			}
+			reminded += len(shares)
+			if len(shares) < shareExpiryBatch {
+				break
+			}
+		}
+	}
+	if reminded > 0 {
+		s.logger.Info("Reminded %d expiring shares", reminded)
+	}
+	return reminded, nil
+}
+
+func (s *shareExpiryService) DeleteExpired(ctx context.Context) (int64, error) {
+	shares, err := s.queries.Resource.WithContext(ctx).DeleteExpiredShares()
+	if err != nil {
+		return 0, err
+	}
+	collaborators, err := s.queries.Content.WithContext(ctx).DeleteExpiredCollaborators()
+	if err != nil {
+		return shares, err
+	}
+	if shares+collaborators > 0 {
+		s.logger.Info("Deleted %d expired resource shares and %d expired co-authorships", shares, collaborators)
+	}
+	return shares + collaborators, nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/config"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+const (
+	SMSProviderTwilio = "twilio"
+
+	smsHTTPWait = 10 * time.Second
+)
+
+// SMSProvider delivers text messages. Implementations must be safe for
+// concurrent use.
+type SMSProvider interface {
+	Send(ctx context.Context, to, body string) error
+}
+
+// NewSMSProvider returns the provider selected by SMS_PROVIDER, or nil when
+// SMS delivery is not configured
+func NewSMSProvider(cfg *config.Config, l *logger.Logger) SMSProvider {
+	switch cfg.SMSProvider {
+	case "":
+		return nil
+	case SMSProviderTwilio:
+		if cfg.TwilioAccountSID == "" || cfg.TwilioAuthToken == "" || cfg.TwilioFromNumber == "" {
+			l.Warn("SMS_PROVIDER is twilio but TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN or TWILIO_FROM_NUMBER is missing; SMS MFA is disabled")
+			return nil
+		}
+		return &twilioSMSProvider{
+			baseURL:    "https://api.twilio.com",
+			accountSID: cfg.TwilioAccountSID,
+			authToken:  cfg.TwilioAuthToken,
+			from:       cfg.TwilioFromNumber,
+			http:       &http.Client{Timeout: smsHTTPWait},
+		}
+	default:
+		l.Warn("Unknown SMS_PROVIDER %q; SMS MFA is disabled", cfg.SMSProvider)
+		return nil
+	}
+}
+
+// twilioSMSProvider sends messages through the Twilio Programmable Messaging API
+type twilioSMSProvider struct {
+	baseURL    string
+	accountSID string
+	authToken  string
+	from       string
+	http       *http.Client
+}
+
+func (p *twilioSMSProvider) Send(ctx context.Context, to, body string) error {
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", p.baseURL, url.PathEscape(p.accountSID))
+	form := url.Values{"To": {to}, "From": {p.from}, "Body": {body}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(p.accountSID, p.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("twilio request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("twilio returned %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/jobs"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+// ManagedPolicies is the catalog of system policies every organization has.
+// Changing a document here updates it in every organization on the next
+// reconciliation.
+var ManagedPolicies = []models.ManagedPolicy{
+	{
+		Name:        "FullAccess",
+		Description: "Administrator full access policy",
+		Document:    `{"Version":"2024-01-01","Statement":[{"Effect":"Allow","Action":["*"],"Resource":["*"]}]}`,
+	},
+	{
+		Name:        "ReadOnlyAccess",
+		Description: "Read and list everything in the organization",
+		Document: `{"Version":"2024-01-01","Statement":[{"Sid":"ReadOnly","Effect":"Allow","Action":[` +
+			`"monkeys:*:read","monkeys:*:list","monkeys:*:get",` +
+			`"monkeys:iam:view_group_permissions","monkeys:resource:view_permissions"],"Resource":["*"]}]}`,
+	},
+	{
+		Name:        "UserAdminAccess",
+		Description: "Manage users, groups and role assignments",
+		Document: `{"Version":"2024-01-01","Statement":[{"Sid":"ManageUsers","Effect":"Allow","Action":[` +
+			`"monkeys:iam:create_user","monkeys:iam:update_user","monkeys:iam:delete_user",` +
+			`"monkeys:iam:suspend_user","monkeys:iam:activate_user","monkeys:iam:restore_user",` +
+			`"monkeys:iam:reset_user_password","monkeys:iam:import_users","monkeys:iam:export_users",` +
+			`"monkeys:iam:revoke_session",` +
+			`"monkeys:iam:create_group","monkeys:iam:update_group","monkeys:iam:delete_group",` +
+			`"monkeys:iam:manage_group_membership","monkeys:iam:view_group_permissions",` +
+			`"monkeys:iam:assign_role","monkeys:iam:unassign_role"],"Resource":["*"]}]}`,
+	},
+	{
+		Name:        "AuditorAccess",
+		Description: "Review audit events, sessions and authorization decisions",
+		Document: `{"Version":"2024-01-01","Statement":[{"Sid":"Audit","Effect":"Allow","Action":[` +
+			`"monkeys:audit:read","monkeys:audit:list","monkeys:audit:export","monkeys:audit:read_events",` +
+			`"monkeys:resource:view_audit","monkeys:authz:read_decisions","monkeys:policy:analyze",` +
+			`"monkeys:kms:view_usage"],"Resource":["*"]}]}`,
+	},
+	{
+		Name:        "PolicyAdminAccess",
+		Description: "Write, approve and roll back policies and the roles they are attached to",
+		Document: `{"Version":"2024-01-01","Statement":[{"Sid":"ManagePolicies","Effect":"Allow","Action":[` +
+			`"monkeys:iam:create_policy","monkeys:iam:update_policy","monkeys:iam:delete_policy",` +
+			`"monkeys:iam:approve_policy","monkeys:iam:rollback_policy","monkeys:policy:analyze",` +
+			`"monkeys:iam:create_role","monkeys:iam:update_role","monkeys:iam:delete_role",` +
+			`"monkeys:iam:attach_role_policy","monkeys:iam:detach_role_policy"],"Resource":["*"]}]}`,
+	},
+	{
+		Name:        "BillingAdminAccess",
+		Description: "View the organization's usage",
+		Document: `{"Version":"2024-01-01","Statement":[{"Sid":"Usage","Effect":"Allow","Action":[` +
+			`"monkeys:billing:view_usage"],"Resource":["*"]}]}`,
+	},
+	{
+		Name:        "ContentEditorAccess",
+		Description: "Create, edit and publish content",
+		Document: `{"Version":"2024-01-01","Statement":[{"Sid":"EditContent","Effect":"Allow","Action":[` +
+			`"monkeys:content:create","monkeys:content:update","monkeys:content:publish",` +
+			`"monkeys:content:unpublish","monkeys:content:manage_collaborators"],"Resource":["*"]}]}`,
+	},
+}
+
+// SystemRoles is the catalog of system roles every organization has. The
+// organization administrator role keeps the name "admin" that route guards
+// check for.
+var SystemRoles = []models.SystemRoleTemplate{
+	{
+		Name:        "admin",
+		Description: "Administrator with full system access",
+		Policies:    []string{"FullAccess"},
+	},
+	{
+		Name:        "user-admin",
+		Description: "Manages users, groups and their role assignments",
+		Policies:    []string{"UserAdminAccess", "ReadOnlyAccess"},
+	},
+	{
+		Name:        "policy-admin",
+		Description: "Manages policies and roles without managing users",
+		Policies:    []string{"PolicyAdminAccess", "ReadOnlyAccess"},
+	},
+	{
+		Name:        "billing-admin",
+		Description: "Reviews the organization's usage",
+		Policies:    []string{"BillingAdminAccess"},
+	},
+	{
+		Name:        "auditor",
+		Description: "Reviews audit logs and access decisions without changing anything",
+		Policies:    []string{"AuditorAccess", "ReadOnlyAccess"},
+	},
+	{
+		Name:        "read-only",
+		Description: "Views everything in the organization without changing anything",
+		Policies:    []string{"ReadOnlyAccess"},
+	},
+	{
+		Name:        "content-editor",
+		Description: "Creates, edits and publishes content",
+		Policies:    []string{"ContentEditorAccess", "ReadOnlyAccess"},
+	},
+}
+
+// SeedSystemRoles creates the catalog roles and policies in an organization.
+// It is safe to call again; existing system roles are brought up to date.
+func SeedSystemRoles(q queries.RoleQueries, organizationID string) error {
+	return q.ReconcileSystemRoles(organizationID, ManagedPolicies, SystemRoles)
+}
+
+// SystemRoleService keeps every organization's system roles and managed
+// policies in line with the catalog
+type SystemRoleService interface {
+	ReconcileAll(ctx context.Context) (int, error)
+	RegisterJobs(scheduler *jobs.Scheduler) error
+}
+
+type systemRoleService struct {
+	queries *queries.Queries
+	logger  *logger.Logger
+}
+
+// NewSystemRoleService creates a new instance of SystemRoleService
+func NewSystemRoleService(q *queries.Queries, l *logger.Logger) SystemRoleService {
+	return &systemRoleService{queries: q, logger: l}
+}
+
+// ReconcileAll reconciles every organization and returns how many were
+// processed. A failing organization is logged and does not stop the rest.
+func (s *systemRoleService) ReconcileAll(ctx context.Context) (int, error) {
+	params := queries.ListParams{Limit: 100}
+	reconciled, failed := 0, 0
+	for {
+		page, err := s.queries.Organization.WithContext(ctx).ListOrganizations(params, "")
+		if err != nil {
+			return reconciled, fmt.Errorf("failed to list organizations: %w", err)
+		}
+		for _, org := range page.Items {
+			if err := ctx.Err(); err != nil {
+				return reconciled, err
+			}
+			if err := SeedSystemRoles(s.queries.Role.WithContext(ctx), org.ID); err != nil {
+				s.logger.Error("Failed to reconcile system roles for organization %s: %v", org.ID, err)
+				failed++
+				continue
+			}
+			reconciled++
+		}
+		if !page.HasMore || page.NextCursor == "" {
+			break
+		}
+		params.Cursor = page.NextCursor
+	}
+	if failed > 0 {
+		return reconciled, fmt.Errorf("system role reconciliation failed for %d organizations", failed)
+	}
+	return reconciled, nil
+}
+
+// RegisterJobs schedules the hourly reconciliation
+func (s *systemRoleService) RegisterJobs(scheduler *jobs.Scheduler) error {
+	return scheduler.Register(jobs.Job{
+		Name:        "system_role_reconcile",
+		Description: "Bring every organization's system roles and managed policies up to date with the catalog",
+		Schedule:    "@hourly",
+		Timeout:     15 * time.Minute,
+		Run: func(ctx context.Context) error {
+			n, err := s.ReconcileAll(ctx)
+			if err != nil {
+				return err
+			}
+			s.logger.Debug("Reconciled system roles for %d organizations", n)
+			return nil
+		},
+	})
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// RFC 8693 identifiers
+const (
+	GrantTypeTokenExchange    = "urn:ietf:params:oauth:grant-type:token-exchange"
+	TokenTypeAccessToken      = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJWT              = "urn:ietf:params:oauth:token-type:jwt"
+	maxExchangedTokenLifetime = 15 * time.Minute
+)
+
+// TokenExchangeRequest is an RFC 8693 token exchange request. The
+// authenticated client acts on behalf of the subject token's user.
+type TokenExchangeRequest struct {
+	ClientID           string
+	ClientSecret       string
+	SubjectToken       string
+	SubjectTokenType   string
+	ActorToken         string
+	RequestedTokenType string
+	Audience           string
+	Scope              string
+}
+
+// TokenExchangeResponse is the RFC 8693 token exchange response
+type TokenExchangeResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+// ExchangeToken issues a token for calling the audience service on behalf of
+// the subject token's user. The new token never outlives the subject token,
+// its scopes are a subset of the subject's, and the "act" claim records the
+// client (and any earlier actors) acting for the user. Errors are RFC 8693
+// error codes.
+func (s *oidcService) ExchangeToken(req TokenExchangeRequest) (*TokenExchangeResponse, error) {
+	if req.SubjectToken == "" || req.Audience == "" {
+		return nil, errors.New("invalid_request")
+	}
+	if req.SubjectTokenType != TokenTypeAccessToken && req.SubjectTokenType != TokenTypeJWT {
+		return nil, errors.New("invalid_request")
+	}
+	if req.RequestedTokenType != "" && req.RequestedTokenType != TokenTypeAccessToken {
+		return nil, errors.New("invalid_request")
+	}
+	// The authenticated client is the actor; separate actor tokens are not supported
+	if req.ActorToken != "" {
+		return nil, errors.New("invalid_request")
+	}
+
+	// Only confidential clients registered for this grant may exchange tokens
+	client, err := s.queries.OIDC.GetClientByID(req.ClientID)
+	if err != nil || client == nil || client.IsPublic || req.ClientSecret == "" {
+		return nil, errors.New("invalid_client")
+	}
+	if !clientSecretMatches(client, req.ClientSecret) {
+		return nil, errors.New("invalid_client")
+	}
+	if !containsString(client.GrantTypes, GrantTypeTokenExchange) {
+		return nil, errors.New("unauthorized_client")
+	}
+
+	subject := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(req.SubjectToken, subject, s.keys.Keyfunc)
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid_grant")
+	}
+	if tokenType, _ := subject["type"].(string); tokenType != "access" {
+		return nil, errors.New("invalid_grant")
+	}
+	if jti, _ := subject["jti"].(string); jti != "" {
+		if revoked, err := s.queries.Auth.IsTokenRevoked(jti); err != nil || revoked {
+			return nil, errors.New("invalid_grant")
+		}
+	}
+	userID, _ := subject["sub"].(string)
+	orgID, _ := subject["organization_id"].(string)
+	// Delegation never crosses tenants
+	if userID == "" || orgID != client.OrganizationID {
+		return nil, errors.New("invalid_grant")
+	}
+	if s.organizationDeleting(orgID) {
+		return nil, errors.New("invalid_grant")
+	}
+
+	// The audience is another service registered as a client of the same org
+	target, err := s.queries.OIDC.GetClientByID(req.Audience)
+	if err != nil || target == nil || target.OrganizationID != client.OrganizationID {
+		return nil, errors.New("invalid_target")
+	}
+
+	scope, ok := narrowScope(req.Scope, subject, target.Scope)
+	if !ok {
+		return nil, errors.New("invalid_scope")
+	}
+
+	ttls, err := s.tokenTTLs(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve token lifetimes: %w", err)
+	}
+	lifetime := maxExchangedTokenLifetime
+	if ttls.access < lifetime {
+		lifetime = ttls.access
+	}
+	now := time.Now()
+	expiresAt := now.Add(lifetime)
+	if exp, err := subject.GetExpirationTime(); err == nil && exp != nil && exp.Before(expiresAt) {
+		expiresAt = exp.Time
+	}
+
+	act := map[string]interface{}{"sub": client.ID}
+	if prior, ok := subject["act"]; ok {
+		act["act"] = prior
+	}
+
+	claims := jwt.MapClaims{
+		"iss":             s.config.OIDCIssuer,
+		"sub":             userID,
+		"aud":             target.ID,
+		"exp":             expiresAt.Unix(),
+		"iat":             now.Unix(),
+		"jti":             uuid.New().String(),
+		"client_id":       client.ID,
+		"organization_id": orgID,
+		"type":            "access",
+		"act":             act,
+	}
+	if scope != "" {
+		claims["scope"] = scope
+	}
+	// Identity claims first-party services read from access tokens
+	for _, name := range []string{"user_id", "email", "role"} {
+		if v, ok := subject[name]; ok {
+			claims[name] = v
+		}
+	}
+
+	signed, err := s.keys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+	s.queries.Stats.RecordTokenIssued(orgID, GrantTypeTokenExchange)
+
+	return &TokenExchangeResponse{
+		AccessToken:     signed,
+		IssuedTokenType: TokenTypeAccessToken,
+		TokenType:       "Bearer",
+		ExpiresIn:       int64(time.Until(expiresAt) / time.Second),
+		Scope:           scope,
+	}, nil
+}
+
+// narrowScope resolves the scope of an exchanged token. Requested scopes
+// must be held by the subject token (when it is scoped) and registered for
+// the target client (when it declares scopes). Without a request the
+// subject's scopes that the target accepts are carried over.
+func narrowScope(requested string, subject jwt.MapClaims, targetScope string) (string, bool) {
+	subjectScope, scoped := subject["scope"].(string)
+	allowed := func(sc string) bool {
+		if scoped && !containsString(strings.Fields(subjectScope), sc) {
+			return false
+		}
+		return targetScope == "" || containsString(strings.Fields(targetScope), sc)
+	}
+
+	if requested == "" {
+		if !scoped {
+			return "", true
+		}
+		var carried []string
+		for _, sc := range strings.Fields(subjectScope) {
+			if allowed(sc) {
+				carried = append(carried, sc)
+			}
+		}
+		return strings.Join(carried, " "), true
+	}
+
+	scopes := strings.Fields(requested)
+	for _, sc := range scopes {
+		if !allowed(sc) {
+			return "", false
+		}
+	}
+	return strings.Join(scopes, " "), true
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/jobs"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+// usageRollupDays is how many past days each run recomputes: the day that
+// just ended, and the one before for audit events that arrived late
+const usageRollupDays = 2
+
+// UsageRollupService rolls the usage of every organization up into
+// org_usage_daily, which the organization analytics read
+type UsageRollupService interface {
+	// Rollup computes the usage of every organization on the UTC day
+	Rollup(ctx context.Context, day time.Time) error
+	RegisterJobs(scheduler *jobs.Scheduler) error
+}
+
+type usageRollupService struct {
+	queries queries.StatsQueries
+	logger  *logger.Logger
+}
+
+// NewUsageRollupService creates a new instance of UsageRollupService
+func NewUsageRollupService(q queries.StatsQueries, l *logger.Logger) UsageRollupService {
+	return &usageRollupService{queries: q, logger: l}
+}
+
+func (s *usageRollupService) Rollup(ctx context.Context, day time.Time) error {
+	n, err := s.queries.WithContext(ctx).RollupOrgUsage(day)
+	if err != nil {
+		return err
+	}
+	s.logger.Info("Rolled up the usage of %d organizations on %s", n, day.UTC().Format("2006-01-02"))
+	return nil
+}
+
+// RegisterJobs schedules the nightly rollup. It runs at half past midnight
+// server time and recomputes whole UTC days, so a day that has not ended yet
+// in UTC is picked up by the next night's run.
+func (s *usageRollupService) RegisterJobs(scheduler *jobs.Scheduler) error {
+	return scheduler.Register(jobs.Job{
+		Name:        "org_usage_rollup",
+		Description: "Roll up the daily usage of every organization for the analytics API",
+		Schedule:    "30 0 * * *",
+		Timeout:     30 * time.Minute,
+		Run:         s.run,
+	})
+}
+
+func (s *usageRollupService) run(ctx context.Context) error {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	for i := usageRollupDays; i >= 1; i-- {
+		if err := s.Rollup(ctx, today.AddDate(0, 0, -i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,435 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+	"github.com/the-monkeys/monkeys-identity/internal/password"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+const (
+	userImportTTL          = 24 * time.Hour
+	userImportBuildTimeout = 30 * time.Minute
+	userImportInviteExpiry = 72 * time.Hour
+	userImportExportPage   = 500
+
+	// UserImportMaxRows caps the number of rows accepted in a single upload
+	UserImportMaxRows = 10000
+	// UserImportSyncRows is the largest import processed inline; bigger
+	// uploads run in the background and are polled via the job API
+	UserImportSyncRows = 100
+)
+
+var (
+	importEmailPattern    = regexp.MustCompile(`^[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}$`)
+	importUsernamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{3,100}$`)
+	importUsernameInvalid = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+)
+
+// UserImportOptions controls how an import is applied
+type UserImportOptions struct {
+	DryRun      bool // Validate only; nothing is written
+	SendInvites bool // Email each created user a link to set their password
+}
+
+// UserImportService bulk-creates users of an organization from CSV or JSON
+// uploads and exports them in the same formats
+type UserImportService interface {
+	StartImport(ctx context.Context, organizationID, requestedBy string, rows []models.UserImportRow, opts UserImportOptions) (*models.UserImportJob, error)
+	GetJob(ctx context.Context, jobID string) (*models.UserImportJob, error)
+	ExportUsers(ctx context.Context, organizationID, format string) ([]byte, error)
+}
+
+type userImportService struct {
+	queries *queries.Queries
+	redis   redis.UniversalClient
+	email   EmailService
+	logger  *logger.Logger
+}
+
+// NewUserImportService creates a new instance of UserImportService
+func NewUserImportService(q *queries.Queries, redis redis.UniversalClient, email EmailService, l *logger.Logger) UserImportService {
+	return &userImportService{queries: q, redis: redis, email: email, logger: l}
+}
+
+func userImportJobKey(jobID string) string { return "user_import:" + jobID }
+
+// ParseUserImport decodes an upload in "csv" or "json" format. CSV files must
+// start with a header row naming the columns (username, email, display_name,
+// password, role); unknown columns are ignored.
+func ParseUserImport(format string, data []byte) ([]models.UserImportRow, error) {
+	var rows []models.UserImportRow
+
+	switch format {
+	case "json":
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return nil, fmt.Errorf("invalid JSON: expected an array of users: %w", err)
+		}
+	case "csv":
+		r := csv.NewReader(bytes.NewReader(data))
+		r.TrimLeadingSpace = true
+		header, err := r.Read()
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: missing header row")
+		}
+		columns := map[string]int{}
+		for i, name := range header {
+			columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+		}
+		if _, ok := columns["email"]; !ok {
+			return nil, fmt.Errorf("invalid CSV: header must contain an email column")
+		}
+		field := func(record []string, name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		for {
+			record, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid CSV: %w", err)
+			}
+			rows = append(rows, models.UserImportRow{
+				Username:    field(record, "username"),
+				Email:       field(record, "email"),
+				DisplayName: field(record, "display_name"),
+				Password:    field(record, "password"),
+				Role:        field(record, "role"),
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("the upload contains no users")
+	}
+	if len(rows) > UserImportMaxRows {
+		return nil, fmt.Errorf("the upload contains %d users; the maximum is %d", len(rows), UserImportMaxRows)
+	}
+	return rows, nil
+}
+
+// StartImport records an import job and processes it, inline for small
+// uploads and in the background otherwise
+func (s *userImportService) StartImport(ctx context.Context, organizationID, requestedBy string, rows []models.UserImportRow, opts UserImportOptions) (*models.UserImportJob, error) {
+	now := time.Now()
+	job := &models.UserImportJob{
+		ID:             uuid.NewString(),
+		OrganizationID: organizationID,
+		RequestedBy:    requestedBy,
+		Status:         "pending",
+		DryRun:         opts.DryRun,
+		SendInvites:    opts.SendInvites,
+		Total:          len(rows),
+		Results:        []models.UserImportRowResult{},
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(userImportTTL),
+	}
+	if err := s.saveJob(ctx, job); err != nil {
+		return nil, err
+	}
+
+	if len(rows) <= UserImportSyncRows {
+		s.run(ctx, job, rows)
+		return job, nil
+	}
+
+	go func() {
+		runCtx, cancel := context.WithTimeout(context.Background(), userImportBuildTimeout)
+		defer cancel()
+		s.run(runCtx, job, rows)
+	}()
+	return job, nil
+}
+
+// GetJob returns the current state of an import job
+func (s *userImportService) GetJob(ctx context.Context, jobID string) (*models.UserImportJob, error) {
+	raw, err := s.redis.Get(ctx, userImportJobKey(jobID)).Bytes()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("import job not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var job models.UserImportJob
+	if err := json.Unmarshal(raw, &job); err != nil {
+		return nil, fmt.Errorf("failed to decode import job: %w", err)
+	}
+	return &job, nil
+}
+
+func (s *userImportService) run(ctx context.Context, job *models.UserImportJob, rows []models.UserImportRow) {
+	job.Status = "running"
+	if err := s.saveJob(ctx, job); err != nil {
+		s.logger.Error("Failed to update import job %s: %v", job.ID, err)
+	}
+
+	q := s.queries.WithContext(ctx)
+	orgName := ""
+	if job.SendInvites && !job.DryRun {
+		if org, err := q.Organization.GetOrganization(job.OrganizationID); err == nil {
+			orgName = org.Name
+		}
+	}
+
+	seenEmails := map[string]bool{}
+	seenUsernames := map[string]bool{}
+	for i, row := range rows {
+		result := s.importRow(q, job, row, seenEmails, seenUsernames, orgName)
+		result.Row = i + 1
+		job.Results = append(job.Results, result)
+		job.Processed++
+		if result.Status == "failed" {
+			job.Failed++
+		} else {
+			job.Succeeded++
+		}
+
+		// Publish progress periodically so pollers see the job advance
+		if job.Processed%UserImportSyncRows == 0 {
+			if err := s.saveJob(ctx, job); err != nil {
+				s.logger.Error("Failed to update import job %s: %v", job.ID, err)
+			}
+		}
+		if ctx.Err() != nil {
+			job.Error = "Import timed out before all rows were processed"
+			break
+		}
+	}
+
+	completedAt := time.Now()
+	job.CompletedAt = &completedAt
+	job.Status = "completed"
+	if job.Error != "" {
+		job.Status = "failed"
+	}
+	s.logger.Info("User import %s for org %s finished: %d created, %d failed (dry run: %t)",
+		job.ID, job.OrganizationID, job.Succeeded, job.Failed, job.DryRun)
+
+	if err := s.saveJob(context.Background(), job); err != nil {
+		s.logger.Error("Failed to update import job %s: %v", job.ID, err)
+	}
+}
+
+// importRow validates and, unless this is a dry run, creates a single user
+func (s *userImportService) importRow(q *queries.Queries, job *models.UserImportJob, row models.UserImportRow, seenEmails, seenUsernames map[string]bool, orgName string) models.UserImportRowResult {
+	row.Email = strings.ToLower(strings.TrimSpace(row.Email))
+	row.Username = strings.TrimSpace(row.Username)
+	if row.Username == "" {
+		row.Username = usernameFromEmail(row.Email)
+	}
+	result := models.UserImportRowResult{Email: row.Email}
+
+	var errs []string
+	if !importEmailPattern.MatchString(row.Email) {
+		errs = append(errs, "invalid email address")
+	} else if seenEmails[row.Email] {
+		errs = append(errs, "duplicate email in upload")
+	} else if existing, err := q.Auth.GetUserByEmail(row.Email, job.OrganizationID); err == nil && existing != nil {
+		errs = append(errs, "a user with this email already exists")
+	}
+	if !importUsernamePattern.MatchString(row.Username) {
+		errs = append(errs, "username must be 3-100 characters of letters, digits, '.', '_' or '-'")
+	} else if seenUsernames[strings.ToLower(row.Username)] {
+		errs = append(errs, "duplicate username in upload")
+	} else if taken, err := q.User.UsernameExists(row.Username, job.OrganizationID); err == nil && taken {
+		errs = append(errs, "a user with this username already exists")
+	}
+	if row.Password != "" && len(row.Password) < 8 {
+		errs = append(errs, "password must be at least 8 characters")
+	}
+
+	roleID := ""
+	if row.Role != "" {
+		id, err := q.Role.GetRoleIDByName(row.Role, job.OrganizationID)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("role %q does not exist", row.Role))
+		}
+		roleID = id
+	}
+
+	seenEmails[row.Email] = true
+	seenUsernames[strings.ToLower(row.Username)] = true
+
+	if len(errs) > 0 {
+		result.Status = "failed"
+		result.Errors = errs
+		return result
+	}
+	if job.DryRun {
+		result.Status = "valid"
+		return result
+	}
+
+	secret := row.Password
+	if secret == "" {
+		// Invited users choose their own password; until then the account
+		// has a random one nobody knows
+		secret = randomHex(24)
+	}
+	hash, err := password.Hash(secret)
+	if err != nil {
+		return failedRow(result, "failed to process password")
+	}
+
+	now := time.Now()
+	user := &models.User{
+		ID:             uuid.NewString(),
+		Username:       row.Username,
+		Email:          row.Email,
+		DisplayName:    row.DisplayName,
+		OrganizationID: job.OrganizationID,
+		PasswordHash:   hash,
+		Status:         "active",
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := q.User.CreateUser(user); err != nil {
+		s.logger.Error("User import %s: failed to create %s: %v", job.ID, row.Email, err)
+		return failedRow(result, "failed to create user")
+	}
+	result.Status = "created"
+	result.UserID = user.ID
+
+	if roleID == "" {
+		if err := q.Role.EnsureRoleByName("user", "Standard user with basic access", job.OrganizationID, &roleID); err != nil {
+			s.logger.Warn("User import %s: failed to ensure default role: %v", job.ID, err)
+		}
+	}
+	if roleID != "" {
+		assignment := &models.RoleAssignment{
+			ID:            uuid.NewString(),
+			RoleID:        roleID,
+			PrincipalID:   user.ID,
+			PrincipalType: "user",
+			AssignedBy:    job.RequestedBy,
+		}
+		if err := q.Role.AssignRole(assignment, job.OrganizationID); err != nil {
+			s.logger.Warn("User import %s: failed to assign role to %s: %v", job.ID, user.ID, err)
+			result.Errors = append(result.Errors, "user created but role assignment failed")
+		}
+	}
+
+	if job.SendInvites {
+		token := uuid.NewString()
+		if err := q.Auth.SetPasswordResetToken(user.ID, token, userImportInviteExpiry); err != nil {
+			s.logger.Warn("User import %s: failed to store invite token for %s: %v", job.ID, user.ID, err)
+			result.Errors = append(result.Errors, "user created but invitation could not be sent")
+		} else if err := s.email.SendInvitationEmail(job.OrganizationID, user.Email, user.Username, orgName, token); err != nil {
+			s.logger.Warn("User import %s: failed to send invite to %s: %v", job.ID, user.Email, err)
+			result.Errors = append(result.Errors, "user created but invitation could not be sent")
+		}
+	}
+
+	return result
+}
+
+// ExportUsers renders every non-deleted user of the organization as CSV or JSON
+func (s *userImportService) ExportUsers(ctx context.Context, organizationID, format string) ([]byte, error) {
+	q := s.queries.WithContext(ctx)
+
+	var users []models.User
+	params := queries.ListParams{Limit: userImportExportPage, SortBy: "created_at", Order: "asc"}
+	for {
+		page, err := q.User.ListUsers(params, organizationID, queries.UserFilter{})
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, page.Items...)
+		if !page.HasMore {
+			break
+		}
+		params.Cursor = page.NextCursor
+	}
+
+	switch format {
+	case "json":
+		type exportedUser struct {
+			ID          string    `json:"id"`
+			Username    string    `json:"username"`
+			Email       string    `json:"email"`
+			DisplayName string    `json:"display_name"`
+			Role        string    `json:"role"`
+			Status      string    `json:"status"`
+			MFAEnabled  bool      `json:"mfa_enabled"`
+			CreatedAt   time.Time `json:"created_at"`
+		}
+		out := make([]exportedUser, 0, len(users))
+		for _, u := range users {
+			out = append(out, exportedUser{u.ID, u.Username, u.Email, u.DisplayName, u.Role, u.Status, u.MFAEnabled, u.CreatedAt})
+		}
+		return json.MarshalIndent(out, "", "  ")
+	case "csv":
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		_ = w.Write([]string{"id", "username", "email", "display_name", "role", "status", "mfa_enabled", "created_at"})
+		for _, u := range users {
+			_ = w.Write([]string{u.ID, u.Username, u.Email, u.DisplayName, u.Role, u.Status,
+				strconv.FormatBool(u.MFAEnabled), u.CreatedAt.UTC().Format(time.RFC3339)})
+		}
+		w.Flush()
+		return buf.Bytes(), w.Error()
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+func (s *userImportService) saveJob(ctx context.Context, job *models.UserImportJob) error {
+	raw, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(job.ExpiresAt)
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	if err := s.redis.Set(ctx, userImportJobKey(job.ID), raw, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save import job: %w", err)
+	}
+	return nil
+}
+
+func failedRow(result models.UserImportRowResult, msg string) models.UserImportRowResult {
+	result.Status = "failed"
+	result.Errors = append(result.Errors, msg)
+	return result
+}
+
+// usernameFromEmail derives a valid username from the local part of an email
+func usernameFromEmail(email string) string {
+	local, _, _ := strings.Cut(email, "@")
+	name := importUsernameInvalid.ReplaceAllString(local, "-")
+	for len(name) < 3 {
+		name += "_"
+	}
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	return name
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
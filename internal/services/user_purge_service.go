@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/jobs"
+	"github.com/the-monkeys/monkeys-identity/internal/queries"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+// UserPurgeService irreversibly anonymizes soft-deleted users once their
+// restore grace period has elapsed
+type UserPurgeService interface {
+	PurgeExpired() (int, error)
+	RegisterJobs(scheduler *jobs.Scheduler) error
+}
+
+type userPurgeService struct {
+	queries     queries.UserQueries
+	logger      *logger.Logger
+	gracePeriod time.Duration
+}
+
+// NewUserPurgeService creates a new instance of UserPurgeService. A grace
+// period of zero or less disables automatic purging.
+func NewUserPurgeService(q queries.UserQueries, gracePeriod time.Duration, l *logger.Logger) UserPurgeService {
+	return &userPurgeService{
+		queries:     q,
+		logger:      l,
+		gracePeriod: gracePeriod,
+	}
+}
+
+// PurgeExpired anonymizes all users deleted longer ago than the grace period
+func (s *userPurgeService) PurgeExpired() (int, error) {
+	return s.queries.PurgeDeletedUsers(time.Now().Add(-s.gracePeriod))
+}
+
+// RegisterJobs schedules the hourly purge unless automatic purging is disabled
+func (s *userPurgeService) RegisterJobs(scheduler *jobs.Scheduler) error {
+	if s.gracePeriod <= 0 {
+		s.logger.Info("User purge job disabled (grace period not set)")
+		return nil
+	}
+	return scheduler.Register(jobs.Job{
+		Name:        "user_purge",
+		Description: "Anonymize deleted users whose restore grace period (" + s.gracePeriod.String() + ") has elapsed",
+		Schedule:    "@hourly",
+		Timeout:     10 * time.Minute,
+		Run:         s.run,
+	})
+}
+
+func (s *userPurgeService) run(ctx context.Context) error {
+	purged, err := s.queries.WithContext(ctx).PurgeDeletedUsers(time.Now().Add(-s.gracePeriod))
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		s.logger.Info("Purged %d deleted users past the grace period", purged)
+	}
+	return nil
+}
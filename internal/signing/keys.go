@@ -0,0 +1,195 @@
+// Package signing owns the keys IAM tokens are signed and verified with.
+package signing
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/the-monkeys/monkeys-identity/internal/config"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+	"github.com/the-monkeys/monkeys-identity/pkg/utils"
+)
+
+// ErrHS256Retired is returned for HS256 tokens once the migration window
+// configured by JWT_HS256_ACCEPT_UNTIL has closed
+var ErrHS256Retired = errors.New("HS256 tokens are no longer accepted")
+
+// Key is a verification key published in the JWKS
+type Key struct {
+	ID     string
+	Public *rsa.PublicKey
+}
+
+// KeyManager signs tokens with the active RSA key and verifies tokens signed
+// by it, by retired keys kept for rotation, and, during a migration window,
+// by the legacy HS256 shared secret.
+type KeyManager struct {
+	active     *rsa.PrivateKey
+	activeID   string
+	keys       []Key // active key first
+	hmacSecret []byte
+	hmacUntil  time.Time
+	temporary  bool // the active key was generated at startup
+}
+
+// NewKeyManager loads the signing key from cfg.JWTPrivateKey and the retired
+// keys from cfg.JWTVerifyKeyFiles. Without a usable signing key a temporary
+// one is generated and written back to cfg.JWTPrivateKey; tokens signed with
+// it do not survive a restart.
+func NewKeyManager(cfg *config.Config, l *logger.Logger) (*KeyManager, error) {
+	var active *rsa.PrivateKey
+	temporary := false
+	if cfg.JWTPrivateKey != "" {
+		key, err := utils.LoadRSAPrivateKey(cfg.JWTPrivateKey)
+		if err != nil {
+			l.Warn("Failed to load provided JWT private key: %v. Generating a temporary one instead.", err)
+		}
+		active = key
+	}
+	if active == nil {
+		l.Warn("Using temporary RSA key for this session (not for production use)")
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate temporary RSA key: %w", err)
+		}
+		active, temporary = key, true
+		cfg.JWTPrivateKey = string(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		}))
+	}
+
+	m := &KeyManager{
+		active:    active,
+		activeID:  KeyID(&active.PublicKey),
+		temporary: temporary,
+	}
+	m.keys = append(m.keys, Key{ID: m.activeID, Public: &active.PublicKey})
+
+	for _, file := range cfg.JWTVerifyKeyFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read verification key %s: %w", file, err)
+		}
+		pub, err := utils.LoadRSAPublicKey(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse verification key %s: %w", file, err)
+		}
+		if id := KeyID(pub); id != m.activeID {
+			m.keys = append(m.keys, Key{ID: id, Public: pub})
+		}
+	}
+
+	if !cfg.JWTHS256AcceptUntil.IsZero() && cfg.JWTSecret != "" {
+		m.hmacSecret = []byte(cfg.JWTSecret)
+		m.hmacUntil = cfg.JWTHS256AcceptUntil
+		if time.Now().Before(m.hmacUntil) {
+			l.Warn("Legacy HS256 tokens are accepted until %s", m.hmacUntil.Format(time.RFC3339))
+		}
+	}
+
+	return m, nil
+}
+
+// KeyID derives a key's "kid" from its RFC 7638 JWK thumbprint, so every
+// replica computes the same ID without coordination
+func KeyID(pub *rsa.PublicKey) string {
+	// Members in lexicographic order, no whitespace
+	jwk := fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, encodeExponent(pub.E), base64.RawURLEncoding.EncodeToString(pub.N.Bytes()))
+	sum := sha256.Sum256([]byte(jwk))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func encodeExponent(e int) string {
+	return base64.RawURLEncoding.EncodeToString(big.NewInt(int64(e)).Bytes())
+}
+
+// PrivateKey returns the active signing key
+func (m *KeyManager) PrivateKey() *rsa.PrivateKey {
+	return m.active
+}
+
+// KeyID returns the kid of the active signing key
+func (m *KeyManager) KeyID() string {
+	return m.activeID
+}
+
+// Temporary reports whether the active key was generated at startup because
+// none was configured; tokens it signs do not survive a restart and other
+// replicas reject them
+func (m *KeyManager) Temporary() bool {
+	return m.temporary
+}
+
+// Check signs a short-lived token with the active key and verifies it, to
+// tell that tokens can be issued
+func (m *KeyManager) Check() error {
+	signed, err := m.Sign(jwt.MapClaims{"sub": "health", "exp": time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		return fmt.Errorf("sign: %w", err)
+	}
+	if _, err := jwt.Parse(signed, m.Keyfunc, jwt.WithValidMethods([]string{"RS256"})); err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+	return nil
+}
+
+// Sign signs claims with RS256 and the active key, setting the kid header
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = m.activeID
+	return token.SignedString(m.active)
+}
+
+// Keyfunc resolves the verification key of a token for jwt.Parse. RS256
+// tokens are matched by kid; tokens without a known kid (issued before kids
+// were set) are tried against every key.
+func (m *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA:
+		if kid, _ := token.Header["kid"].(string); kid != "" {
+			for _, k := range m.keys {
+				if k.ID == kid {
+					return k.Public, nil
+				}
+			}
+		}
+		set := jwt.VerificationKeySet{}
+		for _, k := range m.keys {
+			set.Keys = append(set.Keys, k.Public)
+		}
+		return set, nil
+	case *jwt.SigningMethodHMAC:
+		if m.hmacSecret == nil || !time.Now().Before(m.hmacUntil) {
+			return nil, ErrHS256Retired
+		}
+		return m.hmacSecret, nil
+	}
+	return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+}
+
+// JWKS returns the JSON Web Key Set (RFC 7517) of all verification keys
+func (m *KeyManager) JWKS() map[string]interface{} {
+	keys := make([]map[string]interface{}, 0, len(m.keys))
+	for _, k := range m.keys {
+		keys = append(keys, map[string]interface{}{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": k.ID,
+			"n":   base64.RawURLEncoding.EncodeToString(k.Public.N.Bytes()),
+			"e":   encodeExponent(k.Public.E),
+		})
+	}
+	return map[string]interface{}{"keys": keys}
+}
@@ -0,0 +1,140 @@
+package signing
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/the-monkeys/monkeys-identity/internal/config"
+	"github.com/the-monkeys/monkeys-identity/pkg/logger"
+)
+
+func newKey(t *testing.T) (*rsa.PrivateKey, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+func TestKeyManagerVerifiesActiveAndRetiredKeys(t *testing.T) {
+	_, activePEM := newKey(t)
+	retired, _ := newKey(t)
+	pubDER, err := x509.MarshalPKIXPublicKey(&retired.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retiredFile := filepath.Join(t.TempDir(), "retired.pem")
+	if err := os.WriteFile(retiredFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewKeyManager(&config.Config{JWTPrivateKey: activePEM, JWTVerifyKeyFiles: []string{retiredFile}}, logger.New("error"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(m.JWKS()["keys"].([]map[string]interface{})); got != 2 {
+		t.Fatalf("JWKS has %d keys, want 2", got)
+	}
+
+	claims := jwt.MapClaims{"sub": "u1", "exp": time.Now().Add(time.Minute).Unix()}
+
+	signed, err := m.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.Parse(signed, m.Keyfunc)
+	if err != nil || !token.Valid {
+		t.Fatalf("active key token rejected: %v", err)
+	}
+	if token.Header["kid"] != m.KeyID() {
+		t.Fatalf("kid = %v, want %s", token.Header["kid"], m.KeyID())
+	}
+
+	// Signed by the retired key, with and without its kid
+	for _, kid := range []string{KeyID(&retired.PublicKey), ""} {
+		old := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		if kid != "" {
+			old.Header["kid"] = kid
+		}
+		signed, _ := old.SignedString(retired)
+		if _, err := jwt.Parse(signed, m.Keyfunc); err != nil {
+			t.Fatalf("retired key token (kid %q) rejected: %v", kid, err)
+		}
+	}
+
+	// Signed by an unknown key
+	stranger, _ := newKey(t)
+	signed, _ = jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(stranger)
+	if _, err := jwt.Parse(signed, m.Keyfunc); err == nil {
+		t.Fatal("token signed by an unknown key was accepted")
+	}
+}
+
+func TestKeyManagerHS256Window(t *testing.T) {
+	_, activePEM := newKey(t)
+	claims := jwt.MapClaims{"sub": "u1", "exp": time.Now().Add(time.Minute).Unix()}
+	signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+
+	tests := []struct {
+		name  string
+		until time.Time
+		ok    bool
+	}{
+		{"no window", time.Time{}, false},
+		{"open window", time.Now().Add(time.Hour), true},
+		{"closed window", time.Now().Add(-time.Hour), false},
+	}
+	for _, tt := range tests {
+		m, err := NewKeyManager(&config.Config{JWTPrivateKey: activePEM, JWTSecret: "secret", JWTHS256AcceptUntil: tt.until}, logger.New("error"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = jwt.Parse(signed, m.Keyfunc)
+		if tt.ok && err != nil {
+			t.Errorf("%s: HS256 token rejected: %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrHS256Retired) {
+			t.Errorf("%s: err = %v, want ErrHS256Retired", tt.name, err)
+		}
+	}
+}
+
+func TestKeyManagerCheck(t *testing.T) {
+	_, activePEM := newKey(t)
+	m, err := NewKeyManager(&config.Config{JWTPrivateKey: activePEM}, logger.New("error"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Check(); err != nil {
+		t.Errorf("Check: %v", err)
+	}
+	if m.Temporary() {
+		t.Error("configured key reported as temporary")
+	}
+
+	m, err = NewKeyManager(&config.Config{}, logger.New("error"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Temporary() {
+		t.Error("generated key not reported as temporary")
+	}
+	if err := m.Check(); err != nil {
+		t.Errorf("Check with a temporary key: %v", err)
+	}
+
+	other, _ := newKey(t)
+	m.active = other
+	if err := m.Check(); err == nil {
+		t.Error("Check passed with an active key missing from the verification keys")
+	}
+}
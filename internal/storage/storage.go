@@ -0,0 +1,123 @@
+// Package storage holds the blobs uploaded to the IAM server, such as content
+// attachments, behind a backend chosen by configuration.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/the-monkeys/monkeys-identity/internal/config"
+)
+
+// ErrNotFound is returned by Open for keys that hold no object
+var ErrNotFound = errors.New("object not found")
+
+// Backend stores objects under slash-separated keys
+type Backend interface {
+	// Put writes the object read from r, replacing any object at key
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Open returns a reader of the object; the caller closes it
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// New returns the backend selected by cfg.StorageBackend
+func New(cfg *config.Config) (Backend, error) {
+	switch cfg.StorageBackend {
+	case "local":
+		return NewLocal(cfg.StorageLocalDir)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.StorageBackend)
+	}
+}
+
+// Local stores objects as files below a root directory
+type Local struct {
+	root string
+}
+
+// NewLocal creates the root directory if needed and returns a backend
+// storing objects below it
+func NewLocal(root string) (*Local, error) {
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	return &Local{root: root}, nil
+}
+
+// path maps a key to its file, refusing keys that would escape the root
+func (l *Local) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if key == "" || clean == "/" || strings.Contains(key, "\\") || clean != "/"+key {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(l.root, filepath.FromSlash(clean)), nil
+}
+
+// Put writes to a temporary file renamed into place once complete, so that
+// readers never see a partial object
+func (l *Local) Put(ctx context.Context, key string, r io.Reader) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, &contextReader{ctx: ctx, r: r}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (l *Local) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// contextReader stops a copy once its context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLocalRoundTrip(t *testing.T) {
+	l, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := l.Put(ctx, "org-a/content-1/file", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	r, err := l.Open(ctx, "org-a/content-1/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("read %q, %v; want hello", data, err)
+	}
+
+	if err := l.Delete(ctx, "org-a/content-1/file"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Open(ctx, "org-a/content-1/file"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("open after delete: %v, want ErrNotFound", err)
+	}
+	if err := l.Delete(ctx, "org-a/content-1/file"); err != nil {
+		t.Fatalf("deleting a missing key: %v", err)
+	}
+}
+
+func TestLocalRejectsKeysOutsideRoot(t *testing.T) {
+	l, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"", "../escape", "a/../../escape", "/absolute", "a//b", `a\b`} {
+		if err := l.Put(context.Background(), key, strings.NewReader("x")); err == nil {
+			t.Errorf("Put(%q) succeeded, want an error", key)
+		}
+	}
+}
+
+func TestLocalPutStopsWithContext(t *testing.T) {
+	l, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.Put(ctx, "file", strings.NewReader("data")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Put with canceled context: %v", err)
+	}
+	if _, err := l.Open(context.Background(), "file"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("canceled Put left an object behind: %v", err)
+	}
+}
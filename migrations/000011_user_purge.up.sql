@@ -0,0 +1,7 @@
+-- Track irreversible anonymization of soft-deleted users.
+-- A user with purged_at set has had all PII scrubbed and can no longer be restored.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS purged_at TIMESTAMP WITH TIME ZONE;
+
+-- Supports the purge worker scanning for deleted users past the grace period.
+CREATE INDEX IF NOT EXISTS idx_users_pending_purge ON users (deleted_at) WHERE status = 'deleted' AND purged_at IS NULL;
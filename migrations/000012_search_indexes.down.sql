@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_resources_arn_trgm;
+DROP INDEX IF EXISTS idx_resources_name_trgm;
+DROP INDEX IF EXISTS idx_users_display_name_trgm;
+DROP INDEX IF EXISTS idx_users_email_trgm;
+DROP INDEX IF EXISTS idx_users_username_trgm;
@@ -0,0 +1,10 @@
+-- Trigram indexes backing the ?q= substring search on the users and resources lists.
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_users_username_trgm     ON users USING gin (username gin_trgm_ops)     WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_users_email_trgm        ON users USING gin (email gin_trgm_ops)        WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_users_display_name_trgm ON users USING gin (display_name gin_trgm_ops) WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_resources_name_trgm ON resources USING gin (name gin_trgm_ops) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_resources_arn_trgm  ON resources USING gin (arn gin_trgm_ops)  WHERE deleted_at IS NULL;
@@ -0,0 +1,2 @@
+-- Phone number for SMS one-time passcodes. Email codes go to users.email.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_phone VARCHAR(20);
@@ -0,0 +1,3 @@
+-- When the session last completed an MFA check. Step-up authentication
+-- requires this to be recent for sensitive operations.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS mfa_verified_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,15 @@
+-- Scopes a user has granted an OAuth client. The consent screen is skipped
+-- while the granted scopes cover a request; deleting a row revokes the grant
+-- and every refresh token issued under it.
+CREATE TABLE IF NOT EXISTS oauth_consents (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id UUID NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, client_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_consents_client ON oauth_consents(client_id);
@@ -0,0 +1,3 @@
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS audiences;
+DROP TABLE IF EXISTS oauth_audiences;
+DROP TABLE IF EXISTS oauth_scopes;
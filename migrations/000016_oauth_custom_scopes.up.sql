@@ -0,0 +1,26 @@
+-- Organization-defined OAuth scopes (e.g. blog:write) and the policy actions
+-- each one grants, and the APIs (audiences) access tokens can be issued for
+CREATE TABLE IF NOT EXISTS oauth_scopes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    actions TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (organization_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS oauth_audiences (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    identifier VARCHAR(512) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (organization_id, identifier)
+);
+
+-- Audiences (by identifier) included in the aud claim of a client's access tokens
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS audiences TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,20 @@
+-- Sampled authorization decisions with the trace that explains them. The
+-- share of decisions recorded is set per organization by the
+-- authz_decision_sample_rate setting (default AUTHZ_DECISION_SAMPLE_RATE).
+-- principal_id is not a foreign key: service accounts and groups are
+-- principals too, and decisions outlive deleted users until retention.
+CREATE TABLE IF NOT EXISTS authz_decisions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    principal_id VARCHAR(255) NOT NULL,
+    principal_type VARCHAR(50) NOT NULL,
+    action VARCHAR(255) NOT NULL,
+    resource TEXT NOT NULL,
+    decision VARCHAR(20) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    trace JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_authz_decisions_org_time ON authz_decisions(organization_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_authz_decisions_principal ON authz_decisions(organization_id, principal_id, created_at DESC);
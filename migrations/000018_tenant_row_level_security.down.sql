@@ -0,0 +1,19 @@
+DO $$
+DECLARE
+    t TEXT;
+BEGIN
+    FOREACH t IN ARRAY ARRAY[
+        'users', 'service_accounts', 'groups', 'resources', 'policies', 'roles',
+        'sessions', 'api_keys', 'audit_events', 'access_reviews', 'oauth_clients',
+        'feature_flags', 'content_items', 'oauth_consents', 'oauth_scopes',
+        'oauth_audiences', 'authz_decisions'
+    ] LOOP
+        EXECUTE format('ALTER TABLE %I NO FORCE ROW LEVEL SECURITY', t);
+        EXECUTE format('ALTER TABLE %I DISABLE ROW LEVEL SECURITY', t);
+        EXECUTE format('DROP POLICY IF EXISTS tenant_isolation ON %I', t);
+    END LOOP;
+END
+$$;
+
+DROP FUNCTION IF EXISTS app_tenant_writable(UUID);
+DROP FUNCTION IF EXISTS app_tenant_visible(UUID);
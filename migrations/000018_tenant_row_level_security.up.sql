@@ -0,0 +1,43 @@
+-- Row-level security on tenant tables as defense in depth behind the
+-- organization filters in queries. A transaction sees only its tenant's rows
+-- once it sets app.current_org (SET LOCAL, see database.WithTenant); without
+-- the setting every row stays visible, so the policies are inert until the
+-- application enables DB_ROW_LEVEL_SECURITY. FORCE applies them to the table
+-- owner too, which is the role the application usually connects as.
+
+-- Rows of the global organization (shared roles and policies) and rows
+-- without an organization (global feature flags) are readable by every tenant
+CREATE OR REPLACE FUNCTION app_tenant_visible(row_org UUID) RETURNS BOOLEAN
+LANGUAGE sql STABLE AS $$
+    SELECT NULLIF(current_setting('app.current_org', true), '') IS NULL
+        OR row_org IS NULL
+        OR row_org = '00000000-0000-0000-0000-000000000000'
+        OR row_org = NULLIF(current_setting('app.current_org', true), '')::uuid
+$$;
+
+-- Tenants may only write their own rows
+CREATE OR REPLACE FUNCTION app_tenant_writable(row_org UUID) RETURNS BOOLEAN
+LANGUAGE sql STABLE AS $$
+    SELECT NULLIF(current_setting('app.current_org', true), '') IS NULL
+        OR row_org = NULLIF(current_setting('app.current_org', true), '')::uuid
+$$;
+
+DO $$
+DECLARE
+    t TEXT;
+BEGIN
+    FOREACH t IN ARRAY ARRAY[
+        'users', 'service_accounts', 'groups', 'resources', 'policies', 'roles',
+        'sessions', 'api_keys', 'audit_events', 'access_reviews', 'oauth_clients',
+        'feature_flags', 'content_items', 'oauth_consents', 'oauth_scopes',
+        'oauth_audiences', 'authz_decisions'
+    ] LOOP
+        EXECUTE format('DROP POLICY IF EXISTS tenant_isolation ON %I', t);
+        EXECUTE format(
+            'CREATE POLICY tenant_isolation ON %I USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id))',
+            t);
+        EXECUTE format('ALTER TABLE %I ENABLE ROW LEVEL SECURITY', t);
+        EXECUTE format('ALTER TABLE %I FORCE ROW LEVEL SECURITY', t);
+    END LOOP;
+END
+$$;
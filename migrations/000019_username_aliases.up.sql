@@ -0,0 +1,17 @@
+-- Usernames a user gave up by renaming. They keep resolving to the user so
+-- links to content by the old name redirect, and no one else can take them.
+-- The newest row per user also dates the last change for the rename cooldown.
+CREATE TABLE IF NOT EXISTS username_aliases (
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    username VARCHAR(100) NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (organization_id, username)
+);
+
+CREATE INDEX IF NOT EXISTS idx_username_aliases_user ON username_aliases(user_id, created_at DESC);
+
+CREATE POLICY tenant_isolation ON username_aliases
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE username_aliases ENABLE ROW LEVEL SECURITY;
+ALTER TABLE username_aliases FORCE ROW LEVEL SECURITY;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_content_comment_thread;
+ALTER TABLE content_items DROP COLUMN IF EXISTS moderation_status;
@@ -0,0 +1,12 @@
+-- Moderation state of comments (content_type = 'comment'): pending comments
+-- wait for approval by the owner of the commented content or an org admin,
+-- hidden ones were taken down. NULL for every other content type.
+ALTER TABLE content_items ADD COLUMN IF NOT EXISTS moderation_status VARCHAR(20)
+    CHECK (moderation_status IN ('pending', 'approved', 'hidden'));
+
+UPDATE content_items SET moderation_status = 'approved'
+WHERE content_type = 'comment' AND moderation_status IS NULL;
+
+-- Threads are read one level at a time, oldest first
+CREATE INDEX IF NOT EXISTS idx_content_comment_thread ON content_items(parent_id, created_at, id)
+    WHERE content_type = 'comment' AND deleted_at IS NULL;
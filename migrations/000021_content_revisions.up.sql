@@ -0,0 +1,33 @@
+-- Every saved state of a content item, numbered per item. A revision is
+-- written when content is created, updated or restored, attributed to the
+-- user who saved it; restored_from names the revision a restore copied.
+CREATE TABLE IF NOT EXISTS content_revisions (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    content_id      UUID NOT NULL REFERENCES content_items(id) ON DELETE CASCADE,
+    organization_id UUID NOT NULL REFERENCES organizations(id),
+    revision        INTEGER NOT NULL,
+    title           VARCHAR(500) NOT NULL,
+    slug            VARCHAR(500),
+    body            TEXT DEFAULT '',
+    summary         TEXT DEFAULT '',
+    cover_image_url TEXT DEFAULT '',
+    tags            JSONB DEFAULT '[]',
+    metadata        JSONB DEFAULT '{}',
+    author_id       UUID REFERENCES users(id) ON DELETE SET NULL,
+    restored_from   INTEGER,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (content_id, revision)
+);
+
+-- Existing content starts its history with its current state
+INSERT INTO content_revisions (content_id, organization_id, revision, title, slug, body, summary,
+                               cover_image_url, tags, metadata, author_id, created_at)
+SELECT id, organization_id, 1, title, slug, body, summary, cover_image_url, tags, metadata, owner_id, updated_at
+FROM content_items
+WHERE deleted_at IS NULL
+ON CONFLICT (content_id, revision) DO NOTHING;
+
+CREATE POLICY tenant_isolation ON content_revisions
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE content_revisions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE content_revisions FORCE ROW LEVEL SECURITY;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS content_bookmarks;
+DROP TABLE IF EXISTS content_reactions;
@@ -0,0 +1,34 @@
+-- Reactions and bookmarks on content. A user reacts at most once per type
+-- and bookmarks an item once. Aggregate counts are not read from these
+-- tables on every request: they are kept in content_items.metadata
+-- ("reactions" by type and "bookmarks") and recounted by a periodic job
+-- for items whose Redis counters changed.
+CREATE TABLE IF NOT EXISTS content_reactions (
+    content_id      UUID NOT NULL REFERENCES content_items(id) ON DELETE CASCADE,
+    user_id         UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reaction_type   VARCHAR(20) NOT NULL CHECK (reaction_type IN ('like', 'clap')),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (content_id, user_id, reaction_type)
+);
+
+CREATE TABLE IF NOT EXISTS content_bookmarks (
+    user_id         UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content_id      UUID NOT NULL REFERENCES content_items(id) ON DELETE CASCADE,
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, content_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_content_bookmarks_user ON content_bookmarks(user_id, created_at DESC, content_id);
+CREATE INDEX IF NOT EXISTS idx_content_bookmarks_item ON content_bookmarks(content_id);
+
+CREATE POLICY tenant_isolation ON content_reactions
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE content_reactions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE content_reactions FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation ON content_bookmarks
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE content_bookmarks ENABLE ROW LEVEL SECURITY;
+ALTER TABLE content_bookmarks FORCE ROW LEVEL SECURITY;
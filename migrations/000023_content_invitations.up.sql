@@ -0,0 +1,30 @@
+-- Invitations to collaborate on content sent to an email address that has
+-- no user in the organization yet. The invitee receives a signed link
+-- naming the invitation; it becomes a content_collaborators row when they
+-- accept it or verify that email address on a new account.
+CREATE TABLE IF NOT EXISTS content_invitations (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    content_id      UUID NOT NULL REFERENCES content_items(id) ON DELETE CASCADE,
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    email           VARCHAR(255) NOT NULL,
+    role            VARCHAR(20) NOT NULL DEFAULT 'co-author' CHECK (role IN ('co-author')),
+    status          VARCHAR(20) NOT NULL DEFAULT 'pending'
+                        CHECK (status IN ('pending', 'accepted', 'revoked')),
+    invited_by      UUID REFERENCES users(id) ON DELETE SET NULL,
+    accepted_by     UUID REFERENCES users(id) ON DELETE SET NULL,
+    expires_at      TIMESTAMPTZ NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    accepted_at     TIMESTAMPTZ,
+    revoked_at      TIMESTAMPTZ
+);
+
+-- One open invitation per address and item; re-inviting renews it
+CREATE UNIQUE INDEX IF NOT EXISTS idx_content_invitations_pending
+    ON content_invitations(content_id, LOWER(email)) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_content_invitations_email
+    ON content_invitations(organization_id, LOWER(email)) WHERE status = 'pending';
+
+CREATE POLICY tenant_isolation ON content_invitations
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE content_invitations ENABLE ROW LEVEL SECURITY;
+ALTER TABLE content_invitations FORCE ROW LEVEL SECURITY;
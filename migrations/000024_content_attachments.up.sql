@@ -0,0 +1,27 @@
+-- Files uploaded to content items. Every attachment is also a resource of
+-- type object with the same ID, so it can be shared through resource_shares
+-- like any other resource; deleting the resource deletes the attachment.
+-- The bytes live in the configured storage backend under storage_key.
+CREATE TABLE IF NOT EXISTS content_attachments (
+    id              UUID PRIMARY KEY REFERENCES resources(id) ON DELETE CASCADE,
+    content_id      UUID NOT NULL REFERENCES content_items(id) ON DELETE CASCADE,
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    storage_key     TEXT NOT NULL UNIQUE,
+    filename        VARCHAR(255) NOT NULL,
+    content_type    VARCHAR(100) NOT NULL,
+    size_bytes      BIGINT NOT NULL CHECK (size_bytes >= 0),
+    checksum        VARCHAR(64) NOT NULL, -- hex SHA-256
+    uploaded_by     UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_content_attachments_content
+    ON content_attachments(content_id, created_at);
+-- Quota checks sum the sizes of an organization's attachments
+CREATE INDEX IF NOT EXISTS idx_content_attachments_org
+    ON content_attachments(organization_id) INCLUDE (size_bytes);
+
+CREATE POLICY tenant_isolation ON content_attachments
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE content_attachments ENABLE ROW LEVEL SECURITY;
+ALTER TABLE content_attachments FORCE ROW LEVEL SECURITY;
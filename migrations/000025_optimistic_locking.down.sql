@@ -0,0 +1,2 @@
+ALTER TABLE policies DROP COLUMN IF EXISTS lock_version;
+ALTER TABLE content_items DROP COLUMN IF EXISTS lock_version;
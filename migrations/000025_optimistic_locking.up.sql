@@ -0,0 +1,5 @@
+-- Optimistic concurrency control: lock_version counts the updates of a row.
+-- Clients send back the version they read (If-Match) and an update against
+-- an older one is refused instead of silently overwriting the newer data.
+ALTER TABLE content_items ADD COLUMN IF NOT EXISTS lock_version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE policies ADD COLUMN IF NOT EXISTS lock_version INTEGER NOT NULL DEFAULT 1;
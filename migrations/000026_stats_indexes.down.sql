@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_audit_events_logins;
+DROP INDEX IF EXISTS idx_audit_events_org_timestamp;
@@ -0,0 +1,4 @@
+-- Indexes for the admin dashboard aggregates, which count the audit events
+-- and logins of an organization over the last days
+CREATE INDEX IF NOT EXISTS idx_audit_events_org_timestamp ON audit_events(organization_id, timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_logins ON audit_events(timestamp) WHERE action = 'login';
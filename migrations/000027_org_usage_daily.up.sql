@@ -0,0 +1,16 @@
+-- Daily usage of each organization, rolled up every night from the audit
+-- log, content and API key counters so that analytics never scan them live.
+-- top_resources holds the most accessed resources of the day as
+-- [{"resource_type", "resource_id", "count"}].
+CREATE TABLE IF NOT EXISTS org_usage_daily (
+    organization_id   UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    day               DATE NOT NULL,
+    active_users      INTEGER NOT NULL DEFAULT 0,
+    logins            INTEGER NOT NULL DEFAULT 0,
+    login_failures    INTEGER NOT NULL DEFAULT 0,
+    content_published INTEGER NOT NULL DEFAULT 0,
+    api_key_requests  BIGINT NOT NULL DEFAULT 0,
+    top_resources     JSONB NOT NULL DEFAULT '[]',
+    computed_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (organization_id, day)
+);
@@ -0,0 +1,16 @@
+-- SIEM destinations the audit events of an organization are exported to.
+-- config depends on the type and holds the credentials of the destination.
+CREATE TABLE IF NOT EXISTS audit_sinks (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name            VARCHAR(255) NOT NULL,
+    type            VARCHAR(20) NOT NULL CHECK (type IN ('splunk_hec', 'syslog', 's3')),
+    config          JSONB NOT NULL DEFAULT '{}',
+    enabled         BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by      UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT unique_audit_sink_name_per_org UNIQUE (organization_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_sinks_enabled ON audit_sinks(organization_id) WHERE enabled;
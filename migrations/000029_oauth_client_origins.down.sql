@@ -0,0 +1,2 @@
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS allow_wildcards;
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS allowed_origins;
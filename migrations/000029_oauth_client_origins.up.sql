@@ -0,0 +1,5 @@
+-- Browser origins an OAuth client calls the token and userinfo endpoints
+-- from, and the opt-in to wildcard host labels (https://*.example.com) in
+-- those origins and in redirect_uris
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS allowed_origins TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS allow_wildcards BOOLEAN NOT NULL DEFAULT FALSE;
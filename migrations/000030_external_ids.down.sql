@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_service_accounts_external_id;
+DROP INDEX IF EXISTS idx_oauth_clients_external_id;
+DROP INDEX IF EXISTS idx_policies_external_id;
+DROP INDEX IF EXISTS idx_roles_external_id;
+DROP INDEX IF EXISTS idx_organizations_external_id;
+
+ALTER TABLE service_accounts DROP COLUMN IF EXISTS external_id;
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS external_id;
+ALTER TABLE policies DROP COLUMN IF EXISTS external_id;
+ALTER TABLE roles DROP COLUMN IF EXISTS external_id;
+ALTER TABLE organizations DROP COLUMN IF EXISTS external_id;
@@ -0,0 +1,19 @@
+-- Stable identifiers chosen by the caller, e.g. the name of a Terraform
+-- resource, that managed resources can be upserted and imported by.
+-- Unique per organization among resources that are not deleted.
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS external_id TEXT;
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS external_id TEXT;
+ALTER TABLE policies ADD COLUMN IF NOT EXISTS external_id TEXT;
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS external_id TEXT;
+ALTER TABLE service_accounts ADD COLUMN IF NOT EXISTS external_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_organizations_external_id ON organizations(external_id)
+    WHERE external_id IS NOT NULL AND deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_roles_external_id ON roles(organization_id, external_id)
+    WHERE external_id IS NOT NULL AND deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_policies_external_id ON policies(organization_id, external_id)
+    WHERE external_id IS NOT NULL AND deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_oauth_clients_external_id ON oauth_clients(organization_id, external_id)
+    WHERE external_id IS NOT NULL AND deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_service_accounts_external_id ON service_accounts(organization_id, external_id)
+    WHERE external_id IS NOT NULL AND deleted_at IS NULL;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_groups_external_id;
+
+ALTER TABLE groups DROP COLUMN IF EXISTS external_id;
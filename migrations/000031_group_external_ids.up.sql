@@ -0,0 +1,6 @@
+-- Groups can be managed by external ID too, e.g. from configuration
+-- bundles applied with POST /admin/apply
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS external_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_groups_external_id ON groups(organization_id, external_id)
+    WHERE external_id IS NOT NULL AND deleted_at IS NULL;
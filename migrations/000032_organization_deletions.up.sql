@@ -0,0 +1,27 @@
+-- Scheduled deletions of organizations. Scheduling suspends the organization
+-- and records the status to restore if a root user cancels before
+-- scheduled_for; once it passes, the organization and everything in it is
+-- soft-deleted. The final data export is kept in the storage backend under
+-- export_key. One row per organization: a new schedule replaces a cancelled
+-- one.
+CREATE TABLE IF NOT EXISTS organization_deletions (
+    organization_id UUID PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+    requested_by    UUID REFERENCES users(id) ON DELETE SET NULL,
+    reason          TEXT NOT NULL DEFAULT '',
+    prior_status    entity_status NOT NULL,
+    requested_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    scheduled_for   TIMESTAMPTZ NOT NULL,
+    status          VARCHAR(20) NOT NULL DEFAULT 'scheduled'
+                        CHECK (status IN ('scheduled', 'cancelled', 'completed')),
+    export_status   VARCHAR(20) NOT NULL DEFAULT 'pending'
+                        CHECK (export_status IN ('pending', 'completed', 'failed')),
+    export_key      TEXT,
+    export_size     BIGINT,
+    export_error    TEXT,
+    cancelled_by    UUID REFERENCES users(id) ON DELETE SET NULL,
+    cancelled_at    TIMESTAMPTZ,
+    completed_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_organization_deletions_due ON organization_deletions(scheduled_for)
+    WHERE status = 'scheduled';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS security_alerts;
+DROP TABLE IF EXISTS security_rules;
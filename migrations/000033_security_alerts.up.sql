@@ -0,0 +1,48 @@
+-- Detection rules evaluated over the audit stream of an organization, and the
+-- alerts they raise. A rule fires once threshold occurrences fall within
+-- window_minutes, and not again for the same subject until the window has
+-- passed. webhook_secret signs the alerts posted to webhook_url.
+CREATE TABLE IF NOT EXISTS security_rules (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name            VARCHAR(255) NOT NULL,
+    type            VARCHAR(50) NOT NULL
+                        CHECK (type IN ('failed_logins', 'policy_wildcard', 'mass_role_assignment', 'api_key_new_country')),
+    threshold       INTEGER NOT NULL DEFAULT 1 CHECK (threshold > 0),
+    window_minutes  INTEGER NOT NULL DEFAULT 10 CHECK (window_minutes > 0),
+    severity        VARCHAR(20) NOT NULL DEFAULT 'high'
+                        CHECK (severity IN ('critical', 'high', 'medium', 'low')),
+    enabled         BOOLEAN NOT NULL DEFAULT TRUE,
+    notify_admins   BOOLEAN NOT NULL DEFAULT TRUE,
+    webhook_url     TEXT,
+    webhook_secret  TEXT,
+    created_by      UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT unique_security_rule_name_per_org UNIQUE (organization_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_security_rules_enabled ON security_rules(organization_id) WHERE enabled;
+
+-- rule_name and rule_type are copied so alerts stay readable after their
+-- rule is deleted. subject is what the rule counted by: a user, an IP
+-- address, a policy or an API key.
+CREATE TABLE IF NOT EXISTS security_alerts (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    rule_id         UUID REFERENCES security_rules(id) ON DELETE SET NULL,
+    rule_name       VARCHAR(255) NOT NULL,
+    rule_type       VARCHAR(50) NOT NULL,
+    severity        VARCHAR(20) NOT NULL,
+    subject         TEXT NOT NULL DEFAULT '',
+    summary         TEXT NOT NULL,
+    details         JSONB NOT NULL DEFAULT '{}',
+    status          VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'acknowledged')),
+    raised_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    acknowledged_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    acknowledged_at TIMESTAMPTZ,
+    note            TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_security_alerts_org ON security_alerts(organization_id, raised_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_security_alerts_open ON security_alerts(organization_id) WHERE status = 'open';
@@ -0,0 +1,5 @@
+-- Values sealed with these keys cannot be read once they are dropped; the
+-- ALTER fails while encrypted TOTP secrets are still stored.
+ALTER TABLE users ALTER COLUMN totp_secret TYPE VARCHAR(255);
+
+DROP TABLE IF EXISTS data_encryption_keys;
@@ -0,0 +1,17 @@
+-- Data keys of field encryption, wrapped by the master key named in
+-- master_key_id (local:<id> or vault:<mount>/<key>). Retired keys are kept:
+-- values and backups sealed with them stay readable.
+CREATE TABLE IF NOT EXISTS data_encryption_keys (
+    id            UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    master_key_id VARCHAR(255) NOT NULL,
+    wrapped_key   BYTEA NOT NULL,
+    status        VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'retired')),
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    retired_at    TIMESTAMPTZ
+);
+
+-- A single key seals new values
+CREATE UNIQUE INDEX IF NOT EXISTS idx_data_encryption_keys_active ON data_encryption_keys(status) WHERE status = 'active';
+
+-- Encrypted TOTP secrets outgrow VARCHAR(255)
+ALTER TABLE users ALTER COLUMN totp_secret TYPE TEXT;
@@ -0,0 +1,3 @@
+-- Index for the change history of one entity, read from the audit events
+-- carrying its before/after snapshots
+CREATE INDEX IF NOT EXISTS idx_audit_events_entity ON audit_events(organization_id, resource_type, resource_id, timestamp);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_users_dormant_since;
+ALTER TABLE users DROP COLUMN IF EXISTS dormant_since;
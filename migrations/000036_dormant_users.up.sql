@@ -0,0 +1,4 @@
+-- When a user was flagged as dormant by the inactivity policy of their
+-- organization; cleared on their next sign-in
+ALTER TABLE users ADD COLUMN IF NOT EXISTS dormant_since TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_users_dormant_since ON users(organization_id, dormant_since) WHERE dormant_since IS NOT NULL;
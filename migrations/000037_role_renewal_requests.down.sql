@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS role_renewal_requests;
+ALTER TABLE role_assignments DROP COLUMN IF EXISTS expiry_reminded_at;
@@ -0,0 +1,32 @@
+-- When the holder and assigner of an expiring role assignment were reminded
+-- of its expiry; cleared when the assignment is renewed or reassigned
+ALTER TABLE role_assignments ADD COLUMN IF NOT EXISTS expiry_reminded_at TIMESTAMPTZ;
+
+-- Requests to extend a role assignment before it expires. Approving one
+-- moves the expiry of the assignment to requested_expires_at; nobody may
+-- decide their own request.
+CREATE TABLE IF NOT EXISTS role_renewal_requests (
+    id                   UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id      UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    assignment_id        UUID NOT NULL REFERENCES role_assignments(id) ON DELETE CASCADE,
+    requested_by         UUID REFERENCES users(id) ON DELETE SET NULL,
+    reason               TEXT NOT NULL DEFAULT '',
+    requested_expires_at TIMESTAMPTZ NOT NULL,
+    status               VARCHAR(20) NOT NULL DEFAULT 'pending'
+                             CHECK (status IN ('pending', 'approved', 'denied')),
+    decided_by           UUID REFERENCES users(id) ON DELETE SET NULL,
+    decided_at           TIMESTAMPTZ,
+    decision_comment     TEXT NOT NULL DEFAULT '',
+    created_at           TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- One open request per assignment
+CREATE UNIQUE INDEX IF NOT EXISTS idx_role_renewal_requests_pending
+    ON role_renewal_requests(assignment_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_role_renewal_requests_org
+    ON role_renewal_requests(organization_id, status, created_at DESC);
+
+CREATE POLICY tenant_isolation ON role_renewal_requests
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE role_renewal_requests ENABLE ROW LEVEL SECURITY;
+ALTER TABLE role_renewal_requests FORCE ROW LEVEL SECURITY;
@@ -0,0 +1,15 @@
+ALTER TABLE resource_access_log NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE resource_access_log DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON resource_access_log;
+
+DROP INDEX IF EXISTS idx_resource_access_log_org_timestamp;
+DROP INDEX IF EXISTS idx_resource_access_log_resource;
+DELETE FROM resource_access_log WHERE resource_type != 'resource'
+    OR resource_id NOT IN (SELECT id FROM resources);
+CREATE INDEX IF NOT EXISTS idx_resource_access_log_resource_id ON resource_access_log(resource_id);
+ALTER TABLE resource_access_log ADD CONSTRAINT resource_access_log_resource_id_fkey
+    FOREIGN KEY (resource_id) REFERENCES resources(id) ON DELETE CASCADE;
+
+ALTER TABLE resource_access_log DROP COLUMN IF EXISTS principal_type;
+ALTER TABLE resource_access_log DROP COLUMN IF EXISTS resource_type;
+ALTER TABLE resource_access_log DROP COLUMN IF EXISTS organization_id;
@@ -0,0 +1,25 @@
+-- The access log now covers content items as well as resources, so entries
+-- carry the type and organization of what was accessed instead of relying on
+-- a foreign key to resources. Entries outlive what they describe until the
+-- retention purge removes them.
+ALTER TABLE resource_access_log ADD COLUMN IF NOT EXISTS organization_id UUID;
+ALTER TABLE resource_access_log ADD COLUMN IF NOT EXISTS resource_type VARCHAR(50) NOT NULL DEFAULT 'resource';
+ALTER TABLE resource_access_log ADD COLUMN IF NOT EXISTS principal_type VARCHAR(50) NOT NULL DEFAULT 'user';
+
+UPDATE resource_access_log ral SET organization_id = r.organization_id
+FROM resources r WHERE r.id = ral.resource_id AND ral.organization_id IS NULL;
+DELETE FROM resource_access_log WHERE organization_id IS NULL;
+
+ALTER TABLE resource_access_log ALTER COLUMN organization_id SET NOT NULL;
+ALTER TABLE resource_access_log DROP CONSTRAINT IF EXISTS resource_access_log_resource_id_fkey;
+
+DROP INDEX IF EXISTS idx_resource_access_log_resource_id;
+CREATE INDEX IF NOT EXISTS idx_resource_access_log_resource
+    ON resource_access_log(organization_id, resource_type, resource_id, timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_resource_access_log_org_timestamp
+    ON resource_access_log(organization_id, timestamp);
+
+CREATE POLICY tenant_isolation ON resource_access_log
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE resource_access_log ENABLE ROW LEVEL SECURITY;
+ALTER TABLE resource_access_log FORCE ROW LEVEL SECURITY;
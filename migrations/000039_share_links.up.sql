@@ -0,0 +1,26 @@
+-- Links that give whoever holds them access to one resource or content
+-- item. The link token is signed and names the row, which carries what can
+-- change after minting: revocation and how often the link was redeemed.
+CREATE TABLE IF NOT EXISTS share_links (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    resource_type   VARCHAR(50) NOT NULL CHECK (resource_type IN ('resource', 'content')),
+    resource_id     UUID NOT NULL,
+    access_level    VARCHAR(20) NOT NULL CHECK (access_level IN ('read', 'write')),
+    created_by      UUID REFERENCES users(id) ON DELETE SET NULL,
+    expires_at      TIMESTAMPTZ NOT NULL,
+    max_uses        INTEGER CHECK (max_uses > 0),
+    use_count       INTEGER NOT NULL DEFAULT 0,
+    last_used_at    TIMESTAMPTZ,
+    revoked_at      TIMESTAMPTZ,
+    revoked_by      UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_links_resource
+    ON share_links(organization_id, resource_type, resource_id, created_at DESC);
+
+CREATE POLICY tenant_isolation ON share_links
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE share_links ENABLE ROW LEVEL SECURITY;
+ALTER TABLE share_links FORCE ROW LEVEL SECURITY;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_content_collabs_expires_at;
+DROP INDEX IF EXISTS idx_resource_shares_expires_at;
+ALTER TABLE content_collaborators DROP COLUMN IF EXISTS expiry_reminded_at;
+ALTER TABLE content_collaborators DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE resource_shares DROP COLUMN IF EXISTS expiry_reminded_at;
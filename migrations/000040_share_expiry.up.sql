@@ -0,0 +1,14 @@
+-- When the recipient of an expiring resource share was reminded of its
+-- expiry
+ALTER TABLE resource_shares ADD COLUMN IF NOT EXISTS expiry_reminded_at TIMESTAMPTZ;
+
+-- Co-authors can be added for a limited time, like resource shares. Expired
+-- rows no longer grant access and are deleted by the share expiry job.
+-- Re-adding a co-author replaces the expiry and clears the reminder.
+ALTER TABLE content_collaborators ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+ALTER TABLE content_collaborators ADD COLUMN IF NOT EXISTS expiry_reminded_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_resource_shares_expires_at
+    ON resource_shares(expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_content_collabs_expires_at
+    ON content_collaborators(expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS external_shares;
+DROP TABLE IF EXISTS guest_principals;
@@ -0,0 +1,47 @@
+-- People outside an organization that its members shared a resource or
+-- content item with, known by email address. A guest has no account: they
+-- reach what was shared with them through the link emailed for each share.
+CREATE TABLE IF NOT EXISTS guest_principals (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    email           VARCHAR(255) NOT NULL,
+    created_by      UUID REFERENCES users(id) ON DELETE SET NULL,
+    last_access_at  TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (organization_id, email)
+);
+
+-- Shares with guests, each limited to one resource or content item. Shares
+-- are kept after they expire or are revoked for the admins' review.
+CREATE TABLE IF NOT EXISTS external_shares (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    guest_id        UUID NOT NULL REFERENCES guest_principals(id) ON DELETE CASCADE,
+    resource_type   VARCHAR(50) NOT NULL CHECK (resource_type IN ('resource', 'content')),
+    resource_id     UUID NOT NULL,
+    access_level    VARCHAR(20) NOT NULL CHECK (access_level IN ('read', 'write')),
+    shared_by       UUID REFERENCES users(id) ON DELETE SET NULL,
+    expires_at      TIMESTAMPTZ NOT NULL,
+    last_access_at  TIMESTAMPTZ,
+    revoked_at      TIMESTAMPTZ,
+    revoked_by      UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- One open share per guest and item; sharing again replaces it
+CREATE UNIQUE INDEX IF NOT EXISTS idx_external_shares_open
+    ON external_shares(guest_id, resource_type, resource_id) WHERE revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_external_shares_org
+    ON external_shares(organization_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_external_shares_resource
+    ON external_shares(organization_id, resource_type, resource_id);
+
+CREATE POLICY tenant_isolation ON guest_principals
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE guest_principals ENABLE ROW LEVEL SECURITY;
+ALTER TABLE guest_principals FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation ON external_shares
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE external_shares ENABLE ROW LEVEL SECURITY;
+ALTER TABLE external_shares FORCE ROW LEVEL SECURITY;
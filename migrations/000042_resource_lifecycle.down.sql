@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_resources_lifecycle;
+ALTER TABLE resources DROP COLUMN IF EXISTS recertification_requested_at;
+ALTER TABLE resources DROP COLUMN IF EXISTS certified_at;
+ALTER TABLE resources DROP COLUMN IF EXISTS archived_at;
@@ -0,0 +1,13 @@
+-- Lifecycle state of resources, driven by their lifecycle_policy: when a
+-- resource was archived, when its owner last certified it is still needed,
+-- and when they were asked to again. accessed_at is now kept up to date by
+-- the access log and, with updated_at, tells how long a resource sat idle.
+ALTER TABLE resources ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ;
+ALTER TABLE resources ADD COLUMN IF NOT EXISTS certified_at TIMESTAMPTZ;
+ALTER TABLE resources ADD COLUMN IF NOT EXISTS recertification_requested_at TIMESTAMPTZ;
+
+UPDATE resources SET archived_at = updated_at WHERE status = 'archived' AND archived_at IS NULL;
+
+-- The lifecycle worker only looks at resources with a policy
+CREATE INDEX IF NOT EXISTS idx_resources_lifecycle
+    ON resources(status) WHERE lifecycle_policy <> '{}'::jsonb AND deleted_at IS NULL;
@@ -0,0 +1,8 @@
+DELETE FROM security_rules WHERE type = 'checksum_mismatch';
+ALTER TABLE security_rules DROP CONSTRAINT IF EXISTS security_rules_type_check;
+ALTER TABLE security_rules ADD CONSTRAINT security_rules_type_check
+    CHECK (type IN ('failed_logins', 'policy_wildcard', 'mass_role_assignment', 'api_key_new_country'));
+
+DROP INDEX IF EXISTS idx_resources_checksum_verified_at;
+ALTER TABLE resources DROP COLUMN IF EXISTS checksum_verified_at;
+ALTER TABLE resources DROP COLUMN IF EXISTS checksum_status;
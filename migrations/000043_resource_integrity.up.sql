@@ -0,0 +1,15 @@
+-- Outcome of the last check of a resource's content against its stored
+-- SHA-256 checksum: unverified until checked, then valid, mismatch or, for
+-- resources backed by a stored blob, missing. Blob-backed resources are
+-- re-checked in the background; the others when a client verifies a copy.
+ALTER TABLE resources ADD COLUMN IF NOT EXISTS checksum_status VARCHAR(20) NOT NULL DEFAULT 'unverified'
+    CHECK (checksum_status IN ('unverified', 'valid', 'mismatch', 'missing'));
+ALTER TABLE resources ADD COLUMN IF NOT EXISTS checksum_verified_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_resources_checksum_verified_at
+    ON resources(checksum_verified_at NULLS FIRST) WHERE checksum IS NOT NULL AND deleted_at IS NULL;
+
+-- Checksum mismatches raise security alerts like the other rule types
+ALTER TABLE security_rules DROP CONSTRAINT IF EXISTS security_rules_type_check;
+ALTER TABLE security_rules ADD CONSTRAINT security_rules_type_check
+    CHECK (type IN ('failed_logins', 'policy_wildcard', 'mass_role_assignment', 'api_key_new_country', 'checksum_mismatch'));
@@ -0,0 +1,4 @@
+ALTER TABLE resources DROP CONSTRAINT IF EXISTS fk_resources_encryption_key;
+DROP TABLE IF EXISTS kms_key_grants;
+DROP TABLE IF EXISTS kms_key_versions;
+DROP TABLE IF EXISTS kms_keys;
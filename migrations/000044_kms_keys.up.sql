@@ -0,0 +1,68 @@
+-- Named encryption keys of organizations, used through the KMS API and
+-- referenced by resources.encryption_key_id. Each rotation adds a version;
+-- the material of every version is kept, wrapped by the master key named
+-- in master_key_id, so ciphertexts of earlier versions stay decryptable.
+-- Deleting a key deletes its material.
+CREATE TABLE IF NOT EXISTS kms_keys (
+    id                   UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id      UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name                 VARCHAR(100) NOT NULL,
+    description          TEXT NOT NULL DEFAULT '',
+    status               VARCHAR(20) NOT NULL DEFAULT 'enabled' CHECK (status IN ('enabled', 'disabled')),
+    current_version      INTEGER NOT NULL DEFAULT 1,
+    rotation_period_days INTEGER NOT NULL DEFAULT 0 CHECK (rotation_period_days >= 0),
+    rotated_at           TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_by           UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at           TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at           TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (organization_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS kms_key_versions (
+    key_id          UUID NOT NULL REFERENCES kms_keys(id) ON DELETE CASCADE,
+    version         INTEGER NOT NULL,
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    master_key_id   VARCHAR(255) NOT NULL,
+    wrapped_key     BYTEA NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (key_id, version)
+);
+
+-- Principals allowed to encrypt or decrypt with a key. A group grant
+-- covers the group's members.
+CREATE TABLE IF NOT EXISTS kms_key_grants (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    key_id          UUID NOT NULL REFERENCES kms_keys(id) ON DELETE CASCADE,
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    principal_id    UUID NOT NULL,
+    principal_type  principal_type NOT NULL,
+    operations      TEXT[] NOT NULL CHECK (operations <@ ARRAY['encrypt', 'decrypt'] AND cardinality(operations) > 0),
+    created_by      UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at      TIMESTAMPTZ,
+    UNIQUE (key_id, principal_id, principal_type)
+);
+
+CREATE INDEX IF NOT EXISTS idx_kms_key_grants_principal ON kms_key_grants(principal_id, principal_type);
+-- The rotation job looks at keys with a rotation period
+CREATE INDEX IF NOT EXISTS idx_kms_keys_rotation ON kms_keys(rotated_at) WHERE rotation_period_days > 0;
+
+-- Existing values referenced nothing and are left as they are; new ones
+-- must name a key, and are cleared when it is deleted
+ALTER TABLE resources ADD CONSTRAINT fk_resources_encryption_key
+    FOREIGN KEY (encryption_key_id) REFERENCES kms_keys(id) ON DELETE SET NULL NOT VALID;
+
+CREATE POLICY tenant_isolation ON kms_keys
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE kms_keys ENABLE ROW LEVEL SECURITY;
+ALTER TABLE kms_keys FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation ON kms_key_versions
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE kms_key_versions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE kms_key_versions FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation ON kms_key_grants
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE kms_key_grants ENABLE ROW LEVEL SECURITY;
+ALTER TABLE kms_key_grants FORCE ROW LEVEL SECURITY;
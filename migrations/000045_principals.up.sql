@@ -0,0 +1,21 @@
+-- Users, service accounts and groups as one relation, so a principal
+-- reference of any type resolves with one lookup instead of a join per
+-- type. security_invoker keeps the row level security of the underlying
+-- tables in force for whoever queries the view.
+CREATE OR REPLACE VIEW principals WITH (security_invoker = true) AS
+    SELECT id, 'user'::principal_type AS principal_type, organization_id,
+           username::text AS name,
+           COALESCE(NULLIF(display_name, ''), username)::text AS display_name,
+           email::text AS email, status::text AS status, created_at
+    FROM users
+    WHERE deleted_at IS NULL
+    UNION ALL
+    SELECT id, 'service_account'::principal_type, organization_id,
+           name::text, name::text, NULL::text, status::text, created_at
+    FROM service_accounts
+    WHERE deleted_at IS NULL
+    UNION ALL
+    SELECT id, 'group'::principal_type, organization_id,
+           name::text, name::text, NULL::text, status::text, created_at
+    FROM groups
+    WHERE status != 'deleted';
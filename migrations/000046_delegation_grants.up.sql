@@ -0,0 +1,24 @@
+-- A user's consent for a service account to act on their behalf, limited
+-- to the listed actions (see authz.DelegableActions). The service account
+-- mints short-lived tokens from an active grant; revoking the grant ends
+-- them. There is at most one active grant per user and service account.
+CREATE TABLE IF NOT EXISTS delegation_grants (
+    id                 UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id    UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id            UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    service_account_id UUID NOT NULL REFERENCES service_accounts(id) ON DELETE CASCADE,
+    actions            TEXT[] NOT NULL CHECK (cardinality(actions) > 0),
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at         TIMESTAMPTZ,
+    revoked_at         TIMESTAMPTZ,
+    last_used_at       TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_delegation_grants_active
+    ON delegation_grants(user_id, service_account_id) WHERE revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_delegation_grants_service_account ON delegation_grants(service_account_id);
+
+CREATE POLICY tenant_isolation ON delegation_grants
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE delegation_grants ENABLE ROW LEVEL SECURITY;
+ALTER TABLE delegation_grants FORCE ROW LEVEL SECURITY;
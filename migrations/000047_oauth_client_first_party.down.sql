@@ -0,0 +1,2 @@
+ALTER TABLE oauth_clients DROP CONSTRAINT IF EXISTS oauth_clients_first_party_trusted;
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS is_first_party;
@@ -0,0 +1,8 @@
+-- First-party clients are applications the organization builds itself. Like
+-- trusted clients they skip consent, and only root users may mark either;
+-- the organization's trusted_clients settings decide whether they may.
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS is_first_party BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- A first-party client is always trusted
+ALTER TABLE oauth_clients ADD CONSTRAINT oauth_clients_first_party_trusted
+    CHECK (NOT is_first_party OR is_trusted);
@@ -0,0 +1,5 @@
+-- Rotating a client secret may keep the replaced secret valid for a while,
+-- so that the client's deployments can be updated without downtime
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS previous_secret_hash VARCHAR(255);
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS previous_secret_expires_at TIMESTAMPTZ;
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS secret_rotated_at TIMESTAMPTZ;
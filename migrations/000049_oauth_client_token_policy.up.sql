@@ -0,0 +1,3 @@
+-- Per-client overrides of token lifetimes and scopes, capped by the
+-- organization's settings.client_token_limits
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS token_policy JSONB;
@@ -0,0 +1,20 @@
+-- Organization-specific versions of the verification, password reset,
+-- invitation and inactivity emails. Every save adds a version; the highest
+-- version of a kind is the one sent, and an organization without any
+-- version of a kind gets the built-in email.
+CREATE TABLE IF NOT EXISTS email_templates (
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    kind            VARCHAR(50) NOT NULL,
+    version         INTEGER NOT NULL CHECK (version > 0),
+    subject         TEXT NOT NULL,
+    html_body       TEXT NOT NULL,
+    text_body       TEXT NOT NULL DEFAULT '',
+    created_by      UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (organization_id, kind, version)
+);
+
+CREATE POLICY tenant_isolation ON email_templates
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE email_templates ENABLE ROW LEVEL SECURITY;
+ALTER TABLE email_templates FORCE ROW LEVEL SECURITY;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS claims_webhooks;
@@ -0,0 +1,23 @@
+-- An organization's external claims provider: an HTTPS endpoint called when
+-- tokens are issued, whose answer adds claims under the namespace. Disabling
+-- it stops the calls without losing the configuration.
+CREATE TABLE IF NOT EXISTS claims_webhooks (
+    organization_id UUID PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+    url             TEXT NOT NULL,
+    secret          TEXT NOT NULL,
+    namespace       VARCHAR(100) NOT NULL,
+    timeout_ms      INTEGER NOT NULL DEFAULT 1500,
+    cache_seconds   INTEGER NOT NULL DEFAULT 0,
+    fail_closed     BOOLEAN NOT NULL DEFAULT FALSE,
+    enabled         BOOLEAN NOT NULL DEFAULT TRUE,
+    last_error      TEXT,
+    last_failure_at TIMESTAMPTZ,
+    created_by      UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE POLICY tenant_isolation ON claims_webhooks
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE claims_webhooks ENABLE ROW LEVEL SECURITY;
+ALTER TABLE claims_webhooks FORCE ROW LEVEL SECURITY;
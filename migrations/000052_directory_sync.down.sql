@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS directory_sync_runs;
+DROP TABLE IF EXISTS directory_sync_links;
+DROP TABLE IF EXISTS directory_syncs;
@@ -0,0 +1,64 @@
+-- An organization's scheduled pull of users and groups from an external
+-- directory. source_type names the protocol; scim reads the /Users and
+-- /Groups of a SCIM 2.0 service, such as an HR system, with a bearer token.
+CREATE TABLE IF NOT EXISTS directory_syncs (
+    organization_id    UUID PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+    source_type        VARCHAR(20) NOT NULL CHECK (source_type IN ('scim')),
+    base_url           TEXT NOT NULL,
+    token              TEXT NOT NULL,
+    attribute_mapping  JSONB NOT NULL DEFAULT '{}',
+    sync_groups        BOOLEAN NOT NULL DEFAULT TRUE,
+    deactivate_missing BOOLEAN NOT NULL DEFAULT TRUE,
+    interval_minutes   INTEGER NOT NULL DEFAULT 360 CHECK (interval_minutes > 0),
+    enabled            BOOLEAN NOT NULL DEFAULT TRUE,
+    last_run_at        TIMESTAMPTZ,
+    created_by         UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at         TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- The users and groups a sync manages, by their ID in the directory. Only
+-- linked users are deactivated and only their memberships are reconciled;
+-- deactivated marks users the sync suspended, which it may reactivate.
+CREATE TABLE IF NOT EXISTS directory_sync_links (
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    kind            VARCHAR(10) NOT NULL CHECK (kind IN ('user', 'group')),
+    external_id     TEXT NOT NULL,
+    local_id        UUID NOT NULL,
+    deactivated     BOOLEAN NOT NULL DEFAULT FALSE,
+    synced_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (organization_id, kind, external_id),
+    UNIQUE (organization_id, kind, local_id)
+);
+
+-- One run of a sync, with the counts and changes it reported
+CREATE TABLE IF NOT EXISTS directory_sync_runs (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    trigger         VARCHAR(20) NOT NULL,
+    triggered_by    UUID REFERENCES users(id) ON DELETE SET NULL,
+    dry_run         BOOLEAN NOT NULL DEFAULT FALSE,
+    status          VARCHAR(20) NOT NULL DEFAULT 'running',
+    error           TEXT,
+    summary         JSONB NOT NULL DEFAULT '{}',
+    changes         JSONB NOT NULL DEFAULT '[]',
+    started_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at     TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_directory_sync_runs_org ON directory_sync_runs(organization_id, started_at DESC);
+
+CREATE POLICY tenant_isolation ON directory_syncs
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE directory_syncs ENABLE ROW LEVEL SECURITY;
+ALTER TABLE directory_syncs FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation ON directory_sync_links
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE directory_sync_links ENABLE ROW LEVEL SECURITY;
+ALTER TABLE directory_sync_links FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation ON directory_sync_runs
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE directory_sync_runs ENABLE ROW LEVEL SECURITY;
+ALTER TABLE directory_sync_runs FORCE ROW LEVEL SECURITY;
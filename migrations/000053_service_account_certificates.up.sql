@@ -0,0 +1,24 @@
+-- Client certificates a service account authenticates with over mutual TLS,
+-- pinned by the SHA-256 fingerprint of the DER certificate. The certificate
+-- is not verified against a CA; subject and not_after are kept from it for
+-- display and expiry.
+CREATE TABLE IF NOT EXISTS service_account_certificates (
+    id                 UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id    UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    service_account_id UUID NOT NULL REFERENCES service_accounts(id) ON DELETE CASCADE,
+    name               VARCHAR(255) NOT NULL DEFAULT '',
+    fingerprint        CHAR(64) NOT NULL UNIQUE,
+    subject            TEXT NOT NULL DEFAULT '',
+    not_before         TIMESTAMPTZ NOT NULL,
+    not_after          TIMESTAMPTZ NOT NULL,
+    last_used_at       TIMESTAMPTZ,
+    created_by         UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_service_account_certificates_sa ON service_account_certificates(service_account_id);
+
+CREATE POLICY tenant_isolation ON service_account_certificates
+    USING (app_tenant_visible(organization_id)) WITH CHECK (app_tenant_writable(organization_id));
+ALTER TABLE service_account_certificates ENABLE ROW LEVEL SECURITY;
+ALTER TABLE service_account_certificates FORCE ROW LEVEL SECURITY;
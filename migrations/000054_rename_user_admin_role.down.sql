@@ -0,0 +1,25 @@
+UPDATE organizations o
+SET settings = jsonb_set(o.settings, '{separation_of_duties,rules}', (
+        SELECT COALESCE(jsonb_agg(
+            CASE WHEN jsonb_typeof(rule->'roles') = 'array' THEN jsonb_set(rule, '{roles}', (
+                SELECT COALESCE(jsonb_agg(
+                    CASE WHEN lower(role #>> '{}') = 'user-admin' THEN to_jsonb('user-manager'::text) ELSE role END
+                ), '[]'::jsonb)
+                FROM jsonb_array_elements(rule->'roles') role
+            )) ELSE rule END
+        ), '[]'::jsonb)
+        FROM jsonb_array_elements(o.settings->'separation_of_duties'->'rules') rule
+    ))
+WHERE jsonb_typeof(o.settings->'separation_of_duties'->'rules') = 'array'
+  AND EXISTS (SELECT 1 FROM roles r WHERE r.organization_id = o.id AND r.name = 'user-admin' AND r.is_system_role)
+  AND NOT EXISTS (SELECT 1 FROM roles r WHERE r.organization_id = o.id AND r.name = 'user-manager');
+
+UPDATE roles r
+SET name = 'user-manager', updated_at = NOW()
+WHERE r.name = 'user-admin' AND r.is_system_role
+  AND NOT EXISTS (SELECT 1 FROM roles o WHERE o.organization_id = r.organization_id AND o.name = 'user-manager');
+
+UPDATE policies p
+SET name = 'UserManagerAccess', updated_at = NOW()
+WHERE p.name = 'UserAdminAccess' AND p.is_system_policy
+  AND NOT EXISTS (SELECT 1 FROM policies o WHERE o.organization_id = p.organization_id AND o.name = 'UserManagerAccess');
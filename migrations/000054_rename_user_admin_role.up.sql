@@ -0,0 +1,29 @@
+-- The delegated user administration role is named user-admin, like
+-- policy-admin and billing-admin, and its managed policy UserAdminAccess.
+-- Organizations that created a custom role or policy under the new name keep
+-- theirs, and their system role keeps the old name.
+UPDATE organizations o
+SET settings = jsonb_set(o.settings, '{separation_of_duties,rules}', (
+        SELECT COALESCE(jsonb_agg(
+            CASE WHEN jsonb_typeof(rule->'roles') = 'array' THEN jsonb_set(rule, '{roles}', (
+                SELECT COALESCE(jsonb_agg(
+                    CASE WHEN lower(role #>> '{}') = 'user-manager' THEN to_jsonb('user-admin'::text) ELSE role END
+                ), '[]'::jsonb)
+                FROM jsonb_array_elements(rule->'roles') role
+            )) ELSE rule END
+        ), '[]'::jsonb)
+        FROM jsonb_array_elements(o.settings->'separation_of_duties'->'rules') rule
+    ))
+WHERE jsonb_typeof(o.settings->'separation_of_duties'->'rules') = 'array'
+  AND EXISTS (SELECT 1 FROM roles r WHERE r.organization_id = o.id AND r.name = 'user-manager' AND r.is_system_role)
+  AND NOT EXISTS (SELECT 1 FROM roles r WHERE r.organization_id = o.id AND r.name = 'user-admin');
+
+UPDATE roles r
+SET name = 'user-admin', updated_at = NOW()
+WHERE r.name = 'user-manager' AND r.is_system_role
+  AND NOT EXISTS (SELECT 1 FROM roles o WHERE o.organization_id = r.organization_id AND o.name = 'user-admin');
+
+UPDATE policies p
+SET name = 'UserAdminAccess', updated_at = NOW()
+WHERE p.name = 'UserManagerAccess' AND p.is_system_policy
+  AND NOT EXISTS (SELECT 1 FROM policies o WHERE o.organization_id = p.organization_id AND o.name = 'UserAdminAccess');
@@ -0,0 +1,3 @@
+ALTER TABLE oidc_codes
+    DROP COLUMN IF EXISTS code_challenge_method,
+    DROP COLUMN IF EXISTS code_challenge;
@@ -0,0 +1,5 @@
+-- Authorization codes remember the PKCE challenge of the request they answer
+-- (RFC 7636); the token endpoint only redeems them with its verifier
+ALTER TABLE oidc_codes
+    ADD COLUMN IF NOT EXISTS code_challenge VARCHAR(128),
+    ADD COLUMN IF NOT EXISTS code_challenge_method VARCHAR(10);
@@ -0,0 +1,288 @@
+// Package authfiber lets other Monkeys services built on Fiber accept
+// Monkeys Identity access tokens.
+//
+// RequireAuth verifies the RS256 signature against the IAM JWKS (fetched
+// once and cached), checks expiry, issuer, token type and audience, and
+// stores the claims in the request context under the same keys the IAM
+// server uses (user_id, organization_id, email, role). RequirePermission asks
+// the IAM /authz/check endpoint whether the caller may perform an action and
+// caches decisions briefly.
+//
+//	iam := client.New(iamURL, client.WithAPIKey(os.Getenv("IAM_API_KEY")))
+//	auth, err := authfiber.New(authfiber.Config{BaseURL: iamURL, Audience: "https://blog.example.com", Client: iam})
+//	app.Put("/posts/:id", auth.RequireAuth(), auth.RequirePermission("blog:post:update", "arn:monkey:content:{organization_id}/post/{id}"), updatePost)
+//
+// Tokens are verified offline, so a token revoked at the IAM stays usable
+// here until it expires.
+package authfiber
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/the-monkeys/monkeys-identity/internal/apierror"
+	"github.com/the-monkeys/monkeys-identity/pkg/client"
+)
+
+// ClaimsKey is the fiber.Ctx Locals key holding the verified *Claims
+const ClaimsKey = "iam_claims"
+
+const (
+	defaultJWKSMaxAge  = time.Hour
+	defaultDecisionTTL = 30 * time.Second
+	defaultCacheSize   = 10000
+	fetchTimeout       = 10 * time.Second
+)
+
+// Config configures the middleware
+type Config struct {
+	// BaseURL is the IAM server URL, e.g. https://iam.example.com
+	BaseURL string
+	// JWKSURL overrides BaseURL + /.well-known/jwks.json
+	JWKSURL string
+	// Issuer is the expected iss claim (the IAM OIDC_ISSUER). Empty skips
+	// the check.
+	Issuer string
+	// Audience identifies this service: its OAuth client ID or registered
+	// API audience. Tokens that carry an aud claim (OAuth client tokens and
+	// exchanged tokens) must list it; first-party login tokens have no aud
+	// and are always accepted. Empty rejects every token with an aud claim.
+	Audience string
+	// Client performs permission checks for RequirePermission. Authenticate
+	// it as a service account of the organization.
+	Client *client.Client
+	// JWKSMaxAge is how long fetched keys are trusted before refetching
+	// (default 1h). Unknown key IDs trigger an earlier refetch.
+	JWKSMaxAge time.Duration
+	// DecisionTTL is how long permission decisions are cached (default
+	// 30s). Negative disables caching.
+	DecisionTTL time.Duration
+	// HTTPClient fetches the JWKS (default: 10s timeout)
+	HTTPClient *http.Client
+}
+
+// Claims are the verified claims of an access token
+type Claims struct {
+	UserID         string `json:"user_id"`
+	OrganizationID string `json:"organization_id"`
+	Email          string `json:"email"`
+	Role           string `json:"role"`
+	Type           string `json:"type"`
+	// ClientID and Scope are set on tokens issued to OAuth clients
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// Act names the service acting for the user on exchanged tokens
+	Act map[string]interface{} `json:"act,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Scopes returns the OAuth scopes of a client token, nil for login tokens
+func (c *Claims) Scopes() []string {
+	if c.ClientID == "" {
+		return nil
+	}
+	return strings.Fields(c.Scope)
+}
+
+// Middleware validates IAM access tokens
+type Middleware struct {
+	cfg       Config
+	keys      *keySet
+	decisions *decisionCache
+}
+
+// New creates the middleware. No request is made until the first token
+// arrives, so services start even while the IAM server is down.
+func New(cfg Config) (*Middleware, error) {
+	base := strings.TrimSuffix(cfg.BaseURL, "/")
+	if cfg.JWKSURL == "" {
+		if base == "" {
+			return nil, errors.New("authfiber: BaseURL or JWKSURL is required")
+		}
+		cfg.JWKSURL = base + "/.well-known/jwks.json"
+	}
+	if cfg.JWKSMaxAge <= 0 {
+		cfg.JWKSMaxAge = defaultJWKSMaxAge
+	}
+	if cfg.DecisionTTL == 0 {
+		cfg.DecisionTTL = defaultDecisionTTL
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: fetchTimeout}
+	}
+
+	return &Middleware{
+		cfg:       cfg,
+		keys:      newKeySet(cfg.JWKSURL, cfg.HTTPClient, cfg.JWKSMaxAge),
+		decisions: newDecisionCache(cfg.DecisionTTL, defaultCacheSize),
+	}, nil
+}
+
+// GetClaims returns the claims stored by RequireAuth, or nil
+func GetClaims(c *fiber.Ctx) *Claims {
+	claims, _ := c.Locals(ClaimsKey).(*Claims)
+	return claims
+}
+
+// RequireAuth rejects requests without a valid IAM access token in the
+// Authorization header (or the access_token cookie)
+func (m *Middleware) RequireAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tokenString := ""
+		if parts := strings.SplitN(c.Get(fiber.HeaderAuthorization), " ", 2); len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") {
+			tokenString = strings.TrimSpace(parts[1])
+		}
+		if tokenString == "" {
+			tokenString = c.Cookies("access_token")
+		}
+		if tokenString == "" {
+			return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Authorization required")
+		}
+
+		claims, err := m.Verify(c.Context(), tokenString)
+		if err != nil {
+			if errors.Is(err, jwt.ErrTokenExpired) {
+				return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeTokenExpired, "Token has expired")
+			}
+			return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid or expired token")
+		}
+
+		c.Locals(ClaimsKey, claims)
+		c.Locals("user_id", claims.UserID)
+		c.Locals("organization_id", claims.OrganizationID)
+		c.Locals("email", claims.Email)
+		c.Locals("role", claims.Role)
+		if claims.ClientID != "" {
+			c.Locals("client_id", claims.ClientID)
+			c.Locals("token_scopes", claims.Scopes())
+		}
+		return c.Next()
+	}
+}
+
+// Verify checks an access token and returns its claims
+func (m *Middleware) Verify(ctx context.Context, tokenString string) (*Claims, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	}
+	if m.cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(m.cfg.Issuer))
+	}
+
+	claims := &Claims{}
+	if _, err := jwt.ParseWithClaims(tokenString, claims, m.keys.Keyfunc(ctx), opts...); err != nil {
+		return nil, err
+	}
+
+	// Refresh tokens and ID tokens are signed with the same keys
+	if claims.Type != "access" {
+		return nil, errors.New("not an access token")
+	}
+	if len(claims.Audience) > 0 || claims.Act != nil {
+		if m.cfg.Audience == "" || !containsString(claims.Audience, m.cfg.Audience) {
+			return nil, errors.New("token is not intended for this service")
+		}
+	}
+	if claims.UserID == "" {
+		claims.UserID = claims.Subject
+	}
+	if claims.UserID == "" {
+		return nil, errors.New("token has no subject")
+	}
+	return claims, nil
+}
+
+// RequirePermission allows the request only when the IAM grants the token's
+// user action on resource. {name} placeholders in resource are replaced by
+// route parameters, or by organization_id / user_id from the token:
+//
+//	auth.RequirePermission("blog:post:delete", "arn:monkey:content:{organization_id}/post/{id}")
+//
+// OAuth client tokens are further limited to their scopes. When the IAM
+// cannot be reached the request fails with 503.
+func (m *Middleware) RequirePermission(action, resource string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims := GetClaims(c)
+		if claims == nil {
+			return apierror.Respond(c, fiber.StatusUnauthorized, apierror.CodeUnauthorized, "Authorization required")
+		}
+		if m.cfg.Client == nil {
+			return apierror.Respond(c, fiber.StatusInternalServerError, apierror.CodeInternal, "Permission checks are not configured")
+		}
+
+		res := expandResource(c, claims, resource)
+		allowed, err := m.Allowed(c.Context(), claims, action, res)
+		if err != nil {
+			return apierror.Respond(c, fiber.StatusServiceUnavailable, apierror.CodeServiceUnavailable, "Authorization service unavailable")
+		}
+		if !allowed {
+			return apierror.Respond(c, fiber.StatusForbidden, apierror.CodeForbidden, "Access denied: insufficient permissions")
+		}
+		return c.Next()
+	}
+}
+
+// Allowed asks the IAM whether the token's user may perform action on
+// resource, answering from the decision cache when it can
+func (m *Middleware) Allowed(ctx context.Context, claims *Claims, action, resource string) (bool, error) {
+	scopes := claims.Scopes()
+	key := decisionKey(claims.UserID, claims.ClientID, claims.Scope, action, resource)
+	if allowed, ok := m.decisions.get(key); ok {
+		return allowed, nil
+	}
+
+	res, err := m.cfg.Client.Authz.Check(ctx, client.PermissionCheck{
+		PrincipalID:   claims.UserID,
+		PrincipalType: "user",
+		Action:        action,
+		Resource:      resource,
+		TokenScopes:   scopes,
+	})
+	if err != nil {
+		return false, err
+	}
+	m.decisions.put(key, res.Allowed)
+	return res.Allowed, nil
+}
+
+// expandResource fills {name} placeholders from route params and claims
+func expandResource(c *fiber.Ctx, claims *Claims, resource string) string {
+	if !strings.Contains(resource, "{") {
+		return resource
+	}
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(resource, '{')
+		end := strings.IndexByte(resource[start+1:], '}')
+		if start < 0 || end < 0 {
+			b.WriteString(resource)
+			return b.String()
+		}
+		name := resource[start+1 : start+1+end]
+		b.WriteString(resource[:start])
+		switch name {
+		case "organization_id":
+			b.WriteString(claims.OrganizationID)
+		case "user_id":
+			b.WriteString(claims.UserID)
+		default:
+			b.WriteString(c.Params(name))
+		}
+		resource = resource[start+end+2:]
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package authfiber
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/the-monkeys/monkeys-identity/pkg/client"
+)
+
+type fakeIAM struct {
+	key    *rsa.PrivateKey
+	checks int32
+	srv    *httptest.Server
+}
+
+func newFakeIAM(t *testing.T) *fakeIAM {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iam := &fakeIAM{key: key}
+	iam.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/jwks.json":
+			json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+				"kty": "RSA", "kid": "k1", "alg": "RS256",
+				"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}}})
+		case "/api/v1/authz/check":
+			atomic.AddInt32(&iam.checks, 1)
+			var req client.PermissionCheck
+			json.NewDecoder(r.Body).Decode(&req)
+			allowed := req.PrincipalID == "u1" && req.Resource == "arn:monkey:content:org1/post/42"
+			json.NewEncoder(w).Encode(map[string]interface{}{"allowed": allowed})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(iam.srv.Close)
+	return iam
+}
+
+func (f *fakeIAM) token(t *testing.T, claims jwt.MapClaims) string {
+	base := jwt.MapClaims{
+		"iss": "https://iam.test", "sub": "u1", "user_id": "u1", "organization_id": "org1",
+		"type": "access", "exp": time.Now().Add(time.Minute).Unix(),
+	}
+	for k, v := range claims {
+		if v == nil {
+			delete(base, k)
+			continue
+		}
+		base[k] = v
+	}
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, base)
+	tok.Header["kid"] = "k1"
+	signed, err := tok.SignedString(f.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestRequireAuth(t *testing.T) {
+	iam := newFakeIAM(t)
+	m, err := New(Config{BaseURL: iam.srv.URL, Issuer: "https://iam.test", Audience: "blog-api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Get("/me", m.RequireAuth(), func(c *fiber.Ctx) error {
+		return c.SendString(c.Locals("user_id").(string) + "@" + c.Locals("organization_id").(string))
+	})
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   int
+	}{
+		{"login token", nil, http.StatusOK},
+		{"audience matches", jwt.MapClaims{"aud": []string{"client-1", "blog-api"}, "client_id": "client-1"}, http.StatusOK},
+		{"other audience", jwt.MapClaims{"aud": "billing-api"}, http.StatusUnauthorized},
+		{"refresh token", jwt.MapClaims{"type": "refresh"}, http.StatusUnauthorized},
+		{"share link token", jwt.MapClaims{"type": "share_link", "aud": "urn:monkeys-identity:share_link"}, http.StatusUnauthorized},
+		{"wrong issuer", jwt.MapClaims{"iss": "https://evil.test"}, http.StatusUnauthorized},
+		{"expired", jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}, http.StatusUnauthorized},
+		{"no expiry", jwt.MapClaims{"exp": nil}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req.Header.Set("Authorization", "Bearer "+iam.token(t, tt.claims))
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	iam := newFakeIAM(t)
+	m, err := New(Config{BaseURL: iam.srv.URL, Client: client.New(iam.srv.URL, client.WithAPIKey("k.s"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Put("/posts/:id", m.RequireAuth(), m.RequirePermission("blog:post:update", "arn:monkey:content:{organization_id}/post/{id}"),
+		func(c *fiber.Ctx) error { return c.SendStatus(http.StatusNoContent) })
+
+	token := iam.token(t, nil)
+	for i, tc := range []struct {
+		path string
+		want int
+	}{
+		{"/posts/42", http.StatusNoContent},
+		{"/posts/42", http.StatusNoContent},
+		{"/posts/7", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodPut, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Errorf("request %d: status = %d, want %d", i, resp.StatusCode, tc.want)
+		}
+	}
+
+	// The repeated request is answered from the decision cache
+	if n := atomic.LoadInt32(&iam.checks); n != 2 {
+		t.Errorf("authz checks = %d, want 2", n)
+	}
+}
@@ -0,0 +1,64 @@
+package authfiber
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// decisionCache remembers recent permission decisions. When full, expired
+// entries are dropped first and then the whole cache is cleared, which is
+// cheap and keeps memory bounded without LRU bookkeeping.
+type decisionCache struct {
+	ttl time.Duration
+	max int
+
+	mu      sync.Mutex
+	entries map[string]decisionEntry
+}
+
+type decisionEntry struct {
+	allowed bool
+	expires time.Time
+}
+
+func newDecisionCache(ttl time.Duration, max int) *decisionCache {
+	return &decisionCache{ttl: ttl, max: max, entries: make(map[string]decisionEntry)}
+}
+
+func decisionKey(parts ...string) string {
+	return strings.Join(parts, "\x00")
+}
+
+func (d *decisionCache) get(key string) (bool, bool) {
+	if d.ttl <= 0 {
+		return false, false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, ok := d.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		return false, false
+	}
+	return e.allowed, true
+}
+
+func (d *decisionCache) put(key string, allowed bool) {
+	if d.ttl <= 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.entries) >= d.max {
+		now := time.Now()
+		for k, e := range d.entries {
+			if now.After(e.expires) {
+				delete(d.entries, k)
+			}
+		}
+		if len(d.entries) >= d.max {
+			d.entries = make(map[string]decisionEntry)
+		}
+	}
+	d.entries[key] = decisionEntry{allowed: allowed, expires: time.Now().Add(d.ttl)}
+}
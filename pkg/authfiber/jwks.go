@@ -0,0 +1,140 @@
+package authfiber
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minJWKSRefetch limits how often an unknown kid triggers a JWKS fetch, so
+// tokens with made-up key IDs cannot be used to hammer the IAM server
+const minJWKSRefetch = time.Minute
+
+var errUnknownKey = errors.New("unknown signing key")
+
+// keySet caches the IAM signing keys published at the JWKS endpoint. Keys
+// are refetched after maxAge, and early when a token names a key the cache
+// does not know (the IAM rotated its key).
+type keySet struct {
+	url    string
+	http   *http.Client
+	maxAge time.Duration
+
+	mu          sync.RWMutex
+	keys        map[string]*rsa.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+func newKeySet(url string, hc *http.Client, maxAge time.Duration) *keySet {
+	return &keySet{url: url, http: hc, maxAge: maxAge}
+}
+
+// Keyfunc resolves the verification key of a token for jwt.Parse
+func (s *keySet) Keyfunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("token has no kid header")
+		}
+		return s.key(ctx, kid)
+	}
+}
+
+func (s *keySet) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	s.mu.RLock()
+	key, ok := s.keys[kid]
+	fresh := time.Since(s.fetchedAt) < s.maxAge
+	recent := time.Since(s.attemptedAt) < minJWKSRefetch
+	s.mu.RUnlock()
+
+	if ok && fresh {
+		return key, nil
+	}
+	if !ok && recent {
+		return nil, errUnknownKey
+	}
+
+	if err := s.refresh(ctx); err != nil {
+		// Keep serving cached keys while the IAM server is unreachable
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	s.mu.RLock()
+	key, ok = s.keys[kid]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, errUnknownKey
+	}
+	return key, nil
+}
+
+func (s *keySet) refresh(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Another request fetched while this one waited for the lock
+	if time.Since(s.attemptedAt) < minJWKSRefetch {
+		return nil
+	}
+	s.attemptedAt = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	var doc struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Kty != "RSA" || k.Kid == "" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	s.keys = keys
+	s.fetchedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// AuthService signs users in and out
+type AuthService struct{ c *Client }
+
+// LoginResult is the outcome of Login or VerifyMFA. When MFARequired is set no
+// tokens were issued: complete the login with VerifyMFA and MFAToken.
+type LoginResult struct {
+	Tokens
+	User *User  `json:"user,omitempty"`
+	Role string `json:"role,omitempty"`
+
+	MFARequired bool     `json:"mfa_required,omitempty"`
+	MFAToken    string   `json:"mfa_token,omitempty"`
+	MFAMethods  []string `json:"mfa_methods,omitempty"`
+	CodeSentTo  string   `json:"code_sent_to,omitempty"`
+}
+
+// RegisterRequest creates a user account in an existing organization
+type RegisterRequest struct {
+	Username       string `json:"username"`
+	Email          string `json:"email"`
+	Password       string `json:"password"`
+	DisplayName    string `json:"display_name"`
+	OrganizationID string `json:"organization_id"`
+}
+
+// RegisterResult identifies the account created by Register
+type RegisterResult struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+// Login signs in with email and password. On success the client uses the
+// returned tokens for subsequent requests.
+func (s *AuthService) Login(ctx context.Context, email, password string) (*LoginResult, error) {
+	return s.login(ctx, "/auth/login", map[string]string{"email": email, "password": password})
+}
+
+// VerifyMFA completes a login that returned MFARequired. method is totp,
+// email, sms or backup; empty means the user's primary method.
+func (s *AuthService) VerifyMFA(ctx context.Context, mfaToken, code, method string) (*LoginResult, error) {
+	body := map[string]string{"mfa_token": mfaToken, "code": code}
+	if method != "" {
+		body["method"] = method
+	}
+	return s.login(ctx, "/auth/login/mfa-verify", body)
+}
+
+func (s *AuthService) login(ctx context.Context, path string, body interface{}) (*LoginResult, error) {
+	raw, err := s.c.send(ctx, &request{method: http.MethodPost, path: path, body: body, anonymous: true})
+	if err != nil {
+		return nil, err
+	}
+
+	// The MFA challenge is not enveloped in data; decodeData handles both
+	var resp struct {
+		tokenResponse
+		User        *User    `json:"user"`
+		Role        string   `json:"role"`
+		MFARequired bool     `json:"mfa_required"`
+		MFAToken    string   `json:"mfa_token"`
+		MFAMethods  []string `json:"mfa_methods"`
+		CodeSentTo  string   `json:"code_sent_to"`
+	}
+	if err := decodeData(raw, &resp); err != nil {
+		return nil, err
+	}
+	if resp.MFARequired {
+		return &LoginResult{MFARequired: true, MFAToken: resp.MFAToken, MFAMethods: resp.MFAMethods, CodeSentTo: resp.CodeSentTo}, nil
+	}
+
+	result := &LoginResult{
+		Tokens: Tokens{AccessToken: resp.AccessToken, RefreshToken: resp.RefreshToken, ExpiresAt: resp.expiresAt()},
+		User:   resp.User,
+		Role:   resp.Role,
+	}
+	s.c.SetTokens(result.Tokens)
+	if s.c.onRefresh != nil {
+		s.c.onRefresh(result.Tokens)
+	}
+	return result, nil
+}
+
+// Refresh renews the access token now. Requests refresh automatically, so
+// this is only needed to renew ahead of time.
+func (s *AuthService) Refresh(ctx context.Context) error {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	return s.c.refreshLocked(ctx)
+}
+
+// Logout ends the current session and forgets the client's tokens
+func (s *AuthService) Logout(ctx context.Context) error {
+	err := s.c.do(ctx, &request{method: http.MethodPost, path: "/auth/logout"}, nil)
+	s.c.SetTokens(Tokens{})
+	return err
+}
+
+// Register creates a user account. The user must verify their email before
+// signing in.
+func (s *AuthService) Register(ctx context.Context, req RegisterRequest) (*RegisterResult, error) {
+	var out RegisterResult
+	if err := s.c.do(ctx, &request{method: http.MethodPost, path: "/auth/register", body: req, anonymous: true}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
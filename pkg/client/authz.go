@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// AuthzService answers authorization questions
+type AuthzService struct{ c *Client }
+
+// Check evaluates a permission check. A deny is a successful result with
+// Allowed false, not an error.
+func (s *AuthzService) Check(ctx context.Context, check PermissionCheck) (*PermissionCheckResult, error) {
+	if check.PrincipalType == "" {
+		check.PrincipalType = "user"
+	}
+	var out PermissionCheckResult
+	if err := s.c.do(ctx, &request{method: http.MethodPost, path: "/authz/check", body: check, retry: true}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Allowed reports whether the user may perform action on resource
+func (s *AuthzService) Allowed(ctx context.Context, userID, action, resource string) (bool, error) {
+	res, err := s.Check(ctx, PermissionCheck{PrincipalID: userID, PrincipalType: "user", Action: action, Resource: resource})
+	if err != nil {
+		return false, err
+	}
+	return res.Allowed, nil
+}
+
+// BulkCheck evaluates several checks in one request. Results are in the
+// order of checks.
+func (s *AuthzService) BulkCheck(ctx context.Context, checks []PermissionCheck) ([]PermissionCheckResult, error) {
+	requests := make([]PermissionCheck, len(checks))
+	for i, check := range checks {
+		if check.PrincipalType == "" {
+			check.PrincipalType = "user"
+		}
+		requests[i] = check
+	}
+	body := map[string]interface{}{"requests": requests}
+	var out []PermissionCheckResult
+	if err := s.c.do(ctx, &request{method: http.MethodPost, path: "/authz/bulk-check", body: body, retry: true}, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EffectivePermissions lists what a principal may do. principalType is user,
+// group or role.
+func (s *AuthzService) EffectivePermissions(ctx context.Context, principalID, principalType string) (*EffectivePermissions, error) {
+	q := url.Values{"principal_id": {principalID}}
+	if principalType != "" {
+		q.Set("principal_type", principalType)
+	}
+	var out EffectivePermissions
+	if err := s.c.do(ctx, &request{method: http.MethodGet, path: "/authz/effective-permissions", query: q}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,477 @@
+// Package client is a Go SDK for the Monkeys Identity API.
+//
+// A Client authenticates with either a user's tokens (from Auth.Login or
+// WithTokens) or a service account API key (WithAPIKey). With user tokens the
+// access token is refreshed automatically shortly before it expires and once
+// more when the server answers 401. Idempotent requests are retried with
+// exponential backoff on network errors, 429 and 5xx responses.
+//
+//	c := client.New("https://iam.example.com", client.WithAPIKey(os.Getenv("MONKEYS_API_KEY")))
+//	ok, err := c.Authz.Allowed(ctx, userID, "blog:post:update", "arn:monkey:content:org/post/42")
+//
+// Every method takes a context that bounds the whole call, retries included.
+// Errors returned by the server are *APIError values.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	apiPrefix = "/api/v1"
+
+	defaultTimeout    = 30 * time.Second
+	defaultMaxRetries = 3
+	defaultRetryWait  = 200 * time.Millisecond
+	maxRetryWait      = 5 * time.Second
+
+	// refreshSkew renews the access token this long before it expires
+	refreshSkew = 30 * time.Second
+
+	userAgent = "monkeys-identity-go"
+)
+
+// Tokens are the credentials of a signed-in user
+type Tokens struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// Client talks to a Monkeys Identity server. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	http       *http.Client
+	userAgent  string
+	apiKey     string
+	maxRetries int
+	retryWait  time.Duration
+	onRefresh  func(Tokens)
+
+	mu     sync.Mutex
+	tokens Tokens
+
+	Auth          *AuthService
+	Users         *UserService
+	Organizations *OrganizationService
+	Roles         *RoleService
+	Policies      *PolicyService
+	Authz         *AuthzService
+	Content       *ContentService
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient replaces the default HTTP client (30s timeout)
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithAPIKey authenticates every request with a service account API key
+// (key_id.secret). API keys do not expire, so no refresh takes place.
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithTokens starts the client with tokens obtained earlier, e.g. restored
+// from a session store. expiresAt may be zero when unknown.
+func WithTokens(accessToken, refreshToken string, expiresAt time.Time) Option {
+	return func(c *Client) {
+		c.tokens = Tokens{AccessToken: accessToken, RefreshToken: refreshToken, ExpiresAt: expiresAt}
+	}
+}
+
+// WithRetries sets how many times an idempotent request is retried and the
+// initial backoff, which doubles after each attempt. Zero disables retries.
+func WithRetries(max int, wait time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = max
+		c.retryWait = wait
+	}
+}
+
+// WithUserAgent prefixes the User-Agent header, e.g. "blog-service/1.4"
+func WithUserAgent(ua string) Option {
+	return func(c *Client) { c.userAgent = ua + " " + userAgent }
+}
+
+// OnTokenRefresh registers a callback invoked with the new tokens after every
+// login and refresh, so callers can persist them
+func OnTokenRefresh(fn func(Tokens)) Option {
+	return func(c *Client) { c.onRefresh = fn }
+}
+
+// New creates a client for the server at baseURL (scheme and host, without
+// the /api/v1 prefix)
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), apiPrefix),
+		http:       &http.Client{Timeout: defaultTimeout},
+		userAgent:  userAgent,
+		maxRetries: defaultMaxRetries,
+		retryWait:  defaultRetryWait,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.Auth = &AuthService{c}
+	c.Users = &UserService{c}
+	c.Organizations = &OrganizationService{c}
+	c.Roles = &RoleService{c}
+	c.Policies = &PolicyService{c}
+	c.Authz = &AuthzService{c}
+	c.Content = &ContentService{c}
+	return c
+}
+
+// Tokens returns the current user tokens
+func (c *Client) Tokens() Tokens {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens
+}
+
+// SetTokens replaces the user tokens
+func (c *Client) SetTokens(t Tokens) {
+	c.mu.Lock()
+	c.tokens = t
+	c.mu.Unlock()
+}
+
+// APIError is an error response from the server. Code is the stable,
+// machine-readable error code (see GET /api/v1/public/error-codes).
+type APIError struct {
+	StatusCode int             `json:"-"`
+	Code       string          `json:"code"`
+	Message    string          `json:"message"`
+	Details    json.RawMessage `json:"details,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("monkeys-identity: %d %s", e.StatusCode, e.Code)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.RequestID != "" {
+		msg += " (request " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// IsNotFound reports whether err is a 404 from the server
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsUnauthorized reports whether err is a 401 from the server
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsForbidden reports whether err is a 403 from the server
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden)
+}
+
+func hasStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+// request describes one API call
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   interface{}
+	// anonymous requests carry no credentials and are never refreshed
+	anonymous bool
+	// retry marks non-idempotent methods that are nevertheless safe to
+	// repeat, such as permission checks
+	retry bool
+}
+
+func (r *request) retryable() bool {
+	switch r.method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return r.retry
+}
+
+// do sends r and decodes the response into out. Enveloped responses
+// ({"success": true, "data": ...}) are unwrapped; bare ones are decoded as is.
+func (c *Client) do(ctx context.Context, r *request, out interface{}) error {
+	raw, err := c.send(ctx, r)
+	if err != nil {
+		return err
+	}
+	return decodeData(raw, out)
+}
+
+// send performs r with proactive and on-401 token refresh and retries, and
+// returns the body of a successful response
+func (c *Client) send(ctx context.Context, r *request) ([]byte, error) {
+	var payload []byte
+	if r.body != nil {
+		var err error
+		if payload, err = json.Marshal(r.body); err != nil {
+			return nil, fmt.Errorf("monkeys-identity: encode request: %w", err)
+		}
+	}
+
+	if !r.anonymous && c.apiKey == "" {
+		if err := c.refreshIfExpiring(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		status, header, body, usedToken, err := c.attempt(ctx, r, payload)
+
+		if err == nil && status == http.StatusUnauthorized && !refreshed && !r.anonymous && c.canRefresh() {
+			refreshed = true
+			if rerr := c.refreshAfter(ctx, usedToken); rerr == nil {
+				attempt--
+				continue
+			}
+		}
+
+		if attempt < c.maxRetries && r.retryable() && shouldRetry(status, err) {
+			if werr := c.wait(ctx, attempt, header); werr != nil {
+				return nil, werr
+			}
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		if status >= 400 {
+			return nil, parseAPIError(status, body)
+		}
+		return body, nil
+	}
+}
+
+// attempt sends a single HTTP request
+func (c *Client) attempt(ctx context.Context, r *request, payload []byte) (int, http.Header, []byte, string, error) {
+	endpoint := c.baseURL + apiPrefix + r.path
+	if len(r.query) > 0 {
+		endpoint += "?" + r.query.Encode()
+	}
+
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, endpoint, body)
+	if err != nil {
+		return 0, nil, nil, "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	var token string
+	if !r.anonymous {
+		if c.apiKey != "" {
+			req.Header.Set("X-API-Key", c.apiKey)
+		} else if token = c.Tokens().AccessToken; token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, nil, nil, token, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, token, err
+	}
+	return resp.StatusCode, resp.Header, data, token, nil
+}
+
+func shouldRetry(status int, err error) bool {
+	if err != nil {
+		// The caller's context is done; trying again cannot help
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return status == http.StatusInternalServerError
+}
+
+// wait sleeps before the next attempt, honouring Retry-After
+func (c *Client) wait(ctx context.Context, attempt int, header http.Header) error {
+	d := c.retryWait << attempt
+	if d > maxRetryWait || d <= 0 {
+		d = maxRetryWait
+	}
+	// Full jitter keeps a fleet of clients from retrying in lockstep
+	d = time.Duration(rand.Int63n(int64(d) + 1))
+	if header != nil {
+		if secs, err := strconv.Atoi(header.Get("Retry-After")); err == nil && secs >= 0 {
+			d = time.Duration(secs) * time.Second
+		}
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func parseAPIError(status int, body []byte) error {
+	apiErr := &APIError{StatusCode: status}
+	var envelope struct {
+		APIError
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &envelope); err == nil {
+		*apiErr = envelope.APIError
+		apiErr.StatusCode = status
+		// OAuth endpoints answer {"error": ..., "error_description": ...}
+		if apiErr.Code == "" {
+			apiErr.Code = envelope.Error
+		}
+		if apiErr.Message == "" {
+			apiErr.Message = envelope.ErrorDescription
+		}
+	}
+	if apiErr.Code == "" {
+		apiErr.Code = strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	}
+	if apiErr.Message == "" && len(body) > 0 && len(body) <= 512 {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+	return apiErr
+}
+
+func decodeData(body []byte, out interface{}) error {
+	if out == nil || len(body) == 0 {
+		return nil
+	}
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &envelope); err == nil && len(envelope.Data) > 0 {
+		body = envelope.Data
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("monkeys-identity: decode response: %w", err)
+	}
+	return nil
+}
+
+// canRefresh reports whether user tokens with a refresh token are in use
+func (c *Client) canRefresh() bool {
+	return c.apiKey == "" && c.Tokens().RefreshToken != ""
+}
+
+// refreshIfExpiring renews the access token when it is about to expire
+func (c *Client) refreshIfExpiring(ctx context.Context) error {
+	t := c.Tokens()
+	if t.RefreshToken == "" || t.ExpiresAt.IsZero() || time.Until(t.ExpiresAt) > refreshSkew {
+		return nil
+	}
+	return c.refreshAfter(ctx, t.AccessToken)
+}
+
+// refreshAfter renews the access token unless another goroutine already
+// replaced usedToken while this one waited for the lock
+func (c *Client) refreshAfter(ctx context.Context, usedToken string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tokens.AccessToken != usedToken && c.tokens.AccessToken != "" {
+		return nil
+	}
+	return c.refreshLocked(ctx)
+}
+
+// refreshLocked exchanges the refresh token for a new access token. The
+// caller holds c.mu.
+func (c *Client) refreshLocked(ctx context.Context) error {
+	if c.tokens.RefreshToken == "" {
+		return errors.New("monkeys-identity: no refresh token")
+	}
+
+	raw, err := c.send(ctx, &request{
+		method:    http.MethodPost,
+		path:      "/auth/refresh",
+		body:      map[string]string{"refresh_token": c.tokens.RefreshToken},
+		anonymous: true,
+		retry:     true,
+	})
+	if err != nil {
+		return err
+	}
+	var resp tokenResponse
+	if err := decodeData(raw, &resp); err != nil {
+		return err
+	}
+
+	// Only the access token is renewed; the refresh token keeps its expiry
+	c.tokens.AccessToken = resp.AccessToken
+	c.tokens.ExpiresAt = resp.expiresAt()
+	if resp.RefreshToken != "" {
+		c.tokens.RefreshToken = resp.RefreshToken
+	}
+	if c.onRefresh != nil {
+		c.onRefresh(c.tokens)
+	}
+	return nil
+}
+
+// tokenResponse is the token part of login and refresh responses
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	TokenType    string `json:"token_type"`
+}
+
+func (t tokenResponse) expiresAt() time.Time {
+	if t.ExpiresIn <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+}
+
+// pathEscape escapes each caller-supplied path segment
+func pathEscape(segments ...string) string {
+	var b strings.Builder
+	for _, s := range segments {
+		b.WriteByte('/')
+		b.WriteString(url.PathEscape(s))
+	}
+	return b.String()
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRefreshOnUnauthorized(t *testing.T) {
+	var refreshes int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/auth/refresh":
+			atomic.AddInt32(&refreshes, 1)
+			var body struct {
+				RefreshToken string `json:"refresh_token"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.RefreshToken != "refresh-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"success":true,"data":{"access_token":"access-2","expires_in":900,"token_type":"Bearer"}}`))
+		case "/api/v1/users/me":
+			if r.Header.Get("Authorization") != "Bearer access-2" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"success":false,"code":"token_expired","message":"Token expired"}`))
+				return
+			}
+			w.Write([]byte(`{"success":true,"data":{"id":"u1","email":"a@example.com"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	var persisted Tokens
+	c := New(srv.URL, WithTokens("access-1", "refresh-1", time.Time{}), OnTokenRefresh(func(t Tokens) { persisted = t }))
+
+	user, err := c.Users.Me(context.Background())
+	if err != nil {
+		t.Fatalf("Me: %v", err)
+	}
+	if user.ID != "u1" {
+		t.Errorf("user ID = %q, want u1", user.ID)
+	}
+	if n := atomic.LoadInt32(&refreshes); n != 1 {
+		t.Errorf("refreshes = %d, want 1", n)
+	}
+	if got := c.Tokens(); got.AccessToken != "access-2" || got.RefreshToken != "refresh-1" || got.ExpiresAt.IsZero() {
+		t.Errorf("tokens after refresh = %+v", got)
+	}
+	if persisted.AccessToken != "access-2" {
+		t.Errorf("OnTokenRefresh got %q, want access-2", persisted.AccessToken)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"allowed":true,"decision":"allow"}`))
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, WithAPIKey("key.secret"), WithRetries(3, time.Millisecond))
+
+	allowed, err := c.Authz.Allowed(context.Background(), "u1", "blog:post:read", "arn:monkey:content:org/post/1")
+	if err != nil {
+		t.Fatalf("Allowed: %v", err)
+	}
+	if !allowed {
+		t.Error("Allowed = false, want true")
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("calls = %d, want 3", n)
+	}
+
+	// Creating content is not idempotent and must not be repeated
+	atomic.StoreInt32(&calls, 0)
+	_, err = c.Content.Create(context.Background(), CreateContentRequest{Title: "Hello"})
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("POST calls = %d, want 1", n)
+	}
+	if err == nil {
+		t.Fatal("expected an error for a 503 response")
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "key.secret" {
+			t.Errorf("X-API-Key = %q", r.Header.Get("X-API-Key"))
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"success":false,"code":"not_found","error":"not_found","message":"Role not found","request_id":"req-1"}`))
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL+"/api/v1/", WithAPIKey("key.secret"))
+
+	_, err := c.Roles.Get(context.Background(), "missing")
+	if !IsNotFound(err) {
+		t.Fatalf("err = %v, want a 404 APIError", err)
+	}
+	apiErr := err.(*APIError)
+	if apiErr.Code != "not_found" || apiErr.Message != "Role not found" || apiErr.RequestID != "req-1" {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+}
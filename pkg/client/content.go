@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// ContentService manages content items (blogs, videos, tweets, comments, ...)
+// and their collaborators
+type ContentService struct{ c *Client }
+
+// CreateContentRequest creates a content item owned by the caller
+type CreateContentRequest struct {
+	ContentType   string  `json:"content_type"` // blog, video, tweet, comment, article or post
+	Title         string  `json:"title"`
+	Body          string  `json:"body,omitempty"`
+	Summary       string  `json:"summary,omitempty"`
+	CoverImageURL string  `json:"cover_image_url,omitempty"`
+	ParentID      *string `json:"parent_id,omitempty"`
+	Tags          string  `json:"tags,omitempty"`     // JSON array
+	Metadata      string  `json:"metadata,omitempty"` // JSON object
+}
+
+// UpdateContentRequest changes a content item; nil fields are left as is
+type UpdateContentRequest struct {
+	Title         *string `json:"title,omitempty"`
+	Body          *string `json:"body,omitempty"`
+	Summary       *string `json:"summary,omitempty"`
+	CoverImageURL *string `json:"cover_image_url,omitempty"`
+	Tags          *string `json:"tags,omitempty"`
+	Metadata      *string `json:"metadata,omitempty"`
+}
+
+// ContentListOptions filters List
+type ContentListOptions struct {
+	ListOptions
+	ContentType string
+}
+
+// List returns content the caller owns or collaborates on
+func (s *ContentService) List(ctx context.Context, opts *ContentListOptions) (*List[ContentItem], error) {
+	var o ContentListOptions
+	if opts != nil {
+		o = *opts
+	}
+	q := o.ListOptions.values("sort_by")
+	if o.ContentType != "" {
+		q.Set("content_type", o.ContentType)
+	}
+	var out List[ContentItem]
+	if err := s.c.do(ctx, &request{method: http.MethodGet, path: "/content", query: q}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Get returns a content item and the caller's role on it (owner or co-author)
+func (s *ContentService) Get(ctx context.Context, id string) (*ContentItem, string, error) {
+	var out struct {
+		Content ContentItem `json:"content"`
+		Role    string      `json:"role"`
+	}
+	if err := s.c.do(ctx, &request{method: http.MethodGet, path: "/content" + pathEscape(id)}, &out); err != nil {
+		return nil, "", err
+	}
+	return &out.Content, out.Role, nil
+}
+
+// Create creates a content item as a draft
+func (s *ContentService) Create(ctx context.Context, req CreateContentRequest) (*ContentItem, error) {
+	var out ContentItem
+	if err := s.c.do(ctx, &request{method: http.MethodPost, path: "/content", body: req}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Update changes a content item. Requires owner or co-author.
+func (s *ContentService) Update(ctx context.Context, id string, req UpdateContentRequest) (*ContentItem, error) {
+	var out ContentItem
+	if err := s.c.do(ctx, &request{method: http.MethodPut, path: "/content" + pathEscape(id), body: req}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Delete deletes a content item. Requires owner.
+func (s *ContentService) Delete(ctx context.Context, id string) error {
+	return s.c.do(ctx, &request{method: http.MethodDelete, path: "/content" + pathEscape(id)}, nil)
+}
+
+// SetStatus moves a content item to draft, published, archived, private or
+// hidden. Requires owner.
+func (s *ContentService) SetStatus(ctx context.Context, id, status string) error {
+	body := map[string]string{"status": status}
+	return s.c.do(ctx, &request{method: http.MethodPatch, path: "/content" + pathEscape(id, "status"), body: body}, nil)
+}
+
+// ListCollaborators returns the users with access to a content item
+func (s *ContentService) ListCollaborators(ctx context.Context, id string) ([]ContentCollaborator, error) {
+	var out []ContentCollaborator
+	if err := s.c.do(ctx, &request{method: http.MethodGet, path: "/content" + pathEscape(id, "collaborators")}, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// InviteCollaborator makes a user co-author of a content item. Requires owner.
+func (s *ContentService) InviteCollaborator(ctx context.Context, id, userID string) error {
+	body := map[string]string{"user_id": userID}
+	return s.c.do(ctx, &request{method: http.MethodPost, path: "/content" + pathEscape(id, "collaborators"), body: body}, nil)
+}
+
+// RemoveCollaborator revokes a co-author's access. Requires owner.
+func (s *ContentService) RemoveCollaborator(ctx context.Context, id, userID string) error {
+	return s.c.do(ctx, &request{method: http.MethodDelete, path: "/content" + pathEscape(id, "collaborators", userID)}, nil)
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// OrganizationService reads and administers organizations
+type OrganizationService struct{ c *Client }
+
+// List returns the organizations visible to the caller: all of them for the
+// root user, the caller's own for an organization admin
+func (s *OrganizationService) List(ctx context.Context, opts *ListOptions) (*List[Organization], error) {
+	var out List[Organization]
+	if err := s.c.do(ctx, &request{method: http.MethodGet, path: "/organizations", query: opts.values("sort")}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Get returns an organization by ID
+func (s *OrganizationService) Get(ctx context.Context, id string) (*Organization, error) {
+	var out Organization
+	if err := s.c.do(ctx, &request{method: http.MethodGet, path: "/organizations" + pathEscape(id)}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Update replaces an organization's editable fields. Requires organization
+// admin.
+func (s *OrganizationService) Update(ctx context.Context, org *Organization) (*Organization, error) {
+	var out Organization
+	if err := s.c.do(ctx, &request{method: http.MethodPut, path: "/organizations" + pathEscape(org.ID), body: org}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Delete deletes an organization. Requires organization admin and a recent
+// MFA verification.
+func (s *OrganizationService) Delete(ctx context.Context, id string) error {
+	return s.c.do(ctx, &request{method: http.MethodDelete, path: "/organizations" + pathEscape(id)}, nil)
+}
+
+// ListRoles returns every role of an organization
+func (s *OrganizationService) ListRoles(ctx context.Context, id string) ([]Role, error) {
+	var out struct {
+		Roles []Role `json:"roles"`
+	}
+	if err := s.c.do(ctx, &request{method: http.MethodGet, path: "/organizations" + pathEscape(id, "roles")}, &out); err != nil {
+		return nil, err
+	}
+	return out.Roles, nil
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// PolicyService manages the organization's policies
+type PolicyService struct{ c *Client }
+
+// List returns a page of policies
+func (s *PolicyService) List(ctx context.Context, opts *ListOptions) (*List[Policy], error) {
+	var out List[Policy]
+	if err := s.c.do(ctx, &request{method: http.MethodGet, path: "/policies", query: opts.values("sort_by")}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Get returns a policy by ID
+func (s *PolicyService) Get(ctx context.Context, id string) (*Policy, error) {
+	var out Policy
+	if err := s.c.do(ctx, &request{method: http.MethodGet, path: "/policies" + pathEscape(id)}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Create creates a policy; Document holds the policy JSON. Requires the
+// admin role and a recent MFA verification.
+func (s *PolicyService) Create(ctx context.Context, policy *Policy) (*Policy, error) {
+	var out Policy
+	if err := s.c.do(ctx, &request{method: http.MethodPost, path: "/policies", body: policy}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Update replaces a policy, recording a new version. Requires the admin role
+// and a recent MFA verification.
+func (s *PolicyService) Update(ctx context.Context, policy *Policy) (*Policy, error) {
+	var out Policy
+	if err := s.c.do(ctx, &request{method: http.MethodPut, path: "/policies" + pathEscape(policy.ID), body: policy}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Delete deletes a policy. Requires the admin role and a recent MFA
+// verification.
+func (s *PolicyService) Delete(ctx context.Context, id string) error {
+	return s.c.do(ctx, &request{method: http.MethodDelete, path: "/policies" + pathEscape(id)}, nil)
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// RoleService manages roles, their policies and their assignments
+type RoleService struct{ c *Client }
+
+// AssignRoleRequest assigns a role to a user or service account
+type AssignRoleRequest struct {
+	PrincipalID   string `json:"principal_id"`
+	PrincipalType string `json:"principal_type"` // user or service_account
+	// ExpiresAt ends the assignment automatically; nil keeps it until removed
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Conditions is a JSON document evaluated with the role's policies
+	Conditions string `json:"conditions,omitempty"`
+}
+
+// List returns a page of the organization's roles
+func (s *RoleService) List(ctx context.Context, opts *ListOptions) (*List[Role], error) {
+	var out List[Role]
+	if err := s.c.do(ctx, &request{method: http.MethodGet, path: "/roles", query: opts.values("sort")}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Get returns a role by ID
+func (s *RoleService) Get(ctx context.Context, id string) (*Role, error) {
+	var out Role
+	if err := s.c.do(ctx, &request{method: http.MethodGet, path: "/roles" + pathEscape(id)}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Create creates a role. Requires the admin role.
+func (s *RoleService) Create(ctx context.Context, role *Role) (*Role, error) {
+	var out Role
+	if err := s.c.do(ctx, &request{method: http.MethodPost, path: "/roles", body: role}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Update changes a role. Requires the admin role.
+func (s *RoleService) Update(ctx context.Context, role *Role) (*Role, error) {
+	var out Role
+	if err := s.c.do(ctx, &request{method: http.MethodPut, path: "/roles" + pathEscape(role.ID), body: role}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Delete deletes a role. Requires the admin role.
+func (s *RoleService) Delete(ctx context.Context, id string) error {
+	return s.c.do(ctx, &request{method: http.MethodDelete, path: "/roles" + pathEscape(id)}, nil)
+}
+
+// Assign assigns the role to a principal. Requires the admin role.
+func (s *RoleService) Assign(ctx context.Context, roleID string, req AssignRoleRequest) error {
+	body := map[string]string{
+		"principal_id":   req.PrincipalID,
+		"principal_type": req.PrincipalType,
+		"conditions":     req.Conditions,
+	}
+	if req.ExpiresAt != nil {
+		body["expires_at"] = req.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	return s.c.do(ctx, &request{method: http.MethodPost, path: "/roles" + pathEscape(roleID, "assign"), body: body}, nil)
+}
+
+// Unassign removes the role from a principal. Requires the admin role.
+func (s *RoleService) Unassign(ctx context.Context, roleID, principalID string) error {
+	return s.c.do(ctx, &request{method: http.MethodDelete, path: "/roles" + pathEscape(roleID, "assign", principalID)}, nil)
+}
+
+// ListAssignments returns who holds the role
+func (s *RoleService) ListAssignments(ctx context.Context, roleID string) ([]RoleAssignment, error) {
+	var out struct {
+		Assignments []RoleAssignment `json:"assignments"`
+	}
+	if err := s.c.do(ctx, &request{method: http.MethodGet, path: "/roles" + pathEscape(roleID, "assignments")}, &out); err != nil {
+		return nil, err
+	}
+	return out.Assignments, nil
+}
+
+// AttachPolicy attaches a policy to the role. Requires the admin role.
+func (s *RoleService) AttachPolicy(ctx context.Context, roleID, policyID string) error {
+	body := map[string]string{"policy_id": policyID}
+	return s.c.do(ctx, &request{method: http.MethodPost, path: "/roles" + pathEscape(roleID, "policies"), body: body}, nil)
+}
+
+// DetachPolicy detaches a policy from the role. Requires the admin role.
+func (s *RoleService) DetachPolicy(ctx context.Context, roleID, policyID string) error {
+	return s.c.do(ctx, &request{method: http.MethodDelete, path: "/roles" + pathEscape(roleID, "policies", policyID)}, nil)
+}
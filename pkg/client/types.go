@@ -0,0 +1,113 @@
+package client
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/the-monkeys/monkeys-identity/internal/models"
+)
+
+// Resource types shared with the server
+type (
+	User                = models.User
+	Organization        = models.Organization
+	Role                = models.Role
+	RoleAssignment      = models.RoleAssignment
+	Policy              = models.Policy
+	ContentItem         = models.ContentItem
+	ContentCollaborator = models.ContentCollaboratorWithUser
+)
+
+// ListOptions pages through list endpoints. Set Cursor to the NextCursor of
+// the previous page for stable keyset pagination; otherwise Offset is used.
+type ListOptions struct {
+	Limit  int
+	Offset int
+	Cursor string
+	Sort   string
+	Order  string
+}
+
+func (o *ListOptions) values(sortParam string) url.Values {
+	v := url.Values{}
+	if o == nil {
+		return v
+	}
+	if o.Limit > 0 {
+		v.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset > 0 {
+		v.Set("offset", strconv.Itoa(o.Offset))
+	}
+	if o.Cursor != "" {
+		v.Set("cursor", o.Cursor)
+	}
+	if o.Sort != "" {
+		v.Set(sortParam, o.Sort)
+	}
+	if o.Order != "" {
+		v.Set("order", o.Order)
+	}
+	return v
+}
+
+// List is one page of a list endpoint
+type List[T any] struct {
+	Items      []T    `json:"items"`
+	Total      int64  `json:"total"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	HasMore    bool   `json:"has_more"`
+	TotalPages int    `json:"total_pages"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// PermissionCheck asks whether a principal may perform an action on a resource
+type PermissionCheck struct {
+	PrincipalID   string             `json:"principal_id"`
+	PrincipalType string             `json:"principal_type,omitempty"`
+	Resource      string             `json:"resource"`
+	Action        string             `json:"action"`
+	Context       *PermissionContext `json:"context,omitempty"`
+	// TokenScopes restricts the decision to what an OAuth client token with
+	// these scopes may do
+	TokenScopes []string `json:"token_scopes,omitempty"`
+}
+
+// PermissionContext carries request attributes for policy conditions
+type PermissionContext struct {
+	Principal   string            `json:"principal,omitempty"`
+	Resource    string            `json:"resource,omitempty"`
+	Action      string            `json:"action,omitempty"`
+	Environment map[string]string `json:"environment,omitempty"`
+	RequestTime *time.Time        `json:"request_time,omitempty"`
+	SourceIP    string            `json:"source_ip,omitempty"`
+	UserAgent   string            `json:"user_agent,omitempty"`
+	SessionID   string            `json:"session_id,omitempty"`
+}
+
+// PermissionCheckResult is the decision for a PermissionCheck
+type PermissionCheckResult struct {
+	Allowed  bool             `json:"allowed"`
+	Decision string           `json:"decision"`
+	Policies []string         `json:"policies"`
+	Request  *PermissionCheck `json:"request"`
+}
+
+// EffectivePermissions lists what a principal may do
+type EffectivePermissions struct {
+	PrincipalID   string                `json:"principal_id"`
+	PrincipalType string                `json:"principal_type"`
+	Permissions   []EffectivePermission `json:"permissions"`
+	GeneratedAt   time.Time             `json:"generated_at"`
+}
+
+// EffectivePermission is one grant or denial and where it comes from
+type EffectivePermission struct {
+	Resource   string   `json:"resource"`
+	Actions    []string `json:"actions"`
+	Effect     string   `json:"effect"`
+	Source     string   `json:"source"`
+	Conditions []string `json:"conditions,omitempty"`
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// UserService manages the users of the caller's organization
+type UserService struct{ c *Client }
+
+// UserListOptions filters List. Users are paged by Page (1-based) or Cursor;
+// ListOptions.Offset is ignored.
+type UserListOptions struct {
+	ListOptions
+	Page           int
+	Query          string
+	Status         string
+	Role           string
+	MFAEnabled     *bool
+	OrganizationID string
+}
+
+// CreateUserRequest creates a user in the caller's organization
+type CreateUserRequest struct {
+	Username    string `json:"username"`
+	Email       string `json:"email"`
+	DisplayName string `json:"display_name"`
+	Password    string `json:"password"`
+}
+
+// UpdateUserRequest changes a user's account fields; empty fields are left as is
+type UpdateUserRequest struct {
+	Username    string `json:"username,omitempty"`
+	Email       string `json:"email,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	Status      string `json:"status,omitempty"`
+}
+
+// List returns a page of users
+func (s *UserService) List(ctx context.Context, opts *UserListOptions) (*List[User], error) {
+	var o UserListOptions
+	if opts != nil {
+		o = *opts
+	}
+	q := o.ListOptions.values("sort")
+	q.Del("offset")
+	if o.Page > 0 {
+		q.Set("page", strconv.Itoa(o.Page))
+	}
+	for k, v := range map[string]string{"q": o.Query, "status": o.Status, "role": o.Role, "organization_id": o.OrganizationID} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	if o.MFAEnabled != nil {
+		q.Set("mfa_enabled", strconv.FormatBool(*o.MFAEnabled))
+	}
+
+	raw, err := s.c.send(ctx, &request{method: http.MethodGet, path: "/users", query: q})
+	if err != nil {
+		return nil, err
+	}
+	// Unlike the other list endpoints, users come with a separate meta block
+	var resp struct {
+		Data []User `json:"data"`
+		Meta struct {
+			Page       int    `json:"page"`
+			Limit      int    `json:"limit"`
+			Total      int64  `json:"total"`
+			TotalPages int    `json:"totalPages"`
+			HasMore    bool   `json:"hasMore"`
+			NextCursor string `json:"nextCursor"`
+		} `json:"meta"`
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, fmt.Errorf("monkeys-identity: decode response: %w", err)
+	}
+	list := &List[User]{
+		Items:      resp.Data,
+		Total:      resp.Meta.Total,
+		Limit:      resp.Meta.Limit,
+		HasMore:    resp.Meta.HasMore,
+		TotalPages: resp.Meta.TotalPages,
+		NextCursor: resp.Meta.NextCursor,
+	}
+	if resp.Meta.Page > 1 {
+		list.Offset = (resp.Meta.Page - 1) * resp.Meta.Limit
+	}
+	return list, nil
+}
+
+// Get returns a user by ID
+func (s *UserService) Get(ctx context.Context, id string) (*User, error) {
+	var out User
+	if err := s.c.do(ctx, &request{method: http.MethodGet, path: "/users" + pathEscape(id)}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Me returns the signed-in user
+func (s *UserService) Me(ctx context.Context) (*User, error) {
+	var out User
+	if err := s.c.do(ctx, &request{method: http.MethodGet, path: "/users/me"}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Create creates a user. Requires the admin role.
+func (s *UserService) Create(ctx context.Context, req CreateUserRequest) (*User, error) {
+	var out User
+	if err := s.c.do(ctx, &request{method: http.MethodPost, path: "/users", body: req}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Update changes a user's account fields
+func (s *UserService) Update(ctx context.Context, id string, req UpdateUserRequest) (*User, error) {
+	var out User
+	if err := s.c.do(ctx, &request{method: http.MethodPut, path: "/users" + pathEscape(id), body: req}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Delete soft-deletes a user. Requires the admin role.
+func (s *UserService) Delete(ctx context.Context, id string) error {
+	return s.c.do(ctx, &request{method: http.MethodDelete, path: "/users" + pathEscape(id)}, nil)
+}
+
+// Suspend blocks a user from signing in. Requires the admin role.
+func (s *UserService) Suspend(ctx context.Context, id, reason string) error {
+	body := map[string]string{"reason": reason}
+	return s.c.do(ctx, &request{method: http.MethodPost, path: "/users" + pathEscape(id, "suspend"), body: body}, nil)
+}
+
+// Activate lifts a suspension. Requires the admin role.
+func (s *UserService) Activate(ctx context.Context, id, reason string) error {
+	body := map[string]string{"reason": reason}
+	return s.c.do(ctx, &request{method: http.MethodPost, path: "/users" + pathEscape(id, "activate"), body: body}, nil)
+}
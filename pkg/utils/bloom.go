@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// bloomMagic starts a serialized BloomFilter, followed by the number of hash
+// functions (uint32), the number of bits (uint64), both big-endian, and the
+// bits
+const bloomMagic = "MIBLOOM1"
+
+// BloomFilter is a set that answers membership with no false negatives and
+// a configurable rate of false positives
+type BloomFilter struct {
+	k    uint32
+	m    uint64
+	bits []byte
+}
+
+// NewBloomFilter sizes a filter for n elements at the false positive rate p
+func NewBloomFilter(n uint64, p float64) *BloomFilter {
+	if n == 0 {
+		n = 1
+	}
+	if p <= 0 || p >= 1 {
+		p = 0.001
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	if m < 8 {
+		m = 8
+	}
+	k := uint32(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &BloomFilter{k: k, m: m, bits: make([]byte, (m+7)/8)}
+}
+
+// positions derives the k bit positions of a key by double hashing
+func (f *BloomFilter) positions(key []byte, fn func(pos uint64) bool) bool {
+	sum := sha256.Sum256(key)
+	h1 := binary.BigEndian.Uint64(sum[0:8])
+	h2 := binary.BigEndian.Uint64(sum[8:16]) | 1
+	for i := uint64(0); i < uint64(f.k); i++ {
+		if !fn((h1 + i*h2) % f.m) {
+			return false
+		}
+	}
+	return true
+}
+
+// Add inserts a key
+func (f *BloomFilter) Add(key []byte) {
+	f.positions(key, func(pos uint64) bool {
+		f.bits[pos/8] |= 1 << (pos % 8)
+		return true
+	})
+}
+
+// Contains reports whether the key may have been added. False means it
+// certainly was not.
+func (f *BloomFilter) Contains(key []byte) bool {
+	return f.positions(key, func(pos uint64) bool {
+		return f.bits[pos/8]&(1<<(pos%8)) != 0
+	})
+}
+
+// WriteTo serializes the filter
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	header := make([]byte, len(bloomMagic)+12)
+	copy(header, bloomMagic)
+	binary.BigEndian.PutUint32(header[len(bloomMagic):], f.k)
+	binary.BigEndian.PutUint64(header[len(bloomMagic)+4:], f.m)
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := w.Write(f.bits)
+	return int64(n + m), err
+}
+
+// ReadBloomFilter reads a filter serialized by WriteTo
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(bloomMagic)+12)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("failed to read bloom filter header: %w", err)
+	}
+	if string(header[:len(bloomMagic)]) != bloomMagic {
+		return nil, errors.New("not a bloom filter file")
+	}
+	f := &BloomFilter{
+		k: binary.BigEndian.Uint32(header[len(bloomMagic):]),
+		m: binary.BigEndian.Uint64(header[len(bloomMagic)+4:]),
+	}
+	if f.k == 0 || f.k > 64 || f.m == 0 {
+		return nil, errors.New("invalid bloom filter parameters")
+	}
+	f.bits = make([]byte, (f.m+7)/8)
+	if _, err := io.ReadFull(br, f.bits); err != nil {
+		return nil, fmt.Errorf("failed to read bloom filter bits: %w", err)
+	}
+	return f, nil
+}
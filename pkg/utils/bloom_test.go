@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	f := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(fmt.Sprintf("added-%d", i)))
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	read, err := ReadBloomFilter(&buf)
+	if err != nil {
+		t.Fatalf("ReadBloomFilter: %v", err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if !read.Contains([]byte(fmt.Sprintf("added-%d", i))) {
+			t.Fatalf("added-%d is missing", i)
+		}
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if read.Contains([]byte(fmt.Sprintf("absent-%d", i))) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 300 {
+		t.Errorf("%d false positives in 10000, want about 100", falsePositives)
+	}
+}
+
+func TestReadBloomFilterRejectsOtherFiles(t *testing.T) {
+	for _, data := range []string{"", "MIBLOOM1", "NOTBLOOM\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00\x08\xff"} {
+		if _, err := ReadBloomFilter(bytes.NewBufferString(data)); err == nil {
+			t.Errorf("ReadBloomFilter(%q) succeeded", data)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package utils
+
+import "strings"
+
+// Diff operations
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// DiffChunk is a run of consecutive lines with the same operation
+type DiffChunk struct {
+	Op    string   `json:"op"`
+	Lines []string `json:"lines"`
+}
+
+// maxDiffEdits bounds the time and memory of DiffLines (quadratic in the
+// number of edits); texts differing in more lines are reported as deleted
+// and re-inserted as a whole
+const maxDiffEdits = 1000
+
+// DiffLines returns a line diff turning a into b, computed with Myers'
+// algorithm so that it is minimal
+func DiffLines(a, b string) []DiffChunk {
+	x, y := splitLines(a), splitLines(b)
+
+	// Common prefix and suffix are cheap to strip and common in edits
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	var chunks []DiffChunk
+	add := func(op string, lines ...string) {
+		if len(lines) == 0 {
+			return
+		}
+		if n := len(chunks); n > 0 && chunks[n-1].Op == op {
+			chunks[n-1].Lines = append(chunks[n-1].Lines, lines...)
+			return
+		}
+		chunks = append(chunks, DiffChunk{Op: op, Lines: append([]string(nil), lines...)})
+	}
+
+	add(DiffEqual, x[:prefix]...)
+	mx, my := x[prefix:len(x)-suffix], y[prefix:len(y)-suffix]
+	if ops, ok := myers(mx, my); ok {
+		i, j := 0, 0
+		for _, op := range ops {
+			switch op {
+			case DiffEqual:
+				add(DiffEqual, mx[i])
+				i++
+				j++
+			case DiffDelete:
+				add(DiffDelete, mx[i])
+				i++
+			case DiffInsert:
+				add(DiffInsert, my[j])
+				j++
+			}
+		}
+	} else {
+		add(DiffDelete, mx...)
+		add(DiffInsert, my...)
+	}
+	add(DiffEqual, x[len(x)-suffix:]...)
+	return chunks
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// myers returns the edit script from x to y, one operation per line, or
+// false when it needs more than maxDiffEdits edits
+func myers(x, y []string) ([]string, bool) {
+	n, m := len(x), len(y)
+	limit := n + m
+	if limit > maxDiffEdits {
+		limit = maxDiffEdits
+	}
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+
+	for d := 0; d <= limit; d++ {
+		// Round d only reads diagonals -d+1..d-1 of the previous round
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var i int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				i = v[offset+k+1]
+			} else {
+				i = v[offset+k-1] + 1
+			}
+			j := i - k
+			for i < n && j < m && x[i] == y[j] {
+				i++
+				j++
+			}
+			v[offset+k] = i
+			if i >= n && j >= m {
+				return backtrack(trace, n, m, d), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// backtrack walks the saved frontiers back from (n, m) to recover the path
+func backtrack(trace [][]int, n, m, d int) []string {
+	ops := make([]string, 0, n+m)
+	i, j := n, m
+	for ; d > 0; d-- {
+		v := trace[d] // diagonal k is at v[k+d]
+		k := i - j
+		var prevK int
+		if k == -d || (k != d && v[k-1+d] < v[k+1+d]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevI := v[prevK+d]
+		prevJ := prevI - prevK
+		for i > prevI && j > prevJ {
+			ops = append(ops, DiffEqual)
+			i--
+			j--
+		}
+		if i == prevI {
+			ops = append(ops, DiffInsert)
+		} else {
+			ops = append(ops, DiffDelete)
+		}
+		i, j = prevI, prevJ
+	}
+	for i > 0 && j > 0 {
+		ops = append(ops, DiffEqual)
+		i--
+		j--
+	}
+	for l, r := 0, len(ops)-1; l < r; l, r = l+1, r-1 {
+		ops[l], ops[r] = ops[r], ops[l]
+	}
+	return ops
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []DiffChunk
+	}{
+		{"identical", "a\nb", "a\nb", []DiffChunk{{DiffEqual, []string{"a", "b"}}}},
+		{"both empty", "", "", nil},
+		{"from empty", "", "a", []DiffChunk{{DiffInsert, []string{"a"}}}},
+		{"to empty", "a\nb", "", []DiffChunk{{DiffDelete, []string{"a", "b"}}}},
+		{
+			"replaced line", "a\nb\nc", "a\nx\nc",
+			[]DiffChunk{{DiffEqual, []string{"a"}}, {DiffDelete, []string{"b"}}, {DiffInsert, []string{"x"}}, {DiffEqual, []string{"c"}}},
+		},
+		{
+			"interleaved", "a\nb\nc\nd", "b\nx\nd\ne",
+			[]DiffChunk{{DiffDelete, []string{"a"}}, {DiffEqual, []string{"b"}}, {DiffDelete, []string{"c"}}, {DiffInsert, []string{"x"}}, {DiffEqual, []string{"d"}}, {DiffInsert, []string{"e"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiffLines(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffLines() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// applying the chunks must reproduce both sides
+func TestDiffLinesRoundTrip(t *testing.T) {
+	a := strings.Repeat("same\nold\n", 50) + "tail"
+	b := "head\n" + strings.Repeat("same\nnew\n", 50) + "tail"
+	var from, to []string
+	for _, c := range DiffLines(a, b) {
+		if c.Op != DiffInsert {
+			from = append(from, c.Lines...)
+		}
+		if c.Op != DiffDelete {
+			to = append(to, c.Lines...)
+		}
+	}
+	if strings.Join(from, "\n") != a || strings.Join(to, "\n") != b {
+		t.Error("chunks do not reproduce the inputs")
+	}
+}
+
+func TestDiffLinesTooManyEdits(t *testing.T) {
+	var a, b []string
+	for i := 0; i < maxDiffEdits; i++ {
+		a = append(a, "a")
+		b = append(b, "b")
+	}
+	got := DiffLines(strings.Join(a, "\n"), strings.Join(b, "\n"))
+	if len(got) != 2 || got[0].Op != DiffDelete || got[1].Op != DiffInsert {
+		t.Errorf("got %d chunks, want a whole delete and insert", len(got))
+	}
+}
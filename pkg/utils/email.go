@@ -0,0 +1,26 @@
+package utils
+
+import "strings"
+
+// CanonicalEmail reduces an email address to the mailbox it delivers to, so
+// addresses that differ only in case, a "+tag" suffix or, for Gmail, dots in
+// the local part compare equal. It is meant for spotting duplicate accounts,
+// not for sending mail.
+func CanonicalEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+	if plus := strings.Index(local, "+"); plus > 0 {
+		local = local[:plus]
+	}
+	if domain == "googlemail.com" {
+		domain = "gmail.com"
+	}
+	if domain == "gmail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + domain
+}
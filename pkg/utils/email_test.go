@@ -0,0 +1,24 @@
+package utils
+
+import "testing"
+
+func TestCanonicalEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  string
+	}{
+		{"Alice@Example.com", "alice@example.com"},
+		{"  alice@example.com ", "alice@example.com"},
+		{"alice+news@example.com", "alice@example.com"},
+		{"a.lice@example.com", "a.lice@example.com"},
+		{"A.Lice+x@gmail.com", "alice@gmail.com"},
+		{"a.lice@googlemail.com", "alice@gmail.com"},
+		{"+tag@example.com", "+tag@example.com"},
+		{"not-an-email", "not-an-email"},
+	}
+	for _, tt := range tests {
+		if got := CanonicalEmail(tt.email); got != tt.want {
+			t.Errorf("CanonicalEmail(%q) = %q, want %q", tt.email, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MergePatch applies an RFC 7396 JSON merge patch to the target document and
+// returns the resulting document. An empty target is treated as "{}".
+func MergePatch(target, patch []byte) ([]byte, error) {
+	var patchDoc interface{}
+	if err := json.Unmarshal(patch, &patchDoc); err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+
+	var targetDoc interface{} = map[string]interface{}{}
+	if len(target) > 0 {
+		if err := json.Unmarshal(target, &targetDoc); err != nil {
+			return nil, fmt.Errorf("invalid target document: %w", err)
+		}
+	}
+
+	return json.Marshal(mergePatchValue(targetDoc, patchDoc))
+}
+
+func mergePatchValue(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+			continue
+		}
+		targetObj[key] = mergePatchValue(targetObj[key], value)
+	}
+	return targetObj
+}
+
+// NormalizeJSONObject validates that s is a JSON object and returns it
+// unchanged. An empty string is normalized to "{}".
+func NormalizeJSONObject(s string) (string, error) {
+	if s == "" {
+		return "{}", nil
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &obj); err != nil {
+		return "", fmt.Errorf("value must be a JSON object: %w", err)
+	}
+	if obj == nil {
+		return "{}", nil
+	}
+	return s, nil
+}
+
+// ErrJSONTooComplex is returned for documents nested deeper, or with longer
+// arrays, than allowed
+var ErrJSONTooComplex = errors.New("JSON document is nested too deeply or has too many array elements")
+
+// CheckJSONLimits scans data without decoding it and fails with
+// ErrJSONTooComplex when objects and arrays nest more than maxDepth levels
+// or an array has more than maxArrayLen elements. Syntax errors are left for
+// the decoder to report.
+func CheckJSONLimits(data []byte, maxDepth, maxArrayLen int) error {
+	// Separators seen in each open container; -1 marks an object
+	var stack []int
+	inString, escaped := false, false
+	for _, b := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case b == '\\':
+				escaped = true
+			case b == '"':
+				inString = false
+			}
+			continue
+		}
+		switch b {
+		case '"':
+			inString = true
+		case '{':
+			if len(stack) >= maxDepth {
+				return ErrJSONTooComplex
+			}
+			stack = append(stack, -1)
+		case '[':
+			if len(stack) >= maxDepth {
+				return ErrJSONTooComplex
+			}
+			stack = append(stack, 0)
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case ',':
+			// n commas separate n+1 elements
+			if top := len(stack) - 1; top >= 0 && stack[top] >= 0 {
+				stack[top]++
+				if stack[top] >= maxArrayLen {
+					return ErrJSONTooComplex
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// LimitedJSONDecoder returns an unmarshal function, for fiber.Config's
+// JSONDecoder, that applies CheckJSONLimits before decoding
+func LimitedJSONDecoder(maxDepth, maxArrayLen int) func([]byte, interface{}) error {
+	return func(data []byte, v interface{}) error {
+		if err := CheckJSONLimits(data, maxDepth, maxArrayLen); err != nil {
+			return err
+		}
+		return json.Unmarshal(data, v)
+	}
+}
+
+// CanonicalJSON encodes v with object keys sorted at every level, no
+// insignificant whitespace and numbers kept as written, so that equal
+// documents encode to the same bytes whatever order their keys were in
+func CanonicalJSON(v interface{}) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	// Maps are encoded with sorted keys
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// ContentHash returns "sha256:" and the hex SHA-256 of the canonical JSON
+// of v, for telling whether two documents differ
+func ContentHash(v interface{}) (string, error) {
+	canonical, err := CanonicalJSON(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// ChangedFields returns, sorted, the top-level fields of the JSON objects
+// before and after whose canonical values differ, including fields only
+// one of them has. A nil before is an empty object.
+func ChangedFields(before, after interface{}) ([]string, error) {
+	fields := func(v interface{}) (map[string]json.RawMessage, error) {
+		obj := map[string]json.RawMessage{}
+		if v == nil {
+			return obj, nil
+		}
+		canonical, err := CanonicalJSON(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(canonical, &obj); err != nil {
+			return nil, fmt.Errorf("not a JSON object: %w", err)
+		}
+		return obj, nil
+	}
+	a, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	b, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := []string{}
+	for k, v := range b {
+		if old, ok := a[k]; !ok || !bytes.Equal(old, v) {
+			changed = append(changed, k)
+		}
+	}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// RedactedValue replaces the secrets masked by RedactSecrets
+const RedactedValue = "[REDACTED]"
+
+// secretKeySuffixes are the endings of the object keys whose values
+// RedactSecrets masks, matched case-insensitively
+var secretKeySuffixes = []string{"password", "secret", "token", "_hash", "private_key", "api_key", "access_key", "client_key", "credentials"}
+
+// IsSecretKey reports whether an object key names a secret: a password,
+// secret, token, key or hash of one
+func IsSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, suffix := range secretKeySuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactSecrets returns the JSON encoding of v with the scalar values of
+// secret keys, at any depth, replaced by RedactedValue. Objects under such
+// keys (a "password" policy) are redacted in turn rather than masked, and
+// null and empty values are kept, so that whether a secret is set still
+// shows.
+func RedactSecrets(v interface{}) (json.RawMessage, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(redactValue(doc))
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			switch value.(type) {
+			case map[string]interface{}, []interface{}:
+				v[key] = redactValue(value)
+			case nil:
+			default:
+				if IsSecretKey(key) && value != "" {
+					v[key] = RedactedValue
+				}
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+	}
+	return v
+}
@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	// Cases taken from RFC 7396, Appendix A
+	tests := []struct {
+		name   string
+		target string
+		patch  string
+		want   string
+	}{
+		{"replace value", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"add value", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{"remove value", `{"a":"b"}`, `{"a":null}`, `{}`},
+		{"remove one of many", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{"replace array", `{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"replace with array", `{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{"nested merge", `{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{"arrays are not merged", `{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{"non-object patch replaces", `["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{"object replaces array", `["a","b"]`, `{"a":"b"}`, `{"a":"b"}`},
+		{"null in new nested object", `{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{"empty target", ``, `{"a":1}`, `{"a":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.target), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var gotDoc, wantDoc interface{}
+			if err := json.Unmarshal(got, &gotDoc); err != nil {
+				t.Fatalf("result is not valid JSON: %v", err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &wantDoc); err != nil {
+				t.Fatalf("invalid expectation: %v", err)
+			}
+			if !reflect.DeepEqual(gotDoc, wantDoc) {
+				t.Errorf("MergePatch() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergePatchInvalidPatch(t *testing.T) {
+	if _, err := MergePatch([]byte(`{}`), []byte(`{`)); err == nil {
+		t.Error("expected error for malformed patch")
+	}
+}
+
+func TestCheckJSONLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		ok   bool
+	}{
+		{"flat object", `{"a":1,"b":[1,2,3]}`, true},
+		{"at depth limit", `{"a":{"b":[1]}}`, true},
+		{"too deep", `{"a":{"b":{"c":[1]}}}`, false},
+		{"brackets in strings", `{"a":"[[[[{{{{\"]]]"}`, true},
+		{"array at length limit", `[1,2,3,4]`, true},
+		{"array too long", `[1,2,3,4,5]`, false},
+		{"object keys are not counted", `{"a":1,"b":2,"c":3,"d":4,"e":5}`, true},
+		{"commas in nested objects", `[{"a":1,"b":2,"c":3,"d":4,"e":5}]`, true},
+		{"escaped backslash ends string", `{"a":"\\","b":[[[[1]]]]}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckJSONLimits([]byte(tt.doc), 3, 4)
+			if (err == nil) != tt.ok {
+				t.Errorf("CheckJSONLimits(%s) = %v, want ok %v", tt.doc, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestLimitedJSONDecoder(t *testing.T) {
+	decode := LimitedJSONDecoder(2, 10)
+	var v map[string]interface{}
+	if err := decode([]byte(`{"a":{"b":1}}`), &v); err != nil || v["a"] == nil {
+		t.Fatalf("decode = %v, %v", v, err)
+	}
+	if err := decode([]byte(`{"a":{"b":[1]}}`), &v); err != ErrJSONTooComplex {
+		t.Errorf("decode of too deep document = %v, want ErrJSONTooComplex", err)
+	}
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		want string
+	}{
+		{"sorted keys", json.RawMessage(`{"b": 1, "a": {"d": [3, 1], "c": null}}`), `{"a":{"c":null,"d":[3,1]},"b":1}`},
+		{"numbers as written", json.RawMessage(`{"big": 12345678901234567890, "f": 1.50}`), `{"big":12345678901234567890,"f":1.50}`},
+		{"no html escaping", map[string]string{"uri": "https://a.example/?x=1&y=<2>"}, `{"uri":"https://a.example/?x=1&y=<2>"}`},
+		{"struct", struct {
+			Z string `json:"z"`
+			A bool   `json:"a"`
+		}{"z", true}, `{"a":true,"z":"z"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CanonicalJSON(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("CanonicalJSON = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	a, err := ContentHash(json.RawMessage(`{"name": "x", "tags": {"b": 2, "a": 1}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ContentHash(json.RawMessage(`{"tags":{"a":1,"b":2},"name":"x"}`))
+	if a != b {
+		t.Errorf("hashes of reordered documents differ: %s != %s", a, b)
+	}
+	c, _ := ContentHash(json.RawMessage(`{"tags":{"a":1,"b":3},"name":"x"}`))
+	if a == c {
+		t.Error("hashes of different documents are equal")
+	}
+	if len(a) != len("sha256:")+64 || a[:7] != "sha256:" {
+		t.Errorf("hash = %q, want sha256:<hex>", a)
+	}
+}
+
+func TestChangedFields(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after interface{}
+		want          []string
+	}{
+		{"equal", json.RawMessage(`{"a": 1, "b": {"x": 1, "y": 2}}`), json.RawMessage(`{"b": {"y": 2, "x": 1}, "a": 1}`), []string{}},
+		{"changed and nested", json.RawMessage(`{"a": 1, "b": {"x": 1}}`), json.RawMessage(`{"a": 2, "b": {"x": 2}}`), []string{"a", "b"}},
+		{"added and removed", json.RawMessage(`{"a": 1, "gone": true}`), json.RawMessage(`{"a": 1, "new": null}`), []string{"gone", "new"}},
+		{"created", nil, map[string]int{"b": 1, "a": 2}, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ChangedFields(tt.before, tt.after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") || got == nil {
+				t.Errorf("ChangedFields = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ChangedFields(nil, []int{1}); err == nil {
+		t.Error("ChangedFields of an array succeeded")
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	got, err := RedactSecrets(json.RawMessage(`{
+		"name": "app",
+		"client_secret": "s3cret",
+		"webhooks": [{"url": "https://example.com", "Signing_Secret": "abc", "token": ""}],
+		"password": {"min_length": 12},
+		"password_hash": "$2a$10$x",
+		"token_lifetimes": {"access_token_ttl": "15m"},
+		"api_key": null
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"api_key":null,"client_secret":"[REDACTED]","name":"app","password":{"min_length":12},` +
+		`"password_hash":"[REDACTED]","token_lifetimes":{"access_token_ttl":"15m"},` +
+		`"webhooks":[{"Signing_Secret":"[REDACTED]","token":"","url":"https://example.com"}]}`
+	if string(got) != want {
+		t.Errorf("RedactSecrets =\n%s\nwant\n%s", got, want)
+	}
+
+	if got, err := RedactSecrets(nil); err != nil || string(got) != "null" {
+		t.Errorf("RedactSecrets(nil) = %s, %v", got, err)
+	}
+}
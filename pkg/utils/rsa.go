@@ -36,3 +36,34 @@ func LoadRSAPrivateKey(pemStr string) (*rsa.PrivateKey, error) {
 
 	return rsaPriv, nil
 }
+
+// LoadRSAPublicKey loads an RSA public key from a PEM string. A private key
+// PEM is accepted as well, in which case its public half is returned.
+func LoadRSAPublicKey(pemStr string) (*rsa.PublicKey, error) {
+	if priv, err := LoadRSAPrivateKey(pemStr); err == nil {
+		return &priv.PublicKey, nil
+	}
+
+	block, _ := pem.Decode([]byte(pemStr))
+	if block == nil {
+		return nil, errors.New("failed to parse PEM block")
+	}
+
+	// Try PKCS1
+	if pub, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return pub, nil
+	}
+
+	// Try PKIX
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not an RSA public key")
+	}
+
+	return rsaPub, nil
+}
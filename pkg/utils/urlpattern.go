@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// URL patterns let OAuth clients register origins and redirect URIs with a
+// wildcard host label, e.g. https://*.example.com. The wildcard is only
+// accepted as the whole leftmost label of an https host whose other labels
+// form a registrable domain or a name below one, never a public suffix such
+// as co.uk or github.io. It matches exactly one DNS label, so
+// https://*.example.com matches https://a.example.com but neither
+// https://example.com nor https://a.b.example.com. Scheme, port, path and
+// query must match exactly.
+
+// IsURLPattern reports whether s contains a wildcard
+func IsURLPattern(s string) bool {
+	return strings.Contains(s, "*")
+}
+
+// ValidateOriginPattern checks an origin, scheme://host[:port], that may
+// have a wildcard host label
+func ValidateOriginPattern(pattern string) error {
+	u, err := url.Parse(pattern)
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Opaque != "" {
+		return fmt.Errorf("%q is not an origin", pattern)
+	}
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return fmt.Errorf("origin %q must not have a path, query, fragment or credentials", pattern)
+	}
+	return validatePatternHost(pattern, u)
+}
+
+// ValidateRedirectPattern checks a redirect URI with a wildcard host label.
+// Redirect URIs without a wildcard are matched verbatim and not checked here.
+func ValidateRedirectPattern(pattern string) error {
+	u, err := url.Parse(pattern)
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Opaque != "" {
+		return fmt.Errorf("%q is not an absolute URL", pattern)
+	}
+	if u.Fragment != "" || u.User != nil {
+		return fmt.Errorf("redirect URI %q must not have a fragment or credentials", pattern)
+	}
+	if strings.Contains(u.Path, "*") || strings.Contains(u.RawQuery, "*") {
+		return fmt.Errorf("redirect URI %q may only have a wildcard in its host", pattern)
+	}
+	return validatePatternHost(pattern, u)
+}
+
+func validatePatternHost(pattern string, u *url.URL) error {
+	host := u.Hostname()
+	if !IsURLPattern(host) {
+		if u.Scheme != "https" && !isLoopback(host) {
+			return fmt.Errorf("%q must use https", pattern)
+		}
+		return nil
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("wildcard %q must use https", pattern)
+	}
+	labels := strings.Split(host, ".")
+	if labels[0] != "*" || IsURLPattern(strings.Join(labels[1:], ".")) {
+		return fmt.Errorf("%q may only use * as the whole leftmost host label", pattern)
+	}
+	for _, label := range labels[1:] {
+		if !isHostLabel(label) {
+			return fmt.Errorf("%q has an invalid host", pattern)
+		}
+	}
+	// A wildcard directly below a public suffix would match domains of
+	// unrelated owners. EffectiveTLDPlusOne fails for public suffixes, and
+	// for single labels under the default * rule.
+	if _, err := publicsuffix.EffectiveTLDPlusOne(strings.ToLower(strings.Join(labels[1:], "."))); err != nil {
+		return fmt.Errorf("wildcard %q must be below a registrable domain, e.g. https://*.example.com", pattern)
+	}
+	return nil
+}
+
+// MatchOrigin reports whether origin matches pattern, an origin that may have
+// a wildcard host label
+func MatchOrigin(pattern, origin string) bool {
+	if !IsURLPattern(pattern) {
+		return strings.EqualFold(strings.TrimSuffix(pattern, "/"), origin)
+	}
+	p, err := url.Parse(pattern)
+	if err != nil {
+		return false
+	}
+	u, err := url.Parse(origin)
+	if err != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+		return false
+	}
+	return matchSchemeHost(p, u)
+}
+
+// MatchRedirectURI reports whether uri matches pattern. Patterns without a
+// wildcard must equal uri.
+func MatchRedirectURI(pattern, uri string) bool {
+	if !IsURLPattern(pattern) {
+		return pattern == uri
+	}
+	p, err := url.Parse(pattern)
+	if err != nil {
+		return false
+	}
+	u, err := url.Parse(uri)
+	if err != nil || u.User != nil || u.Fragment != "" || u.Opaque != "" {
+		return false
+	}
+	return matchSchemeHost(p, u) && p.EscapedPath() == u.EscapedPath() && p.RawQuery == u.RawQuery
+}
+
+func matchSchemeHost(pattern, u *url.URL) bool {
+	if pattern.Scheme != u.Scheme || pattern.Port() != u.Port() {
+		return false
+	}
+	suffix := strings.TrimPrefix(strings.ToLower(pattern.Hostname()), "*")
+	host := strings.ToLower(u.Hostname())
+	if !strings.HasPrefix(pattern.Hostname(), "*.") || !strings.HasSuffix(host, suffix) {
+		return false
+	}
+	return isHostLabel(strings.TrimSuffix(host, suffix))
+}
+
+// isHostLabel reports whether s is a single DNS label
+func isHostLabel(s string) bool {
+	if s == "" || len(s) > 63 || s[0] == '-' || s[len(s)-1] == '-' {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
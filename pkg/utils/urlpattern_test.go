@@ -0,0 +1,100 @@
+package utils
+
+import "testing"
+
+func TestValidateOriginPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		valid   bool
+	}{
+		{"https://app.example.com", true},
+		{"https://*.example.com", true},
+		{"https://*.example.com:8443", true},
+		{"http://localhost:3000", true},
+		{"http://app.example.com", false},
+		{"http://*.example.com", false},
+		{"https://*.com", false},
+		{"https://*.co.uk", false},
+		{"https://*.CO.UK", false},
+		{"https://*.github.io", false},
+		{"https://*.s3.amazonaws.com", false},
+		{"https://*.example.co.uk", true},
+		{"https://*.myapp.github.io", true},
+		{"https://*.corp", false},
+		{"https://a.*.example.com", false},
+		{"https://*a.example.com", false},
+		{"https://*.*.example.com", false},
+		{"https://*.example.com/path", false},
+		{"https://user@*.example.com", false},
+		{"*", false},
+	}
+	for _, tt := range tests {
+		if err := ValidateOriginPattern(tt.pattern); (err == nil) != tt.valid {
+			t.Errorf("ValidateOriginPattern(%q) = %v, want valid %v", tt.pattern, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateRedirectPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		valid   bool
+	}{
+		{"https://*.example.com/callback", true},
+		{"https://*.example.com/callback?mode=web", true},
+		{"https://*.example.com/*", false},
+		{"https://*.example.com/callback#frag", false},
+		{"https://*.co/callback", false},
+		{"http://*.example.com/callback", false},
+	}
+	for _, tt := range tests {
+		if err := ValidateRedirectPattern(tt.pattern); (err == nil) != tt.valid {
+			t.Errorf("ValidateRedirectPattern(%q) = %v, want valid %v", tt.pattern, err, tt.valid)
+		}
+	}
+}
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		pattern, origin string
+		want            bool
+	}{
+		{"https://app.example.com", "https://app.example.com", true},
+		{"https://app.example.com", "https://APP.example.com", true},
+		{"https://*.example.com", "https://pr-42.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://a.b.example.com", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"https://*.example.com", "https://a.example.com.evil.io", false},
+		{"https://*.example.com", "http://a.example.com", false},
+		{"https://*.example.com", "https://a.example.com:8443", false},
+		{"https://*.example.com:8443", "https://a.example.com:8443", true},
+		{"https://*.example.com", "https://a_b.example.com", false},
+	}
+	for _, tt := range tests {
+		if got := MatchOrigin(tt.pattern, tt.origin); got != tt.want {
+			t.Errorf("MatchOrigin(%q, %q) = %v, want %v", tt.pattern, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestMatchRedirectURI(t *testing.T) {
+	tests := []struct {
+		pattern, uri string
+		want         bool
+	}{
+		{"myapp://callback", "myapp://callback", true},
+		{"https://app.example.com/cb", "https://app.example.com/cb/", false},
+		{"https://*.example.com/cb", "https://pr-1.example.com/cb", true},
+		{"https://*.example.com/cb", "https://pr-1.example.com/cb/../admin", false},
+		{"https://*.example.com/cb", "https://pr-1.example.com/cb?next=x", false},
+		{"https://*.example.com/cb", "https://pr-1.example.com/cb#x", false},
+		{"https://*.example.com/cb", "https://u@pr-1.example.com/cb", false},
+		{"https://*.example.com/cb", "https://x.pr-1.example.com/cb", false},
+	}
+	for _, tt := range tests {
+		if got := MatchRedirectURI(tt.pattern, tt.uri); got != tt.want {
+			t.Errorf("MatchRedirectURI(%q, %q) = %v, want %v", tt.pattern, tt.uri, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// YAMLToJSON converts a YAML 1.2 document to JSON, so that it can be
+// decoded like a JSON request body. Mapping keys must be strings, as JSON
+// object keys are; JSON documents, being YAML too, come out as they went in.
+func YAMLToJSON(data []byte) ([]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+	value, err := jsonValue(doc, "")
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// jsonValue checks that the mappings in v have string keys, turning those
+// yaml.v3 decodes as map[interface{}]interface{} into maps with string
+// keys. path locates v in errors.
+func jsonValue(v interface{}, path string) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			value, err := jsonValue(item, path+"."+key)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = value
+		}
+		return v, nil
+	case map[interface{}]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid YAML: key %v of %s is not a string", k, pathOrRoot(path))
+			}
+			value, err := jsonValue(item, path+"."+key)
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = value
+		}
+		return obj, nil
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, item := range v {
+			value, err := jsonValue(item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = value
+		}
+		return arr, nil
+	}
+	return v, nil
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "the document"
+	}
+	return path[1:]
+}
@@ -0,0 +1,32 @@
+package utils
+
+import "testing"
+
+func TestYAMLToJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"mappings and sequences", "roles:\n  - external_id: ops\n    spec:\n      name: Ops\n      tags: {team: sre}\n", `{"roles":[{"external_id":"ops","spec":{"name":"Ops","tags":{"team":"sre"}}}]}`},
+		{"scalars", "n: 3\nf: 0.5\nb: true\nnothing: null\ns: \"042\"\n", `{"b":true,"f":0.5,"n":3,"nothing":null,"s":"042"}`},
+		{"json", `{"a": [1, {"b": "c"}]}`, `{"a":[1,{"b":"c"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := YAMLToJSON([]byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("YAMLToJSON = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	for _, in := range []string{"a: [1, 2", "list:\n  - {1: one}\n"} {
+		if _, err := YAMLToJSON([]byte(in)); err == nil {
+			t.Errorf("YAMLToJSON(%q) succeeded", in)
+		}
+	}
+}
@@ -11,32 +11,30 @@ interface ClientInfo {
     logo_url: string;
     policy_uri: string;
     tos_uri: string;
+    scope: string;
 }
 
 const ConsentPage = () => {
     const [searchParams] = useSearchParams();
 
-
-    const clientId = searchParams.get('client_id');
-    const scope = searchParams.get('scope') || '';
-    const state = searchParams.get('state') || '';
-    const nonce = searchParams.get('nonce') || '';
-    const redirectUri = searchParams.get('redirect_uri') || '';
+    // The authorization request stays on the server; the page only gets
+    // its request_uri
+    const requestUri = searchParams.get('request_uri');
 
     const [clientInfo, setClientInfo] = useState<ClientInfo | null>(null);
     const [isLoading, setIsLoading] = useState(true);
     const [error, setError] = useState('');
 
     useEffect(() => {
-        if (!clientId) {
-            setError('Missing client_id');
+        if (!requestUri) {
+            setError('Missing request_uri');
             setIsLoading(false);
             return;
         }
 
         const fetchClientInfo = async () => {
             try {
-                const { data } = await client.get(`/oauth2/client-info?client_id=${clientId}`);
+                const { data } = await client.get('/oauth2/client-info', { params: { request_uri: requestUri } });
                 setClientInfo(data);
             } catch (err: any) {
                 console.error(err);
@@ -47,17 +45,13 @@ const ConsentPage = () => {
         };
 
         fetchClientInfo();
-    }, [clientId]);
+    }, [requestUri]);
 
     const handleDecision = async (decision: 'allow' | 'deny') => {
         setIsLoading(true);
         try {
             const payload = {
-                client_id: clientId,
-                scope,
-                state,
-                nonce,
-                redirect_uri: redirectUri,
+                request_uri: requestUri,
                 decision
             };
             const { data } = await client.post('/oauth2/consent', payload);
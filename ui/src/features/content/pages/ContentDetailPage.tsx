@@ -94,6 +94,7 @@ const ContentDetailPage = () => {
             body: content.body,
             summary: content.summary,
             cover_image_url: content.cover_image_url,
+            lock_version: content.lock_version,
         });
         setShowEditModal(true);
     };
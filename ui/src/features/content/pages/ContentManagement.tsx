@@ -110,6 +110,7 @@ const ContentManagement = () => {
             body: item.body,
             summary: item.summary,
             cover_image_url: item.cover_image_url,
+            lock_version: item.lock_version,
         });
         setShowEditModal(true);
     };
@@ -15,6 +15,7 @@ export interface ContentItem {
     published_at?: string | null;
     created_at: string;
     updated_at: string;
+    lock_version?: number; // send back with updates
 }
 
 export interface ContentCollaborator {
@@ -46,6 +47,7 @@ export interface UpdateContentRequest {
     cover_image_url?: string;
     tags?: string;
     metadata?: string;
+    lock_version?: number; // version the edit is based on
 }
 
 export const CONTENT_TYPES = [
@@ -219,14 +219,16 @@ const DocumentationPage = () => {
 
                                 <div className="space-y-4">
                                     <h4 className="text-white font-bold">Step 2: Authorization Code Flow</h4>
-                                    <p className="text-sm text-gray-400">Redirect your users to our authorize endpoint to start the login process.</p>
+                                    <p className="text-sm text-gray-400">Redirect your users to our authorize endpoint to start the login process. Public clients must use PKCE: send the S256 challenge of a random code verifier, and the verifier when exchanging the code.</p>
                                     <div className="bg-slate-900 rounded-xl border border-border-color-dark p-4 font-mono text-xs overflow-x-auto text-gray-300">
                                         {`GET /oauth2/authorize?
   client_id=YOUR_CLIENT_ID&
   response_type=code&
   scope=openid profile email&
   redirect_uri=YOUR_REDIRECT_URI&
-  state=RANDOM_STATE`}
+  state=RANDOM_STATE&
+  code_challenge=BASE64URL_SHA256_OF_VERIFIER&
+  code_challenge_method=S256`}
                                     </div>
                                 </div>
 
@@ -243,6 +245,7 @@ const DocumentationPage = () => {
   "grant_type": "authorization_code",
   "client_id": "CLIENT_ID",
   "code": "CODE",
+  "code_verifier": "CODE_VERIFIER",
   "redirect_uri": "REDIRECT_URI"
 }`}
                                             </div>
@@ -18,6 +18,7 @@ export interface Policy {
     approved_by?: string | null;
     approved_at?: string | null;
     deleted_at?: string | null;
+    lock_version?: number;
 }
 
 export const policyKeys = {
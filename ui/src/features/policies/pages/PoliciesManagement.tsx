@@ -91,7 +91,7 @@ const PoliciesManagement = () => {
         if (!selectedPolicy) return;
         try {
             const documentObj = JSON.parse(editPolicyData.document);
-            updatePolicyMutation.mutate({ id: selectedPolicy.id, data: { ...editPolicyData, document: documentObj } }, {
+            updatePolicyMutation.mutate({ id: selectedPolicy.id, data: { ...editPolicyData, document: documentObj, lock_version: selectedPolicy.lock_version } }, {
                 onSuccess: () => {
                     setShowEditModal(false);
                     setSelectedPolicy(null);
@@ -173,6 +173,7 @@ const CreatePolicy = () => {
             is_system_policy: isSystemPolicy,
             status: status.toLowerCase(),
             document: documentJson,
+            lock_version: existingPolicy?.lock_version,
         };
 
         try {
@@ -27,6 +27,7 @@ export interface Policy {
     created_at: string;
     updated_at: string;
     deleted_at: string;
+    lock_version?: number;
 }
 
 export interface CreatePolicyRequest {
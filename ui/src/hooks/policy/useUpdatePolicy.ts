@@ -12,6 +12,7 @@ export const useUpdatePolicy = () => {
         mutationFn: updatePolicy,
         onSuccess: () => {
             queryClient.invalidateQueries({ queryKey: ['policies'] });
+            queryClient.invalidateQueries({ queryKey: ['policy'] });
         },
     });
 };
\ No newline at end of file
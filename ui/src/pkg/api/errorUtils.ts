@@ -1,18 +1,18 @@
 import { AxiosError } from 'axios';
 
-interface APIErrorData {
+export interface APIErrorData {
     success?: boolean;
+    code?: string;
     error?: string;
     message?: string;
-    status?: number;
+    details?: unknown;
+    request_id?: string;
 }
 
 /**
  * Extracts a human-readable error message from an API error response.
- * Handles all three backend response formats:
- *   Format A: { status, error, message }
- *   Format B: { success, error, message }
- *   Format C: { error }
+ * The backend returns { success, code, error, message, details, request_id };
+ * OAuth2 protocol endpoints return { error, error_description }.
  */
 export function extractErrorMessage(error: unknown, fallback = 'An unexpected error occurred'): string {
     if (error instanceof AxiosError && error.response?.data) {
@@ -28,6 +28,17 @@ export function extractErrorMessage(error: unknown, fallback = 'An unexpected er
     return fallback;
 }
 
+/**
+ * Extracts the machine-readable error code (see GET /public/error-codes).
+ */
+export function extractErrorCode(error: unknown): string | undefined {
+    if (error instanceof AxiosError && error.response?.data) {
+        const data = error.response.data as APIErrorData;
+        return data.code || data.error;
+    }
+    return undefined;
+}
+
 /**
  * Extracts the HTTP status code from an API error.
  */